@@ -0,0 +1,38 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_file
+// +build !no_file
+
+package main
+
+import (
+	"mosn.io/layotto/components/file"
+	"mosn.io/layotto/components/file/local"
+	"mosn.io/layotto/components/file/s3/alicloud"
+	"mosn.io/layotto/components/file/s3/aws"
+	"mosn.io/layotto/components/file/s3/minio"
+	"mosn.io/layotto/pkg/runtime"
+)
+
+// File components, which are compiled out with the build tag no_file
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithFileFactory(
+			file.NewFileFactory("aliOSS", alicloud.NewAliCloudOSS),
+			file.NewFileFactory("minioOSS", minio.NewMinioOss),
+			file.NewFileFactory("awsOSS", aws.NewAwsOss),
+			file.NewFileFactory("local", local.NewLocalStore),
+		),
+	)
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_hello
+// +build !no_hello
+
+package main
+
+import (
+	"mosn.io/layotto/components/hello"
+	"mosn.io/layotto/components/hello/helloworld"
+	"mosn.io/layotto/pkg/runtime"
+)
+
+// Hello components, which are compiled out with the build tag no_hello
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithHelloFactory(
+			hello.NewHelloFactory("helloworld", helloworld.NewHelloWorld),
+		),
+	)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_pubsub
+// +build !no_pubsub
+
+package main
+
+import (
+	dapr_comp_pubsub "github.com/dapr/components-contrib/pubsub"
+	pubsub_snssqs "github.com/dapr/components-contrib/pubsub/aws/snssqs"
+	pubsub_eventhubs "github.com/dapr/components-contrib/pubsub/azure/eventhubs"
+	"github.com/dapr/components-contrib/pubsub/azure/servicebus"
+	pubsub_gcp "github.com/dapr/components-contrib/pubsub/gcp/pubsub"
+	pubsub_hazelcast "github.com/dapr/components-contrib/pubsub/hazelcast"
+	pubsub_inmemory "github.com/dapr/components-contrib/pubsub/in-memory"
+	pubsub_kafka "github.com/dapr/components-contrib/pubsub/kafka"
+	pubsub_mqtt "github.com/dapr/components-contrib/pubsub/mqtt"
+	"github.com/dapr/components-contrib/pubsub/natsstreaming"
+	pubsub_pulsar "github.com/dapr/components-contrib/pubsub/pulsar"
+	"github.com/dapr/components-contrib/pubsub/rabbitmq"
+	pubsub_redis "github.com/dapr/components-contrib/pubsub/redis"
+
+	"mosn.io/layotto/pkg/runtime"
+	"mosn.io/layotto/pkg/runtime/pubsub"
+	runtime_pubsub_amqp "mosn.io/layotto/pkg/runtime/pubsub/amqp"
+	runtime_pubsub_gcp "mosn.io/layotto/pkg/runtime/pubsub/gcp"
+	runtime_pubsub_kafka "mosn.io/layotto/pkg/runtime/pubsub/kafka"
+	runtime_pubsub_rabbitmq "mosn.io/layotto/pkg/runtime/pubsub/rabbitmq"
+	runtime_pubsub_snssqs "mosn.io/layotto/pkg/runtime/pubsub/snssqs"
+)
+
+// PubSub components, which are compiled out with the build tag no_pubsub
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithPubSubFactory(
+			pubsub.NewFactory("redis", func() dapr_comp_pubsub.PubSub {
+				return pubsub_redis.NewRedisStreams(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("natsstreaming", func() dapr_comp_pubsub.PubSub {
+				return natsstreaming.NewNATSStreamingPubSub(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("azure.eventhubs", func() dapr_comp_pubsub.PubSub {
+				return pubsub_eventhubs.NewAzureEventHubs(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("azure.servicebus", func() dapr_comp_pubsub.PubSub {
+				return servicebus.NewAzureServiceBus(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("amqp", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_amqp.NewAMQP()
+			}),
+			pubsub.NewFactory("rabbitmq", func() dapr_comp_pubsub.PubSub {
+				return rabbitmq.NewRabbitMQ(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("layotto.rabbitmq", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_rabbitmq.NewRabbitMQ()
+			}),
+			pubsub.NewFactory("hazelcast", func() dapr_comp_pubsub.PubSub {
+				return pubsub_hazelcast.NewHazelcastPubSub(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("gcp.pubsub", func() dapr_comp_pubsub.PubSub {
+				return pubsub_gcp.NewGCPPubSub(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("layotto.gcp.pubsub", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_gcp.NewGCPPubSub()
+			}),
+			pubsub.NewFactory("kafka", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_kafka.NewReplayable(pubsub_kafka.NewKafka(loggerForDaprComp))
+			}),
+			pubsub.NewFactory("snssqs", func() dapr_comp_pubsub.PubSub {
+				return pubsub_snssqs.NewSnsSqs(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("layotto.snssqs", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_snssqs.NewSnsSqs()
+			}),
+			pubsub.NewFactory("mqtt", func() dapr_comp_pubsub.PubSub {
+				return pubsub_mqtt.NewMQTTPubSub(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("pulsar", func() dapr_comp_pubsub.PubSub {
+				return pubsub_pulsar.NewPulsar(loggerForDaprComp)
+			}),
+			pubsub.NewFactory("in-memory", func() dapr_comp_pubsub.PubSub {
+				return pubsub_inmemory.New(loggerForDaprComp)
+			}),
+		),
+	)
+}
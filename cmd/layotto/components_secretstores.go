@@ -0,0 +1,64 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_secretstores
+// +build !no_secretstores
+
+package main
+
+import (
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/dapr/components-contrib/secretstores/aws/parameterstore"
+	"github.com/dapr/components-contrib/secretstores/azure/keyvault"
+	gcp_secretmanager "github.com/dapr/components-contrib/secretstores/gcp/secretmanager"
+	"github.com/dapr/components-contrib/secretstores/hashicorp/vault"
+	secretstore_env "github.com/dapr/components-contrib/secretstores/local/env"
+	secretstore_file "github.com/dapr/components-contrib/secretstores/local/file"
+
+	"mosn.io/layotto/pkg/runtime"
+	secretstores_loader "mosn.io/layotto/pkg/runtime/secretstores"
+	runtime_secretstores_kubernetes "mosn.io/layotto/pkg/runtime/secretstores/kubernetes"
+	runtime_secretstores_secretmanager "mosn.io/layotto/pkg/runtime/secretstores/secretmanager"
+)
+
+// Secret stores components, which are compiled out with the build tag no_secretstores
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithSecretStoresFactory(
+			secretstores_loader.NewFactory("kubernetes", func() secretstores.SecretStore {
+				return runtime_secretstores_kubernetes.NewSecretStore()
+			}),
+			secretstores_loader.NewFactory("azure.keyvault", func() secretstores.SecretStore {
+				return keyvault.NewAzureKeyvaultSecretStore(loggerForDaprComp)
+			}),
+			secretstores_loader.NewFactory("hashicorp.vault", func() secretstores.SecretStore {
+				return vault.NewHashiCorpVaultSecretStore(loggerForDaprComp)
+			}),
+			secretstores_loader.NewFactory("aws.secretmanager", func() secretstores.SecretStore {
+				return runtime_secretstores_secretmanager.NewSecretManager()
+			}),
+			secretstores_loader.NewFactory("aws.parameterstore", func() secretstores.SecretStore {
+				return parameterstore.NewParameterStore(loggerForDaprComp)
+			}),
+			secretstores_loader.NewFactory("gcp.secretmanager", func() secretstores.SecretStore {
+				return gcp_secretmanager.NewSecreteManager(loggerForDaprComp)
+			}),
+			secretstores_loader.NewFactory("local.file", func() secretstores.SecretStore {
+				return secretstore_file.NewLocalSecretStore(loggerForDaprComp)
+			}),
+			secretstores_loader.NewFactory("local.env", func() secretstores.SecretStore {
+				return secretstore_env.NewEnvSecretStore(loggerForDaprComp)
+			}),
+		),
+	)
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_sequencer
+// +build !no_sequencer
+
+package main
+
+import (
+	"mosn.io/layotto/components/sequencer"
+	sequencer_etcd "mosn.io/layotto/components/sequencer/etcd"
+	sequencer_mongo "mosn.io/layotto/components/sequencer/mongo"
+	sequencer_redis "mosn.io/layotto/components/sequencer/redis"
+	sequencer_zookeeper "mosn.io/layotto/components/sequencer/zookeeper"
+	"mosn.io/layotto/pkg/runtime"
+	runtime_sequencer "mosn.io/layotto/pkg/runtime/sequencer"
+	"mosn.io/pkg/log"
+)
+
+// Sequencer components, which are compiled out with the build tag no_sequencer
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithSequencerFactory(
+			runtime_sequencer.NewFactory("etcd", func() sequencer.Store {
+				return sequencer_etcd.NewEtcdSequencer(log.DefaultLogger)
+			}),
+			runtime_sequencer.NewFactory("redis", func() sequencer.Store {
+				return sequencer_redis.NewStandaloneRedisSequencer(log.DefaultLogger)
+			}),
+			runtime_sequencer.NewFactory("zookeeper", func() sequencer.Store {
+				return sequencer_zookeeper.NewZookeeperSequencer(log.DefaultLogger)
+			}),
+			runtime_sequencer.NewFactory("mongo", func() sequencer.Store {
+				return sequencer_mongo.NewMongoSequencer(log.DefaultLogger)
+			}),
+		),
+	)
+}
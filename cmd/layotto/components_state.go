@@ -0,0 +1,118 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_state
+// +build !no_state
+
+package main
+
+import (
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/components-contrib/state/aerospike"
+	state_dynamodb "github.com/dapr/components-contrib/state/aws/dynamodb"
+	state_azure_blobstorage "github.com/dapr/components-contrib/state/azure/blobstorage"
+	state_cosmosdb "github.com/dapr/components-contrib/state/azure/cosmosdb"
+	state_azure_tablestorage "github.com/dapr/components-contrib/state/azure/tablestorage"
+	"github.com/dapr/components-contrib/state/cassandra"
+	"github.com/dapr/components-contrib/state/cloudstate"
+	"github.com/dapr/components-contrib/state/couchbase"
+	"github.com/dapr/components-contrib/state/gcp/firestore"
+	"github.com/dapr/components-contrib/state/hashicorp/consul"
+	"github.com/dapr/components-contrib/state/hazelcast"
+	"github.com/dapr/components-contrib/state/memcached"
+	"github.com/dapr/components-contrib/state/mongodb"
+	state_mysql "github.com/dapr/components-contrib/state/mysql"
+	"github.com/dapr/components-contrib/state/postgresql"
+	"github.com/dapr/components-contrib/state/rethinkdb"
+	"github.com/dapr/components-contrib/state/sqlserver"
+	"github.com/dapr/components-contrib/state/zookeeper"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+	"mosn.io/layotto/pkg/runtime"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtime_state_mysql "mosn.io/layotto/pkg/runtime/state/mysql"
+	runtime_state_postgresql "mosn.io/layotto/pkg/runtime/state/postgresql"
+	runtime_state_redis "mosn.io/layotto/pkg/runtime/state/redis"
+)
+
+// State components, which are compiled out with the build tag no_state
+func init() {
+	componentOptions = append(componentOptions,
+		runtime.WithStateFactory(
+			runtime_state.NewFactory("in-memory", func() state.Store {
+				return mock_state.New(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("redis", func() state.Store {
+				return runtime_state_redis.NewRedisStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("consul", func() state.Store {
+				return consul.NewConsulStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("azure.blobstorage", func() state.Store {
+				return state_azure_blobstorage.NewAzureBlobStorageStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("azure.cosmosdb", func() state.Store {
+				return state_cosmosdb.NewCosmosDBStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("azure.tablestorage", func() state.Store {
+				return state_azure_tablestorage.NewAzureTablesStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("cassandra", func() state.Store {
+				return cassandra.NewCassandraStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("memcached", func() state.Store {
+				return memcached.NewMemCacheStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("mongodb", func() state.Store {
+				return mongodb.NewMongoDB(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("zookeeper", func() state.Store {
+				return zookeeper.NewZookeeperStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("gcp.firestore", func() state.Store {
+				return firestore.NewFirestoreStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("postgresql", func() state.Store {
+				return postgresql.NewPostgreSQLStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("sqlserver", func() state.Store {
+				return sqlserver.NewSQLServerStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("hazelcast", func() state.Store {
+				return hazelcast.NewHazelcastStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("cloudstate.crdt", func() state.Store {
+				return cloudstate.NewCRDT(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("couchbase", func() state.Store {
+				return couchbase.NewCouchbaseStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("aerospike", func() state.Store {
+				return aerospike.NewAerospikeStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("rethinkdb", func() state.Store {
+				return rethinkdb.NewRethinkDBStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("aws.dynamodb", state_dynamodb.NewDynamoDBStateStore),
+			runtime_state.NewFactory("mysql", func() state.Store {
+				return state_mysql.NewMySQLStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("mysql.outbox", func() state.Store {
+				return runtime_state_mysql.NewMySQLStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("postgresql.jsonb", func() state.Store {
+				return runtime_state_postgresql.NewPostgreSQLStateStore(loggerForDaprComp)
+			}),
+		),
+	)
+}
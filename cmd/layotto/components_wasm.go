@@ -0,0 +1,23 @@
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !no_wasm
+// +build !no_wasm
+
+package main
+
+// WASM filter and its runtime, which are compiled out with the build tag no_wasm
+import (
+	_ "mosn.io/layotto/pkg/wasm"
+	_ "mosn.io/mosn/pkg/wasm/runtime/wasmer"
+)
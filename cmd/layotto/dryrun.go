@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"mosn.io/layotto/pkg/runtime"
+)
+
+// mosnConfig is the part of the mosn config locating the runtime configs
+type mosnConfig struct {
+	Servers []struct {
+		Listeners []struct {
+			Name         string `json:"name"`
+			FilterChains []struct {
+				Filters []struct {
+					Type   string `json:"type"`
+					Config struct {
+						ServerName string          `json:"server_name"`
+						GrpcConfig json.RawMessage `json:"grpc_config"`
+					} `json:"config"`
+				} `json:"filters"`
+			} `json:"filter_chains"`
+		} `json:"listeners"`
+	} `json:"servers"`
+}
+
+// dryRun validates the runtime configs in the config file, prints the problems found and returns the exit code
+func dryRun(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("read config %s error: %v\n", path, err)
+		return 1
+	}
+	var cfg mosnConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("%s: illegal json: %v\n", path, err)
+		return 1
+	}
+	found, problems := 0, 0
+	from := 0
+	for _, server := range cfg.Servers {
+		for _, listener := range server.Listeners {
+			for _, chain := range listener.FilterChains {
+				for _, filter := range chain.Filters {
+					if filter.Type != "grpc" || filter.Config.ServerName != "runtime" || len(filter.Config.GrpcConfig) == 0 {
+						continue
+					}
+					found++
+					raw := filter.Config.GrpcConfig
+					// the raw config is a copy of the bytes in the file, so the lines are counted from where it starts
+					baseLine, located := 0, false
+					if i := bytes.Index(data[from:], raw); i >= 0 {
+						baseLine, located = bytes.Count(data[:from+i], []byte("\n")), true
+						from += i + len(raw)
+					}
+					for _, d := range runtime.ValidateRuntimeConfig(raw, componentOptions...) {
+						problems++
+						if !located {
+							d.Line = 0
+						} else if d.Line > 0 {
+							d.Line += baseLine
+						}
+						fmt.Printf("%s: listener %s: %s\n", path, listener.Name, d)
+					}
+				}
+			}
+		}
+	}
+	if found == 0 {
+		fmt.Printf("%s: no runtime config is found, which is the grpc_config of the grpc filter with server_name runtime\n", path)
+		return 1
+	}
+	if problems > 0 {
+		fmt.Printf("%s: %d problems found\n", path, problems)
+		return 1
+	}
+	fmt.Printf("%s: the runtime config is valid\n", path)
+	return 0
+}
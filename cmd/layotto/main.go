@@ -19,118 +19,29 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/dapr/components-contrib/secretstores"
-	"github.com/dapr/components-contrib/secretstores/aws/parameterstore"
-	"github.com/dapr/components-contrib/secretstores/aws/secretmanager"
-	"github.com/dapr/components-contrib/secretstores/azure/keyvault"
-	gcp_secretmanager "github.com/dapr/components-contrib/secretstores/gcp/secretmanager"
-	"github.com/dapr/components-contrib/secretstores/hashicorp/vault"
-	sercetstores_kubernetes "github.com/dapr/components-contrib/secretstores/kubernetes"
-	secretstore_env "github.com/dapr/components-contrib/secretstores/local/env"
-	secretstore_file "github.com/dapr/components-contrib/secretstores/local/file"
 	"mosn.io/api"
 	"mosn.io/layotto/diagnostics"
+	_ "mosn.io/layotto/diagnostics/exporter_iml"
 	"mosn.io/layotto/pkg/grpc/default_api"
-	secretstores_loader "mosn.io/layotto/pkg/runtime/secretstores"
 	"os"
 	"strconv"
 	"time"
 
-	"mosn.io/layotto/components/file/local"
-	"mosn.io/layotto/components/file/s3/alicloud"
-	"mosn.io/layotto/components/file/s3/aws"
-	"mosn.io/layotto/components/file/s3/minio"
-
-	mock_state "mosn.io/layotto/pkg/mock/components/state"
-
-	dbindings "github.com/dapr/components-contrib/bindings"
-	"github.com/dapr/components-contrib/bindings/http"
-	"mosn.io/layotto/components/configstores/etcdv3"
-	"mosn.io/layotto/components/file"
-	"mosn.io/layotto/components/sequencer"
-	"mosn.io/layotto/pkg/runtime/bindings"
-	runtime_sequencer "mosn.io/layotto/pkg/runtime/sequencer"
-	"mosn.io/pkg/log"
-
-	// Hello
-	"mosn.io/layotto/components/hello"
-	"mosn.io/layotto/components/hello/helloworld"
-
-	// Configuration
-	"mosn.io/layotto/components/configstores"
-	"mosn.io/layotto/components/configstores/apollo"
-
-	// Pub/Sub
-	dapr_comp_pubsub "github.com/dapr/components-contrib/pubsub"
-	pubsub_snssqs "github.com/dapr/components-contrib/pubsub/aws/snssqs"
-	pubsub_eventhubs "github.com/dapr/components-contrib/pubsub/azure/eventhubs"
-	"github.com/dapr/components-contrib/pubsub/azure/servicebus"
-	pubsub_gcp "github.com/dapr/components-contrib/pubsub/gcp/pubsub"
-	pubsub_hazelcast "github.com/dapr/components-contrib/pubsub/hazelcast"
-	pubsub_inmemory "github.com/dapr/components-contrib/pubsub/in-memory"
-	pubsub_kafka "github.com/dapr/components-contrib/pubsub/kafka"
-	pubsub_mqtt "github.com/dapr/components-contrib/pubsub/mqtt"
-	"github.com/dapr/components-contrib/pubsub/natsstreaming"
-	pubsub_pulsar "github.com/dapr/components-contrib/pubsub/pulsar"
-	"github.com/dapr/components-contrib/pubsub/rabbitmq"
-	pubsub_redis "github.com/dapr/components-contrib/pubsub/redis"
 	"github.com/dapr/kit/logger"
-	"mosn.io/layotto/pkg/runtime/pubsub"
-
-	// RPC
-	"mosn.io/layotto/components/rpc"
-	mosninvoker "mosn.io/layotto/components/rpc/invoker/mosn"
-
-	// State Stores
-	"github.com/dapr/components-contrib/state"
-	"github.com/dapr/components-contrib/state/aerospike"
-	state_dynamodb "github.com/dapr/components-contrib/state/aws/dynamodb"
-	state_azure_blobstorage "github.com/dapr/components-contrib/state/azure/blobstorage"
-	state_cosmosdb "github.com/dapr/components-contrib/state/azure/cosmosdb"
-	state_azure_tablestorage "github.com/dapr/components-contrib/state/azure/tablestorage"
-	"github.com/dapr/components-contrib/state/cassandra"
-	"github.com/dapr/components-contrib/state/cloudstate"
-	"github.com/dapr/components-contrib/state/couchbase"
-	"github.com/dapr/components-contrib/state/gcp/firestore"
-	"github.com/dapr/components-contrib/state/hashicorp/consul"
-	"github.com/dapr/components-contrib/state/hazelcast"
-	"github.com/dapr/components-contrib/state/memcached"
-	"github.com/dapr/components-contrib/state/mongodb"
-	state_mysql "github.com/dapr/components-contrib/state/mysql"
-	"github.com/dapr/components-contrib/state/postgresql"
-	state_redis "github.com/dapr/components-contrib/state/redis"
-	"github.com/dapr/components-contrib/state/rethinkdb"
-	"github.com/dapr/components-contrib/state/sqlserver"
-	"github.com/dapr/components-contrib/state/zookeeper"
-	runtime_state "mosn.io/layotto/pkg/runtime/state"
-
-	// Lock
-	"mosn.io/layotto/components/lock"
-	lock_consul "mosn.io/layotto/components/lock/consul"
-	lock_etcd "mosn.io/layotto/components/lock/etcd"
-	lock_mongo "mosn.io/layotto/components/lock/mongo"
-	lock_redis "mosn.io/layotto/components/lock/redis"
-	lock_zookeeper "mosn.io/layotto/components/lock/zookeeper"
-	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
-
-	// Sequencer
-	sequencer_etcd "mosn.io/layotto/components/sequencer/etcd"
-	sequencer_mongo "mosn.io/layotto/components/sequencer/mongo"
-	sequencer_redis "mosn.io/layotto/components/sequencer/redis"
-	sequencer_zookeeper "mosn.io/layotto/components/sequencer/zookeeper"
 
 	// Actuator
 	_ "mosn.io/layotto/pkg/actuator"
 	"mosn.io/layotto/pkg/actuator/health"
 	actuatorInfo "mosn.io/layotto/pkg/actuator/info"
+	actuatorLogger "mosn.io/layotto/pkg/actuator/logger"
 	_ "mosn.io/layotto/pkg/filter/stream/actuator/http"
 	"mosn.io/layotto/pkg/integrate/actuator"
 
 	"github.com/urfave/cli"
 	"google.golang.org/grpc"
 	_ "mosn.io/layotto/pkg/filter/network/tcpcopy"
+	_ "mosn.io/layotto/pkg/metrics/push"
 	"mosn.io/layotto/pkg/runtime"
-	_ "mosn.io/layotto/pkg/wasm"
 	"mosn.io/mosn/pkg/featuregate"
 	_ "mosn.io/mosn/pkg/filter/network/grpc"
 	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
@@ -151,13 +62,17 @@ import (
 	tracehttp "mosn.io/mosn/pkg/trace/sofa/http"
 	xtrace "mosn.io/mosn/pkg/trace/sofa/xprotocol"
 	tracebolt "mosn.io/mosn/pkg/trace/sofa/xprotocol/bolt"
-	_ "mosn.io/mosn/pkg/wasm/runtime/wasmer"
 	_ "mosn.io/pkg/buffer"
+	"mosn.io/pkg/log"
 )
 
 // loggerForDaprComp is constructed for reusing dapr's components.
 var loggerForDaprComp = logger.NewLogger("reuse.dapr.component")
 
+// componentOptions registers the factories of the components. They're appended by the components_*.go files,
+// each of which can be compiled out with its build tag to reduce the size of the binary, e.g. -tags "no_pubsub no_file".
+var componentOptions []runtime.Option
+
 func init() {
 	mgrpc.RegisterServerHandler("runtime", NewRuntimeGrpcServer)
 	// Register default actuator implementations
@@ -167,7 +82,10 @@ func init() {
 }
 
 func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrpc.RegisteredServer, error) {
-	// 1. parse config
+	// 1. parse config, the problems found are reported only, since the runtime may start with them
+	for _, d := range runtime.ValidateRuntimeConfig(data, componentOptions...) {
+		log.DefaultLogger.Warnf("[runtime] config: %s", d)
+	}
 	cfg, err := runtime.ParseRuntimeConfig(data)
 	if err != nil {
 		actuator.GetRuntimeReadinessIndicator().SetUnhealthy(fmt.Sprintf("parse config error.%v", err))
@@ -176,206 +94,13 @@ func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrp
 	// 2. new instance
 	rt := runtime.NewMosnRuntime(cfg)
 	// 3. run
-	server, err := rt.Run(
+	server, err := rt.Run(append([]runtime.Option{
 		runtime.WithGrpcOptions(opts...),
 		// register your grpc API here
 		runtime.WithGrpcAPI(
 			default_api.NewGrpcAPI,
 		),
-		// Hello
-		runtime.WithHelloFactory(
-			hello.NewHelloFactory("helloworld", helloworld.NewHelloWorld),
-		),
-		// Configuration
-		runtime.WithConfigStoresFactory(
-			configstores.NewStoreFactory("apollo", apollo.NewStore),
-			configstores.NewStoreFactory("etcd", etcdv3.NewStore),
-		),
-
-		// RPC
-		runtime.WithRpcFactory(
-			rpc.NewRpcFactory("mosn", mosninvoker.NewMosnInvoker),
-		),
-
-		// File
-		runtime.WithFileFactory(
-			file.NewFileFactory("aliOSS", alicloud.NewAliCloudOSS),
-			file.NewFileFactory("minioOSS", minio.NewMinioOss),
-			file.NewFileFactory("awsOSS", aws.NewAwsOss),
-			file.NewFileFactory("local", local.NewLocalStore),
-		),
-
-		// PubSub
-		runtime.WithPubSubFactory(
-			pubsub.NewFactory("redis", func() dapr_comp_pubsub.PubSub {
-				return pubsub_redis.NewRedisStreams(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("natsstreaming", func() dapr_comp_pubsub.PubSub {
-				return natsstreaming.NewNATSStreamingPubSub(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("azure.eventhubs", func() dapr_comp_pubsub.PubSub {
-				return pubsub_eventhubs.NewAzureEventHubs(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("azure.servicebus", func() dapr_comp_pubsub.PubSub {
-				return servicebus.NewAzureServiceBus(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("rabbitmq", func() dapr_comp_pubsub.PubSub {
-				return rabbitmq.NewRabbitMQ(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("hazelcast", func() dapr_comp_pubsub.PubSub {
-				return pubsub_hazelcast.NewHazelcastPubSub(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("gcp.pubsub", func() dapr_comp_pubsub.PubSub {
-				return pubsub_gcp.NewGCPPubSub(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("kafka", func() dapr_comp_pubsub.PubSub {
-				return pubsub_kafka.NewKafka(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("snssqs", func() dapr_comp_pubsub.PubSub {
-				return pubsub_snssqs.NewSnsSqs(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("mqtt", func() dapr_comp_pubsub.PubSub {
-				return pubsub_mqtt.NewMQTTPubSub(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("pulsar", func() dapr_comp_pubsub.PubSub {
-				return pubsub_pulsar.NewPulsar(loggerForDaprComp)
-			}),
-			pubsub.NewFactory("in-memory", func() dapr_comp_pubsub.PubSub {
-				return pubsub_inmemory.New(loggerForDaprComp)
-			}),
-		),
-		// State
-		runtime.WithStateFactory(
-			runtime_state.NewFactory("in-memory", func() state.Store {
-				return mock_state.New(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("redis", func() state.Store {
-				return state_redis.NewRedisStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("consul", func() state.Store {
-				return consul.NewConsulStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("azure.blobstorage", func() state.Store {
-				return state_azure_blobstorage.NewAzureBlobStorageStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("azure.cosmosdb", func() state.Store {
-				return state_cosmosdb.NewCosmosDBStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("azure.tablestorage", func() state.Store {
-				return state_azure_tablestorage.NewAzureTablesStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("cassandra", func() state.Store {
-				return cassandra.NewCassandraStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("memcached", func() state.Store {
-				return memcached.NewMemCacheStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("mongodb", func() state.Store {
-				return mongodb.NewMongoDB(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("zookeeper", func() state.Store {
-				return zookeeper.NewZookeeperStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("gcp.firestore", func() state.Store {
-				return firestore.NewFirestoreStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("postgresql", func() state.Store {
-				return postgresql.NewPostgreSQLStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("sqlserver", func() state.Store {
-				return sqlserver.NewSQLServerStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("hazelcast", func() state.Store {
-				return hazelcast.NewHazelcastStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("cloudstate.crdt", func() state.Store {
-				return cloudstate.NewCRDT(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("couchbase", func() state.Store {
-				return couchbase.NewCouchbaseStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("aerospike", func() state.Store {
-				return aerospike.NewAerospikeStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("rethinkdb", func() state.Store {
-				return rethinkdb.NewRethinkDBStateStore(loggerForDaprComp)
-			}),
-			runtime_state.NewFactory("aws.dynamodb", state_dynamodb.NewDynamoDBStateStore),
-			runtime_state.NewFactory("mysql", func() state.Store {
-				return state_mysql.NewMySQLStateStore(loggerForDaprComp)
-			}),
-		),
-		// Lock
-		runtime.WithLockFactory(
-			runtime_lock.NewFactory("redis_cluster", func() lock.LockStore {
-				return lock_redis.NewClusterRedisLock(log.DefaultLogger)
-			}),
-			runtime_lock.NewFactory("redis", func() lock.LockStore {
-				return lock_redis.NewStandaloneRedisLock(log.DefaultLogger)
-			}),
-			runtime_lock.NewFactory("zookeeper", func() lock.LockStore {
-				return lock_zookeeper.NewZookeeperLock(log.DefaultLogger)
-			}),
-			runtime_lock.NewFactory("etcd", func() lock.LockStore {
-				return lock_etcd.NewEtcdLock(log.DefaultLogger)
-			}),
-			runtime_lock.NewFactory("consul", func() lock.LockStore {
-				return lock_consul.NewConsulLock(log.DefaultLogger)
-			}),
-			runtime_lock.NewFactory("mongo", func() lock.LockStore {
-				return lock_mongo.NewMongoLock(log.DefaultLogger)
-			}),
-		),
-
-		// bindings
-		runtime.WithOutputBindings(
-			bindings.NewOutputBindingFactory("http", func() dbindings.OutputBinding {
-				return http.NewHTTP(loggerForDaprComp)
-			}),
-		),
-
-		// Sequencer
-		runtime.WithSequencerFactory(
-			runtime_sequencer.NewFactory("etcd", func() sequencer.Store {
-				return sequencer_etcd.NewEtcdSequencer(log.DefaultLogger)
-			}),
-			runtime_sequencer.NewFactory("redis", func() sequencer.Store {
-				return sequencer_redis.NewStandaloneRedisSequencer(log.DefaultLogger)
-			}),
-			runtime_sequencer.NewFactory("zookeeper", func() sequencer.Store {
-				return sequencer_zookeeper.NewZookeeperSequencer(log.DefaultLogger)
-			}),
-			runtime_sequencer.NewFactory("mongo", func() sequencer.Store {
-				return sequencer_mongo.NewMongoSequencer(log.DefaultLogger)
-			}),
-		),
-		// secretstores
-		runtime.WithSecretStoresFactory(
-			secretstores_loader.NewFactory("kubernetes", func() secretstores.SecretStore {
-				return sercetstores_kubernetes.NewKubernetesSecretStore(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("azure.keyvault", func() secretstores.SecretStore {
-				return keyvault.NewAzureKeyvaultSecretStore(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("hashicorp.vault", func() secretstores.SecretStore {
-				return vault.NewHashiCorpVaultSecretStore(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("aws.secretmanager", func() secretstores.SecretStore {
-				return secretmanager.NewSecretManager(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("aws.parameterstore", func() secretstores.SecretStore {
-				return parameterstore.NewParameterStore(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("gcp.secretmanager", func() secretstores.SecretStore {
-				return gcp_secretmanager.NewSecreteManager(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("local.file", func() secretstores.SecretStore {
-				return secretstore_file.NewLocalSecretStore(loggerForDaprComp)
-			}),
-			secretstores_loader.NewFactory("local.env", func() secretstores.SecretStore {
-				return secretstore_env.NewEnvSecretStore(loggerForDaprComp)
-			}),
-		))
+	}, componentOptions...)...)
 	// 4. check if unhealthy
 	if err != nil {
 		actuator.GetRuntimeReadinessIndicator().SetUnhealthy(err.Error())
@@ -397,9 +122,15 @@ var cmdStart = cli.Command{
 			Name:   "feature-gates, f",
 			Usage:  "config feature gates",
 			EnvVar: "FEATURE_GATES",
+		}, cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Validate the runtime config in the configuration file and exit without starting",
 		},
 	},
 	Action: func(c *cli.Context) error {
+		if c.Bool("dry-run") {
+			os.Exit(dryRun(c.String("config")))
+		}
 		stm := mosn.NewStageManager(c, c.String("config"))
 
 		stm.AppendParamsParsedStage(ExtensionsRegister)
@@ -413,6 +144,11 @@ var cmdStart = cli.Command{
 
 		stm.AppendInitStage(mosn.DefaultInitStage)
 
+		// the logger of modules wraps the default logger, which is initialized with mosn before this stage
+		stm.AppendPreStartStage(func(_ *mosn.Mosn) {
+			actuatorLogger.Install()
+		})
+
 		stm.AppendPreStartStage(mosn.DefaultPreStartStage) // called finally stage by default
 
 		stm.AppendStartStage(mosn.DefaultStartStage)
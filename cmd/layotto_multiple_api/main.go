@@ -39,6 +39,7 @@ import (
 	dbindings "github.com/dapr/components-contrib/bindings"
 	"github.com/dapr/components-contrib/bindings/http"
 	"mosn.io/layotto/components/configstores/etcdv3"
+	"mosn.io/layotto/components/configstores/nacos"
 	"mosn.io/layotto/components/file"
 	"mosn.io/layotto/components/sequencer"
 	"mosn.io/layotto/pkg/runtime/bindings"
@@ -69,6 +70,11 @@ import (
 	pubsub_redis "github.com/dapr/components-contrib/pubsub/redis"
 	"github.com/dapr/kit/logger"
 	"mosn.io/layotto/pkg/runtime/pubsub"
+	runtime_pubsub_amqp "mosn.io/layotto/pkg/runtime/pubsub/amqp"
+	runtime_pubsub_gcp "mosn.io/layotto/pkg/runtime/pubsub/gcp"
+	runtime_pubsub_kafka "mosn.io/layotto/pkg/runtime/pubsub/kafka"
+	runtime_pubsub_rabbitmq "mosn.io/layotto/pkg/runtime/pubsub/rabbitmq"
+	runtime_pubsub_snssqs "mosn.io/layotto/pkg/runtime/pubsub/snssqs"
 
 	// RPC
 	"mosn.io/layotto/components/rpc"
@@ -91,11 +97,13 @@ import (
 	"github.com/dapr/components-contrib/state/mongodb"
 	state_mysql "github.com/dapr/components-contrib/state/mysql"
 	"github.com/dapr/components-contrib/state/postgresql"
-	state_redis "github.com/dapr/components-contrib/state/redis"
 	"github.com/dapr/components-contrib/state/rethinkdb"
 	"github.com/dapr/components-contrib/state/sqlserver"
 	"github.com/dapr/components-contrib/state/zookeeper"
 	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtime_state_mysql "mosn.io/layotto/pkg/runtime/state/mysql"
+	runtime_state_postgresql "mosn.io/layotto/pkg/runtime/state/postgresql"
+	runtime_state_redis "mosn.io/layotto/pkg/runtime/state/redis"
 
 	// Lock
 	"mosn.io/layotto/components/lock"
@@ -114,13 +122,16 @@ import (
 	_ "mosn.io/layotto/pkg/actuator"
 	"mosn.io/layotto/pkg/actuator/health"
 	actuatorInfo "mosn.io/layotto/pkg/actuator/info"
+	actuatorLogger "mosn.io/layotto/pkg/actuator/logger"
 	_ "mosn.io/layotto/pkg/filter/stream/actuator/http"
 	"mosn.io/layotto/pkg/integrate/actuator"
 
 	"github.com/urfave/cli"
 	"google.golang.org/grpc"
 	"mosn.io/layotto/diagnostics"
+	_ "mosn.io/layotto/diagnostics/exporter_iml"
 	_ "mosn.io/layotto/pkg/filter/network/tcpcopy"
+	_ "mosn.io/layotto/pkg/metrics/push"
 	"mosn.io/layotto/pkg/runtime"
 	"mosn.io/mosn/pkg/featuregate"
 	_ "mosn.io/mosn/pkg/filter/network/grpc"
@@ -187,6 +198,7 @@ func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrp
 		runtime.WithConfigStoresFactory(
 			configstores.NewStoreFactory("apollo", apollo.NewStore),
 			configstores.NewStoreFactory("etcd", etcdv3.NewStore),
+			configstores.NewStoreFactory("nacos", nacos.NewStore),
 		),
 
 		// RPC
@@ -216,21 +228,33 @@ func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrp
 			pubsub.NewFactory("azure.servicebus", func() dapr_comp_pubsub.PubSub {
 				return servicebus.NewAzureServiceBus(loggerForDaprComp)
 			}),
+			pubsub.NewFactory("amqp", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_amqp.NewAMQP()
+			}),
 			pubsub.NewFactory("rabbitmq", func() dapr_comp_pubsub.PubSub {
 				return rabbitmq.NewRabbitMQ(loggerForDaprComp)
 			}),
+			pubsub.NewFactory("layotto.rabbitmq", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_rabbitmq.NewRabbitMQ()
+			}),
 			pubsub.NewFactory("hazelcast", func() dapr_comp_pubsub.PubSub {
 				return pubsub_hazelcast.NewHazelcastPubSub(loggerForDaprComp)
 			}),
 			pubsub.NewFactory("gcp.pubsub", func() dapr_comp_pubsub.PubSub {
 				return pubsub_gcp.NewGCPPubSub(loggerForDaprComp)
 			}),
+			pubsub.NewFactory("layotto.gcp.pubsub", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_gcp.NewGCPPubSub()
+			}),
 			pubsub.NewFactory("kafka", func() dapr_comp_pubsub.PubSub {
-				return pubsub_kafka.NewKafka(loggerForDaprComp)
+				return runtime_pubsub_kafka.NewReplayable(pubsub_kafka.NewKafka(loggerForDaprComp))
 			}),
 			pubsub.NewFactory("snssqs", func() dapr_comp_pubsub.PubSub {
 				return pubsub_snssqs.NewSnsSqs(loggerForDaprComp)
 			}),
+			pubsub.NewFactory("layotto.snssqs", func() dapr_comp_pubsub.PubSub {
+				return runtime_pubsub_snssqs.NewSnsSqs()
+			}),
 			pubsub.NewFactory("mqtt", func() dapr_comp_pubsub.PubSub {
 				return pubsub_mqtt.NewMQTTPubSub(loggerForDaprComp)
 			}),
@@ -247,7 +271,7 @@ func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrp
 				return mock_state.New(loggerForDaprComp)
 			}),
 			runtime_state.NewFactory("redis", func() state.Store {
-				return state_redis.NewRedisStateStore(loggerForDaprComp)
+				return runtime_state_redis.NewRedisStateStore(loggerForDaprComp)
 			}),
 			runtime_state.NewFactory("consul", func() state.Store {
 				return consul.NewConsulStateStore(loggerForDaprComp)
@@ -301,6 +325,12 @@ func NewRuntimeGrpcServer(data json.RawMessage, opts ...grpc.ServerOption) (mgrp
 			runtime_state.NewFactory("mysql", func() state.Store {
 				return state_mysql.NewMySQLStateStore(loggerForDaprComp)
 			}),
+			runtime_state.NewFactory("mysql.outbox", func() state.Store {
+				return runtime_state_mysql.NewMySQLStateStore(loggerForDaprComp)
+			}),
+			runtime_state.NewFactory("postgresql.jsonb", func() state.Store {
+				return runtime_state_postgresql.NewPostgreSQLStateStore(loggerForDaprComp)
+			}),
 		),
 		// Lock
 		runtime.WithLockFactory(
@@ -376,6 +406,11 @@ var cmdStart = cli.Command{
 
 		stm.AppendInitStage(mosn.DefaultInitStage)
 
+		// the logger of modules wraps the default logger, which is initialized with mosn before this stage
+		stm.AppendPreStartStage(func(_ *mosn.Mosn) {
+			actuatorLogger.Install()
+		})
+
 		stm.AppendPreStartStage(mosn.DefaultPreStartStage) // called finally stage by default
 
 		stm.AppendStartStage(mosn.DefaultStartStage)
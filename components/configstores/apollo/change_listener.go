@@ -21,10 +21,13 @@ import (
 	"mosn.io/layotto/components/configstores"
 	"mosn.io/pkg/log"
 	"mosn.io/pkg/utils"
+	"sync"
 	"time"
 )
 
 type changeListener struct {
+	// agollo may call OnChange concurrently, so the events are notified one by one to keep the order of updates of the same key
+	mu          sync.Mutex
 	subscribers *subscriberHolder
 	timeout     time.Duration
 	store       RepoForListener
@@ -34,6 +37,8 @@ type RepoForListener interface {
 	splitKey(keyWithLabel string) (key string, label string)
 	getAllTags(group string, keyWithLabel string) (tags map[string]string, err error)
 	GetAppId() string
+	getReleaseKey(namespace string) string
+	invalidateReleaseKey(namespace string)
 }
 
 func newChangeListener(c RepoForListener) *changeListener {
@@ -45,17 +50,23 @@ func newChangeListener(c RepoForListener) *changeListener {
 }
 
 func (lis *changeListener) OnChange(changeEvent *storage.ChangeEvent) {
-	// 1. find related subscribers
+	// the namespace is released again, so the release key is changed.
+	// It's queried before locking, so that the subscribing isn't blocked by the config service
 	ns := changeEvent.Namespace
+	lis.store.invalidateReleaseKey(ns)
+	releaseKey := lis.store.getReleaseKey(ns)
+	lis.mu.Lock()
+	defer lis.mu.Unlock()
+	// 1. find related subscribers
 	groupLevel := lis.subscribers.findByTopic(ns, "")
 	for key, change := range changeEvent.Changes {
 		keyLevel := lis.subscribers.findByTopic(ns, key)
 		// 2. notice
 		for _, s := range groupLevel {
-			lis.notify(s, key, change)
+			lis.notify(s, key, change, releaseKey)
 		}
 		for _, s := range keyLevel {
-			lis.notify(s, key, change)
+			lis.notify(s, key, change, releaseKey)
 		}
 	}
 }
@@ -63,7 +74,7 @@ func (lis *changeListener) OnChange(changeEvent *storage.ChangeEvent) {
 func (lis *changeListener) OnNewestChange(event *storage.FullChangeEvent) {
 }
 
-func (lis *changeListener) notify(s *subscriber, keyWithLabel string, change *storage.ConfigChange) {
+func (lis *changeListener) notify(s *subscriber, keyWithLabel string, change *storage.ConfigChange, releaseKey string) {
 	if s == nil || s.respChan == nil || change == nil {
 		return
 	}
@@ -89,8 +100,11 @@ func (lis *changeListener) notify(s *subscriber, keyWithLabel string, change *st
 	item := &configstores.ConfigurationItem{}
 	item.Group = s.group
 	item.Key, item.Label = lis.store.splitKey(keyWithLabel)
-	// TODO add a removed flag in response struct.
-	if change.ChangeType != storage.DELETED {
+	item.Deleted = change.ChangeType == storage.DELETED
+	if releaseKey != "" {
+		item.Metadata = map[string]string{metadataReleaseKey: releaseKey}
+	}
+	if !item.Deleted {
 		item.Content = change.NewValue.(string)
 		tags, err := lis.store.getAllTags(s.group, keyWithLabel)
 		if err != nil {
@@ -119,6 +133,10 @@ func (lis *changeListener) addByTopic(namespace string, keyWithLabel string, res
 	return lis.subscribers.addByTopic(namespace, keyWithLabel, respChan)
 }
 
+func (lis *changeListener) removeByChan(respChan chan *configstores.SubscribeResp) {
+	lis.subscribers.removeByChan(respChan)
+}
+
 func (lis *changeListener) reset() {
 	lis.subscribers.reset()
 }
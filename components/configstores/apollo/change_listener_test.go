@@ -44,6 +44,13 @@ func (m *MockRepo) GetAppId() string {
 	return testAppId
 }
 
+func (m *MockRepo) getReleaseKey(namespace string) string {
+	return "release-" + namespace
+}
+
+func (m *MockRepo) invalidateReleaseKey(namespace string) {
+}
+
 const ns = "application"
 
 func setupChangeListener() *changeListener {
@@ -73,6 +80,7 @@ func Test_changeListener_OnChange(t *testing.T) {
 			assert.True(t, len(c2.Items) == 1)
 			assert.True(t, c2.Items[0].Key == "key1")
 			assert.True(t, c2.Items[0].Content == "v2")
+			assert.Equal(t, "release-"+ns, c2.Items[0].Metadata[metadataReleaseKey])
 			wg.Done()
 		case <-time.After(time.Second * 2):
 			t.Error("consume timeout")
@@ -99,6 +107,40 @@ func Test_changeListener_OnChange(t *testing.T) {
 	wg.Wait()
 }
 
+func Test_changeListener_OnChangeDeleted(t *testing.T) {
+	lis := setupChangeListener()
+	ch := make(chan *configstores.SubscribeResp)
+	err := lis.addByTopic(ns, "key1", ch)
+	if err != nil {
+		t.Error(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case c2 := <-ch:
+			assert.True(t, len(c2.Items) == 1)
+			assert.Equal(t, "key1", c2.Items[0].Key)
+			assert.True(t, c2.Items[0].Deleted)
+			assert.Equal(t, "", c2.Items[0].Content)
+		case <-time.After(time.Second * 2):
+			t.Error("consume timeout")
+		}
+	}()
+	changes := make(map[string]*storage.ConfigChange)
+	changes["key1"] = &storage.ConfigChange{
+		OldValue:   "v1",
+		ChangeType: storage.DELETED,
+	}
+	event := &storage.ChangeEvent{
+		Changes: changes,
+	}
+	event.Namespace = ns
+	lis.OnChange(event)
+	wg.Wait()
+}
+
 func Test_changeListener_timeout(t *testing.T) {
 	// 1. setup
 	lis := setupChangeListener()
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"mosn.io/layotto/components/configstores"
@@ -47,6 +48,11 @@ type ConfigStore struct {
 	kvConfig       *RepoConfig
 	tagsConfig     *RepoConfig
 	openAPIClient  httpClient
+	// releaseKeys caches the release keys of the namespaces, which are invalidated on changes
+	releaseKeysLock sync.Mutex
+	releaseKeys     map[string]string
+	// releaseKeysVersion is increased on every invalidation, so that a release key queried before it isn't cached
+	releaseKeysVersion uint64
 }
 type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -76,6 +82,7 @@ func NewStore() configstores.Store {
 		kvRepo:        newAgolloRepository(),
 		tagsRepo:      newAgolloRepository(),
 		openAPIClient: newHttpClient(),
+		releaseKeys:   make(map[string]string),
 	}
 }
 
@@ -143,6 +150,11 @@ func (c *ConfigStore) doInit(config *configstores.StoreConfig) error {
 	if c.openAPIUser == "" {
 		return errConfigMissingField("open_api_user")
 	}
+	// the public namespaces associated with the app are loaded as the private ones
+	namespaceName := metadata["namespace_name"]
+	if public := metadata[configKeyPublicNamespaceName]; public != "" {
+		namespaceName = strings.Trim(namespaceName+namespaceSeparator+public, namespaceSeparator)
+	}
 	// TODO make 'env' configurable
 	// 2. SetConfig client
 	kvRepoConfig := &RepoConfig{
@@ -150,7 +162,7 @@ func (c *ConfigStore) doInit(config *configstores.StoreConfig) error {
 		appId:          appId,
 		env:            c.env,
 		cluster:        metadata["cluster"],
-		namespaceName:  metadata["namespace_name"],
+		namespaceName:  namespaceName,
 		isBackupConfig: isBackupConfig,
 		// secret,not required
 		secret: metadata["secret"],
@@ -191,16 +203,38 @@ func (c *ConfigStore) Get(ctx context.Context, req *configstores.GetRequest) ([]
 	if len(req.Keys) > 0 && req.Group == "" {
 		req.Group = defaultNamespace
 	}
-	// 1. app level
+	var items []*configstores.ConfigurationItem
+	var err error
 	if req.Group == "" {
-		return c.getAllWithAppId()
+		// 1. app level
+		items, err = c.getAllWithAppId(req.KeyPattern)
+	} else {
+		// the group can be several namespaces joined with commas
+		for _, ns := range strings.Split(req.Group, namespaceSeparator) {
+			var res []*configstores.ConfigurationItem
+			if len(req.Keys) == 0 {
+				// 2. group level
+				res, err = c.getAllWithNamespace(ns, req.KeyPattern)
+			} else {
+				// 3. group+key+label level
+				res, err = c.getKeys(ns, req.Keys, req.Label)
+			}
+			items = append(items, res...)
+			if err != nil {
+				break
+			}
+		}
 	}
-	// 2. group level
-	if len(req.Keys) == 0 {
-		return c.getAllWithNamespace(req.Group)
+	if err != nil || len(req.Tags) == 0 {
+		return items, err
 	}
-	// 3. group+key+label level
-	return c.getKeys(req.Group, req.Keys, req.Label)
+	// 4. filter by tags
+	return configstores.FilterItems(&configstores.GetRequest{Tags: req.Tags}, items), nil
+}
+
+// SupportFilter returns true because keys are filtered before querying tags, and items are filtered by tags locally.
+func (c *ConfigStore) SupportFilter() bool {
+	return true
 }
 
 func (c *ConfigStore) getAllTags(group string, keyWithLabel string) (tags map[string]string, err error) {
@@ -326,16 +360,21 @@ func (c *ConfigStore) Subscribe(req *configstores.SubscribeReq, ch chan *configs
 		}
 		return nil
 	}
-	// 2. group level
-	if len(req.Keys) == 0 {
-		err := c.listener.addByTopic(req.Group, "", ch)
-		return err
-	}
-	// 3. key level
-	for _, k := range req.Keys {
-		err := c.listener.addByTopic(req.Group, c.concatenateKey(k, req.Label), ch)
-		if err != nil {
-			return err
+	// the group can be several namespaces joined with commas, which are subscribed together
+	for _, ns := range strings.Split(req.Group, namespaceSeparator) {
+		// 2. group level
+		if len(req.Keys) == 0 {
+			if err := c.listener.addByTopic(ns, "", ch); err != nil {
+				return err
+			}
+			continue
+		}
+		// 3. key level
+		for _, k := range req.Keys {
+			err := c.listener.addByTopic(ns, c.concatenateKey(k, req.Label), ch)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -347,6 +386,11 @@ func (c *ConfigStore) StopSubscribe() {
 	c.listener.reset()
 }
 
+// Unsubscribe stops the subscriptions of the channel only. The update being sent to it is released after the timeout of the listener
+func (c *ConfigStore) Unsubscribe(ch chan *configstores.SubscribeResp) {
+	c.listener.removeByChan(ch)
+}
+
 func (c *ConfigStore) getKeys(group string, keys []string, label string) ([]*configstores.ConfigurationItem, error) {
 	log.DefaultLogger.Debugf("getKeys start.namespace : %v, keys : %v, label : %v", group, keys, label)
 	// 1. prepare suffix
@@ -355,6 +399,7 @@ func (c *ConfigStore) getKeys(group string, keys []string, label string) ([]*con
 		suffix = c.delimiter + label
 	}
 	res := make([]*configstores.ConfigurationItem, 0, 10)
+	releaseKey := c.getReleaseKey(group)
 	// 2. loop query
 	for _, k := range keys {
 		keyWithLabel := k + suffix
@@ -370,6 +415,7 @@ func (c *ConfigStore) getKeys(group string, keys []string, label string) ([]*con
 		item.Label = label
 		item.Key = k
 		item.Content = fmt.Sprintf("%v", value)
+		item.Metadata = releaseKeyMetadata(releaseKey)
 		// query tags
 		item.Tags, err = c.getAllTags(group, keyWithLabel)
 		if err != nil {
@@ -381,13 +427,13 @@ func (c *ConfigStore) getKeys(group string, keys []string, label string) ([]*con
 	return res, nil
 }
 
-func (c *ConfigStore) getAllWithAppId() ([]*configstores.ConfigurationItem, error) {
+func (c *ConfigStore) getAllWithAppId(keyPattern string) ([]*configstores.ConfigurationItem, error) {
 	log.DefaultLogger.Debugf("getAllWithAppId start.namespace:%v", c.kvConfig.namespaceName)
 	split := strings.Split(c.kvConfig.namespaceName, ",")
 	res := make([]*configstores.ConfigurationItem, 0, 10)
 	// loop every namespace in config
 	for _, ns := range split {
-		items, err := c.getAllWithNamespace(ns)
+		items, err := c.getAllWithNamespace(ns, keyPattern)
 		res = append(res, items...)
 		if err != nil {
 			return res, err
@@ -396,14 +442,16 @@ func (c *ConfigStore) getAllWithAppId() ([]*configstores.ConfigurationItem, erro
 	return res, nil
 }
 
-func (c *ConfigStore) getAllWithNamespace(group string) ([]*configstores.ConfigurationItem, error) {
+func (c *ConfigStore) getAllWithNamespace(group string, keyPattern string) ([]*configstores.ConfigurationItem, error) {
 	log.DefaultLogger.Debugf("getAllWithNamespace start.namespace:%v", group)
 	res := make([]*configstores.ConfigurationItem, 0, 10)
+	releaseKey := c.getReleaseKey(group)
 	// 1. loop query
 	err := c.kvRepo.Range(group, func(key, value interface{}) bool {
 		// 1.1. convert
 		item := &configstores.ConfigurationItem{}
 		item.Group = group
+		item.Metadata = releaseKeyMetadata(releaseKey)
 		k := key.(string)
 		if k == "" {
 			//	never happen
@@ -414,6 +462,10 @@ func (c *ConfigStore) getAllWithNamespace(group string) ([]*configstores.Configu
 			if len(split) > 1 {
 				item.Label = split[1]
 			}
+			// skip the unmatched keys before querying tags
+			if !configstores.MatchKey(keyPattern, item.Key) {
+				return true
+			}
 			// 1.2. query tags
 			tags, err := c.getAllTags(group, k)
 			if err != nil {
@@ -434,6 +486,44 @@ func (c *ConfigStore) getAllWithNamespace(group string) ([]*configstores.Configu
 	return res, nil
 }
 
+// getReleaseKey returns the cached release key of the namespace, an empty string is returned if it fails to query.
+// The config service is queried without the lock, so that a slow query doesn't block the other readers.
+func (c *ConfigStore) getReleaseKey(namespace string) string {
+	c.releaseKeysLock.Lock()
+	key, ok := c.releaseKeys[namespace]
+	version := c.releaseKeysVersion
+	c.releaseKeysLock.Unlock()
+	if ok {
+		return key
+	}
+	key, err := c.kvRepo.GetReleaseKey(namespace)
+	if err != nil {
+		log.DefaultLogger.Errorf("error when querying release key of namespace %v: %v", namespace, err)
+		return ""
+	}
+	c.releaseKeysLock.Lock()
+	if version == c.releaseKeysVersion {
+		c.releaseKeys[namespace] = key
+	}
+	c.releaseKeysLock.Unlock()
+	return key
+}
+
+// invalidateReleaseKey is called when the namespace is released
+func (c *ConfigStore) invalidateReleaseKey(namespace string) {
+	c.releaseKeysLock.Lock()
+	defer c.releaseKeysLock.Unlock()
+	delete(c.releaseKeys, namespace)
+	c.releaseKeysVersion++
+}
+
+func releaseKeyMetadata(releaseKey string) map[string]string {
+	if releaseKey == "" {
+		return nil
+	}
+	return map[string]string{metadataReleaseKey: releaseKey}
+}
+
 func (c *ConfigStore) setItem(appId string, item *configstores.ConfigurationItem) error {
 	// 1. put request
 	keyWithLabel := c.concatenateKey(item.Key, item.Label)
@@ -36,6 +36,8 @@ type MockRepository struct {
 	cfg     *RepoConfig
 	invoked []string
 	cache   map[string]map[string]string
+	// onGetReleaseKey is called while querying the release key
+	onGetReleaseKey func()
 }
 
 func (a *MockRepository) Connect() error {
@@ -97,6 +99,17 @@ func (a *MockRepository) AddChangeListener(listener *changeListener) {
 	a.invoked = append(a.invoked, "AddChangeListener")
 }
 
+func (a *MockRepository) GetReleaseKey(namespace string) (string, error) {
+	if namespace == "wrong" {
+		return "", errors.New("test")
+	}
+	a.invoked = append(a.invoked, "GetReleaseKey,"+namespace)
+	if a.onGetReleaseKey != nil {
+		a.onGetReleaseKey()
+	}
+	return "release-" + namespace, nil
+}
+
 func (a *MockRepository) Set(namespace string, key string, value string) error {
 	if _, ok := a.cache[namespace]; !ok {
 		a.cache[namespace] = make(map[string]string)
@@ -164,6 +177,20 @@ func TestConfigStore_read(t *testing.T) {
 	if err != nil || len(resp) != 3 {
 		t.Error(err)
 	}
+	//	filter by key pattern
+	req4 := req3
+	req4.KeyPattern = "*o"
+	resp, err = store.Get(context.Background(), &req4)
+	if err != nil || len(resp) != 2 {
+		t.Error(err)
+	}
+	//	filter by tags
+	req5 := req2
+	req5.Tags = map[string]string{"owner": "layotto"}
+	resp, err = store.Get(context.Background(), &req5)
+	if err != nil || len(resp) != 0 {
+		t.Error(err)
+	}
 	//	subscribe
 	var subReq configstores.SubscribeReq
 	ch := make(chan *configstores.SubscribeResp)
@@ -189,6 +216,61 @@ func TestConfigStore_read(t *testing.T) {
 	}
 }
 
+func TestConfigStore_multipleNamespaces(t *testing.T) {
+	store, cfg := setup(t)
+	kvRepo := store.kvRepo.(*MockRepository)
+	kvRepo.Set("application", "sofa", "sofa")
+	kvRepo.Set("dept.common", "sofa", "common")
+	cfg.Metadata[configKeyPublicNamespaceName] = "dept.common"
+	err := store.Init(cfg)
+	assert.Nil(t, err)
+	// the public namespaces are loaded
+	assert.Equal(t, "dubbo,product.joe,application,dept.common", kvRepo.GetConfig().namespaceName)
+
+	// the namespaces in the group are queried, and the release keys are in the metadata
+	resp, err := store.Get(context.Background(), &configstores.GetRequest{Group: "application,dept.common", Keys: []string{"sofa"}})
+	assert.Nil(t, err)
+	assert.Len(t, resp, 2)
+	assert.Equal(t, "sofa", resp[0].Content)
+	assert.Equal(t, "release-application", resp[0].Metadata[metadataReleaseKey])
+	assert.Equal(t, "common", resp[1].Content)
+	assert.Equal(t, "release-dept.common", resp[1].Metadata[metadataReleaseKey])
+
+	// the release keys are cached until the namespace is changed
+	resp, err = store.Get(context.Background(), &configstores.GetRequest{Group: "dept.common"})
+	assert.Nil(t, err)
+	assert.Len(t, resp, 1)
+	count := func() int {
+		n := 0
+		for _, v := range kvRepo.invoked {
+			if v == "GetReleaseKey,dept.common" {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 1, count())
+	store.invalidateReleaseKey("dept.common")
+	store.getReleaseKey("dept.common")
+	assert.Equal(t, 2, count())
+	// the release key queried before the invalidation isn't cached
+	store.invalidateReleaseKey("dept.common")
+	kvRepo.onGetReleaseKey = func() {
+		store.invalidateReleaseKey("dept.common")
+	}
+	store.getReleaseKey("dept.common")
+	kvRepo.onGetReleaseKey = nil
+	store.getReleaseKey("dept.common")
+	assert.Equal(t, 4, count())
+
+	// one subscription covers the namespaces
+	ch := make(chan *configstores.SubscribeResp)
+	err = store.Subscribe(&configstores.SubscribeReq{Group: "application,dept.common", Keys: []string{"sofa"}}, ch)
+	assert.Nil(t, err)
+	assert.Len(t, store.listener.subscribers.findByTopic("application", "sofa"), 1)
+	assert.Len(t, store.listener.subscribers.findByTopic("dept.common", "sofa"), 1)
+}
+
 func setup(t *testing.T) (*ConfigStore, *configstores.StoreConfig) {
 	store := NewStore().(*ConfigStore)
 	//mock read client
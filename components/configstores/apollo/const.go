@@ -29,4 +29,11 @@ const (
 	commitUrlTpl               = "%v/openapi/v1/envs/%v/apps/%v/clusters/%v/namespaces/%v/releases"
 	deleteUrlTpl               = "%v/openapi/v1/envs/%v/apps/%v/clusters/%v/namespaces/%v/items/%v"
 	createNamespaceUrlTpl      = "%v/openapi/v1/apps/%v/appnamespaces"
+	configsUrlTpl              = "%v/configs/%v/%v/%v"
+	// configKeyPublicNamespaceName is the public namespaces associated with the app, which are loaded besides namespace_name
+	configKeyPublicNamespaceName = "public_namespace_name"
+	// namespaceSeparator separates the namespaces in the config and in the group of the requests
+	namespaceSeparator = ","
+	// metadataReleaseKey is the release key of the namespace in the metadata of the items, for audit
+	metadataReleaseKey = "release_key"
 )
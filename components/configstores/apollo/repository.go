@@ -17,11 +17,21 @@
 package apollo
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/zouyx/agollo/v4"
 	agolloConfig "github.com/zouyx/agollo/v4/env/config"
+	"io/ioutil"
 	"mosn.io/pkg/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // An interface to abstract different apollo sdks,also making it easier to write unit tests.
@@ -35,6 +45,8 @@ type Repository interface {
 	Get(namespace string, key string) (interface{}, error)
 	//	process every items under the namespace
 	Range(namespace string, f func(key, value interface{}) bool) error
+	// GetReleaseKey returns the release key of the latest release of the namespace
+	GetReleaseKey(namespace string) (string, error)
 }
 
 type RepoConfig struct {
@@ -48,6 +60,8 @@ type RepoConfig struct {
 	secret         string `json:"secret"`
 }
 
+var releaseKeyClient = &http.Client{Timeout: 5 * time.Second}
+
 func init() {
 	agollo.SetLogger(NewDefaultLogger(log.DefaultLogger))
 }
@@ -113,3 +127,52 @@ func (a *AgolloRepository) Range(namespace string, f func(key interface{}, value
 func (a *AgolloRepository) AddChangeListener(listener *changeListener) {
 	a.client.AddChangeListener(listener)
 }
+
+// GetReleaseKey queries the config service, since agollo doesn't expose the release keys
+func (a *AgolloRepository) GetReleaseKey(namespace string) (string, error) {
+	addr := a.cfg.addr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u := fmt.Sprintf(configsUrlTpl, strings.TrimSuffix(addr, "/"), url.PathEscape(a.cfg.appId),
+		url.PathEscape(a.cfg.cluster), url.PathEscape(namespace))
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	if a.cfg.secret != "" {
+		signRequest(req, a.cfg.appId, a.cfg.secret)
+	}
+	resp, err := releaseKeyClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("query release key of namespace %v failed with status %v", namespace, resp.StatusCode))
+	}
+	res := &struct {
+		ReleaseKey string `json:"releaseKey"`
+	}{}
+	if err = json.Unmarshal(body, res); err != nil {
+		return "", err
+	}
+	return res.ReleaseKey, nil
+}
+
+// signRequest adds the signature required by the config service if the secret is set
+func signRequest(req *http.Request, appId string, secret string) {
+	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	pathWithQuery := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		pathWithQuery += "?" + req.URL.RawQuery
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + pathWithQuery))
+	req.Header.Set("Authorization", fmt.Sprintf("Apollo %s:%s", appId, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	req.Header.Set("Timestamp", timestamp)
+}
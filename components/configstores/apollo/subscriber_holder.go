@@ -87,6 +87,21 @@ func (h *subscriberHolder) remove(s *subscriber) {
 	}
 }
 
+// removeByChan removes the subscribers sending to the channel
+func (h *subscriberHolder) removeByChan(respChan chan *configstores.SubscribeResp) {
+	h.Lock()
+	defer h.Unlock()
+	for key, slice := range h.chanMap {
+		kept := make([]*subscriber, 0, len(slice))
+		for _, s := range slice {
+			if s.respChan != respChan {
+				kept = append(kept, s)
+			}
+		}
+		h.chanMap[key] = kept
+	}
+}
+
 func (h *subscriberHolder) reset() {
 	h.Lock()
 	defer h.Unlock()
@@ -91,3 +91,18 @@ func Test_addByTopic_whenChanNil_thenError(t *testing.T) {
 	topic := h.findByTopic("application", "key1")
 	assert.True(t, len(topic) == 0)
 }
+
+func Test_removeByChan_thenOtherChanKept(t *testing.T) {
+	h := newSubscriberHolder()
+	ch := make(chan *configstores.SubscribeResp)
+	ch2 := make(chan *configstores.SubscribeResp)
+	h.addByTopic("application", "key1", ch)
+	h.addByTopic("application", "key1", ch2)
+	h.addByTopic("application", "", ch)
+	h.removeByChan(ch)
+	topic := h.findByTopic("application", "key1")
+	assert.True(t, len(topic) == 1)
+	assert.True(t, topic[0].respChan == ch2)
+	topic = h.findByTopic("application", "")
+	assert.True(t, len(topic) == 0)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"fmt"
+)
+
+// AtomicSetter is implemented by the stores which can save a batch of items in a native transaction.
+type AtomicSetter interface {
+	// SetAtomically saves all the items or none of them.
+	SetAtomically(context.Context, *SetRequest) error
+}
+
+// BatchError is returned by SetAtomically when the emulated batch fails.
+type BatchError struct {
+	// Err is why the batch fails
+	Err error
+	// RollbackErr is not nil if the items saved before the failure can't be restored,
+	// in which case the batch is partially saved.
+	RollbackErr error
+}
+
+func (e *BatchError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("save configuration failed: %v, and rollback failed: %v", e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("save configuration failed and rolled back: %v", e.Err)
+}
+
+// RolledBack reports whether the store is restored to the state before the batch.
+func (e *BatchError) RolledBack() bool {
+	return e.RollbackErr == nil
+}
+
+type groupLabel struct {
+	group string
+	label string
+}
+
+// SetAtomically saves all the items of the request or none of them.
+// The native transaction is used if the store implements AtomicSetter, and native is true in that case.
+// Otherwise, the current values are saved before setting, and restored if it fails.
+// The emulation isn't isolated: other clients may see the items before they are rolled back.
+func SetAtomically(ctx context.Context, store Store, req *SetRequest) (native bool, err error) {
+	if setter, ok := store.(AtomicSetter); ok {
+		return true, setter.SetAtomically(ctx, req)
+	}
+	// 1. save the current values
+	keys := make(map[groupLabel][]string)
+	for _, item := range req.Items {
+		gl := groupLabel{item.Group, item.Label}
+		keys[gl] = append(keys[gl], item.Key)
+	}
+	old := make(map[groupLabel][]*ConfigurationItem)
+	for gl, ks := range keys {
+		items, err := store.Get(ctx, &GetRequest{AppId: req.AppId, Group: gl.group, Label: gl.label, Keys: ks})
+		if err != nil {
+			return false, fmt.Errorf("save configuration failed when querying the current values: %v", err)
+		}
+		old[gl] = items
+	}
+	// 2. set
+	err = store.Set(ctx, req)
+	if err == nil {
+		return false, nil
+	}
+	// 3. rollback
+	return false, &BatchError{Err: err, RollbackErr: rollback(ctx, store, req.StoreName, req.AppId, keys, old)}
+}
+
+func rollback(ctx context.Context, store Store, storeName string, appId string, keys map[groupLabel][]string, old map[groupLabel][]*ConfigurationItem) error {
+	restore := &SetRequest{StoreName: storeName, AppId: appId}
+	for gl, ks := range keys {
+		existed := make(map[string]bool)
+		for _, item := range old[gl] {
+			existed[item.Key] = true
+			restore.Items = append(restore.Items, &ConfigurationItem{
+				Key:      item.Key,
+				Content:  item.Content,
+				Group:    gl.group,
+				Label:    gl.label,
+				Tags:     item.Tags,
+				Metadata: item.Metadata,
+			})
+		}
+		// delete the items which didn't exist
+		var absent []string
+		for _, k := range ks {
+			if !existed[k] {
+				absent = append(absent, k)
+			}
+		}
+		if len(absent) == 0 {
+			continue
+		}
+		if err := store.Delete(ctx, &DeleteRequest{AppId: appId, Group: gl.group, Label: gl.label, Keys: absent}); err != nil {
+			return err
+		}
+	}
+	if len(restore.Items) == 0 {
+		return nil
+	}
+	return store.Set(ctx, restore)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore keeps items in memory, and fails the first setFailures times of Set
+type memStore struct {
+	Store
+	kv          map[string]string
+	setFailures int
+}
+
+func (m *memStore) Get(ctx context.Context, req *GetRequest) ([]*ConfigurationItem, error) {
+	var res []*ConfigurationItem
+	for _, k := range req.Keys {
+		if v, ok := m.kv[k]; ok {
+			res = append(res, &ConfigurationItem{Key: k, Content: v})
+		}
+	}
+	return res, nil
+}
+
+func (m *memStore) Set(ctx context.Context, req *SetRequest) error {
+	// save the first item before failing
+	for i, item := range req.Items {
+		if m.setFailures > 0 && i > 0 {
+			m.setFailures--
+			return errors.New("net error")
+		}
+		m.kv[item.Key] = item.Content
+	}
+	return nil
+}
+
+func (m *memStore) Delete(ctx context.Context, req *DeleteRequest) error {
+	for _, k := range req.Keys {
+		delete(m.kv, k)
+	}
+	return nil
+}
+
+type nativeStore struct {
+	memStore
+	called bool
+}
+
+func (n *nativeStore) SetAtomically(ctx context.Context, req *SetRequest) error {
+	n.called = true
+	return nil
+}
+
+func TestSetAtomically(t *testing.T) {
+	req := &SetRequest{AppId: "app", Items: []*ConfigurationItem{
+		{Key: "a", Content: "new"},
+		{Key: "b", Content: "new"},
+	}}
+
+	t.Run("native", func(t *testing.T) {
+		store := &nativeStore{}
+		native, err := SetAtomically(context.Background(), store, req)
+		assert.Nil(t, err)
+		assert.True(t, native)
+		assert.True(t, store.called)
+	})
+
+	t.Run("emulated", func(t *testing.T) {
+		store := &memStore{kv: map[string]string{"a": "old"}}
+		native, err := SetAtomically(context.Background(), store, req)
+		assert.Nil(t, err)
+		assert.False(t, native)
+		assert.Equal(t, "new", store.kv["b"])
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		store := &memStore{kv: map[string]string{"b": "old"}, setFailures: 1}
+		_, err := SetAtomically(context.Background(), store, req)
+		e, ok := err.(*BatchError)
+		assert.True(t, ok)
+		assert.True(t, e.RolledBack())
+		assert.Equal(t, map[string]string{"b": "old"}, store.kv)
+	})
+
+	t.Run("rollback failed", func(t *testing.T) {
+		store := &memStore{kv: map[string]string{"a": "old", "b": "old"}, setFailures: 2}
+		_, err := SetAtomically(context.Background(), store, req)
+		e, ok := err.(*BatchError)
+		assert.True(t, ok)
+		assert.False(t, e.RolledBack())
+	})
+}
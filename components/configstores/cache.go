@@ -0,0 +1,249 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+// cacheFlushInterval is how often the items refreshed by Get are written to the cache file
+var cacheFlushInterval = 5 * time.Second
+
+// Staleness describes the items served from the local cache when the configuration store is unavailable.
+type Staleness struct {
+	// CachedAt is when the oldest one of the items was cached.
+	CachedAt time.Time
+}
+
+type cacheEntry struct {
+	Item *ConfigurationItem `json:"item"`
+	// unix timestamp in milliseconds
+	CachedAt int64 `json:"cached_at"`
+}
+
+// CachedStore wraps a Store with a local cache persisted to disk.
+// Every successful Get refreshes the cache, and the last known good values are served
+// if the store fails, even if the sidecar restarts while the store is down.
+// The refreshed items are written to disk periodically rather than on every Get, while the deletions are written at once.
+type CachedStore struct {
+	Store
+	file    string
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// dirty is true if the entries are refreshed but not written to disk yet
+	dirty     bool
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCachedStore creates a CachedStore whose cache file is named after the store in the dir.
+func NewCachedStore(name string, store Store, dir string) (*CachedStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &CachedStore{
+		Store:   store,
+		file:    filepath.Join(dir, name+".json"),
+		entries: make(map[string]*cacheEntry),
+		stopCh:  make(chan struct{}),
+	}
+	data, err := ioutil.ReadFile(c.file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			// a broken cache shouldn't stop the sidecar
+			log.DefaultLogger.Errorf("[configstores] ignore broken cache file %s: %v", c.file, err)
+			c.entries = make(map[string]*cacheEntry)
+		}
+	}
+	interval := cacheFlushInterval
+	utils.GoWithRecover(func() {
+		c.flushLoop(interval)
+	}, nil)
+	return c, nil
+}
+
+// Close writes the items refreshed to disk and stops flushing them periodically.
+func (c *CachedStore) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stopCh)
+		c.flush()
+	})
+}
+
+func (c *CachedStore) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// flush writes the entries to disk if they are refreshed since the last write
+func (c *CachedStore) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dirty {
+		c.persist()
+	}
+}
+
+// Get gets configuration from the store, or from the local cache if the store fails.
+func (c *CachedStore) Get(ctx context.Context, req *GetRequest) ([]*ConfigurationItem, error) {
+	items, _, err := c.GetWithFallback(ctx, req)
+	return items, err
+}
+
+// GetWithFallback is the same as Get, but it also returns the Staleness if the items come from the local cache.
+// The Staleness is nil if the items are fresh.
+func (c *CachedStore) GetWithFallback(ctx context.Context, req *GetRequest) ([]*ConfigurationItem, *Staleness, error) {
+	items, err := c.Store.Get(ctx, req)
+	if err == nil {
+		c.refresh(req, items)
+		return items, nil, nil
+	}
+	cached, staleness := c.lookup(req)
+	if len(cached) == 0 {
+		return nil, nil, err
+	}
+	log.DefaultLogger.Warnf("[configstores] serve %d items from local cache because get failed: %v", len(cached), err)
+	return cached, staleness, nil
+}
+
+// SupportFilter is the same as the wrapped store, as the items served from the local cache are always filtered.
+func (c *CachedStore) SupportFilter() bool {
+	return SupportFilter(c.Store)
+}
+
+// GetSince is the same as the wrapped store, the items changed aren't served from the local cache,
+// since the revisions of them are unknown.
+func (c *CachedStore) GetSince(ctx context.Context, req *GetRequest, revision int64) ([]*ConfigurationItem, int64, error) {
+	return GetSince(ctx, c.Store, req, revision)
+}
+
+// ConnectionState is the same as the wrapped store, even if the items are served from the local cache.
+func (c *CachedStore) ConnectionState() ConnectionState {
+	return ConnectionStateOf(c.Store)
+}
+
+// Delete deletes configuration from the store and the local cache.
+func (c *CachedStore) Delete(ctx context.Context, req *DeleteRequest) error {
+	if err := c.Store.Delete(ctx, req); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range req.Keys {
+		delete(c.entries, cacheKey(req.AppId, req.Group, req.Label, key))
+	}
+	c.persist()
+	return nil
+}
+
+func (c *CachedStore) refresh(req *GetRequest, items []*ConfigurationItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// all the keys in the group are returned, so the absent ones have been deleted
+	if len(req.Keys) == 0 && !req.HasFilter() {
+		prefix := cacheKey(req.AppId, req.Group, req.Label, "")
+		for k := range c.entries {
+			if strings.HasPrefix(k, prefix) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, item := range items {
+		c.entries[cacheKey(req.AppId, req.Group, req.Label, item.Key)] = &cacheEntry{Item: item, CachedAt: now}
+	}
+	c.dirty = true
+}
+
+func (c *CachedStore) lookup(req *GetRequest) ([]*ConfigurationItem, *Staleness) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var matched []*cacheEntry
+	if len(req.Keys) == 0 {
+		prefix := cacheKey(req.AppId, req.Group, req.Label, "")
+		for k, e := range c.entries {
+			if strings.HasPrefix(k, prefix) {
+				matched = append(matched, e)
+			}
+		}
+	} else {
+		for _, key := range req.Keys {
+			if e, ok := c.entries[cacheKey(req.AppId, req.Group, req.Label, key)]; ok {
+				matched = append(matched, e)
+			}
+		}
+	}
+	items := make([]*ConfigurationItem, 0, len(matched))
+	var oldest int64
+	for _, e := range matched {
+		if !MatchKey(req.KeyPattern, e.Item.Key) || !MatchTags(req.Tags, e.Item.Tags) {
+			continue
+		}
+		items = append(items, e.Item)
+		if oldest == 0 || e.CachedAt < oldest {
+			oldest = e.CachedAt
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items, &Staleness{CachedAt: time.Unix(0, oldest*int64(time.Millisecond))}
+}
+
+// persist writes the cache to a temp file and renames it, so the cache file is never half written.
+// It should be called with the lock held.
+func (c *CachedStore) persist() {
+	c.dirty = false
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		log.DefaultLogger.Errorf("[configstores] marshal cache failed: %v", err)
+		return
+	}
+	tmp := c.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.DefaultLogger.Errorf("[configstores] write cache file %s failed: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, c.file); err != nil {
+		log.DefaultLogger.Errorf("[configstores] rename cache file %s failed: %v", tmp, err)
+	}
+}
+
+func cacheKey(appId, group, label, key string) string {
+	return appId + "/" + group + "/" + label + "/" + key
+}
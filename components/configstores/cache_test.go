@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	Store
+	items []*ConfigurationItem
+	err   error
+}
+
+func (f *fakeStore) Get(ctx context.Context, req *GetRequest) ([]*ConfigurationItem, error) {
+	return f.items, f.err
+}
+
+func (f *fakeStore) Delete(ctx context.Context, req *DeleteRequest) error {
+	return f.err
+}
+
+func TestCachedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configcache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := &fakeStore{items: []*ConfigurationItem{{Key: "a", Content: "1"}, {Key: "b", Content: "2"}}}
+	cached, err := NewCachedStore("apollo", store, dir)
+	assert.Nil(t, err)
+	req := &GetRequest{AppId: "app", Group: "g", Label: "l"}
+
+	// fresh
+	items, staleness, err := cached.GetWithFallback(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Nil(t, staleness)
+	assert.Equal(t, 2, len(items))
+	// the items refreshed are written to disk periodically or on close
+	_, err = os.Stat(dir + "/apollo.json")
+	assert.True(t, os.IsNotExist(err))
+	cached.Close()
+	cached.Close()
+
+	// the store is down, and the sidecar restarts
+	store.err = errors.New("net error")
+	cached, err = NewCachedStore("apollo", store, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	items, staleness, err = cached.GetWithFallback(context.Background(), &GetRequest{AppId: "app", Group: "g", Label: "l", Keys: []string{"b", "c"}})
+	assert.Nil(t, err)
+	assert.NotNil(t, staleness)
+	assert.False(t, staleness.CachedAt.IsZero())
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "2", items[0].Content)
+
+	// nothing cached
+	_, _, err = cached.GetWithFallback(context.Background(), &GetRequest{AppId: "app", Group: "other"})
+	assert.Equal(t, "net error", err.Error())
+
+	// keys absent from a full get are removed
+	store.err = nil
+	store.items = []*ConfigurationItem{{Key: "a", Content: "3"}}
+	_, _, err = cached.GetWithFallback(context.Background(), req)
+	assert.Nil(t, err)
+	store.err = errors.New("net error")
+	items, staleness, err = cached.GetWithFallback(context.Background(), req)
+	assert.Nil(t, err)
+	assert.NotNil(t, staleness)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "3", items[0].Content)
+
+	// deleted keys are removed from the cache, and from the disk at once
+	store.err = nil
+	assert.Nil(t, cached.Delete(context.Background(), &DeleteRequest{AppId: "app", Group: "g", Label: "l", Keys: []string{"a"}}))
+	store.err = errors.New("net error")
+	_, err = cached.Get(context.Background(), req)
+	assert.NotNil(t, err)
+	restarted, err := NewCachedStore("apollo", store, dir)
+	assert.Nil(t, err)
+	defer restarted.Close()
+	assert.Equal(t, 0, len(restarted.entries))
+}
+
+func TestCachedStoreFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configcache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	interval := cacheFlushInterval
+	cacheFlushInterval = 10 * time.Millisecond
+	defer func() {
+		cacheFlushInterval = interval
+	}()
+
+	cached, err := NewCachedStore("apollo", &fakeStore{items: []*ConfigurationItem{{Key: "a", Content: "1"}}}, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	_, err = cached.Get(context.Background(), &GetRequest{AppId: "app", Group: "g", Label: "l"})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(dir + "/apollo.json")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewCachedStoreWithBrokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configcache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(dir+"/apollo.json", []byte("{"), 0644))
+
+	cached, err := NewCachedStore("apollo", &fakeStore{}, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	assert.Equal(t, 0, len(cached.entries))
+}
@@ -59,3 +59,20 @@ type Store interface {
 	// GetDefaultLabel returns default label
 	GetDefaultLabel() string
 }
+
+// Unsubscriber is implemented by the stores which can stop the subscriptions of one channel,
+// while StopSubscribe stops all the subscriptions of the store.
+type Unsubscriber interface {
+	// Unsubscribe stops the subscriptions sending the updates to the channel, and releases the updates being sent to it.
+	Unsubscribe(ch chan *SubscribeResp)
+}
+
+// Unsubscribe stops the subscriptions of the channel. If the store doesn't implement Unsubscriber,
+// all of its subscriptions are stopped, since such a store is supposed to serve one subscriber at a time.
+func Unsubscribe(store Store, ch chan *SubscribeResp) {
+	if u, ok := store.(Unsubscriber); ok {
+		u.Unsubscribe(ch)
+		return
+	}
+	store.StopSubscribe()
+}
@@ -15,15 +15,19 @@ package etcdv3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"mosn.io/pkg/utils"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/connectivity"
 	"mosn.io/layotto/components/configstores"
 	"mosn.io/layotto/components/trace"
 	"mosn.io/pkg/log"
@@ -39,6 +43,8 @@ type EtcdV3ConfigStore struct {
 	cancel       context.CancelFunc
 	watchStarted bool
 	watchRespCh  chan *configstores.SubscribeResp
+	// stopCh is closed when the watching is stopped, to release the response being sent
+	stopCh chan struct{}
 }
 
 func (c *EtcdV3ConfigStore) GetDefaultGroup() string {
@@ -117,25 +123,65 @@ func (c *EtcdV3ConfigStore) GetItemsFromAllKeys(kvs []*mvccpb.KeyValue, targetSt
 
 // Get gets configuration from configuration store.
 func (c *EtcdV3ConfigStore) Get(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
-	targetString := []string{req.AppId, "*", "*", "*"}
 	//TODO: the imp read all keys under app, then do match operation, should change later.
 	keyValues, err := c.client.Get(ctx, "/"+req.AppId, clientv3.WithPrefix())
-	res := make([]*configstores.ConfigurationItem, 0)
 	if err != nil {
 		log.DefaultLogger.Errorf("fail get all group key-value,err: %+v", err)
 		return nil, err
 	}
-	targetString[configstores.Group] = req.Group
-	targetString[configstores.Label] = req.Label
+	trace.SetExtraComponentInfo(ctx, fmt.Sprintf("method: %+v, store: %+v", "Get", "etcd"))
+	return c.getItems(keyValues.Kvs, req), nil
+}
+
+// GetSince gets the items changed after the revision by comparing the items at the revision with the current ones.
+func (c *EtcdV3ConfigStore) GetSince(ctx context.Context, req *configstores.GetRequest, revision int64) ([]*configstores.ConfigurationItem, int64, error) {
+	current, err := c.client.Get(ctx, "/"+req.AppId, clientv3.WithPrefix())
+	if err != nil {
+		log.DefaultLogger.Errorf("fail get all group key-value,err: %+v", err)
+		return nil, 0, err
+	}
+	items := c.getItems(current.Kvs, req)
+	if revision <= 0 {
+		return items, current.Header.Revision, nil
+	}
+	previous, err := c.client.Get(ctx, "/"+req.AppId, clientv3.WithPrefix(), clientv3.WithRev(revision))
+	if err != nil {
+		if errors.Is(err, rpctypes.ErrCompacted) || errors.Is(err, rpctypes.ErrFutureRev) {
+			return nil, 0, configstores.ErrRevisionCompacted
+		}
+		log.DefaultLogger.Errorf("fail get key-value at revision %d,err: %+v", revision, err)
+		return nil, 0, err
+	}
+	old := make(map[string]*configstores.ConfigurationItem)
+	for _, item := range c.getItems(previous.Kvs, req) {
+		old[item.Group+"/"+item.Label+"/"+item.Key] = item
+	}
+	changed := make([]*configstores.ConfigurationItem, 0)
+	for _, item := range items {
+		k := item.Group + "/" + item.Label + "/" + item.Key
+		if o, ok := old[k]; !ok || o.Content != item.Content || !reflect.DeepEqual(o.Tags, item.Tags) {
+			changed = append(changed, item)
+		}
+		delete(old, k)
+	}
+	for _, item := range old {
+		changed = append(changed, &configstores.ConfigurationItem{Group: item.Group, Label: item.Label, Key: item.Key, Deleted: true})
+	}
+	return changed, current.Header.Revision, nil
+}
+
+// getItems returns the items of the key-values matching the request
+func (c *EtcdV3ConfigStore) getItems(kvs []*mvccpb.KeyValue, req *configstores.GetRequest) []*configstores.ConfigurationItem {
+	targetString := []string{req.AppId, req.Group, req.Label, "*"}
 	if len(req.Keys) == 0 {
-		return c.GetItemsFromAllKeys(keyValues.Kvs, targetString), nil
+		return c.GetItemsFromAllKeys(kvs, targetString)
 	}
+	res := make([]*configstores.ConfigurationItem, 0)
 	for _, key := range req.Keys {
 		targetString[configstores.Key] = key
-		res = append(res, c.GetItemsFromAllKeys(keyValues.Kvs, targetString)...)
+		res = append(res, c.GetItemsFromAllKeys(kvs, targetString)...)
 	}
-	trace.SetExtraComponentInfo(ctx, fmt.Sprintf("method: %+v, store: %+v", "Get", "etcd"))
-	return res, nil
+	return res
 }
 
 // Set saves configuration into configuration store.
@@ -152,6 +198,22 @@ func (c *EtcdV3ConfigStore) Set(ctx context.Context, req *configstores.SetReques
 	return nil
 }
 
+// SetAtomically implements configstores.AtomicSetter, the items are put in one transaction of etcd.
+// etcd limits the operations of a transaction, which is 128 by default, see --max-txn-ops.
+func (c *EtcdV3ConfigStore) SetAtomically(ctx context.Context, req *configstores.SetRequest) error {
+	var ops []clientv3.Op
+	for _, item := range req.Items {
+		for _, key := range c.ParseKey(req.AppId, item) {
+			ops = append(ops, clientv3.OpPut(key, item.Content))
+		}
+	}
+	if _, err := c.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+		log.DefaultLogger.Errorf("set %d keys atomically failed with error: %+v", len(ops), err)
+		return err
+	}
+	return nil
+}
+
 // Delete deletes configuration from configuration store.
 func (c *EtcdV3ConfigStore) Delete(ctx context.Context, req *configstores.DeleteRequest) error {
 	for _, key := range req.Keys {
@@ -166,32 +228,36 @@ func (c *EtcdV3ConfigStore) Delete(ctx context.Context, req *configstores.Delete
 }
 
 func (c *EtcdV3ConfigStore) processWatchResponse(resp *clientv3.WatchResponse) {
-	res := &configstores.SubscribeResp{StoreName: "etcd", AppId: c.appIdKey}
-	item := &configstores.ConfigurationItem{}
+	res := &configstores.SubscribeResp{StoreName: "etcd", AppId: c.appIdKey, Revision: resp.Header.Revision}
 	if len(resp.Events) == 0 {
 		return
 	}
 	c.RLock()
-	defer c.RUnlock()
 	if !c.watchStarted {
+		c.RUnlock()
 		return
 	}
 	for _, events := range resp.Events {
 		s := strings.Split(string(events.Kv.Key), "/")[1:]
 		if key, ok := c.subscribeKey[string(events.Kv.Key)]; ok {
+			item := &configstores.ConfigurationItem{}
 			item.Group = s[configstores.Group]
 			item.Label = s[configstores.Label]
 			item.Key = key
 			item.Content = string(events.Kv.Value)
+			item.Deleted = events.Type == mvccpb.DELETE
 			res.Items = append(res.Items, item)
 		}
 	}
-	c.watchRespCh <- res
+	ch, stopCh := c.watchRespCh, c.stopCh
+	c.RUnlock()
+	select {
+	case ch <- res:
+	case <-stopCh:
+	}
 }
-func (c *EtcdV3ConfigStore) watch() {
+func (c *EtcdV3ConfigStore) watch(ctx context.Context) {
 	// Add watch for propertyKey from lastUpdatedRevision updated after Initializing
-	ctx, cancel := context.WithCancel(context.Background())
-	c.cancel = cancel
 	ch := c.client.Watch(ctx, "/"+c.appIdKey, clientv3.WithCreatedNotify(), clientv3.WithPrefix())
 	for wc := range ch {
 		c.processWatchResponse(&wc)
@@ -200,17 +266,21 @@ func (c *EtcdV3ConfigStore) watch() {
 
 // Subscribe gets configuration from configuration store and subscribe the updates.
 func (c *EtcdV3ConfigStore) Subscribe(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
-	c.appIdKey = req.AppId
-	c.watchRespCh = ch
 	c.Lock()
 	defer c.Unlock()
+	c.appIdKey = req.AppId
+	c.watchRespCh = ch
 	for _, key := range req.Keys {
 		s := "/" + req.AppId + "/" + req.Group + "/" + req.Label + "/" + key
 		c.subscribeKey[s] = key
 	}
 	if !c.watchStarted {
+		// the watching is canceled by StopSubscribe, which may be called before the goroutine runs
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		c.stopCh = make(chan struct{})
 		utils.GoWithRecover(func() {
-			c.watch()
+			c.watch(ctx)
 		}, nil)
 		c.watchStarted = true
 	}
@@ -220,12 +290,41 @@ func (c *EtcdV3ConfigStore) Subscribe(req *configstores.SubscribeReq, ch chan *c
 func (c *EtcdV3ConfigStore) StopSubscribe() {
 	c.Lock()
 	defer c.Unlock()
+	c.stopWatching()
+}
+
+// Unsubscribe stops watching if the channel is the one subscribing, since the store serves one subscriber at a time
+func (c *EtcdV3ConfigStore) Unsubscribe(ch chan *configstores.SubscribeResp) {
+	c.Lock()
+	defer c.Unlock()
+	if c.watchRespCh == ch {
+		c.stopWatching()
+	}
+}
+
+// stopWatching must be locked
+func (c *EtcdV3ConfigStore) stopWatching() {
 	if !c.watchStarted {
 		return
 	}
 	c.watchStarted = false
 	c.cancel()
-	close(c.watchRespCh)
+	close(c.stopCh)
+}
+
+// ConnectionState reports the state of the grpc connection to the etcd cluster
+func (c *EtcdV3ConfigStore) ConnectionState() configstores.ConnectionState {
+	if c.client == nil {
+		return configstores.Disconnected
+	}
+	switch c.client.ActiveConnection().GetState() {
+	case connectivity.Ready:
+		return configstores.Connected
+	case connectivity.Idle, connectivity.Connecting:
+		return configstores.Connecting
+	default:
+		return configstores.Disconnected
+	}
 }
 
 func (c *EtcdV3ConfigStore) ParseKey(appId string, req *configstores.ConfigurationItem) []string {
@@ -242,9 +242,60 @@ func (suite *ClientTestSuite) Set() {
 		suite.T().Fatal(err)
 	}
 }
+func (suite *ClientTestSuite) GetSince() {
+	t := suite.T()
+	ctx := context.Background()
+	req := &configstores.GetRequest{AppId: "mosn", Group: "default", Label: "default"}
+	items, rev, err := configstores.GetSince(ctx, suite.store, req, 0)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.True(t, rev > 0)
+
+	// only the items changed are returned
+	err = suite.store.Set(ctx, &configstores.SetRequest{AppId: "mosn", Items: []*configstores.ConfigurationItem{{Key: "layotto", Content: "l1", Group: "default", Label: "default"}}})
+	assert.Nil(t, err)
+	items, rev, err = configstores.GetSince(ctx, suite.store, req, rev)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "layotto", items[0].Key)
+	assert.Equal(t, "l1", items[0].Content)
+
+	err = suite.store.Delete(ctx, &configstores.DeleteRequest{AppId: "mosn", Group: "default", Label: "default", Keys: []string{"layotto"}})
+	assert.Nil(t, err)
+	items, rev, err = configstores.GetSince(ctx, suite.store, req, rev)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "layotto", items[0].Key)
+	assert.True(t, items[0].Deleted)
+
+	items, _, err = configstores.GetSince(ctx, suite.store, req, rev)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+
+	_, _, err = configstores.GetSince(ctx, suite.store, req, rev+100)
+	assert.Equal(t, configstores.ErrRevisionCompacted, err)
+}
+
+func (suite *ClientTestSuite) SetAtomically() {
+	t := suite.T()
+	ctx := context.Background()
+	native, err := configstores.SetAtomically(ctx, suite.store, &configstores.SetRequest{AppId: "mosn", Items: []*configstores.ConfigurationItem{
+		{Key: "a", Content: "1", Group: "batch", Label: "default"},
+		{Key: "b", Content: "2", Group: "batch", Label: "default"},
+	}})
+	assert.Nil(t, err)
+	assert.True(t, native)
+	items, err := suite.store.Get(ctx, &configstores.GetRequest{AppId: "mosn", Group: "batch", Label: "default", Keys: []string{"a", "b"}})
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.Nil(t, suite.store.Delete(ctx, &configstores.DeleteRequest{AppId: "mosn", Group: "batch", Label: "default", Keys: []string{"a", "b"}}))
+}
+
 func (suite *ClientTestSuite) TestEtcd() {
 	suite.Set()
 	suite.Get()
+	suite.GetSince()
+	suite.SetAtomically()
 	go suite.Subscribe()
 	time.Sleep(1 * time.Second)
 	suite.Set()
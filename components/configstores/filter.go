@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import "strings"
+
+// FilterSupporter is implemented by the stores which filter items by the KeyPattern and Tags of GetRequest themselves.
+// For the other stores, the runtime filters the items returned by Get.
+type FilterSupporter interface {
+	SupportFilter() bool
+}
+
+// SupportFilter returns true if the store filters items by KeyPattern and Tags itself.
+func SupportFilter(store Store) bool {
+	f, ok := store.(FilterSupporter)
+	return ok && f.SupportFilter()
+}
+
+// HasFilter returns true if the request has KeyPattern or Tags.
+func (r *GetRequest) HasFilter() bool {
+	return r.KeyPattern != "" || len(r.Tags) > 0
+}
+
+// FilterItems returns the items matching both the KeyPattern and the Tags of the request.
+func FilterItems(req *GetRequest, items []*ConfigurationItem) []*ConfigurationItem {
+	if !req.HasFilter() {
+		return items
+	}
+	res := make([]*ConfigurationItem, 0, len(items))
+	for _, item := range items {
+		if MatchKey(req.KeyPattern, item.Key) && MatchTags(req.Tags, item.Tags) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// MatchKey reports whether the key matches the pattern, in which `*` matches any sequence of characters.
+// An empty pattern matches any key.
+func MatchKey(pattern string, key string) bool {
+	if pattern == "" {
+		return true
+	}
+	parts := strings.Split(pattern, "*")
+	// no wildcard
+	if len(parts) == 1 {
+		return pattern == key
+	}
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		idx := strings.Index(key, p)
+		if idx < 0 {
+			return false
+		}
+		key = key[idx+len(p):]
+	}
+	return len(key) >= len(last) && strings.HasSuffix(key, last)
+}
+
+// MatchTags reports whether tags contains all the wanted ones.
+func MatchTags(want map[string]string, tags map[string]string) bool {
+	for k, v := range want {
+		if actual, ok := tags[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
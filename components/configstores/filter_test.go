@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchKey(t *testing.T) {
+	assert.True(t, MatchKey("", "a"))
+	assert.True(t, MatchKey("a", "a"))
+	assert.False(t, MatchKey("a", "ab"))
+	assert.True(t, MatchKey("db.*", "db.url"))
+	assert.False(t, MatchKey("db.*", "cache.url"))
+	assert.True(t, MatchKey("*.url", "db.url"))
+	assert.True(t, MatchKey("db.*.url", "db.master.url"))
+	assert.False(t, MatchKey("db.*.url", "db.master.port"))
+	assert.True(t, MatchKey("*", ""))
+	assert.False(t, MatchKey("a*a", "a"))
+}
+
+func TestFilterItems(t *testing.T) {
+	items := []*ConfigurationItem{
+		{Key: "db.url", Tags: map[string]string{"env": "prod"}},
+		{Key: "db.port", Tags: map[string]string{"env": "test"}},
+		{Key: "cache.url"},
+	}
+	res := FilterItems(&GetRequest{}, items)
+	assert.Equal(t, 3, len(res))
+
+	res = FilterItems(&GetRequest{KeyPattern: "db.*"}, items)
+	assert.Equal(t, 2, len(res))
+
+	res = FilterItems(&GetRequest{KeyPattern: "db.*", Tags: map[string]string{"env": "prod"}}, items)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "db.url", res[0].Key)
+
+	res = FilterItems(&GetRequest{Tags: map[string]string{"owner": "layotto"}}, items)
+	assert.Equal(t, 0, len(res))
+}
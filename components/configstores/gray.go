@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"net"
+	"strings"
+)
+
+const (
+	// GrayIPsKey is the metadata or tag key of a ConfigurationItem in gray release.
+	// Its value is the comma separated ips of the sidecars which should receive the item.
+	GrayIPsKey = "gray_ips"
+	// GrayLabelsKey is the metadata or tag key of a ConfigurationItem in gray release.
+	// Its value is the comma separated labels of the sidecars which should receive the item.
+	GrayLabelsKey = "gray_labels"
+	// ClientIPKey is the metadata key of a subscription request, specifying the ip used to match gray release rules.
+	// The ip of the sidecar is used if it's absent.
+	ClientIPKey = "client_ip"
+	// ClientLabelsKey is the metadata key of a subscription request, specifying the comma separated labels used to match gray release rules.
+	ClientLabelsKey = "client_labels"
+)
+
+// GrayTarget identifies a sidecar when matching the gray release rules of configuration items.
+// Stores which support gray release put the rules into the metadata of items with GrayIPsKey and GrayLabelsKey,
+// and only the sidecars matching the rules receive the items. The rules can also be saved as the tags of the items,
+// which are kept by the stores such as apollo and etcd.
+type GrayTarget struct {
+	IP     string
+	Labels []string
+}
+
+// NewGrayTarget creates a GrayTarget from the metadata of a subscription request.
+func NewGrayTarget(metadata map[string]string) *GrayTarget {
+	t := &GrayTarget{
+		IP:     metadata[ClientIPKey],
+		Labels: splitAndTrim(metadata[ClientLabelsKey]),
+	}
+	if t.IP == "" {
+		t.IP = localIP()
+	}
+	return t
+}
+
+// Match reports whether the item should be received by the target.
+// Items without gray release rules match all the targets.
+func (t *GrayTarget) Match(item *ConfigurationItem) bool {
+	ips := splitAndTrim(grayRule(item, GrayIPsKey))
+	labels := splitAndTrim(grayRule(item, GrayLabelsKey))
+	if len(ips) == 0 && len(labels) == 0 {
+		return true
+	}
+	for _, ip := range ips {
+		if ip == t.IP {
+			return true
+		}
+	}
+	for _, l := range labels {
+		for _, own := range t.Labels {
+			if l == own {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter returns the items which should be received by the target.
+func (t *GrayTarget) Filter(items []*ConfigurationItem) []*ConfigurationItem {
+	res := make([]*ConfigurationItem, 0, len(items))
+	for _, item := range items {
+		if t.Match(item) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// grayRule returns the rule in the metadata of the item, or in the tags if it's absent in the metadata
+func grayRule(item *ConfigurationItem, key string) string {
+	if v, ok := item.Metadata[key]; ok {
+		return v
+	}
+	return item.Tags[key]
+}
+
+func splitAndTrim(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// localIP returns the first non-loopback ipv4 address
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
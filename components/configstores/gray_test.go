@@ -0,0 +1,49 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrayTarget(t *testing.T) {
+	target := NewGrayTarget(map[string]string{ClientIPKey: "10.0.0.1", ClientLabelsKey: "canary, blue"})
+	assert.Equal(t, "10.0.0.1", target.IP)
+	assert.Equal(t, []string{"canary", "blue"}, target.Labels)
+
+	items := []*ConfigurationItem{
+		{Key: "normal"},
+		{Key: "ip", Metadata: map[string]string{GrayIPsKey: "10.0.0.2,10.0.0.1"}},
+		{Key: "label", Metadata: map[string]string{GrayLabelsKey: "blue"}},
+		{Key: "others", Metadata: map[string]string{GrayIPsKey: "10.0.0.2", GrayLabelsKey: "green"}},
+		{Key: "tag", Tags: map[string]string{GrayLabelsKey: "canary"}},
+		{Key: "others", Tags: map[string]string{GrayIPsKey: "10.0.0.2"}},
+	}
+	res := target.Filter(items)
+	assert.Equal(t, 4, len(res))
+	for _, item := range res {
+		assert.NotEqual(t, "others", item.Key)
+	}
+}
+
+func TestNewGrayTargetWithLocalIP(t *testing.T) {
+	target := NewGrayTarget(nil)
+	assert.Equal(t, localIP(), target.IP)
+	assert.Nil(t, target.Labels)
+}
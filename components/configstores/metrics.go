@@ -0,0 +1,169 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+// ConnectionState is the state of the connection from a store to its servers
+type ConnectionState string
+
+const (
+	// ConnectionUnknown is the state of the stores not reporting their connections
+	ConnectionUnknown ConnectionState = "unknown"
+	Connected         ConnectionState = "connected"
+	// Connecting means the store is connecting or reconnecting to the servers
+	Connecting   ConnectionState = "connecting"
+	Disconnected ConnectionState = "disconnected"
+)
+
+// ConnectionReporter is implemented by the stores keeping long connections to the servers, e.g. etcd and nacos
+type ConnectionReporter interface {
+	ConnectionState() ConnectionState
+}
+
+// ConnectionStateOf returns the connection state of the store, it's ConnectionUnknown if the store doesn't report it
+func ConnectionStateOf(store Store) ConnectionState {
+	r, ok := store.(ConnectionReporter)
+	if !ok {
+		return ConnectionUnknown
+	}
+	return r.ConnectionState()
+}
+
+// PushStats are the counters of the subscription responses of a store pushed to the apps
+type PushStats struct {
+	Pushed int64
+	Errors int64
+	// Lag is the time from the store change to sending the latest response of the changes,
+	// which is measured only if the servers report the time of the changes
+	Lag time.Duration
+}
+
+type storeMetrics struct {
+	metrics types.Metrics
+	pushed  int64
+	errors  int64
+	lag     int64
+}
+
+// stores maps the store names to the *storeMetrics
+var stores sync.Map
+
+func metricsOf(store string) *storeMetrics {
+	if v, ok := stores.Load(store); ok {
+		return v.(*storeMetrics)
+	}
+	s := &storeMetrics{}
+	m, err := metrics.NewMetrics("configuration", map[string]string{"store": store})
+	if err != nil {
+		log.DefaultLogger.Warnf("[configstores] create metrics of store %s error: %v", store, err)
+	} else {
+		s.metrics = m
+	}
+	v, _ := stores.LoadOrStore(store, s)
+	return v.(*storeMetrics)
+}
+
+// RecordPush records a subscription response of the store sent to the app, the store is the name of the store subscribed.
+// The changedAt is when the store changed reported by the servers, the lag isn't recorded if it's zero.
+func RecordPush(store string, changedAt time.Time, err error) {
+	s := metricsOf(store)
+	if err != nil {
+		atomic.AddInt64(&s.errors, 1)
+		if s.metrics != nil {
+			s.metrics.Counter("push_errors").Inc(1)
+		}
+		return
+	}
+	atomic.AddInt64(&s.pushed, 1)
+	if s.metrics != nil {
+		s.metrics.Counter("pushed").Inc(1)
+	}
+	if changedAt.IsZero() {
+		return
+	}
+	lag := time.Since(changedAt)
+	atomic.StoreInt64(&s.lag, int64(lag))
+	if s.metrics != nil {
+		s.metrics.Histogram("subscription_lag_ms").Update(lag.Milliseconds())
+	}
+}
+
+// PushStatsOf returns the push stats of the store
+func PushStatsOf(store string) PushStats {
+	s := metricsOf(store)
+	return PushStats{
+		Pushed: atomic.LoadInt64(&s.pushed),
+		Errors: atomic.LoadInt64(&s.errors),
+		Lag:    time.Duration(atomic.LoadInt64(&s.lag)),
+	}
+}
+
+// RecordConnectionState updates the gauge "connected" of the store, which is 1 if it's connected,
+// 0 if not and -1 if the state is unknown
+func RecordConnectionState(store string, state ConnectionState) {
+	s := metricsOf(store)
+	if s.metrics == nil {
+		return
+	}
+	var v int64
+	switch state {
+	case Connected:
+		v = 1
+	case ConnectionUnknown:
+		v = -1
+	}
+	s.metrics.Gauge("connected").Update(v)
+}
+
+// WatchConnections refreshes the gauges of the connection states of the stores periodically, until stop is called
+func WatchConnections(stores map[string]Store, interval time.Duration) (stop func()) {
+	copied := make(map[string]Store, len(stores))
+	for name, store := range stores {
+		copied[name] = store
+	}
+	stopCh := make(chan struct{})
+	utils.GoWithRecover(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for name, store := range copied {
+				RecordConnectionState(name, ConnectionStateOf(store))
+			}
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}, nil)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+		})
+	}
+}
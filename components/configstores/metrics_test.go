@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConnectionStore struct {
+	fakeStore
+	state ConnectionState
+}
+
+func (f *fakeConnectionStore) ConnectionState() ConnectionState {
+	return f.state
+}
+
+func TestConnectionStateOf(t *testing.T) {
+	assert.Equal(t, ConnectionUnknown, ConnectionStateOf(&fakeStore{}))
+	assert.Equal(t, Connecting, ConnectionStateOf(&fakeConnectionStore{state: Connecting}))
+
+	dir, err := ioutil.TempDir("", "configstores")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cached, err := NewCachedStore("etcd", &fakeConnectionStore{state: Connected}, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	assert.Equal(t, Connected, ConnectionStateOf(cached))
+
+	RecordConnectionState("etcd", Connected)
+}
+
+func TestRecordPush(t *testing.T) {
+	RecordPush("push_test", time.Time{}, nil)
+	assert.Equal(t, PushStats{Pushed: 1}, PushStatsOf("push_test"))
+
+	RecordPush("push_test", time.Now().Add(-time.Second), nil)
+	RecordPush("push_test", time.Now(), errors.New("broken"))
+	stats := PushStatsOf("push_test")
+	assert.Equal(t, int64(2), stats.Pushed)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.True(t, stats.Lag >= time.Second)
+
+	assert.Equal(t, PushStats{}, PushStatsOf("unknown"))
+}
+
+func TestWatchConnections(t *testing.T) {
+	stop := WatchConnections(map[string]Store{"etcd": &fakeConnectionStore{state: Connected}}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	stop()
+	stop()
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	accessTokenHeader = "accessToken"
+	loginPath         = "/v1/auth/login"
+)
+
+// authenticator logs in the Nacos server through the HTTP API, and refreshes the access token before it expires
+type authenticator struct {
+	addrs       []string
+	contextPath string
+	username    string
+	password    string
+	client      *http.Client
+
+	mu        sync.Mutex
+	accessKey string
+	expireAt  time.Time
+}
+
+type loginResponse struct {
+	AccessToken string `json:"accessToken"`
+	TokenTtl    int64  `json:"tokenTtl"`
+}
+
+func (a *authenticator) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.accessKey != "" && time.Now().Before(a.expireAt) {
+		return a.accessKey, nil
+	}
+	var err error
+	for _, addr := range a.addrs {
+		var resp *loginResponse
+		if resp, err = a.login(addr); err != nil {
+			continue
+		}
+		a.accessKey = resp.AccessToken
+		// the token is refreshed when 90% of its ttl passed
+		a.expireAt = time.Now().Add(time.Duration(resp.TokenTtl) * time.Second * 9 / 10)
+		return a.accessKey, nil
+	}
+	return "", err
+}
+
+func (a *authenticator) login(addr string) (*loginResponse, error) {
+	form := url.Values{"username": {a.username}, "password": {a.password}}
+	resp, err := a.client.PostForm("http://"+trimScheme(addr)+a.contextPath+loginPath, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("login nacos failed with status %d: %s", resp.StatusCode, body)
+	}
+	res := &loginResponse{}
+	if err = json.Unmarshal(body, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func trimScheme(addr string) string {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return addr[i+3:]
+	}
+	return addr
+}
@@ -0,0 +1,345 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/components/configstores"
+)
+
+const (
+	// grpcPortOffset is the offset of the gRPC port to the HTTP port of the Nacos server
+	grpcPortOffset  = 1000
+	requestMethod   = "/Request/request"
+	biStreamMethod  = "/BiRequestStream/requestBiStream"
+	registerRetries = 5
+	registerWait    = 100 * time.Millisecond
+	reconnectWait   = time.Second
+)
+
+var errClientClosed = errors.New("nacos client is closed")
+
+var biStreamDesc = &grpc.StreamDesc{
+	StreamName:    "requestBiStream",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// responseError is the error returned by the Nacos server
+type responseError struct {
+	ErrorCode int
+	Message   string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("nacos error %d: %s", e.ErrorCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*responseError)
+	return ok && e.ErrorCode == errorCodeNotFound
+}
+
+// grpcClient is the long connection to the Nacos server through the gRPC protocol of Nacos 2.x.
+// The server pushes the changes through the bi-directional stream, and the client acknowledges them.
+// The connection is rebuilt with the next server if the stream is broken.
+type grpcClient struct {
+	addrs       []string
+	timeout     time.Duration
+	dialOptions []grpc.DialOption
+	auth        *authenticator
+	// onPush is called for the changes pushed by the server
+	onPush func(cfg configContext)
+	// onReconnected is called after the connection is rebuilt, to listen the configs again
+	onReconnected func()
+
+	mu     sync.RWMutex
+	next   int
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	closed bool
+	// connected is false while reconnecting
+	connected bool
+	stopCh    chan struct{}
+}
+
+// start connects to a server and keeps the connection in background
+func (c *grpcClient) start() error {
+	c.stopCh = make(chan struct{})
+	stream, err := c.connect()
+	if err != nil {
+		return err
+	}
+	utils.GoWithRecover(func() {
+		c.run(stream)
+	}, nil)
+	return nil
+}
+
+func (c *grpcClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.stopCh)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *grpcClient) state() configstores.ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch {
+	case c.closed:
+		return configstores.Disconnected
+	case c.connected:
+		return configstores.Connected
+	default:
+		return configstores.Connecting
+	}
+}
+
+func (c *grpcClient) run(stream grpc.ClientStream) {
+	for {
+		err := c.serve(stream)
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+		log.DefaultLogger.Warnf("[nacos] connection is broken, reconnecting: %v", err)
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-time.After(reconnectWait):
+			}
+			if stream, err = c.connect(); err == nil {
+				break
+			}
+			log.DefaultLogger.Errorf("[nacos] reconnect error: %v", err)
+		}
+		if c.onReconnected != nil {
+			utils.GoWithRecover(c.onReconnected, nil)
+		}
+	}
+}
+
+// connect checks the next server, and sets up the bi-directional stream
+func (c *grpcClient) connect() (grpc.ClientStream, error) {
+	c.mu.Lock()
+	addr := c.addrs[c.next%len(c.addrs)]
+	c.next++
+	c.mu.Unlock()
+	target, err := grpcAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	opts := append([]grpc.DialOption{grpc.WithInsecure()}, c.dialOptions...)
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// the server is checked before setting up the stream
+	check := &serverCheckResponse{}
+	if err = c.invoke(context.Background(), conn, typeServerCheckRequest, &request{Module: moduleInternal}, check); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, biStreamDesc, biStreamMethod, grpc.ForceCodec(payloadCodec{}))
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+	setup := &connectionSetupRequest{
+		request:       request{Headers: map[string]string{}, Module: moduleInternal},
+		ClientVersion: clientVersion,
+		Labels:        map[string]string{"source": "sdk", "module": moduleConfig},
+	}
+	if err = sendPayload(stream, typeConnectionSetupRequest, setup); err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cancel()
+		conn.Close()
+		return nil, errClientClosed
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn, c.cancel = conn, cancel
+	c.connected = true
+	log.DefaultLogger.Infof("[nacos] connected to %s, connection id: %s", target, check.ConnectionId)
+	return stream, nil
+}
+
+// serve handles the requests pushed by the server until the stream is broken
+func (c *grpcClient) serve(stream grpc.ClientStream) error {
+	for {
+		p := &payload{}
+		if err := stream.RecvMsg(p); err != nil {
+			return err
+		}
+		switch p.Type {
+		case typeConfigChangeNotifyRequest:
+			req := &configChangeNotifyRequest{}
+			if err := json.Unmarshal(p.Body, req); err != nil {
+				log.DefaultLogger.Errorf("[nacos] illegal push: %v", err)
+				continue
+			}
+			// the push is acknowledged before querying the config
+			if err := sendPayload(stream, typeConfigChangeNotifyResponse, ack(req.RequestId)); err != nil {
+				return err
+			}
+			if c.onPush != nil {
+				cfg := req.configContext
+				utils.GoWithRecover(func() {
+					c.onPush(cfg)
+				}, nil)
+			}
+		case typeClientDetectionRequest:
+			req := &request{}
+			json.Unmarshal(p.Body, req)
+			if err := sendPayload(stream, typeClientDetectionResponse, ack(req.RequestId)); err != nil {
+				return err
+			}
+		case typeConnectResetRequest:
+			req := &request{}
+			json.Unmarshal(p.Body, req)
+			sendPayload(stream, typeConnectResetResponse, ack(req.RequestId))
+			return errors.New("connection is reset by the server")
+		default:
+			log.DefaultLogger.Debugf("[nacos] ignore the request %s pushed by the server", p.Type)
+		}
+	}
+}
+
+// request sends the request through the current connection, it's retried if the connection isn't registered yet
+func (c *grpcClient) request(ctx context.Context, typ string, req interface{}, resp interface{}) error {
+	var err error
+	for i := 0; i < registerRetries; i++ {
+		c.mu.RLock()
+		conn := c.conn
+		c.mu.RUnlock()
+		if conn == nil {
+			return errClientClosed
+		}
+		err = c.invoke(ctx, conn, typ, req, resp)
+		if e, ok := err.(*responseError); !ok || e.ErrorCode != errorCodeUnregistered {
+			return err
+		}
+		time.Sleep(registerWait)
+	}
+	return err
+}
+
+func (c *grpcClient) invoke(ctx context.Context, conn *grpc.ClientConn, typ string, req interface{}, resp interface{}) error {
+	headers := map[string]string{}
+	if c.auth != nil {
+		token, err := c.auth.token()
+		if err != nil {
+			return err
+		}
+		headers[accessTokenHeader] = token
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	// the headers are in both the metadata and the body
+	if len(headers) > 0 {
+		m := map[string]interface{}{}
+		if err = json.Unmarshal(body, &m); err != nil {
+			return err
+		}
+		m["headers"] = headers
+		if body, err = json.Marshal(m); err != nil {
+			return err
+		}
+	}
+	in := &payload{Type: typ, Headers: headers, Body: body}
+	out := &payload{}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err = conn.Invoke(ctx, requestMethod, in, out, grpc.ForceCodec(payloadCodec{})); err != nil {
+		return err
+	}
+	result := &response{}
+	if err = json.Unmarshal(out.Body, result); err != nil {
+		return err
+	}
+	if out.Type == typeErrorResponse || result.ResultCode != resultCodeSuccess {
+		return &responseError{ErrorCode: result.ErrorCode, Message: result.Message}
+	}
+	return json.Unmarshal(out.Body, resp)
+}
+
+func sendPayload(stream grpc.ClientStream, typ string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(&payload{Type: typ, Body: body})
+}
+
+func ack(requestId string) *response {
+	return &response{ResultCode: resultCodeSuccess, RequestId: requestId}
+}
+
+// grpcAddress returns the gRPC address of the server, whose port is the HTTP port plus 1000
+func grpcAddress(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(trimScheme(addr))
+	if err != nil {
+		return "", err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+grpcPortOffset)), nil
+}
@@ -0,0 +1,402 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/components/configstores"
+)
+
+const (
+	defaultGroup       = "DEFAULT_GROUP"
+	defaultTimeout     = 3 * time.Second
+	defaultContextPath = "/nacos"
+	// resyncInterval is the interval of listening all the subscribed configs again, in case a push is lost
+	resyncInterval = 5 * time.Minute
+
+	namespaceKey   = "namespace"
+	usernameKey    = "username"
+	passwordKey    = "password"
+	contextPathKey = "context_path"
+
+	// the metadata of the items
+	md5Key          = "md5"
+	contentTypeKey  = "content_type"
+	lastModifiedKey = "last_modified"
+)
+
+var (
+	ErrNoAddress = errors.New("configuration illegal:no address")
+	ErrNoKeys    = errors.New("params illegal:no keys")
+)
+
+// ConfigStore is the config store of Nacos 2.x, which subscribes the changes through the gRPC long connection.
+// The group of the API is the group of Nacos, the label of the API is the namespace of Nacos,
+// and the key of the API is the data id of Nacos.
+type ConfigStore struct {
+	client    *grpcClient
+	namespace string
+
+	mu sync.Mutex
+	// subscribed is the md5 of the subscribed configs
+	subscribed map[configContext]string
+	ch         chan *configstores.SubscribeResp
+	// unsubscribeCh is closed by StopSubscribe, to stop notifying the subscriber
+	unsubscribeCh chan struct{}
+	// refreshMu serializes the refreshes, so that a stale value queried by an earlier push is never notified after a newer one
+	refreshMu sync.Mutex
+	storeName string
+	stopCh    chan struct{}
+	closeOnce sync.Once
+	// dialOptions is used by the tests
+	dialOptions []grpc.DialOption
+}
+
+func NewStore() configstores.Store {
+	return &ConfigStore{subscribed: make(map[configContext]string)}
+}
+
+func (c *ConfigStore) Init(config *configstores.StoreConfig) error {
+	if len(config.Address) == 0 {
+		return ErrNoAddress
+	}
+	timeout := defaultTimeout
+	if t, err := strconv.Atoi(config.TimeOut); err == nil && t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+	c.storeName = config.StoreName
+	c.namespace = config.Metadata[namespaceKey]
+	c.client = &grpcClient{
+		addrs:         config.Address,
+		timeout:       timeout,
+		dialOptions:   c.dialOptions,
+		onPush:        c.refresh,
+		onReconnected: c.relisten,
+	}
+	if username := config.Metadata[usernameKey]; username != "" {
+		contextPath := defaultContextPath
+		if p, ok := config.Metadata[contextPathKey]; ok {
+			contextPath = p
+		}
+		c.client.auth = &authenticator{
+			addrs:       config.Address,
+			contextPath: contextPath,
+			username:    username,
+			password:    config.Metadata[passwordKey],
+			client:      &http.Client{Timeout: timeout},
+		}
+	}
+	c.stopCh = make(chan struct{})
+	if err := c.client.start(); err != nil {
+		return err
+	}
+	utils.GoWithRecover(c.resync, nil)
+	return nil
+}
+
+func (c *ConfigStore) GetDefaultGroup() string {
+	return defaultGroup
+}
+
+// GetDefaultLabel returns the namespace in the metadata, the public namespace is used if it's empty
+func (c *ConfigStore) GetDefaultLabel() string {
+	return c.namespace
+}
+
+// Get gets the configs by the keys, since Nacos can't list the configs through the gRPC protocol
+func (c *ConfigStore) Get(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+	if len(req.Keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	res := make([]*configstores.ConfigurationItem, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		resp, err := c.query(ctx, configContext{DataId: key, Group: req.Group, Tenant: req.Label})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.DefaultLogger.Errorf("[nacos] get config %s error: %v", key, err)
+			return nil, err
+		}
+		res = append(res, newItem(key, req.Group, req.Label, resp))
+	}
+	return res, nil
+}
+
+func (c *ConfigStore) Set(ctx context.Context, req *configstores.SetRequest) error {
+	for _, item := range req.Items {
+		group := item.Group
+		if group == "" {
+			group = defaultGroup
+		}
+		publish := &configPublishRequest{
+			configRequest: newConfigRequest(configContext{DataId: item.Key, Group: group, Tenant: item.Label}),
+			Content:       item.Content,
+			AdditionMap:   map[string]string{"appName": req.AppId},
+		}
+		if err := c.client.request(ctx, typeConfigPublishRequest, publish, &response{}); err != nil {
+			log.DefaultLogger.Errorf("[nacos] set config %s error: %v", item.Key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ConfigStore) Delete(ctx context.Context, req *configstores.DeleteRequest) error {
+	for _, key := range req.Keys {
+		remove := &configRemoveRequest{
+			configRequest: newConfigRequest(configContext{DataId: key, Group: req.Group, Tenant: req.Label}),
+		}
+		if err := c.client.request(ctx, typeConfigRemoveRequest, remove, &response{}); err != nil {
+			log.DefaultLogger.Errorf("[nacos] delete config %s error: %v", key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe listens the configs of the keys, and the changes are pushed by the server
+func (c *ConfigStore) Subscribe(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
+	if len(req.Keys) == 0 {
+		return ErrNoKeys
+	}
+	contexts := make([]configListenContext, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		cfg := configContext{DataId: key, Group: req.Group, Tenant: req.Label}
+		// the current md5 is listened, so that only the later changes are notified
+		var md5 string
+		resp, err := c.query(context.Background(), cfg)
+		if err == nil {
+			md5 = resp.Md5
+		} else if !isNotFound(err) {
+			return err
+		}
+		contexts = append(contexts, configListenContext{DataId: key, Group: req.Group, Tenant: req.Label, Md5: md5})
+	}
+	c.mu.Lock()
+	c.ch = ch
+	if c.unsubscribeCh == nil {
+		c.unsubscribeCh = make(chan struct{})
+	}
+	for _, l := range contexts {
+		c.subscribed[configContext{DataId: l.DataId, Group: l.Group, Tenant: l.Tenant}] = l.Md5
+	}
+	c.mu.Unlock()
+	return c.listen(contexts)
+}
+
+func (c *ConfigStore) StopSubscribe() {
+	c.mu.Lock()
+	contexts := c.unsubscribe()
+	c.mu.Unlock()
+	c.unlisten(contexts)
+}
+
+// Unsubscribe stops listening if the channel is the one subscribing, since the store serves one subscriber at a time
+func (c *ConfigStore) Unsubscribe(ch chan *configstores.SubscribeResp) {
+	c.mu.Lock()
+	if c.ch != ch {
+		c.mu.Unlock()
+		return
+	}
+	contexts := c.unsubscribe()
+	c.mu.Unlock()
+	c.unlisten(contexts)
+}
+
+// unsubscribe clears the subscription and returns the configs to unlisten, must be locked
+func (c *ConfigStore) unsubscribe() []configListenContext {
+	contexts := make([]configListenContext, 0, len(c.subscribed))
+	for cfg := range c.subscribed {
+		contexts = append(contexts, configListenContext{DataId: cfg.DataId, Group: cfg.Group, Tenant: cfg.Tenant})
+	}
+	c.subscribed = make(map[configContext]string)
+	c.ch = nil
+	if c.unsubscribeCh != nil {
+		close(c.unsubscribeCh)
+		c.unsubscribeCh = nil
+	}
+	return contexts
+}
+
+// unlisten removes the listeners of the configs from the server
+func (c *ConfigStore) unlisten(contexts []configListenContext) {
+	if len(contexts) == 0 {
+		return
+	}
+	req := &configBatchListenRequest{
+		request:              request{Headers: map[string]string{}, Module: moduleConfig},
+		Listen:               false,
+		ConfigListenContexts: contexts,
+	}
+	if err := c.client.request(context.Background(), typeConfigBatchListenRequest, req, &configChangeBatchListenResponse{}); err != nil {
+		log.DefaultLogger.Warnf("[nacos] stop listening error: %v", err)
+	}
+}
+
+// ConnectionState reports the state of the long connection to the server
+func (c *ConfigStore) ConnectionState() configstores.ConnectionState {
+	if c.client == nil {
+		return configstores.Disconnected
+	}
+	return c.client.state()
+}
+
+// Close closes the connection to the server, it can be called more than once
+func (c *ConfigStore) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stopCh)
+		c.client.close()
+	})
+	return nil
+}
+
+// listen registers the listeners, and refreshes the configs changed since their md5
+func (c *ConfigStore) listen(contexts []configListenContext) error {
+	req := &configBatchListenRequest{
+		request:              request{Headers: map[string]string{}, Module: moduleConfig},
+		Listen:               true,
+		ConfigListenContexts: contexts,
+	}
+	resp := &configChangeBatchListenResponse{}
+	if err := c.client.request(context.Background(), typeConfigBatchListenRequest, req, resp); err != nil {
+		log.DefaultLogger.Errorf("[nacos] listen configs error: %v", err)
+		return err
+	}
+	// the changes are refreshed in background like the pushes, since the subscriber may not receive them yet
+	for _, cfg := range resp.ChangedConfigs {
+		cfg := cfg
+		utils.GoWithRecover(func() {
+			c.refresh(cfg)
+		}, nil)
+	}
+	return nil
+}
+
+// relisten listens all the subscribed configs, since the listeners are bound to the connection
+func (c *ConfigStore) relisten() {
+	c.mu.Lock()
+	contexts := make([]configListenContext, 0, len(c.subscribed))
+	for cfg, md5 := range c.subscribed {
+		contexts = append(contexts, configListenContext{DataId: cfg.DataId, Group: cfg.Group, Tenant: cfg.Tenant, Md5: md5})
+	}
+	c.mu.Unlock()
+	if len(contexts) > 0 {
+		c.listen(contexts)
+	}
+}
+
+func (c *ConfigStore) resync() {
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.relisten()
+		}
+	}
+}
+
+// refresh queries the changed config, and notifies the subscriber if its md5 is changed
+func (c *ConfigStore) refresh(cfg configContext) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.mu.Lock()
+	_, ok := c.subscribed[cfg]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	resp, err := c.query(context.Background(), cfg)
+	deleted := isNotFound(err)
+	if err != nil && !deleted {
+		log.DefaultLogger.Errorf("[nacos] refresh config %s error: %v", cfg.DataId, err)
+		return
+	}
+	var item *configstores.ConfigurationItem
+	if deleted {
+		item = &configstores.ConfigurationItem{Key: cfg.DataId, Group: cfg.Group, Label: cfg.Tenant, Deleted: true}
+		resp = &configQueryResponse{}
+	} else {
+		item = newItem(cfg.DataId, cfg.Group, cfg.Tenant, resp)
+	}
+
+	c.mu.Lock()
+	md5, ok := c.subscribed[cfg]
+	if !ok || md5 == resp.Md5 {
+		c.mu.Unlock()
+		return
+	}
+	c.subscribed[cfg] = resp.Md5
+	ch, unsubscribeCh := c.ch, c.unsubscribeCh
+	c.mu.Unlock()
+	if ch == nil {
+		return
+	}
+	// the time of deleting isn't known, and the lag isn't measured then
+	var changedAt time.Time
+	if resp.LastModified > 0 {
+		changedAt = time.Unix(0, resp.LastModified*int64(time.Millisecond))
+	}
+	// the refresh lock is held until the subscriber receives it, or the subscription is stopped
+	select {
+	case ch <- &configstores.SubscribeResp{StoreName: c.storeName, Items: []*configstores.ConfigurationItem{item}, ChangedAt: changedAt}:
+	case <-unsubscribeCh:
+	case <-c.stopCh:
+	}
+}
+
+func (c *ConfigStore) query(ctx context.Context, cfg configContext) (*configQueryResponse, error) {
+	resp := &configQueryResponse{}
+	err := c.client.request(ctx, typeConfigQueryRequest, &configQueryRequest{configRequest: newConfigRequest(cfg)}, resp)
+	return resp, err
+}
+
+func newConfigRequest(cfg configContext) configRequest {
+	return configRequest{
+		request: request{Headers: map[string]string{}, Module: moduleConfig},
+		DataId:  cfg.DataId,
+		Group:   cfg.Group,
+		Tenant:  cfg.Tenant,
+	}
+}
+
+func newItem(key, group, label string, resp *configQueryResponse) *configstores.ConfigurationItem {
+	return &configstores.ConfigurationItem{
+		Key:     key,
+		Content: resp.Content,
+		Group:   group,
+		Label:   label,
+		Metadata: map[string]string{
+			md5Key:          resp.Md5,
+			contentTypeKey:  resp.ContentType,
+			lastModifiedKey: strconv.FormatInt(resp.LastModified, 10),
+		},
+	}
+}
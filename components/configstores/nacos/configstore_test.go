@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"mosn.io/layotto/components/configstores"
+)
+
+// fakeServer implements the config requests of Nacos 2.x in memory
+type fakeServer struct {
+	mu      sync.Mutex
+	configs map[configContext]string
+	pushCh  chan configContext
+	ackCh   chan string
+}
+
+func (s *fakeServer) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if method == biStreamMethod {
+		return s.serveStream(stream)
+	}
+	in := &payload{}
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	var resp interface{} = ack("")
+	switch in.Type {
+	case typeConfigQueryRequest:
+		req := &configQueryRequest{}
+		json.Unmarshal(in.Body, req)
+		s.mu.Lock()
+		content, ok := s.configs[configContext{DataId: req.DataId, Group: req.Group, Tenant: req.Tenant}]
+		s.mu.Unlock()
+		if !ok {
+			resp = &response{ResultCode: 500, ErrorCode: errorCodeNotFound, Message: "config data not exist"}
+		} else {
+			resp = &configQueryResponse{response: *ack(""), Content: content, Md5: content, LastModified: 1}
+		}
+	case typeConfigPublishRequest:
+		req := &configPublishRequest{}
+		json.Unmarshal(in.Body, req)
+		s.mu.Lock()
+		s.configs[configContext{DataId: req.DataId, Group: req.Group, Tenant: req.Tenant}] = req.Content
+		s.mu.Unlock()
+	case typeConfigRemoveRequest:
+		req := &configRemoveRequest{}
+		json.Unmarshal(in.Body, req)
+		s.mu.Lock()
+		delete(s.configs, configContext{DataId: req.DataId, Group: req.Group, Tenant: req.Tenant})
+		s.mu.Unlock()
+	case typeConfigBatchListenRequest:
+		resp = &configChangeBatchListenResponse{response: *ack("")}
+	}
+	body, _ := json.Marshal(resp)
+	return stream.SendMsg(&payload{Type: in.Type, Body: body})
+}
+
+func (s *fakeServer) serveStream(stream grpc.ServerStream) error {
+	setup := &payload{}
+	if err := stream.RecvMsg(setup); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			p := &payload{}
+			if err := stream.RecvMsg(p); err != nil {
+				return
+			}
+			res := &response{}
+			json.Unmarshal(p.Body, res)
+			s.ackCh <- res.RequestId
+		}
+	}()
+	for cfg := range s.pushCh {
+		push := &configChangeNotifyRequest{request: request{RequestId: "1"}, configContext: cfg}
+		if err := sendPayload(stream, typeConfigChangeNotifyRequest, push); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestConfigStore(t *testing.T) {
+	fake := &fakeServer{
+		configs: map[configContext]string{},
+		pushCh:  make(chan configContext),
+		ackCh:   make(chan string, 1),
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.CustomCodec(payloadCodec{}), grpc.UnknownServiceHandler(fake.handle))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	defer close(fake.pushCh)
+
+	store := NewStore().(*ConfigStore)
+	store.dialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return lis.Dial()
+	})}
+	assert.Equal(t, ErrNoAddress, store.Init(&configstores.StoreConfig{}))
+	err := store.Init(&configstores.StoreConfig{StoreName: "nacos", Address: []string{"127.0.0.1:8848"}, Metadata: map[string]string{"namespace": "dev"}})
+	assert.Nil(t, err)
+	defer store.Close()
+	assert.Equal(t, configstores.Connected, store.ConnectionState())
+	assert.Equal(t, "DEFAULT_GROUP", store.GetDefaultGroup())
+	assert.Equal(t, "dev", store.GetDefaultLabel())
+
+	// set and get
+	ctx := context.Background()
+	err = store.Set(ctx, &configstores.SetRequest{AppId: "app", Items: []*configstores.ConfigurationItem{{Key: "k1", Content: "v1", Label: "dev"}}})
+	assert.Nil(t, err)
+	items, err := store.Get(ctx, &configstores.GetRequest{Group: "DEFAULT_GROUP", Label: "dev", Keys: []string{"k1", "k2"}})
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "v1", items[0].Content)
+	assert.Equal(t, "v1", items[0].Metadata[md5Key])
+	_, err = store.Get(ctx, &configstores.GetRequest{})
+	assert.Equal(t, ErrNoKeys, err)
+
+	// the pushes are acknowledged, and only the changes are notified
+	ch := make(chan *configstores.SubscribeResp, 1)
+	err = store.Subscribe(&configstores.SubscribeReq{Group: "DEFAULT_GROUP", Label: "dev", Keys: []string{"k1"}}, ch)
+	assert.Nil(t, err)
+	cfg := configContext{DataId: "k1", Group: "DEFAULT_GROUP", Tenant: "dev"}
+	fake.pushCh <- cfg
+	assert.Equal(t, "1", <-fake.ackCh)
+	select {
+	case <-ch:
+		t.Fatal("unchanged config is notified")
+	case <-time.After(100 * time.Millisecond):
+	}
+	fake.mu.Lock()
+	fake.configs[cfg] = "v2"
+	fake.mu.Unlock()
+	fake.pushCh <- cfg
+	<-fake.ackCh
+	resp := <-ch
+	assert.Equal(t, "nacos", resp.StoreName)
+	assert.Equal(t, "v2", resp.Items[0].Content)
+	assert.False(t, resp.ChangedAt.IsZero())
+
+	// the deletion is notified
+	err = store.Delete(ctx, &configstores.DeleteRequest{Group: "DEFAULT_GROUP", Label: "dev", Keys: []string{"k1"}})
+	assert.Nil(t, err)
+	fake.pushCh <- cfg
+	<-fake.ackCh
+	resp = <-ch
+	assert.True(t, resp.Items[0].Deleted)
+	store.StopSubscribe()
+
+	// the notification isn't blocked by the subscriber stopped
+	unread := make(chan *configstores.SubscribeResp)
+	err = store.Subscribe(&configstores.SubscribeReq{Group: "DEFAULT_GROUP", Label: "dev", Keys: []string{"k1"}}, unread)
+	assert.Nil(t, err)
+	fake.mu.Lock()
+	fake.configs[cfg] = "v3"
+	fake.mu.Unlock()
+	refreshed := make(chan struct{})
+	go func() {
+		store.refresh(cfg)
+		close(refreshed)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	store.StopSubscribe()
+	<-refreshed
+
+	// it can be closed more than once
+	assert.Nil(t, store.Close())
+}
+
+func TestPayloadCodec(t *testing.T) {
+	codec := payloadCodec{}
+	in := &payload{Type: "ConfigQueryRequest", ClientIp: "127.0.0.1", Headers: map[string]string{"accessToken": "token"}, Body: []byte(`{"dataId":"k"}`)}
+	data, err := codec.Marshal(in)
+	assert.Nil(t, err)
+	out := &payload{}
+	assert.Nil(t, codec.Unmarshal(data, out))
+	assert.Equal(t, in, out)
+	_, err = codec.Marshal("illegal")
+	assert.NotNil(t, err)
+}
+
+func TestGrpcAddress(t *testing.T) {
+	addr, err := grpcAddress("http://127.0.0.1:8848")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:9848", addr)
+	_, err = grpcAddress("127.0.0.1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+const (
+	moduleConfig   = "config"
+	moduleInternal = "internal"
+	clientVersion  = "Nacos-Layotto-Client:v2.0.0"
+)
+
+// the types of the requests and responses of Nacos 2.x
+const (
+	typeServerCheckRequest         = "ServerCheckRequest"
+	typeConnectionSetupRequest     = "ConnectionSetupRequest"
+	typeConfigQueryRequest         = "ConfigQueryRequest"
+	typeConfigPublishRequest       = "ConfigPublishRequest"
+	typeConfigRemoveRequest        = "ConfigRemoveRequest"
+	typeConfigBatchListenRequest   = "ConfigBatchListenRequest"
+	typeConfigChangeNotifyRequest  = "ConfigChangeNotifyRequest"
+	typeConfigChangeNotifyResponse = "ConfigChangeNotifyResponse"
+	typeClientDetectionRequest     = "ClientDetectionRequest"
+	typeClientDetectionResponse    = "ClientDetectionResponse"
+	typeConnectResetRequest        = "ConnectResetRequest"
+	typeConnectResetResponse       = "ConnectResetResponse"
+	typeErrorResponse              = "ErrorResponse"
+)
+
+const (
+	resultCodeSuccess = 200
+	// errorCodeNotFound is returned by ConfigQueryRequest if the config doesn't exist
+	errorCodeNotFound = 300
+	// errorCodeUnregistered is returned if the connection isn't set up yet
+	errorCodeUnregistered = 301
+)
+
+type request struct {
+	Headers   map[string]string `json:"headers"`
+	RequestId string            `json:"requestId,omitempty"`
+	Module    string            `json:"module"`
+}
+
+type response struct {
+	ResultCode int    `json:"resultCode"`
+	ErrorCode  int    `json:"errorCode"`
+	Message    string `json:"message"`
+	RequestId  string `json:"requestId"`
+}
+
+type serverCheckResponse struct {
+	response
+	ConnectionId string `json:"connectionId"`
+}
+
+type connectionSetupRequest struct {
+	request
+	ClientVersion string            `json:"clientVersion"`
+	Tenant        string            `json:"tenant"`
+	Labels        map[string]string `json:"labels"`
+}
+
+type configRequest struct {
+	request
+	DataId string `json:"dataId"`
+	Group  string `json:"group"`
+	Tenant string `json:"tenant"`
+}
+
+type configQueryRequest struct {
+	configRequest
+	Tag string `json:"tag,omitempty"`
+}
+
+type configQueryResponse struct {
+	response
+	Content      string `json:"content"`
+	ContentType  string `json:"contentType"`
+	Md5          string `json:"md5"`
+	LastModified int64  `json:"lastModified"`
+	Tag          string `json:"tag"`
+}
+
+type configPublishRequest struct {
+	configRequest
+	Content     string            `json:"content"`
+	CasMd5      string            `json:"casMd5,omitempty"`
+	AdditionMap map[string]string `json:"additionMap,omitempty"`
+}
+
+type configRemoveRequest struct {
+	configRequest
+	Tag string `json:"tag,omitempty"`
+}
+
+type configListenContext struct {
+	DataId string `json:"dataId"`
+	Group  string `json:"group"`
+	Tenant string `json:"tenant"`
+	Md5    string `json:"md5"`
+}
+
+type configBatchListenRequest struct {
+	request
+	Listen               bool                  `json:"listen"`
+	ConfigListenContexts []configListenContext `json:"configListenContexts"`
+}
+
+type configContext struct {
+	DataId string `json:"dataId"`
+	Group  string `json:"group"`
+	Tenant string `json:"tenant"`
+}
+
+type configChangeBatchListenResponse struct {
+	response
+	ChangedConfigs []configContext `json:"changedConfigs"`
+}
+
+// configChangeNotifyRequest is pushed by the server through the bi-directional stream
+type configChangeNotifyRequest struct {
+	request
+	configContext
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacos
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// payload is the message of the gRPC services of Nacos 2.x.
+// The type of the request or response is in the metadata, and the body is the request or response in JSON.
+//
+//	message Metadata { string type = 3; map<string, string> headers = 7; string clientIp = 8; }
+//	message Payload { Metadata metadata = 2; google.protobuf.Any body = 3; }
+type payload struct {
+	Type     string
+	ClientIp string
+	Headers  map[string]string
+	Body     []byte
+}
+
+// payloadCodec encodes the payloads, so that the client doesn't depend on the generated code of Nacos
+type payloadCodec struct{}
+
+func (payloadCodec) Marshal(v interface{}) ([]byte, error) {
+	p, ok := v.(*payload)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message %T", v)
+	}
+	var md []byte
+	md = appendString(md, 3, p.Type)
+	for k, v := range p.Headers {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, v)
+		md = protowire.AppendTag(md, 7, protowire.BytesType)
+		md = protowire.AppendBytes(md, entry)
+	}
+	if p.ClientIp != "" {
+		md = appendString(md, 8, p.ClientIp)
+	}
+	var body []byte
+	body = protowire.AppendTag(body, 2, protowire.BytesType)
+	body = protowire.AppendBytes(body, p.Body)
+
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, md)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, body)
+	return b, nil
+}
+
+func (payloadCodec) Unmarshal(data []byte, v interface{}) error {
+	p, ok := v.(*payload)
+	if !ok {
+		return fmt.Errorf("unexpected message %T", v)
+	}
+	return consumeFields(data, func(num protowire.Number, b []byte) error {
+		switch num {
+		case 2:
+			return consumeFields(b, func(num protowire.Number, b []byte) error {
+				switch num {
+				case 3:
+					p.Type = string(b)
+				case 8:
+					p.ClientIp = string(b)
+				case 7:
+					var k, v string
+					err := consumeFields(b, func(num protowire.Number, b []byte) error {
+						if num == 1 {
+							k = string(b)
+						} else if num == 2 {
+							v = string(b)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					if p.Headers == nil {
+						p.Headers = make(map[string]string)
+					}
+					p.Headers[k] = v
+				}
+				return nil
+			})
+		case 3:
+			return consumeFields(b, func(num protowire.Number, b []byte) error {
+				if num == 2 {
+					p.Body = append([]byte(nil), b...)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func (payloadCodec) Name() string {
+	return "proto"
+}
+
+// String implements the deprecated grpc.Codec
+func (payloadCodec) String() string {
+	return "proto"
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// consumeFields calls fn with the length-delimited fields, and the other fields are skipped
+func consumeFields(data []byte, fn func(num protowire.Number, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		b, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, b); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrRevisionNotSupported is returned by GetSince if the store doesn't keep the revisions
+	ErrRevisionNotSupported = errors.New("the configuration store doesn't support revisions")
+	// ErrRevisionCompacted is returned by GetSince if the history since the revision has been compacted
+	ErrRevisionCompacted = errors.New("the revision has been compacted")
+)
+
+// RevisionStore is implemented by the stores keeping the history of the configurations by revision, e.g. etcd,
+// so that the subscribers can resume from the revision of the last update they received instead of a snapshot.
+// The stores set the Revision of SubscribeResp to the revision after the changes.
+type RevisionStore interface {
+	// GetSince returns the items changed after the revision, in which the deleted ones are marked, and the current revision.
+	// All the current items are returned if the revision is 0.
+	GetSince(ctx context.Context, req *GetRequest, revision int64) ([]*ConfigurationItem, int64, error)
+}
+
+// GetSince gets the items changed after the revision from the store, it returns ErrRevisionNotSupported
+// if the store doesn't keep the revisions.
+func GetSince(ctx context.Context, store Store, req *GetRequest, revision int64) ([]*ConfigurationItem, int64, error) {
+	r, ok := store.(RevisionStore)
+	if !ok {
+		return nil, 0, ErrRevisionNotSupported
+	}
+	return r.GetSince(ctx, req, revision)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configstores
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRevisionStore struct {
+	fakeStore
+	revision int64
+}
+
+func (f *fakeRevisionStore) GetSince(ctx context.Context, req *GetRequest, revision int64) ([]*ConfigurationItem, int64, error) {
+	if revision > f.revision {
+		return nil, 0, ErrRevisionCompacted
+	}
+	return f.items, f.revision, f.err
+}
+
+func TestGetSince(t *testing.T) {
+	req := &GetRequest{AppId: "app", Group: "g", Label: "l"}
+	_, _, err := GetSince(context.Background(), &fakeStore{}, req, 0)
+	assert.Equal(t, ErrRevisionNotSupported, err)
+
+	store := &fakeRevisionStore{fakeStore: fakeStore{items: []*ConfigurationItem{{Key: "a", Content: "1"}}}, revision: 10}
+	items, rev, err := GetSince(context.Background(), store, req, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), rev)
+	assert.Len(t, items, 1)
+
+	// the cached store resumes like the store wrapped
+	dir, err := ioutil.TempDir("", "configcache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cached, err := NewCachedStore("etcd", store, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	_, rev, err = GetSince(context.Background(), cached, req, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), rev)
+	_, _, err = GetSince(context.Background(), cached, req, 11)
+	assert.Equal(t, ErrRevisionCompacted, err)
+
+	cached, err = NewCachedStore("apollo", &fakeStore{}, dir)
+	assert.Nil(t, err)
+	defer cached.Close()
+	_, _, err = GetSince(context.Background(), cached, req, 0)
+	assert.Equal(t, ErrRevisionNotSupported, err)
+}
@@ -16,12 +16,17 @@
 
 package configstores
 
+import "time"
+
 // StoreConfig wraps configuration for a store implementation
 type StoreConfig struct {
 	StoreName string            `json:"store_name"`
 	Address   []string          `json:"address"`
 	TimeOut   string            `json:"timeout"`
 	Metadata  map[string]string `json:"metadata"`
+	// CacheDir enables the local cache persisted in this directory.
+	// If it is set, the last known good configuration is served when the store is unavailable.
+	CacheDir string `json:"cache_dir"`
 }
 
 // GetRequest is the object describing a get configuration request
@@ -31,6 +36,10 @@ type GetRequest struct {
 	Label    string
 	Keys     []string
 	Metadata map[string]string
+	// KeyPattern filters keys with `*` matching any sequence of characters. Only used when Keys is empty.
+	KeyPattern string
+	// Tags filters the items which have all these tags.
+	Tags map[string]string
 }
 
 // SetRequest is the object describing a save configuration request
@@ -48,6 +57,8 @@ type ConfigurationItem struct {
 	Label    string
 	Tags     map[string]string
 	Metadata map[string]string
+	// Deleted marks the item is deleted. Only used in SubscribeResp.
+	Deleted bool
 }
 
 // DeleteRequest is the object describing a delete configuration request
@@ -73,4 +84,12 @@ type SubscribeResp struct {
 	StoreName string
 	AppId     string
 	Items     []*ConfigurationItem
+	// Snapshot means the items are the current values of all the subscribed keys rather than the changed ones.
+	// Components send incremental updates, and the snapshot is made by the runtime when subscribing.
+	Snapshot bool
+	// Revision is the revision of the store after the changes, it's 0 if the store doesn't keep the revisions.
+	Revision int64
+	// ChangedAt is when the store changed by the clock of the servers, e.g. the modification time of the item.
+	// It's zero for the snapshots and if the servers don't report it, and the lag isn't recorded then.
+	ChangedAt time.Time
 }
@@ -31,3 +31,82 @@ type File interface {
 	Del(context.Context, *DelRequest) error
 	Stat(context.Context, *FileMetaRequest) (*FileMetaResp, error)
 }
+
+// Tagger is implemented by the components which support tagging files, e.g. object tagging of s3
+type Tagger interface {
+	Tag(context.Context, *TagRequest) error
+}
+
+// UserMetadataSupporter is implemented by the components which store the user metadata with the files, e.g. the object metadata of s3
+type UserMetadataSupporter interface {
+	SupportUserMetadata() bool
+}
+
+// ProgressSupporter is implemented by the components which report the bytes uploaded by PutFileStu.Progress
+type ProgressSupporter interface {
+	SupportProgress() bool
+}
+
+// Restorer is implemented by the components which support the archive storage classes, e.g. Glacier of aws s3.
+// The archived files should be restored before they can be got.
+type Restorer interface {
+	Restore(context.Context, *RestoreRequest) error
+}
+
+// UploadCleaner is implemented by the components which keep the incomplete uploads of the aborted puts,
+// e.g. the multipart uploads of s3, which cost storage until they're aborted
+type UploadCleaner interface {
+	ListIncompleteUploads(context.Context, *ListIncompleteUploadsRequest) ([]*IncompleteUpload, error)
+	AbortUpload(context.Context, *AbortUploadRequest) error
+}
+
+// Wrapper is implemented by the wrappers of the components, e.g. the encryption of the runtime,
+// so that the optional capabilities of the wrapped component can be found
+type Wrapper interface {
+	Unwrap() File
+}
+
+// AsTagger returns the Tagger in the chain of the wrappers
+func AsTagger(f File) (Tagger, bool) {
+	for f != nil {
+		if t, ok := f.(Tagger); ok {
+			return t, true
+		}
+		w, ok := f.(Wrapper)
+		if !ok {
+			break
+		}
+		f = w.Unwrap()
+	}
+	return nil, false
+}
+
+// AsRestorer returns the Restorer in the chain of the wrappers
+func AsRestorer(f File) (Restorer, bool) {
+	for f != nil {
+		if r, ok := f.(Restorer); ok {
+			return r, true
+		}
+		w, ok := f.(Wrapper)
+		if !ok {
+			break
+		}
+		f = w.Unwrap()
+	}
+	return nil, false
+}
+
+// AsUploadCleaner returns the UploadCleaner in the chain of the wrappers
+func AsUploadCleaner(f File) (UploadCleaner, bool) {
+	for f != nil {
+		if c, ok := f.(UploadCleaner); ok {
+			return c, true
+		}
+		w, ok := f.(Wrapper)
+		if !ok {
+			break
+		}
+		f = w.Unwrap()
+	}
+	return nil, false
+}
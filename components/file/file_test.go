@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFile struct {
+	File
+}
+
+type fakeRestorer struct {
+	fakeFile
+}
+
+func (f *fakeRestorer) Restore(context.Context, *RestoreRequest) error {
+	return nil
+}
+
+type fakeWrapper struct {
+	File
+}
+
+func (w *fakeWrapper) Unwrap() File {
+	return w.File
+}
+
+func TestAsRestorer(t *testing.T) {
+	_, ok := AsRestorer(&fakeFile{})
+	assert.False(t, ok)
+	_, ok = AsTagger(&fakeFile{})
+	assert.False(t, ok)
+
+	restorer := &fakeRestorer{}
+	r, ok := AsRestorer(&fakeWrapper{File: &fakeWrapper{File: restorer}})
+	assert.True(t, ok)
+	assert.Equal(t, restorer, r)
+	_, ok = AsTagger(&fakeWrapper{File: restorer})
+	assert.False(t, ok)
+	_, ok = AsRestorer(nil)
+	assert.False(t, ok)
+}
+
+type fakeUploadCleaner struct {
+	fakeFile
+}
+
+func (f *fakeUploadCleaner) ListIncompleteUploads(context.Context, *ListIncompleteUploadsRequest) ([]*IncompleteUpload, error) {
+	return nil, nil
+}
+
+func (f *fakeUploadCleaner) AbortUpload(context.Context, *AbortUploadRequest) error {
+	return nil
+}
+
+func TestAsUploadCleaner(t *testing.T) {
+	_, ok := AsUploadCleaner(&fakeWrapper{File: &fakeRestorer{}})
+	assert.False(t, ok)
+
+	cleaner := &fakeUploadCleaner{}
+	c, ok := AsUploadCleaner(&fakeWrapper{File: cleaner})
+	assert.True(t, ok)
+	assert.Equal(t, cleaner, c)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SortByName         = "name"
+	SortBySize         = "size"
+	SortByLastModified = "last_modified"
+)
+
+// lastModifiedLayout is the layout of time.Time.String(), which is used by the components to format FilesInfo.LastModified
+const lastModifiedLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// IsValidSortKey tells whether the files can be sorted by the key, the empty key keeps the order of the component
+func IsValidSortKey(key string) bool {
+	switch key {
+	case "", SortByName, SortBySize, SortByLastModified:
+		return true
+	}
+	return false
+}
+
+// FilterFiles filters the files by the options of the request, then sorts them.
+// It's idempotent, so it's safe to apply it to the files which are filtered by the component already.
+func FilterFiles(req *ListRequest, files []*FilesInfo) []*FilesInfo {
+	res := make([]*FilesInfo, 0, len(files))
+	for _, f := range files {
+		if match(req, f) {
+			res = append(res, f)
+		}
+	}
+	if req.SortBy == "" {
+		return res
+	}
+	less := func(a, b *FilesInfo) bool {
+		switch req.SortBy {
+		case SortBySize:
+			return a.Size < b.Size
+		case SortByLastModified:
+			ta, _ := ParseLastModified(a.LastModified)
+			tb, _ := ParseLastModified(b.LastModified)
+			return ta.Before(tb)
+		default:
+			return a.FileName < b.FileName
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if req.Descending {
+			return less(res[j], res[i])
+		}
+		return less(res[i], res[j])
+	})
+	return res
+}
+
+func match(req *ListRequest, f *FilesInfo) bool {
+	name := f.FileName
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if !strings.HasPrefix(name, req.Prefix) || !strings.HasSuffix(name, req.Suffix) {
+		return false
+	}
+	if !req.ModifiedAfter.IsZero() || !req.ModifiedBefore.IsZero() {
+		t, err := ParseLastModified(f.LastModified)
+		if err != nil {
+			return false
+		}
+		if !req.ModifiedAfter.IsZero() && t.Before(req.ModifiedAfter) {
+			return false
+		}
+		if !req.ModifiedBefore.IsZero() && !t.Before(req.ModifiedBefore) {
+			return false
+		}
+	}
+	for k, v := range req.MetadataFilter {
+		if actual, ok := f.Meta[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLastModified parses FilesInfo.LastModified, which is formatted by time.Time.String() or in RFC3339
+func ParseLastModified(s string) (time.Time, error) {
+	// drop the monotonic clock reading, e.g. " m=+0.000000001"
+	if idx := strings.Index(s, " m="); idx >= 0 {
+		s = s[:idx]
+	}
+	t, err := time.Parse(lastModifiedLayout, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterFiles(t *testing.T) {
+	now := time.Date(2021, 11, 12, 10, 0, 0, 0, time.UTC)
+	files := []*FilesInfo{
+		{FileName: "dir/app.log", Size: 3, LastModified: now.Add(-time.Hour).String(), Meta: map[string]string{"k": "v"}},
+		{FileName: "dir/app.txt", Size: 1, LastModified: now.String()},
+		{FileName: "dir/gc.log", Size: 2, LastModified: now.Add(time.Hour).String()},
+		{FileName: "dir/bad.log", Size: 4, LastModified: "unknown"},
+	}
+
+	res := FilterFiles(&ListRequest{Prefix: "app"}, files)
+	assert.Len(t, res, 2)
+
+	res = FilterFiles(&ListRequest{Suffix: ".log", SortBy: SortBySize, Descending: true}, files)
+	assert.Len(t, res, 3)
+	assert.Equal(t, "dir/bad.log", res[0].FileName)
+	assert.Equal(t, "dir/gc.log", res[2].FileName)
+
+	// the files whose modified time can't be parsed are excluded by the time filters
+	res = FilterFiles(&ListRequest{ModifiedAfter: now, SortBy: SortByLastModified}, files)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "dir/app.txt", res[0].FileName)
+	res = FilterFiles(&ListRequest{ModifiedBefore: now}, files)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "dir/app.log", res[0].FileName)
+
+	res = FilterFiles(&ListRequest{MetadataFilter: map[string]string{"k": "v"}}, files)
+	assert.Len(t, res, 1)
+
+	// the order of the component is kept without sort key
+	res = FilterFiles(&ListRequest{}, files)
+	assert.Equal(t, files, res)
+}
+
+func TestIsValidSortKey(t *testing.T) {
+	assert.True(t, IsValidSortKey(""))
+	assert.True(t, IsValidSortKey(SortByLastModified))
+	assert.False(t, IsValidSortKey("unknown"))
+}
@@ -111,6 +111,10 @@ func (h *hdfs) Put(ctx context.Context, stu *file.PutFileStu) error {
 	_, err = client.Write(stu.FileName, stu.DataStream, size)
 
 	if err != nil {
+		// the partial file is removed, e.g. when the client disconnected mid-stream
+		if delErr := client.Delete(stu.FileName); delErr != nil {
+			return fmt.Errorf("hdfs put file[%s] fail,err: %s, delete partial file fail,err: %s", stu.FileName, err.Error(), delErr.Error())
+		}
 		return err
 	}
 
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -62,14 +64,25 @@ func (lf *LocalStore) Put(ctx context.Context, f *file.PutFileStu) error {
 		return fmt.Errorf("wrong fileFlag value:%+v in metadata", err)
 	}
 
+	// the partial file is removed if the put fails, unless it exists before
+	_, err = os.Stat(f.FileName)
+	created := os.IsNotExist(err)
 	fileObj, err := os.OpenFile(f.FileName, fl, os.FileMode(m))
 	if err != nil {
 		return err
 	}
 	defer fileObj.Close()
+	if err = writeFile(fileObj, f.DataStream); err != nil && created {
+		fileObj.Close()
+		os.Remove(f.FileName)
+	}
+	return err
+}
+
+func writeFile(fileObj *os.File, src io.Reader) error {
 	data := make([]byte, 512, 512)
 	for {
-		n, err := f.DataStream.Read(data)
+		n, err := src.Read(data)
 		if err != nil {
 			if err == io.EOF {
 				if n > 0 {
@@ -164,5 +177,8 @@ func (lf *LocalStore) Stat(ctx context.Context, f *file.FileMetaRequest) (*file.
 	}
 	resp.Metadata[FileMode] = append(resp.Metadata[FileMode], m)
 	resp.Metadata[FileIsDir] = append(resp.Metadata[FileIsDir], isDir)
+	if !fileInfo.IsDir() {
+		resp.ContentType = mime.TypeByExtension(filepath.Ext(f.FileName))
+	}
 	return resp, nil
 }
@@ -116,3 +116,26 @@ func TestFile(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, exist, false)
 }
+
+func TestPutAborted(t *testing.T) {
+	ls := &LocalStore{}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("hello"))
+		writer.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+	f := &file.PutFileStu{
+		FileName:   "aborted.txt",
+		DataStream: reader,
+		Metadata: map[string]string{
+			FileMode: strconv.Itoa(0777),
+			FileFlag: strconv.Itoa(os.O_RDWR | os.O_CREATE),
+		},
+	}
+	err := ls.Put(context.TODO(), f)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	// the partial file is removed
+	exist, err := CheckFileExist(f.FileName)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
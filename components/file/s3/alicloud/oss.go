@@ -76,7 +76,10 @@ func (s *AliCloudOSS) Init(ctx context.Context, metadata *file.FileConfig) error
 }
 
 func (s *AliCloudOSS) Put(ctx context.Context, st *file.PutFileStu) error {
-	storageType := st.Metadata[storageTypeKey]
+	storageType := st.StorageClass
+	if storageType == "" {
+		storageType = st.Metadata[storageTypeKey]
+	}
 	if storageType == "" {
 		storageType = "Standard"
 	}
@@ -88,7 +91,14 @@ func (s *AliCloudOSS) Put(ctx context.Context, st *file.PutFileStu) error {
 	if err != nil {
 		return fmt.Errorf("put file[%s] fail,err: %s", st.FileName, err.Error())
 	}
-	err = bucket.PutObject(fileNameWithoutBucket, st.DataStream, oss.ObjectStorageClass(oss.StorageClassType(storageType)), oss.ObjectACL(oss.ACLPublicRead))
+	options := []oss.Option{oss.ObjectStorageClass(oss.StorageClassType(storageType)), oss.ObjectACL(oss.ACLPublicRead)}
+	for k, v := range st.UserMetadata {
+		options = append(options, oss.Meta(k, v))
+	}
+	if st.Progress != nil {
+		options = append(options, oss.Progress(&progressListener{progress: st.Progress}))
+	}
+	err = bucket.PutObject(fileNameWithoutBucket, st.DataStream, options...)
 	if err != nil {
 		return fmt.Errorf("put file[%s] fail,err: %s", st.FileName, err.Error())
 	}
@@ -115,7 +125,8 @@ func (s *AliCloudOSS) List(ctx context.Context, request *file.ListRequest) (*fil
 		return nil, fmt.Errorf("list directory[%s] fail, err: %s", request.DirectoryName, err.Error())
 	}
 	resp := &file.ListResp{}
-	prefix := loss.GetFilePrefixName(request.DirectoryName)
+	// the prefix filter is pushed down, the other filters are applied by the runtime
+	prefix := loss.GetFilePrefixName(request.DirectoryName) + request.Prefix
 	object, err := bucket.ListObjectsV2(oss.StartAfter(request.Marker), oss.MaxKeys(int(request.PageSize)), oss.Prefix(prefix))
 	if err != nil {
 		return nil, fmt.Errorf("list directory[%s] fail, err: %s", request.DirectoryName, err.Error())
@@ -189,9 +200,140 @@ func (s *AliCloudOSS) Stat(ctx context.Context, request *file.FileMetaRequest) (
 		}
 		resp.Metadata[k] = append(resp.Metadata[k], v...)
 	}
+	// the content type and the storage class are only returned by the detailed meta
+	detail, err := bucket.GetObjectDetailedMeta(fileNameWithoutBucket)
+	if err != nil {
+		return nil, err
+	}
+	resp.ETag = loss.TrimETag(detail.Get(oss.HTTPHeaderEtag))
+	resp.UserMetadata = loss.UserMetadata(detail, oss.HTTPHeaderOssMetaPrefix)
+	resp.ContentType = detail.Get(oss.HTTPHeaderContentType)
+	resp.StorageClass = detail.Get(oss.HTTPHeaderOssStorageClass)
+	if resp.StorageClass == "" {
+		resp.StorageClass = string(oss.StorageStandard)
+	}
+	// the tags are fetched by another request, which is skipped if it's not permitted
+	if tagging, err := bucket.GetObjectTagging(fileNameWithoutBucket); err == nil {
+		resp.Tags = make(map[string]string, len(tagging.Tags))
+		for _, t := range tagging.Tags {
+			resp.Tags[t.Key] = t.Value
+		}
+	}
 	return resp, nil
 }
 
+// SupportUserMetadata implements file.UserMetadataSupporter, the user metadata is stored as object metadata.
+func (s *AliCloudOSS) SupportUserMetadata() bool {
+	return true
+}
+
+// SupportProgress implements file.ProgressSupporter, the progress is reported while the data is sent.
+func (s *AliCloudOSS) SupportProgress() bool {
+	return true
+}
+
+// progressListener reports the bytes sent by the transferring events
+type progressListener struct {
+	progress func(uploaded int64)
+}
+
+func (l *progressListener) ProgressChanged(event *oss.ProgressEvent) {
+	if event.EventType == oss.TransferDataEvent {
+		l.progress(event.ConsumedBytes)
+	}
+}
+
+func (s *AliCloudOSS) Tag(ctx context.Context, request *file.TagRequest) error {
+	bucket, err := s.getBucket(request.FileName, request.Metadata)
+	if err != nil {
+		return fmt.Errorf("tag file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	fileNameWithoutBucket, err := loss.GetFileName(request.FileName)
+	if err != nil {
+		return fmt.Errorf("tag file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	if len(request.Tags) == 0 {
+		err = bucket.DeleteObjectTagging(fileNameWithoutBucket)
+	} else {
+		tagging := oss.Tagging{Tags: make([]oss.Tag, 0, len(request.Tags))}
+		for k, v := range request.Tags {
+			tagging.Tags = append(tagging.Tags, oss.Tag{Key: k, Value: v})
+		}
+		err = bucket.PutObjectTagging(fileNameWithoutBucket, tagging)
+	}
+	if err != nil {
+		if e, ok := err.(oss.ServiceError); ok && e.StatusCode == 404 {
+			return file.ErrNotExist
+		}
+		return fmt.Errorf("tag file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	return nil
+}
+
+// Restore restores a temporary copy of the object in Archive or ColdArchive storage class.
+func (s *AliCloudOSS) Restore(ctx context.Context, request *file.RestoreRequest) error {
+	bucket, err := s.getBucket(request.FileName, request.Metadata)
+	if err != nil {
+		return fmt.Errorf("restore file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	fileNameWithoutBucket, err := loss.GetFileName(request.FileName)
+	if err != nil {
+		return fmt.Errorf("restore file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	err = bucket.RestoreObjectDetail(fileNameWithoutBucket, oss.RestoreConfiguration{Days: request.Days, Tier: request.Tier})
+	if err != nil {
+		if e, ok := err.(oss.ServiceError); ok && e.StatusCode == 404 {
+			return file.ErrNotExist
+		}
+		return fmt.Errorf("restore file[%s] fail, err: %s", request.FileName, err.Error())
+	}
+	return nil
+}
+
+// ListIncompleteUploads lists the multipart uploads in the bucket which are never completed or aborted.
+func (s *AliCloudOSS) ListIncompleteUploads(ctx context.Context, request *file.ListIncompleteUploadsRequest) ([]*file.IncompleteUpload, error) {
+	bucket, err := s.getBucket(request.DirectoryName, request.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("list incomplete uploads of bucket[%s] fail, err: %s", request.DirectoryName, err.Error())
+	}
+	uploads := make([]*file.IncompleteUpload, 0)
+	prefix := loss.GetFilePrefixName(request.DirectoryName)
+	keyMarker, uploadIdMarker := "", ""
+	for {
+		result, err := bucket.ListMultipartUploads(oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIdMarker))
+		if err != nil {
+			return nil, fmt.Errorf("list incomplete uploads of bucket[%s] fail, err: %s", request.DirectoryName, err.Error())
+		}
+		for _, v := range result.Uploads {
+			if !request.InitiatedBefore.IsZero() && !v.Initiated.Before(request.InitiatedBefore) {
+				continue
+			}
+			uploads = append(uploads, &file.IncompleteUpload{FileName: bucket.BucketName + "/" + v.Key, UploadId: v.UploadID, Initiated: v.Initiated})
+		}
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+		keyMarker, uploadIdMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// AbortUpload aborts the multipart upload, and the parts uploaded are removed.
+func (s *AliCloudOSS) AbortUpload(ctx context.Context, request *file.AbortUploadRequest) error {
+	bucket, err := s.getBucket(request.Upload.FileName, request.Metadata)
+	if err != nil {
+		return fmt.Errorf("abort upload of file[%s] fail, err: %s", request.Upload.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(request.Upload.FileName)
+	if err != nil {
+		return fmt.Errorf("abort upload of file[%s] fail, err: %s", request.Upload.FileName, err.Error())
+	}
+	imur := oss.InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: key, UploadID: request.Upload.UploadId}
+	if err = bucket.AbortMultipartUpload(imur); err != nil {
+		return fmt.Errorf("abort upload of file[%s] fail, err: %s", request.Upload.FileName, err.Error())
+	}
+	return nil
+}
+
 func (s *AliCloudOSS) checkMetadata(m *OssMetadata) bool {
 	if m.AccessKeySecret == "" || m.Endpoint == "" || m.AccessKeyID == "" {
 		return false
@@ -28,6 +28,7 @@ import (
 	aws_config "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"mosn.io/layotto/components/file"
 	loss "mosn.io/layotto/components/file/s3"
 )
@@ -121,15 +122,19 @@ func (a *AwsOss) Put(ctx context.Context, st *file.PutFileStu) error {
 		return fmt.Errorf("awsoss put file[%s] fail,err: %s", st.FileName, err.Error())
 	}
 	input := &s3.PutObjectInput{
-		Bucket: &bucket,
-		Key:    &key,
-		Body:   st.DataStream,
+		Bucket:   &bucket,
+		Key:      &key,
+		Body:     st.DataStream,
+		Metadata: st.UserMetadata,
+	}
+	if st.StorageClass != "" {
+		input.StorageClass = types.StorageClass(st.StorageClass)
 	}
 	client, err := a.selectClient(st.Metadata)
 	if err != nil {
 		return err
 	}
-	_, err = client.PutObject(context.TODO(), input, nil)
+	_, err = client.PutObject(ctx, input, nil)
 	if err != nil {
 		return err
 	}
@@ -179,23 +184,24 @@ func (a *AwsOss) Get(ctx context.Context, st *file.GetFileStu) (io.ReadCloser, e
 }
 
 // List objects from aws oss.
+// The prefix filter and the marker are pushed down to ListObjectsV2, the other filters are applied by the runtime.
 func (a *AwsOss) List(ctx context.Context, st *file.ListRequest) (*file.ListResp, error) {
 	bucket, err := loss.GetBucketName(st.DirectoryName)
 	if err != nil {
 		return nil, fmt.Errorf("list bucket[%s] fail, err: %s", st.DirectoryName, err.Error())
 	}
-	prefix := loss.GetFilePrefixName(st.DirectoryName)
-	input := &s3.ListObjectsInput{
-		Bucket:  &bucket,
-		MaxKeys: st.PageSize,
-		Marker:  &st.Marker,
-		Prefix:  &prefix,
+	prefix := loss.GetFilePrefixName(st.DirectoryName) + st.Prefix
+	input := &s3.ListObjectsV2Input{
+		Bucket:     &bucket,
+		MaxKeys:    st.PageSize,
+		StartAfter: &st.Marker,
+		Prefix:     &prefix,
 	}
 	client, err := a.selectClient(st.Metadata)
 	if err != nil {
 		return nil, fmt.Errorf("list bucket[%s] fail, err: %s", st.DirectoryName, err.Error())
 	}
-	out, err := client.ListObjects(context.TODO(), input, nil)
+	out, err := client.ListObjectsV2(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("list bucket[%s] fail, err: %s", st.DirectoryName, err.Error())
 	}
@@ -270,5 +276,154 @@ func (a *AwsOss) Stat(ctx context.Context, st *file.FileMetaRequest) (*file.File
 	for k, v := range out.Metadata {
 		resp.Metadata[k] = append(resp.Metadata[k], v)
 	}
+	resp.ETag = loss.TrimETag(*out.ETag)
+	resp.UserMetadata = make(map[string]string, len(out.Metadata))
+	for k, v := range out.Metadata {
+		resp.UserMetadata[strings.ToLower(k)] = v
+	}
+	if out.ContentType != nil {
+		resp.ContentType = *out.ContentType
+	}
+	resp.StorageClass = string(out.StorageClass)
+	if resp.StorageClass == "" {
+		resp.StorageClass = loss.StandardStorageClass
+	}
+	// the tags are fetched by another request, which is skipped if it's not permitted
+	tagging, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{Bucket: &bucket, Key: &key})
+	if err == nil {
+		resp.Tags = make(map[string]string, len(tagging.TagSet))
+		for _, t := range tagging.TagSet {
+			resp.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+	}
 	return resp, nil
 }
+
+// SupportUserMetadata implements file.UserMetadataSupporter, the user metadata is stored as object metadata.
+func (a *AwsOss) SupportUserMetadata() bool {
+	return true
+}
+
+// Tag replaces the tags of the object in aws oss.
+func (a *AwsOss) Tag(ctx context.Context, st *file.TagRequest) error {
+	bucket, err := loss.GetBucketName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	client, err := a.selectClient(st.Metadata)
+	if err != nil {
+		return err
+	}
+	tagSet := make([]types.Tag, 0, len(st.Tags))
+	for k, v := range st.Tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	input := &s3.PutObjectTaggingInput{
+		Bucket:  &bucket,
+		Key:     &key,
+		Tagging: &types.Tagging{TagSet: tagSet},
+	}
+	if _, err = client.PutObjectTagging(ctx, input); err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return file.ErrNotExist
+		}
+		return fmt.Errorf("awsoss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	return nil
+}
+
+// Restore restores a temporary copy of the archived object in aws oss, e.g. the objects in GLACIER or DEEP_ARCHIVE.
+func (a *AwsOss) Restore(ctx context.Context, st *file.RestoreRequest) error {
+	bucket, err := loss.GetBucketName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	client, err := a.selectClient(st.Metadata)
+	if err != nil {
+		return err
+	}
+	req := &types.RestoreRequest{Days: st.Days}
+	if st.Tier != "" {
+		req.GlacierJobParameters = &types.GlacierJobParameters{Tier: types.Tier(st.Tier)}
+	}
+	input := &s3.RestoreObjectInput{
+		Bucket:         &bucket,
+		Key:            &key,
+		RestoreRequest: req,
+	}
+	if _, err = client.RestoreObject(ctx, input); err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return file.ErrNotExist
+		}
+		return fmt.Errorf("awsoss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	return nil
+}
+
+// ListIncompleteUploads lists the multipart uploads in the bucket which are never completed or aborted.
+func (a *AwsOss) ListIncompleteUploads(ctx context.Context, st *file.ListIncompleteUploadsRequest) ([]*file.IncompleteUpload, error) {
+	bucket, err := loss.GetBucketName(st.DirectoryName)
+	if err != nil {
+		return nil, fmt.Errorf("awsoss list incomplete uploads of bucket[%s] fail,err: %s", st.DirectoryName, err.Error())
+	}
+	client, err := a.selectClient(st.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	uploads := make([]*file.IncompleteUpload, 0)
+	prefix := loss.GetFilePrefixName(st.DirectoryName)
+	input := &s3.ListMultipartUploadsInput{Bucket: &bucket, Prefix: &prefix}
+	for {
+		out, err := client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("awsoss list incomplete uploads of bucket[%s] fail,err: %s", st.DirectoryName, err.Error())
+		}
+		for _, v := range out.Uploads {
+			if v.Key == nil || v.UploadId == nil || v.Initiated == nil {
+				continue
+			}
+			if !st.InitiatedBefore.IsZero() && !v.Initiated.Before(st.InitiatedBefore) {
+				continue
+			}
+			uploads = append(uploads, &file.IncompleteUpload{FileName: bucket + "/" + *v.Key, UploadId: *v.UploadId, Initiated: *v.Initiated})
+		}
+		if !out.IsTruncated {
+			return uploads, nil
+		}
+		input.KeyMarker = out.NextKeyMarker
+		input.UploadIdMarker = out.NextUploadIdMarker
+	}
+}
+
+// AbortUpload aborts the multipart upload, and the parts uploaded are removed.
+func (a *AwsOss) AbortUpload(ctx context.Context, st *file.AbortUploadRequest) error {
+	bucket, err := loss.GetBucketName(st.Upload.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss abort upload of file[%s] fail,err: %s", st.Upload.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.Upload.FileName)
+	if err != nil {
+		return fmt.Errorf("awsoss abort upload of file[%s] fail,err: %s", st.Upload.FileName, err.Error())
+	}
+	client, err := a.selectClient(st.Metadata)
+	if err != nil {
+		return err
+	}
+	input := &s3.AbortMultipartUploadInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &st.Upload.UploadId,
+	}
+	if _, err = client.AbortMultipartUpload(ctx, input); err != nil {
+		return fmt.Errorf("awsoss abort upload of file[%s] fail,err: %s", st.Upload.FileName, err.Error())
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"strconv"
 
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
 
 	"github.com/minio/minio-go/v7"
 	"mosn.io/layotto/components/file"
@@ -32,8 +33,9 @@ import (
 )
 
 const (
-	endpointKey = "endpoint"
-	fileSize    = "fileSize"
+	endpointKey        = "endpoint"
+	fileSize           = "fileSize"
+	userMetadataPrefix = "X-Amz-Meta-"
 )
 
 var (
@@ -106,8 +108,17 @@ func (m *MinioOss) Put(ctx context.Context, st *file.PutFileStu) error {
 			return err
 		}
 	}
-	_, err = core.Client.PutObject(ctx, bucket, key, st.DataStream, size, minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream", UserMetadata: st.UserMetadata, StorageClass: st.StorageClass}
+	if st.Progress != nil {
+		opts.Progress = &progressReader{progress: st.Progress}
+	}
+	_, err = core.Client.PutObject(ctx, bucket, key, st.DataStream, size, opts)
 	if err != nil {
+		// abort the multipart upload left behind by a failed or cancelled put,
+		// ctx may already be done when the client disconnected mid-stream
+		if abortErr := core.Client.RemoveIncompleteUpload(context.Background(), bucket, key); abortErr != nil {
+			return fmt.Errorf("minioOss put file[%s] fail,err: %s, abort upload fail,err: %s", st.FileName, err.Error(), abortErr.Error())
+		}
 		return err
 	}
 	return nil
@@ -139,7 +150,8 @@ func (m *MinioOss) List(ctx context.Context, st *file.ListRequest) (*file.ListRe
 	if err != nil {
 		return nil, fmt.Errorf("MinioOss list bucket[%s] fail, err: %s", st.DirectoryName, err.Error())
 	}
-	prefix := loss.GetFilePrefixName(st.DirectoryName)
+	// the prefix filter is pushed down, the other filters are applied by the runtime
+	prefix := loss.GetFilePrefixName(st.DirectoryName) + st.Prefix
 
 	core, err := m.selectClient(st.Metadata)
 	if err != nil {
@@ -209,9 +221,142 @@ func (m *MinioOss) Stat(ctx context.Context, st *file.FileMetaRequest) (*file.Fi
 	for k, v := range info.Metadata {
 		resp.Metadata[k] = v
 	}
+	resp.ETag = loss.TrimETag(info.ETag)
+	resp.UserMetadata = loss.UserMetadata(info.Metadata, userMetadataPrefix)
+	resp.ContentType = info.ContentType
+	resp.StorageClass = info.StorageClass
+	if resp.StorageClass == "" {
+		resp.StorageClass = loss.StandardStorageClass
+	}
+	// the tags are fetched by another request, which is skipped if it's not permitted
+	if t, err := core.Client.GetObjectTagging(ctx, bucket, key, minio.GetObjectTaggingOptions{}); err == nil {
+		resp.Tags = t.ToMap()
+	}
 	return resp, nil
 }
 
+// SupportUserMetadata implements file.UserMetadataSupporter, the user metadata is stored as object metadata.
+func (m *MinioOss) SupportUserMetadata() bool {
+	return true
+}
+
+// SupportProgress implements file.ProgressSupporter, the progress is reported while the parts are sent.
+func (m *MinioOss) SupportProgress() bool {
+	return true
+}
+
+// progressReader is the progress hook of minio, which reads the bytes uploaded
+type progressReader struct {
+	uploaded int64
+	progress func(uploaded int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	r.uploaded += int64(len(p))
+	r.progress(r.uploaded)
+	return len(p), nil
+}
+
+func (m *MinioOss) Tag(ctx context.Context, st *file.TagRequest) error {
+	bucket, err := loss.GetBucketName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	core, err := m.selectClient(st.Metadata)
+	if err != nil {
+		return fmt.Errorf("minioOss tag file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	if len(st.Tags) == 0 {
+		err = core.Client.RemoveObjectTagging(ctx, bucket, key, minio.RemoveObjectTaggingOptions{})
+	} else {
+		var t *tags.Tags
+		if t, err = tags.NewTags(st.Tags, true); err != nil {
+			return fmt.Errorf("minioOss tag file[%s] fail,err: %s", st.FileName, err.Error())
+		}
+		err = core.Client.PutObjectTagging(ctx, bucket, key, t, minio.PutObjectTaggingOptions{})
+	}
+	if err != nil {
+		if resp, ok := err.(minio.ErrorResponse); ok && resp.StatusCode == 404 {
+			return file.ErrNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// Restore restores a temporary copy of the archived object.
+func (m *MinioOss) Restore(ctx context.Context, st *file.RestoreRequest) error {
+	bucket, err := loss.GetBucketName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	core, err := m.selectClient(st.Metadata)
+	if err != nil {
+		return fmt.Errorf("minioOss restore file[%s] fail,err: %s", st.FileName, err.Error())
+	}
+	req := minio.RestoreRequest{}
+	req.SetDays(int(st.Days))
+	if st.Tier != "" {
+		req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierType(st.Tier)})
+	}
+	if err = core.Client.RestoreObject(ctx, bucket, key, "", req); err != nil {
+		if resp, ok := err.(minio.ErrorResponse); ok && resp.StatusCode == 404 {
+			return file.ErrNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// ListIncompleteUploads lists the multipart uploads in the bucket which are never completed or aborted.
+func (m *MinioOss) ListIncompleteUploads(ctx context.Context, st *file.ListIncompleteUploadsRequest) ([]*file.IncompleteUpload, error) {
+	bucket, err := loss.GetBucketName(st.DirectoryName)
+	if err != nil {
+		return nil, fmt.Errorf("minioOss list incomplete uploads of bucket[%s] fail,err: %s", st.DirectoryName, err.Error())
+	}
+	core, err := m.selectClient(st.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	uploads := make([]*file.IncompleteUpload, 0)
+	prefix := loss.GetFilePrefixName(st.DirectoryName)
+	for info := range core.Client.ListIncompleteUploads(ctx, bucket, prefix, true) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("minioOss list incomplete uploads of bucket[%s] fail,err: %s", st.DirectoryName, info.Err.Error())
+		}
+		if !st.InitiatedBefore.IsZero() && !info.Initiated.Before(st.InitiatedBefore) {
+			continue
+		}
+		uploads = append(uploads, &file.IncompleteUpload{FileName: bucket + "/" + info.Key, UploadId: info.UploadID, Initiated: info.Initiated})
+	}
+	return uploads, nil
+}
+
+// AbortUpload aborts the multipart upload, and the parts uploaded are removed.
+func (m *MinioOss) AbortUpload(ctx context.Context, st *file.AbortUploadRequest) error {
+	bucket, err := loss.GetBucketName(st.Upload.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss abort upload of file[%s] fail,err: %s", st.Upload.FileName, err.Error())
+	}
+	key, err := loss.GetFileName(st.Upload.FileName)
+	if err != nil {
+		return fmt.Errorf("minioOss abort upload of file[%s] fail,err: %s", st.Upload.FileName, err.Error())
+	}
+	core, err := m.selectClient(st.Metadata)
+	if err != nil {
+		return err
+	}
+	return core.AbortMultipartUpload(ctx, bucket, key, st.Upload.UploadId)
+}
+
 func (m *MinioOss) createOssClient(meta *MinioMetaData) (*minio.Core, error) {
 	client, err := minio.New(
 		meta.EndPoint,
@@ -111,6 +111,24 @@ func TestMinioOss_Put(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestMinioOss_IncompleteUploads(t *testing.T) {
+	oss := NewMinioOss()
+	err := oss.Init(context.TODO(), &file.FileConfig{Metadata: json.RawMessage(cfg)})
+	assert.Nil(t, err)
+	cleaner, ok := oss.(file.UploadCleaner)
+	assert.True(t, ok)
+
+	_, err = cleaner.ListIncompleteUploads(context.TODO(), &file.ListIncompleteUploadsRequest{DirectoryName: "bucket"})
+	assert.NotNil(t, err)
+	_, err = cleaner.ListIncompleteUploads(context.TODO(), &file.ListIncompleteUploadsRequest{DirectoryName: "bucket/", Metadata: map[string]string{"endpoint": "demo-endpoint"}})
+	assert.Equal(t, ErrClientNotExist, err)
+
+	err = cleaner.AbortUpload(context.TODO(), &file.AbortUploadRequest{Upload: &file.IncompleteUpload{FileName: "bucket/"}})
+	assert.NotNil(t, err)
+	err = cleaner.AbortUpload(context.TODO(), &file.AbortUploadRequest{Upload: &file.IncompleteUpload{FileName: "bucket/file", UploadId: "id"}, Metadata: map[string]string{"endpoint": "demo-endpoint"}})
+	assert.Equal(t, ErrClientNotExist, err)
+}
+
 func TestMinioOss_Get(t *testing.T) {
 	oss := NewMinioOss()
 
@@ -23,8 +23,15 @@ import (
 
 const (
 	ETag = "ETag"
+	// StandardStorageClass is the storage class of the objects whose storage class isn't returned
+	StandardStorageClass = "STANDARD"
 )
 
+// TrimETag removes the quotes around the etag returned by the object storages
+func TrimETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
 func GetBucketName(fileName string) (string, error) {
 	index := strings.Index(fileName, "/")
 	if index == -1 || index == 0 {
@@ -52,3 +59,16 @@ func GetFileName(fileName string) (string, error) {
 	}
 	return name, nil
 }
+
+// UserMetadata returns the user metadata in the headers, the prefix is removed and the keys are converted to lower case
+func UserMetadata(headers map[string][]string, prefix string) map[string]string {
+	res := make(map[string]string)
+	prefix = strings.ToLower(prefix)
+	for k, v := range headers {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, prefix) && len(v) > 0 {
+			res[k[len(prefix):]] = v[0]
+		}
+	}
+	return res
+}
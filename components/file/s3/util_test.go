@@ -45,3 +45,16 @@ func TestGetFileName(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "aaa", name)
 }
+
+func TestTrimETag(t *testing.T) {
+	assert.Equal(t, "abc", TrimETag("\"abc\""))
+	assert.Equal(t, "abc", TrimETag("abc"))
+}
+
+func TestUserMetadata(t *testing.T) {
+	headers := map[string][]string{
+		"X-Oss-Meta-Layotto-Key": {"v"},
+		"Content-Type":           {"text/plain"},
+	}
+	assert.Equal(t, map[string]string{"layotto-key": "v"}, UserMetadata(headers, "X-Oss-Meta-"))
+}
@@ -19,6 +19,7 @@ package file
 import (
 	"encoding/json"
 	"io"
+	"time"
 )
 
 // FileConfig wraps configuration for a file implementation
@@ -30,6 +31,14 @@ type PutFileStu struct {
 	DataStream io.Reader
 	FileName   string
 	Metadata   map[string]string
+	// UserMetadata is stored with the file by the components implementing UserMetadataSupporter,
+	// and it's returned by FileMetaResp.UserMetadata
+	UserMetadata map[string]string
+	// StorageClass of the file, e.g. STANDARD or GLACIER of aws s3. The default storage class of the component is used if it's empty
+	StorageClass string
+	// Progress is called with the bytes uploaded so far by the components implementing ProgressSupporter, it may be nil.
+	// It may be called from the goroutines of the component until Put returns.
+	Progress func(uploaded int64)
 }
 
 type GetFileStu struct {
@@ -47,6 +56,15 @@ type ListRequest struct {
 	Marker        string
 	PageSize      int32
 	Metadata      map[string]string
+	// The filters and the sort options below can be pushed down by the components,
+	// and they are applied by the runtime as well, see FilterFiles
+	Prefix         string
+	Suffix         string
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	MetadataFilter map[string]string
+	SortBy         string
+	Descending     bool
 }
 
 type FilesInfo struct {
@@ -70,5 +88,57 @@ type FileMetaRequest struct {
 type FileMetaResp struct {
 	Size         int64
 	LastModified string
+	// ETag, ContentType and StorageClass are left empty if the component doesn't support them
+	ETag         string
+	ContentType  string
+	StorageClass string
+	// Tags are the user defined tags of the file
+	Tags map[string]string
+	// UserMetadata is the metadata stored by PutFileStu.UserMetadata, whose keys are in lower case
+	UserMetadata map[string]string
 	Metadata     map[string][]string
 }
+
+type TagRequest struct {
+	FileName string
+	// Tags replace the existing tags of the file
+	Tags     map[string]string
+	Metadata map[string]string
+}
+
+// The tiers of restoring the archived files, which trade off the time against the cost
+const (
+	TierExpedited = "Expedited"
+	TierStandard  = "Standard"
+	TierBulk      = "Bulk"
+)
+
+type RestoreRequest struct {
+	FileName string
+	// Days is how long the restored copy is kept, after which it's archived again
+	Days int32
+	// Tier is one of TierExpedited, TierStandard and TierBulk, the default tier of the component is used if it's empty
+	Tier     string
+	Metadata map[string]string
+}
+
+type ListIncompleteUploadsRequest struct {
+	// DirectoryName is the bucket and the prefix of the keys, e.g. "bucket/" or "bucket/tmp/"
+	DirectoryName string
+	// InitiatedBefore filters the uploads initiated before it, the zero time means all of them
+	InitiatedBefore time.Time
+	Metadata        map[string]string
+}
+
+// IncompleteUpload is an upload which is never completed, e.g. a multipart upload left behind by an aborted put
+type IncompleteUpload struct {
+	// FileName is the bucket and the key, which is the same as the one put
+	FileName  string
+	UploadId  string
+	Initiated time.Time
+}
+
+type AbortUploadRequest struct {
+	Upload   *IncompleteUpload
+	Metadata map[string]string
+}
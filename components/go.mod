@@ -33,6 +33,7 @@ require (
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
 	golang.org/x/oauth2 v0.0.0-20201208152858-08078c50e5b5 // indirect
 	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
 	mosn.io/api v0.0.0-20211217011300-b851d129be01
 	mosn.io/mosn v0.25.1-0.20211217125944-69b50c40af81
 	mosn.io/pkg v0.0.0-20211217101631-d914102d1baf
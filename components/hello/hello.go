@@ -27,10 +27,24 @@ type HelloService interface {
 
 type HelloConfig struct {
 	HelloString string `json:"hello"`
+	// Templates are the response templates by the locales, e.g. "zh-CN" or "zh", and "*" is the template of the other locales.
+	// They're text/template executed with the HelloRequest, e.g. "{{.Name}}, hello".
+	Templates map[string]string `json:"templates"`
+	// FaultInjection allows the requests to inject delays and errors by their metadata, which is disabled by default.
+	// It's only for testing the clients, and shouldn't be enabled in production.
+	FaultInjection bool `json:"fault_injection"`
+}
+
+// FaultInjectable is implemented by the hello services which may allow the requests to inject delays and errors
+type FaultInjectable interface {
+	FaultInjectionEnabled() bool
 }
 
 type HelloRequest struct {
 	Name string `json:"name"`
+	// Locale selects the response template, e.g. "zh-CN"
+	Locale   string            `json:"locale"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 type HelloReponse struct {
@@ -17,18 +17,29 @@
 package helloworld
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"text/template"
 
 	"mosn.io/layotto/components/hello"
 	"mosn.io/layotto/components/trace"
 )
 
+// defaultLocale is the locale of the template used if the locale of the request has no template
+const defaultLocale = "*"
+
 type HelloWorld struct {
 	Say string
+	// templates are keyed by the normalized locales
+	templates map[string]*template.Template
+	// faultInjection allows the requests to inject delays and errors by the metadata
+	faultInjection bool
 }
 
 var _ hello.HelloService = &HelloWorld{}
+var _ hello.FaultInjectable = &HelloWorld{}
 
 func NewHelloWorld() hello.HelloService {
 	return &HelloWorld{}
@@ -36,12 +47,55 @@ func NewHelloWorld() hello.HelloService {
 
 func (hw *HelloWorld) Init(config *hello.HelloConfig) error {
 	hw.Say = config.HelloString
+	hw.faultInjection = config.FaultInjection
+	hw.templates = make(map[string]*template.Template, len(config.Templates))
+	for locale, text := range config.Templates {
+		t, err := template.New(locale).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("template of locale %s is invalid: %v", locale, err)
+		}
+		hw.templates[normalizeLocale(locale)] = t
+	}
 	return nil
 }
 
 func (hw *HelloWorld) Hello(ctx context.Context, req *hello.HelloRequest) (*hello.HelloReponse, error) {
 	trace.SetExtraComponentInfo(ctx, fmt.Sprintf("method: %+v", "hello"))
-	return &hello.HelloReponse{
-		HelloString: hw.Say + ", " + req.Name,
-	}, nil
+	t := hw.template(req.Locale)
+	if t == nil {
+		return &hello.HelloReponse{
+			HelloString: hw.Say + ", " + req.Name,
+		}, nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, req); err != nil {
+		return nil, fmt.Errorf("execute template of locale %s error: %v", t.Name(), err)
+	}
+	return &hello.HelloReponse{HelloString: buf.String()}, nil
+}
+
+// FaultInjectionEnabled reports whether the fault_injection config is enabled
+func (hw *HelloWorld) FaultInjectionEnabled() bool {
+	return hw.faultInjection
+}
+
+// template returns the template of the locale, e.g. "zh-CN" falls back to "zh" and then "*"
+func (hw *HelloWorld) template(locale string) *template.Template {
+	locale = normalizeLocale(locale)
+	for locale != "" {
+		if t, ok := hw.templates[locale]; ok {
+			return t
+		}
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return hw.templates[defaultLocale]
+}
+
+// normalizeLocale converts the locale to lower case with "-" as the separator, e.g. "zh_CN" to "zh-cn"
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
 }
@@ -37,4 +37,47 @@ func TestHelloWorld(t *testing.T) {
 	if resp.HelloString != "Hi, Layotto" {
 		t.Fatalf("hello output failed")
 	}
+	if hs.(hello.FaultInjectable).FaultInjectionEnabled() {
+		t.Fatalf("fault injection is enabled by default")
+	}
+	hs.Init(&hello.HelloConfig{HelloString: "Hi", FaultInjection: true})
+	if !hs.(hello.FaultInjectable).FaultInjectionEnabled() {
+		t.Fatalf("fault injection isn't enabled")
+	}
+}
+
+func TestHelloWorld_Templates(t *testing.T) {
+	hs := NewHelloWorld()
+	err := hs.Init(&hello.HelloConfig{
+		HelloString: "Hi",
+		Templates: map[string]string{
+			"*":     "Hello, {{.Name}}",
+			"zh":    "你好, {{.Name}}",
+			"zh_TW": "您好, {{.Name}}",
+			"ja":    "{{.Name}}さん, {{.Metadata.greeting}}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	cases := map[string]string{
+		"":      "Hello, Layotto",
+		"en-US": "Hello, Layotto",
+		"zh-CN": "你好, Layotto",
+		"zh-tw": "您好, Layotto",
+		"ja":    "Layottoさん, こんにちは",
+	}
+	for locale, expected := range cases {
+		resp, err := hs.Hello(context.Background(), &hello.HelloRequest{Name: "Layotto", Locale: locale, Metadata: map[string]string{"greeting": "こんにちは"}})
+		if err != nil {
+			t.Fatalf("hello of locale %s failed: %v", locale, err)
+		}
+		if resp.HelloString != expected {
+			t.Fatalf("hello of locale %s is %s, expected %s", locale, resp.HelloString, expected)
+		}
+	}
+
+	if err := hs.Init(&hello.HelloConfig{Templates: map[string]string{"*": "{{.Name"}}); err == nil {
+		t.Fatalf("invalid template is accepted")
+	}
 }
@@ -18,14 +18,17 @@ import (
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/components/pkg/schema"
 	"mosn.io/layotto/components/pkg/utils"
 	"mosn.io/pkg/log"
 	"time"
 )
 
-// Standalone Redis lock store.Any fail-over related features are not supported,such as Sentinel and Redis Cluster.
+// Standalone Redis lock store.
+// The lock is kept on a single redis deployment, which can be a standalone node, a sentinel-backed master or a redis cluster.
+// Note that the lock might be lost if the master fails over before the key is replicated.
 type StandaloneRedisLock struct {
-	client   *redis.Client
+	client   redis.UniversalClient
 	metadata utils.RedisMetadata
 
 	features []lock.Feature
@@ -54,10 +57,13 @@ func (p *StandaloneRedisLock) Init(metadata lock.Metadata) error {
 	}
 	p.metadata = m
 	// 2. construct client
-	p.client = utils.NewRedisClient(m)
+	p.client = utils.AcquireRedisClient(m)
 	p.ctx, p.cancel = context.WithCancel(context.Background())
 	// 3. connect to redis
 	if _, err = p.client.Ping(p.ctx).Result(); err != nil {
+		// release the shared client, since the component won't be closed if Init fails
+		p.cancel()
+		p.client.Close()
 		return fmt.Errorf("[standaloneRedisLock]: error connecting to redis at %s: %s", m.Host, err)
 	}
 	return err
@@ -127,6 +133,11 @@ func newInternalErrorUnlockResponse() *lock.UnlockResponse {
 	}
 }
 
+// MetadataSchema declares the metadata fields of StandaloneRedisLock
+func (p *StandaloneRedisLock) MetadataSchema() *schema.Schema {
+	return utils.RedisMetadataSchema
+}
+
 // Close shuts down the client's redis connections.
 func (p *StandaloneRedisLock) Close() error {
 	if p.cancel != nil {
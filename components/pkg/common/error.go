@@ -25,6 +25,7 @@ const (
 	UnavailebleCode
 	InternalCode
 	InvalidArgsCode
+	PermissionDeniedCode
 )
 
 type CommonError interface {
@@ -71,6 +72,8 @@ func ToGrpcError(err error) error {
 			code = codes.Internal
 		case InvalidArgsCode:
 			code = codes.InvalidArgument
+		case PermissionDeniedCode:
+			code = codes.PermissionDenied
 		default:
 			code = codes.Unknown
 		}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package egress
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subtreeSuffix at the end of a path pattern matches all the paths under the prefix
+const subtreeSuffix = "/**"
+
+// encodedSeparators are the percent-encoded dots, slashes and backslashes, which servers differ in decoding,
+// e.g. "/v1/%2e%2e/admin" reaches "/admin" on most servers, so the paths with them are denied
+var encodedSeparators = []string{"%2e", "%2f", "%5c"}
+
+// Config is the egress policy of the outbound HTTP requests, i.e. the requests of HTTP bindings and the http channels of InvokeService
+type Config struct {
+	// Allow is the allowlist of the requests, all the requests are allowed if it's empty
+	Allow []*Rule `json:"allow"`
+	// Proxy is the URL of the proxy sending the requests, e.g. "http://proxy.example.com:3128"
+	Proxy string `json:"proxy"`
+	// NoProxy are the patterns of the hosts sent to directly instead of through the proxy
+	NoProxy []string `json:"no_proxy"`
+	// CABundles are the PEM files of the CAs trusted besides the ones of the system
+	CABundles []string `json:"ca_bundles"`
+}
+
+// Rule allows the requests to the hosts, ports and paths.
+// The patterns are in the syntax of path.Match, e.g. "*.example.com", and a path pattern ending with "/**" matches the paths under it.
+type Rule struct {
+	// Host is the pattern of the hosts
+	Host string `json:"host"`
+	// Ports are the ports allowed, any port is allowed if it's empty
+	Ports []int `json:"ports"`
+	// Paths are the patterns of the paths allowed, any path is allowed if it's empty
+	Paths []string `json:"paths"`
+}
+
+// DeniedError is returned if a request isn't allowed by the policy
+type DeniedError struct {
+	Host string
+	Port int
+	Path string
+}
+
+func (e *DeniedError) Error() string {
+	host := e.Host
+	if e.Port > 0 {
+		host = net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	}
+	return fmt.Sprintf("egress to %s%s is not allowed by the policy", host, e.Path)
+}
+
+// Policy enforces the allowlist and sends the requests through the proxy with the CAs configured
+type Policy struct {
+	rules   []*Rule
+	proxy   *url.URL
+	noProxy []string
+	rootCAs *x509.CertPool
+}
+
+// NewPolicy validates the config and loads the CA bundles
+func NewPolicy(config *Config) (*Policy, error) {
+	p := &Policy{rules: config.Allow, noProxy: config.NoProxy}
+	for i, r := range config.Allow {
+		if r.Host == "" {
+			return nil, fmt.Errorf("host of egress rule %d is required", i)
+		}
+		for _, pattern := range append([]string{r.Host}, r.Paths...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern of egress rule %d: %s", i, pattern)
+			}
+		}
+		for _, port := range r.Ports {
+			if port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid port of egress rule %d: %d", i, port)
+			}
+		}
+	}
+	for _, pattern := range config.NoProxy {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid no_proxy pattern of egress: %s", pattern)
+		}
+	}
+	if config.Proxy != "" {
+		u, err := url.Parse(config.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid egress proxy: %s", config.Proxy)
+		}
+		p.proxy = u
+	}
+	if len(config.CABundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range config.CABundles {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("read egress CA bundle %s failed: %v", file, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate is found in egress CA bundle %s", file)
+			}
+		}
+		p.rootCAs = pool
+	}
+	return p, nil
+}
+
+// Allow checks the request to the host, port and escaped path, the port is 0 if it's unknown and only the rules without ports match it.
+// It returns DeniedError if no rule allows the request, or the path has encoded dots or slashes.
+func (p *Policy) Allow(host string, port int, escapedPath string) error {
+	if len(p.rules) == 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+	lower := strings.ToLower(escapedPath)
+	for _, s := range encodedSeparators {
+		if strings.Contains(lower, s) {
+			return &DeniedError{Host: host, Port: port, Path: escapedPath}
+		}
+	}
+	urlPath, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return &DeniedError{Host: host, Port: port, Path: escapedPath}
+	}
+	// decoded before cleaned like the servers, e.g. "/api/../admin" is checked as "/admin"
+	urlPath = path.Clean("/" + urlPath)
+	for _, r := range p.rules {
+		if r.allows(host, port, urlPath) {
+			return nil
+		}
+	}
+	return &DeniedError{Host: host, Port: port, Path: urlPath}
+}
+
+// AllowURL checks the request to the URL, of which the port is the default one of the scheme if it's omitted.
+// The port of the other schemes is unknown if it's omitted.
+func (p *Policy) AllowURL(u *url.URL) error {
+	port := 0
+	if s := u.Port(); s != "" {
+		port, _ = strconv.Atoi(s)
+	} else {
+		switch u.Scheme {
+		case "http":
+			port = 80
+		case "https":
+			port = 443
+		}
+	}
+	return p.Allow(u.Hostname(), port, u.EscapedPath())
+}
+
+func (r *Rule) allows(host string, port int, urlPath string) bool {
+	if ok, _ := path.Match(strings.ToLower(r.Host), host); !ok {
+		return false
+	}
+	if len(r.Ports) > 0 {
+		// the rules restricting the ports don't allow the unknown port
+		found := false
+		for _, p := range r.Ports {
+			if p == port {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range r.Paths {
+		if matchPath(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern string, urlPath string) bool {
+	if strings.HasSuffix(pattern, subtreeSuffix) {
+		// match the prefix with the same number of segments of the path
+		prefix := strings.TrimSuffix(pattern, subtreeSuffix)
+		n := strings.Count(prefix, "/")
+		segments := strings.Split(urlPath, "/")
+		if len(segments) <= n {
+			return false
+		}
+		ok, _ := path.Match(prefix, strings.Join(segments[:n+1], "/"))
+		return ok
+	}
+	ok, _ := path.Match(pattern, urlPath)
+	return ok
+}
+
+// Transport returns the transport sending the requests allowed through the proxy, and trusting the CA bundles
+func (p *Policy) Transport() http.RoundTripper {
+	return p.WrapTransport(&http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	})
+}
+
+// WrapTransport returns the transport checking the requests before sending them by next, e.g. the one of a client created by others.
+// If next is an http.Transport, it's cloned to send the requests through the proxy and trust the CA bundles.
+func (p *Policy) WrapTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if t, ok := next.(*http.Transport); ok {
+		t = t.Clone()
+		t.Proxy = p.proxyOf
+		if p.rootCAs != nil {
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			t.TLSClientConfig.RootCAs = p.rootCAs
+		}
+		next = t
+	}
+	return &transport{policy: p, next: next}
+}
+
+func (p *Policy) proxyOf(req *http.Request) (*url.URL, error) {
+	if p.proxy == nil {
+		return nil, nil
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	for _, pattern := range p.noProxy {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return nil, nil
+		}
+	}
+	return p.proxy, nil
+}
+
+// transport checks every request, including the ones of redirects
+type transport struct {
+	policy *Policy
+	next   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.AllowURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package egress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPolicy(t *testing.T) {
+	for _, c := range []*Config{
+		{Allow: []*Rule{{}}},
+		{Allow: []*Rule{{Host: "["}}},
+		{Allow: []*Rule{{Host: "example.com", Ports: []int{0}}}},
+		{NoProxy: []string{"["}},
+		{Proxy: "proxy:3128"},
+		{CABundles: []string{"not-exist.pem"}},
+	} {
+		_, err := NewPolicy(c)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestPolicyAllow(t *testing.T) {
+	p, err := NewPolicy(&Config{Allow: []*Rule{
+		{Host: "*.example.com", Ports: []int{443}},
+		{Host: "api.partner.com", Paths: []string{"/v1/**", "/health"}},
+	}})
+	assert.Nil(t, err)
+	allowed := []string{
+		"https://a.example.com/anything",
+		"https://A.Example.com:443",
+		"http://api.partner.com/v1",
+		"http://api.partner.com/v1/orders/1",
+		"http://api.partner.com:8080/health",
+	}
+	for _, s := range allowed {
+		u, _ := url.Parse(s)
+		assert.Nil(t, p.AllowURL(u), s)
+	}
+	denied := []string{
+		"http://a.example.com/anything",
+		"https://example.com",
+		"http://api.partner.com/v2",
+		"http://api.partner.com/v1/../admin",
+		"http://api.partner.com/v10",
+		// the encoded dots and slashes are decoded by most servers
+		"http://api.partner.com/v1/%2e%2e/admin",
+		"http://api.partner.com/v1/%2E%2E/admin",
+		"http://api.partner.com/v1/..%2fadmin",
+		"http://api.partner.com/v1/%5c..%5cadmin",
+	}
+	for _, s := range denied {
+		u, _ := url.Parse(s)
+		err := p.AllowURL(u)
+		assert.IsType(t, &DeniedError{}, err, s)
+	}
+	// the port is unknown
+	assert.IsType(t, &DeniedError{}, p.Allow("a.example.com", 0, "/"))
+	u, _ := url.Parse("ftp://a.example.com/anything")
+	assert.IsType(t, &DeniedError{}, p.AllowURL(u))
+	assert.Nil(t, p.Allow("api.partner.com", 0, "/health"))
+	// the paths are decoded before they're checked
+	assert.Nil(t, p.Allow("api.partner.com", 0, "/v1/%6frders"))
+	assert.IsType(t, &DeniedError{}, p.Allow("api.partner.com", 0, "/v1/%zz"))
+
+	// all the requests are allowed without rules
+	p, err = NewPolicy(&Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Allow("any.com", 80, "/"))
+}
+
+func TestPolicyTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/denied", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	p, err := NewPolicy(&Config{Allow: []*Rule{{Host: u.Hostname(), Paths: []string{"/allowed", "/redirect"}}}})
+	assert.Nil(t, err)
+	client := &http.Client{Transport: p.Transport()}
+
+	resp, err := client.Get(server.URL + "/allowed")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = client.Get(server.URL + "/denied")
+	assert.NotNil(t, err)
+	// the redirects are checked too
+	_, err = client.Get(server.URL + "/redirect")
+	assert.NotNil(t, err)
+
+	// the transports of the other clients are wrapped
+	client = &http.Client{Transport: p.WrapTransport(&http.Transport{})}
+	resp, err = client.Get(server.URL + "/allowed")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	_, err = client.Get(server.URL + "/denied")
+	assert.NotNil(t, err)
+}
+
+func TestPolicyProxy(t *testing.T) {
+	p, err := NewPolicy(&Config{Proxy: "http://proxy.example.com:3128", NoProxy: []string{"*.internal"}})
+	assert.Nil(t, err)
+	req, _ := http.NewRequest(http.MethodGet, "https://api.partner.com", nil)
+	proxy, err := p.proxyOf(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "proxy.example.com:3128", proxy.Host)
+	req, _ = http.NewRequest(http.MethodGet, "http://svc.internal", nil)
+	proxy, err = p.proxyOf(req)
+	assert.Nil(t, err)
+	assert.Nil(t, proxy)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type of a metadata field
+type FieldType string
+
+const (
+	TypeString   FieldType = "string"
+	TypeInt      FieldType = "int"
+	TypeBool     FieldType = "bool"
+	TypeDuration FieldType = "duration"
+
+	secretMask = "******"
+)
+
+// Field declares a metadata field of a component.
+type Field struct {
+	Name     string
+	Type     FieldType
+	Required bool
+	// Default is the value used by the component when the field is absent. It's only for documentation.
+	Default string
+	// Secret fields are masked when the metadata is printed.
+	Secret bool
+	// Options are the legal values. Empty means any value is ok.
+	Options     []string
+	Description string
+}
+
+// Schema declares the metadata fields of a component.
+type Schema struct {
+	Fields []Field
+}
+
+// Provider is implemented by the components which declare their metadata schema.
+// The runtime validates the metadata before initializing these components.
+type Provider interface {
+	MetadataSchema() *Schema
+}
+
+// Validate checks the properties and returns an error describing all the illegal fields.
+// Unknown fields are ignored because components may pass them through to the backend.
+func (s *Schema) Validate(properties map[string]string) error {
+	var problems []string
+	for _, f := range s.Fields {
+		val, ok := properties[f.Name]
+		if !ok || val == "" {
+			if f.Required {
+				problems = append(problems, fmt.Sprintf("missing required field %s", f.Name))
+			}
+			continue
+		}
+		if err := f.check(val); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("illegal metadata: %s", strings.Join(problems, "; "))
+}
+
+// Mask returns a copy of the properties in which the secret fields are masked.
+func (s *Schema) Mask(properties map[string]string) map[string]string {
+	masked := make(map[string]string, len(properties))
+	for k, v := range properties {
+		masked[k] = v
+	}
+	for _, f := range s.Fields {
+		if _, ok := masked[f.Name]; ok && f.Secret {
+			masked[f.Name] = secretMask
+		}
+	}
+	return masked
+}
+
+func (f *Field) check(val string) error {
+	switch f.Type {
+	case TypeInt:
+		if _, err := strconv.Atoi(val); err != nil {
+			return fmt.Errorf("field %s should be an integer but got %q", f.Name, val)
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(val); err != nil {
+			return fmt.Errorf("field %s should be a bool but got %q", f.Name, val)
+		}
+	case TypeDuration:
+		// both "2s" and nanoseconds are accepted
+		if _, err := time.ParseDuration(val); err != nil {
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				return fmt.Errorf("field %s should be a duration but got %q", f.Name, val)
+			}
+		}
+	}
+	if len(f.Options) == 0 {
+		return nil
+	}
+	for _, o := range f.Options {
+		if o == val {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s should be one of [%s] but got %q", f.Name, strings.Join(f.Options, ", "), val)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = &Schema{
+	Fields: []Field{
+		{Name: "host", Type: TypeString, Required: true, Description: "server address"},
+		{Name: "password", Type: TypeString, Secret: true, Description: "password"},
+		{Name: "db", Type: TypeInt, Default: "0"},
+		{Name: "enableTLS", Type: TypeBool, Default: "false"},
+		{Name: "timeout", Type: TypeDuration, Default: "2s"},
+		{Name: "mode", Type: TypeString, Options: []string{"node", "cluster"}},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		err := testSchema.Validate(map[string]string{
+			"host":      "localhost:6379",
+			"db":        "1",
+			"enableTLS": "true",
+			"timeout":   "3s",
+			"mode":      "cluster",
+			"unknown":   "whatever",
+		})
+		assert.Nil(t, err)
+	})
+
+	t.Run("duration in nanoseconds", func(t *testing.T) {
+		err := testSchema.Validate(map[string]string{"host": "localhost:6379", "timeout": "2000000000"})
+		assert.Nil(t, err)
+	})
+
+	t.Run("all problems are reported", func(t *testing.T) {
+		err := testSchema.Validate(map[string]string{
+			"db":        "abc",
+			"enableTLS": "yes",
+			"timeout":   "1x",
+			"mode":      "sentinel",
+		})
+		assert.NotNil(t, err)
+		msg := err.Error()
+		assert.True(t, strings.HasPrefix(msg, "illegal metadata: "))
+		assert.Contains(t, msg, "missing required field host")
+		assert.Contains(t, msg, "field db should be an integer")
+		assert.Contains(t, msg, "field enableTLS should be a bool")
+		assert.Contains(t, msg, "field timeout should be a duration")
+		assert.Contains(t, msg, "field mode should be one of [node, cluster]")
+	})
+}
+
+func TestMask(t *testing.T) {
+	props := map[string]string{"host": "localhost:6379", "password": "123"}
+	masked := testSchema.Mask(props)
+	assert.Equal(t, "******", masked["password"])
+	assert.Equal(t, "localhost:6379", masked["host"])
+	// the original properties are not modified
+	assert.Equal(t, "123", props["password"])
+}
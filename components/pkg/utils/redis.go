@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
+	"mosn.io/layotto/components/pkg/schema"
 	"runtime"
 	"strconv"
 	"strings"
@@ -30,40 +31,117 @@ const (
 	hosts                  = "redisHosts"
 	password               = "redisPassword"
 	enableTLS              = "enableTLS"
+	tlsSkipVerify          = "tlsSkipVerify"
 	maxRetries             = "maxRetries"
 	concurrency            = "concurrency"
 	maxRetryBackoff        = "maxRetryBackoff"
+	username               = "redisUsername"
+	redisType              = "redisType"
+	failover               = "failover"
+	sentinelMasterName     = "sentinelMasterName"
+	poolSize               = "poolSize"
+	minIdleConns           = "minIdleConns"
 	defaultBase            = 10
 	defaultBitSize         = 0
 	defaultDB              = 0
 	defaultMaxRetries      = 3
 	defaultMaxRetryBackoff = time.Second * 2
 	defaultEnableTLS       = false
+	defaultTLSSkipVerify   = false
+
+	// RedisTypeNode means a standalone redis node
+	RedisTypeNode = "node"
+	// RedisTypeCluster means a redis cluster
+	RedisTypeCluster = "cluster"
 )
 
 func NewRedisClient(m RedisMetadata) *redis.Client {
 	opts := &redis.Options{
 		Addr:            m.Host,
+		Username:        m.Username,
 		Password:        m.Password,
 		DB:              m.DB,
 		MaxRetries:      m.MaxRetries,
 		MaxRetryBackoff: m.MaxRetryBackoff,
-	}
-	if m.EnableTLS {
-		opts.TLSConfig = &tls.Config{
-			InsecureSkipVerify: m.EnableTLS,
-		}
+		TLSConfig:       newTLSConfig(m.EnableTLS, m.TLSSkipVerify),
+		PoolSize:        m.PoolSize,
+		MinIdleConns:    m.MinIdleConns,
 	}
 	return redis.NewClient(opts)
 }
 
+// NewRedisUniversalClient returns a client according to the deployment of redis:
+// a sentinel-backed failover client if failover is enabled,
+// a cluster client if redisType is cluster,
+// otherwise a standalone client.
+func NewRedisUniversalClient(m RedisMetadata) redis.UniversalClient {
+	if m.Failover {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:      m.SentinelMasterName,
+			SentinelAddrs:   splitHosts(m.Host),
+			Username:        m.Username,
+			Password:        m.Password,
+			DB:              m.DB,
+			MaxRetries:      m.MaxRetries,
+			MaxRetryBackoff: m.MaxRetryBackoff,
+			TLSConfig:       newTLSConfig(m.EnableTLS, m.TLSSkipVerify),
+			PoolSize:        m.PoolSize,
+			MinIdleConns:    m.MinIdleConns,
+		})
+	}
+	if m.RedisType == RedisTypeCluster {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           splitHosts(m.Host),
+			Username:        m.Username,
+			Password:        m.Password,
+			MaxRetries:      m.MaxRetries,
+			MaxRetryBackoff: m.MaxRetryBackoff,
+			TLSConfig:       newTLSConfig(m.EnableTLS, m.TLSSkipVerify),
+			PoolSize:        m.PoolSize,
+			MinIdleConns:    m.MinIdleConns,
+		})
+	}
+	return NewRedisClient(m)
+}
+
+// newTLSConfig verifies the certificates of the servers unless skipVerify is set explicitly
+func newTLSConfig(enable bool, skipVerify bool) *tls.Config {
+	if !enable {
+		return nil
+	}
+	return &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+}
+
+func splitHosts(val string) []string {
+	hosts := strings.Split(val, ",")
+	for i := range hosts {
+		hosts[i] = strings.TrimSpace(hosts[i])
+	}
+	return hosts
+}
+
 type RedisMetadata struct {
+	// Host is the address of redis. It can be a comma separated list in cluster or failover mode.
 	Host            string
+	Username        string
 	Password        string
 	MaxRetries      int
 	MaxRetryBackoff time.Duration
 	EnableTLS       bool
-	DB              int
+	// TLSSkipVerify skips verifying the certificates of the servers, which is insecure and only for testing
+	TLSSkipVerify bool
+	DB            int
+	// RedisType is node or cluster
+	RedisType string
+	// Failover enables the sentinel mode, and Host is the address list of sentinels
+	Failover           bool
+	SentinelMasterName string
+	// PoolSize is the max number of connections per node. 0 means the default of go-redis, 10 per CPU.
+	PoolSize int
+	// MinIdleConns is the minimum number of idle connections kept per node.
+	MinIdleConns int
 }
 
 func ParseRedisMetadata(properties map[string]string) (RedisMetadata, error) {
@@ -79,6 +157,10 @@ func ParseRedisMetadata(properties map[string]string) (RedisMetadata, error) {
 		m.Password = val
 	}
 
+	if val, ok := properties[username]; ok && val != "" {
+		m.Username = val
+	}
+
 	m.EnableTLS = defaultEnableTLS
 	if val, ok := properties[enableTLS]; ok && val != "" {
 		tls, err := strconv.ParseBool(val)
@@ -88,6 +170,57 @@ func ParseRedisMetadata(properties map[string]string) (RedisMetadata, error) {
 		m.EnableTLS = tls
 	}
 
+	m.TLSSkipVerify = defaultTLSSkipVerify
+	if val, ok := properties[tlsSkipVerify]; ok && val != "" {
+		skip, err := strconv.ParseBool(val)
+		if err != nil {
+			return m, fmt.Errorf("redis store error: can't parse tlsSkipVerify field: %s", err)
+		}
+		m.TLSSkipVerify = skip
+	}
+
+	m.RedisType = RedisTypeNode
+	if val, ok := properties[redisType]; ok && val != "" {
+		if val != RedisTypeNode && val != RedisTypeCluster {
+			return m, fmt.Errorf("redis store error: redisType must be %s or %s, but got %s", RedisTypeNode, RedisTypeCluster, val)
+		}
+		m.RedisType = val
+	}
+
+	if val, ok := properties[failover]; ok && val != "" {
+		parsedVal, err := strconv.ParseBool(val)
+		if err != nil {
+			return m, fmt.Errorf("redis store error: can't parse failover field: %s", err)
+		}
+		m.Failover = parsedVal
+	}
+	if val, ok := properties[poolSize]; ok && val != "" {
+		parsedVal, err := strconv.Atoi(val)
+		if err != nil || parsedVal < 0 {
+			return m, fmt.Errorf("redis store error: can't parse poolSize field: %s", val)
+		}
+		m.PoolSize = parsedVal
+	}
+
+	if val, ok := properties[minIdleConns]; ok && val != "" {
+		parsedVal, err := strconv.Atoi(val)
+		if err != nil || parsedVal < 0 {
+			return m, fmt.Errorf("redis store error: can't parse minIdleConns field: %s", val)
+		}
+		m.MinIdleConns = parsedVal
+	}
+
+	if m.Failover {
+		if m.RedisType == RedisTypeCluster {
+			return m, errors.New("redis store error: failover is not supported in cluster mode")
+		}
+		if val, ok := properties[sentinelMasterName]; ok && val != "" {
+			m.SentinelMasterName = val
+		} else {
+			return m, errors.New("redis store error: missing sentinelMasterName in failover mode")
+		}
+	}
+
 	m.MaxRetries = defaultMaxRetries
 	if val, ok := properties[maxRetries]; ok && val != "" {
 		parsedVal, err := strconv.ParseInt(val, defaultBase, defaultBitSize)
@@ -123,15 +256,12 @@ func NewClusterRedisClient(m RedisClusterMetadata) []*redis.Client {
 	for _, Host := range m.Hosts {
 		opts := &redis.Options{
 			Addr:            Host,
+			Username:        m.Username,
 			Password:        m.Password,
 			DB:              m.DB,
 			MaxRetries:      m.MaxRetries,
 			MaxRetryBackoff: m.MaxRetryBackoff,
-		}
-		if m.EnableTLS {
-			opts.TLSConfig = &tls.Config{
-				InsecureSkipVerify: m.EnableTLS,
-			}
+			TLSConfig:       newTLSConfig(m.EnableTLS, m.TLSSkipVerify),
 		}
 		clients = append(clients, redis.NewClient(opts))
 	}
@@ -141,11 +271,14 @@ func NewClusterRedisClient(m RedisClusterMetadata) []*redis.Client {
 type RedisClusterMetadata struct {
 	Hosts           []string
 	Concurrency     int
+	Username        string
 	Password        string
 	MaxRetries      int
 	MaxRetryBackoff time.Duration
 	EnableTLS       bool
-	DB              int
+	// TLSSkipVerify skips verifying the certificates of the servers, which is insecure and only for testing
+	TLSSkipVerify bool
+	DB            int
 }
 
 func ParseRedisClusterMetadata(properties map[string]string) (RedisClusterMetadata, error) {
@@ -161,6 +294,10 @@ func ParseRedisClusterMetadata(properties map[string]string) (RedisClusterMetada
 		m.Password = val
 	}
 
+	if val, ok := properties[username]; ok && val != "" {
+		m.Username = val
+	}
+
 	m.EnableTLS = defaultEnableTLS
 	if val, ok := properties[enableTLS]; ok && val != "" {
 		tls, err := strconv.ParseBool(val)
@@ -170,6 +307,15 @@ func ParseRedisClusterMetadata(properties map[string]string) (RedisClusterMetada
 		m.EnableTLS = tls
 	}
 
+	m.TLSSkipVerify = defaultTLSSkipVerify
+	if val, ok := properties[tlsSkipVerify]; ok && val != "" {
+		skip, err := strconv.ParseBool(val)
+		if err != nil {
+			return m, fmt.Errorf("redis store error: can't parse tlsSkipVerify field: %s", err)
+		}
+		m.TLSSkipVerify = skip
+	}
+
 	m.MaxRetries = defaultMaxRetries
 	if val, ok := properties[maxRetries]; ok && val != "" {
 		parsedVal, err := strconv.ParseInt(val, defaultBase, defaultBitSize)
@@ -215,3 +361,22 @@ func ParseRedisClusterMetadata(properties map[string]string) (RedisClusterMetada
 func GetMiliTimestamp(i int64) int64 {
 	return i / 1e6
 }
+
+// RedisMetadataSchema declares the metadata fields parsed by ParseRedisMetadata
+var RedisMetadataSchema = &schema.Schema{
+	Fields: []schema.Field{
+		{Name: host, Type: schema.TypeString, Required: true, Description: "redis server address, such as localhost:6380. It can be a comma separated list in cluster or failover mode"},
+		{Name: username, Type: schema.TypeString, Description: "redis username, used by the AUTH command with ACL"},
+		{Name: password, Type: schema.TypeString, Secret: true, Description: "redis password"},
+		{Name: db, Type: schema.TypeInt, Default: strconv.Itoa(defaultDB), Description: "redis database number"},
+		{Name: enableTLS, Type: schema.TypeBool, Default: strconv.FormatBool(defaultEnableTLS), Description: "whether to connect with TLS, the certificates of the servers are verified"},
+		{Name: tlsSkipVerify, Type: schema.TypeBool, Default: strconv.FormatBool(defaultTLSSkipVerify), Description: "whether to skip verifying the certificates of the servers with TLS, which is insecure"},
+		{Name: maxRetries, Type: schema.TypeInt, Default: strconv.Itoa(defaultMaxRetries), Description: "maximum number of retries before giving up"},
+		{Name: maxRetryBackoff, Type: schema.TypeDuration, Default: defaultMaxRetryBackoff.String(), Description: "maximum backoff between each retry"},
+		{Name: redisType, Type: schema.TypeString, Default: RedisTypeNode, Options: []string{RedisTypeNode, RedisTypeCluster}, Description: "the deployment of redis"},
+		{Name: failover, Type: schema.TypeBool, Default: "false", Description: "whether to connect via sentinels"},
+		{Name: sentinelMasterName, Type: schema.TypeString, Description: "the name of the master monitored by sentinels. Required if failover is true"},
+		{Name: poolSize, Type: schema.TypeInt, Description: "the max number of connections per redis node"},
+		{Name: minIdleConns, Type: schema.TypeInt, Description: "the minimum number of idle connections"},
+	},
+}
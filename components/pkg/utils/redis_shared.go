@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	sharedRedisClientsLock sync.Mutex
+	sharedRedisClients     = make(map[string]*sharedRedisClient)
+)
+
+// sharedRedisClient is a client shared by all the components connecting to the same redis with the same options.
+type sharedRedisClient struct {
+	client redis.UniversalClient
+	refs   int
+}
+
+// sharedRedisClientRef is what a component gets. Closing it only releases the reference,
+// and the underlying connection pool is closed when the last reference is released.
+type sharedRedisClientRef struct {
+	redis.UniversalClient
+	key  string
+	once sync.Once
+}
+
+// AcquireRedisClient returns a client whose connection pool is shared by the components
+// with the same redis metadata, e.g. one redis used for both lock and sequencer.
+// The caller should call Close() on the returned client to release it.
+func AcquireRedisClient(m RedisMetadata) redis.UniversalClient {
+	key := redisMetadataKey(m)
+	sharedRedisClientsLock.Lock()
+	defer sharedRedisClientsLock.Unlock()
+	shared, ok := sharedRedisClients[key]
+	if !ok {
+		shared = &sharedRedisClient{client: NewRedisUniversalClient(m)}
+		sharedRedisClients[key] = shared
+	}
+	shared.refs++
+	return &sharedRedisClientRef{
+		UniversalClient: shared.client,
+		key:             key,
+	}
+}
+
+// Close releases the reference. It's safe to be called more than once.
+func (r *sharedRedisClientRef) Close() error {
+	var err error
+	r.once.Do(func() {
+		sharedRedisClientsLock.Lock()
+		defer sharedRedisClientsLock.Unlock()
+		shared, ok := sharedRedisClients[r.key]
+		if !ok {
+			return
+		}
+		shared.refs--
+		if shared.refs > 0 {
+			return
+		}
+		delete(sharedRedisClients, r.key)
+		err = shared.client.Close()
+	})
+	return err
+}
+
+func redisMetadataKey(m RedisMetadata) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%s|%t|%s|%t|%t|%d|%d|%d|%d",
+		m.Host, m.Username, m.Password, m.DB, m.RedisType, m.Failover, m.SentinelMasterName,
+		m.EnableTLS, m.TLSSkipVerify, m.MaxRetries, m.MaxRetryBackoff, m.PoolSize, m.MinIdleConns)
+}
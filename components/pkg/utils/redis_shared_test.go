@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireRedisClient(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	m, err := ParseRedisMetadata(map[string]string{host: s.Addr()})
+	assert.NoError(t, err)
+	c1 := AcquireRedisClient(m)
+	c2 := AcquireRedisClient(m)
+	// the same pool is shared
+	assert.Equal(t, c1.(*sharedRedisClientRef).UniversalClient, c2.(*sharedRedisClientRef).UniversalClient)
+	assert.Equal(t, 2, sharedRedisClients[redisMetadataKey(m)].refs)
+
+	// different options lead to different pools
+	m2 := m
+	m2.PoolSize = 5
+	c3 := AcquireRedisClient(m2)
+	assert.NotEqual(t, c1.(*sharedRedisClientRef).UniversalClient, c3.(*sharedRedisClientRef).UniversalClient)
+	assert.NoError(t, c3.Close())
+
+	// closing one reference doesn't affect others
+	assert.NoError(t, c1.Close())
+	assert.NoError(t, c1.Close())
+	assert.NoError(t, c2.Ping(context.Background()).Err())
+	assert.Equal(t, 1, sharedRedisClients[redisMetadataKey(m)].refs)
+
+	// the pool is closed after the last reference is released
+	assert.NoError(t, c2.Close())
+	_, ok := sharedRedisClients[redisMetadataKey(m)]
+	assert.False(t, ok)
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRedisMetadata(t *testing.T) {
+	t.Run("missing host", func(t *testing.T) {
+		_, err := ParseRedisMetadata(map[string]string{})
+		assert.Error(t, err)
+	})
+
+	t.Run("default node", func(t *testing.T) {
+		m, err := ParseRedisMetadata(map[string]string{
+			host:     "127.0.0.1:6379",
+			username: "user",
+			password: "pwd",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, RedisTypeNode, m.RedisType)
+		assert.Equal(t, "user", m.Username)
+		assert.False(t, m.Failover)
+		_, ok := NewRedisUniversalClient(m).(*redis.Client)
+		assert.True(t, ok)
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		m, err := ParseRedisMetadata(map[string]string{
+			host:      "127.0.0.1:7000, 127.0.0.1:7001",
+			redisType: RedisTypeCluster,
+			enableTLS: "true",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"127.0.0.1:7000", "127.0.0.1:7001"}, splitHosts(m.Host))
+		_, ok := NewRedisUniversalClient(m).(*redis.ClusterClient)
+		assert.True(t, ok)
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		_, err := ParseRedisMetadata(map[string]string{
+			host:     "127.0.0.1:26379",
+			failover: "true",
+		})
+		assert.Error(t, err)
+
+		_, err = ParseRedisMetadata(map[string]string{
+			host:               "127.0.0.1:26379",
+			failover:           "true",
+			redisType:          RedisTypeCluster,
+			sentinelMasterName: "mymaster",
+		})
+		assert.Error(t, err)
+
+		m, err := ParseRedisMetadata(map[string]string{
+			host:               "127.0.0.1:26379",
+			failover:           "true",
+			sentinelMasterName: "mymaster",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "mymaster", m.SentinelMasterName)
+		_, ok := NewRedisUniversalClient(m).(*redis.Client)
+		assert.True(t, ok)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		m, err := ParseRedisMetadata(map[string]string{
+			host:      "127.0.0.1:6379",
+			enableTLS: "true",
+		})
+		assert.Nil(t, err)
+		// the certificates are verified by default
+		assert.False(t, NewRedisClient(m).Options().TLSConfig.InsecureSkipVerify)
+
+		m, err = ParseRedisMetadata(map[string]string{
+			host:          "127.0.0.1:6379",
+			enableTLS:     "true",
+			tlsSkipVerify: "true",
+		})
+		assert.Nil(t, err)
+		assert.True(t, NewRedisClient(m).Options().TLSConfig.InsecureSkipVerify)
+
+		_, err = ParseRedisMetadata(map[string]string{host: "127.0.0.1:6379", tlsSkipVerify: "yes"})
+		assert.Error(t, err)
+	})
+
+	t.Run("illegal redisType", func(t *testing.T) {
+		_, err := ParseRedisMetadata(map[string]string{
+			host:      "127.0.0.1:6379",
+			redisType: "other",
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestRedisMetadataSchema(t *testing.T) {
+	assert.Nil(t, RedisMetadataSchema.Validate(map[string]string{host: "127.0.0.1:6380", redisType: RedisTypeCluster}))
+	assert.NotNil(t, RedisMetadataSchema.Validate(map[string]string{host: "127.0.0.1:6380", redisType: "sentinel"}))
+	assert.NotNil(t, RedisMetadataSchema.Validate(map[string]string{}))
+}
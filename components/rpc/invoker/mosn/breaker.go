@@ -0,0 +1,301 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+)
+
+const (
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerErrorRatio  = 0.5
+	defaultBreakerCooldown    = 30 * time.Second
+)
+
+// CircuitBreakerConfig is the config of the circuit breakers of the endpoints of the targets, i.e. the ids of InvokeService.
+// An endpoint is ejected for the cooldown if the error ratio in the window or the consecutive errors exceed the thresholds,
+// and the requests to it fail fast. After the cooldown, one request is let through as a probe,
+// which closes the breaker if it succeeds, or ejects the endpoint again if it fails or doesn't complete in its timeout.
+type CircuitBreakerConfig struct {
+	// WindowMs is the window of counting the errors, the default value is 10000.
+	WindowMs int `json:"window_ms"`
+	// MinRequests is the min number of requests in a window to judge the error ratio, the default value is 20.
+	MinRequests int `json:"min_requests"`
+	// ErrorRatio is the max error ratio in a window, the default value is 0.5.
+	ErrorRatio float64 `json:"error_ratio"`
+	// ConsecutiveErrors ejects the endpoint after the number of consecutive errors if it's positive.
+	ConsecutiveErrors int `json:"consecutive_errors"`
+	// CooldownMs is how long the endpoint is ejected, the default value is 30000.
+	CooldownMs int `json:"cooldown_ms"`
+}
+
+// endpointKey identifies the circuit breaker of an endpoint of a target
+type endpointKey struct {
+	target string
+	// endpoint is the one resolved by dns or the static endpoints,
+	// it's empty if the request is sent to the cluster of MOSN, which balances the hosts of the target itself
+	endpoint string
+}
+
+func (k endpointKey) String() string {
+	if k.endpoint == "" {
+		return k.target
+	}
+	return k.target + "@" + k.endpoint
+}
+
+type circuitBreakers struct {
+	window            time.Duration
+	minRequests       int
+	errorRatio        float64
+	consecutiveErrors int
+	cooldown          time.Duration
+	now               func() time.Time
+
+	mu        sync.Mutex
+	endpoints map[endpointKey]*endpointBreaker
+}
+
+type endpointBreaker struct {
+	windowStart  time.Time
+	requests     int
+	errors       int
+	consecutive  int
+	ejectedUntil time.Time
+	// probing is true if the probe after the cooldown is in flight, which is abandoned after the probeDeadline.
+	// probe identifies the probe in flight, so that the result of an abandoned one is ignored.
+	probing       bool
+	probe         uint64
+	probeDeadline time.Time
+	metrics       types.Metrics
+}
+
+func newCircuitBreakers(cfg *CircuitBreakerConfig) *circuitBreakers {
+	b := &circuitBreakers{
+		window:            defaultBreakerWindow,
+		minRequests:       defaultBreakerMinRequests,
+		errorRatio:        defaultBreakerErrorRatio,
+		consecutiveErrors: cfg.ConsecutiveErrors,
+		cooldown:          defaultBreakerCooldown,
+		now:               time.Now,
+		endpoints:         make(map[endpointKey]*endpointBreaker),
+	}
+	if cfg.WindowMs > 0 {
+		b.window = time.Duration(cfg.WindowMs) * time.Millisecond
+	}
+	if cfg.MinRequests > 0 {
+		b.minRequests = cfg.MinRequests
+	}
+	if cfg.ErrorRatio > 0 {
+		b.errorRatio = cfg.ErrorRatio
+	}
+	if cfg.CooldownMs > 0 {
+		b.cooldown = time.Duration(cfg.CooldownMs) * time.Millisecond
+	}
+	return b
+}
+
+// endpoint returns the breaker of the endpoint, the caller must hold the lock
+func (b *circuitBreakers) endpoint(key endpointKey) *endpointBreaker {
+	t, ok := b.endpoints[key]
+	if !ok {
+		t = &endpointBreaker{windowStart: b.now()}
+		m, err := metrics.NewMetrics("rpc_circuit_breaker", map[string]string{"target": key.target, "endpoint": key.endpoint})
+		if err != nil {
+			log.DefaultLogger.Warnf("[runtime][rpc]create metrics of circuit breaker %s error: %v", key, err)
+		}
+		t.metrics = m
+		b.endpoints[key] = t
+	}
+	return t
+}
+
+// available reports whether the requests can be sent to the endpoint, without taking the probe.
+// It's used by the resolvers to skip the ejected endpoints.
+func (b *circuitBreakers) available(key endpointKey) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.endpoints[key]
+	if !ok || t.ejectedUntil.IsZero() {
+		return true
+	}
+	return !b.now().Before(t.ejectedUntil) && !t.probing
+}
+
+// allow reports whether the request to the endpoint can be sent.
+// If the request is the probe after the cooldown, it returns the id of the probe, which is abandoned after the timeout.
+func (b *circuitBreakers) allow(key endpointKey, timeout time.Duration) (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.endpoint(key)
+	if t.ejectedUntil.IsZero() {
+		return 0, true
+	}
+	now := b.now()
+	if t.probing && !now.Before(t.probeDeadline) {
+		// the probe not completing in its timeout is taken as a failure
+		log.DefaultLogger.Warnf("[runtime][rpc]probe of circuit breaker of %s doesn't complete in %v", key, timeout)
+		t.probing = false
+		b.eject(key, t, now)
+	}
+	if now.Before(t.ejectedUntil) || t.probing {
+		t.inc("rejections")
+		return 0, false
+	}
+	if timeout <= 0 {
+		timeout = b.cooldown
+	}
+	t.probing = true
+	t.probe++
+	t.probeDeadline = now.Add(timeout)
+	return t.probe, true
+}
+
+// record counts the result of a request to the endpoint, probe is the one returned by allow
+func (b *circuitBreakers) record(key endpointKey, probe uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.endpoint(key)
+	now := b.now()
+	if probe != 0 {
+		// the probe is abandoned, or the breaker is reset
+		if !t.probing || t.probe != probe {
+			return
+		}
+		t.probing = false
+		if err == nil {
+			log.DefaultLogger.Infof("[runtime][rpc]circuit breaker of %s is closed", key)
+			t.reset(now)
+		} else {
+			b.eject(key, t, now)
+		}
+		return
+	}
+	// the requests sent before the endpoint is ejected don't count
+	if !t.ejectedUntil.IsZero() {
+		return
+	}
+	if now.Sub(t.windowStart) >= b.window {
+		t.windowStart = now
+		t.requests, t.errors = 0, 0
+	}
+	t.requests++
+	if err == nil {
+		t.consecutive = 0
+		return
+	}
+	t.errors++
+	t.consecutive++
+	if (b.consecutiveErrors > 0 && t.consecutive >= b.consecutiveErrors) ||
+		(t.requests >= b.minRequests && float64(t.errors) >= b.errorRatio*float64(t.requests)) {
+		b.eject(key, t, now)
+	}
+}
+
+func (b *circuitBreakers) eject(key endpointKey, t *endpointBreaker, now time.Time) {
+	log.DefaultLogger.Warnf("[runtime][rpc]circuit breaker of %s is open for %v, errors: %d/%d, consecutive errors: %d",
+		key, b.cooldown, t.errors, t.requests, t.consecutive)
+	t.ejectedUntil = now.Add(b.cooldown)
+	t.windowStart = now
+	t.requests, t.errors, t.consecutive = 0, 0, 0
+	t.inc("ejections")
+	t.updateEjected(1)
+}
+
+// reset closes the breakers of the endpoints of the target, or all the targets if it's empty,
+// and returns the endpoints which were open
+func (b *circuitBreakers) reset(target string) []rpc.CircuitBreakerEndpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var endpoints []rpc.CircuitBreakerEndpoint
+	for key, t := range b.endpoints {
+		if (target == "" || target == key.target) && !t.ejectedUntil.IsZero() {
+			t.reset(b.now())
+			endpoints = append(endpoints, rpc.CircuitBreakerEndpoint{Id: key.target, Endpoint: key.endpoint})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Id != endpoints[j].Id {
+			return endpoints[i].Id < endpoints[j].Id
+		}
+		return endpoints[i].Endpoint < endpoints[j].Endpoint
+	})
+	return endpoints
+}
+
+func (t *endpointBreaker) reset(now time.Time) {
+	t.ejectedUntil = time.Time{}
+	t.probing = false
+	t.windowStart = now
+	t.requests, t.errors, t.consecutive = 0, 0, 0
+	t.updateEjected(0)
+}
+
+func (t *endpointBreaker) inc(name string) {
+	if t.metrics != nil {
+		t.metrics.Counter(name).Inc(1)
+	}
+}
+
+func (t *endpointBreaker) updateEjected(v int64) {
+	if t.metrics != nil {
+		t.metrics.Gauge("ejected").Update(v)
+	}
+}
+
+// do sends the request through the circuit breaker of its endpoint
+func (m *mosnInvoker) do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	// the breaker and the channel are of the target before it's resolved to the fallback target
+	id := req.Id
+	if m.breakers == nil {
+		m.resolve(req, nil)
+		return m.channelOf(id).Do(req)
+	}
+	// the resolvers skip the ejected endpoints
+	key := endpointKey{target: id}
+	key.endpoint = m.resolve(req, func(endpoint string) bool {
+		return m.breakers.available(endpointKey{target: id, endpoint: endpoint})
+	})
+	probe, ok := m.breakers.allow(key, time.Duration(req.Timeout)*time.Millisecond)
+	if !ok {
+		return nil, common.Errorf(common.UnavailebleCode, "circuit breaker of %s is open", key)
+	}
+	resp, err := m.channelOf(id).Do(req)
+	m.breakers.record(key, probe, err)
+	return resp, err
+}
+
+// ResetCircuitBreaker implements rpc.CircuitBreakerResetter
+func (m *mosnInvoker) ResetCircuitBreaker(target string) []rpc.CircuitBreakerEndpoint {
+	if m.breakers == nil {
+		return nil
+	}
+	endpoints := m.breakers.reset(target)
+	if len(endpoints) > 0 {
+		log.DefaultLogger.Infof("[runtime][rpc]circuit breakers of %v are reset", endpoints)
+	}
+	return endpoints
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreakers(&CircuitBreakerConfig{MinRequests: 4, ErrorRatio: 0.5, CooldownMs: 1000})
+	b.now = func() time.Time { return now }
+	fail := errors.New("fail")
+	svc := endpointKey{target: "svc"}
+	allow := func(key endpointKey) bool {
+		_, ok := b.allow(key, time.Second)
+		return ok
+	}
+
+	// not ejected before the min requests
+	b.record(svc, 0, nil)
+	b.record(svc, 0, fail)
+	b.record(svc, 0, fail)
+	assert.True(t, allow(svc))
+	b.record(svc, 0, fail)
+	// 3 errors of 4 requests
+	assert.False(t, allow(svc))
+	assert.False(t, b.available(svc))
+	assert.True(t, allow(endpointKey{target: "other"}))
+	// the endpoints are ejected separately
+	assert.True(t, allow(endpointKey{target: "svc", endpoint: "10.0.0.1:8080"}))
+
+	// a probe after the cooldown, the others are rejected while probing
+	now = now.Add(time.Second)
+	assert.True(t, b.available(svc))
+	probe, ok := b.allow(svc, time.Second)
+	assert.True(t, ok)
+	assert.False(t, b.available(svc))
+	assert.False(t, allow(svc))
+	b.record(svc, probe, fail)
+	assert.False(t, allow(svc))
+	now = now.Add(time.Second)
+	probe, ok = b.allow(svc, time.Second)
+	assert.True(t, ok)
+	b.record(svc, probe, nil)
+	assert.True(t, allow(svc))
+
+	// the window is reset
+	b.record(svc, 0, fail)
+	b.record(svc, 0, fail)
+	b.record(svc, 0, fail)
+	now = now.Add(defaultBreakerWindow)
+	b.record(svc, 0, fail)
+	assert.True(t, allow(svc))
+
+	// consecutive errors
+	b = newCircuitBreakers(&CircuitBreakerConfig{ConsecutiveErrors: 2, CooldownMs: 1000})
+	b.now = func() time.Time { return now }
+	b.record(svc, 0, fail)
+	b.record(svc, 0, nil)
+	b.record(svc, 0, fail)
+	assert.True(t, allow(svc))
+	b.record(svc, 0, fail)
+	assert.False(t, allow(svc))
+
+	// the probe not completing in its timeout ejects the endpoint again, and its result is ignored
+	now = now.Add(time.Second)
+	probe, ok = b.allow(svc, 100*time.Millisecond)
+	assert.True(t, ok)
+	now = now.Add(100 * time.Millisecond)
+	assert.False(t, allow(svc))
+	b.record(svc, probe, nil)
+	assert.False(t, allow(svc))
+	now = now.Add(time.Second)
+	assert.True(t, allow(svc))
+
+	// manual reset
+	b.eject(svc, b.endpoint(svc), now)
+	b.eject(endpointKey{target: "svc", endpoint: "10.0.0.1:8080"}, b.endpoint(endpointKey{target: "svc", endpoint: "10.0.0.1:8080"}), now)
+	assert.Empty(t, b.reset("other"))
+	assert.Equal(t, []rpc.CircuitBreakerEndpoint{{Id: "svc"}, {Id: "svc", Endpoint: "10.0.0.1:8080"}}, b.reset(""))
+	assert.True(t, allow(svc))
+}
+
+func TestInvokeWithCircuitBreaker(t *testing.T) {
+	ch := &scriptedChannel{failures: 100}
+	m := &mosnInvoker{channel: ch, cb: callback.NewCallback(), breakers: newCircuitBreakers(&CircuitBreakerConfig{ConsecutiveErrors: 2})}
+	req := func() *rpc.RPCRequest { return &rpc.RPCRequest{Id: "svc", Method: "Get"} }
+	for i := 0; i < 2; i++ {
+		_, err := m.Invoke(context.Background(), req())
+		assert.Equal(t, "fail", err.Error())
+	}
+	// fail fast without calling the target
+	_, err := m.Invoke(context.Background(), req())
+	assert.Equal(t, "code 1, msg: circuit breaker of svc is open", err.Error())
+	assert.Equal(t, int32(2), ch.calls)
+
+	assert.Equal(t, []rpc.CircuitBreakerEndpoint{{Id: "svc"}}, m.ResetCircuitBreaker("svc"))
+	_, err = m.Invoke(context.Background(), req())
+	assert.Equal(t, "fail", err.Error())
+}
+
+func TestInvokeWithEndpointCircuitBreaker(t *testing.T) {
+	r, err := newResolvers(&ResolverConfig{
+		FallbackTarget: "fallback",
+		Targets:        map[string]*TargetResolverConfig{"svc": {Chain: []string{"static"}, Static: []string{"10.0.0.1:8080", "10.0.0.2:8080"}}},
+	})
+	assert.Nil(t, err)
+	r.random = func(n int) int { return 0 }
+	ch := &scriptedChannel{failures: 1}
+	m := &mosnInvoker{
+		channel:   ch,
+		cb:        callback.NewCallback(),
+		resolvers: r,
+		breakers:  newCircuitBreakers(&CircuitBreakerConfig{ConsecutiveErrors: 1}),
+	}
+	req := &rpc.RPCRequest{Id: "svc", Method: "Get"}
+	_, err = m.Invoke(context.Background(), req)
+	assert.NotNil(t, err)
+	assert.Equal(t, "10.0.0.1:8080", req.Header.Get(defaultEndpointHeader))
+
+	// the ejected endpoint is skipped, and the others of the target are still used
+	req = &rpc.RPCRequest{Id: "svc", Method: "Get"}
+	_, err = m.Invoke(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:8080", req.Header.Get(defaultEndpointHeader))
+}
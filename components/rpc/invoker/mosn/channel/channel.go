@@ -24,6 +24,7 @@ import (
 
 	"mosn.io/layotto/components/rpc"
 	common "mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/mosn/pkg/server"
 )
 
@@ -49,6 +50,11 @@ type ChannelConfig struct {
 	Listener string                 `json:"listener"`
 	Size     int                    `json:"size"`
 	Ext      map[string]interface{} `json:"ext"`
+	// Targets are the ids of InvokeService served by the channel, which is ignored by the first channel,
+	// i.e. the default one serving the other targets
+	Targets []string `json:"targets"`
+	// Egress is the egress policy passed by the invoker
+	Egress *egress.Policy `json:"-"`
 }
 
 // GetChannel is get rpc.Channel by config.Protocol
@@ -121,11 +121,20 @@ func (p *connPool) Get(ctx context.Context) (*wrapConn, error) {
 	}
 
 	// create new conn
-	c, err := p.dialFunc()
+	wc, err := p.dial()
 	if err != nil {
 		p.freeTurn()
 		return nil, err
 	}
+	return wc, nil
+}
+
+// dial creates a new conn and starts its readloop
+func (p *connPool) dial() (*wrapConn, error) {
+	c, err := p.dialFunc()
+	if err != nil {
+		return nil, err
+	}
 	wc := &wrapConn{Conn: c}
 	if p.stateFunc != nil {
 		wc.state = p.stateFunc()
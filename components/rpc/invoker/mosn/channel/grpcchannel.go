@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	_ "mosn.io/mosn/pkg/stream/http2"
+
+	common "mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+)
+
+const (
+	// GrpcProtocol is the protocol of the grpc channel
+	GrpcProtocol = "grpc"
+	// GrpcTargetHeader is the metadata of the target of the request, i.e. the id of the request,
+	// which the router of the listener routes by
+	GrpcTargetHeader = "x-layotto-target"
+
+	grpcContentType = "application/x-protobuf"
+)
+
+// init is regist grpc channel
+func init() {
+	RegistChannel(GrpcProtocol, newGrpcChannel)
+}
+
+// grpcChannel is Channel implement, which calls the unary methods of gRPC services through the listener of mosn,
+// e.g. a http2 proxy to the gRPC apps. The data of requests and responses are serialized protobuf messages.
+type grpcChannel struct {
+	listener string
+	// the conn is dialed at the first request, like the conns of the other channels, so that mosn has started
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+// newGrpcChannel is create rpc.Channel by ChannelConfig
+func newGrpcChannel(config ChannelConfig) (rpc.Channel, error) {
+	// the connections are multiplexed by http2, so the size of the channel is ignored
+	return &grpcChannel{listener: config.Listener}, nil
+}
+
+func (g *grpcChannel) getConn() (*grpc.ClientConn, error) {
+	g.once.Do(func() {
+		g.conn, g.err = grpc.Dial("passthrough:///"+g.listener,
+			grpc.WithInsecure(),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				local, remote := net.Pipe()
+				if err := acceptFunc(&fakeTcpConn{c: remote}, g.listener); err != nil {
+					local.Close()
+					remote.Close()
+					return nil, err
+				}
+				return &fakeTcpConn{c: local}, nil
+			}),
+		)
+	})
+	return g.conn, g.err
+}
+
+// Do is used to handle RPCRequest and return RPCResponse
+func (g *grpcChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	conn, err := g.getConn()
+	if err != nil {
+		return nil, common.Error(common.UnavailebleCode, err.Error())
+	}
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(req.Ctx, timeout)
+	defer cancel()
+
+	md := metadata.MD{}
+	req.Header.Range(func(key string, value string) bool {
+		if !isReservedGrpcHeader(key) {
+			md.Set(key, value)
+		}
+		return true
+	})
+	md.Set(GrpcTargetHeader, req.Id)
+	var header, trailer metadata.MD
+	out := []byte{}
+	err = conn.Invoke(metadata.NewOutgoingContext(ctx, md), grpcMethod(req), &req.Data, &out,
+		grpc.ForceCodec(rawCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, toCommonError(err)
+	}
+	resp := &rpc.RPCResponse{
+		ContentType: grpcContentType,
+		Data:        out,
+		Header:      map[string][]string{},
+	}
+	for k, v := range header {
+		resp.Header[k] = v
+	}
+	// the trailers are returned as the headers, after the headers with the same keys
+	for k, v := range trailer {
+		resp.Header[k] = append(resp.Header[k], v...)
+	}
+	return resp, nil
+}
+
+// grpcMethod returns the full method of the request. If the method isn't full, the id of InvokeService is the full name of the service,
+// which is the source of the request if the id is rewritten to another target, e.g. the fallback target of the resolver.
+func grpcMethod(req *rpc.RPCRequest) string {
+	if strings.HasPrefix(req.Method, "/") {
+		return req.Method
+	}
+	service := req.Id
+	if req.Source != "" {
+		service = req.Source
+	}
+	return "/" + service + "/" + req.Method
+}
+
+// isReservedGrpcHeader reports whether the header is set by gRPC or is the options of http channels
+func isReservedGrpcHeader(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "content-type", "user-agent", "te", "verb", "query_string", GrpcTargetHeader:
+		return true
+	}
+	return strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-")
+}
+
+// toCommonError converts the gRPC status to the error of rpc
+func toCommonError(err error) error {
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.DeadlineExceeded:
+		return common.Error(common.TimeoutCode, s.Message())
+	case codes.Unavailable:
+		return common.Error(common.UnavailebleCode, s.Message())
+	case codes.InvalidArgument:
+		return common.Error(common.InvalidArgsCode, s.Message())
+	default:
+		return common.Errorf(common.InternalCode, "grpc response code %s, message: %s", s.Code(), s.Message())
+	}
+}
+
+// rawCodec sends and receives the serialized protobuf messages as they are
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+// Name is the content subtype of the requests, i.e. "application/grpc+proto"
+func (rawCodec) Name() string {
+	return "proto"
+}
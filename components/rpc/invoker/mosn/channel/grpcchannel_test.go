@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	common "mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+)
+
+// connListener is a net.Listener accepting the conns of the channel
+type connListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errors.New("listener is closed")
+	}
+}
+
+func (l *connListener) Close() error {
+	close(l.done)
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// startGrpcEchoServer serves the method /test.Echo/Echo, which replies the StringValue with the target in the metadata
+func startGrpcEchoServer(t *testing.T) {
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Echo",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &wrapperspb.StringValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if in.Value == "invalid" {
+					return nil, status.Error(codes.InvalidArgument, "invalid value")
+				}
+				md, _ := metadata.FromIncomingContext(ctx)
+				target := md.Get(GrpcTargetHeader)[0]
+				grpc.SetHeader(ctx, metadata.Pairs("echo-target", target))
+				grpc.SetTrailer(ctx, metadata.Pairs("echo-trailer", "done"))
+				return &wrapperspb.StringValue{Value: in.Value + "@" + target}, nil
+			},
+		}},
+	}, struct{}{})
+	lis := &connListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	acceptFunc = func(conn net.Conn, listener string) error {
+		go func() {
+			lis.conns <- conn
+		}()
+		return nil
+	}
+}
+
+func TestGrpcChannel(t *testing.T) {
+	startGrpcEchoServer(t)
+	ch, err := GetChannel(ChannelConfig{Protocol: GrpcProtocol, Listener: "grpc"})
+	assert.Nil(t, err)
+
+	data, err := proto.Marshal(&wrapperspb.StringValue{Value: "hello"})
+	assert.Nil(t, err)
+	req := &rpc.RPCRequest{
+		Ctx:     context.Background(),
+		Id:      "test.Echo",
+		Method:  "Echo",
+		Timeout: 1000,
+		Data:    data,
+		Header:  rpc.RPCHeader{"content-type": {"application/grpc"}, "x-user": {"u1"}},
+	}
+	resp, err := ch.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-protobuf", resp.ContentType)
+	assert.Equal(t, []string{"test.Echo"}, resp.Header["echo-target"])
+	assert.Equal(t, []string{"done"}, resp.Header["echo-trailer"])
+	out := &wrapperspb.StringValue{}
+	assert.Nil(t, proto.Unmarshal(resp.Data, out))
+	assert.Equal(t, "hello@test.Echo", out.Value)
+
+	// the full method
+	req.Id = "echo"
+	req.Method = "/test.Echo/Echo"
+	resp, err = ch.Do(req)
+	assert.Nil(t, err)
+	assert.Nil(t, proto.Unmarshal(resp.Data, out))
+	assert.Equal(t, "hello@echo", out.Value)
+
+	// the service is the source of the request rewritten to another target
+	req.Id = "fallback"
+	req.Source = "test.Echo"
+	req.Method = "Echo"
+	resp, err = ch.Do(req)
+	assert.Nil(t, err)
+	assert.Nil(t, proto.Unmarshal(resp.Data, out))
+	assert.Equal(t, "hello@fallback", out.Value)
+	req.Method = "/test.Echo/Echo"
+
+	req.Data, _ = proto.Marshal(&wrapperspb.StringValue{Value: "invalid"})
+	_, err = ch.Do(req)
+	assert.Equal(t, common.InvalidArgsCode, err.(common.CommonError).Code())
+	req.Method = "/test.Echo/Missing"
+	_, err = ch.Do(req)
+	assert.Equal(t, common.InternalCode, err.(common.CommonError).Code())
+}
@@ -21,12 +21,14 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"mosn.io/pkg/buffer"
 
 	"github.com/valyala/fasthttp"
 	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/layotto/components/rpc"
 	_ "mosn.io/mosn/pkg/stream/http"
 )
@@ -61,11 +63,13 @@ func (h *hstate) close() {
 // httpChannel is Channel implement
 type httpChannel struct {
 	pool *connPool
+	// egress is nil if the requests aren't checked
+	egress *egress.Policy
 }
 
 // newHttpChannel is used to create rpc.Channel according to ChannelConfig
 func newHttpChannel(config ChannelConfig) (rpc.Channel, error) {
-	hc := &httpChannel{}
+	hc := &httpChannel{egress: config.Egress}
 	hc.pool = newConnPool(
 		config.Size,
 		// dialFunc
@@ -99,6 +103,18 @@ func newHttpChannel(config ChannelConfig) (rpc.Channel, error) {
 
 // Do is used to handle RPCRequest and return RPCResponse
 func (h *httpChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	// 0. check the egress policy, in which the host is the target.
+	// The port is decided by the listener of mosn, so it's unknown here and the port rules don't apply.
+	if h.egress != nil {
+		path := req.Method
+		if i := strings.IndexAny(path, "?#"); i >= 0 {
+			path = path[:i]
+		}
+		if err := h.egress.Allow(req.Id, 0, path); err != nil {
+			return nil, common.Error(common.PermissionDeniedCode, err.Error())
+		}
+	}
+
 	// 1. context.WithTimeout
 	timeout := time.Duration(req.Timeout) * time.Millisecond
 	ctx, cancel := context.WithTimeout(req.Ctx, timeout)
@@ -29,6 +29,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/layotto/components/rpc"
 )
 
@@ -85,6 +87,29 @@ func TestHttpChannel(t *testing.T) {
 	assert.Equal(t, "hello", string(resp.Data))
 }
 
+func TestHttpChannelEgress(t *testing.T) {
+	startTestHttpServer()
+
+	policy, err := egress.NewPolicy(&egress.Config{Allow: []*egress.Rule{{Host: "foo", Paths: []string{"/api/**"}}}})
+	assert.Nil(t, err)
+	channel, err := newHttpChannel(ChannelConfig{Size: 1, Egress: policy})
+	assert.Nil(t, err)
+
+	req := &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "/api/bar?a=b", Data: []byte("hello"), Timeout: 1000}
+	resp, err := channel.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(resp.Data))
+
+	for _, req := range []*rpc.RPCRequest{
+		{Ctx: context.TODO(), Id: "foo", Method: "/admin", Data: []byte("hello"), Timeout: 1000},
+		{Ctx: context.TODO(), Id: "foo", Method: "/api/../admin", Data: []byte("hello"), Timeout: 1000},
+		{Ctx: context.TODO(), Id: "other", Method: "/api/bar", Data: []byte("hello"), Timeout: 1000},
+	} {
+		_, err = channel.Do(req)
+		assert.Equal(t, common.PermissionDeniedCode, err.(common.CommonError).Code())
+	}
+}
+
 func TestRenewHttpConn(t *testing.T) {
 	startTestHttpServer()
 
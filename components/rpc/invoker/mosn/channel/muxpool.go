@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// muxConn is a conn shared by the concurrent requests, the writes are serialized by the lock
+type muxConn struct {
+	*wrapConn
+	wmu      sync.Mutex
+	created  time.Time
+	lastUsed int64
+	inflight int32
+	retired  int32
+}
+
+// write writes the packet, only one goroutine writes the conn at a time
+func (c *muxConn) write(b []byte, deadline time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := c.Write(b); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&c.lastUsed, time.Now().UnixNano())
+	return nil
+}
+
+// idle returns the duration since the last write
+func (c *muxConn) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastUsed)))
+}
+
+// release is called when a request finishes, the last request of the retired conn closes it
+func (c *muxConn) release() {
+	if atomic.AddInt32(&c.inflight, -1) == 0 && atomic.LoadInt32(&c.retired) == 1 {
+		c.close()
+	}
+}
+
+// retire stops sending new requests to the conn, and closes it after the in-flight requests finish
+func (c *muxConn) retire(drainTimeout time.Duration) {
+	if !atomic.CompareAndSwapInt32(&c.retired, 0, 1) {
+		return
+	}
+	if atomic.LoadInt32(&c.inflight) == 0 {
+		c.close()
+		return
+	}
+	// close it anyway if the in-flight requests don't finish in time
+	time.AfterFunc(drainTimeout, func() {
+		c.close()
+	})
+}
+
+// muxPool multiplexes the requests on a fixed number of conns instead of checking the conns out exclusively.
+// The conns older than maxAge are retired and drained gracefully, so that the updates of the listener
+// and the routers of mosn, e.g. the changes of the targets, are applied to the new conns.
+type muxPool struct {
+	dialer       *connPool
+	onDial       func(*muxConn)
+	maxAge       time.Duration
+	drainTimeout time.Duration
+
+	mu    sync.Mutex
+	next  uint32
+	conns []*muxConn
+}
+
+func newMuxPool(size int, dialer *connPool, maxAge time.Duration, drainTimeout time.Duration, onDial func(*muxConn)) *muxPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &muxPool{
+		dialer:       dialer,
+		onDial:       onDial,
+		maxAge:       maxAge,
+		drainTimeout: drainTimeout,
+		conns:        make([]*muxConn, size),
+	}
+}
+
+// Get returns a conn by round robin, the caller must release it after the request finishes
+func (p *muxPool) Get() (*muxConn, error) {
+	i := int(atomic.AddUint32(&p.next, 1) % uint32(len(p.conns)))
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.conns[i]
+	if c != nil && !c.isClose() && (p.maxAge <= 0 || now.Sub(c.created) < p.maxAge) {
+		atomic.AddInt32(&c.inflight, 1)
+		return c, nil
+	}
+	if c != nil {
+		p.conns[i] = nil
+		c.retire(p.drainTimeout)
+	}
+	wc, err := p.dialer.dial()
+	if err != nil {
+		return nil, err
+	}
+	c = &muxConn{wrapConn: wc, created: now, lastUsed: now.UnixNano(), inflight: 1}
+	p.conns[i] = c
+	if p.onDial != nil {
+		p.onDial(c)
+	}
+	return c, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMuxPool(size int, maxAge time.Duration, drainTimeout time.Duration) *muxPool {
+	dialer := newConnPool(
+		size,
+		func() (net.Conn, error) {
+			p, _ := net.Pipe()
+			return &fakeTcpConn{c: p}, nil
+		},
+		nil,
+		nil,
+		nil,
+	)
+	return newMuxPool(size, dialer, maxAge, drainTimeout, nil)
+}
+
+func TestMuxPoolGet(t *testing.T) {
+	p := newTestMuxPool(2, 0, time.Second)
+
+	c1, err := p.Get()
+	assert.Nil(t, err)
+	c2, err := p.Get()
+	assert.Nil(t, err)
+	assert.NotEqual(t, c1, c2)
+	// the conns are shared by round robin
+	c3, err := p.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, c1, c3)
+	assert.Equal(t, int32(2), c1.inflight)
+
+	c1.release()
+	c3.release()
+	c2.release()
+	assert.False(t, c1.isClose())
+	assert.False(t, c2.isClose())
+
+	// the closed conn is replaced
+	c1.close()
+	for i := 0; i < 2; i++ {
+		c, err := p.Get()
+		assert.Nil(t, err)
+		assert.NotEqual(t, c1, c)
+		assert.False(t, c.isClose())
+		c.release()
+	}
+}
+
+func TestMuxPoolDrain(t *testing.T) {
+	p := newTestMuxPool(1, 20*time.Millisecond, time.Second)
+
+	c1, err := p.Get()
+	assert.Nil(t, err)
+	time.Sleep(30 * time.Millisecond)
+
+	// the old conn is retired, and closed after the in-flight request finishes
+	c2, err := p.Get()
+	assert.Nil(t, err)
+	assert.NotEqual(t, c1, c2)
+	assert.False(t, c1.isClose())
+	c1.release()
+	assert.True(t, c1.isClose())
+	c2.release()
+	assert.False(t, c2.isClose())
+}
+
+func TestMuxPoolDrainTimeout(t *testing.T) {
+	p := newTestMuxPool(1, 20*time.Millisecond, 20*time.Millisecond)
+
+	c1, err := p.Get()
+	assert.Nil(t, err)
+	time.Sleep(30 * time.Millisecond)
+	c2, err := p.Get()
+	assert.Nil(t, err)
+	defer c2.release()
+
+	// the in-flight request doesn't finish in time
+	assert.False(t, c1.isClose())
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, c1.isClose())
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	common "mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/invoker/mosn/thrift"
+	_ "mosn.io/mosn/pkg/filter/network/tcpproxy"
+)
+
+const (
+	thriftFrameHeaderSize = 4
+	maxThriftFrameSize    = 16 * 1024 * 1024
+)
+
+// init is regist thrift channel
+func init() {
+	RegistChannel("thrift", newThriftChannel)
+}
+
+// thriftConfig is the ext of thrift ChannelConfig
+type thriftConfig struct {
+	// Protocol is binary or compact, the default value is binary
+	Protocol string `json:"protocol"`
+	// Service is the name of the multiplexed service, it's empty if the server isn't multiplexed
+	Service string `json:"service"`
+	// Methods are the signatures of the methods called with JSON data
+	Methods map[string]*thrift.MethodSpec `json:"methods"`
+}
+
+// tstate is record state
+type tstate struct {
+	seq   int32
+	mu    sync.Mutex
+	calls map[int32]chan tcall
+}
+
+type tcall struct {
+	msg []byte
+	err error
+}
+
+// thriftChannel is Channel implement, which sends framed Thrift messages to the listener of mosn,
+// e.g. a tcp proxy to the Thrift services
+type thriftChannel struct {
+	codec *thrift.Codec
+	pool  *connPool
+}
+
+// newThriftChannel is create rpc.Channel by ChannelConfig
+func newThriftChannel(config ChannelConfig) (rpc.Channel, error) {
+	var conf thriftConfig
+	if len(config.Ext) > 0 {
+		b, err := json.Marshal(config.Ext)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &conf); err != nil {
+			return nil, fmt.Errorf("invalid thrift config: %v", err)
+		}
+	}
+	codec, err := thrift.NewCodec(conf.Protocol, conf.Service, conf.Methods)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &thriftChannel{codec: codec}
+	m.pool = newConnPool(
+		config.Size,
+		// dialFunc
+		func() (net.Conn, error) {
+			local, remote := net.Pipe()
+			localTcpConn := &fakeTcpConn{c: local}
+			remoteTcpConn := &fakeTcpConn{c: remote}
+			if err := acceptFunc(remoteTcpConn, config.Listener); err != nil {
+				return nil, err
+			}
+			return localTcpConn, nil
+		},
+		// stateFunc
+		func() interface{} {
+			return &tstate{calls: map[int32]chan tcall{}}
+		},
+		m.onData,
+		m.cleanup,
+	)
+	return m, nil
+}
+
+// Do is handle RPCRequest to RPCResponse
+func (m *thriftChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	// 1. context.WithTimeout
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(req.Ctx, timeout)
+	defer cancel()
+
+	// 2. get fake connection with mosn
+	conn, err := m.pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tstate := conn.state.(*tstate)
+
+	// 3. encode request
+	seq := atomic.AddInt32(&tstate.seq, 1)
+	msg, err := m.codec.EncodeCall(req.Method, seq, req.Data)
+	if err != nil {
+		m.pool.Put(conn, false)
+		return nil, common.Error(common.InvalidArgsCode, err.Error())
+	}
+	buf := make([]byte, thriftFrameHeaderSize, thriftFrameHeaderSize+len(msg))
+	binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+	buf = append(buf, msg...)
+
+	// set timeout
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		m.pool.Put(conn, true)
+		return nil, common.Error(common.UnavailebleCode, err.Error())
+	}
+	oneway := m.codec.Oneway(req.Method)
+	callChan := make(chan tcall, 1)
+	if !oneway {
+		// register response channel
+		tstate.mu.Lock()
+		tstate.calls[seq] = callChan
+		tstate.mu.Unlock()
+	}
+
+	// write packet
+	if _, err := conn.Write(buf); err != nil {
+		m.removeCall(tstate, seq)
+		m.pool.Put(conn, true)
+		return nil, common.Error(common.UnavailebleCode, err.Error())
+	}
+	m.pool.Put(conn, false)
+	if oneway {
+		return &rpc.RPCResponse{Header: map[string][]string{}}, nil
+	}
+
+	// read response and decode it
+	select {
+	case res := <-callChan:
+		if res.err != nil {
+			return nil, common.Error(common.UnavailebleCode, res.err.Error())
+		}
+		return m.decode(req, res.msg)
+	case <-ctx.Done():
+		m.removeCall(tstate, seq)
+		return nil, common.Error(common.TimeoutCode, ErrTimeout.Error())
+	}
+}
+
+func (m *thriftChannel) decode(req *rpc.RPCRequest, msg []byte) (*rpc.RPCResponse, error) {
+	data, err := m.codec.DecodeReply(req.Method, msg)
+	if err != nil {
+		return nil, common.Error(common.InternalCode, err.Error())
+	}
+	resp := &rpc.RPCResponse{Header: map[string][]string{}, Data: data}
+	if m.codec.HasSignature(req.Method) {
+		resp.ContentType = "application/json"
+	} else {
+		resp.ContentType = "application/x-thrift"
+	}
+	return resp, nil
+}
+
+// removeCall is delete tstate.calls by seq
+func (m *thriftChannel) removeCall(tstate *tstate, seq int32) {
+	tstate.mu.Lock()
+	delete(tstate.calls, seq)
+	tstate.mu.Unlock()
+}
+
+// onData splits the frames and notifies the calls by the sequence ids
+func (m *thriftChannel) onData(conn *wrapConn) error {
+	tstate := conn.state.(*tstate)
+	for conn.buf.Len() >= thriftFrameHeaderSize {
+		size := binary.BigEndian.Uint32(conn.buf.Bytes())
+		if size > maxThriftFrameSize {
+			return fmt.Errorf("[runtime][rpc]thrift frame too large: %d", size)
+		}
+		if conn.buf.Len() < thriftFrameHeaderSize+int(size) {
+			break
+		}
+		msg := make([]byte, size)
+		copy(msg, conn.buf.Bytes()[thriftFrameHeaderSize:])
+		conn.buf.Drain(thriftFrameHeaderSize + int(size))
+
+		seq, err := m.codec.SeqID(msg)
+		if err != nil {
+			return err
+		}
+		tstate.mu.Lock()
+		notifyChan, ok := tstate.calls[seq]
+		if ok {
+			delete(tstate.calls, seq)
+		}
+		tstate.mu.Unlock()
+		if ok {
+			notifyChan <- tcall{msg: msg}
+		}
+	}
+	return nil
+}
+
+// cleanup is clean all tstate.calls
+func (m *thriftChannel) cleanup(c *wrapConn, err error) {
+	tstate := c.state.(*tstate)
+	// cleanup pending calls
+	tstate.mu.Lock()
+	for seq, notifyChan := range tstate.calls {
+		notifyChan <- tcall{err: err}
+		delete(tstate.calls, seq)
+	}
+	tstate.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package channel
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+)
+
+// startThriftEchoServer replies the binary messages with their arguments, which are the results of field 0
+func startThriftEchoServer() {
+	acceptFunc = func(conn net.Conn, listener string) error {
+		go func() {
+			defer conn.Close()
+			for {
+				header := make([]byte, thriftFrameHeaderSize)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				frame := make([]byte, binary.BigEndian.Uint32(header))
+				if _, err := io.ReadFull(conn, frame); err != nil {
+					return
+				}
+				// oneway
+				if frame[3] == 4 {
+					continue
+				}
+				// call -> reply
+				frame[3] = 2
+				if _, err := conn.Write(append(header, frame...)); err != nil {
+					return
+				}
+			}
+		}()
+		return nil
+	}
+}
+
+func newThriftTestChannel(t *testing.T) rpc.Channel {
+	config := ChannelConfig{Size: 1, Protocol: "thrift", Ext: map[string]interface{}{
+		"protocol": "binary",
+		"methods": map[string]interface{}{
+			"echo": map[string]interface{}{
+				"args":   []interface{}{map[string]interface{}{"id": 0, "name": "message", "type": "string"}},
+				"result": map[string]interface{}{"type": "string"},
+			},
+			"notify": map[string]interface{}{
+				"args":   []interface{}{map[string]interface{}{"id": 1, "name": "event", "type": "string"}},
+				"oneway": true,
+			},
+		},
+	}}
+	channel, err := GetChannel(config)
+	assert.Nil(t, err)
+	return channel
+}
+
+func TestThriftChannel(t *testing.T) {
+	startThriftEchoServer()
+	channel := newThriftTestChannel(t)
+
+	req := &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "echo", Data: []byte(`{"message": "hello"}`), Timeout: 1000}
+	resp, err := channel.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, `"hello"`, string(resp.Data))
+	assert.Equal(t, "application/json", resp.ContentType)
+
+	req = &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "notify", Data: []byte(`{"event": "hello"}`), Timeout: 1000}
+	_, err = channel.Do(req)
+	assert.Nil(t, err)
+
+	// the arguments mismatch the signature
+	req = &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "echo", Data: []byte(`{"message": 1}`), Timeout: 1000}
+	_, err = channel.Do(req)
+	assert.NotNil(t, err)
+}
+
+func TestThriftChannelInvalidConfig(t *testing.T) {
+	_, err := GetChannel(ChannelConfig{Size: 1, Protocol: "thrift", Ext: map[string]interface{}{"protocol": "json"}})
+	assert.NotNil(t, err)
+	_, err = GetChannel(ChannelConfig{Size: 1, Protocol: "thrift", Ext: map[string]interface{}{
+		"methods": map[string]interface{}{"echo": map[string]interface{}{"result": map[string]interface{}{"type": "any"}}},
+	}})
+	assert.True(t, strings.Contains(err.Error(), "echo"))
+}
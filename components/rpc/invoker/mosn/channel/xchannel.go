@@ -18,6 +18,7 @@ package channel
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -29,6 +30,13 @@ import (
 	common "mosn.io/layotto/components/pkg/common"
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/rpc/invoker/mosn/transport_protocol"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	defaultHeartbeatTimeout = 3 * time.Second
+	defaultDrainTimeout     = 30 * time.Second
 )
 
 // init is regist bolt、boltv2、dubbo channel
@@ -48,7 +56,18 @@ func newXChannel(config ChannelConfig) (rpc.Channel, error) {
 		return nil, err
 	}
 
-	m := &xChannel{proto: proto}
+	var opts xOptions
+	if len(config.Ext) > 0 {
+		b, err := json.Marshal(config.Ext)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &opts); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %v", config.Protocol, err)
+		}
+	}
+
+	m := &xChannel{proto: proto, opts: opts}
 	m.pool = newConnPool(
 		config.Size,
 		// dialFunc
@@ -68,10 +87,31 @@ func newXChannel(config ChannelConfig) (rpc.Channel, error) {
 		m.onData,
 		m.cleanup,
 	)
+	if opts.Multiplex {
+		drainTimeout := defaultDrainTimeout
+		if opts.DrainTimeoutMs > 0 {
+			drainTimeout = time.Duration(opts.DrainTimeoutMs) * time.Millisecond
+		}
+		m.mux = newMuxPool(config.Size, m.pool, time.Duration(opts.ConnMaxAgeMs)*time.Millisecond, drainTimeout, m.startHeartbeat)
+	}
 
 	return m, nil
 }
 
+// xOptions are the options in the ext of ChannelConfig besides the ones of the protocol
+type xOptions struct {
+	// Multiplex shares the conns among the concurrent requests, the number of conns is the size of the channel
+	Multiplex bool `json:"multiplex"`
+	// HeartbeatIntervalMs enables the heartbeats of the multiplexed conns idle for the interval
+	HeartbeatIntervalMs int `json:"heartbeat_interval_ms"`
+	// HeartbeatTimeoutMs is the timeout of heartbeats, the conn is closed if the heartbeat fails
+	HeartbeatTimeoutMs int `json:"heartbeat_timeout_ms"`
+	// ConnMaxAgeMs retires the multiplexed conns after the age if it's positive
+	ConnMaxAgeMs int `json:"conn_max_age_ms"`
+	// DrainTimeoutMs is the max time waiting for the in-flight requests of the retired conns
+	DrainTimeoutMs int `json:"drain_timeout_ms"`
+}
+
 // xstate is record state
 type xstate struct {
 	reqid uint32
@@ -87,7 +127,10 @@ type call struct {
 // xChannel is Channel implement
 type xChannel struct {
 	proto transport_protocol.TransportProtocol
+	opts  xOptions
 	pool  *connPool
+	// mux is nil if the conns aren't multiplexed
+	mux *muxPool
 }
 
 // Do is handle RPCRequest to RPCResponse
@@ -96,6 +139,9 @@ func (m *xChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
 	timeout := time.Duration(req.Timeout) * time.Millisecond
 	ctx, cancel := context.WithTimeout(req.Ctx, timeout)
 	defer cancel()
+	if m.mux != nil {
+		return m.doMux(ctx, req)
+	}
 
 	// 2. get fake connection with mosn
 	conn, err := m.pool.Get(ctx)
@@ -136,6 +182,41 @@ func (m *xChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
 	m.pool.Put(conn, false)
 
 	// read response and decode it
+	return m.wait(ctx, xstate, id, callChan)
+}
+
+// doMux sends the request on a multiplexed conn
+func (m *xChannel) doMux(ctx context.Context, req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	conn, err := m.mux.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.release()
+	xstate := conn.state.(*xstate)
+
+	frame := m.proto.ToFrame(req)
+	id := atomic.AddUint32(&xstate.reqid, 1)
+	frame.SetRequestId(uint64(id))
+	buf, encErr := m.proto.Encode(req.Ctx, frame)
+	if encErr != nil {
+		return nil, common.Error(common.InternalCode, encErr.Error())
+	}
+
+	callChan := make(chan call, 1)
+	xstate.mu.Lock()
+	xstate.calls[id] = callChan
+	xstate.mu.Unlock()
+	deadline, _ := ctx.Deadline()
+	if err := conn.write(buf.Bytes(), deadline); err != nil {
+		m.removeCall(xstate, id)
+		conn.close()
+		return nil, common.Error(common.UnavailebleCode, err.Error())
+	}
+	return m.wait(ctx, xstate, id, callChan)
+}
+
+// wait waits for the response of the call
+func (m *xChannel) wait(ctx context.Context, xstate *xstate, id uint32, callChan chan call) (*rpc.RPCResponse, error) {
 	select {
 	case res := <-callChan:
 		if res.err != nil {
@@ -148,6 +229,67 @@ func (m *xChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
 	}
 }
 
+// startHeartbeat sends heartbeats on the conn when it's idle, and closes it if the heartbeat fails,
+// so that the broken conns are found before the requests, and the idle conns aren't closed by mosn.
+func (m *xChannel) startHeartbeat(conn *muxConn) {
+	if m.opts.HeartbeatIntervalMs <= 0 {
+		return
+	}
+	interval := time.Duration(m.opts.HeartbeatIntervalMs) * time.Millisecond
+	timeout := defaultHeartbeatTimeout
+	if m.opts.HeartbeatTimeoutMs > 0 {
+		timeout = time.Duration(m.opts.HeartbeatTimeoutMs) * time.Millisecond
+	}
+	utils.GoWithRecover(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if conn.isClose() || atomic.LoadInt32(&conn.retired) == 1 {
+				return
+			}
+			if conn.idle(time.Now()) < interval {
+				continue
+			}
+			if err := m.heartbeat(conn, timeout); err != nil {
+				log.DefaultLogger.Warnf("[runtime][rpc]heartbeat error, close the conn: %s", err.Error())
+				conn.close()
+				return
+			}
+		}
+	}, nil)
+}
+
+func (m *xChannel) heartbeat(conn *muxConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	xstate := conn.state.(*xstate)
+	id := atomic.AddUint32(&xstate.reqid, 1)
+	frame := m.proto.Trigger(ctx, uint64(id))
+	if frame == nil {
+		return nil
+	}
+	buf, err := m.proto.Encode(ctx, frame)
+	if err != nil {
+		return err
+	}
+	callChan := make(chan call, 1)
+	xstate.mu.Lock()
+	xstate.calls[id] = callChan
+	xstate.mu.Unlock()
+	deadline, _ := ctx.Deadline()
+	if err := conn.write(buf.Bytes(), deadline); err != nil {
+		m.removeCall(xstate, id)
+		return err
+	}
+	select {
+	case res := <-callChan:
+		return res.err
+	case <-ctx.Done():
+		m.removeCall(xstate, id)
+		return ErrTimeout
+	}
+}
+
 // removeCall is delete xstate.calls by id
 func (m *xChannel) removeCall(xstate *xstate, id uint32) {
 	xstate.mu.Lock()
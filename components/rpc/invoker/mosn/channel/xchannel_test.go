@@ -309,3 +309,41 @@ func TestReadloopError(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(resp.Data), "ok")
 }
+
+func TestMultiplexChannel(t *testing.T) {
+	startTestServer()
+
+	config := ChannelConfig{Size: 2, Protocol: proto, Ext: map[string]interface{}{
+		"class":                 "xxx",
+		"multiplex":             true,
+		"heartbeat_interval_ms": 10,
+	}}
+	channel, err := newXChannel(config)
+	assert.Nil(t, err)
+	mux := channel.(*xChannel).mux
+	assert.NotNil(t, mux)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := "echo" + strconv.Itoa(i)
+			req := &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "bar", Data: []byte(data), Timeout: 1000}
+			resp, err := channel.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, data, string(resp.Data))
+		}(i)
+	}
+	wg.Wait()
+
+	// the idle conns survive the heartbeats
+	time.Sleep(50 * time.Millisecond)
+	for _, c := range mux.conns {
+		assert.False(t, c.isClose())
+	}
+	req := &rpc.RPCRequest{Ctx: context.TODO(), Id: "foo", Method: "bar", Data: []byte("hello world"), Timeout: 1000}
+	resp, err := channel.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", string(resp.Data))
+}
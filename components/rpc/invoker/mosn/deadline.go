@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"strconv"
+	"time"
+
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+)
+
+// TimeoutBudgetHeader carries the remaining timeout in milliseconds of the caller across the sidecars.
+// The sidecar sets it on the requests sent, and the apps forward it to their sidecars when they invoke further,
+// so that the downstream services shrink their timeouts instead of working after the caller has timed out.
+const TimeoutBudgetHeader = "rpc-timeout-budget"
+
+// applyTimeoutBudget shrinks the timeout of the request to the deadline of the context and the budget header,
+// and sets the header to the timeout. It returns false if the budget is exhausted.
+func applyTimeoutBudget(req *rpc.RPCRequest, now time.Time) bool {
+	budget := time.Duration(req.Timeout) * time.Millisecond
+	if deadline, ok := req.Ctx.Deadline(); ok {
+		if remaining := deadline.Sub(now); remaining < budget {
+			budget = remaining
+		}
+	}
+	if v := req.Header.Get(TimeoutBudgetHeader); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 32); err == nil {
+			if remaining := time.Duration(ms) * time.Millisecond; remaining < budget {
+				budget = remaining
+			}
+		}
+	}
+	timeout := budget / time.Millisecond
+	if timeout <= 0 {
+		return false
+	}
+	req.Timeout = int32(timeout)
+	if req.Header == nil {
+		req.Header = rpc.RPCHeader{}
+	}
+	req.Header[TimeoutBudgetHeader] = []string{strconv.Itoa(int(timeout))}
+	return true
+}
+
+func errTimeoutBudgetExhausted(req *rpc.RPCRequest) error {
+	return common.Errorf(common.TimeoutCode, "timeout budget of %s.%s is exhausted", req.Id, req.Method)
+}
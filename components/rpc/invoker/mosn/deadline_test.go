@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+func TestApplyTimeoutBudget(t *testing.T) {
+	now := time.Now()
+
+	// the timeout of the request
+	req := &rpc.RPCRequest{Ctx: context.Background(), Timeout: 3000}
+	assert.True(t, applyTimeoutBudget(req, now))
+	assert.Equal(t, int32(3000), req.Timeout)
+	assert.Equal(t, "3000", req.Header.Get(TimeoutBudgetHeader))
+
+	// the deadline of the context
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(time.Second))
+	defer cancel()
+	req = &rpc.RPCRequest{Ctx: ctx, Timeout: 3000}
+	assert.True(t, applyTimeoutBudget(req, now))
+	assert.Equal(t, int32(1000), req.Timeout)
+
+	// the budget of the upstream
+	req = &rpc.RPCRequest{Ctx: ctx, Timeout: 3000, Header: rpc.RPCHeader{TimeoutBudgetHeader: {"500"}}}
+	assert.True(t, applyTimeoutBudget(req, now))
+	assert.Equal(t, int32(500), req.Timeout)
+	assert.Equal(t, "500", req.Header.Get(TimeoutBudgetHeader))
+
+	// the invalid header is ignored
+	req = &rpc.RPCRequest{Ctx: ctx, Timeout: 3000, Header: rpc.RPCHeader{TimeoutBudgetHeader: {"abc"}}}
+	assert.True(t, applyTimeoutBudget(req, now))
+	assert.Equal(t, int32(1000), req.Timeout)
+
+	// exhausted
+	req = &rpc.RPCRequest{Ctx: ctx, Timeout: 3000}
+	assert.False(t, applyTimeoutBudget(req, now.Add(time.Second)))
+	req = &rpc.RPCRequest{Ctx: context.Background(), Timeout: 3000, Header: rpc.RPCHeader{TimeoutBudgetHeader: {"0"}}}
+	assert.False(t, applyTimeoutBudget(req, now))
+}
+
+func TestInvokeTimeoutBudgetExhausted(t *testing.T) {
+	ch := &recordChannel{}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback()}
+	req := &rpc.RPCRequest{Id: "svc", Method: "Get", Header: rpc.RPCHeader{TimeoutBudgetHeader: {"0"}}}
+	_, err := invoker.Invoke(context.Background(), req)
+	assert.NotNil(t, err)
+	assert.Equal(t, common.TimeoutCode, err.(common.CommonError).Code())
+	assert.Equal(t, 0, ch.count("svc"))
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is a subset of JSON schema, which validates the types, the required properties, the enums,
+// the ranges and the lengths of the values. The other keywords are ignored.
+type jsonSchema struct {
+	Type                 jsonTypes              `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Pattern              string                 `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// jsonTypes is the "type" keyword, which is a type or a list of types
+type jsonTypes []string
+
+func (t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type should be a string or a list of strings: %s", data)
+	}
+	*t = list
+	return nil
+}
+
+func parseJSONSchema(data []byte) (*jsonSchema, error) {
+	s := &jsonSchema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = p
+	}
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// validate validates the JSON document
+func (s *jsonSchema) validate(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+	return s.validateValue("$", v)
+}
+
+func (s *jsonSchema) validateValue(path string, v interface{}) error {
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		return fmt.Errorf("%s should be %s", path, strings.Join(s.Type, " or "))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s should be one of %v", path, s.Enum)
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return s.validateObject(path, value)
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return fmt.Errorf("%s should have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return fmt.Errorf("%s should have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				if err := s.Items.validateValue(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		n := len([]rune(value))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s should have at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s should have at most %d characters", path, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fmt.Errorf("%s should match %s", path, s.Pattern)
+		}
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return fmt.Errorf("%s is an invalid number: %v", path, err)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fmt.Errorf("%s should be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fmt.Errorf("%s should be at most %v", path, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateObject(path string, value map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := value[name]; !ok {
+			return fmt.Errorf("%s.%s is required", path, name)
+		}
+	}
+	// validate in order, so that the same error is reported for the same document
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return fmt.Errorf("%s.%s is not allowed", path, name)
+			}
+			continue
+		}
+		if err := p.validateValue(path+"."+name, value[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) matchesType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if _, err := value.Int64(); err == nil && t == "integer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) inEnum(v interface{}) bool {
+	for _, e := range s.Enum {
+		if n, ok := v.(json.Number); ok {
+			if f, err := n.Float64(); err == nil && reflect.DeepEqual(f, e) {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s, err := parseJSONSchema([]byte(`{
+		"type": "object",
+		"required": ["id", "items"],
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "string", "pattern": "^o[0-9]+$"},
+			"note": {"type": ["string", "null"], "maxLength": 4},
+			"status": {"enum": ["new", "paid", 1]},
+			"items": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"properties": {"count": {"type": "integer", "minimum": 1, "maximum": 10}}
+				}
+			}
+		}
+	}`))
+	assert.Nil(t, err)
+	assert.Nil(t, s.validate([]byte(`{"id": "o1", "note": null, "status": 1, "items": [{"count": 2}]}`)))
+	for doc, msg := range map[string]string{
+		`[]`:                         "$ should be object",
+		`{"id": "o1"}`:               "$.items is required",
+		`{"id": "x", "items": [{}]}`: "$.id should match ^o[0-9]+$",
+		`{"id": "o1", "items": []}`:  "$.items should have at least 1 items",
+		`{"id": "o1", "items": [{"count": 1.5}]}`:       "$.items[0].count should be integer",
+		`{"id": "o1", "items": [{"count": 11}]}`:        "$.items[0].count should be at most 10",
+		`{"id": "o1", "items": [{}], "note": "hello"}`:  "$.note should have at most 4 characters",
+		`{"id": "o1", "items": [{}], "status": "done"}`: "$.status should be one of [new paid 1]",
+		`{"id": "o1", "items": [{}], "price": 1}`:       "$.price is not allowed",
+	} {
+		err := s.validate([]byte(doc))
+		if assert.NotNil(t, err, doc) {
+			assert.Equal(t, msg, err.Error(), doc)
+		}
+	}
+	assert.NotNil(t, s.validate([]byte(`{`)))
+
+	_, err = parseJSONSchema([]byte(`{"type": "decimal"}`))
+	assert.NotNil(t, err)
+	_, err = parseJSONSchema([]byte(`{"properties": {"id": {"pattern": "("}}}`))
+	assert.NotNil(t, err)
+}
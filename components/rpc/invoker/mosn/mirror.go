@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/pkg/log"
+)
+
+const defaultMirrorMaxInFlight = 100
+
+// MirrorRule mirrors a percentage of the requests to the source to the target, e.g. a new version in a dark launch.
+// The mirrored requests are fire-and-forget, and their responses are discarded.
+type MirrorRule struct {
+	// Source is the id of InvokeService whose requests are mirrored
+	Source string `json:"source"`
+	// Target is the id which the copies are sent to
+	Target string `json:"target"`
+	// Percentage is the percentage of the requests mirrored, 0 ~ 100
+	Percentage float64 `json:"percentage"`
+	// Methods are the methods mirrored, all the methods are mirrored if it's empty
+	Methods []string `json:"methods"`
+}
+
+// mirrors holds the mirror rules, the requests exceeding maxInFlight are not mirrored to protect the sidecar
+type mirrors struct {
+	rules       map[string][]*MirrorRule
+	maxInFlight int32
+	inFlight    int32
+	random      func() float64
+}
+
+func newMirrors(rules []*MirrorRule, maxInFlight int) (*mirrors, error) {
+	m := &mirrors{
+		rules:       make(map[string][]*MirrorRule),
+		maxInFlight: defaultMirrorMaxInFlight,
+		random:      rand.Float64,
+	}
+	if maxInFlight > 0 {
+		m.maxInFlight = int32(maxInFlight)
+	}
+	for _, r := range rules {
+		if r.Source == "" || r.Target == "" {
+			return nil, fmt.Errorf("source and target of mirror rule are required")
+		}
+		if r.Percentage < 0 || r.Percentage > 100 {
+			return nil, fmt.Errorf("percentage of mirror rule %s -> %s should be 0 ~ 100: %v", r.Source, r.Target, r.Percentage)
+		}
+		m.rules[r.Source] = append(m.rules[r.Source], r)
+	}
+	return m, nil
+}
+
+// targets returns the targets which the request is mirrored to
+func (m *mirrors) targets(req *rpc.RPCRequest) []string {
+	var targets []string
+	for _, r := range m.rules[req.Id] {
+		if !r.matchMethod(req.Method) {
+			continue
+		}
+		if m.random()*100 < r.Percentage {
+			targets = append(targets, r.Target)
+		}
+	}
+	return targets
+}
+
+func (r *MirrorRule) matchMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// mirror sends the copies of the request to the targets in background.
+// The request is copied before the callbacks, since they may depend on the id, e.g. dubbo_json_rpc.
+func (m *mosnInvoker) mirror(req *rpc.RPCRequest) {
+	if m.mirrors == nil {
+		return
+	}
+	for _, target := range m.mirrors.targets(req) {
+		if atomic.AddInt32(&m.mirrors.inFlight, 1) > m.mirrors.maxInFlight {
+			atomic.AddInt32(&m.mirrors.inFlight, -1)
+			log.DefaultLogger.Debugf("[runtime][rpc]too many mirrored requests, skip mirroring %s to %s", req.Id, target)
+			continue
+		}
+		r := cloneRequest(req)
+		r.Id = target
+		// the mirrored request isn't canceled with the original one
+		r.Ctx = context.Background()
+		go func() {
+			defer func() {
+				atomic.AddInt32(&m.mirrors.inFlight, -1)
+				if e := recover(); e != nil {
+					log.DefaultLogger.Errorf("[runtime][rpc]mirror request to %s panic: %v", r.Id, e)
+				}
+			}()
+			r, err := m.cb.BeforeInvoke(r)
+			if err == nil {
+				_, err = m.do(r)
+			}
+			if err != nil {
+				log.DefaultLogger.Debugf("[runtime][rpc]mirror request to %s error: %s", r.Id, err.Error())
+			}
+		}()
+	}
+}
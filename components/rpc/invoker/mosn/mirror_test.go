@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+// recordChannel records the ids of the requests, and blocks until it's released
+type recordChannel struct {
+	mu      sync.Mutex
+	ids     []string
+	release chan struct{}
+}
+
+func (c *recordChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	c.mu.Lock()
+	c.ids = append(c.ids, req.Id)
+	c.mu.Unlock()
+	if req.Id != "svc" && c.release != nil {
+		<-c.release
+	}
+	return &rpc.RPCResponse{}, nil
+}
+
+func (c *recordChannel) count(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, i := range c.ids {
+		if i == id {
+			n++
+		}
+	}
+	return n
+}
+
+func TestNewMirrors(t *testing.T) {
+	_, err := newMirrors([]*MirrorRule{{Source: "svc"}}, 0)
+	assert.NotNil(t, err)
+	_, err = newMirrors([]*MirrorRule{{Source: "svc", Target: "v2", Percentage: 101}}, 0)
+	assert.NotNil(t, err)
+	m, err := newMirrors([]*MirrorRule{{Source: "svc", Target: "v2", Percentage: 50}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(defaultMirrorMaxInFlight), m.maxInFlight)
+}
+
+func TestMirror(t *testing.T) {
+	m, err := newMirrors([]*MirrorRule{
+		{Source: "svc", Target: "v2", Percentage: 50},
+		{Source: "svc", Target: "shadow", Percentage: 100, Methods: []string{"Get"}},
+	}, 0)
+	assert.Nil(t, err)
+	draw := 0.3
+	m.random = func() float64 { return draw }
+	ch := &recordChannel{}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), mirrors: m}
+
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return ch.count("v2") == 1 && ch.count("shadow") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// not sampled, and the method doesn't match
+	draw = 0.6
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Put"})
+	assert.Nil(t, err)
+	// the request to another target isn't mirrored
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "other", Method: "Get"})
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, ch.count("svc"))
+	assert.Equal(t, 1, ch.count("v2"))
+	assert.Equal(t, 1, ch.count("shadow"))
+}
+
+func TestMirrorMaxInFlight(t *testing.T) {
+	m, err := newMirrors([]*MirrorRule{{Source: "svc", Target: "v2", Percentage: 100}}, 1)
+	assert.Nil(t, err)
+	ch := &recordChannel{release: make(chan struct{})}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), mirrors: m}
+
+	// the original requests don't wait for the mirrored ones
+	for i := 0; i < 3; i++ {
+		_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 3, ch.count("svc"))
+	assert.Eventually(t, func() bool { return ch.count("v2") == 1 }, time.Second, 10*time.Millisecond)
+	close(ch.release)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, ch.count("v2"))
+}
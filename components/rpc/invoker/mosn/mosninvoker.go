@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/rpc/callback"
@@ -35,8 +36,22 @@ const (
 
 // mosnInvoker is Invoker implement
 type mosnInvoker struct {
-	channel rpc.Channel
-	cb      rpc.Callback
+	// channel is the default channel, and channels are the ones of the targets configured
+	channel  rpc.Channel
+	channels map[string]rpc.Channel
+	cb       rpc.Callback
+	// retry is the retry policies by the targets
+	retry map[string]*RetryPolicy
+	// breakers is nil if the circuit breaker isn't configured
+	breakers *circuitBreakers
+	// mirrors is nil if no request is mirrored
+	mirrors *mirrors
+	// routes is nil if no request is routed
+	routes *routes
+	// resolvers is nil if the targets are resolved by the registry only
+	resolvers *resolvers
+	// payloads is nil if no payload schema is registered
+	payloads *payloadSchemas
 }
 
 // mosnConfig is mosn config
@@ -44,6 +59,20 @@ type mosnConfig struct {
 	Before  []rpc.CallbackFunc      `json:"before_invoke"`
 	After   []rpc.CallbackFunc      `json:"after_invoke"`
 	Channel []channel.ChannelConfig `json:"channel"`
+	// Retry is the retry policies by the targets, "*" is the default policy
+	Retry map[string]*RetryPolicy `json:"retry"`
+	// CircuitBreaker ejects the unhealthy targets for a while if it's not nil
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker"`
+	// Mirror is the rules of mirroring requests to other targets
+	Mirror []*MirrorRule `json:"mirror"`
+	// Routes are the rules of routing requests to other targets, e.g. canary versions
+	Routes []*RouteRule `json:"routes"`
+	// MirrorMaxInFlight is the max number of mirrored requests in flight, the default value is 100
+	MirrorMaxInFlight int `json:"mirror_max_in_flight"`
+	// Resolver resolves the targets by DNS or the static endpoints if the registry is degraded
+	Resolver *ResolverConfig `json:"resolver"`
+	// PayloadSchemas validate and transcode the payloads of the methods of the targets
+	PayloadSchemas []*PayloadSchemaConfig `json:"payload_schemas"`
 }
 
 // NewMosnInvoker is init mosnInvoker
@@ -71,12 +100,69 @@ func (m *mosnInvoker) Init(conf rpc.RpcConfig) error {
 		return errors.New("missing channel config")
 	}
 
-	// todo support multiple channel
-	channel, err := channel.GetChannel(config.Channel[0])
+	for i := range config.Channel {
+		config.Channel[i].Egress = conf.Egress
+	}
+	// the first channel is the default one, and the others serve their targets
+	var err error
+	m.channel, err = channel.GetChannel(config.Channel[0])
 	if err != nil {
 		return err
 	}
-	m.channel = channel
+	protocols := make(map[string]string)
+	for _, c := range config.Channel[1:] {
+		if len(c.Targets) == 0 {
+			return fmt.Errorf("targets of channel %s are required", c.Protocol)
+		}
+		ch, err := channel.GetChannel(c)
+		if err != nil {
+			return err
+		}
+		if m.channels == nil {
+			m.channels = make(map[string]rpc.Channel)
+		}
+		for _, target := range c.Targets {
+			if _, ok := m.channels[target]; ok {
+				return fmt.Errorf("target %s is served by several channels", target)
+			}
+			m.channels[target] = ch
+			protocols[target] = c.Protocol
+		}
+	}
+	m.retry = config.Retry
+	if config.CircuitBreaker != nil {
+		m.breakers = newCircuitBreakers(config.CircuitBreaker)
+	}
+	if len(config.Routes) > 0 {
+		if m.routes, err = newRoutes(config.Routes); err != nil {
+			return err
+		}
+	}
+	if config.Resolver != nil {
+		if m.resolvers, err = newResolvers(config.Resolver); err != nil {
+			return err
+		}
+	}
+	if len(config.PayloadSchemas) > 0 {
+		// the targets of grpc channels accept protobuf only
+		for _, s := range config.PayloadSchemas {
+			protocol, ok := protocols[s.Id]
+			if !ok {
+				protocol = config.Channel[0].Protocol
+			}
+			if protocol == channel.GrpcProtocol && s.TargetFormat == "" && s.RequestType != "" && s.ResponseType != "" {
+				s.TargetFormat = PayloadFormatProtobuf
+			}
+		}
+		if m.payloads, err = newPayloadSchemas(config.PayloadSchemas); err != nil {
+			return err
+		}
+	}
+	if len(config.Mirror) > 0 {
+		if m.mirrors, err = newMirrors(config.Mirror, config.MirrorMaxInFlight); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -95,6 +181,20 @@ func (m *mosnInvoker) Invoke(ctx context.Context, req *rpc.RPCRequest) (resp *rp
 	}
 	req.Ctx = ctx
 	log.DefaultLogger.Debugf("[runtime][rpc]request %+v", req)
+	// the payloads are checked by the schemas of the target before it's routed
+	payload, err := m.checkPayload(req)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime][rpc]error %s", err.Error())
+		return nil, err
+	}
+	// the policies below apply to the routed target
+	m.route(req)
+	if !applyTimeoutBudget(req, time.Now()) {
+		err = errTimeoutBudgetExhausted(req)
+		log.DefaultLogger.Errorf("[runtime][rpc]error %s", err.Error())
+		return nil, err
+	}
+	m.mirror(req)
 	// 2. beforeInvoke callback
 	req, err = m.cb.BeforeInvoke(req)
 	if err != nil {
@@ -102,12 +202,22 @@ func (m *mosnInvoker) Invoke(ctx context.Context, req *rpc.RPCRequest) (resp *rp
 		return nil, err
 	}
 	// 3. do invocation
-	resp, err = m.channel.Do(req)
+	if p := m.retryPolicy(req); p != nil {
+		resp, err = m.doWithRetry(req, p)
+	} else {
+		resp, err = m.do(req)
+	}
 	if err != nil {
 		log.DefaultLogger.Errorf("[runtime][rpc]error %s", err.Error())
 		return nil, err
 	}
 	resp.Ctx = req.Ctx
+	if payload != nil {
+		if err = payload.checkResponse(resp); err != nil {
+			log.DefaultLogger.Errorf("[runtime][rpc]error %s", err.Error())
+			return nil, err
+		}
+	}
 	// 4. afterInvoke callback
 	resp, err = m.cb.AfterInvoke(resp)
 	if err != nil {
@@ -115,3 +225,11 @@ func (m *mosnInvoker) Invoke(ctx context.Context, req *rpc.RPCRequest) (resp *rp
 	}
 	return resp, err
 }
+
+// channelOf returns the channel of the target
+func (m *mosnInvoker) channelOf(target string) rpc.Channel {
+	if c, ok := m.channels[target]; ok {
+		return c
+	}
+	return m.channel
+}
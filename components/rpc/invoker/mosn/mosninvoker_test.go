@@ -68,6 +68,42 @@ func Test_mosnInvoker_Init(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("multiple channels", func(t *testing.T) {
+		channels := map[string]rpc.Channel{}
+		for _, protocol := range []string{"fake-default", "fake-grpc"} {
+			ch := &recordChannel{}
+			channels[protocol] = ch
+			channel.RegistChannel(protocol, func(config channel.ChannelConfig) (rpc.Channel, error) {
+				return ch, nil
+			})
+		}
+		invoker := NewMosnInvoker()
+		err := invoker.Init(rpc.RpcConfig{Config: []byte(`{"channel": [{"protocol":"fake-default"}, {"protocol":"fake-grpc"}]}`)})
+		assert.Equal(t, "targets of channel fake-grpc are required", err.Error())
+		err = invoker.Init(rpc.RpcConfig{Config: []byte(`{"channel": [{"protocol":"fake-default"}, {"protocol":"fake-grpc", "targets": ["a"]}, {"protocol":"fake-grpc", "targets": ["a"]}]}`)})
+		assert.Equal(t, "target a is served by several channels", err.Error())
+
+		invoker = NewMosnInvoker()
+		err = invoker.Init(rpc.RpcConfig{Config: []byte(`{"channel": [{"protocol":"fake-default"}, {"protocol":"fake-grpc", "targets": ["shop.v1.OrderService"]}]}`)})
+		assert.Nil(t, err)
+		m := invoker.(*mosnInvoker)
+		assert.Equal(t, channels["fake-grpc"], m.channelOf("shop.v1.OrderService"))
+		assert.Equal(t, channels["fake-default"], m.channelOf("other"))
+	})
+
+	t.Run("grpc targets", func(t *testing.T) {
+		invoker := NewMosnInvoker()
+		err := invoker.Init(rpc.RpcConfig{Config: []byte(`{
+			"channel": [{"protocol":"fake-default"}, {"protocol":"grpc", "listener": "grpc", "targets": ["order"]}],
+			"payload_schemas": [
+				{"id": "order", "method": "*", "descriptor_set": "` + writeDescriptorSet(t) + `", "request_type": "shop.v1.Order", "response_type": "shop.v1.Order"}
+			]
+		}`)})
+		assert.Nil(t, err)
+		// the payloads of the targets of grpc channels are transcoded to protobuf
+		schemas := invoker.(*mosnInvoker).PayloadSchemas("order")
+		assert.Equal(t, PayloadFormatProtobuf, schemas[0].TargetFormat)
+	})
 }
 
 func Test_mosnInvoker_Invoke(t *testing.T) {
@@ -0,0 +1,302 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/mosn/pkg/upstream/cluster"
+	"mosn.io/pkg/log"
+)
+
+const (
+	// ResolverRegistry resolves the target by the registry, i.e. the hosts of the cluster of MOSN discovered by the registry
+	ResolverRegistry = "registry"
+	// ResolverDNS resolves the target by DNS
+	ResolverDNS = "dns"
+	// ResolverStatic resolves the target to the static endpoints in the config
+	ResolverStatic = "static"
+
+	defaultEndpointHeader  = "x-layotto-endpoint"
+	defaultNegativeTTL     = 5 * time.Second
+	negativeCacheSweepSize = 1024
+)
+
+var defaultResolverChain = []string{ResolverRegistry, ResolverDNS, ResolverStatic}
+
+// ResolverConfig is the config of resolving the targets of InvokeService by a chain of resolvers,
+// so that the requests are still sent when the primary registry is degraded.
+// The targets resolved by the registry are sent as usual, and the ones resolved by DNS or the static endpoints
+// are sent to the fallback target with the endpoint in the header.
+type ResolverConfig struct {
+	// Chain is the order of the resolvers, the default value is ["registry", "dns", "static"]
+	Chain []string `json:"chain"`
+	// FallbackTarget is the target of the requests resolved by DNS or the static endpoints,
+	// which should be a cluster of MOSN sending the requests to the endpoint in the header, e.g. an original destination cluster
+	FallbackTarget string `json:"fallback_target"`
+	// EndpointHeader is the header of the endpoint resolved, the default value is "x-layotto-endpoint"
+	EndpointHeader string `json:"endpoint_header"`
+	// NegativeTTLMs is how long a resolver is skipped after it resolves nothing for a target, the default value is 5000
+	NegativeTTLMs int `json:"negative_ttl_ms"`
+	// Targets are the resolvers of the targets, the targets not configured are resolved by the registry only
+	Targets map[string]*TargetResolverConfig `json:"targets"`
+}
+
+// TargetResolverConfig is the config of resolving a target
+type TargetResolverConfig struct {
+	// Chain overrides the order of the resolvers of the target
+	Chain []string `json:"chain"`
+	// Cluster is the cluster of MOSN whose hosts are discovered by the registry, the default value is the target
+	Cluster string `json:"cluster"`
+	// DNS is the host and the port resolved by DNS, e.g. "user-service.default.svc.cluster.local:8080"
+	DNS string `json:"dns"`
+	// Static are the endpoints used if the others resolve nothing
+	Static []string `json:"static"`
+}
+
+// resolvers resolves the targets by the chains
+type resolvers struct {
+	chain          []string
+	fallbackTarget string
+	endpointHeader string
+	negativeTTL    time.Duration
+	targets        map[string]*TargetResolverConfig
+	// the functions below are replaced in tests
+	hasHosts   func(cluster string) bool
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	random     func(n int) int
+	now        func() time.Time
+
+	mu sync.Mutex
+	// negative is the expiration of the negative results by the target and the resolver
+	negative map[string]time.Time
+}
+
+func newResolvers(config *ResolverConfig) (*resolvers, error) {
+	r := &resolvers{
+		chain:          defaultResolverChain,
+		fallbackTarget: config.FallbackTarget,
+		endpointHeader: defaultEndpointHeader,
+		negativeTTL:    defaultNegativeTTL,
+		targets:        config.Targets,
+		hasHosts:       clusterHasHosts,
+		lookupHost:     net.DefaultResolver.LookupHost,
+		random:         rand.Intn,
+		now:            time.Now,
+		negative:       make(map[string]time.Time),
+	}
+	if len(config.Chain) > 0 {
+		r.chain = config.Chain
+	}
+	if err := validateResolverChain(r.chain); err != nil {
+		return nil, err
+	}
+	if config.EndpointHeader != "" {
+		r.endpointHeader = config.EndpointHeader
+	}
+	if config.NegativeTTLMs < 0 {
+		return nil, fmt.Errorf("negative_ttl_ms of resolver can't be negative")
+	}
+	if config.NegativeTTLMs > 0 {
+		r.negativeTTL = time.Duration(config.NegativeTTLMs) * time.Millisecond
+	}
+	for target, t := range config.Targets {
+		if t == nil {
+			return nil, fmt.Errorf("resolver of target %s is empty", target)
+		}
+		if err := validateResolverChain(t.Chain); err != nil {
+			return nil, err
+		}
+		if t.DNS != "" {
+			if _, _, err := net.SplitHostPort(t.DNS); err != nil {
+				return nil, fmt.Errorf("dns of resolver of target %s should be host:port: %v", target, err)
+			}
+		}
+		if (t.DNS != "" || len(t.Static) > 0) && r.fallbackTarget == "" {
+			return nil, fmt.Errorf("fallback_target of resolver is required by the dns and static resolvers of target %s", target)
+		}
+	}
+	return r, nil
+}
+
+func validateResolverChain(chain []string) error {
+	for _, name := range chain {
+		if name != ResolverRegistry && name != ResolverDNS && name != ResolverStatic {
+			return fmt.Errorf("unknown resolver %s", name)
+		}
+	}
+	return nil
+}
+
+// resolve returns the endpoint of the target and the resolver resolving it, the endpoint is empty if it's resolved by the registry.
+// The endpoints not available, i.e. ejected by the circuit breakers, are skipped. If all the endpoints resolved are ejected,
+// the first one is returned, so that the request is rejected by its circuit breaker.
+// It returns false if all the resolvers resolve nothing.
+func (r *resolvers) resolve(ctx context.Context, target string, available func(endpoint string) bool) (endpoint string, resolver string, ok bool) {
+	t, configured := r.targets[target]
+	if !configured {
+		return "", ResolverRegistry, true
+	}
+	chain := r.chain
+	if len(t.Chain) > 0 {
+		chain = t.Chain
+	}
+	var ejected, ejectedResolver string
+	ejectedFound := false
+	for _, resolver := range chain {
+		key := target + "|" + resolver
+		if r.negativeCached(key) {
+			continue
+		}
+		var endpoints []string
+		switch resolver {
+		case ResolverRegistry:
+			cluster := t.Cluster
+			if cluster == "" {
+				cluster = target
+			}
+			if r.hasHosts(cluster) {
+				endpoints = []string{""}
+			}
+		case ResolverDNS:
+			endpoints = r.lookup(ctx, target, t.DNS)
+		case ResolverStatic:
+			endpoints = t.Static
+		}
+		if len(endpoints) == 0 {
+			r.cacheNegative(key)
+			continue
+		}
+		candidates := endpoints
+		if available != nil {
+			candidates = make([]string, 0, len(endpoints))
+			for _, e := range endpoints {
+				if available(e) {
+					candidates = append(candidates, e)
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[r.random(len(candidates))], resolver, true
+		}
+		if !ejectedFound {
+			ejected, ejectedResolver, ejectedFound = endpoints[0], resolver, true
+		}
+	}
+	if ejectedFound {
+		return ejected, ejectedResolver, true
+	}
+	return "", "", false
+}
+
+// resolvable reports whether the target is resolved by any of the resolvers, the targets not configured are resolved by the registry
+func (r *resolvers) resolvable(ctx context.Context, target string) bool {
+	_, _, ok := r.resolve(ctx, target, nil)
+	return ok
+}
+
+func (r *resolvers) lookup(ctx context.Context, target string, hostPort string) []string {
+	if hostPort == "" {
+		return nil
+	}
+	host, port, _ := net.SplitHostPort(hostPort)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	addrs, err := r.lookupHost(ctx, host)
+	if err != nil {
+		log.DefaultLogger.Warnf("[runtime][rpc]resolve %s of target %s by dns error: %v", host, target, err)
+		return nil
+	}
+	endpoints := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, net.JoinHostPort(addr, port))
+	}
+	return endpoints
+}
+
+func (r *resolvers) negativeCached(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expire, ok := r.negative[key]
+	if !ok {
+		return false
+	}
+	if r.now().Before(expire) {
+		return true
+	}
+	delete(r.negative, key)
+	return false
+}
+
+func (r *resolvers) cacheNegative(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	// the targets are configured, so the expired results are swept only in case of too many resolvers
+	if len(r.negative) >= negativeCacheSweepSize {
+		for k, expire := range r.negative {
+			if !now.Before(expire) {
+				delete(r.negative, k)
+			}
+		}
+	}
+	r.negative[key] = now.Add(r.negativeTTL)
+}
+
+// clusterHasHosts reports whether the registry has discovered the hosts of the cluster
+func clusterHasHosts(name string) (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			ok = false
+		}
+	}()
+	snapshot := cluster.GetClusterMngAdapterInstance().GetClusterSnapshot(context.Background(), name)
+	return snapshot != nil && snapshot.IsExistsHosts(nil)
+}
+
+// resolve sends the request to the fallback target with the endpoint in the header if the registry resolves nothing,
+// and returns the endpoint. available skips the endpoints ejected by the circuit breakers if it's not nil.
+func (m *mosnInvoker) resolve(req *rpc.RPCRequest, available func(endpoint string) bool) string {
+	if m.resolvers == nil {
+		return ""
+	}
+	endpoint, resolver, ok := m.resolvers.resolve(req.Ctx, req.Id, available)
+	if !ok {
+		log.DefaultLogger.Warnf("[runtime][rpc]target %s is resolved by none of the resolvers", req.Id)
+		return ""
+	}
+	if endpoint == "" {
+		return ""
+	}
+	log.DefaultLogger.Debugf("[runtime][rpc]target %s is resolved to %s by %s", req.Id, endpoint, resolver)
+	if req.Header == nil {
+		req.Header = make(rpc.RPCHeader)
+	}
+	req.Header[m.resolvers.endpointHeader] = []string{endpoint}
+	if req.Source == "" {
+		req.Source = req.Id
+	}
+	req.Id = m.resolvers.fallbackTarget
+	return endpoint
+}
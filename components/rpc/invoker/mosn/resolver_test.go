@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+func TestNewResolvers(t *testing.T) {
+	_, err := newResolvers(&ResolverConfig{Chain: []string{"registry", "consul"}})
+	assert.NotNil(t, err)
+	_, err = newResolvers(&ResolverConfig{NegativeTTLMs: -1})
+	assert.NotNil(t, err)
+	_, err = newResolvers(&ResolverConfig{FallbackTarget: "fallback", Targets: map[string]*TargetResolverConfig{"svc": {DNS: "svc.local"}}})
+	assert.NotNil(t, err)
+	// the fallback target is required by dns and static
+	_, err = newResolvers(&ResolverConfig{Targets: map[string]*TargetResolverConfig{"svc": {Static: []string{"10.0.0.1:8080"}}}})
+	assert.NotNil(t, err)
+	_, err = newResolvers(&ResolverConfig{Targets: map[string]*TargetResolverConfig{"svc": {Cluster: "svc_cluster"}}})
+	assert.Nil(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	r, err := newResolvers(&ResolverConfig{
+		FallbackTarget: "fallback",
+		NegativeTTLMs:  1000,
+		Targets: map[string]*TargetResolverConfig{
+			"svc":    {Cluster: "svc_cluster", DNS: "svc.local:8080", Static: []string{"10.0.0.1:8080"}},
+			"static": {Chain: []string{"static", "registry"}, Static: []string{"10.0.0.2:8080", "10.0.0.3:8080"}},
+		},
+	})
+	assert.Nil(t, err)
+	healthy := map[string]bool{"svc_cluster": true}
+	var clusters []string
+	r.hasHosts = func(cluster string) bool {
+		clusters = append(clusters, cluster)
+		return healthy[cluster]
+	}
+	lookups := 0
+	var dnsErr error
+	r.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		assert.Equal(t, "svc.local", host)
+		return []string{"192.168.0.1"}, dnsErr
+	}
+	r.random = func(n int) int { return n - 1 }
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	// the targets not configured are resolved by the registry only
+	endpoint, resolver, ok := r.resolve(context.Background(), "other", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "", endpoint)
+	assert.Equal(t, ResolverRegistry, resolver)
+	assert.Empty(t, clusters)
+
+	endpoint, resolver, ok = r.resolve(context.Background(), "svc", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "", endpoint)
+	assert.Equal(t, ResolverRegistry, resolver)
+	assert.Equal(t, []string{"svc_cluster"}, clusters)
+
+	// falls back to dns if the registry is degraded
+	healthy["svc_cluster"] = false
+	endpoint, resolver, ok = r.resolve(context.Background(), "svc", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "192.168.0.1:8080", endpoint)
+	assert.Equal(t, ResolverDNS, resolver)
+
+	// the registry is skipped while the negative result is cached
+	healthy["svc_cluster"] = true
+	endpoint, _, _ = r.resolve(context.Background(), "svc", nil)
+	assert.Equal(t, "192.168.0.1:8080", endpoint)
+	assert.Equal(t, 2, len(clusters))
+
+	// falls back to the static endpoints if dns fails, and dns isn't looked up again until the negative result expires
+	now = now.Add(time.Second)
+	healthy["svc_cluster"] = false
+	dnsErr = errors.New("no such host")
+	endpoint, resolver, _ = r.resolve(context.Background(), "svc", nil)
+	assert.Equal(t, "10.0.0.1:8080", endpoint)
+	assert.Equal(t, ResolverStatic, resolver)
+	assert.Equal(t, 3, lookups)
+	endpoint, _, _ = r.resolve(context.Background(), "svc", nil)
+	assert.Equal(t, "10.0.0.1:8080", endpoint)
+	assert.Equal(t, 3, lookups)
+
+	// the registry is used again after the negative result expires
+	now = now.Add(time.Second)
+	healthy["svc_cluster"] = true
+	endpoint, resolver, _ = r.resolve(context.Background(), "svc", nil)
+	assert.Equal(t, "", endpoint)
+	assert.Equal(t, ResolverRegistry, resolver)
+
+	// the chain is overridden by the target
+	endpoint, resolver, ok = r.resolve(context.Background(), "static", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.3:8080", endpoint)
+	assert.Equal(t, ResolverStatic, resolver)
+
+	// nothing is resolved
+	r.targets["none"] = &TargetResolverConfig{Chain: []string{"registry", "dns"}}
+	_, _, ok = r.resolve(context.Background(), "none", nil)
+	assert.False(t, ok)
+}
+
+func TestInvokeResolved(t *testing.T) {
+	r, err := newResolvers(&ResolverConfig{
+		FallbackTarget: "fallback",
+		Targets:        map[string]*TargetResolverConfig{"svc": {Static: []string{"10.0.0.1:8080"}}},
+	})
+	assert.Nil(t, err)
+	r.hasHosts = func(string) bool { return false }
+	ch := &recordChannel{}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), resolvers: r}
+	req := &rpc.RPCRequest{Id: "svc", Method: "Get"}
+	_, err = invoker.Invoke(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ch.count("svc"))
+	assert.Equal(t, 1, ch.count("fallback"))
+	assert.Equal(t, "10.0.0.1:8080", req.Header.Get(defaultEndpointHeader))
+	assert.Equal(t, "svc", req.Source)
+
+	// the circuit breaker is of the endpoint of the target before it's resolved
+	invoker.breakers = newCircuitBreakers(&CircuitBreakerConfig{})
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	assert.NotNil(t, invoker.breakers.endpoints[endpointKey{target: "svc", endpoint: "10.0.0.1:8080"}])
+	assert.Nil(t, invoker.breakers.endpoints[endpointKey{target: "svc"}])
+	assert.Nil(t, invoker.breakers.endpoints[endpointKey{target: "fallback", endpoint: "10.0.0.1:8080"}])
+}
+
+func TestResolveAvailable(t *testing.T) {
+	r, err := newResolvers(&ResolverConfig{
+		FallbackTarget: "fallback",
+		Targets: map[string]*TargetResolverConfig{
+			"svc": {Static: []string{"10.0.0.1:8080", "10.0.0.2:8080"}},
+		},
+	})
+	assert.Nil(t, err)
+	r.hasHosts = func(string) bool { return true }
+	r.random = func(n int) int { return n - 1 }
+	ejected := map[string]bool{"": true, "10.0.0.2:8080": true}
+	available := func(endpoint string) bool { return !ejected[endpoint] }
+
+	// the ejected cluster and endpoints are skipped
+	endpoint, resolver, ok := r.resolve(context.Background(), "svc", available)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1:8080", endpoint)
+	assert.Equal(t, ResolverStatic, resolver)
+
+	// the first one is returned if all of them are ejected
+	ejected["10.0.0.1:8080"] = true
+	endpoint, resolver, ok = r.resolve(context.Background(), "svc", available)
+	assert.True(t, ok)
+	assert.Equal(t, "", endpoint)
+	assert.Equal(t, ResolverRegistry, resolver)
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/pkg/log"
+)
+
+// defaultRetryTarget is the key of the retry policy applied to the targets without their own policies
+const defaultRetryTarget = "*"
+
+// RetryPolicy is the retry policy of a target, i.e. the id of InvokeService.
+// Only the idempotent methods are retried or hedged, the others are invoked once.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first one, the default value is 1 which disables retries.
+	MaxAttempts int `json:"max_attempts"`
+	// BackoffMs is the interval between the sequential retries.
+	BackoffMs int `json:"backoff_ms"`
+	// HedgeDelayMs enables hedging if it's positive: another attempt is sent if there is no response
+	// after the delay, without canceling the former ones, and the first successful response wins.
+	HedgeDelayMs int `json:"hedge_delay_ms"`
+	// IdempotentMethods are the methods safe to be retried, "*" means all the methods.
+	IdempotentMethods []string `json:"idempotent_methods"`
+}
+
+func (p *RetryPolicy) idempotent(method string) bool {
+	for _, m := range p.IdempotentMethods {
+		if m == defaultRetryTarget || m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy returns the policy of the request, or nil if it's invoked once
+func (m *mosnInvoker) retryPolicy(req *rpc.RPCRequest) *RetryPolicy {
+	p, ok := m.retry[req.Id]
+	if !ok {
+		p = m.retry[defaultRetryTarget]
+	}
+	if p == nil || p.MaxAttempts <= 1 || !p.idempotent(req.Method) {
+		return nil
+	}
+	return p
+}
+
+// doWithRetry invokes the request by the retry policy, the attempts and the backoffs share the timeout of the request.
+// It returns the last error if all the attempts fail, or the timeout is exhausted or the context is done before the next attempt.
+func (m *mosnInvoker) doWithRetry(req *rpc.RPCRequest, p *RetryPolicy) (*rpc.RPCResponse, error) {
+	deadline := time.Now().Add(time.Duration(req.Timeout) * time.Millisecond)
+	if p.HedgeDelayMs > 0 {
+		return m.doHedged(req, p, deadline)
+	}
+	ctx := requestContext(req)
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		if attempt > 1 && p.BackoffMs > 0 {
+			timer := time.NewTimer(time.Duration(p.BackoffMs) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				log.DefaultLogger.Warnf("[runtime][rpc]retries of %s.%s stop: %v", req.Id, req.Method, ctx.Err())
+				return nil, err
+			case <-timer.C:
+			}
+		}
+		r, ok := attemptRequest(req, deadline)
+		if !ok {
+			if err == nil {
+				err = errTimeoutBudgetExhausted(req)
+			}
+			log.DefaultLogger.Warnf("[runtime][rpc]retries of %s.%s stop: the timeout is exhausted", req.Id, req.Method)
+			return nil, err
+		}
+		var resp *rpc.RPCResponse
+		if resp, err = m.do(r); err == nil {
+			return resp, nil
+		}
+		log.DefaultLogger.Warnf("[runtime][rpc]attempt %d of %s.%s error: %s", attempt, req.Id, req.Method, err.Error())
+	}
+	return nil, err
+}
+
+// attemptRequest copies the request for an attempt with the timeout remaining before the deadline.
+// It returns false if the timeout is exhausted.
+func attemptRequest(req *rpc.RPCRequest, deadline time.Time) (*rpc.RPCRequest, bool) {
+	r := cloneRequest(req)
+	now := time.Now()
+	r.Timeout = int32(deadline.Sub(now) / time.Millisecond)
+	if r.Ctx == nil {
+		r.Ctx = context.Background()
+	}
+	return r, applyTimeoutBudget(r, now)
+}
+
+func requestContext(req *rpc.RPCRequest) context.Context {
+	if req.Ctx == nil {
+		return context.Background()
+	}
+	return req.Ctx
+}
+
+type attemptResult struct {
+	resp *rpc.RPCResponse
+	err  error
+}
+
+// doHedged sends a new attempt when the hedge delay passes or an attempt fails, until one succeeds.
+// The attempts share the timeout of the request, and it returns when the context is done.
+func (m *mosnInvoker) doHedged(req *rpc.RPCRequest, p *RetryPolicy, deadline time.Time) (*rpc.RPCResponse, error) {
+	ctx := requestContext(req)
+	// buffered so that the late attempts don't block after the result is returned
+	results := make(chan attemptResult, p.MaxAttempts)
+	send := func() bool {
+		r, ok := attemptRequest(req, deadline)
+		if !ok {
+			return false
+		}
+		go func() {
+			defer func() {
+				if e := recover(); e != nil {
+					results <- attemptResult{err: fmt.Errorf("[runtime][rpc]mosn invoker panic: %v", e)}
+				}
+			}()
+			resp, err := m.do(r)
+			results <- attemptResult{resp: resp, err: err}
+		}()
+		return true
+	}
+	if !send() {
+		return nil, errTimeoutBudgetExhausted(req)
+	}
+	delay := time.Duration(p.HedgeDelayMs) * time.Millisecond
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	// inFlight is the number of attempts without results
+	sent, inFlight := 1, 1
+	var err error
+	for {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				return r.resp, nil
+			}
+			err = r.err
+			log.DefaultLogger.Warnf("[runtime][rpc]hedged attempt of %s.%s error: %s", req.Id, req.Method, err.Error())
+			// the failed attempt is replaced at once
+			if sent < p.MaxAttempts && send() {
+				sent++
+				inFlight++
+			}
+			if inFlight == 0 {
+				return nil, err
+			}
+		case <-timer.C:
+			if sent < p.MaxAttempts && send() {
+				sent++
+				inFlight++
+				timer.Reset(delay)
+			}
+		case <-ctx.Done():
+			log.DefaultLogger.Warnf("[runtime][rpc]hedged attempts of %s.%s stop: %v", req.Id, req.Method, ctx.Err())
+			if err == nil {
+				err = errTimeoutBudgetExhausted(req)
+			}
+			return nil, err
+		}
+	}
+}
+
+// cloneRequest copies the request for an attempt, since the channel may modify the header
+func cloneRequest(req *rpc.RPCRequest) *rpc.RPCRequest {
+	r := *req
+	if req.Header != nil {
+		r.Header = make(rpc.RPCHeader, len(req.Header))
+		for k, v := range req.Header {
+			r.Header[k] = append([]string(nil), v...)
+		}
+	}
+	return &r
+}
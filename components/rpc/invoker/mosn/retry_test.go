@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+// scriptedChannel fails the first failures attempts, and responds after the delay of each attempt
+type scriptedChannel struct {
+	calls    int32
+	failures int32
+	delays   []time.Duration
+
+	mu sync.Mutex
+	// timeouts are the timeouts of the attempts
+	timeouts []int32
+}
+
+func (c *scriptedChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	c.mu.Lock()
+	c.timeouts = append(c.timeouts, req.Timeout)
+	c.mu.Unlock()
+	n := atomic.AddInt32(&c.calls, 1)
+	if int(n) <= len(c.delays) {
+		time.Sleep(c.delays[n-1])
+	}
+	if n <= c.failures {
+		return nil, errors.New("fail")
+	}
+	return &rpc.RPCResponse{Data: []byte{byte(n)}}, nil
+}
+
+func newRetryInvoker(ch rpc.Channel, policies map[string]*RetryPolicy) *mosnInvoker {
+	return &mosnInvoker{channel: ch, cb: callback.NewCallback(), retry: policies}
+}
+
+func TestRetry(t *testing.T) {
+	policies := map[string]*RetryPolicy{
+		"svc": {MaxAttempts: 3, IdempotentMethods: []string{"Get"}},
+	}
+	req := func(id, method string) *rpc.RPCRequest {
+		return &rpc.RPCRequest{Id: id, Method: method, Timeout: 100}
+	}
+
+	// the idempotent method is retried
+	ch := &scriptedChannel{failures: 2}
+	resp, err := newRetryInvoker(ch, policies).Invoke(context.Background(), req("svc", "Get"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3}, resp.Data)
+
+	// the others are invoked once
+	ch = &scriptedChannel{failures: 2}
+	_, err = newRetryInvoker(ch, policies).Invoke(context.Background(), req("svc", "Put"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), ch.calls)
+	ch = &scriptedChannel{failures: 2}
+	_, err = newRetryInvoker(ch, policies).Invoke(context.Background(), req("other", "Get"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), ch.calls)
+
+	// the default policy
+	policies[defaultRetryTarget] = &RetryPolicy{MaxAttempts: 2, IdempotentMethods: []string{"*"}}
+	ch = &scriptedChannel{failures: 2}
+	_, err = newRetryInvoker(ch, policies).Invoke(context.Background(), req("other", "Put"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), ch.calls)
+}
+
+func TestRetryDeadline(t *testing.T) {
+	policies := map[string]*RetryPolicy{
+		"svc": {MaxAttempts: 3, BackoffMs: 100, IdempotentMethods: []string{"*"}},
+	}
+
+	// the attempts get the timeout remaining, and the retries stop when it's exhausted
+	ch := &scriptedChannel{failures: 3}
+	start := time.Now()
+	_, err := newRetryInvoker(ch, policies).Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get", Timeout: 150})
+	assert.Equal(t, "fail", err.Error())
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+	assert.Equal(t, int32(2), ch.calls)
+	assert.True(t, ch.timeouts[0] <= 150 && ch.timeouts[0] > 100)
+	assert.True(t, ch.timeouts[1] <= 50)
+
+	// the backoff stops when the context is done
+	ch = &scriptedChannel{failures: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = newRetryInvoker(ch, policies).Invoke(ctx, &rpc.RPCRequest{Id: "svc", Method: "Get", Timeout: 1000})
+	assert.Equal(t, "fail", err.Error())
+	assert.True(t, time.Since(start) < 90*time.Millisecond)
+	assert.Equal(t, int32(1), ch.calls)
+}
+
+func TestHedging(t *testing.T) {
+	policies := map[string]*RetryPolicy{
+		"svc": {MaxAttempts: 2, HedgeDelayMs: 10, IdempotentMethods: []string{"*"}},
+	}
+
+	// the second attempt is sent after the delay and responds first
+	ch := &scriptedChannel{delays: []time.Duration{500 * time.Millisecond, 0}}
+	start := time.Now()
+	resp, err := newRetryInvoker(ch, policies).Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, resp.Data)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+
+	// a fast response doesn't trigger the hedged attempt
+	ch = &scriptedChannel{}
+	_, err = newRetryInvoker(ch, policies).Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ch.calls))
+
+	// a failed attempt is replaced at once, and the last error is returned if all fail
+	ch = &scriptedChannel{failures: 2}
+	_, err = newRetryInvoker(ch, policies).Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Equal(t, "fail", err.Error())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&ch.calls))
+
+	// the hedged attempts return when the context is done
+	ch = &scriptedChannel{delays: []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = newRetryInvoker(ch, policies).Invoke(ctx, &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+}
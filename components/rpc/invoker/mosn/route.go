@@ -0,0 +1,181 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/pkg/log"
+)
+
+// RouteRule routes the requests to the source matching the rule to the destinations, e.g. canary versions.
+// The rules of a source are matched in order, and the first matched one wins.
+type RouteRule struct {
+	// Source is the id of InvokeService whose requests are routed
+	Source string `json:"source"`
+	// Match is the condition of the rule, the rule matches all the requests if it's nil
+	Match *RouteMatch `json:"match"`
+	// Destinations split the matched requests by weight
+	Destinations []*RouteDestination `json:"destinations"`
+}
+
+// RouteMatch matches the method and the headers of requests, all the conditions must be met
+type RouteMatch struct {
+	// Methods are the methods matched, all the methods are matched if it's empty
+	Methods []string `json:"methods"`
+	// Headers are the headers matched with the exact values, the keys are case insensitive
+	Headers map[string]string `json:"headers"`
+}
+
+// RouteDestination is a target of the routed requests, which is resolved like the ids of InvokeService,
+// i.e. by the resolver of the invoker if the target is configured in it, or by the registry of MOSN.
+type RouteDestination struct {
+	Target string `json:"target"`
+	// Weight is the percentage of the matched requests sent to the target, the weights of a rule sum to 100
+	Weight int `json:"weight"`
+}
+
+// routes holds the route rules of the sources
+type routes struct {
+	rules  map[string][]*RouteRule
+	random func(n int) int
+}
+
+func newRoutes(rules []*RouteRule) (*routes, error) {
+	r := &routes{
+		rules:  make(map[string][]*RouteRule),
+		random: rand.Intn,
+	}
+	for _, rule := range rules {
+		if rule.Source == "" || len(rule.Destinations) == 0 {
+			return nil, fmt.Errorf("source and destinations of route rule are required")
+		}
+		total := 0
+		for _, d := range rule.Destinations {
+			if d.Target == "" || d.Weight < 0 {
+				return nil, fmt.Errorf("invalid destination of route rule %s: %+v", rule.Source, d)
+			}
+			total += d.Weight
+		}
+		if total != 100 {
+			return nil, fmt.Errorf("weights of route rule %s should sum to 100: %d", rule.Source, total)
+		}
+		if rule.Match != nil && len(rule.Match.Headers) > 0 {
+			// the keys are matched case insensitively
+			headers := make(map[string]string, len(rule.Match.Headers))
+			for k, v := range rule.Match.Headers {
+				headers[strings.ToLower(k)] = v
+			}
+			rule.Match.Headers = headers
+		}
+		r.rules[rule.Source] = append(r.rules[rule.Source], rule)
+	}
+	return r, nil
+}
+
+// target returns the target which the request is routed to, or the id of the request if no rule matches.
+// The destinations not resolvable are skipped and their weights go to the others of the rule,
+// and the rule is skipped if none of them is resolvable. All of them are resolvable if resolvable is nil.
+func (r *routes) target(req *rpc.RPCRequest, resolvable func(target string) bool) string {
+	for _, rule := range r.rules[req.Id] {
+		if !rule.Match.matches(req) {
+			continue
+		}
+		destinations, total := rule.Destinations, 100
+		if resolvable != nil {
+			destinations, total = nil, 0
+			for _, d := range rule.Destinations {
+				if d.Weight > 0 && resolvable(d.Target) {
+					destinations = append(destinations, d)
+					total += d.Weight
+				}
+			}
+			if total == 0 {
+				log.DefaultLogger.Warnf("[runtime][rpc]none of the destinations of route rule of %s is resolvable", req.Id)
+				continue
+			}
+		}
+		n := r.random(total)
+		for _, d := range destinations {
+			if n < d.Weight {
+				return d.Target
+			}
+			n -= d.Weight
+		}
+	}
+	return req.Id
+}
+
+func (m *RouteMatch) matches(req *rpc.RPCRequest) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.Methods) > 0 {
+		matched := false
+		for _, method := range m.Methods {
+			if method == req.Method {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for k, v := range m.Headers {
+		if headerValue(req.Header, k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// headerValue returns the value of the header whose key equals the lower case key case insensitively
+func headerValue(header rpc.RPCHeader, key string) string {
+	if values, ok := header[key]; ok {
+		return strings.Join(values, ",")
+	}
+	for k, values := range header {
+		if strings.ToLower(k) == key {
+			return strings.Join(values, ",")
+		}
+	}
+	return ""
+}
+
+// route rewrites the id of the request to the target chosen by the route rules, among the ones resolvable by the resolvers
+func (m *mosnInvoker) route(req *rpc.RPCRequest) {
+	if m.routes == nil {
+		return
+	}
+	var resolvable func(target string) bool
+	if m.resolvers != nil {
+		resolvable = func(target string) bool {
+			return m.resolvers.resolvable(req.Ctx, target)
+		}
+	}
+	if target := m.routes.target(req, resolvable); target != req.Id {
+		log.DefaultLogger.Debugf("[runtime][rpc]route %s.%s to %s", req.Id, req.Method, target)
+		if req.Source == "" {
+			req.Source = req.Id
+		}
+		req.Id = target
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+func TestNewRoutes(t *testing.T) {
+	_, err := newRoutes([]*RouteRule{{Source: "svc"}})
+	assert.NotNil(t, err)
+	_, err = newRoutes([]*RouteRule{{Source: "svc", Destinations: []*RouteDestination{{Target: "v1", Weight: 90}}}})
+	assert.NotNil(t, err)
+	_, err = newRoutes([]*RouteRule{{Source: "svc", Destinations: []*RouteDestination{{Weight: 100}}}})
+	assert.NotNil(t, err)
+}
+
+func TestRoute(t *testing.T) {
+	r, err := newRoutes([]*RouteRule{
+		{
+			Source:       "svc",
+			Match:        &RouteMatch{Headers: map[string]string{"X-Canary": "true"}},
+			Destinations: []*RouteDestination{{Target: "svc:2.0", Weight: 100}},
+		},
+		{
+			Source:       "svc",
+			Match:        &RouteMatch{Methods: []string{"Get"}},
+			Destinations: []*RouteDestination{{Target: "svc:1.0", Weight: 90}, {Target: "svc:2.0", Weight: 10}},
+		},
+	})
+	assert.Nil(t, err)
+	n := 0
+	r.random = func(int) int { return n }
+	req := func(method string, header rpc.RPCHeader) *rpc.RPCRequest {
+		return &rpc.RPCRequest{Id: "svc", Method: method, Header: header}
+	}
+
+	// the header matches case insensitively
+	assert.Equal(t, "svc:2.0", r.target(req("Put", rpc.RPCHeader{"x-canary": {"true"}}), nil))
+	assert.Equal(t, "svc", r.target(req("Put", rpc.RPCHeader{"x-canary": {"false"}}), nil))
+	assert.Equal(t, "svc", r.target(req("Put", nil), nil))
+	assert.Equal(t, "svc:2.0", r.target(req("Put", rpc.RPCHeader{"X-CANARY": {"true"}}), nil))
+
+	// split by weight
+	assert.Equal(t, "svc:1.0", r.target(req("Get", nil), nil))
+	n = 89
+	assert.Equal(t, "svc:1.0", r.target(req("Get", nil), nil))
+	n = 90
+	assert.Equal(t, "svc:2.0", r.target(req("Get", nil), nil))
+
+	// the destinations not resolvable are skipped
+	resolvable := map[string]bool{"svc:2.0": true}
+	n = 5
+	assert.Equal(t, "svc:2.0", r.target(req("Get", nil), func(target string) bool { return resolvable[target] }))
+	resolvable["svc:2.0"] = false
+	assert.Equal(t, "svc", r.target(req("Get", nil), func(target string) bool { return resolvable[target] }))
+
+	// the other targets are not routed
+	assert.Equal(t, "other", r.target(&rpc.RPCRequest{Id: "other", Method: "Get"}, nil))
+}
+
+func TestInvokeRouted(t *testing.T) {
+	r, err := newRoutes([]*RouteRule{
+		{Source: "svc", Destinations: []*RouteDestination{{Target: "svc:2.0", Weight: 100}}},
+	})
+	assert.Nil(t, err)
+	ch := &recordChannel{}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), routes: r}
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ch.count("svc"))
+	assert.Equal(t, 1, ch.count("svc:2.0"))
+
+	// the destination is resolved by the resolver
+	invoker.resolvers, err = newResolvers(&ResolverConfig{Targets: map[string]*TargetResolverConfig{"svc:2.0": {Chain: []string{"registry"}}}})
+	assert.Nil(t, err)
+	invoker.resolvers.hasHosts = func(string) bool { return false }
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "svc", Method: "Get"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ch.count("svc"))
+}
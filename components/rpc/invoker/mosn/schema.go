@@ -0,0 +1,381 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+)
+
+const (
+	// PayloadSchemaEnforce rejects the payloads violating the schemas
+	PayloadSchemaEnforce = "enforce"
+	// PayloadSchemaWarn logs the payloads violating the schemas only
+	PayloadSchemaWarn = "warn"
+
+	// PayloadFormatJSON and PayloadFormatProtobuf are the formats of the payloads
+	PayloadFormatJSON     = "json"
+	PayloadFormatProtobuf = "protobuf"
+
+	anyMethod = "*"
+
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// PayloadSchemaConfig registers the schema of the payloads of a method of a target.
+// The payloads are validated by the protobuf messages in the descriptor set, or by the JSON schemas.
+type PayloadSchemaConfig struct {
+	// Id is the target, i.e. the id of InvokeService
+	Id string `json:"id"`
+	// Method is the method of the target, "*" matches the methods without their own schemas
+	Method string `json:"method"`
+	// DescriptorSet is the file of the FileDescriptorSet, e.g. the output of `protoc --include_imports --descriptor_set_out`
+	DescriptorSet string `json:"descriptor_set"`
+	// RequestType and ResponseType are the full names of the messages in the descriptor set, e.g. "shop.v1.Order",
+	// the payloads aren't validated by the descriptors if they're empty
+	RequestType  string `json:"request_type"`
+	ResponseType string `json:"response_type"`
+	// RequestJSONSchema and ResponseJSONSchema validate the JSON payloads
+	RequestJSONSchema  json.RawMessage `json:"request_json_schema"`
+	ResponseJSONSchema json.RawMessage `json:"response_json_schema"`
+	// TargetFormat is the format of the payloads accepted by the target, "json" or "protobuf".
+	// The requests in the other format are transcoded to it, and the responses are transcoded back.
+	// It's "protobuf" for the targets of grpc channels if the message types are registered, and the payloads aren't transcoded otherwise.
+	TargetFormat string `json:"target_format"`
+	// Transcode is the same as the target_format "protobuf"
+	Transcode bool `json:"transcode"`
+	// Mode is "enforce" by default, which rejects the payloads violating the schemas, and "warn" logs them only
+	Mode string `json:"mode"`
+}
+
+// payloadSchema is the PayloadSchemaConfig loaded
+type payloadSchema struct {
+	cfg            *PayloadSchemaConfig
+	descriptorSet  []byte
+	requestType    protoreflect.MessageDescriptor
+	responseType   protoreflect.MessageDescriptor
+	requestSchema  *jsonSchema
+	responseSchema *jsonSchema
+}
+
+// payloadSchemas are the schemas by the targets and the methods
+type payloadSchemas struct {
+	schemas map[string]map[string]*payloadSchema
+}
+
+func newPayloadSchemas(configs []*PayloadSchemaConfig) (*payloadSchemas, error) {
+	p := &payloadSchemas{schemas: make(map[string]map[string]*payloadSchema)}
+	for _, cfg := range configs {
+		s, err := loadPayloadSchema(cfg)
+		if err != nil {
+			return nil, err
+		}
+		methods, ok := p.schemas[cfg.Id]
+		if !ok {
+			methods = make(map[string]*payloadSchema)
+			p.schemas[cfg.Id] = methods
+		}
+		if _, ok := methods[cfg.Method]; ok {
+			return nil, fmt.Errorf("duplicate payload schema of %s.%s", cfg.Id, cfg.Method)
+		}
+		methods[cfg.Method] = s
+	}
+	return p, nil
+}
+
+func loadPayloadSchema(cfg *PayloadSchemaConfig) (*payloadSchema, error) {
+	if cfg.Id == "" || cfg.Method == "" {
+		return nil, fmt.Errorf("id and method of payload schema are required")
+	}
+	name := cfg.Id + "." + cfg.Method
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = PayloadSchemaEnforce
+	case PayloadSchemaEnforce, PayloadSchemaWarn:
+	default:
+		return nil, fmt.Errorf("unknown mode of payload schema %s: %s", name, cfg.Mode)
+	}
+	s := &payloadSchema{cfg: cfg}
+	if cfg.DescriptorSet != "" {
+		if err := s.loadDescriptors(); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set of payload schema %s: %v", name, err)
+		}
+	} else if cfg.RequestType != "" || cfg.ResponseType != "" {
+		return nil, fmt.Errorf("descriptor_set of payload schema %s is required by the message types", name)
+	}
+	if cfg.Transcode && cfg.TargetFormat == "" {
+		cfg.TargetFormat = PayloadFormatProtobuf
+	}
+	switch cfg.TargetFormat {
+	case "":
+	case PayloadFormatJSON, PayloadFormatProtobuf:
+		if s.requestType == nil || s.responseType == nil {
+			return nil, fmt.Errorf("request_type and response_type of payload schema %s are required by transcoding", name)
+		}
+	default:
+		return nil, fmt.Errorf("unknown target_format of payload schema %s: %s", name, cfg.TargetFormat)
+	}
+	var err error
+	if len(cfg.RequestJSONSchema) > 0 {
+		if s.requestSchema, err = parseJSONSchema(cfg.RequestJSONSchema); err != nil {
+			return nil, fmt.Errorf("invalid request_json_schema of payload schema %s: %v", name, err)
+		}
+	}
+	if len(cfg.ResponseJSONSchema) > 0 {
+		if s.responseSchema, err = parseJSONSchema(cfg.ResponseJSONSchema); err != nil {
+			return nil, fmt.Errorf("invalid response_json_schema of payload schema %s: %v", name, err)
+		}
+	}
+	if s.requestType == nil && s.responseType == nil && s.requestSchema == nil && s.responseSchema == nil {
+		return nil, fmt.Errorf("payload schema %s validates nothing", name)
+	}
+	return s, nil
+}
+
+func (s *payloadSchema) loadDescriptors() error {
+	data, err := ioutil.ReadFile(s.cfg.DescriptorSet)
+	if err != nil {
+		return err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return err
+	}
+	s.descriptorSet = data
+	if s.requestType, err = findMessage(files, s.cfg.RequestType); err != nil {
+		return err
+	}
+	s.responseType, err = findMessage(files, s.cfg.ResponseType)
+	return err
+}
+
+func findMessage(files interface {
+	FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+}, name string) (protoreflect.MessageDescriptor, error) {
+	if name == "" {
+		return nil, nil
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s is not found: %v", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// match returns the schema of the method of the target, or nil if there isn't
+func (p *payloadSchemas) match(id string, method string) *payloadSchema {
+	methods, ok := p.schemas[id]
+	if !ok {
+		return nil
+	}
+	if s, ok := methods[method]; ok {
+		return s
+	}
+	return methods[anyMethod]
+}
+
+// payloadCall is the payloads of a request checked by the schema
+type payloadCall struct {
+	schema *payloadSchema
+	// id and method are the ones before the request is routed
+	id     string
+	method string
+	// transcoded is true if the request is transcoded to the target format,
+	// and the response is transcoded back to the format and the content type of the caller
+	transcoded        bool
+	callerFormat      string
+	callerContentType string
+}
+
+// checkRequest validates the request, and transcodes it to the target format if it's required
+func (s *payloadSchema) checkRequest(req *rpc.RPCRequest) (*payloadCall, error) {
+	call := &payloadCall{schema: s, id: req.Id, method: req.Method}
+	format := payloadFormat(req.ContentType)
+	if err := s.validate(req.Data, format, s.requestType, s.requestSchema); err != nil {
+		if err = s.violated(common.InvalidArgsCode, "request of %s.%s violates the payload schema: %v", req.Id, req.Method, err); err != nil {
+			return nil, err
+		}
+		// the invalid requests are sent as they are in the warn mode
+		return call, nil
+	}
+	target := s.cfg.TargetFormat
+	if target == "" || target == format {
+		return call, nil
+	}
+	data, err := transcode(req.Data, s.requestType, format, target)
+	if err != nil {
+		return nil, common.Errorf(common.InvalidArgsCode, "fail to transcode the request of %s.%s: %v", req.Id, req.Method, err)
+	}
+	call.transcoded = true
+	call.callerFormat = format
+	call.callerContentType = req.ContentType
+	if call.callerContentType == "" {
+		call.callerContentType = contentTypeJSON
+	}
+	req.Data = data
+	req.ContentType = contentTypeOf(target)
+	return call, nil
+}
+
+// checkResponse validates the response, and transcodes it back to the format of the caller if the request is transcoded
+func (c *payloadCall) checkResponse(resp *rpc.RPCResponse) error {
+	s := c.schema
+	// the responses of the requests transcoded are in the target format, whatever the content types are
+	format := payloadFormat(resp.ContentType)
+	if c.transcoded {
+		format = s.cfg.TargetFormat
+	}
+	if err := s.validate(resp.Data, format, s.responseType, s.responseSchema); err != nil {
+		return s.violated(common.InternalCode, "response of %s.%s violates the payload schema: %v", c.id, c.method, err)
+	}
+	if !c.transcoded {
+		return nil
+	}
+	data, err := transcode(resp.Data, s.responseType, format, c.callerFormat)
+	if err != nil {
+		return common.Errorf(common.InternalCode, "fail to transcode the response of %s.%s: %v", c.id, c.method, err)
+	}
+	resp.Data = data
+	resp.ContentType = c.callerContentType
+	return nil
+}
+
+// validate validates the payload by the message type, and the JSON schema if it's JSON
+func (s *payloadSchema) validate(data []byte, format string, md protoreflect.MessageDescriptor, schema *jsonSchema) error {
+	if md != nil {
+		if err := unmarshalPayload(data, format, dynamicpb.NewMessage(md)); err != nil {
+			return err
+		}
+	}
+	if schema != nil && format == PayloadFormatJSON {
+		return schema.validate(data)
+	}
+	return nil
+}
+
+// violated returns the error of the violation, or logs it in the warn mode
+func (s *payloadSchema) violated(code int, format string, args ...interface{}) error {
+	err := common.Errorf(code, format, args...)
+	if s.cfg.Mode == PayloadSchemaWarn {
+		log.DefaultLogger.Warnf("[runtime][rpc]%s", err.Msg())
+		return nil
+	}
+	return err
+}
+
+// transcode converts the payload from a format to another
+func transcode(data []byte, md protoreflect.MessageDescriptor, from string, to string) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := unmarshalPayload(data, from, msg); err != nil {
+		return nil, err
+	}
+	if to == PayloadFormatJSON {
+		return protojson.Marshal(msg)
+	}
+	return proto.Marshal(msg)
+}
+
+func unmarshalPayload(data []byte, format string, msg proto.Message) error {
+	if format == PayloadFormatJSON {
+		return protojson.Unmarshal(data, msg)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// payloadFormat returns the format of the payload, which is JSON if the content type is empty or contains "json"
+func payloadFormat(contentType string) string {
+	if contentType == "" || strings.Contains(strings.ToLower(contentType), "json") {
+		return PayloadFormatJSON
+	}
+	return PayloadFormatProtobuf
+}
+
+func contentTypeOf(format string) string {
+	if format == PayloadFormatJSON {
+		return contentTypeJSON
+	}
+	return contentTypeProtobuf
+}
+
+// checkPayload validates the request by the payload schema of it,
+// and returns the call checking the response, which is nil if there isn't a schema
+func (m *mosnInvoker) checkPayload(req *rpc.RPCRequest) (*payloadCall, error) {
+	if m.payloads == nil {
+		return nil, nil
+	}
+	s := m.payloads.match(req.Id, req.Method)
+	if s == nil {
+		return nil, nil
+	}
+	return s.checkRequest(req)
+}
+
+// PayloadSchemas implements rpc.PayloadSchemaProvider
+func (m *mosnInvoker) PayloadSchemas(target string) []*rpc.PayloadSchema {
+	if m.payloads == nil {
+		return nil
+	}
+	var res []*rpc.PayloadSchema
+	for id, methods := range m.payloads.schemas {
+		if target != "" && id != target {
+			continue
+		}
+		for _, s := range methods {
+			res = append(res, &rpc.PayloadSchema{
+				Id:                 s.cfg.Id,
+				Method:             s.cfg.Method,
+				RequestType:        s.cfg.RequestType,
+				ResponseType:       s.cfg.ResponseType,
+				DescriptorSet:      s.descriptorSet,
+				RequestJSONSchema:  string(s.cfg.RequestJSONSchema),
+				ResponseJSONSchema: string(s.cfg.ResponseJSONSchema),
+				TargetFormat:       s.cfg.TargetFormat,
+				Mode:               s.cfg.Mode,
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Id != res[j].Id {
+			return res[i].Id < res[j].Id
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
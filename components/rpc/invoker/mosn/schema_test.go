@@ -0,0 +1,200 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mosn
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/rpc/callback"
+)
+
+// writeDescriptorSet writes the descriptor set of the message shop.v1.Order {string id = 1; int32 count = 2;}
+func writeDescriptorSet(t *testing.T) string {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("shop/v1/order.proto"),
+		Package: proto.String("shop.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(set)
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "payload")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "order.pb")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestNewPayloadSchemas(t *testing.T) {
+	path := writeDescriptorSet(t)
+	for _, cfg := range []*PayloadSchemaConfig{
+		{Id: "svc"},
+		{Id: "svc", Method: "*"},
+		{Id: "svc", Method: "*", Mode: "strict", RequestType: "shop.v1.Order", DescriptorSet: path},
+		{Id: "svc", Method: "*", RequestType: "shop.v1.Order"},
+		{Id: "svc", Method: "*", RequestType: "shop.v1.Missing", DescriptorSet: path},
+		{Id: "svc", Method: "*", RequestType: "shop.v1.Order", DescriptorSet: path, Transcode: true},
+		{Id: "svc", Method: "*", RequestJSONSchema: []byte(`{"type": "decimal"}`)},
+		{Id: "svc", Method: "*", RequestType: "shop.v1.Order", ResponseType: "shop.v1.Order", DescriptorSet: path, TargetFormat: "xml"},
+		{Id: "svc", Method: "*", RequestType: "shop.v1.Order", DescriptorSet: path, TargetFormat: "json"},
+	} {
+		_, err := newPayloadSchemas([]*PayloadSchemaConfig{cfg})
+		assert.NotNil(t, err, "%+v", cfg)
+	}
+	_, err := newPayloadSchemas([]*PayloadSchemaConfig{
+		{Id: "svc", Method: "Get", RequestJSONSchema: []byte(`{"type": "object"}`)},
+		{Id: "svc", Method: "Get", RequestJSONSchema: []byte(`{"type": "object"}`)},
+	})
+	assert.NotNil(t, err)
+}
+
+// payloadChannel replies the response and records the request
+type payloadChannel struct {
+	req  *rpc.RPCRequest
+	resp *rpc.RPCResponse
+}
+
+func (c *payloadChannel) Do(req *rpc.RPCRequest) (*rpc.RPCResponse, error) {
+	c.req = req
+	return c.resp, nil
+}
+
+func TestInvokePayloadSchema(t *testing.T) {
+	path := writeDescriptorSet(t)
+	payloads, err := newPayloadSchemas([]*PayloadSchemaConfig{
+		{
+			Id:                "order",
+			Method:            "Create",
+			DescriptorSet:     path,
+			RequestType:       "shop.v1.Order",
+			ResponseType:      "shop.v1.Order",
+			RequestJSONSchema: []byte(`{"type": "object", "required": ["id"]}`),
+			Transcode:         true,
+		},
+		{Id: "order", Method: "*", RequestJSONSchema: []byte(`{"type": "object", "additionalProperties": false}`), Mode: PayloadSchemaWarn},
+	})
+	assert.Nil(t, err)
+	ch := &payloadChannel{}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), payloads: payloads}
+
+	// the JSON request is sent as protobuf, and the protobuf response is returned as JSON
+	ch.resp = &rpc.RPCResponse{Data: []byte{0x0a, 0x02, 'o', '1', 0x10, 0x03}}
+	resp, err := invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", ContentType: "application/json", Data: []byte(`{"id": "o1", "count": 3}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, contentTypeProtobuf, ch.req.ContentType)
+	assert.Equal(t, []byte{0x0a, 0x02, 'o', '1', 0x10, 0x03}, ch.req.Data)
+	assert.Equal(t, contentTypeJSON, resp.ContentType)
+	assert.JSONEq(t, `{"id": "o1", "count": 3}`, string(resp.Data))
+
+	// the requests violating the schemas are rejected
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", Data: []byte(`{"count": 3}`)})
+	assert.Equal(t, common.InvalidArgsCode, err.(common.CommonError).Code())
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", Data: []byte(`{"id": "o1", "price": 3}`)})
+	assert.Equal(t, common.InvalidArgsCode, err.(common.CommonError).Code())
+
+	// the responses violating the schemas are rejected
+	ch.resp = &rpc.RPCResponse{Data: []byte{0xff}}
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", Data: []byte(`{"id": "o1"}`)})
+	assert.Equal(t, common.InternalCode, err.(common.CommonError).Code())
+
+	// the protobuf requests are validated and sent as they are
+	ch.resp = &rpc.RPCResponse{ContentType: contentTypeProtobuf, Data: []byte{0x0a, 0x02, 'o', '1'}}
+	resp, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", ContentType: contentTypeProtobuf, Data: []byte{0x0a, 0x02, 'o', '1'}})
+	assert.Nil(t, err)
+	assert.Equal(t, contentTypeProtobuf, resp.ContentType)
+
+	// the violations are logged only in the warn mode
+	ch.resp = &rpc.RPCResponse{}
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Delete", Data: []byte(`{"id": "o1", "force": true}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id": "o1", "force": true}`, string(ch.req.Data))
+
+	// the other targets aren't checked
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "user", Method: "Create", Data: []byte(`garbage`)})
+	assert.Nil(t, err)
+
+	schemas := invoker.PayloadSchemas("order")
+	assert.Len(t, schemas, 2)
+	assert.Equal(t, "*", schemas[0].Method)
+	assert.Equal(t, PayloadSchemaWarn, schemas[0].Mode)
+	assert.Equal(t, "Create", schemas[1].Method)
+	assert.Equal(t, PayloadSchemaEnforce, schemas[1].Mode)
+	assert.Equal(t, PayloadFormatProtobuf, schemas[1].TargetFormat)
+	assert.NotEmpty(t, schemas[1].DescriptorSet)
+	assert.Empty(t, invoker.PayloadSchemas("user"))
+}
+
+func TestInvokePayloadSchema_TargetFormat(t *testing.T) {
+	path := writeDescriptorSet(t)
+	payloads, err := newPayloadSchemas([]*PayloadSchemaConfig{{
+		Id:            "order",
+		Method:        "*",
+		DescriptorSet: path,
+		RequestType:   "shop.v1.Order",
+		ResponseType:  "shop.v1.Order",
+		TargetFormat:  PayloadFormatJSON,
+	}})
+	assert.Nil(t, err)
+	ch := &payloadChannel{resp: &rpc.RPCResponse{ContentType: "application/json; charset=utf-8", Data: []byte(`{"id": "o1", "count": 3}`)}}
+	invoker := &mosnInvoker{channel: ch, cb: callback.NewCallback(), payloads: payloads}
+
+	// the protobuf request is sent as JSON, and the JSON response is returned as protobuf
+	resp, err := invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", ContentType: "application/grpc", Data: []byte{0x0a, 0x02, 'o', '1'}})
+	assert.Nil(t, err)
+	assert.Equal(t, contentTypeJSON, ch.req.ContentType)
+	assert.JSONEq(t, `{"id": "o1"}`, string(ch.req.Data))
+	assert.Equal(t, "application/grpc", resp.ContentType)
+	assert.Equal(t, []byte{0x0a, 0x02, 'o', '1', 0x10, 0x03}, resp.Data)
+
+	// the JSON request is sent as it is
+	ch.resp = &rpc.RPCResponse{ContentType: contentTypeJSON, Data: []byte(`{"id": "o1"}`)}
+	resp, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", Data: []byte(`{"id": "o1"}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, "", ch.req.ContentType)
+	assert.Equal(t, `{"id": "o1"}`, string(resp.Data))
+
+	// the JSON response violating the message fails the transcoded request
+	ch.resp = &rpc.RPCResponse{ContentType: contentTypeJSON, Data: []byte(`{"id": 1}`)}
+	_, err = invoker.Invoke(context.Background(), &rpc.RPCRequest{Id: "order", Method: "Create", ContentType: contentTypeProtobuf, Data: []byte{0x0a, 0x02, 'o', '1'}})
+	assert.Equal(t, common.InternalCode, err.(common.CommonError).Code())
+}
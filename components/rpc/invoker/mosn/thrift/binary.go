@@ -0,0 +1,240 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thrift
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const binaryVersion1 uint32 = 0x80010000
+
+// binaryProtocol is the strict binary protocol of Thrift
+type binaryProtocol struct{}
+
+func (binaryProtocol) newWriter() writer {
+	return &binaryWriter{}
+}
+
+func (binaryProtocol) newReader(b []byte) reader {
+	return &binaryReader{buf: b}
+}
+
+type binaryWriter struct {
+	buf []byte
+}
+
+func (w *binaryWriter) writeMessageBegin(name string, typ byte, seq int32) {
+	w.writeI32(int32(binaryVersion1 | uint32(typ)))
+	w.writeBinary([]byte(name))
+	w.writeI32(seq)
+}
+
+func (w *binaryWriter) writeStructBegin() {}
+
+func (w *binaryWriter) writeStructEnd() {}
+
+func (w *binaryWriter) writeFieldBegin(typ byte, id int16) {
+	w.buf = append(w.buf, typ)
+	w.writeI16(id)
+}
+
+func (w *binaryWriter) writeFieldStop() {
+	w.buf = append(w.buf, typeStop)
+}
+
+func (w *binaryWriter) writeBool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *binaryWriter) writeByte(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *binaryWriter) writeI16(v int16) {
+	w.buf = append(w.buf, byte(uint16(v)>>8), byte(v))
+}
+
+func (w *binaryWriter) writeI32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *binaryWriter) writeI64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *binaryWriter) writeDouble(v float64) {
+	w.writeI64(int64(math.Float64bits(v)))
+}
+
+func (w *binaryWriter) writeBinary(v []byte) {
+	w.writeI32(int32(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *binaryWriter) writeListBegin(elem byte, size int) {
+	w.buf = append(w.buf, elem)
+	w.writeI32(int32(size))
+}
+
+func (w *binaryWriter) writeMapBegin(key byte, value byte, size int) {
+	w.buf = append(w.buf, key, value)
+	w.writeI32(int32(size))
+}
+
+func (w *binaryWriter) bytes() []byte {
+	return w.buf
+}
+
+type binaryReader struct {
+	buf []byte
+}
+
+func (r *binaryReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.buf) < n {
+		return nil, errShortBuffer
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *binaryReader) readMessageBegin() (string, byte, int32, error) {
+	v, err := r.readI32()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if uint32(v)&0xffff0000 != binaryVersion1 {
+		return "", 0, 0, fmt.Errorf("bad version of thrift binary message: %x", uint32(v))
+	}
+	name, err := r.readBinary()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	seq, err := r.readI32()
+	return string(name), byte(v), seq, err
+}
+
+func (r *binaryReader) readStructBegin() {}
+
+func (r *binaryReader) readStructEnd() {}
+
+func (r *binaryReader) readFieldBegin() (byte, int16, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if b[0] == typeStop {
+		return typeStop, 0, nil
+	}
+	id, err := r.readI16()
+	return b[0], id, err
+}
+
+func (r *binaryReader) readBool() (bool, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return false, err
+	}
+	return b[0] != 0, nil
+}
+
+func (r *binaryReader) readByte() (int8, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return int8(b[0]), nil
+}
+
+func (r *binaryReader) readI16() (int16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (r *binaryReader) readI32() (int32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *binaryReader) readI64() (int64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (r *binaryReader) readDouble() (float64, error) {
+	v, err := r.readI64()
+	return math.Float64frombits(uint64(v)), err
+}
+
+func (r *binaryReader) readBinary() ([]byte, error) {
+	n, err := r.readI32()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.next(int(n))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (r *binaryReader) readListBegin() (byte, int, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := r.readI32()
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative size of thrift list: %d", n)
+	}
+	return b[0], int(n), err
+}
+
+func (r *binaryReader) readMapBegin() (byte, byte, int, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	n, err := r.readI32()
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative size of thrift map: %d", n)
+	}
+	return b[0], b[1], int(n), err
+}
+
+func (r *binaryReader) remaining() []byte {
+	return r.buf
+}
@@ -0,0 +1,435 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ApplicationException is the error reported by the Thrift framework of the server, e.g. unknown method
+type ApplicationException struct {
+	Message string
+	Type    int32
+}
+
+func (e *ApplicationException) Error() string {
+	return fmt.Sprintf("thrift application exception %d: %s", e.Type, e.Message)
+}
+
+// UserException is the exception declared by the method, Data is its JSON
+type UserException struct {
+	Name string
+	Data []byte
+}
+
+func (e *UserException) Error() string {
+	return fmt.Sprintf("thrift exception %s: %s", e.Name, e.Data)
+}
+
+// Codec converts the JSON data of generic calls to Thrift messages and back.
+// The methods without signatures are passed through: the data is the encoded struct of the arguments,
+// and the reply is the encoded struct of the result.
+type Codec struct {
+	proto   protocol
+	service string
+	methods map[string]*MethodSpec
+}
+
+// NewCodec returns the codec of the protocol, binary or compact.
+// The names of the messages are prefixed with "service:" if the service is not empty, like the multiplexed protocol.
+func NewCodec(protocolName string, service string, methods map[string]*MethodSpec) (*Codec, error) {
+	proto, err := newProtocol(protocolName)
+	if err != nil {
+		return nil, err
+	}
+	for name, m := range methods {
+		if err := m.init(); err != nil {
+			return nil, fmt.Errorf("invalid signature of method %s: %v", name, err)
+		}
+	}
+	return &Codec{proto: proto, service: service, methods: methods}, nil
+}
+
+// HasSignature returns true if the signature of the method is configured, i.e. its data is JSON
+func (c *Codec) HasSignature(method string) bool {
+	_, ok := c.methods[method]
+	return ok
+}
+
+// Oneway returns true if the method doesn't reply
+func (c *Codec) Oneway(method string) bool {
+	m, ok := c.methods[method]
+	return ok && m.Oneway
+}
+
+// EncodeCall encodes the call message of the method
+func (c *Codec) EncodeCall(method string, seq int32, data []byte) ([]byte, error) {
+	name := method
+	if c.service != "" {
+		name = c.service + ":" + method
+	}
+	m, ok := c.methods[method]
+	typ := messageCall
+	if ok && m.Oneway {
+		typ = messageOneway
+	}
+	w := c.proto.newWriter()
+	w.writeMessageBegin(name, typ, seq)
+	if !ok {
+		return append(w.bytes(), data...), nil
+	}
+	args := map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&args); err != nil {
+			return nil, fmt.Errorf("arguments of %s should be a JSON object: %v", method, err)
+		}
+	}
+	if err := writeFields(w, m.Args, args); err != nil {
+		return nil, fmt.Errorf("arguments of %s: %v", method, err)
+	}
+	return w.bytes(), nil
+}
+
+// SeqID returns the sequence id of the message
+func (c *Codec) SeqID(msg []byte) (int32, error) {
+	_, _, seq, err := c.proto.newReader(msg).readMessageBegin()
+	return seq, err
+}
+
+// DecodeReply decodes the reply message of the method, and returns the JSON of the return value
+func (c *Codec) DecodeReply(method string, msg []byte) ([]byte, error) {
+	r := c.proto.newReader(msg)
+	_, typ, _, err := r.readMessageBegin()
+	if err != nil {
+		return nil, err
+	}
+	if typ == messageException {
+		return nil, readApplicationException(r)
+	}
+	if typ != messageReply {
+		return nil, fmt.Errorf("unexpected type of thrift message: %d", typ)
+	}
+	m, ok := c.methods[method]
+	if !ok {
+		return r.remaining(), nil
+	}
+	result := &TypeSpec{Type: "struct", id: typeStruct, Fields: m.Exceptions}
+	if !m.void() {
+		result.Fields = append([]*FieldSpec{{ID: 0, Name: "success", TypeSpec: *m.Result}}, m.Exceptions...)
+	}
+	v, err := readValue(r, result)
+	if err != nil {
+		return nil, err
+	}
+	fields := v.(map[string]interface{})
+	for _, e := range m.Exceptions {
+		if ex, ok := fields[e.Name]; ok {
+			data, _ := json.Marshal(ex)
+			return nil, &UserException{Name: e.Name, Data: data}
+		}
+	}
+	if m.void() {
+		return nil, nil
+	}
+	success, ok := fields["success"]
+	if !ok {
+		return nil, fmt.Errorf("%s failed: unknown result", method)
+	}
+	return json.Marshal(success)
+}
+
+func readApplicationException(r reader) error {
+	e := &ApplicationException{}
+	spec := &TypeSpec{Type: "struct", id: typeStruct, Fields: []*FieldSpec{
+		{ID: 1, Name: "message", TypeSpec: TypeSpec{Type: "string", id: typeString}},
+		{ID: 2, Name: "type", TypeSpec: TypeSpec{Type: "i32", id: typeI32}},
+	}}
+	v, err := readValue(r, spec)
+	if err != nil {
+		return err
+	}
+	fields := v.(map[string]interface{})
+	e.Message, _ = fields["message"].(string)
+	e.Type, _ = fields["type"].(int32)
+	return e
+}
+
+func writeFields(w writer, fields []*FieldSpec, values map[string]interface{}) error {
+	w.writeStructBegin()
+	for _, f := range fields {
+		v, ok := values[f.Name]
+		// the missing fields are left to the server, e.g. the optional ones
+		if !ok || v == nil {
+			continue
+		}
+		w.writeFieldBegin(f.id, f.ID)
+		if err := writeValue(w, &f.TypeSpec, v); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	w.writeFieldStop()
+	w.writeStructEnd()
+	return nil
+}
+
+func writeValue(w writer, t *TypeSpec, v interface{}) error {
+	switch t.id {
+	case typeBool:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("bool expected: %v", v)
+		}
+		w.writeBool(b)
+	case typeByte, typeI16, typeI32, typeI64:
+		n, err := toInt(v, t.id)
+		if err != nil {
+			return err
+		}
+		switch t.id {
+		case typeByte:
+			w.writeByte(int8(n))
+		case typeI16:
+			w.writeI16(int16(n))
+		case typeI32:
+			w.writeI32(int32(n))
+		default:
+			w.writeI64(n)
+		}
+	case typeDouble:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		w.writeDouble(f)
+	case typeString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("string expected: %v", v)
+		}
+		if t.Type != "binary" {
+			w.writeBinary([]byte(s))
+			break
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("binary should be base64 encoded: %v", err)
+		}
+		w.writeBinary(b)
+	case typeList, typeSet:
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("array expected: %v", v)
+		}
+		w.writeListBegin(t.Elem.id, len(items))
+		for _, item := range items {
+			if err := writeValue(w, t.Elem, item); err != nil {
+				return err
+			}
+		}
+	case typeMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("object expected: %v", v)
+		}
+		w.writeMapBegin(t.Key.id, t.Value.id, len(m))
+		for k, item := range m {
+			key, err := parseKey(t.Key, k)
+			if err != nil {
+				return err
+			}
+			if err := writeValue(w, t.Key, key); err != nil {
+				return err
+			}
+			if err := writeValue(w, t.Value, item); err != nil {
+				return err
+			}
+		}
+	case typeStruct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("object expected: %v", v)
+		}
+		return writeFields(w, t.Fields, m)
+	default:
+		return fmt.Errorf("unsupported thrift type %s", t.Type)
+	}
+	return nil
+}
+
+// parseKey converts the keys of JSON objects to the values of the key type
+func parseKey(t *TypeSpec, k string) (interface{}, error) {
+	switch t.id {
+	case typeString:
+		return k, nil
+	case typeBool:
+		return strconv.ParseBool(k)
+	case typeByte, typeI16, typeI32, typeI64, typeDouble:
+		return json.Number(k), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type of map: %s", t.Type)
+	}
+}
+
+func toInt(v interface{}, typ byte) (int64, error) {
+	var n int64
+	var err error
+	switch x := v.(type) {
+	case json.Number:
+		n, err = x.Int64()
+	case float64:
+		n = int64(x)
+		if float64(n) != x {
+			err = fmt.Errorf("integer expected: %v", x)
+		}
+	default:
+		err = fmt.Errorf("integer expected: %v", v)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var min, max int64
+	switch typ {
+	case typeByte:
+		min, max = math.MinInt8, math.MaxInt8
+	case typeI16:
+		min, max = math.MinInt16, math.MaxInt16
+	case typeI32:
+		min, max = math.MinInt32, math.MaxInt32
+	default:
+		return n, nil
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("integer out of range: %d", n)
+	}
+	return n, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.Float64()
+	case float64:
+		return x, nil
+	default:
+		return 0, fmt.Errorf("number expected: %v", v)
+	}
+}
+
+func readValue(r reader, t *TypeSpec) (interface{}, error) {
+	switch t.id {
+	case typeBool:
+		return r.readBool()
+	case typeByte:
+		return r.readByte()
+	case typeI16:
+		return r.readI16()
+	case typeI32:
+		return r.readI32()
+	case typeI64:
+		return r.readI64()
+	case typeDouble:
+		return r.readDouble()
+	case typeString:
+		b, err := r.readBinary()
+		if err != nil || t.Type == "binary" {
+			return b, err
+		}
+		return string(b), nil
+	case typeList, typeSet:
+		et, size, err := r.readListBegin()
+		if err != nil {
+			return nil, err
+		}
+		if et != t.Elem.id {
+			return nil, fmt.Errorf("type of elements mismatches: %d", et)
+		}
+		items := []interface{}{}
+		for i := 0; i < size; i++ {
+			item, err := readValue(r, t.Elem)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case typeMap:
+		kt, vt, size, err := r.readMapBegin()
+		if err != nil {
+			return nil, err
+		}
+		if size > 0 && (kt != t.Key.id || vt != t.Value.id) {
+			return nil, fmt.Errorf("types of map mismatch: %d, %d", kt, vt)
+		}
+		m := map[string]interface{}{}
+		for i := 0; i < size; i++ {
+			k, err := readValue(r, t.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readValue(r, t.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, nil
+	case typeStruct:
+		return readFields(r, t.Fields)
+	default:
+		return nil, fmt.Errorf("unsupported thrift type %s", t.Type)
+	}
+}
+
+func readFields(r reader, fields []*FieldSpec) (map[string]interface{}, error) {
+	byID := make(map[int16]*FieldSpec, len(fields))
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+	values := map[string]interface{}{}
+	r.readStructBegin()
+	for {
+		typ, id, err := r.readFieldBegin()
+		if err != nil {
+			return nil, err
+		}
+		if typ == typeStop {
+			break
+		}
+		f, ok := byID[id]
+		// the fields unknown to the signature are skipped, e.g. added by newer versions of the server
+		if !ok || f.id != typ {
+			if err := skip(r, typ); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v, err := readValue(r, &f.TypeSpec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		values[f.Name] = v
+	}
+	r.readStructEnd()
+	return values, nil
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thrift
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sayHelloSignature = `{
+	"args": [
+		{"id": 1, "name": "name", "type": "string"},
+		{"id": 2, "name": "times", "type": "i32"},
+		{"id": 3, "name": "tags", "type": "list", "elem": {"type": "string"}},
+		{"id": 4, "name": "options", "type": "map", "key": {"type": "string"}, "value": {"type": "bool"}},
+		{"id": 20, "name": "user", "type": "struct", "fields": [
+			{"id": 1, "name": "id", "type": "i64"},
+			{"id": 2, "name": "vip", "type": "bool"},
+			{"id": 3, "name": "score", "type": "double"},
+			{"id": 4, "name": "avatar", "type": "binary"}
+		]}
+	],
+	"result": {"type": "string"},
+	"exceptions": [
+		{"id": 1, "name": "error", "type": "struct", "fields": [{"id": 1, "name": "message", "type": "string"}]}
+	]
+}`
+
+func newTestCodec(t *testing.T, protocol string) *Codec {
+	var m MethodSpec
+	assert.Nil(t, json.Unmarshal([]byte(sayHelloSignature), &m))
+	c, err := NewCodec(protocol, "", map[string]*MethodSpec{
+		"sayHello": &m,
+		"notify":   {Args: []*FieldSpec{{ID: 1, Name: "event", TypeSpec: TypeSpec{Type: "string"}}}, Oneway: true},
+	})
+	assert.Nil(t, err)
+	return c
+}
+
+func TestNewCodec(t *testing.T) {
+	_, err := NewCodec("json", "", nil)
+	assert.NotNil(t, err)
+	_, err = NewCodec("binary", "", map[string]*MethodSpec{
+		"bad": {Args: []*FieldSpec{{ID: 1, Name: "a", TypeSpec: TypeSpec{Type: "list"}}}},
+	})
+	assert.NotNil(t, err)
+	_, err = NewCodec("binary", "", map[string]*MethodSpec{
+		"bad": {Args: []*FieldSpec{{ID: 1, Name: "a", TypeSpec: TypeSpec{Type: "i32"}}, {ID: 1, Name: "b", TypeSpec: TypeSpec{Type: "i32"}}}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestEncodeCallBytes(t *testing.T) {
+	c, err := NewCodec("binary", "", map[string]*MethodSpec{"ping": {}})
+	assert.Nil(t, err)
+	msg, err := c.EncodeCall("ping", 1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x80, 0x01, 0x00, 0x01, 0, 0, 0, 4, 'p', 'i', 'n', 'g', 0, 0, 0, 1, 0}, msg)
+
+	c, err = NewCodec("compact", "Hello", map[string]*MethodSpec{"ping": {}})
+	assert.Nil(t, err)
+	msg, err = c.EncodeCall("ping", 1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x82, 0x21, 0x01, 10, 'H', 'e', 'l', 'l', 'o', ':', 'p', 'i', 'n', 'g', 0}, msg)
+}
+
+func TestEncodeCall(t *testing.T) {
+	for _, protocol := range []string{"binary", "compact"} {
+		c := newTestCodec(t, protocol)
+		data := `{"name": "layotto", "times": 3, "tags": ["a", "b"], "options": {"loud": true},
+			"user": {"id": 12345678901, "vip": false, "score": 1.5, "avatar": "AQI="}}`
+		msg, err := c.EncodeCall("sayHello", 7, []byte(data))
+		assert.Nil(t, err)
+
+		r := c.proto.newReader(msg)
+		name, typ, seq, err := r.readMessageBegin()
+		assert.Nil(t, err)
+		assert.Equal(t, "sayHello", name)
+		assert.Equal(t, messageCall, typ)
+		assert.Equal(t, int32(7), seq)
+		args, err := readFields(r, c.methods["sayHello"].Args)
+		assert.Nil(t, err)
+		assert.Equal(t, "layotto", args["name"])
+		assert.Equal(t, int32(3), args["times"])
+		assert.Equal(t, []interface{}{"a", "b"}, args["tags"])
+		assert.Equal(t, map[string]interface{}{"loud": true}, args["options"])
+		assert.Equal(t, map[string]interface{}{"id": int64(12345678901), "vip": false, "score": 1.5, "avatar": []byte{1, 2}}, args["user"])
+		assert.Empty(t, r.remaining())
+
+		// invalid arguments
+		_, err = c.EncodeCall("sayHello", 8, []byte(`{"times": "3"}`))
+		assert.NotNil(t, err)
+		_, err = c.EncodeCall("sayHello", 8, []byte(`{"times": 3000000000}`))
+		assert.NotNil(t, err)
+		_, err = c.EncodeCall("sayHello", 8, []byte(`[]`))
+		assert.NotNil(t, err)
+
+		// oneway
+		assert.True(t, c.Oneway("notify"))
+		msg, err = c.EncodeCall("notify", 9, []byte(`{"event": "x"}`))
+		assert.Nil(t, err)
+		_, typ, _, err = c.proto.newReader(msg).readMessageBegin()
+		assert.Nil(t, err)
+		assert.Equal(t, messageOneway, typ)
+
+		// the methods without signatures are passed through
+		msg, err = c.EncodeCall("raw", 10, []byte{0})
+		assert.Nil(t, err)
+		r = c.proto.newReader(msg)
+		_, _, _, err = r.readMessageBegin()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0}, r.remaining())
+	}
+}
+
+func TestDecodeReply(t *testing.T) {
+	for _, protocol := range []string{"binary", "compact"} {
+		c := newTestCodec(t, protocol)
+		reply := func(typ byte, write func(w writer)) []byte {
+			w := c.proto.newWriter()
+			w.writeMessageBegin("sayHello", typ, 1)
+			w.writeStructBegin()
+			write(w)
+			w.writeFieldStop()
+			w.writeStructEnd()
+			return w.bytes()
+		}
+
+		// success, and the unknown fields are skipped
+		msg := reply(messageReply, func(w writer) {
+			w.writeFieldBegin(typeI32, 9)
+			w.writeI32(1)
+			w.writeFieldBegin(typeString, 0)
+			w.writeBinary([]byte("hello layotto"))
+		})
+		seq, err := c.SeqID(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), seq)
+		data, err := c.DecodeReply("sayHello", msg)
+		assert.Nil(t, err)
+		assert.Equal(t, `"hello layotto"`, string(data))
+
+		// the declared exception
+		msg = reply(messageReply, func(w writer) {
+			w.writeFieldBegin(typeStruct, 1)
+			w.writeStructBegin()
+			w.writeFieldBegin(typeString, 1)
+			w.writeBinary([]byte("boom"))
+			w.writeFieldStop()
+			w.writeStructEnd()
+		})
+		_, err = c.DecodeReply("sayHello", msg)
+		assert.Equal(t, &UserException{Name: "error", Data: []byte(`{"message":"boom"}`)}, err)
+
+		// the application exception
+		msg = reply(messageException, func(w writer) {
+			w.writeFieldBegin(typeString, 1)
+			w.writeBinary([]byte("unknown method"))
+			w.writeFieldBegin(typeI32, 2)
+			w.writeI32(1)
+		})
+		_, err = c.DecodeReply("sayHello", msg)
+		assert.Equal(t, &ApplicationException{Message: "unknown method", Type: 1}, err)
+
+		// no result
+		msg = reply(messageReply, func(w writer) {})
+		_, err = c.DecodeReply("sayHello", msg)
+		assert.NotNil(t, err)
+
+		// truncated
+		msg = reply(messageReply, func(w writer) {
+			w.writeFieldBegin(typeString, 0)
+			w.writeBinary([]byte("hello layotto"))
+		})
+		_, err = c.DecodeReply("sayHello", msg[:len(msg)-4])
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,373 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thrift
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	compactProtocolID byte = 0x82
+	compactVersion    byte = 1
+	compactTypeShift       = 5
+
+	compactBoolTrue  byte = 1
+	compactBoolFalse byte = 2
+)
+
+var (
+	toCompactType = map[byte]byte{
+		typeStop:   0,
+		typeBool:   compactBoolTrue,
+		typeByte:   3,
+		typeI16:    4,
+		typeI32:    5,
+		typeI64:    6,
+		typeDouble: 7,
+		typeString: 8,
+		typeList:   9,
+		typeSet:    10,
+		typeMap:    11,
+		typeStruct: 12,
+	}
+	fromCompactType = map[byte]byte{}
+)
+
+func init() {
+	for t, c := range toCompactType {
+		fromCompactType[c] = t
+	}
+	fromCompactType[compactBoolFalse] = typeBool
+}
+
+// compactProtocol is the compact protocol of Thrift
+type compactProtocol struct{}
+
+func (compactProtocol) newWriter() writer {
+	return &compactWriter{}
+}
+
+func (compactProtocol) newReader(b []byte) reader {
+	return &compactReader{buf: b}
+}
+
+type compactWriter struct {
+	buf         []byte
+	lastFieldID int16
+	fieldIDs    []int16
+	// boolFieldID is the id of the bool field whose header is written with the value
+	boolFieldID  int16
+	pendingField bool
+}
+
+func (w *compactWriter) writeVarint(v uint64) {
+	for v >= 0x80 {
+		w.buf = append(w.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *compactWriter) writeMessageBegin(name string, typ byte, seq int32) {
+	w.buf = append(w.buf, compactProtocolID, compactVersion|typ<<compactTypeShift)
+	w.writeVarint(uint64(uint32(seq)))
+	w.writeBinary([]byte(name))
+}
+
+func (w *compactWriter) writeStructBegin() {
+	w.fieldIDs = append(w.fieldIDs, w.lastFieldID)
+	w.lastFieldID = 0
+}
+
+func (w *compactWriter) writeStructEnd() {
+	w.lastFieldID = w.fieldIDs[len(w.fieldIDs)-1]
+	w.fieldIDs = w.fieldIDs[:len(w.fieldIDs)-1]
+}
+
+func (w *compactWriter) writeFieldBegin(typ byte, id int16) {
+	if typ == typeBool {
+		w.boolFieldID = id
+		w.pendingField = true
+		return
+	}
+	w.writeFieldHeader(toCompactType[typ], id)
+}
+
+func (w *compactWriter) writeFieldHeader(ctype byte, id int16) {
+	if id > w.lastFieldID && id-w.lastFieldID <= 15 {
+		w.buf = append(w.buf, byte(id-w.lastFieldID)<<4|ctype)
+	} else {
+		w.buf = append(w.buf, ctype)
+		w.writeI16(id)
+	}
+	w.lastFieldID = id
+}
+
+func (w *compactWriter) writeFieldStop() {
+	w.buf = append(w.buf, typeStop)
+}
+
+func (w *compactWriter) writeBool(v bool) {
+	ctype := compactBoolFalse
+	if v {
+		ctype = compactBoolTrue
+	}
+	if w.pendingField {
+		w.pendingField = false
+		w.writeFieldHeader(ctype, w.boolFieldID)
+		return
+	}
+	w.buf = append(w.buf, ctype)
+}
+
+func (w *compactWriter) writeByte(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *compactWriter) writeI16(v int16) {
+	w.writeI32(int32(v))
+}
+
+func (w *compactWriter) writeI32(v int32) {
+	w.writeVarint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+func (w *compactWriter) writeI64(v int64) {
+	w.writeVarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *compactWriter) writeDouble(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *compactWriter) writeBinary(v []byte) {
+	w.writeVarint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *compactWriter) writeListBegin(elem byte, size int) {
+	if size <= 14 {
+		w.buf = append(w.buf, byte(size)<<4|toCompactType[elem])
+		return
+	}
+	w.buf = append(w.buf, 0xf0|toCompactType[elem])
+	w.writeVarint(uint64(size))
+}
+
+func (w *compactWriter) writeMapBegin(key byte, value byte, size int) {
+	if size == 0 {
+		w.buf = append(w.buf, 0)
+		return
+	}
+	w.writeVarint(uint64(size))
+	w.buf = append(w.buf, toCompactType[key]<<4|toCompactType[value])
+}
+
+func (w *compactWriter) bytes() []byte {
+	return w.buf
+}
+
+type compactReader struct {
+	buf         []byte
+	lastFieldID int16
+	fieldIDs    []int16
+	// boolValue is the value of the bool field read with the header
+	boolValue   bool
+	pendingBool bool
+}
+
+func (r *compactReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.buf) < n {
+		return nil, errShortBuffer
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *compactReader) readVarint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.next(1)
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("thrift varint overflows")
+}
+
+func (r *compactReader) readMessageBegin() (string, byte, int32, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if b[0] != compactProtocolID || b[1]&0x1f != compactVersion {
+		return "", 0, 0, fmt.Errorf("bad header of thrift compact message: %x", b)
+	}
+	seq, err := r.readVarint()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	name, err := r.readBinary()
+	return string(name), b[1] >> compactTypeShift & 0x07, int32(uint32(seq)), err
+}
+
+func (r *compactReader) readStructBegin() {
+	r.fieldIDs = append(r.fieldIDs, r.lastFieldID)
+	r.lastFieldID = 0
+}
+
+func (r *compactReader) readStructEnd() {
+	r.lastFieldID = r.fieldIDs[len(r.fieldIDs)-1]
+	r.fieldIDs = r.fieldIDs[:len(r.fieldIDs)-1]
+}
+
+func (r *compactReader) readFieldBegin() (byte, int16, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	ctype := b[0] & 0x0f
+	if ctype == typeStop {
+		return typeStop, 0, nil
+	}
+	var id int16
+	if delta := int16(b[0] >> 4); delta != 0 {
+		id = r.lastFieldID + delta
+	} else if id, err = r.readI16(); err != nil {
+		return 0, 0, err
+	}
+	typ, ok := fromCompactType[ctype]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown thrift compact type %d", ctype)
+	}
+	if typ == typeBool {
+		r.boolValue = ctype == compactBoolTrue
+		r.pendingBool = true
+	}
+	r.lastFieldID = id
+	return typ, id, nil
+}
+
+func (r *compactReader) readBool() (bool, error) {
+	if r.pendingBool {
+		r.pendingBool = false
+		return r.boolValue, nil
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return false, err
+	}
+	return b[0] == compactBoolTrue, nil
+}
+
+func (r *compactReader) readByte() (int8, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return int8(b[0]), nil
+}
+
+func (r *compactReader) readI16() (int16, error) {
+	v, err := r.readI32()
+	return int16(v), err
+}
+
+func (r *compactReader) readI32() (int32, error) {
+	v, err := r.readVarint()
+	u := uint32(v)
+	return int32(u>>1) ^ -int32(u&1), err
+}
+
+func (r *compactReader) readI64() (int64, error) {
+	v, err := r.readVarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (r *compactReader) readDouble() (float64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+func (r *compactReader) readBinary() ([]byte, error) {
+	n, err := r.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)) {
+		return nil, errShortBuffer
+	}
+	b, _ := r.next(int(n))
+	return append([]byte(nil), b...), nil
+}
+
+func (r *compactReader) readListBegin() (byte, int, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	size := uint64(b[0] >> 4)
+	if size == 15 {
+		if size, err = r.readVarint(); err != nil {
+			return 0, 0, err
+		}
+	}
+	typ, ok := fromCompactType[b[0]&0x0f]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown thrift compact type %d", b[0]&0x0f)
+	}
+	if size > uint64(len(r.buf)) {
+		return 0, 0, errShortBuffer
+	}
+	return typ, int(size), nil
+}
+
+func (r *compactReader) readMapBegin() (byte, byte, int, error) {
+	size, err := r.readVarint()
+	if err != nil || size == 0 {
+		return 0, 0, 0, err
+	}
+	if size > uint64(len(r.buf)) {
+		return 0, 0, 0, errShortBuffer
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	key, ok := fromCompactType[b[0]>>4]
+	value, ok2 := fromCompactType[b[0]&0x0f]
+	if !ok || !ok2 {
+		return 0, 0, 0, fmt.Errorf("unknown thrift compact types of map: %x", b[0])
+	}
+	return key, value, int(size), nil
+}
+
+func (r *compactReader) remaining() []byte {
+	return r.buf
+}
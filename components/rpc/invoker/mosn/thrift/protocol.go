@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thrift
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errShortBuffer = errors.New("thrift message is truncated")
+
+// writer encodes the values of a protocol into the buffer
+type writer interface {
+	writeMessageBegin(name string, typ byte, seq int32)
+	writeStructBegin()
+	writeStructEnd()
+	writeFieldBegin(typ byte, id int16)
+	writeFieldStop()
+	writeBool(v bool)
+	writeByte(v int8)
+	writeI16(v int16)
+	writeI32(v int32)
+	writeI64(v int64)
+	writeDouble(v float64)
+	writeBinary(v []byte)
+	writeListBegin(elem byte, size int)
+	writeMapBegin(key byte, value byte, size int)
+	bytes() []byte
+}
+
+// reader decodes the values of a protocol from the buffer
+type reader interface {
+	readMessageBegin() (name string, typ byte, seq int32, err error)
+	readStructBegin()
+	readStructEnd()
+	// readFieldBegin returns typeStop at the end of the struct
+	readFieldBegin() (typ byte, id int16, err error)
+	readBool() (bool, error)
+	readByte() (int8, error)
+	readI16() (int16, error)
+	readI32() (int32, error)
+	readI64() (int64, error)
+	readDouble() (float64, error)
+	readBinary() ([]byte, error)
+	readListBegin() (elem byte, size int, err error)
+	readMapBegin() (key byte, value byte, size int, err error)
+	// remaining returns the bytes not read yet
+	remaining() []byte
+}
+
+// protocol creates the writers and readers of a Thrift protocol
+type protocol interface {
+	newWriter() writer
+	newReader(b []byte) reader
+}
+
+func newProtocol(name string) (protocol, error) {
+	switch name {
+	case "", "binary":
+		return binaryProtocol{}, nil
+	case "compact":
+		return compactProtocol{}, nil
+	default:
+		return nil, fmt.Errorf("unknown thrift protocol %s", name)
+	}
+}
+
+// skip reads the value of the type and drops it, e.g. the fields unknown to the signature
+func skip(r reader, typ byte) error {
+	var err error
+	switch typ {
+	case typeBool:
+		_, err = r.readBool()
+	case typeByte:
+		_, err = r.readByte()
+	case typeI16:
+		_, err = r.readI16()
+	case typeI32:
+		_, err = r.readI32()
+	case typeI64:
+		_, err = r.readI64()
+	case typeDouble:
+		_, err = r.readDouble()
+	case typeString:
+		_, err = r.readBinary()
+	case typeStruct:
+		r.readStructBegin()
+		for {
+			ft, _, err := r.readFieldBegin()
+			if err != nil {
+				return err
+			}
+			if ft == typeStop {
+				break
+			}
+			if err := skip(r, ft); err != nil {
+				return err
+			}
+		}
+		r.readStructEnd()
+	case typeMap:
+		kt, vt, size, err := r.readMapBegin()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := skip(r, kt); err != nil {
+				return err
+			}
+			if err := skip(r, vt); err != nil {
+				return err
+			}
+		}
+	case typeSet, typeList:
+		et, size, err := r.readListBegin()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := skip(r, et); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown thrift type id %d", typ)
+	}
+	return err
+}
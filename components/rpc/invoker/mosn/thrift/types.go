@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package thrift encodes the generic calls of Thrift services by the method signatures in the config,
+// so that the JSON data of InvokeService is converted to Thrift messages without generated code.
+package thrift
+
+import (
+	"fmt"
+)
+
+// the type ids of the binary protocol
+const (
+	typeStop   byte = 0
+	typeVoid   byte = 1
+	typeBool   byte = 2
+	typeByte   byte = 3
+	typeDouble byte = 4
+	typeI16    byte = 6
+	typeI32    byte = 8
+	typeI64    byte = 10
+	typeString byte = 11
+	typeStruct byte = 12
+	typeMap    byte = 13
+	typeSet    byte = 14
+	typeList   byte = 15
+)
+
+// the types of messages
+const (
+	messageCall      byte = 1
+	messageReply     byte = 2
+	messageException byte = 3
+	messageOneway    byte = 4
+)
+
+var typeNames = map[string]byte{
+	"void":   typeVoid,
+	"bool":   typeBool,
+	"byte":   typeByte,
+	"i8":     typeByte,
+	"i16":    typeI16,
+	"i32":    typeI32,
+	"i64":    typeI64,
+	"double": typeDouble,
+	"string": typeString,
+	"binary": typeString,
+	"struct": typeStruct,
+	"map":    typeMap,
+	"set":    typeSet,
+	"list":   typeList,
+}
+
+// TypeSpec describes a Thrift type in the IDL, e.g. {"type": "list", "elem": {"type": "string"}}
+type TypeSpec struct {
+	// Type is one of void, bool, byte, i8, i16, i32, i64, double, string, binary, struct, map, set and list
+	Type string `json:"type"`
+	// Elem is the type of the elements of list and set
+	Elem *TypeSpec `json:"elem,omitempty"`
+	// Key and Value are the types of map
+	Key   *TypeSpec `json:"key,omitempty"`
+	Value *TypeSpec `json:"value,omitempty"`
+	// Fields are the fields of struct
+	Fields []*FieldSpec `json:"fields,omitempty"`
+
+	id byte
+}
+
+// FieldSpec describes a field of struct, an argument or an exception of method
+type FieldSpec struct {
+	ID   int16  `json:"id"`
+	Name string `json:"name"`
+	TypeSpec
+}
+
+// MethodSpec is the signature of a method
+type MethodSpec struct {
+	Args []*FieldSpec `json:"args"`
+	// Result is the type of the return value, nil means void
+	Result *TypeSpec `json:"result"`
+	// Exceptions are the exceptions declared by the throws clause
+	Exceptions []*FieldSpec `json:"exceptions"`
+	// Oneway methods don't wait for the replies
+	Oneway bool `json:"oneway"`
+}
+
+func (t *TypeSpec) init() error {
+	id, ok := typeNames[t.Type]
+	if !ok {
+		return fmt.Errorf("unknown thrift type %q", t.Type)
+	}
+	t.id = id
+	switch id {
+	case typeList, typeSet:
+		if t.Elem == nil {
+			return fmt.Errorf("elem of %s is required", t.Type)
+		}
+		return t.Elem.init()
+	case typeMap:
+		if t.Key == nil || t.Value == nil {
+			return fmt.Errorf("key and value of map are required")
+		}
+		if err := t.Key.init(); err != nil {
+			return err
+		}
+		return t.Value.init()
+	case typeStruct:
+		return initFields(t.Fields)
+	}
+	return nil
+}
+
+func initFields(fields []*FieldSpec) error {
+	ids := make(map[int16]bool, len(fields))
+	for _, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("name of field %d is required", f.ID)
+		}
+		if ids[f.ID] {
+			return fmt.Errorf("duplicate field id %d", f.ID)
+		}
+		ids[f.ID] = true
+		if err := f.init(); err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		if f.id == typeVoid {
+			return fmt.Errorf("field %s can't be void", f.Name)
+		}
+	}
+	return nil
+}
+
+func (m *MethodSpec) init() error {
+	if err := initFields(m.Args); err != nil {
+		return err
+	}
+	if err := initFields(m.Exceptions); err != nil {
+		return err
+	}
+	if m.Result != nil {
+		return m.Result.init()
+	}
+	return nil
+}
+
+func (m *MethodSpec) void() bool {
+	return m.Result == nil || m.Result.id == typeVoid
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+
+	"mosn.io/layotto/components/pkg/egress"
 )
 
 // RPCHeader is storage header info
@@ -55,7 +57,10 @@ type RPCRequest struct {
 	// context
 	Ctx context.Context
 	// request id
-	Id          string
+	Id string
+	// Source is the id of InvokeService if the Id is rewritten to another target by the invoker, e.g. routed or resolved,
+	// and it's empty if the Id isn't rewritten
+	Source      string
 	Timeout     int32
 	Method      string
 	ContentType string
@@ -73,6 +78,8 @@ type RPCResponse struct {
 
 type RpcConfig struct {
 	Config json.RawMessage
+	// Egress is the egress policy of the runtime enforced by the http channels, which isn't enforced if it's nil
+	Egress *egress.Policy `json:"-"`
 }
 
 // Invoker is interface for init rpc config or invoke rpc request
@@ -81,6 +88,48 @@ type Invoker interface {
 	Invoke(ctx context.Context, req *RPCRequest) (*RPCResponse, error)
 }
 
+// CircuitBreakerEndpoint is an endpoint of a target with its own circuit breaker
+type CircuitBreakerEndpoint struct {
+	// Id is the target, i.e. the id of InvokeService
+	Id string
+	// Endpoint is the endpoint resolved by the invoker, it's empty if the endpoints of the target are balanced by MOSN
+	Endpoint string
+}
+
+// CircuitBreakerResetter is implemented by the invokers with circuit breakers
+type CircuitBreakerResetter interface {
+	// ResetCircuitBreaker closes the circuit breakers of the endpoints of the target, or all the targets if it's empty,
+	// and returns the endpoints of which the breakers were open.
+	ResetCircuitBreaker(target string) []CircuitBreakerEndpoint
+}
+
+// PayloadSchema is the schema of the payloads of a method of a target
+type PayloadSchema struct {
+	// Id is the target, i.e. the id of InvokeService
+	Id string
+	// Method is the method of the target, "*" is all the methods of it
+	Method string
+	// RequestType and ResponseType are the full names of the protobuf messages in the DescriptorSet
+	RequestType  string
+	ResponseType string
+	// DescriptorSet is the serialized FileDescriptorSet of the messages
+	DescriptorSet []byte
+	// RequestJSONSchema and ResponseJSONSchema are the JSON schemas of the payloads
+	RequestJSONSchema  string
+	ResponseJSONSchema string
+	// TargetFormat is the format of the payloads accepted by the target, "json" or "protobuf",
+	// the payloads in the other format are transcoded. The payloads aren't transcoded if it's empty.
+	TargetFormat string
+	// Mode is "enforce" or "warn"
+	Mode string
+}
+
+// PayloadSchemaProvider is implemented by the invokers validating the payloads by the schemas
+type PayloadSchemaProvider interface {
+	// PayloadSchemas returns the schemas of the target, or all the targets if it's empty
+	PayloadSchemas(target string) []*PayloadSchema
+}
+
 // Callback is interface for before invoke or after invoke
 type Callback interface {
 	// AddBeforeInvoke is add BeforeInvoke func
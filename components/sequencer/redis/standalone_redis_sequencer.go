@@ -16,13 +16,14 @@ package redis
 import (
 	"context"
 	"github.com/go-redis/redis/v8"
+	"mosn.io/layotto/components/pkg/schema"
 	"mosn.io/layotto/components/pkg/utils"
 	"mosn.io/layotto/components/sequencer"
 	"mosn.io/pkg/log"
 )
 
 type StandaloneRedisSequencer struct {
-	client     *redis.Client
+	client     redis.UniversalClient
 	metadata   utils.RedisMetadata
 	biggerThan map[string]int64
 
@@ -64,7 +65,7 @@ func (s *StandaloneRedisSequencer) Init(config sequencer.Configuration) error {
 	s.biggerThan = config.BiggerThan
 
 	// construct client
-	s.client = utils.NewRedisClient(m)
+	s.client = utils.AcquireRedisClient(m)
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	//check biggerThan, initialize if not satisfied
@@ -77,6 +78,9 @@ func (s *StandaloneRedisSequencer) Init(config sequencer.Configuration) error {
 		err = eval.Err()
 		//occur error,  such as value is string type
 		if err != nil {
+			// release the shared client, since the component won't be closed if Init fails
+			s.cancel()
+			s.client.Close()
 			return err
 		}
 		//As long as there is no error, the initialization is successful
@@ -117,6 +121,11 @@ func (s *StandaloneRedisSequencer) GetSegment(req *sequencer.GetSegmentRequest)
 		To:   by.Val(),
 	}, nil
 }
+// MetadataSchema declares the metadata fields of StandaloneRedisSequencer
+func (s *StandaloneRedisSequencer) MetadataSchema() *schema.Schema {
+	return utils.RedisMetadataSchema
+}
+
 func (s *StandaloneRedisSequencer) Close() error {
 	s.cancel()
 	return s.client.Close()
@@ -16,4 +16,41 @@ package sequencer
 type Config struct {
 	BiggerThan map[string]int64  `json:"biggerThan"`
 	Metadata   map[string]string `json:"metadata"`
+	// Shards spreads the allocation of the hot keys across several keys in the store
+	Shards []ShardConfig `json:"shards,omitempty"`
+	// Benchmark records the latency distribution of the allocation, which is reported by the actuator info endpoint
+	Benchmark bool `json:"benchmark,omitempty"`
+	// Fencing verifies the ids of STRONG auto increment against the high-watermark in a state store
+	Fencing *FencingConfig `json:"fencing,omitempty"`
+	// Region serves the ids from the blocks reserved by the sidecar, which are allocated from the store globally
+	Region *RegionConfig `json:"region,omitempty"`
+}
+
+// RegionConfig is the config of the region mode, which keeps allocating the unique ids during the partition from the store
+type RegionConfig struct {
+	// Name is the name of the region or the datacenter of the sidecar
+	Name string `json:"name"`
+	// BlockSize is the number of the ids in a block, 10000 by default
+	BlockSize int64 `json:"block_size,omitempty"`
+	// ReservedBlocks is the number of the blocks reserved ahead besides the block in use, 2 by default
+	ReservedBlocks int `json:"reserved_blocks,omitempty"`
+}
+
+// FencingConfig is the config of fencing, which prevents the ids going backwards after the failover of the store
+type FencingConfig struct {
+	// StateStore is the name of the state store saving the high-watermarks, it should support etag
+	StateStore string `json:"state_store"`
+	// MaxRetries is the max number of the ids allocated again if the id isn't above the watermark, 3 by default
+	MaxRetries int `json:"max_retries,omitempty"`
+}
+
+// ShardConfig shards the keys matching the pattern
+type ShardConfig struct {
+	// Pattern is matched against the key in the request, using the syntax of path.Match, e.g. "order_*"
+	Pattern string `json:"pattern"`
+	// Count is the number of the shards of a key
+	Count int `json:"count"`
+	// Merge is how the ids of the shards are merged into one id space, "interleave" by default.
+	// "interleave" returns id*count+shard, and "partition" puts the shard into the highest bits of the id.
+	Merge string `json:"merge,omitempty"`
 }
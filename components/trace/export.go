@@ -22,6 +22,12 @@ type Exporter interface {
 	ExportSpan(s *Span)
 }
 
+// ExporterInitializer is implemented by the exporters which need configuration.
+// Init is called with the config of the exporter when the tracer is created.
+type ExporterInitializer interface {
+	Init(config map[string]interface{}) error
+}
+
 var activeExporters []string
 
 var (
@@ -40,3 +40,20 @@ func TestExport(t *testing.T) {
 	span.FinishSpan()
 	assert.Equal(t, m.runtime, 1)
 }
+
+func TestExportSampled(t *testing.T) {
+	m := &MockExporter{}
+	SetActiveExporters([]string{"mock"})
+	RegisterExporter("mock", m)
+	defer UnregisterExporter("mock")
+
+	span := &Span{}
+	assert.True(t, span.Sampled())
+	span.SetSampled(false)
+	span.FinishSpan()
+	assert.Equal(t, 0, m.runtime)
+
+	span.SetSampled(true)
+	span.FinishSpan()
+	assert.Equal(t, 1, m.runtime)
+}
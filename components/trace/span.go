@@ -30,6 +30,8 @@ type Span struct {
 	parentSpanId  string
 	tags          [sofa.TRACE_END]string
 	operationName string
+	// dropped is true if the span isn't sampled, in which case it won't be exported
+	dropped bool
 }
 
 func (span *Span) SetTraceId(id string) {
@@ -71,8 +73,21 @@ func (span *Span) Tag(key uint64) string {
 	return span.tags[key]
 }
 
+// SetSampled decides whether the span will be exported when it's finished.
+// Spans are sampled by default.
+func (span *Span) SetSampled(sampled bool) {
+	span.dropped = !sampled
+}
+
+func (span *Span) Sampled() bool {
+	return !span.dropped
+}
+
 func (span *Span) FinishSpan() {
 	span.EndTime = time.Now()
+	if span.dropped {
+		return
+	}
 	for _, name := range activeExporters {
 		exporter := GetExporter(name)
 		if exporter == nil {
@@ -0,0 +1,133 @@
+package exporter_iml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	defaultQueueSize     = 1024
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultHTTPTimeout   = 5 * time.Second
+)
+
+// reporterConfig is the common config of the exporters reporting spans by http
+type reporterConfig struct {
+	Endpoint        string `json:"endpoint"`
+	QueueSize       int    `json:"queue_size"`
+	BatchSize       int    `json:"batch_size"`
+	FlushIntervalMs int    `json:"flush_interval_ms"`
+	TimeoutMs       int    `json:"timeout_ms"`
+}
+
+func parseReporterConfig(config map[string]interface{}, target interface{}) error {
+	if config == nil {
+		return nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// httpReporter collects the encoded spans in a queue, and posts them in batches by a background goroutine,
+// so that exporting never blocks the requests. The spans are dropped if the queue is full.
+type httpReporter struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+	queue         chan interface{}
+	stopCh        chan struct{}
+	// encode marshals a batch into the http body
+	encode func(batch []interface{}) ([]byte, error)
+}
+
+func newHTTPReporter(url string, cfg reporterConfig, encode func(batch []interface{}) ([]byte, error)) *httpReporter {
+	r := &httpReporter{
+		url:           url,
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushIntervalMs) * time.Millisecond,
+		client:        &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+		encode:        encode,
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.flushInterval <= 0 {
+		r.flushInterval = defaultFlushInterval
+	}
+	if r.client.Timeout <= 0 {
+		r.client.Timeout = defaultHTTPTimeout
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	r.queue = make(chan interface{}, queueSize)
+	r.stopCh = make(chan struct{})
+	utils.GoWithRecover(r.run, nil)
+	return r
+}
+
+func (r *httpReporter) report(span interface{}) {
+	select {
+	case r.queue <- span:
+	default:
+		log.DefaultLogger.Warnf("[tracing] the queue of %s is full, drop the span", r.url)
+	}
+}
+
+func (r *httpReporter) run() {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+	batch := make([]interface{}, 0, r.batchSize)
+	for {
+		select {
+		case span := <-r.queue:
+			batch = append(batch, span)
+			if len(batch) < r.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-r.stopCh:
+			return
+		}
+		if err := r.send(batch); err != nil {
+			log.DefaultLogger.Errorf("[tracing] fail to report %d spans to %s: %v", len(batch), r.url, err)
+		}
+		batch = make([]interface{}, 0, r.batchSize)
+	}
+}
+
+// stop discards the spans in the queue, it's called when the exporter is initialized again
+func (r *httpReporter) stop() {
+	close(r.stopCh)
+}
+
+func (r *httpReporter) send(batch []interface{}) error {
+	body, err := r.encode(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
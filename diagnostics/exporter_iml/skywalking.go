@@ -0,0 +1,140 @@
+package exporter_iml
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"mosn.io/layotto/components/trace"
+)
+
+func init() {
+	trace.RegisterExporter("skywalking", &SkyWalkingExporter{})
+}
+
+const (
+	defaultSkyWalkingEndpoint = "http://127.0.0.1:12800"
+	skyWalkingSegmentsPath    = "/v3/segments"
+	// the component id of grpc in skywalking
+	skyWalkingGrpcComponentID = 23
+)
+
+//SkyWalkingExporter is the implementation of Exporter, report spans to the http receiver of skywalking oap server
+type SkyWalkingExporter struct {
+	mu       sync.RWMutex
+	service  string
+	instance string
+	reporter *httpReporter
+}
+
+var _ trace.Exporter = &SkyWalkingExporter{}
+var _ trace.ExporterInitializer = &SkyWalkingExporter{}
+
+type skyWalkingConfig struct {
+	reporterConfig
+	Service  string `json:"service"`
+	Instance string `json:"instance"`
+}
+
+type skyWalkingTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type skyWalkingSpan struct {
+	OperationName string          `json:"operationName"`
+	StartTime     int64           `json:"startTime"`
+	EndTime       int64           `json:"endTime"`
+	SpanType      string          `json:"spanType"`
+	SpanLayer     string          `json:"spanLayer"`
+	ComponentID   int             `json:"componentId"`
+	IsError       bool            `json:"isError"`
+	SpanID        int             `json:"spanId"`
+	ParentSpanID  int             `json:"parentSpanId"`
+	Tags          []skyWalkingTag `json:"tags,omitempty"`
+}
+
+type skyWalkingSegment struct {
+	TraceID         string            `json:"traceId"`
+	TraceSegmentID  string            `json:"traceSegmentId"`
+	Service         string            `json:"service"`
+	ServiceInstance string            `json:"serviceInstance"`
+	Spans           []*skyWalkingSpan `json:"spans"`
+}
+
+// Init creates the reporter, the config can be like {"endpoint": "http://127.0.0.1:12800", "service": "layotto"}.
+// The instance is the hostname by default.
+func (e *SkyWalkingExporter) Init(config map[string]interface{}) error {
+	var cfg skyWalkingConfig
+	if err := parseReporterConfig(config, &cfg); err != nil {
+		return err
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultSkyWalkingEndpoint
+	}
+	if cfg.Service == "" {
+		cfg.Service = defaultServiceName
+	}
+	if cfg.Instance == "" {
+		cfg.Instance, _ = os.Hostname()
+	}
+	url := strings.TrimSuffix(cfg.Endpoint, "/") + skyWalkingSegmentsPath
+	reporter := newHTTPReporter(url, cfg.reporterConfig, func(batch []interface{}) ([]byte, error) {
+		return json.Marshal(batch)
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.reporter != nil {
+		e.reporter.stop()
+	}
+	e.service = cfg.Service
+	e.instance = cfg.Instance
+	e.reporter = reporter
+	return nil
+}
+
+// ExportSpan converts the span into a segment of skywalking and reports it asynchronously
+func (e *SkyWalkingExporter) ExportSpan(sd *trace.Span) {
+	e.mu.RLock()
+	reporter, service, instance := e.reporter, e.service, e.instance
+	e.mu.RUnlock()
+	if reporter == nil {
+		return
+	}
+	reporter.report(toSkyWalkingSegment(sd, service, instance))
+}
+
+// toSkyWalkingSegment converts the span into a segment with a single entry span,
+// since a span of layotto is the server side of a grpc call.
+func toSkyWalkingSegment(sd *trace.Span, service string, instance string) *skyWalkingSegment {
+	tags := spanTags(sd)
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	span := &skyWalkingSpan{
+		OperationName: sd.Tag(trace.LAYOTTO_METHOD_NAME),
+		StartTime:     sd.StartTime.UnixNano() / 1e6,
+		EndTime:       sd.EndTime.UnixNano() / 1e6,
+		SpanType:      "Entry",
+		SpanLayer:     "RPCFramework",
+		ComponentID:   skyWalkingGrpcComponentID,
+		IsError:       sd.Tag(trace.LAYOTTO_REQUEST_RESULT) == "1",
+		SpanID:        0,
+		ParentSpanID:  -1,
+	}
+	for _, k := range keys {
+		span.Tags = append(span.Tags, skyWalkingTag{Key: k, Value: tags[k]})
+	}
+	return &skyWalkingSegment{
+		TraceID:         sd.TraceId(),
+		TraceSegmentID:  sd.TraceId() + "." + sd.SpanId(),
+		Service:         service,
+		ServiceInstance: instance,
+		Spans:           []*skyWalkingSpan{span},
+	}
+}
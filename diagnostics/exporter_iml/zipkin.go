@@ -0,0 +1,138 @@
+package exporter_iml
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"mosn.io/layotto/components/trace"
+)
+
+func init() {
+	trace.RegisterExporter("zipkin", &ZipkinExporter{})
+}
+
+const (
+	defaultZipkinEndpoint = "http://127.0.0.1:9411/api/v2/spans"
+	defaultServiceName    = "layotto"
+)
+
+//ZipkinExporter is the implementation of Exporter, report spans to zipkin by the json v2 api
+type ZipkinExporter struct {
+	mu          sync.RWMutex
+	serviceName string
+	reporter    *httpReporter
+}
+
+var _ trace.Exporter = &ZipkinExporter{}
+var _ trace.ExporterInitializer = &ZipkinExporter{}
+
+type zipkinConfig struct {
+	reporterConfig
+	ServiceName string `json:"service_name"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// Init creates the reporter, the config can be like {"endpoint": "http://127.0.0.1:9411/api/v2/spans", "service_name": "layotto"}
+func (e *ZipkinExporter) Init(config map[string]interface{}) error {
+	var cfg zipkinConfig
+	if err := parseReporterConfig(config, &cfg); err != nil {
+		return err
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultZipkinEndpoint
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+	reporter := newHTTPReporter(cfg.Endpoint, cfg.reporterConfig, func(batch []interface{}) ([]byte, error) {
+		return json.Marshal(batch)
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.reporter != nil {
+		e.reporter.stop()
+	}
+	e.serviceName = cfg.ServiceName
+	e.reporter = reporter
+	return nil
+}
+
+// ExportSpan converts the span into zipkin format and reports it asynchronously
+func (e *ZipkinExporter) ExportSpan(sd *trace.Span) {
+	e.mu.RLock()
+	reporter, serviceName := e.reporter, e.serviceName
+	e.mu.RUnlock()
+	if reporter == nil {
+		return
+	}
+	reporter.report(toZipkinSpan(sd, serviceName))
+}
+
+func toZipkinSpan(sd *trace.Span, serviceName string) *zipkinSpan {
+	span := &zipkinSpan{
+		TraceID:       normalizeID(sd.TraceId(), 32),
+		ID:            normalizeID(sd.SpanId(), 16),
+		Name:          sd.Tag(trace.LAYOTTO_METHOD_NAME),
+		Kind:          "SERVER",
+		Timestamp:     sd.StartTime.UnixNano() / 1000,
+		Duration:      sd.EndTime.Sub(sd.StartTime).Nanoseconds() / 1000,
+		LocalEndpoint: zipkinEndpoint{ServiceName: serviceName},
+		Tags:          spanTags(sd),
+	}
+	if sd.ParentSpanId() != "" && sd.ParentSpanId() != sd.SpanId() {
+		span.ParentID = normalizeID(sd.ParentSpanId(), 16)
+	}
+	return span
+}
+
+// spanTags collects the tags of layotto, and keeps the original ids since they may be changed by normalizeID
+func spanTags(sd *trace.Span) map[string]string {
+	tags := map[string]string{
+		"layotto.trace_id": sd.TraceId(),
+		"layotto.span_id":  sd.SpanId(),
+		"layotto.result":   sd.Tag(trace.LAYOTTO_REQUEST_RESULT),
+	}
+	if v := sd.Tag(trace.LAYOTTO_APP_NAME); v != "" {
+		tags["layotto.app_name"] = v
+	}
+	if v := sd.Tag(trace.LAYOTTO_COMPONENT_DETAIL); v != "" {
+		tags["layotto.component"] = v
+	}
+	if sd.Tag(trace.LAYOTTO_REQUEST_RESULT) == "1" {
+		tags["error"] = "true"
+	}
+	return tags
+}
+
+// normalizeID converts the id into a lower hex string of the length, which is required by zipkin.
+// A hex id is left padded with zeros, and the other ids, e.g. the rpc ids like "0.1", are hashed.
+func normalizeID(id string, length int) string {
+	id = strings.ToLower(id)
+	if len(id) > 0 && len(id) <= length {
+		if _, err := hex.DecodeString(strings.Repeat("0", len(id)%2) + id); err == nil {
+			return strings.Repeat("0", length-len(id)) + id
+		}
+	}
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(id))
+	return hex.EncodeToString(h.Sum(nil))[:length]
+}
@@ -0,0 +1,68 @@
+package exporter_iml
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/trace"
+)
+
+func newTestSpan() *trace.Span {
+	span := &trace.Span{StartTime: time.Unix(1, 0), EndTime: time.Unix(1, int64(5*time.Millisecond))}
+	span.SetTraceId("0a0fe8f1163434567890abcd")
+	span.SetSpanId("0.1")
+	span.SetParentSpanId("0")
+	span.SetTag(trace.LAYOTTO_METHOD_NAME, "/spec.proto.runtime.v1.Runtime/SayHello")
+	span.SetTag(trace.LAYOTTO_REQUEST_RESULT, "1")
+	return span
+}
+
+func TestZipkinExporter(t *testing.T) {
+	received := make(chan []zipkinSpan, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var spans []zipkinSpan
+		assert.Nil(t, json.Unmarshal(body, &spans))
+		received <- spans
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	e := &ZipkinExporter{}
+	err := e.Init(map[string]interface{}{"endpoint": server.URL, "batch_size": 1, "service_name": "app"})
+	assert.Nil(t, err)
+	defer e.reporter.stop()
+	e.ExportSpan(newTestSpan())
+
+	select {
+	case spans := <-received:
+		assert.Len(t, spans, 1)
+		s := spans[0]
+		assert.Equal(t, "000000000a0fe8f1163434567890abcd", s.TraceID)
+		assert.Len(t, s.ID, 16)
+		assert.Equal(t, normalizeID("0", 16), s.ParentID)
+		assert.Equal(t, "app", s.LocalEndpoint.ServiceName)
+		assert.Equal(t, int64(1000000), s.Timestamp)
+		assert.Equal(t, int64(5000), s.Duration)
+		assert.Equal(t, "true", s.Tags["error"])
+		assert.Equal(t, "0.1", s.Tags["layotto.span_id"])
+	case <-time.After(3 * time.Second):
+		t.Fatal("spans not reported")
+	}
+}
+
+func TestSkyWalkingSegment(t *testing.T) {
+	seg := toSkyWalkingSegment(newTestSpan(), "layotto", "host")
+	assert.Equal(t, "0a0fe8f1163434567890abcd", seg.TraceID)
+	assert.Equal(t, "0a0fe8f1163434567890abcd.0.1", seg.TraceSegmentID)
+	assert.Len(t, seg.Spans, 1)
+	assert.Equal(t, "/spec.proto.runtime.v1.Runtime/SayHello", seg.Spans[0].OperationName)
+	assert.Equal(t, int64(5), seg.Spans[0].EndTime-seg.Spans[0].StartTime)
+	assert.True(t, seg.Spans[0].IsError)
+}
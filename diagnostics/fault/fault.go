@@ -0,0 +1,327 @@
+package fault
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mosn.io/pkg/log"
+)
+
+const (
+	// runtimeServicePrefix is the prefix of the methods injected, the other services, e.g. the Admin service, are never injected
+	runtimeServicePrefix  = "/spec.proto.runtime.v1.Runtime/"
+	defaultErrorMessage   = "the error is injected by fault injection"
+	abortedMessage        = "the response is aborted by fault injection"
+	maxDelay              = time.Minute
+	maxPercent            = 100
+	percentRandomExcluded = 100
+)
+
+// Config is the config of fault injection, which injects delays, errors and aborts into the Runtime API
+// for chaos experiments, without modifying the apps or the backends.
+type Config struct {
+	// Enabled injects the faults of the rules, it can be toggled by the Admin service at runtime
+	Enabled bool `json:"enabled"`
+	// Rules are matched in order, and the first matched one is applied
+	Rules []*Rule `json:"rules"`
+}
+
+// Rule is the faults injected into the requests matched. The percentages are 0 ~ 100, and 0 never injects the fault.
+type Rule struct {
+	// Name identifies the rule in the logs
+	Name string `json:"name"`
+	// Methods are the methods of the Runtime API matched, e.g. "GetState", all of them are matched if it's empty
+	Methods []string `json:"methods"`
+	// Components are the names of the components matched, e.g. the store_name of GetState, all of them are matched if it's empty.
+	// They're matched by the requests of the unary methods only, so a rule with components never matches the streaming methods.
+	Components []string `json:"components"`
+	// DelayMs delays the requests before they're handled, at most 1 minute
+	DelayMs      int     `json:"delay_ms"`
+	DelayPercent float64 `json:"delay_percent"`
+	// ErrorCode fails the requests without handling them, it's the name or the number of the gRPC code, e.g. "UNAVAILABLE" or "14"
+	ErrorCode    string  `json:"error_code"`
+	ErrorMessage string  `json:"error_message"`
+	ErrorPercent float64 `json:"error_percent"`
+	// AbortPercent drops the responses after the requests are handled and fails them with UNAVAILABLE,
+	// so that the clients see failures of the requests which take effect, like a broken connection.
+	AbortPercent float64 `json:"abort_percent"`
+}
+
+// rule is the Rule validated
+type rule struct {
+	*Rule
+	methods    map[string]bool
+	components map[string]bool
+	delay      time.Duration
+	code       codes.Code
+}
+
+func (r *Rule) compile() (*rule, error) {
+	for _, p := range []float64{r.DelayPercent, r.ErrorPercent, r.AbortPercent} {
+		if p < 0 || p > maxPercent {
+			return nil, fmt.Errorf("the percentages of fault rule %s should be 0 ~ 100", r.Name)
+		}
+	}
+	if r.DelayMs < 0 {
+		return nil, fmt.Errorf("delay_ms of fault rule %s can't be negative", r.Name)
+	}
+	c := &rule{Rule: r, delay: time.Duration(r.DelayMs) * time.Millisecond}
+	if c.delay > maxDelay {
+		c.delay = maxDelay
+	}
+	if r.ErrorPercent > 0 {
+		code, err := ParseCode(r.ErrorCode)
+		if err != nil || code == codes.OK {
+			return nil, fmt.Errorf("error_code of fault rule %s is invalid: %q", r.Name, r.ErrorCode)
+		}
+		c.code = code
+	}
+	if (c.delay == 0 || r.DelayPercent == 0) && r.ErrorPercent == 0 && r.AbortPercent == 0 {
+		return nil, fmt.Errorf("fault rule %s injects nothing", r.Name)
+	}
+	if len(r.Methods) > 0 {
+		c.methods = make(map[string]bool, len(r.Methods))
+		for _, m := range r.Methods {
+			c.methods[strings.TrimPrefix(m, runtimeServicePrefix)] = true
+		}
+	}
+	if len(r.Components) > 0 {
+		c.components = make(map[string]bool, len(r.Components))
+		for _, name := range r.Components {
+			c.components[name] = true
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether the rule matches the method, the req is nil for the streaming methods
+func (r *rule) matches(method string, req interface{}) bool {
+	if r.methods != nil && !r.methods[method] {
+		return false
+	}
+	if r.components == nil {
+		return true
+	}
+	name, ok := componentOf(req)
+	return ok && r.components[name]
+}
+
+// ParseCode parses the gRPC code by the name, e.g. "UNAVAILABLE", or the number, e.g. "14"
+func ParseCode(v string) (codes.Code, error) {
+	var code codes.Code
+	if n, err := strconv.Atoi(v); err == nil {
+		v = strconv.Itoa(n)
+	} else {
+		v = strconv.Quote(strings.ToUpper(v))
+	}
+	err := code.UnmarshalJSON([]byte(v))
+	return code, err
+}
+
+// Injector injects the faults into the grpc server by the interceptors
+type Injector struct {
+	mu      sync.RWMutex
+	enabled bool
+	rules   []*rule
+	// random returns a number in [0, 100), replaced in tests
+	random func() float64
+}
+
+// New creates the injector with the config
+func New(cfg *Config) (*Injector, error) {
+	i := &Injector{
+		random: func() float64 {
+			return rand.Float64() * percentRandomExcluded
+		},
+	}
+	if err := i.Update(cfg.Enabled, cfg.Rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Update enables or disables the injection, and replaces the rules
+func (i *Injector) Update(enabled bool, rules []*Rule) error {
+	compiled := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		if r == nil {
+			return fmt.Errorf("fault rule can't be empty")
+		}
+		c, err := r.compile()
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+	i.mu.Lock()
+	i.enabled = enabled
+	i.rules = compiled
+	i.mu.Unlock()
+	log.DefaultLogger.Infof("[fault] fault injection is updated, enabled: %v, rules: %d", enabled, len(rules))
+	return nil
+}
+
+// SetEnabled enables or disables the injection and keeps the rules
+func (i *Injector) SetEnabled(enabled bool) {
+	i.mu.Lock()
+	i.enabled = enabled
+	i.mu.Unlock()
+	log.DefaultLogger.Infof("[fault] fault injection is updated, enabled: %v", enabled)
+}
+
+// Config returns the current config of the injection
+func (i *Injector) Config() *Config {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	cfg := &Config{Enabled: i.enabled, Rules: make([]*Rule, 0, len(i.rules))}
+	for _, r := range i.rules {
+		cfg.Rules = append(cfg.Rules, r.Rule)
+	}
+	return cfg
+}
+
+// faults is the faults decided for a request
+type faults struct {
+	rule  *rule
+	delay time.Duration
+	err   error
+	abort bool
+}
+
+// decide rolls the faults of the first rule matching the request
+func (i *Injector) decide(fullMethod string, req interface{}) *faults {
+	if !strings.HasPrefix(fullMethod, runtimeServicePrefix) {
+		return nil
+	}
+	method := strings.TrimPrefix(fullMethod, runtimeServicePrefix)
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if !i.enabled {
+		return nil
+	}
+	for _, r := range i.rules {
+		if !r.matches(method, req) {
+			continue
+		}
+		f := &faults{rule: r}
+		if r.delay > 0 && i.random() < r.DelayPercent {
+			f.delay = r.delay
+		}
+		if r.ErrorPercent > 0 && i.random() < r.ErrorPercent {
+			msg := r.ErrorMessage
+			if msg == "" {
+				msg = defaultErrorMessage
+			}
+			f.err = status.Error(r.code, msg)
+		} else if r.AbortPercent > 0 && i.random() < r.AbortPercent {
+			f.abort = true
+		}
+		if f.delay == 0 && f.err == nil && !f.abort {
+			return nil
+		}
+		log.DefaultLogger.Debugf("[fault] inject faults of rule %s into %s, delay: %v, error: %v, abort: %v", r.Name, method, f.delay, f.err, f.abort)
+		return f
+	}
+	return nil
+}
+
+// before delays the request and returns the error injected, which fails the request without handling it
+func (f *faults) before(ctx context.Context) error {
+	if f.delay > 0 {
+		timer := time.NewTimer(f.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return f.err
+}
+
+// UnaryInterceptor is an implementation of grpc.UnaryServerInterceptor
+func (i *Injector) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	f := i.decide(info.FullMethod, req)
+	if f == nil {
+		return handler(ctx, req)
+	}
+	if err := f.before(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	if f.abort {
+		return nil, status.Error(codes.Unavailable, abortedMessage)
+	}
+	return resp, err
+}
+
+// StreamInterceptor is an implementation of grpc.StreamServerInterceptor.
+// The streams are aborted when the first message is sent, i.e. after the request is handled.
+func (i *Injector) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	f := i.decide(info.FullMethod, nil)
+	if f == nil {
+		return handler(srv, ss)
+	}
+	if err := f.before(ss.Context()); err != nil {
+		return err
+	}
+	if !f.abort {
+		return handler(srv, ss)
+	}
+	as := &abortedStream{ServerStream: ss}
+	err := handler(srv, as)
+	if as.aborted {
+		return status.Error(codes.Unavailable, abortedMessage)
+	}
+	return err
+}
+
+// abortedStream fails to send the messages
+type abortedStream struct {
+	grpc.ServerStream
+	aborted bool
+}
+
+func (s *abortedStream) SendMsg(m interface{}) error {
+	s.aborted = true
+	return status.Error(codes.Unavailable, abortedMessage)
+}
+
+type storeNameGetter interface {
+	GetStoreName() string
+}
+
+type pubsubNameGetter interface {
+	GetPubsubName() string
+}
+
+type componentNameGetter interface {
+	GetComponentName() string
+}
+
+type serviceNameGetter interface {
+	GetServiceName() string
+}
+
+// componentOf returns the name of the component requested
+func componentOf(req interface{}) (string, bool) {
+	switch r := req.(type) {
+	case storeNameGetter:
+		return r.GetStoreName(), true
+	case pubsubNameGetter:
+		return r.GetPubsubName(), true
+	case componentNameGetter:
+		return r.GetComponentName(), true
+	case serviceNameGetter:
+		return r.GetServiceName(), true
+	}
+	return "", false
+}
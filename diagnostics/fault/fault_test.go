@@ -0,0 +1,151 @@
+package fault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestParseCode(t *testing.T) {
+	code, err := ParseCode("UNAVAILABLE")
+	assert.Nil(t, err)
+	assert.Equal(t, codes.Unavailable, code)
+	code, err = ParseCode("resource_exhausted")
+	assert.Nil(t, err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	code, err = ParseCode("4")
+	assert.Nil(t, err)
+	assert.Equal(t, codes.DeadlineExceeded, code)
+	_, err = ParseCode("BROKEN")
+	assert.NotNil(t, err)
+	_, err = ParseCode("100")
+	assert.NotNil(t, err)
+}
+
+func TestNew(t *testing.T) {
+	for _, r := range []*Rule{
+		{Name: "nothing"},
+		{Name: "no percent", DelayMs: 100},
+		{Name: "percent", DelayMs: 100, DelayPercent: 101},
+		{Name: "negative", DelayMs: -1, DelayPercent: 10},
+		{Name: "code", ErrorCode: "BROKEN", ErrorPercent: 10},
+		{Name: "ok", ErrorCode: "OK", ErrorPercent: 10},
+	} {
+		_, err := New(&Config{Rules: []*Rule{r}})
+		assert.NotNil(t, err, r.Name)
+	}
+	i, err := New(&Config{Enabled: true, Rules: []*Rule{{Name: "abort", AbortPercent: 1}}})
+	assert.Nil(t, err)
+	assert.True(t, i.Config().Enabled)
+	assert.Equal(t, "abort", i.Config().Rules[0].Name)
+}
+
+func newInjector(t *testing.T, rules ...*Rule) *Injector {
+	i, err := New(&Config{Enabled: true, Rules: rules})
+	assert.Nil(t, err)
+	// roll 50 every time
+	i.random = func() float64 {
+		return 50
+	}
+	return i
+}
+
+func unary(i *Injector, ctx context.Context, method string, req interface{}) (bool, error) {
+	handled := false
+	_, err := i.UnaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return "resp", nil
+	})
+	return handled, err
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	i := newInjector(t,
+		&Rule{Name: "redis", Methods: []string{"GetState"}, Components: []string{"redis"}, ErrorCode: "UNAVAILABLE", ErrorMessage: "redis is down", ErrorPercent: 60},
+		&Rule{Name: "rare", Methods: []string{"/spec.proto.runtime.v1.Runtime/GetState"}, ErrorCode: "INTERNAL", ErrorPercent: 40},
+		&Rule{Name: "abort", Methods: []string{"PublishEvent"}, AbortPercent: 100},
+	)
+	ctx := context.Background()
+
+	handled, err := unary(i, ctx, "/spec.proto.runtime.v1.Runtime/GetState", &runtimev1pb.GetStateRequest{StoreName: "redis"})
+	assert.False(t, handled)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "redis is down", status.Convert(err).Message())
+	// the first rule matched is applied only, and 50 isn't less than 40
+	handled, err = unary(i, ctx, "/spec.proto.runtime.v1.Runtime/GetState", &runtimev1pb.GetStateRequest{StoreName: "mongo"})
+	assert.True(t, handled)
+	assert.Nil(t, err)
+
+	handled, err = unary(i, ctx, "/spec.proto.runtime.v1.Runtime/PublishEvent", &runtimev1pb.PublishEventRequest{PubsubName: "kafka"})
+	assert.True(t, handled)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// the other services are never injected
+	handled, err = unary(i, ctx, "/spec.proto.runtime.v1.Admin/PublishEvent", nil)
+	assert.True(t, handled)
+	assert.Nil(t, err)
+
+	i.SetEnabled(false)
+	handled, err = unary(i, ctx, "/spec.proto.runtime.v1.Runtime/PublishEvent", &runtimev1pb.PublishEventRequest{PubsubName: "kafka"})
+	assert.True(t, handled)
+	assert.Nil(t, err)
+}
+
+func TestUnaryInterceptor_Delay(t *testing.T) {
+	i := newInjector(t, &Rule{Name: "slow", DelayMs: 20, DelayPercent: 100})
+	start := time.Now()
+	handled, err := unary(i, context.Background(), "/spec.proto.runtime.v1.Runtime/SayHello", nil)
+	assert.True(t, handled)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	assert.Nil(t, i.Update(true, []*Rule{{Name: "slower", DelayMs: 60000, DelayPercent: 100}}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	handled, err = unary(i, ctx, "/spec.proto.runtime.v1.Runtime/SayHello", nil)
+	assert.False(t, handled)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.MD{})
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	i := newInjector(t,
+		&Rule{Name: "components", Components: []string{"redis"}, ErrorCode: "UNAVAILABLE", ErrorPercent: 100},
+		&Rule{Name: "abort", Methods: []string{"GetFile"}, AbortPercent: 100},
+	)
+	info := &grpc.StreamServerInfo{FullMethod: "/spec.proto.runtime.v1.Runtime/GetFile"}
+	ss := &fakeServerStream{}
+	err := i.StreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return stream.SendMsg("chunk")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 0, ss.sent)
+
+	info.FullMethod = "/spec.proto.runtime.v1.Runtime/PutFile"
+	err = i.StreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return stream.SendMsg("resp")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ss.sent)
+}
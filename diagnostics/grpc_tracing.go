@@ -7,6 +7,7 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 
 	"google.golang.org/grpc"
+	"mosn.io/api"
 	ltrace "mosn.io/layotto/components/trace"
 	"mosn.io/mosn/pkg/trace"
 )
@@ -20,6 +21,7 @@ func UnaryInterceptorFilter(ctx context.Context, req interface{}, info *grpc.Una
 	tracer := trace.Tracer("layotto")
 	span := tracer.Start(ctx, req, time.Now())
 	defer span.FinishSpan()
+	setSampled(span, info.FullMethod)
 	span.SetTag(ltrace.LAYOTTO_METHOD_NAME, info.FullMethod)
 	span.SetTag(ltrace.LAYOTTO_REQUEST_RESULT, "0")
 	ctx = GetNewContext(ctx, span)
@@ -39,6 +41,7 @@ func StreamInterceptorFilter(srv interface{}, ss grpc.ServerStream, info *grpc.S
 	ctx := ss.Context()
 	span := tracer.Start(ctx, nil, time.Now())
 	defer span.FinishSpan()
+	setSampled(span, info.FullMethod)
 	span.SetTag(ltrace.LAYOTTO_METHOD_NAME, info.FullMethod)
 	span.SetTag(ltrace.LAYOTTO_REQUEST_RESULT, "0")
 	wrapped := grpc_middleware.WrapServerStream(ss)
@@ -50,3 +53,10 @@ func StreamInterceptorFilter(srv interface{}, ss grpc.ServerStream, info *grpc.S
 	}
 	return err
 }
+
+// setSampled marks the span as not sampled, so that it won't be exported if the sampler drops it
+func setSampled(span api.Span, method string) {
+	if s, ok := span.(*ltrace.Span); ok {
+		s.SetSampled(ShouldSample(method))
+	}
+}
@@ -0,0 +1,168 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mosn.io/pkg/log"
+)
+
+const (
+	Sampler = "sampler"
+
+	SamplerAlways        = "always"
+	SamplerNever         = "never"
+	SamplerProbabilistic = "probabilistic"
+	SamplerRateLimiting  = "rate_limiting"
+)
+
+// SamplerConfig is the sampling strategy.
+// Param is the sampling rate for the probabilistic sampler, and the max number of traces per second for the rate limiting sampler.
+// PerApi overrides the strategy for the specified grpc methods, e.g. "/spec.proto.runtime.v1.Runtime/SayHello".
+type SamplerConfig struct {
+	Type   string                   `json:"type"`
+	Param  float64                  `json:"param"`
+	PerApi map[string]SamplerConfig `json:"per_api,omitempty"`
+}
+
+//TraceSampler decides whether the trace of a grpc method should be exported
+type TraceSampler interface {
+	Sample(method string) bool
+}
+
+var (
+	activeSampler     TraceSampler = alwaysSampler(true)
+	activeSamplerLock sync.RWMutex
+)
+
+func setActiveSampler(s TraceSampler) {
+	activeSamplerLock.Lock()
+	activeSampler = s
+	activeSamplerLock.Unlock()
+}
+
+// ShouldSample decides whether the trace of the method should be exported by the active sampler
+func ShouldSample(method string) bool {
+	activeSamplerLock.RLock()
+	s := activeSampler
+	activeSamplerLock.RUnlock()
+	return s.Sample(method)
+}
+
+func getSamplerFromConfig(config map[string]interface{}) (TraceSampler, error) {
+	v, ok := config[Sampler]
+	if !ok {
+		return alwaysSampler(true), nil
+	}
+	var cfg SamplerConfig
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return NewSampler(cfg)
+}
+
+// NewSampler creates a sampler according to the config, the default strategy is always.
+func NewSampler(cfg SamplerConfig) (TraceSampler, error) {
+	def, err := newBaseSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.PerApi) == 0 {
+		return def, nil
+	}
+	s := &perApiSampler{defaultSampler: def, samplers: make(map[string]TraceSampler, len(cfg.PerApi))}
+	for method, c := range cfg.PerApi {
+		if s.samplers[method], err = newBaseSampler(c); err != nil {
+			return nil, fmt.Errorf("invalid sampler of %s: %v", method, err)
+		}
+	}
+	return s, nil
+}
+
+func newBaseSampler(cfg SamplerConfig) (TraceSampler, error) {
+	switch cfg.Type {
+	case "", SamplerAlways:
+		return alwaysSampler(true), nil
+	case SamplerNever:
+		return alwaysSampler(false), nil
+	case SamplerProbabilistic:
+		if cfg.Param < 0 || cfg.Param > 1 {
+			return nil, fmt.Errorf("sampling rate should be in [0, 1], but got %v", cfg.Param)
+		}
+		return probabilisticSampler(cfg.Param), nil
+	case SamplerRateLimiting:
+		if cfg.Param <= 0 {
+			return nil, fmt.Errorf("traces per second should be positive, but got %v", cfg.Param)
+		}
+		return newRateLimitingSampler(cfg.Param), nil
+	default:
+		return nil, fmt.Errorf("not support sampler type: %s", cfg.Type)
+	}
+}
+
+type alwaysSampler bool
+
+func (s alwaysSampler) Sample(method string) bool {
+	return bool(s)
+}
+
+type probabilisticSampler float64
+
+func (s probabilisticSampler) Sample(method string) bool {
+	return rand.Float64() < float64(s)
+}
+
+// rateLimitingSampler samples at most `perSecond` traces every second
+type rateLimitingSampler struct {
+	perSecond int64
+	// window is the unix second of current window
+	window int64
+	count  int64
+}
+
+func newRateLimitingSampler(perSecond float64) *rateLimitingSampler {
+	n := int64(perSecond)
+	if n < 1 {
+		n = 1
+	}
+	return &rateLimitingSampler{perSecond: n}
+}
+
+func (s *rateLimitingSampler) Sample(method string) bool {
+	now := time.Now().Unix()
+	window := atomic.LoadInt64(&s.window)
+	if now != window && atomic.CompareAndSwapInt64(&s.window, window, now) {
+		atomic.StoreInt64(&s.count, 0)
+	}
+	return atomic.AddInt64(&s.count, 1) <= s.perSecond
+}
+
+type perApiSampler struct {
+	defaultSampler TraceSampler
+	samplers       map[string]TraceSampler
+}
+
+func (s *perApiSampler) Sample(method string) bool {
+	if sampler, ok := s.samplers[method]; ok {
+		return sampler.Sample(method)
+	}
+	return s.defaultSampler.Sample(method)
+}
+
+// initSampler replaces the active sampler, and keeps the old one if the config is invalid
+func initSampler(config map[string]interface{}) {
+	s, err := getSamplerFromConfig(config)
+	if err != nil {
+		log.DefaultLogger.Errorf("[tracing] invalid sampler config: %v", err)
+		return
+	}
+	setActiveSampler(s)
+}
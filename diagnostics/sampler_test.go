@@ -0,0 +1,55 @@
+package diagnostics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampler(t *testing.T) {
+	t.Run("default is always", func(t *testing.T) {
+		s, err := getSamplerFromConfig(map[string]interface{}{})
+		assert.Nil(t, err)
+		assert.True(t, s.Sample("/a"))
+	})
+
+	t.Run("per api", func(t *testing.T) {
+		s, err := getSamplerFromConfig(map[string]interface{}{
+			Sampler: map[string]interface{}{
+				"type": SamplerNever,
+				"per_api": map[string]interface{}{
+					"/a": map[string]interface{}{"type": SamplerProbabilistic, "param": 1},
+					"/b": map[string]interface{}{"type": SamplerRateLimiting, "param": 2},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.False(t, s.Sample("/c"))
+		assert.True(t, s.Sample("/a"))
+		// at most 2 traces every second, and the calls may cross 2 windows
+		sampled := 0
+		for i := 0; i < 10; i++ {
+			if s.Sample("/b") {
+				sampled++
+			}
+		}
+		assert.True(t, sampled >= 2 && sampled <= 4)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewSampler(SamplerConfig{Type: SamplerProbabilistic, Param: 2})
+		assert.NotNil(t, err)
+		_, err = NewSampler(SamplerConfig{Type: SamplerRateLimiting})
+		assert.NotNil(t, err)
+		_, err = NewSampler(SamplerConfig{PerApi: map[string]SamplerConfig{"/a": {Type: "unknown"}}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("invalid config keeps the active sampler", func(t *testing.T) {
+		defer setActiveSampler(alwaysSampler(true))
+		initSampler(map[string]interface{}{Sampler: map[string]interface{}{"type": SamplerNever}})
+		assert.False(t, ShouldSample("/a"))
+		initSampler(map[string]interface{}{Sampler: map[string]interface{}{"type": "unknown"}})
+		assert.False(t, ShouldSample("/a"))
+	})
+}
@@ -24,10 +24,31 @@ type grpcTracer struct {
 
 func NewTracer(config map[string]interface{}) (api.Tracer, error) {
 	v := getActiveExportersFromConfig(config)
+	initExporters(v, config)
 	ltrace.SetActiveExporters(v)
+	initSampler(config)
 	return &grpcTracer{config: config}, nil
 }
 
+// initExporters passes the config to the exporters which need it, e.g. "zipkin": {"endpoint": "..."}
+func initExporters(exporters []string, config map[string]interface{}) {
+	for _, name := range exporters {
+		e := ltrace.GetExporter(name)
+		if e == nil {
+			log.DefaultLogger.Errorf("[tracing] not support exporter: %s", name)
+			continue
+		}
+		initializer, ok := e.(ltrace.ExporterInitializer)
+		if !ok {
+			continue
+		}
+		exporterConfig, _ := config[name].(map[string]interface{})
+		if err := initializer.Init(exporterConfig); err != nil {
+			log.DefaultLogger.Errorf("[tracing] fail to init exporter %s: %v", name, err)
+		}
+	}
+}
+
 func getActiveExportersFromConfig(config map[string]interface{}) []string {
 	var exporters []string
 	if v, ok := config[Exporter]; ok {
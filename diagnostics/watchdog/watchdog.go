@@ -0,0 +1,319 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	defaultSlowThreshold      = time.Second
+	defaultCheckInterval      = 10 * time.Second
+	defaultLatencyWindow      = 1024
+	defaultCooldown           = 5 * time.Minute
+	defaultCPUProfileDuration = 10 * time.Second
+)
+
+// Config is the config of the watchdog
+type Config struct {
+	// SlowThresholdMs is the threshold of slow requests, 1000 by default
+	SlowThresholdMs int `json:"slow_threshold_ms"`
+	// ApiSlowThresholdMs overrides the threshold for the specified grpc methods, e.g. "/spec.proto.runtime.v1.Runtime/GetState"
+	ApiSlowThresholdMs map[string]int `json:"api_slow_threshold_ms"`
+	// Profile captures pprof profiles automatically if it's not nil
+	Profile *ProfileConfig `json:"profile,omitempty"`
+}
+
+// ProfileConfig specifies when to capture profiles. A limit is disabled if it's not positive.
+type ProfileConfig struct {
+	// Dir is where the profiles are dumped, os.TempDir()/layotto-pprof by default
+	Dir string `json:"dir"`
+	// P99ThresholdMs captures a cpu profile when the p99 latency of recent requests exceeds it
+	P99ThresholdMs int `json:"p99_threshold_ms"`
+	// GoroutineThreshold captures a goroutine profile when the number of goroutines exceeds it
+	GoroutineThreshold int `json:"goroutine_threshold"`
+	// CheckIntervalMs is the interval to check the limits, 10000 by default
+	CheckIntervalMs int `json:"check_interval_ms"`
+	// LatencyWindow is how many recent requests are used to compute the p99 latency, 1024 by default
+	LatencyWindow int `json:"latency_window"`
+	// CooldownMs is the min interval between two captures of the same kind, 300000 by default
+	CooldownMs int `json:"cooldown_ms"`
+	// CPUProfileDurationMs is how long a cpu profile lasts, 10000 by default
+	CPUProfileDurationMs int `json:"cpu_profile_duration_ms"`
+}
+
+// Watchdog logs the slow requests, and captures profiles when the p99 latency or the number of goroutines crosses the limits.
+type Watchdog struct {
+	slowThreshold    time.Duration
+	apiSlowThreshold map[string]time.Duration
+	profile          *ProfileConfig
+
+	mu sync.Mutex
+	// latencies is a ring buffer of the recent latencies
+	latencies   []time.Duration
+	next        int
+	full        bool
+	lastCapture map[string]time.Time
+	lastProfile string
+
+	stopCh chan struct{}
+	// capture functions, replaced in tests
+	captureCPU       func(path string, d time.Duration) error
+	captureGoroutine func(path string) error
+	numGoroutine     func() int
+}
+
+// New creates a watchdog with the config, the missing fields are set to default
+func New(cfg *Config) *Watchdog {
+	w := &Watchdog{
+		slowThreshold:    durationOf(cfg.SlowThresholdMs, defaultSlowThreshold),
+		apiSlowThreshold: make(map[string]time.Duration, len(cfg.ApiSlowThresholdMs)),
+		lastCapture:      make(map[string]time.Time),
+		stopCh:           make(chan struct{}),
+		captureCPU:       captureCPUProfile,
+		captureGoroutine: captureGoroutineProfile,
+		numGoroutine:     runtime.NumGoroutine,
+	}
+	for method, ms := range cfg.ApiSlowThresholdMs {
+		if ms > 0 {
+			w.apiSlowThreshold[method] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if cfg.Profile != nil {
+		p := *cfg.Profile
+		if p.Dir == "" {
+			p.Dir = filepath.Join(os.TempDir(), "layotto-pprof")
+		}
+		if p.LatencyWindow <= 0 {
+			p.LatencyWindow = defaultLatencyWindow
+		}
+		w.profile = &p
+		w.latencies = make([]time.Duration, p.LatencyWindow)
+	}
+	return w
+}
+
+func durationOf(ms int, defaultValue time.Duration) time.Duration {
+	if ms <= 0 {
+		return defaultValue
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Start checks the limits periodically if profiling is enabled
+func (w *Watchdog) Start() {
+	if w.profile == nil {
+		return
+	}
+	utils.GoWithRecover(func() {
+		ticker := time.NewTicker(durationOf(w.profile.CheckIntervalMs, defaultCheckInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-w.stopCh:
+				return
+			}
+		}
+	}, nil)
+}
+
+func (w *Watchdog) Stop() {
+	close(w.stopCh)
+}
+
+// UnaryInterceptor is an implementation of grpc.UnaryServerInterceptor
+func (w *Watchdog) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	w.observe(info.FullMethod, req, time.Since(start), err)
+	return resp, err
+}
+
+// StreamInterceptor is an implementation of grpc.StreamServerInterceptor.
+// Only the latencies of the streams are logged, since a stream may last very long.
+func (w *Watchdog) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	w.logIfSlow(info.FullMethod, nil, time.Since(start), err)
+	return err
+}
+
+func (w *Watchdog) observe(method string, req interface{}, cost time.Duration, err error) {
+	if w.profile != nil {
+		w.mu.Lock()
+		w.latencies[w.next] = cost
+		w.next++
+		if w.next == len(w.latencies) {
+			w.next = 0
+			w.full = true
+		}
+		w.mu.Unlock()
+	}
+	w.logIfSlow(method, req, cost, err)
+}
+
+func (w *Watchdog) threshold(method string) time.Duration {
+	if t, ok := w.apiSlowThreshold[method]; ok {
+		return t
+	}
+	return w.slowThreshold
+}
+
+func (w *Watchdog) logIfSlow(method string, req interface{}, cost time.Duration, err error) {
+	threshold := w.threshold(method)
+	if cost < threshold {
+		return
+	}
+	msg := fmt.Sprintf("[watchdog] slow request %s cost %v, threshold %v", method, cost, threshold)
+	if detail := requestDetail(req); detail != "" {
+		msg += ", " + detail
+	}
+	if err != nil {
+		msg += fmt.Sprintf(", error: %v", err)
+	}
+	if p := w.getLastProfile(); p != "" {
+		msg += ", last profile: " + p
+	}
+	log.DefaultLogger.Warnf("%s", msg)
+}
+
+func (w *Watchdog) getLastProfile() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastProfile
+}
+
+// p99 returns the p99 latency of the recent requests
+func (w *Watchdog) p99() time.Duration {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.latencies)
+	}
+	recent := make([]time.Duration, n)
+	copy(recent, w.latencies[:n])
+	w.mu.Unlock()
+	if n == 0 {
+		return 0
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i] < recent[j]
+	})
+	return recent[(n*99-1)/100]
+}
+
+// check captures profiles if the limits are crossed
+func (w *Watchdog) check() {
+	if w.profile.P99ThresholdMs > 0 {
+		threshold := time.Duration(w.profile.P99ThresholdMs) * time.Millisecond
+		if p99 := w.p99(); p99 > threshold {
+			w.capture("cpu", fmt.Sprintf("p99 latency %v exceeds %v", p99, threshold), func(path string) error {
+				return w.captureCPU(path, durationOf(w.profile.CPUProfileDurationMs, defaultCPUProfileDuration))
+			})
+		}
+	}
+	if w.profile.GoroutineThreshold > 0 {
+		if n := w.numGoroutine(); n > w.profile.GoroutineThreshold {
+			w.capture("goroutine", fmt.Sprintf("goroutine count %d exceeds %d", n, w.profile.GoroutineThreshold), w.captureGoroutine)
+		}
+	}
+}
+
+func (w *Watchdog) capture(kind string, reason string, f func(path string) error) {
+	now := time.Now()
+	w.mu.Lock()
+	if last, ok := w.lastCapture[kind]; ok && now.Sub(last) < durationOf(w.profile.CooldownMs, defaultCooldown) {
+		w.mu.Unlock()
+		return
+	}
+	w.lastCapture[kind] = now
+	w.mu.Unlock()
+
+	if err := os.MkdirAll(w.profile.Dir, 0755); err != nil {
+		log.DefaultLogger.Errorf("[watchdog] %s, but fail to create dir %s: %v", reason, w.profile.Dir, err)
+		return
+	}
+	path := filepath.Join(w.profile.Dir, fmt.Sprintf("%s-%s-%d.pprof", kind, now.Format("20060102-150405"), os.Getpid()))
+	if err := f(path); err != nil {
+		log.DefaultLogger.Errorf("[watchdog] %s, but fail to capture %s profile: %v", reason, kind, err)
+		return
+	}
+	w.mu.Lock()
+	w.lastProfile = path
+	w.mu.Unlock()
+	log.DefaultLogger.Warnf("[watchdog] %s, %s profile dumped to %s", reason, kind, path)
+}
+
+func captureCPUProfile(path string, d time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+	time.Sleep(d)
+	pprof.StopCPUProfile()
+	return nil
+}
+
+func captureGoroutineProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return pprof.Lookup("goroutine").WriteTo(f, 1)
+}
+
+// the getters generated by protoc, which tell the component and the key of a request
+type (
+	storeNameGetter     interface{ GetStoreName() string }
+	pubsubNameGetter    interface{ GetPubsubName() string }
+	componentNameGetter interface{ GetComponentName() string }
+	nameGetter          interface{ GetName() string }
+	keyGetter           interface{ GetKey() string }
+	topicGetter         interface{ GetTopic() string }
+	keysGetter          interface{ GetKeys() []string }
+)
+
+// requestDetail describes the component and the key of the request
+func requestDetail(req interface{}) string {
+	if req == nil {
+		return ""
+	}
+	var details []string
+	switch r := req.(type) {
+	case storeNameGetter:
+		details = append(details, "component: "+r.GetStoreName())
+	case pubsubNameGetter:
+		details = append(details, "component: "+r.GetPubsubName())
+	case componentNameGetter:
+		details = append(details, "component: "+r.GetComponentName())
+	case nameGetter:
+		details = append(details, "component: "+r.GetName())
+	}
+	switch r := req.(type) {
+	case keyGetter:
+		details = append(details, "key: "+r.GetKey())
+	case topicGetter:
+		details = append(details, "topic: "+r.GetTopic())
+	case keysGetter:
+		details = append(details, "keys: "+strings.Join(r.GetKeys(), ","))
+	}
+	return strings.Join(details, ", ")
+}
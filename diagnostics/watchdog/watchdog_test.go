@@ -0,0 +1,73 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestRequestDetail(t *testing.T) {
+	assert.Equal(t, "component: redis, key: k", requestDetail(&runtimev1pb.GetStateRequest{StoreName: "redis", Key: "k"}))
+	assert.Equal(t, "component: kafka, topic: t", requestDetail(&runtimev1pb.PublishEventRequest{PubsubName: "kafka", Topic: "t"}))
+	assert.Equal(t, "", requestDetail(nil))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	w := New(&Config{
+		SlowThresholdMs:    1000,
+		ApiSlowThresholdMs: map[string]int{"/fast": 1},
+		Profile:            &ProfileConfig{LatencyWindow: 2},
+	})
+	assert.Equal(t, time.Second, w.threshold("/other"))
+	assert.Equal(t, time.Millisecond, w.threshold("/fast"))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/fast"}
+	for i := 0; i < 3; i++ {
+		_, err := w.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			time.Sleep(2 * time.Millisecond)
+			return nil, errors.New("mock")
+		})
+		assert.NotNil(t, err)
+	}
+	// the window keeps the latest 2 latencies
+	assert.True(t, w.full)
+	assert.True(t, w.p99() >= 2*time.Millisecond)
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w := New(&Config{Profile: &ProfileConfig{
+		Dir:                dir,
+		P99ThresholdMs:     1,
+		GoroutineThreshold: 1,
+	}})
+	var cpuPaths []string
+	w.captureCPU = func(path string, d time.Duration) error {
+		assert.Equal(t, defaultCPUProfileDuration, d)
+		cpuPaths = append(cpuPaths, path)
+		return nil
+	}
+	w.numGoroutine = func() int { return 2 }
+	w.observe("/a", nil, 10*time.Millisecond, nil)
+
+	w.check()
+	assert.Len(t, cpuPaths, 1)
+	assert.Contains(t, w.getLastProfile(), "goroutine-")
+	_, err = os.Stat(w.getLastProfile())
+	assert.Nil(t, err)
+
+	// captures are skipped during the cooldown
+	w.check()
+	assert.Len(t, cpuPaths, 1)
+}
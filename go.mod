@@ -3,25 +3,37 @@ module mosn.io/layotto
 go 1.14
 
 require (
+	cloud.google.com/go/pubsub v1.5.0
+	github.com/Azure/go-amqp v0.13.1
 	github.com/Azure/go-autorest/autorest/azure/cli v0.4.2 // indirect
 	github.com/Azure/go-autorest/autorest/validation v0.3.1 // indirect
 	github.com/Azure/go-autorest/logger v0.2.1 // indirect
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/Shopify/sarama v1.23.1
 	github.com/agrea/ptr v0.0.0-20180711073057-77a518d99b7b
 	github.com/alicebob/miniredis/v2 v2.16.0
+	github.com/aws/aws-sdk-go v1.36.30
 	github.com/dapr/components-contrib v1.5.1-rc.1
 	github.com/dapr/kit v0.0.2-0.20210614175626-b9074b64d233
 	github.com/dimchansky/utfbom v1.1.1 // indirect
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gammazero/workerpool v1.1.2
+	github.com/go-redis/redis/v8 v8.8.0
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/mock v1.6.0
 	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.3
 	github.com/google/uuid v1.3.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/jackc/pgx/v4 v4.6.0
 	github.com/json-iterator/go v1.1.11
+	github.com/klauspost/compress v1.13.0
 	github.com/phayes/freeport v0.0.0-20180830031419-95f893ade6f2
 	github.com/pkg/errors v0.9.1
+	github.com/rcrowley/go-metrics v0.0.0-20200313005456-10cdbea86bc0
 	github.com/shirou/gopsutil v3.21.3+incompatible
+	github.com/streadway/amqp v1.0.0
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli v1.22.1
 	github.com/valyala/fasthttp v1.28.0
@@ -29,9 +41,13 @@ require (
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
 	golang.org/x/net v0.0.0-20211005001312-d4b1ae081e3b // indirect
 	golang.org/x/text v0.3.7 // indirect
+	google.golang.org/api v0.32.0
 	google.golang.org/grpc v1.39.0
 	google.golang.org/grpc/examples v0.0.0-20210818220435-8ab16ef276a3
 	google.golang.org/protobuf v1.27.1
+	k8s.io/api v0.20.0
+	k8s.io/apimachinery v0.20.0
+	k8s.io/client-go v0.20.0
 	mosn.io/api v0.0.0-20211217011300-b851d129be01
 	mosn.io/layotto/components v0.0.0-20211020084508-6f5ee3cfeba0
 	mosn.io/layotto/spec v0.0.0-20211020084508-6f5ee3cfeba0
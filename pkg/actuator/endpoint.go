@@ -29,3 +29,19 @@ type ParamsScanner interface {
 	Next() string
 	HasNext() bool
 }
+
+// TokenHeader is the http header carrying the token of the caller, which is checked by the endpoints changing the runtime
+const TokenHeader = "layotto-actuator-token"
+
+type tokenKey struct{}
+
+// WithToken returns the context carrying the token of the caller
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenOf returns the token of the caller, which is empty if it's not carried
+func TokenOf(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
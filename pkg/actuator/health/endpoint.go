@@ -67,27 +67,46 @@ func (e *Endpoint) Handle(ctx context.Context, params actuator.ParamsScanner) (m
 		return result, invalidTypeError
 	}
 	healthType := params.Next()
-	m, ok := type2Indicators[healthType]
-	if !ok || len(m) == 0 {
+	if m, ok := type2Indicators[healthType]; !ok || len(m) == 0 {
 		return result, invalidTypeError
 	}
 	// 2. traverse the indicator chain
-	result[status_key] = UP
-	var resultErr error = nil
-	components := make(map[string]Health)
+	status, components := check(healthType)
+	result[status_key] = status
 	result[components_key] = components
-	for k, idc := range m {
+	switch status {
+	case DOWN:
+		return result, serviceDownError
+	case INIT:
+		return result, serviceInitError
+	}
+	return result, nil
+}
+
+// CheckLiveness traverses the liveness indicators, and returns the overall status as well as the ones of every indicator.
+func CheckLiveness() (Status, map[string]Health) {
+	return check(liveness_key)
+}
+
+// CheckReadiness traverses the readiness indicators, and returns the overall status as well as the ones of every indicator.
+func CheckReadiness() (Status, map[string]Health) {
+	return check(readiness_key)
+}
+
+// check returns DOWN if any indicator is DOWN, otherwise INIT if any indicator is INIT, otherwise UP.
+func check(healthType string) (Status, map[string]Health) {
+	result := UP
+	components := make(map[string]Health)
+	for k, idc := range type2Indicators[healthType] {
 		status, detail := idc.Report()
 		components[k] = Health{Status: status, Details: detail}
 		if status == DOWN {
-			result[status_key] = DOWN
-			resultErr = serviceDownError
-		} else if status == INIT && result[status_key] == UP {
-			result[status_key] = INIT
-			resultErr = serviceInitError
+			result = DOWN
+		} else if status == INIT && result == UP {
+			result = INIT
 		}
 	}
-	return result, resultErr
+	return result, components
 }
 
 // AddLivenessIndicator register health.Indicator for liveness check.It's not concurrent-safe,so please invoke it ONLY in init method.
@@ -71,3 +71,14 @@ func TestEndpoint_WhenNoIndicator(t *testing.T) {
 	assert.True(t, health.Status == DOWN)
 	assert.True(t, health.GetDetail("reason") == "mock")
 }
+
+func TestCheck(t *testing.T) {
+	status, components := CheckLiveness()
+	assert.Equal(t, UP, status)
+	assert.Len(t, components, 0)
+
+	AddReadinessIndicator("check", mockIndicator{})
+	status, components = CheckReadiness()
+	assert.Equal(t, DOWN, status)
+	assert.Equal(t, "mock", components["check"].GetDetail("reason"))
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+
+	"mosn.io/layotto/pkg/actuator"
+)
+
+const (
+	logger_key  = "logger"
+	level_key   = "level"
+	modules_key = "modules"
+	// reset_param removes the level of a module, e.g. /actuator/logger/reset/runtime
+	reset_param = "reset"
+)
+
+func init() {
+	actuator.GetDefault().AddEndpoint(logger_key, NewEndpoint())
+}
+
+type Endpoint struct {
+}
+
+func NewEndpoint() *Endpoint {
+	return &Endpoint{}
+}
+
+// Handle queries or changes the log levels:
+//
+//	/actuator/logger                  returns the levels
+//	/actuator/logger/{level}          changes the global level
+//	/actuator/logger/{level}/{module} changes the level of the module
+//	/actuator/logger/reset/{module}   removes the level of the module
+//
+// The levels after the change are returned, like:
+//
+//	{
+//	 "level": "INFO",
+//	 "modules": {
+//	   "runtime": "DEBUG"
+//	 }
+//	}
+func (e *Endpoint) Handle(ctx context.Context, params actuator.ParamsScanner) (map[string]interface{}, error) {
+	if params != nil && params.HasNext() {
+		level := params.Next()
+		var err error
+		switch {
+		case params.HasNext() && level == reset_param:
+			err = SetModuleLevel(params.Next(), "")
+		case params.HasNext():
+			err = SetModuleLevel(params.Next(), level)
+		default:
+			err = SetLevel(level)
+		}
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}, err
+		}
+	}
+	global, modules := GetLevels()
+	return map[string]interface{}{
+		level_key:   global,
+		modules_key: modules,
+	}, nil
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"mosn.io/pkg/log"
+)
+
+var levelNames = map[log.Level]string{
+	log.FATAL: "FATAL",
+	log.ERROR: "ERROR",
+	log.WARN:  "WARN",
+	log.INFO:  "INFO",
+	log.DEBUG: "DEBUG",
+	log.TRACE: "TRACE",
+}
+
+// maxParsedFormats bounds the formats whose modules are kept, since the formats built at runtime are parsed each time
+const maxParsedFormats = 4096
+
+// ErrNotInstalled is returned when the level of a module is set but the logger filtering the modules isn't installed
+var ErrNotInstalled = errors.New("the levels of modules aren't supported since the logger of modules isn't installed")
+
+var (
+	// mu serializes the changes of the levels, the logs read the levels without locking
+	mu sync.Mutex
+	// moduleLevels holds the map of the log levels of the modules, which override the global level.
+	// A module is the tag at the beginning of the logs, e.g. "runtime" for "[runtime] ...",
+	// and "grpc" matches "[grpc.GetState] ..." as well. The map is replaced instead of modified.
+	moduleLevels atomic.Value
+	// installed is the wrapper of log.DefaultLogger, which is installed by Install
+	installed *moduleLogger
+	// parsedFormats caches the modules of the formats
+	parsedFormats      sync.Map
+	parsedFormatsCount int32
+)
+
+func init() {
+	moduleLevels.Store(map[string]log.Level{})
+}
+
+// Install wraps log.DefaultLogger to filter the logs by the levels of modules.
+// It replaces log.DefaultLogger, so it should be called once the default logger is initialized
+// and before the logs are written concurrently, e.g. in a pre-start stage.
+func Install() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := log.DefaultLogger.(*moduleLogger); ok {
+		return
+	}
+	installed = &moduleLogger{ErrorLogger: log.DefaultLogger}
+	installed.level = int32(log.DefaultLogger.GetLogLevel())
+	log.DefaultLogger = installed
+}
+
+// Installed reports whether the logger filtering the modules is installed
+func Installed() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return installed != nil
+}
+
+func levels() map[string]log.Level {
+	return moduleLevels.Load().(map[string]log.Level)
+}
+
+// ParseLevel converts the level name (case-insensitive) into log.Level
+func ParseLevel(name string) (log.Level, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for l, n := range levelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q", name)
+}
+
+func LevelName(l log.Level) string {
+	if n, ok := levelNames[l]; ok {
+		return n
+	}
+	return fmt.Sprintf("LEVEL(%d)", l)
+}
+
+// GetLevels returns the global log level and the levels of the modules
+func GetLevels() (string, map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current := levels()
+	modules := make(map[string]string, len(current))
+	for m, l := range current {
+		modules[m] = LevelName(l)
+	}
+	return LevelName(globalLevel()), modules
+}
+
+// SetLevel changes the global log level
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	if installed != nil {
+		atomic.StoreInt32(&installed.level, int32(l))
+	}
+	applyInnerLevel(l, levels())
+	mu.Unlock()
+	log.DefaultLogger.Infof("[actuator] [logger] log level is changed to %s", LevelName(l))
+	return nil
+}
+
+// SetModuleLevel changes the log level of the module, and the module level is removed if the name of the level is empty
+func SetModuleLevel(module string, name string) error {
+	module = strings.TrimSpace(module)
+	if module == "" {
+		return fmt.Errorf("module is required")
+	}
+	var l log.Level
+	if name != "" {
+		var err error
+		if l, err = ParseLevel(name); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if installed == nil {
+		return ErrNotInstalled
+	}
+	current := levels()
+	next := make(map[string]log.Level, len(current)+1)
+	for m, level := range current {
+		next[m] = level
+	}
+	if name == "" {
+		delete(next, module)
+	} else {
+		next[module] = l
+	}
+	moduleLevels.Store(next)
+	applyInnerLevel(globalLevel(), next)
+	return nil
+}
+
+// globalLevel must be locked
+func globalLevel() log.Level {
+	if installed != nil {
+		return installed.GetLogLevel()
+	}
+	return log.DefaultLogger.GetLogLevel()
+}
+
+// applyInnerLevel sets the level of the underlying logger to the most verbose one, so that the module logs aren't filtered by it.
+// It must be locked.
+func applyInnerLevel(global log.Level, modules map[string]log.Level) {
+	inner := global
+	for _, l := range modules {
+		if l > inner {
+			inner = l
+		}
+	}
+	if installed != nil {
+		installed.ErrorLogger.SetLogLevel(inner)
+		return
+	}
+	log.DefaultLogger.SetLogLevel(inner)
+}
+
+// enabled tells whether a log of the level should be written, according to the module of the log
+func enabled(global log.Level, format string, level log.Level) bool {
+	modules := levels()
+	if len(modules) == 0 {
+		return level <= global
+	}
+	threshold := global
+	for _, module := range parsedModulesOf(format) {
+		if l, ok := modules[module]; ok {
+			threshold = l
+		} else if idx := strings.Index(module, "."); idx > 0 {
+			if l, ok := modules[module[:idx]]; ok {
+				threshold = l
+			}
+		}
+	}
+	return level <= threshold
+}
+
+// parsedModulesOf returns the modules of the format, which is parsed once if the cache isn't full
+func parsedModulesOf(format string) []string {
+	if modules, ok := parsedFormats.Load(format); ok {
+		return modules.([]string)
+	}
+	modules := modulesOf(format)
+	if atomic.AddInt32(&parsedFormatsCount, 1) <= maxParsedFormats {
+		parsedFormats.Store(format, modules)
+	} else {
+		atomic.AddInt32(&parsedFormatsCount, -1)
+	}
+	return modules
+}
+
+// modulesOf returns the tags at the beginning of the log, e.g. ["runtime", "grpc.GetState"] for "[runtime] [grpc.GetState] ..."
+func modulesOf(format string) []string {
+	var modules []string
+	s := format
+	for {
+		s = strings.TrimLeft(s, " ")
+		if !strings.HasPrefix(s, "[") {
+			return modules
+		}
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return modules
+		}
+		modules = append(modules, s[1:end])
+		s = s[end+1:]
+	}
+}
+
+// moduleLogger filters the logs by the levels of modules, the other methods are delegated to the underlying logger
+type moduleLogger struct {
+	log.ErrorLogger
+	// level is the global log.Level, which is accessed atomically
+	level int32
+}
+
+func (l *moduleLogger) SetLogLevel(level log.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	atomic.StoreInt32(&l.level, int32(level))
+	applyInnerLevel(level, levels())
+}
+
+func (l *moduleLogger) GetLogLevel() log.Level {
+	return log.Level(atomic.LoadInt32(&l.level))
+}
+
+func (l *moduleLogger) Tracef(format string, args ...interface{}) {
+	if enabled(l.GetLogLevel(), format, log.TRACE) {
+		l.ErrorLogger.Tracef(format, args...)
+	}
+}
+
+func (l *moduleLogger) Debugf(format string, args ...interface{}) {
+	if enabled(l.GetLogLevel(), format, log.DEBUG) {
+		l.ErrorLogger.Debugf(format, args...)
+	}
+}
+
+func (l *moduleLogger) Infof(format string, args ...interface{}) {
+	if enabled(l.GetLogLevel(), format, log.INFO) {
+		l.ErrorLogger.Infof(format, args...)
+	}
+}
+
+func (l *moduleLogger) Warnf(format string, args ...interface{}) {
+	if enabled(l.GetLogLevel(), format, log.WARN) {
+		l.ErrorLogger.Warnf(format, args...)
+	}
+}
+
+func (l *moduleLogger) Errorf(format string, args ...interface{}) {
+	if enabled(l.GetLogLevel(), format, log.ERROR) {
+		l.ErrorLogger.Errorf(format, args...)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mosn.io/pkg/log"
+)
+
+type mockScanner struct {
+	params []string
+}
+
+func (m *mockScanner) Next() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	p := m.params[0]
+	m.params = m.params[1:]
+	return p
+}
+
+func (m *mockScanner) HasNext() bool {
+	return len(m.params) > 0
+}
+
+// reset restores the default logger
+func reset(origin log.ErrorLogger, level log.Level) {
+	origin.SetLogLevel(level)
+	log.DefaultLogger = origin
+	installed = nil
+	moduleLevels.Store(map[string]log.Level{})
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := ParseLevel(" debug")
+	assert.Nil(t, err)
+	assert.Equal(t, log.DEBUG, l)
+	assert.Equal(t, "DEBUG", LevelName(l))
+	_, err = ParseLevel("verbose")
+	assert.NotNil(t, err)
+}
+
+func TestModulesOf(t *testing.T) {
+	assert.Equal(t, []string{"runtime", "grpc.GetState"}, modulesOf("[runtime] [grpc.GetState] fail to get %s"))
+	assert.Equal(t, []string{"runtime", "grpc.GetState"}, parsedModulesOf("[runtime] [grpc.GetState] fail to get %s"))
+	modules, ok := parsedFormats.Load("[runtime] [grpc.GetState] fail to get %s")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"runtime", "grpc.GetState"}, modules)
+	assert.Nil(t, modulesOf("no module"))
+	assert.Equal(t, []string{"runtime"}, modulesOf("[runtime] [unclosed"))
+}
+
+func TestSetLevel(t *testing.T) {
+	defer reset(log.DefaultLogger, log.DefaultLogger.GetLogLevel())
+
+	// the levels of modules require the logger installed
+	assert.Equal(t, ErrNotInstalled, SetModuleLevel("grpc", "debug"))
+	Install()
+	Install()
+	assert.Equal(t, installed, log.DefaultLogger)
+	_, ok := installed.ErrorLogger.(*moduleLogger)
+	assert.False(t, ok)
+
+	assert.Nil(t, SetLevel("warn"))
+	assert.NotNil(t, SetLevel("verbose"))
+	level, modules := GetLevels()
+	assert.Equal(t, "WARN", level)
+	assert.Len(t, modules, 0)
+
+	assert.Nil(t, SetModuleLevel("grpc", "debug"))
+	assert.NotNil(t, SetModuleLevel("", "debug"))
+	assert.NotNil(t, SetModuleLevel("runtime", "verbose"))
+	level, modules = GetLevels()
+	assert.Equal(t, "WARN", level)
+	assert.Equal(t, map[string]string{"grpc": "DEBUG"}, modules)
+	// the underlying logger doesn't filter the module logs
+	assert.Equal(t, log.DEBUG, installed.ErrorLogger.GetLogLevel())
+
+	assert.True(t, enabled(log.WARN, "[runtime] [grpc.GetState] fail", log.DEBUG))
+	assert.True(t, enabled(log.WARN, "[grpc] fail", log.DEBUG))
+	assert.False(t, enabled(log.WARN, "[runtime] fail", log.INFO))
+	assert.True(t, enabled(log.WARN, "[runtime] fail", log.ERROR))
+
+	assert.Nil(t, SetModuleLevel("grpc", ""))
+	_, modules = GetLevels()
+	assert.Len(t, modules, 0)
+	assert.Equal(t, log.WARN, installed.ErrorLogger.GetLogLevel())
+}
+
+func TestEndpoint_Handle(t *testing.T) {
+	defer reset(log.DefaultLogger, log.DefaultLogger.GetLogLevel())
+	Install()
+
+	ep := NewEndpoint()
+	handle, err := ep.Handle(context.Background(), &mockScanner{params: []string{"error"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR", handle[level_key])
+
+	handle, err = ep.Handle(context.Background(), &mockScanner{params: []string{"debug", "runtime"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR", handle[level_key])
+	assert.Equal(t, map[string]string{"runtime": "DEBUG"}, handle[modules_key])
+
+	handle, err = ep.Handle(context.Background(), &mockScanner{params: []string{reset_param, "runtime"}})
+	assert.Nil(t, err)
+	assert.Len(t, handle[modules_key], 0)
+
+	handle, err = ep.Handle(context.Background(), &mockScanner{params: []string{"verbose"}})
+	assert.NotNil(t, err)
+	assert.Contains(t, handle, "error")
+
+	handle, err = ep.Handle(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR", handle[level_key])
+}
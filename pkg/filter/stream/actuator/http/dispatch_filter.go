@@ -70,6 +70,9 @@ func (dis *DispatchFilter) OnReceive(ctx context.Context, headers api.HeaderMap,
 		dis.write404()
 		return api.StreamFilterStop
 	}
+	if token, ok := headers.Get(actuator.TokenHeader); ok {
+		ctx = actuator.WithToken(ctx, token)
+	}
 	json, err := endpoint.Handle(ctx, resolver)
 	// 4. write result
 	var code int
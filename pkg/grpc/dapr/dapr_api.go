@@ -27,13 +27,13 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/anypb"
 	"mosn.io/layotto/components/configstores"
 	"mosn.io/layotto/components/file"
 	"mosn.io/layotto/components/hello"
 	"mosn.io/layotto/components/lock"
 	runtime_common "mosn.io/layotto/components/pkg/common"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/layotto/components/rpc"
 	mosninvoker "mosn.io/layotto/components/rpc/invoker/mosn"
 	"mosn.io/layotto/components/sequencer"
@@ -42,6 +42,7 @@ import (
 	"mosn.io/layotto/pkg/grpc/dapr/proto/runtime/v1"
 	dapr_v1pb "mosn.io/layotto/pkg/grpc/dapr/proto/runtime/v1"
 	"mosn.io/layotto/pkg/messages"
+	mbindings "mosn.io/layotto/pkg/runtime/bindings"
 	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
 	"mosn.io/pkg/log"
 	"strings"
@@ -150,8 +151,16 @@ func (d *daprGrpcAPI) InvokeBinding(ctx context.Context, in *runtime.InvokeBindi
 
 	r := &dapr_v1pb.InvokeBindingResponse{}
 	resp, err := d.sendToOutputBindingFn(in.Name, req)
+	var invalid *mbindings.InvalidMetadataError
+	if errors.As(err, &invalid) {
+		return r, messages.Errorf(codes.InvalidArgument, messages.ErrBindingMetadataInvalid, in.Name, err.Error())
+	}
+	var denied *egress.DeniedError
+	if errors.As(err, &denied) {
+		return r, messages.Errorf(codes.PermissionDenied, messages.ErrBindingEgressDenied, in.Name, denied.Error())
+	}
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrInvokeOutputBinding, in.Name, err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrInvokeOutputBinding, in.Name, err.Error())
 		log.DefaultLogger.Errorf("call out binding fail, err:%+v", err)
 		return r, err
 	}
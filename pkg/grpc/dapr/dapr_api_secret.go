@@ -20,7 +20,6 @@ import (
 	"context"
 	"github.com/dapr/components-contrib/secretstores"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"mosn.io/layotto/pkg/grpc/dapr/proto/runtime/v1"
 	"mosn.io/layotto/pkg/messages"
 	"mosn.io/pkg/log"
@@ -29,21 +28,21 @@ import (
 func (d *daprGrpcAPI) GetSecret(ctx context.Context, request *runtime.GetSecretRequest) (*runtime.GetSecretResponse, error) {
 	// 1. check parameters
 	if d.secretStores == nil || len(d.secretStores) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrSecretStoreNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrSecretStoreNotConfigured)
 		log.DefaultLogger.Errorf("GetSecret fail,not configured err:%+v", err)
 		return &runtime.GetSecretResponse{}, err
 	}
 	secretStoreName := request.StoreName
 
 	if d.secretStores[secretStoreName] == nil {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrSecretStoreNotFound, secretStoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrSecretStoreNotFound, secretStoreName)
 		log.DefaultLogger.Errorf("GetSecret fail,not find err:%+v", err)
 		return &runtime.GetSecretResponse{}, err
 	}
 
 	// 2. TODO permission control
 	if !d.isSecretAllowed(request.StoreName, request.Key) {
-		err := status.Errorf(codes.PermissionDenied, messages.ErrPermissionDenied, request.Key, request.StoreName)
+		err := messages.Errorf(codes.PermissionDenied, messages.ErrPermissionDenied, request.Key, request.StoreName)
 		return &runtime.GetSecretResponse{}, err
 	}
 
@@ -55,7 +54,7 @@ func (d *daprGrpcAPI) GetSecret(ctx context.Context, request *runtime.GetSecretR
 	getResponse, err := d.secretStores[secretStoreName].GetSecret(req)
 	// 4. parse result
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrSecretGet, req.Name, secretStoreName, err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrSecretGet, req.Name, secretStoreName, err.Error())
 		log.DefaultLogger.Errorf("GetSecret fail,get secret err:%+v", err)
 		return &runtime.GetSecretResponse{}, err
 	}
@@ -70,14 +69,14 @@ func (d *daprGrpcAPI) GetSecret(ctx context.Context, request *runtime.GetSecretR
 func (d *daprGrpcAPI) GetBulkSecret(ctx context.Context, in *runtime.GetBulkSecretRequest) (*runtime.GetBulkSecretResponse, error) {
 	// 1. check parameters
 	if d.secretStores == nil || len(d.secretStores) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrSecretStoreNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrSecretStoreNotConfigured)
 		log.DefaultLogger.Errorf("GetBulkSecret fail,not configured err:%+v", err)
 		return &runtime.GetBulkSecretResponse{}, err
 	}
 	secretStoreName := in.StoreName
 
 	if d.secretStores[secretStoreName] == nil {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrSecretStoreNotFound, secretStoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrSecretStoreNotFound, secretStoreName)
 		log.DefaultLogger.Errorf("GetBulkSecret fail,not find err:%+v", err)
 		return &runtime.GetBulkSecretResponse{}, err
 	}
@@ -88,7 +87,7 @@ func (d *daprGrpcAPI) GetBulkSecret(ctx context.Context, in *runtime.GetBulkSecr
 	getResponse, err := d.secretStores[secretStoreName].BulkGetSecret(req)
 	// 3. parse result
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrBulkSecretGet, secretStoreName, err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrBulkSecretGet, secretStoreName, err.Error())
 		log.DefaultLogger.Errorf("GetBulkSecret fail,bulk secret err:%+v", err)
 		return &runtime.GetBulkSecretResponse{}, err
 	}
@@ -18,6 +18,7 @@ package dapr
 
 import (
 	"context"
+	"errors"
 
 	"github.com/dapr/components-contrib/state"
 	"github.com/gammazero/workerpool"
@@ -31,9 +32,13 @@ import (
 	dapr_v1pb "mosn.io/layotto/pkg/grpc/dapr/proto/runtime/v1"
 	"mosn.io/layotto/pkg/messages"
 	state2 "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 	"mosn.io/pkg/log"
 )
 
+// errKeyHashed is the error of the query results whose keys are hashed by the key policy of the store
+const errKeyHashed = "the key is hashed by the key policy of the store, so it's the key in the store instead of the key of the app"
+
 func (d *daprGrpcAPI) SaveState(ctx context.Context, in *dapr_v1pb.SaveStateRequest) (*emptypb.Empty, error) {
 	// 1. get store
 	store, err := d.getStateStore(in.StoreName)
@@ -48,6 +53,10 @@ func (d *daprGrpcAPI) SaveState(ctx context.Context, in *dapr_v1pb.SaveStateRequ
 		if err != nil {
 			return &emptypb.Empty{}, err
 		}
+		if err = checkTTL(s.Key, in.StoreName, s.Metadata); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.SaveState] error: %v", err)
+			return &emptypb.Empty{}, err
+		}
 		reqs = append(reqs, *StateItem2SetRequest(s, key))
 	}
 	// 3. query
@@ -85,11 +94,20 @@ func (d *daprGrpcAPI) GetState(ctx context.Context, request *dapr_v1pb.GetStateR
 	compResp, err := store.Get(req)
 	// 4. check result
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrStateGet, request.Key, request.StoreName, err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrStateGet, request.Key, request.StoreName, err.Error())
 		log.DefaultLogger.Errorf("[runtime] [grpc.GetState] %v", err)
 		return &dapr_v1pb.GetStateResponse{}, err
 	}
-	return GetResponse2GetStateResponse(compResp), nil
+	resp := GetResponse2GetStateResponse(compResp)
+	// 5. check the content type expected
+	if expected := request.GetMetadata()[state2.ContentTypeMetadataKey]; expected != "" {
+		if err = state2.CheckContentType(expected, resp.Data, resp.Metadata); err != nil {
+			err = messages.Errorf(codes.FailedPrecondition, messages.ErrStateContentType, request.Key, request.StoreName, err.Error())
+			log.DefaultLogger.Errorf("[runtime] [grpc.GetState] %v", err)
+			return &dapr_v1pb.GetStateResponse{}, err
+		}
+	}
+	return resp, nil
 }
 
 func (d *daprGrpcAPI) GetBulkState(ctx context.Context, request *dapr_v1pb.GetBulkStateRequest) (*dapr_v1pb.GetBulkStateResponse, error) {
@@ -108,6 +126,9 @@ func (d *daprGrpcAPI) GetBulkState(ctx context.Context, request *dapr_v1pb.GetBu
 	// 2. store.BulkGet
 	// 2.1. convert reqs
 	reqs := make([]state.GetRequest, len(request.Keys))
+	// the keys of the items are the ones requested, since the keys escaped or hashed by the key policy
+	// can't be restored reliably from the keys in the store
+	originals := make(map[string]string, len(request.Keys))
 	for i, k := range request.Keys {
 		key, err := state2.GetModifiedStateKey(k, request.StoreName, d.appId)
 		if err != nil {
@@ -118,16 +139,22 @@ func (d *daprGrpcAPI) GetBulkState(ctx context.Context, request *dapr_v1pb.GetBu
 			Metadata: request.GetMetadata(),
 		}
 		reqs[i] = r
+		originals[key] = k
 	}
 	// 2.2. query
 	support, responses, err := store.BulkGet(reqs)
 	if err != nil {
 		return bulkResp, err
 	}
+	expected := request.GetMetadata()[state2.ContentTypeMetadataKey]
 	// 2.3. parse and return result if store supports this method
 	if support {
 		for i := 0; i < len(responses); i++ {
-			bulkResp.Items = append(bulkResp.Items, BulkGetResponse2BulkStateItem(&responses[i]))
+			item := BulkGetResponse2BulkStateItem(&responses[i])
+			if k, ok := originals[responses[i].Key]; ok {
+				item.Key = k
+			}
+			bulkResp.Items = append(bulkResp.Items, checkBulkStateItem(item, expected))
 		}
 		return bulkResp, nil
 	}
@@ -137,7 +164,7 @@ func (d *daprGrpcAPI) GetBulkState(ctx context.Context, request *dapr_v1pb.GetBu
 	pool := workerpool.New(int(request.Parallelism))
 	resultCh := make(chan *dapr_v1pb.BulkStateItem, n)
 	for i := 0; i < n; i++ {
-		pool.Submit(generateGetStateTask(store, &reqs[i], resultCh))
+		pool.Submit(generateGetStateTask(store, &reqs[i], request.Keys[i], resultCh))
 	}
 	pool.StopWait()
 	for {
@@ -146,7 +173,7 @@ func (d *daprGrpcAPI) GetBulkState(ctx context.Context, request *dapr_v1pb.GetBu
 			if !ok {
 				return bulkResp, nil
 			}
-			bulkResp.Items = append(bulkResp.Items, item)
+			bulkResp.Items = append(bulkResp.Items, checkBulkStateItem(item, expected))
 		default:
 			return bulkResp, nil
 		}
@@ -166,7 +193,7 @@ func (d *daprGrpcAPI) QueryStateAlpha1(ctx context.Context, request *dapr_v1pb.Q
 	// 2. check if this store has the query feature
 	querier, ok := store.(state.Querier)
 	if !ok {
-		err = status.Errorf(codes.Unimplemented, messages.ErrNotFound, "Query")
+		err = messages.Errorf(codes.Unimplemented, messages.ErrStateQueryNotSupported, request.GetStoreName())
 		log.DefaultLogger.Errorf("[runtime] [grpc.QueryStateAlpha1] error: %v", err)
 		return ret, err
 	}
@@ -174,7 +201,7 @@ func (d *daprGrpcAPI) QueryStateAlpha1(ctx context.Context, request *dapr_v1pb.Q
 	// 3. Unmarshal query dsl
 	var req state.QueryRequest
 	if err = jsoniter.Unmarshal([]byte(request.GetQuery()), &req.Query); err != nil {
-		err = status.Errorf(codes.InvalidArgument, messages.ErrMalformedRequest, err.Error())
+		err = messages.Errorf(codes.InvalidArgument, messages.ErrStateQueryInvalid, request.GetStoreName(), err.Error())
 		log.DefaultLogger.Errorf("[runtime] [grpc.QueryStateAlpha1] error: %v", err)
 		return ret, err
 	}
@@ -184,7 +211,7 @@ func (d *daprGrpcAPI) QueryStateAlpha1(ctx context.Context, request *dapr_v1pb.Q
 	resp, err := querier.Query(&req)
 	// 5. convert response
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrStateQuery, request.GetStoreName(), err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrStateQuery, request.GetStoreName(), err.Error())
 		log.DefaultLogger.Errorf("[runtime] [grpc.QueryStateAlpha1] error: %v", err)
 		return ret, err
 	}
@@ -197,9 +224,16 @@ func (d *daprGrpcAPI) QueryStateAlpha1(ctx context.Context, request *dapr_v1pb.Q
 	ret.Metadata = resp.Metadata
 
 	for i := range resp.Results {
+		key, ok := state2.GetOriginalStateKeyOf(request.StoreName, resp.Results[i].Key)
 		ret.Results[i] = &dapr_v1pb.QueryStateItem{
-			Key:  state2.GetOriginalStateKey(resp.Results[i].Key),
-			Data: resp.Results[i].Data,
+			Key:   key,
+			Data:  resp.Results[i].Data,
+			Etag:  common.PointerToString(resp.Results[i].ETag),
+			Error: resp.Results[i].Error,
+		}
+		// the key in the store is returned, which isn't the key of the app
+		if !ok && ret.Results[i].Error == "" {
+			ret.Results[i].Error = errKeyHashed
 		}
 	}
 	return ret, nil
@@ -257,20 +291,20 @@ func (d *daprGrpcAPI) DeleteBulkState(ctx context.Context, request *dapr_v1pb.De
 func (d *daprGrpcAPI) ExecuteStateTransaction(ctx context.Context, request *dapr_v1pb.ExecuteStateTransactionRequest) (*emptypb.Empty, error) {
 	// 1. check params
 	if d.stateStores == nil || len(d.stateStores) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
 		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
 		return &emptypb.Empty{}, err
 	}
 	storeName := request.StoreName
 	if d.stateStores[storeName] == nil {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, storeName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, storeName)
 		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
 		return &emptypb.Empty{}, err
 	}
 	// 2. find store
 	store, ok := d.transactionalStateStores[storeName]
 	if !ok {
-		err := status.Errorf(codes.Unimplemented, messages.ErrStateStoreNotSupported, storeName)
+		err := messages.Errorf(codes.Unimplemented, messages.ErrStateStoreNotSupported, storeName)
 		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
 		return &emptypb.Empty{}, err
 	}
@@ -292,6 +326,10 @@ func (d *daprGrpcAPI) ExecuteStateTransaction(ctx context.Context, request *dapr
 		// 3.2. prepare TransactionalStateOperation struct according to the operation type
 		switch state.OperationType(op.OperationType) {
 		case state.Upsert:
+			if err = checkTTL(req.Key, request.StoreName, req.Metadata); err != nil {
+				log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
+				return &emptypb.Empty{}, err
+			}
 			operation = state.TransactionalStateOperation{
 				Operation: state.Upsert,
 				Request:   *StateItem2SetRequest(req, key),
@@ -302,7 +340,7 @@ func (d *daprGrpcAPI) ExecuteStateTransaction(ctx context.Context, request *dapr
 				Request:   *StateItem2DeleteRequest(req, key),
 			}
 		default:
-			err := status.Errorf(codes.Unimplemented, messages.ErrNotSupportedStateOperation, op.OperationType)
+			err := messages.Errorf(codes.Unimplemented, messages.ErrNotSupportedStateOperation, op.OperationType)
 			log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
 			return &emptypb.Empty{}, err
 		}
@@ -314,8 +352,18 @@ func (d *daprGrpcAPI) ExecuteStateTransaction(ctx context.Context, request *dapr
 		Metadata:   request.Metadata,
 	})
 	// 5. check result
+	if _, ok := err.(*state2.ClassifiedDataError); ok {
+		err = messages.WithErrorCode(status.Newf(codes.FailedPrecondition, messages.ErrStateTransaction, err.Error()), runtimev1pb.ErrorCode_STATE_CLASSIFIED_DATA_BLOCKED)
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
+		return &emptypb.Empty{}, err
+	}
+	if isContentTypeInvalid(err) {
+		err = messages.WithErrorCode(status.Newf(codes.InvalidArgument, messages.ErrStateTransaction, err.Error()), runtimev1pb.ErrorCode_STATE_CONTENT_TYPE_INVALID)
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
+		return &emptypb.Empty{}, err
+	}
 	if err != nil {
-		err = status.Errorf(codes.Internal, messages.ErrStateTransaction, err.Error())
+		err = messages.Errorf(codes.Internal, messages.ErrStateTransaction, err.Error())
 		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
 		return &emptypb.Empty{}, err
 	}
@@ -324,29 +372,35 @@ func (d *daprGrpcAPI) ExecuteStateTransaction(ctx context.Context, request *dapr
 
 func (d *daprGrpcAPI) getStateStore(name string) (state.Store, error) {
 	if d.stateStores == nil || len(d.stateStores) == 0 {
-		return nil, status.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
+		return nil, messages.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
 	}
 
 	if d.stateStores[name] == nil {
-		return nil, status.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, name)
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, name)
 	}
 	return d.stateStores[name], nil
 }
 
 // wrapDaprComponentError parse and wrap error from dapr component
 func (d *daprGrpcAPI) wrapDaprComponentError(err error, format string, args ...interface{}) error {
+	if _, ok := err.(*state2.ClassifiedDataError); ok {
+		return messages.WithErrorCode(status.Newf(codes.FailedPrecondition, format, args...), runtimev1pb.ErrorCode_STATE_CLASSIFIED_DATA_BLOCKED)
+	}
+	if isContentTypeInvalid(err) {
+		return messages.WithErrorCode(status.Newf(codes.InvalidArgument, format, args...), runtimev1pb.ErrorCode_STATE_CONTENT_TYPE_INVALID)
+	}
 	e, ok := err.(*state.ETagError)
 	if !ok {
-		return status.Errorf(codes.Internal, format, args...)
+		return messages.Errorf(codes.Internal, format, args...)
 	}
 	switch e.Kind() {
 	case state.ETagMismatch:
-		return status.Errorf(codes.Aborted, format, args...)
+		return messages.WithErrorCode(status.Newf(codes.Aborted, format, args...), runtimev1pb.ErrorCode_STATE_ETAG_MISMATCH)
 	case state.ETagInvalid:
-		return status.Errorf(codes.InvalidArgument, format, args...)
+		return messages.WithErrorCode(status.Newf(codes.InvalidArgument, format, args...), runtimev1pb.ErrorCode_STATE_ETAG_INVALID)
 	}
 
-	return status.Errorf(codes.Internal, format, args...)
+	return messages.Errorf(codes.Internal, format, args...)
 }
 
 func StateItem2SetRequest(grpcReq *dapr_common_v1pb.StateItem, key string) *state.SetRequest {
@@ -401,7 +455,7 @@ func StateConcurrencyToString(c dapr_common_v1pb.StateOptions_StateConcurrency)
 	return ""
 }
 
-func generateGetStateTask(store state.Store, req *state.GetRequest, resultCh chan *dapr_v1pb.BulkStateItem) func() {
+func generateGetStateTask(store state.Store, req *state.GetRequest, key string, resultCh chan *dapr_v1pb.BulkStateItem) func() {
 	return func() {
 		// get
 		r, err := store.Get(req)
@@ -409,11 +463,11 @@ func generateGetStateTask(store state.Store, req *state.GetRequest, resultCh cha
 		var item *dapr_v1pb.BulkStateItem
 		if err != nil {
 			item = &dapr_v1pb.BulkStateItem{
-				Key:   state2.GetOriginalStateKey(req.Key),
+				Key:   key,
 				Error: err.Error(),
 			}
 		} else {
-			item = GetResponse2BulkStateItem(r, state2.GetOriginalStateKey(req.Key))
+			item = GetResponse2BulkStateItem(r, key)
 		}
 		// collect result
 		select {
@@ -488,3 +542,27 @@ func StateItem2DeleteRequest(grpcReq *dapr_common_v1pb.StateItem, key string) *s
 	}
 	return req
 }
+
+// checkTTL validates the ttl in the metadata of a write, so that the invalid ttls fail the same way for all the stores
+func checkTTL(key, storeName string, metadata map[string]string) error {
+	if _, _, err := state2.ParseTTL(metadata); err != nil {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrStateTTLInvalid, key, storeName, err.Error())
+	}
+	return nil
+}
+
+// isContentTypeInvalid returns whether the value written doesn't match the content type declared, or it's required
+func isContentTypeInvalid(err error) bool {
+	return errors.Is(err, state2.ErrContentTypeInvalid) || errors.Is(err, state2.ErrContentTypeRequired)
+}
+
+// checkBulkStateItem replaces the item with an error if it doesn't match the content type expected
+func checkBulkStateItem(item *dapr_v1pb.BulkStateItem, expected string) *dapr_v1pb.BulkStateItem {
+	if expected == "" || item.Error != "" {
+		return item
+	}
+	if err := state2.CheckContentType(expected, item.Data, item.Metadata); err != nil {
+		return &dapr_v1pb.BulkStateItem{Key: item.Key, Error: err.Error()}
+	}
+	return item
+}
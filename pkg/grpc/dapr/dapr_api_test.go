@@ -67,14 +67,14 @@ func TestNewDaprAPI_Alpha(t *testing.T) {
 	}
 	// construct API
 	grpcAPI := NewDaprAPI_Alpha(&grpc_api.ApplicationContext{
-		"", nil, nil, nil, nil,
-		map[string]state.Store{"mock": store}, nil, nil, nil,
-		func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+		StateStores: map[string]state.Store{"mock": store},
+		SendToOutputBindingFn: func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
 			if name == "error-binding" {
 				return nil, errors.New("error when invoke binding")
 			}
 			return &bindings.InvokeResponse{Data: []byte("ok")}, nil
-		}, nil})
+		},
+	})
 	err := grpcAPI.Init(nil)
 	if err != nil {
 		t.Errorf("grpcAPI.Init error")
@@ -218,9 +218,8 @@ func TestNewDaprAPI_GetSecretStores(t *testing.T) {
 	}
 	// Setup Dapr API server
 	grpcAPI := NewDaprAPI_Alpha(&grpc_api.ApplicationContext{
-		"", nil, nil, nil, nil,
-		nil, nil, nil, nil,
-		nil, fakeStores})
+		SecretStores: fakeStores,
+	})
 	err := grpcAPI.Init(nil)
 	if err != nil {
 		t.Errorf("grpcAPI.Init error")
@@ -292,9 +291,8 @@ func TestGetBulkSecret(t *testing.T) {
 	// Setup Dapr API server
 	// Setup Dapr API server
 	grpcAPI := NewDaprAPI_Alpha(&grpc_api.ApplicationContext{
-		"", nil, nil, nil, nil,
-		nil, nil, nil, nil,
-		nil, fakeStores})
+		SecretStores: fakeStores,
+	})
 	// Run test server
 	err := grpcAPI.Init(nil)
 	if err != nil {
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/reflection"
+	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
+)
+
+// DebugConfig enables the services for debugging the runtime server
+type DebugConfig struct {
+	// Reflection registers the gRPC reflection service, so that the APIs can be explored by tools like grpcurl
+	Reflection bool `json:"reflection"`
+	// Channelz registers the channelz service, which reports the states of the channels, servers and sockets
+	Channelz bool `json:"channelz"`
+}
+
+// debugAPI is the GrpcAPI registering the debug services
+type debugAPI struct {
+	config DebugConfig
+}
+
+// NewDebugAPI returns the GrpcAPI registering the debug services enabled by the config
+func NewDebugAPI(config DebugConfig) GrpcAPI {
+	return &debugAPI{config: config}
+}
+
+func (d *debugAPI) Init(conn *grpc.ClientConn) error {
+	return nil
+}
+
+func (d *debugAPI) Register(s *grpc.Server, registeredServer mgrpc.RegisteredServer) (mgrpc.RegisteredServer, error) {
+	if d.config.Reflection {
+		reflection.Register(s)
+	}
+	if d.config.Channelz {
+		channelz.RegisterChannelzServiceToServer(s)
+	}
+	return registeredServer, nil
+}
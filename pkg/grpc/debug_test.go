@@ -0,0 +1,43 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestDebugAPI(t *testing.T) {
+	services := func(config DebugConfig) map[string]grpc.ServiceInfo {
+		s := grpc.NewServer()
+		_, err := NewDebugAPI(config).Register(s, s)
+		assert.Nil(t, err)
+		return s.GetServiceInfo()
+	}
+
+	assert.Empty(t, services(DebugConfig{}))
+
+	info := services(DebugConfig{Reflection: true})
+	assert.Contains(t, info, "grpc.reflection.v1alpha.ServerReflection")
+	assert.NotContains(t, info, "grpc.channelz.v1.Channelz")
+
+	info = services(DebugConfig{Reflection: true, Channelz: true})
+	assert.Contains(t, info, "grpc.reflection.v1alpha.ServerReflection")
+	assert.Contains(t, info, "grpc.channelz.v1.Channelz")
+}
@@ -26,6 +26,7 @@ import (
 	l8_comp_pubsub "mosn.io/layotto/components/pubsub"
 	"strings"
 	"sync"
+	"time"
 
 	grpc_api "mosn.io/layotto/pkg/grpc"
 	"mosn.io/layotto/pkg/grpc/dapr"
@@ -41,18 +42,22 @@ import (
 	"github.com/golang/protobuf/ptypes/empty"
 	"mosn.io/layotto/components/file"
 
+	"mosn.io/layotto/pkg/actuator/health"
 	"mosn.io/layotto/pkg/converter"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtime_file "mosn.io/layotto/pkg/runtime/file"
 	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
 	runtime_sequencer "mosn.io/layotto/pkg/runtime/sequencer"
 
 	contrib_contenttype "github.com/dapr/components-contrib/contenttype"
 	"github.com/dapr/components-contrib/pubsub"
-	contrib_pubsub "github.com/dapr/components-contrib/pubsub"
 	"github.com/google/uuid"
 	jsoniter "github.com/json-iterator/go"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"mosn.io/layotto/components/configstores"
@@ -67,6 +72,8 @@ import (
 
 const (
 	Metadata_key_pubsubName = "pubsubName"
+	// abortUploadsTimeout is the timeout of aborting the incomplete uploads of a canceled put
+	abortUploadsTimeout = 10 * time.Second
 )
 
 var (
@@ -89,13 +96,15 @@ type API interface {
 	// GetConfiguration gets configuration from configuration store.
 	GetConfiguration(context.Context, *runtimev1pb.GetConfigurationRequest) (*runtimev1pb.GetConfigurationResponse, error)
 	// SaveConfiguration saves configuration into configuration store.
-	SaveConfiguration(context.Context, *runtimev1pb.SaveConfigurationRequest) (*emptypb.Empty, error)
+	SaveConfiguration(context.Context, *runtimev1pb.SaveConfigurationRequest) (*runtimev1pb.SaveConfigurationResponse, error)
 	// DeleteConfiguration deletes configuration from configuration store.
 	DeleteConfiguration(context.Context, *runtimev1pb.DeleteConfigurationRequest) (*emptypb.Empty, error)
 	// SubscribeConfiguration gets configuration from configuration store and subscribe the updates.
 	SubscribeConfiguration(runtimev1pb.Runtime_SubscribeConfigurationServer) error
 	// Publishes events to the specific topic.
 	PublishEvent(context.Context, *runtimev1pb.PublishEventRequest) (*emptypb.Empty, error)
+	// Waits until the events published asynchronously are sent.
+	Flush(context.Context, *runtimev1pb.FlushRequest) (*runtimev1pb.FlushResponse, error)
 	// State
 	GetState(ctx context.Context, in *runtimev1pb.GetStateRequest) (*runtimev1pb.GetStateResponse, error)
 	GetBulkState(ctx context.Context, in *runtimev1pb.GetBulkStateRequest) (*runtimev1pb.GetBulkStateResponse, error)
@@ -103,27 +112,64 @@ type API interface {
 	DeleteState(ctx context.Context, in *runtimev1pb.DeleteStateRequest) (*emptypb.Empty, error)
 	DeleteBulkState(ctx context.Context, in *runtimev1pb.DeleteBulkStateRequest) (*emptypb.Empty, error)
 	ExecuteStateTransaction(ctx context.Context, in *runtimev1pb.ExecuteStateTransactionRequest) (*emptypb.Empty, error)
+	ExecuteMultiStoreStateTransaction(ctx context.Context, in *runtimev1pb.ExecuteMultiStoreStateTransactionRequest) (*runtimev1pb.ExecuteMultiStoreStateTransactionResponse, error)
+	CompareAndSwap(ctx context.Context, in *runtimev1pb.CompareAndSwapRequest) (*runtimev1pb.CompareAndSwapResponse, error)
+	Increment(ctx context.Context, in *runtimev1pb.IncrementRequest) (*runtimev1pb.IncrementResponse, error)
+	Decrement(ctx context.Context, in *runtimev1pb.DecrementRequest) (*runtimev1pb.DecrementResponse, error)
+	DeleteStateByPrefix(ctx context.Context, in *runtimev1pb.DeleteStateByPrefixRequest) (*runtimev1pb.DeleteStateByPrefixResponse, error)
+	QueryState(ctx context.Context, in *runtimev1pb.QueryStateRequest) (*runtimev1pb.QueryStateResponse, error)
+	CheckAndRecordIdempotency(ctx context.Context, in *runtimev1pb.CheckAndRecordIdempotencyRequest) (*runtimev1pb.CheckAndRecordIdempotencyResponse, error)
+	CreateSession(ctx context.Context, in *runtimev1pb.CreateSessionRequest) (*runtimev1pb.CreateSessionResponse, error)
+	GetSession(ctx context.Context, in *runtimev1pb.GetSessionRequest) (*runtimev1pb.GetSessionResponse, error)
+	TouchSession(ctx context.Context, in *runtimev1pb.TouchSessionRequest) (*runtimev1pb.TouchSessionResponse, error)
+	RevokeSession(ctx context.Context, in *runtimev1pb.RevokeSessionRequest) (*emptypb.Empty, error)
 	// Get File
 	GetFile(*runtimev1pb.GetFileRequest, runtimev1pb.Runtime_GetFileServer) error
 	// Put file with stream.
 	PutFile(runtimev1pb.Runtime_PutFileServer) error
+	PutFileWithProgress(runtimev1pb.Runtime_PutFileWithProgressServer) error
 	// List all files
 	ListFile(ctx context.Context, in *runtimev1pb.ListFileRequest) (*runtimev1pb.ListFileResp, error)
 	//Delete specific file
 	DelFile(ctx context.Context, in *runtimev1pb.DelFileRequest) (*emptypb.Empty, error)
 	// Get file meta data, if file not exist,return code.NotFound error
 	GetFileMeta(ctx context.Context, in *runtimev1pb.GetFileMetaRequest) (*runtimev1pb.GetFileMetaResponse, error)
+	// Replace the tags of specific file, if file not exist,return code.NotFound error
+	TagFile(ctx context.Context, in *runtimev1pb.TagFileRequest) (*emptypb.Empty, error)
+	RestoreFile(ctx context.Context, in *runtimev1pb.RestoreFileRequest) (*emptypb.Empty, error)
 	// Distributed Lock API
 	TryLock(context.Context, *runtimev1pb.TryLockRequest) (*runtimev1pb.TryLockResponse, error)
 	Unlock(context.Context, *runtimev1pb.UnlockRequest) (*runtimev1pb.UnlockResponse, error)
+	TryLockBulk(context.Context, *runtimev1pb.TryLockBulkRequest) (*runtimev1pb.TryLockBulkResponse, error)
 	// Sequencer API
 	GetNextId(context.Context, *runtimev1pb.GetNextIdRequest) (*runtimev1pb.GetNextIdResponse, error)
 	// InvokeBinding Binding API
 	InvokeBinding(context.Context, *runtimev1pb.InvokeBindingRequest) (*runtimev1pb.InvokeBindingResponse, error)
+	// Lists the output bindings with their operations
+	ListBindings(context.Context, *runtimev1pb.ListBindingsRequest) (*runtimev1pb.ListBindingsResponse, error)
+	// Gets the operations of an output binding
+	GetBindingOperations(context.Context, *runtimev1pb.GetBindingOperationsRequest) (*runtimev1pb.GetBindingOperationsResponse, error)
 	// Gets secrets from secret stores.
 	GetSecret(context.Context, *runtimev1pb.GetSecretRequest) (*runtimev1pb.GetSecretResponse, error)
 	// Gets a bulk of secrets
 	GetBulkSecret(context.Context, *runtimev1pb.GetBulkSecretRequest) (*runtimev1pb.GetBulkSecretResponse, error)
+	// Subscribes the changes of secrets
+	SubscribeSecret(*runtimev1pb.SubscribeSecretRequest, runtimev1pb.Runtime_SubscribeSecretServer) error
+	// Renders the template with secrets
+	RenderTemplate(context.Context, *runtimev1pb.RenderTemplateRequest) (*runtimev1pb.RenderTemplateResponse, error)
+	// Executes multiple operations concurrently in one round trip
+	Batch(context.Context, *runtimev1pb.BatchRequest) (*runtimev1pb.BatchResponse, error)
+	// Reports whether the sidecar is ready to serve
+	GetReadiness(context.Context, *runtimev1pb.GetReadinessRequest) (*runtimev1pb.GetReadinessResponse, error)
+	// Subscribes to a topic and receives the events over the stream
+	SubscribeTopicEvents(runtimev1pb.Runtime_SubscribeTopicEventsServer) error
+	// Gets the metadata of the sidecar
+	GetMetadata(context.Context, *runtimev1pb.GetMetadataRequest) (*runtimev1pb.GetMetadataResponse, error)
+	GetPayloadSchemas(context.Context, *runtimev1pb.GetPayloadSchemasRequest) (*runtimev1pb.GetPayloadSchemasResponse, error)
+	// Evaluates a feature flag in the config store
+	EvaluateFeatureFlag(context.Context, *runtimev1pb.EvaluateFeatureFlagRequest) (*runtimev1pb.EvaluateFeatureFlagResponse, error)
+	// Subscribes the evaluations of feature flags
+	SubscribeFeatureFlag(*runtimev1pb.SubscribeFeatureFlagRequest, runtimev1pb.Runtime_SubscribeFeatureFlagServer) error
 	// GrpcAPI related
 	grpc_api.GrpcAPI
 }
@@ -143,9 +189,20 @@ type api struct {
 	sequencers               map[string]sequencer.Store
 	sendToOutputBindingFn    func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error)
 	secretStores             map[string]secretstores.SecretStore
+	listOutputBindingsFn     func() map[string][]bindings.OperationKind
 	// app callback
 	AppCallbackConn   *grpc.ClientConn
+	appCallback       runtimev1pb.AppCallbackClient
 	topicPerComponent map[string]TopicSubscriptions
+	// subscription status is reported by the readiness API
+	subscriptionStatus     health.Status
+	subscriptionStatusLock sync.RWMutex
+	// subscriptionGates maps pubsub name to topic to the gate pausing the delivery
+	subscriptionGates     map[string]map[string]*runtime_pubsub.Gate
+	subscriptionGatesLock sync.RWMutex
+	// topicEventStreams maps pubsub name to topic to the subscription by SubscribeTopicEvents
+	topicEventStreams     map[string]map[string]*topicEventStream
+	topicEventStreamsLock sync.Mutex
 	// json
 	json jsoniter.API
 }
@@ -153,19 +210,30 @@ type api struct {
 func (a *api) Init(conn *grpc.ClientConn) error {
 	// 1. set connection
 	a.AppCallbackConn = conn
-	return a.startSubscribing()
+	// 2. subscribe the topics
+	err := a.startSubscribing()
+	if err != nil {
+		a.setSubscriptionStatus(health.DOWN)
+	} else {
+		a.setSubscriptionStatus(health.UP)
+	}
+	return err
 }
 
 func (a *api) Register(s *grpc.Server, registeredServer mgrpc.RegisteredServer) (mgrpc.RegisteredServer, error) {
 	LayottoAPISingleton = a
 	runtimev1pb.RegisterRuntimeServer(s, a)
+	healthpb.RegisterHealthServer(s, &healthServer{api: a})
 	return registeredServer, nil
 }
 
 func NewGrpcAPI(ac *grpc_api.ApplicationContext) grpc_api.GrpcAPI {
-	return NewAPI(ac.AppId,
+	a := NewAPI(ac.AppId,
 		ac.Hellos, ac.ConfigStores, ac.Rpcs, ac.PubSubs, ac.StateStores, ac.Files, ac.LockStores, ac.Sequencers,
 		ac.SendToOutputBindingFn, ac.SecretStores)
+	a.(*api).appCallback = ac.AppCallback
+	a.(*api).listOutputBindingsFn = ac.ListOutputBindingsFn
+	return a
 }
 
 func NewAPI(
@@ -207,6 +275,7 @@ func NewAPI(
 		sendToOutputBindingFn:    sendToOutputBindingFn,
 		secretStores:             secretStores,
 		json:                     jsoniter.ConfigFastest,
+		subscriptionStatus:       health.INIT,
 	}
 }
 
@@ -216,9 +285,17 @@ func (a *api) SayHello(ctx context.Context, in *runtimev1pb.SayHelloRequest) (*r
 		log.DefaultLogger.Errorf("[runtime] [grpc.say_hello] get hello error: %v", err)
 		return nil, err
 	}
+	// the latency and the errors are injected by the metadata for testing the clients, if the service allows it
+	if f, ok := h.(hello.FaultInjectable); ok && f.FaultInjectionEnabled() {
+		if err = injectHelloFault(ctx, in.Metadata); err != nil {
+			return nil, err
+		}
+	}
 	// create hello request based on pb.go struct
 	req := &hello.HelloRequest{
-		Name: in.Name,
+		Name:     in.Name,
+		Locale:   in.Metadata[helloMetadataLocale],
+		Metadata: in.Metadata,
 	}
 	resp, err := h.Hello(ctx, req)
 	if err != nil {
@@ -227,8 +304,9 @@ func (a *api) SayHello(ctx context.Context, in *runtimev1pb.SayHelloRequest) (*r
 	}
 	// create response base on hello.Response
 	return &runtimev1pb.SayHelloResponse{
-		Hello: resp.HelloString,
-		Data:  in.Data,
+		Hello:    resp.HelloString,
+		Data:     in.Data,
+		Metadata: in.Metadata,
 	}, nil
 
 }
@@ -280,10 +358,11 @@ func (a *api) InvokeService(ctx context.Context, in *runtimev1pb.InvokeServiceRe
 // GetConfiguration gets configuration from configuration store.
 func (a *api) GetConfiguration(ctx context.Context, req *runtimev1pb.GetConfigurationRequest) (*runtimev1pb.GetConfigurationResponse, error) {
 	resp := &runtimev1pb.GetConfigurationResponse{}
+	req.StoreName = alias.Resolve(alias.ConfigStore, req.StoreName)
 	// check store type supported or not
 	store, ok := a.configStores[req.StoreName]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("configure store [%+v] don't support now", req.StoreName))
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, req.StoreName)
 	}
 	//here protect user use space for sting, eg: " ", "de fault"
 	if strings.ReplaceAll(req.Group, " ", "") == "" {
@@ -292,10 +371,32 @@ func (a *api) GetConfiguration(ctx context.Context, req *runtimev1pb.GetConfigur
 	if strings.ReplaceAll(req.Label, " ", "") == "" {
 		req.Label = store.GetDefaultLabel()
 	}
-	items, err := store.Get(ctx, &configstores.GetRequest{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: req.Keys, Metadata: req.Metadata})
+	getReq := &configstores.GetRequest{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: req.Keys, Metadata: req.Metadata, Tags: req.Tags}
+	if len(req.Keys) == 0 {
+		getReq.KeyPattern = req.KeyPattern
+	}
+	var items []*configstores.ConfigurationItem
+	var err error
+	if cached, ok := store.(*configstores.CachedStore); ok {
+		// serve the last known good values with staleness if the store is unavailable
+		var staleness *configstores.Staleness
+		items, staleness, err = cached.GetWithFallback(ctx, getReq)
+		if staleness != nil {
+			resp.Stale = true
+			resp.CachedAt = staleness.CachedAt.UnixNano() / int64(time.Millisecond)
+		}
+	} else {
+		items, err = store.Get(ctx, getReq)
+	}
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("get configuration failed with error: %+v", err))
 	}
+	// filter the items if the store can't do it
+	if !configstores.SupportFilter(store) {
+		items = configstores.FilterItems(getReq, items)
+	}
+	// only return the items matching gray release rules, the same as SubscribeConfiguration
+	items = configstores.NewGrayTarget(req.Metadata).Filter(items)
 	for _, item := range items {
 		resp.Items = append(resp.Items, &runtimev1pb.ConfigurationItem{Group: item.Group, Label: item.Label, Key: item.Key, Content: item.Content, Tags: item.Tags, Metadata: item.Metadata})
 	}
@@ -303,10 +404,11 @@ func (a *api) GetConfiguration(ctx context.Context, req *runtimev1pb.GetConfigur
 }
 
 // SaveConfiguration saves configuration into configuration store.
-func (a *api) SaveConfiguration(ctx context.Context, req *runtimev1pb.SaveConfigurationRequest) (*emptypb.Empty, error) {
+func (a *api) SaveConfiguration(ctx context.Context, req *runtimev1pb.SaveConfigurationRequest) (*runtimev1pb.SaveConfigurationResponse, error) {
+	req.StoreName = alias.Resolve(alias.ConfigStore, req.StoreName)
 	store, ok := a.configStores[req.StoreName]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("configure store [%+v] don't support now", req.StoreName))
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, req.StoreName)
 	}
 	setReq := &configstores.SetRequest{}
 	setReq.AppId = req.AppId
@@ -321,15 +423,32 @@ func (a *api) SaveConfiguration(ctx context.Context, req *runtimev1pb.SaveConfig
 		}
 		setReq.Items = append(setReq.Items, &configstores.ConfigurationItem{Group: item.Group, Label: item.Label, Key: item.Key, Content: item.Content, Tags: item.Tags, Metadata: item.Metadata})
 	}
-	err := store.Set(ctx, setReq)
-	return &emptypb.Empty{}, err
+	resp := &runtimev1pb.SaveConfigurationResponse{}
+	if !req.Atomic {
+		err := store.Set(ctx, setReq)
+		return resp, err
+	}
+	native, err := configstores.SetAtomically(ctx, store, setReq)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.SaveConfiguration] error: %v", err)
+		if e, ok := err.(*configstores.BatchError); ok && !e.RolledBack() {
+			return nil, messages.Error(codes.DataLoss, err.Error())
+		}
+		return nil, messages.Error(codes.Aborted, err.Error())
+	}
+	resp.Atomicity = runtimev1pb.SaveConfigurationResponse_EMULATED
+	if native {
+		resp.Atomicity = runtimev1pb.SaveConfigurationResponse_NATIVE
+	}
+	return resp, nil
 }
 
 // DeleteConfiguration deletes configuration from configuration store.
 func (a *api) DeleteConfiguration(ctx context.Context, req *runtimev1pb.DeleteConfigurationRequest) (*emptypb.Empty, error) {
+	req.StoreName = alias.Resolve(alias.ConfigStore, req.StoreName)
 	store, ok := a.configStores[req.StoreName]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("configure store [%+v] don't support now", req.StoreName))
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, req.StoreName)
 	}
 	if strings.ReplaceAll(req.Group, " ", "") == "" {
 		req.Group = store.GetDefaultGroup()
@@ -343,16 +462,23 @@ func (a *api) DeleteConfiguration(ctx context.Context, req *runtimev1pb.DeleteCo
 
 // SubscribeConfiguration gets configuration from configuration store and subscribe the updates.
 func (a *api) SubscribeConfiguration(sub runtimev1pb.Runtime_SubscribeConfigurationServer) error {
-	wg := sync.WaitGroup{}
-	wg.Add(2)
 	var subErr error
 	respCh := make(chan *configstores.SubscribeResp)
 	recvExitCh := make(chan struct{})
+	writerExitCh := make(chan struct{})
+	sendFailedCh := make(chan struct{})
+	senderExitCh := make(chan struct{})
+	var sendErr error
 	subscribedStore := make([]configstores.Store, 0, 1)
+	// subscriber buffers the responses, so that a slow consumer doesn't block the components
+	subscriber := newConfigurationSubscriber()
+	defer subscriber.close()
+	// target is used to match the gray release rules of items
+	var target *configstores.GrayTarget
+	var targetLock sync.RWMutex
 	// TODO currently this goroutine model is error-prone,and it should be refactored after new version of configuration API being accepted
 	// 1. start a reader goroutine
 	utils.GoWithRecover(func() {
-		defer wg.Done()
 		for {
 			// 1.1. read stream
 			req, err := sub.Recv()
@@ -370,15 +496,16 @@ func (a *api) SubscribeConfiguration(sub runtimev1pb.Runtime_SubscribeConfigurat
 				return
 			}
 			// 1.3. else find the component and delegate to it
+			req.StoreName = alias.Resolve(alias.ConfigStore, req.StoreName)
 			store, ok := a.configStores[req.StoreName]
 			// 1.3.1. stop if StoreName is not supported
 			if !ok {
-				log.DefaultLogger.Errorf("configure store [%+v] don't support now", req.StoreName)
+				log.DefaultLogger.Errorf(messages.ErrConfigStoreNotFound, req.StoreName)
 				// stop all the subscribers
 				for _, store := range subscribedStore {
 					store.StopSubscribe()
 				}
-				subErr = errors.New(fmt.Sprintf("configure store [%+v] don't support now", req.StoreName))
+				subErr = messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, req.StoreName)
 				// stop writer goroutine
 				close(recvExitCh)
 				return
@@ -390,14 +517,26 @@ func (a *api) SubscribeConfiguration(sub runtimev1pb.Runtime_SubscribeConfigurat
 			if strings.ReplaceAll(req.Label, " ", "") == "" {
 				req.Label = store.GetDefaultLabel()
 			}
-			// 1.3.3. delegate to the component
-			store.Subscribe(&configstores.SubscribeReq{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: req.Keys, Metadata: req.Metadata}, respCh)
+			// 1.3.3. the latest request decides how to match gray release rules and how to buffer the responses
+			targetLock.Lock()
+			target = configstores.NewGrayTarget(req.Metadata)
+			targetLock.Unlock()
+			subscriber.configure(req.Metadata)
+			// 1.3.4. delegate to the component, whose responses carry the name of the store subscribed,
+			// since the components may name themselves differently, e.g. "etcd"
+			storeCh := make(chan *configstores.SubscribeResp)
+			store.Subscribe(&configstores.SubscribeReq{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: req.Keys, Metadata: req.Metadata}, storeCh)
 			subscribedStore = append(subscribedStore, store)
+			// 1.3.5. send the current values as a snapshot, so that the app can build its local cache before applying the updates,
+			// or only the changes missed if the app resumes the subscription and the store keeps the revisions.
+			// They are queried after subscribing, so no update is lost in between, and the updates wait in the channel
+			// of the store until the snapshot is sent, so that the snapshot is never delivered after them.
+			forwardConfigurationResponses(req.StoreName, configurationSnapshot(store, req), storeCh, respCh, writerExitCh)
 		}
 	}, nil)
 	// 2. start a writer goroutine
 	utils.GoWithRecover(func() {
-		defer wg.Done()
+		defer close(writerExitCh)
 		for {
 			select {
 			// read response from components
@@ -405,72 +544,159 @@ func (a *api) SubscribeConfiguration(sub runtimev1pb.Runtime_SubscribeConfigurat
 				if !ok {
 					return
 				}
+				// only send the items matching gray release rules
+				targetLock.RLock()
+				t := target
+				targetLock.RUnlock()
+				matched := resp.Items
+				if t != nil {
+					matched = t.Filter(resp.Items)
+				}
+				if len(matched) == 0 && !resp.Snapshot {
+					continue
+				}
 				items := make([]*runtimev1pb.ConfigurationItem, 0, 10)
-				for _, item := range resp.Items {
-					items = append(items, &runtimev1pb.ConfigurationItem{Group: item.Group, Label: item.Label, Key: item.Key, Content: item.Content, Tags: item.Tags, Metadata: item.Metadata})
+				for _, item := range matched {
+					items = append(items, &runtimev1pb.ConfigurationItem{Group: item.Group, Label: item.Label, Key: item.Key, Content: item.Content, Tags: item.Tags, Metadata: item.Metadata, Deleted: item.Deleted})
 				}
-				// write to response stream
-				sub.Send(&runtimev1pb.SubscribeConfigurationResponse{StoreName: resp.StoreName, AppId: resp.StoreName, Items: items})
+				respType := runtimev1pb.SubscribeConfigurationResponse_INCREMENTAL
+				if resp.Snapshot {
+					respType = runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT
+				}
+				// buffer the response, which will be written to response stream by the sender goroutine
+				subscriber.push(&runtimev1pb.SubscribeConfigurationResponse{StoreName: resp.StoreName, AppId: resp.StoreName, Items: items, Type: respType,
+					ResumeToken: encodeResumeToken(resp.Revision)}, resp.ChangedAt)
 			//	read exit signal
 			case <-recvExitCh:
 				return
+			case <-sendFailedCh:
+				return
+			}
+		}
+	}, nil)
+	// 3. start a sender goroutine
+	utils.GoWithRecover(func() {
+		defer close(senderExitCh)
+		for {
+			r, ok := subscriber.pop(writerExitCh)
+			if !ok {
+				return
+			}
+			// write to response stream
+			err := sub.Send(r.resp)
+			subscriber.onSent(r, err)
+			if err != nil {
+				log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeConfiguration] send response error: %v", err)
+				sendErr = err
+				close(sendFailedCh)
+				return
 			}
 		}
 	}, nil)
-	wg.Wait()
+	// 4. exit when the stream is broken. If it's found by the sender, the reader blocked in Recv doesn't have to be waited,
+	// since the stream is canceled once the handler returns, and then the reader stops the subscribers and exits.
+	select {
+	case <-recvExitCh:
+	case <-sendFailedCh:
+	}
+	<-writerExitCh
+	<-senderExitCh
 	log.DefaultLogger.Warnf("subscribe gorountine exit")
+	if sendErr != nil {
+		return sendErr
+	}
 	return subErr
 }
 
 func (a *api) PublishEvent(ctx context.Context, in *runtimev1pb.PublishEventRequest) (*emptypb.Empty, error) {
-	result, err := a.doPublishEvent(ctx, in.PubsubName, in.Topic, in.Data, in.DataContentType, in.Metadata)
+	pubsubName := alias.Resolve(alias.PubSub, in.PubsubName)
+	metadata := runtime_pubsub.WithPartitionKey(pubsubName, in.Metadata, in.PartitionKey)
+	result, err := a.doPublishEvent(ctx, pubsubName, in.Topic, in.Data, in.DataContentType, metadata, in.Async)
 	if err != nil {
 		log.DefaultLogger.Errorf("[runtime] [grpc.PublishEvent] %v", err)
 	}
 	return result, err
 }
 
+// Flush waits until the events published asynchronously are sent to the pubsub component.
+func (a *api) Flush(ctx context.Context, in *runtimev1pb.FlushRequest) (*runtimev1pb.FlushResponse, error) {
+	pubsubName := alias.Resolve(alias.PubSub, in.PubsubName)
+	if pubsubName == "" {
+		return &runtimev1pb.FlushResponse{}, messages.Error(codes.InvalidArgument, messages.ErrPubsubEmpty)
+	}
+	component, ok := a.pubSubs[pubsubName]
+	if !ok {
+		return &runtimev1pb.FlushResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrPubsubNotFound, pubsubName)
+	}
+	publisher, ok := component.(runtime_pubsub.AsyncPublisher)
+	if !ok {
+		return &runtimev1pb.FlushResponse{}, messages.Errorf(codes.FailedPrecondition, messages.ErrPubsubAsyncNotEnabled, pubsubName)
+	}
+	failed, err := publisher.Flush(ctx, asyncCaller(ctx))
+	if err != nil {
+		err = messages.Errorf(codes.DeadlineExceeded, messages.ErrPubsubFlush, pubsubName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.Flush] %v", err)
+		return &runtimev1pb.FlushResponse{}, err
+	}
+	return &runtimev1pb.FlushResponse{Failed: failed}, nil
+}
+
+// asyncCaller identifies the caller of async publishing by its connection,
+// so that the failures of its events are reported to its flushes only
+func asyncCaller(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
 // doPublishEvent is a protocal irrelevant function to do event publishing.
 // It's easy to add APIs for other protocals.Just move this func to a separate layer if you need.
-func (a *api) doPublishEvent(ctx context.Context, pubsubName string, topic string, data []byte, contentType string, metadata map[string]string) (*emptypb.Empty, error) {
+func (a *api) doPublishEvent(ctx context.Context, pubsubName string, topic string, data []byte, contentType string, metadata map[string]string, async bool) (*emptypb.Empty, error) {
 	// 1. validate
 	if pubsubName == "" {
-		err := status.Error(codes.InvalidArgument, messages.ErrPubsubEmpty)
+		err := messages.Error(codes.InvalidArgument, messages.ErrPubsubEmpty)
 		return &emptypb.Empty{}, err
 	}
 	if topic == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrTopicEmpty, pubsubName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrTopicEmpty, pubsubName)
 		return &emptypb.Empty{}, err
 	}
 	// 2. get component
 	component, ok := a.pubSubs[pubsubName]
 	if !ok {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrPubsubNotFound, pubsubName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrPubsubNotFound, pubsubName)
 		return &emptypb.Empty{}, err
 	}
 
 	// 3. new cloudevent request
-	if data == nil {
-		data = []byte{}
-	}
-	var envelope map[string]interface{}
-	var err error = nil
-	if contrib_contenttype.IsCloudEventContentType(contentType) {
-		envelope, err = contrib_pubsub.FromCloudEvent(data, topic, pubsubName, "")
-		if err != nil {
-			err = status.Errorf(codes.InvalidArgument, messages.ErrPubsubCloudEventCreation, err.Error())
-			return &emptypb.Empty{}, err
+	var b []byte
+	var err error
+	features := component.Features()
+	// the envelope is in protobuf format if the data is a protobuf message, otherwise in json format
+	switch {
+	case contrib_contenttype.IsCloudEventContentType(contentType):
+		b, err = runtime_pubsub.PatchCloudEvent(data, topic, pubsubName, "", features, metadata)
+	case runtime_pubsub.IsProtoCloudEventContentType(contentType):
+		b, err = runtime_pubsub.PatchProtoCloudEvent(data, topic, pubsubName, "", features, metadata)
+	default:
+		ce := &runtime_pubsub.CloudEvent{
+			ID:              uuid.New().String(),
+			Source:          l8_comp_pubsub.DefaultCloudEventSource,
+			Type:            l8_comp_pubsub.DefaultCloudEventType,
+			Topic:           topic,
+			PubsubName:      pubsubName,
+			DataContentType: contentType,
+			Data:            data,
+		}
+		if runtime_pubsub.IsProtobufContentType(contentType) {
+			b = runtime_pubsub.MarshalProtoCloudEvent(ce, features, metadata)
+		} else {
+			b = runtime_pubsub.MarshalCloudEvent(ce, features, metadata)
 		}
-	} else {
-		envelope = contrib_pubsub.NewCloudEventsEnvelope(uuid.New().String(), l8_comp_pubsub.DefaultCloudEventSource, l8_comp_pubsub.DefaultCloudEventType, "", topic, pubsubName,
-			contentType, data, "")
 	}
-	features := component.Features()
-	pubsub.ApplyMetadata(envelope, features, metadata)
-
-	b, err := jsoniter.ConfigFastest.Marshal(envelope)
 	if err != nil {
-		err = status.Errorf(codes.InvalidArgument, messages.ErrPubsubCloudEventsSer, topic, pubsubName, err.Error())
+		err = messages.Errorf(codes.InvalidArgument, messages.ErrPubsubCloudEventCreation, err.Error())
 		return &emptypb.Empty{}, err
 	}
 	// 4. publish
@@ -482,9 +708,19 @@ func (a *api) doPublishEvent(ctx context.Context, pubsubName string, topic strin
 	}
 
 	// TODO limit topic scope
+	if async {
+		publisher, ok := component.(runtime_pubsub.AsyncPublisher)
+		if !ok {
+			return &emptypb.Empty{}, messages.Errorf(codes.FailedPrecondition, messages.ErrPubsubAsyncNotEnabled, pubsubName)
+		}
+		if err = publisher.PublishAsync(asyncCaller(ctx), &req); err != nil {
+			return &emptypb.Empty{}, messages.Errorf(codes.ResourceExhausted, messages.ErrPubsubAsyncEnqueue, topic, pubsubName, err.Error())
+		}
+		return &emptypb.Empty{}, nil
+	}
 	err = component.Publish(&req)
 	if err != nil {
-		nerr := status.Errorf(codes.Internal, messages.ErrPubsubPublishMessage, topic, pubsubName, err.Error())
+		nerr := messages.Errorf(codes.Internal, messages.ErrPubsubPublishMessage, topic, pubsubName, err.Error())
 		return &emptypb.Empty{}, nerr
 	}
 	return &emptypb.Empty{}, nil
@@ -492,11 +728,11 @@ func (a *api) doPublishEvent(ctx context.Context, pubsubName string, topic strin
 
 func (a *api) getStateStore(name string) (state.Store, error) {
 	if a.stateStores == nil || len(a.stateStores) == 0 {
-		return nil, status.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
+		return nil, messages.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
 	}
 
 	if a.stateStores[name] == nil {
-		return nil, status.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, name)
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, name)
 	}
 	return a.stateStores[name], nil
 }
@@ -505,29 +741,43 @@ func (a *api) getStateStore(name string) (state.Store, error) {
 func (a *api) wrapDaprComponentError(err error, format string, args ...interface{}) error {
 	e, ok := err.(*state.ETagError)
 	if !ok {
-		return status.Errorf(codes.Internal, format, args...)
+		return messages.Errorf(codes.Internal, format, args...)
 	}
 	switch e.Kind() {
 	case state.ETagMismatch:
-		return status.Errorf(codes.Aborted, format, args...)
+		return messages.Errorf(codes.Aborted, format, args...)
 	case state.ETagInvalid:
-		return status.Errorf(codes.InvalidArgument, format, args...)
+		return messages.Errorf(codes.InvalidArgument, format, args...)
 	}
 
-	return status.Errorf(codes.Internal, format, args...)
+	return messages.Errorf(codes.Internal, format, args...)
 }
 
 func (a *api) GetFile(req *runtimev1pb.GetFileRequest, stream runtimev1pb.Runtime_GetFileServer) error {
 	if a.fileOps[req.StoreName] == nil {
-		return status.Errorf(codes.InvalidArgument, "not supported store type: %+v", req.StoreName)
+		return messages.Errorf(codes.InvalidArgument, "not supported store type: %+v", req.StoreName)
 	}
 	if req.Metadata == nil {
 		req.Metadata = make(map[string]string)
 	}
+	// the total size is unknown if the meta data can't be got
+	var progress *runtimev1pb.FileProgress
+	if req.Progress {
+		progress = &runtimev1pb.FileProgress{}
+		meta, err := a.fileOps[req.StoreName].Stat(stream.Context(), &file.FileMetaRequest{FileName: req.Name, Metadata: req.Metadata})
+		if err == nil {
+			// the size of the compressed files isn't the size got
+			if !runtime_file.IsCompressed(meta.UserMetadata) {
+				progress.TotalBytes = meta.Size
+			}
+		} else {
+			log.DefaultLogger.Warnf("[runtime] [grpc.GetFile] get meta data of file %s error: %v", req.Name, err)
+		}
+	}
 	st := &file.GetFileStu{FileName: req.Name, Metadata: req.Metadata}
 	data, err := a.fileOps[req.StoreName].Get(stream.Context(), st)
 	if err != nil {
-		return status.Errorf(codes.Internal, "get file fail,err: %+v", err)
+		return messages.Errorf(codes.Internal, "get file fail,err: %+v", err)
 	}
 
 	buffsPtr := bytesPool.Get().(*[]byte)
@@ -545,26 +795,45 @@ func (a *api) GetFile(req *runtimev1pb.GetFileRequest, stream runtimev1pb.Runtim
 		length, err := data.Read(buf)
 		if err != nil && err != io.EOF {
 			log.DefaultLogger.Warnf("get file fail, err: %+v", err)
-			return status.Errorf(codes.Internal, "get file fail,err: %+v", err)
+			return messages.Errorf(codes.Internal, "get file fail,err: %+v", err)
 		}
 		if err == nil || (err == io.EOF && length != 0) {
 			resp := &runtimev1pb.GetFileResponse{Data: buf[:length]}
+			if progress != nil {
+				progress.BytesTransferred += int64(length)
+				resp.Progress = &runtimev1pb.FileProgress{BytesTransferred: progress.BytesTransferred, TotalBytes: progress.TotalBytes}
+			}
 			if err = stream.Send(resp); err != nil {
-				return status.Errorf(codes.Internal, "send file data fail,err: %+v", err)
+				return messages.Errorf(codes.Internal, "send file data fail,err: %+v", err)
 			}
 		}
 		if err == io.EOF {
+			if progress == nil {
+				return nil
+			}
+			progress.Done = true
+			if err = stream.Send(&runtimev1pb.GetFileResponse{Progress: progress}); err != nil {
+				return messages.Errorf(codes.Internal, "send file data fail,err: %+v", err)
+			}
 			return nil
 		}
 	}
 }
 
+// putFileStream is the stream of PutFile or PutFileWithProgress
+type putFileStream interface {
+	Recv() (*runtimev1pb.PutFileRequest, error)
+	Context() context.Context
+}
+
 type putObjectStreamReader struct {
 	data   []byte
-	server runtimev1pb.Runtime_PutFileServer
+	server putFileStream
+	// consumed is the bytes read by the component
+	consumed int64
 }
 
-func newPutObjectStreamReader(data []byte, server runtimev1pb.Runtime_PutFileServer) *putObjectStreamReader {
+func newPutObjectStreamReader(data []byte, server putFileStream) *putObjectStreamReader {
 	return &putObjectStreamReader{data: data, server: server}
 }
 
@@ -576,6 +845,7 @@ func (r *putObjectStreamReader) Read(p []byte) (int, error) {
 			n := copy(p[count:], r.data)
 			r.data = r.data[n:]
 			count += n
+			r.consumed += int64(n)
 			if count == total {
 				return count, nil
 			}
@@ -592,48 +862,130 @@ func (r *putObjectStreamReader) Read(p []byte) (int, error) {
 }
 
 func (a *api) PutFile(stream runtimev1pb.Runtime_PutFileServer) error {
-	req, err := stream.Recv()
-	if err != nil {
+	if _, _, err := a.putFile(stream, nil); err != nil {
 		//if client send eof error directly, return nil
 		if err == io.EOF {
 			return nil
 		}
-		return status.Errorf(codes.Internal, "receive file data fail: err: %+v", err)
+		return err
+	}
+	stream.SendAndClose(&empty.Empty{})
+	return nil
+}
+
+// PutFileWithProgress is the same as PutFile, besides the progress is sent back while the data is uploaded.
+// The progress is sent only once the file is stored if the component can't report the bytes uploaded.
+func (a *api) PutFileWithProgress(stream runtimev1pb.Runtime_PutFileWithProgressServer) error {
+	var (
+		// the component may report the progress from its goroutines
+		mu      sync.Mutex
+		sendErr error
+	)
+	first, stored, err := a.putFile(stream, func(first *runtimev1pb.PutFileRequest, uploaded int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the stream is broken if it fails, so the component fails to receive the next chunk
+		if sendErr == nil {
+			sendErr = stream.Send(&runtimev1pb.FileProgress{BytesTransferred: uploaded, TotalBytes: first.Size})
+		}
+	})
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return stream.Send(&runtimev1pb.FileProgress{BytesTransferred: stored, TotalBytes: first.Size, Done: true})
+}
+
+// putFile stores the data of the stream, and returns the first request and the bytes stored.
+// The onProgress is called with the first request and the bytes uploaded if the component implements file.ProgressSupporter.
+// If the client is gone, the stream is broken and the incomplete uploads of the file are aborted, e.g. the multipart uploads of s3.
+func (a *api) putFile(stream putFileStream, onProgress func(first *runtimev1pb.PutFileRequest, uploaded int64)) (*runtimev1pb.PutFileRequest, int64, error) {
+	req, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return nil, 0, err
+		}
+		return nil, 0, messages.Errorf(codes.Internal, "receive file data fail: err: %+v", err)
 	}
 
 	if a.fileOps[req.StoreName] == nil {
-		return status.Errorf(codes.InvalidArgument, "not support store type: %+v", req.StoreName)
+		return nil, 0, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", req.StoreName)
 	}
 	fileReader := newPutObjectStreamReader(req.Data, stream)
 	if req.Metadata == nil {
 		req.Metadata = make(map[string]string)
 	}
-	st := &file.PutFileStu{DataStream: fileReader, FileName: req.Name, Metadata: req.Metadata}
-	if err = a.fileOps[req.StoreName].Put(stream.Context(), st); err != nil {
-		return status.Errorf(codes.Internal, err.Error())
+	st := &file.PutFileStu{DataStream: fileReader, FileName: req.Name, Metadata: req.Metadata, StorageClass: req.StorageClass}
+	if s, ok := a.fileOps[req.StoreName].(file.ProgressSupporter); ok && s.SupportProgress() && onProgress != nil {
+		st.Progress = func(uploaded int64) {
+			onProgress(req, uploaded)
+		}
 	}
-	stream.SendAndClose(&empty.Empty{})
-	return nil
+	ctx := stream.Context()
+	start := time.Now()
+	if err = a.fileOps[req.StoreName].Put(ctx, st); err != nil {
+		if ctx.Err() != nil {
+			log.DefaultLogger.Warnf("[runtime] [grpc.PutFile] put file %s is canceled by the client after %d bytes", req.Name, fileReader.consumed)
+			// ctx is done already
+			abortCtx, cancel := context.WithTimeout(context.Background(), abortUploadsTimeout)
+			defer cancel()
+			if _, abortErr := runtime_file.AbortUploads(abortCtx, a.fileOps[req.StoreName], req.Name, req.Metadata, start); abortErr != nil {
+				log.DefaultLogger.Errorf("[runtime] [grpc.PutFile] abort the incomplete uploads of file %s error: %v", req.Name, abortErr)
+			}
+			return nil, 0, messages.Errorf(codes.Canceled, "put file %s is canceled: %v", req.Name, err)
+		}
+		return nil, 0, messages.Errorf(codes.Internal, err.Error())
+	}
+	return req, fileReader.consumed, nil
 }
 
 //ListFile list all files
 func (a *api) ListFile(ctx context.Context, in *runtimev1pb.ListFileRequest) (*runtimev1pb.ListFileResp, error) {
 	if in.Request == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "request can't be nil")
+		return nil, messages.Errorf(codes.InvalidArgument, "request can't be nil")
 	}
 	if in.Request.Metadata == nil {
 		in.Request.Metadata = make(map[string]string)
 	}
 
 	if a.fileOps[in.Request.StoreName] == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+		return nil, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+	}
+	if !file.IsValidSortKey(in.SortBy) {
+		return nil, messages.Errorf(codes.InvalidArgument, "not support sort key: %s", in.SortBy)
+	}
+	if in.ModifiedAfter > 0 && in.ModifiedBefore > 0 && in.ModifiedAfter >= in.ModifiedBefore {
+		return nil, messages.Errorf(codes.InvalidArgument, "modified_after should be less than modified_before")
 	}
-	resp, err := a.fileOps[in.Request.StoreName].List(ctx, &file.ListRequest{DirectoryName: in.Request.Name, PageSize: in.PageSize, Marker: in.Marker, Metadata: in.Request.Metadata})
+	req := &file.ListRequest{
+		DirectoryName:  in.Request.Name,
+		PageSize:       in.PageSize,
+		Marker:         in.Marker,
+		Metadata:       in.Request.Metadata,
+		Prefix:         in.Prefix,
+		Suffix:         in.Suffix,
+		MetadataFilter: in.MetadataFilter,
+		SortBy:         in.SortBy,
+		Descending:     in.Descending,
+	}
+	if in.ModifiedAfter > 0 {
+		req.ModifiedAfter = time.Unix(in.ModifiedAfter, 0)
+	}
+	if in.ModifiedBefore > 0 {
+		req.ModifiedBefore = time.Unix(in.ModifiedBefore, 0)
+	}
+	resp, err := a.fileOps[in.Request.StoreName].List(ctx, req)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, messages.Errorf(codes.Internal, err.Error())
 	}
+	// the filters are applied again for the components which don't support them.
+	// The marker of the component is kept, so a page may contain fewer files than page_size.
 	files := make([]*runtimev1pb.FileInfo, 0)
-	for _, v := range resp.Files {
+	for _, v := range file.FilterFiles(req, resp.Files) {
 		file := &runtimev1pb.FileInfo{}
 		file.FileName = v.FileName
 		file.LastModified = v.LastModified
@@ -648,20 +1000,20 @@ func (a *api) ListFile(ctx context.Context, in *runtimev1pb.ListFileRequest) (*r
 func (a *api) DelFile(ctx context.Context, in *runtimev1pb.DelFileRequest) (*emptypb.Empty, error) {
 	errCode := codes.Internal
 	if in.Request == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "request can't be nil")
+		return nil, messages.Errorf(codes.InvalidArgument, "request can't be nil")
 	}
 	if in.Request.Metadata == nil {
 		in.Request.Metadata = make(map[string]string)
 	}
 	if a.fileOps[in.Request.StoreName] == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+		return nil, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
 	}
 	err := a.fileOps[in.Request.StoreName].Del(ctx, &file.DelRequest{FileName: in.Request.Name, Metadata: in.Request.Metadata})
 	if err != nil {
 		if code, ok := FileErrMap2GrpcErr[err]; ok {
 			errCode = code
 		}
-		return nil, status.Errorf(errCode, err.Error())
+		return nil, messages.Errorf(errCode, err.Error())
 	}
 	return &emptypb.Empty{}, nil
 }
@@ -670,20 +1022,20 @@ func (a *api) DelFile(ctx context.Context, in *runtimev1pb.DelFileRequest) (*emp
 func (a *api) GetFileMeta(ctx context.Context, in *runtimev1pb.GetFileMetaRequest) (*runtimev1pb.GetFileMetaResponse, error) {
 	errCode := codes.Internal
 	if in.Request == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "request can't be nil")
+		return nil, messages.Errorf(codes.InvalidArgument, "request can't be nil")
 	}
 	if in.Request.Metadata == nil {
 		in.Request.Metadata = make(map[string]string)
 	}
 	if a.fileOps[in.Request.StoreName] == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+		return nil, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
 	}
 	resp, err := a.fileOps[in.Request.StoreName].Stat(ctx, &file.FileMetaRequest{FileName: in.Request.Name, Metadata: in.Request.Metadata})
 	if err != nil {
 		if code, ok := FileErrMap2GrpcErr[err]; ok {
 			errCode = code
 		}
-		return nil, status.Errorf(errCode, err.Error())
+		return nil, messages.Errorf(errCode, err.Error())
 	}
 	meta := &runtimev1pb.FileMeta{}
 	meta.Metadata = make(map[string]*runtimev1pb.FileMetaValue)
@@ -691,32 +1043,101 @@ func (a *api) GetFileMeta(ctx context.Context, in *runtimev1pb.GetFileMetaReques
 		meta.Metadata[k] = &runtimev1pb.FileMetaValue{}
 		meta.Metadata[k].Value = append(meta.Metadata[k].Value, v...)
 	}
-	return &runtimev1pb.GetFileMetaResponse{Size: resp.Size, LastModified: resp.LastModified, Response: meta}, nil
+	return &runtimev1pb.GetFileMetaResponse{
+		Size:         resp.Size,
+		LastModified: resp.LastModified,
+		Response:     meta,
+		Etag:         resp.ETag,
+		ContentType:  resp.ContentType,
+		StorageClass: resp.StorageClass,
+		Tags:         resp.Tags,
+	}, nil
+}
+
+//TagFile replace the tags of specific file
+func (a *api) TagFile(ctx context.Context, in *runtimev1pb.TagFileRequest) (*emptypb.Empty, error) {
+	errCode := codes.Internal
+	if in.Request == nil {
+		return nil, messages.Errorf(codes.InvalidArgument, "request can't be nil")
+	}
+	if in.Request.Metadata == nil {
+		in.Request.Metadata = make(map[string]string)
+	}
+	if a.fileOps[in.Request.StoreName] == nil {
+		return nil, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+	}
+	tagger, ok := file.AsTagger(a.fileOps[in.Request.StoreName])
+	if !ok {
+		return nil, messages.Errorf(codes.Unimplemented, "store %s doesn't support tagging files", in.Request.StoreName)
+	}
+	err := tagger.Tag(ctx, &file.TagRequest{FileName: in.Request.Name, Tags: in.Tags, Metadata: in.Request.Metadata})
+	if err != nil {
+		if code, ok := FileErrMap2GrpcErr[err]; ok {
+			errCode = code
+		}
+		return nil, messages.Errorf(errCode, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+//RestoreFile restore a temporary copy of the archived file
+func (a *api) RestoreFile(ctx context.Context, in *runtimev1pb.RestoreFileRequest) (*emptypb.Empty, error) {
+	errCode := codes.Internal
+	if in.Request == nil {
+		return nil, messages.Errorf(codes.InvalidArgument, "request can't be nil")
+	}
+	if in.Request.Metadata == nil {
+		in.Request.Metadata = make(map[string]string)
+	}
+	if a.fileOps[in.Request.StoreName] == nil {
+		return nil, messages.Errorf(codes.InvalidArgument, "not support store type: %+v", in.Request.StoreName)
+	}
+	if in.Days <= 0 {
+		return nil, messages.Errorf(codes.InvalidArgument, "days should be positive")
+	}
+	switch in.Tier {
+	case "", file.TierExpedited, file.TierStandard, file.TierBulk:
+	default:
+		return nil, messages.Errorf(codes.InvalidArgument, "not support restore tier: %s", in.Tier)
+	}
+	restorer, ok := file.AsRestorer(a.fileOps[in.Request.StoreName])
+	if !ok {
+		return nil, messages.Errorf(codes.Unimplemented, "store %s doesn't support restoring files", in.Request.StoreName)
+	}
+	err := restorer.Restore(ctx, &file.RestoreRequest{FileName: in.Request.Name, Days: in.Days, Tier: in.Tier, Metadata: in.Request.Metadata})
+	if err != nil {
+		if code, ok := FileErrMap2GrpcErr[err]; ok {
+			errCode = code
+		}
+		return nil, messages.Errorf(errCode, err.Error())
+	}
+	return &emptypb.Empty{}, nil
 }
 
 func (a *api) TryLock(ctx context.Context, req *runtimev1pb.TryLockRequest) (*runtimev1pb.TryLockResponse, error) {
 	// 1. validate
 	if a.lockStores == nil || len(a.lockStores) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrLockStoresNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrLockStoresNotConfigured)
 		log.DefaultLogger.Errorf("[runtime] [grpc.TryLock] error: %v", err)
 		return &runtimev1pb.TryLockResponse{}, err
 	}
+	req.StoreName = alias.Resolve(alias.Lock, req.StoreName)
 	if req.ResourceId == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
 		return &runtimev1pb.TryLockResponse{}, err
 	}
 	if req.LockOwner == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrLockOwnerEmpty, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrLockOwnerEmpty, req.StoreName)
 		return &runtimev1pb.TryLockResponse{}, err
 	}
 	if req.Expire <= 0 {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrExpireNotPositive, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrExpireNotPositive, req.StoreName)
 		return &runtimev1pb.TryLockResponse{}, err
 	}
 	// 2. find store component
 	store, ok := a.lockStores[req.StoreName]
 	if !ok {
-		return &runtimev1pb.TryLockResponse{}, status.Errorf(codes.InvalidArgument, messages.ErrLockStoreNotFound, req.StoreName)
+		return &runtimev1pb.TryLockResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrLockStoreNotFound, req.StoreName)
 	}
 	// 3. convert request
 	compReq := converter.TryLockRequest2ComponentRequest(req)
@@ -741,22 +1162,23 @@ func (a *api) TryLock(ctx context.Context, req *runtimev1pb.TryLockRequest) (*ru
 func (a *api) Unlock(ctx context.Context, req *runtimev1pb.UnlockRequest) (*runtimev1pb.UnlockResponse, error) {
 	// 1. validate
 	if a.lockStores == nil || len(a.lockStores) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrLockStoresNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrLockStoresNotConfigured)
 		log.DefaultLogger.Errorf("[runtime] [grpc.Unlock] error: %v", err)
 		return newInternalErrorUnlockResponse(), err
 	}
+	req.StoreName = alias.Resolve(alias.Lock, req.StoreName)
 	if req.ResourceId == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
 		return newInternalErrorUnlockResponse(), err
 	}
 	if req.LockOwner == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrLockOwnerEmpty, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrLockOwnerEmpty, req.StoreName)
 		return newInternalErrorUnlockResponse(), err
 	}
 	// 2. find store component
 	store, ok := a.lockStores[req.StoreName]
 	if !ok {
-		return newInternalErrorUnlockResponse(), status.Errorf(codes.InvalidArgument, messages.ErrLockStoreNotFound, req.StoreName)
+		return newInternalErrorUnlockResponse(), messages.Errorf(codes.InvalidArgument, messages.ErrLockStoreNotFound, req.StoreName)
 	}
 	// 3. convert request
 	compReq := converter.UnlockGrpc2ComponentRequest(req)
@@ -784,15 +1206,67 @@ func newInternalErrorUnlockResponse() *runtimev1pb.UnlockResponse {
 	}
 }
 
+func (a *api) TryLockBulk(ctx context.Context, req *runtimev1pb.TryLockBulkRequest) (*runtimev1pb.TryLockBulkResponse, error) {
+	// 1. validate
+	if len(a.lockStores) == 0 {
+		err := messages.Error(codes.FailedPrecondition, messages.ErrLockStoresNotConfigured)
+		log.DefaultLogger.Errorf("[runtime] [grpc.TryLockBulk] error: %v", err)
+		return &runtimev1pb.TryLockBulkResponse{}, err
+	}
+	req.StoreName = alias.Resolve(alias.Lock, req.StoreName)
+	if len(req.ResourceIds) == 0 {
+		return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
+	}
+	if len(req.ResourceIds) > runtime_lock.MaxBulkResources {
+		return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrResourceIdsTooMany, runtime_lock.MaxBulkResources, req.StoreName)
+	}
+	for _, id := range req.ResourceIds {
+		if id == "" {
+			return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrResourceIdEmpty, req.StoreName)
+		}
+	}
+	if req.LockOwner == "" {
+		return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrLockOwnerEmpty, req.StoreName)
+	}
+	if req.Expire <= 0 {
+		return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrExpireNotPositive, req.StoreName)
+	}
+	// 2. find store component
+	store, ok := a.lockStores[req.StoreName]
+	if !ok {
+		return &runtimev1pb.TryLockBulkResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrLockStoreNotFound, req.StoreName)
+	}
+	// 3. modify keys, the resource id failed is reported with the original key
+	keys := make([]string, 0, len(req.ResourceIds))
+	origins := make(map[string]string, len(req.ResourceIds))
+	for _, id := range req.ResourceIds {
+		key, err := runtime_lock.GetModifiedLockKey(id, req.StoreName, a.appId)
+		if err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.TryLockBulk] error: %v", err)
+			return &runtimev1pb.TryLockBulkResponse{}, err
+		}
+		keys = append(keys, key)
+		origins[key] = id
+	}
+	// 4. acquire all the locks or none of them
+	failed, err := runtime_lock.TryLockBulk(store, keys, req.LockOwner, req.Expire)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.TryLockBulk] error: %v", err)
+		return &runtimev1pb.TryLockBulkResponse{FailedResourceId: origins[failed]}, err
+	}
+	return &runtimev1pb.TryLockBulkResponse{Success: failed == "", FailedResourceId: origins[failed]}, nil
+}
+
 func (a *api) GetNextId(ctx context.Context, req *runtimev1pb.GetNextIdRequest) (*runtimev1pb.GetNextIdResponse, error) {
 	// 1. validate
 	if len(a.sequencers) == 0 {
-		err := status.Error(codes.FailedPrecondition, messages.ErrSequencerStoresNotConfigured)
+		err := messages.Error(codes.FailedPrecondition, messages.ErrSequencerStoresNotConfigured)
 		log.DefaultLogger.Errorf("[runtime] [grpc.GetNextId] error: %v", err)
 		return &runtimev1pb.GetNextIdResponse{}, err
 	}
+	req.StoreName = alias.Resolve(alias.Sequencer, req.StoreName)
 	if req.Key == "" {
-		err := status.Errorf(codes.InvalidArgument, messages.ErrSequencerKeyEmpty, req.StoreName)
+		err := messages.Errorf(codes.InvalidArgument, messages.ErrSequencerKeyEmpty, req.StoreName)
 		return &runtimev1pb.GetNextIdResponse{}, err
 	}
 	// 2. convert
@@ -809,9 +1283,21 @@ func (a *api) GetNextId(ctx context.Context, req *runtimev1pb.GetNextIdRequest)
 	// 3. find store component
 	store, ok := a.sequencers[req.StoreName]
 	if !ok {
-		return &runtimev1pb.GetNextIdResponse{}, status.Errorf(codes.InvalidArgument, messages.ErrSequencerStoreNotFound, req.StoreName)
+		return &runtimev1pb.GetNextIdResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrSequencerStoreNotFound, req.StoreName)
+	}
+	// the hot keys are allocated from one of their shards
+	shard := runtime_sequencer.GetShard(req.StoreName, req.Key)
+	var idx int
+	if shard != nil {
+		if err = shard.Seed(store, compReq.Key, compReq.Metadata); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.GetNextId] error: %v", err)
+			return &runtimev1pb.GetNextIdResponse{}, err
+		}
+		idx = shard.Next()
+		compReq.Key = shard.Key(compReq.Key, idx)
 	}
 	var next int64
+	start := time.Now()
 	// 4. invoke component
 	if compReq.Options.AutoIncrement == sequencer.WEAK {
 		// WEAK
@@ -820,6 +1306,10 @@ func (a *api) GetNextId(ctx context.Context, req *runtimev1pb.GetNextIdRequest)
 		// STRONG
 		next, err = a.getNextIdFromComponent(ctx, store, compReq)
 	}
+	runtime_sequencer.ObserveLatency(req.StoreName, time.Since(start))
+	if err == nil && shard != nil {
+		next, err = shard.Merge(next, idx)
+	}
 	// 5. convert response
 	if err != nil {
 		log.DefaultLogger.Errorf("[runtime] [grpc.GetNextId] error: %v", err)
@@ -852,7 +1342,7 @@ func (a *api) getNextIdFromComponent(ctx context.Context, store sequencer.Store,
 
 func (a *api) InvokeBinding(ctx context.Context, in *runtimev1pb.InvokeBindingRequest) (*runtimev1pb.InvokeBindingResponse, error) {
 	daprResp, err := a.daprAPI.InvokeBinding(ctx, &dapr_v1pb.InvokeBindingRequest{
-		Name:      in.Name,
+		Name:      alias.Resolve(alias.Binding, in.Name),
 		Data:      in.Data,
 		Metadata:  in.Metadata,
 		Operation: in.Operation,
@@ -868,7 +1358,7 @@ func (a *api) InvokeBinding(ctx context.Context, in *runtimev1pb.InvokeBindingRe
 
 func (a *api) GetSecret(ctx context.Context, in *runtimev1pb.GetSecretRequest) (*runtimev1pb.GetSecretResponse, error) {
 	daprResp, err := a.daprAPI.GetSecret(ctx, &dapr_v1pb.GetSecretRequest{
-		StoreName: in.StoreName,
+		StoreName: alias.Resolve(alias.SecretStore, in.StoreName),
 		Key:       in.Key,
 		Metadata:  in.Metadata,
 	})
@@ -880,7 +1370,7 @@ func (a *api) GetSecret(ctx context.Context, in *runtimev1pb.GetSecretRequest) (
 
 func (a *api) GetBulkSecret(ctx context.Context, in *runtimev1pb.GetBulkSecretRequest) (*runtimev1pb.GetBulkSecretResponse, error) {
 	daprResp, err := a.daprAPI.GetBulkSecret(ctx, &dapr_v1pb.GetBulkSecretRequest{
-		StoreName: in.StoreName,
+		StoreName: alias.Resolve(alias.SecretStore, in.StoreName),
 		Metadata:  in.Metadata,
 	})
 	if err != nil {
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// maxBatchOperations is the max number of operations in a BatchRequest
+const maxBatchOperations = 100
+
+// Batch executes multiple operations concurrently and returns all the results in one response.
+// A failed operation doesn't affect the others. Its error is put into the corresponding result.
+func (a *api) Batch(ctx context.Context, in *runtimev1pb.BatchRequest) (*runtimev1pb.BatchResponse, error) {
+	if in == nil {
+		return &runtimev1pb.BatchResponse{}, status.Error(codes.InvalidArgument, "BatchRequest is nil")
+	}
+	n := len(in.Operations)
+	if n > maxBatchOperations {
+		return &runtimev1pb.BatchResponse{}, status.Errorf(codes.InvalidArgument, "the number of operations exceeds %d", maxBatchOperations)
+	}
+	results := make([]*runtimev1pb.BatchOperationResult, n)
+	parallelism := int(in.Parallelism)
+	if parallelism <= 0 || parallelism > n {
+		parallelism = n
+	}
+	limiter := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, op := range in.Operations {
+		limiter <- struct{}{}
+		wg.Add(1)
+		i, op := i, op
+		utils.GoWithRecover(func() {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			results[i] = a.doBatchOperation(ctx, op)
+		}, nil)
+	}
+	wg.Wait()
+	return &runtimev1pb.BatchResponse{Results: results}, nil
+}
+
+func (a *api) doBatchOperation(ctx context.Context, op *runtimev1pb.BatchOperation) (res *runtimev1pb.BatchOperationResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.Batch] panic: %v", r)
+			res = &runtimev1pb.BatchOperationResult{Code: int32(codes.Internal), Message: fmt.Sprintf("%v", r)}
+		}
+	}()
+	res = &runtimev1pb.BatchOperationResult{}
+	var err error
+	switch req := op.GetRequest().(type) {
+	case *runtimev1pb.BatchOperation_GetState:
+		res.GetState, err = a.GetState(ctx, req.GetState)
+	case *runtimev1pb.BatchOperation_SaveState:
+		_, err = a.SaveState(ctx, req.SaveState)
+	case *runtimev1pb.BatchOperation_DeleteState:
+		_, err = a.DeleteState(ctx, req.DeleteState)
+	case *runtimev1pb.BatchOperation_PublishEvent:
+		_, err = a.PublishEvent(ctx, req.PublishEvent)
+	case *runtimev1pb.BatchOperation_InvokeBinding:
+		res.InvokeBinding, err = a.InvokeBinding(ctx, req.InvokeBinding)
+	case *runtimev1pb.BatchOperation_GetNextId:
+		res.GetNextId, err = a.GetNextId(ctx, req.GetNextId)
+	case *runtimev1pb.BatchOperation_GetConfiguration:
+		res.GetConfiguration, err = a.GetConfiguration(ctx, req.GetConfiguration)
+	case *runtimev1pb.BatchOperation_GetSecret:
+		res.GetSecret, err = a.GetSecret(ctx, req.GetSecret)
+	default:
+		err = status.Error(codes.InvalidArgument, "the request of the batch operation is not set")
+	}
+	if err != nil {
+		return &runtimev1pb.BatchOperationResult{Code: int32(status.Code(err)), Message: err.Error()}
+	}
+	return res
+}
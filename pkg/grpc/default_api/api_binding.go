@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dapr/components-contrib/bindings"
+	"google.golang.org/grpc/codes"
+
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// ListBindings lists the output bindings the app can invoke, so that the tools can discover them without the config.
+func (a *api) ListBindings(ctx context.Context, in *runtimev1pb.ListBindingsRequest) (*runtimev1pb.ListBindingsResponse, error) {
+	listed := a.listOutputBindings()
+	names := make([]string, 0, len(listed))
+	for name := range listed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp := &runtimev1pb.ListBindingsResponse{Bindings: make([]*runtimev1pb.BindingInfo, 0, len(names))}
+	for _, name := range names {
+		resp.Bindings = append(resp.Bindings, &runtimev1pb.BindingInfo{
+			Name:       name,
+			Operations: operationNames(listed[name]),
+		})
+	}
+	return resp, nil
+}
+
+// GetBindingOperations gets the operations supported by an output binding.
+func (a *api) GetBindingOperations(ctx context.Context, in *runtimev1pb.GetBindingOperationsRequest) (*runtimev1pb.GetBindingOperationsResponse, error) {
+	name := alias.Resolve(alias.Binding, in.GetName())
+	ops, ok := a.listOutputBindings()[name]
+	if !ok {
+		return &runtimev1pb.GetBindingOperationsResponse{}, messages.Errorf(codes.NotFound, messages.ErrBindingNotFound, in.GetName())
+	}
+	return &runtimev1pb.GetBindingOperationsResponse{Operations: operationNames(ops)}, nil
+}
+
+func (a *api) listOutputBindings() map[string][]bindings.OperationKind {
+	if a.listOutputBindingsFn == nil {
+		return nil
+	}
+	return a.listOutputBindingsFn()
+}
+
+func operationNames(ops []bindings.OperationKind) []string {
+	names := make([]string, 0, len(ops))
+	for _, op := range ops {
+		names = append(names, string(op))
+	}
+	return names
+}
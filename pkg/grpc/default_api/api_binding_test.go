@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dapr/components-contrib/bindings"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/messages"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestBindings(t *testing.T) {
+	a := &api{}
+	resp, err := a.ListBindings(context.Background(), &runtimev1pb.ListBindingsRequest{})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Bindings)
+
+	a.listOutputBindingsFn = func() map[string][]bindings.OperationKind {
+		return map[string][]bindings.OperationKind{
+			"kafka": {bindings.CreateOperation},
+			"http":  {bindings.CreateOperation, bindings.GetOperation},
+		}
+	}
+	resp, err = a.ListBindings(context.Background(), &runtimev1pb.ListBindingsRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(resp.Bindings))
+	assert.Equal(t, "http", resp.Bindings[0].Name)
+	assert.Equal(t, []string{"create", "get"}, resp.Bindings[0].Operations)
+	assert.Equal(t, "kafka", resp.Bindings[1].Name)
+
+	ops, err := a.GetBindingOperations(context.Background(), &runtimev1pb.GetBindingOperationsRequest{Name: "kafka"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"create"}, ops.Operations)
+	_, err = a.GetBindingOperations(context.Background(), &runtimev1pb.GetBindingOperationsRequest{Name: "mq"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_BINDING_NOT_FOUND, messages.ErrorCodeOf(err))
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/dapr/components-contrib/pubsub"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"mosn.io/layotto/pkg/runtime/alias"
 	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
 	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 	_ "net/http/pprof"
@@ -32,6 +33,9 @@ import (
 	"mosn.io/pkg/log"
 )
 
+// errAppCallbackNotConfigured is returned when an event can't be delivered since the app can't be called
+var errAppCallbackNotConfigured = errors.New("the app callback isn't configured")
+
 func (a *api) startSubscribing() error {
 	// 1. check if there is no need to do it
 	if len(a.pubSubs) == 0 {
@@ -65,17 +69,12 @@ func (a *api) beginPubSub(pubsubName string, ps pubsub.PubSub, topicRoutes map[s
 	for topic, route := range v.topic2Details {
 		// TODO limit topic scope
 		log.DefaultLogger.Debugf("[runtime][beginPubSub]subscribing to topic=%s on pubsub=%s", topic, pubsubName)
+		gate := a.addSubscriptionGate(pubsubName, topic)
 		// ask component to subscribe
 		if err := ps.Subscribe(pubsub.SubscribeRequest{
 			Topic:    topic,
 			Metadata: route.metadata,
-		}, func(ctx context.Context, msg *pubsub.NewMessage) error {
-			if msg.Metadata == nil {
-				msg.Metadata = make(map[string]string, 1)
-			}
-			msg.Metadata[Metadata_key_pubsubName] = pubsubName
-			return a.publishMessageGRPC(ctx, msg)
-		}); err != nil {
+		}, a.topicEventHandler(pubsubName, gate)); err != nil {
 			log.DefaultLogger.Warnf("[runtime][beginPubSub]failed to subscribe to topic %s: %s", topic, err)
 			return err
 		}
@@ -84,6 +83,22 @@ func (a *api) beginPubSub(pubsubName string, ps pubsub.PubSub, topicRoutes map[s
 	return nil
 }
 
+// topicEventHandler returns the handler delivering the events of the subscription to the app
+func (a *api) topicEventHandler(pubsubName string, gate *runtime_pubsub.Gate) pubsub.Handler {
+	return func(ctx context.Context, msg *pubsub.NewMessage) error {
+		// wait if the subscription is paused
+		if err := gate.Enter(ctx); err != nil {
+			return err
+		}
+		defer gate.Leave()
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string, 1)
+		}
+		msg.Metadata[Metadata_key_pubsubName] = pubsubName
+		return a.publishMessageGRPC(ctx, msg)
+	}
+}
+
 type Details struct {
 	metadata map[string]string
 }
@@ -97,26 +112,27 @@ func (a *api) getInterestedTopics() (map[string]TopicSubscriptions, error) {
 	if a.topicPerComponent != nil {
 		return a.topicPerComponent, nil
 	}
-	if a.AppCallbackConn == nil {
+	client := a.appCallbackClient()
+	if client == nil {
 		return make(map[string]TopicSubscriptions), nil
 	}
 	comp2Topic := make(map[string]TopicSubscriptions)
 	var subscriptions []*runtimev1pb.TopicSubscription
 
-	// 2. handle app subscriptions
-	client := runtimev1pb.NewAppCallbackClient(a.AppCallbackConn)
+	// 2. handle app subscriptions.
+	// The subscriptions of the http callback are declared in the config
 	subscriptions = runtime_pubsub.ListTopicSubscriptions(client, log.DefaultLogger)
-	// TODO handle declarative subscriptions
 
 	// 3. prepare result
 	for _, s := range subscriptions {
 		if s == nil {
 			continue
 		}
-		if _, ok := comp2Topic[s.PubsubName]; !ok {
-			comp2Topic[s.PubsubName] = TopicSubscriptions{topic2Details: make(map[string]Details)}
+		pubsubName := alias.Resolve(alias.PubSub, s.PubsubName)
+		if _, ok := comp2Topic[pubsubName]; !ok {
+			comp2Topic[pubsubName] = TopicSubscriptions{topic2Details: make(map[string]Details)}
 		}
-		comp2Topic[s.PubsubName].topic2Details[s.Topic] = Details{metadata: s.Metadata}
+		comp2Topic[pubsubName].topic2Details[s.Topic] = Details{metadata: s.Metadata}
 	}
 
 	// 4. log
@@ -135,6 +151,9 @@ func (a *api) getInterestedTopics() (map[string]TopicSubscriptions, error) {
 }
 
 func (a *api) publishMessageGRPC(ctx context.Context, msg *pubsub.NewMessage) error {
+	if runtime_pubsub.IsProtoCloudEvent(msg.Data) {
+		return a.publishProtoMessageGRPC(ctx, msg)
+	}
 	// 1. Unmarshal to cloudEvent model
 	var cloudEvent map[string]interface{}
 	err := a.json.Unmarshal(msg.Data, &cloudEvent)
@@ -181,24 +200,82 @@ func (a *api) publishMessageGRPC(ctx context.Context, msg *pubsub.NewMessage) er
 	// TODO tracing
 
 	// 4. Call appcallback
-	clientV1 := runtimev1pb.NewAppCallbackClient(a.AppCallbackConn)
-	res, err := clientV1.OnTopicEvent(ctx, envelope)
+	res, err := a.sendTopicEvent(ctx, envelope)
 
 	// 5. Check result
-	return retryStrategy(err, res, cloudEvent)
+	return retryStrategy(err, res, cloudEvent[pubsub.IDField].(string))
+}
+
+// publishProtoMessageGRPC delivers the event of which the envelope is in protobuf format.
+// The data is passed to the app as it is.
+func (a *api) publishProtoMessageGRPC(ctx context.Context, msg *pubsub.NewMessage) error {
+	// 1. Unmarshal to cloudEvent model
+	cloudEvent, err := runtime_pubsub.UnmarshalProtoCloudEvent(msg.Data)
+	if err != nil {
+		log.DefaultLogger.Debugf("[runtime]error deserializing cloud events proto: %s", err)
+		return err
+	}
+
+	// 2. Drop msg if the current cloud event has expired
+	if cloudEvent.HasExpired() {
+		log.DefaultLogger.Warnf("[runtime]dropping expired pub/sub event %v as of %v", cloudEvent.ID, cloudEvent.Expiration)
+		return nil
+	}
+
+	// 3. Convert to proto domain struct
+	envelope := &runtimev1pb.TopicEventRequest{
+		Id:              cloudEvent.ID,
+		Source:          cloudEvent.Source,
+		DataContentType: cloudEvent.DataContentType,
+		Type:            cloudEvent.Type,
+		SpecVersion:     cloudEvent.SpecVersion,
+		Data:            cloudEvent.Data,
+		Topic:           msg.Topic,
+		PubsubName:      msg.Metadata[Metadata_key_pubsubName],
+	}
+
+	// 4. Call appcallback
+	res, err := a.sendTopicEvent(ctx, envelope)
+
+	// 5. Check result
+	return retryStrategy(err, res, cloudEvent.ID)
+}
+
+// sendTopicEvent sends the event to the stream subscribing to the topic by SubscribeTopicEvents if there is one,
+// otherwise to the app callback
+func (a *api) sendTopicEvent(ctx context.Context, envelope *runtimev1pb.TopicEventRequest) (*runtimev1pb.TopicEventResponse, error) {
+	if s := a.getTopicEventStream(envelope.PubsubName, envelope.Topic); s != nil {
+		return s.deliver(ctx, envelope)
+	}
+	client := a.appCallbackClient()
+	if client == nil {
+		return nil, errAppCallbackNotConfigured
+	}
+	return client.OnTopicEvent(ctx, envelope)
+}
+
+// appCallbackClient returns the client to call the app, which is nil if the app can't be called
+func (a *api) appCallbackClient() runtimev1pb.AppCallbackClient {
+	if a.appCallback != nil {
+		return a.appCallback
+	}
+	if a.AppCallbackConn == nil {
+		return nil
+	}
+	return runtimev1pb.NewAppCallbackClient(a.AppCallbackConn)
 }
 
 // retryStrategy returns error when the message should be redelivered
-func retryStrategy(err error, res *runtimev1pb.TopicEventResponse, cloudEvent map[string]interface{}) error {
+func retryStrategy(err error, res *runtimev1pb.TopicEventResponse, id string) error {
 	if err != nil {
 		errStatus, hasErrStatus := status.FromError(err)
 		if hasErrStatus && (errStatus.Code() == codes.Unimplemented) {
 			// DROP
-			log.DefaultLogger.Warnf("[runtime]non-retriable error returned from app while processing pub/sub event %v: %s", cloudEvent[pubsub.IDField].(string), err)
+			log.DefaultLogger.Warnf("[runtime]non-retriable error returned from app while processing pub/sub event %v: %s", id, err)
 			return nil
 		}
 
-		err = errors.New(fmt.Sprintf("error returned from app while processing pub/sub event %v: %s", cloudEvent[pubsub.IDField].(string), err))
+		err = errors.New(fmt.Sprintf("error returned from app while processing pub/sub event %v: %s", id, err))
 		log.DefaultLogger.Debugf("%s", err)
 		// on error from application, return error for redelivery of event
 		return err
@@ -210,11 +287,11 @@ func retryStrategy(err error, res *runtimev1pb.TopicEventResponse, cloudEvent ma
 		// success from protobuf definition
 		return nil
 	case runtimev1pb.TopicEventResponse_RETRY:
-		return errors.New(fmt.Sprintf("RETRY status returned from app while processing pub/sub event %v", cloudEvent[pubsub.IDField].(string)))
+		return errors.New(fmt.Sprintf("RETRY status returned from app while processing pub/sub event %v", id))
 	case runtimev1pb.TopicEventResponse_DROP:
-		log.DefaultLogger.Warnf("[runtime]DROP status returned from app while processing pub/sub event %v", cloudEvent[pubsub.IDField].(string))
+		log.DefaultLogger.Warnf("[runtime]DROP status returned from app while processing pub/sub event %v", id)
 		return nil
 	}
 	// Consider unknown status field as error and retry
-	return errors.New(fmt.Sprintf("unknown status returned from app while processing pub/sub event %v: %v", cloudEvent[pubsub.IDField].(string), res.GetStatus()))
+	return errors.New(fmt.Sprintf("unknown status returned from app while processing pub/sub event %v: %v", id, res.GetStatus()))
 }
@@ -0,0 +1,354 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/pkg/actuator/info"
+	"mosn.io/layotto/pkg/runtime/budget"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const (
+	// the metadata key of SubscribeConfigurationRequest, specifying how many responses can be buffered for the subscriber
+	subscribeBufferSizeKey = "buffer_size"
+	// the metadata key of SubscribeConfigurationRequest, specifying which response is dropped when the buffer is full
+	subscribeOverflowPolicyKey = "overflow_policy"
+
+	dropOldest = "drop_oldest"
+	dropNewest = "drop_newest"
+
+	defaultSubscribeBufferSize = 100
+
+	// resumeTokenPrefix versions the format of the resume tokens
+	resumeTokenPrefix = "r"
+)
+
+var (
+	subscriberId uint64
+	// subscribers are the configuration subscribers alive, which are reported by the info endpoint of actuator
+	subscribers sync.Map
+)
+
+func init() {
+	info.AddInfoContributorFunc("configuration_subscribers", func() (interface{}, error) {
+		res := make(map[string]interface{})
+		subscribers.Range(func(key, value interface{}) bool {
+			res[key.(string)] = value.(*configurationSubscriber).stats()
+			return true
+		})
+		return res, nil
+	})
+	budget.Register("configuration_subscribers", subscribersConsumer{})
+}
+
+// subscribersConsumer accounts the responses buffered by all the subscribers in the resource budget
+type subscribersConsumer struct{}
+
+func (subscribersConsumer) MemoryUsage() int64 {
+	var total int64
+	subscribers.Range(func(key, value interface{}) bool {
+		total += value.(*configurationSubscriber).memoryUsage()
+		return true
+	})
+	return total
+}
+
+// Shrink drops the oldest responses of the subscribers until the usage is not larger than target
+func (c subscribersConsumer) Shrink(target int64) {
+	excess := c.MemoryUsage() - target
+	subscribers.Range(func(key, value interface{}) bool {
+		if excess <= 0 {
+			return false
+		}
+		excess -= value.(*configurationSubscriber).shrink(excess)
+		return true
+	})
+}
+
+type bufferedResponse struct {
+	resp       *runtimev1pb.SubscribeConfigurationResponse
+	size       int64
+	enqueuedAt time.Time
+	// changedAt is when the store changed, it's zero for the snapshots
+	changedAt time.Time
+	snapshot  bool
+}
+
+// configurationSubscriber buffers the responses for a SubscribeConfiguration stream,
+// so that a slow consumer blocks neither the components nor the other subscribers, and its memory is bounded.
+type configurationSubscriber struct {
+	id     string
+	mu     sync.Mutex
+	size   int
+	policy string
+	queue  []*bufferedResponse
+	// bytes is the size of the buffered responses, it's updated under the lock but read atomically,
+	// because the budget reads the usage of all the subscribers while one of them is locked in push
+	bytes  int64
+	notify chan struct{}
+	// counters
+	sent    uint64
+	dropped uint64
+}
+
+func newConfigurationSubscriber() *configurationSubscriber {
+	s := &configurationSubscriber{
+		id:     fmt.Sprintf("subscriber-%d", atomic.AddUint64(&subscriberId, 1)),
+		size:   defaultSubscribeBufferSize,
+		policy: dropOldest,
+		notify: make(chan struct{}, 1),
+	}
+	subscribers.Store(s.id, s)
+	return s
+}
+
+// configure changes the buffer size and overflow policy if they are specified in the metadata of the request
+func (s *configurationSubscriber) configure(metadata map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := metadata[subscribeBufferSizeKey]; ok {
+		if size, err := strconv.Atoi(v); err == nil && size > 0 {
+			s.size = size
+		} else {
+			log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] invalid %s: %s", subscribeBufferSizeKey, v)
+		}
+	}
+	if v, ok := metadata[subscribeOverflowPolicyKey]; ok {
+		if v == dropOldest || v == dropNewest {
+			s.policy = v
+		} else {
+			log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] invalid %s: %s", subscribeOverflowPolicyKey, v)
+		}
+	}
+}
+
+// push buffers the response without blocking. An update is dropped according to the policy
+// if the buffer is full or the memory budget of the runtime is exceeded, while a snapshot is never dropped,
+// because the app can't build its local cache without it.
+func (s *configurationSubscriber) push(resp *runtimev1pb.SubscribeConfigurationResponse, changedAt time.Time) {
+	size := int64(proto.Size(resp))
+	snapshot := resp.Type == runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT
+	s.mu.Lock()
+	for !snapshot && (len(s.queue) >= s.size || len(s.queue) > 0 && !budget.Allow(size)) {
+		s.dropped++
+		if s.policy == dropNewest || !s.removeOldestUpdate() {
+			s.mu.Unlock()
+			log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] %s is too slow, drop the latest response", s.id)
+			return
+		}
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] %s is too slow, drop the oldest response", s.id)
+	}
+	s.queue = append(s.queue, &bufferedResponse{resp: resp, size: size, enqueuedAt: time.Now(), changedAt: changedAt, snapshot: snapshot})
+	atomic.AddInt64(&s.bytes, size)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits until there is a response in the buffer or the exit channel is closed
+func (s *configurationSubscriber) pop(exitCh <-chan struct{}) (*bufferedResponse, bool) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			r := s.removeAt(0)
+			s.mu.Unlock()
+			return r, true
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.notify:
+		case <-exitCh:
+			return nil, false
+		}
+	}
+}
+
+// removeOldestUpdate removes the oldest response which is not a snapshot, and returns false if there is none. It must be locked
+func (s *configurationSubscriber) removeOldestUpdate() bool {
+	for i, r := range s.queue {
+		if !r.snapshot {
+			s.removeAt(i)
+			return true
+		}
+	}
+	return false
+}
+
+// removeAt removes the i-th buffered response, must be locked
+func (s *configurationSubscriber) removeAt(i int) *bufferedResponse {
+	r := s.queue[i]
+	copy(s.queue[i:], s.queue[i+1:])
+	s.queue[len(s.queue)-1] = nil
+	s.queue = s.queue[:len(s.queue)-1]
+	atomic.AddInt64(&s.bytes, -r.size)
+	return r
+}
+
+func (s *configurationSubscriber) memoryUsage() int64 {
+	return atomic.LoadInt64(&s.bytes)
+}
+
+// shrink drops the oldest updates until n bytes are released or no update is buffered, and returns the bytes released.
+// The snapshots are kept like in push.
+func (s *configurationSubscriber) shrink(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var released int64
+	for i := 0; released < n && i < len(s.queue); {
+		if s.queue[i].snapshot {
+			i++
+			continue
+		}
+		released += s.removeAt(i).size
+		s.dropped++
+	}
+	if released > 0 {
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] drop %d bytes of %s due to the memory budget", released, s.id)
+	}
+	return released
+}
+
+// forwardConfigurationResponses sends the snapshot if it's not nil, and then the responses of the store to the stream
+// with the name of the store subscribed, until the channel of the store is closed or the writer exits
+func forwardConfigurationResponses(storeName string, snapshot *configstores.SubscribeResp, storeCh <-chan *configstores.SubscribeResp,
+	respCh chan<- *configstores.SubscribeResp, writerExitCh <-chan struct{}) {
+	utils.GoWithRecover(func() {
+		if snapshot != nil {
+			select {
+			case respCh <- snapshot:
+			case <-writerExitCh:
+				return
+			}
+		}
+		for {
+			select {
+			case resp, ok := <-storeCh:
+				if !ok {
+					return
+				}
+				resp.StoreName = storeName
+				select {
+				case respCh <- resp:
+				case <-writerExitCh:
+					return
+				}
+			case <-writerExitCh:
+				return
+			}
+		}
+	}, nil)
+}
+
+// onSent counts the response sent or failed to send, which is also recorded in the metrics of the store
+func (s *configurationSubscriber) onSent(r *bufferedResponse, err error) {
+	configstores.RecordPush(r.resp.StoreName, r.changedAt, err)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.sent++
+	s.mu.Unlock()
+}
+
+// stats reports the counters and the lag, which is how long the oldest buffered response has been waiting
+func (s *configurationSubscriber) stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lag time.Duration
+	if len(s.queue) > 0 {
+		lag = time.Since(s.queue[0].enqueuedAt)
+	}
+	return map[string]interface{}{
+		"buffered": len(s.queue),
+		"bytes":    atomic.LoadInt64(&s.bytes),
+		"sent":     s.sent,
+		"dropped":  s.dropped,
+		"lag_ms":   lag.Milliseconds(),
+	}
+}
+
+func (s *configurationSubscriber) close() {
+	subscribers.Delete(s.id)
+}
+
+// configurationSnapshot returns the changes since the resume token of the request if the store keeps the revisions,
+// otherwise the snapshot of the current values. It returns nil if the store fails.
+func configurationSnapshot(store configstores.Store, req *runtimev1pb.SubscribeConfigurationRequest) *configstores.SubscribeResp {
+	ctx := context.Background()
+	getReq := &configstores.GetRequest{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: req.Keys, Metadata: req.Metadata}
+	if revision, ok := decodeResumeToken(req.ResumeToken); ok {
+		items, current, err := configstores.GetSince(ctx, store, getReq, revision)
+		if err == nil {
+			return &configstores.SubscribeResp{StoreName: req.StoreName, AppId: req.AppId, Items: items, Revision: current}
+		}
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] resume from revision %d of store %s failed, send a snapshot: %v",
+			revision, req.StoreName, err)
+	}
+	items, revision, err := configstores.GetSince(ctx, store, getReq, 0)
+	if err != nil {
+		if err != configstores.ErrRevisionNotSupported {
+			log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] get revision of store %s failed: %v", req.StoreName, err)
+		}
+		revision = 0
+		if items, err = store.Get(ctx, getReq); err != nil {
+			log.DefaultLogger.Errorf("get configuration snapshot of store [%+v] failed with error: %+v", req.StoreName, err)
+			return nil
+		}
+	}
+	return &configstores.SubscribeResp{StoreName: req.StoreName, AppId: req.AppId, Items: items, Snapshot: true, Revision: revision}
+}
+
+// encodeResumeToken returns the opaque token of the revision, which is empty if the store doesn't keep the revisions
+func encodeResumeToken(revision int64) string {
+	if revision <= 0 {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(resumeTokenPrefix + strconv.FormatInt(revision, 10)))
+}
+
+// decodeResumeToken returns the revision of the token, or false if the token is empty or invalid
+func decodeResumeToken(token string) (int64, bool) {
+	if token == "" {
+		return 0, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) <= len(resumeTokenPrefix) || string(b[:len(resumeTokenPrefix)]) != resumeTokenPrefix {
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] invalid resume token: %s", token)
+		return 0, false
+	}
+	revision, err := strconv.ParseInt(string(b[len(resumeTokenPrefix):]), 10, 64)
+	if err != nil || revision <= 0 {
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeConfiguration] invalid resume token: %s", token)
+		return 0, false
+	}
+	return revision, true
+}
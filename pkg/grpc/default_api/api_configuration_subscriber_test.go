@@ -0,0 +1,196 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/pkg/mock"
+	"mosn.io/layotto/pkg/runtime/budget"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestConfigurationSubscriber(t *testing.T) {
+	push := func(s *configurationSubscriber, keys ...string) {
+		for _, k := range keys {
+			s.push(&runtimev1pb.SubscribeConfigurationResponse{Items: []*runtimev1pb.ConfigurationItem{{Key: k}}}, time.Time{})
+		}
+	}
+	popKeys := func(s *configurationSubscriber) []string {
+		var keys []string
+		exitCh := make(chan struct{})
+		close(exitCh)
+		for {
+			r, ok := s.pop(exitCh)
+			if !ok {
+				return keys
+			}
+			keys = append(keys, r.resp.Items[0].Key)
+		}
+	}
+
+	t.Run("drop oldest", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		s.configure(map[string]string{subscribeBufferSizeKey: "2"})
+		push(s, "a", "b", "c")
+		stats := s.stats()
+		assert.Equal(t, 2, stats["buffered"])
+		assert.Equal(t, uint64(1), stats["dropped"])
+		assert.Equal(t, []string{"b", "c"}, popKeys(s))
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		s.configure(map[string]string{subscribeBufferSizeKey: "2", subscribeOverflowPolicyKey: dropNewest})
+		push(s, "a", "b", "c")
+		assert.Equal(t, []string{"a", "b"}, popKeys(s))
+	})
+
+	t.Run("snapshot is never dropped", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		s.configure(map[string]string{subscribeBufferSizeKey: "2"})
+		s.push(&runtimev1pb.SubscribeConfigurationResponse{Items: []*runtimev1pb.ConfigurationItem{{Key: "snapshot"}},
+			Type: runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT}, time.Time{})
+		push(s, "a", "b")
+		assert.Equal(t, []string{"snapshot", "b"}, popKeys(s))
+
+		s.push(&runtimev1pb.SubscribeConfigurationResponse{Items: []*runtimev1pb.ConfigurationItem{{Key: "snapshot"}},
+			Type: runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT}, time.Time{})
+		subscribersConsumer{}.Shrink(0)
+		assert.Equal(t, []string{"snapshot"}, popKeys(s))
+	})
+
+	t.Run("invalid config is ignored", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		s.configure(map[string]string{subscribeBufferSizeKey: "-1", subscribeOverflowPolicyKey: "unknown"})
+		assert.Equal(t, defaultSubscribeBufferSize, s.size)
+		assert.Equal(t, dropOldest, s.policy)
+	})
+
+	t.Run("memory budget", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		push(s, "a", "b", "c")
+		size := s.memoryUsage()
+		assert.True(t, size > 0)
+
+		budget.Init(&budget.Config{MaxMemoryBytes: size, CheckIntervalMs: 3600000})
+		defer budget.Init(nil)
+		// the oldest one is dropped to make room
+		push(s, "d")
+		assert.Equal(t, uint64(1), s.stats()["dropped"])
+
+		subscribersConsumer{}.Shrink(0)
+		assert.Equal(t, int64(0), s.memoryUsage())
+		assert.Nil(t, popKeys(s))
+	})
+
+	t.Run("push stats", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		defer s.close()
+		s.push(&runtimev1pb.SubscribeConfigurationResponse{StoreName: "subscriber_test"}, time.Now().Add(-time.Second))
+		r, ok := s.pop(nil)
+		assert.True(t, ok)
+		s.onSent(r, nil)
+		s.onSent(r, errors.New("broken"))
+		assert.Equal(t, uint64(1), s.stats()["sent"])
+		stats := configstores.PushStatsOf("subscriber_test")
+		assert.Equal(t, int64(1), stats.Pushed)
+		assert.Equal(t, int64(1), stats.Errors)
+		assert.True(t, stats.Lag >= time.Second)
+	})
+
+	t.Run("registered for metrics", func(t *testing.T) {
+		s := newConfigurationSubscriber()
+		_, ok := subscribers.Load(s.id)
+		assert.True(t, ok)
+		s.close()
+		_, ok = subscribers.Load(s.id)
+		assert.False(t, ok)
+	})
+}
+
+type revisionStore struct {
+	*mock.MockStore
+	since []int64
+}
+
+func (s *revisionStore) GetSince(ctx context.Context, req *configstores.GetRequest, revision int64) ([]*configstores.ConfigurationItem, int64, error) {
+	s.since = append(s.since, revision)
+	if revision == 1 {
+		return nil, 0, configstores.ErrRevisionCompacted
+	}
+	return []*configstores.ConfigurationItem{{Key: "k"}}, 10, nil
+}
+
+func TestResumeToken(t *testing.T) {
+	assert.Equal(t, "", encodeResumeToken(0))
+	rev, ok := decodeResumeToken(encodeResumeToken(42))
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), rev)
+
+	for _, token := range []string{"", "!!", encodeResumeToken(0), "eDQy"} {
+		_, ok = decodeResumeToken(token)
+		assert.False(t, ok, token)
+	}
+}
+
+func TestConfigurationSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("revisions not supported", func(t *testing.T) {
+		store := mock.NewMockStore(ctrl)
+		store.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]*configstores.ConfigurationItem{{Key: "k"}}, nil).Times(2)
+		resp := configurationSnapshot(store, &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock"})
+		assert.True(t, resp.Snapshot)
+		assert.Equal(t, int64(0), resp.Revision)
+		assert.Len(t, resp.Items, 1)
+		// the token is ignored
+		resp = configurationSnapshot(store, &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", ResumeToken: encodeResumeToken(5)})
+		assert.True(t, resp.Snapshot)
+
+		store.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("fail"))
+		assert.Nil(t, configurationSnapshot(store, &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock"}))
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		store := &revisionStore{MockStore: mock.NewMockStore(ctrl)}
+		resp := configurationSnapshot(store, &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", ResumeToken: encodeResumeToken(5)})
+		assert.False(t, resp.Snapshot)
+		assert.Equal(t, int64(10), resp.Revision)
+		assert.Equal(t, "mock", resp.StoreName)
+		assert.Equal(t, []int64{5}, store.since)
+
+		// a snapshot is sent if the revision is compacted
+		store.since = nil
+		resp = configurationSnapshot(store, &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", ResumeToken: encodeResumeToken(1)})
+		assert.True(t, resp.Snapshot)
+		assert.Equal(t, int64(10), resp.Revision)
+		assert.Equal(t, []int64{1, 0}, store.since)
+	})
+}
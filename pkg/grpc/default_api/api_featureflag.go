@@ -0,0 +1,221 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/featureflag"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// EvaluateFeatureFlag evaluates the feature flag in the config store for the target.
+func (a *api) EvaluateFeatureFlag(ctx context.Context, in *runtimev1pb.EvaluateFeatureFlagRequest) (*runtimev1pb.EvaluateFeatureFlagResponse, error) {
+	storeName := alias.Resolve(alias.ConfigStore, in.StoreName)
+	store, ok := a.configStores[storeName]
+	if !ok {
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, storeName)
+	}
+	if in.Flag == "" {
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrFeatureFlagEmpty, storeName)
+	}
+	req := &featureflag.Request{
+		AppId:    in.AppId,
+		Group:    defaultGroup(store, in.Group),
+		Label:    defaultLabel(store, in.Label),
+		Flag:     in.Flag,
+		Context:  &featureflag.Context{TargetingKey: in.TargetingKey, Attributes: in.Attributes},
+		Metadata: in.Metadata,
+	}
+	e, err := featureflag.Evaluate(ctx, store, req)
+	if err != nil {
+		err = featureFlagError(storeName, in.Flag, err)
+		log.DefaultLogger.Errorf("[runtime] [grpc.EvaluateFeatureFlag] %v", err)
+		return nil, err
+	}
+	return featureFlagResponse(in.Flag, e), nil
+}
+
+// SubscribeFeatureFlag sends the evaluations of the feature flags for the target,
+// and evaluates the flags again when they are changed in the config store.
+// Only the evaluations of which the variants or values change are sent, until the stream is closed by the app.
+func (a *api) SubscribeFeatureFlag(in *runtimev1pb.SubscribeFeatureFlagRequest, stream runtimev1pb.Runtime_SubscribeFeatureFlagServer) error {
+	// 1. validate
+	storeName := alias.Resolve(alias.ConfigStore, in.StoreName)
+	store, ok := a.configStores[storeName]
+	if !ok {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrConfigStoreNotFound, storeName)
+	}
+	if len(in.Flags) == 0 {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrFeatureFlagEmpty, storeName)
+	}
+	group := defaultGroup(store, in.Group)
+	label := defaultLabel(store, in.Label)
+	target := &featureflag.Context{TargetingKey: in.TargetingKey, Attributes: in.Attributes}
+	newRequest := func(flag string) *featureflag.Request {
+		return &featureflag.Request{AppId: in.AppId, Group: group, Label: label, Flag: flag, Context: target, Metadata: in.Metadata}
+	}
+	// 2. subscribe before evaluating, so that no change is lost in between
+	ctx := stream.Context()
+	respCh := make(chan *configstores.SubscribeResp)
+	err := store.Subscribe(&configstores.SubscribeReq{AppId: in.AppId, Group: group, Label: label, Keys: in.Flags, Metadata: in.Metadata}, respCh)
+	if err != nil {
+		err = messages.Errorf(codes.Internal, messages.ErrFeatureFlagEvaluate, strings.Join(in.Flags, ","), storeName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeFeatureFlag] %v", err)
+		return err
+	}
+	// only the subscription of this stream is stopped, which also releases the update being sent by the store
+	defer configstores.Unsubscribe(store, respCh)
+	sender := &featureFlagSender{stream: stream, last: make(map[string]*runtimev1pb.EvaluateFeatureFlagResponse)}
+	// 3. send the current evaluations
+	for _, flag := range in.Flags {
+		e, err := featureflag.Evaluate(ctx, store, newRequest(flag))
+		if errors.Is(err, featureflag.ErrFlagNotFound) {
+			err = sender.delete(flag)
+		} else if err != nil {
+			err = featureFlagError(storeName, flag, err)
+			log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeFeatureFlag] %v", err)
+			return err
+		} else {
+			err = sender.send(flag, e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// 4. evaluate the changed flags again
+	_, isProvider := store.(featureflag.Provider)
+	for {
+		var resp *configstores.SubscribeResp
+		select {
+		case <-ctx.Done():
+			return nil
+		case resp, ok = <-respCh:
+		}
+		// the store closes the channel if it gives up the subscription, e.g. the updates aren't received in time
+		if !ok {
+			err := messages.Errorf(codes.Unavailable, messages.ErrFeatureFlagEvaluate, strings.Join(in.Flags, ","), storeName, "the subscription is closed by the store")
+			log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeFeatureFlag] %v", err)
+			return err
+		}
+		for _, item := range resp.Items {
+			// the last evaluations of all the subscribed flags are recorded when sending the current ones
+			if _, ok := sender.last[item.Key]; !ok {
+				continue
+			}
+			if item.Deleted {
+				if err := sender.delete(item.Key); err != nil {
+					return err
+				}
+				continue
+			}
+			var e *featureflag.Evaluation
+			var err error
+			if isProvider {
+				e, err = featureflag.Evaluate(ctx, store, newRequest(item.Key))
+			} else {
+				e, err = featureflag.EvaluateItem(item, target)
+			}
+			// keep serving the last evaluation if the new one fails, e.g. the flag is modified by mistake
+			if err != nil {
+				log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeFeatureFlag] %v", featureFlagError(storeName, item.Key, err))
+				continue
+			}
+			if err := sender.send(item.Key, e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// featureFlagSender sends the evaluations of which the variants or values are different from the last sent ones
+type featureFlagSender struct {
+	stream runtimev1pb.Runtime_SubscribeFeatureFlagServer
+	// last maps the flags to the last sent evaluations, nil for the deleted flags
+	last map[string]*runtimev1pb.EvaluateFeatureFlagResponse
+}
+
+func (s *featureFlagSender) send(flag string, e *featureflag.Evaluation) error {
+	resp := featureFlagResponse(flag, e)
+	if last := s.last[flag]; last != nil && last.Variant == resp.Variant && last.Value == resp.Value {
+		return nil
+	}
+	s.last[flag] = resp
+	return s.doSend(&runtimev1pb.SubscribeFeatureFlagResponse{Evaluation: resp})
+}
+
+func (s *featureFlagSender) delete(flag string) error {
+	if last, ok := s.last[flag]; ok && last == nil {
+		return nil
+	}
+	s.last[flag] = nil
+	return s.doSend(&runtimev1pb.SubscribeFeatureFlagResponse{Evaluation: &runtimev1pb.EvaluateFeatureFlagResponse{Flag: flag}, Deleted: true})
+}
+
+func (s *featureFlagSender) doSend(resp *runtimev1pb.SubscribeFeatureFlagResponse) error {
+	if err := s.stream.Send(resp); err != nil {
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeFeatureFlag] send the evaluation of flag %s failed: %v", resp.Evaluation.Flag, err)
+		return err
+	}
+	return nil
+}
+
+func featureFlagResponse(flag string, e *featureflag.Evaluation) *runtimev1pb.EvaluateFeatureFlagResponse {
+	return &runtimev1pb.EvaluateFeatureFlagResponse{
+		Flag:    flag,
+		Variant: e.Variant,
+		Value:   e.Value,
+		Reason:  runtimev1pb.FeatureFlagReason(runtimev1pb.FeatureFlagReason_value[e.Reason]),
+	}
+}
+
+func featureFlagError(storeName string, flag string, err error) error {
+	switch {
+	case errors.Is(err, featureflag.ErrFlagNotFound):
+		return messages.Errorf(codes.NotFound, messages.ErrFeatureFlagNotFound, flag, storeName)
+	case errors.Is(err, featureflag.ErrInvalidFlag):
+		return messages.Errorf(codes.FailedPrecondition, messages.ErrFeatureFlagInvalid, flag, storeName, err.Error())
+	case errors.Is(err, featureflag.ErrTargetingKeyRequired):
+		return messages.Errorf(codes.InvalidArgument, messages.ErrFeatureFlagEvaluate, flag, storeName, err.Error())
+	default:
+		return messages.Errorf(codes.Internal, messages.ErrFeatureFlagEvaluate, flag, storeName, err.Error())
+	}
+}
+
+// defaultGroup returns the default group of the store if the group is blank
+func defaultGroup(store configstores.Store, group string) string {
+	if strings.ReplaceAll(group, " ", "") == "" {
+		return store.GetDefaultGroup()
+	}
+	return group
+}
+
+// defaultLabel returns the default label of the store if the label is blank
+func defaultLabel(store configstores.Store, label string) string {
+	if strings.ReplaceAll(label, " ", "") == "" {
+		return store.GetDefaultLabel()
+	}
+	return label
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/mock"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const checkoutFlag = `{
+  "variants": {"on": true, "off": false},
+  "default_variant": "off",
+  "rules": [{"conditions": [{"attribute": "country", "operator": "in", "values": ["CN"]}], "variant": "on"}]
+}`
+
+func TestEvaluateFeatureFlag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock.NewMockStore(ctrl)
+	store.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+		assert.Equal(t, "default", req.Group)
+		switch req.Keys[0] {
+		case "checkout":
+			return []*configstores.ConfigurationItem{{Key: "checkout", Content: checkoutFlag}}, nil
+		case "broken":
+			return []*configstores.ConfigurationItem{{Key: "broken", Content: `{"variants": {}}`}}, nil
+		}
+		return nil, nil
+	}).AnyTimes()
+	a := NewAPI("", nil, map[string]configstores.Store{"mock": store}, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	resp, err := a.EvaluateFeatureFlag(context.Background(), &runtimev1pb.EvaluateFeatureFlagRequest{
+		StoreName:  "mock",
+		Flag:       "checkout",
+		Attributes: map[string]string{"country": "CN"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "on", resp.Variant)
+	assert.Equal(t, "true", resp.Value)
+	assert.Equal(t, runtimev1pb.FeatureFlagReason_TARGETING_MATCH, resp.Reason)
+
+	_, err = a.EvaluateFeatureFlag(context.Background(), &runtimev1pb.EvaluateFeatureFlagRequest{StoreName: "mock", Flag: "absent"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_FEATURE_FLAG_NOT_FOUND, messages.ErrorCodeOf(err))
+
+	_, err = a.EvaluateFeatureFlag(context.Background(), &runtimev1pb.EvaluateFeatureFlagRequest{StoreName: "mock", Flag: "broken"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_FEATURE_FLAG_INVALID, messages.ErrorCodeOf(err))
+
+	_, err = a.EvaluateFeatureFlag(context.Background(), &runtimev1pb.EvaluateFeatureFlagRequest{StoreName: "mock"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = a.EvaluateFeatureFlag(context.Background(), &runtimev1pb.EvaluateFeatureFlagRequest{StoreName: "etcd", Flag: "checkout"})
+	assert.Equal(t, runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
+}
+
+type mockSubscribeFeatureFlagServer struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   []*runtimev1pb.SubscribeFeatureFlagResponse
+	limit  int
+}
+
+func (m *mockSubscribeFeatureFlagServer) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockSubscribeFeatureFlagServer) Send(resp *runtimev1pb.SubscribeFeatureFlagResponse) error {
+	m.sent = append(m.sent, resp)
+	if len(m.sent) == m.limit {
+		m.cancel()
+	}
+	return nil
+}
+
+func TestSubscribeFeatureFlag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock.NewMockStore(ctrl)
+	store.EXPECT().StopSubscribe().Times(1)
+	store.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+		if req.Keys[0] == "checkout" {
+			return []*configstores.ConfigurationItem{{Key: "checkout", Content: checkoutFlag}}, nil
+		}
+		return nil, nil
+	}).Times(2)
+	store.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
+		assert.Equal(t, []string{"checkout", "search"}, req.Keys)
+		go func() {
+			changes := [][]*configstores.ConfigurationItem{
+				// the evaluation is unchanged
+				{{Key: "checkout", Content: `{"variants": {"on": true, "off": false}, "default_variant": "off", "rules": [{"variant": "off"}]}`}},
+				// invalid flags are ignored
+				{{Key: "checkout", Content: `{`}},
+				// not subscribed
+				{{Key: "other", Content: checkoutFlag}},
+				{{Key: "search", Content: `{"variants": {"v1": 1, "v2": 2}, "default_variant": "v2"}`}},
+				{{Key: "checkout", Deleted: true}},
+			}
+			for _, items := range changes {
+				ch <- &configstores.SubscribeResp{StoreName: "mock", Items: items}
+			}
+		}()
+		return nil
+	})
+	a := NewAPI("", nil, map[string]configstores.Store{"mock": store}, nil, nil, nil, nil, nil, nil, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &mockSubscribeFeatureFlagServer{ctx: ctx, cancel: cancel, limit: 4}
+	err := a.SubscribeFeatureFlag(&runtimev1pb.SubscribeFeatureFlagRequest{StoreName: "mock", Flags: []string{"checkout", "search"}}, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(stream.sent))
+	// the current evaluations
+	assert.Equal(t, "off", stream.sent[0].Evaluation.Variant)
+	assert.Equal(t, runtimev1pb.FeatureFlagReason_DEFAULT, stream.sent[0].Evaluation.Reason)
+	assert.Equal(t, "search", stream.sent[1].Evaluation.Flag)
+	assert.True(t, stream.sent[1].Deleted)
+	// the changes
+	assert.Equal(t, "2", stream.sent[2].Evaluation.Value)
+	assert.Equal(t, runtimev1pb.FeatureFlagReason_STATIC, stream.sent[2].Evaluation.Reason)
+	assert.Equal(t, "checkout", stream.sent[3].Evaluation.Flag)
+	assert.True(t, stream.sent[3].Deleted)
+}
+
+type unsubscribingStore struct {
+	*mock.MockStore
+	unsubscribed chan *configstores.SubscribeResp
+}
+
+func (s *unsubscribingStore) Unsubscribe(ch chan *configstores.SubscribeResp) {
+	s.unsubscribed = ch
+}
+
+func TestSubscribeFeatureFlagUnsubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := mock.NewMockStore(ctrl)
+	mockStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]*configstores.ConfigurationItem{{Key: "checkout", Content: checkoutFlag}}, nil)
+	var subscribed chan *configstores.SubscribeResp
+	// the store gives up the subscription
+	mockStore.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
+		subscribed = ch
+		close(ch)
+		return nil
+	})
+	store := &unsubscribingStore{MockStore: mockStore}
+	a := NewAPI("", nil, map[string]configstores.Store{"mock": store}, nil, nil, nil, nil, nil, nil, nil, nil)
+	stream := &mockSubscribeFeatureFlagServer{ctx: context.Background()}
+	err := a.SubscribeFeatureFlag(&runtimev1pb.SubscribeFeatureFlagRequest{StoreName: "mock", Flags: []string{"checkout"}}, stream)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, len(stream.sent))
+	// only the subscription of the stream is stopped, StopSubscribe isn't expected
+	assert.Equal(t, subscribed, store.unsubscribed)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/actuator/health"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const (
+	// runtimeServiceName is the service name of the Runtime API, which is checked by readiness.
+	runtimeServiceName = "spec.proto.runtime.v1.Runtime"
+	// livenessServiceName is the service name checked by liveness.
+	livenessServiceName = "liveness"
+	healthWatchInterval = time.Second
+)
+
+// GetReadiness reports the readiness indicators and the status of subscriptions.
+func (a *api) GetReadiness(ctx context.Context, in *runtimev1pb.GetReadinessRequest) (*runtimev1pb.GetReadinessResponse, error) {
+	indicatorStatus, components := health.CheckReadiness()
+	subscriptionStatus := a.getSubscriptionStatus()
+	resp := &runtimev1pb.GetReadinessResponse{
+		Status:             mergeStatus(indicatorStatus, subscriptionStatus),
+		SubscriptionStatus: subscriptionStatus,
+		Components:         make(map[string]*runtimev1pb.ComponentHealth, len(components)),
+	}
+	resp.Ready = resp.Status == health.UP
+	for name, h := range components {
+		details := make(map[string]string, len(h.Details))
+		for k, v := range h.Details {
+			details[k] = fmt.Sprint(v)
+		}
+		resp.Components[name] = &runtimev1pb.ComponentHealth{Status: h.Status, Details: details}
+	}
+	return resp, nil
+}
+
+func (a *api) setSubscriptionStatus(s health.Status) {
+	a.subscriptionStatusLock.Lock()
+	defer a.subscriptionStatusLock.Unlock()
+	a.subscriptionStatus = s
+}
+
+func (a *api) getSubscriptionStatus() health.Status {
+	a.subscriptionStatusLock.RLock()
+	defer a.subscriptionStatusLock.RUnlock()
+	return a.subscriptionStatus
+}
+
+// mergeStatus returns DOWN if any status is DOWN, otherwise INIT if any status is INIT, otherwise UP
+func mergeStatus(statuses ...health.Status) health.Status {
+	res := health.UP
+	for _, s := range statuses {
+		if s == health.DOWN {
+			return health.DOWN
+		}
+		if s == health.INIT {
+			res = health.INIT
+		}
+	}
+	return res
+}
+
+// healthServer implements grpc.health.v1.Health, so that the probes can target the grpc port directly.
+// The empty service name and the name of Runtime API are checked by readiness, and "liveness" is checked by liveness.
+type healthServer struct {
+	api *api
+}
+
+func (s *healthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := s.check(in.Service)
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch sends the status once it changes.
+func (s *healthServer) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+	for {
+		st, err := s.check(in.Service)
+		if err != nil {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+func (s *healthServer) check(service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	var st health.Status
+	switch service {
+	case "", runtimeServiceName:
+		indicatorStatus, _ := health.CheckReadiness()
+		st = mergeStatus(indicatorStatus, s.api.getSubscriptionStatus())
+	case livenessServiceName:
+		st, _ = health.CheckLiveness()
+	default:
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %s", service)
+	}
+	if st == health.UP {
+		return healthpb.HealthCheckResponse_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, nil
+}
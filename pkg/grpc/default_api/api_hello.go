@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/diagnostics/fault"
+	"mosn.io/layotto/pkg/messages"
+)
+
+// The keys of the metadata of SayHelloRequest controlling the response
+const (
+	helloMetadataLocale       = "locale"
+	helloMetadataDelayMs      = "delay_ms"
+	helloMetadataErrorCode    = "error_code"
+	helloMetadataErrorMessage = "error_message"
+	helloMetadataErrorPercent = "error_percent"
+
+	// maxHelloDelay caps the delay injected, so that the requests can't hold the sidecar for long
+	maxHelloDelay = time.Minute
+)
+
+// injectHelloFault delays the response and fails the request as the metadata requires
+func injectHelloFault(ctx context.Context, md map[string]string) error {
+	if v, ok := md[helloMetadataDelayMs]; ok {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return messages.Errorf(codes.InvalidArgument, "invalid %s: %s", helloMetadataDelayMs, v)
+		}
+		delay := time.Duration(ms) * time.Millisecond
+		if delay > maxHelloDelay {
+			delay = maxHelloDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	v, ok := md[helloMetadataErrorCode]
+	if !ok {
+		return nil
+	}
+	code, err := fault.ParseCode(v)
+	if err != nil {
+		return messages.Errorf(codes.InvalidArgument, "invalid %s: %s", helloMetadataErrorCode, v)
+	}
+	if code == codes.OK {
+		return nil
+	}
+	if v, ok := md[helloMetadataErrorPercent]; ok {
+		percent, err := strconv.Atoi(v)
+		if err != nil || percent < 0 || percent > 100 {
+			return messages.Errorf(codes.InvalidArgument, "invalid %s: %s", helloMetadataErrorPercent, v)
+		}
+		if rand.Intn(100) >= percent {
+			return nil
+		}
+	}
+	msg := md[helloMetadataErrorMessage]
+	if msg == "" {
+		msg = "error injected by the metadata of SayHello"
+	}
+	return status.Error(code, msg)
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/components/hello"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+type fakeHello struct {
+	req            *hello.HelloRequest
+	faultInjection bool
+}
+
+func (h *fakeHello) FaultInjectionEnabled() bool {
+	return h.faultInjection
+}
+
+func (h *fakeHello) Init(*hello.HelloConfig) error {
+	return nil
+}
+
+func (h *fakeHello) Hello(ctx context.Context, req *hello.HelloRequest) (*hello.HelloReponse, error) {
+	h.req = req
+	return &hello.HelloReponse{HelloString: "hi, " + req.Name}, nil
+}
+
+func TestSayHelloMetadata(t *testing.T) {
+	h := &fakeHello{faultInjection: true}
+	a := &api{hellos: map[string]hello.HelloService{"mock": h}}
+
+	t.Run("echo", func(t *testing.T) {
+		md := map[string]string{"locale": "zh-CN", "k": "v"}
+		resp, err := a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Name: "layotto", Metadata: md})
+		assert.Nil(t, err)
+		assert.Equal(t, "hi, layotto", resp.Hello)
+		assert.Equal(t, md, resp.Metadata)
+		assert.Equal(t, "zh-CN", h.req.Locale)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		start := time.Now()
+		_, err := a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"delay_ms": "20"}})
+		assert.Nil(t, err)
+		assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+		// the delay is interrupted by the deadline
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = a.SayHello(ctx, &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"delay_ms": "10000"}})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"error_code": "unavailable", "error_message": "try again"}})
+		assert.Equal(t, status.Error(codes.Unavailable, "try again"), err)
+		_, err = a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"error_code": "8"}})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		_, err = a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"error_code": "UNAVAILABLE", "error_percent": "0"}})
+		assert.Nil(t, err)
+		_, err = a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: map[string]string{"error_code": "OK"}})
+		assert.Nil(t, err)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		h := &fakeHello{}
+		a := &api{hellos: map[string]hello.HelloService{"mock": h}}
+		md := map[string]string{"delay_ms": "10000", "error_code": "UNAVAILABLE"}
+		resp, err := a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Name: "layotto", Metadata: md})
+		assert.Nil(t, err)
+		assert.Equal(t, "hi, layotto", resp.Hello)
+	})
+
+	t.Run("invalid metadata", func(t *testing.T) {
+		for _, md := range []map[string]string{
+			{"delay_ms": "-1"},
+			{"error_code": "NOT_A_CODE"},
+			{"error_code": "99"},
+			{"error_code": "INTERNAL", "error_percent": "101"},
+		} {
+			_, err := a.SayHello(context.Background(), &runtimev1pb.SayHelloRequest{ServiceName: "mock", Metadata: md})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", md)
+		}
+	})
+}
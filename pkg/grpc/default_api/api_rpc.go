@@ -0,0 +1,65 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/pkg/messages"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// GetPayloadSchemas returns the payload schemas of the target in all the invokers validating the payloads.
+func (a *api) GetPayloadSchemas(ctx context.Context, in *runtimev1pb.GetPayloadSchemasRequest) (*runtimev1pb.GetPayloadSchemasResponse, error) {
+	resp := &runtimev1pb.GetPayloadSchemasResponse{}
+	supported := false
+	for _, invoker := range a.rpcs {
+		provider, ok := invoker.(rpc.PayloadSchemaProvider)
+		if !ok {
+			continue
+		}
+		supported = true
+		for _, s := range provider.PayloadSchemas(in.Id) {
+			resp.Schemas = append(resp.Schemas, &runtimev1pb.PayloadSchema{
+				Id:                 s.Id,
+				Method:             s.Method,
+				RequestType:        s.RequestType,
+				ResponseType:       s.ResponseType,
+				DescriptorSet:      s.DescriptorSet,
+				RequestJsonSchema:  s.RequestJSONSchema,
+				ResponseJsonSchema: s.ResponseJSONSchema,
+				Transcode:          s.TargetFormat != "",
+				Mode:               s.Mode,
+				TargetFormat:       s.TargetFormat,
+			})
+		}
+	}
+	if !supported {
+		return nil, messages.Error(codes.FailedPrecondition, messages.ErrPayloadSchemaNotConfigured)
+	}
+	sort.SliceStable(resp.Schemas, func(i, j int) bool {
+		if resp.Schemas[i].Id != resp.Schemas[j].Id {
+			return resp.Schemas[i].Id < resp.Schemas[j].Id
+		}
+		return resp.Schemas[i].Method < resp.Schemas[j].Method
+	})
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtime_secretstores "mosn.io/layotto/pkg/runtime/secretstores"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// SubscribeSecret sends the current values of the secrets and their changes, e.g. the rotation of secrets,
+// until the stream is closed by the app.
+func (a *api) SubscribeSecret(in *runtimev1pb.SubscribeSecretRequest, stream runtimev1pb.Runtime_SubscribeSecretServer) error {
+	// 1. validate
+	if len(a.secretStores) == 0 {
+		return messages.Error(codes.FailedPrecondition, messages.ErrSecretStoreNotConfigured)
+	}
+	storeName := alias.Resolve(alias.SecretStore, in.StoreName)
+	store, ok := a.secretStores[storeName]
+	if !ok {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrSecretStoreNotFound, storeName)
+	}
+	watcher, ok := store.(runtime_secretstores.Watcher)
+	if !ok {
+		return messages.Errorf(codes.Unimplemented, messages.ErrSecretWatchNotSupported, storeName)
+	}
+	// 2. watch
+	ctx := stream.Context()
+	changes := newSecretChanges()
+	req := &runtime_secretstores.WatchRequest{Keys: in.Keys, Metadata: in.Metadata}
+	if err := watcher.Watch(ctx, req, changes.put); err != nil {
+		err = messages.Errorf(codes.Internal, messages.ErrSecretWatch, storeName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeSecret] %v", err)
+		return err
+	}
+	// 3. send the changes
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes.notify:
+		}
+		for _, e := range changes.take() {
+			resp := &runtimev1pb.SubscribeSecretResponse{
+				StoreName: in.StoreName,
+				Key:       e.Key,
+				Data:      e.Data,
+				Deleted:   e.Deleted,
+			}
+			if err := stream.Send(resp); err != nil {
+				log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeSecret] send the change of secret %s failed: %v", e.Key, err)
+				return err
+			}
+		}
+	}
+}
+
+// RenderTemplate renders the template with the secrets, so that the composite value, e.g. a JDBC url,
+// is built in the sidecar and never needs to be stored anywhere.
+func (a *api) RenderTemplate(ctx context.Context, in *runtimev1pb.RenderTemplateRequest) (*runtimev1pb.RenderTemplateResponse, error) {
+	if in.Template == "" {
+		return nil, messages.Error(codes.InvalidArgument, messages.ErrSecretTemplateEmpty)
+	}
+	get := func(storeName string, key string) (map[string]string, error) {
+		resp, err := a.GetSecret(ctx, &runtimev1pb.GetSecretRequest{StoreName: storeName, Key: key, Metadata: in.Metadata})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Data, nil
+	}
+	result, err := runtime_secretstores.RenderTemplate(in.Template, get)
+	if err != nil {
+		// the errors of GetSecret are returned as they are
+		if _, ok := status.FromError(err); !ok {
+			err = messages.Errorf(codes.InvalidArgument, messages.ErrSecretTemplate, err.Error())
+		}
+		log.DefaultLogger.Errorf("[runtime] [grpc.RenderTemplate] %v", err)
+		return nil, err
+	}
+	return &runtimev1pb.RenderTemplateResponse{Result: result}, nil
+}
+
+// secretChanges keeps the latest change of every secret until it's sent,
+// so that a slow app doesn't block the secret store.
+type secretChanges struct {
+	mu     sync.Mutex
+	keys   []string
+	latest map[string]*runtime_secretstores.SecretEvent
+	notify chan struct{}
+}
+
+func newSecretChanges() *secretChanges {
+	return &secretChanges{
+		latest: make(map[string]*runtime_secretstores.SecretEvent),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (c *secretChanges) put(e *runtime_secretstores.SecretEvent) {
+	c.mu.Lock()
+	if _, ok := c.latest[e.Key]; !ok {
+		c.keys = append(c.keys, e.Key)
+	}
+	c.latest[e.Key] = e
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the pending changes in the order of the secrets changed
+func (c *secretChanges) take() []*runtime_secretstores.SecretEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := make([]*runtime_secretstores.SecretEvent, 0, len(c.keys))
+	for _, k := range c.keys {
+		events = append(events, c.latest[k])
+	}
+	c.keys = nil
+	c.latest = make(map[string]*runtime_secretstores.SecretEvent)
+	return events
+}
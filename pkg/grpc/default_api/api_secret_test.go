@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/messages"
+	moke_secret "mosn.io/layotto/pkg/mock/components/secret"
+	runtime_secretstores "mosn.io/layotto/pkg/runtime/secretstores"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+type mockWatchableSecretStore struct {
+	moke_secret.FakeSecretStore
+	events []*runtime_secretstores.SecretEvent
+	req    *runtime_secretstores.WatchRequest
+}
+
+func (m *mockWatchableSecretStore) Watch(ctx context.Context, req *runtime_secretstores.WatchRequest, handler func(*runtime_secretstores.SecretEvent)) error {
+	m.req = req
+	for _, e := range m.events {
+		handler(e)
+	}
+	return nil
+}
+
+type mockSubscribeSecretServer struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   []*runtimev1pb.SubscribeSecretResponse
+	limit  int
+}
+
+func (m *mockSubscribeSecretServer) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockSubscribeSecretServer) Send(resp *runtimev1pb.SubscribeSecretResponse) error {
+	m.sent = append(m.sent, resp)
+	if len(m.sent) == m.limit {
+		m.cancel()
+	}
+	return nil
+}
+
+func TestSubscribeSecret(t *testing.T) {
+	store := &mockWatchableSecretStore{events: []*runtime_secretstores.SecretEvent{
+		{Key: "db", Data: map[string]string{"password": "1"}},
+		{Key: "mq", Data: map[string]string{"password": "2"}},
+		// only the latest change of db is sent if the app is slow
+		{Key: "db", Data: map[string]string{"password": "3"}},
+		{Key: "mq", Deleted: true},
+	}}
+	a := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, map[string]secretstores.SecretStore{
+		"watchable": store,
+		"fake":      moke_secret.FakeSecretStore{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &mockSubscribeSecretServer{ctx: ctx, cancel: cancel, limit: 2}
+	err := a.SubscribeSecret(&runtimev1pb.SubscribeSecretRequest{StoreName: "watchable", Keys: []string{"db", "mq"}}, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db", "mq"}, store.req.Keys)
+	assert.Len(t, stream.sent, 2)
+	assert.Equal(t, "watchable", stream.sent[0].StoreName)
+	assert.Equal(t, "db", stream.sent[0].Key)
+	assert.Equal(t, map[string]string{"password": "3"}, stream.sent[0].Data)
+	assert.Equal(t, "mq", stream.sent[1].Key)
+	assert.True(t, stream.sent[1].Deleted)
+
+	err = a.SubscribeSecret(&runtimev1pb.SubscribeSecretRequest{StoreName: "fake"}, stream)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_SECRET_WATCH_NOT_SUPPORTED, messages.ErrorCodeOf(err))
+
+	err = a.SubscribeSecret(&runtimev1pb.SubscribeSecretRequest{StoreName: "unknown"}, stream)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRenderTemplate(t *testing.T) {
+	a := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, map[string]secretstores.SecretStore{
+		"fake": moke_secret.FakeSecretStore{},
+	})
+
+	resp, err := a.RenderTemplate(context.Background(), &runtimev1pb.RenderTemplateRequest{
+		Template: `password={{secret "fake" "good-key" | urlquery}}`,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "password=life+is+good", resp.Result)
+
+	_, err = a.RenderTemplate(context.Background(), &runtimev1pb.RenderTemplateRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the errors of the template
+	_, err = a.RenderTemplate(context.Background(), &runtimev1pb.RenderTemplateRequest{Template: `{{secret "fake"`})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_SECRET_TEMPLATE_INVALID, messages.ErrorCodeOf(err))
+
+	// the errors of getting secrets
+	_, err = a.RenderTemplate(context.Background(), &runtimev1pb.RenderTemplateRequest{Template: `{{secret "unknown" "good-key"}}`})
+	assert.Equal(t, runtimev1pb.ErrorCode_SECRET_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
+	_, err = a.RenderTemplate(context.Background(), &runtimev1pb.RenderTemplateRequest{Template: `{{secret "fake" "error-key"}}`})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
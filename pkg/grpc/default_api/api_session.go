@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	state2 "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// CreateSession creates a session with a random id in the state store.
+func (a *api) CreateSession(ctx context.Context, in *runtimev1pb.CreateSessionRequest) (*runtimev1pb.CreateSessionResponse, error) {
+	if in == nil {
+		return &runtimev1pb.CreateSessionResponse{}, messages.Error(codes.InvalidArgument, "CreateSessionRequest is nil")
+	}
+	id, err := state2.NewSessionId()
+	if err != nil {
+		err = messages.Errorf(codes.Internal, messages.ErrSession, "", in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.CreateSession] error: %v", err)
+		return &runtimev1pb.CreateSessionResponse{}, err
+	}
+	sessions, key, err := a.getSessions("CreateSession", in.StoreName, id)
+	if err != nil {
+		return &runtimev1pb.CreateSessionResponse{}, err
+	}
+	s, err := sessions.Create(key, in.Data, in.TtlInSeconds, in.Metadata)
+	if err != nil {
+		return &runtimev1pb.CreateSessionResponse{}, sessionError("CreateSession", id, in.StoreName, err)
+	}
+	return &runtimev1pb.CreateSessionResponse{SessionId: id, ExpireTime: s.ExpireTime}, nil
+}
+
+// GetSession gets a session, and renews it if more than half of its ttl has elapsed since it's renewed.
+func (a *api) GetSession(ctx context.Context, in *runtimev1pb.GetSessionRequest) (*runtimev1pb.GetSessionResponse, error) {
+	if in == nil {
+		return &runtimev1pb.GetSessionResponse{}, messages.Error(codes.InvalidArgument, "GetSessionRequest is nil")
+	}
+	sessions, key, err := a.getSessions("GetSession", in.StoreName, in.SessionId)
+	if err != nil {
+		return &runtimev1pb.GetSessionResponse{}, err
+	}
+	s, err := sessions.Get(key, in.Metadata)
+	if err != nil {
+		return &runtimev1pb.GetSessionResponse{}, sessionError("GetSession", in.SessionId, in.StoreName, err)
+	}
+	return &runtimev1pb.GetSessionResponse{Data: s.Data, TtlInSeconds: s.TTLInSeconds, ExpireTime: s.ExpireTime}, nil
+}
+
+// TouchSession renews a session.
+func (a *api) TouchSession(ctx context.Context, in *runtimev1pb.TouchSessionRequest) (*runtimev1pb.TouchSessionResponse, error) {
+	if in == nil {
+		return &runtimev1pb.TouchSessionResponse{}, messages.Error(codes.InvalidArgument, "TouchSessionRequest is nil")
+	}
+	sessions, key, err := a.getSessions("TouchSession", in.StoreName, in.SessionId)
+	if err != nil {
+		return &runtimev1pb.TouchSessionResponse{}, err
+	}
+	s, err := sessions.Touch(key, in.Metadata)
+	if err != nil {
+		return &runtimev1pb.TouchSessionResponse{}, sessionError("TouchSession", in.SessionId, in.StoreName, err)
+	}
+	return &runtimev1pb.TouchSessionResponse{ExpireTime: s.ExpireTime}, nil
+}
+
+// RevokeSession deletes a session.
+func (a *api) RevokeSession(ctx context.Context, in *runtimev1pb.RevokeSessionRequest) (*emptypb.Empty, error) {
+	if in == nil {
+		return &emptypb.Empty{}, messages.Error(codes.InvalidArgument, "RevokeSessionRequest is nil")
+	}
+	sessions, key, err := a.getSessions("RevokeSession", in.StoreName, in.SessionId)
+	if err != nil {
+		return &emptypb.Empty{}, err
+	}
+	if err := sessions.Revoke(key, in.Metadata); err != nil {
+		return &emptypb.Empty{}, sessionError("RevokeSession", in.SessionId, in.StoreName, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// getSessions returns the sessions of the state store, and the key of the session in it
+func (a *api) getSessions(method string, storeName string, id string) (*state2.Sessions, string, error) {
+	storeName = alias.Resolve(alias.State, storeName)
+	store, err := a.getStateStore(storeName)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.%s] error: %v", method, err)
+		return nil, "", err
+	}
+	if id == "" {
+		return nil, "", messages.Error(codes.InvalidArgument, "the session_id is required")
+	}
+	key, err := state2.GetModifiedStateKey(state2.SessionKey(id), storeName, a.appId)
+	if err != nil {
+		return nil, "", err
+	}
+	sessions, err := state2.NewSessions(store)
+	if err != nil {
+		return nil, "", sessionError(method, id, storeName, err)
+	}
+	return sessions, key, nil
+}
+
+func sessionError(method string, id string, storeName string, err error) error {
+	switch err {
+	case state2.ErrSessionNotFound:
+		return messages.Errorf(codes.NotFound, messages.ErrSessionNotFound, id, storeName)
+	case state2.ErrSessionETagNotSupported:
+		return messages.Errorf(codes.FailedPrecondition, messages.ErrSession, id, storeName, err.Error())
+	case state2.ErrSessionTTLInvalid:
+		return messages.Errorf(codes.InvalidArgument, messages.ErrSession, id, storeName, err.Error())
+	}
+	err = messages.Errorf(codes.Internal, messages.ErrSession, id, storeName, err.Error())
+	log.DefaultLogger.Errorf("[runtime] [grpc.%s] error: %v", method, err)
+	return err
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/messages"
+	state2 "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// mapStateStore is a state store without etag, which keeps the values in a map
+type mapStateStore struct {
+	state.Store
+	items map[string][]byte
+}
+
+func (s *mapStateStore) Features() []state.Feature {
+	return nil
+}
+
+func (s *mapStateStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	return &state.GetResponse{Data: s.items[req.Key]}, nil
+}
+
+func (s *mapStateStore) Set(req *state.SetRequest) error {
+	s.items[req.Key] = req.Value.([]byte)
+	return nil
+}
+
+func (s *mapStateStore) Delete(req *state.DeleteRequest) error {
+	delete(s.items, req.Key)
+	return nil
+}
+
+func TestSession(t *testing.T) {
+	store := &mapStateStore{items: map[string][]byte{}}
+	etagStore, err := state2.NewETagStore(store, &state2.ETagConfig{})
+	assert.Nil(t, err)
+	stores := map[string]state.Store{"mock": etagStore, "noetag": &mapStateStore{items: map[string][]byte{}}}
+	api := NewAPI("app", nil, nil, nil, nil, stores, nil, nil, nil, nil, nil)
+	ctx := context.Background()
+
+	_, err = api.CreateSession(ctx, &runtimev1pb.CreateSessionRequest{StoreName: "abc", TtlInSeconds: 60})
+	assert.Equal(t, "rpc error: code = InvalidArgument desc = state store abc is not found", err.Error())
+	_, err = api.CreateSession(ctx, &runtimev1pb.CreateSessionRequest{StoreName: "noetag", TtlInSeconds: 60})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = api.CreateSession(ctx, &runtimev1pb.CreateSessionRequest{StoreName: "mock"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created, err := api.CreateSession(ctx, &runtimev1pb.CreateSessionRequest{StoreName: "mock", TtlInSeconds: 60, Data: []byte("user=1")})
+	assert.Nil(t, err)
+	assert.Len(t, created.SessionId, 32)
+	assert.InDelta(t, time.Now().Unix()+60, created.ExpireTime, 2)
+	assert.Len(t, store.items, 1)
+	for key := range store.items {
+		assert.True(t, strings.HasSuffix(key, "layotto-session-"+created.SessionId))
+	}
+
+	got, err := api.GetSession(ctx, &runtimev1pb.GetSessionRequest{StoreName: "mock", SessionId: created.SessionId})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user=1"), got.Data)
+	assert.Equal(t, int64(60), got.TtlInSeconds)
+	touched, err := api.TouchSession(ctx, &runtimev1pb.TouchSessionRequest{StoreName: "mock", SessionId: created.SessionId})
+	assert.Nil(t, err)
+	assert.True(t, touched.ExpireTime >= created.ExpireTime)
+
+	_, err = api.RevokeSession(ctx, &runtimev1pb.RevokeSessionRequest{StoreName: "mock", SessionId: created.SessionId})
+	assert.Nil(t, err)
+	_, err = api.GetSession(ctx, &runtimev1pb.GetSessionRequest{StoreName: "mock", SessionId: created.SessionId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_STATE_SESSION_NOT_FOUND, messages.ErrorCodeOf(err))
+	_, err = api.TouchSession(ctx, &runtimev1pb.TouchSessionRequest{StoreName: "mock", SessionId: created.SessionId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = api.GetSession(ctx, &runtimev1pb.GetSessionRequest{StoreName: "mock"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -17,25 +17,33 @@
 package default_api
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	_ "net/http/pprof"
+	"strconv"
 
+	"github.com/dapr/components-contrib/state"
 	"github.com/golang/protobuf/ptypes/empty"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"mosn.io/layotto/pkg/common"
 	dapr_common_v1pb "mosn.io/layotto/pkg/grpc/dapr/proto/common/v1"
 	dapr_v1pb "mosn.io/layotto/pkg/grpc/dapr/proto/runtime/v1"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	state2 "mosn.io/layotto/pkg/runtime/state"
 	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+	"mosn.io/pkg/log"
 )
 
 // GetState obtains the state for a specific key.
 func (a *api) GetState(ctx context.Context, in *runtimev1pb.GetStateRequest) (*runtimev1pb.GetStateResponse, error) {
 	if in == nil {
-		return &runtimev1pb.GetStateResponse{}, status.Error(codes.InvalidArgument, "GetStateRequest is nil")
+		return &runtimev1pb.GetStateResponse{}, messages.Error(codes.InvalidArgument, "GetStateRequest is nil")
 	}
 	daprReq := &dapr_v1pb.GetStateRequest{
-		StoreName:   in.GetStoreName(),
+		StoreName:   alias.Resolve(alias.State, in.GetStoreName()),
 		Key:         in.GetKey(),
 		Consistency: dapr_common_v1pb.StateOptions_StateConsistency(in.GetConsistency()),
 		Metadata:    in.GetMetadata(),
@@ -53,11 +61,11 @@ func (a *api) GetState(ctx context.Context, in *runtimev1pb.GetStateRequest) (*r
 
 func (a *api) SaveState(ctx context.Context, in *runtimev1pb.SaveStateRequest) (*emptypb.Empty, error) {
 	if in == nil {
-		return &emptypb.Empty{}, status.Error(codes.InvalidArgument, "SaveStateRequest is nil")
+		return &emptypb.Empty{}, messages.Error(codes.InvalidArgument, "SaveStateRequest is nil")
 	}
 	// convert request
 	daprReq := &dapr_v1pb.SaveStateRequest{
-		StoreName: in.StoreName,
+		StoreName: alias.Resolve(alias.State, in.StoreName),
 		States:    convertStatesToDaprPB(in.States),
 	}
 	// delegate to dapr api implementation
@@ -66,10 +74,10 @@ func (a *api) SaveState(ctx context.Context, in *runtimev1pb.SaveStateRequest) (
 
 func (a *api) GetBulkState(ctx context.Context, in *runtimev1pb.GetBulkStateRequest) (*runtimev1pb.GetBulkStateResponse, error) {
 	if in == nil {
-		return &runtimev1pb.GetBulkStateResponse{}, status.Error(codes.InvalidArgument, "GetBulkStateRequest is nil")
+		return &runtimev1pb.GetBulkStateResponse{}, messages.Error(codes.InvalidArgument, "GetBulkStateRequest is nil")
 	}
 	daprReq := &dapr_v1pb.GetBulkStateRequest{
-		StoreName:   in.GetStoreName(),
+		StoreName:   alias.Resolve(alias.State, in.GetStoreName()),
 		Keys:        in.GetKeys(),
 		Parallelism: in.GetParallelism(),
 		Metadata:    in.GetMetadata(),
@@ -91,12 +99,42 @@ func (a *api) GetBulkState(ctx context.Context, in *runtimev1pb.GetBulkStateRequ
 	return ret, nil
 }
 
+// QueryState queries the state items by their values, for the state stores implementing state.Querier.
+func (a *api) QueryState(ctx context.Context, in *runtimev1pb.QueryStateRequest) (*runtimev1pb.QueryStateResponse, error) {
+	if in == nil {
+		return &runtimev1pb.QueryStateResponse{}, messages.Error(codes.InvalidArgument, "QueryStateRequest is nil")
+	}
+	daprReq := &dapr_v1pb.QueryStateRequest{
+		StoreName: alias.Resolve(alias.State, in.GetStoreName()),
+		Query:     in.GetQuery(),
+		Metadata:  in.GetMetadata(),
+	}
+	resp, err := a.daprAPI.QueryStateAlpha1(ctx, daprReq)
+	if err != nil {
+		return &runtimev1pb.QueryStateResponse{}, err
+	}
+	ret := &runtimev1pb.QueryStateResponse{
+		Results:  make([]*runtimev1pb.QueryStateItem, 0, len(resp.Results)),
+		Token:    resp.GetToken(),
+		Metadata: resp.GetMetadata(),
+	}
+	for _, item := range resp.Results {
+		ret.Results = append(ret.Results, &runtimev1pb.QueryStateItem{
+			Key:   item.GetKey(),
+			Data:  item.GetData(),
+			Etag:  item.GetEtag(),
+			Error: item.GetError(),
+		})
+	}
+	return ret, nil
+}
+
 func (a *api) DeleteState(ctx context.Context, in *runtimev1pb.DeleteStateRequest) (*emptypb.Empty, error) {
 	if in == nil {
-		return &emptypb.Empty{}, status.Error(codes.InvalidArgument, "DeleteStateRequest is nil")
+		return &emptypb.Empty{}, messages.Error(codes.InvalidArgument, "DeleteStateRequest is nil")
 	}
 	daprReq := &dapr_v1pb.DeleteStateRequest{
-		StoreName: in.GetStoreName(),
+		StoreName: alias.Resolve(alias.State, in.GetStoreName()),
 		Key:       in.GetKey(),
 		Etag:      convertEtagToDaprPB(in.Etag),
 		Options:   convertOptionsToDaprPB(in.Options),
@@ -107,10 +145,10 @@ func (a *api) DeleteState(ctx context.Context, in *runtimev1pb.DeleteStateReques
 
 func (a *api) DeleteBulkState(ctx context.Context, in *runtimev1pb.DeleteBulkStateRequest) (*empty.Empty, error) {
 	if in == nil {
-		return &emptypb.Empty{}, status.Error(codes.InvalidArgument, "DeleteBulkStateRequest is nil")
+		return &emptypb.Empty{}, messages.Error(codes.InvalidArgument, "DeleteBulkStateRequest is nil")
 	}
 	daprReq := &dapr_v1pb.DeleteBulkStateRequest{
-		StoreName: in.GetStoreName(),
+		StoreName: alias.Resolve(alias.State, in.GetStoreName()),
 		States:    convertStatesToDaprPB(in.States),
 	}
 	return a.daprAPI.DeleteBulkState(ctx, daprReq)
@@ -118,16 +156,325 @@ func (a *api) DeleteBulkState(ctx context.Context, in *runtimev1pb.DeleteBulkSta
 
 func (a *api) ExecuteStateTransaction(ctx context.Context, in *runtimev1pb.ExecuteStateTransactionRequest) (*emptypb.Empty, error) {
 	if in == nil {
-		return &emptypb.Empty{}, status.Error(codes.InvalidArgument, "ExecuteStateTransactionRequest is nil")
+		return &emptypb.Empty{}, messages.Error(codes.InvalidArgument, "ExecuteStateTransactionRequest is nil")
+	}
+	storeName := alias.Resolve(alias.State, in.GetStoreName())
+	metadata := in.GetMetadata()
+	// the messages reach the outbox store through the metadata, which can't be forged by the app
+	if len(in.Outbox) > 0 || metadata[state2.OutboxMetadataKey] != "" {
+		var err error
+		if metadata, err = a.outboxMetadata(storeName, in.Outbox, metadata); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteStateTransaction] error: %v", err)
+			return &emptypb.Empty{}, err
+		}
 	}
 	daprReq := &dapr_v1pb.ExecuteStateTransactionRequest{
-		StoreName:  in.GetStoreName(),
+		StoreName:  storeName,
 		Operations: convertTransactionalStateOperationToDaprPB(in.Operations),
-		Metadata:   in.GetMetadata(),
+		Metadata:   metadata,
 	}
 	return a.daprAPI.ExecuteStateTransaction(ctx, daprReq)
 }
 
+// outboxMetadata returns the metadata of the transaction carrying the messages saved in the outbox of the store
+func (a *api) outboxMetadata(storeName string, outbox []*runtimev1pb.OutboxMessage, metadata map[string]string) (map[string]string, error) {
+	var msgs []*state2.OutboxMessage
+	if len(outbox) > 0 {
+		store, err := a.getStateStore(storeName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := state2.AsOutboxStore(store); !ok {
+			return nil, messages.Errorf(codes.Unimplemented, messages.ErrStateOutboxNotSupported, storeName)
+		}
+		msgs = make([]*state2.OutboxMessage, 0, len(outbox))
+		for i, m := range outbox {
+			if m.GetPubsubName() == "" || m.GetTopic() == "" {
+				return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateOutboxInvalid, i, "the pubsub name and the topic are required")
+			}
+			if _, ok := a.pubSubs[m.PubsubName]; !ok {
+				return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateOutboxInvalid, i, "pubsub "+m.PubsubName+" not found")
+			}
+			msgs = append(msgs, &state2.OutboxMessage{PubsubName: m.PubsubName, Topic: m.Topic, Data: m.Data, Metadata: m.Metadata})
+		}
+	}
+	metadata, err := state2.WithOutbox(metadata, msgs)
+	if err != nil {
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateOutboxInvalid, 0, err.Error())
+	}
+	return metadata, nil
+}
+
+// CompareAndSwap sets the value of a key only if its current value equals the expected one.
+func (a *api) CompareAndSwap(ctx context.Context, in *runtimev1pb.CompareAndSwapRequest) (*runtimev1pb.CompareAndSwapResponse, error) {
+	if in == nil {
+		return &runtimev1pb.CompareAndSwapResponse{}, messages.Error(codes.InvalidArgument, "CompareAndSwapRequest is nil")
+	}
+	in.StoreName = alias.Resolve(alias.State, in.StoreName)
+	// 1. get store
+	store, err := a.getStateStore(in.StoreName)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	// the comparison and the set are not atomic, so an etag is needed to detect concurrent modifications
+	if !state.FeatureETag.IsPresent(store.Features()) {
+		err = messages.Errorf(codes.Unimplemented, messages.ErrStateStoreNotSupportETag, in.StoreName)
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	key, err := state2.GetModifiedStateKey(in.Key, in.StoreName, a.appId)
+	if err != nil {
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	if in.ExpectAbsent {
+		return a.createIfAbsent(in, store, key)
+	}
+	// 2. get the current value
+	current, err := store.Get(&state.GetRequest{
+		Key:      key,
+		Metadata: in.Metadata,
+		Options:  state.GetStateOption{Consistency: state.Strong},
+	})
+	if err != nil {
+		err = messages.Errorf(codes.Internal, messages.ErrStateGet, in.Key, in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	// 3. compare, an absent key never matches since it has no etag to guard the set
+	if current == nil || current.ETag == nil || !bytes.Equal(current.Data, in.ExpectedValue) {
+		resp := &runtimev1pb.CompareAndSwapResponse{Succeeded: false}
+		if current != nil {
+			resp.Value = current.Data
+			resp.Etag = common.PointerToString(current.ETag)
+		}
+		return resp, nil
+	}
+	// 4. set with etag
+	err = store.Set(&state.SetRequest{
+		Key:      key,
+		Value:    in.NewValue,
+		ETag:     current.ETag,
+		Metadata: in.Metadata,
+		Options: state.SetStateOption{
+			Concurrency: state.FirstWrite,
+			Consistency: state.Strong,
+		},
+	})
+	if err != nil {
+		if e, ok := err.(*state.ETagError); ok && e.Kind() == state.ETagMismatch {
+			// lost the race
+			return &runtimev1pb.CompareAndSwapResponse{Succeeded: false}, nil
+		}
+		err = messages.Errorf(codes.Internal, messages.ErrStateSave, in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	return &runtimev1pb.CompareAndSwapResponse{
+		Succeeded: true,
+		Value:     in.NewValue,
+		Etag:      a.etagOf(store, key, in.NewValue, in.Metadata),
+	}, nil
+}
+
+// createIfAbsent creates the key by the atomic set-if-absent of the store, since saving without etag isn't conditional in all the stores
+func (a *api) createIfAbsent(in *runtimev1pb.CompareAndSwapRequest, store state.Store, key string) (*runtimev1pb.CompareAndSwapResponse, error) {
+	if len(in.NewValue) == 0 {
+		return &runtimev1pb.CompareAndSwapResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrStateSave, in.StoreName, "the new_value is empty")
+	}
+	ttl, _ := strconv.ParseInt(in.Metadata[state2.TTLMetadataKey], 10, 64)
+	created, value, err := state2.CheckAndRecord(store, &state2.IdempotencyRequest{
+		Key:          key,
+		Value:        in.NewValue,
+		TTLInSeconds: ttl,
+		Metadata:     in.Metadata,
+	})
+	if err == state2.ErrIdempotencyNotSupported {
+		err = messages.Errorf(codes.Unimplemented, messages.ErrStateCreateNotSupported, in.StoreName)
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	if err != nil {
+		err = messages.Errorf(codes.Internal, messages.ErrStateSave, in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.CompareAndSwap] error: %v", err)
+		return &runtimev1pb.CompareAndSwapResponse{}, err
+	}
+	return &runtimev1pb.CompareAndSwapResponse{
+		Succeeded: created,
+		Value:     value,
+		Etag:      a.etagOf(store, key, value, in.Metadata),
+	}, nil
+}
+
+// etagOf reads the etag of the value written, it's empty if the value has been modified again
+func (a *api) etagOf(store state.Store, key string, value []byte, metadata map[string]string) string {
+	resp, err := store.Get(&state.GetRequest{
+		Key:      key,
+		Metadata: metadata,
+		Options:  state.GetStateOption{Consistency: state.Strong},
+	})
+	if err != nil || resp == nil || !bytes.Equal(resp.Data, value) {
+		return ""
+	}
+	return common.PointerToString(resp.ETag)
+}
+
+// Increment increases the integer value of a key atomically.
+func (a *api) Increment(ctx context.Context, in *runtimev1pb.IncrementRequest) (*runtimev1pb.IncrementResponse, error) {
+	if in == nil {
+		return &runtimev1pb.IncrementResponse{}, messages.Error(codes.InvalidArgument, "IncrementRequest is nil")
+	}
+	delta := in.Delta
+	if delta == 0 {
+		delta = 1
+	}
+	v, err := a.doIncrement("Increment", in.StoreName, in.Key, delta, in.Metadata)
+	if err != nil {
+		return &runtimev1pb.IncrementResponse{}, err
+	}
+	return &runtimev1pb.IncrementResponse{Value: v}, nil
+}
+
+// Decrement decreases the integer value of a key atomically.
+func (a *api) Decrement(ctx context.Context, in *runtimev1pb.DecrementRequest) (*runtimev1pb.DecrementResponse, error) {
+	if in == nil {
+		return &runtimev1pb.DecrementResponse{}, messages.Error(codes.InvalidArgument, "DecrementRequest is nil")
+	}
+	delta := in.Delta
+	if delta == 0 {
+		delta = 1
+	}
+	v, err := a.doIncrement("Decrement", in.StoreName, in.Key, -delta, in.Metadata)
+	if err != nil {
+		return &runtimev1pb.DecrementResponse{}, err
+	}
+	return &runtimev1pb.DecrementResponse{Value: v}, nil
+}
+
+// DeleteStateByPrefix deletes all the keys starting with the prefix.
+func (a *api) DeleteStateByPrefix(ctx context.Context, in *runtimev1pb.DeleteStateByPrefixRequest) (*runtimev1pb.DeleteStateByPrefixResponse, error) {
+	if in == nil {
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, messages.Error(codes.InvalidArgument, "DeleteStateByPrefixRequest is nil")
+	}
+	in.StoreName = alias.Resolve(alias.State, in.StoreName)
+	// 1. get store
+	store, err := a.getStateStore(in.StoreName)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.DeleteStateByPrefix] error: %v", err)
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, err
+	}
+	// 2. check the request, the prefix of the app id is added to the prefix below so an empty one would match all the keys
+	if in.Prefix == "" {
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrStateDeleteByPrefix, in.Prefix, in.StoreName, state2.ErrPrefixEmpty.Error())
+	}
+	if !in.Confirm {
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrStateDeleteNotConfirmed, in.Prefix, in.StoreName)
+	}
+	prefix, err := state2.GetModifiedStateKey(in.Prefix, in.StoreName, a.appId)
+	if err != nil {
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, err
+	}
+	// 3. delete
+	n, err := state2.DeleteByPrefix(store, &state2.DeleteByPrefixRequest{
+		Prefix:   prefix,
+		MaxKeys:  int(in.MaxKeys),
+		Metadata: in.Metadata,
+	})
+	if err != nil {
+		code := codes.Internal
+		switch {
+		case err == state2.ErrListKeysNotSupported:
+			code = codes.Unimplemented
+		case errors.Is(err, state2.ErrPrefixTooManyKeys):
+			code = codes.FailedPrecondition
+		}
+		err = messages.Errorf(code, messages.ErrStateDeleteByPrefix, in.Prefix, in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.DeleteStateByPrefix] error: %v", err)
+		return &runtimev1pb.DeleteStateByPrefixResponse{}, err
+	}
+	log.DefaultLogger.Infof("[runtime] [grpc.DeleteStateByPrefix] %d keys with prefix %s are deleted in state store %s", n, in.Prefix, in.StoreName)
+	return &runtimev1pb.DeleteStateByPrefixResponse{Deleted: int32(n)}, nil
+}
+
+// CheckAndRecordIdempotency records the processed-marker of a key if it's absent, and reports whether it's recorded by this call.
+func (a *api) CheckAndRecordIdempotency(ctx context.Context, in *runtimev1pb.CheckAndRecordIdempotencyRequest) (*runtimev1pb.CheckAndRecordIdempotencyResponse, error) {
+	if in == nil {
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, messages.Error(codes.InvalidArgument, "CheckAndRecordIdempotencyRequest is nil")
+	}
+	in.StoreName = alias.Resolve(alias.State, in.StoreName)
+	// 1. get store
+	store, err := a.getStateStore(in.StoreName)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.CheckAndRecordIdempotency] error: %v", err)
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, err
+	}
+	// 2. check the request
+	if in.Key == "" {
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrStateIdempotency, in.Key, in.StoreName, "the key is empty")
+	}
+	if in.TtlInSeconds < 0 {
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, messages.Errorf(codes.InvalidArgument, messages.ErrStateIdempotency, in.Key, in.StoreName, "the ttl_in_seconds is negative")
+	}
+	key, err := state2.GetModifiedStateKey(in.Key, in.StoreName, a.appId)
+	if err != nil {
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, err
+	}
+	// 3. test and set
+	recorded, value, err := state2.CheckAndRecord(store, &state2.IdempotencyRequest{
+		Key:          key,
+		Value:        in.Value,
+		TTLInSeconds: in.TtlInSeconds,
+		Metadata:     in.Metadata,
+	})
+	if err != nil {
+		code := codes.Internal
+		if err == state2.ErrIdempotencyNotSupported {
+			code = codes.Unimplemented
+		}
+		err = messages.Errorf(code, messages.ErrStateIdempotency, in.Key, in.StoreName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.CheckAndRecordIdempotency] error: %v", err)
+		return &runtimev1pb.CheckAndRecordIdempotencyResponse{}, err
+	}
+	return &runtimev1pb.CheckAndRecordIdempotencyResponse{Recorded: recorded, Value: value}, nil
+}
+
+func (a *api) doIncrement(method string, storeName string, key string, delta int64, metadata map[string]string) (int64, error) {
+	storeName = alias.Resolve(alias.State, storeName)
+	// 1. get store
+	store, err := a.getStateStore(storeName)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.%s] error: %v", method, err)
+		return 0, err
+	}
+	// 2. generate the actual key
+	modifiedKey, err := state2.GetModifiedStateKey(key, storeName, a.appId)
+	if err != nil {
+		return 0, err
+	}
+	// 3. increment
+	v, err := state2.Increment(store, &state2.IncrementRequest{
+		Key:      modifiedKey,
+		Delta:    delta,
+		Metadata: metadata,
+	}, state2.DefaultIncrementMaxRetries)
+	// 4. check result
+	if err != nil {
+		code := codes.Internal
+		switch err {
+		case state2.ErrIncrementNotSupported:
+			code = codes.Unimplemented
+		case state2.ErrValueNotInteger:
+			code = codes.FailedPrecondition
+		case state2.ErrIncrementConflict:
+			code = codes.Aborted
+		}
+		err = messages.Errorf(code, messages.ErrStateIncrement, key, storeName, err.Error())
+		log.DefaultLogger.Errorf("[runtime] [grpc.%s] error: %v", method, err)
+		return 0, err
+	}
+	return v, nil
+}
+
 // some code for converting from runtimev1pb to dapr_common_v1pb
 
 func convertEtagToDaprPB(etag *runtimev1pb.Etag) *dapr_common_v1pb.Etag {
@@ -153,22 +500,26 @@ func convertStatesToDaprPB(states []*runtimev1pb.StateItem) []*dapr_common_v1pb.
 		return dStates
 	}
 	for _, s := range states {
-		ds := &dapr_common_v1pb.StateItem{
-			Key:      s.Key,
-			Value:    s.Value,
-			Metadata: s.Metadata,
-		}
-		if s.Etag != nil {
-			ds.Etag = convertEtagToDaprPB(s.Etag)
-		}
-		if s.Options != nil {
-			ds.Options = convertOptionsToDaprPB(s.Options)
-		}
-		dStates = append(dStates, ds)
+		dStates = append(dStates, convertStateToDaprPB(s))
 	}
 	return dStates
 }
 
+func convertStateToDaprPB(s *runtimev1pb.StateItem) *dapr_common_v1pb.StateItem {
+	ds := &dapr_common_v1pb.StateItem{
+		Key:      s.Key,
+		Value:    s.Value,
+		Metadata: s.Metadata,
+	}
+	if s.Etag != nil {
+		ds.Etag = convertEtagToDaprPB(s.Etag)
+	}
+	if s.Options != nil {
+		ds.Options = convertOptionsToDaprPB(s.Options)
+	}
+	return ds
+}
+
 func convertTransactionalStateOperationToDaprPB(ops []*runtimev1pb.TransactionalStateOperation) []*dapr_v1pb.TransactionalStateOperation {
 	ret := make([]*dapr_v1pb.TransactionalStateOperation, 0, len(ops))
 	for i := 0; i < len(ops); i++ {
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/grpc/dapr"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	state2 "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// compensationRecord is persisted into every participating store before any change is applied,
+// so that the changes can be reverted (by the runtime or manually) if some other store fails.
+type compensationRecord struct {
+	TransactionId string               `json:"transactionId"`
+	StoreName     string               `json:"storeName"`
+	Entries       []*compensationEntry `json:"entries"`
+}
+
+// compensationEntry is the original value of a key before the transaction.
+type compensationEntry struct {
+	Key    string `json:"key"`
+	Exists bool   `json:"exists"`
+	Value  []byte `json:"value,omitempty"`
+}
+
+// txParticipant holds everything about a store taking part in a cross-store transaction.
+type txParticipant struct {
+	storeName  string
+	store      state.Store
+	operations []state.TransactionalStateOperation
+	recordKey  string
+	record     *compensationRecord
+	result     *runtimev1pb.StoreTransactionResult
+}
+
+// ExecuteMultiStoreStateTransaction executes a best-effort transaction across multiple state stores.
+// It works in two phases:
+// 1. prepare: the original values of the keys are saved as a compensation record in every participating store.
+// 2. apply: operations are applied store by store. If any store fails, all the touched stores are restored from their compensation records.
+// The compensation records are deleted once the transaction is committed or rolled back,
+// and kept for manual recovery if the compensation fails.
+func (a *api) ExecuteMultiStoreStateTransaction(ctx context.Context, in *runtimev1pb.ExecuteMultiStoreStateTransactionRequest) (*runtimev1pb.ExecuteMultiStoreStateTransactionResponse, error) {
+	if in == nil {
+		return &runtimev1pb.ExecuteMultiStoreStateTransactionResponse{}, messages.Error(codes.InvalidArgument, "ExecuteMultiStoreStateTransactionRequest is nil")
+	}
+	// 1. check params
+	if len(a.stateStores) == 0 {
+		err := messages.Error(codes.FailedPrecondition, messages.ErrStateStoresNotConfigured)
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] error: %v", err)
+		return &runtimev1pb.ExecuteMultiStoreStateTransactionResponse{}, err
+	}
+	txId := uuid.New().String()
+	// 2. group operations by store
+	participants, err := a.groupOperationsByStore(txId, in.Operations)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] error: %v", err)
+		return &runtimev1pb.ExecuteMultiStoreStateTransactionResponse{}, err
+	}
+	resp := &runtimev1pb.ExecuteMultiStoreStateTransactionResponse{
+		TransactionId: txId,
+		Status:        runtimev1pb.ExecuteMultiStoreStateTransactionResponse_COMMITTED,
+		Results:       make([]*runtimev1pb.StoreTransactionResult, 0, len(participants)),
+	}
+	for _, p := range participants {
+		resp.Results = append(resp.Results, p.result)
+	}
+	// 3. prepare phase: persist compensation records
+	for i, p := range participants {
+		if err := a.prepareParticipant(p); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] prepare store %s error: %v", p.storeName, err)
+			p.result.Error = err.Error()
+			a.removeCompensationRecords(participants[:i])
+			resp.Status = runtimev1pb.ExecuteMultiStoreStateTransactionResponse_ROLLED_BACK
+			return resp, nil
+		}
+	}
+	// 4. apply phase
+	for i, p := range participants {
+		if err := a.applyParticipant(p, in.Metadata); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] apply store %s error: %v", p.storeName, err)
+			p.result.Error = err.Error()
+			// the failed store might be partially applied, so it should be compensated too
+			resp.Status = a.compensateParticipants(participants[:i+1])
+			a.removeCompensationRecords(participants[i+1:])
+			return resp, nil
+		}
+		p.result.Applied = true
+	}
+	// 5. clean up
+	a.removeCompensationRecords(participants)
+	return resp, nil
+}
+
+func (a *api) groupOperationsByStore(txId string, ops []*runtimev1pb.MultiStoreStateOperation) ([]*txParticipant, error) {
+	participants := make([]*txParticipant, 0)
+	byName := make(map[string]*txParticipant)
+	for _, op := range ops {
+		// tolerant npe
+		if op == nil || op.Request == nil {
+			log.DefaultLogger.Warnf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] one of MultiStoreStateOperation.Request is nil")
+			continue
+		}
+		op.StoreName = alias.Resolve(alias.State, op.StoreName)
+		p, ok := byName[op.StoreName]
+		if !ok {
+			store, exists := a.stateStores[op.StoreName]
+			if !exists {
+				return nil, messages.Errorf(codes.InvalidArgument, messages.ErrStateStoreNotFound, op.StoreName)
+			}
+			recordKey, err := state2.GetModifiedStateKey(state2.CompensationRecordKeyPrefix+txId, op.StoreName, a.appId)
+			if err != nil {
+				return nil, err
+			}
+			p = &txParticipant{
+				storeName: op.StoreName,
+				store:     store,
+				recordKey: recordKey,
+				record: &compensationRecord{
+					TransactionId: txId,
+					StoreName:     op.StoreName,
+				},
+				result: &runtimev1pb.StoreTransactionResult{StoreName: op.StoreName},
+			}
+			byName[op.StoreName] = p
+			participants = append(participants, p)
+		}
+		key, err := state2.GetModifiedStateKey(op.Request.Key, op.StoreName, a.appId)
+		if err != nil {
+			return nil, err
+		}
+		switch state.OperationType(op.OperationType) {
+		case state.Upsert:
+			p.operations = append(p.operations, state.TransactionalStateOperation{
+				Operation: state.Upsert,
+				Request:   *dapr.StateItem2SetRequest(convertStateToDaprPB(op.Request), key),
+			})
+		case state.Delete:
+			p.operations = append(p.operations, state.TransactionalStateOperation{
+				Operation: state.Delete,
+				Request:   *dapr.StateItem2DeleteRequest(convertStateToDaprPB(op.Request), key),
+			})
+		default:
+			return nil, messages.Errorf(codes.Unimplemented, messages.ErrNotSupportedStateOperation, op.OperationType)
+		}
+	}
+	return participants, nil
+}
+
+// prepareParticipant reads the original values of the keys and saves them as a compensation record.
+func (a *api) prepareParticipant(p *txParticipant) error {
+	visited := make(map[string]bool)
+	for _, op := range p.operations {
+		key := operationKey(op)
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+		resp, err := p.store.Get(&state.GetRequest{Key: key})
+		if err != nil {
+			return fmt.Errorf(messages.ErrStateGet, key, p.storeName, err.Error())
+		}
+		entry := &compensationEntry{Key: key}
+		if resp != nil && resp.Data != nil {
+			entry.Exists = true
+			entry.Value = resp.Data
+		}
+		p.record.Entries = append(p.record.Entries, entry)
+	}
+	data, err := a.json.Marshal(p.record)
+	if err != nil {
+		return fmt.Errorf(messages.ErrStateCompensationRecord, p.storeName, err.Error())
+	}
+	if err := p.store.Set(&state.SetRequest{Key: p.recordKey, Value: data}); err != nil {
+		return fmt.Errorf(messages.ErrStateCompensationRecord, p.storeName, err.Error())
+	}
+	return nil
+}
+
+// applyParticipant applies the operations in one transaction if the store supports it, otherwise one by one.
+func (a *api) applyParticipant(p *txParticipant, metadata map[string]string) error {
+	if txStore, ok := a.transactionalStateStores[p.storeName]; ok {
+		return txStore.Multi(&state.TransactionalStateRequest{
+			Operations: p.operations,
+			Metadata:   metadata,
+		})
+	}
+	for _, op := range p.operations {
+		var err error
+		switch req := op.Request.(type) {
+		case state.SetRequest:
+			err = p.store.Set(&req)
+		case state.DeleteRequest:
+			err = p.store.Delete(&req)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compensateParticipants restores the original values and returns the final status of the transaction.
+func (a *api) compensateParticipants(participants []*txParticipant) runtimev1pb.ExecuteMultiStoreStateTransactionResponse_TransactionStatus {
+	result := runtimev1pb.ExecuteMultiStoreStateTransactionResponse_ROLLED_BACK
+	for _, p := range participants {
+		if err := compensate(p); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] compensate store %s error: %v, compensation record %s is kept",
+				p.storeName, err, p.recordKey)
+			if p.result.Error == "" {
+				p.result.Error = err.Error()
+			} else {
+				p.result.Error = fmt.Sprintf("%s; compensation failed: %s", p.result.Error, err.Error())
+			}
+			result = runtimev1pb.ExecuteMultiStoreStateTransactionResponse_INCONSISTENT
+			continue
+		}
+		p.result.Compensated = true
+		a.removeCompensationRecords([]*txParticipant{p})
+	}
+	return result
+}
+
+func compensate(p *txParticipant) error {
+	for _, entry := range p.record.Entries {
+		var err error
+		if entry.Exists {
+			err = p.store.Set(&state.SetRequest{Key: entry.Key, Value: entry.Value})
+		} else {
+			err = p.store.Delete(&state.DeleteRequest{Key: entry.Key})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *api) removeCompensationRecords(participants []*txParticipant) {
+	for _, p := range participants {
+		if err := p.store.Delete(&state.DeleteRequest{Key: p.recordKey}); err != nil {
+			log.DefaultLogger.Warnf("[runtime] [grpc.ExecuteMultiStoreStateTransaction] fail to delete compensation record %s in store %s: %v",
+				p.recordKey, p.storeName, err)
+		}
+	}
+}
+
+func operationKey(op state.TransactionalStateOperation) string {
+	switch req := op.Request.(type) {
+	case state.SetRequest:
+		return req.Key
+	case state.DeleteRequest:
+		return req.Key
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+	state2 "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestExecuteMultiStoreStateTransaction(t *testing.T) {
+	t.Run("state store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.ExecuteMultiStoreStateTransactionRequest{}
+		_, err := api.ExecuteMultiStoreStateTransaction(context.Background(), req)
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = state store is not configured", err.Error())
+	})
+
+	t.Run("state store not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.ExecuteMultiStoreStateTransactionRequest{
+			Operations: []*runtimev1pb.MultiStoreStateOperation{
+				{
+					StoreName:     "abc",
+					OperationType: string(state.Upsert),
+					Request:       &runtimev1pb.StateItem{Key: "a"},
+				},
+			},
+		}
+		resp, err := api.ExecuteMultiStoreStateTransaction(context.Background(), req)
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = state store abc is not found", err.Error())
+		// the status isn't set if the transaction isn't executed
+		assert.Equal(t, runtimev1pb.ExecuteMultiStoreStateTransactionResponse_UNSPECIFIED, resp.Status)
+	})
+
+	t.Run("committed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		// store1 doesn't support transaction
+		store1 := mock_state.NewMockStore(ctrl)
+		store1.EXPECT().Features().Return(nil)
+		store1.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil)
+		store1.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+			if strings.HasPrefix(req.Key, state2.CompensationRecordKeyPrefix) {
+				return nil
+			}
+			assert.Equal(t, "a", req.Key)
+			assert.Equal(t, []byte("va"), req.Value)
+			return nil
+		}).Times(2)
+		store1.EXPECT().Delete(gomock.Any()).DoAndReturn(func(req *state.DeleteRequest) error {
+			assert.True(t, strings.HasPrefix(req.Key, state2.CompensationRecordKeyPrefix))
+			return nil
+		})
+		// store2 supports transaction
+		mockStore2 := mock_state.NewMockStore(ctrl)
+		mockStore2.EXPECT().Features().Return([]state.Feature{state.FeatureTransactional})
+		mockStore2.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("vb")}, nil)
+		mockStore2.EXPECT().Set(gomock.Any()).Return(nil)
+		mockStore2.EXPECT().Delete(gomock.Any()).Return(nil)
+		mockTxStore2 := mock_state.NewMockTransactionalStore(ctrl)
+		mockTxStore2.EXPECT().Multi(gomock.Any()).DoAndReturn(func(req *state.TransactionalStateRequest) error {
+			assert.Equal(t, 1, len(req.Operations))
+			assert.Equal(t, state.Delete, req.Operations[0].Operation)
+			assert.Equal(t, "mosn", req.Metadata["runtime"])
+			return nil
+		})
+		store2 := &MockTxStore{mockStore2, mockTxStore2}
+
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"store1": store1, "store2": store2}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.ExecuteMultiStoreStateTransactionRequest{
+			Operations: []*runtimev1pb.MultiStoreStateOperation{
+				{
+					StoreName:     "store1",
+					OperationType: string(state.Upsert),
+					Request:       &runtimev1pb.StateItem{Key: "a", Value: []byte("va")},
+				},
+				{
+					StoreName:     "store2",
+					OperationType: string(state.Delete),
+					Request:       &runtimev1pb.StateItem{Key: "b"},
+				},
+			},
+			Metadata: map[string]string{"runtime": "mosn"},
+		}
+		resp, err := api.ExecuteMultiStoreStateTransaction(context.Background(), req)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, resp.TransactionId)
+		assert.Equal(t, runtimev1pb.ExecuteMultiStoreStateTransactionResponse_COMMITTED, resp.Status)
+		assert.Equal(t, 2, len(resp.Results))
+		assert.Equal(t, "store1", resp.Results[0].StoreName)
+		assert.True(t, resp.Results[0].Applied)
+		assert.True(t, resp.Results[1].Applied)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		store1 := mock_state.NewMockStore(ctrl)
+		store1.EXPECT().Features().Return(nil)
+		store1.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("old")}, nil)
+		var restored []byte
+		store1.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+			if req.Key == "a" {
+				restored = req.Value.([]byte)
+			}
+			return nil
+		}).Times(3)
+		store1.EXPECT().Delete(gomock.Any()).Return(nil)
+
+		store2 := mock_state.NewMockStore(ctrl)
+		store2.EXPECT().Features().Return(nil)
+		store2.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil)
+		store2.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+			if strings.HasPrefix(req.Key, state2.CompensationRecordKeyPrefix) {
+				return nil
+			}
+			return fmt.Errorf("net error")
+		}).Times(2)
+		var deleted []string
+		store2.EXPECT().Delete(gomock.Any()).DoAndReturn(func(req *state.DeleteRequest) error {
+			deleted = append(deleted, req.Key)
+			return nil
+		}).Times(2)
+
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"store1": store1, "store2": store2}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.ExecuteMultiStoreStateTransactionRequest{
+			Operations: []*runtimev1pb.MultiStoreStateOperation{
+				{
+					StoreName:     "store1",
+					OperationType: string(state.Upsert),
+					Request:       &runtimev1pb.StateItem{Key: "a", Value: []byte("new")},
+				},
+				{
+					StoreName:     "store2",
+					OperationType: string(state.Upsert),
+					Request:       &runtimev1pb.StateItem{Key: "b", Value: []byte("new")},
+				},
+			},
+		}
+		resp, err := api.ExecuteMultiStoreStateTransaction(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.ExecuteMultiStoreStateTransactionResponse_ROLLED_BACK, resp.Status)
+		assert.Equal(t, []byte("old"), restored)
+		// key b didn't exist before, so it is deleted when compensating
+		assert.Equal(t, "b", deleted[0])
+		assert.True(t, resp.Results[0].Compensated)
+		assert.False(t, resp.Results[1].Applied)
+		assert.Equal(t, "net error", resp.Results[1].Error)
+	})
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// PauseSubscription stops delivering new events of the subscription and waits for the in-flight events.
+func (a *api) PauseSubscription(ctx context.Context, in *runtimev1pb.PauseSubscriptionRequest) (*emptypb.Empty, error) {
+	gate, err := a.getSubscriptionGate(in.PubsubName, in.Topic)
+	if err != nil {
+		return nil, err
+	}
+	log.DefaultLogger.Infof("[runtime] [grpc.PauseSubscription] pause the subscription to topic %s in pubsub %s", in.Topic, in.PubsubName)
+	if err := gate.Pause(ctx); err != nil {
+		// the subscription keeps paused
+		return nil, messages.Errorf(codes.DeadlineExceeded, messages.ErrSubscriptionDrain, in.Topic, in.PubsubName, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ResumeSubscription restarts delivering the events of the subscription.
+func (a *api) ResumeSubscription(ctx context.Context, in *runtimev1pb.ResumeSubscriptionRequest) (*emptypb.Empty, error) {
+	gate, err := a.getSubscriptionGate(in.PubsubName, in.Topic)
+	if err != nil {
+		return nil, err
+	}
+	log.DefaultLogger.Infof("[runtime] [grpc.ResumeSubscription] resume the subscription to topic %s in pubsub %s", in.Topic, in.PubsubName)
+	gate.Resume()
+	return &emptypb.Empty{}, nil
+}
+
+// GetMetadata returns the app id and the state of subscriptions.
+func (a *api) GetMetadata(ctx context.Context, in *runtimev1pb.GetMetadataRequest) (*runtimev1pb.GetMetadataResponse, error) {
+	resp := &runtimev1pb.GetMetadataResponse{Id: a.appId}
+	a.subscriptionGatesLock.RLock()
+	for pubsubName, topics := range a.subscriptionGates {
+		for topic, gate := range topics {
+			paused, inFlight := gate.State()
+			sm := &runtimev1pb.SubscriptionMetadata{
+				PubsubName: pubsubName,
+				Topic:      topic,
+				Paused:     paused,
+				InFlight:   inFlight,
+			}
+			if d, ok := runtime_pubsub.Unwrap(a.pubSubs[pubsubName]).(runtime_pubsub.SubscriptionDescriber); ok {
+				sm.Metadata = d.DescribeSubscription(topic)
+			}
+			resp.Subscriptions = append(resp.Subscriptions, sm)
+		}
+	}
+	a.subscriptionGatesLock.RUnlock()
+	sort.Slice(resp.Subscriptions, func(i, j int) bool {
+		if resp.Subscriptions[i].PubsubName != resp.Subscriptions[j].PubsubName {
+			return resp.Subscriptions[i].PubsubName < resp.Subscriptions[j].PubsubName
+		}
+		return resp.Subscriptions[i].Topic < resp.Subscriptions[j].Topic
+	})
+	for name := range a.pubSubs {
+		c := runtime_pubsub.CapabilitiesOf(name, a.pubSubs[name])
+		_, replay := runtime_pubsub.AsReplayer(a.pubSubs[name])
+		resp.PubSubs = append(resp.PubSubs, &runtimev1pb.PubSubMetadata{
+			Name:         name,
+			PartitionKey: len(c.PartitionKeyMetadata) > 0,
+			// the values of Ordering are the same as the proto
+			Ordering: runtimev1pb.PubSubMetadata_Ordering(c.Ordering),
+			Replay:   replay,
+		})
+	}
+	sort.Slice(resp.PubSubs, func(i, j int) bool {
+		return resp.PubSubs[i].Name < resp.PubSubs[j].Name
+	})
+	for name, store := range a.configStores {
+		state := configstores.ConnectionStateOf(store)
+		configstores.RecordConnectionState(name, state)
+		stats := configstores.PushStatsOf(name)
+		resp.ConfigStores = append(resp.ConfigStores, &runtimev1pb.ConfigStoreMetadata{
+			Name:              name,
+			ConnectionState:   string(state),
+			Pushed:            stats.Pushed,
+			PushErrors:        stats.Errors,
+			SubscriptionLagMs: stats.Lag.Milliseconds(),
+		})
+	}
+	sort.Slice(resp.ConfigStores, func(i, j int) bool {
+		return resp.ConfigStores[i].Name < resp.ConfigStores[j].Name
+	})
+	return resp, nil
+}
+
+// ReplayMessages delivers the messages in the range to the app again.
+// The subscription must exist, and the messages wait if it's paused.
+func (a *api) ReplayMessages(ctx context.Context, in *runtimev1pb.ReplayMessagesRequest) (*runtimev1pb.ReplayMessagesResponse, error) {
+	// 1. validate
+	gate, err := a.getSubscriptionGate(in.PubsubName, in.Topic)
+	if err != nil {
+		return nil, err
+	}
+	pubsubName := alias.Resolve(alias.PubSub, in.PubsubName)
+	replayer, ok := runtime_pubsub.AsReplayer(a.pubSubs[pubsubName])
+	if !ok {
+		return nil, messages.Errorf(codes.Unimplemented, messages.ErrPubsubReplayNotSupported, pubsubName)
+	}
+	req := &runtime_pubsub.ReplayRequest{
+		Topic:       in.Topic,
+		Partition:   in.Partition,
+		StartOffset: in.StartOffset,
+		EndOffset:   in.EndOffset,
+		Metadata:    in.Metadata,
+	}
+	if in.StartTime > 0 {
+		req.StartTime = time.Unix(0, in.StartTime*int64(time.Millisecond))
+		req.EndTime = time.Now()
+		if in.EndTime > 0 {
+			req.EndTime = time.Unix(0, in.EndTime*int64(time.Millisecond))
+		}
+		if !req.EndTime.After(req.StartTime) {
+			return nil, messages.Error(codes.InvalidArgument, messages.ErrPubsubReplayRange)
+		}
+	} else if in.StartOffset < 0 || in.EndOffset <= in.StartOffset {
+		return nil, messages.Error(codes.InvalidArgument, messages.ErrPubsubReplayRange)
+	}
+	// 2. replay
+	log.DefaultLogger.Infof("[runtime] [grpc.ReplayMessages] replay topic %s in pubsub %s", in.Topic, pubsubName)
+	count, err := replayer.Replay(ctx, req, a.topicEventHandler(pubsubName, gate))
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.ReplayMessages] replay topic %s in pubsub %s error: %v", in.Topic, pubsubName, err)
+		return nil, messages.Errorf(codes.Internal, messages.ErrPubsubReplay, in.Topic, pubsubName, count, err.Error())
+	}
+	return &runtimev1pb.ReplayMessagesResponse{Count: count}, nil
+}
+
+func (a *api) addSubscriptionGate(pubsubName string, topic string) *runtime_pubsub.Gate {
+	a.subscriptionGatesLock.Lock()
+	defer a.subscriptionGatesLock.Unlock()
+	if a.subscriptionGates == nil {
+		a.subscriptionGates = make(map[string]map[string]*runtime_pubsub.Gate)
+	}
+	if _, ok := a.subscriptionGates[pubsubName]; !ok {
+		a.subscriptionGates[pubsubName] = make(map[string]*runtime_pubsub.Gate)
+	}
+	gate := runtime_pubsub.NewGate()
+	a.subscriptionGates[pubsubName][topic] = gate
+	return gate
+}
+
+func (a *api) getSubscriptionGate(pubsubName string, topic string) (*runtime_pubsub.Gate, error) {
+	pubsubName = alias.Resolve(alias.PubSub, pubsubName)
+	if pubsubName == "" {
+		return nil, messages.Error(codes.InvalidArgument, messages.ErrPubsubEmpty)
+	}
+	if topic == "" {
+		return nil, messages.Errorf(codes.InvalidArgument, messages.ErrTopicEmpty, pubsubName)
+	}
+	a.subscriptionGatesLock.RLock()
+	defer a.subscriptionGatesLock.RUnlock()
+	gate, ok := a.subscriptionGates[pubsubName][topic]
+	if !ok {
+		return nil, messages.Errorf(codes.NotFound, messages.ErrSubscriptionNotFound, topic, pubsubName)
+	}
+	return gate, nil
+}
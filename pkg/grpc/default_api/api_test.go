@@ -31,20 +31,24 @@ import (
 	"github.com/stretchr/testify/assert"
 	rawGRPC "google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/test/bufconn"
 	l8grpc "mosn.io/layotto/pkg/grpc"
 	"net"
+	"strconv"
 	"testing"
 
 	"errors"
 	jsoniter "github.com/json-iterator/go"
 	"google.golang.org/grpc/status"
 	"io"
+	"io/ioutil"
 	"mosn.io/layotto/components/configstores"
 	"mosn.io/layotto/components/hello"
 	"mosn.io/layotto/components/lock"
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/pkg/messages"
 	"mosn.io/layotto/pkg/mock"
 	mock_invoker "mosn.io/layotto/pkg/mock/components/invoker"
 	mock_lock "mosn.io/layotto/pkg/mock/components/lock"
@@ -52,6 +56,11 @@ import (
 	mock_sequencer "mosn.io/layotto/pkg/mock/components/sequencer"
 	mock_state "mosn.io/layotto/pkg/mock/components/state"
 	mock_appcallback "mosn.io/layotto/pkg/mock/runtime/appcallback"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+	runtime_sequencer "mosn.io/layotto/pkg/runtime/sequencer"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
 	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 
 	"time"
@@ -194,6 +203,49 @@ func TestMosnRuntime_publishMessageGRPC(t *testing.T) {
 		err = apiForTest.publishMessageGRPC(context.Background(), msg)
 		assert.Nil(t, err)
 	})
+
+	t.Run("publish protobuf cloud event", func(t *testing.T) {
+		// init grpc server
+		mockAppCallbackServer := mock_appcallback.NewMockAppCallbackServer(gomock.NewController(t))
+		mockAppCallbackServer.EXPECT().OnTopicEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, req *runtimev1pb.TopicEventRequest) (*runtimev1pb.TopicEventResponse, error) {
+				assert.Equal(t, "id", req.Id)
+				assert.Equal(t, "application/x-protobuf", req.DataContentType)
+				assert.Equal(t, []byte{0x08, 0x96, 0x01}, req.Data)
+				return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}, nil
+			})
+
+		lis := bufconn.Listen(1024 * 1024)
+		s := grpc.NewServer()
+		runtimev1pb.RegisterAppCallbackServer(s, mockAppCallbackServer)
+		go func() {
+			s.Serve(lis)
+		}()
+
+		// init callback client
+		callbackClient, err := grpc.DialContext(context.Background(), "bufnet", rawGRPC.WithInsecure(), rawGRPC.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.Dial()
+		}))
+		assert.Nil(t, err)
+
+		data := runtime_pubsub.MarshalProtoCloudEvent(&runtime_pubsub.CloudEvent{
+			ID:              "id",
+			Source:          "source",
+			Type:            "type",
+			DataContentType: "application/x-protobuf",
+			Data:            []byte{0x08, 0x96, 0x01},
+		}, nil, nil)
+		msg := &pubsub.NewMessage{
+			Data:     data,
+			Topic:    "layotto",
+			Metadata: make(map[string]string),
+		}
+		a := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		var apiForTest = a.(*api)
+		apiForTest.AppCallbackConn = callbackClient
+		err = apiForTest.publishMessageGRPC(context.Background(), msg)
+		assert.Nil(t, err)
+	})
 }
 
 func startTestRuntimeAPIServer(port int, testAPIServer API) *grpc.Server {
@@ -225,8 +277,33 @@ func TestGetConfiguration(t *testing.T) {
 	assert.Equal(t, res.Items[0].Key, "sofa")
 	assert.Equal(t, res.Items[0].Content, "sofa1")
 	_, err = api.GetConfiguration(context.Background(), &runtimev1pb.GetConfigurationRequest{StoreName: "etcd", AppId: "mosn", Keys: []string{"sofa"}})
-	assert.Equal(t, err.Error(), "configure store [etcd] don't support now")
+	assert.Equal(t, status.Convert(err).Message(), "configure store [etcd] don't support now")
+	assert.Equal(t, runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
+
+	// the runtime filters items if the store can't do it
+	mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+		assert.Equal(t, "db.*", req.KeyPattern)
+		return []*configstores.ConfigurationItem{
+			{Key: "db.url", Tags: map[string]string{"env": "prod"}},
+			{Key: "db.port"},
+			{Key: "cache.url", Tags: map[string]string{"env": "prod"}},
+		}, nil
+	})
+	res, err = api.GetConfiguration(context.Background(), &runtimev1pb.GetConfigurationRequest{StoreName: "mock", AppId: "mosn", KeyPattern: "db.*", Tags: map[string]string{"env": "prod"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Items))
+	assert.Equal(t, "db.url", res.Items[0].Key)
 
+	// the items in gray release are only returned to the matching sidecars
+	mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]*configstores.ConfigurationItem{
+		{Key: "stable"},
+		{Key: "canary", Tags: map[string]string{configstores.GrayIPsKey: "10.0.0.2"}},
+	}, nil)
+	res, err = api.GetConfiguration(context.Background(), &runtimev1pb.GetConfigurationRequest{StoreName: "mock", AppId: "mosn",
+		Metadata: map[string]string{configstores.ClientIPKey: "10.0.0.1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Items))
+	assert.Equal(t, "stable", res.Items[0].Key)
 }
 
 func TestSaveConfiguration(t *testing.T) {
@@ -264,9 +341,35 @@ func TestSaveConfiguration(t *testing.T) {
 		mockConfigStore := mock.NewMockStore(ctrl)
 		api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
 		_, err := api.SaveConfiguration(context.Background(), &runtimev1pb.SaveConfigurationRequest{StoreName: "etcd"})
-		assert.Equal(t, err.Error(), "configure store [etcd] don't support now")
+		assert.Equal(t, status.Convert(err).Message(), "configure store [etcd] don't support now")
+		assert.Equal(t, runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
 	})
 
+	t.Run("atomic", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockConfigStore := mock.NewMockStore(ctrl)
+		mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, nil)
+		mockConfigStore.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("net error"))
+		mockConfigStore.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *configstores.DeleteRequest) error {
+			assert.Equal(t, []string{"key"}, req.Keys)
+			return nil
+		})
+		api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.SaveConfigurationRequest{
+			StoreName: "mock",
+			AppId:     "appid",
+			Items:     []*runtimev1pb.ConfigurationItem{{Key: "key", Content: "value"}},
+			Atomic:    true,
+		}
+		_, err := api.SaveConfiguration(context.Background(), req)
+		assert.Equal(t, codes.Aborted, status.Code(err))
+
+		mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, nil)
+		mockConfigStore.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+		resp, err := api.SaveConfiguration(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.SaveConfigurationResponse_EMULATED, resp.Atomicity)
+	})
 }
 
 func TestDeleteConfiguration(t *testing.T) {
@@ -295,7 +398,8 @@ func TestDeleteConfiguration(t *testing.T) {
 		mockConfigStore := mock.NewMockStore(ctrl)
 		api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
 		_, err := api.DeleteConfiguration(context.Background(), &runtimev1pb.DeleteConfigurationRequest{StoreName: "etcd"})
-		assert.Equal(t, err.Error(), "configure store [etcd] don't support now")
+		assert.Equal(t, status.Convert(err).Message(), "configure store [etcd] don't support now")
+		assert.Equal(t, runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
 	})
 
 }
@@ -311,7 +415,8 @@ func TestSubscribeConfiguration(t *testing.T) {
 	grpcServer := &MockGrpcServer{req: &runtimev1pb.SubscribeConfigurationRequest{}, err: nil}
 	err := api.SubscribeConfiguration(grpcServer)
 	assert.NotNil(t, err)
-	assert.Equal(t, err.Error(), "configure store [] don't support now")
+	assert.Equal(t, status.Convert(err).Message(), "configure store [] don't support now")
+	assert.Equal(t, runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND, messages.ErrorCodeOf(err))
 
 	//test
 	grpcServer2 := &MockGrpcServer{req: &runtimev1pb.SubscribeConfigurationRequest{}, err: errors.New("exit")}
@@ -320,6 +425,143 @@ func TestSubscribeConfiguration(t *testing.T) {
 	assert.Equal(t, err.Error(), "exit")
 }
 
+type mockSubscribeConfigurationServer struct {
+	reqs    chan *runtimev1pb.SubscribeConfigurationRequest
+	sent    chan *runtimev1pb.SubscribeConfigurationResponse
+	sendErr error
+	grpc.ServerStream
+}
+
+func (m *mockSubscribeConfigurationServer) Send(res *runtimev1pb.SubscribeConfigurationResponse) error {
+	if m.sendErr != nil {
+		return m.sendErr
+	}
+	m.sent <- res
+	return nil
+}
+
+func (m *mockSubscribeConfigurationServer) Recv() (*runtimev1pb.SubscribeConfigurationRequest, error) {
+	req, ok := <-m.reqs
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func TestSubscribeConfigurationSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConfigStore := mock.NewMockStore(ctrl)
+	var updateCh chan *configstores.SubscribeResp
+	mockConfigStore.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
+		updateCh = ch
+		return nil
+	})
+	mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]*configstores.ConfigurationItem{{Key: "a", Content: "v1"}}, nil)
+	mockConfigStore.EXPECT().StopSubscribe()
+	api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	srv := &mockSubscribeConfigurationServer{
+		reqs: make(chan *runtimev1pb.SubscribeConfigurationRequest, 1),
+		sent: make(chan *runtimev1pb.SubscribeConfigurationResponse),
+	}
+	srv.reqs <- &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", Keys: []string{"a"}, Metadata: map[string]string{configstores.ClientIPKey: "10.0.0.1"}}
+	errCh := make(chan error)
+	go func() {
+		errCh <- api.SubscribeConfiguration(srv)
+	}()
+
+	// the first response is the snapshot
+	resp := <-srv.sent
+	assert.Equal(t, runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT, resp.Type)
+	assert.Equal(t, "v1", resp.Items[0].Content)
+	// then the updates, in which the ones not targeting this sidecar are skipped
+	updateCh <- &configstores.SubscribeResp{StoreName: "mock", Items: []*configstores.ConfigurationItem{{Key: "a", Content: "gray", Metadata: map[string]string{configstores.GrayIPsKey: "10.0.0.2"}}}}
+	// the responses carry the name of the store subscribed, whatever the component names itself
+	updateCh <- &configstores.SubscribeResp{StoreName: "etcd", Items: []*configstores.ConfigurationItem{{Key: "a", Deleted: true}}}
+	resp = <-srv.sent
+	assert.Equal(t, runtimev1pb.SubscribeConfigurationResponse_INCREMENTAL, resp.Type)
+	assert.True(t, resp.Items[0].Deleted)
+	assert.Equal(t, "mock", resp.StoreName)
+
+	close(srv.reqs)
+	assert.Equal(t, io.EOF, <-errCh)
+}
+
+func TestSubscribeConfigurationSnapshotFirst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConfigStore := mock.NewMockStore(ctrl)
+	// the component sends an update at once, before the snapshot is queried
+	mockConfigStore.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req *configstores.SubscribeReq, ch chan *configstores.SubscribeResp) error {
+		go func() {
+			ch <- &configstores.SubscribeResp{StoreName: "mock", Items: []*configstores.ConfigurationItem{{Key: "a", Content: "v2"}}}
+		}()
+		return nil
+	})
+	mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+		time.Sleep(50 * time.Millisecond)
+		return []*configstores.ConfigurationItem{{Key: "a", Content: "v1"}}, nil
+	})
+	mockConfigStore.EXPECT().StopSubscribe()
+	api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	srv := &mockSubscribeConfigurationServer{
+		reqs: make(chan *runtimev1pb.SubscribeConfigurationRequest, 1),
+		sent: make(chan *runtimev1pb.SubscribeConfigurationResponse),
+	}
+	srv.reqs <- &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", Keys: []string{"a"}}
+	errCh := make(chan error)
+	go func() {
+		errCh <- api.SubscribeConfiguration(srv)
+	}()
+
+	resp := <-srv.sent
+	assert.Equal(t, runtimev1pb.SubscribeConfigurationResponse_SNAPSHOT, resp.Type)
+	assert.Equal(t, "v1", resp.Items[0].Content)
+	resp = <-srv.sent
+	assert.Equal(t, runtimev1pb.SubscribeConfigurationResponse_INCREMENTAL, resp.Type)
+	assert.Equal(t, "v2", resp.Items[0].Content)
+
+	close(srv.reqs)
+	assert.Equal(t, io.EOF, <-errCh)
+}
+
+func TestSubscribeConfigurationSendError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConfigStore := mock.NewMockStore(ctrl)
+	mockConfigStore.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return(nil)
+	mockConfigStore.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]*configstores.ConfigurationItem{{Key: "a", Content: "v1"}}, nil)
+	stopped := make(chan struct{})
+	mockConfigStore.EXPECT().StopSubscribe().Do(func() { close(stopped) })
+	api := NewAPI("", nil, map[string]configstores.Store{"mock": mockConfigStore}, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	srv := &mockSubscribeConfigurationServer{
+		reqs:    make(chan *runtimev1pb.SubscribeConfigurationRequest, 1),
+		sendErr: errors.New("broken"),
+	}
+	srv.reqs <- &runtimev1pb.SubscribeConfigurationRequest{StoreName: "mock", Keys: []string{"a"}}
+	errCh := make(chan error)
+	go func() {
+		errCh <- api.SubscribeConfiguration(srv)
+	}()
+
+	// the handler returns while the reader is still blocked in Recv
+	select {
+	case err := <-errCh:
+		assert.Equal(t, srv.sendErr, err)
+	case <-time.After(time.Second):
+		t.Fatal("the handler doesn't exit after the send error")
+	}
+	// the reader stops the subscribers once the stream is canceled
+	close(srv.reqs)
+	<-stopped
+}
+
 type MockInvoker struct {
 	tmock.Mock
 }
@@ -422,6 +664,29 @@ func TestPublishEvent(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("publish with partition key", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockPubSub := mock_pubsub.NewMockPubSub(ctrl)
+		mockPubSub.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			assert.Equal(t, "order-1", req.Metadata["partitionKey"])
+			assert.Equal(t, "order-1", req.Metadata["key"])
+			assert.Equal(t, "v", req.Metadata["k"])
+			return nil
+		})
+		mockPubSub.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"pulsar": mockPubSub}, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.PublishEventRequest{
+			PubsubName:   "pulsar",
+			Topic:        "abc",
+			Metadata:     map[string]string{"k": "v"},
+			PartitionKey: "order-1",
+		}
+		_, err := api.PublishEvent(context.Background(), req)
+		assert.Nil(t, err)
+		// the metadata of the request isn't modified
+		assert.Len(t, req.Metadata, 1)
+	})
+
 	t.Run("publish net error", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		mockPubSub := mock_pubsub.NewMockPubSub(ctrl)
@@ -436,6 +701,49 @@ func TestPublishEvent(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Equal(t, "rpc error: code = Internal desc = error when publish to topic abc in pubsub mock: net error", err.Error())
 	})
+
+	t.Run("async publishing is not enabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockPubSub := mock_pubsub.NewMockPubSub(ctrl)
+		mockPubSub.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"mock": mockPubSub}, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.PublishEventRequest{
+			PubsubName: "mock",
+			Topic:      "abc",
+			Async:      true,
+		}
+		_, err := api.PublishEvent(context.Background(), req)
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = async publishing is not enabled in pubsub mock", err.Error())
+	})
+
+	t.Run("publish async and flush", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockPubSub := mock_pubsub.NewMockPubSub(ctrl)
+		mockPubSub.EXPECT().Publish(gomock.Any()).Return(nil)
+		mockPubSub.EXPECT().Features().Return(nil)
+		asyncPubSub := runtime_pubsub.NewAsyncPubSub(mockPubSub, nil)
+		api := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"mock": asyncPubSub}, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.PublishEventRequest{
+			PubsubName: "mock",
+			Topic:      "abc",
+			Async:      true,
+		}
+		_, err := api.PublishEvent(context.Background(), req)
+		assert.Nil(t, err)
+		resp, err := api.Flush(context.Background(), &runtimev1pb.FlushRequest{PubsubName: "mock"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), resp.Failed)
+	})
+}
+
+func TestFlush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockPubSub := mock_pubsub.NewMockPubSub(ctrl)
+	api := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"mock": mockPubSub}, nil, nil, nil, nil, nil, nil)
+	_, err := api.Flush(context.Background(), &runtimev1pb.FlushRequest{PubsubName: "abc"})
+	assert.Equal(t, "rpc error: code = InvalidArgument desc = pubsub abc not found", err.Error())
+	_, err = api.Flush(context.Background(), &runtimev1pb.FlushRequest{PubsubName: "mock"})
+	assert.Equal(t, "rpc error: code = FailedPrecondition desc = async publishing is not enabled in pubsub mock", err.Error())
 }
 
 func TestGetBulkState(t *testing.T) {
@@ -514,6 +822,28 @@ func TestGetBulkState(t *testing.T) {
 		assert.Equal(t, 2, len(rsp.GetItems()))
 	})
 
+	t.Run("content type mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		compResp := []state.BulkGetResponse{
+			{Key: "json", Data: []byte(`{"a":1}`)},
+			{Key: "text", Data: []byte("mock data")},
+		}
+		mockStore.EXPECT().BulkGet(gomock.Any()).Return(true, compResp, nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.GetBulkStateRequest{
+			StoreName: "mock",
+			Keys:      []string{"json", "text"},
+			Metadata:  map[string]string{runtime_state.ContentTypeMetadataKey: "application/json"},
+		}
+		rsp, err := api.GetBulkState(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(`{"a":1}`), rsp.Items[0].Data)
+		assert.Empty(t, rsp.Items[0].Error)
+		assert.Nil(t, rsp.Items[1].Data)
+		assert.NotEmpty(t, rsp.Items[1].Error)
+	})
 }
 
 func TestGetState(t *testing.T) {
@@ -585,6 +915,27 @@ func TestGetState(t *testing.T) {
 		assert.Equal(t, []byte("mock data"), rsp.GetData())
 	})
 
+	t.Run("content type mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{
+			Data:     []byte("mock data"),
+			Metadata: map[string]string{runtime_state.ContentTypeMetadataKey: "text/plain"},
+		}, nil).Times(2)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.GetStateRequest{
+			StoreName: "mock",
+			Key:       "mykey",
+			Metadata:  map[string]string{runtime_state.ContentTypeMetadataKey: "text/plain; charset=utf-8"},
+		}
+		_, err := api.GetState(context.Background(), req)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		req.Metadata[runtime_state.ContentTypeMetadataKey] = "text/plain"
+		rsp, err := api.GetState(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, "text/plain", rsp.Metadata[runtime_state.ContentTypeMetadataKey])
+	})
 }
 
 func TestSaveState(t *testing.T) {
@@ -631,6 +982,46 @@ func TestSaveState(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Equal(t, "rpc error: code = Internal desc = failed saving state in state store mock: net error", err.Error())
 	})
+
+	t.Run("content type invalid", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		store := runtime_state.NewTypedStore(mockStore, &runtime_state.TypedValuesConfig{})
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": store}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.SaveStateRequest{
+			StoreName: "mock",
+			States: []*runtimev1pb.StateItem{
+				{
+					Key:      "abc",
+					Value:    []byte("mock data"),
+					Metadata: map[string]string{runtime_state.ContentTypeMetadataKey: "application/json"},
+				},
+			},
+		}
+		_, err := api.SaveState(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, runtimev1pb.ErrorCode_STATE_CONTENT_TYPE_INVALID, messages.ErrorCodeOf(err))
+	})
+
+	t.Run("ttl invalid", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.SaveStateRequest{
+			StoreName: "mock",
+			States: []*runtimev1pb.StateItem{
+				{
+					Key:      "abc",
+					Value:    []byte("mock data"),
+					Metadata: map[string]string{runtime_state.TTLMetadataKey: "0"},
+				},
+			},
+		}
+		_, err := api.SaveState(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
 }
 
 func TestDeleteState(t *testing.T) {
@@ -709,6 +1100,66 @@ func TestDeleteBulkState(t *testing.T) {
 	})
 }
 
+type mockQueryStore struct {
+	state.Store
+	query func(req *state.QueryRequest) (*state.QueryResponse, error)
+}
+
+func (m *mockQueryStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return m.query(req)
+}
+
+func TestQueryState(t *testing.T) {
+	t.Run("query not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil).AnyTimes()
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.QueryState(context.Background(), &runtimev1pb.QueryStateRequest{StoreName: "mock", Query: `{}`})
+		assert.Equal(t, "rpc error: code = Unimplemented desc = state store mock doesn't support query", err.Error())
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil).AnyTimes()
+		store := &mockQueryStore{Store: mockStore}
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": store}, nil, nil, nil, nil, nil)
+		_, err := api.QueryState(context.Background(), &runtimev1pb.QueryStateRequest{StoreName: "mock", Query: `{"filter":`})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil).AnyTimes()
+		etag := "3"
+		store := &mockQueryStore{Store: mockStore, query: func(req *state.QueryRequest) (*state.QueryResponse, error) {
+			assert.Equal(t, "v", req.Metadata["k"])
+			return &state.QueryResponse{
+				Results: []state.QueryItem{
+					{Key: "app||order-1", Data: []byte(`{"city":"Hangzhou"}`), ETag: &etag},
+					{Key: "app||order-2", Error: "malformed"},
+				},
+				Token: "next",
+			}, nil
+		}}
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": store}, nil, nil, nil, nil, nil)
+		resp, err := api.QueryState(context.Background(), &runtimev1pb.QueryStateRequest{
+			StoreName: "mock",
+			Query:     `{"filter": {"EQ": {"city": "Hangzhou"}}, "page": {"limit": 2}}`,
+			Metadata:  map[string]string{"k": "v"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "next", resp.Token)
+		assert.Len(t, resp.Results, 2)
+		assert.Equal(t, "order-1", resp.Results[0].Key)
+		assert.Equal(t, `{"city":"Hangzhou"}`, string(resp.Results[0].Data))
+		assert.Equal(t, "3", resp.Results[0].Etag)
+		assert.Equal(t, "malformed", resp.Results[1].Error)
+	})
+}
+
 type MockTxStore struct {
 	state.Store
 	state.TransactionalStore
@@ -829,34 +1280,343 @@ func TestExecuteStateTransaction(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Equal(t, "rpc error: code = Internal desc = error while executing state transaction: net error", err.Error())
 	})
-}
 
-func TestTryLock(t *testing.T) {
-	t.Run("lock store not configured", func(t *testing.T) {
-		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
-		req := &runtimev1pb.TryLockRequest{
-			StoreName: "abc",
-		}
-		_, err := api.TryLock(context.Background(), req)
-		assert.Equal(t, "rpc error: code = FailedPrecondition desc = lock store is not configured", err.Error())
-	})
+	t.Run("outbox", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureTransactional}).Times(2)
+		mockTxStore := mock_state.NewMockTransactionalStore(ctrl)
+		mockTxStore.EXPECT().Multi(gomock.Any()).DoAndReturn(func(req *state.TransactionalStateRequest) error {
+			msgs, err := runtime_state.OutboxFromMetadata(req.Metadata)
+			assert.Nil(t, err)
+			assert.Len(t, msgs, 1)
+			assert.Equal(t, "orders", msgs[0].Topic)
+			assert.Equal(t, "mosn", req.Metadata["runtime"])
+			return nil
+		})
+		pubSubs := map[string]pubsub.PubSub{"mq": mock_pubsub.NewMockPubSub(ctrl)}
+		api := NewAPI("", nil, nil, nil, pubSubs, map[string]state.Store{
+			"mock":   &MockTxStore{mockStore, mockTxStore},
+			"outbox": &outboxTxStore{MockTxStore: &MockTxStore{mockStore, mockTxStore}},
+		}, nil, nil, nil, nil, nil)
 
-	t.Run("resourceid empty", func(t *testing.T) {
-		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
-		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
-		req := &runtimev1pb.TryLockRequest{
-			StoreName: "abc",
+		req := &runtimev1pb.ExecuteStateTransactionRequest{
+			StoreName: "mock",
+			Outbox:    []*runtimev1pb.OutboxMessage{{PubsubName: "mq", Topic: "orders"}},
 		}
-		_, err := api.TryLock(context.Background(), req)
-		assert.Equal(t, "rpc error: code = InvalidArgument desc = ResourceId is empty in lock store abc", err.Error())
+		_, err := api.ExecuteStateTransaction(context.Background(), req)
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+		req.StoreName = "outbox"
+		req.Outbox[0].PubsubName = "absent"
+		_, err = api.ExecuteStateTransaction(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		req.Outbox[0].PubsubName = "mq"
+		req.Metadata = map[string]string{"runtime": "mosn", runtime_state.OutboxMetadataKey: "forged"}
+		_, err = api.ExecuteStateTransaction(context.Background(), req)
+		assert.Nil(t, err)
 	})
+}
 
-	t.Run("lock owner empty", func(t *testing.T) {
-		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
-		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
-		req := &runtimev1pb.TryLockRequest{
-			StoreName:  "abc",
-			ResourceId: "resource",
+// outboxTxStore saves the messages of the transactions in the outbox
+type outboxTxStore struct {
+	*MockTxStore
+}
+
+func (s *outboxTxStore) MultiWithOutbox(req *state.TransactionalStateRequest, messages []*runtime_state.OutboxMessage) error {
+	return s.Multi(req)
+}
+
+func (s *outboxTxStore) ClaimOutbox(owner string, limit int, lease time.Duration) ([]*runtime_state.OutboxMessage, error) {
+	return nil, nil
+}
+
+func (s *outboxTxStore) DeleteOutbox(owner string, ids []int64) error {
+	return nil
+}
+
+func (s *outboxTxStore) FailOutbox(owner string, id int64, deadLetter bool) error {
+	return nil
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	t.Run("state store not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{
+			StoreName: "abc",
+		}
+		_, err := api.CompareAndSwap(context.Background(), req)
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = state store abc is not found", err.Error())
+	})
+
+	t.Run("etag not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil).Times(2)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{
+			StoreName: "mock",
+			Key:       "abc",
+		}
+		_, err := api.CompareAndSwap(context.Background(), req)
+		assert.Equal(t, "rpc error: code = Unimplemented desc = state store mock doesn't support etag", err.Error())
+	})
+
+	t.Run("value not match", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(2)
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("other"), ETag: &etag}, nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{
+			StoreName:     "mock",
+			Key:           "abc",
+			ExpectedValue: []byte("old"),
+			NewValue:      []byte("new"),
+		}
+		resp, err := api.CompareAndSwap(context.Background(), req)
+		assert.Nil(t, err)
+		assert.False(t, resp.Succeeded)
+		assert.Equal(t, []byte("other"), resp.Value)
+		assert.Equal(t, "1", resp.Etag)
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(2)
+		etag, newEtag := "1", "2"
+		gomock.InOrder(
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("old"), ETag: &etag}, nil),
+			mockStore.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+				assert.Equal(t, "abc", req.Key)
+				assert.Equal(t, []byte("new"), req.Value)
+				assert.Equal(t, "1", *req.ETag)
+				assert.Equal(t, state.FirstWrite, req.Options.Concurrency)
+				return nil
+			}),
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("new"), ETag: &newEtag}, nil),
+		)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{
+			StoreName:     "mock",
+			Key:           "abc",
+			ExpectedValue: []byte("old"),
+			NewValue:      []byte("new"),
+		}
+		resp, err := api.CompareAndSwap(context.Background(), req)
+		assert.Nil(t, err)
+		assert.True(t, resp.Succeeded)
+		assert.Equal(t, []byte("new"), resp.Value)
+		assert.Equal(t, "2", resp.Etag)
+	})
+
+	t.Run("etag mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(2)
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{ETag: &etag}, nil)
+		mockStore.EXPECT().Set(gomock.Any()).Return(state.NewETagError(state.ETagMismatch, nil))
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{
+			StoreName: "mock",
+			Key:       "abc",
+			NewValue:  []byte("new"),
+		}
+		resp, err := api.CompareAndSwap(context.Background(), req)
+		assert.Nil(t, err)
+		assert.False(t, resp.Succeeded)
+	})
+
+	t.Run("absent key without expect_absent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(2)
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		resp, err := api.CompareAndSwap(context.Background(), &runtimev1pb.CompareAndSwapRequest{StoreName: "mock", Key: "abc", NewValue: []byte("new")})
+		assert.Nil(t, err)
+		assert.False(t, resp.Succeeded)
+	})
+
+	t.Run("expect absent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(5)
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("new"), ETag: &etag}, nil).Times(2)
+		store := &idempotencyRecorderStore{Store: mockStore, markers: map[string][]byte{}}
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": store}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CompareAndSwapRequest{StoreName: "mock", Key: "abc", NewValue: []byte("new"), ExpectAbsent: true}
+		resp, err := api.CompareAndSwap(context.Background(), req)
+		assert.Nil(t, err)
+		assert.True(t, resp.Succeeded)
+		assert.Equal(t, "1", resp.Etag)
+		// created already
+		req.NewValue = []byte("newer")
+		resp, err = api.CompareAndSwap(context.Background(), req)
+		assert.Nil(t, err)
+		assert.False(t, resp.Succeeded)
+		assert.Equal(t, []byte("new"), resp.Value)
+		assert.Equal(t, "1", resp.Etag)
+
+		// not supported without set-if-absent
+		api = NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err = api.CompareAndSwap(context.Background(), req)
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
+
+func TestIncrement(t *testing.T) {
+	t.Run("state store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.Increment(context.Background(), &runtimev1pb.IncrementRequest{StoreName: "abc", Key: "a"})
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = state store is not configured", err.Error())
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil).Times(2)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.Increment(context.Background(), &runtimev1pb.IncrementRequest{StoreName: "mock", Key: "a"})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag}).Times(3)
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("5"), ETag: &etag}, nil).Times(2)
+		mockStore.EXPECT().Set(gomock.Any()).Return(nil).Times(2)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		resp, err := api.Increment(context.Background(), &runtimev1pb.IncrementRequest{StoreName: "mock", Key: "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(6), resp.Value)
+		dResp, err := api.Decrement(context.Background(), &runtimev1pb.DecrementRequest{StoreName: "mock", Key: "a", Delta: 2})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), dResp.Value)
+	})
+}
+
+func TestCheckAndRecordIdempotency(t *testing.T) {
+	t.Run("state store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.CheckAndRecordIdempotency(context.Background(), &runtimev1pb.CheckAndRecordIdempotencyRequest{StoreName: "abc", Key: "a"})
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = state store is not configured", err.Error())
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.CheckAndRecordIdempotency(context.Background(), &runtimev1pb.CheckAndRecordIdempotencyRequest{StoreName: "mock"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = api.CheckAndRecordIdempotency(context.Background(), &runtimev1pb.CheckAndRecordIdempotencyRequest{StoreName: "mock", Key: "a", TtlInSeconds: -1})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.CheckAndRecordIdempotency(context.Background(), &runtimev1pb.CheckAndRecordIdempotencyRequest{StoreName: "mock", Key: "a"})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		store := &idempotencyRecorderStore{Store: mockStore, markers: map[string][]byte{}}
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": store}, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.CheckAndRecordIdempotencyRequest{StoreName: "mock", Key: "msg-1", TtlInSeconds: 30, Value: []byte("done")}
+		resp, err := api.CheckAndRecordIdempotency(context.Background(), req)
+		assert.Nil(t, err)
+		assert.True(t, resp.Recorded)
+		assert.Equal(t, int64(30), store.ttl)
+		// the duplicate
+		resp, err = api.CheckAndRecordIdempotency(context.Background(), req)
+		assert.Nil(t, err)
+		assert.False(t, resp.Recorded)
+		assert.Equal(t, []byte("done"), resp.Value)
+	})
+}
+
+type idempotencyRecorderStore struct {
+	state.Store
+	markers map[string][]byte
+	ttl     int64
+}
+
+func (s *idempotencyRecorderStore) CheckAndRecord(req *runtime_state.IdempotencyRequest) (bool, []byte, error) {
+	if v, ok := s.markers[req.Key]; ok {
+		return false, v, nil
+	}
+	s.markers[req.Key] = req.Value
+	s.ttl = req.TTLInSeconds
+	return true, req.Value, nil
+}
+
+func TestDeleteStateByPrefix(t *testing.T) {
+	t.Run("state store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.DeleteStateByPrefix(context.Background(), &runtimev1pb.DeleteStateByPrefixRequest{StoreName: "abc", Prefix: "a"})
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = state store is not configured", err.Error())
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		mockStore := mock_state.NewMockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.DeleteStateByPrefix(context.Background(), &runtimev1pb.DeleteStateByPrefixRequest{StoreName: "mock", Prefix: "a"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = api.DeleteStateByPrefix(context.Background(), &runtimev1pb.DeleteStateByPrefixRequest{StoreName: "mock", Confirm: true})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		mockStore := mock_state.NewMockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, map[string]state.Store{"mock": mockStore}, nil, nil, nil, nil, nil)
+		_, err := api.DeleteStateByPrefix(context.Background(), &runtimev1pb.DeleteStateByPrefixRequest{StoreName: "mock", Prefix: "a", Confirm: true})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
+
+func TestTryLock(t *testing.T) {
+	t.Run("lock store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		req := &runtimev1pb.TryLockRequest{
+			StoreName: "abc",
+		}
+		_, err := api.TryLock(context.Background(), req)
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = lock store is not configured", err.Error())
+	})
+
+	t.Run("resourceid empty", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		req := &runtimev1pb.TryLockRequest{
+			StoreName: "abc",
+		}
+		_, err := api.TryLock(context.Background(), req)
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = ResourceId is empty in lock store abc", err.Error())
+	})
+
+	t.Run("lock owner empty", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		req := &runtimev1pb.TryLockRequest{
+			StoreName:  "abc",
+			ResourceId: "resource",
 		}
 		_, err := api.TryLock(context.Background(), req)
 		assert.Equal(t, "rpc error: code = InvalidArgument desc = LockOwner is empty in lock store abc", err.Error())
@@ -975,6 +1735,85 @@ func TestUnlock(t *testing.T) {
 	})
 }
 
+func TestTryLockBulk(t *testing.T) {
+	t.Run("lock store not configured", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.TryLockBulk(context.Background(), &runtimev1pb.TryLockBulkRequest{StoreName: "abc"})
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = lock store is not configured", err.Error())
+	})
+
+	t.Run("resourceid empty", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		_, err := api.TryLockBulk(context.Background(), &runtimev1pb.TryLockBulkRequest{StoreName: "abc"})
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = ResourceId is empty in lock store abc", err.Error())
+		_, err = api.TryLockBulk(context.Background(), &runtimev1pb.TryLockBulkRequest{StoreName: "abc", ResourceIds: []string{"a", ""}})
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = ResourceId is empty in lock store abc", err.Error())
+	})
+
+	t.Run("too many resource ids", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		ids := make([]string, runtime_lock.MaxBulkResources+1)
+		for i := range ids {
+			ids[i] = strconv.Itoa(i)
+		}
+		_, err := api.TryLockBulk(context.Background(), &runtimev1pb.TryLockBulkRequest{StoreName: "mock", ResourceIds: ids})
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = the number of ResourceIds exceeds 100 in lock store mock", err.Error())
+	})
+
+	t.Run("lock store not found", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		req := &runtimev1pb.TryLockBulkRequest{
+			StoreName:   "abc",
+			ResourceIds: []string{"a"},
+			LockOwner:   "owner",
+			Expire:      1,
+		}
+		_, err := api.TryLockBulk(context.Background(), req)
+		assert.Equal(t, "rpc error: code = InvalidArgument desc = lock store abc not found", err.Error())
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		gomock.InOrder(
+			mockLockStore.EXPECT().TryLock(&lock.TryLockRequest{ResourceId: "lock|||a", LockOwner: "owner", Expire: 1}).Return(&lock.TryLockResponse{Success: true}, nil),
+			mockLockStore.EXPECT().TryLock(&lock.TryLockRequest{ResourceId: "lock|||b", LockOwner: "owner", Expire: 1}).Return(&lock.TryLockResponse{Success: true}, nil),
+		)
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		req := &runtimev1pb.TryLockBulkRequest{
+			StoreName:   "mock",
+			ResourceIds: []string{"b", "a"},
+			LockOwner:   "owner",
+			Expire:      1,
+		}
+		resp, err := api.TryLockBulk(context.Background(), req)
+		assert.Nil(t, err)
+		assert.True(t, resp.Success)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		mockLockStore := mock_lock.NewMockLockStore(gomock.NewController(t))
+		gomock.InOrder(
+			mockLockStore.EXPECT().TryLock(&lock.TryLockRequest{ResourceId: "lock|||a", LockOwner: "owner", Expire: 1}).Return(&lock.TryLockResponse{Success: true}, nil),
+			mockLockStore.EXPECT().TryLock(&lock.TryLockRequest{ResourceId: "lock|||b", LockOwner: "owner", Expire: 1}).Return(&lock.TryLockResponse{Success: false}, nil),
+			mockLockStore.EXPECT().Unlock(&lock.UnlockRequest{ResourceId: "lock|||a", LockOwner: "owner"}).Return(&lock.UnlockResponse{Status: lock.SUCCESS}, nil),
+		)
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, map[string]lock.LockStore{"mock": mockLockStore}, nil, nil, nil)
+		req := &runtimev1pb.TryLockBulkRequest{
+			StoreName:   "mock",
+			ResourceIds: []string{"c", "b", "a"},
+			LockOwner:   "owner",
+			Expire:      1,
+		}
+		resp, err := api.TryLockBulk(context.Background(), req)
+		assert.Nil(t, err)
+		assert.False(t, resp.Success)
+		assert.Equal(t, "b", resp.FailedResourceId)
+	})
+}
+
 func TestGetNextId(t *testing.T) {
 	t.Run("sequencers not configured", func(t *testing.T) {
 		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
@@ -1029,6 +1868,41 @@ func TestGetNextId(t *testing.T) {
 		assert.Equal(t, int64(10), rsp.NextId)
 	})
 
+	t.Run("sharded key", func(t *testing.T) {
+		err := runtime_sequencer.SaveShardConfiguration("sharded", []sequencer.ShardConfig{{Pattern: "hot*", Count: 4}}, nil)
+		assert.Nil(t, err)
+		// the key has issued 9 ids before it's sharded
+		counters := map[string]int64{"sequencer|||hot key": 9}
+		mockSequencerStore := mock_sequencer.NewMockStore(gomock.NewController(t))
+		mockSequencerStore.EXPECT().GetNextId(gomock.Any()).
+			DoAndReturn(func(req *sequencer.GetNextIdRequest) (*sequencer.GetNextIdResponse, error) {
+				counters[req.Key]++
+				return &sequencer.GetNextIdResponse{
+					NextId: counters[req.Key],
+				}, nil
+			}).AnyTimes()
+		mockSequencerStore.EXPECT().GetSegment(gomock.Any()).
+			DoAndReturn(func(req *sequencer.GetSegmentRequest) (bool, *sequencer.GetSegmentResponse, error) {
+				from := counters[req.Key] + 1
+				counters[req.Key] += int64(req.Size)
+				return true, &sequencer.GetSegmentResponse{From: from, To: counters[req.Key]}, nil
+			}).AnyTimes()
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, map[string]sequencer.Store{"sharded": mockSequencerStore}, nil, nil)
+		req := &runtimev1pb.GetNextIdRequest{
+			StoreName: "sharded",
+			Key:       "hot key",
+			Options: &runtimev1pb.SequencerOptions{
+				Increment: runtimev1pb.SequencerOptions_STRONG,
+			},
+		}
+		rsp, err := api.GetNextId(context.Background(), req)
+		assert.Nil(t, err)
+		// the shards are seeded above the id 10 issued by the key, and the shard 1 allocates the id 3
+		assert.Equal(t, int64(13), rsp.NextId)
+		assert.Equal(t, int64(3), counters["sequencer|||hot key#shard-1"])
+		assert.Equal(t, int64(10), counters["sequencer|||hot key"])
+	})
+
 	t.Run("net error", func(t *testing.T) {
 		mockSequencerStore := mock_sequencer.NewMockStore(gomock.NewController(t))
 		mockSequencerStore.EXPECT().GetNextId(gomock.Any()).Return(nil, fmt.Errorf("net error"))
@@ -1044,6 +1918,26 @@ func TestGetNextId(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Equal(t, "net error", err.Error())
 	})
+
+	t.Run("default sequencer", func(t *testing.T) {
+		mockSequencerStore := mock_sequencer.NewMockStore(gomock.NewController(t))
+		mockSequencerStore.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 10}, nil)
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, map[string]sequencer.Store{"mock": mockSequencerStore}, nil, nil)
+		err := alias.Save(map[string]string{"sequencer": "mock"}, nil, func(kind alias.Kind, name string) bool {
+			return kind == alias.Sequencer && name == "mock"
+		})
+		assert.Nil(t, err)
+		defer alias.Save(nil, nil, nil)
+		req := &runtimev1pb.GetNextIdRequest{
+			Key: "next key",
+			Options: &runtimev1pb.SequencerOptions{
+				Increment: runtimev1pb.SequencerOptions_STRONG,
+			},
+		}
+		rsp, err := api.GetNextId(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(10), rsp.NextId)
+	})
 }
 
 func SendData(w net.Conn) {
@@ -1090,6 +1984,159 @@ func TestPutFile(t *testing.T) {
 	assert.Equal(t, s.Message(), "err occur")
 }
 
+func TestGetFileWithProgress(t *testing.T) {
+	r, w := net.Pipe()
+	ctrl := gomock.NewController(t)
+	mockFile := mock.NewMockFile(ctrl)
+	mockStream := mock.NewMockRuntime_GetFileServer(ctrl)
+	api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": mockFile}, nil, nil, nil, nil)
+	metadata := make(map[string]string)
+	mockStream.EXPECT().Context().Return(context.Background()).AnyTimes()
+	mockFile.EXPECT().Stat(context.Background(), &file.FileMetaRequest{FileName: "a.txt", Metadata: metadata}).Return(&file.FileMetaResp{Size: 8}, nil).Times(1)
+	mockFile.EXPECT().Get(context.Background(), &file.GetFileStu{FileName: "a.txt", Metadata: metadata}).Return(r, nil).Times(1)
+	gomock.InOrder(
+		mockStream.EXPECT().Send(&runtimev1pb.GetFileResponse{Data: []byte("testFile"), Progress: &runtimev1pb.FileProgress{BytesTransferred: 8, TotalBytes: 8}}).Return(nil).Times(1),
+		mockStream.EXPECT().Send(&runtimev1pb.GetFileResponse{Progress: &runtimev1pb.FileProgress{BytesTransferred: 8, TotalBytes: 8, Done: true}}).Return(nil).Times(1),
+	)
+	go SendData(w)
+	err := api.GetFile(&runtimev1pb.GetFileRequest{StoreName: "mock", Name: "a.txt", Progress: true}, mockStream)
+	assert.Nil(t, err)
+}
+
+func TestGetFileWithProgress_Compressed(t *testing.T) {
+	r, w := net.Pipe()
+	ctrl := gomock.NewController(t)
+	mockFile := mock.NewMockFile(ctrl)
+	mockStream := mock.NewMockRuntime_GetFileServer(ctrl)
+	api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": mockFile}, nil, nil, nil, nil)
+	metadata := make(map[string]string)
+	mockStream.EXPECT().Context().Return(context.Background()).AnyTimes()
+	// the size of the compressed file isn't the size got, so the total is unknown
+	meta := &file.FileMetaResp{Size: 4, UserMetadata: map[string]string{"layotto-compression": "gzip"}}
+	mockFile.EXPECT().Stat(context.Background(), &file.FileMetaRequest{FileName: "a.txt", Metadata: metadata}).Return(meta, nil).Times(1)
+	mockFile.EXPECT().Get(context.Background(), &file.GetFileStu{FileName: "a.txt", Metadata: metadata}).Return(r, nil).Times(1)
+	gomock.InOrder(
+		mockStream.EXPECT().Send(&runtimev1pb.GetFileResponse{Data: []byte("testFile"), Progress: &runtimev1pb.FileProgress{BytesTransferred: 8}}).Return(nil).Times(1),
+		mockStream.EXPECT().Send(&runtimev1pb.GetFileResponse{Progress: &runtimev1pb.FileProgress{BytesTransferred: 8, Done: true}}).Return(nil).Times(1),
+	)
+	go SendData(w)
+	err := api.GetFile(&runtimev1pb.GetFileRequest{StoreName: "mock", Name: "a.txt", Progress: true}, mockStream)
+	assert.Nil(t, err)
+}
+
+// progressFile is a file component reporting the bytes uploaded
+type progressFile struct {
+	*mock.MockFile
+}
+
+func (f *progressFile) SupportProgress() bool {
+	return true
+}
+
+type fakePutFileWithProgressServer struct {
+	rawGRPC.ServerStream
+	ctx      context.Context
+	requests []*runtimev1pb.PutFileRequest
+	progress []*runtimev1pb.FileProgress
+}
+
+func (s *fakePutFileWithProgressServer) Recv() (*runtimev1pb.PutFileRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakePutFileWithProgressServer) Send(p *runtimev1pb.FileProgress) error {
+	s.progress = append(s.progress, p)
+	return nil
+}
+
+func (s *fakePutFileWithProgressServer) Context() context.Context {
+	return s.ctx
+}
+
+func TestPutFileWithProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockFile := mock.NewMockFile(ctrl)
+	api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": mockFile}, nil, nil, nil, nil)
+
+	t.Run("progress", func(t *testing.T) {
+		stream := &fakePutFileWithProgressServer{
+			ctx: context.Background(),
+			requests: []*runtimev1pb.PutFileRequest{
+				{StoreName: "mock", Name: "a.txt", Data: []byte("hello"), Size: 10},
+				{Data: []byte("world")},
+			},
+		}
+		mockFile.EXPECT().Put(context.Background(), gomock.Any()).DoAndReturn(func(ctx context.Context, st *file.PutFileStu) error {
+			data, err := ioutil.ReadAll(st.DataStream)
+			assert.Nil(t, err)
+			assert.Equal(t, "helloworld", string(data))
+			return nil
+		}).Times(1)
+		err := api.PutFileWithProgress(stream)
+		assert.Nil(t, err)
+		// the component can't report the bytes uploaded, so the progress is sent once the file is stored
+		assert.Equal(t, []*runtimev1pb.FileProgress{
+			{BytesTransferred: 10, TotalBytes: 10, Done: true},
+		}, stream.progress)
+	})
+
+	t.Run("progress of the component", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": &progressFile{mockFile}}, nil, nil, nil, nil)
+		stream := &fakePutFileWithProgressServer{
+			ctx: context.Background(),
+			requests: []*runtimev1pb.PutFileRequest{
+				{StoreName: "mock", Name: "a.txt", Data: []byte("hello"), Size: 10},
+				{Data: []byte("world")},
+			},
+		}
+		mockFile.EXPECT().Put(context.Background(), gomock.Any()).DoAndReturn(func(ctx context.Context, st *file.PutFileStu) error {
+			data, err := ioutil.ReadAll(st.DataStream)
+			assert.Nil(t, err)
+			assert.Equal(t, "helloworld", string(data))
+			st.Progress(4)
+			st.Progress(10)
+			return nil
+		}).Times(1)
+		err := api.PutFileWithProgress(stream)
+		assert.Nil(t, err)
+		assert.Equal(t, []*runtimev1pb.FileProgress{
+			{BytesTransferred: 4, TotalBytes: 10},
+			{BytesTransferred: 10, TotalBytes: 10},
+			{BytesTransferred: 10, TotalBytes: 10, Done: true},
+		}, stream.progress)
+	})
+
+	t.Run("canceled by the client", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := &fakePutFileWithProgressServer{
+			ctx:      ctx,
+			requests: []*runtimev1pb.PutFileRequest{{StoreName: "mock", Name: "a.txt", Data: []byte("hello")}},
+		}
+		mockFile.EXPECT().Put(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, st *file.PutFileStu) error {
+			cancel()
+			return ctx.Err()
+		}).Times(1)
+		err := api.PutFileWithProgress(stream)
+		s, _ := status.FromError(err)
+		assert.Equal(t, codes.Canceled, s.Code())
+		assert.Empty(t, stream.progress)
+	})
+
+	t.Run("not support store type", func(t *testing.T) {
+		stream := &fakePutFileWithProgressServer{
+			ctx:      context.Background(),
+			requests: []*runtimev1pb.PutFileRequest{{StoreName: "mock1"}},
+		}
+		err := api.PutFileWithProgress(stream)
+		assert.Equal(t, err, status.Errorf(codes.InvalidArgument, "not support store type: mock1"))
+	})
+}
+
 func TestListFile(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockFile := mock.NewMockFile(ctrl)
@@ -1116,6 +2163,24 @@ func TestListFile(t *testing.T) {
 	resp, err = api.ListFile(context.Background(), &runtimev1pb.ListFileRequest{Request: request})
 	assert.Equal(t, len(resp.Files), 1)
 	assert.Equal(t, resp.Files[0].FileName, "hello")
+
+	// the filters are applied by the runtime if the component doesn't support them
+	files = []*file.FilesInfo{
+		{FileName: "test/b.log", Size: 1},
+		{FileName: "test/a.txt", Size: 2},
+		{FileName: "test/a.log", Size: 3},
+	}
+	mockFile.EXPECT().List(context.Background(), &file.ListRequest{DirectoryName: request.Name, Metadata: request.Metadata, Suffix: ".log", SortBy: "name"}).Return(&file.ListResp{Files: files}, nil).Times(1)
+	resp, err = api.ListFile(context.Background(), &runtimev1pb.ListFileRequest{Request: request, Suffix: ".log", SortBy: "name"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(resp.Files))
+	assert.Equal(t, "test/a.log", resp.Files[0].FileName)
+	assert.Equal(t, "test/b.log", resp.Files[1].FileName)
+
+	_, err = api.ListFile(context.Background(), &runtimev1pb.ListFileRequest{Request: request, SortBy: "unknown"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = api.ListFile(context.Background(), &runtimev1pb.ListFileRequest{Request: request, ModifiedAfter: 2, ModifiedBefore: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func TestDelFile(t *testing.T) {
@@ -1159,6 +2224,104 @@ func TestGetFileMeta(t *testing.T) {
 	resp, err = api.GetFileMeta(context.Background(), request)
 	assert.Equal(t, resp.LastModified, "123")
 	assert.Equal(t, int(resp.Size), 10)
+
+	re.ETag = "etag"
+	re.ContentType = "text/plain"
+	re.StorageClass = "STANDARD"
+	re.Tags = map[string]string{"k": "v"}
+	mockFile.EXPECT().Stat(context.Background(), &file.FileMetaRequest{FileName: request.Request.Name, Metadata: meta}).Return(re, nil).Times(1)
+	resp, err = api.GetFileMeta(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, "etag", resp.Etag)
+	assert.Equal(t, "text/plain", resp.ContentType)
+	assert.Equal(t, "STANDARD", resp.StorageClass)
+	assert.Equal(t, map[string]string{"k": "v"}, resp.Tags)
+}
+
+type mockTagFile struct {
+	*mock.MockFile
+	req *file.TagRequest
+	err error
+}
+
+func (m *mockTagFile) Tag(ctx context.Context, req *file.TagRequest) error {
+	m.req = req
+	return m.err
+}
+
+func TestTagFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockFile := mock.NewMockFile(ctrl)
+	tagFile := &mockTagFile{MockFile: mockFile}
+	api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": mockFile, "tag": tagFile}, nil, nil, nil, nil)
+
+	_, err := api.TagFile(context.Background(), &runtimev1pb.TagFileRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	request := &runtimev1pb.TagFileRequest{
+		Request: &runtimev1pb.FileRequest{StoreName: "mock", Name: "bucket/test"},
+		Tags:    map[string]string{"k": "v"},
+	}
+	_, err = api.TagFile(context.Background(), request)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	request.Request.StoreName = "tag"
+	_, err = api.TagFile(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket/test", tagFile.req.FileName)
+	assert.Equal(t, map[string]string{"k": "v"}, tagFile.req.Tags)
+
+	tagFile.err = file.ErrNotExist
+	_, err = api.TagFile(context.Background(), request)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+type mockRestoreFile struct {
+	*mock.MockFile
+	req *file.RestoreRequest
+	err error
+}
+
+func (m *mockRestoreFile) Restore(ctx context.Context, req *file.RestoreRequest) error {
+	m.req = req
+	return m.err
+}
+
+func TestRestoreFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockFile := mock.NewMockFile(ctrl)
+	restoreFile := &mockRestoreFile{MockFile: mockFile}
+	api := NewAPI("", nil, nil, nil, nil, nil, map[string]file.File{"mock": mockFile, "restore": restoreFile}, nil, nil, nil, nil)
+
+	_, err := api.RestoreFile(context.Background(), &runtimev1pb.RestoreFileRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	request := &runtimev1pb.RestoreFileRequest{
+		Request: &runtimev1pb.FileRequest{StoreName: "restore", Name: "bucket/test"},
+	}
+	_, err = api.RestoreFile(context.Background(), request)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	request.Days = 1
+	request.Tier = "Fast"
+	_, err = api.RestoreFile(context.Background(), request)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	request.Tier = file.TierBulk
+	request.Request.StoreName = "mock"
+	_, err = api.RestoreFile(context.Background(), request)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	request.Request.StoreName = "restore"
+	_, err = api.RestoreFile(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket/test", restoreFile.req.FileName)
+	assert.Equal(t, int32(1), restoreFile.req.Days)
+	assert.Equal(t, file.TierBulk, restoreFile.req.Tier)
+
+	restoreFile.err = file.ErrNotExist
+	_, err = api.RestoreFile(context.Background(), request)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 }
 
 func createTestClient(port int) *grpc.ClientConn {
@@ -1339,3 +2502,252 @@ func startTestServerAPI(port int, srv runtimev1pb.RuntimeServer) *grpc.Server {
 
 	return server
 }
+
+func TestBatch(t *testing.T) {
+	t.Run("request is nil", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.Batch(context.Background(), nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("mixed operations", func(t *testing.T) {
+		mockSequencerStore := mock_sequencer.NewMockStore(gomock.NewController(t))
+		mockSequencerStore.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 10}, nil).Times(2)
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, map[string]sequencer.Store{"mock": mockSequencerStore}, nil, nil)
+		getNextId := &runtimev1pb.GetNextIdRequest{
+			StoreName: "mock",
+			Key:       "next key",
+			Options: &runtimev1pb.SequencerOptions{
+				Increment: runtimev1pb.SequencerOptions_STRONG,
+			},
+		}
+		req := &runtimev1pb.BatchRequest{
+			Operations: []*runtimev1pb.BatchOperation{
+				{Request: &runtimev1pb.BatchOperation_GetNextId{GetNextId: getNextId}},
+				{Request: &runtimev1pb.BatchOperation_GetState{GetState: &runtimev1pb.GetStateRequest{StoreName: "abc", Key: "key"}}},
+				{},
+				nil,
+				{Request: &runtimev1pb.BatchOperation_GetNextId{GetNextId: getNextId}},
+			},
+			Parallelism: 2,
+		}
+		rsp, err := api.Batch(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Len(t, rsp.Results, 5)
+		assert.Equal(t, int32(codes.OK), rsp.Results[0].Code)
+		assert.Equal(t, int64(10), rsp.Results[0].GetNextId.NextId)
+		assert.Equal(t, int32(codes.FailedPrecondition), rsp.Results[1].Code)
+		assert.Nil(t, rsp.Results[1].GetState)
+		assert.Equal(t, int32(codes.InvalidArgument), rsp.Results[2].Code)
+		assert.Equal(t, int32(codes.InvalidArgument), rsp.Results[3].Code)
+		assert.Equal(t, int64(10), rsp.Results[4].GetNextId.NextId)
+	})
+
+	t.Run("too many operations", func(t *testing.T) {
+		api := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		_, err := api.Batch(context.Background(), &runtimev1pb.BatchRequest{Operations: make([]*runtimev1pb.BatchOperation, maxBatchOperations+1)})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestGetReadiness(t *testing.T) {
+	a := NewAPI("", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	resp, err := a.GetReadiness(context.Background(), &runtimev1pb.GetReadinessRequest{})
+	assert.Nil(t, err)
+	assert.False(t, resp.Ready)
+	assert.Equal(t, "INIT", resp.SubscriptionStatus)
+
+	hs := &healthServer{api: a.(*api)}
+	check, err := hs.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.Status)
+
+	// no subscription is needed without pubsub components
+	assert.Nil(t, a.Init(nil))
+	resp, err = a.GetReadiness(context.Background(), &runtimev1pb.GetReadinessRequest{})
+	assert.Nil(t, err)
+	assert.True(t, resp.Ready)
+	assert.Equal(t, "UP", resp.SubscriptionStatus)
+
+	check, err = hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "spec.proto.runtime.v1.Runtime"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+	check, err = hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "liveness"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+	_, err = hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestPauseSubscription(t *testing.T) {
+	a := NewAPI("app1", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil).(*api)
+	gate := a.addSubscriptionGate("mock", "topic")
+
+	_, err := a.PauseSubscription(context.Background(), &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = a.PauseSubscription(context.Background(), &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "other"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// the in-flight event isn't drained before timeout
+	assert.Nil(t, gate.Enter(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = a.PauseSubscription(ctx, &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	md, err := a.GetMetadata(context.Background(), &runtimev1pb.GetMetadataRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "app1", md.Id)
+	assert.Len(t, md.Subscriptions, 1)
+	assert.True(t, md.Subscriptions[0].Paused)
+	assert.Equal(t, int64(1), md.Subscriptions[0].InFlight)
+
+	gate.Leave()
+	_, err = a.PauseSubscription(context.Background(), &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Nil(t, err)
+
+	_, err = a.ResumeSubscription(context.Background(), &runtimev1pb.ResumeSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Nil(t, err)
+	md, err = a.GetMetadata(context.Background(), &runtimev1pb.GetMetadataRequest{})
+	assert.Nil(t, err)
+	assert.False(t, md.Subscriptions[0].Paused)
+	assert.Equal(t, int64(0), md.Subscriptions[0].InFlight)
+}
+
+func TestGetMetadataOfPubSubs(t *testing.T) {
+	a := NewAPI("app1", nil, nil, nil, map[string]pubsub.PubSub{"kafka": nil, "redis": nil}, nil, nil, nil, nil, nil, nil)
+	md, err := a.GetMetadata(context.Background(), &runtimev1pb.GetMetadataRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, md.PubSubs, 2)
+	assert.Equal(t, "kafka", md.PubSubs[0].Name)
+	assert.True(t, md.PubSubs[0].PartitionKey)
+	assert.Equal(t, runtimev1pb.PubSubMetadata_PARTITION_KEY, md.PubSubs[0].Ordering)
+	assert.Equal(t, "redis", md.PubSubs[1].Name)
+	assert.False(t, md.PubSubs[1].PartitionKey)
+	assert.Equal(t, runtimev1pb.PubSubMetadata_NONE, md.PubSubs[1].Ordering)
+}
+
+type mockReplayablePubSub struct {
+	pubsub.PubSub
+	messages [][]byte
+}
+
+func (m *mockReplayablePubSub) Replay(ctx context.Context, req *runtime_pubsub.ReplayRequest, handler pubsub.Handler) (int64, error) {
+	var count int64
+	for _, data := range m.messages {
+		if err := handler(ctx, &pubsub.NewMessage{Data: data, Topic: req.Topic}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func TestReplayMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	data, err := json.Marshal(map[string]interface{}{
+		pubsub.IDField:              "id",
+		pubsub.SourceField:          "source",
+		pubsub.DataContentTypeField: "text/plain",
+		pubsub.TypeField:            "type",
+		pubsub.SpecVersionField:     "1.0",
+		pubsub.DataField:            "layotto",
+	})
+	assert.Nil(t, err)
+	replayable := &mockReplayablePubSub{PubSub: mock_pubsub.NewMockPubSub(ctrl), messages: [][]byte{data, data}}
+	a := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{
+		"replayable": replayable,
+		"mock":       mock_pubsub.NewMockPubSub(ctrl),
+	}, nil, nil, nil, nil, nil, nil).(*api)
+	app := mock_appcallback.NewMockAppCallbackClient(ctrl)
+	a.appCallback = app
+	a.addSubscriptionGate("replayable", "topic")
+	a.addSubscriptionGate("mock", "topic")
+
+	t.Run("metadata", func(t *testing.T) {
+		md, err := a.GetMetadata(context.Background(), &runtimev1pb.GetMetadataRequest{})
+		assert.Nil(t, err)
+		assert.Len(t, md.PubSubs, 2)
+		assert.Equal(t, "mock", md.PubSubs[0].Name)
+		assert.False(t, md.PubSubs[0].Replay)
+		assert.Equal(t, "replayable", md.PubSubs[1].Name)
+		assert.True(t, md.PubSubs[1].Replay)
+	})
+
+	t.Run("subscription not found", func(t *testing.T) {
+		_, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "replayable", Topic: "other"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		_, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "mock", Topic: "topic", EndOffset: 10})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "replayable", Topic: "topic", StartOffset: 10, EndOffset: 5})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "replayable", Topic: "topic", StartTime: 2000, EndTime: 1000})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		app.EXPECT().OnTopicEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, in *runtimev1pb.TopicEventRequest, opts ...rawGRPC.CallOption) (*runtimev1pb.TopicEventResponse, error) {
+			assert.Equal(t, "replayable", in.PubsubName)
+			assert.Equal(t, "layotto", string(in.Data))
+			return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}, nil
+		}).Times(2)
+		resp, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "replayable", Topic: "topic", StartTime: 1000})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), resp.Count)
+	})
+
+	t.Run("app fails", func(t *testing.T) {
+		app.EXPECT().OnTopicEvent(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable"))
+		_, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "replayable", Topic: "topic", EndOffset: 2})
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+}
+
+type mockSchemaInvoker struct {
+	rpc.Invoker
+	schemas []*rpc.PayloadSchema
+}
+
+func (m *mockSchemaInvoker) PayloadSchemas(target string) []*rpc.PayloadSchema {
+	var res []*rpc.PayloadSchema
+	for _, s := range m.schemas {
+		if target == "" || target == s.Id {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func TestGetPayloadSchemas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := NewAPI("", nil, nil, map[string]rpc.Invoker{"mosn": mock_invoker.NewMockInvoker(ctrl)}, nil, nil, nil, nil, nil, nil, nil)
+	_, err := a.GetPayloadSchemas(context.Background(), &runtimev1pb.GetPayloadSchemasRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	invoker := &mockSchemaInvoker{Invoker: mock_invoker.NewMockInvoker(ctrl), schemas: []*rpc.PayloadSchema{
+		{Id: "user", Method: "*", RequestJSONSchema: `{"type": "object"}`, Mode: "warn"},
+		{Id: "order", Method: "Create", RequestType: "shop.v1.Order", DescriptorSet: []byte{1}, TargetFormat: "protobuf", Mode: "enforce"},
+	}}
+	a = NewAPI("", nil, nil, map[string]rpc.Invoker{"mosn": invoker}, nil, nil, nil, nil, nil, nil, nil)
+	resp, err := a.GetPayloadSchemas(context.Background(), &runtimev1pb.GetPayloadSchemasRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Schemas, 2)
+	assert.Equal(t, "order", resp.Schemas[0].Id)
+	assert.Equal(t, "shop.v1.Order", resp.Schemas[0].RequestType)
+	assert.True(t, resp.Schemas[0].Transcode)
+	assert.Equal(t, "protobuf", resp.Schemas[0].TargetFormat)
+	assert.Equal(t, `{"type": "object"}`, resp.Schemas[1].RequestJsonSchema)
+	resp, err = a.GetPayloadSchemas(context.Background(), &runtimev1pb.GetPayloadSchemasRequest{Id: "user"})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Schemas, 1)
+	assert.Equal(t, "warn", resp.Schemas[0].Mode)
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"google.golang.org/grpc/codes"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+var (
+	errTopicEventStreamClosed   = errors.New("the stream subscribing to the topic is closed")
+	errTopicEventStreamAttached = errors.New("another stream is subscribing to the topic")
+)
+
+// SubscribeTopicEvents subscribes to the topic of the first request and sends the events over the stream.
+// The following requests ack the events, and the events not acked before the stream is closed are redelivered.
+func (a *api) SubscribeTopicEvents(stream runtimev1pb.Runtime_SubscribeTopicEventsServer) error {
+	// 1. the first request subscribes to the topic
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	pubsubName := alias.Resolve(alias.PubSub, req.PubsubName)
+	if pubsubName == "" {
+		return messages.Error(codes.InvalidArgument, messages.ErrPubsubEmpty)
+	}
+	ps, ok := a.pubSubs[pubsubName]
+	if !ok {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrPubsubNotFound, pubsubName)
+	}
+	if req.Topic == "" {
+		return messages.Errorf(codes.InvalidArgument, messages.ErrTopicEmpty, pubsubName)
+	}
+	s, err := a.attachTopicEventStream(ps, pubsubName, req.Topic, req.Metadata, stream)
+	if err != nil {
+		return err
+	}
+	defer s.detach(stream)
+	log.DefaultLogger.Infof("[runtime] [grpc.SubscribeTopicEvents] subscribe to topic %s in pubsub %s", req.Topic, pubsubName)
+	// 2. the following requests ack the events
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeTopicEvents] the stream subscribing to topic %s in pubsub %s is broken: %v", s.topic, pubsubName, err)
+			return err
+		}
+		s.ack(req.Id, &runtimev1pb.TopicEventResponse{Status: req.Status})
+	}
+}
+
+// attachTopicEventStream attaches the stream to the subscription of the topic, which is created at the first time.
+// The pubsub components can't unsubscribe, so the subscription is kept after the stream is closed,
+// and the events are redelivered until a new stream subscribes to the topic.
+func (a *api) attachTopicEventStream(ps pubsub.PubSub, pubsubName string, topic string, metadata map[string]string,
+	stream runtimev1pb.Runtime_SubscribeTopicEventsServer) (*topicEventStream, error) {
+	a.topicEventStreamsLock.Lock()
+	s, ok := a.topicEventStreams[pubsubName][topic]
+	if !ok {
+		// the topic can't be subscribed by both the app callback and the stream
+		a.subscriptionGatesLock.RLock()
+		_, subscribed := a.subscriptionGates[pubsubName][topic]
+		a.subscriptionGatesLock.RUnlock()
+		if subscribed {
+			a.topicEventStreamsLock.Unlock()
+			return nil, messages.Errorf(codes.AlreadyExists, messages.ErrSubscriptionExists, topic, pubsubName)
+		}
+		s = &topicEventStream{topic: topic, pending: make(map[string]chan *runtimev1pb.TopicEventResponse)}
+		if a.topicEventStreams == nil {
+			a.topicEventStreams = make(map[string]map[string]*topicEventStream)
+		}
+		if _, ok := a.topicEventStreams[pubsubName]; !ok {
+			a.topicEventStreams[pubsubName] = make(map[string]*topicEventStream)
+		}
+		a.topicEventStreams[pubsubName][topic] = s
+	}
+	// the component is called without the lock, which is taken by every delivery
+	a.topicEventStreamsLock.Unlock()
+	subscribe := func() error {
+		return ps.Subscribe(pubsub.SubscribeRequest{
+			Topic:    topic,
+			Metadata: metadata,
+		}, a.topicEventHandler(pubsubName, a.addSubscriptionGate(pubsubName, topic)))
+	}
+	subscribed, err := s.attach(stream, subscribe)
+	if err == nil {
+		return s, nil
+	}
+	// the subscription is kept once it's created, and the stream is detached from it
+	if !subscribed {
+		a.topicEventStreamsLock.Lock()
+		if a.topicEventStreams[pubsubName][topic] == s && !s.isSubscribed() {
+			delete(a.topicEventStreams[pubsubName], topic)
+			a.subscriptionGatesLock.Lock()
+			delete(a.subscriptionGates[pubsubName], topic)
+			a.subscriptionGatesLock.Unlock()
+		}
+		a.topicEventStreamsLock.Unlock()
+	}
+	switch err {
+	case errTopicEventStreamAttached:
+		return nil, messages.Errorf(codes.AlreadyExists, messages.ErrSubscriptionExists, topic, pubsubName)
+	case errTopicEventStreamClosed:
+		return nil, err
+	}
+	log.DefaultLogger.Errorf("[runtime] [grpc.SubscribeTopicEvents] subscribe to topic %s in pubsub %s error: %v", topic, pubsubName, err)
+	return nil, messages.Errorf(codes.Internal, messages.ErrPubsubSubscribe, topic, pubsubName, err.Error())
+}
+
+// getTopicEventStream returns the stream subscription of the topic, which is nil if it's subscribed by the app callback
+func (a *api) getTopicEventStream(pubsubName string, topic string) *topicEventStream {
+	a.topicEventStreamsLock.Lock()
+	defer a.topicEventStreamsLock.Unlock()
+	return a.topicEventStreams[pubsubName][topic]
+}
+
+// topicEventStream delivers the events of a topic to the stream of SubscribeTopicEvents attached to it
+type topicEventStream struct {
+	topic string
+	lock  sync.Mutex
+	// subscribed is true once the topic is subscribed, which can't be undone
+	subscribed bool
+	// stream is nil if no stream is attached
+	stream runtimev1pb.Runtime_SubscribeTopicEventsServer
+	// closed is closed when the stream is detached
+	closed chan struct{}
+	// pending maps the ids of the events sent to the channels waiting for the acks
+	pending  map[string]chan *runtimev1pb.TopicEventResponse
+	sendLock sync.Mutex
+}
+
+// attach sets the stream and confirms the subscription, it fails if another stream is attached.
+// The topic is subscribed by the function before the confirmation if it's not subscribed yet,
+// and the events delivered in the meantime wait for the stream. It returns whether the topic is subscribed.
+func (s *topicEventStream) attach(stream runtimev1pb.Runtime_SubscribeTopicEventsServer, subscribe func() error) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stream != nil {
+		return s.subscribed, errTopicEventStreamAttached
+	}
+	if !s.subscribed {
+		if err := subscribe(); err != nil {
+			return false, err
+		}
+		s.subscribed = true
+	}
+	if err := stream.Send(&runtimev1pb.SubscribeTopicEventsResponse{}); err != nil {
+		return true, errTopicEventStreamClosed
+	}
+	s.stream = stream
+	s.closed = make(chan struct{})
+	return true, nil
+}
+
+func (s *topicEventStream) isSubscribed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.subscribed
+}
+
+func (s *topicEventStream) detach(stream runtimev1pb.Runtime_SubscribeTopicEventsServer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stream != stream {
+		return
+	}
+	s.stream = nil
+	close(s.closed)
+}
+
+// deliver sends the event to the stream and waits for the ack
+func (s *topicEventStream) deliver(ctx context.Context, in *runtimev1pb.TopicEventRequest) (*runtimev1pb.TopicEventResponse, error) {
+	s.lock.Lock()
+	stream, closed := s.stream, s.closed
+	if stream == nil {
+		s.lock.Unlock()
+		return nil, errTopicEventStreamClosed
+	}
+	ack := make(chan *runtimev1pb.TopicEventResponse, 1)
+	s.pending[in.Id] = ack
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.pending, in.Id)
+		s.lock.Unlock()
+	}()
+	s.sendLock.Lock()
+	err := stream.Send(&runtimev1pb.SubscribeTopicEventsResponse{Event: in})
+	s.sendLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-ack:
+		return res, nil
+	case <-closed:
+		return nil, errTopicEventStreamClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ack passes the result to the delivery waiting for it, the acks of unknown events are ignored
+func (s *topicEventStream) ack(id string, res *runtimev1pb.TopicEventResponse) {
+	s.lock.Lock()
+	ack, ok := s.pending[id]
+	s.lock.Unlock()
+	if !ok {
+		log.DefaultLogger.Warnf("[runtime] [grpc.SubscribeTopicEvents] ignore the ack of unknown event %s of topic %s", id, s.topic)
+		return
+	}
+	select {
+	case ack <- res:
+	default:
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package default_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+type mockSubscribedPubSub struct {
+	pubsub.PubSub
+	handlers   map[string]pubsub.Handler
+	subscribes int
+}
+
+func (m *mockSubscribedPubSub) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	m.handlers[req.Topic] = handler
+	m.subscribes++
+	return nil
+}
+
+// fakeTopicEventsServer is a stream failing to send
+type fakeTopicEventsServer struct {
+	grpc.ServerStream
+}
+
+func (s *fakeTopicEventsServer) Send(*runtimev1pb.SubscribeTopicEventsResponse) error {
+	return errors.New("broken")
+}
+
+func (s *fakeTopicEventsServer) Recv() (*runtimev1pb.SubscribeTopicEventsRequest, error) {
+	return nil, io.EOF
+}
+
+func startTopicEventsServer(t *testing.T, a API) runtimev1pb.RuntimeClient {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	runtimev1pb.RegisterRuntimeServer(s, a)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.Nil(t, err)
+	return runtimev1pb.NewRuntimeClient(conn)
+}
+
+func subscribeTopicEvents(t *testing.T, client runtimev1pb.RuntimeClient, req *runtimev1pb.SubscribeTopicEventsRequest) (runtimev1pb.Runtime_SubscribeTopicEventsClient, error) {
+	stream, err := client.SubscribeTopicEvents(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(req))
+	_, err = stream.Recv()
+	return stream, err
+}
+
+func TestSubscribeTopicEvents(t *testing.T) {
+	ps := &mockSubscribedPubSub{handlers: make(map[string]pubsub.Handler)}
+	a := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"mock": ps}, nil, nil, nil, nil, nil, nil)
+	a.(*api).addSubscriptionGate("mock", "callback")
+	client := startTopicEventsServer(t, a)
+	data, err := json.Marshal(map[string]interface{}{
+		pubsub.IDField:              "id",
+		pubsub.SourceField:          "source",
+		pubsub.DataContentTypeField: "text/plain",
+		pubsub.TypeField:            "type",
+		pubsub.SpecVersionField:     "1.0",
+		pubsub.DataField:            "layotto",
+	})
+	assert.Nil(t, err)
+	msg := func() *pubsub.NewMessage {
+		return &pubsub.NewMessage{Data: data, Topic: "topic"}
+	}
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{Topic: "topic"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "other", Topic: "topic"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "mock"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("subscribed by the app callback", func(t *testing.T) {
+		_, err := subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "mock", Topic: "callback"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	stream, err := subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Nil(t, err)
+	handler := ps.handlers["topic"]
+	assert.NotNil(t, handler)
+
+	t.Run("subscribed by another stream", func(t *testing.T) {
+		_, err := subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "mock", Topic: "topic"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("ack events", func(t *testing.T) {
+		for _, s := range []runtimev1pb.TopicEventResponse_TopicEventResponseStatus{
+			runtimev1pb.TopicEventResponse_SUCCESS,
+			runtimev1pb.TopicEventResponse_RETRY,
+		} {
+			done := make(chan error, 1)
+			go func() {
+				done <- handler(context.Background(), msg())
+			}()
+			resp, err := stream.Recv()
+			assert.Nil(t, err)
+			assert.Equal(t, "id", resp.Event.Id)
+			assert.Equal(t, "mock", resp.Event.PubsubName)
+			assert.Equal(t, "layotto", string(resp.Event.Data))
+			assert.Nil(t, stream.Send(&runtimev1pb.SubscribeTopicEventsRequest{Id: resp.Event.Id, Status: s}))
+			err = <-done
+			if s == runtimev1pb.TopicEventResponse_SUCCESS {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		}
+	})
+
+	t.Run("redeliver after the stream is closed", func(t *testing.T) {
+		done := make(chan error, 1)
+		go func() {
+			done <- handler(context.Background(), msg())
+		}()
+		_, err := stream.Recv()
+		assert.Nil(t, err)
+		assert.Nil(t, stream.CloseSend())
+		assert.NotNil(t, <-done)
+		// the topic is subscribed again by a new stream
+		stream, err = subscribeTopicEvents(t, client, &runtimev1pb.SubscribeTopicEventsRequest{PubsubName: "mock", Topic: "topic"})
+		assert.Nil(t, err)
+		go func() {
+			done <- handler(context.Background(), msg())
+		}()
+		resp, err := stream.Recv()
+		assert.Nil(t, err)
+		assert.Nil(t, stream.Send(&runtimev1pb.SubscribeTopicEventsRequest{Id: resp.Event.Id}))
+		assert.Nil(t, <-done)
+	})
+}
+
+func TestAttachTopicEventStream_ConfirmFailed(t *testing.T) {
+	ps := &mockSubscribedPubSub{handlers: make(map[string]pubsub.Handler)}
+	a := NewAPI("", nil, nil, nil, map[string]pubsub.PubSub{"mock": ps}, nil, nil, nil, nil, nil, nil).(*api)
+	data, err := json.Marshal(map[string]interface{}{
+		pubsub.IDField:              "id",
+		pubsub.SourceField:          "source",
+		pubsub.DataContentTypeField: "text/plain",
+		pubsub.TypeField:            "type",
+		pubsub.SpecVersionField:     "1.0",
+		pubsub.DataField:            "layotto",
+	})
+	assert.Nil(t, err)
+
+	// the subscription is kept with the stream detached after the confirmation fails
+	_, err = a.attachTopicEventStream(ps, "mock", "topic", nil, &fakeTopicEventsServer{})
+	assert.Equal(t, errTopicEventStreamClosed, err)
+	assert.Equal(t, 1, ps.subscribes)
+	assert.NotNil(t, a.getTopicEventStream("mock", "topic"))
+	// the events are redelivered instead of calling the app callback, which isn't configured
+	err = ps.handlers["topic"](context.Background(), &pubsub.NewMessage{Data: data, Topic: "topic"})
+	assert.NotNil(t, err)
+
+	// the topic isn't subscribed again
+	_, err = a.attachTopicEventStream(ps, "mock", "topic", nil, &fakeTopicEventsServer{})
+	assert.Equal(t, errTopicEventStreamClosed, err)
+	assert.Equal(t, 1, ps.subscribes)
+
+	// the events of the topics without the stream can't be sent without the app callback
+	_, err = a.sendTopicEvent(context.Background(), &runtimev1pb.TopicEventRequest{PubsubName: "mock", Topic: "other"})
+	assert.Equal(t, errAppCallbackNotConfigured, err)
+}
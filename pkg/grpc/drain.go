@@ -0,0 +1,237 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/actuator"
+	"mosn.io/layotto/pkg/actuator/health"
+)
+
+const (
+	drainEndpointName = "grpc"
+	// drainParam starts draining the server, e.g. /actuator/grpc/drain
+	drainParam = "drain"
+)
+
+var (
+	ErrNotDraining = errors.New("the grpc server isn't configured to drain")
+	// ErrDrainForbidden is returned if the caller of the actuator endpoint isn't authorized to drain the server
+	ErrDrainForbidden = errors.New("the caller isn't authorized to drain the grpc server")
+)
+
+func init() {
+	actuator.GetDefault().AddEndpoint(drainEndpointName, NewDrainEndpoint())
+}
+
+// Drainer closes the streams gracefully before the server stops, e.g. when the sidecar is rolled.
+// After it starts draining, the new streams are rejected, and the streams open are closed after the grace period,
+// both with UNAVAILABLE, so that the clients reconnect to another sidecar and resume. The unary calls are still served.
+type Drainer struct {
+	grace time.Duration
+	// tokens authorize the callers of the actuator endpoint draining the server
+	tokens []string
+
+	mu       sync.Mutex
+	draining bool
+	streams  map[*drainedStream]struct{}
+	// closed is closed once the server is draining and all the streams are closed
+	closed chan struct{}
+}
+
+// drainedStream is the stream whose context is canceled when it's closed by draining.
+// The handlers blocked in receiving without watching the context end when the server stops.
+type drainedStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	cancel  context.CancelFunc
+	drained bool
+}
+
+func (s *drainedStream) Context() context.Context {
+	return s.ctx
+}
+
+// NewDrainer returns a Drainer keeping the streams for the grace period after it starts draining.
+// The tokens authorize the callers of the actuator endpoint draining the server, which can't drain it if they're empty.
+func NewDrainer(grace time.Duration, tokens []string) *Drainer {
+	return &Drainer{
+		grace:   grace,
+		tokens:  tokens,
+		streams: make(map[*drainedStream]struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// StreamInterceptor rejects the new streams once the server is draining, and tracks the streams open
+func (d *Drainer) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := context.WithCancel(ss.Context())
+	s := &drainedStream{ServerStream: ss, ctx: ctx, cancel: cancel}
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		cancel()
+		return status.Errorf(codes.Unavailable, "the runtime is draining, %s is rejected", info.FullMethod)
+	}
+	d.streams[s] = struct{}{}
+	d.mu.Unlock()
+
+	err := handler(srv, s)
+	cancel()
+
+	d.mu.Lock()
+	delete(d.streams, s)
+	drained := s.drained
+	if d.draining && len(d.streams) == 0 {
+		d.closeOnce()
+	}
+	d.mu.Unlock()
+	if drained {
+		return status.Errorf(codes.Unavailable, "the runtime is draining, %s is closed", info.FullMethod)
+	}
+	return err
+}
+
+// Drain starts draining, the streams open are closed after the grace period
+func (d *Drainer) Drain() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return
+	}
+	d.draining = true
+	if len(d.streams) == 0 {
+		d.closeOnce()
+		return
+	}
+	time.AfterFunc(d.grace, d.closeStreams)
+}
+
+// Wait waits until all the streams are closed after draining, it returns false if they aren't closed before the timeout
+func (d *Drainer) Wait(timeout time.Duration) bool {
+	select {
+	case <-d.closed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Draining returns whether the server is draining
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Streams returns the number of the streams open
+func (d *Drainer) Streams() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.streams)
+}
+
+// ReadinessIndicator reports DOWN once the server is draining, so that no more clients are routed to it
+func (d *Drainer) ReadinessIndicator() (string, map[string]interface{}) {
+	if d.Draining() {
+		return health.DOWN, map[string]interface{}{"reason": "draining", "streams": d.Streams()}
+	}
+	return health.UP, nil
+}
+
+// authorize checks the token of the caller of the actuator endpoint against the tokens configured
+func (d *Drainer) authorize(ctx context.Context) error {
+	token := actuator.TokenOf(ctx)
+	if token == "" {
+		return ErrDrainForbidden
+	}
+	for _, expected := range d.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return nil
+		}
+	}
+	return ErrDrainForbidden
+}
+
+func (d *Drainer) closeStreams() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for s := range d.streams {
+		s.drained = true
+		s.cancel()
+	}
+}
+
+// closeOnce closes the channel of waiting, it's called with the lock held
+func (d *Drainer) closeOnce() {
+	select {
+	case <-d.closed:
+	default:
+		close(d.closed)
+	}
+}
+
+var (
+	drainerMu sync.Mutex
+	drainer   *Drainer
+)
+
+// SetDrainer sets the Drainer of the runtime server, which is used by the actuator endpoint
+func SetDrainer(d *Drainer) {
+	drainerMu.Lock()
+	defer drainerMu.Unlock()
+	drainer = d
+}
+
+type DrainEndpoint struct {
+}
+
+func NewDrainEndpoint() *DrainEndpoint {
+	return &DrainEndpoint{}
+}
+
+// Handle returns the state of draining, or starts draining:
+//
+//	/actuator/grpc        returns whether the server is draining and the number of the streams open
+//	/actuator/grpc/drain  starts draining and returns the state, the header layotto-actuator-token should carry a drain token
+func (e *DrainEndpoint) Handle(ctx context.Context, params actuator.ParamsScanner) (map[string]interface{}, error) {
+	drainerMu.Lock()
+	d := drainer
+	drainerMu.Unlock()
+	if d == nil {
+		return map[string]interface{}{"error": ErrNotDraining.Error()}, ErrNotDraining
+	}
+	if params != nil && params.HasNext() && params.Next() == drainParam {
+		if err := d.authorize(ctx); err != nil {
+			return map[string]interface{}{"error": err.Error()}, err
+		}
+		d.Drain()
+	}
+	return map[string]interface{}{
+		"draining": d.Draining(),
+		"streams":  d.Streams(),
+	}, nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/pkg/actuator"
+)
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestDrainer(t *testing.T) {
+	d := NewDrainer(50*time.Millisecond, nil)
+	info := &grpc.StreamServerInfo{FullMethod: "/spec.proto.runtime.v1.Runtime/SubscribeConfiguration"}
+	ss := &testServerStream{ctx: context.Background()}
+	s, _ := d.ReadinessIndicator()
+	assert.Equal(t, "UP", s)
+
+	// the streams returning by themselves keep their results
+	err := d.StreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		assert.Equal(t, 1, d.Streams())
+		return status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 0, d.Streams())
+
+	// the streams open are closed after the grace period
+	started := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		result <- d.StreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+			close(started)
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		})
+	}()
+	<-started
+	d.Drain()
+	assert.True(t, d.Draining())
+	s, details := d.ReadinessIndicator()
+	assert.Equal(t, "DOWN", s)
+	assert.Equal(t, 1, details["streams"])
+
+	// the new streams are rejected
+	err = d.StreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		t.Fatal("the stream shouldn't be handled")
+		return nil
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	assert.False(t, d.Wait(10*time.Millisecond))
+	assert.Equal(t, codes.Unavailable, status.Code(<-result))
+	assert.True(t, d.Wait(time.Second))
+	assert.Equal(t, 0, d.Streams())
+}
+
+func TestDrainerWithoutStreams(t *testing.T) {
+	d := NewDrainer(time.Hour, nil)
+	d.Drain()
+	d.Drain()
+	assert.True(t, d.Wait(time.Second))
+}
+
+func TestDrainEndpoint(t *testing.T) {
+	defer SetDrainer(nil)
+	e := NewDrainEndpoint()
+	_, err := e.Handle(context.Background(), nil)
+	assert.Equal(t, ErrNotDraining, err)
+
+	d := NewDrainer(time.Second, []string{"token"})
+	SetDrainer(d)
+	resp, err := e.Handle(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, false, resp["draining"])
+
+	// the callers without the token can't drain
+	_, err = e.Handle(context.Background(), &testParams{params: []string{drainParam}})
+	assert.Equal(t, ErrDrainForbidden, err)
+	_, err = e.Handle(actuator.WithToken(context.Background(), "other"), &testParams{params: []string{drainParam}})
+	assert.Equal(t, ErrDrainForbidden, err)
+	assert.False(t, d.Draining())
+
+	resp, err = e.Handle(actuator.WithToken(context.Background(), "token"), &testParams{params: []string{drainParam}})
+	assert.Nil(t, err)
+	assert.Equal(t, true, resp["draining"])
+	assert.True(t, d.Draining())
+
+	// no tokens are configured
+	SetDrainer(NewDrainer(time.Second, nil))
+	_, err = e.Handle(actuator.WithToken(context.Background(), "token"), &testParams{params: []string{drainParam}})
+	assert.Equal(t, ErrDrainForbidden, err)
+}
+
+type testParams struct {
+	params []string
+}
+
+func (p *testParams) Next() string {
+	next := p.params[0]
+	p.params = p.params[1:]
+	return next
+}
+
+func (p *testParams) HasNext() bool {
+	return len(p.params) > 0
+}
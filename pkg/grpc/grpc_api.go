@@ -28,6 +28,7 @@ import (
 	"mosn.io/layotto/components/lock"
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/sequencer"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
 )
 
@@ -54,4 +55,8 @@ type ApplicationContext struct {
 	Sequencers            map[string]sequencer.Store
 	SendToOutputBindingFn func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error)
 	SecretStores          map[string]secretstores.SecretStore
+	// ListOutputBindingsFn returns the operations of the output bindings by their names
+	ListOutputBindingsFn func() map[string][]bindings.OperationKind
+	// AppCallback is used to call the app if not nil, otherwise the callback connection is used
+	AppCallback runtimev1pb.AppCallbackClient
 }
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+const defaultDrainGrace = 10 * time.Second
+
+var (
+	ErrServerConfigNegative = errors.New("the durations and limits of grpc server can't be negative")
+	ErrDrainTokenEmpty      = errors.New("the drain tokens of grpc server shouldn't be empty")
+)
+
+// ServerConfig tunes the connections of the runtime server, e.g. to roll the sidecars without breaking the streams abruptly
+type ServerConfig struct {
+	// MaxConcurrentStreams limits the concurrent streams of each connection, it's unlimited if it's 0
+	MaxConcurrentStreams uint32           `json:"max_concurrent_streams,omitempty"`
+	Keepalive            *KeepaliveConfig `json:"keepalive,omitempty"`
+	// DrainGraceMs is how long the streams are kept after the server starts draining, 10 seconds by default
+	DrainGraceMs int `json:"drain_grace_ms,omitempty"`
+	// DrainTokens authorize the callers of the actuator endpoint draining the server by the header layotto-actuator-token,
+	// the endpoint can't drain the server if it's empty, which drains only before stopping then
+	DrainTokens []string `json:"drain_tokens,omitempty"`
+}
+
+// KeepaliveConfig is the keepalive parameters and the enforcement policy of the server
+type KeepaliveConfig struct {
+	// TimeMs pings the client after the connection is idle for it
+	TimeMs int `json:"time_ms,omitempty"`
+	// TimeoutMs closes the connection if the ping isn't acknowledged in it
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+	// MaxConnectionIdleMs closes the connections without calls for it with GOAWAY
+	MaxConnectionIdleMs int `json:"max_connection_idle_ms,omitempty"`
+	// MaxConnectionAgeMs sends GOAWAY to the connections older than it, so the clients reconnect gradually
+	MaxConnectionAgeMs int `json:"max_connection_age_ms,omitempty"`
+	// MaxConnectionAgeGraceMs is how long the calls are kept after GOAWAY for the max connection age, forever by default
+	MaxConnectionAgeGraceMs int `json:"max_connection_age_grace_ms,omitempty"`
+	// MinTimeMs is the minimum interval of the pings of the clients, the connections pinging more frequently are closed
+	MinTimeMs int `json:"min_time_ms,omitempty"`
+	// PermitWithoutStream allows the clients to ping without calls
+	PermitWithoutStream bool `json:"permit_without_stream,omitempty"`
+}
+
+// Validate checks the config
+func (c *ServerConfig) Validate() error {
+	if c.DrainGraceMs < 0 {
+		return ErrServerConfigNegative
+	}
+	for _, token := range c.DrainTokens {
+		if token == "" {
+			return ErrDrainTokenEmpty
+		}
+	}
+	if k := c.Keepalive; k != nil {
+		for _, v := range []int{k.TimeMs, k.TimeoutMs, k.MaxConnectionIdleMs, k.MaxConnectionAgeMs, k.MaxConnectionAgeGraceMs, k.MinTimeMs} {
+			if v < 0 {
+				return ErrServerConfigNegative
+			}
+		}
+	}
+	return nil
+}
+
+// DrainGrace returns how long the streams are kept after the server starts draining
+func (c *ServerConfig) DrainGrace() time.Duration {
+	if c.DrainGraceMs > 0 {
+		return time.Duration(c.DrainGraceMs) * time.Millisecond
+	}
+	return defaultDrainGrace
+}
+
+// ServerOptions returns the options of the grpc server, the parameters not configured are the defaults of grpc
+func (c *ServerConfig) ServerOptions() []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if c.MaxConcurrentStreams > 0 {
+		options = append(options, grpc.MaxConcurrentStreams(c.MaxConcurrentStreams))
+	}
+	k := c.Keepalive
+	if k == nil {
+		return options
+	}
+	options = append(options, grpc.KeepaliveParams(keepalive.ServerParameters{
+		MaxConnectionIdle:     millis(k.MaxConnectionIdleMs),
+		MaxConnectionAge:      millis(k.MaxConnectionAgeMs),
+		MaxConnectionAgeGrace: millis(k.MaxConnectionAgeGraceMs),
+		Time:                  millis(k.TimeMs),
+		Timeout:               millis(k.TimeoutMs),
+	}))
+	if k.MinTimeMs > 0 || k.PermitWithoutStream {
+		options = append(options, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             millis(k.MinTimeMs),
+			PermitWithoutStream: k.PermitWithoutStream,
+		}))
+	}
+	return options
+}
+
+// millis converts the milliseconds to the duration, 0 is left for the default of grpc
+func millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfig(t *testing.T) {
+	c := &ServerConfig{}
+	assert.Nil(t, c.Validate())
+	assert.Empty(t, c.ServerOptions())
+	assert.Equal(t, defaultDrainGrace, c.DrainGrace())
+
+	c = &ServerConfig{
+		MaxConcurrentStreams: 100,
+		DrainGraceMs:         3000,
+		Keepalive: &KeepaliveConfig{
+			TimeMs:             60000,
+			MaxConnectionAgeMs: 600000,
+			MinTimeMs:          10000,
+		},
+	}
+	assert.Nil(t, c.Validate())
+	assert.Len(t, c.ServerOptions(), 3)
+	assert.Equal(t, 3*time.Second, c.DrainGrace())
+
+	c.Keepalive.MinTimeMs = 0
+	assert.Len(t, c.ServerOptions(), 2)
+
+	c.Keepalive.TimeoutMs = -1
+	assert.Equal(t, ErrServerConfigNegative, c.Validate())
+	c = &ServerConfig{DrainGraceMs: -1}
+	assert.Equal(t, ErrServerConfigNegative, c.Validate())
+	c = &ServerConfig{DrainTokens: []string{""}}
+	assert.Equal(t, ErrDrainTokenEmpty, c.Validate())
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jsonpath implements the subset of JSONPath used to select the fields of json documents in the configs,
+// e.g. `$.user.email`, `$.cards[*].number`, `$['x-token']` and `$.items[0]`.
+// The documents are the values decoded by encoding/json into interface{}.
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment is a step of the path, which selects a field, an element or all the children
+type segment struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Path is a parsed JSONPath
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Parse parses the JSONPath, which starts with `$` and consists of
+// `.name`, `['name']`, `[n]` (negative from the end), `.*` and `[*]`.
+func Parse(expr string) (*Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath %q should start with $", expr)
+	}
+	p := &Path{expr: expr}
+	rest := expr[1:]
+	for rest != "" {
+		var seg segment
+		var err error
+		switch rest[0] {
+		case '.':
+			seg, rest, err = parseDot(rest[1:])
+		case '[':
+			seg, rest, err = parseBracket(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected %q", rest[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid jsonpath %q: %v", expr, err)
+		}
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+func parseDot(s string) (segment, string, error) {
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		end = len(s)
+	}
+	name := s[:end]
+	if name == "" {
+		return segment{}, "", errors.New("empty field name")
+	}
+	if name == "*" {
+		return segment{wildcard: true}, s[end:], nil
+	}
+	return segment{field: name}, s[end:], nil
+}
+
+func parseBracket(s string) (segment, string, error) {
+	if s != "" && (s[0] == '\'' || s[0] == '"') {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 || !strings.HasPrefix(s[end+2:], "]") {
+			return segment{}, "", errors.New("unterminated quoted field name")
+		}
+		return segment{field: s[1 : end+1]}, s[end+3:], nil
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return segment{}, "", errors.New("missing ]")
+	}
+	if s[:end] == "*" {
+		return segment{wildcard: true}, s[end+1:], nil
+	}
+	i, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return segment{}, "", fmt.Errorf("invalid index %q", s[:end])
+	}
+	return segment{index: i, isIndex: true}, s[end+1:], nil
+}
+
+// MustParse is like Parse but panics if the path is invalid
+func MustParse(expr string) *Path {
+	p, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the expression of the path
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Definite reports whether the path selects at most one value, i.e. it has no wildcards
+func (p *Path) Definite() bool {
+	for _, s := range p.segments {
+		if s.wildcard {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the values selected by the path in the document
+func (p *Path) Get(doc interface{}) []interface{} {
+	var values []interface{}
+	p.Update(doc, func(v interface{}) (interface{}, bool) {
+		values = append(values, v)
+		return v, true
+	})
+	return values
+}
+
+// Update replaces the values selected by the path with the results of fn,
+// and removes them from the objects or arrays if fn returns false.
+// It returns the new document and the number of values selected.
+// The document is modified in place, except that the root or the arrays with removed elements are replaced.
+func (p *Path) Update(doc interface{}, fn func(v interface{}) (interface{}, bool)) (interface{}, int) {
+	v, _, n := update(doc, p.segments, fn)
+	return v, n
+}
+
+// Delete removes the values selected by the path, and returns the new document and the number of values removed.
+func (p *Path) Delete(doc interface{}) (interface{}, int) {
+	return p.Update(doc, func(interface{}) (interface{}, bool) {
+		return nil, false
+	})
+}
+
+func update(node interface{}, segments []segment, fn func(v interface{}) (interface{}, bool)) (interface{}, bool, int) {
+	if len(segments) == 0 {
+		v, keep := fn(node)
+		return v, keep, 1
+	}
+	seg, rest := segments[0], segments[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if seg.isIndex {
+			return node, true, 0
+		}
+		total := 0
+		for k, child := range n {
+			if !seg.wildcard && k != seg.field {
+				continue
+			}
+			v, keep, count := update(child, rest, fn)
+			if keep {
+				n[k] = v
+			} else {
+				delete(n, k)
+			}
+			total += count
+		}
+		return n, true, total
+	case []interface{}:
+		if !seg.isIndex && !seg.wildcard {
+			return node, true, 0
+		}
+		total := 0
+		kept := n[:0:0]
+		for i, child := range n {
+			if !seg.wildcard && i != normalizeIndex(seg.index, len(n)) {
+				kept = append(kept, child)
+				continue
+			}
+			v, keep, count := update(child, rest, fn)
+			if keep {
+				kept = append(kept, v)
+			}
+			total += count
+		}
+		if len(kept) == len(n) {
+			copy(n, kept)
+			return n, true, total
+		}
+		return kept, true, total
+	}
+	return node, true, 0
+}
+
+func normalizeIndex(i int, length int) int {
+	if i < 0 {
+		return length + i
+	}
+	return i
+}
+
+// Set sets the value at the path and returns the new document.
+// The missing objects on the path are created, and the path should be definite.
+func (p *Path) Set(doc interface{}, value interface{}) (interface{}, error) {
+	if !p.Definite() {
+		return doc, fmt.Errorf("can't set the value at the indefinite jsonpath %s", p.expr)
+	}
+	return set(doc, p.segments, value, p.expr)
+}
+
+func set(node interface{}, segments []segment, value interface{}, expr string) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	seg, rest := segments[0], segments[1:]
+	if seg.isIndex {
+		arr, ok := node.([]interface{})
+		if !ok {
+			return node, fmt.Errorf("the parent of index %d in jsonpath %s isn't an array", seg.index, expr)
+		}
+		i := normalizeIndex(seg.index, len(arr))
+		if i < 0 || i >= len(arr) {
+			return node, fmt.Errorf("index %d in jsonpath %s is out of range", seg.index, expr)
+		}
+		v, err := set(arr[i], rest, value, expr)
+		arr[i] = v
+		return arr, err
+	}
+	if node == nil {
+		node = make(map[string]interface{})
+	}
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return node, fmt.Errorf("the parent of field %s in jsonpath %s isn't an object", seg.field, expr)
+	}
+	v, err := set(obj[seg.field], rest, value, expr)
+	obj[seg.field] = v
+	return obj, err
+}
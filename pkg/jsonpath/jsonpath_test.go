@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var doc interface{}
+	assert.Nil(t, json.Unmarshal([]byte(s), &doc))
+	return doc
+}
+
+func encode(t *testing.T, doc interface{}) string {
+	b, err := json.Marshal(doc)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+const order = `{"user": {"name": "alice", "email": "a@example.com"}, "x-token": "t",
+  "cards": [{"number": "4111", "cvv": "123"}, {"number": "5500", "cvv": "456"}]}`
+
+func TestParse(t *testing.T) {
+	for _, expr := range []string{"$", "$.a.b", "$['x-token']", `$["a"][0]`, "$.a[*].b", "$.*", "$.a[-1]"} {
+		_, err := Parse(expr)
+		assert.Nil(t, err, expr)
+	}
+	for _, expr := range []string{"", "a.b", "$.", "$..a", "$[", "$['a'", "$[a]", "$a"} {
+		_, err := Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+	assert.True(t, MustParse("$.a[0]").Definite())
+	assert.False(t, MustParse("$.a[*]").Definite())
+}
+
+func TestGet(t *testing.T) {
+	doc := decode(t, order)
+	assert.Equal(t, []interface{}{"a@example.com"}, MustParse("$.user.email").Get(doc))
+	assert.Equal(t, []interface{}{"t"}, MustParse("$['x-token']").Get(doc))
+	assert.ElementsMatch(t, []interface{}{"4111", "5500"}, MustParse("$.cards[*].number").Get(doc))
+	assert.Equal(t, []interface{}{"5500"}, MustParse("$.cards[-1].number").Get(doc))
+	assert.Empty(t, MustParse("$.user.phone").Get(doc))
+	assert.Empty(t, MustParse("$.user[0]").Get(doc))
+	assert.Equal(t, []interface{}{doc}, MustParse("$").Get(doc))
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	doc := decode(t, order)
+	doc, n := MustParse("$.cards[*].number").Update(doc, func(v interface{}) (interface{}, bool) {
+		return "****", true
+	})
+	assert.Equal(t, 2, n)
+	doc, n = MustParse("$.cards[*].cvv").Delete(doc)
+	assert.Equal(t, 2, n)
+	doc, n = MustParse("$.user.email").Delete(doc)
+	assert.Equal(t, 1, n)
+	assert.JSONEq(t, `{"user": {"name": "alice"}, "x-token": "t", "cards": [{"number": "****"}, {"number": "****"}]}`, encode(t, doc))
+
+	// removing elements of arrays
+	doc, n = MustParse("$.cards[0]").Delete(doc)
+	assert.Equal(t, 1, n)
+	assert.JSONEq(t, `{"user": {"name": "alice"}, "x-token": "t", "cards": [{"number": "****"}]}`, encode(t, doc))
+}
+
+func TestSet(t *testing.T) {
+	doc, err := MustParse("$.user.address.city").Set(nil, "Hangzhou")
+	assert.Nil(t, err)
+	doc, err = MustParse("$.user.id").Set(doc, 1)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"user": {"id": 1, "address": {"city": "Hangzhou"}}}`, encode(t, doc))
+
+	_, err = MustParse("$.user[*]").Set(doc, 1)
+	assert.NotNil(t, err)
+	_, err = MustParse("$.user.id.x").Set(doc, 1)
+	assert.NotNil(t, err)
+	_, err = MustParse("$.user[3]").Set(doc, 1)
+	assert.NotNil(t, err)
+}
@@ -24,6 +24,18 @@ const (
 	ErrPubsubCloudEventsSer     = "error when marshalling cloud event envelope for topic %s pubsub %s: %s"
 	ErrPubsubPublishMessage     = "error when publish to topic %s in pubsub %s: %s"
 	ErrPubsubCloudEventCreation = "cannot create cloudevent: %s"
+	ErrPubsubAsyncNotEnabled    = "async publishing is not enabled in pubsub %s"
+	ErrPubsubAsyncEnqueue       = "error when enqueue the event to topic %s in pubsub %s: %s"
+	ErrPubsubFlush              = "error when flushing pubsub %s: %s"
+	ErrSubscriptionNotFound     = "subscription to topic %s in pubsub %s not found"
+	ErrSubscriptionDrain        = "error when draining the subscription to topic %s in pubsub %s: %s"
+	ErrPubsubReplayNotSupported = "replaying messages is not supported by pubsub %s"
+	ErrPubsubReplayRange        = "invalid range of messages to replay"
+	ErrPubsubReplay             = "error when replaying topic %s in pubsub %s after %d messages: %s"
+	ErrSubscriptionExists       = "topic %s in pubsub %s is already subscribed"
+	ErrPubsubSubscribe          = "error when subscribing to topic %s in pubsub %s: %s"
+	// Rpc
+	ErrPayloadSchemaNotConfigured = "payload schema is not configured in rpc"
 	// Http.
 	ErrNotFound             = "method %q is not found"
 	ErrMalformedRequest     = "failed deserializing HTTP body: %s"
@@ -35,13 +47,35 @@ const (
 	ErrStateDelete              = "failed deleting state with key %s: %s"
 	ErrStateSave                = "failed saving state in state store %s: %s"
 	ErrStateQuery               = "failed query in state store %s: %s"
+	ErrStateQueryNotSupported   = "state store %s doesn't support query"
+	ErrStateQueryInvalid        = "the query of state store %s is invalid: %s"
+	ErrStateStoreNotSupportETag = "state store %s doesn't support etag"
+	ErrStateCreateNotSupported  = "state store %s doesn't support atomic set-if-absent"
+	ErrStateIncrement           = "failed incrementing %s in state store %s: %s"
+	ErrStateIdempotency         = "failed recording the idempotency key %s in state store %s: %s"
+	ErrSessionNotFound          = "session %s is not found or expired in state store %s"
+	ErrSession                  = "failed handling session %s in state store %s: %s"
+	ErrStateDeleteByPrefix      = "failed deleting the keys with prefix %s in state store %s: %s"
+	ErrStateDeleteNotConfirmed  = "the deletion of the keys with prefix %s in state store %s is not confirmed"
+	ErrStateContentType         = "content type of %s in state store %s is unexpected: %s"
+	ErrStateTTLInvalid          = "ttl of %s in state store %s is invalid: %s"
 	// StateTransaction
 	ErrStateStoreNotSupported     = "state store %s doesn't support transaction"
 	ErrNotSupportedStateOperation = "operation type %s not supported"
 	ErrStateTransaction           = "error while executing state transaction: %s"
+	ErrStateCompensationRecord    = "failed saving compensation record in state store %s: %s"
+	ErrStateOutboxNotSupported    = "state store %s doesn't support outbox"
+	ErrStateOutboxInvalid         = "outbox message %d of the transaction is invalid: %s"
+	// Configuration
+	ErrConfigStoreNotFound = "configure store [%+v] don't support now"
+	ErrFeatureFlagEmpty    = "feature flag is empty in config store %s"
+	ErrFeatureFlagNotFound = "feature flag %s not found in config store %s"
+	ErrFeatureFlagInvalid  = "feature flag %s in config store %s is invalid: %s"
+	ErrFeatureFlagEvaluate = "error when evaluate feature flag %s in config store %s: %s"
 	//	Lock
 	ErrLockStoresNotConfigured = "lock store is not configured"
 	ErrResourceIdEmpty         = "ResourceId is empty in lock store %s"
+	ErrResourceIdsTooMany      = "the number of ResourceIds exceeds %d in lock store %s"
 	ErrLockOwnerEmpty          = "LockOwner is empty in lock store %s"
 	ErrExpireNotPositive       = "Expire is not positive in lock store %s"
 	ErrLockStoreNotFound       = "lock store %s not found"
@@ -50,8 +84,16 @@ const (
 	ErrSequencerKeyEmpty            = "Key is empty in sequencer store %s"
 	ErrSequencerStoreNotFound       = "Sequencer store %s not found"
 
+	// Logger
+	ErrInvalidLogLevel        = "invalid log level %q, expected one of FATAL, ERROR, WARN, INFO, DEBUG and TRACE"
+	ErrLogModuleEmpty         = "log module is empty"
+	ErrLogModulesNotInstalled = "the levels of log modules aren't supported, since the logger of modules isn't installed"
+
 	// Binding.
-	ErrInvokeOutputBinding = "error when invoke output binding %s: %s"
+	ErrInvokeOutputBinding    = "error when invoke output binding %s: %s"
+	ErrBindingNotFound        = "output binding %s is not found"
+	ErrBindingMetadataInvalid = "invalid metadata of output binding %s: %s"
+	ErrBindingEgressDenied    = "output binding %s is denied by the egress policy: %s"
 
 	// Secret
 	ErrSecretStoreNotConfigured = "error when get secret but not find configured"
@@ -59,4 +101,8 @@ const (
 	ErrSecretGet                = "error when get secret : secret name => %s,store name =>%s,error => %s"
 	ErrBulkSecretGet            = "error when bulk get secret %s: %s"
 	ErrPermissionDenied         = "access denied by policy to get %s from %s"
+	ErrSecretWatchNotSupported  = "secret store %s doesn't support watching secrets"
+	ErrSecretWatch              = "error when watch secrets in store %s: %s"
+	ErrSecretTemplateEmpty      = "secret template is empty"
+	ErrSecretTemplate           = "error when render the secret template: %s"
 )
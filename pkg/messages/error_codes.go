@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package messages
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// errorCodes maps the messages to the error codes attached to the errors
+var errorCodes = map[string]runtimev1pb.ErrorCode{
+	// PubSub
+	ErrPubsubEmpty:              runtimev1pb.ErrorCode_PUBSUB_NAME_EMPTY,
+	ErrPubsubNotFound:           runtimev1pb.ErrorCode_PUBSUB_NOT_FOUND,
+	ErrTopicEmpty:               runtimev1pb.ErrorCode_PUBSUB_TOPIC_EMPTY,
+	ErrPubsubCloudEventsSer:     runtimev1pb.ErrorCode_PUBSUB_PUBLISH_FAILED,
+	ErrPubsubPublishMessage:     runtimev1pb.ErrorCode_PUBSUB_PUBLISH_FAILED,
+	ErrPubsubCloudEventCreation: runtimev1pb.ErrorCode_PUBSUB_PUBLISH_FAILED,
+	ErrPubsubAsyncEnqueue:       runtimev1pb.ErrorCode_PUBSUB_PUBLISH_FAILED,
+	ErrSubscriptionNotFound:     runtimev1pb.ErrorCode_PUBSUB_SUBSCRIPTION_NOT_FOUND,
+	ErrPubsubReplayNotSupported: runtimev1pb.ErrorCode_PUBSUB_REPLAY_NOT_SUPPORTED,
+	ErrSubscriptionExists:       runtimev1pb.ErrorCode_PUBSUB_SUBSCRIPTION_EXISTS,
+	// Rpc
+	ErrCircuitBreakerNotConfigured: runtimev1pb.ErrorCode_RPC_CIRCUIT_BREAKER_NOT_CONFIGURED,
+	ErrPayloadSchemaNotConfigured:  runtimev1pb.ErrorCode_RPC_PAYLOAD_SCHEMA_NOT_CONFIGURED,
+	// State
+	ErrStateStoresNotConfigured: runtimev1pb.ErrorCode_STATE_STORE_NOT_CONFIGURED,
+	ErrStateStoreNotFound:       runtimev1pb.ErrorCode_STATE_STORE_NOT_FOUND,
+	ErrStateGet:                 runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateDelete:              runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateSave:                runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateQuery:               runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateQueryNotSupported:   runtimev1pb.ErrorCode_STATE_QUERY_NOT_SUPPORTED,
+	ErrStateIncrement:           runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateIdempotency:         runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrSessionNotFound:          runtimev1pb.ErrorCode_STATE_SESSION_NOT_FOUND,
+	ErrSession:                  runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateStoreNotSupportETag: runtimev1pb.ErrorCode_STATE_ETAG_NOT_SUPPORTED,
+	ErrStateCreateNotSupported:  runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateContentType:         runtimev1pb.ErrorCode_STATE_CONTENT_TYPE_MISMATCH,
+	// StateTransaction
+	ErrStateStoreNotSupported:  runtimev1pb.ErrorCode_STATE_TRANSACTION_NOT_SUPPORTED,
+	ErrStateTransaction:        runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateCompensationRecord: runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	ErrStateOutboxNotSupported: runtimev1pb.ErrorCode_STATE_TRANSACTION_NOT_SUPPORTED,
+	ErrStateOutboxInvalid:      runtimev1pb.ErrorCode_STATE_OPERATION_FAILED,
+	// Configuration
+	ErrConfigStoreNotFound: runtimev1pb.ErrorCode_CONFIG_STORE_NOT_FOUND,
+	ErrFeatureFlagNotFound: runtimev1pb.ErrorCode_FEATURE_FLAG_NOT_FOUND,
+	ErrFeatureFlagInvalid:  runtimev1pb.ErrorCode_FEATURE_FLAG_INVALID,
+	// Lock
+	ErrLockStoresNotConfigured: runtimev1pb.ErrorCode_LOCK_STORE_NOT_CONFIGURED,
+	ErrLockStoreNotFound:       runtimev1pb.ErrorCode_LOCK_STORE_NOT_FOUND,
+	// Sequencer
+	ErrSequencerStoresNotConfigured: runtimev1pb.ErrorCode_SEQUENCER_STORE_NOT_CONFIGURED,
+	ErrSequencerStoreNotFound:       runtimev1pb.ErrorCode_SEQUENCER_STORE_NOT_FOUND,
+	// Binding
+	ErrInvokeOutputBinding:    runtimev1pb.ErrorCode_BINDING_INVOKE_FAILED,
+	ErrBindingNotFound:        runtimev1pb.ErrorCode_BINDING_NOT_FOUND,
+	ErrBindingMetadataInvalid: runtimev1pb.ErrorCode_BINDING_METADATA_INVALID,
+	ErrBindingEgressDenied:    runtimev1pb.ErrorCode_BINDING_EGRESS_DENIED,
+	// Secret
+	ErrSecretStoreNotConfigured: runtimev1pb.ErrorCode_SECRET_STORE_NOT_CONFIGURED,
+	ErrSecretStoreNotFound:      runtimev1pb.ErrorCode_SECRET_STORE_NOT_FOUND,
+	ErrPermissionDenied:         runtimev1pb.ErrorCode_SECRET_PERMISSION_DENIED,
+	ErrSecretWatchNotSupported:  runtimev1pb.ErrorCode_SECRET_WATCH_NOT_SUPPORTED,
+	ErrSecretTemplateEmpty:      runtimev1pb.ErrorCode_SECRET_TEMPLATE_INVALID,
+	ErrSecretTemplate:           runtimev1pb.ErrorCode_SECRET_TEMPLATE_INVALID,
+}
+
+// Errorf returns the status error of the message like status.Errorf,
+// and attaches the ErrorInfo with the error code of the message if there is one.
+func Errorf(c codes.Code, format string, a ...interface{}) error {
+	return WithErrorCode(status.Newf(c, format, a...), errorCodes[format])
+}
+
+// Error returns the status error of the message like status.Error,
+// and attaches the ErrorInfo with the error code of the message if there is one.
+func Error(c codes.Code, msg string) error {
+	return WithErrorCode(status.New(c, msg), errorCodes[msg])
+}
+
+// WithErrorCode attaches the ErrorInfo with the error code to the status, and returns its error
+func WithErrorCode(s *status.Status, code runtimev1pb.ErrorCode) error {
+	if code == runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED {
+		return s.Err()
+	}
+	d, err := s.WithDetails(&runtimev1pb.ErrorInfo{Code: code})
+	if err != nil {
+		return s.Err()
+	}
+	return d.Err()
+}
+
+// ErrorCodeOf returns the error code attached to the error
+func ErrorCodeOf(err error) runtimev1pb.ErrorCode {
+	s, ok := status.FromError(err)
+	if !ok {
+		return runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*runtimev1pb.ErrorInfo); ok {
+			return info.Code
+		}
+	}
+	return runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+}
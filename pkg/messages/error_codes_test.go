@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package messages
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestErrorf(t *testing.T) {
+	err := Errorf(codes.InvalidArgument, ErrStateStoreNotFound, "redis")
+	s := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, s.Code())
+	assert.Equal(t, "state store redis is not found", s.Message())
+	assert.Equal(t, runtimev1pb.ErrorCode_STATE_STORE_NOT_FOUND, ErrorCodeOf(err))
+}
+
+func TestError(t *testing.T) {
+	err := Error(codes.FailedPrecondition, ErrLockStoresNotConfigured)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_LOCK_STORE_NOT_CONFIGURED, ErrorCodeOf(err))
+}
+
+func TestErrorWithoutCode(t *testing.T) {
+	err := Errorf(codes.InvalidArgument, "request can't be nil")
+	s := status.Convert(err)
+	assert.Equal(t, "request can't be nil", s.Message())
+	assert.Empty(t, s.Details())
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCodeOf(err))
+}
+
+func TestWithErrorCode(t *testing.T) {
+	err := WithErrorCode(status.New(codes.Aborted, "etag mismatch"), runtimev1pb.ErrorCode_STATE_ETAG_MISMATCH)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, runtimev1pb.ErrorCode_STATE_ETAG_MISMATCH, ErrorCodeOf(err))
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCodeOf(nil))
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCodeOf(errors.New("boom")))
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package push provides the metrics sinks which push metrics to the remote periodically,
+// for the environments without a scrape infrastructure.
+package push
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	defaultPrefix        = "layotto"
+)
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	percentiles      = []float64{0.5, 0.9, 0.99}
+)
+
+// Config is the common config of the push sinks
+type Config struct {
+	// FlushIntervalMs is the interval to push metrics, 10s by default
+	FlushIntervalMs int `json:"flush_interval_ms"`
+	// Prefix is prepended to the name of the metrics, "layotto" by default
+	Prefix string `json:"prefix"`
+	// Labels are added to all the metrics, e.g. the app name or the region
+	Labels map[string]string `json:"labels"`
+}
+
+func parseConfig(config map[string]interface{}, target interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (c *Config) flushInterval() time.Duration {
+	if c.FlushIntervalMs <= 0 {
+		return defaultFlushInterval
+	}
+	return time.Duration(c.FlushIntervalMs) * time.Millisecond
+}
+
+type sampleKind int
+
+const (
+	kindCounter sampleKind = iota
+	kindGauge
+)
+
+// sample is a value of a series at the flush time
+type sample struct {
+	name string
+	kind sampleKind
+	// labels are sorted by name
+	labels []label
+	value  float64
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+// key identifies the series of the sample
+func (s *sample) key() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	for _, l := range s.labels {
+		b.WriteByte(',')
+		b.WriteString(l.name)
+		b.WriteByte('=')
+		b.WriteString(l.value)
+	}
+	return b.String()
+}
+
+// collect converts the metrics into samples. Counters keep the cumulative value,
+// and histograms are converted into a count, a sum and gauges of percentiles.
+// The sum is a gauge, since it's summed over the samples kept by the histogram and it may decrease.
+func collect(prefix string, constLabels map[string]string, ms []types.Metrics) []*sample {
+	var res []*sample
+	for _, m := range ms {
+		base := make(map[string]string, len(constLabels)+len(m.Labels()))
+		for k, v := range m.Labels() {
+			base[k] = v
+		}
+		for k, v := range constLabels {
+			base[k] = v
+		}
+		namePrefix := prefix + "_" + m.Type() + "_"
+		m.Each(func(key string, i interface{}) {
+			name := sanitize(namePrefix + key)
+			switch metric := i.(type) {
+			case gometrics.Counter:
+				res = append(res, newSample(name, kindCounter, base, nil, float64(metric.Count())))
+			case gometrics.Gauge:
+				res = append(res, newSample(name, kindGauge, base, nil, float64(metric.Value())))
+			case gometrics.GaugeFloat64:
+				res = append(res, newSample(name, kindGauge, base, nil, metric.Value()))
+			case gometrics.Histogram:
+				snapshot := metric.Snapshot()
+				res = append(res,
+					newSample(name+"_count", kindCounter, base, nil, float64(snapshot.Count())),
+					newSample(name+"_sum", kindGauge, base, nil, float64(snapshot.Sum())))
+				ps := snapshot.Percentiles(percentiles)
+				for idx, p := range percentiles {
+					res = append(res, newSample(name, kindGauge, base, map[string]string{"quantile": formatFloat(p)}, ps[idx]))
+				}
+			default:
+				log.DefaultLogger.Debugf("[metrics] unsupported metric %s of type %T", name, i)
+			}
+		})
+	}
+	return res
+}
+
+func newSample(name string, kind sampleKind, base map[string]string, extra map[string]string, value float64) *sample {
+	s := &sample{name: name, kind: kind, value: value, labels: make([]label, 0, len(base)+len(extra))}
+	for k, v := range base {
+		s.labels = append(s.labels, label{name: sanitize(k), value: v})
+	}
+	for k, v := range extra {
+		s.labels = append(s.labels, label{name: k, value: v})
+	}
+	sort.Slice(s.labels, func(i, j int) bool {
+		return s.labels[i].name < s.labels[j].name
+	})
+	return s
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func sanitize(name string) string {
+	return invalidNameChars.ReplaceAllString(name, "_")
+}
+
+// pusher is implemented by the sinks
+type pusher interface {
+	push(samples []*sample) error
+}
+
+// sink implements types.MetricsSink, it pushes all the metrics periodically.
+type sink struct {
+	name   string
+	config Config
+	pusher pusher
+	stopCh chan struct{}
+}
+
+var _ types.MetricsSink = &sink{}
+
+func newSink(name string, config Config, p pusher) *sink {
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	return &sink{name: name, config: config, pusher: p, stopCh: make(chan struct{})}
+}
+
+// Flush pushes the metrics, the writer is ignored since the metrics are sent to the remote
+func (s *sink) Flush(writer io.Writer, ms []types.Metrics) {
+	samples := collect(s.config.Prefix, s.config.Labels, ms)
+	if len(samples) == 0 {
+		return
+	}
+	if err := s.pusher.push(samples); err != nil {
+		log.DefaultLogger.Errorf("[metrics] [%s] fail to push %d samples: %v", s.name, len(samples), err)
+	}
+}
+
+func (s *sink) start() {
+	utils.GoWithRecover(func() {
+		ticker := time.NewTicker(s.config.flushInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Flush(nil, metrics.GetAll())
+			case <-s.stopCh:
+				return
+			}
+		}
+	}, nil)
+}
+
+func (s *sink) stop() {
+	close(s.stopCh)
+}
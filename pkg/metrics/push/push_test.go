@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package push
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+)
+
+// newTestMetrics creates the metrics of the type, each test uses its own type since the metrics are global
+func newTestMetrics(t *testing.T, typ string) []types.Metrics {
+	m, err := metrics.NewMetrics(typ, map[string]string{"component": "redis"})
+	assert.Nil(t, err)
+	m.Counter("requests").Inc(3)
+	m.Gauge("conns").Update(2)
+	m.Histogram("rt").Update(10)
+	return []types.Metrics{m}
+}
+
+func TestCollect(t *testing.T) {
+	samples := collect("layotto", map[string]string{"app": "demo"}, newTestMetrics(t, "push_collect"))
+	byKey := make(map[string]*sample)
+	for _, s := range samples {
+		byKey[s.key()] = s
+	}
+	s := byKey["layotto_push_collect_requests,app=demo,component=redis"]
+	if assert.NotNil(t, s) {
+		assert.Equal(t, kindCounter, s.kind)
+		assert.Equal(t, float64(3), s.value)
+	}
+	assert.Equal(t, float64(2), byKey["layotto_push_collect_conns,app=demo,component=redis"].value)
+	assert.Equal(t, float64(1), byKey["layotto_push_collect_rt_count,app=demo,component=redis"].value)
+	assert.Equal(t, kindGauge, byKey["layotto_push_collect_rt_sum,app=demo,component=redis"].kind)
+	assert.Equal(t, float64(10), byKey["layotto_push_collect_rt,app=demo,component=redis,quantile=0.99"].value)
+}
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	ms := newTestMetrics(t, "push_statsd")
+
+	s, err := NewStatsdSink(map[string]interface{}{
+		"address":           conn.LocalAddr().String(),
+		"flush_interval_ms": 3600000,
+		"labels":            map[string]string{"app": "demo"},
+	})
+	assert.Nil(t, err)
+	defer s.(*sink).stop()
+
+	read := func() string {
+		buf := make([]byte, maxStatsdPacketSize)
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		return string(buf[:n])
+	}
+	s.Flush(nil, ms)
+	lines := read()
+	assert.Contains(t, lines, "layotto_push_statsd_requests.demo.redis:3|c")
+	assert.Contains(t, lines, "layotto_push_statsd_conns.demo.redis:2|g")
+
+	// only the increment of counters is sent
+	s.Flush(nil, ms)
+	lines = read()
+	assert.False(t, strings.Contains(lines, "layotto_push_statsd_requests"))
+	ms[0].Counter("requests").Inc(2)
+	s.Flush(nil, ms)
+	assert.Contains(t, read(), "layotto_push_statsd_requests.demo.redis:2|c")
+
+	t.Run("dogstatsd tags", func(t *testing.T) {
+		p := &statsdPusher{dogStatsdTags: true, counters: make(map[string]float64)}
+		line := p.format(newSample("conns", kindGauge, map[string]string{"app": "demo"}, nil, 2))
+		assert.Equal(t, "conns:2|g|#app:demo", line)
+	})
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		body, _ := ioutil.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		assert.Nil(t, err)
+		received <- decoded
+	}))
+	defer server.Close()
+
+	_, err := NewRemoteWriteSink(map[string]interface{}{})
+	assert.NotNil(t, err)
+
+	s, err := NewRemoteWriteSink(map[string]interface{}{
+		"endpoint":          server.URL,
+		"flush_interval_ms": 3600000,
+		"headers":           map[string]string{"X-Scope-OrgID": "tenant"},
+	})
+	assert.Nil(t, err)
+	defer s.(*sink).stop()
+	s.Flush(nil, newTestMetrics(t, "push_remote_write"))
+
+	select {
+	case b := <-received:
+		assert.True(t, bytes.Contains(b, []byte("layotto_push_remote_write_requests")))
+		assert.True(t, bytes.Contains(b, []byte("__name__")))
+	case <-time.After(3 * time.Second):
+		t.Fatal("metrics not pushed")
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	s := newSample("m", kindGauge, map[string]string{"A": "1", "b": "2"}, nil, 1)
+	b := encodeWriteRequest([]*sample{s}, time.Unix(1, 0))
+	// the labels are sorted: A, __name__, b
+	ia := bytes.Index(b, []byte("A"))
+	iname := bytes.Index(b, []byte("__name__"))
+	ib := bytes.LastIndex(b, []byte("b"))
+	assert.True(t, ia < iname && iname < ib)
+}
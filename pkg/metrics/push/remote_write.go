@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package push
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"mosn.io/mosn/pkg/metrics/sink"
+	"mosn.io/mosn/pkg/types"
+)
+
+const (
+	RemoteWriteSinkType = "prometheus_remote_write"
+
+	defaultRemoteWriteTimeout = 5 * time.Second
+	metricNameLabel           = "__name__"
+)
+
+func init() {
+	sink.RegisterSink(RemoteWriteSinkType, NewRemoteWriteSink)
+}
+
+// RemoteWriteConfig is the config of the prometheus remote-write sink
+type RemoteWriteConfig struct {
+	Config
+	// Endpoint is the url of remote-write, e.g. http://127.0.0.1:9090/api/v1/write
+	Endpoint  string `json:"endpoint"`
+	TimeoutMs int    `json:"timeout_ms"`
+	// Headers are added to the requests, e.g. the authorization or the tenant id
+	Headers map[string]string `json:"headers"`
+}
+
+type remoteWritePusher struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewRemoteWriteSink creates a sink pushing metrics by the prometheus remote-write protocol
+func NewRemoteWriteSink(config map[string]interface{}) (types.MetricsSink, error) {
+	var cfg RemoteWriteConfig
+	if err := parseConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint of prometheus remote-write is required")
+	}
+	p := &remoteWritePusher{
+		endpoint: cfg.Endpoint,
+		headers:  cfg.Headers,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+	}
+	if p.client.Timeout <= 0 {
+		p.client.Timeout = defaultRemoteWriteTimeout
+	}
+	s := newSink(RemoteWriteSinkType, cfg.Config, p)
+	s.start()
+	return s, nil
+}
+
+func (p *remoteWritePusher) push(samples []*sample) error {
+	body := snappy.Encode(nil, encodeWriteRequest(samples, time.Now()))
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes the samples into prometheus.WriteRequest:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(samples []*sample, now time.Time) []byte {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	var b, series, point []byte
+	for _, s := range samples {
+		series = series[:0]
+		// the labels should be sorted by name, including __name__
+		nameAppended := false
+		for _, l := range s.labels {
+			if !nameAppended && l.name > metricNameLabel {
+				series = appendLabel(series, metricNameLabel, s.name)
+				nameAppended = true
+			}
+			series = appendLabel(series, l.name, l.value)
+		}
+		if !nameAppended {
+			series = appendLabel(series, metricNameLabel, s.name)
+		}
+		point = point[:0]
+		point = protowire.AppendTag(point, 1, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, math.Float64bits(s.value))
+		point = protowire.AppendTag(point, 2, protowire.VarintType)
+		point = protowire.AppendVarint(point, uint64(ts))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, point)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, series)
+	}
+	return b
+}
+
+func appendLabel(b []byte, name string, value string) []byte {
+	var l []byte
+	l = protowire.AppendTag(l, 1, protowire.BytesType)
+	l = protowire.AppendString(l, name)
+	l = protowire.AppendTag(l, 2, protowire.BytesType)
+	l = protowire.AppendString(l, value)
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, l)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package push
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+
+	"mosn.io/mosn/pkg/metrics/sink"
+	"mosn.io/mosn/pkg/types"
+)
+
+const (
+	StatsdSinkType = "statsd"
+
+	defaultStatsdAddress = "127.0.0.1:8125"
+	// keep the packets smaller than the MTU
+	maxStatsdPacketSize = 1432
+)
+
+func init() {
+	sink.RegisterSink(StatsdSinkType, NewStatsdSink)
+}
+
+// StatsdConfig is the config of the statsd sink
+type StatsdConfig struct {
+	Config
+	// Address is the udp address of statsd, 127.0.0.1:8125 by default
+	Address string `json:"address"`
+	// DogStatsdTags sends the labels as the tags of DogStatsD, e.g. "|#k1:v1,k2:v2".
+	// Otherwise the label values are appended to the name, since the plain statsd protocol has no labels.
+	DogStatsdTags bool `json:"dogstatsd_tags"`
+}
+
+type statsdPusher struct {
+	conn          net.Conn
+	dogStatsdTags bool
+	mu            sync.Mutex
+	// counters keeps the last values of the counters, since statsd expects the increments
+	counters map[string]float64
+}
+
+// NewStatsdSink creates a sink pushing metrics to statsd by udp
+func NewStatsdSink(config map[string]interface{}) (types.MetricsSink, error) {
+	var cfg StatsdConfig
+	if err := parseConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Address == "" {
+		cfg.Address = defaultStatsdAddress
+	}
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	p := &statsdPusher{
+		conn:          conn,
+		dogStatsdTags: cfg.DogStatsdTags,
+		counters:      make(map[string]float64),
+	}
+	s := newSink(StatsdSinkType, cfg.Config, p)
+	s.start()
+	return s, nil
+}
+
+func (p *statsdPusher) push(samples []*sample) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var buf bytes.Buffer
+	var lastErr error
+	for _, s := range samples {
+		line := p.format(s)
+		if line == "" {
+			continue
+		}
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxStatsdPacketSize {
+			if _, err := p.conn.Write(buf.Bytes()); err != nil {
+				lastErr = err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := p.conn.Write(buf.Bytes()); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// format converts the sample into a line of statsd. The increment of a counter is sent,
+// and nothing is sent if the counter doesn't change.
+func (p *statsdPusher) format(s *sample) string {
+	value, typ := s.value, "g"
+	if s.kind == kindCounter {
+		key := s.key()
+		last := p.counters[key]
+		p.counters[key] = s.value
+		value, typ = s.value-last, "c"
+		// the counter is reset
+		if value < 0 {
+			value = s.value
+		}
+		if value == 0 {
+			return ""
+		}
+	}
+	var b strings.Builder
+	b.WriteString(s.name)
+	if !p.dogStatsdTags {
+		for _, l := range s.labels {
+			b.WriteByte('.')
+			b.WriteString(sanitize(l.value))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if p.dogStatsdTags && len(s.labels) > 0 {
+		b.WriteString("|#")
+		for i, l := range s.labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.name)
+			b.WriteByte(':')
+			b.WriteString(l.value)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,616 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/dapr/components-contrib/state"
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/emptypb"
+	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/file"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/diagnostics/fault"
+	"mosn.io/layotto/pkg/actuator/logger"
+	"mosn.io/layotto/pkg/messages"
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/apidoc"
+	"mosn.io/layotto/pkg/runtime/crd"
+	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// AdminTokenMetadataKey is the key of the grpc metadata carrying the token of the caller of the Admin service
+const AdminTokenMetadataKey = "layotto-admin-token"
+
+// The info of the OpenAPI document returned by GetApiDescriptors
+const (
+	apiDocTitle   = "Layotto API"
+	apiDocVersion = "v1"
+)
+
+// defaultTopContendedLocks is the number of the resources returned by GetTopContendedLocks if the limit isn't specified
+const defaultTopContendedLocks = 10
+
+var ErrAdminTokensEmpty = errors.New("the tokens of the admin service are required and shouldn't be empty")
+
+// AdminConfig enables the Admin service, which changes the components of the running sidecar
+type AdminConfig struct {
+	// Tokens authorize the callers, a request is served if it carries any of them
+	Tokens []string `json:"tokens"`
+}
+
+func (c *AdminConfig) Validate() error {
+	if len(c.Tokens) == 0 {
+		return ErrAdminTokensEmpty
+	}
+	for _, token := range c.Tokens {
+		if token == "" {
+			return ErrAdminTokensEmpty
+		}
+	}
+	return nil
+}
+
+// adminAPI is the GrpcAPI serving the Admin service
+type adminAPI struct {
+	m      *MosnRuntime
+	tokens []string
+	// registered are the components registered by the Admin service, which can be unregistered by it.
+	// It's guarded by the reconfigureLock of the runtime.
+	registered map[alias.Kind]map[string]bool
+	// server is the grpc server the Admin service is registered to, which serves the APIs described by GetApiDescriptors
+	server *rawGRPC.Server
+}
+
+func newAdminAPI(m *MosnRuntime, cfg *AdminConfig) *adminAPI {
+	return &adminAPI{
+		m:          m,
+		tokens:     cfg.Tokens,
+		registered: make(map[alias.Kind]map[string]bool),
+	}
+}
+
+func (a *adminAPI) Init(conn *rawGRPC.ClientConn) error {
+	return nil
+}
+
+func (a *adminAPI) Register(s *rawGRPC.Server, registeredServer mgrpc.RegisteredServer) (mgrpc.RegisteredServer, error) {
+	runtimev1pb.RegisterAdminServer(s, a)
+	a.server = s
+	return registeredServer, nil
+}
+
+// authorize checks the token in the metadata against the tokens configured
+func (a *adminAPI) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(AdminTokenMetadataKey)
+	if len(tokens) == 0 {
+		return status.Errorf(codes.Unauthenticated, "the metadata %s is required", AdminTokenMetadataKey)
+	}
+	for _, token := range tokens {
+		for _, expected := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+				return nil
+			}
+		}
+	}
+	return status.Error(codes.PermissionDenied, "the admin token is invalid")
+}
+
+func parseComponentKind(kind string, name string) (alias.Kind, error) {
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "the name of the component is required")
+	}
+	for _, k := range crd.Kinds {
+		if string(k) == kind {
+			return k, nil
+		}
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unsupported kind %q of the component", kind)
+}
+
+// RegisterComponent creates the component with the metadata, and serves it at once
+func (a *adminAPI) RegisterComponent(ctx context.Context, in *runtimev1pb.RegisterComponentRequest) (*runtimev1pb.RegisterComponentResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	kind, err := parseComponentKind(in.Kind, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	m := a.m
+	m.reconfigureLock.Lock()
+	defer m.reconfigureLock.Unlock()
+	if !m.profile.GroupEnabled(kindGroups[kind]) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s components are disabled by the profile %s", kind, m.profile.Name())
+	}
+	if componentConfigured(m.runtimeConfig, kind, in.Name) {
+		return nil, status.Errorf(codes.AlreadyExists, "%s component %s already exists", kind, in.Name)
+	}
+	md := make(map[string]string, len(in.Metadata))
+	for k, v := range in.Metadata {
+		md[k] = v
+	}
+	if err := m.reconfigure([]crd.Change{{Kind: kind, Name: in.Name, Metadata: md}}, m.crd.snapshot()); err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.RegisterComponent] register %s component %s error: %v", kind, in.Name, err)
+		return nil, status.Errorf(codes.Internal, "register %s component %s failed: %v", kind, in.Name, err)
+	}
+	if a.registered[kind] == nil {
+		a.registered[kind] = make(map[string]bool)
+	}
+	a.registered[kind][in.Name] = true
+	log.DefaultLogger.Infof("[runtime] [grpc.RegisterComponent] %s component %s is registered", kind, in.Name)
+	return &runtimev1pb.RegisterComponentResponse{}, nil
+}
+
+// UnregisterComponent removes the component registered by RegisterComponent,
+// which is closed after the requests in flight complete
+func (a *adminAPI) UnregisterComponent(ctx context.Context, in *runtimev1pb.UnregisterComponentRequest) (*runtimev1pb.UnregisterComponentResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	kind, err := parseComponentKind(in.Kind, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	m := a.m
+	m.reconfigureLock.Lock()
+	defer m.reconfigureLock.Unlock()
+	if !a.registered[kind][in.Name] {
+		return nil, status.Errorf(codes.NotFound, "%s component %s isn't registered by the admin service", kind, in.Name)
+	}
+	// it fails if the component is still used, e.g. by the aliases or the apps in tenants
+	if err := m.reconfigure([]crd.Change{{Kind: kind, Name: in.Name}}, m.crd.snapshot()); err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.UnregisterComponent] unregister %s component %s error: %v", kind, in.Name, err)
+		return nil, status.Errorf(codes.FailedPrecondition, "unregister %s component %s failed: %v", kind, in.Name, err)
+	}
+	delete(a.registered[kind], in.Name)
+	log.DefaultLogger.Infof("[runtime] [grpc.UnregisterComponent] %s component %s is unregistered", kind, in.Name)
+	return &runtimev1pb.UnregisterComponentResponse{}, nil
+}
+
+// snapshotTarget returns the state store and the file store of the request to export or import the state
+func (a *adminAPI) snapshotTarget(storeName, fileStore, fileName, appID string) (state.Store, file.File, string, error) {
+	if storeName == "" || fileStore == "" || fileName == "" {
+		return nil, nil, "", status.Error(codes.InvalidArgument, "the store_name, file_store and file_name are required")
+	}
+	m := a.m
+	m.reconfigureLock.Lock()
+	defer m.reconfigureLock.Unlock()
+	store, ok := m.states[storeName]
+	if !ok {
+		return nil, nil, "", status.Errorf(codes.NotFound, "state store %s is not found", storeName)
+	}
+	f, ok := m.files[fileStore]
+	if !ok {
+		return nil, nil, "", status.Errorf(codes.NotFound, "file store %s is not found", fileStore)
+	}
+	if appID == "" {
+		appID = m.runtimeConfig.AppManagement.AppId
+	}
+	prefix := runtime_state.KeyPrefix(storeName, appID)
+	// the keys of all the apps would be exported or overwritten
+	if prefix == "" {
+		return nil, nil, "", status.Errorf(codes.FailedPrecondition, "the keys of state store %s have no prefix of the app", storeName)
+	}
+	return store, f, prefix, nil
+}
+
+// ExportState streams the keys of the app in the state store to the file store
+func (a *adminAPI) ExportState(ctx context.Context, in *runtimev1pb.ExportStateRequest) (*runtimev1pb.ExportStateResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	store, f, prefix, err := a.snapshotTarget(in.StoreName, in.FileStore, in.FileName, in.AppId)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	var keys int
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		keys, err = runtime_state.Export(store, &runtime_state.SnapshotRequest{Prefix: prefix, Metadata: in.Metadata}, pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	err = f.Put(ctx, &file.PutFileStu{DataStream: pr, FileName: in.FileName, Metadata: in.FileMetadata})
+	// unblocks the export if the file store stops reading
+	pr.Close()
+	exportErr := <-done
+	// the export fails with the pipe closed if the file store fails first
+	if err != nil && errors.Is(exportErr, io.ErrClosedPipe) {
+		exportErr = nil
+	}
+	if exportErr != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExportState] export state store %s error: %v", in.StoreName, exportErr)
+		if errors.Is(exportErr, runtime_state.ErrListKeysNotSupported) {
+			return nil, status.Errorf(codes.Unimplemented, "state store %s doesn't support listing keys", in.StoreName)
+		}
+		return nil, status.Errorf(codes.Internal, "export state store %s failed: %v", in.StoreName, exportErr)
+	}
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [grpc.ExportState] put file %s to %s error: %v", in.FileName, in.FileStore, err)
+		return nil, status.Errorf(codes.Internal, "put file %s failed: %v", in.FileName, err)
+	}
+	log.DefaultLogger.Infof("[runtime] [grpc.ExportState] %d keys of state store %s are exported to file %s", keys, in.StoreName, in.FileName)
+	return &runtimev1pb.ExportStateResponse{Keys: int64(keys)}, nil
+}
+
+// ImportState saves the keys of the file written by ExportState to the state store
+func (a *adminAPI) ImportState(ctx context.Context, in *runtimev1pb.ImportStateRequest) (*runtimev1pb.ImportStateResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	store, f, prefix, err := a.snapshotTarget(in.StoreName, in.FileStore, in.FileName, in.AppId)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.Get(ctx, &file.GetFileStu{FileName: in.FileName, Metadata: in.FileMetadata})
+	if err != nil {
+		if errors.Is(err, file.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, "file %s is not found", in.FileName)
+		}
+		log.DefaultLogger.Errorf("[runtime] [grpc.ImportState] get file %s from %s error: %v", in.FileName, in.FileStore, err)
+		return nil, status.Errorf(codes.Internal, "get file %s failed: %v", in.FileName, err)
+	}
+	defer r.Close()
+	keys, err := runtime_state.Import(store, &runtime_state.SnapshotRequest{Prefix: prefix, Metadata: in.Metadata}, r)
+	if err != nil {
+		// the keys imported before the error are kept
+		log.DefaultLogger.Errorf("[runtime] [grpc.ImportState] import state store %s error after %d keys: %v", in.StoreName, keys, err)
+		if errors.Is(err, runtime_state.ErrSnapshotInvalid) {
+			return nil, status.Errorf(codes.InvalidArgument, "file %s isn't a state snapshot: %v", in.FileName, err)
+		}
+		return nil, status.Errorf(codes.Internal, "import state store %s failed after %d keys: %v", in.StoreName, keys, err)
+	}
+	log.DefaultLogger.Infof("[runtime] [grpc.ImportState] %d keys of file %s are imported to state store %s", keys, in.FileName, in.StoreName)
+	return &runtimev1pb.ImportStateResponse{Keys: int64(keys)}, nil
+}
+
+// GetTopContendedLocks returns the resources of the lock store contended most
+func (a *adminAPI) GetTopContendedLocks(ctx context.Context, in *runtimev1pb.GetTopContendedLocksRequest) (*runtimev1pb.GetTopContendedLocksResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if in.StoreName == "" {
+		return nil, status.Error(codes.InvalidArgument, "the store_name is required")
+	}
+	a.m.reconfigureLock.Lock()
+	store, ok := a.m.locks[in.StoreName]
+	a.m.reconfigureLock.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "lock store %s is not found", in.StoreName)
+	}
+	stats, ok := store.(runtime_lock.StatsStore)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "the lock_stats of lock store %s is not configured", in.StoreName)
+	}
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = defaultTopContendedLocks
+	}
+	resp := &runtimev1pb.GetTopContendedLocksResponse{}
+	for _, k := range stats.TopContended(limit) {
+		resp.Locks = append(resp.Locks, &runtimev1pb.ContendedLock{
+			ResourceId: k.ResourceId,
+			Pattern:    k.Pattern,
+			Attempts:   k.Attempts,
+			Contended:  k.Contended,
+			Expired:    k.Expired,
+		})
+	}
+	return resp, nil
+}
+
+// GetFaultInjection returns the fault injection of the Runtime API
+func (a *adminAPI) GetFaultInjection(ctx context.Context, in *runtimev1pb.GetFaultInjectionRequest) (*runtimev1pb.GetFaultInjectionResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if a.m.faults == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the fault_injection is not configured")
+	}
+	cfg := a.m.faults.Config()
+	return &runtimev1pb.GetFaultInjectionResponse{Enabled: cfg.Enabled, Rules: faultRulesToPb(cfg.Rules)}, nil
+}
+
+// UpdateFaultInjection enables or disables the fault injection, and replaces the rules if update_rules is true
+func (a *adminAPI) UpdateFaultInjection(ctx context.Context, in *runtimev1pb.UpdateFaultInjectionRequest) (*runtimev1pb.UpdateFaultInjectionResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if a.m.faults == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the fault_injection is not configured")
+	}
+	if in.UpdateRules {
+		if err := a.m.faults.Update(in.Enabled, faultRulesFromPb(in.Rules)); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	} else {
+		a.m.faults.SetEnabled(in.Enabled)
+	}
+	cfg := a.m.faults.Config()
+	return &runtimev1pb.UpdateFaultInjectionResponse{Enabled: cfg.Enabled, Rules: faultRulesToPb(cfg.Rules)}, nil
+}
+
+// GetApiDescriptors returns the descriptors and the OpenAPI document of the services served,
+// the methods disabled by the profile are excluded
+func (a *adminAPI) GetApiDescriptors(ctx context.Context, in *runtimev1pb.GetApiDescriptorsRequest) (*runtimev1pb.GetApiDescriptorsResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if a.server == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the admin service isn't registered to the server")
+	}
+	services := a.servedServices()
+	if len(in.Services) > 0 {
+		requested := make(apidoc.Services, len(in.Services))
+		for _, name := range in.Services {
+			methods, ok := services[name]
+			if !ok {
+				return nil, status.Errorf(codes.NotFound, "service %s is not served", name)
+			}
+			requested[name] = methods
+		}
+		services = requested
+	}
+	set, err := apidoc.DescriptorSet(services)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &runtimev1pb.GetApiDescriptorsResponse{}
+	if resp.DescriptorSet, err = proto.Marshal(set); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if resp.Openapi, err = apidoc.OpenAPI(services, apiDocTitle, apiDocVersion); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for name, methods := range services {
+		for _, method := range methods {
+			resp.Methods = append(resp.Methods, "/"+name+"/"+method)
+		}
+	}
+	sort.Strings(resp.Methods)
+	return resp, nil
+}
+
+// servedServices returns the services of the server described by the registered descriptors, with the methods enabled by the profile
+func (a *adminAPI) servedServices() apidoc.Services {
+	services := make(apidoc.Services)
+	for name, info := range a.server.GetServiceInfo() {
+		if _, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name)); err != nil {
+			log.DefaultLogger.Warnf("[runtime] the descriptor of service %s isn't registered, so it's not described", name)
+			continue
+		}
+		var methods []string
+		for _, method := range info.Methods {
+			if a.m.profile == nil || a.m.profile.methodEnabled("/"+name+"/"+method.Name) {
+				methods = append(methods, method.Name)
+			}
+		}
+		if len(methods) > 0 {
+			services[name] = methods
+		}
+	}
+	return services
+}
+
+// ResetCircuitBreaker closes the circuit breakers of the endpoints of the target in all the invokers with circuit breakers
+func (a *adminAPI) ResetCircuitBreaker(ctx context.Context, in *runtimev1pb.ResetCircuitBreakerRequest) (*runtimev1pb.ResetCircuitBreakerResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	resp := &runtimev1pb.ResetCircuitBreakerResponse{}
+	supported := false
+	// the rpcs aren't changed after the runtime starts
+	for name, invoker := range a.m.rpcs {
+		resetter, ok := invoker.(rpc.CircuitBreakerResetter)
+		if !ok {
+			continue
+		}
+		supported = true
+		endpoints := resetter.ResetCircuitBreaker(in.Id)
+		if len(endpoints) > 0 {
+			log.DefaultLogger.Infof("[runtime] [grpc.ResetCircuitBreaker] reset circuit breakers of %v in rpc %s", endpoints, name)
+		}
+		for _, e := range endpoints {
+			resp.Endpoints = append(resp.Endpoints, &runtimev1pb.CircuitBreakerEndpoint{Id: e.Id, Endpoint: e.Endpoint})
+		}
+	}
+	if !supported {
+		return nil, status.Error(codes.FailedPrecondition, "the circuit_breaker of rpc is not configured")
+	}
+	sort.SliceStable(resp.Endpoints, func(i, j int) bool {
+		if resp.Endpoints[i].Id != resp.Endpoints[j].Id {
+			return resp.Endpoints[i].Id < resp.Endpoints[j].Id
+		}
+		return resp.Endpoints[i].Endpoint < resp.Endpoints[j].Endpoint
+	})
+	return resp, nil
+}
+
+// GetLogLevel returns the global log level and the levels of modules.
+func (a *adminAPI) GetLogLevel(ctx context.Context, in *runtimev1pb.GetLogLevelRequest) (*runtimev1pb.GetLogLevelResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	level, modules := logger.GetLevels()
+	return &runtimev1pb.GetLogLevelResponse{Level: level, ModuleLevels: modules}, nil
+}
+
+// SetLogLevel changes the log levels without restart.
+func (a *adminAPI) SetLogLevel(ctx context.Context, in *runtimev1pb.SetLogLevelRequest) (*runtimev1pb.SetLogLevelResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	// validate all the levels first, so that nothing is changed if the request is invalid
+	if in.Level != "" {
+		if _, err := logger.ParseLevel(in.Level); err != nil {
+			return nil, messages.Errorf(codes.InvalidArgument, messages.ErrInvalidLogLevel, in.Level)
+		}
+	}
+	for module, level := range in.ModuleLevels {
+		if module == "" {
+			return nil, messages.Error(codes.InvalidArgument, messages.ErrLogModuleEmpty)
+		}
+		if level == "" {
+			continue
+		}
+		if _, err := logger.ParseLevel(level); err != nil {
+			return nil, messages.Errorf(codes.InvalidArgument, messages.ErrInvalidLogLevel, level)
+		}
+	}
+	if len(in.ModuleLevels) > 0 && !logger.Installed() {
+		return nil, messages.Error(codes.FailedPrecondition, messages.ErrLogModulesNotInstalled)
+	}
+	if in.Level != "" {
+		if err := logger.SetLevel(in.Level); err != nil {
+			return nil, messages.Errorf(codes.InvalidArgument, messages.ErrInvalidLogLevel, in.Level)
+		}
+	}
+	for module, level := range in.ModuleLevels {
+		if err := logger.SetModuleLevel(module, level); err != nil {
+			return nil, messages.Errorf(codes.InvalidArgument, messages.ErrInvalidLogLevel, level)
+		}
+	}
+	level, modules := logger.GetLevels()
+	return &runtimev1pb.SetLogLevelResponse{Level: level, ModuleLevels: modules}, nil
+}
+
+// subscriptionController is implemented by the GrpcAPIs holding the subscriptions of an app, e.g. the default API
+type subscriptionController interface {
+	PauseSubscription(ctx context.Context, in *runtimev1pb.PauseSubscriptionRequest) (*emptypb.Empty, error)
+	ResumeSubscription(ctx context.Context, in *runtimev1pb.ResumeSubscriptionRequest) (*emptypb.Empty, error)
+	ReplayMessages(ctx context.Context, in *runtimev1pb.ReplayMessagesRequest) (*runtimev1pb.ReplayMessagesResponse, error)
+}
+
+// subscriptionsOf returns the GrpcAPI holding the subscriptions of the app, which is the main app if the id is empty
+func (a *adminAPI) subscriptionsOf(appId string) (subscriptionController, error) {
+	m := a.m
+	var apis []interface{}
+	if appId == "" || appId == m.runtimeConfig.AppManagement.AppId {
+		// the registered GrpcAPIs hold the subscriptions of the main app
+		for _, api := range m.apis {
+			apis = append(apis, api)
+		}
+	} else {
+		var t *tenant
+		if m.router != nil {
+			t = m.router.subscribers[appId]
+		}
+		if t == nil {
+			return nil, status.Errorf(codes.NotFound, "app %s isn't served by the runtime", appId)
+		}
+		for _, api := range t.apis {
+			apis = append(apis, api)
+		}
+	}
+	for _, api := range apis {
+		if c, ok := api.(subscriptionController); ok {
+			return c, nil
+		}
+	}
+	return nil, status.Error(codes.Unimplemented, "the subscriptions of the app aren't held by any API")
+}
+
+// PauseSubscription stops delivering new events of the subscription of the app and waits for the in-flight events.
+func (a *adminAPI) PauseSubscription(ctx context.Context, in *runtimev1pb.PauseSubscriptionRequest) (*emptypb.Empty, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	c, err := a.subscriptionsOf(in.AppId)
+	if err != nil {
+		return nil, err
+	}
+	return c.PauseSubscription(ctx, in)
+}
+
+// ResumeSubscription restarts delivering the events of the subscription of the app.
+func (a *adminAPI) ResumeSubscription(ctx context.Context, in *runtimev1pb.ResumeSubscriptionRequest) (*emptypb.Empty, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	c, err := a.subscriptionsOf(in.AppId)
+	if err != nil {
+		return nil, err
+	}
+	return c.ResumeSubscription(ctx, in)
+}
+
+// ReplayMessages delivers the messages in the range to the app subscribing the topic again.
+func (a *adminAPI) ReplayMessages(ctx context.Context, in *runtimev1pb.ReplayMessagesRequest) (*runtimev1pb.ReplayMessagesResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	c, err := a.subscriptionsOf(in.AppId)
+	if err != nil {
+		return nil, err
+	}
+	return c.ReplayMessages(ctx, in)
+}
+
+func faultRulesToPb(rules []*fault.Rule) []*runtimev1pb.FaultRule {
+	res := make([]*runtimev1pb.FaultRule, 0, len(rules))
+	for _, r := range rules {
+		res = append(res, &runtimev1pb.FaultRule{
+			Name:         r.Name,
+			Methods:      r.Methods,
+			Components:   r.Components,
+			DelayMs:      int32(r.DelayMs),
+			DelayPercent: r.DelayPercent,
+			ErrorCode:    r.ErrorCode,
+			ErrorMessage: r.ErrorMessage,
+			ErrorPercent: r.ErrorPercent,
+			AbortPercent: r.AbortPercent,
+		})
+	}
+	return res
+}
+
+func faultRulesFromPb(rules []*runtimev1pb.FaultRule) []*fault.Rule {
+	res := make([]*fault.Rule, 0, len(rules))
+	for _, r := range rules {
+		res = append(res, &fault.Rule{
+			Name:         r.Name,
+			Methods:      r.Methods,
+			Components:   r.Components,
+			DelayMs:      int(r.DelayMs),
+			DelayPercent: r.DelayPercent,
+			ErrorCode:    r.ErrorCode,
+			ErrorMessage: r.ErrorMessage,
+			ErrorPercent: r.ErrorPercent,
+			AbortPercent: r.AbortPercent,
+		})
+	}
+	return res
+}
@@ -0,0 +1,498 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"mosn.io/layotto/components/file"
+	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/diagnostics/fault"
+	"mosn.io/layotto/pkg/grpc"
+	"mosn.io/layotto/pkg/grpc/default_api"
+	"mosn.io/layotto/pkg/mock"
+	mock_invoker "mosn.io/layotto/pkg/mock/components/invoker"
+	mock_lock "mosn.io/layotto/pkg/mock/components/lock"
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+	mlock "mosn.io/layotto/pkg/runtime/lock"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestAdminConfig_Validate(t *testing.T) {
+	assert.Equal(t, ErrAdminTokensEmpty, (&AdminConfig{}).Validate())
+	assert.Equal(t, ErrAdminTokensEmpty, (&AdminConfig{Tokens: []string{""}}).Validate())
+	assert.Nil(t, (&AdminConfig{Tokens: []string{"t"}}).Validate())
+}
+
+func TestAdminAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	newLock := func() lock.LockStore {
+		store := mock_lock.NewMockLockStore(ctrl)
+		store.EXPECT().Init(gomock.Any()).Return(nil).AnyTimes()
+		return store
+	}
+	cfg := &AdminConfig{Tokens: []string{"secret"}}
+	rt := NewMosnRuntime(&MosnRuntimeConfig{
+		AppManagement:  AppConfig{AppId: "main"},
+		LockManagement: map[string]lock.Config{"file": {}},
+		Admin:          cfg,
+	})
+	_, err := rt.Run(
+		WithGrpcAPI(default_api.NewGrpcAPI),
+		WithLockFactory(mlock.NewFactory("file", newLock), mlock.NewFactory("dynamic", newLock)),
+	)
+	assert.Nil(t, err)
+	defer rt.Stop()
+	a := newAdminAPI(rt, cfg)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	t.Run("unauthorized", func(t *testing.T) {
+		req := &runtimev1pb.RegisterComponentRequest{Kind: "lock", Name: "dynamic"}
+		_, err := a.RegisterComponent(context.Background(), req)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		wrong := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "guess"))
+		_, err = a.RegisterComponent(wrong, req)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		assert.Nil(t, rt.locks["dynamic"])
+	})
+
+	t.Run("illegal request", func(t *testing.T) {
+		_, err := a.RegisterComponent(ctx, &runtimev1pb.RegisterComponentRequest{Kind: "hellos", Name: "dynamic"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = a.RegisterComponent(ctx, &runtimev1pb.RegisterComponentRequest{Kind: "lock"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("register", func(t *testing.T) {
+		_, err := a.RegisterComponent(ctx, &runtimev1pb.RegisterComponentRequest{
+			Kind:     "lock",
+			Name:     "dynamic",
+			Metadata: map[string]string{"k": "v"},
+		})
+		assert.Nil(t, err)
+		assert.NotNil(t, rt.locks["dynamic"])
+		assert.Equal(t, "v", rt.runtimeConfig.LockManagement["dynamic"].Metadata["k"])
+		_, err = a.RegisterComponent(ctx, &runtimev1pb.RegisterComponentRequest{Kind: "lock", Name: "dynamic"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("implementation not found", func(t *testing.T) {
+		_, err := a.RegisterComponent(ctx, &runtimev1pb.RegisterComponentRequest{Kind: "lock", Name: "unknown"})
+		assert.Equal(t, codes.Internal, status.Code(err))
+		_, ok := rt.runtimeConfig.LockManagement["unknown"]
+		assert.False(t, ok)
+	})
+
+	t.Run("unregister", func(t *testing.T) {
+		_, err := a.UnregisterComponent(ctx, &runtimev1pb.UnregisterComponentRequest{Kind: "lock", Name: "file"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.NotNil(t, rt.locks["file"])
+		_, err = a.UnregisterComponent(ctx, &runtimev1pb.UnregisterComponentRequest{Kind: "lock", Name: "dynamic"})
+		assert.Nil(t, err)
+		assert.Nil(t, rt.locks["dynamic"])
+		_, err = a.UnregisterComponent(ctx, &runtimev1pb.UnregisterComponentRequest{Kind: "lock", Name: "dynamic"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+// listingStore is a MockStore which can list the keys
+type listingStore struct {
+	*mock_state.MockStore
+	keys []string
+}
+
+func (s *listingStore) ListKeys(req *runtime_state.ListKeysRequest) ([]string, error) {
+	var keys []string
+	for _, k := range s.keys {
+		if k > req.After && len(keys) < req.Limit {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func TestAdminAPI_State(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cfg := &AdminConfig{Tokens: []string{"secret"}}
+	rt := NewMosnRuntime(&MosnRuntimeConfig{AppManagement: AppConfig{AppId: "main"}})
+	store := &listingStore{MockStore: mock_state.NewMockStore(ctrl), keys: []string{"main||a", "main||b"}}
+	rt.states["listing"] = store
+	rt.states["plain"] = mock_state.NewMockStore(ctrl)
+	files := mock.NewMockFile(ctrl)
+	rt.files["files"] = files
+	a := newAdminAPI(rt, cfg)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, err := a.ExportState(context.Background(), &runtimev1pb.ExportStateRequest{StoreName: "listing", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = a.ImportState(context.Background(), &runtimev1pb.ImportStateRequest{StoreName: "listing", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("illegal request", func(t *testing.T) {
+		_, err := a.ExportState(ctx, &runtimev1pb.ExportStateRequest{StoreName: "listing", FileStore: "files"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = a.ExportState(ctx, &runtimev1pb.ExportStateRequest{StoreName: "unknown", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = a.ImportState(ctx, &runtimev1pb.ImportStateRequest{StoreName: "listing", FileStore: "unknown", FileName: "f"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		// the keys without the prefix of the app
+		assert.Nil(t, runtime_state.SaveStateConfiguration("shared", map[string]string{"keyPrefix": "none"}))
+		_, err = a.ExportState(ctx, &runtimev1pb.ExportStateRequest{StoreName: "shared", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("listing keys unsupported", func(t *testing.T) {
+		files.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *file.PutFileStu) error {
+			_, err := ioutil.ReadAll(req.DataStream)
+			return err
+		})
+		_, err := a.ExportState(ctx, &runtimev1pb.ExportStateRequest{StoreName: "plain", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("put failed", func(t *testing.T) {
+		files.EXPECT().Put(gomock.Any(), gomock.Any()).Return(errors.New("disk full"))
+		store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v")}, nil).Times(2)
+		_, err := a.ExportState(ctx, &runtimev1pb.ExportStateRequest{StoreName: "listing", FileStore: "files", FileName: "f"})
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "disk full")
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		var snapshot []byte
+		files.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *file.PutFileStu) error {
+			assert.Equal(t, "backup.gz", req.FileName)
+			assert.Equal(t, map[string]string{"bucket": "b"}, req.Metadata)
+			var err error
+			snapshot, err = ioutil.ReadAll(req.DataStream)
+			return err
+		})
+		store.EXPECT().Get(gomock.Any()).DoAndReturn(func(req *state.GetRequest) (*state.GetResponse, error) {
+			assert.Equal(t, map[string]string{"partition": "p"}, req.Metadata)
+			return &state.GetResponse{Data: []byte("value of " + req.Key)}, nil
+		}).Times(2)
+		resp, err := a.ExportState(ctx, &runtimev1pb.ExportStateRequest{
+			StoreName:    "listing",
+			FileStore:    "files",
+			FileName:     "backup.gz",
+			Metadata:     map[string]string{"partition": "p"},
+			FileMetadata: map[string]string{"bucket": "b"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), resp.Keys)
+
+		// imported for another app
+		files.EXPECT().Get(gomock.Any(), gomock.Any()).Return(ioutil.NopCloser(bytes.NewReader(snapshot)), nil)
+		store.EXPECT().BulkSet(gomock.Any()).DoAndReturn(func(req []state.SetRequest) error {
+			assert.Len(t, req, 2)
+			assert.Equal(t, "clone||a", req[0].Key)
+			assert.Equal(t, []byte("value of main||a"), req[0].Value)
+			assert.Equal(t, "clone||b", req[1].Key)
+			return nil
+		})
+		importResp, err := a.ImportState(ctx, &runtimev1pb.ImportStateRequest{StoreName: "listing", AppId: "clone", FileStore: "files", FileName: "backup.gz"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), importResp.Keys)
+	})
+
+	t.Run("import failed", func(t *testing.T) {
+		files.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, file.ErrNotExist)
+		_, err := a.ImportState(ctx, &runtimev1pb.ImportStateRequest{StoreName: "listing", FileStore: "files", FileName: "missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		files.EXPECT().Get(gomock.Any(), gomock.Any()).Return(ioutil.NopCloser(bytes.NewReader([]byte("garbage"))), nil)
+		_, err = a.ImportState(ctx, &runtimev1pb.ImportStateRequest{StoreName: "listing", FileStore: "files", FileName: "garbage"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestAdminAPI_GetTopContendedLocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	rt := NewMosnRuntime(&MosnRuntimeConfig{})
+	store := mock_lock.NewMockLockStore(ctrl)
+	store.EXPECT().TryLock(gomock.Any()).Return(&lock.TryLockResponse{Success: false}, nil).Times(2)
+	stats := mlock.NewStatsStore("stats", store, &mlock.StatsConfig{Patterns: []string{"order_*"}})
+	stats.TryLock(&lock.TryLockRequest{ResourceId: "lock|||order_1", LockOwner: "o1", Expire: 10})
+	stats.TryLock(&lock.TryLockRequest{ResourceId: "lock|||order_1", LockOwner: "o1", Expire: 10})
+	rt.locks["stats"] = stats
+	rt.locks["plain"] = mock_lock.NewMockLockStore(ctrl)
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.GetTopContendedLocks(context.Background(), &runtimev1pb.GetTopContendedLocksRequest{StoreName: "stats"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.GetTopContendedLocks(ctx, &runtimev1pb.GetTopContendedLocksRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = a.GetTopContendedLocks(ctx, &runtimev1pb.GetTopContendedLocksRequest{StoreName: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = a.GetTopContendedLocks(ctx, &runtimev1pb.GetTopContendedLocksRequest{StoreName: "plain"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	resp, err := a.GetTopContendedLocks(ctx, &runtimev1pb.GetTopContendedLocksRequest{StoreName: "stats"})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Locks, 1)
+	assert.Equal(t, "order_1", resp.Locks[0].ResourceId)
+	assert.Equal(t, "order_*", resp.Locks[0].Pattern)
+	assert.Equal(t, int64(2), resp.Locks[0].Attempts)
+	assert.Equal(t, int64(2), resp.Locks[0].Contended)
+}
+
+func TestAdminAPI_FaultInjection(t *testing.T) {
+	rt := NewMosnRuntime(&MosnRuntimeConfig{})
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.GetFaultInjection(context.Background(), &runtimev1pb.GetFaultInjectionRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.GetFaultInjection(ctx, &runtimev1pb.GetFaultInjectionRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	rt.faults, err = fault.New(&fault.Config{Rules: []*fault.Rule{{Name: "slow", DelayMs: 100, DelayPercent: 50}}})
+	assert.Nil(t, err)
+	resp, err := a.GetFaultInjection(ctx, &runtimev1pb.GetFaultInjectionRequest{})
+	assert.Nil(t, err)
+	assert.False(t, resp.Enabled)
+	assert.Len(t, resp.Rules, 1)
+	assert.Equal(t, int32(100), resp.Rules[0].DelayMs)
+
+	// the rules are kept
+	updated, err := a.UpdateFaultInjection(ctx, &runtimev1pb.UpdateFaultInjectionRequest{Enabled: true})
+	assert.Nil(t, err)
+	assert.True(t, updated.Enabled)
+	assert.Equal(t, "slow", updated.Rules[0].Name)
+
+	_, err = a.UpdateFaultInjection(ctx, &runtimev1pb.UpdateFaultInjectionRequest{
+		UpdateRules: true,
+		Rules:       []*runtimev1pb.FaultRule{{Name: "broken", ErrorCode: "NOT_A_CODE", ErrorPercent: 10}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	updated, err = a.UpdateFaultInjection(ctx, &runtimev1pb.UpdateFaultInjectionRequest{
+		Enabled:     true,
+		UpdateRules: true,
+		Rules:       []*runtimev1pb.FaultRule{{Name: "down", Methods: []string{"GetState"}, ErrorCode: "UNAVAILABLE", ErrorPercent: 100}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, updated.Rules, 1)
+	assert.Equal(t, "down", updated.Rules[0].Name)
+	assert.Equal(t, []string{"GetState"}, updated.Rules[0].Methods)
+}
+
+type mockBreakerInvoker struct {
+	rpc.Invoker
+	open []rpc.CircuitBreakerEndpoint
+}
+
+func (m *mockBreakerInvoker) ResetCircuitBreaker(target string) []rpc.CircuitBreakerEndpoint {
+	var reset, open []rpc.CircuitBreakerEndpoint
+	for _, e := range m.open {
+		if target == "" || target == e.Id {
+			reset = append(reset, e)
+		} else {
+			open = append(open, e)
+		}
+	}
+	m.open = open
+	return reset
+}
+
+func TestAdminAPI_ResetCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	rt := NewMosnRuntime(&MosnRuntimeConfig{})
+	rt.rpcs["mosn"] = mock_invoker.NewMockInvoker(ctrl)
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.ResetCircuitBreaker(context.Background(), &runtimev1pb.ResetCircuitBreakerRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.ResetCircuitBreaker(ctx, &runtimev1pb.ResetCircuitBreakerRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	rt.rpcs["mosn"] = &mockBreakerInvoker{
+		Invoker: mock_invoker.NewMockInvoker(ctrl),
+		open:    []rpc.CircuitBreakerEndpoint{{Id: "b"}, {Id: "a", Endpoint: "10.0.0.2:8080"}, {Id: "a", Endpoint: "10.0.0.1:8080"}},
+	}
+	resp, err := a.ResetCircuitBreaker(ctx, &runtimev1pb.ResetCircuitBreakerRequest{Id: "a"})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Endpoints, 2)
+	assert.Equal(t, "10.0.0.1:8080", resp.Endpoints[0].Endpoint)
+	assert.Equal(t, "10.0.0.2:8080", resp.Endpoints[1].Endpoint)
+	resp, err = a.ResetCircuitBreaker(ctx, &runtimev1pb.ResetCircuitBreakerRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Endpoints, 1)
+	assert.Equal(t, "b", resp.Endpoints[0].Id)
+}
+
+func TestAdminAPI_SetLogLevel(t *testing.T) {
+	a := newAdminAPI(NewMosnRuntime(&MosnRuntimeConfig{}), &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.GetLogLevel(context.Background(), &runtimev1pb.GetLogLevelRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.SetLogLevel(context.Background(), &runtimev1pb.SetLogLevelRequest{Level: "debug"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	got, err := a.GetLogLevel(ctx, &runtimev1pb.GetLogLevelRequest{})
+	assert.Nil(t, err)
+	// nothing is changed if any level is invalid
+	_, err = a.SetLogLevel(ctx, &runtimev1pb.SetLogLevelRequest{
+		Level:        "debug",
+		ModuleLevels: map[string]string{"runtime": "verbose"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = a.SetLogLevel(ctx, &runtimev1pb.SetLogLevelRequest{ModuleLevels: map[string]string{"": "debug"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	// the logger of modules isn't installed
+	_, err = a.SetLogLevel(ctx, &runtimev1pb.SetLogLevelRequest{ModuleLevels: map[string]string{"runtime": "debug"}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	resp, err := a.SetLogLevel(ctx, &runtimev1pb.SetLogLevelRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, got.Level, resp.Level)
+	assert.Equal(t, len(got.ModuleLevels), len(resp.ModuleLevels))
+}
+
+type mockSubscriptionAPI struct {
+	grpc.GrpcAPI
+	paused map[string]bool
+}
+
+func (m *mockSubscriptionAPI) PauseSubscription(ctx context.Context, in *runtimev1pb.PauseSubscriptionRequest) (*emptypb.Empty, error) {
+	m.paused[in.Topic] = true
+	return &emptypb.Empty{}, nil
+}
+
+func (m *mockSubscriptionAPI) ResumeSubscription(ctx context.Context, in *runtimev1pb.ResumeSubscriptionRequest) (*emptypb.Empty, error) {
+	delete(m.paused, in.Topic)
+	return &emptypb.Empty{}, nil
+}
+
+func (m *mockSubscriptionAPI) ReplayMessages(ctx context.Context, in *runtimev1pb.ReplayMessagesRequest) (*runtimev1pb.ReplayMessagesResponse, error) {
+	return &runtimev1pb.ReplayMessagesResponse{Count: in.EndOffset - in.StartOffset}, nil
+}
+
+func TestAdminAPI_PauseSubscription(t *testing.T) {
+	rt := NewMosnRuntime(&MosnRuntimeConfig{AppManagement: AppConfig{AppId: "main"}})
+	mainAPI := &mockSubscriptionAPI{paused: make(map[string]bool)}
+	tenantAPI := &mockSubscriptionAPI{paused: make(map[string]bool)}
+	rt.apis = []grpc.GrpcAPI{mainAPI}
+	rt.router = newAPIRouter("main", routeTable{
+		"main":   &tenant{apis: map[interface{}]interface{}{}},
+		"tenant": &tenant{apis: map[interface{}]interface{}{mainAPI: tenantAPI}},
+	}, nil)
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.PauseSubscription(context.Background(), &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.ResumeSubscription(context.Background(), &runtimev1pb.ResumeSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.PauseSubscription(ctx, &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic", AppId: "other"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// the mainAPI app by default
+	_, err = a.PauseSubscription(ctx, &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Nil(t, err)
+	assert.True(t, mainAPI.paused["topic"])
+	assert.Empty(t, tenantAPI.paused)
+	_, err = a.PauseSubscription(ctx, &runtimev1pb.PauseSubscriptionRequest{PubsubName: "mock", Topic: "topic", AppId: "tenant"})
+	assert.Nil(t, err)
+	assert.True(t, tenantAPI.paused["topic"])
+	_, err = a.ResumeSubscription(ctx, &runtimev1pb.ResumeSubscriptionRequest{PubsubName: "mock", Topic: "topic"})
+	assert.Nil(t, err)
+	assert.Empty(t, mainAPI.paused)
+	assert.True(t, tenantAPI.paused["topic"])
+}
+
+func TestAdminAPI_ReplayMessages(t *testing.T) {
+	rt := NewMosnRuntime(&MosnRuntimeConfig{AppManagement: AppConfig{AppId: "main"}})
+	rt.apis = []grpc.GrpcAPI{&mockSubscriptionAPI{}}
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err := a.ReplayMessages(context.Background(), &runtimev1pb.ReplayMessagesRequest{PubsubName: "mock", Topic: "topic", EndOffset: 2})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	// there are no tenants
+	_, err = a.ReplayMessages(ctx, &runtimev1pb.ReplayMessagesRequest{PubsubName: "mock", Topic: "topic", EndOffset: 2, AppId: "tenant"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	resp, err := a.ReplayMessages(ctx, &runtimev1pb.ReplayMessagesRequest{PubsubName: "mock", Topic: "topic", EndOffset: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), resp.Count)
+}
+
+func TestAdminAPI_GetApiDescriptors(t *testing.T) {
+	rt := NewMosnRuntime(&MosnRuntimeConfig{})
+	var err error
+	rt.profile, err = NewProfile(&ProfileConfig{Name: ProfileMinimal})
+	assert.Nil(t, err)
+	a := newAdminAPI(rt, &AdminConfig{Tokens: []string{"secret"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AdminTokenMetadataKey, "secret"))
+
+	_, err = a.GetApiDescriptors(context.Background(), &runtimev1pb.GetApiDescriptorsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.GetApiDescriptors(ctx, &runtimev1pb.GetApiDescriptorsRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	s := rawGRPC.NewServer()
+	runtimev1pb.RegisterRuntimeServer(s, &runtimev1pb.UnimplementedRuntimeServer{})
+	_, err = a.Register(s, nil)
+	assert.Nil(t, err)
+
+	resp, err := a.GetApiDescriptors(ctx, &runtimev1pb.GetApiDescriptorsRequest{})
+	assert.Nil(t, err)
+	// the methods disabled by the minimal profile are excluded
+	assert.Contains(t, resp.Methods, "/spec.proto.runtime.v1.Runtime/GetState")
+	assert.Contains(t, resp.Methods, "/spec.proto.runtime.v1.Admin/GetApiDescriptors")
+	assert.NotContains(t, resp.Methods, "/spec.proto.runtime.v1.Runtime/InvokeService")
+	set := &descriptorpb.FileDescriptorSet{}
+	assert.Nil(t, proto.Unmarshal(resp.DescriptorSet, set))
+	var methods []string
+	for _, f := range set.File {
+		for _, svc := range f.Service {
+			for _, m := range svc.Method {
+				methods = append(methods, "/"+f.GetPackage()+"."+svc.GetName()+"/"+m.GetName())
+			}
+		}
+	}
+	assert.ElementsMatch(t, resp.Methods, methods)
+	assert.Contains(t, string(resp.Openapi), `"/spec.proto.runtime.v1.Runtime/GetState"`)
+	assert.NotContains(t, string(resp.Openapi), `"/spec.proto.runtime.v1.Runtime/InvokeService"`)
+
+	resp, err = a.GetApiDescriptors(ctx, &runtimev1pb.GetApiDescriptorsRequest{Services: []string{"spec.proto.runtime.v1.Admin"}})
+	assert.Nil(t, err)
+	assert.NotContains(t, resp.Methods, "/spec.proto.runtime.v1.Runtime/GetState")
+	assert.Contains(t, resp.Methods, "/spec.proto.runtime.v1.Admin/GetFaultInjection")
+	_, err = a.GetApiDescriptors(ctx, &runtimev1pb.GetApiDescriptorsRequest{Services: []string{"spec.proto.runtime.v1.Foo"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alias
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Kind is the kind of components, named after the key in the runtime config
+type Kind string
+
+const (
+	State       Kind = "state"
+	PubSub      Kind = "pub_subs"
+	ConfigStore Kind = "config_stores"
+	Lock        Kind = "lock"
+	Sequencer   Kind = "sequencer"
+	Binding     Kind = "bindings"
+	SecretStore Kind = "secretStores"
+)
+
+var (
+	mu       sync.RWMutex
+	defaults = map[Kind]string{}
+	aliases  = map[Kind]map[string]string{}
+)
+
+// Save saves the default component of each kind and the aliases of components.
+// The existence check function is used to validate that the default and the targets of aliases are configured.
+func Save(defaultComponents map[string]string, componentAliases map[string]map[string]string, exists func(kind Kind, name string) bool) error {
+	newDefaults := make(map[Kind]string, len(defaultComponents))
+	newAliases := make(map[Kind]map[string]string, len(componentAliases))
+	for kind, as := range componentAliases {
+		m := make(map[string]string, len(as))
+		for alias, name := range as {
+			if !exists(Kind(kind), name) {
+				return fmt.Errorf("the target of alias %s of %s component is not found: %s", alias, kind, name)
+			}
+			m[alias] = name
+		}
+		newAliases[Kind(kind)] = m
+	}
+	for kind, name := range defaultComponents {
+		resolved := name
+		if target, ok := newAliases[Kind(kind)][name]; ok {
+			resolved = target
+		}
+		if !exists(Kind(kind), resolved) {
+			return fmt.Errorf("the default %s component is not found: %s", kind, name)
+		}
+		newDefaults[Kind(kind)] = resolved
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaults = newDefaults
+	aliases = newAliases
+	return nil
+}
+
+// Resolve returns the real name of the component.
+// The default component is used if the name is empty, so requests may omit the component name.
+func Resolve(kind Kind, name string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if name == "" {
+		return defaults[kind]
+	}
+	if target, ok := aliases[kind][name]; ok {
+		return target
+	}
+	return name
+}
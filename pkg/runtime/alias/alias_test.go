@@ -0,0 +1,44 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alias
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	defer Save(nil, nil, nil)
+	exists := func(kind Kind, name string) bool {
+		return kind == State && (name == "redis" || name == "mongo")
+	}
+	err := Save(map[string]string{"state": "cache"}, map[string]map[string]string{"state": {"cache": "redis"}}, exists)
+	assert.Nil(t, err)
+	assert.Equal(t, "redis", Resolve(State, ""))
+	assert.Equal(t, "redis", Resolve(State, "cache"))
+	assert.Equal(t, "mongo", Resolve(State, "mongo"))
+	assert.Equal(t, "", Resolve(PubSub, ""))
+	assert.Equal(t, "cache", Resolve(PubSub, "cache"))
+
+	err = Save(nil, map[string]map[string]string{"state": {"cache": "etcd"}}, exists)
+	assert.Equal(t, "the target of alias cache of state component is not found: etcd", err.Error())
+	err = Save(map[string]string{"pub_subs": "redis"}, nil, exists)
+	assert.Equal(t, "the default pub_subs component is not found: redis", err.Error())
+	// the configuration is unchanged if it's illegal
+	assert.Equal(t, "redis", Resolve(State, ""))
+}
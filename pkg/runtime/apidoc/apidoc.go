@@ -0,0 +1,282 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apidoc describes the APIs served by the runtime, by the protobuf descriptors and the OpenAPI document of them
+package apidoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Services maps the full names of the grpc services to the names of the methods served
+type Services map[string][]string
+
+// grpcContentType is the content type of the requests and the responses of the grpc methods
+const grpcContentType = "application/grpc"
+
+// wellKnown are the schemas of the well known types, which have special JSON mappings
+var wellKnown = map[protoreflect.FullName]map[string]interface{}{
+	"google.protobuf.Any": {
+		"type":                 "object",
+		"properties":           map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+		"additionalProperties": true,
+	},
+	"google.protobuf.Empty":       {"type": "object"},
+	"google.protobuf.Struct":      {"type": "object", "additionalProperties": true},
+	"google.protobuf.Value":       {},
+	"google.protobuf.ListValue":   {"type": "array", "items": map[string]interface{}{}},
+	"google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+	"google.protobuf.Duration":    {"type": "string"},
+	"google.protobuf.FieldMask":   {"type": "string"},
+	"google.protobuf.DoubleValue": {"type": "number", "format": "double"},
+	"google.protobuf.FloatValue":  {"type": "number", "format": "float"},
+	"google.protobuf.Int64Value":  {"type": "string", "format": "int64"},
+	"google.protobuf.UInt64Value": {"type": "string", "format": "uint64"},
+	"google.protobuf.Int32Value":  {"type": "integer", "format": "int32"},
+	"google.protobuf.UInt32Value": {"type": "integer", "format": "int64"},
+	"google.protobuf.BoolValue":   {"type": "boolean"},
+	"google.protobuf.StringValue": {"type": "string"},
+	"google.protobuf.BytesValue":  {"type": "string", "format": "byte"},
+}
+
+// resolve finds the descriptors of the services in the global registry, in the order of their names
+func resolve(services Services) ([]protoreflect.ServiceDescriptor, error) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]protoreflect.ServiceDescriptor, 0, len(names))
+	for _, name := range names {
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("the descriptor of service %s is not found: %v", name, err)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+		res = append(res, sd)
+	}
+	return res, nil
+}
+
+// served reports whether the method of the service is served
+func (s Services) served(service protoreflect.FullName, method protoreflect.Name) bool {
+	for _, m := range s[string(service)] {
+		if m == string(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// DescriptorSet returns the files defining the services, together with the files imported by them,
+// which are ordered as the ones generated by `protoc --include_imports`.
+// The services and the methods not served are removed from the files.
+func DescriptorSet(services Services) (*descriptorpb.FileDescriptorSet, error) {
+	sds, err := resolve(services)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if added[fd.Path()] {
+			return
+		}
+		added[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fdp := protodesc.ToFileDescriptorProto(fd)
+		fdp.Service = nil
+		for i := 0; i < fd.Services().Len(); i++ {
+			sd := fd.Services().Get(i)
+			if _, ok := services[string(sd.FullName())]; !ok {
+				continue
+			}
+			sdp := protodesc.ToServiceDescriptorProto(sd)
+			sdp.Method = nil
+			for j := 0; j < sd.Methods().Len(); j++ {
+				md := sd.Methods().Get(j)
+				if services.served(sd.FullName(), md.Name()) {
+					sdp.Method = append(sdp.Method, protodesc.ToMethodDescriptorProto(md))
+				}
+			}
+			fdp.Service = append(fdp.Service, sdp)
+		}
+		set.File = append(set.File, fdp)
+	}
+	for _, sd := range sds {
+		add(sd.ParentFile())
+	}
+	return set, nil
+}
+
+// OpenAPI returns the OpenAPI 3 document in JSON of the methods of the services, as they're served by the grpc server:
+// every method is a POST to its grpc path /<service>/<method> with the content type application/grpc.
+// The messages are length-prefixed protobuf on the wire, their schemas describe the fields by the protobuf JSON mapping.
+// The responses are always 200, the status of a call is carried in the grpc-status and grpc-message trailers,
+// and the streaming methods are marked by the x-grpc-streaming extension.
+func OpenAPI(services Services, title string, version string) ([]byte, error) {
+	sds, err := resolve(services)
+	if err != nil {
+		return nil, err
+	}
+	g := &openAPI{schemas: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+	for _, sd := range sds {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			if !services.served(sd.FullName(), md.Name()) {
+				continue
+			}
+			op := map[string]interface{}{
+				"operationId": fmt.Sprintf("%s_%s", sd.Name(), md.Name()),
+				"tags":        []string{string(sd.FullName())},
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content":  grpcContent(g.message(md.Input())),
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "The status of the call is carried in the grpc-status and grpc-message trailers",
+						"content":     grpcContent(g.message(md.Output())),
+					},
+				},
+			}
+			if streaming := streamingOf(md); streaming != "" {
+				op["x-grpc-streaming"] = streaming
+			}
+			paths[fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())] = map[string]interface{}{"post": op}
+		}
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]interface{}{"title": title, "version": version},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.schemas},
+	}, "", "  ")
+}
+
+// streamingOf returns which side of the method streams, i.e. client, server or bidi, or empty if it's unary
+func streamingOf(md protoreflect.MethodDescriptor) string {
+	switch {
+	case md.IsStreamingClient() && md.IsStreamingServer():
+		return "bidi"
+	case md.IsStreamingClient():
+		return "client"
+	case md.IsStreamingServer():
+		return "server"
+	}
+	return ""
+}
+
+// openAPI collects the schemas of the messages and the enums referenced by the methods
+type openAPI struct {
+	schemas map[string]interface{}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func grpcContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{grpcContentType: map[string]interface{}{"schema": schema}}
+}
+
+// message returns the schema of the message, which refers to the schema added to the components unless it's a well known type
+func (g *openAPI) message(md protoreflect.MessageDescriptor) map[string]interface{} {
+	if schema, ok := wellKnown[md.FullName()]; ok {
+		return schema
+	}
+	name := string(md.FullName())
+	if _, ok := g.schemas[name]; ok {
+		return ref(name)
+	}
+	// added before the fields, so the recursive messages refer to it instead of walking it again
+	schema := map[string]interface{}{"type": "object"}
+	g.schemas[name] = schema
+	if md.Fields().Len() > 0 {
+		properties := make(map[string]interface{}, md.Fields().Len())
+		for i := 0; i < md.Fields().Len(); i++ {
+			fd := md.Fields().Get(i)
+			properties[fd.JSONName()] = g.field(fd)
+		}
+		schema["properties"] = properties
+	}
+	return ref(name)
+}
+
+func (g *openAPI) enum(ed protoreflect.EnumDescriptor) map[string]interface{} {
+	name := string(ed.FullName())
+	if _, ok := g.schemas[name]; !ok {
+		values := make([]string, 0, ed.Values().Len())
+		for i := 0; i < ed.Values().Len(); i++ {
+			values = append(values, string(ed.Values().Get(i).Name()))
+		}
+		g.schemas[name] = map[string]interface{}{"type": "string", "enum": values}
+	}
+	return ref(name)
+}
+
+func (g *openAPI) field(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{"type": "object", "additionalProperties": g.singular(fd.MapValue())}
+	}
+	if fd.IsList() {
+		return map[string]interface{}{"type": "array", "items": g.singular(fd)}
+	}
+	return g.singular(fd)
+}
+
+// singular returns the schema of a value of the field, by the protobuf JSON mapping, e.g. the 64-bit integers are strings
+func (g *openAPI) singular(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		return g.enum(fd.Enum())
+	default:
+		return g.message(fd.Message())
+	}
+}
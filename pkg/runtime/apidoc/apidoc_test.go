@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apidoc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/reflect/protodesc"
+
+	_ "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const runtimeService = "spec.proto.runtime.v1.Runtime"
+
+func TestDescriptorSet(t *testing.T) {
+	set, err := DescriptorSet(Services{runtimeService: {"GetNextId", "SubscribeConfiguration"}})
+	assert.Nil(t, err)
+	// the imported files come first
+	last := set.File[len(set.File)-1]
+	assert.Equal(t, "spec.proto.runtime.v1", last.GetPackage())
+	var paths []string
+	for _, f := range set.File[:len(set.File)-1] {
+		paths = append(paths, f.GetName())
+	}
+	assert.Contains(t, paths, "google/protobuf/empty.proto")
+	assert.Contains(t, paths, "google/protobuf/any.proto")
+
+	// the Admin service and the other methods are removed
+	assert.Len(t, last.Service, 1)
+	assert.Equal(t, "Runtime", last.Service[0].GetName())
+	assert.Len(t, last.Service[0].Method, 2)
+	assert.Equal(t, "SubscribeConfiguration", last.Service[0].Method[0].GetName())
+	assert.Equal(t, "GetNextId", last.Service[0].Method[1].GetName())
+
+	// the set is self-contained
+	files, err := protodesc.NewFiles(set)
+	assert.Nil(t, err)
+	_, err = files.FindDescriptorByName(runtimeService)
+	assert.Nil(t, err)
+
+	_, err = DescriptorSet(Services{"not.a.Service": {"Foo"}})
+	assert.NotNil(t, err)
+	_, err = DescriptorSet(Services{"spec.proto.runtime.v1.GetNextIdRequest": {"Foo"}})
+	assert.NotNil(t, err)
+}
+
+func TestOpenAPI(t *testing.T) {
+	raw, err := OpenAPI(Services{runtimeService: {"GetNextId", "SubscribeConfiguration"}}, "Layotto API", "v1")
+	assert.Nil(t, err)
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.Nil(t, json.Unmarshal(raw, &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, "Layotto API", doc.Info.Title)
+
+	// the paths are the grpc paths of the methods
+	assert.Len(t, doc.Paths, 2)
+	op := doc.Paths["/spec.proto.runtime.v1.Runtime/GetNextId"]["post"]
+	assert.Equal(t, "Runtime_GetNextId", op["operationId"])
+	assert.NotContains(t, op, "x-grpc-streaming")
+	body, _ := json.Marshal(op["requestBody"])
+	assert.JSONEq(t, `{"required": true, "content": {"application/grpc": {"schema": {"$ref": "#/components/schemas/spec.proto.runtime.v1.GetNextIdRequest"}}}}`, string(body))
+	responses, _ := json.Marshal(op["responses"])
+	assert.Contains(t, string(responses), `"application/grpc"`)
+	assert.NotContains(t, string(responses), `"default"`)
+	op = doc.Paths["/spec.proto.runtime.v1.Runtime/SubscribeConfiguration"]["post"]
+	assert.Equal(t, "bidi", op["x-grpc-streaming"])
+
+	schemas := doc.Components.Schemas
+	props, _ := json.Marshal(schemas["spec.proto.runtime.v1.GetNextIdRequest"]["properties"])
+	assert.JSONEq(t, `{
+		"storeName": {"type": "string"},
+		"key": {"type": "string"},
+		"options": {"$ref": "#/components/schemas/spec.proto.runtime.v1.SequencerOptions"},
+		"metadata": {"type": "object", "additionalProperties": {"type": "string"}}
+	}`, string(props))
+	// the 64-bit integers are strings in JSON
+	props, _ = json.Marshal(schemas["spec.proto.runtime.v1.GetNextIdResponse"]["properties"])
+	assert.JSONEq(t, `{"nextId": {"type": "string", "format": "int64"}}`, string(props))
+	enum, _ := json.Marshal(schemas["spec.proto.runtime.v1.SequencerOptions.AutoIncrement"])
+	assert.JSONEq(t, `{"type": "string", "enum": ["WEAK", "STRONG"]}`, string(enum))
+	assert.Contains(t, schemas, "spec.proto.runtime.v1.SubscribeConfigurationRequest")
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bindings
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"github.com/dapr/components-contrib/bindings"
+
+	"mosn.io/layotto/components/pkg/egress"
+)
+
+// HTTPBindingName is the name of the http output binding, whose requests are sent by the egress policy
+const HTTPBindingName = "http"
+
+// EgressHTTPBinding is the http output binding of dapr whose client sends the requests by the transport of the egress policy,
+// so that they're checked by the allowlist, and sent through the proxy trusting the CA bundles.
+// The requests and the responses are the same as the ones of the wrapped binding.
+type EgressHTTPBinding struct {
+	bindings.OutputBinding
+	// basePath is the cleaned path of the url of the binding, which the paths of the requests can't escape
+	basePath string
+}
+
+// NewEgressHTTPBinding wraps the http binding initialized with the metadata
+func NewEgressHTTPBinding(comp bindings.OutputBinding, policy *egress.Policy, metadata map[string]string) (*EgressHTTPBinding, error) {
+	u, err := url.Parse(metadata["url"])
+	if err != nil || metadata["url"] == "" {
+		return nil, fmt.Errorf("invalid url of http binding: %s", metadata["url"])
+	}
+	client, err := httpClientOf(comp)
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = policy.WrapTransport(client.Transport)
+	return &EgressHTTPBinding{
+		OutputBinding: comp,
+		basePath:      path.Clean("/" + u.Path),
+	}, nil
+}
+
+// httpClientOf returns the client of the http binding initialized, which isn't exported by dapr
+func httpClientOf(comp bindings.OutputBinding) (*http.Client, error) {
+	v := reflect.ValueOf(comp)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported http binding %T", comp)
+	}
+	f := v.Elem().FieldByName("client")
+	if !f.IsValid() || f.Type() != reflect.TypeOf(&http.Client{}) || f.IsNil() {
+		return nil, fmt.Errorf("the client of http binding %T isn't found", comp)
+	}
+	return *(**http.Client)(unsafe.Pointer(f.Addr().Pointer())), nil
+}
+
+// Invoke checks the path in the metadata doesn't escape the url of the binding, and sends the request by the wrapped binding
+func (b *EgressHTTPBinding) Invoke(req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+	if p, ok := req.Metadata["path"]; ok {
+		// the path is checked decoded and cleaned like egress.Policy.Allow, so that e.g. "%2e%2e" doesn't escape the url
+		decoded, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path: %s", p)
+		}
+		joined := path.Clean(b.basePath + "/" + decoded)
+		if joined != b.basePath && !strings.HasPrefix(joined, strings.TrimSuffix(b.basePath, "/")+"/") {
+			return nil, fmt.Errorf("invalid path: %s", p)
+		}
+	}
+	return b.OutputBinding.Invoke(req)
+}
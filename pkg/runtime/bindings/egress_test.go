@@ -0,0 +1,109 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bindings
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dapr/components-contrib/bindings"
+	daprhttp "github.com/dapr/components-contrib/bindings/http"
+	"github.com/dapr/kit/logger"
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/pkg/egress"
+)
+
+type noClientBinding struct {
+	bindings.OutputBinding
+}
+
+func newHTTPBinding(t *testing.T, u string) bindings.OutputBinding {
+	comp := daprhttp.NewHTTP(logger.NewLogger("test"))
+	assert.Nil(t, comp.Init(bindings.Metadata{Name: HTTPBindingName, Properties: map[string]string{"url": u}}))
+	return comp
+}
+
+func TestEgressHTTPBinding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Trace", r.Header.Get("X-Trace"))
+		if r.URL.Path == "/api/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	policy, err := egress.NewPolicy(&egress.Config{Allow: []*egress.Rule{{Host: u.Hostname(), Paths: []string{"/api/**"}}}})
+	assert.Nil(t, err)
+
+	_, err = NewEgressHTTPBinding(newHTTPBinding(t, server.URL), policy, map[string]string{})
+	assert.NotNil(t, err)
+	// the bindings without the client of dapr's http binding
+	_, err = NewEgressHTTPBinding(&noClientBinding{}, policy, map[string]string{"url": server.URL})
+	assert.NotNil(t, err)
+	b, err := NewEgressHTTPBinding(newHTTPBinding(t, server.URL+"/api/"), policy, map[string]string{"url": server.URL + "/api/"})
+	assert.Nil(t, err)
+
+	t.Run("allowed", func(t *testing.T) {
+		resp, err := b.Invoke(&bindings.InvokeRequest{
+			Data:      []byte("hello"),
+			Metadata:  map[string]string{"path": "/orders", "X-Trace": "1", "lower": "ignored"},
+			Operation: "post",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(resp.Data))
+		assert.Equal(t, "200", resp.Metadata["statusCode"])
+		assert.Equal(t, http.MethodPost, resp.Metadata["X-Method"])
+		assert.Equal(t, "1", resp.Metadata["X-Trace"])
+	})
+
+	t.Run("status code", func(t *testing.T) {
+		resp, err := b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "fail"}, Operation: "get"})
+		assert.NotNil(t, err)
+		assert.Equal(t, "500", resp.Metadata["statusCode"])
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		b, err := NewEgressHTTPBinding(newHTTPBinding(t, server.URL), policy, map[string]string{"url": server.URL})
+		assert.Nil(t, err)
+		_, err = b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "admin"}, Operation: "get"})
+		var denied *egress.DeniedError
+		assert.True(t, errors.As(err, &denied))
+	})
+
+	t.Run("path", func(t *testing.T) {
+		_, err := b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "../admin"}, Operation: "get"})
+		assert.NotNil(t, err)
+		_, err = b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "%2e%2e/admin"}, Operation: "get"})
+		assert.NotNil(t, err)
+		_, err = b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "%zz"}, Operation: "get"})
+		assert.NotNil(t, err)
+		// the dots in the segments are valid
+		resp, err := b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "a..b"}, Operation: "get"})
+		assert.Nil(t, err)
+		assert.Equal(t, "200", resp.Metadata["statusCode"])
+		_, err = b.Invoke(&bindings.InvokeRequest{Metadata: map[string]string{"path": "orders/../items"}, Operation: "get"})
+		assert.Nil(t, err)
+	})
+}
@@ -16,7 +16,102 @@
 
 package bindings
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	MetadataTypeString   = "string"
+	MetadataTypeInt      = "int"
+	MetadataTypeBool     = "bool"
+	MetadataTypeDuration = "duration"
+)
+
+// InvalidMetadataError is returned if the metadata of a request doesn't match the operation metadata of the binding
+type InvalidMetadataError struct {
+	msg string
+}
+
+func (e *InvalidMetadataError) Error() string {
+	return e.msg
+}
+
 type Metadata struct {
 	Version  string
 	Metadata map[string]string `json:"metadata"`
+	// DefaultMetadata is merged into the metadata of the requests invoking the output binding, the requests win
+	DefaultMetadata map[string]string `json:"default_metadata,omitempty"`
+	// OperationMetadata maps the operations to the metadata required by them,
+	// which is validated after merging the default metadata and before invoking the output binding
+	OperationMetadata map[string][]MetadataField `json:"operation_metadata,omitempty"`
+}
+
+// MetadataField is a metadata required by an operation
+type MetadataField struct {
+	Name string `json:"name"`
+	// Type is one of string, int, bool and duration, the value is any string if it's empty
+	Type string `json:"type,omitempty"`
+}
+
+// MergeMetadata returns the metadata of a request invoking the operation merged with the default metadata,
+// it fails with InvalidMetadataError if the metadata required by the operation is missing or of a wrong type.
+func (m *Metadata) MergeMetadata(operation string, metadata map[string]string) (map[string]string, error) {
+	merged := metadata
+	if len(m.DefaultMetadata) > 0 {
+		merged = make(map[string]string, len(m.DefaultMetadata)+len(metadata))
+		for k, v := range m.DefaultMetadata {
+			merged[k] = v
+		}
+		for k, v := range metadata {
+			merged[k] = v
+		}
+	}
+	for _, f := range m.OperationMetadata[operation] {
+		v, ok := merged[f.Name]
+		if !ok {
+			return nil, &InvalidMetadataError{msg: fmt.Sprintf("%s is required by operation %s", f.Name, operation)}
+		}
+		if err := checkMetadataType(f.Type, v); err != nil {
+			return nil, &InvalidMetadataError{msg: fmt.Sprintf("%s of operation %s should be %s: %s", f.Name, operation, f.Type, v)}
+		}
+	}
+	return merged, nil
+}
+
+// Validate checks the types of the operation metadata
+func (m *Metadata) Validate() error {
+	operations := make([]string, 0, len(m.OperationMetadata))
+	for op := range m.OperationMetadata {
+		operations = append(operations, op)
+	}
+	sort.Strings(operations)
+	for _, op := range operations {
+		for _, f := range m.OperationMetadata[op] {
+			if f.Name == "" {
+				return fmt.Errorf("the name of the metadata of operation %s is empty", op)
+			}
+			switch f.Type {
+			case "", MetadataTypeString, MetadataTypeInt, MetadataTypeBool, MetadataTypeDuration:
+			default:
+				return fmt.Errorf("unknown type %s of metadata %s of operation %s, expected string, int, bool or duration", f.Type, f.Name, op)
+			}
+		}
+	}
+	return nil
+}
+
+func checkMetadataType(typ string, value string) error {
+	var err error
+	switch typ {
+	case MetadataTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case MetadataTypeBool:
+		_, err = strconv.ParseBool(value)
+	case MetadataTypeDuration:
+		_, err = time.ParseDuration(value)
+	}
+	return err
 }
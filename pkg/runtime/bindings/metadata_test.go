@@ -0,0 +1,73 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bindings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	m := &Metadata{
+		DefaultMetadata: map[string]string{"contentType": "text/plain", "ttlInSeconds": "60"},
+		OperationMetadata: map[string][]MetadataField{
+			"create": {{Name: "key"}, {Name: "ttlInSeconds", Type: MetadataTypeInt}},
+		},
+	}
+
+	t.Run("request wins", func(t *testing.T) {
+		md, err := m.MergeMetadata("create", map[string]string{"key": "k", "ttlInSeconds": "10"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"key": "k", "contentType": "text/plain", "ttlInSeconds": "10"}, md)
+	})
+
+	t.Run("required metadata is missing", func(t *testing.T) {
+		_, err := m.MergeMetadata("create", nil)
+		assert.IsType(t, &InvalidMetadataError{}, err)
+		assert.Equal(t, "key is required by operation create", err.Error())
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		_, err := m.MergeMetadata("create", map[string]string{"key": "k", "ttlInSeconds": "1m"})
+		assert.IsType(t, &InvalidMetadataError{}, err)
+	})
+
+	t.Run("operation without required metadata", func(t *testing.T) {
+		md, err := m.MergeMetadata("get", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, m.DefaultMetadata, md)
+	})
+
+	t.Run("no default metadata", func(t *testing.T) {
+		md := map[string]string{"key": "k"}
+		merged, err := (&Metadata{}).MergeMetadata("create", md)
+		assert.Nil(t, err)
+		assert.Equal(t, md, merged)
+	})
+}
+
+func TestValidateOperationMetadata(t *testing.T) {
+	m := &Metadata{OperationMetadata: map[string][]MetadataField{
+		"create": {{Name: "key"}, {Name: "ttl", Type: MetadataTypeDuration}, {Name: "async", Type: MetadataTypeBool}},
+	}}
+	assert.Nil(t, m.Validate())
+	m.OperationMetadata["delete"] = []MetadataField{{Name: "key", Type: "float"}}
+	assert.NotNil(t, m.Validate())
+	m.OperationMetadata["delete"] = []MetadataField{{Type: MetadataTypeString}}
+	assert.NotNil(t, m.Validate())
+}
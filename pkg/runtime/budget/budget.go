@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package budget caps the memory used by the caches, buffers and spools of the runtime,
+// so that the overhead of the sidecar is bounded on dense nodes.
+package budget
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/pkg/actuator/info"
+)
+
+const defaultCheckInterval = time.Second
+
+var ErrMemoryBudgetExceeded = errors.New("memory budget of the runtime is exceeded")
+
+// Config is the resource budget. A limit is disabled if it's not positive.
+type Config struct {
+	// MaxMemoryBytes caps the memory held by the registered consumers, e.g. caches and buffers
+	MaxMemoryBytes int64 `json:"max_memory_bytes"`
+	// MaxPayloadBytes rejects the requests larger than it
+	MaxPayloadBytes int `json:"max_payload_bytes"`
+	// CheckIntervalMs is the interval to enforce the memory budget, 1000 by default
+	CheckIntervalMs int `json:"check_interval_ms"`
+}
+
+// Consumer holds memory which is accounted by the budget. MemoryUsage should be cheap.
+type Consumer interface {
+	MemoryUsage() int64
+}
+
+// Shrinker is implemented by the consumers which can release memory, e.g. by evicting caches or dropping buffered items.
+type Shrinker interface {
+	// Shrink releases memory until the usage is not larger than target
+	Shrink(target int64)
+}
+
+var (
+	mu        sync.RWMutex
+	consumers = make(map[string]Consumer)
+	maxMemory int64
+	stopCh    chan struct{}
+	// counters
+	rejected uint64
+	shrunk   uint64
+)
+
+func init() {
+	info.AddInfoContributorFunc("resource_budget", func() (interface{}, error) {
+		usages := make(map[string]int64)
+		var total int64
+		mu.RLock()
+		for name, c := range consumers {
+			u := c.MemoryUsage()
+			usages[name] = u
+			total += u
+		}
+		mu.RUnlock()
+		return map[string]interface{}{
+			"max_memory_bytes": atomic.LoadInt64(&maxMemory),
+			"usage_bytes":      total,
+			"consumers":        usages,
+			"rejected":         atomic.LoadUint64(&rejected),
+			"shrunk":           atomic.LoadUint64(&shrunk),
+		}, nil
+	})
+}
+
+// Register adds a consumer, the one with the same name is replaced
+func Register(name string, c Consumer) {
+	mu.Lock()
+	consumers[name] = c
+	mu.Unlock()
+}
+
+func Unregister(name string) {
+	mu.Lock()
+	delete(consumers, name)
+	mu.Unlock()
+}
+
+// Init applies the budget and starts to enforce it periodically. It can be called again to change the budget.
+func Init(cfg *Config) {
+	Stop()
+	if cfg == nil || cfg.MaxMemoryBytes <= 0 {
+		atomic.StoreInt64(&maxMemory, 0)
+		return
+	}
+	atomic.StoreInt64(&maxMemory, cfg.MaxMemoryBytes)
+	interval := time.Duration(cfg.CheckIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	ch := make(chan struct{})
+	mu.Lock()
+	stopCh = ch
+	mu.Unlock()
+	utils.GoWithRecover(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				Enforce()
+			case <-ch:
+				return
+			}
+		}
+	}, nil)
+}
+
+// Stop stops enforcing the budget
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		stopCh = nil
+	}
+}
+
+// Usage returns the memory held by all the consumers
+func Usage() int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	var total int64
+	for _, c := range consumers {
+		total += c.MemoryUsage()
+	}
+	return total
+}
+
+// Allow tells whether n more bytes can be held. The callers should reject or drop the data if it returns false.
+func Allow(n int64) bool {
+	max := atomic.LoadInt64(&maxMemory)
+	if max <= 0 || Usage()+n <= max {
+		return true
+	}
+	atomic.AddUint64(&rejected, 1)
+	return false
+}
+
+// Enforce shrinks the consumers if the budget is exceeded, the largest consumer is shrunk first.
+func Enforce() {
+	max := atomic.LoadInt64(&maxMemory)
+	if max <= 0 {
+		return
+	}
+	type usage struct {
+		name     string
+		consumer Consumer
+		shrinker Shrinker
+		bytes    int64
+	}
+	var shrinkers []usage
+	var total int64
+	mu.RLock()
+	for name, c := range consumers {
+		u := c.MemoryUsage()
+		total += u
+		if s, ok := c.(Shrinker); ok {
+			shrinkers = append(shrinkers, usage{name: name, consumer: c, shrinker: s, bytes: u})
+		}
+	}
+	mu.RUnlock()
+	excess := total - max
+	if excess <= 0 {
+		return
+	}
+	sort.Slice(shrinkers, func(i, j int) bool {
+		return shrinkers[i].bytes > shrinkers[j].bytes
+	})
+	for _, s := range shrinkers {
+		if excess <= 0 {
+			break
+		}
+		target := s.bytes - excess
+		if target < 0 {
+			target = 0
+		}
+		s.shrinker.Shrink(target)
+		released := s.bytes - s.consumer.MemoryUsage()
+		if released > 0 {
+			excess -= released
+			atomic.AddUint64(&shrunk, 1)
+			log.DefaultLogger.Warnf("[runtime] [budget] memory budget %d exceeded, %s released %d bytes", max, s.name, released)
+		}
+	}
+	if excess > 0 {
+		log.DefaultLogger.Errorf("[runtime] [budget] memory budget %d is still exceeded by %d bytes", max, excess)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package budget
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockConsumer struct {
+	usage int64
+}
+
+func (m *mockConsumer) MemoryUsage() int64 {
+	return m.usage
+}
+
+type mockShrinker struct {
+	mockConsumer
+}
+
+func (m *mockShrinker) Shrink(target int64) {
+	m.usage = target
+}
+
+func TestBudget(t *testing.T) {
+	fixed := &mockConsumer{usage: 100}
+	small := &mockShrinker{mockConsumer{usage: 50}}
+	large := &mockShrinker{mockConsumer{usage: 200}}
+	Register("fixed", fixed)
+	Register("small", small)
+	Register("large", large)
+	defer func() {
+		Unregister("fixed")
+		Unregister("small")
+		Unregister("large")
+		Init(nil)
+	}()
+
+	// unlimited
+	assert.True(t, Allow(1<<30))
+	Enforce()
+	assert.Equal(t, int64(350), Usage())
+
+	Init(&Config{MaxMemoryBytes: 300, CheckIntervalMs: 3600000})
+	assert.True(t, Allow(-50))
+	assert.False(t, Allow(1))
+
+	// the largest one is shrunk first
+	Enforce()
+	assert.Equal(t, int64(150), large.usage)
+	assert.Equal(t, int64(50), small.usage)
+	assert.Equal(t, int64(300), Usage())
+
+	// shrink all the shrinkers if needed
+	fixed.usage = 280
+	Enforce()
+	assert.Equal(t, int64(0), large.usage)
+	assert.Equal(t, int64(20), small.usage)
+}
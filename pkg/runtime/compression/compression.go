@@ -0,0 +1,168 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package compression compresses the file streams and the state values with gzip or zstd.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+	// None disables the compression, e.g. for the files which are compressed already
+	None = "none"
+
+	defaultMinSize = 1024
+)
+
+// magic is the prefix of the compressed values, followed by the id of the algorithm
+var magic = []byte("\x00l8z")
+
+var ErrCorruptedValue = errors.New("the compressed value is corrupted")
+
+// Config is the config of compression
+type Config struct {
+	// Algorithm is gzip, zstd or none, gzip by default
+	Algorithm string `json:"algorithm"`
+	// MinSizeBytes is the min size of the data to compress, 1024 by default
+	MinSizeBytes int `json:"min_size_bytes"`
+}
+
+func (c *Config) Validate() error {
+	return Validate(c.GetAlgorithm())
+}
+
+func (c *Config) GetAlgorithm() string {
+	if c.Algorithm == "" {
+		return Gzip
+	}
+	return c.Algorithm
+}
+
+// MinSize returns the min size of the data to compress
+func (c *Config) MinSize() int {
+	if c.MinSizeBytes <= 0 {
+		return defaultMinSize
+	}
+	return c.MinSizeBytes
+}
+
+// Validate checks whether the algorithm is supported
+func Validate(algorithm string) error {
+	switch algorithm {
+	case Gzip, Zstd, None:
+		return nil
+	}
+	return fmt.Errorf("unsupported compression algorithm %q, expected gzip, zstd or none", algorithm)
+}
+
+// NewWriter compresses the data written to w
+func NewWriter(algorithm string, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, Validate(algorithm)
+}
+
+// NewReader decompresses the data read from r
+func NewReader(algorithm string, r io.Reader) (io.ReadCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, Validate(algorithm)
+}
+
+// Compress compresses the value, and the result is prefixed by the magic and the algorithm so that it can be detected by Decompress
+func Compress(algorithm string, value []byte) ([]byte, error) {
+	id, err := algorithmID(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(id)
+	w, err := NewWriter(algorithm, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// IsCompressed tells whether the value is compressed by Compress
+func IsCompressed(value []byte) bool {
+	return len(value) > len(magic) && bytes.HasPrefix(value, magic)
+}
+
+// Decompress decompresses the value compressed by Compress, the other values are returned as they are
+func Decompress(value []byte) ([]byte, error) {
+	if !IsCompressed(value) {
+		return value, nil
+	}
+	var algorithm string
+	switch value[len(magic)] {
+	case 'g':
+		algorithm = Gzip
+	case 'z':
+		algorithm = Zstd
+	default:
+		return nil, ErrCorruptedValue
+	}
+	r, err := NewReader(algorithm, bytes.NewReader(value[len(magic)+1:]))
+	if err != nil {
+		return nil, ErrCorruptedValue
+	}
+	defer r.Close()
+	res, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrCorruptedValue
+	}
+	return res, nil
+}
+
+func algorithmID(algorithm string) (byte, error) {
+	switch algorithm {
+	case Gzip:
+		return 'g', nil
+	case Zstd:
+		return 'z', nil
+	}
+	return 0, fmt.Errorf("unsupported compression algorithm %q, expected gzip or zstd", algorithm)
+}
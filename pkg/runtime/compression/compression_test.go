@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	value := []byte(strings.Repeat("layotto", 1000))
+	for _, algorithm := range []string{Gzip, Zstd} {
+		compressed, err := Compress(algorithm, value)
+		assert.Nil(t, err)
+		assert.True(t, IsCompressed(compressed))
+		assert.True(t, len(compressed) < len(value))
+		decompressed, err := Decompress(compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, value, decompressed)
+	}
+	_, err := Compress(None, value)
+	assert.NotNil(t, err)
+
+	// the values which aren't compressed are returned as they are
+	plain, err := Decompress([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(plain))
+	_, err = Decompress(append(magic, 'x', 1, 2))
+	assert.Equal(t, ErrCorruptedValue, err)
+}
+
+func TestStream(t *testing.T) {
+	value := []byte(strings.Repeat("layotto", 1000))
+	for _, algorithm := range []string{Gzip, Zstd} {
+		var buf bytes.Buffer
+		w, err := NewWriter(algorithm, &buf)
+		assert.Nil(t, err)
+		_, err = w.Write(value)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+
+		r, err := NewReader(algorithm, &buf)
+		assert.Nil(t, err)
+		got, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+		assert.Equal(t, value, got)
+	}
+	_, err := NewWriter("lz4", &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
+
+func TestConfig(t *testing.T) {
+	c := &Config{}
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, Gzip, c.GetAlgorithm())
+	assert.Equal(t, defaultMinSize, c.MinSize())
+	c.Algorithm = "lz4"
+	assert.NotNil(t, c.Validate())
+}
@@ -19,15 +19,25 @@ package runtime
 import (
 	"encoding/json"
 
+	"mosn.io/layotto/diagnostics/fault"
+	"mosn.io/layotto/diagnostics/watchdog"
+
 	"mosn.io/layotto/pkg/runtime/bindings"
+	"mosn.io/layotto/pkg/runtime/budget"
+	"mosn.io/layotto/pkg/runtime/compression"
+	"mosn.io/layotto/pkg/runtime/crd"
+	runtime_file "mosn.io/layotto/pkg/runtime/file"
+	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
 
 	"mosn.io/layotto/components/file"
 
 	"mosn.io/layotto/components/configstores"
 	"mosn.io/layotto/components/hello"
 	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/pkg/grpc"
 	"mosn.io/layotto/pkg/runtime/pubsub"
 	"mosn.io/layotto/pkg/runtime/state"
 )
@@ -35,6 +45,12 @@ import (
 type AppConfig struct {
 	AppId            string `json:"app_id"`
 	GrpcCallbackPort int    `json:"grpc_callback_port"`
+	// HttpCallback delivers topic events to the app over HTTP instead of the gRPC AppCallback service
+	HttpCallback *pubsub.HTTPCallbackConfig `json:"http_callback,omitempty"`
+	// Callbacks are the extra targets receiving topic events besides the app, e.g. a local audit processor
+	Callbacks map[string]*pubsub.CallbackTargetConfig `json:"callbacks,omitempty"`
+	// Tokens authenticate the requests of the app, which are required if there are tenants
+	Tokens []string `json:"tokens,omitempty"`
 }
 
 type MosnRuntimeConfig struct {
@@ -49,9 +65,61 @@ type MosnRuntimeConfig struct {
 	SequencerManagement    map[string]sequencer.Config         `json:"sequencer"`
 	Bindings               map[string]bindings.Metadata        `json:"bindings"`
 	SecretStoresManagement map[string]bindings.Metadata        `json:"secretStores"`
+	// DataClasses maps the data classes (e.g. "pii") to the json paths of the fields of them in the state values,
+	// the state stores block or redact the classes by their classification policy
+	DataClasses map[string][]string `json:"data_classes,omitempty"`
+	// DefaultComponents maps the kind of components (e.g. "state") to the default one,
+	// which is used when a request omits the component name.
+	DefaultComponents map[string]string `json:"default_components"`
+	// ComponentAliases maps the kind of components to the aliases of them,
+	// so apps can keep the names in requests when switching to another component.
+	ComponentAliases map[string]map[string]string `json:"component_aliases"`
+	// Watchdog logs slow requests and captures profiles automatically, it's disabled if not configured
+	Watchdog *watchdog.Config `json:"watchdog,omitempty"`
+	// FaultInjection injects delays, errors and aborts into the Runtime API for chaos testing,
+	// the injection can be toggled and the rules can be replaced by the Admin service
+	FaultInjection *fault.Config `json:"fault_injection,omitempty"`
+	// ResourceBudget caps the memory overhead of the runtime, it's unlimited if not configured
+	ResourceBudget *budget.Config `json:"resource_budget,omitempty"`
+	// FileEvents maps the name of file components to the config of the events published after files are changed
+	FileEvents map[string]runtime_file.EventConfig `json:"file_events"`
+	// FileEncryption maps the name of file components to the config of client-side encryption
+	FileEncryption map[string]runtime_file.EncryptionConfig `json:"file_encryption"`
+	// FileCompression maps the name of file components to the config of compression
+	FileCompression map[string]compression.Config `json:"file_compression"`
+	// FileJanitor maps the name of file components to the config of aborting the incomplete uploads left behind
+	FileJanitor map[string]runtime_file.JanitorConfig `json:"file_janitor"`
+	// LockLocal maps the name of lock components to the config of the lock table in the sidecar
+	LockLocal map[string]runtime_lock.LocalConfig `json:"lock_local"`
+	// LockStats maps the name of lock components to the config of the metrics of the locks, grouped by the patterns of resource ids
+	LockStats map[string]runtime_lock.StatsConfig `json:"lock_stats"`
+	// Tenants maps the id of the apps served besides the main app to the config of them,
+	// the requests carrying a token of the app in the metadata are served with the components of the app
+	Tenants map[string]TenantConfig `json:"tenants,omitempty"`
+	// CRD loads the components, the subscriptions and the aliases declared by the Kubernetes custom resources
+	CRD *crd.Config `json:"crd,omitempty"`
+	// Admin enables the Admin service, which registers and unregisters the components at runtime
+	Admin *AdminConfig `json:"admin,omitempty"`
+	// Profile selects the API groups and the background subsystems started, all of them start if it's not configured
+	Profile *ProfileConfig `json:"profile,omitempty"`
+	// WasmFilters are the wasm modules intercepting the unary calls of the runtime APIs in order,
+	// e.g. validating or enriching the requests, which don't require recompiling the sidecar
+	WasmFilters []json.RawMessage `json:"wasm_filters,omitempty"`
+	// GrpcServer tunes the connections of the grpc server and drains the streams before stopping
+	GrpcServer *grpc.ServerConfig `json:"grpc_server,omitempty"`
+	// GrpcDebug registers the debug services on the grpc server, e.g. reflection and channelz
+	GrpcDebug *grpc.DebugConfig `json:"grpc_debug,omitempty"`
+	// Egress is the allowlist, the proxy and the CA bundles of the outbound HTTP requests,
+	// i.e. the ones of the http binding and the http channels of the rpcs
+	Egress *egress.Config `json:"egress,omitempty"`
 }
 
+// ParseRuntimeConfig parses the runtime config after the references to the environment variables and the files are replaced
 func ParseRuntimeConfig(data json.RawMessage) (*MosnRuntimeConfig, error) {
+	data, err := interpolateConfig(data)
+	if err != nil {
+		return nil, err
+	}
 	cfg := &MosnRuntimeConfig{}
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
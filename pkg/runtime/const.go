@@ -20,4 +20,6 @@ import "time"
 
 const (
 	dialTimeout = time.Second * 30
+	// connectionWatchInterval is the interval of refreshing the connection states of the configuration stores in the metrics
+	connectionWatchInterval = time.Second * 10
 )
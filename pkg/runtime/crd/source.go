@@ -0,0 +1,166 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	ComponentResource     = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "components"}
+	SubscriptionResource  = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "subscriptions"}
+	ConfigurationResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "configurations"}
+)
+
+var ErrNamespaceEmpty = errors.New("the namespace of the custom resources is required")
+
+// Config is the config of loading the custom resources from Kubernetes
+type Config struct {
+	// Namespace is the namespace of the resources
+	Namespace string `json:"namespace"`
+	// KubeconfigPath is used out of the cluster, the in-cluster config is used if it's empty
+	KubeconfigPath string `json:"kubeconfig_path,omitempty"`
+	// Watch reconciles the components when the resources change, otherwise they're loaded at startup only
+	Watch bool `json:"watch,omitempty"`
+}
+
+func (c *Config) Validate() error {
+	if c.Namespace == "" {
+		return ErrNamespaceEmpty
+	}
+	return nil
+}
+
+// Source loads the resources in the scope of an app
+type Source struct {
+	namespace string
+	appId     string
+	client    dynamic.Interface
+}
+
+func NewSource(cfg *Config, appId string) (*Source, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	config, err := restConfig(cfg.KubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newSource(cfg.Namespace, appId, client), nil
+}
+
+func newSource(namespace string, appId string, client dynamic.Interface) *Source {
+	return &Source{namespace: namespace, appId: appId, client: client}
+}
+
+func restConfig(kubeconfigPath string) (*rest.Config, error) {
+	if kubeconfigPath == "" {
+		return rest.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+}
+
+// Load lists the resources from the API server
+func (s *Source) Load(ctx context.Context) (*Snapshot, error) {
+	var components []Component
+	if err := s.list(ctx, ComponentResource, &components); err != nil {
+		return nil, err
+	}
+	var subscriptions []Subscription
+	if err := s.list(ctx, SubscriptionResource, &subscriptions); err != nil {
+		return nil, err
+	}
+	var configurations []Configuration
+	if err := s.list(ctx, ConfigurationResource, &configurations); err != nil {
+		return nil, err
+	}
+	return NewSnapshot(s.appId, components, subscriptions, configurations)
+}
+
+func (s *Source) list(ctx context.Context, resource schema.GroupVersionResource, out interface{}) error {
+	list, err := s.client.Resource(resource).Namespace(s.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	return decode(list.Items, out)
+}
+
+// decode converts the unstructured objects to the typed ones by their json
+func decode(items []unstructured.Unstructured, out interface{}) error {
+	objs := make([]map[string]interface{}, 0, len(items))
+	for i := range items {
+		objs = append(objs, items[i].Object)
+	}
+	data, err := json.Marshal(objs)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Watch calls the handler with the resources loaded again after they change, until ctx is done.
+// The changes made while the handler is running are merged into one call.
+func (s *Source) Watch(ctx context.Context, handler func(*Snapshot, error)) {
+	notify := make(chan struct{}, 1)
+	changed := func() {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(s.client, 0, s.namespace, nil)
+	var synced []cache.InformerSynced
+	for _, resource := range []schema.GroupVersionResource{ComponentResource, SubscriptionResource, ConfigurationResource} {
+		informer := factory.ForResource(resource).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { changed() },
+			UpdateFunc: func(oldObj, newObj interface{}) { changed() },
+			DeleteFunc: func(obj interface{}) { changed() },
+		})
+		synced = append(synced, informer.HasSynced)
+	}
+	factory.Start(ctx.Done())
+	go func() {
+		// the resources listed by the informers at first are the ones loaded already
+		if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-notify:
+			}
+			handler(s.Load(ctx))
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDecode(t *testing.T) {
+	items := []unstructured.Unstructured{{Object: map[string]interface{}{
+		"apiVersion": "layotto.io/v1alpha1",
+		"kind":       "Component",
+		"metadata":   map[string]interface{}{"name": "redis", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"type":     "state.redis",
+			"metadata": []interface{}{map[string]interface{}{"name": "redisHost", "value": "localhost:6379"}},
+		},
+		"scopes": []interface{}{"app1"},
+	}}}
+	var components []Component
+	assert.Nil(t, decode(items, &components))
+	assert.Equal(t, []Component{{
+		Metadata: ObjectMeta{Name: "redis", Namespace: "default"},
+		Spec: ComponentSpec{
+			Type:     "state.redis",
+			Metadata: []MetadataItem{{Name: "redisHost", Value: "localhost:6379"}},
+		},
+		Scopes: []string{"app1"},
+	}}, components)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mosn.io/layotto/pkg/actuator"
+)
+
+const (
+	endpointName = "crd"
+	// reconcileParam loads the resources and reconciles the components at once, e.g. /actuator/crd/reconcile
+	reconcileParam = "reconcile"
+)
+
+var ErrNotWatching = errors.New("the runtime doesn't watch the custom resources")
+
+func init() {
+	actuator.GetDefault().AddEndpoint(endpointName, NewEndpoint())
+}
+
+// Status is the result of the last reconcile
+type Status struct {
+	// Time is the time of the last reconcile
+	Time time.Time `json:"time"`
+	// Error is the error of the last reconcile, the components are kept unchanged if it's not empty
+	Error string `json:"error,omitempty"`
+	// Pending are the components and the subscriptions changed, which apply after the runtime restarts
+	Pending []string `json:"pending,omitempty"`
+}
+
+var (
+	mu         sync.Mutex
+	status     *Status
+	reconciler func(ctx context.Context) error
+)
+
+// SetReconciler sets the function reconciling the components, which is called by the actuator endpoint
+func SetReconciler(f func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	reconciler = f
+}
+
+// SetStatus saves the result of the last reconcile
+func SetStatus(s *Status) {
+	mu.Lock()
+	defer mu.Unlock()
+	status = s
+}
+
+type Endpoint struct {
+}
+
+func NewEndpoint() *Endpoint {
+	return &Endpoint{}
+}
+
+// Handle returns the result of the last reconcile, or reconciles the components at once:
+//
+//	/actuator/crd            returns the result of the last reconcile
+//	/actuator/crd/reconcile  reconciles the components and returns the result
+func (e *Endpoint) Handle(ctx context.Context, params actuator.ParamsScanner) (map[string]interface{}, error) {
+	mu.Lock()
+	f := reconciler
+	mu.Unlock()
+	if params != nil && params.HasNext() && params.Next() == reconcileParam {
+		if f == nil {
+			return map[string]interface{}{"error": ErrNotWatching.Error()}, ErrNotWatching
+		}
+		// the error is reported in the status
+		_ = f(ctx)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return map[string]interface{}{
+		"watching": f != nil,
+		"status":   status,
+	}, nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockScanner struct {
+	params []string
+}
+
+func (m *mockScanner) Next() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	p := m.params[0]
+	m.params = m.params[1:]
+	return p
+}
+
+func (m *mockScanner) HasNext() bool {
+	return len(m.params) > 0
+}
+
+func TestEndpoint(t *testing.T) {
+	defer SetReconciler(nil)
+	defer SetStatus(nil)
+	e := NewEndpoint()
+
+	// not watching
+	result, err := e.Handle(context.Background(), &mockScanner{})
+	assert.Nil(t, err)
+	assert.Equal(t, false, result["watching"])
+	_, err = e.Handle(context.Background(), &mockScanner{params: []string{reconcileParam}})
+	assert.Equal(t, ErrNotWatching, err)
+
+	// watching
+	now := time.Now()
+	SetReconciler(func(ctx context.Context) error {
+		SetStatus(&Status{Time: now, Pending: []string{"pub_subs.kafka"}})
+		return nil
+	})
+	result, err = e.Handle(context.Background(), &mockScanner{})
+	assert.Nil(t, err)
+	assert.Equal(t, true, result["watching"])
+	assert.Nil(t, result["status"])
+
+	result, err = e.Handle(context.Background(), &mockScanner{params: []string{reconcileParam}})
+	assert.Nil(t, err)
+	assert.Equal(t, &Status{Time: now, Pending: []string{"pub_subs.kafka"}}, result["status"])
+}
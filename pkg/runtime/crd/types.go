@@ -0,0 +1,239 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+// The API group and the version of the custom resources
+const (
+	Group   = "layotto.io"
+	Version = "v1alpha1"
+)
+
+// Kinds are the kinds of components declared by the Component resources, named after the keys in the runtime config.
+// The components of the other kinds are configured in the runtime config only.
+var Kinds = []alias.Kind{alias.State, alias.PubSub, alias.Lock, alias.Sequencer, alias.Binding, alias.SecretStore}
+
+// ObjectMeta is the part of the metadata of the resources used by the runtime
+type ObjectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// Component declares a component of the runtime
+type Component struct {
+	Metadata ObjectMeta    `json:"metadata"`
+	Spec     ComponentSpec `json:"spec"`
+	// Scopes are the ids of the apps using the resource, all the apps use it if it's empty
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type ComponentSpec struct {
+	// Type is <kind>.<name>, e.g. state.redis declares the state component named redis
+	Type     string         `json:"type"`
+	Metadata []MetadataItem `json:"metadata"`
+}
+
+type MetadataItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Subscription declares a topic subscription of the app, besides the ones listed by the app itself
+type Subscription struct {
+	Metadata ObjectMeta       `json:"metadata"`
+	Spec     SubscriptionSpec `json:"spec"`
+	Scopes   []string         `json:"scopes,omitempty"`
+}
+
+type SubscriptionSpec struct {
+	PubsubName string            `json:"pubsubname"`
+	Topic      string            `json:"topic"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// Configuration declares the default components and the aliases of components
+type Configuration struct {
+	Metadata ObjectMeta        `json:"metadata"`
+	Spec     ConfigurationSpec `json:"spec"`
+	Scopes   []string          `json:"scopes,omitempty"`
+}
+
+type ConfigurationSpec struct {
+	DefaultComponents map[string]string            `json:"default_components,omitempty"`
+	ComponentAliases  map[string]map[string]string `json:"component_aliases,omitempty"`
+}
+
+// Snapshot is the config declared by the resources of an app
+type Snapshot struct {
+	// Components maps the kind to the name to the metadata of the components
+	Components        map[alias.Kind]map[string]map[string]string
+	Subscriptions     []pubsub.Subscription
+	DefaultComponents map[string]string
+	ComponentAliases  map[string]map[string]string
+}
+
+// NewSnapshot collects the resources in the scope of the app,
+// the configurations are merged in the order of the names, so the latter ones win.
+func NewSnapshot(appId string, components []Component, subscriptions []Subscription, configurations []Configuration) (*Snapshot, error) {
+	s := &Snapshot{
+		Components:        make(map[alias.Kind]map[string]map[string]string),
+		DefaultComponents: make(map[string]string),
+		ComponentAliases:  make(map[string]map[string]string),
+	}
+	for _, c := range components {
+		if !inScope(appId, c.Scopes) {
+			continue
+		}
+		kind, name, err := parseType(c.Spec.Type)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %v", c.Metadata.Name, err)
+		}
+		if _, ok := s.Components[kind][name]; ok {
+			return nil, fmt.Errorf("component %s: %s is declared more than once", c.Metadata.Name, c.Spec.Type)
+		}
+		if s.Components[kind] == nil {
+			s.Components[kind] = make(map[string]map[string]string)
+		}
+		md := make(map[string]string, len(c.Spec.Metadata))
+		for _, item := range c.Spec.Metadata {
+			md[item.Name] = item.Value
+		}
+		s.Components[kind][name] = md
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Metadata.Name < subscriptions[j].Metadata.Name
+	})
+	for _, sub := range subscriptions {
+		if !inScope(appId, sub.Scopes) {
+			continue
+		}
+		if sub.Spec.PubsubName == "" || sub.Spec.Topic == "" {
+			return nil, fmt.Errorf("subscription %s: pubsubname and topic are required", sub.Metadata.Name)
+		}
+		s.Subscriptions = append(s.Subscriptions, pubsub.Subscription{
+			PubsubName: sub.Spec.PubsubName,
+			Topic:      sub.Spec.Topic,
+			Metadata:   sub.Spec.Metadata,
+		})
+	}
+	sort.Slice(configurations, func(i, j int) bool {
+		return configurations[i].Metadata.Name < configurations[j].Metadata.Name
+	})
+	for _, c := range configurations {
+		if !inScope(appId, c.Scopes) {
+			continue
+		}
+		for kind, name := range c.Spec.DefaultComponents {
+			s.DefaultComponents[kind] = name
+		}
+		for kind, aliases := range c.Spec.ComponentAliases {
+			if s.ComponentAliases[kind] == nil {
+				s.ComponentAliases[kind] = make(map[string]string, len(aliases))
+			}
+			for a, name := range aliases {
+				s.ComponentAliases[kind][a] = name
+			}
+		}
+	}
+	return s, nil
+}
+
+func inScope(appId string, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == appId {
+			return true
+		}
+	}
+	return false
+}
+
+func parseType(t string) (alias.Kind, string, error) {
+	i := strings.Index(t, ".")
+	if i <= 0 || i == len(t)-1 {
+		return "", "", fmt.Errorf("illegal type %q, expected <kind>.<name>", t)
+	}
+	kind := alias.Kind(t[:i])
+	for _, k := range Kinds {
+		if k == kind {
+			return kind, t[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unsupported kind %q of type %q", kind, t)
+}
+
+// Change is a component added, updated or removed between snapshots
+type Change struct {
+	Kind alias.Kind
+	Name string
+	// Metadata is the new metadata of the component, it's nil if the component is removed
+	Metadata map[string]string
+}
+
+func (c Change) Removed() bool {
+	return c.Metadata == nil
+}
+
+// Changes returns the changes of the components from the old snapshot, in the order of kinds and names
+func (s *Snapshot) Changes(old *Snapshot) []Change {
+	var changes []Change
+	for _, kind := range Kinds {
+		names := make(map[string]bool)
+		for name := range s.Components[kind] {
+			names[name] = true
+		}
+		for name := range old.Components[kind] {
+			names[name] = true
+		}
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			md, ok := s.Components[kind][name]
+			oldMd, oldOk := old.Components[kind][name]
+			if ok && oldOk && reflect.DeepEqual(md, oldMd) {
+				continue
+			}
+			if ok && md == nil {
+				md = map[string]string{}
+			}
+			changes = append(changes, Change{Kind: kind, Name: name, Metadata: md})
+		}
+	}
+	return changes
+}
+
+// SubscriptionsChanged reports whether the subscriptions differ from the old snapshot
+func (s *Snapshot) SubscriptionsChanged(old *Snapshot) bool {
+	if len(s.Subscriptions) == 0 && len(old.Subscriptions) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(s.Subscriptions, old.Subscriptions)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+func newComponent(name, typ string, scopes ...string) Component {
+	return Component{
+		Metadata: ObjectMeta{Name: name, Namespace: "default"},
+		Spec: ComponentSpec{
+			Type:     typ,
+			Metadata: []MetadataItem{{Name: "redisHost", Value: name + ":6379"}},
+		},
+		Scopes: scopes,
+	}
+}
+
+func TestNewSnapshot(t *testing.T) {
+	s, err := NewSnapshot("app1",
+		[]Component{
+			newComponent("redis", "state.redis"),
+			newComponent("etcd", "lock.etcd", "app1"),
+			newComponent("zookeeper", "sequencer.zookeeper", "app2"),
+		},
+		[]Subscription{
+			{Metadata: ObjectMeta{Name: "b"}, Spec: SubscriptionSpec{PubsubName: "kafka", Topic: "users"}},
+			{Metadata: ObjectMeta{Name: "a"}, Spec: SubscriptionSpec{PubsubName: "kafka", Topic: "orders"}},
+			{Metadata: ObjectMeta{Name: "c"}, Spec: SubscriptionSpec{PubsubName: "kafka", Topic: "audit"}, Scopes: []string{"app2"}},
+		},
+		[]Configuration{
+			{Metadata: ObjectMeta{Name: "b"}, Spec: ConfigurationSpec{DefaultComponents: map[string]string{"state": "redis"}}},
+			{Metadata: ObjectMeta{Name: "a"}, Spec: ConfigurationSpec{
+				DefaultComponents: map[string]string{"state": "mongo", "lock": "etcd"},
+				ComponentAliases:  map[string]map[string]string{"state": {"cache": "redis"}},
+			}},
+		},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, map[alias.Kind]map[string]map[string]string{
+		alias.State: {"redis": {"redisHost": "redis:6379"}},
+		alias.Lock:  {"etcd": {"redisHost": "etcd:6379"}},
+	}, s.Components)
+	assert.Equal(t, []pubsub.Subscription{
+		{PubsubName: "kafka", Topic: "orders"},
+		{PubsubName: "kafka", Topic: "users"},
+	}, s.Subscriptions)
+	// the latter configurations win
+	assert.Equal(t, map[string]string{"state": "redis", "lock": "etcd"}, s.DefaultComponents)
+	assert.Equal(t, map[string]map[string]string{"state": {"cache": "redis"}}, s.ComponentAliases)
+}
+
+func TestNewSnapshotIllegal(t *testing.T) {
+	for _, c := range []Component{
+		newComponent("a", "redis"),
+		newComponent("a", "state."),
+		newComponent("a", "hellos.helloworld"),
+	} {
+		_, err := NewSnapshot("app1", []Component{c}, nil, nil)
+		assert.NotNil(t, err, c.Spec.Type)
+	}
+	_, err := NewSnapshot("app1", []Component{newComponent("a", "state.redis"), newComponent("b", "state.redis")}, nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewSnapshot("app1", nil, []Subscription{{Spec: SubscriptionSpec{PubsubName: "kafka"}}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestChanges(t *testing.T) {
+	old, err := NewSnapshot("app1", []Component{
+		newComponent("redis", "state.redis"),
+		newComponent("etcd", "lock.etcd"),
+		newComponent("kafka", "pub_subs.kafka"),
+	}, nil, nil)
+	assert.Nil(t, err)
+	updated := newComponent("redis", "state.redis")
+	updated.Spec.Metadata[0].Value = "redis-new:6379"
+	s, err := NewSnapshot("app1", []Component{
+		updated,
+		newComponent("kafka", "pub_subs.kafka"),
+		newComponent("zookeeper", "sequencer.zookeeper"),
+	}, []Subscription{{Spec: SubscriptionSpec{PubsubName: "kafka", Topic: "orders"}}}, nil)
+	assert.Nil(t, err)
+
+	changes := s.Changes(old)
+	assert.Equal(t, []Change{
+		{Kind: alias.State, Name: "redis", Metadata: map[string]string{"redisHost": "redis-new:6379"}},
+		{Kind: alias.Lock, Name: "etcd"},
+		{Kind: alias.Sequencer, Name: "zookeeper", Metadata: map[string]string{"redisHost": "zookeeper:6379"}},
+	}, changes)
+	assert.False(t, changes[0].Removed())
+	assert.True(t, changes[1].Removed())
+	assert.Empty(t, s.Changes(s))
+
+	assert.True(t, s.SubscriptionsChanged(old))
+	assert.False(t, s.SubscriptionsChanged(s))
+	assert.False(t, old.SubscriptionsChanged(&Snapshot{}))
+}
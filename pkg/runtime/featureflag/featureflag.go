@@ -0,0 +1,299 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// TargetingKeyAttribute is the attribute name referring to the targeting key in conditions,
+// following the evaluation context of OpenFeature.
+const TargetingKeyAttribute = "targetingKey"
+
+// The reasons of evaluations, which are the same as the resolution reasons of OpenFeature.
+const (
+	// ReasonStatic means the flag has no rules, so the default variant is served to everyone.
+	ReasonStatic = "STATIC"
+	// ReasonTargetingMatch means the conditions of a rule are matched.
+	ReasonTargetingMatch = "TARGETING_MATCH"
+	// ReasonSplit means the variant is chosen by the percentage rollout of a rule.
+	ReasonSplit = "SPLIT"
+	// ReasonDefault means no rule is matched, so the default variant is served.
+	ReasonDefault = "DEFAULT"
+	// ReasonDisabled means the flag is disabled, so the default variant is served.
+	ReasonDisabled = "DISABLED"
+)
+
+// The operators of conditions
+const (
+	OperatorIn         = "in"
+	OperatorNotIn      = "not_in"
+	OperatorStartsWith = "starts_with"
+	OperatorEndsWith   = "ends_with"
+	OperatorContains   = "contains"
+	OperatorMatches    = "matches"
+)
+
+// ErrTargetingKeyRequired is returned when a percentage rollout is evaluated without targeting key,
+// because the variant can't be sticky without it.
+var ErrTargetingKeyRequired = errors.New("targeting key is required by the percentage rollout")
+
+// Flag is the definition of a feature flag, which is stored as json in the config stores, e.g.
+//
+//	{
+//	  "variants": {"on": true, "off": false},
+//	  "default_variant": "off",
+//	  "rules": [
+//	    {"conditions": [{"attribute": "country", "operator": "in", "values": ["CN"]}], "variant": "on"},
+//	    {"rollout": [{"variant": "on", "weight": 10}, {"variant": "off", "weight": 90}]}
+//	  ]
+//	}
+//
+// The rules are evaluated in order, and the first one of which all the conditions match decides the variant.
+type Flag struct {
+	// Disabled flags serve the default variant to everyone.
+	Disabled bool `json:"disabled,omitempty"`
+	// Variants maps the names of variants to their json values.
+	Variants map[string]json.RawMessage `json:"variants"`
+	// DefaultVariant is served when no rule matches.
+	DefaultVariant string  `json:"default_variant"`
+	Rules          []*Rule `json:"rules,omitempty"`
+}
+
+// Rule serves the Variant, or a variant chosen by the Rollout, if all the Conditions match.
+// A rule without conditions matches everyone.
+type Rule struct {
+	Conditions []*Condition `json:"conditions,omitempty"`
+	Variant    string       `json:"variant,omitempty"`
+	// Rollout splits the targets by weights. The same targeting key always gets the same variant.
+	Rollout []*Split `json:"rollout,omitempty"`
+}
+
+// Condition matches the value of an attribute of the evaluation context with the operator and values.
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values"`
+	patterns  []*regexp.Regexp
+}
+
+// Split is a part of percentage rollout.
+type Split struct {
+	Variant string `json:"variant"`
+	Weight  int    `json:"weight"`
+}
+
+// Context is the evaluation context, in which the attributes are used by conditions
+// and the targeting key is used by percentage rollouts.
+type Context struct {
+	TargetingKey string
+	Attributes   map[string]string
+}
+
+// Evaluation is the result of evaluating a flag.
+type Evaluation struct {
+	Variant string
+	// Value is the json value of the variant
+	Value  string
+	Reason string
+}
+
+// Parse parses the flag from json and validates it.
+func Parse(data []byte) (*Flag, error) {
+	f := &Flag{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Flag) validate() error {
+	if len(f.Variants) == 0 {
+		return errors.New("flag has no variants")
+	}
+	if err := f.checkVariant(f.DefaultVariant); err != nil {
+		return fmt.Errorf("default_variant: %v", err)
+	}
+	for i, r := range f.Rules {
+		if err := f.validateRule(r); err != nil {
+			return fmt.Errorf("rules[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (f *Flag) validateRule(r *Rule) error {
+	if (r.Variant == "") == (len(r.Rollout) == 0) {
+		return errors.New("exactly one of variant and rollout should be set")
+	}
+	if r.Variant != "" {
+		if err := f.checkVariant(r.Variant); err != nil {
+			return err
+		}
+	}
+	for _, s := range r.Rollout {
+		if err := f.checkVariant(s.Variant); err != nil {
+			return err
+		}
+		if s.Weight < 0 {
+			return fmt.Errorf("negative weight %d of variant %s", s.Weight, s.Variant)
+		}
+	}
+	if len(r.Rollout) > 0 && totalWeight(r.Rollout) == 0 {
+		return errors.New("the weights of rollout are all zero")
+	}
+	for _, c := range r.Conditions {
+		if err := c.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Flag) checkVariant(name string) error {
+	if _, ok := f.Variants[name]; !ok {
+		return fmt.Errorf("unknown variant %q", name)
+	}
+	return nil
+}
+
+func (c *Condition) compile() error {
+	switch c.Operator {
+	case OperatorIn, OperatorNotIn, OperatorStartsWith, OperatorEndsWith, OperatorContains:
+	case OperatorMatches:
+		c.patterns = make([]*regexp.Regexp, 0, len(c.Values))
+		for _, v := range c.Values {
+			p, err := regexp.Compile(v)
+			if err != nil {
+				return fmt.Errorf("invalid pattern of attribute %s: %v", c.Attribute, err)
+			}
+			c.patterns = append(c.patterns, p)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q of attribute %s", c.Operator, c.Attribute)
+	}
+	return nil
+}
+
+// Evaluate evaluates the flag named name in the context.
+// The name is hashed together with the targeting key in percentage rollouts,
+// so that different flags split the targets independently.
+func (f *Flag) Evaluate(name string, ctx *Context) (*Evaluation, error) {
+	if f.Disabled {
+		return f.evaluation(f.DefaultVariant, ReasonDisabled), nil
+	}
+	if len(f.Rules) == 0 {
+		return f.evaluation(f.DefaultVariant, ReasonStatic), nil
+	}
+	for _, r := range f.Rules {
+		if !r.match(ctx) {
+			continue
+		}
+		if r.Variant != "" {
+			return f.evaluation(r.Variant, ReasonTargetingMatch), nil
+		}
+		if ctx.TargetingKey == "" {
+			return nil, ErrTargetingKeyRequired
+		}
+		return f.evaluation(split(r.Rollout, name, ctx.TargetingKey), ReasonSplit), nil
+	}
+	return f.evaluation(f.DefaultVariant, ReasonDefault), nil
+}
+
+func (f *Flag) evaluation(variant string, reason string) *Evaluation {
+	return &Evaluation{Variant: variant, Value: string(f.Variants[variant]), Reason: reason}
+}
+
+func (r *Rule) match(ctx *Context) bool {
+	for _, c := range r.Conditions {
+		if !c.match(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Condition) match(ctx *Context) bool {
+	v, ok := ctx.Attributes[c.Attribute]
+	if c.Attribute == TargetingKeyAttribute {
+		v, ok = ctx.TargetingKey, ctx.TargetingKey != ""
+	}
+	// an absent attribute only matches not_in
+	if !ok {
+		return c.Operator == OperatorNotIn
+	}
+	if c.Operator == OperatorNotIn {
+		return !contains(c.Values, v)
+	}
+	if c.Operator == OperatorMatches {
+		for _, p := range c.patterns {
+			if p.MatchString(v) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, want := range c.Values {
+		switch {
+		case c.Operator == OperatorIn && v == want,
+			c.Operator == OperatorStartsWith && strings.HasPrefix(v, want),
+			c.Operator == OperatorEndsWith && strings.HasSuffix(v, want),
+			c.Operator == OperatorContains && strings.Contains(v, want):
+			return true
+		}
+	}
+	return false
+}
+
+// split chooses the variant by the hash of the flag name and the targeting key
+func split(rollout []*Split, name string, targetingKey string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + targetingKey))
+	bucket := int(h.Sum32() % uint32(totalWeight(rollout)))
+	for _, s := range rollout {
+		if bucket < s.Weight {
+			return s.Variant
+		}
+		bucket -= s.Weight
+	}
+	return rollout[len(rollout)-1].Variant
+}
+
+func totalWeight(rollout []*Split) int {
+	total := 0
+	for _, s := range rollout {
+		total += s.Weight
+	}
+	return total
+}
+
+func contains(values []string, v string) bool {
+	for _, want := range values {
+		if want == v {
+			return true
+		}
+	}
+	return false
+}
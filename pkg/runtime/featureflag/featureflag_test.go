@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/configstores"
+)
+
+const checkout = `{
+  "variants": {"new": "v2", "old": "v1"},
+  "default_variant": "old",
+  "rules": [
+    {"conditions": [{"attribute": "targetingKey", "operator": "in", "values": ["tester"]}], "variant": "new"},
+    {"conditions": [{"attribute": "country", "operator": "in", "values": ["CN", "SG"]},
+                    {"attribute": "email", "operator": "ends_with", "values": ["@example.com"]}], "variant": "new"},
+    {"conditions": [{"attribute": "version", "operator": "matches", "values": ["^2\\."]}],
+     "rollout": [{"variant": "new", "weight": 30}, {"variant": "old", "weight": 70}]}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	_, err := Parse([]byte(checkout))
+	assert.Nil(t, err)
+
+	invalid := map[string]string{
+		"no variants":       `{"default_variant": "on"}`,
+		"unknown default":   `{"variants": {"on": true}, "default_variant": "off"}`,
+		"unknown variant":   `{"variants": {"on": true}, "default_variant": "on", "rules": [{"variant": "off"}]}`,
+		"variant & rollout": `{"variants": {"on": true}, "default_variant": "on", "rules": [{"variant": "on", "rollout": [{"variant": "on", "weight": 1}]}]}`,
+		"zero weights":      `{"variants": {"on": true}, "default_variant": "on", "rules": [{"rollout": [{"variant": "on", "weight": 0}]}]}`,
+		"unknown operator":  `{"variants": {"on": true}, "default_variant": "on", "rules": [{"conditions": [{"attribute": "a", "operator": "gt"}], "variant": "on"}]}`,
+		"invalid pattern":   `{"variants": {"on": true}, "default_variant": "on", "rules": [{"conditions": [{"attribute": "a", "operator": "matches", "values": ["("]}], "variant": "on"}]}`,
+		"invalid json":      `{`,
+	}
+	for name, data := range invalid {
+		_, err := Parse([]byte(data))
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	f, err := Parse([]byte(checkout))
+	assert.Nil(t, err)
+
+	t.Run("targeting key", func(t *testing.T) {
+		e, err := f.Evaluate("checkout", &Context{TargetingKey: "tester"})
+		assert.Nil(t, err)
+		assert.Equal(t, &Evaluation{Variant: "new", Value: `"v2"`, Reason: ReasonTargetingMatch}, e)
+	})
+
+	t.Run("all conditions match", func(t *testing.T) {
+		e, err := f.Evaluate("checkout", &Context{Attributes: map[string]string{"country": "SG", "email": "a@example.com"}})
+		assert.Nil(t, err)
+		assert.Equal(t, "new", e.Variant)
+		assert.Equal(t, ReasonTargetingMatch, e.Reason)
+
+		e, err = f.Evaluate("checkout", &Context{Attributes: map[string]string{"country": "SG", "email": "a@other.com"}})
+		assert.Nil(t, err)
+		assert.Equal(t, &Evaluation{Variant: "old", Value: `"v1"`, Reason: ReasonDefault}, e)
+	})
+
+	t.Run("rollout", func(t *testing.T) {
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			ctx := &Context{TargetingKey: fmt.Sprintf("user-%d", i), Attributes: map[string]string{"version": "2.1"}}
+			e, err := f.Evaluate("checkout", ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, ReasonSplit, e.Reason)
+			counts[e.Variant]++
+			// sticky
+			again, _ := f.Evaluate("checkout", ctx)
+			assert.Equal(t, e.Variant, again.Variant)
+		}
+		assert.InDelta(t, 300, counts["new"], 60)
+		assert.InDelta(t, 700, counts["old"], 60)
+
+		_, err := f.Evaluate("checkout", &Context{Attributes: map[string]string{"version": "2.1"}})
+		assert.Equal(t, ErrTargetingKeyRequired, err)
+	})
+
+	t.Run("not_in matches absent attributes", func(t *testing.T) {
+		f, err := Parse([]byte(`{"variants": {"on": true, "off": false}, "default_variant": "off",
+			"rules": [{"conditions": [{"attribute": "tier", "operator": "not_in", "values": ["free"]}], "variant": "on"}]}`))
+		assert.Nil(t, err)
+		e, _ := f.Evaluate("f", &Context{})
+		assert.Equal(t, "on", e.Variant)
+		e, _ = f.Evaluate("f", &Context{Attributes: map[string]string{"tier": "free"}})
+		assert.Equal(t, "off", e.Variant)
+	})
+
+	t.Run("static and disabled", func(t *testing.T) {
+		f, err := Parse([]byte(`{"variants": {"on": true, "off": false}, "default_variant": "on"}`))
+		assert.Nil(t, err)
+		e, _ := f.Evaluate("f", &Context{})
+		assert.Equal(t, &Evaluation{Variant: "on", Value: "true", Reason: ReasonStatic}, e)
+
+		f, err = Parse([]byte(`{"disabled": true, "variants": {"on": true, "off": false}, "default_variant": "off", "rules": [{"variant": "on"}]}`))
+		assert.Nil(t, err)
+		e, _ = f.Evaluate("f", &Context{})
+		assert.Equal(t, &Evaluation{Variant: "off", Value: "false", Reason: ReasonDisabled}, e)
+	})
+}
+
+type mockStore struct {
+	configstores.Store
+	items []*configstores.ConfigurationItem
+}
+
+func (s *mockStore) Get(ctx context.Context, req *configstores.GetRequest) ([]*configstores.ConfigurationItem, error) {
+	return s.items, nil
+}
+
+type mockProvider struct {
+	mockStore
+}
+
+func (p *mockProvider) EvaluateFlag(ctx context.Context, req *Request) (*Evaluation, error) {
+	return &Evaluation{Variant: "remote", Value: "1", Reason: ReasonStatic}, nil
+}
+
+func TestEvaluateStore(t *testing.T) {
+	store := &mockStore{items: []*configstores.ConfigurationItem{{Key: "f", Content: `{"variants": {"on": true}, "default_variant": "on"}`}}}
+	e, err := Evaluate(context.Background(), store, &Request{Flag: "f", Context: &Context{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "on", e.Variant)
+
+	_, err = Evaluate(context.Background(), store, &Request{Flag: "g", Context: &Context{}})
+	assert.Equal(t, ErrFlagNotFound, err)
+
+	e, err = Evaluate(context.Background(), &mockProvider{}, &Request{Flag: "f", Context: &Context{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "remote", e.Variant)
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mosn.io/layotto/components/configstores"
+)
+
+var (
+	// ErrFlagNotFound is returned when the flag doesn't exist in the config store.
+	ErrFlagNotFound = errors.New("flag not found")
+	// ErrInvalidFlag is wrapped in the errors returned when the definition of the flag is invalid.
+	ErrInvalidFlag = errors.New("invalid flag")
+)
+
+// Provider is implemented by the config stores which evaluate feature flags themselves,
+// e.g. the adapters of OpenFeature providers. The Evaluation is the same as the resolution details of OpenFeature.
+// For the other stores, the flags are stored as json in the items keyed by the flag names, and evaluated by the runtime.
+type Provider interface {
+	EvaluateFlag(ctx context.Context, req *Request) (*Evaluation, error)
+}
+
+// Request is the request of evaluating a flag
+type Request struct {
+	AppId    string
+	Group    string
+	Label    string
+	Flag     string
+	Context  *Context
+	Metadata map[string]string
+}
+
+// Evaluate evaluates the flag in the store.
+// It returns ErrFlagNotFound if the flag doesn't exist.
+func Evaluate(ctx context.Context, store configstores.Store, req *Request) (*Evaluation, error) {
+	if p, ok := store.(Provider); ok {
+		return p.EvaluateFlag(ctx, req)
+	}
+	items, err := store.Get(ctx, &configstores.GetRequest{AppId: req.AppId, Group: req.Group, Label: req.Label, Keys: []string{req.Flag}, Metadata: req.Metadata})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Key == req.Flag {
+			return EvaluateItem(item, req.Context)
+		}
+	}
+	return nil, ErrFlagNotFound
+}
+
+// EvaluateItem evaluates the flag stored in the configuration item.
+func EvaluateItem(item *configstores.ConfigurationItem, ctx *Context) (*Evaluation, error) {
+	f, err := Parse([]byte(item.Content))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidFlag, item.Key, err)
+	}
+	return f.Evaluate(item.Key, ctx)
+}
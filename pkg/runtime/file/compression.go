@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"mosn.io/pkg/utils"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+	"mosn.io/layotto/pkg/runtime/compression"
+)
+
+const (
+	// compressionMetadataKey in the request metadata overrides the algorithm of the config, e.g. "none" for the files compressed already
+	compressionMetadataKey = "compression"
+	// compressionKey is the user metadata stored with the compressed files
+	compressionKey = "layotto-compression"
+)
+
+// compressedFile compresses the files put, and decompresses the files got.
+// The files without the compression metadata are returned as they are.
+type compressedFile struct {
+	l8_comp_file.File
+	cfg compression.Config
+}
+
+// NewCompressedFile wraps the file component so that the files are compressed by the sidecar
+func NewCompressedFile(f l8_comp_file.File, cfg *compression.Config) (l8_comp_file.File, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if s, ok := f.(l8_comp_file.UserMetadataSupporter); !ok || !s.SupportUserMetadata() {
+		return nil, ErrUserMetadataNotSupported
+	}
+	return &compressedFile{File: f, cfg: *cfg}, nil
+}
+
+// Unwrap implements file.Wrapper, so that the capabilities like tagging are kept
+func (c *compressedFile) Unwrap() l8_comp_file.File {
+	return c.File
+}
+
+func (c *compressedFile) SupportUserMetadata() bool {
+	return true
+}
+
+func (c *compressedFile) Put(ctx context.Context, st *l8_comp_file.PutFileStu) error {
+	algorithm := c.cfg.GetAlgorithm()
+	if a, ok := st.Metadata[compressionMetadataKey]; ok {
+		if err := compression.Validate(a); err != nil {
+			return l8_comp_file.ErrInvalid
+		}
+		algorithm = a
+	}
+	if algorithm == compression.None || st.DataStream == nil {
+		return c.File.Put(ctx, st)
+	}
+	// the small files aren't compressed
+	src := bufio.NewReaderSize(st.DataStream, c.cfg.MinSize())
+	if _, err := src.Peek(c.cfg.MinSize()); err != nil {
+		if err != io.EOF {
+			return err
+		}
+		st.DataStream = src
+		return c.File.Put(ctx, st)
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	utils.GoWithRecover(func() {
+		w, err := compression.NewWriter(algorithm, pw)
+		if err == nil {
+			if _, err = io.Copy(w, src); err == nil {
+				err = w.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}, nil)
+	meta := make(map[string]string, len(st.UserMetadata)+1)
+	for k, v := range st.UserMetadata {
+		meta[k] = v
+	}
+	meta[compressionKey] = algorithm
+	st.UserMetadata = meta
+	// the compressed size is unknown until the whole file is compressed
+	st.Metadata = withFileSize(st.Metadata, nil)
+	st.DataStream = pr
+	return c.File.Put(ctx, st)
+}
+
+func (c *compressedFile) Get(ctx context.Context, st *l8_comp_file.GetFileStu) (io.ReadCloser, error) {
+	meta, err := c.File.Stat(ctx, &l8_comp_file.FileMetaRequest{FileName: st.FileName, Metadata: st.Metadata})
+	if err != nil {
+		return nil, err
+	}
+	algorithm := meta.UserMetadata[compressionKey]
+	data, err := c.File.Get(ctx, st)
+	if err != nil || algorithm == "" {
+		return data, err
+	}
+	r, err := compression.NewReader(algorithm, data)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: r, closers: []io.Closer{r, data}}, nil
+}
+
+// IsCompressed tells whether the file is compressed by the sidecar according to its user metadata,
+// the size of which is the compressed size instead of the size got
+func IsCompressed(userMetadata map[string]string) bool {
+	return userMetadata[compressionKey] != ""
+}
+
+// readCloser closes all the closers
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+	"mosn.io/layotto/pkg/runtime/compression"
+)
+
+func TestCompression(t *testing.T) {
+	mem := newMemFile()
+	f, err := NewCompressedFile(mem, &compression.Config{MinSizeBytes: 100})
+	assert.Nil(t, err)
+
+	get := func(name string) string {
+		r, err := f.Get(context.Background(), &l8_comp_file.GetFileStu{FileName: name})
+		assert.Nil(t, err)
+		data, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+		return string(data)
+	}
+
+	// the small files are stored as they are
+	err = f.Put(context.Background(), &l8_comp_file.PutFileStu{FileName: "small", DataStream: strings.NewReader("hello")})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(mem.files["small"]))
+	assert.Equal(t, "", mem.metas["small"][compressionKey])
+	assert.Equal(t, "hello", get("small"))
+
+	large := strings.Repeat("layotto", 100)
+	for _, algorithm := range []string{compression.Gzip, compression.Zstd} {
+		err = f.Put(context.Background(), &l8_comp_file.PutFileStu{
+			FileName:     "large",
+			DataStream:   strings.NewReader(large),
+			Metadata:     map[string]string{compressionMetadataKey: algorithm, fileSizeMetadataKey: strconv.Itoa(len(large))},
+			UserMetadata: map[string]string{"owner": "layotto"},
+		})
+		assert.Nil(t, err)
+		assert.True(t, len(mem.files["large"]) < len(large))
+		assert.Equal(t, algorithm, mem.metas["large"][compressionKey])
+		assert.Equal(t, "layotto", mem.metas["large"]["owner"])
+		// the declared size isn't the compressed one
+		_, ok := mem.sizes["large"]
+		assert.False(t, ok)
+		assert.Equal(t, large, get("large"))
+	}
+
+	// the compression can be disabled per request
+	err = f.Put(context.Background(), &l8_comp_file.PutFileStu{
+		FileName:   "raw",
+		DataStream: strings.NewReader(large),
+		Metadata:   map[string]string{compressionMetadataKey: compression.None},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(mem.files["raw"]))
+
+	err = f.Put(context.Background(), &l8_comp_file.PutFileStu{
+		FileName:   "raw",
+		DataStream: bytes.NewReader([]byte(large)),
+		Metadata:   map[string]string{compressionMetadataKey: "lz4"},
+	})
+	assert.Equal(t, l8_comp_file.ErrInvalid, err)
+}
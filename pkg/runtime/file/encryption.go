@@ -0,0 +1,341 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+)
+
+const (
+	// encryptionAlgorithm is the value of the metadata encryptionKey
+	encryptionAlgorithm = "AES256-GCM"
+	// the user metadata stored with the encrypted files
+	encryptionKey = "layotto-encryption"
+	wrappedKeyKey = "layotto-wrapped-key"
+	keyNameKey    = "layotto-key-name"
+
+	keySize = 32
+	// chunkSize is the size of the plaintext encrypted at a time
+	chunkSize = 64 * 1024
+	// fileSizeMetadataKey is the size of the file declared in the request metadata, which is used by the components like minio as the object size
+	fileSizeMetadataKey = "fileSize"
+)
+
+var (
+	ErrEncryptionSecretStoreEmpty = errors.New("secret_store is required for file encryption")
+	ErrEncryptionKeyNameEmpty     = errors.New("key_name is required for file encryption")
+	ErrUserMetadataNotSupported   = errors.New("the component doesn't support user metadata, which is required by file encryption")
+	ErrInvalidMasterKey           = errors.New("the master key should be 32 bytes in base64")
+	ErrCorruptedFile              = errors.New("the encrypted file is corrupted")
+)
+
+// EncryptionConfig is the config of client-side encryption.
+// Each file is encrypted by a random data key, which is wrapped by the master key and stored in the user metadata of the file.
+type EncryptionConfig struct {
+	// SecretStore is the name of the secret store containing the master key
+	SecretStore string `json:"secret_store"`
+	// KeyName is the name of the secret, whose value is a 32 bytes key in base64
+	KeyName string `json:"key_name"`
+}
+
+func (c *EncryptionConfig) Validate() error {
+	if c.SecretStore == "" {
+		return ErrEncryptionSecretStoreEmpty
+	}
+	if c.KeyName == "" {
+		return ErrEncryptionKeyNameEmpty
+	}
+	return nil
+}
+
+// ParseMasterKey decodes the master key in base64
+func ParseMasterKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != keySize {
+		return nil, ErrInvalidMasterKey
+	}
+	return key, nil
+}
+
+// encryption encrypts the files put and decrypts the files got.
+// The files without the encryption metadata are returned as they are, e.g. the ones put before the encryption is enabled.
+type encryption struct {
+	l8_comp_file.File
+	keyName string
+	master  cipher.AEAD
+}
+
+// NewEncryption wraps the file component so that the files are encrypted by the sidecar
+func NewEncryption(f l8_comp_file.File, keyName string, masterKey []byte) (l8_comp_file.File, error) {
+	if s, ok := f.(l8_comp_file.UserMetadataSupporter); !ok || !s.SupportUserMetadata() {
+		return nil, ErrUserMetadataNotSupported
+	}
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption{File: f, keyName: keyName, master: master}, nil
+}
+
+// Unwrap implements file.Wrapper, so that the capabilities like tagging are kept
+func (e *encryption) Unwrap() l8_comp_file.File {
+	return e.File
+}
+
+// SupportUserMetadata implements file.UserMetadataSupporter, so that the other wrappers can store metadata as well
+func (e *encryption) SupportUserMetadata() bool {
+	return true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryption) Put(ctx context.Context, st *l8_comp_file.PutFileStu) error {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	nonce := make([]byte, e.master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	wrapped := e.master.Seal(nonce, nonce, dataKey, []byte(e.keyName))
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	meta := make(map[string]string, len(st.UserMetadata)+3)
+	for k, v := range st.UserMetadata {
+		meta[k] = v
+	}
+	meta[encryptionKey] = encryptionAlgorithm
+	meta[wrappedKeyKey] = base64.StdEncoding.EncodeToString(wrapped)
+	meta[keyNameKey] = e.keyName
+	st.UserMetadata = meta
+	st.Metadata = withFileSize(st.Metadata, ciphertextSize)
+	st.DataStream = &encryptReader{src: bufio.NewReaderSize(st.DataStream, chunkSize), aead: aead}
+	return e.File.Put(ctx, st)
+}
+
+func (e *encryption) Get(ctx context.Context, st *l8_comp_file.GetFileStu) (io.ReadCloser, error) {
+	meta, err := e.File.Stat(ctx, &l8_comp_file.FileMetaRequest{FileName: st.FileName, Metadata: st.Metadata})
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.dataKey(meta.UserMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt file[%s] fail, err: %s", st.FileName, err.Error())
+	}
+	data, err := e.File.Get(ctx, st)
+	if err != nil || aead == nil {
+		return data, err
+	}
+	return &decryptReader{src: bufio.NewReaderSize(data, chunkSize+aead.Overhead()), closer: data, aead: aead}, nil
+}
+
+// Stat returns the size of the plaintext for the encrypted files
+func (e *encryption) Stat(ctx context.Context, st *l8_comp_file.FileMetaRequest) (*l8_comp_file.FileMetaResp, error) {
+	resp, err := e.File.Stat(ctx, st)
+	if err != nil || resp.UserMetadata[encryptionKey] == "" {
+		return resp, err
+	}
+	resp.Size = plaintextSize(resp.Size)
+	return resp, nil
+}
+
+// dataKey unwraps the data key in the user metadata, nil is returned if the file isn't encrypted
+func (e *encryption) dataKey(meta map[string]string) (cipher.AEAD, error) {
+	algorithm := meta[encryptionKey]
+	if algorithm == "" {
+		return nil, nil
+	}
+	if algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unknown encryption algorithm %s", algorithm)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(meta[wrappedKeyKey])
+	if err != nil || len(wrapped) < e.master.NonceSize() {
+		return nil, ErrCorruptedFile
+	}
+	nonceSize := e.master.NonceSize()
+	dataKey, err := e.master.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(meta[keyNameKey]))
+	if err != nil {
+		return nil, fmt.Errorf("fail to unwrap the data key by master key %s: %v", meta[keyNameKey], err)
+	}
+	return newAEAD(dataKey)
+}
+
+// ciphertextSize computes the size of the encrypted file by the size of the plaintext
+func ciphertextSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*16
+}
+
+// withFileSize rewrites the declared file size by the size function, the size is removed if it's unknown after the rewriting, i.e. the size function is nil.
+// The metadata is copied, since it belongs to the request.
+func withFileSize(metadata map[string]string, size func(int64) int64) map[string]string {
+	declared, ok := metadata[fileSizeMetadataKey]
+	if !ok {
+		return metadata
+	}
+	copied := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	delete(copied, fileSizeMetadataKey)
+	if size == nil {
+		return copied
+	}
+	if n, err := strconv.ParseInt(declared, 10, 64); err == nil && n >= 0 {
+		copied[fileSizeMetadataKey] = strconv.FormatInt(size(n), 10)
+	}
+	return copied
+}
+
+// plaintextSize computes the size of the plaintext by the size of the encrypted file
+func plaintextSize(size int64) int64 {
+	sealed := int64(chunkSize + 16)
+	chunks := (size + sealed - 1) / sealed
+	if chunks == 0 {
+		chunks = 1
+	}
+	if plain := size - chunks*16; plain > 0 {
+		return plain
+	}
+	return 0
+}
+
+// chunkNonce is the nonce of the nth chunk. The data key is used by one file only, so the counter is unique.
+func chunkNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+	return nonce
+}
+
+// chunkAD marks the last chunk, so that a truncated file can be detected
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptReader encrypts the plaintext chunk by chunk, an empty file is encrypted into one chunk as well
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	n       uint64
+	buf     []byte
+	pending []byte
+	done    bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, chunkSize)
+		}
+		n, err := io.ReadFull(r.src, r.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := n < chunkSize
+		if !last {
+			if _, err := r.src.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		r.pending = r.aead.Seal(r.pending[:0], chunkNonce(r.aead, r.n), r.buf[:n], chunkAD(last))
+		r.n++
+		r.done = last
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// decryptReader decrypts the chunks written by encryptReader
+type decryptReader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	aead    cipher.AEAD
+	n       uint64
+	buf     []byte
+	pending []byte
+	done    bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, chunkSize+r.aead.Overhead())
+		}
+		n, err := io.ReadFull(r.src, r.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := n < len(r.buf)
+		if !last {
+			if _, err := r.src.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		plain, err := r.aead.Open(r.buf[:0], chunkNonce(r.aead, r.n), r.buf[:n], chunkAD(last))
+		if err != nil {
+			return 0, ErrCorruptedFile
+		}
+		r.pending = plain
+		r.n++
+		r.done = last
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
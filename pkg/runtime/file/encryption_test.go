@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+)
+
+// memFile stores the files and the user metadata in memory
+type memFile struct {
+	files map[string][]byte
+	metas map[string]map[string]string
+	// sizes are the file sizes declared in the request metadata
+	sizes map[string]string
+}
+
+func newMemFile() *memFile {
+	return &memFile{files: make(map[string][]byte), metas: make(map[string]map[string]string), sizes: make(map[string]string)}
+}
+
+func (m *memFile) Init(context.Context, *l8_comp_file.FileConfig) error { return nil }
+
+func (m *memFile) Put(ctx context.Context, st *l8_comp_file.PutFileStu) error {
+	data, err := ioutil.ReadAll(st.DataStream)
+	if err != nil {
+		return err
+	}
+	m.files[st.FileName] = data
+	m.metas[st.FileName] = st.UserMetadata
+	if size, ok := st.Metadata[fileSizeMetadataKey]; ok {
+		m.sizes[st.FileName] = size
+	} else {
+		delete(m.sizes, st.FileName)
+	}
+	return nil
+}
+
+func (m *memFile) Get(ctx context.Context, st *l8_comp_file.GetFileStu) (io.ReadCloser, error) {
+	data, ok := m.files[st.FileName]
+	if !ok {
+		return nil, l8_comp_file.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memFile) List(context.Context, *l8_comp_file.ListRequest) (*l8_comp_file.ListResp, error) {
+	return &l8_comp_file.ListResp{}, nil
+}
+
+func (m *memFile) Del(ctx context.Context, st *l8_comp_file.DelRequest) error {
+	delete(m.files, st.FileName)
+	return nil
+}
+
+func (m *memFile) Stat(ctx context.Context, st *l8_comp_file.FileMetaRequest) (*l8_comp_file.FileMetaResp, error) {
+	data, ok := m.files[st.FileName]
+	if !ok {
+		return nil, l8_comp_file.ErrNotExist
+	}
+	return &l8_comp_file.FileMetaResp{Size: int64(len(data)), UserMetadata: m.metas[st.FileName]}, nil
+}
+
+func (m *memFile) SupportUserMetadata() bool { return true }
+
+func TestEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	masterKey, err := ParseMasterKey(base64.StdEncoding.EncodeToString(key))
+	assert.Nil(t, err)
+	_, err = ParseMasterKey("short")
+	assert.Equal(t, ErrInvalidMasterKey, err)
+
+	mem := newMemFile()
+	f, err := NewEncryption(mem, "master", masterKey)
+	assert.Nil(t, err)
+
+	for _, size := range []int{0, 10, chunkSize, chunkSize + 1, 3*chunkSize - 1} {
+		data := make([]byte, size)
+		rand.Read(data)
+		metadata := map[string]string{fileSizeMetadataKey: strconv.Itoa(size)}
+		err = f.Put(context.Background(), &l8_comp_file.PutFileStu{FileName: "a", DataStream: bytes.NewReader(data), Metadata: metadata})
+		assert.Nil(t, err)
+		assert.NotEqual(t, data, mem.files["a"])
+		// the declared size is rewritten to the size of the encrypted file, and the request metadata is kept
+		assert.Equal(t, strconv.Itoa(len(mem.files["a"])), mem.sizes["a"])
+		assert.Equal(t, strconv.Itoa(size), metadata[fileSizeMetadataKey])
+		assert.Equal(t, encryptionAlgorithm, mem.metas["a"][encryptionKey])
+
+		meta, err := f.Stat(context.Background(), &l8_comp_file.FileMetaRequest{FileName: "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(size), meta.Size)
+
+		r, err := f.Get(context.Background(), &l8_comp_file.GetFileStu{FileName: "a"})
+		assert.Nil(t, err)
+		got, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+		assert.Equal(t, data, got)
+	}
+
+	// a truncated file is detected
+	mem.files["a"] = mem.files["a"][:chunkSize+16]
+	r, err := f.Get(context.Background(), &l8_comp_file.GetFileStu{FileName: "a"})
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrCorruptedFile, err)
+
+	// the files which aren't encrypted are returned as they are
+	mem.files["plain"] = []byte("hello")
+	r, err = f.Get(context.Background(), &l8_comp_file.GetFileStu{FileName: "plain"})
+	assert.Nil(t, err)
+	got, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "hello", string(got))
+
+	// the data key can't be unwrapped by another master key
+	rand.Read(key)
+	other, _ := NewEncryption(mem, "master", key)
+	_, err = other.Get(context.Background(), &l8_comp_file.GetFileStu{FileName: "a"})
+	assert.NotNil(t, err)
+}
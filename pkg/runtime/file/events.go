@@ -0,0 +1,162 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"mosn.io/pkg/log"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+	l8_comp_pubsub "mosn.io/layotto/components/pubsub"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+const (
+	// EventTypePut is the type of the event published after a file is put
+	EventTypePut = "com.runtime.file.put"
+	// EventTypeDelete is the type of the event published after a file is deleted
+	EventTypeDelete = "com.runtime.file.deleted"
+
+	// fileEventsCaller is the caller of the file events published asynchronously, whose failures are only logged
+	fileEventsCaller = "layotto/file"
+)
+
+var (
+	ErrEventPubsubEmpty = errors.New("pubsub_name is required for file events")
+	ErrEventTopicEmpty  = errors.New("topic is required for file events")
+)
+
+// EventConfig is the config of file events, which are published to the topic after PutFile or DelFile succeeds.
+type EventConfig struct {
+	PubsubName string `json:"pubsub_name"`
+	Topic      string `json:"topic"`
+}
+
+func (c *EventConfig) Validate() error {
+	if c.PubsubName == "" {
+		return ErrEventPubsubEmpty
+	}
+	if c.Topic == "" {
+		return ErrEventTopicEmpty
+	}
+	return nil
+}
+
+// Event is the data of the cloud events
+type Event struct {
+	StoreName string `json:"store_name"`
+	Name      string `json:"name"`
+	// Size is the bytes put, it's empty for the deleted files
+	Size     int64             `json:"size,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// eventBridge publishes the events after the files are put or deleted successfully.
+// The failures of publishing are logged only, since the files are changed already.
+type eventBridge struct {
+	l8_comp_file.File
+	storeName string
+	pubsub    pubsub.PubSub
+	cfg       EventConfig
+}
+
+// NewEventBridge wraps the file component so that the events are published to the pubsub component
+func NewEventBridge(storeName string, f l8_comp_file.File, ps pubsub.PubSub, cfg *EventConfig) l8_comp_file.File {
+	return &eventBridge{File: f, storeName: storeName, pubsub: ps, cfg: *cfg}
+}
+
+// Unwrap implements file.Wrapper, so that the capabilities like tagging are kept
+func (b *eventBridge) Unwrap() l8_comp_file.File {
+	return b.File
+}
+
+// SupportProgress implements file.ProgressSupporter, since the data is put as it is
+func (b *eventBridge) SupportProgress() bool {
+	s, ok := b.File.(l8_comp_file.ProgressSupporter)
+	return ok && s.SupportProgress()
+}
+
+func (b *eventBridge) Put(ctx context.Context, st *l8_comp_file.PutFileStu) error {
+	counter := &countingReader{r: st.DataStream}
+	if st.DataStream != nil {
+		st.DataStream = counter
+	}
+	if err := b.File.Put(ctx, st); err != nil {
+		return err
+	}
+	b.publish(EventTypePut, &Event{StoreName: b.storeName, Name: st.FileName, Size: counter.n, Metadata: st.Metadata})
+	return nil
+}
+
+func (b *eventBridge) Del(ctx context.Context, st *l8_comp_file.DelRequest) error {
+	if err := b.File.Del(ctx, st); err != nil {
+		return err
+	}
+	b.publish(EventTypeDelete, &Event{StoreName: b.storeName, Name: st.FileName, Metadata: st.Metadata})
+	return nil
+}
+
+func (b *eventBridge) publish(eventType string, e *Event) {
+	data, err := jsoniter.ConfigFastest.Marshal(e)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [file] fail to marshal the event of file %s: %v", e.Name, err)
+		return
+	}
+	ce := &runtime_pubsub.CloudEvent{
+		ID:              uuid.New().String(),
+		Source:          l8_comp_pubsub.DefaultCloudEventSource,
+		Type:            eventType,
+		Subject:         e.Name,
+		Topic:           b.cfg.Topic,
+		PubsubName:      b.cfg.PubsubName,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	req := &pubsub.PublishRequest{
+		PubsubName: b.cfg.PubsubName,
+		Topic:      b.cfg.Topic,
+		Data:       runtime_pubsub.MarshalCloudEvent(ce, b.pubsub.Features(), nil),
+	}
+	// publish in background if possible, so that the file operations aren't blocked by the pubsub
+	if publisher, ok := b.pubsub.(runtime_pubsub.AsyncPublisher); ok {
+		err = publisher.PublishAsync(fileEventsCaller, req)
+	} else {
+		err = b.pubsub.Publish(req)
+	}
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [file] fail to publish the %s event of file %s to topic %s in pubsub %s: %v",
+			eventType, e.Name, b.cfg.Topic, b.cfg.PubsubName, err)
+	}
+}
+
+// countingReader counts the bytes read from the stream
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
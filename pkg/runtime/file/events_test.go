@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/golang/mock/gomock"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+	"mosn.io/layotto/pkg/mock"
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+)
+
+func TestEventBridge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	f := mock.NewMockFile(ctrl)
+	ps := mock_pubsub.NewMockPubSub(ctrl)
+	ps.EXPECT().Features().Return(nil).AnyTimes()
+	var published []*pubsub.PublishRequest
+	ps.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+		published = append(published, req)
+		return nil
+	}).AnyTimes()
+	b := NewEventBridge("oss", f, ps, &EventConfig{PubsubName: "mq", Topic: "files"})
+	// the mock component doesn't support tagging
+	_, ok := l8_comp_file.AsTagger(b)
+	assert.False(t, ok)
+	assert.Equal(t, f, b.(l8_comp_file.Wrapper).Unwrap())
+
+	f.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, st *l8_comp_file.PutFileStu) error {
+		buf := make([]byte, 16)
+		n, _ := st.DataStream.Read(buf)
+		assert.Equal(t, 5, n)
+		return nil
+	})
+	err := b.Put(context.Background(), &l8_comp_file.PutFileStu{FileName: "bucket/a.txt", DataStream: strings.NewReader("hello")})
+	assert.Nil(t, err)
+	assert.Len(t, published, 1)
+	assert.Equal(t, "files", published[0].Topic)
+	ce := make(map[string]interface{})
+	assert.Nil(t, jsoniter.Unmarshal(published[0].Data, &ce))
+	assert.Equal(t, EventTypePut, ce["type"])
+	assert.Equal(t, "bucket/a.txt", ce["subject"])
+	data := ce["data"].(map[string]interface{})
+	assert.Equal(t, "oss", data["store_name"])
+	assert.Equal(t, float64(5), data["size"])
+
+	// no event is published if the operation fails
+	f.EXPECT().Del(gomock.Any(), gomock.Any()).Return(errors.New("net error"))
+	assert.NotNil(t, b.Del(context.Background(), &l8_comp_file.DelRequest{FileName: "bucket/a.txt"}))
+	assert.Len(t, published, 1)
+
+	f.EXPECT().Del(gomock.Any(), gomock.Any()).Return(nil)
+	assert.Nil(t, b.Del(context.Background(), &l8_comp_file.DelRequest{FileName: "bucket/a.txt"}))
+	assert.Len(t, published, 2)
+	assert.Contains(t, string(published[1].Data), EventTypeDelete)
+}
+
+func TestEventConfig_Validate(t *testing.T) {
+	assert.Equal(t, ErrEventPubsubEmpty, (&EventConfig{Topic: "files"}).Validate())
+	assert.Equal(t, ErrEventTopicEmpty, (&EventConfig{PubsubName: "mq"}).Validate())
+	assert.Nil(t, (&EventConfig{PubsubName: "mq", Topic: "files"}).Validate())
+}
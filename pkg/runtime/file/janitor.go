@@ -0,0 +1,197 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+)
+
+const (
+	defaultJanitorInterval = time.Hour
+	defaultJanitorMaxAge   = 24 * time.Hour
+)
+
+var (
+	ErrJanitorDirectoriesEmpty   = errors.New("directories are required for the file janitor")
+	ErrJanitorNegative           = errors.New("interval_ms and max_age_ms of the file janitor can't be negative")
+	ErrUploadCleanerNotSupported = errors.New("the component doesn't support listing and aborting incomplete uploads, which is required by the file janitor")
+)
+
+// JanitorConfig is the config of the janitor, which aborts the incomplete uploads left behind by the aborted puts,
+// e.g. the multipart uploads of s3, which cost storage silently until they're aborted.
+type JanitorConfig struct {
+	// Directories are the buckets and the prefixes scanned, e.g. "bucket/" or "bucket/tmp/"
+	Directories []string `json:"directories"`
+	// MaxAgeMs is the age after which the uploads are aborted, the default value is 24 hours.
+	// It should be longer than the longest put, otherwise the puts in progress are aborted.
+	MaxAgeMs int `json:"max_age_ms"`
+	// IntervalMs is the interval of scanning, the default value is 1 hour.
+	IntervalMs int `json:"interval_ms"`
+	// Metadata is passed to the component, e.g. the endpoint of s3
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (c *JanitorConfig) Validate() error {
+	if len(c.Directories) == 0 {
+		return ErrJanitorDirectoriesEmpty
+	}
+	if c.MaxAgeMs < 0 || c.IntervalMs < 0 {
+		return ErrJanitorNegative
+	}
+	return nil
+}
+
+// Janitor aborts the incomplete uploads older than the max age periodically.
+type Janitor struct {
+	storeName string
+	cleaner   l8_comp_file.UploadCleaner
+	config    *JanitorConfig
+	interval  time.Duration
+	maxAge    time.Duration
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewJanitor creates the janitor of the component, the config should be validated before.
+func NewJanitor(storeName string, cleaner l8_comp_file.UploadCleaner, config *JanitorConfig) *Janitor {
+	j := &Janitor{
+		storeName: storeName,
+		cleaner:   cleaner,
+		config:    config,
+		interval:  defaultJanitorInterval,
+		maxAge:    defaultJanitorMaxAge,
+		stopCh:    make(chan struct{}),
+	}
+	if config.IntervalMs > 0 {
+		j.interval = time.Duration(config.IntervalMs) * time.Millisecond
+	}
+	if config.MaxAgeMs > 0 {
+		j.maxAge = time.Duration(config.MaxAgeMs) * time.Millisecond
+	}
+	return j
+}
+
+// Start cleans up in background until Stop is called, the first round runs at once.
+func (j *Janitor) Start() {
+	utils.GoWithRecover(j.run, nil)
+}
+
+// Stop stops cleaning up, the round in progress is cancelled.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stopCh)
+	})
+}
+
+func (j *Janitor) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	utils.GoWithRecover(func() {
+		<-j.stopCh
+		cancel()
+	}, nil)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		n, err := j.Clean(ctx)
+		if err != nil {
+			log.DefaultLogger.Errorf("[runtime] [file.janitor] clean up incomplete uploads of component %s error: %v", j.storeName, err)
+		}
+		if n > 0 {
+			log.DefaultLogger.Infof("[runtime] [file.janitor] %d incomplete uploads of component %s are aborted", n, j.storeName)
+		}
+		select {
+		case <-j.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Clean aborts the incomplete uploads older than the max age in the directories, it returns the number of uploads aborted.
+// The directories and the uploads left are still cleaned up after a failure, and the first error is returned.
+func (j *Janitor) Clean(ctx context.Context) (int, error) {
+	var (
+		aborted  int
+		firstErr error
+	)
+	before := time.Now().Add(-j.maxAge)
+	for _, dir := range j.config.Directories {
+		uploads, err := j.cleaner.ListIncompleteUploads(ctx, &l8_comp_file.ListIncompleteUploadsRequest{
+			DirectoryName:   dir,
+			InitiatedBefore: before,
+			Metadata:        j.config.Metadata,
+		})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, upload := range uploads {
+			// the components may not filter the uploads by themselves
+			if !upload.Initiated.Before(before) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return aborted, ctx.Err()
+			}
+			if err := j.cleaner.AbortUpload(ctx, &l8_comp_file.AbortUploadRequest{Upload: upload, Metadata: j.config.Metadata}); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			aborted++
+		}
+	}
+	return aborted, firstErr
+}
+
+// AbortUploads aborts the incomplete uploads of the file initiated since the put started, which are left behind when the put is canceled.
+// Nothing is done if the component doesn't support it, and the uploads missed, e.g. because of the clock skew, are left to the janitor.
+func AbortUploads(ctx context.Context, f l8_comp_file.File, fileName string, metadata map[string]string, since time.Time) (int, error) {
+	cleaner, ok := l8_comp_file.AsUploadCleaner(f)
+	if !ok {
+		return 0, nil
+	}
+	uploads, err := cleaner.ListIncompleteUploads(ctx, &l8_comp_file.ListIncompleteUploadsRequest{DirectoryName: fileName, Metadata: metadata})
+	if err != nil {
+		return 0, err
+	}
+	aborted := 0
+	for _, upload := range uploads {
+		// the uploads of the files prefixed with the name are listed as well
+		if upload.FileName != fileName || upload.Initiated.Before(since) {
+			continue
+		}
+		if err := cleaner.AbortUpload(ctx, &l8_comp_file.AbortUploadRequest{Upload: upload, Metadata: metadata}); err != nil {
+			return aborted, err
+		}
+		aborted++
+	}
+	return aborted, nil
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	l8_comp_file "mosn.io/layotto/components/file"
+)
+
+type memUploadCleaner struct {
+	sync.Mutex
+	uploads  map[string][]*l8_comp_file.IncompleteUpload
+	aborted  []string
+	abortErr error
+}
+
+func (c *memUploadCleaner) ListIncompleteUploads(ctx context.Context, req *l8_comp_file.ListIncompleteUploadsRequest) ([]*l8_comp_file.IncompleteUpload, error) {
+	c.Lock()
+	defer c.Unlock()
+	uploads, ok := c.uploads[req.DirectoryName]
+	if !ok {
+		return nil, errors.New("bucket not found")
+	}
+	return uploads, nil
+}
+
+func (c *memUploadCleaner) AbortUpload(ctx context.Context, req *l8_comp_file.AbortUploadRequest) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.abortErr != nil {
+		return c.abortErr
+	}
+	c.aborted = append(c.aborted, req.Upload.UploadId)
+	return nil
+}
+
+func (c *memUploadCleaner) abortedUploads() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.aborted...)
+}
+
+func TestJanitorConfig_Validate(t *testing.T) {
+	cfg := &JanitorConfig{}
+	assert.Equal(t, ErrJanitorDirectoriesEmpty, cfg.Validate())
+	cfg.Directories = []string{"bucket/"}
+	assert.Nil(t, cfg.Validate())
+	cfg.MaxAgeMs = -1
+	assert.Equal(t, ErrJanitorNegative, cfg.Validate())
+}
+
+func TestJanitor_Clean(t *testing.T) {
+	now := time.Now()
+	cleaner := &memUploadCleaner{
+		uploads: map[string][]*l8_comp_file.IncompleteUpload{
+			"a/": {
+				{FileName: "a/1", UploadId: "1", Initiated: now.Add(-2 * time.Hour)},
+				// it's too young to be aborted
+				{FileName: "a/2", UploadId: "2", Initiated: now},
+			},
+			"b/tmp/": {
+				{FileName: "b/tmp/3", UploadId: "3", Initiated: now.Add(-3 * time.Hour)},
+			},
+		},
+	}
+	j := NewJanitor("mock", cleaner, &JanitorConfig{Directories: []string{"a/", "c/", "b/tmp/"}, MaxAgeMs: int(time.Hour / time.Millisecond)})
+
+	// the other directories are still cleaned up after a failure
+	n, err := j.Clean(context.Background())
+	assert.Equal(t, "bucket not found", err.Error())
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"1", "3"}, cleaner.abortedUploads())
+
+	cleaner.abortErr = errors.New("abort fail")
+	j.config.Directories = []string{"a/"}
+	n, err = j.Clean(context.Background())
+	assert.Equal(t, cleaner.abortErr, err)
+	assert.Equal(t, 0, n)
+
+	// the round is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = j.Clean(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestJanitor_StartStop(t *testing.T) {
+	cleaner := &memUploadCleaner{
+		uploads: map[string][]*l8_comp_file.IncompleteUpload{
+			"a/": {{FileName: "a/1", UploadId: "1", Initiated: time.Now().Add(-48 * time.Hour)}},
+		},
+	}
+	j := NewJanitor("mock", cleaner, &JanitorConfig{Directories: []string{"a/"}, IntervalMs: 10})
+	assert.Equal(t, defaultJanitorMaxAge, j.maxAge)
+	j.Start()
+	defer j.Stop()
+	// the first round runs at once
+	assert.Eventually(t, func() bool {
+		return len(cleaner.abortedUploads()) >= 2
+	}, time.Second, 5*time.Millisecond)
+	j.Stop()
+}
+
+func TestAbortUploads(t *testing.T) {
+	now := time.Now()
+	cleaner := &memUploadCleaner{
+		uploads: map[string][]*l8_comp_file.IncompleteUpload{
+			"a/1": {
+				{FileName: "a/1", UploadId: "1", Initiated: now},
+				// it's initiated before the put
+				{FileName: "a/1", UploadId: "2", Initiated: now.Add(-time.Hour)},
+				// it's another file with the same prefix
+				{FileName: "a/10", UploadId: "3", Initiated: now},
+			},
+		},
+	}
+	f := &struct {
+		*memFile
+		*memUploadCleaner
+	}{newMemFile(), cleaner}
+	n, err := AbortUploads(context.Background(), f, "a/1", nil, now.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"1"}, cleaner.abortedUploads())
+
+	// nothing is done if the component doesn't support it
+	n, err = AbortUploads(context.Background(), newMemFile(), "a/1", nil, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dapr/components-contrib/secretstores"
+)
+
+const (
+	filePrefix      = "file:"
+	secretRefPrefix = "secretKeyRef:"
+	defaultSep      = ":-"
+)
+
+// referencePattern matches ${...} in the runtime config, and $${...} is the escaped one which is kept as ${...}
+var referencePattern = regexp.MustCompile(`\$?\$\{[^}]*\}`)
+
+// interpolateConfig replaces the references in the string values of the runtime config:
+//
+//	${ENV_VAR}                      the environment variable, it's an error if it isn't set
+//	${ENV_VAR:-default}             the environment variable, or the default if it isn't set
+//	${file:path}                    the content of the file without the trailing newline, e.g. a mounted secret
+//	${secretKeyRef:store:name:key}  kept as it is, which is resolved after the secret stores are initialized
+//
+// The references can only be in the strings, so the values replaced are escaped as json strings.
+func interpolateConfig(data []byte) ([]byte, error) {
+	var err error
+	out := referencePattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if err != nil {
+			return ref
+		}
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+		var expr string
+		// the expression is a part of a json string, which may be escaped
+		if e := json.Unmarshal([]byte(`"`+string(ref[2:len(ref)-1])+`"`), &expr); e != nil {
+			err = fmt.Errorf("illegal reference %s in runtime config: %v", ref, e)
+			return ref
+		}
+		if strings.HasPrefix(expr, secretRefPrefix) {
+			return ref
+		}
+		value, e := resolveReference(expr)
+		if e != nil {
+			err = fmt.Errorf("resolve %s in runtime config error: %v", ref, e)
+			return ref
+		}
+		quoted, _ := json.Marshal(value)
+		return quoted[1 : len(quoted)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func resolveReference(expr string) (string, error) {
+	if strings.HasPrefix(expr, filePrefix) {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(expr, filePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r"), nil
+	}
+	name, def, hasDefault := expr, "", false
+	if i := strings.Index(expr, defaultSep); i >= 0 {
+		name, def, hasDefault = expr[:i], expr[i+len(defaultSep):], true
+	}
+	if name == "" {
+		return "", fmt.Errorf("the name of the environment variable is empty")
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+	if hasDefault {
+		return def, nil
+	}
+	return "", fmt.Errorf("environment variable %s isn't set", name)
+}
+
+// secretRefPattern matches the secretKeyRef references left by interpolateConfig
+var secretRefPattern = regexp.MustCompile(`\$\{` + secretRefPrefix + `([^}]*)\}`)
+
+// resolveSecretRefs replaces the secretKeyRef references in the metadata of the components in the config with the secrets.
+// The key is the name of the secret if it's omitted, or the only value of the secret.
+// It's called before the components are initialized, both at startup and after the components are changed at runtime,
+// and the metadata with references is replaced with a copy, so the maps shared with the custom resources keep the references.
+func (m *MosnRuntime) resolveSecretRefs() error {
+	c := m.runtimeConfig
+	for name, cfg := range c.SecretStoresManagement {
+		for k, v := range cfg.Metadata {
+			if secretRefPattern.MatchString(v) {
+				return fmt.Errorf("metadata %s of secret store %s can't refer to the secrets", k, name)
+			}
+		}
+	}
+	var err error
+	resolve := func(kind string, name string, metadata map[string]string) map[string]string {
+		if err != nil {
+			return metadata
+		}
+		var resolved map[string]string
+		for k, v := range metadata {
+			if !secretRefPattern.MatchString(v) {
+				continue
+			}
+			if resolved == nil {
+				resolved = make(map[string]string, len(metadata))
+				for key, value := range metadata {
+					resolved[key] = value
+				}
+			}
+			if resolved[k], err = m.resolveSecretRef(v); err != nil {
+				err = fmt.Errorf("resolve metadata %s of %s component %s error: %v", k, kind, name, err)
+				return metadata
+			}
+		}
+		if resolved == nil {
+			return metadata
+		}
+		return resolved
+	}
+	for name, cfg := range c.PubSubManagement {
+		cfg.Metadata = resolve("pubsub", name, cfg.Metadata)
+		c.PubSubManagement[name] = cfg
+	}
+	for name, cfg := range c.StateManagement {
+		cfg.Metadata = resolve("state", name, cfg.Metadata)
+		c.StateManagement[name] = cfg
+	}
+	for name, cfg := range c.LockManagement {
+		cfg.Metadata = resolve("lock", name, cfg.Metadata)
+		c.LockManagement[name] = cfg
+	}
+	for name, cfg := range c.SequencerManagement {
+		cfg.Metadata = resolve("sequencer", name, cfg.Metadata)
+		c.SequencerManagement[name] = cfg
+	}
+	for name, cfg := range c.Bindings {
+		cfg.Metadata = resolve("binding", name, cfg.Metadata)
+		c.Bindings[name] = cfg
+	}
+	return err
+}
+
+func (m *MosnRuntime) resolveSecretRef(value string) (string, error) {
+	var err error
+	resolved := secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		parts := strings.Split(secretRefPattern.FindStringSubmatch(ref)[1], ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			err = fmt.Errorf("illegal reference %s, expected ${%sstore:name[:key]}", ref, secretRefPrefix)
+			return ref
+		}
+		store, ok := m.secretStores[parts[0]]
+		if !ok {
+			err = fmt.Errorf("secret store %s not found", parts[0])
+			return ref
+		}
+		resp, e := store.GetSecret(secretstores.GetSecretRequest{Name: parts[1]})
+		if e != nil {
+			err = fmt.Errorf("fail to get secret %s: %v", parts[1], e)
+			return ref
+		}
+		key := parts[1]
+		if len(parts) == 3 {
+			key = parts[2]
+		}
+		secret, ok := resp.Data[key]
+		if !ok && len(parts) == 2 && len(resp.Data) == 1 {
+			for _, v := range resp.Data {
+				secret, ok = v, true
+			}
+		}
+		if !ok {
+			err = fmt.Errorf("key %s not found in secret %s", key, parts[1])
+			return ref
+		}
+		return secret
+	})
+	return resolved, err
+}
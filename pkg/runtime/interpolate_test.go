@@ -0,0 +1,125 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/lock"
+	mock_secret "mosn.io/layotto/pkg/mock/components/secret"
+	mbindings "mosn.io/layotto/pkg/runtime/bindings"
+	mstate "mosn.io/layotto/pkg/runtime/state"
+)
+
+func TestInterpolateConfig(t *testing.T) {
+	os.Setenv("LAYOTTO_TEST_HOST", `redis:6379`)
+	os.Setenv("LAYOTTO_TEST_QUOTED", `a"b\c`)
+	defer os.Unsetenv("LAYOTTO_TEST_HOST")
+	defer os.Unsetenv("LAYOTTO_TEST_QUOTED")
+	dir, err := ioutil.TempDir("", "interpolate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "password")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("p@ss\n"), 0600))
+
+	t.Run("env and file", func(t *testing.T) {
+		data := `{"state": {"redis": {"metadata": {
+  "redisHost": "${LAYOTTO_TEST_HOST}",
+  "redisPassword": "${file:` + path + `}",
+  "db": "db-${LAYOTTO_TEST_DB:-0}",
+  "quoted": "${LAYOTTO_TEST_QUOTED}",
+  "escaped": "$${LAYOTTO_TEST_HOST}",
+  "secret": "${secretKeyRef:vault:redis:password}"
+}}}}`
+		cfg, err := ParseRuntimeConfig([]byte(data))
+		assert.Nil(t, err)
+		md := cfg.StateManagement["redis"].Metadata
+		assert.Equal(t, "redis:6379", md["redisHost"])
+		assert.Equal(t, "p@ss", md["redisPassword"])
+		assert.Equal(t, "db-0", md["db"])
+		assert.Equal(t, `a"b\c`, md["quoted"])
+		assert.Equal(t, "${LAYOTTO_TEST_HOST}", md["escaped"])
+		// the secrets are resolved after the secret stores are initialized
+		assert.Equal(t, "${secretKeyRef:vault:redis:password}", md["secret"])
+	})
+
+	t.Run("env not set", func(t *testing.T) {
+		_, err := ParseRuntimeConfig([]byte(`{"app": {"app_id": "${LAYOTTO_TEST_NOT_SET}"}}`))
+		assert.EqualError(t, err, "resolve ${LAYOTTO_TEST_NOT_SET} in runtime config error: environment variable LAYOTTO_TEST_NOT_SET isn't set")
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		_, err := ParseRuntimeConfig([]byte(`{"app": {"app_id": "${file:` + filepath.Join(dir, "none") + `}"}}`))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("lines are kept", func(t *testing.T) {
+		d := ValidateRuntimeConfig([]byte("{\n  \"app\": {\"app_id\": \"${LAYOTTO_TEST_HOST}\"},\n  \"stat\": {}\n}"))
+		assert.Len(t, d, 1)
+		assert.Equal(t, 3, d[0].Line)
+	})
+}
+
+func TestResolveSecretRefs(t *testing.T) {
+	newRuntime := func(metadata map[string]string) *MosnRuntime {
+		m := NewMosnRuntime(&MosnRuntimeConfig{
+			StateManagement: map[string]mstate.Config{"redis": {Metadata: metadata}},
+			LockManagement:  map[string]lock.Config{"redis": {}},
+		})
+		m.secretStores["local"] = mock_secret.FakeSecretStore{}
+		return m
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		original := map[string]string{
+			"password": "${secretKeyRef:local:good-key}",
+			"url":      "redis://u:${secretKeyRef:local:good-key:good-key}@host",
+		}
+		m := newRuntime(original)
+		assert.Nil(t, m.resolveSecretRefs())
+		md := m.runtimeConfig.StateManagement["redis"].Metadata
+		assert.Equal(t, "life is good", md["password"])
+		assert.Equal(t, "redis://u:life is good@host", md["url"])
+		// the metadata is copied
+		assert.Equal(t, "${secretKeyRef:local:good-key}", original["password"])
+	})
+
+	t.Run("illegal", func(t *testing.T) {
+		for _, ref := range []string{
+			"${secretKeyRef:local}",
+			"${secretKeyRef:unknown:good-key}",
+			"${secretKeyRef:local:error-key}",
+			"${secretKeyRef:local:good-key:none}",
+		} {
+			m := newRuntime(map[string]string{"password": ref})
+			assert.NotNil(t, m.resolveSecretRefs(), ref)
+		}
+	})
+
+	t.Run("secret store", func(t *testing.T) {
+		m := newRuntime(nil)
+		m.runtimeConfig.SecretStoresManagement = map[string]mbindings.Metadata{
+			"local": {Metadata: map[string]string{"token": "${secretKeyRef:local:good-key}"}},
+		}
+		assert.NotNil(t, m.resolveSecretRefs())
+	})
+}
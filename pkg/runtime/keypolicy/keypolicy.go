@@ -0,0 +1,170 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package keypolicy checks the keys of the state stores, locks and sequencers against the constraints of the backends,
+// e.g. the allowed characters and the max length, before they're sent to the components.
+package keypolicy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// the metadata keys of the components, in the same place as keyPrefix
+	allowedCharsKey        = "keyAllowedChars"
+	invalidCharStrategyKey = "keyInvalidCharStrategy"
+	maxLengthKey           = "keyMaxLength"
+	overlongStrategyKey    = "keyOverlongStrategy"
+
+	// Reject fails the requests with the keys violating the policy, it's the default strategy
+	Reject = "reject"
+	// Escape replaces the characters not allowed with %XX, which is reversible and collision free
+	Escape = "escape"
+	// Hash truncates the overlong keys and appends the hash of the whole key
+	Hash = "hash"
+
+	// hashLength is the min length of the hash appended to the overlong keys, in hex
+	hashLength = 32
+)
+
+// Policy is the key policy of a component. The zero value accepts all the keys.
+type Policy struct {
+	// allowed matches the keys consisting of the allowed characters only, nil means all the characters are allowed
+	allowed *regexp.Regexp
+	// invalid matches a character not allowed
+	invalid       *regexp.Regexp
+	escapeInvalid bool
+	// maxLength is the max length of the keys in bytes including the prefix, 0 means unlimited
+	maxLength    int
+	hashOverlong bool
+}
+
+// Parse reads the policy from the metadata of the component, e.g.
+//
+//	"keyAllowedChars": "a-zA-Z0-9_.:-",
+//	"keyInvalidCharStrategy": "escape",
+//	"keyMaxLength": "250",
+//	"keyOverlongStrategy": "hash"
+//
+// keyAllowedChars is the content of a character class in regular expressions.
+func Parse(metadata map[string]string) (*Policy, error) {
+	p := &Policy{}
+	if chars := metadata[allowedCharsKey]; chars != "" {
+		var err error
+		if p.allowed, err = regexp.Compile("^[" + chars + "]*$"); err != nil {
+			return nil, fmt.Errorf("%s '%s' is illegal: %v", allowedCharsKey, chars, err)
+		}
+		p.invalid = regexp.MustCompile("[^" + chars + "]")
+	}
+	switch strategy := strings.ToLower(metadata[invalidCharStrategyKey]); strategy {
+	case "", Reject:
+	case Escape:
+		if p.allowed != nil && p.allowed.MatchString("%") {
+			return nil, fmt.Errorf("%s can't contain '%%' with the escape strategy", allowedCharsKey)
+		}
+		p.escapeInvalid = true
+	default:
+		return nil, fmt.Errorf("%s '%s' is illegal, expected reject or escape", invalidCharStrategyKey, strategy)
+	}
+	if s := metadata[maxLengthKey]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s '%s' is illegal", maxLengthKey, s)
+		}
+		p.maxLength = n
+	}
+	switch strategy := strings.ToLower(metadata[overlongStrategyKey]); strategy {
+	case "", Reject:
+	case Hash:
+		if p.maxLength > 0 && p.maxLength <= hashLength {
+			return nil, fmt.Errorf("%s should be greater than %d with the hash strategy", maxLengthKey, hashLength)
+		}
+		if p.allowed != nil && !p.allowed.MatchString("0123456789abcdef") {
+			return nil, fmt.Errorf("%s should allow the hex digits with the hash strategy", allowedCharsKey)
+		}
+		p.hashOverlong = true
+	default:
+		return nil, fmt.Errorf("%s '%s' is illegal, expected reject or hash", overlongStrategyKey, strategy)
+	}
+	return p, nil
+}
+
+// Sanitize checks the characters of the key from the request, the ones not allowed are escaped or rejected.
+// It's called before the prefix is added, since the separators in the prefix needn't be allowed.
+func (p *Policy) Sanitize(key string) (string, error) {
+	if p == nil || p.allowed == nil || p.allowed.MatchString(key) {
+		return key, nil
+	}
+	if !p.escapeInvalid {
+		return "", fmt.Errorf("key '%s' contains the characters not allowed", key)
+	}
+	return p.invalid.ReplaceAllStringFunc(key, func(s string) string {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+		}
+		return b.String()
+	}), nil
+}
+
+// Limit checks the length of the key with the prefix, the overlong ones are hashed or rejected.
+// The hashed keys keep the beginning of the keys, so the prefix still separates the key spaces.
+// With the hash strategy, the keys of the max length are hashed too, so that exactly the hashed keys have the max length.
+func (p *Policy) Limit(key string) (string, error) {
+	if p == nil || p.maxLength == 0 || len(key) < p.maxLength || (len(key) == p.maxLength && !p.hashOverlong) {
+		return key, nil
+	}
+	if !p.hashOverlong {
+		return "", fmt.Errorf("key '%s' is longer than %d", key, p.maxLength)
+	}
+	sum := sha256.Sum256([]byte(key))
+	n := p.maxLength - hashLength
+	// don't split a multi-byte character, the hash is longer instead
+	for n > 0 && !utf8.RuneStart(key[n]) {
+		n--
+	}
+	return key[:n] + hex.EncodeToString(sum[:])[:p.maxLength-n], nil
+}
+
+// Hashed returns whether the key with the prefix is hashed by Limit, whose original key can't be restored.
+func (p *Policy) Hashed(key string) bool {
+	return p != nil && p.hashOverlong && p.maxLength > 0 && len(key) == p.maxLength
+}
+
+// Restore reverses Sanitize, i.e. the characters escaped are restored. The keys of the reject strategy are returned as they are.
+func (p *Policy) Restore(key string) string {
+	if p == nil || !p.escapeInvalid || !strings.Contains(key, "%") {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) {
+			if v, err := strconv.ParseUint(key[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package keypolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, &Policy{}, p)
+
+	illegal := []map[string]string{
+		{allowedCharsKey: "z-a"},
+		{allowedCharsKey: "\\"},
+		{invalidCharStrategyKey: "drop"},
+		{allowedCharsKey: "a-z%", invalidCharStrategyKey: Escape},
+		{maxLengthKey: "abc"},
+		{maxLengthKey: "-1"},
+		{overlongStrategyKey: "truncate"},
+		{maxLengthKey: "32", overlongStrategyKey: Hash},
+		{allowedCharsKey: "a-z", overlongStrategyKey: Hash},
+	}
+	for _, md := range illegal {
+		_, err := Parse(md)
+		assert.NotNil(t, err, "%v", md)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	var nilPolicy *Policy
+	key, err := nilPolicy.Sanitize("a b")
+	assert.Nil(t, err)
+	assert.Equal(t, "a b", key)
+
+	p, err := Parse(map[string]string{allowedCharsKey: "a-zA-Z0-9_.:-"})
+	assert.Nil(t, err)
+	key, err = p.Sanitize("order:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "order:1", key)
+	_, err = p.Sanitize("order 1")
+	assert.NotNil(t, err)
+
+	p, err = Parse(map[string]string{allowedCharsKey: "a-zA-Z0-9_.:-", invalidCharStrategyKey: "ESCAPE"})
+	assert.Nil(t, err)
+	key, err = p.Sanitize("order 1/中%")
+	assert.Nil(t, err)
+	assert.Equal(t, "order%201%2F%E4%B8%AD%25", key)
+}
+
+func TestLimit(t *testing.T) {
+	p, err := Parse(map[string]string{maxLengthKey: "40"})
+	assert.Nil(t, err)
+	key, err := p.Limit(strings.Repeat("a", 40))
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("a", 40), key)
+	_, err = p.Limit(strings.Repeat("a", 41))
+	assert.NotNil(t, err)
+
+	p, err = Parse(map[string]string{maxLengthKey: "40", overlongStrategyKey: Hash})
+	assert.Nil(t, err)
+	long1, err := p.Limit("prefix||" + strings.Repeat("a", 41))
+	assert.Nil(t, err)
+	assert.Len(t, long1, 40)
+	assert.True(t, strings.HasPrefix(long1, "prefix||"))
+	long2, _ := p.Limit("prefix||" + strings.Repeat("a", 42))
+	assert.NotEqual(t, long1, long2)
+	// deterministic
+	again, _ := p.Limit("prefix||" + strings.Repeat("a", 41))
+	assert.Equal(t, long1, again)
+
+	// the multi-byte characters aren't split
+	key, err = p.Limit("1234567" + strings.Repeat("中", 20))
+	assert.Nil(t, err)
+	assert.Equal(t, "1234567", key[:7])
+	assert.Len(t, key, 40)
+
+	// exactly the hashed keys have the max length
+	key, err = p.Limit(strings.Repeat("a", 40))
+	assert.Nil(t, err)
+	assert.NotEqual(t, strings.Repeat("a", 40), key)
+	assert.True(t, p.Hashed(key))
+	short, _ := p.Limit(strings.Repeat("a", 39))
+	assert.False(t, p.Hashed(short))
+	assert.False(t, (*Policy)(nil).Hashed(key))
+}
+
+func TestRestore(t *testing.T) {
+	p, err := Parse(map[string]string{allowedCharsKey: "a-zA-Z0-9_.:-", invalidCharStrategyKey: "escape"})
+	assert.Nil(t, err)
+	for _, k := range []string{"order:1", "order 1/中%", "%", "a%2"} {
+		key, err := p.Sanitize(k)
+		assert.Nil(t, err)
+		assert.Equal(t, k, p.Restore(key))
+	}
+	// the keys of the reject strategy are kept as they are
+	p, _ = Parse(map[string]string{})
+	assert.Equal(t, "a%20b", p.Restore("a%20b"))
+	assert.Equal(t, "a%20b", (*Policy)(nil).Restore("a%20b"))
+}
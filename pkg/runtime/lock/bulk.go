@@ -0,0 +1,67 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"sort"
+
+	"mosn.io/layotto/components/lock"
+	"mosn.io/pkg/log"
+)
+
+// MaxBulkResources is the max number of the resources locked by TryLockBulk in a request
+const MaxBulkResources = 100
+
+// TryLockBulk acquires the locks of all the resources with the same owner, or none of them.
+// The resources are deduplicated and acquired in order, so the requests locking the same resources don't deadlock each other.
+// The locks acquired are released in reverse order if any of them fails, and the resource failed is returned.
+// The resource failed with an error is released as well, as the lock may be acquired before the error, e.g. a timeout.
+func TryLockBulk(store lock.LockStore, resourceIds []string, owner string, expire int32) (failed string, err error) {
+	ids := make([]string, 0, len(resourceIds))
+	seen := make(map[string]struct{}, len(resourceIds))
+	for _, id := range resourceIds {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		resp, err := store.TryLock(&lock.TryLockRequest{ResourceId: id, LockOwner: owner, Expire: expire})
+		if err == nil && resp.Success {
+			continue
+		}
+		if err != nil {
+			rollback(store, ids[:i+1], owner)
+		} else {
+			rollback(store, ids[:i], owner)
+		}
+		return id, err
+	}
+	return "", nil
+}
+
+func rollback(store lock.LockStore, ids []string, owner string) {
+	for i := len(ids) - 1; i >= 0; i-- {
+		resp, err := store.Unlock(&lock.UnlockRequest{ResourceId: ids[i], LockOwner: owner})
+		if err != nil {
+			log.DefaultLogger.Errorf("[runtime] [lock.bulk] rollback lock %s error: %v", ids[i], err)
+			continue
+		}
+		if resp.Status != lock.SUCCESS {
+			log.DefaultLogger.Warnf("[runtime] [lock.bulk] rollback lock %s with status %v", ids[i], resp.Status)
+		}
+	}
+}
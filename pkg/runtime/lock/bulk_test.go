@@ -0,0 +1,101 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/lock"
+)
+
+// memLockStore holds the locks in memory and records the order of the requests
+type memLockStore struct {
+	fakeLockStore
+	owners   map[string]string
+	failOn   string
+	locked   []string
+	unlocked []string
+	// lockOnFail acquires the lock of failOn before the error is returned
+	lockOnFail bool
+}
+
+func newMemLockStore() *memLockStore {
+	return &memLockStore{owners: make(map[string]string)}
+}
+
+func (m *memLockStore) TryLock(req *lock.TryLockRequest) (*lock.TryLockResponse, error) {
+	if req.ResourceId == m.failOn {
+		if m.lockOnFail {
+			m.owners[req.ResourceId] = req.LockOwner
+		}
+		return nil, errors.New("store error")
+	}
+	if _, ok := m.owners[req.ResourceId]; ok {
+		return &lock.TryLockResponse{Success: false}, nil
+	}
+	m.owners[req.ResourceId] = req.LockOwner
+	m.locked = append(m.locked, req.ResourceId)
+	return &lock.TryLockResponse{Success: true}, nil
+}
+
+func (m *memLockStore) Unlock(req *lock.UnlockRequest) (*lock.UnlockResponse, error) {
+	if m.owners[req.ResourceId] != req.LockOwner {
+		return &lock.UnlockResponse{Status: lock.LOCK_BELONG_TO_OTHERS}, nil
+	}
+	delete(m.owners, req.ResourceId)
+	m.unlocked = append(m.unlocked, req.ResourceId)
+	return &lock.UnlockResponse{Status: lock.SUCCESS}, nil
+}
+
+func TestTryLockBulk(t *testing.T) {
+	store := newMemLockStore()
+	failed, err := TryLockBulk(store, []string{"c", "a", "b", "a"}, "o1", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", failed)
+	// sorted and deduplicated
+	assert.Equal(t, []string{"a", "b", "c"}, store.locked)
+	assert.Equal(t, map[string]string{"a": "o1", "b": "o1", "c": "o1"}, store.owners)
+}
+
+func TestTryLockBulkRollback(t *testing.T) {
+	store := newMemLockStore()
+	store.owners["c"] = "o2"
+	failed, err := TryLockBulk(store, []string{"d", "c", "b", "a"}, "o1", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "c", failed)
+	// the locks acquired are released in reverse order
+	assert.Equal(t, []string{"a", "b"}, store.locked)
+	assert.Equal(t, []string{"b", "a"}, store.unlocked)
+	assert.Equal(t, map[string]string{"c": "o2"}, store.owners)
+
+	store = newMemLockStore()
+	store.failOn = "b"
+	failed, err = TryLockBulk(store, []string{"a", "b", "c"}, "o1", 10)
+	assert.NotNil(t, err)
+	assert.Equal(t, "b", failed)
+	assert.Empty(t, store.owners)
+
+	// the lock acquired before the error is released as well
+	store = newMemLockStore()
+	store.failOn = "b"
+	store.lockOnFail = true
+	failed, err = TryLockBulk(store, []string{"a", "b", "c"}, "o1", 10)
+	assert.NotNil(t, err)
+	assert.Equal(t, "b", failed)
+	assert.Equal(t, []string{"b", "a"}, store.unlocked)
+	assert.Empty(t, store.owners)
+}
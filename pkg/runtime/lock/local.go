@@ -0,0 +1,154 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mosn.io/layotto/components/lock"
+)
+
+const (
+	// LocalModeLocal serves the locks from the lock table in the sidecar only.
+	// It's for the apps with a single replica per key, or the callers in the same process like WASM functions.
+	LocalModeLocal = "local"
+	// LocalModeHybrid rejects the contention between the callers of the sidecar with the lock table,
+	// and acquires the lock from the store only after the lock table.
+	LocalModeHybrid = "hybrid"
+
+	// the expired entries are swept when the table grows to this size at least
+	minSweepSize = 1024
+)
+
+// LocalConfig is the config of the lock table in the sidecar
+type LocalConfig struct {
+	// Mode is "local" or "hybrid"
+	Mode string `json:"mode"`
+}
+
+func (c *LocalConfig) Validate() error {
+	if c.Mode != LocalModeLocal && c.Mode != LocalModeHybrid {
+		return fmt.Errorf("unknown local lock mode '%s', it should be '%s' or '%s'", c.Mode, LocalModeLocal, LocalModeHybrid)
+	}
+	return nil
+}
+
+type localEntry struct {
+	owner    string
+	expireAt time.Time
+}
+
+// localLockStore keeps the locks acquired through the sidecar in a lock table.
+// In the local mode the store isn't called at all, while in the hybrid mode the store is the source of truth
+// and the table only saves the round trips of the requests that would fail anyway.
+type localLockStore struct {
+	lock.LockStore
+	hybrid bool
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*localEntry
+	sweepAt int
+}
+
+// NewLocalLockStore wraps the lock store with a lock table in the sidecar
+func NewLocalLockStore(store lock.LockStore, cfg *LocalConfig) lock.LockStore {
+	return &localLockStore{
+		LockStore: store,
+		hybrid:    cfg.Mode == LocalModeHybrid,
+		now:       time.Now,
+		entries:   make(map[string]*localEntry),
+		sweepAt:   minSweepSize,
+	}
+}
+
+func (l *localLockStore) TryLock(req *lock.TryLockRequest) (*lock.TryLockResponse, error) {
+	now := l.now()
+	l.mu.Lock()
+	if e, ok := l.entries[req.ResourceId]; ok && now.Before(e.expireAt) {
+		l.mu.Unlock()
+		return &lock.TryLockResponse{Success: false}, nil
+	}
+	if len(l.entries) >= l.sweepAt {
+		l.sweep(now)
+	}
+	e := &localEntry{owner: req.LockOwner, expireAt: now.Add(time.Duration(req.Expire) * time.Second)}
+	l.entries[req.ResourceId] = e
+	l.mu.Unlock()
+	if !l.hybrid {
+		return &lock.TryLockResponse{Success: true}, nil
+	}
+	// the entry is reserved while acquiring from the store, so the other callers of the sidecar fail fast
+	resp, err := l.LockStore.TryLock(req)
+	if err != nil || !resp.Success {
+		l.remove(req.ResourceId, e)
+	}
+	return resp, err
+}
+
+func (l *localLockStore) Unlock(req *lock.UnlockRequest) (*lock.UnlockResponse, error) {
+	now := l.now()
+	l.mu.Lock()
+	e, ok := l.entries[req.ResourceId]
+	if ok && !now.Before(e.expireAt) {
+		delete(l.entries, req.ResourceId)
+		ok = false
+	}
+	l.mu.Unlock()
+	if !ok {
+		if l.hybrid {
+			// the lock might be acquired before the sidecar restarted
+			return l.LockStore.Unlock(req)
+		}
+		return &lock.UnlockResponse{Status: lock.LOCK_UNEXIST}, nil
+	}
+	if e.owner != req.LockOwner {
+		return &lock.UnlockResponse{Status: lock.LOCK_BELONG_TO_OTHERS}, nil
+	}
+	if !l.hybrid {
+		l.remove(req.ResourceId, e)
+		return &lock.UnlockResponse{Status: lock.SUCCESS}, nil
+	}
+	resp, err := l.LockStore.Unlock(req)
+	// the entry is kept on errors, so that the owner can retry
+	if err == nil {
+		l.remove(req.ResourceId, e)
+	}
+	return resp, err
+}
+
+// remove deletes the entry unless it's replaced already
+func (l *localLockStore) remove(resourceId string, e *localEntry) {
+	l.mu.Lock()
+	if l.entries[resourceId] == e {
+		delete(l.entries, resourceId)
+	}
+	l.mu.Unlock()
+}
+
+// sweep deletes the expired entries, the next sweep happens when the table doubles.
+// It's called with the mutex held.
+func (l *localLockStore) sweep(now time.Time) {
+	for id, e := range l.entries {
+		if !now.Before(e.expireAt) {
+			delete(l.entries, id)
+		}
+	}
+	l.sweepAt = 2 * len(l.entries)
+	if l.sweepAt < minSweepSize {
+		l.sweepAt = minSweepSize
+	}
+}
@@ -0,0 +1,174 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/lock"
+)
+
+type fakeLockStore struct {
+	tryLocks int
+	unlocks  int
+	success  bool
+	status   lock.LockStatus
+	err      error
+}
+
+func (f *fakeLockStore) Init(metadata lock.Metadata) error {
+	return nil
+}
+
+func (f *fakeLockStore) Features() []lock.Feature {
+	return nil
+}
+
+func (f *fakeLockStore) TryLock(req *lock.TryLockRequest) (*lock.TryLockResponse, error) {
+	f.tryLocks++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &lock.TryLockResponse{Success: f.success}, nil
+}
+
+func (f *fakeLockStore) Unlock(req *lock.UnlockRequest) (*lock.UnlockResponse, error) {
+	f.unlocks++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &lock.UnlockResponse{Status: f.status}, nil
+}
+
+func newTestLocalLockStore(store lock.LockStore, mode string, now *time.Time) *localLockStore {
+	l := NewLocalLockStore(store, &LocalConfig{Mode: mode}).(*localLockStore)
+	l.now = func() time.Time {
+		return *now
+	}
+	return l
+}
+
+func TestLocalConfigValidate(t *testing.T) {
+	assert.Nil(t, (&LocalConfig{Mode: LocalModeLocal}).Validate())
+	assert.Nil(t, (&LocalConfig{Mode: LocalModeHybrid}).Validate())
+	assert.NotNil(t, (&LocalConfig{}).Validate())
+	assert.NotNil(t, (&LocalConfig{Mode: "remote"}).Validate())
+}
+
+func TestLocalLockStore(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{}
+	l := newTestLocalLockStore(store, LocalModeLocal, &now)
+
+	resp, err := l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	assert.Nil(t, err)
+	assert.True(t, resp.Success)
+	resp, err = l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o2", Expire: 10})
+	assert.Nil(t, err)
+	assert.False(t, resp.Success)
+
+	unlockResp, err := l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o2"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.LOCK_BELONG_TO_OTHERS, unlockResp.Status)
+	unlockResp, err = l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.SUCCESS, unlockResp.Status)
+	unlockResp, err = l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.LOCK_UNEXIST, unlockResp.Status)
+
+	// the lock can be acquired by others after it expires
+	resp, _ = l.TryLock(&lock.TryLockRequest{ResourceId: "r2", LockOwner: "o1", Expire: 1})
+	assert.True(t, resp.Success)
+	now = now.Add(time.Second)
+	resp, _ = l.TryLock(&lock.TryLockRequest{ResourceId: "r2", LockOwner: "o2", Expire: 1})
+	assert.True(t, resp.Success)
+
+	// the store isn't called in the local mode
+	assert.Equal(t, 0, store.tryLocks)
+	assert.Equal(t, 0, store.unlocks)
+}
+
+func TestLocalLockStoreSweep(t *testing.T) {
+	now := time.Now()
+	l := newTestLocalLockStore(&fakeLockStore{}, LocalModeLocal, &now)
+	for i := 0; i < minSweepSize; i++ {
+		l.TryLock(&lock.TryLockRequest{ResourceId: string(rune(i)), LockOwner: "o1", Expire: 1})
+	}
+	assert.Len(t, l.entries, minSweepSize)
+	now = now.Add(time.Second)
+	l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 1})
+	assert.Len(t, l.entries, 1)
+	assert.Equal(t, minSweepSize, l.sweepAt)
+}
+
+func TestHybridLockStore(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{success: true, status: lock.SUCCESS}
+	l := newTestLocalLockStore(store, LocalModeHybrid, &now)
+
+	resp, err := l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	assert.Nil(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, 1, store.tryLocks)
+	// the contention is rejected in the sidecar
+	resp, err = l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o2", Expire: 10})
+	assert.Nil(t, err)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 1, store.tryLocks)
+
+	unlockResp, err := l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o2"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.LOCK_BELONG_TO_OTHERS, unlockResp.Status)
+	assert.Equal(t, 0, store.unlocks)
+	unlockResp, err = l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.SUCCESS, unlockResp.Status)
+	assert.Equal(t, 1, store.unlocks)
+	assert.Empty(t, l.entries)
+
+	// the locks not in the table are unlocked by the store
+	l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.Equal(t, 2, store.unlocks)
+}
+
+func TestHybridLockStoreFailed(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{success: false}
+	l := newTestLocalLockStore(store, LocalModeHybrid, &now)
+
+	// the lock is held by another sidecar
+	resp, err := l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	assert.Nil(t, err)
+	assert.False(t, resp.Success)
+	assert.Empty(t, l.entries)
+
+	store.err = errors.New("store error")
+	_, err = l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	assert.NotNil(t, err)
+	assert.Empty(t, l.entries)
+
+	// the entry is kept if the store fails to unlock
+	store.err = nil
+	store.success = true
+	l.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	store.err = errors.New("store error")
+	_, err = l.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.NotNil(t, err)
+	assert.Len(t, l.entries, 1)
+}
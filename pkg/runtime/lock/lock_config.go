@@ -16,8 +16,11 @@ package lock
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
+
+	"mosn.io/layotto/pkg/runtime/keypolicy"
 )
 
 const (
@@ -33,10 +36,15 @@ const (
 	separator    = "||"
 )
 
-var lockConfiguration = map[string]*StoreConfiguration{}
+var (
+	lockConfiguration = map[string]*StoreConfiguration{}
+	// the configurations are saved again when the components are reconciled
+	lockConfigurationLock sync.RWMutex
+)
 
 type StoreConfiguration struct {
 	keyPrefixStrategy string
+	keyPolicy         *keypolicy.Policy
 }
 
 func SaveLockConfiguration(storeName string, metadata map[string]string) error {
@@ -50,7 +58,14 @@ func SaveLockConfiguration(storeName string, metadata map[string]string) error {
 		}
 	}
 
-	lockConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy}
+	policy, err := keypolicy.Parse(metadata)
+	if err != nil {
+		return err
+	}
+
+	lockConfigurationLock.Lock()
+	lockConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy, keyPolicy: policy}
+	lockConfigurationLock.Unlock()
 	return nil
 }
 
@@ -59,28 +74,43 @@ func GetModifiedLockKey(key, storeName, appID string) (string, error) {
 		return "", err
 	}
 	config := getConfiguration(storeName)
+	key, err := config.keyPolicy.Sanitize(key)
+	if err != nil {
+		return "", err
+	}
+	return config.keyPolicy.Limit(addPrefix(config, key, storeName, appID))
+}
+
+func addPrefix(config *StoreConfiguration, key, storeName, appID string) string {
 	switch config.keyPrefixStrategy {
 	case strategyNone:
-		return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key), nil
+		return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key)
 	case strategyStoreName:
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, storeName, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, storeName, separator, key)
 	case strategyAppid:
 		if appID == "" {
-			return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key), nil
+			return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key)
 		}
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, appID, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, appID, separator, key)
 	default:
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, config.keyPrefixStrategy, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, config.keyPrefixStrategy, separator, key)
 	}
 }
 
 func getConfiguration(storeName string) *StoreConfiguration {
+	lockConfigurationLock.RLock()
 	c := lockConfiguration[storeName]
+	lockConfigurationLock.RUnlock()
+	if c != nil {
+		return c
+	}
+	lockConfigurationLock.Lock()
+	defer lockConfigurationLock.Unlock()
+	c = lockConfiguration[storeName]
 	if c == nil {
 		c = &StoreConfiguration{keyPrefixStrategy: strategyDefault}
 		lockConfiguration[storeName] = c
 	}
-
 	return c
 }
 
@@ -15,6 +15,7 @@ package lock
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -116,3 +117,28 @@ func TestPrefix_StoreNotInitial(t *testing.T) {
 	modifiedLockKey, _ := GetModifiedLockKey(key, "store999", "appid99")
 	require.Equal(t, "lock|||appid99||lock-key-1234567", modifiedLockKey)
 }
+
+func TestKeyPolicy(t *testing.T) {
+	err := SaveLockConfiguration("store7", map[string]string{
+		"keyAllowedChars":        "a-z0-9-",
+		"keyInvalidCharStrategy": "escape",
+		"keyMaxLength":           "48",
+		"keyOverlongStrategy":    "hash",
+	})
+	require.Nil(t, err)
+	modifiedLockKey, err := GetModifiedLockKey("order 1", "store7", "")
+	require.Nil(t, err)
+	require.Equal(t, "lock|||order%201", modifiedLockKey)
+	modifiedLockKey, err = GetModifiedLockKey(strings.Repeat("a", 48), "store7", "")
+	require.Nil(t, err)
+	require.Len(t, modifiedLockKey, 48)
+	require.True(t, strings.HasPrefix(modifiedLockKey, "lock|||aaa"))
+
+	err = SaveLockConfiguration("store8", map[string]string{"keyMaxLength": "10"})
+	require.Nil(t, err)
+	_, err = GetModifiedLockKey(key, "store8", "")
+	require.NotNil(t, err)
+
+	err = SaveLockConfiguration("store9", map[string]string{"keyOverlongStrategy": "truncate"})
+	require.NotNil(t, err)
+}
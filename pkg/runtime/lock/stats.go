@@ -0,0 +1,296 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/lock"
+)
+
+const (
+	// OtherPattern groups the resource ids matching none of the patterns in the metrics
+	OtherPattern = "other"
+
+	defaultTopKeys = 1000
+)
+
+// StatsConfig is the config of the metrics and the contention analytics of a lock store
+type StatsConfig struct {
+	// Patterns group the resource ids in the metrics, using the syntax of path.Match, e.g. "order_*".
+	// They are matched in order, and the resource ids matching none of them are grouped as "other".
+	Patterns []string `json:"patterns"`
+	// TopKeys is the max number of contended resources tracked for the top contended query, 1000 by default
+	TopKeys int `json:"top_keys"`
+}
+
+func (c *StatsConfig) Validate() error {
+	for _, p := range c.Patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid lock stats pattern '%s': %v", p, err)
+		}
+	}
+	if c.TopKeys < 0 {
+		return fmt.Errorf("lock stats top_keys %d shouldn't be negative", c.TopKeys)
+	}
+	return nil
+}
+
+// ContendedKey is the contention of a resource since it's contended first
+type ContendedKey struct {
+	ResourceId string
+	Pattern    string
+	// Attempts is the number of TryLock calls, including the contended ones
+	Attempts int64
+	// Contended is the number of TryLock calls failed because the lock is held by others
+	Contended int64
+	// Expired is the number of times the lock expired without being unlocked
+	Expired int64
+}
+
+// StatsStore is the lock store recording the metrics, which reports the most contended resources
+type StatsStore interface {
+	lock.LockStore
+	// TopContended returns the n resources contended most, in descending order of the contended calls
+	TopContended(n int) []ContendedKey
+}
+
+type holder struct {
+	owner      string
+	pattern    int
+	acquiredAt time.Time
+	expireAt   time.Time
+}
+
+// statsStore records the acquisition latency, the contention, the hold duration and the expirations of the locks
+// in the metrics of each pattern. The hold duration and the expirations are only known for the locks acquired
+// through the sidecar, and an expiration is counted when the lock is acquired again or the holders are swept.
+type statsStore struct {
+	lock.LockStore
+	name     string
+	patterns []string
+	metrics  []types.Metrics
+	topKeys  int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	holders map[string]*holder
+	sweepAt int
+	keys    map[string]*ContendedKey
+}
+
+// NewStatsStore wraps the lock store with the metrics
+func NewStatsStore(name string, store lock.LockStore, cfg *StatsConfig) StatsStore {
+	s := &statsStore{
+		LockStore: store,
+		name:      name,
+		patterns:  append(append([]string{}, cfg.Patterns...), OtherPattern),
+		topKeys:   cfg.TopKeys,
+		now:       time.Now,
+		holders:   make(map[string]*holder),
+		sweepAt:   minSweepSize,
+		keys:      make(map[string]*ContendedKey),
+	}
+	if s.topKeys == 0 {
+		s.topKeys = defaultTopKeys
+	}
+	s.metrics = make([]types.Metrics, len(s.patterns))
+	for i, p := range s.patterns {
+		m, err := metrics.NewMetrics("lock", map[string]string{"store": name, "pattern": p})
+		if err != nil {
+			log.DefaultLogger.Warnf("[runtime] [lock.stats] create metrics of store %s error: %v", name, err)
+			continue
+		}
+		s.metrics[i] = m
+	}
+	return s
+}
+
+// match returns the index of the pattern of the resource id
+func (s *statsStore) match(resourceId string) int {
+	for i, p := range s.patterns[:len(s.patterns)-1] {
+		if ok, _ := path.Match(p, resourceId); ok {
+			return i
+		}
+	}
+	return len(s.patterns) - 1
+}
+
+func (s *statsStore) TryLock(req *lock.TryLockRequest) (*lock.TryLockResponse, error) {
+	id := resourceIdOf(req.ResourceId)
+	pattern := s.match(id)
+	start := s.now()
+	resp, err := s.LockStore.TryLock(req)
+	now := s.now()
+	s.histogram(pattern, "acquire_latency_us", now.Sub(start).Microseconds())
+	if err != nil {
+		s.inc(pattern, "errors")
+		return resp, err
+	}
+	contended := !resp.Success
+	if contended {
+		s.inc(pattern, "contended")
+	} else {
+		s.inc(pattern, "acquired")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count(id, pattern, contended)
+	if contended {
+		return resp, err
+	}
+	if h, ok := s.holders[req.ResourceId]; ok && !now.Before(h.expireAt) {
+		s.expire(req.ResourceId, h)
+	}
+	if len(s.holders) >= s.sweepAt {
+		s.sweep(now)
+	}
+	s.holders[req.ResourceId] = &holder{
+		owner:      req.LockOwner,
+		pattern:    pattern,
+		acquiredAt: now,
+		expireAt:   now.Add(time.Duration(req.Expire) * time.Second),
+	}
+	return resp, err
+}
+
+func (s *statsStore) Unlock(req *lock.UnlockRequest) (*lock.UnlockResponse, error) {
+	resp, err := s.LockStore.Unlock(req)
+	if err != nil {
+		s.inc(s.match(resourceIdOf(req.ResourceId)), "errors")
+		return resp, err
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.holders[req.ResourceId]
+	if !ok || h.owner != req.LockOwner {
+		return resp, err
+	}
+	switch {
+	case resp.Status == lock.SUCCESS:
+		delete(s.holders, req.ResourceId)
+		s.histogram(h.pattern, "hold_duration_ms", now.Sub(h.acquiredAt).Milliseconds())
+	case resp.Status == lock.LOCK_UNEXIST && !now.Before(h.expireAt):
+		// the owner unlocks too late
+		s.expire(req.ResourceId, h)
+	}
+	return resp, err
+}
+
+// count records the TryLock call of the resource in the top contended keys.
+// A resource is tracked since it's contended first, and the least contended one is evicted if the keys are full.
+// It's called with the mutex held.
+func (s *statsStore) count(id string, pattern int, contended bool) {
+	k, ok := s.keys[id]
+	if !ok {
+		if !contended {
+			return
+		}
+		if len(s.keys) >= s.topKeys {
+			s.evict()
+		}
+		k = &ContendedKey{ResourceId: id, Pattern: s.patterns[pattern]}
+		s.keys[id] = k
+	}
+	k.Attempts++
+	if contended {
+		k.Contended++
+	}
+}
+
+// evict deletes the least contended key, it's called with the mutex held
+func (s *statsStore) evict() {
+	var min *ContendedKey
+	for _, k := range s.keys {
+		if min == nil || k.Contended < min.Contended {
+			min = k
+		}
+	}
+	if min != nil {
+		delete(s.keys, min.ResourceId)
+	}
+}
+
+// expire counts the expiration of the lock held, it's called with the mutex held
+func (s *statsStore) expire(resourceId string, h *holder) {
+	delete(s.holders, resourceId)
+	s.inc(h.pattern, "expired")
+	if k, ok := s.keys[resourceIdOf(resourceId)]; ok {
+		k.Expired++
+	}
+}
+
+// sweep counts the expirations of the locks held, the next sweep happens when the holders double.
+// It's called with the mutex held.
+func (s *statsStore) sweep(now time.Time) {
+	for id, h := range s.holders {
+		if !now.Before(h.expireAt) {
+			s.expire(id, h)
+		}
+	}
+	s.sweepAt = 2 * len(s.holders)
+	if s.sweepAt < minSweepSize {
+		s.sweepAt = minSweepSize
+	}
+}
+
+func (s *statsStore) TopContended(n int) []ContendedKey {
+	s.mu.Lock()
+	s.sweep(s.now())
+	res := make([]ContendedKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		res = append(res, *k)
+	}
+	s.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Contended != res[j].Contended {
+			return res[i].Contended > res[j].Contended
+		}
+		return res[i].ResourceId < res[j].ResourceId
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+func (s *statsStore) inc(pattern int, name string) {
+	if m := s.metrics[pattern]; m != nil {
+		m.Counter(name).Inc(1)
+	}
+}
+
+func (s *statsStore) histogram(pattern int, name string, v int64) {
+	if m := s.metrics[pattern]; m != nil {
+		m.Histogram(name).Update(v)
+	}
+}
+
+// resourceIdOf returns the resource id in the request of the app, without the prefix added by GetModifiedLockKey
+func resourceIdOf(key string) string {
+	if i := strings.LastIndex(key, separator); i >= 0 {
+		return key[i+len(separator):]
+	}
+	return key
+}
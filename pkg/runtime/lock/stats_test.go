@@ -0,0 +1,137 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/lock"
+)
+
+func newTestStatsStore(store lock.LockStore, cfg *StatsConfig, now *time.Time) *statsStore {
+	s := NewStatsStore("test", store, cfg).(*statsStore)
+	s.now = func() time.Time {
+		return *now
+	}
+	return s
+}
+
+func TestStatsConfigValidate(t *testing.T) {
+	assert.Nil(t, (&StatsConfig{}).Validate())
+	assert.Nil(t, (&StatsConfig{Patterns: []string{"order_*"}, TopKeys: 10}).Validate())
+	assert.NotNil(t, (&StatsConfig{Patterns: []string{"order_["}}).Validate())
+	assert.NotNil(t, (&StatsConfig{TopKeys: -1}).Validate())
+}
+
+func TestResourceIdOf(t *testing.T) {
+	assert.Equal(t, "r1", resourceIdOf("lock|||r1"))
+	assert.Equal(t, "r1", resourceIdOf("lock|||app||r1"))
+	assert.Equal(t, "r1", resourceIdOf("r1"))
+}
+
+func TestStatsStoreMatch(t *testing.T) {
+	now := time.Now()
+	s := newTestStatsStore(&fakeLockStore{}, &StatsConfig{Patterns: []string{"order_*", "user_*"}}, &now)
+	assert.Equal(t, 0, s.match("order_1"))
+	assert.Equal(t, 1, s.match("user_1"))
+	assert.Equal(t, 2, s.match("item_1"))
+	assert.Equal(t, OtherPattern, s.patterns[2])
+}
+
+func TestStatsStoreTopContended(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{success: true}
+	s := newTestStatsStore(store, &StatsConfig{Patterns: []string{"order_*"}}, &now)
+
+	// the resources never contended aren't tracked
+	resp, err := s.TryLock(&lock.TryLockRequest{ResourceId: "lock|||app||order_1", LockOwner: "o1", Expire: 10})
+	assert.Nil(t, err)
+	assert.True(t, resp.Success)
+	assert.Empty(t, s.TopContended(10))
+
+	store.success = false
+	for i := 0; i < 3; i++ {
+		s.TryLock(&lock.TryLockRequest{ResourceId: "lock|||app||order_1", LockOwner: "o2", Expire: 10})
+	}
+	s.TryLock(&lock.TryLockRequest{ResourceId: "lock|||app||item_1", LockOwner: "o2", Expire: 10})
+	store.success = true
+	s.TryLock(&lock.TryLockRequest{ResourceId: "lock|||app||item_1", LockOwner: "o2", Expire: 10})
+
+	top := s.TopContended(10)
+	assert.Equal(t, []ContendedKey{
+		{ResourceId: "order_1", Pattern: "order_*", Attempts: 3, Contended: 3},
+		{ResourceId: "item_1", Pattern: OtherPattern, Attempts: 2, Contended: 1},
+	}, top)
+	assert.Len(t, s.TopContended(1), 1)
+
+	// errors aren't counted as the contention
+	store.err = errors.New("unavailable")
+	_, err = s.TryLock(&lock.TryLockRequest{ResourceId: "lock|||app||order_1", LockOwner: "o2", Expire: 10})
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(3), s.TopContended(1)[0].Attempts)
+}
+
+func TestStatsStoreEvict(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{}
+	s := newTestStatsStore(store, &StatsConfig{TopKeys: 2}, &now)
+	for _, id := range []string{"r1", "r1", "r2", "r3"} {
+		s.TryLock(&lock.TryLockRequest{ResourceId: id, LockOwner: "o1", Expire: 10})
+	}
+	top := s.TopContended(0)
+	assert.Len(t, top, 2)
+	assert.Equal(t, "r1", top[0].ResourceId)
+	assert.Equal(t, "r3", top[1].ResourceId)
+}
+
+func TestStatsStoreExpired(t *testing.T) {
+	now := time.Now()
+	store := &fakeLockStore{success: true, status: lock.SUCCESS}
+	s := newTestStatsStore(store, &StatsConfig{}, &now)
+
+	// unlocked in time
+	s.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	now = now.Add(time.Second)
+	resp, err := s.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o1"})
+	assert.Nil(t, err)
+	assert.Equal(t, lock.SUCCESS, resp.Status)
+	assert.Empty(t, s.holders)
+
+	// contend the lock so that it's tracked, then it expires and is acquired by others
+	s.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o1", Expire: 10})
+	store.success = false
+	s.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o2", Expire: 10})
+	store.success = true
+	now = now.Add(11 * time.Second)
+	s.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o2", Expire: 10})
+	assert.Equal(t, int64(1), s.TopContended(1)[0].Expired)
+	assert.Equal(t, "o2", s.holders["r1"].owner)
+
+	// unlocked too late
+	now = now.Add(11 * time.Second)
+	store.status = lock.LOCK_UNEXIST
+	s.Unlock(&lock.UnlockRequest{ResourceId: "r1", LockOwner: "o2"})
+	assert.Equal(t, int64(2), s.TopContended(1)[0].Expired)
+	assert.Empty(t, s.holders)
+
+	// swept
+	s.TryLock(&lock.TryLockRequest{ResourceId: "r1", LockOwner: "o3", Expire: 10})
+	now = now.Add(11 * time.Second)
+	assert.Equal(t, int64(3), s.TopContended(1)[0].Expired)
+	assert.Empty(t, s.holders)
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const (
+	// ProfileMinimal serves the state, configuration and secret APIs only, without the background subsystems
+	ProfileMinimal = "minimal"
+	// ProfileStandard serves the common APIs, and starts the subsystems configured except the debug services
+	ProfileStandard = "standard"
+	// ProfileFull serves all the APIs and starts all the subsystems configured, it's the default profile
+	ProfileFull = "full"
+)
+
+// The API groups, the components of a group aren't initialized if the group is disabled
+const (
+	GroupHello         = "hello"
+	GroupConfiguration = "configuration"
+	GroupRpc           = "rpc"
+	GroupPubSub        = "pubsub"
+	GroupState         = "state"
+	GroupFile          = "file"
+	GroupLock          = "lock"
+	GroupSequencer     = "sequencer"
+	GroupBinding       = "binding"
+	GroupSecret        = "secret"
+)
+
+// The background subsystems, they start only if they're configured and enabled by the profile
+const (
+	// SubsystemAppCallback connects to the app to deliver the events of pubsubs and input bindings
+	SubsystemAppCallback    = "app_callback"
+	SubsystemWatchdog       = "watchdog"
+	SubsystemResourceBudget = "resource_budget"
+	SubsystemGrpcDebug      = "grpc_debug"
+	// SubsystemFaultInjection is for chaos testing, so only the full profile enables it
+	SubsystemFaultInjection = "fault_injection"
+)
+
+var allGroups = []string{GroupHello, GroupConfiguration, GroupRpc, GroupPubSub, GroupState, GroupFile, GroupLock, GroupSequencer, GroupBinding, GroupSecret}
+
+var allSubsystems = []string{SubsystemAppCallback, SubsystemWatchdog, SubsystemResourceBudget, SubsystemGrpcDebug, SubsystemFaultInjection}
+
+var profiles = map[string]struct {
+	groups     []string
+	subsystems []string
+}{
+	ProfileMinimal: {
+		groups: []string{GroupConfiguration, GroupState, GroupSecret},
+	},
+	ProfileStandard: {
+		groups:     []string{GroupConfiguration, GroupRpc, GroupPubSub, GroupState, GroupLock, GroupSequencer, GroupBinding, GroupSecret},
+		subsystems: []string{SubsystemAppCallback, SubsystemWatchdog, SubsystemResourceBudget},
+	},
+	ProfileFull: {
+		groups:     allGroups,
+		subsystems: allSubsystems,
+	},
+}
+
+// groupShared is the group of the methods served whatever the API groups are,
+// and the operations of Batch are checked by the groups of them
+const groupShared = ""
+
+// methodGroups maps the methods of the runtime service to the API groups, all of them should be listed
+var methodGroups = map[string]string{
+	"GetMetadata":                       groupShared,
+	"GetReadiness":                      groupShared,
+	"Batch":                             groupShared,
+	"SayHello":                          GroupHello,
+	"GetConfiguration":                  GroupConfiguration,
+	"SaveConfiguration":                 GroupConfiguration,
+	"DeleteConfiguration":               GroupConfiguration,
+	"SubscribeConfiguration":            GroupConfiguration,
+	"EvaluateFeatureFlag":               GroupConfiguration,
+	"SubscribeFeatureFlag":              GroupConfiguration,
+	"InvokeService":                     GroupRpc,
+	"GetPayloadSchemas":                 GroupRpc,
+	"PublishEvent":                      GroupPubSub,
+	"Flush":                             GroupPubSub,
+	"SubscribeTopicEvents":              GroupPubSub,
+	"GetState":                          GroupState,
+	"GetBulkState":                      GroupState,
+	"QueryState":                        GroupState,
+	"SaveState":                         GroupState,
+	"DeleteState":                       GroupState,
+	"DeleteBulkState":                   GroupState,
+	"ExecuteStateTransaction":           GroupState,
+	"ExecuteMultiStoreStateTransaction": GroupState,
+	"CompareAndSwap":                    GroupState,
+	"Increment":                         GroupState,
+	"Decrement":                         GroupState,
+	"DeleteStateByPrefix":               GroupState,
+	"CheckAndRecordIdempotency":         GroupState,
+	"CreateSession":                     GroupState,
+	"GetSession":                        GroupState,
+	"TouchSession":                      GroupState,
+	"RevokeSession":                     GroupState,
+	"GetFile":                           GroupFile,
+	"PutFile":                           GroupFile,
+	"PutFileWithProgress":               GroupFile,
+	"ListFile":                          GroupFile,
+	"DelFile":                           GroupFile,
+	"GetFileMeta":                       GroupFile,
+	"TagFile":                           GroupFile,
+	"RestoreFile":                       GroupFile,
+	"TryLock":                           GroupLock,
+	"Unlock":                            GroupLock,
+	"TryLockBulk":                       GroupLock,
+	"GetNextId":                         GroupSequencer,
+	"InvokeBinding":                     GroupBinding,
+	"ListBindings":                      GroupBinding,
+	"GetBindingOperations":              GroupBinding,
+	"GetSecret":                         GroupSecret,
+	"GetBulkSecret":                     GroupSecret,
+	"SubscribeSecret":                   GroupSecret,
+	"RenderTemplate":                    GroupSecret,
+}
+
+const runtimeServicePrefix = "/spec.proto.runtime.v1.Runtime/"
+
+// ProfileConfig selects the API groups and the background subsystems started by the runtime
+type ProfileConfig struct {
+	// Name is minimal, standard or full
+	Name string `json:"name"`
+	// APIGroups replaces the API groups of the profile if it's not empty
+	APIGroups []string `json:"api_groups,omitempty"`
+	// Subsystems replaces the subsystems of the profile if it's not empty
+	Subsystems []string `json:"subsystems,omitempty"`
+}
+
+// Profile is the resolved profile of the runtime
+type Profile struct {
+	name       string
+	groups     map[string]bool
+	subsystems map[string]bool
+}
+
+// NewProfile resolves the config, the full profile is used if it's nil
+func NewProfile(cfg *ProfileConfig) (*Profile, error) {
+	name := ProfileFull
+	if cfg != nil && cfg.Name != "" {
+		name = strings.ToLower(cfg.Name)
+	}
+	def, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, expected minimal, standard or full", name)
+	}
+	groups, subsystems := def.groups, def.subsystems
+	if cfg != nil && len(cfg.APIGroups) > 0 {
+		groups = cfg.APIGroups
+	}
+	if cfg != nil && len(cfg.Subsystems) > 0 {
+		subsystems = cfg.Subsystems
+	}
+	p := &Profile{name: name}
+	var err error
+	if p.groups, err = toSet(groups, allGroups, "API group"); err != nil {
+		return nil, err
+	}
+	if p.subsystems, err = toSet(subsystems, allSubsystems, "subsystem"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func toSet(names []string, valid []string, kind string) (map[string]bool, error) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		found := false
+		for _, v := range valid {
+			if v == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown %s %q, expected one of %s", kind, name, strings.Join(valid, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+func (p *Profile) Name() string {
+	return p.name
+}
+
+// GroupEnabled reports whether the API group is served
+func (p *Profile) GroupEnabled(group string) bool {
+	return p.groups[group]
+}
+
+// SubsystemEnabled reports whether the subsystem is allowed to start
+func (p *Profile) SubsystemEnabled(subsystem string) bool {
+	return p.subsystems[subsystem]
+}
+
+// methodEnabled reports whether the method of the grpc server is served
+func (p *Profile) methodEnabled(fullMethod string) bool {
+	if !strings.HasPrefix(fullMethod, runtimeServicePrefix) {
+		return true
+	}
+	group, ok := methodGroups[strings.TrimPrefix(fullMethod, runtimeServicePrefix)]
+	return !ok || group == groupShared || p.groups[group]
+}
+
+func (p *Profile) unavailable(fullMethod string) error {
+	return status.Errorf(codes.Unimplemented, "method %s is disabled by the profile %s", fullMethod, p.name)
+}
+
+// batchGroups returns the API groups of the operations in the request if it's a Batch request
+func batchGroups(req interface{}) []string {
+	batch, ok := req.(*runtimev1pb.BatchRequest)
+	if !ok {
+		return nil
+	}
+	var groups []string
+	for _, op := range batch.Operations {
+		switch op.GetRequest().(type) {
+		case *runtimev1pb.BatchOperation_GetState, *runtimev1pb.BatchOperation_SaveState, *runtimev1pb.BatchOperation_DeleteState:
+			groups = append(groups, GroupState)
+		case *runtimev1pb.BatchOperation_PublishEvent:
+			groups = append(groups, GroupPubSub)
+		case *runtimev1pb.BatchOperation_InvokeBinding:
+			groups = append(groups, GroupBinding)
+		case *runtimev1pb.BatchOperation_GetNextId:
+			groups = append(groups, GroupSequencer)
+		case *runtimev1pb.BatchOperation_GetConfiguration:
+			groups = append(groups, GroupConfiguration)
+		case *runtimev1pb.BatchOperation_GetSecret:
+			groups = append(groups, GroupSecret)
+		}
+	}
+	return groups
+}
+
+// UnaryInterceptor rejects the methods of the API groups disabled
+func (p *Profile) UnaryInterceptor(ctx context.Context, req interface{}, info *rawGRPC.UnaryServerInfo, handler rawGRPC.UnaryHandler) (interface{}, error) {
+	if !p.methodEnabled(info.FullMethod) {
+		return nil, p.unavailable(info.FullMethod)
+	}
+	for _, group := range batchGroups(req) {
+		if !p.groups[group] {
+			return nil, status.Errorf(codes.Unimplemented, "the operations of API group %s in %s are disabled by the profile %s", group, info.FullMethod, p.name)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor rejects the streaming methods of the API groups disabled
+func (p *Profile) StreamInterceptor(srv interface{}, ss rawGRPC.ServerStream, info *rawGRPC.StreamServerInfo, handler rawGRPC.StreamHandler) error {
+	if !p.methodEnabled(info.FullMethod) {
+		return p.unavailable(info.FullMethod)
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestNewProfile(t *testing.T) {
+	p, err := NewProfile(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ProfileFull, p.Name())
+	for _, g := range allGroups {
+		assert.True(t, p.GroupEnabled(g))
+	}
+	for _, s := range allSubsystems {
+		assert.True(t, p.SubsystemEnabled(s))
+	}
+
+	p, err = NewProfile(&ProfileConfig{Name: "Minimal"})
+	assert.Nil(t, err)
+	assert.Equal(t, ProfileMinimal, p.Name())
+	assert.True(t, p.GroupEnabled(GroupState))
+	assert.False(t, p.GroupEnabled(GroupPubSub))
+	assert.False(t, p.SubsystemEnabled(SubsystemAppCallback))
+
+	p, err = NewProfile(&ProfileConfig{Name: ProfileStandard, APIGroups: []string{GroupLock}, Subsystems: []string{SubsystemGrpcDebug}})
+	assert.Nil(t, err)
+	assert.True(t, p.GroupEnabled(GroupLock))
+	assert.False(t, p.GroupEnabled(GroupState))
+	assert.True(t, p.SubsystemEnabled(SubsystemGrpcDebug))
+	assert.False(t, p.SubsystemEnabled(SubsystemWatchdog))
+
+	_, err = NewProfile(&ProfileConfig{Name: "tiny"})
+	assert.NotNil(t, err)
+	_, err = NewProfile(&ProfileConfig{APIGroups: []string{"actor"}})
+	assert.NotNil(t, err)
+	_, err = NewProfile(&ProfileConfig{Subsystems: []string{"tracing"}})
+	assert.NotNil(t, err)
+}
+
+func TestProfileInterceptor(t *testing.T) {
+	p, err := NewProfile(&ProfileConfig{Name: ProfileMinimal})
+	assert.Nil(t, err)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	resp, err := p.UnaryInterceptor(context.Background(), nil, &rawGRPC.UnaryServerInfo{FullMethod: runtimeServicePrefix + "GetState"}, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", resp)
+	// the methods not in any group are always served
+	_, err = p.UnaryInterceptor(context.Background(), nil, &rawGRPC.UnaryServerInfo{FullMethod: runtimeServicePrefix + "GetMetadata"}, handler)
+	assert.Nil(t, err)
+	_, err = p.UnaryInterceptor(context.Background(), nil, &rawGRPC.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	assert.Nil(t, err)
+	// the operations of Batch are checked by their groups
+	batchInfo := &rawGRPC.UnaryServerInfo{FullMethod: runtimeServicePrefix + "Batch"}
+	_, err = p.UnaryInterceptor(context.Background(), &runtimev1pb.BatchRequest{Operations: []*runtimev1pb.BatchOperation{
+		{Request: &runtimev1pb.BatchOperation_GetState{GetState: &runtimev1pb.GetStateRequest{}}},
+		{Request: &runtimev1pb.BatchOperation_GetSecret{GetSecret: &runtimev1pb.GetSecretRequest{}}},
+	}}, batchInfo, handler)
+	assert.Nil(t, err)
+	_, err = p.UnaryInterceptor(context.Background(), &runtimev1pb.BatchRequest{Operations: []*runtimev1pb.BatchOperation{
+		{Request: &runtimev1pb.BatchOperation_GetState{GetState: &runtimev1pb.GetStateRequest{}}},
+		{Request: &runtimev1pb.BatchOperation_PublishEvent{PublishEvent: &runtimev1pb.PublishEventRequest{}}},
+	}}, batchInfo, handler)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = p.UnaryInterceptor(context.Background(), nil, &rawGRPC.UnaryServerInfo{FullMethod: runtimeServicePrefix + "TryLock"}, handler)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	streamHandler := func(srv interface{}, stream rawGRPC.ServerStream) error {
+		return nil
+	}
+	err = p.StreamInterceptor(nil, nil, &rawGRPC.StreamServerInfo{FullMethod: runtimeServicePrefix + "SubscribeConfiguration"}, streamHandler)
+	assert.Nil(t, err)
+	err = p.StreamInterceptor(nil, nil, &rawGRPC.StreamServerInfo{FullMethod: runtimeServicePrefix + "GetFile"}, streamHandler)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestMethodGroups(t *testing.T) {
+	for method, group := range methodGroups {
+		if group != groupShared {
+			assert.Contains(t, allGroups, group, method)
+		}
+	}
+	// all the methods of the runtime service are listed
+	methods := runtimev1pb.File_runtime_proto.Services().ByName("Runtime").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		_, ok := methodGroups[string(methods.Get(i).Name())]
+		assert.True(t, ok, methods.Get(i).Name())
+	}
+}
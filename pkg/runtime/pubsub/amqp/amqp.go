@@ -0,0 +1,368 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package amqp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/dapr/components-contrib/pubsub"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+const (
+	// the annotations scheduling the delivery of messages
+	serviceBusScheduledEnqueueTime = "x-opt-scheduled-enqueue-time"
+	deliveryTimeAnnotation         = "x-opt-delivery-time"
+	// the filter of Service Bus accepting the next available session if its value is nil
+	sessionFilterName = "com.microsoft:session-filter"
+	sessionFilterCode = 0x00000137000000C
+
+	reconnectInterval = 3 * time.Second
+)
+
+var ErrClosed = errors.New("amqp component is closed")
+
+// AMQP is a pubsub component speaking AMQP 1.0, e.g. Azure Service Bus, ActiveMQ Artemis and Qpid.
+// If sessions are enabled, the messages of a session are handled one by one in order,
+// and the sessions are handled concurrently up to maxConcurrentSessions.
+type AMQP struct {
+	metadata *metadata
+
+	mu         sync.Mutex
+	client     *amqp.Client
+	session    *amqp.Session
+	senders    map[string]*amqp.Sender
+	closed     bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	subscribed map[string]string
+}
+
+// NewAMQP returns a new AMQP 1.0 pubsub component
+func NewAMQP() pubsub.PubSub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AMQP{
+		senders:    make(map[string]*amqp.Sender),
+		ctx:        ctx,
+		cancel:     cancel,
+		subscribed: make(map[string]string),
+	}
+}
+
+func (a *AMQP) Init(md pubsub.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	a.metadata = m
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.connect()
+}
+
+func (a *AMQP) Features() []pubsub.Feature {
+	return nil
+}
+
+// SupportPartitionOrdering reports whether the messages of a session are delivered in order, which requires sessions
+func (a *AMQP) SupportPartitionOrdering() bool {
+	return a.metadata.sessionEnabled
+}
+
+// connect dials the broker, the caller must hold the lock
+func (a *AMQP) connect() error {
+	var opts []amqp.ConnOption
+	if a.metadata.username != "" {
+		opts = append(opts, amqp.ConnSASLPlain(a.metadata.username, a.metadata.password))
+	} else {
+		opts = append(opts, amqp.ConnSASLAnonymous())
+	}
+	client, err := amqp.Dial(a.metadata.url, opts...)
+	if err != nil {
+		return err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return err
+	}
+	a.client = client
+	a.session = session
+	a.senders = make(map[string]*amqp.Sender)
+	return nil
+}
+
+// reset drops the connection after errors, so that it's dialed again next time. The caller must hold the lock.
+func (a *AMQP) reset() {
+	if a.client != nil {
+		a.client.Close()
+	}
+	a.client = nil
+	a.session = nil
+	a.senders = make(map[string]*amqp.Sender)
+}
+
+// sender returns the sender of the topic, the caller must hold the lock
+func (a *AMQP) sender(topic string) (*amqp.Sender, error) {
+	if a.closed {
+		return nil, ErrClosed
+	}
+	if a.client == nil {
+		if err := a.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if s, ok := a.senders[topic]; ok {
+		return s, nil
+	}
+	s, err := a.session.NewSender(amqp.LinkTargetAddress(topic))
+	if err != nil {
+		return nil, err
+	}
+	a.senders[topic] = s
+	return s, nil
+}
+
+// Publish sends the message to the address of the topic.
+// The "sessionId" metadata assigns the message to a session, and the delayed-delivery metadata schedules it.
+func (a *AMQP) Publish(req *pubsub.PublishRequest) error {
+	msg, err := a.newMessage(req, time.Now())
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, err := a.sender(req.Topic)
+	if err != nil {
+		return err
+	}
+	if err := s.Send(a.ctx, msg); err != nil {
+		a.reset()
+		return err
+	}
+	return nil
+}
+
+func (a *AMQP) newMessage(req *pubsub.PublishRequest, now time.Time) (*amqp.Message, error) {
+	msg := amqp.NewMessage(req.Data)
+	msg.Properties = &amqp.MessageProperties{}
+	if sessionID := req.Metadata[sessionIDKey]; sessionID != "" {
+		msg.Properties.GroupID = sessionID
+	} else if a.metadata.sessionEnabled {
+		// the partition key of the runtime orders the messages too
+		msg.Properties.GroupID = req.Metadata[partitionKeyKey]
+	}
+	at, delayed, err := runtime_pubsub.DeliveryTime(req.Metadata, now)
+	if err != nil {
+		return nil, err
+	}
+	if delayed {
+		msg.Annotations = amqp.Annotations{}
+		if a.metadata.serviceBus {
+			msg.Annotations[serviceBusScheduledEnqueueTime] = at.UTC()
+		} else {
+			msg.Annotations[deliveryTimeAnnotation] = at.UnixNano() / int64(time.Millisecond)
+		}
+	}
+	return msg, nil
+}
+
+// Subscribe receives the messages from the address of the subscription
+func (a *AMQP) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	address := a.metadata.sourceAddress(req.Topic)
+	// fail fast if the address can't be consumed
+	receiver, err := a.newReceiver(address)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.subscribed[req.Topic] = address
+	a.mu.Unlock()
+	if !a.metadata.sessionEnabled {
+		utils.GoWithRecover(func() {
+			a.receive(req.Topic, address, receiver, handler)
+		}, nil)
+		return nil
+	}
+	utils.GoWithRecover(func() {
+		a.receiveSessions(req.Topic, address, receiver, handler)
+	}, nil)
+	for i := 1; i < a.metadata.maxConcurrentSessions; i++ {
+		utils.GoWithRecover(func() {
+			a.receiveSessions(req.Topic, address, nil, handler)
+		}, nil)
+	}
+	return nil
+}
+
+func (a *AMQP) newReceiver(address string) (*amqp.Receiver, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, ErrClosed
+	}
+	if a.client == nil {
+		if err := a.connect(); err != nil {
+			return nil, err
+		}
+	}
+	opts := []amqp.LinkOption{
+		amqp.LinkSourceAddress(address),
+		amqp.LinkCredit(a.metadata.prefetchCount),
+	}
+	if a.metadata.sessionEnabled {
+		opts = append(opts, amqp.LinkSourceFilter(sessionFilterName, sessionFilterCode, nil))
+	}
+	r, err := a.session.NewReceiver(opts...)
+	if err != nil {
+		a.reset()
+		return nil, err
+	}
+	return r, nil
+}
+
+// receive handles the messages concurrently up to the prefetch count, and receives again after errors
+func (a *AMQP) receive(topic string, address string, r *amqp.Receiver, handler pubsub.Handler) {
+	sem := make(chan struct{}, a.metadata.prefetchCount)
+	for {
+		for {
+			msg, err := r.Receive(a.ctx)
+			if err != nil {
+				if a.ctx.Err() == nil {
+					log.DefaultLogger.Errorf("[runtime] [pubsub.amqp] receive from %s error: %v", address, err)
+				}
+				break
+			}
+			sem <- struct{}{}
+			utils.GoWithRecover(func() {
+				defer func() { <-sem }()
+				a.handle(topic, msg, handler)
+			}, nil)
+		}
+		r.Close(context.Background())
+		if r = a.reopen(address); r == nil {
+			return
+		}
+	}
+}
+
+// receiveSessions locks the next available session and handles its messages in order,
+// moving on to another session once it has been idle for the timeout.
+func (a *AMQP) receiveSessions(topic string, address string, r *amqp.Receiver, handler pubsub.Handler) {
+	for {
+		if r == nil {
+			if r = a.reopen(address); r == nil {
+				return
+			}
+		}
+		for {
+			ctx, cancel := context.WithTimeout(a.ctx, a.metadata.sessionIdleTimeout)
+			msg, err := r.Receive(ctx)
+			cancel()
+			if err != nil {
+				if a.ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) {
+					log.DefaultLogger.Errorf("[runtime] [pubsub.amqp] receive session from %s error: %v", address, err)
+				}
+				break
+			}
+			a.handle(topic, msg, handler)
+		}
+		// closing the link releases the session lock
+		r.Close(context.Background())
+		r = nil
+	}
+}
+
+// reopen creates the receiver again until it succeeds, and returns nil if the component is closed
+func (a *AMQP) reopen(address string) *amqp.Receiver {
+	for {
+		select {
+		case <-a.ctx.Done():
+			return nil
+		default:
+		}
+		r, err := a.newReceiver(address)
+		if err == nil {
+			return r
+		}
+		if errors.Is(err, ErrClosed) {
+			return nil
+		}
+		log.DefaultLogger.Errorf("[runtime] [pubsub.amqp] receive from %s error: %v", address, err)
+		select {
+		case <-a.ctx.Done():
+			return nil
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+func (a *AMQP) handle(topic string, msg *amqp.Message, handler pubsub.Handler) {
+	md := map[string]string{}
+	if msg.Properties != nil && msg.Properties.GroupID != "" {
+		md[sessionIDKey] = msg.Properties.GroupID
+	}
+	err := handler(a.ctx, &pubsub.NewMessage{Data: msg.GetData(), Topic: topic, Metadata: md})
+	if err == nil {
+		if err := msg.Accept(a.ctx); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [pubsub.amqp] accept message of topic %s error: %v", topic, err)
+		}
+		return
+	}
+	log.DefaultLogger.Warnf("[runtime] [pubsub.amqp] handle message of topic %s error: %v", topic, err)
+	// the message is redelivered, and dead-lettered by the broker after the max delivery count
+	if err := msg.Modify(a.ctx, true, false, nil); err != nil {
+		log.DefaultLogger.Errorf("[runtime] [pubsub.amqp] modify message of topic %s error: %v", topic, err)
+	}
+}
+
+// DescribeSubscription returns the address of the subscription, so that it's visible in the metadata of the runtime
+func (a *AMQP) DescribeSubscription(topic string) map[string]string {
+	a.mu.Lock()
+	address, ok := a.subscribed[topic]
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return map[string]string{
+		"address":         address,
+		"session_enabled": strconv.FormatBool(a.metadata.sessionEnabled),
+		"prefetch_count":  strconv.FormatUint(uint64(a.metadata.prefetchCount), 10),
+	}
+}
+
+func (a *AMQP) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	a.cancel()
+	if a.client != nil {
+		return a.client.Close()
+	}
+	return nil
+}
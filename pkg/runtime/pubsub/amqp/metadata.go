@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package amqp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	connectionStringKey      = "connectionString"
+	urlKey                   = "url"
+	usernameKey              = "username"
+	passwordKey              = "password"
+	consumerIDKey            = "consumerID"
+	subscriptionAddressKey   = "subscriptionAddress"
+	sessionEnabledKey        = "sessionEnabled"
+	maxConcurrentSessionsKey = "maxConcurrentSessions"
+	sessionIdleTimeoutMsKey  = "sessionIdleTimeoutMs"
+	prefetchCountKey         = "prefetchCount"
+
+	// the metadata of publish requests choosing the session
+	sessionIDKey    = "sessionId"
+	partitionKeyKey = "partitionKey"
+
+	topicPlaceholder      = "{topic}"
+	consumerIDPlaceholder = "{consumerID}"
+
+	serviceBusSubscriptionAddress = "{topic}/subscriptions/{consumerID}"
+	defaultSessionIdleTimeout     = time.Minute
+)
+
+var ErrNoEndpoint = errors.New("either connectionString or url is required")
+
+type metadata struct {
+	url      string
+	username string
+	password string
+	// serviceBus is true if the broker is Azure Service Bus, which is configured by the connection string
+	serviceBus            bool
+	consumerID            string
+	subscriptionAddress   string
+	sessionEnabled        bool
+	maxConcurrentSessions int
+	sessionIdleTimeout    time.Duration
+	prefetchCount         uint32
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		url:                   props[urlKey],
+		username:              props[usernameKey],
+		password:              props[passwordKey],
+		consumerID:            props[consumerIDKey],
+		subscriptionAddress:   props[subscriptionAddressKey],
+		maxConcurrentSessions: 1,
+		sessionIdleTimeout:    defaultSessionIdleTimeout,
+		prefetchCount:         1,
+	}
+	if cs := props[connectionStringKey]; cs != "" {
+		if err := m.parseConnectionString(cs); err != nil {
+			return nil, err
+		}
+	}
+	if m.url == "" {
+		return nil, ErrNoEndpoint
+	}
+	if m.subscriptionAddress == "" {
+		m.subscriptionAddress = topicPlaceholder
+		if m.serviceBus {
+			m.subscriptionAddress = serviceBusSubscriptionAddress
+		}
+	}
+	if v := props[sessionEnabledKey]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", sessionEnabledKey, v)
+		}
+		m.sessionEnabled = b
+	}
+	if v := props[maxConcurrentSessionsKey]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid %s: %s", maxConcurrentSessionsKey, v)
+		}
+		m.maxConcurrentSessions = n
+	}
+	if v := props[sessionIdleTimeoutMsKey]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid %s: %s", sessionIdleTimeoutMsKey, v)
+		}
+		m.sessionIdleTimeout = time.Duration(n) * time.Millisecond
+	}
+	if v := props[prefetchCountKey]; v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid %s: %s", prefetchCountKey, v)
+		}
+		m.prefetchCount = uint32(n)
+	}
+	return m, nil
+}
+
+// parseConnectionString parses the connection string of Azure Service Bus, e.g.
+// Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=name;SharedAccessKey=key
+func (m *metadata) parseConnectionString(cs string) error {
+	var endpoint string
+	for _, part := range strings.Split(cs, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "Endpoint":
+			endpoint = strings.TrimSpace(kv[1])
+		case "SharedAccessKeyName":
+			m.username = strings.TrimSpace(kv[1])
+		case "SharedAccessKey":
+			m.password = strings.TrimSpace(kv[1])
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid endpoint in the connection string: %s", endpoint)
+	}
+	m.url = "amqps://" + u.Host
+	m.serviceBus = true
+	return nil
+}
+
+// sourceAddress returns the address consuming the topic
+func (m *metadata) sourceAddress(topic string) string {
+	addr := strings.Replace(m.subscriptionAddress, topicPlaceholder, topic, -1)
+	return strings.Replace(addr, consumerIDPlaceholder, m.consumerID, -1)
+}
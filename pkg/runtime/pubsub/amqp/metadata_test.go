@@ -0,0 +1,90 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package amqp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	_, err := parseMetadata(map[string]string{})
+	assert.Equal(t, ErrNoEndpoint, err)
+
+	m, err := parseMetadata(map[string]string{urlKey: "amqp://localhost:5672", consumerIDKey: "app"})
+	assert.Nil(t, err)
+	assert.False(t, m.serviceBus)
+	assert.False(t, m.sessionEnabled)
+	assert.Equal(t, uint32(1), m.prefetchCount)
+	assert.Equal(t, "topic", m.sourceAddress("topic"))
+
+	m, err = parseMetadata(map[string]string{
+		connectionStringKey:      "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=name;SharedAccessKey=key",
+		consumerIDKey:            "app",
+		sessionEnabledKey:        "true",
+		maxConcurrentSessionsKey: "4",
+		sessionIdleTimeoutMsKey:  "500",
+		prefetchCountKey:         "10",
+	})
+	assert.Nil(t, err)
+	assert.True(t, m.serviceBus)
+	assert.Equal(t, "amqps://ns.servicebus.windows.net", m.url)
+	assert.Equal(t, "name", m.username)
+	assert.Equal(t, "key", m.password)
+	assert.True(t, m.sessionEnabled)
+	assert.Equal(t, 4, m.maxConcurrentSessions)
+	assert.Equal(t, 500*time.Millisecond, m.sessionIdleTimeout)
+	assert.Equal(t, uint32(10), m.prefetchCount)
+	assert.Equal(t, "topic/subscriptions/app", m.sourceAddress("topic"))
+
+	_, err = parseMetadata(map[string]string{connectionStringKey: "SharedAccessKey=key"})
+	assert.NotNil(t, err)
+	_, err = parseMetadata(map[string]string{urlKey: "amqp://localhost:5672", maxConcurrentSessionsKey: "0"})
+	assert.NotNil(t, err)
+}
+
+func TestNewMessage(t *testing.T) {
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	a := &AMQP{metadata: &metadata{serviceBus: true, sessionEnabled: true}}
+	msg, err := a.newMessage(&pubsub.PublishRequest{
+		Data:     []byte("hello"),
+		Metadata: map[string]string{sessionIDKey: "order-1", "delay": "1m"},
+	}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "order-1", msg.Properties.GroupID)
+	assert.Equal(t, now.Add(time.Minute), msg.Annotations[serviceBusScheduledEnqueueTime])
+
+	a.metadata.serviceBus = false
+	msg, err = a.newMessage(&pubsub.PublishRequest{
+		Data:     []byte("hello"),
+		Metadata: map[string]string{partitionKeyKey: "p", "deliverAt": "2021-10-01T00:00:10Z"},
+	}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "p", msg.Properties.GroupID)
+	assert.Equal(t, now.Add(10*time.Second).UnixNano()/int64(time.Millisecond), msg.Annotations[deliveryTimeAnnotation])
+
+	// delivered immediately
+	msg, err = a.newMessage(&pubsub.PublishRequest{Data: []byte("hello")}, now)
+	assert.Nil(t, err)
+	assert.Nil(t, msg.Annotations)
+
+	_, err = a.newMessage(&pubsub.PublishRequest{Metadata: map[string]string{"delay": "soon"}}, now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/pkg/runtime/budget"
+)
+
+const (
+	defaultAsyncQueueSize     = 1024
+	defaultAsyncWorkers       = 1
+	defaultAsyncMaxRetries    = 3
+	defaultAsyncRetryInterval = 100 * time.Millisecond
+	closeFlushTimeout         = 5 * time.Second
+)
+
+var (
+	// ErrAsyncQueueFull is returned by PublishAsync when there is no room for the event.
+	ErrAsyncQueueFull = errors.New("async publish queue is full")
+	// ErrAsyncPublisherClosed is returned by PublishAsync after the component is closed.
+	ErrAsyncPublisherClosed = errors.New("async publisher is closed")
+)
+
+// AsyncConfig is the config of async publishing.
+type AsyncConfig struct {
+	// QueueSize is the capacity of the local queue.
+	QueueSize int `json:"queue_size"`
+	// Workers is the number of goroutines publishing the events in the queue.
+	// Events may be published out of order if it's greater than 1.
+	Workers int `json:"workers"`
+	// MaxRetries is how many times an event is retried before it's dropped. The default value is 3.
+	MaxRetries int `json:"max_retries"`
+	// RetryIntervalMs is the interval between two retries, which doubles after each retry.
+	RetryIntervalMs int `json:"retry_interval_ms"`
+}
+
+// AsyncPublisher is implemented by the components which can publish events in background.
+// The events are buffered in memory only, so this mode isn't durable:
+// the events accepted but not published yet are lost if the process crashes.
+type AsyncPublisher interface {
+	// PublishAsync returns once the event is put into the local queue.
+	// The caller identifies who publishes the event, so that its failures are reported to itself only.
+	PublishAsync(caller string, req *pubsub.PublishRequest) error
+	// Flush waits until all the events enqueued before it's called are published or dropped,
+	// and returns the number of events of the caller dropped since its last flush.
+	Flush(ctx context.Context, caller string) (failed int64, err error)
+}
+
+// asyncEvent is an event in the queue
+type asyncEvent struct {
+	req    *pubsub.PublishRequest
+	caller string
+	seq    int64
+}
+
+// flushWaiter waits until the events up to seq are done
+type flushWaiter struct {
+	seq int64
+	ch  chan struct{}
+}
+
+// AsyncPubSub wraps a pubsub component to support async publishing.
+// The events are kept in memory, so they will be lost if the process crashes before they are published.
+type AsyncPubSub struct {
+	pubsub.PubSub
+	queue         chan *asyncEvent
+	maxRetries    int
+	retryInterval time.Duration
+
+	mu     sync.Mutex
+	closed bool
+	// enqueued is the sequence of the last event enqueued
+	enqueued int64
+	// doneUpTo is the sequence below which all the events are done,
+	// and done are the ones done ahead of it, which happens if there are several workers
+	doneUpTo int64
+	done     map[int64]struct{}
+	// failed is the number of events dropped of each caller since its last flush
+	failed map[string]int64
+	// bytes is the size of the events in the queue, which is accounted by the resource budget
+	bytes   int64
+	waiters []flushWaiter
+	stopCh  chan struct{}
+}
+
+// NewAsyncPubSub wraps the component and starts the workers.
+func NewAsyncPubSub(comp pubsub.PubSub, config *AsyncConfig) *AsyncPubSub {
+	if config == nil {
+		config = &AsyncConfig{}
+	}
+	size := config.QueueSize
+	if size <= 0 {
+		size = defaultAsyncQueueSize
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+	maxRetries := config.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultAsyncMaxRetries
+	}
+	interval := time.Duration(config.RetryIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultAsyncRetryInterval
+	}
+	a := &AsyncPubSub{
+		PubSub:        comp,
+		queue:         make(chan *asyncEvent, size),
+		maxRetries:    maxRetries,
+		retryInterval: interval,
+		done:          make(map[int64]struct{}),
+		failed:        make(map[string]int64),
+		stopCh:        make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		utils.GoWithRecover(a.work, nil)
+	}
+	return a
+}
+
+// PublishAsync puts the event into the local queue, and returns ErrAsyncQueueFull if there is no room.
+// budget.ErrMemoryBudgetExceeded is returned if the memory budget of the runtime is exceeded.
+func (a *AsyncPubSub) PublishAsync(caller string, req *pubsub.PublishRequest) error {
+	size := int64(len(req.Data))
+	if !budget.Allow(size) {
+		return budget.ErrMemoryBudgetExceeded
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrAsyncPublisherClosed
+	}
+	select {
+	case a.queue <- &asyncEvent{req: req, caller: caller, seq: a.enqueued + 1}:
+		a.enqueued++
+		a.bytes += size
+		return nil
+	default:
+		return ErrAsyncQueueFull
+	}
+}
+
+// Flush waits until the events enqueued before are done or the context is done.
+// The events enqueued after it's called are not waited for, so it returns even if the publishing continues.
+func (a *AsyncPubSub) Flush(ctx context.Context, caller string) (int64, error) {
+	a.mu.Lock()
+	if a.doneUpTo >= a.enqueued {
+		failed := a.takeFailed(caller)
+		a.mu.Unlock()
+		return failed, nil
+	}
+	ch := make(chan struct{})
+	a.waiters = append(a.waiters, flushWaiter{seq: a.enqueued, ch: ch})
+	a.mu.Unlock()
+
+	select {
+	case <-ch:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.takeFailed(caller), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// takeFailed returns and resets the failures of the caller, it's called with the lock held
+func (a *AsyncPubSub) takeFailed(caller string) int64 {
+	failed := a.failed[caller]
+	delete(a.failed, caller)
+	return failed
+}
+
+// MemoryUsage implements budget.Consumer.
+// The events in the queue are never dropped to shrink the memory, new events are rejected instead.
+func (a *AsyncPubSub) MemoryUsage() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.bytes
+}
+
+// Close stops accepting new events, waits a while for the queue to be drained and then closes the component.
+func (a *AsyncPubSub) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+	defer cancel()
+	if _, err := a.Flush(ctx, ""); err != nil {
+		log.DefaultLogger.Errorf("[runtime] [pubsub.AsyncPubSub] events are dropped when closing: %v", err)
+	}
+	close(a.stopCh)
+	return a.PubSub.Close()
+}
+
+func (a *AsyncPubSub) work() {
+	for {
+		select {
+		case e := <-a.queue:
+			a.finish(e, a.publish(e.req))
+		case <-a.stopCh:
+			return
+		}
+	}
+}
+
+func (a *AsyncPubSub) publish(req *pubsub.PublishRequest) (err error) {
+	interval := a.retryInterval
+	for i := 0; ; i++ {
+		if err = a.PubSub.Publish(req); err == nil {
+			return nil
+		}
+		if i >= a.maxRetries {
+			log.DefaultLogger.Errorf("[runtime] [pubsub.AsyncPubSub] drop the event to topic %s of pubsub %s after %d retries: %v",
+				req.Topic, req.PubsubName, i, err)
+			return err
+		}
+		select {
+		case <-time.After(interval):
+		case <-a.stopCh:
+			return err
+		}
+		interval *= 2
+	}
+}
+
+// finish marks the event done, and wakes up the flushes waiting for the events up to it
+func (a *AsyncPubSub) finish(e *asyncEvent, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.failed[e.caller]++
+	}
+	a.bytes -= int64(len(e.req.Data))
+	a.done[e.seq] = struct{}{}
+	for {
+		if _, ok := a.done[a.doneUpTo+1]; !ok {
+			break
+		}
+		delete(a.done, a.doneUpTo+1)
+		a.doneUpTo++
+	}
+	waiting := a.waiters[:0]
+	for _, w := range a.waiters {
+		if w.seq <= a.doneUpTo {
+			close(w.ch)
+			continue
+		}
+		waiting = append(waiting, w)
+	}
+	a.waiters = waiting
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+	"mosn.io/layotto/pkg/runtime/budget"
+)
+
+func TestAsyncPubSub(t *testing.T) {
+	t.Run("publish and flush", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		comp.EXPECT().Publish(gomock.Any()).Return(nil).Times(3)
+		comp.EXPECT().Close().Return(nil)
+		a := NewAsyncPubSub(comp, nil)
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, a.PublishAsync("app", &pubsub.PublishRequest{PubsubName: "mock", Topic: "topic"}))
+		}
+		failed, err := a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), failed)
+
+		assert.Nil(t, a.Close())
+		assert.Equal(t, ErrAsyncPublisherClosed, a.PublishAsync("app", &pubsub.PublishRequest{}))
+	})
+
+	t.Run("drop after retries", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		comp.EXPECT().Publish(gomock.Any()).Return(errors.New("net error")).Times(3)
+		a := NewAsyncPubSub(comp, &AsyncConfig{MaxRetries: 2, RetryIntervalMs: 1})
+		assert.Nil(t, a.PublishAsync("app", &pubsub.PublishRequest{PubsubName: "mock", Topic: "topic"}))
+		failed, err := a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), failed)
+		// the counter is reset
+		failed, err = a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), failed)
+	})
+
+	t.Run("failures of each caller", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			if req.Topic == "bad" {
+				return errors.New("net error")
+			}
+			return nil
+		}).AnyTimes()
+		a := NewAsyncPubSub(comp, &AsyncConfig{MaxRetries: 1, RetryIntervalMs: 1})
+		assert.Nil(t, a.PublishAsync("app1", &pubsub.PublishRequest{Topic: "bad"}))
+		assert.Nil(t, a.PublishAsync("app2", &pubsub.PublishRequest{Topic: "good"}))
+		failed, err := a.Flush(context.Background(), "app2")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), failed)
+		// the flush of app2 doesn't take the failures of app1
+		failed, err = a.Flush(context.Background(), "app1")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), failed)
+	})
+
+	t.Run("flush up to the snapshot", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		blocks := map[string]chan struct{}{"first": make(chan struct{}), "second": make(chan struct{})}
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			<-blocks[req.Topic]
+			return nil
+		}).AnyTimes()
+		a := NewAsyncPubSub(comp, &AsyncConfig{Workers: 2})
+		assert.Nil(t, a.PublishAsync("app", &pubsub.PublishRequest{Topic: "first"}))
+		flushed := make(chan error)
+		go func() {
+			_, err := a.Flush(context.Background(), "app")
+			flushed <- err
+		}()
+		// the flush doesn't wait for the events enqueued after it
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, a.PublishAsync("app", &pubsub.PublishRequest{Topic: "second"}))
+		close(blocks["first"])
+		select {
+		case err := <-flushed:
+			assert.Nil(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("the flush waits for the events enqueued after it")
+		}
+		close(blocks["second"])
+		_, err := a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+	})
+
+	t.Run("queue is full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		block := make(chan struct{})
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			<-block
+			return nil
+		}).AnyTimes()
+		a := NewAsyncPubSub(comp, &AsyncConfig{QueueSize: 1})
+		var err error
+		for i := 0; i < 3 && err == nil; i++ {
+			err = a.PublishAsync("app", &pubsub.PublishRequest{})
+		}
+		assert.Equal(t, ErrAsyncQueueFull, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = a.Flush(ctx, "app")
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		close(block)
+		_, err = a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+	})
+
+	t.Run("memory budget", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		block := make(chan struct{})
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			<-block
+			return nil
+		}).AnyTimes()
+		a := NewAsyncPubSub(comp, nil)
+		budget.Register("async_test", a)
+		budget.Init(&budget.Config{MaxMemoryBytes: 10, CheckIntervalMs: 3600000})
+		defer func() {
+			budget.Unregister("async_test")
+			budget.Init(nil)
+		}()
+
+		assert.Nil(t, a.PublishAsync("app", &pubsub.PublishRequest{Data: make([]byte, 6)}))
+		assert.Equal(t, int64(6), a.MemoryUsage())
+		assert.Equal(t, budget.ErrMemoryBudgetExceeded, a.PublishAsync("app", &pubsub.PublishRequest{Data: make([]byte, 6)}))
+
+		close(block)
+		_, err := a.Flush(context.Background(), "app")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), a.MemoryUsage())
+	})
+}
@@ -19,4 +19,12 @@ package pubsub
 // Config wraps configuration for a pubsub implementation
 type Config struct {
 	Metadata map[string]string `json:"metadata"`
+	// Async enables async publishing for this component if it's not nil
+	Async *AsyncConfig `json:"async,omitempty"`
+	// Priority enables the priority metadata of events if it's not nil
+	Priority *PriorityConfig `json:"priority,omitempty"`
+	// Transform transforms the data of the events published and delivered if it's not nil
+	Transform *TransformConfig `json:"transform,omitempty"`
+	// DeadLetter republishes the events failing to be delivered to a dead-letter topic if it's not nil
+	DeadLetter *DeadLetterConfig `json:"dead_letter,omitempty"`
 }
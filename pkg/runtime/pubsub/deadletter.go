@@ -0,0 +1,188 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	jsoniter "github.com/json-iterator/go"
+	"mosn.io/pkg/log"
+)
+
+// The failure metadata of dead-lettered events.
+// They're set in the metadata of the publish requests and as the extension attributes of the cloud events,
+// so they're lowercase alphanumeric as the cloud events spec requires.
+const (
+	DeadLetterTopicKey    = "deadlettertopic"
+	DeadLetterErrorKey    = "deadlettererror"
+	DeadLetterAttemptsKey = "deadletterattempts"
+	DeadLetterTimeKey     = "deadlettertime"
+)
+
+const (
+	// DeadLetterTopicPlaceholder in the dead-letter topic is replaced by the topic of the event
+	DeadLetterTopicPlaceholder = "{topic}"
+
+	defaultDeadLetterTopic         = DeadLetterTopicPlaceholder + "-deadletter"
+	defaultDeadLetterMaxAttempts   = 3
+	defaultDeadLetterRetryInterval = time.Second
+)
+
+// DeadLetterConfig is the config of dead-lettering the events which fail to be delivered.
+// An event is retried in place, and republished to the dead-letter topic after MaxAttempts deliveries fail,
+// e.g. the app callback is unavailable or returns RETRY.
+type DeadLetterConfig struct {
+	// Topic is the dead-letter topic, in which "{topic}" is replaced by the topic of the event. It's "{topic}-deadletter" by default
+	Topic string `json:"topic"`
+	// MaxAttempts is the number of deliveries before the event is dead-lettered, 3 by default
+	MaxAttempts int `json:"max_attempts"`
+	// RetryIntervalMs is the interval between deliveries, 1000 by default
+	RetryIntervalMs int `json:"retry_interval_ms"`
+}
+
+// DeadLetterPubSub wraps a pubsub component to republish the events failing to be delivered to the dead-letter topic
+type DeadLetterPubSub struct {
+	pubsub.PubSub
+	topic         string
+	maxAttempts   int
+	retryInterval time.Duration
+}
+
+// NewDeadLetterPubSub wraps the component
+func NewDeadLetterPubSub(comp pubsub.PubSub, config *DeadLetterConfig) (*DeadLetterPubSub, error) {
+	d := &DeadLetterPubSub{
+		PubSub:        comp,
+		topic:         config.Topic,
+		maxAttempts:   config.MaxAttempts,
+		retryInterval: time.Duration(config.RetryIntervalMs) * time.Millisecond,
+	}
+	if d.topic == "" {
+		d.topic = defaultDeadLetterTopic
+	}
+	if d.topic == DeadLetterTopicPlaceholder {
+		return nil, fmt.Errorf("the dead-letter topic %s is the same as the topic of the events", d.topic)
+	}
+	if d.maxAttempts < 0 || config.RetryIntervalMs < 0 {
+		return nil, fmt.Errorf("invalid dead-letter retries: max_attempts %d, retry_interval_ms %d", d.maxAttempts, config.RetryIntervalMs)
+	}
+	if d.maxAttempts == 0 {
+		d.maxAttempts = defaultDeadLetterMaxAttempts
+	}
+	if config.RetryIntervalMs == 0 {
+		d.retryInterval = defaultDeadLetterRetryInterval
+	}
+	return d, nil
+}
+
+// Subscribe retries the events which fail to be handled, and dead-letters them at last.
+// The events are acked once they're dead-lettered, and redelivered by the broker if the dead-lettering fails.
+func (d *DeadLetterPubSub) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	deadLetterTopic := d.deadLetterTopic(req.Topic)
+	if deadLetterTopic == req.Topic {
+		return fmt.Errorf("the dead-letter topic of topic %s is itself", req.Topic)
+	}
+	return d.PubSub.Subscribe(req, func(ctx context.Context, msg *pubsub.NewMessage) error {
+		var err error
+		for attempt := 1; ; attempt++ {
+			if err = handler(ctx, msg); err == nil {
+				return nil
+			}
+			if attempt >= d.maxAttempts {
+				break
+			}
+			select {
+			case <-time.After(d.retryInterval):
+			case <-ctx.Done():
+				// the runtime is closing, so the broker redelivers it later
+				return err
+			}
+		}
+		if dlErr := d.deadLetter(deadLetterTopic, req.Topic, msg, err); dlErr != nil {
+			log.DefaultLogger.Errorf("[runtime] [pubsub.deadletter] dead-letter the event of topic %s to %s failed: %v", req.Topic, deadLetterTopic, dlErr)
+			return err
+		}
+		log.DefaultLogger.Warnf("[runtime] [pubsub.deadletter] the event of topic %s is dead-lettered to %s after %d attempts: %v", req.Topic, deadLetterTopic, d.maxAttempts, err)
+		return nil
+	})
+}
+
+func (d *DeadLetterPubSub) deadLetterTopic(topic string) string {
+	return strings.ReplaceAll(d.topic, DeadLetterTopicPlaceholder, topic)
+}
+
+// deadLetter republishes the event as it is received, with the failure metadata attached
+func (d *DeadLetterPubSub) deadLetter(deadLetterTopic string, topic string, msg *pubsub.NewMessage, cause error) error {
+	failure := map[string]string{
+		DeadLetterTopicKey:    topic,
+		DeadLetterErrorKey:    cause.Error(),
+		DeadLetterAttemptsKey: strconv.Itoa(d.maxAttempts),
+		DeadLetterTimeKey:     time.Now().UTC().Format(time.RFC3339),
+	}
+	return d.PubSub.Publish(&pubsub.PublishRequest{
+		Data:     withExtensions(msg.Data, failure),
+		Topic:    deadLetterTopic,
+		Metadata: failure,
+	})
+}
+
+// withExtensions sets the extension attributes of the cloud event.
+// The data is kept as it is if it isn't a cloud event, e.g. the raw payload.
+func withExtensions(data []byte, extensions map[string]string) []byte {
+	if IsProtoCloudEvent(data) {
+		ce, err := UnmarshalProtoCloudEvent(data)
+		if err != nil {
+			return data
+		}
+		if ce.Extensions == nil {
+			ce.Extensions = make(map[string]string, len(extensions))
+		}
+		for k, v := range extensions {
+			ce.Extensions[k] = v
+		}
+		return MarshalProtoCloudEvent(ce, nil, nil)
+	}
+	var fields map[string]jsoniter.RawMessage
+	if err := jsoniter.ConfigFastest.Unmarshal(data, &fields); err != nil || fields[pubsub.SpecVersionField] == nil {
+		return data
+	}
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+	stream.WriteObjectStart()
+	for k, v := range fields {
+		if _, ok := extensions[k]; ok {
+			continue
+		}
+		stream.WriteObjectField(k)
+		stream.Write(v)
+		stream.WriteMore()
+	}
+	first := true
+	for k, v := range extensions {
+		if !first {
+			stream.WriteMore()
+		}
+		first = false
+		writeStringField(stream, k, v)
+	}
+	stream.WriteObjectEnd()
+	return copyBuffer(stream)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+)
+
+func TestDeadLetterPubSub(t *testing.T) {
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewDeadLetterPubSub(nil, &DeadLetterConfig{Topic: DeadLetterTopicPlaceholder})
+		assert.NotNil(t, err)
+		_, err = NewDeadLetterPubSub(nil, &DeadLetterConfig{MaxAttempts: -1})
+		assert.NotNil(t, err)
+	})
+
+	ctrl := gomock.NewController(t)
+	comp := mock_pubsub.NewMockPubSub(ctrl)
+	d, err := NewDeadLetterPubSub(comp, &DeadLetterConfig{MaxAttempts: 2, RetryIntervalMs: 1})
+	assert.Nil(t, err)
+	var handler pubsub.Handler
+	comp.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req pubsub.SubscribeRequest, h pubsub.Handler) error {
+		handler = h
+		return nil
+	})
+	attempts := 0
+	var failure error
+	assert.Nil(t, d.Subscribe(pubsub.SubscribeRequest{Topic: "topic"}, func(ctx context.Context, msg *pubsub.NewMessage) error {
+		attempts++
+		return failure
+	}))
+	data := []byte(`{"id":"1","specversion":"1.0","topic":"topic","data":{"a":1}}`)
+
+	t.Run("delivered", func(t *testing.T) {
+		attempts, failure = 0, nil
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "topic", Data: data}))
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("dead-lettered", func(t *testing.T) {
+		attempts, failure = 0, errors.New("retry required")
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			assert.Equal(t, "topic-deadletter", req.Topic)
+			assert.Equal(t, "topic", req.Metadata[DeadLetterTopicKey])
+			assert.Equal(t, "2", req.Metadata[DeadLetterAttemptsKey])
+			var ce map[string]interface{}
+			assert.Nil(t, json.Unmarshal(req.Data, &ce))
+			assert.Equal(t, "1", ce[pubsub.IDField])
+			assert.Equal(t, map[string]interface{}{"a": float64(1)}, ce[pubsub.DataField])
+			assert.Equal(t, "retry required", ce[DeadLetterErrorKey])
+			assert.Equal(t, "2", ce[DeadLetterAttemptsKey])
+			return nil
+		})
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "topic", Data: data}))
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("dead-lettering failed", func(t *testing.T) {
+		attempts, failure = 0, errors.New("retry required")
+		comp.EXPECT().Publish(gomock.Any()).Return(errors.New("broker unavailable"))
+		assert.Equal(t, failure, handler(context.Background(), &pubsub.NewMessage{Topic: "topic", Data: data}))
+	})
+
+	t.Run("raw payload", func(t *testing.T) {
+		attempts, failure = 0, errors.New("retry required")
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			assert.Equal(t, "raw", string(req.Data))
+			assert.Equal(t, "retry required", req.Metadata[DeadLetterErrorKey])
+			return nil
+		})
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "topic", Data: []byte("raw")}))
+	})
+}
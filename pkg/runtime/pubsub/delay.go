@@ -0,0 +1,49 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DelayMetadataKey delays the delivery of the event by a duration, e.g. "30s"
+	DelayMetadataKey = "delay"
+	// DeliverAtMetadataKey schedules the delivery of the event at a time in RFC3339 format
+	DeliverAtMetadataKey = "deliverAt"
+)
+
+// DeliveryTime returns the scheduled delivery time in the metadata of a publish request.
+// It returns false if the event should be delivered immediately.
+func DeliveryTime(metadata map[string]string, now time.Time) (time.Time, bool, error) {
+	if v := metadata[DeliverAtMetadataKey]; v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s metadata %q: %v", DeliverAtMetadataKey, v, err)
+		}
+		return t, t.After(now), nil
+	}
+	if v := metadata[DelayMetadataKey]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return time.Time{}, false, fmt.Errorf("invalid %s metadata %q", DelayMetadataKey, v)
+		}
+		return now.Add(d), d > 0, nil
+	}
+	return time.Time{}, false, nil
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryTime(t *testing.T) {
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	_, delayed, err := DeliveryTime(nil, now)
+	assert.Nil(t, err)
+	assert.False(t, delayed)
+
+	at, delayed, err := DeliveryTime(map[string]string{DelayMetadataKey: "30s"}, now)
+	assert.Nil(t, err)
+	assert.True(t, delayed)
+	assert.Equal(t, now.Add(30*time.Second), at)
+
+	// deliverAt takes precedence over delay
+	at, delayed, err = DeliveryTime(map[string]string{DelayMetadataKey: "30s", DeliverAtMetadataKey: "2021-10-01T01:00:00Z"}, now)
+	assert.Nil(t, err)
+	assert.True(t, delayed)
+	assert.Equal(t, now.Add(time.Hour), at)
+
+	// the past is delivered immediately
+	_, delayed, err = DeliveryTime(map[string]string{DeliverAtMetadataKey: "2021-09-01T00:00:00Z"}, now)
+	assert.Nil(t, err)
+	assert.False(t, delayed)
+
+	_, _, err = DeliveryTime(map[string]string{DelayMetadataKey: "-1s"}, now)
+	assert.NotNil(t, err)
+	_, _, err = DeliveryTime(map[string]string{DeliverAtMetadataKey: "tomorrow"}, now)
+	assert.NotNil(t, err)
+}
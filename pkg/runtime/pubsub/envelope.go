@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/contenttype"
+	"github.com/dapr/components-contrib/pubsub"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const ttlMetadataKey = "ttlInSeconds"
+
+// CloudEvent is the envelope of an event.
+// It's serialized by MarshalCloudEvent into the same json as the map created by pubsub.NewCloudEventsEnvelope,
+// or by MarshalProtoCloudEvent in protobuf format.
+type CloudEvent struct {
+	ID              string
+	SpecVersion     string
+	Source          string
+	Type            string
+	Subject         string
+	Topic           string
+	PubsubName      string
+	DataContentType string
+	Data            []byte
+	TraceID         string
+	Expiration      string
+	// Extensions are the other attributes
+	Extensions map[string]string
+}
+
+// MarshalCloudEvent serializes the envelope.
+// The expiration is set if the metadata contains a ttl which isn't supported by the component natively.
+// Instead of building a map, the fields are written to a pooled stream directly,
+// and json data is written as it is without being decoded.
+func MarshalCloudEvent(ce *CloudEvent, features []pubsub.Feature, metadata map[string]string) []byte {
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+
+	dataContentType := ce.DataContentType
+	if dataContentType == "" {
+		dataContentType = pubsub.DefaultCloudEventDataContentType
+	}
+	specVersion := ce.SpecVersion
+	if specVersion == "" {
+		specVersion = pubsub.CloudEventsSpecVersion
+	}
+	stream.WriteObjectStart()
+	writeStringField(stream, pubsub.IDField, ce.ID)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.SpecVersionField, specVersion)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.DataContentTypeField, dataContentType)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.SourceField, ce.Source)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.TypeField, ce.Type)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.TopicField, ce.Topic)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.PubsubField, ce.PubsubName)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.TraceIDField, ce.TraceID)
+	if ce.Subject != "" {
+		stream.WriteMore()
+		writeStringField(stream, pubsub.SubjectField, ce.Subject)
+	}
+	expiration := ce.Expiration
+	if e, ok := expirationOf(features, metadata); ok {
+		expiration = e
+	}
+	if expiration != "" {
+		stream.WriteMore()
+		writeStringField(stream, pubsub.ExpirationField, expiration)
+	}
+	for k, v := range ce.Extensions {
+		stream.WriteMore()
+		writeStringField(stream, k, v)
+	}
+	stream.WriteMore()
+	switch {
+	case contenttype.IsJSONContentType(dataContentType) && jsoniter.Valid(ce.Data):
+		stream.WriteObjectField(pubsub.DataField)
+		stream.Write(ce.Data)
+	case isBinaryContentType(dataContentType):
+		stream.WriteObjectField(pubsub.DataBase64Field)
+		stream.WriteString(base64.StdEncoding.EncodeToString(ce.Data))
+	default:
+		stream.WriteObjectField(pubsub.DataField)
+		stream.WriteString(string(ce.Data))
+	}
+	stream.WriteObjectEnd()
+	return copyBuffer(stream)
+}
+
+// PatchCloudEvent sets the topic, pubsub name and trace id of an event which is already a cloud event,
+// as well as the expiration like MarshalCloudEvent.
+// Only the top level fields are decoded, so the data is kept as it is.
+func PatchCloudEvent(data []byte, topic string, pubsubName string, traceID string, features []pubsub.Feature, metadata map[string]string) ([]byte, error) {
+	var fields map[string]jsoniter.RawMessage
+	if err := jsoniter.ConfigFastest.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, pubsub.TopicField)
+	delete(fields, pubsub.PubsubField)
+	delete(fields, pubsub.TraceIDField)
+	expiration, hasExpiration := expirationOf(features, metadata)
+	if hasExpiration {
+		delete(fields, pubsub.ExpirationField)
+	}
+
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+	stream.WriteObjectStart()
+	for k, v := range fields {
+		stream.WriteObjectField(k)
+		stream.Write(v)
+		stream.WriteMore()
+	}
+	writeStringField(stream, pubsub.TopicField, topic)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.PubsubField, pubsubName)
+	stream.WriteMore()
+	writeStringField(stream, pubsub.TraceIDField, traceID)
+	if hasExpiration {
+		stream.WriteMore()
+		writeStringField(stream, pubsub.ExpirationField, expiration)
+	}
+	stream.WriteObjectEnd()
+	return copyBuffer(stream), nil
+}
+
+func writeStringField(stream *jsoniter.Stream, field string, value string) {
+	stream.WriteObjectField(field)
+	stream.WriteString(value)
+}
+
+// copyBuffer copies the result out of the stream, because the buffer will be reused after the stream is returned
+func copyBuffer(stream *jsoniter.Stream) []byte {
+	b := make([]byte, len(stream.Buffer()))
+	copy(b, stream.Buffer())
+	return b
+}
+
+// expirationOf returns the expiration if the ttl in metadata should be handled by the runtime
+func expirationOf(features []pubsub.Feature, metadata map[string]string) (string, bool) {
+	val, ok := metadata[ttlMetadataKey]
+	if !ok || val == "" || pubsub.FeatureMessageTTL.IsPresent(features) {
+		return "", false
+	}
+	seconds, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || seconds <= 0 {
+		return "", false
+	}
+	return time.Now().UTC().Add(time.Duration(seconds) * time.Second).Format(time.RFC3339), true
+}
+
+func isBinaryContentType(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "application/octet-stream")
+}
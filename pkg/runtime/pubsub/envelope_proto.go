@@ -0,0 +1,396 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// CloudEventProtobufContentType is the content type of a cloud event in protobuf format.
+// See https://github.com/cloudevents/spec/blob/v1.0.1/protobuf-format.md
+const CloudEventProtobufContentType = "application/cloudevents+protobuf"
+
+// field numbers of io.cloudevents.v1.CloudEvent
+const (
+	ceIDNumber         protowire.Number = 1
+	ceSourceNumber     protowire.Number = 2
+	ceSpecVersion      protowire.Number = 3
+	ceTypeNumber       protowire.Number = 4
+	ceAttributesNumber protowire.Number = 5
+	ceBinaryDataNumber protowire.Number = 6
+	ceTextDataNumber   protowire.Number = 7
+	ceProtoDataNumber  protowire.Number = 8
+)
+
+// field numbers of io.cloudevents.v1.CloudEvent.CloudEventAttributeValue
+const (
+	attrBooleanNumber   protowire.Number = 1
+	attrIntegerNumber   protowire.Number = 2
+	attrStringNumber    protowire.Number = 3
+	attrBytesNumber     protowire.Number = 4
+	attrURINumber       protowire.Number = 5
+	attrURIRefNumber    protowire.Number = 6
+	attrTimestampNumber protowire.Number = 7
+)
+
+var errMalformedProtoCloudEvent = errors.New("malformed cloud event in protobuf format")
+
+// reservedAttributes are the attributes which are fields of the envelope, so they can't be extensions
+var reservedAttributes = map[string]struct{}{
+	pubsub.IDField:          {},
+	pubsub.SourceField:      {},
+	pubsub.SpecVersionField: {},
+	pubsub.TypeField:        {},
+	pubsub.DataField:        {},
+	pubsub.DataBase64Field:  {},
+}
+
+// ValidateExtensionName checks the name of an extension attribute.
+// It should consist of lowercase letters and digits as the cloud events spec requires, and not be a reserved attribute.
+func ValidateExtensionName(name string) error {
+	if name == "" {
+		return errors.New("the name of the extension attribute is empty")
+	}
+	if _, ok := reservedAttributes[name]; ok {
+		return fmt.Errorf("the extension attribute %s is reserved", name)
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return fmt.Errorf("the name of the extension attribute %s should consist of lowercase letters and digits", name)
+		}
+	}
+	return nil
+}
+
+// IsProtobufContentType reports whether the data is a protobuf message.
+// The envelopes of such events are serialized in protobuf format, so the data is kept as it is instead of being base64 encoded.
+func IsProtobufContentType(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	return strings.HasPrefix(ct, "application/protobuf") ||
+		strings.HasPrefix(ct, "application/x-protobuf") ||
+		strings.HasPrefix(ct, "application/grpc")
+}
+
+// IsProtoCloudEventContentType reports whether the data is already a cloud event in protobuf format.
+func IsProtoCloudEventContentType(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), CloudEventProtobufContentType)
+}
+
+// IsProtoCloudEvent reports whether the message received from the pubsub component is in protobuf format.
+// The brokers don't always keep the content type of the messages, so the payload has to be a well-formed
+// io.cloudevents.v1.CloudEvent with the required attributes, of which the spec version is the marker.
+// Other payloads, e.g. the raw ones not starting with '{', are not taken as protobuf.
+func IsProtoCloudEvent(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	ce, err := UnmarshalProtoCloudEvent(b)
+	if err != nil {
+		return false
+	}
+	return hasRequiredAttributes(ce)
+}
+
+// hasRequiredAttributes reports whether the event has the attributes which the cloud events spec requires
+func hasRequiredAttributes(ce *CloudEvent) bool {
+	for _, v := range []string{ce.ID, ce.Source, ce.Type} {
+		if v == "" || !utf8.ValidString(v) {
+			return false
+		}
+	}
+	return strings.HasPrefix(ce.SpecVersion, "1.")
+}
+
+// MarshalProtoCloudEvent serializes the envelope in protobuf format.
+// The expiration is set like MarshalCloudEvent.
+func MarshalProtoCloudEvent(ce *CloudEvent, features []pubsub.Feature, metadata map[string]string) []byte {
+	specVersion := ce.SpecVersion
+	if specVersion == "" {
+		specVersion = pubsub.CloudEventsSpecVersion
+	}
+	b := make([]byte, 0, len(ce.Data)+128)
+	b = appendString(b, ceIDNumber, ce.ID)
+	b = appendString(b, ceSourceNumber, ce.Source)
+	b = appendString(b, ceSpecVersion, specVersion)
+	b = appendString(b, ceTypeNumber, ce.Type)
+	b = appendAttribute(b, pubsub.DataContentTypeField, ce.DataContentType)
+	b = appendAttribute(b, pubsub.SubjectField, ce.Subject)
+	b = appendAttribute(b, pubsub.TopicField, ce.Topic)
+	b = appendAttribute(b, pubsub.PubsubField, ce.PubsubName)
+	b = appendAttribute(b, pubsub.TraceIDField, ce.TraceID)
+	expiration := ce.Expiration
+	if e, ok := expirationOf(features, metadata); ok {
+		expiration = e
+	}
+	b = appendAttribute(b, pubsub.ExpirationField, expiration)
+	for k, v := range ce.Extensions {
+		b = appendAttribute(b, k, v)
+	}
+	b = protowire.AppendTag(b, ceBinaryDataNumber, protowire.BytesType)
+	b = protowire.AppendBytes(b, ce.Data)
+	return b
+}
+
+// PatchProtoCloudEvent sets the topic, pubsub name, trace id and expiration of an event which is already a cloud event in protobuf format.
+// The event should have the required attributes, otherwise the subscribers can't tell it's in protobuf format.
+func PatchProtoCloudEvent(data []byte, topic string, pubsubName string, traceID string, features []pubsub.Feature, metadata map[string]string) ([]byte, error) {
+	ce, err := UnmarshalProtoCloudEvent(data)
+	if err != nil {
+		return nil, err
+	}
+	if !hasRequiredAttributes(ce) {
+		return nil, errors.New("the cloud event in protobuf format should have id, source, specversion 1.x and type")
+	}
+	ce.Topic = topic
+	ce.PubsubName = pubsubName
+	ce.TraceID = traceID
+	return MarshalProtoCloudEvent(ce, features, metadata), nil
+}
+
+// UnmarshalProtoCloudEvent parses a cloud event in protobuf format.
+// Attributes other than the strings are converted to their canonical string representations,
+// and the extension attributes with invalid or reserved names are rejected.
+func UnmarshalProtoCloudEvent(b []byte) (*CloudEvent, error) {
+	ce := &CloudEvent{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errMalformedProtoCloudEvent
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return nil, errMalformedProtoCloudEvent
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, errMalformedProtoCloudEvent
+		}
+		b = b[n:]
+		switch num {
+		case ceIDNumber:
+			ce.ID = string(v)
+		case ceSourceNumber:
+			ce.Source = string(v)
+		case ceSpecVersion:
+			ce.SpecVersion = string(v)
+		case ceTypeNumber:
+			ce.Type = string(v)
+		case ceAttributesNumber:
+			key, value, err := consumeAttribute(v)
+			if err != nil {
+				return nil, err
+			}
+			if err = ce.setAttribute(key, value); err != nil {
+				return nil, err
+			}
+		case ceBinaryDataNumber, ceTextDataNumber:
+			ce.Data = v
+		case ceProtoDataNumber:
+			// google.protobuf.Any, of which the value is field 2
+			ce.Data = consumeBytesField(v, 2)
+		}
+	}
+	return ce, nil
+}
+
+// HasExpired reports whether the expiration of the event has passed.
+func (ce *CloudEvent) HasExpired() bool {
+	if ce.Expiration == "" {
+		return false
+	}
+	expiration, err := time.Parse(time.RFC3339, ce.Expiration)
+	if err != nil {
+		return false
+	}
+	return expiration.UTC().Before(time.Now().UTC())
+}
+
+func (ce *CloudEvent) setAttribute(key string, value string) error {
+	switch key {
+	case pubsub.DataContentTypeField:
+		ce.DataContentType = value
+	case pubsub.SubjectField:
+		ce.Subject = value
+	case pubsub.TopicField:
+		ce.Topic = value
+	case pubsub.PubsubField:
+		ce.PubsubName = value
+	case pubsub.TraceIDField:
+		ce.TraceID = value
+	case pubsub.ExpirationField:
+		ce.Expiration = value
+	default:
+		if err := ValidateExtensionName(key); err != nil {
+			return err
+		}
+		if ce.Extensions == nil {
+			ce.Extensions = make(map[string]string)
+		}
+		ce.Extensions[key] = value
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendAttribute appends an entry of the attributes map, of which the value is a ce_string
+func appendAttribute(b []byte, key string, value string) []byte {
+	if value == "" {
+		return b
+	}
+	var attr []byte
+	attr = appendString(attr, attrStringNumber, value)
+	var entry []byte
+	entry = appendString(entry, 1, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, attr)
+	b = protowire.AppendTag(b, ceAttributesNumber, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+// consumeAttribute parses an entry of the attributes map
+func consumeAttribute(b []byte) (key string, value string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			return "", "", errMalformedProtoCloudEvent
+		}
+		b = b[n:]
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return "", "", errMalformedProtoCloudEvent
+		}
+		b = b[n:]
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			if value, err = consumeAttributeValue(v); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return key, value, nil
+}
+
+// consumeAttributeValue parses a CloudEventAttributeValue
+func consumeAttributeValue(b []byte) (string, error) {
+	value := ""
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", errMalformedProtoCloudEvent
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.VarintType && (num == attrBooleanNumber || num == attrIntegerNumber):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return "", errMalformedProtoCloudEvent
+			}
+			b = b[n:]
+			if num == attrBooleanNumber {
+				value = strconv.FormatBool(v != 0)
+			} else {
+				value = strconv.FormatInt(int64(int32(v)), 10)
+			}
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", errMalformedProtoCloudEvent
+			}
+			b = b[n:]
+			switch num {
+			case attrStringNumber, attrURINumber, attrURIRefNumber:
+				value = string(v)
+			case attrBytesNumber:
+				value = base64.StdEncoding.EncodeToString(v)
+			case attrTimestampNumber:
+				value = consumeTimestamp(v)
+			}
+		default:
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return "", fmt.Errorf("%w: unexpected attribute value type", errMalformedProtoCloudEvent)
+			}
+			b = b[n:]
+		}
+	}
+	return value, nil
+}
+
+// consumeTimestamp converts a google.protobuf.Timestamp into RFC3339 format
+func consumeTimestamp(b []byte) string {
+	var seconds, nanos uint64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.VarintType {
+			return ""
+		}
+		b = b[n:]
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return ""
+		}
+		b = b[n:]
+		if num == 1 {
+			seconds = v
+		} else if num == 2 {
+			nanos = v
+		}
+	}
+	return time.Unix(int64(seconds), int64(nanos)).UTC().Format(time.RFC3339)
+}
+
+// consumeBytesField returns the value of a bytes field in a message
+func consumeBytesField(b []byte, field protowire.Number) []byte {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil
+		}
+		if num == field && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			return v
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtoCloudEvent(t *testing.T) {
+	data := []byte{0x08, 0x96, 0x01, 0x7b}
+	ce := &CloudEvent{
+		ID:              "1",
+		Source:          "runtime",
+		Type:            "com.runtime.event.sent",
+		Topic:           "topic",
+		PubsubName:      "mock",
+		DataContentType: "application/x-protobuf",
+		Data:            data,
+		Extensions:      map[string]string{"partitionkey": "a"},
+	}
+	b := MarshalProtoCloudEvent(ce, nil, map[string]string{ttlMetadataKey: "10"})
+	assert.True(t, IsProtoCloudEvent(b))
+	assert.False(t, IsProtoCloudEvent([]byte(` {"id":"1"}`)))
+	// raw payloads not starting with '{' are not taken as protobuf
+	assert.False(t, IsProtoCloudEvent([]byte(`"hello"`)))
+	assert.False(t, IsProtoCloudEvent([]byte(`[1, 2]`)))
+	assert.False(t, IsProtoCloudEvent(data))
+	// the required attributes are missing
+	assert.False(t, IsProtoCloudEvent(appendString(nil, ceIDNumber, "1")))
+
+	actual, err := UnmarshalProtoCloudEvent(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", actual.ID)
+	assert.Equal(t, "1.0", actual.SpecVersion)
+	assert.Equal(t, "runtime", actual.Source)
+	assert.Equal(t, "com.runtime.event.sent", actual.Type)
+	assert.Equal(t, "topic", actual.Topic)
+	assert.Equal(t, "mock", actual.PubsubName)
+	assert.Equal(t, "application/x-protobuf", actual.DataContentType)
+	assert.Equal(t, data, actual.Data)
+	assert.Equal(t, "a", actual.Extensions["partitionkey"])
+	assert.NotEmpty(t, actual.Expiration)
+	assert.False(t, actual.HasExpired())
+
+	t.Run("patch", func(t *testing.T) {
+		b, err := PatchProtoCloudEvent(b, "new", "other", "trace", nil, nil)
+		assert.Nil(t, err)
+		actual, err := UnmarshalProtoCloudEvent(b)
+		assert.Nil(t, err)
+		assert.Equal(t, "new", actual.Topic)
+		assert.Equal(t, "other", actual.PubsubName)
+		assert.Equal(t, "trace", actual.TraceID)
+		assert.Equal(t, data, actual.Data)
+
+		_, err = PatchProtoCloudEvent([]byte{0x0a, 0x05}, "new", "other", "", nil, nil)
+		assert.NotNil(t, err)
+		// the subscribers can't tell it's in protobuf format without the required attributes
+		_, err = PatchProtoCloudEvent(appendString(nil, ceIDNumber, "1"), "new", "other", "", nil, nil)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("extension names", func(t *testing.T) {
+		for _, name := range []string{"id", "source", "specversion", "type", "data", "data_base64", "Upper", "with-dash", ""} {
+			assert.NotNil(t, ValidateExtensionName(name), name)
+			b := appendTypedAttribute(appendString(nil, ceIDNumber, "1"), name, attrStringNumber, protowire.BytesType, func(v []byte) []byte {
+				return protowire.AppendBytes(v, []byte("x"))
+			})
+			_, err := UnmarshalProtoCloudEvent(b)
+			assert.NotNil(t, err, name)
+		}
+		assert.Nil(t, ValidateExtensionName("partitionkey2"))
+	})
+
+	t.Run("typed attributes", func(t *testing.T) {
+		// {id: "2", attributes: {"time": {ce_timestamp: {seconds: 1}}, "count": {ce_integer: 3}}, text_data: "hello"}
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, 1)
+		b := appendString(nil, ceIDNumber, "2")
+		b = appendTypedAttribute(b, "time", attrTimestampNumber, protowire.BytesType, func(v []byte) []byte {
+			return protowire.AppendBytes(v, ts)
+		})
+		b = appendTypedAttribute(b, "count", attrIntegerNumber, protowire.VarintType, func(v []byte) []byte {
+			return protowire.AppendVarint(v, 3)
+		})
+		b = appendString(b, ceTextDataNumber, "hello")
+
+		actual, err := UnmarshalProtoCloudEvent(b)
+		assert.Nil(t, err)
+		assert.Equal(t, "2", actual.ID)
+		assert.Equal(t, time.Unix(1, 0).UTC().Format(time.RFC3339), actual.Extensions["time"])
+		assert.Equal(t, "3", actual.Extensions["count"])
+		assert.Equal(t, []byte("hello"), actual.Data)
+	})
+}
+
+func appendTypedAttribute(b []byte, key string, num protowire.Number, typ protowire.Type, appendValue func([]byte) []byte) []byte {
+	attr := appendValue(protowire.AppendTag(nil, num, typ))
+	entry := appendString(nil, 1, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, attr)
+	b = protowire.AppendTag(b, ceAttributesNumber, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+func TestProtobufContentType(t *testing.T) {
+	assert.True(t, IsProtobufContentType("application/x-protobuf"))
+	assert.True(t, IsProtobufContentType("application/protobuf; proto=foo.Bar"))
+	assert.False(t, IsProtobufContentType("application/json"))
+	assert.True(t, IsProtoCloudEventContentType("application/cloudevents+protobuf"))
+	assert.False(t, IsProtoCloudEventContentType("application/cloudevents+json"))
+}
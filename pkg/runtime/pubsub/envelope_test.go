@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+)
+
+var testJSONData = []byte(`{"orderId":"100","items":[{"sku":"a","count":1},{"sku":"b","count":2}],"address":{"city":"hangzhou"}}`)
+
+func TestMarshalCloudEvent(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"json", "application/json", testJSONData},
+		{"invalid json", "application/json", []byte("{")},
+		{"text", "text/plain", []byte("hello")},
+		{"default content type", "", []byte("hello")},
+		{"empty data", "", nil},
+		{"binary", "application/octet-stream", []byte{0, 1, 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := MarshalCloudEvent(&CloudEvent{
+				ID:              "1",
+				Source:          "runtime",
+				Type:            "com.runtime.event.sent",
+				Topic:           "topic",
+				PubsubName:      "mock",
+				DataContentType: c.contentType,
+				Data:            c.data,
+			}, nil, nil)
+			data := c.data
+			if data == nil {
+				data = []byte{}
+			}
+			expected := pubsub.NewCloudEventsEnvelope("1", "runtime", "com.runtime.event.sent", "", "topic", "mock", c.contentType, data, "")
+			var actual map[string]interface{}
+			assert.Nil(t, jsoniter.Unmarshal(b, &actual))
+			assert.Equal(t, normalize(t, expected), actual)
+		})
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		metadata := map[string]string{ttlMetadataKey: "10"}
+		var actual map[string]interface{}
+		b := MarshalCloudEvent(&CloudEvent{ID: "1", Data: testJSONData}, nil, metadata)
+		assert.Nil(t, jsoniter.Unmarshal(b, &actual))
+		assert.NotEmpty(t, actual[pubsub.ExpirationField])
+
+		actual = nil
+		b = MarshalCloudEvent(&CloudEvent{ID: "1", Data: testJSONData}, []pubsub.Feature{pubsub.FeatureMessageTTL}, metadata)
+		assert.Nil(t, jsoniter.Unmarshal(b, &actual))
+		assert.Nil(t, actual[pubsub.ExpirationField])
+	})
+}
+
+func TestPatchCloudEvent(t *testing.T) {
+	ce := []byte(`{"id":"1","specversion":"1.0","source":"app","type":"order","topic":"old","datacontenttype":"application/json","data":` + string(testJSONData) + `}`)
+	b, err := PatchCloudEvent(ce, "topic", "mock", "", nil, nil)
+	assert.Nil(t, err)
+	expected, err := pubsub.FromCloudEvent(ce, "topic", "mock", "")
+	assert.Nil(t, err)
+	var actual map[string]interface{}
+	assert.Nil(t, jsoniter.Unmarshal(b, &actual))
+	assert.Equal(t, normalize(t, expected), actual)
+
+	_, err = PatchCloudEvent([]byte("{"), "topic", "mock", "", nil, nil)
+	assert.NotNil(t, err)
+}
+
+// normalize converts the value types of a map to the ones decoded from json
+func normalize(t *testing.T, m map[string]interface{}) map[string]interface{} {
+	b, err := jsoniter.Marshal(m)
+	assert.Nil(t, err)
+	var res map[string]interface{}
+	assert.Nil(t, jsoniter.Unmarshal(b, &res))
+	return res
+}
+
+func BenchmarkMarshalCloudEvent(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MarshalCloudEvent(&CloudEvent{
+			ID:              "1",
+			Source:          "runtime",
+			Type:            "com.runtime.event.sent",
+			Topic:           "topic",
+			PubsubName:      "mock",
+			DataContentType: "application/json",
+			Data:            testJSONData,
+		}, nil, nil)
+	}
+}
+
+// BenchmarkMarshalCloudEventWithMap is the baseline building the envelope as a map
+func BenchmarkMarshalCloudEventWithMap(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		envelope := pubsub.NewCloudEventsEnvelope("1", "runtime", "com.runtime.event.sent", "", "topic", "mock",
+			"application/json", testJSONData, "")
+		pubsub.ApplyMetadata(envelope, nil, nil)
+		jsoniter.ConfigFastest.Marshal(envelope)
+	}
+}
+
+func BenchmarkPatchCloudEvent(b *testing.B) {
+	ce := []byte(`{"id":"1","specversion":"1.0","source":"app","type":"order","datacontenttype":"application/json","data":` + string(testJSONData) + `}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PatchCloudEvent(ce, "topic", "mock", "", nil, nil)
+	}
+}
+
+// BenchmarkPatchCloudEventWithMap is the baseline decoding the whole cloud event into a map
+func BenchmarkPatchCloudEventWithMap(b *testing.B) {
+	ce := []byte(`{"id":"1","specversion":"1.0","source":"app","type":"order","datacontenttype":"application/json","data":` + string(testJSONData) + `}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		envelope, _ := pubsub.FromCloudEvent(ce, "topic", "mock", "")
+		pubsub.ApplyMetadata(envelope, nil, nil)
+		jsoniter.ConfigFastest.Marshal(envelope)
+	}
+}
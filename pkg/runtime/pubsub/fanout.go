@@ -0,0 +1,193 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"mosn.io/layotto/pkg/runtime/alias"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+	"mosn.io/pkg/log"
+)
+
+const (
+	// MainCallbackTarget is the name of the target which is the app itself
+	MainCallbackTarget = "app"
+	// AckRequired makes the event redelivered until the target succeeds
+	AckRequired = "required"
+	// AckNone ignores the failures of the target
+	AckNone = "none"
+
+	// maxTrackedEvents limits the number of partially acked events remembered for deduplication
+	maxTrackedEvents = 10000
+)
+
+// CallbackTargetConfig is the config of an extra app callback target, e.g. a local audit processor.
+// Either GrpcPort or HttpCallback should be configured.
+type CallbackTargetConfig struct {
+	// GrpcPort is the port of the AppCallback service on localhost
+	GrpcPort int `json:"grpc_port"`
+	// HttpCallback delivers the events over HTTP
+	HttpCallback *HTTPCallbackConfig `json:"http_callback,omitempty"`
+	// Ack is "required" (default) or "none"
+	Ack string `json:"ack"`
+}
+
+// CallbackTarget is a target which the events are dispatched to
+type CallbackTarget struct {
+	Client runtimev1pb.AppCallbackClient
+	// AckRequired is false if the failures of this target should be ignored
+	AckRequired bool
+}
+
+// FanOutCallback dispatches each event to all the targets subscribing to the topic.
+// Every target acks the event independently: when an event is redelivered, the targets
+// which have acked it are skipped, so only the failed targets receive it again.
+type FanOutCallback struct {
+	targets map[string]CallbackTarget
+	names   []string
+
+	mu sync.Mutex
+	// routes maps pubsub name to topic to the names of targets
+	routes map[string]map[string][]string
+	// acked maps the event id to the targets which have acked it
+	acked map[string]map[string]struct{}
+	order []string
+}
+
+// NewFanOutCallback returns a FanOutCallback dispatching events to the targets
+func NewFanOutCallback(targets map[string]CallbackTarget) *FanOutCallback {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &FanOutCallback{
+		targets: targets,
+		names:   names,
+		routes:  make(map[string]map[string][]string),
+		acked:   make(map[string]map[string]struct{}),
+	}
+}
+
+// ListTopicSubscriptions merges the subscriptions of all targets and records which targets subscribe to each topic
+func (f *FanOutCallback) ListTopicSubscriptions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*runtimev1pb.ListTopicSubscriptionsResponse, error) {
+	routes := make(map[string]map[string][]string)
+	resp := &runtimev1pb.ListTopicSubscriptionsResponse{}
+	for _, name := range f.names {
+		for _, s := range ListTopicSubscriptions(f.targets[name].Client, log.DefaultLogger) {
+			if s == nil {
+				continue
+			}
+			pubsubName := alias.Resolve(alias.PubSub, s.PubsubName)
+			if _, ok := routes[pubsubName]; !ok {
+				routes[pubsubName] = make(map[string][]string)
+			}
+			// the first subscription of a topic decides the metadata
+			if len(routes[pubsubName][s.Topic]) == 0 {
+				resp.Subscriptions = append(resp.Subscriptions, s)
+			}
+			routes[pubsubName][s.Topic] = append(routes[pubsubName][s.Topic], name)
+		}
+	}
+	f.mu.Lock()
+	f.routes = routes
+	f.mu.Unlock()
+	return resp, nil
+}
+
+// OnTopicEvent delivers the event to the targets concurrently.
+// It returns RETRY if any target requiring ack fails.
+func (f *FanOutCallback) OnTopicEvent(ctx context.Context, in *runtimev1pb.TopicEventRequest, opts ...grpc.CallOption) (*runtimev1pb.TopicEventResponse, error) {
+	// 1. find the targets which haven't acked it
+	f.mu.Lock()
+	var pending []string
+	for _, name := range f.routes[alias.Resolve(alias.PubSub, in.PubsubName)][in.Topic] {
+		if _, ok := f.acked[in.Id][name]; !ok {
+			pending = append(pending, name)
+		}
+	}
+	f.mu.Unlock()
+	// 2. deliver
+	results := make([]bool, len(pending))
+	var wg sync.WaitGroup
+	for i, name := range pending {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			target := f.targets[name]
+			results[i] = isAcked(target.Client.OnTopicEvent(ctx, in))
+			if !results[i] && !target.AckRequired {
+				log.DefaultLogger.Warnf("[runtime][fanout]ignore the failure of target %s while processing pub/sub event %v", name, in.Id)
+				results[i] = true
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	// 3. record the acks
+	failed := false
+	for _, ok := range results {
+		if !ok {
+			failed = true
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !failed {
+		// all done, no need to remember it
+		delete(f.acked, in.Id)
+		return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}, nil
+	}
+	for i, name := range pending {
+		if !results[i] {
+			continue
+		}
+		if _, ok := f.acked[in.Id]; !ok {
+			f.acked[in.Id] = make(map[string]struct{})
+			f.order = append(f.order, in.Id)
+		}
+		f.acked[in.Id][name] = struct{}{}
+	}
+	f.evict()
+	return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_RETRY}, nil
+}
+
+// evict forgets the oldest events if too many are tracked
+func (f *FanOutCallback) evict() {
+	for len(f.order) > maxTrackedEvents {
+		delete(f.acked, f.order[0])
+		f.order = f.order[1:]
+	}
+}
+
+// isAcked reports whether the result means the target is done with the event, the same as retryStrategy
+func isAcked(res *runtimev1pb.TopicEventResponse, err error) bool {
+	if err != nil {
+		return status.Code(err) == codes.Unimplemented
+	}
+	switch res.GetStatus() {
+	case runtimev1pb.TopicEventResponse_SUCCESS, runtimev1pb.TopicEventResponse_DROP:
+		return true
+	}
+	return false
+}
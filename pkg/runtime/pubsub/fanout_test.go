@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+	mock_appcallback "mosn.io/layotto/pkg/mock/runtime/appcallback"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestFanOutCallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	app := mock_appcallback.NewMockAppCallbackClient(ctrl)
+	audit := mock_appcallback.NewMockAppCallbackClient(ctrl)
+	app.EXPECT().ListTopicSubscriptions(gomock.Any(), gomock.Any()).Return(&runtimev1pb.ListTopicSubscriptionsResponse{
+		Subscriptions: []*runtimev1pb.TopicSubscription{
+			{PubsubName: "mock", Topic: "orders"},
+			{PubsubName: "mock", Topic: "users"},
+		},
+	}, nil)
+	audit.EXPECT().ListTopicSubscriptions(gomock.Any(), gomock.Any()).Return(&runtimev1pb.ListTopicSubscriptionsResponse{
+		Subscriptions: []*runtimev1pb.TopicSubscription{
+			{PubsubName: "mock", Topic: "orders"},
+		},
+	}, nil)
+	f := NewFanOutCallback(map[string]CallbackTarget{
+		MainCallbackTarget: {Client: app, AckRequired: true},
+		"audit":            {Client: audit, AckRequired: true},
+	})
+	resp, err := f.ListTopicSubscriptions(context.Background(), &emptypb.Empty{})
+	assert.Nil(t, err)
+	// the topic subscribed by both targets is subscribed only once
+	assert.Len(t, resp.Subscriptions, 2)
+
+	success := &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}
+	t.Run("routing", func(t *testing.T) {
+		app.EXPECT().OnTopicEvent(gomock.Any(), gomock.Any()).Return(success, nil)
+		resp, err := f.OnTopicEvent(context.Background(), &runtimev1pb.TopicEventRequest{Id: "1", PubsubName: "mock", Topic: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_SUCCESS, resp.Status)
+	})
+
+	t.Run("only failed targets receive the redelivered event", func(t *testing.T) {
+		event := &runtimev1pb.TopicEventRequest{Id: "2", PubsubName: "mock", Topic: "orders"}
+		app.EXPECT().OnTopicEvent(gomock.Any(), event).Return(success, nil).Times(1)
+		audit.EXPECT().OnTopicEvent(gomock.Any(), event).Return(nil, errors.New("unavailable"))
+		resp, err := f.OnTopicEvent(context.Background(), event)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_RETRY, resp.Status)
+
+		audit.EXPECT().OnTopicEvent(gomock.Any(), event).Return(success, nil)
+		resp, err = f.OnTopicEvent(context.Background(), event)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_SUCCESS, resp.Status)
+		assert.Empty(t, f.acked)
+	})
+
+	t.Run("ack not required", func(t *testing.T) {
+		f.targets["audit"] = CallbackTarget{Client: audit, AckRequired: false}
+		event := &runtimev1pb.TopicEventRequest{Id: "3", PubsubName: "mock", Topic: "orders"}
+		app.EXPECT().OnTopicEvent(gomock.Any(), event).Return(success, nil)
+		audit.EXPECT().OnTopicEvent(gomock.Any(), event).Return(&runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_RETRY}, nil)
+		resp, err := f.OnTopicEvent(context.Background(), event)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_SUCCESS, resp.Status)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Gate controls the delivery of events of a subscription.
+// When it's paused, new events wait until it's resumed, so the broker keeps the events
+// instead of redelivering them over and over.
+type Gate struct {
+	mu       sync.Mutex
+	paused   bool
+	resumeCh chan struct{}
+	inFlight int64
+	drainCh  chan struct{}
+}
+
+// NewGate returns an open gate
+func NewGate() *Gate {
+	return &Gate{}
+}
+
+// Enter waits until the gate is open, and then counts the event as in-flight.
+// Leave must be called after the event is delivered if it returns nil.
+func (g *Gate) Enter(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		if !g.paused {
+			g.inFlight++
+			g.mu.Unlock()
+			return nil
+		}
+		ch := g.resumeCh
+		g.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Leave marks an in-flight event as delivered
+func (g *Gate) Leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if g.inFlight == 0 && g.drainCh != nil {
+		close(g.drainCh)
+		g.drainCh = nil
+	}
+}
+
+// Pause stops new events and waits for the in-flight events to be drained.
+// The gate keeps paused even if the context is done before draining.
+func (g *Gate) Pause(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.paused {
+		g.paused = true
+		g.resumeCh = make(chan struct{})
+	}
+	if g.inFlight == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.drainCh == nil {
+		g.drainCh = make(chan struct{})
+	}
+	ch := g.drainCh
+	g.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume lets the waiting events in
+func (g *Gate) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.resumeCh)
+	}
+}
+
+// State returns whether the gate is paused and the number of in-flight events
+func (g *Gate) State() (paused bool, inFlight int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.inFlight
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGate(t *testing.T) {
+	g := NewGate()
+	assert.Nil(t, g.Enter(context.Background()))
+
+	// pausing waits for the in-flight event
+	paused := make(chan error, 1)
+	go func() {
+		paused <- g.Pause(context.Background())
+	}()
+	select {
+	case <-paused:
+		t.Fatal("paused before draining")
+	case <-time.After(10 * time.Millisecond):
+	}
+	g.Leave()
+	assert.Nil(t, <-paused)
+	p, inFlight := g.State()
+	assert.True(t, p)
+	assert.Equal(t, int64(0), inFlight)
+
+	// new events wait until resumed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, g.Enter(ctx))
+	entered := make(chan error, 1)
+	go func() {
+		entered <- g.Enter(context.Background())
+	}()
+	g.Resume()
+	assert.Nil(t, <-entered)
+	g.Leave()
+	p, _ = g.State()
+	assert.False(t, p)
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	gcppubsub "cloud.google.com/go/pubsub"
+	"github.com/dapr/components-contrib/pubsub"
+	"google.golang.org/api/option"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	// the number of acked message ids remembered by every subscription for deduplication
+	maxAckedMessages  = 10000
+	reconnectInterval = 3 * time.Second
+)
+
+var ErrClosed = errors.New("gcp pubsub component is closed")
+
+// GCPPubSub is a pubsub component of Google Cloud Pub/Sub.
+// Every subscription is named "<consumerID>-<topic>", and created with the ordering and dead-letter policy if it doesn't exist.
+type GCPPubSub struct {
+	metadata *metadata
+	client   *gcppubsub.Client
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu         sync.Mutex
+	topics     map[string]*gcppubsub.Topic
+	subscribed map[string]*subscriptionConfig
+}
+
+// NewGCPPubSub returns a new gcp pubsub component
+func NewGCPPubSub() pubsub.PubSub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &GCPPubSub{
+		ctx:        ctx,
+		cancel:     cancel,
+		topics:     make(map[string]*gcppubsub.Topic),
+		subscribed: make(map[string]*subscriptionConfig),
+	}
+}
+
+func (g *GCPPubSub) Init(md pubsub.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	g.metadata = m
+	var opts []option.ClientOption
+	if m.credentials != nil {
+		opts = append(opts, option.WithCredentialsJSON(m.credentials))
+	}
+	g.client, err = gcppubsub.NewClient(g.ctx, m.projectID, opts...)
+	return err
+}
+
+func (g *GCPPubSub) Features() []pubsub.Feature {
+	return nil
+}
+
+// SupportPartitionOrdering reports whether the messages with the same ordering key are delivered in order,
+// which requires message ordering to be enabled
+func (g *GCPPubSub) SupportPartitionOrdering() bool {
+	return g.metadata.enableMessageOrdering
+}
+
+// topic returns the topic, creating it if it doesn't exist and the entity management isn't disabled
+func (g *GCPPubSub) topic(name string) (*gcppubsub.Topic, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	if t, ok := g.topics[name]; ok {
+		return t, nil
+	}
+	t := g.client.Topic(name)
+	if !g.metadata.disableEntityManagement {
+		exists, err := t.Exists(g.ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if t, err = g.client.CreateTopic(g.ctx, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the messages with ordering keys are published in order
+	t.EnableMessageOrdering = g.metadata.enableMessageOrdering
+	g.topics[name] = t
+	return t, nil
+}
+
+// Publish sends the message to the topic. The "orderingKey" metadata orders the messages if message ordering is enabled.
+func (g *GCPPubSub) Publish(req *pubsub.PublishRequest) error {
+	t, err := g.topic(req.Topic)
+	if err != nil {
+		return err
+	}
+	msg := &gcppubsub.Message{Data: req.Data}
+	if g.metadata.enableMessageOrdering {
+		msg.OrderingKey = req.Metadata[orderingKeyKey]
+	}
+	if _, err := t.Publish(g.ctx, msg).Get(g.ctx); err != nil {
+		if msg.OrderingKey != "" {
+			// the publishing of the ordering key is paused after errors
+			t.ResumePublish(msg.OrderingKey)
+		}
+		return err
+	}
+	return nil
+}
+
+// Subscribe receives the messages of the subscription of the topic.
+// The messages with the same ordering key are delivered one by one if ordering is enabled on the subscription.
+func (g *GCPPubSub) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	if g.metadata.consumerID == "" {
+		return errors.New("gcp pubsub consumerID is empty")
+	}
+	cfg, err := g.metadata.subscription(req.Topic, req.Metadata)
+	if err != nil {
+		return err
+	}
+	sub, err := g.ensureSubscription(req.Topic, cfg)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.subscribed[req.Topic] = cfg
+	g.mu.Unlock()
+	var acked *ackedMessages
+	if g.metadata.dedupAckedMessages {
+		acked = newAckedMessages(maxAckedMessages)
+	}
+	utils.GoWithRecover(func() {
+		for {
+			err := sub.Receive(g.ctx, func(ctx context.Context, m *gcppubsub.Message) {
+				g.handle(ctx, req.Topic, m, acked, handler)
+			})
+			if g.ctx.Err() != nil {
+				return
+			}
+			log.DefaultLogger.Errorf("[runtime] [pubsub.gcp] receive subscription %s error: %v", cfg.name, err)
+			select {
+			case <-g.ctx.Done():
+				return
+			case <-time.After(reconnectInterval):
+			}
+		}
+	}, nil)
+	return nil
+}
+
+func (g *GCPPubSub) ensureSubscription(topic string, cfg *subscriptionConfig) (*gcppubsub.Subscription, error) {
+	sub := g.client.Subscription(cfg.name)
+	if g.metadata.disableEntityManagement {
+		return sub, nil
+	}
+	exists, err := sub.Exists(g.ctx)
+	if err != nil || exists {
+		return sub, err
+	}
+	t, err := g.topic(topic)
+	if err != nil {
+		return nil, err
+	}
+	sc := gcppubsub.SubscriptionConfig{Topic: t, EnableMessageOrdering: cfg.ordering}
+	if cfg.deadLetterTopic != "" {
+		dlt, err := g.topic(cfg.deadLetterTopic)
+		if err != nil {
+			return nil, err
+		}
+		sc.DeadLetterPolicy = &gcppubsub.DeadLetterPolicy{
+			DeadLetterTopic:     dlt.String(),
+			MaxDeliveryAttempts: cfg.maxDeliveryAttempts,
+		}
+	}
+	return g.client.CreateSubscription(g.ctx, cfg.name, sc)
+}
+
+func (g *GCPPubSub) handle(ctx context.Context, topic string, m *gcppubsub.Message, acked *ackedMessages, handler pubsub.Handler) {
+	// the message acked before is redelivered if the ack is lost
+	if acked != nil && acked.contains(m.ID) {
+		m.Ack()
+		return
+	}
+	md := map[string]string{messageIDKey: m.ID}
+	if m.OrderingKey != "" {
+		md[orderingKeyKey] = m.OrderingKey
+	}
+	if m.DeliveryAttempt != nil {
+		md[deliveryAttemptKey] = strconv.Itoa(*m.DeliveryAttempt)
+	}
+	if err := handler(ctx, &pubsub.NewMessage{Data: m.Data, Topic: topic, Metadata: md}); err != nil {
+		log.DefaultLogger.Warnf("[runtime] [pubsub.gcp] handle message %s of topic %s error: %v", m.ID, topic, err)
+		// the message is redelivered, or dead-lettered after the max delivery attempts
+		m.Nack()
+		return
+	}
+	if acked != nil {
+		acked.add(m.ID)
+	}
+	m.Ack()
+}
+
+// DescribeSubscription returns the subscription of the topic, so that it's visible in the metadata of the runtime
+func (g *GCPPubSub) DescribeSubscription(topic string) map[string]string {
+	g.mu.Lock()
+	cfg, ok := g.subscribed[topic]
+	g.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	desc := map[string]string{
+		"subscription":         cfg.name,
+		"message_ordering":     strconv.FormatBool(cfg.ordering),
+		"dedup_acked_messages": strconv.FormatBool(g.metadata.dedupAckedMessages),
+	}
+	if cfg.deadLetterTopic != "" {
+		desc["dead_letter_topic"] = cfg.deadLetterTopic
+		desc["max_delivery_attempts"] = strconv.Itoa(cfg.maxDeliveryAttempts)
+	}
+	return desc
+}
+
+func (g *GCPPubSub) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx.Err() != nil {
+		return nil
+	}
+	g.cancel()
+	for _, t := range g.topics {
+		t.Stop()
+	}
+	if g.client != nil {
+		return g.client.Close()
+	}
+	return nil
+}
+
+// ackedMessages remembers the ids of the latest acked messages, to skip the redeliveries whose acks are lost.
+// It's a best-effort dedup rather than exactly-once delivery: the ids are only in the memory of this replica,
+// so a message redelivered to another replica, after a restart or after its id is evicted is handled again.
+type ackedMessages struct {
+	mu    sync.Mutex
+	max   int
+	ids   map[string]*list.Element
+	order *list.List
+}
+
+func newAckedMessages(max int) *ackedMessages {
+	return &ackedMessages{
+		max:   max,
+		ids:   make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (a *ackedMessages) contains(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.ids[id]
+	return ok
+}
+
+func (a *ackedMessages) add(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.ids[id]; ok {
+		return
+	}
+	a.ids[id] = a.order.PushBack(id)
+	if a.order.Len() > a.max {
+		oldest := a.order.Front()
+		a.order.Remove(oldest)
+		delete(a.ids, oldest.Value.(string))
+	}
+}
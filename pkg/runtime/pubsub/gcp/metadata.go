@@ -0,0 +1,167 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// the keys are compatible with the gcp pubsub component of dapr
+const (
+	projectIDKey               = "projectId"
+	typeKey                    = "type"
+	privateKeyIDKey            = "privateKeyId"
+	privateKeyKey              = "privateKey"
+	clientEmailKey             = "clientEmail"
+	clientIDKey                = "clientId"
+	authURIKey                 = "authUri"
+	tokenURIKey                = "tokenUri"
+	authProviderCertURLKey     = "authProviderX509CertUrl"
+	clientCertURLKey           = "clientX509CertUrl"
+	consumerIDKey              = "consumerID"
+	disableEntityManagementKey = "disableEntityManagement"
+	enableMessageOrderingKey   = "enableMessageOrdering"
+	deadLetterTopicKey         = "deadLetterTopic"
+	maxDeliveryAttemptsKey     = "maxDeliveryAttempts"
+	dedupAckedMessagesKey      = "dedupAckedMessages"
+
+	// the metadata of messages
+	orderingKeyKey     = "orderingKey"
+	messageIDKey       = "messageId"
+	deliveryAttemptKey = "deliveryAttempt"
+
+	defaultMaxDeliveryAttempts = 5
+)
+
+var ErrProjectIDEmpty = errors.New("gcp pubsub projectId is empty")
+
+type metadata struct {
+	projectID string
+	// credentials is the json of the service account, the default credentials are used if it's nil
+	credentials             []byte
+	consumerID              string
+	disableEntityManagement bool
+	enableMessageOrdering   bool
+	deadLetterTopic         string
+	maxDeliveryAttempts     int
+	dedupAckedMessages      bool
+}
+
+type credentials struct {
+	Type                string `json:"type"`
+	ProjectID           string `json:"project_id"`
+	PrivateKeyID        string `json:"private_key_id"`
+	PrivateKey          string `json:"private_key"`
+	ClientEmail         string `json:"client_email"`
+	ClientID            string `json:"client_id"`
+	AuthURI             string `json:"auth_uri"`
+	TokenURI            string `json:"token_uri"`
+	AuthProviderCertURL string `json:"auth_provider_x509_cert_url"`
+	ClientCertURL       string `json:"client_x509_cert_url"`
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		projectID:           props[projectIDKey],
+		consumerID:          props[consumerIDKey],
+		maxDeliveryAttempts: defaultMaxDeliveryAttempts,
+	}
+	if m.projectID == "" {
+		return nil, ErrProjectIDEmpty
+	}
+	if props[privateKeyKey] != "" {
+		b, err := json.Marshal(&credentials{
+			Type:                props[typeKey],
+			ProjectID:           m.projectID,
+			PrivateKeyID:        props[privateKeyIDKey],
+			PrivateKey:          props[privateKeyKey],
+			ClientEmail:         props[clientEmailKey],
+			ClientID:            props[clientIDKey],
+			AuthURI:             props[authURIKey],
+			TokenURI:            props[tokenURIKey],
+			AuthProviderCertURL: props[authProviderCertURLKey],
+			ClientCertURL:       props[clientCertURLKey],
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.credentials = b
+	}
+	var err error
+	parseBool := func(key string, v *bool) {
+		if s := props[key]; s != "" && err == nil {
+			*v, err = strconv.ParseBool(s)
+		}
+	}
+	parseBool(disableEntityManagementKey, &m.disableEntityManagement)
+	parseBool(enableMessageOrderingKey, &m.enableMessageOrdering)
+	parseBool(dedupAckedMessagesKey, &m.dedupAckedMessages)
+	if err != nil {
+		return nil, fmt.Errorf("gcp pubsub metadata is invalid: %v", err)
+	}
+	m.deadLetterTopic = props[deadLetterTopicKey]
+	if s := props[maxDeliveryAttemptsKey]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 5 || n > 100 {
+			return nil, fmt.Errorf("gcp pubsub max delivery attempts should be 5 ~ 100: %s", s)
+		}
+		m.maxDeliveryAttempts = n
+	}
+	return m, nil
+}
+
+// subscriptionConfig is the config of a subscription, of which the dead-letter topic can be overridden by the subscription metadata
+type subscriptionConfig struct {
+	name                string
+	ordering            bool
+	deadLetterTopic     string
+	maxDeliveryAttempts int
+}
+
+func (m *metadata) subscription(topic string, props map[string]string) (*subscriptionConfig, error) {
+	c := &subscriptionConfig{
+		name:                subscriptionName(m.consumerID, topic),
+		ordering:            m.enableMessageOrdering,
+		deadLetterTopic:     m.deadLetterTopic,
+		maxDeliveryAttempts: m.maxDeliveryAttempts,
+	}
+	if s := props[enableMessageOrderingKey]; s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gcp pubsub %s: %s", enableMessageOrderingKey, s)
+		}
+		c.ordering = b
+	}
+	if s := props[deadLetterTopicKey]; s != "" {
+		c.deadLetterTopic = s
+	}
+	if s := props[maxDeliveryAttemptsKey]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 5 || n > 100 {
+			return nil, fmt.Errorf("gcp pubsub max delivery attempts should be 5 ~ 100: %s", s)
+		}
+		c.maxDeliveryAttempts = n
+	}
+	return c, nil
+}
+
+func subscriptionName(consumerID string, topic string) string {
+	return consumerID + "-" + topic
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	_, err := parseMetadata(map[string]string{})
+	assert.Equal(t, ErrProjectIDEmpty, err)
+
+	m, err := parseMetadata(map[string]string{projectIDKey: "project", consumerIDKey: "app"})
+	assert.Nil(t, err)
+	assert.Nil(t, m.credentials)
+	assert.False(t, m.enableMessageOrdering)
+	assert.Equal(t, defaultMaxDeliveryAttempts, m.maxDeliveryAttempts)
+
+	m, err = parseMetadata(map[string]string{
+		projectIDKey:             "project",
+		consumerIDKey:            "app",
+		privateKeyKey:            "key",
+		clientEmailKey:           "app@project.iam.gserviceaccount.com",
+		enableMessageOrderingKey: "true",
+		dedupAckedMessagesKey:    "true",
+		deadLetterTopicKey:       "dead",
+		maxDeliveryAttemptsKey:   "10",
+	})
+	assert.Nil(t, err)
+	var c credentials
+	assert.Nil(t, json.Unmarshal(m.credentials, &c))
+	assert.Equal(t, "project", c.ProjectID)
+	assert.Equal(t, "key", c.PrivateKey)
+	assert.True(t, m.enableMessageOrdering)
+	assert.True(t, m.dedupAckedMessages)
+
+	// the subscription metadata overrides the component metadata
+	sc, err := m.subscription("orders", map[string]string{enableMessageOrderingKey: "false", maxDeliveryAttemptsKey: "20"})
+	assert.Nil(t, err)
+	assert.Equal(t, "app-orders", sc.name)
+	assert.False(t, sc.ordering)
+	assert.Equal(t, "dead", sc.deadLetterTopic)
+	assert.Equal(t, 20, sc.maxDeliveryAttempts)
+
+	_, err = parseMetadata(map[string]string{projectIDKey: "project", maxDeliveryAttemptsKey: "1"})
+	assert.NotNil(t, err)
+	_, err = m.subscription("orders", map[string]string{maxDeliveryAttemptsKey: "101"})
+	assert.NotNil(t, err)
+}
+
+func TestAckedMessages(t *testing.T) {
+	a := newAckedMessages(2)
+	a.add("1")
+	a.add("2")
+	a.add("2")
+	assert.True(t, a.contains("1"))
+	a.add("3")
+	// the oldest one is evicted
+	assert.False(t, a.contains("1"))
+	assert.True(t, a.contains("2"))
+	assert.True(t, a.contains("3"))
+}
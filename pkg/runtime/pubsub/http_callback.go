@@ -0,0 +1,205 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/contenttype"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+const (
+	// ModeStructured sends the whole cloud event as the json body
+	ModeStructured = "structured"
+	// ModeBinary sends the data as the body and the attributes as `ce-` headers
+	ModeBinary = "binary"
+
+	cloudEventJSONContentType = "application/cloudevents+json"
+	defaultCallbackTimeoutMs  = 5000
+)
+
+var ErrCallbackURLEmpty = errors.New("url of the http callback is empty")
+
+// HTTPCallbackConfig is the config of delivering topic events to the app over HTTP
+type HTTPCallbackConfig struct {
+	// Url receives the events by POST
+	Url string `json:"url"`
+	// Mode is the content mode of cloud events, "structured" (default) or "binary"
+	Mode string `json:"mode"`
+	// TimeoutMs is the timeout of a delivery, 5000 by default
+	TimeoutMs int `json:"timeout_ms"`
+	// Subscriptions are declared here since the runtime can't ask the app for them over HTTP
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// Subscription is a declarative topic subscription
+type Subscription struct {
+	PubsubName string            `json:"pubsub_name"`
+	Topic      string            `json:"topic"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+// httpCallbackResponse is the optional json body returned by the app
+type httpCallbackResponse struct {
+	Status string `json:"status"`
+}
+
+// httpAppCallback implements runtimev1pb.AppCallbackClient over HTTP
+type httpAppCallback struct {
+	cfg    HTTPCallbackConfig
+	client *http.Client
+}
+
+// NewHTTPAppCallback returns an AppCallbackClient which posts topic events to the url in the config
+func NewHTTPAppCallback(cfg HTTPCallbackConfig) (runtimev1pb.AppCallbackClient, error) {
+	if cfg.Url == "" {
+		return nil, ErrCallbackURLEmpty
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeStructured
+	case ModeStructured, ModeBinary:
+	default:
+		return nil, fmt.Errorf("unknown content mode of the http callback: %s", cfg.Mode)
+	}
+	if cfg.TimeoutMs <= 0 {
+		cfg.TimeoutMs = defaultCallbackTimeoutMs
+	}
+	return &httpAppCallback{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+	}, nil
+}
+
+func (c *httpAppCallback) ListTopicSubscriptions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*runtimev1pb.ListTopicSubscriptionsResponse, error) {
+	resp := &runtimev1pb.ListTopicSubscriptionsResponse{}
+	for _, s := range c.cfg.Subscriptions {
+		resp.Subscriptions = append(resp.Subscriptions, &runtimev1pb.TopicSubscription{
+			PubsubName: s.PubsubName,
+			Topic:      s.Topic,
+			Metadata:   s.Metadata,
+		})
+	}
+	return resp, nil
+}
+
+func (c *httpAppCallback) OnTopicEvent(ctx context.Context, in *runtimev1pb.TopicEventRequest, opts ...grpc.CallOption) (*runtimev1pb.TopicEventResponse, error) {
+	// 1. build the request according to the content mode
+	var req *http.Request
+	var err error
+	if c.cfg.Mode == ModeBinary {
+		req, err = c.binaryRequest(ctx, in)
+	} else {
+		req, err = c.structuredRequest(ctx, in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 2. post it
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// 3. convert the result.
+	// 404 means the app doesn't handle this topic, which is the same as codes.Unimplemented in gRPC
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, status.Errorf(codes.Unimplemented, "http callback returns status code %d", resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("http callback returns status code %d: %s", resp.StatusCode, string(body))
+	}
+	// an empty body means success
+	if len(bytes.TrimSpace(body)) == 0 {
+		return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}, nil
+	}
+	var r httpCallbackResponse
+	if err := json.Unmarshal(body, &r); err != nil || r.Status == "" {
+		return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_SUCCESS}, nil
+	}
+	s, ok := runtimev1pb.TopicEventResponse_TopicEventResponseStatus_value[strings.ToUpper(r.Status)]
+	if !ok {
+		return nil, fmt.Errorf("unknown status returned from http callback: %s", r.Status)
+	}
+	return &runtimev1pb.TopicEventResponse{Status: runtimev1pb.TopicEventResponse_TopicEventResponseStatus(s)}, nil
+}
+
+func (c *httpAppCallback) structuredRequest(ctx context.Context, in *runtimev1pb.TopicEventRequest) (*http.Request, error) {
+	ce := map[string]interface{}{
+		"id":              in.Id,
+		"source":          in.Source,
+		"type":            in.Type,
+		"specversion":     in.SpecVersion,
+		"datacontenttype": in.DataContentType,
+		"topic":           in.Topic,
+		"pubsubname":      in.PubsubName,
+	}
+	if len(in.Data) > 0 {
+		if contenttype.IsJSONContentType(in.DataContentType) && json.Valid(in.Data) {
+			ce["data"] = json.RawMessage(in.Data)
+		} else if contenttype.IsStringContentType(in.DataContentType) {
+			ce["data"] = string(in.Data)
+		} else {
+			// encoding/json encodes []byte in base64
+			ce["data_base64"] = in.Data
+		}
+	}
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", cloudEventJSONContentType)
+	return req, nil
+}
+
+func (c *httpAppCallback) binaryRequest(ctx context.Context, in *runtimev1pb.TopicEventRequest) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Url, bytes.NewReader(in.Data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("ce-id", in.Id)
+	req.Header.Set("ce-source", in.Source)
+	req.Header.Set("ce-type", in.Type)
+	req.Header.Set("ce-specversion", in.SpecVersion)
+	req.Header.Set("ce-topic", in.Topic)
+	req.Header.Set("ce-pubsubname", in.PubsubName)
+	if in.DataContentType != "" {
+		req.Header.Set("Content-Type", in.DataContentType)
+	}
+	return req, nil
+}
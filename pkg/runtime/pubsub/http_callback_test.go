@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestHTTPAppCallback(t *testing.T) {
+	event := &runtimev1pb.TopicEventRequest{
+		Id:              "1",
+		Source:          "runtime",
+		Type:            "com.runtime.event.sent",
+		SpecVersion:     "1.0",
+		DataContentType: "application/json",
+		Data:            []byte(`{"a":1}`),
+		Topic:           "topic",
+		PubsubName:      "mock",
+	}
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewHTTPAppCallback(HTTPCallbackConfig{})
+		assert.Equal(t, ErrCallbackURLEmpty, err)
+		_, err = NewHTTPAppCallback(HTTPCallbackConfig{Url: "http://127.0.0.1", Mode: "unknown"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("declarative subscriptions", func(t *testing.T) {
+		cb, err := NewHTTPAppCallback(HTTPCallbackConfig{
+			Url:           "http://127.0.0.1",
+			Subscriptions: []Subscription{{PubsubName: "mock", Topic: "topic", Metadata: map[string]string{"k": "v"}}},
+		})
+		assert.Nil(t, err)
+		resp, err := cb.ListTopicSubscriptions(context.Background(), &emptypb.Empty{})
+		assert.Nil(t, err)
+		assert.Len(t, resp.Subscriptions, 1)
+		assert.Equal(t, "mock", resp.Subscriptions[0].PubsubName)
+		assert.Equal(t, "topic", resp.Subscriptions[0].Topic)
+		assert.Equal(t, "v", resp.Subscriptions[0].Metadata["k"])
+	})
+
+	t.Run("structured mode", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, cloudEventJSONContentType, r.Header.Get("Content-Type"))
+			var ce map[string]interface{}
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &ce))
+			assert.Equal(t, "1", ce["id"])
+			assert.Equal(t, "topic", ce["topic"])
+			assert.Equal(t, map[string]interface{}{"a": float64(1)}, ce["data"])
+			w.Write([]byte(`{"status":"DROP"}`))
+		}))
+		defer srv.Close()
+		cb, err := NewHTTPAppCallback(HTTPCallbackConfig{Url: srv.URL})
+		assert.Nil(t, err)
+		resp, err := cb.OnTopicEvent(context.Background(), event)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_DROP, resp.Status)
+	})
+
+	t.Run("binary mode", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.Equal(t, "1", r.Header.Get("ce-id"))
+			assert.Equal(t, "mock", r.Header.Get("ce-pubsubname"))
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, `{"a":1}`, string(body))
+		}))
+		defer srv.Close()
+		cb, err := NewHTTPAppCallback(HTTPCallbackConfig{Url: srv.URL, Mode: ModeBinary})
+		assert.Nil(t, err)
+		resp, err := cb.OnTopicEvent(context.Background(), event)
+		assert.Nil(t, err)
+		assert.Equal(t, runtimev1pb.TopicEventResponse_SUCCESS, resp.Status)
+	})
+
+	t.Run("error status code", func(t *testing.T) {
+		code := http.StatusInternalServerError
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		defer srv.Close()
+		cb, err := NewHTTPAppCallback(HTTPCallbackConfig{Url: srv.URL})
+		assert.Nil(t, err)
+		_, err = cb.OnTopicEvent(context.Background(), event)
+		assert.NotNil(t, err)
+
+		// not found means the app doesn't handle it
+		code = http.StatusNotFound
+		_, err = cb.OnTopicEvent(context.Background(), event)
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
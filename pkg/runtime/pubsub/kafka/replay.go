@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/dapr/components-contrib/pubsub"
+
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+const (
+	brokersKey      = "brokers"
+	authRequiredKey = "authRequired"
+	saslUsernameKey = "saslUsername"
+	saslPasswordKey = "saslPassword"
+
+	// the metadata of replayed messages
+	PartitionMetadataKey = "partition"
+	OffsetMetadataKey    = "offset"
+)
+
+var ErrNoBrokers = errors.New("kafka brokers are not configured")
+
+// replayableKafka wraps the kafka component to replay messages by seeking the partitions
+type replayableKafka struct {
+	pubsub.PubSub
+	brokers []string
+	config  *sarama.Config
+}
+
+// NewReplayable wraps the kafka component so that it implements runtime_pubsub.Replayer
+func NewReplayable(comp pubsub.PubSub) pubsub.PubSub {
+	return &replayableKafka{PubSub: comp}
+}
+
+func (k *replayableKafka) Init(metadata pubsub.Metadata) error {
+	if err := k.PubSub.Init(metadata); err != nil {
+		return err
+	}
+	for _, b := range strings.Split(metadata.Properties[brokersKey], ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			k.brokers = append(k.brokers, b)
+		}
+	}
+	if len(k.brokers) == 0 {
+		return ErrNoBrokers
+	}
+	cfg := sarama.NewConfig()
+	// querying offsets by time requires 0.10.1+
+	cfg.Version = sarama.V1_0_0_0
+	cfg.Consumer.Return.Errors = true
+	if auth, _ := strconv.ParseBool(metadata.Properties[authRequiredKey]); auth {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.User = metadata.Properties[saslUsernameKey]
+		cfg.Net.SASL.Password = metadata.Properties[saslPasswordKey]
+	}
+	k.config = cfg
+	return nil
+}
+
+func (k *replayableKafka) Replay(ctx context.Context, req *runtime_pubsub.ReplayRequest, handler pubsub.Handler) (int64, error) {
+	client, err := sarama.NewClient(k.brokers, k.config)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	// 1. find the offset range of partitions
+	ranges, err := k.offsetRanges(client, req)
+	if err != nil {
+		return 0, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+	// 2. replay the partitions one by one
+	partitions := make([]int32, 0, len(ranges))
+	for p := range ranges {
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	var count int64
+	for _, p := range partitions {
+		n, err := k.replayPartition(ctx, consumer, req.Topic, p, ranges[p], handler)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// offsetRanges returns the [start, end) offsets of each partition to replay
+func (k *replayableKafka) offsetRanges(client sarama.Client, req *runtime_pubsub.ReplayRequest) (map[int32][2]int64, error) {
+	ranges := make(map[int32][2]int64)
+	if !req.ByTime() {
+		newest, err := client.GetOffset(req.Topic, req.Partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		end := req.EndOffset
+		if end > newest {
+			end = newest
+		}
+		if req.StartOffset < end {
+			ranges[req.Partition] = [2]int64{req.StartOffset, end}
+		}
+		return ranges, nil
+	}
+	partitions, err := client.Partitions(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partitions {
+		newest, err := client.GetOffset(req.Topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		// -1 is returned if there is no message after the time
+		start, err := client.GetOffset(req.Topic, p, toMillis(req.StartTime))
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 {
+			continue
+		}
+		end, err := client.GetOffset(req.Topic, p, toMillis(req.EndTime))
+		if err != nil {
+			return nil, err
+		}
+		if end < 0 || end > newest {
+			end = newest
+		}
+		if start < end {
+			ranges[p] = [2]int64{start, end}
+		}
+	}
+	return ranges, nil
+}
+
+func (k *replayableKafka) replayPartition(ctx context.Context, consumer sarama.Consumer, topic string, partition int32, r [2]int64, handler pubsub.Handler) (int64, error) {
+	pc, err := consumer.ConsumePartition(topic, partition, r[0])
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+	var count int64
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if msg.Offset >= r[1] {
+				return count, nil
+			}
+			if err := handler(ctx, &pubsub.NewMessage{
+				Data:  msg.Value,
+				Topic: topic,
+				Metadata: map[string]string{
+					PartitionMetadataKey: strconv.FormatInt(int64(partition), 10),
+					OffsetMetadataKey:    strconv.FormatInt(msg.Offset, 10),
+				},
+			}); err != nil {
+				return count, err
+			}
+			count++
+			if msg.Offset+1 >= r[1] {
+				return count, nil
+			}
+		case err := <-pc.Errors():
+			return count, err
+		case <-ctx.Done():
+			return count, ctx.Err()
+		}
+	}
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import "github.com/dapr/components-contrib/pubsub"
+
+const (
+	// PartitionKeyMetadataKey is the metadata of publish requests carrying the partition key
+	PartitionKeyMetadataKey = "partitionKey"
+)
+
+// Ordering is the ordering guarantee of the events published by a pubsub component
+type Ordering int
+
+const (
+	// OrderingNone means the events may be delivered out of order
+	OrderingNone Ordering = iota
+	// OrderingPartitionKey means the events with the same partition key are delivered in order
+	OrderingPartitionKey
+	// OrderingTopic means the events of a topic are delivered in order
+	OrderingTopic
+)
+
+// Capabilities describes how a pubsub component handles the partition key and the ordering of events
+type Capabilities struct {
+	// PartitionKeyMetadata are the metadata read by the component as the partition key,
+	// e.g. the key of Kafka messages. The partition key isn't passed to the broker natively if it's empty.
+	PartitionKeyMetadata []string
+	// Ordering is the ordering guarantee of the component
+	Ordering Ordering
+}
+
+// PartitionOrderingSupporter is implemented by the pubsub components which deliver the events with the same partition key
+// in order only with some config, e.g. FIFO topics, so that the ordering isn't claimed when it's off
+type PartitionOrderingSupporter interface {
+	SupportPartitionOrdering() bool
+}
+
+// capabilities of the pubsub components, keyed by the names of the components.
+// The ordering of the ones implementing PartitionOrderingSupporter depends on their config.
+var capabilities = map[string]Capabilities{
+	// the key of the message, and a partition is consumed in order
+	"kafka": {PartitionKeyMetadata: []string{PartitionKeyMetadataKey}, Ordering: OrderingPartitionKey},
+	// the partition key of the event, and a partition is received in order
+	"azure.eventhubs": {PartitionKeyMetadata: []string{PartitionKeyMetadataKey}, Ordering: OrderingPartitionKey},
+	// the key of the message, which is kept in order by Key_Shared subscriptions
+	"pulsar": {PartitionKeyMetadata: []string{"key"}, Ordering: OrderingPartitionKey},
+	// the sharding key of orderly messages
+	"rocketmq": {PartitionKeyMetadata: []string{"rocketmq-shardingkey"}, Ordering: OrderingPartitionKey},
+	// the ordering key, which orders the messages when message ordering is enabled
+	"gcp.pubsub": {PartitionKeyMetadata: []string{"orderingKey"}},
+	// the message group, which orders the messages of FIFO topics
+	"layotto.snssqs": {PartitionKeyMetadata: []string{PartitionKeyMetadataKey}},
+	// the session of the message, which orders the messages when sessions are enabled
+	"amqp": {PartitionKeyMetadata: []string{PartitionKeyMetadataKey}},
+}
+
+// CapabilitiesOf returns the capabilities of the pubsub component,
+// with the ordering reported by the component if it implements PartitionOrderingSupporter
+func CapabilitiesOf(name string, comp pubsub.PubSub) Capabilities {
+	c := capabilities[name]
+	if s, ok := Unwrap(comp).(PartitionOrderingSupporter); ok && s.SupportPartitionOrdering() {
+		c.Ordering = OrderingPartitionKey
+	}
+	return c
+}
+
+// WithPartitionKey returns the metadata with the partition key of the pubsub component.
+// The metadata isn't modified, and the partition key overrides the ones in it.
+func WithPartitionKey(name string, metadata map[string]string, key string) map[string]string {
+	if key == "" {
+		return metadata
+	}
+	md := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	md[PartitionKeyMetadataKey] = key
+	for _, k := range capabilities[name].PartitionKeyMetadata {
+		md[k] = key
+	}
+	return md
+}
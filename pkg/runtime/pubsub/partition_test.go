@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPartitionKey(t *testing.T) {
+	md := map[string]string{"k": "v", PartitionKeyMetadataKey: "old"}
+	got := WithPartitionKey("rocketmq", md, "order-1")
+	assert.Equal(t, map[string]string{
+		"k":                     "v",
+		PartitionKeyMetadataKey: "order-1",
+		"rocketmq-shardingkey":  "order-1",
+	}, got)
+	// the metadata isn't modified
+	assert.Equal(t, "old", md[PartitionKeyMetadataKey])
+
+	// unknown components only get the partitionKey metadata
+	got = WithPartitionKey("redis", nil, "order-1")
+	assert.Equal(t, map[string]string{PartitionKeyMetadataKey: "order-1"}, got)
+
+	// nothing is changed without partition key
+	assert.Equal(t, md, WithPartitionKey("kafka", md, ""))
+}
+
+type orderingPubSub struct {
+	pubsub.PubSub
+	ordering bool
+}
+
+func (o *orderingPubSub) SupportPartitionOrdering() bool {
+	return o.ordering
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	c := CapabilitiesOf("kafka", nil)
+	assert.Equal(t, OrderingPartitionKey, c.Ordering)
+	assert.Equal(t, []string{PartitionKeyMetadataKey}, c.PartitionKeyMetadata)
+
+	c = CapabilitiesOf("mqtt", nil)
+	assert.Equal(t, OrderingNone, c.Ordering)
+	assert.Empty(t, c.PartitionKeyMetadata)
+
+	// the ordering depends on the config of the component, e.g. FIFO topics
+	c = CapabilitiesOf("layotto.snssqs", &orderingPubSub{})
+	assert.Equal(t, OrderingNone, c.Ordering)
+	assert.Equal(t, []string{PartitionKeyMetadataKey}, c.PartitionKeyMetadata)
+	c = CapabilitiesOf("layotto.snssqs", NewAsyncPubSub(&orderingPubSub{ordering: true}, nil))
+	assert.Equal(t, OrderingPartitionKey, c.Ordering)
+}
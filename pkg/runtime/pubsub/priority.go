@@ -0,0 +1,253 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dapr/components-contrib/pubsub"
+)
+
+const (
+	// PriorityMetadataKey is the metadata of publish requests and messages carrying the priority
+	PriorityMetadataKey = "priority"
+	// PriorityModeNative passes the priority to the broker, e.g. RabbitMQ priority queues
+	PriorityModeNative = "native"
+	// PriorityModeTopics emulates the priority by a topic per level
+	PriorityModeTopics = "topics"
+
+	defaultPriorityLevels      = 3
+	defaultPriorityConcurrency = 16
+	priorityTopicSeparator     = ".priority-"
+)
+
+// PriorityConfig is the config of event priorities.
+// The priorities are 0 ~ Levels-1, and the bigger one is more urgent. Events without priority are in level 0.
+type PriorityConfig struct {
+	// Mode is "native" (default) or "topics"
+	Mode string `json:"mode"`
+	// Levels is the number of priorities, 3 by default
+	Levels int `json:"levels"`
+	// Weights are used in topics mode. When events of all levels are waiting,
+	// level i is delivered Weights[i] times in every sum(Weights) deliveries. It's 1, 2, 4... by default.
+	Weights []int `json:"weights"`
+	// MaxConcurrency is the number of events delivered concurrently in topics mode, 16 by default
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+// PriorityPubSub wraps a pubsub component to support the priority metadata
+type PriorityPubSub struct {
+	pubsub.PubSub
+	mode      string
+	levels    int
+	scheduler *priorityScheduler
+}
+
+// NewPriorityPubSub wraps the component
+func NewPriorityPubSub(comp pubsub.PubSub, config *PriorityConfig) (*PriorityPubSub, error) {
+	p := &PriorityPubSub{PubSub: comp, mode: config.Mode, levels: config.Levels}
+	if p.mode == "" {
+		p.mode = PriorityModeNative
+	}
+	if p.levels <= 0 {
+		p.levels = defaultPriorityLevels
+	}
+	switch p.mode {
+	case PriorityModeNative:
+		return p, nil
+	case PriorityModeTopics:
+	default:
+		return nil, fmt.Errorf("unknown priority mode: %s", p.mode)
+	}
+	weights := config.Weights
+	if len(weights) == 0 {
+		weights = make([]int, p.levels)
+		for i := range weights {
+			weights[i] = 1 << i
+		}
+	}
+	if len(weights) != p.levels {
+		return nil, fmt.Errorf("the number of priority weights %d doesn't match the levels %d", len(weights), p.levels)
+	}
+	for _, w := range weights {
+		if w <= 0 {
+			return nil, fmt.Errorf("priority weights should be positive: %v", weights)
+		}
+	}
+	concurrency := config.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultPriorityConcurrency
+	}
+	p.scheduler = newPriorityScheduler(weights, concurrency)
+	return p, nil
+}
+
+// Publish routes the event to the topic of its priority in topics mode
+func (p *PriorityPubSub) Publish(req *pubsub.PublishRequest) error {
+	level, err := p.priority(req.Metadata)
+	if err != nil {
+		return err
+	}
+	if p.mode == PriorityModeTopics && level > 0 {
+		routed := *req
+		routed.Topic = priorityTopic(req.Topic, level)
+		return p.PubSub.Publish(&routed)
+	}
+	return p.PubSub.Publish(req)
+}
+
+// Subscribe subscribes the topics of all levels in topics mode,
+// and the events are delivered in the order decided by the weights.
+func (p *PriorityPubSub) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	if p.mode != PriorityModeTopics {
+		return p.PubSub.Subscribe(req, handler)
+	}
+	for level := 0; level < p.levels; level++ {
+		level := level
+		sub := req
+		if level > 0 {
+			sub.Topic = priorityTopic(req.Topic, level)
+		}
+		err := p.PubSub.Subscribe(sub, func(ctx context.Context, msg *pubsub.NewMessage) error {
+			if err := p.scheduler.acquire(ctx, level); err != nil {
+				return err
+			}
+			defer p.scheduler.release()
+			// the app sees the original topic
+			msg.Topic = req.Topic
+			if msg.Metadata == nil {
+				msg.Metadata = make(map[string]string, 1)
+			}
+			msg.Metadata[PriorityMetadataKey] = strconv.Itoa(level)
+			return handler(ctx, msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PriorityPubSub) priority(metadata map[string]string) (int, error) {
+	v, ok := metadata[PriorityMetadataKey]
+	if !ok || v == "" {
+		return 0, nil
+	}
+	level, err := strconv.Atoi(v)
+	if err != nil || level < 0 || level >= p.levels {
+		return 0, fmt.Errorf("invalid priority %q, expected 0 ~ %d", v, p.levels-1)
+	}
+	return level, nil
+}
+
+func priorityTopic(topic string, level int) string {
+	return topic + priorityTopicSeparator + strconv.Itoa(level)
+}
+
+// priorityScheduler limits the concurrency of deliveries, and picks the waiting level by weighted round robin
+type priorityScheduler struct {
+	mu      sync.Mutex
+	weights []int
+	credits []int
+	free    int
+	waiters [][]chan struct{}
+}
+
+func newPriorityScheduler(weights []int, concurrency int) *priorityScheduler {
+	return &priorityScheduler{
+		weights: weights,
+		credits: append([]int(nil), weights...),
+		free:    concurrency,
+		waiters: make([][]chan struct{}, len(weights)),
+	}
+}
+
+func (s *priorityScheduler) acquire(ctx context.Context, level int) error {
+	s.mu.Lock()
+	if s.free > 0 && s.noWaiters() {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	s.waiters[level] = append(s.waiters[level], ch)
+	s.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, w := range s.waiters[level] {
+			if w == ch {
+				s.waiters[level] = append(s.waiters[level][:i], s.waiters[level][i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot has been handed over, give it back
+		s.handOver()
+		return ctx.Err()
+	}
+}
+
+func (s *priorityScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOver()
+}
+
+// handOver gives a free slot to the next waiter, the caller must hold the lock
+func (s *priorityScheduler) handOver() {
+	level := s.next()
+	if level < 0 {
+		s.free++
+		return
+	}
+	ch := s.waiters[level][0]
+	s.waiters[level] = s.waiters[level][1:]
+	close(ch)
+}
+
+// next picks the most urgent waiting level which has credits left.
+// The credits are refilled when all the waiting levels run out of them.
+func (s *priorityScheduler) next() int {
+	for round := 0; round < 2; round++ {
+		for level := len(s.waiters) - 1; level >= 0; level-- {
+			if len(s.waiters[level]) > 0 && s.credits[level] > 0 {
+				s.credits[level]--
+				return level
+			}
+		}
+		if s.noWaiters() {
+			return -1
+		}
+		copy(s.credits, s.weights)
+	}
+	return -1
+}
+
+func (s *priorityScheduler) noWaiters() bool {
+	for _, w := range s.waiters {
+		if len(w) > 0 {
+			return false
+		}
+	}
+	return true
+}
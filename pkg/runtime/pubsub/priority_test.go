@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+)
+
+func TestPriorityPubSub(t *testing.T) {
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewPriorityPubSub(nil, &PriorityConfig{Mode: "unknown"})
+		assert.NotNil(t, err)
+		_, err = NewPriorityPubSub(nil, &PriorityConfig{Mode: PriorityModeTopics, Levels: 2, Weights: []int{1}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("native", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewPriorityPubSub(comp, &PriorityConfig{})
+		assert.Nil(t, err)
+		req := &pubsub.PublishRequest{Topic: "topic", Metadata: map[string]string{PriorityMetadataKey: "2"}}
+		comp.EXPECT().Publish(req).Return(nil)
+		assert.Nil(t, p.Publish(req))
+		assert.NotNil(t, p.Publish(&pubsub.PublishRequest{Topic: "topic", Metadata: map[string]string{PriorityMetadataKey: "3"}}))
+	})
+
+	t.Run("topics", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewPriorityPubSub(comp, &PriorityConfig{Mode: PriorityModeTopics, Levels: 2})
+		assert.Nil(t, err)
+		// publish
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			assert.Equal(t, "topic.priority-1", req.Topic)
+			return nil
+		})
+		assert.Nil(t, p.Publish(&pubsub.PublishRequest{Topic: "topic", Metadata: map[string]string{PriorityMetadataKey: "1"}}))
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			assert.Equal(t, "topic", req.Topic)
+			return nil
+		})
+		assert.Nil(t, p.Publish(&pubsub.PublishRequest{Topic: "topic"}))
+		// subscribe
+		handlers := map[string]pubsub.Handler{}
+		comp.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+			handlers[req.Topic] = handler
+			return nil
+		}).Times(2)
+		var received []*pubsub.NewMessage
+		assert.Nil(t, p.Subscribe(pubsub.SubscribeRequest{Topic: "topic"}, func(ctx context.Context, msg *pubsub.NewMessage) error {
+			received = append(received, msg)
+			return nil
+		}))
+		assert.Len(t, handlers, 2)
+		assert.Nil(t, handlers["topic.priority-1"](context.Background(), &pubsub.NewMessage{Topic: "topic.priority-1"}))
+		assert.Len(t, received, 1)
+		assert.Equal(t, "topic", received[0].Topic)
+		assert.Equal(t, "1", received[0].Metadata[PriorityMetadataKey])
+	})
+}
+
+func TestPriorityScheduler(t *testing.T) {
+	s := newPriorityScheduler([]int{1, 2}, 1)
+	assert.Nil(t, s.acquire(context.Background(), 0))
+	// wait in order: 0, 0, 1, 1
+	var order []int
+	done := make(chan int, 4)
+	for _, level := range []int{0, 0, 1, 1} {
+		ch := make(chan struct{})
+		s.mu.Lock()
+		s.waiters[level] = append(s.waiters[level], ch)
+		s.mu.Unlock()
+		go func(level int, ch chan struct{}) {
+			<-ch
+			done <- level
+		}(level, ch)
+	}
+	for i := 0; i < 4; i++ {
+		s.release()
+		order = append(order, <-done)
+	}
+	// the urgent level goes first by its weight
+	assert.Equal(t, []int{1, 1, 0, 0}, order)
+
+	// the slot is free at last
+	s.release()
+	assert.Equal(t, 1, s.free)
+}
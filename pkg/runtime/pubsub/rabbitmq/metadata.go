@@ -0,0 +1,199 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// the keys are compatible with the rabbitmq component of dapr
+const (
+	hostKey               = "host"
+	consumerIDKey         = "consumerID"
+	durableKey            = "durable"
+	deleteWhenUnusedKey   = "deletedWhenUnused"
+	requeueInFailureKey   = "requeueInFailure"
+	deliveryModeKey       = "deliveryMode"
+	prefetchCountKey      = "prefetchCount"
+	enableDeadLetterKey   = "enableDeadLetter"
+	maxLenKey             = "maxLen"
+	maxLenBytesKey        = "maxLenBytes"
+	publisherConfirmKey   = "publisherConfirm"
+	publishTimeoutMsKey   = "publishTimeoutMs"
+	queueTypeKey          = "queueType"
+	deliveryLimitKey      = "deliveryLimit"
+	maxPriorityKey        = "maxPriority"
+	priorityKey           = "priority"
+	queueTypeClassic      = "classic"
+	queueTypeQuorum       = "quorum"
+	defaultPublishTimeout = 5 * time.Second
+)
+
+var ErrHostEmpty = errors.New("rabbitmq host is empty")
+
+type metadata struct {
+	host             string
+	consumerID       string
+	durable          bool
+	deleteWhenUnused bool
+	requeueInFailure bool
+	deliveryMode     uint8
+	prefetchCount    int
+	enableDeadLetter bool
+	maxLen           int64
+	maxLenBytes      int64
+	publisherConfirm bool
+	publishTimeout   time.Duration
+	queueType        string
+	deliveryLimit    int64
+	maxPriority      int64
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		host:             props[hostKey],
+		consumerID:       props[consumerIDKey],
+		durable:          true,
+		publisherConfirm: true,
+		publishTimeout:   defaultPublishTimeout,
+		queueType:        queueTypeClassic,
+	}
+	if m.host == "" {
+		return nil, ErrHostEmpty
+	}
+	var err error
+	parseBool := func(key string, v *bool) {
+		if s, ok := props[key]; ok && s != "" && err == nil {
+			*v, err = strconv.ParseBool(s)
+		}
+	}
+	parseInt := func(key string, v *int64) {
+		if s, ok := props[key]; ok && s != "" && err == nil {
+			*v, err = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	parseBool(durableKey, &m.durable)
+	parseBool(deleteWhenUnusedKey, &m.deleteWhenUnused)
+	parseBool(requeueInFailureKey, &m.requeueInFailure)
+	parseBool(enableDeadLetterKey, &m.enableDeadLetter)
+	parseBool(publisherConfirmKey, &m.publisherConfirm)
+	parseInt(maxLenKey, &m.maxLen)
+	parseInt(maxLenBytesKey, &m.maxLenBytes)
+	parseInt(deliveryLimitKey, &m.deliveryLimit)
+	parseInt(maxPriorityKey, &m.maxPriority)
+	var deliveryMode, prefetch, timeoutMs int64
+	parseInt(deliveryModeKey, &deliveryMode)
+	parseInt(prefetchCountKey, &prefetch)
+	parseInt(publishTimeoutMsKey, &timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq metadata is invalid: %v", err)
+	}
+	if deliveryMode < 0 || deliveryMode > amqp.Persistent {
+		return nil, fmt.Errorf("rabbitmq delivery mode should be 0, 1 or 2: %d", deliveryMode)
+	}
+	m.deliveryMode = uint8(deliveryMode)
+	m.prefetchCount = int(prefetch)
+	if timeoutMs > 0 {
+		m.publishTimeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	if m.maxPriority < 0 || m.maxPriority > 255 {
+		return nil, fmt.Errorf("rabbitmq max priority should be 0 ~ 255: %d", m.maxPriority)
+	}
+	if t := props[queueTypeKey]; t != "" {
+		m.queueType = t
+	}
+	switch m.queueType {
+	case queueTypeClassic:
+	case queueTypeQuorum:
+		// quorum queues are always durable, and don't support priorities
+		if !m.durable || m.deleteWhenUnused {
+			return nil, errors.New("rabbitmq quorum queues should be durable and not deleted when unused")
+		}
+		if m.maxPriority > 0 {
+			return nil, errors.New("rabbitmq quorum queues don't support priorities")
+		}
+	default:
+		return nil, fmt.Errorf("unknown rabbitmq queue type: %s", m.queueType)
+	}
+	return m, nil
+}
+
+// prefetch returns the prefetch count of a subscription, which may be overridden by the subscription metadata
+func (m *metadata) prefetch(subscription map[string]string) (int, error) {
+	s, ok := subscription[prefetchCountKey]
+	if !ok || s == "" {
+		return m.prefetchCount, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rabbitmq prefetch count: %s", s)
+	}
+	return n, nil
+}
+
+// queueArgs returns the arguments declaring the queue
+func (m *metadata) queueArgs(queueName string) amqp.Table {
+	args := amqp.Table{}
+	if m.queueType == queueTypeQuorum {
+		args["x-queue-type"] = queueTypeQuorum
+		if m.deliveryLimit > 0 {
+			args["x-delivery-limit"] = m.deliveryLimit
+		}
+	}
+	if m.enableDeadLetter {
+		args["x-dead-letter-exchange"] = deadLetterExchange(queueName)
+	}
+	if m.maxLen > 0 {
+		args["x-max-length"] = m.maxLen
+	}
+	if m.maxLenBytes > 0 {
+		args["x-max-length-bytes"] = m.maxLenBytes
+	}
+	if m.maxPriority > 0 {
+		args["x-max-priority"] = m.maxPriority
+	}
+	return args
+}
+
+// requeue reports whether a message failed to process should be requeued.
+// The messages are dead-lettered instead if possible, and quorum queues dead-letter them after the delivery limit.
+func (m *metadata) requeue() bool {
+	if m.queueType == queueTypeQuorum && m.deliveryLimit > 0 {
+		return true
+	}
+	if m.enableDeadLetter {
+		return false
+	}
+	return m.requeueInFailure
+}
+
+func queueName(consumerID string, topic string) string {
+	return consumerID + "-" + topic
+}
+
+func deadLetterExchange(queueName string) string {
+	return "dlx-" + queueName
+}
+
+func deadLetterQueue(queueName string) string {
+	return "dlq-" + queueName
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	_, err := parseMetadata(map[string]string{})
+	assert.Equal(t, ErrHostEmpty, err)
+
+	m, err := parseMetadata(map[string]string{hostKey: "amqp://localhost:5672", consumerIDKey: "app"})
+	assert.Nil(t, err)
+	assert.True(t, m.durable)
+	assert.True(t, m.publisherConfirm)
+	assert.Equal(t, defaultPublishTimeout, m.publishTimeout)
+	assert.Equal(t, queueTypeClassic, m.queueType)
+	assert.Empty(t, m.queueArgs("app-topic"))
+
+	m, err = parseMetadata(map[string]string{
+		hostKey:             "amqp://localhost:5672",
+		queueTypeKey:        queueTypeQuorum,
+		deliveryLimitKey:    "5",
+		enableDeadLetterKey: "true",
+		prefetchCountKey:    "10",
+		publishTimeoutMsKey: "100",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 100*time.Millisecond, m.publishTimeout)
+	args := m.queueArgs("app-topic")
+	assert.Equal(t, queueTypeQuorum, args["x-queue-type"])
+	assert.Equal(t, int64(5), args["x-delivery-limit"])
+	assert.Equal(t, "dlx-app-topic", args["x-dead-letter-exchange"])
+	// the broker dead-letters the message after the delivery limit
+	assert.True(t, m.requeue())
+
+	// prefetch count of subscriptions
+	n, err := m.prefetch(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, n)
+	n, err = m.prefetch(map[string]string{prefetchCountKey: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = m.prefetch(map[string]string{prefetchCountKey: "-1"})
+	assert.NotNil(t, err)
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, props := range []map[string]string{
+			{hostKey: "amqp://localhost", queueTypeKey: "stream"},
+			{hostKey: "amqp://localhost", queueTypeKey: queueTypeQuorum, durableKey: "false"},
+			{hostKey: "amqp://localhost", queueTypeKey: queueTypeQuorum, maxPriorityKey: "10"},
+			{hostKey: "amqp://localhost", deliveryModeKey: "3"},
+			{hostKey: "amqp://localhost", durableKey: "yes?"},
+		} {
+			_, err := parseMetadata(props)
+			assert.NotNil(t, err)
+		}
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		m, err := parseMetadata(map[string]string{hostKey: "amqp://localhost", enableDeadLetterKey: "true", requeueInFailureKey: "true"})
+		assert.Nil(t, err)
+		// dead-lettered instead
+		assert.False(t, m.requeue())
+		m, err = parseMetadata(map[string]string{hostKey: "amqp://localhost", requeueInFailureKey: "true"})
+		assert.Nil(t, err)
+		assert.True(t, m.requeue())
+	})
+}
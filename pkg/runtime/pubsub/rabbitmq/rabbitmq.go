@@ -0,0 +1,370 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/streadway/amqp"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	fanoutExchangeKind = "fanout"
+	reconnectInterval  = 3 * time.Second
+)
+
+var (
+	ErrPublishNacked  = errors.New("rabbitmq broker nacked the message")
+	ErrPublishTimeout = errors.New("timeout waiting for the publisher confirm")
+	ErrClosed         = errors.New("rabbitmq component is closed")
+)
+
+// RabbitMQ is a pubsub component, in which every topic is a fanout exchange and
+// every subscription is a queue named "<consumerID>-<topic>" bound to it.
+type RabbitMQ struct {
+	metadata *metadata
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	closed   bool
+	stopCh   chan struct{}
+	declared map[string]bool
+	// the publishing channel is in confirm mode if publisher confirms are enabled
+	pubCh      *amqp.Channel
+	confirms   chan amqp.Confirmation
+	subscribed map[string]*subscription
+}
+
+type subscription struct {
+	queue    string
+	prefetch int
+}
+
+// NewRabbitMQ returns a new rabbitmq pubsub component
+func NewRabbitMQ() pubsub.PubSub {
+	return &RabbitMQ{
+		stopCh:     make(chan struct{}),
+		declared:   make(map[string]bool),
+		subscribed: make(map[string]*subscription),
+	}
+}
+
+func (r *RabbitMQ) Init(md pubsub.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	r.metadata = m
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connect()
+}
+
+func (r *RabbitMQ) Features() []pubsub.Feature {
+	return nil
+}
+
+// connect dials the broker, the caller must hold the lock
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.metadata.host)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.pubCh = nil
+	r.declared = make(map[string]bool)
+	return nil
+}
+
+// publishChannel returns the channel for publishing, the caller must hold the lock
+func (r *RabbitMQ) publishChannel() (*amqp.Channel, error) {
+	if r.closed {
+		return nil, ErrClosed
+	}
+	if r.conn == nil || r.conn.IsClosed() {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if r.pubCh != nil {
+		return r.pubCh, nil
+	}
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if r.metadata.publisherConfirm {
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+	r.pubCh = ch
+	return ch, nil
+}
+
+// Publish sends the message to the exchange of the topic.
+// It waits for the confirm of the broker if publisher confirms are enabled,
+// so the messages are serialized on the publishing channel.
+func (r *RabbitMQ) Publish(req *pubsub.PublishRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, err := r.publishChannel()
+	if err != nil {
+		return err
+	}
+	if err := r.declareExchange(ch, req.Topic); err != nil {
+		r.resetPublishChannel()
+		return err
+	}
+	msg := amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: r.metadata.deliveryMode,
+		Body:         req.Data,
+	}
+	if p := req.Metadata[priorityKey]; p != "" {
+		priority, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid rabbitmq priority: %s", p)
+		}
+		msg.Priority = uint8(priority)
+	}
+	if err := ch.Publish(req.Topic, "", false, false, msg); err != nil {
+		r.resetPublishChannel()
+		return err
+	}
+	if !r.metadata.publisherConfirm {
+		return nil
+	}
+	timer := time.NewTimer(r.metadata.publishTimeout)
+	defer timer.Stop()
+	select {
+	case c, ok := <-r.confirms:
+		if !ok {
+			r.resetPublishChannel()
+			return amqp.ErrClosed
+		}
+		if !c.Ack {
+			return ErrPublishNacked
+		}
+		return nil
+	case <-timer.C:
+		// the late confirm would be mistaken for the next message, so the channel is dropped
+		r.resetPublishChannel()
+		return ErrPublishTimeout
+	}
+}
+
+// resetPublishChannel drops the publishing channel after errors, the caller must hold the lock
+func (r *RabbitMQ) resetPublishChannel() {
+	if r.pubCh != nil {
+		r.pubCh.Close()
+		r.pubCh = nil
+	}
+	r.declared = make(map[string]bool)
+}
+
+func (r *RabbitMQ) declareExchange(ch *amqp.Channel, topic string) error {
+	if r.declared[topic] {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(topic, fanoutExchangeKind, true, false, false, false, nil); err != nil {
+		return err
+	}
+	r.declared[topic] = true
+	return nil
+}
+
+// Subscribe declares the queue of the subscription and consumes it.
+// The prefetch count of the subscription limits the number of messages processed concurrently.
+func (r *RabbitMQ) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	if r.metadata.consumerID == "" {
+		return errors.New("rabbitmq consumerID is empty")
+	}
+	prefetch, err := r.metadata.prefetch(req.Metadata)
+	if err != nil {
+		return err
+	}
+	sub := &subscription{queue: queueName(r.metadata.consumerID, req.Topic), prefetch: prefetch}
+	deliveries, ch, err := r.consume(req.Topic, sub)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.subscribed[req.Topic] = sub
+	r.mu.Unlock()
+	utils.GoWithRecover(func() {
+		r.handleDeliveries(req.Topic, sub, ch, deliveries, handler)
+	}, nil)
+	return nil
+}
+
+// consume declares the exchange, the queue and the dead-letter ones, and starts consuming
+func (r *RabbitMQ) consume(topic string, sub *subscription) (<-chan amqp.Delivery, *amqp.Channel, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, nil, ErrClosed
+	}
+	if r.conn == nil || r.conn.IsClosed() {
+		if err := r.connect(); err != nil {
+			r.mu.Unlock()
+			return nil, nil, err
+		}
+	}
+	conn := r.conn
+	r.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	deliveries, err := r.declareAndConsume(ch, topic, sub)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return deliveries, ch, nil
+}
+
+func (r *RabbitMQ) declareAndConsume(ch *amqp.Channel, topic string, sub *subscription) (<-chan amqp.Delivery, error) {
+	m := r.metadata
+	if err := ch.ExchangeDeclare(topic, fanoutExchangeKind, true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+	if m.enableDeadLetter {
+		dlx := deadLetterExchange(sub.queue)
+		if err := ch.ExchangeDeclare(dlx, fanoutExchangeKind, true, false, false, false, nil); err != nil {
+			return nil, err
+		}
+		dlq := deadLetterQueue(sub.queue)
+		if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+			return nil, err
+		}
+		if err := ch.QueueBind(dlq, "", dlx, false, nil); err != nil {
+			return nil, err
+		}
+	}
+	q, err := ch.QueueDeclare(sub.queue, m.durable, m.deleteWhenUnused, false, false, m.queueArgs(sub.queue))
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.QueueBind(q.Name, "", topic, false, nil); err != nil {
+		return nil, err
+	}
+	if sub.prefetch > 0 {
+		if err := ch.Qos(sub.prefetch, 0, false); err != nil {
+			return nil, err
+		}
+	}
+	return ch.Consume(q.Name, "", false, false, false, false, nil)
+}
+
+func (r *RabbitMQ) handleDeliveries(topic string, sub *subscription, ch *amqp.Channel, deliveries <-chan amqp.Delivery, handler pubsub.Handler) {
+	concurrency := sub.prefetch
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for {
+		for d := range deliveries {
+			sem <- struct{}{}
+			d := d
+			utils.GoWithRecover(func() {
+				defer func() { <-sem }()
+				r.handle(topic, d, handler)
+			}, nil)
+		}
+		ch.Close()
+		// the channel is closed, consume again unless the component is closed
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-time.After(reconnectInterval):
+			}
+			var err error
+			deliveries, ch, err = r.consume(topic, sub)
+			if err == nil {
+				break
+			}
+			log.DefaultLogger.Errorf("[runtime] [pubsub.rabbitmq] consume queue %s error: %v", sub.queue, err)
+		}
+	}
+}
+
+func (r *RabbitMQ) handle(topic string, d amqp.Delivery, handler pubsub.Handler) {
+	md := map[string]string{}
+	if d.Priority > 0 {
+		md[priorityKey] = strconv.Itoa(int(d.Priority))
+	}
+	err := handler(context.Background(), &pubsub.NewMessage{Data: d.Body, Topic: topic, Metadata: md})
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [pubsub.rabbitmq] ack message of topic %s error: %v", topic, err)
+		}
+		return
+	}
+	requeue := r.metadata.requeue()
+	log.DefaultLogger.Warnf("[runtime] [pubsub.rabbitmq] handle message of topic %s error: %v, requeue: %v", topic, err, requeue)
+	if err := d.Nack(false, requeue); err != nil {
+		log.DefaultLogger.Errorf("[runtime] [pubsub.rabbitmq] nack message of topic %s error: %v", topic, err)
+	}
+}
+
+// DescribeSubscription returns the queue of the subscription, so that it's visible in the metadata of the runtime
+func (r *RabbitMQ) DescribeSubscription(topic string) map[string]string {
+	r.mu.Lock()
+	sub, ok := r.subscribed[topic]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	desc := map[string]string{
+		"queue":          sub.queue,
+		"queue_type":     r.metadata.queueType,
+		"prefetch_count": strconv.Itoa(sub.prefetch),
+	}
+	if r.metadata.enableDeadLetter {
+		desc["dead_letter_exchange"] = deadLetterExchange(sub.queue)
+		desc["dead_letter_queue"] = deadLetterQueue(sub.queue)
+	}
+	return desc
+}
+
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.stopCh)
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+)
+
+// ReplayRequest is the range of messages to replay.
+// The time range is used if StartTime isn't zero, otherwise the offset range of the partition is used.
+// Both ranges include the start and exclude the end.
+type ReplayRequest struct {
+	Topic       string
+	StartTime   time.Time
+	EndTime     time.Time
+	Partition   int32
+	StartOffset int64
+	EndOffset   int64
+	Metadata    map[string]string
+}
+
+// ByTime reports whether the messages are replayed by the time range
+func (r *ReplayRequest) ByTime() bool {
+	return !r.StartTime.IsZero()
+}
+
+// Replayer is implemented by the pubsub components of which the broker supports seek, e.g. Kafka.
+type Replayer interface {
+	// Replay reads the messages in the range and calls the handler one by one.
+	// It stops at the first error returned by the handler, and returns the number of messages handled.
+	Replay(ctx context.Context, req *ReplayRequest, handler pubsub.Handler) (int64, error)
+}
+
+// SubscriptionDescriber is implemented by the pubsub components which can describe the subscriptions,
+// e.g. the queue consumed, so that they're visible in the metadata of the runtime.
+type SubscriptionDescriber interface {
+	DescribeSubscription(topic string) map[string]string
+}
+
+// AsReplayer returns the Replayer of the component, looking through the wrappers of the runtime
+func AsReplayer(comp pubsub.PubSub) (Replayer, bool) {
+	r, ok := Unwrap(comp).(Replayer)
+	return r, ok
+}
+
+// Unwrap returns the component wrapped by the runtime
+func Unwrap(comp pubsub.PubSub) pubsub.PubSub {
+	if async, ok := comp.(*AsyncPubSub); ok {
+		comp = async.PubSub
+	}
+	if transform, ok := comp.(*TransformPubSub); ok {
+		comp = transform.PubSub
+	}
+	if deadLetter, ok := comp.(*DeadLetterPubSub); ok {
+		comp = deadLetter.PubSub
+	}
+	if priority, ok := comp.(*PriorityPubSub); ok {
+		comp = priority.PubSub
+	}
+	return comp
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snssqs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// the keys are compatible with the snssqs component of dapr
+const (
+	accessKeyKey                = "accessKey"
+	secretKeyKey                = "secretKey"
+	sessionTokenKey             = "sessionToken"
+	regionKey                   = "region"
+	endpointKey                 = "endpoint"
+	consumerIDKey               = "consumerID"
+	messageVisibilityTimeoutKey = "messageVisibilityTimeout"
+	messageRetryLimitKey        = "messageRetryLimit"
+	messageWaitTimeSecondsKey   = "messageWaitTimeSeconds"
+	messageMaxNumberKey         = "messageMaxNumber"
+	fifoKey                     = "fifo"
+	fifoMessageGroupIDKey       = "fifoMessageGroupID"
+
+	// the metadata of publish requests
+	messageGroupIDKey         = "messageGroupId"
+	messageDeduplicationIDKey = "messageDeduplicationId"
+	partitionKeyKey           = "partitionKey"
+
+	fifoSuffix                      = ".fifo"
+	defaultMessageVisibilityTimeout = 10
+	defaultMessageRetryLimit        = 10
+	defaultMessageWaitTimeSeconds   = 1
+	defaultMessageMaxNumber         = 10
+	defaultMessageGroupID           = "default"
+)
+
+var (
+	ErrRegionEmpty = errors.New("snssqs region is empty")
+	invalidNameRe  = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+type metadata struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	endpoint     string
+	consumerID   string
+	// the seconds a received message is invisible to other consumers
+	messageVisibilityTimeout int64
+	// the messages received more than the limit are deleted
+	messageRetryLimit      int64
+	messageWaitTimeSeconds int64
+	messageMaxNumber       int64
+	// the topics are FIFO topics and the queues are FIFO queues
+	fifo               bool
+	fifoMessageGroupID string
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		accessKey:                props[accessKeyKey],
+		secretKey:                props[secretKeyKey],
+		sessionToken:             props[sessionTokenKey],
+		region:                   props[regionKey],
+		endpoint:                 props[endpointKey],
+		consumerID:               props[consumerIDKey],
+		messageVisibilityTimeout: defaultMessageVisibilityTimeout,
+		messageRetryLimit:        defaultMessageRetryLimit,
+		messageWaitTimeSeconds:   defaultMessageWaitTimeSeconds,
+		messageMaxNumber:         defaultMessageMaxNumber,
+		fifoMessageGroupID:       defaultMessageGroupID,
+	}
+	if m.region == "" {
+		return nil, ErrRegionEmpty
+	}
+	var err error
+	parseInt := func(key string, v *int64) {
+		if s := props[key]; s != "" && err == nil {
+			*v, err = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	parseInt(messageVisibilityTimeoutKey, &m.messageVisibilityTimeout)
+	parseInt(messageRetryLimitKey, &m.messageRetryLimit)
+	parseInt(messageWaitTimeSecondsKey, &m.messageWaitTimeSeconds)
+	parseInt(messageMaxNumberKey, &m.messageMaxNumber)
+	if s := props[fifoKey]; s != "" && err == nil {
+		m.fifo, err = strconv.ParseBool(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snssqs metadata is invalid: %v", err)
+	}
+	if err := validVisibilityTimeout(m.messageVisibilityTimeout); err != nil {
+		return nil, err
+	}
+	if m.messageWaitTimeSeconds < 0 || m.messageWaitTimeSeconds > 20 {
+		return nil, fmt.Errorf("snssqs message wait time should be 0 ~ 20 seconds: %d", m.messageWaitTimeSeconds)
+	}
+	if m.messageMaxNumber < 1 || m.messageMaxNumber > 10 {
+		return nil, fmt.Errorf("snssqs message max number should be 1 ~ 10: %d", m.messageMaxNumber)
+	}
+	if g := props[fifoMessageGroupIDKey]; g != "" {
+		m.fifoMessageGroupID = g
+	}
+	return m, nil
+}
+
+// visibilityTimeout returns the visibility timeout of a subscription, which may be overridden by the subscription metadata
+func (m *metadata) visibilityTimeout(subscription map[string]string) (int64, error) {
+	s := subscription[messageVisibilityTimeoutKey]
+	if s == "" {
+		return m.messageVisibilityTimeout, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snssqs message visibility timeout: %s", s)
+	}
+	return n, validVisibilityTimeout(n)
+}
+
+// messageGroupID returns the group of a message published to the FIFO topic
+func (m *metadata) messageGroupID(md map[string]string) string {
+	if g := md[messageGroupIDKey]; g != "" {
+		return g
+	}
+	if g := md[partitionKeyKey]; g != "" {
+		return g
+	}
+	return m.fifoMessageGroupID
+}
+
+func (m *metadata) topicName(topic string) string {
+	return m.entityName(topic)
+}
+
+func (m *metadata) queueName(topic string) string {
+	return m.entityName(m.consumerID + "-" + topic)
+}
+
+// entityName replaces the characters not allowed in the names of topics and queues
+func (m *metadata) entityName(name string) string {
+	name = invalidNameRe.ReplaceAllString(name, "-")
+	if m.fifo {
+		name += fifoSuffix
+	}
+	return name
+}
+
+func validVisibilityTimeout(n int64) error {
+	// the max visibility timeout of sqs is 12 hours
+	if n < 0 || n > 43200 {
+		return fmt.Errorf("snssqs message visibility timeout should be 0 ~ 43200 seconds: %d", n)
+	}
+	return nil
+}
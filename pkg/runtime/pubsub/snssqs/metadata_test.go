@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snssqs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	_, err := parseMetadata(map[string]string{})
+	assert.Equal(t, ErrRegionEmpty, err)
+
+	m, err := parseMetadata(map[string]string{regionKey: "us-east-1", consumerIDKey: "app"})
+	assert.Nil(t, err)
+	assert.False(t, m.fifo)
+	assert.Equal(t, int64(defaultMessageVisibilityTimeout), m.messageVisibilityTimeout)
+	assert.Equal(t, "app-orders", m.queueName("orders"))
+	assert.Equal(t, "orders-v1", m.topicName("orders.v1"))
+
+	m, err = parseMetadata(map[string]string{
+		regionKey:                   "us-east-1",
+		consumerIDKey:               "app",
+		fifoKey:                     "true",
+		fifoMessageGroupIDKey:       "group",
+		messageVisibilityTimeoutKey: "30",
+	})
+	assert.Nil(t, err)
+	assert.True(t, m.fifo)
+	assert.Equal(t, "app-orders.fifo", m.queueName("orders"))
+	assert.Equal(t, "orders.fifo", m.topicName("orders"))
+
+	// the message group
+	assert.Equal(t, "user-1", m.messageGroupID(map[string]string{messageGroupIDKey: "user-1", partitionKeyKey: "p"}))
+	assert.Equal(t, "p", m.messageGroupID(map[string]string{partitionKeyKey: "p"}))
+	assert.Equal(t, "group", m.messageGroupID(nil))
+
+	// the visibility timeout of subscriptions
+	timeout, err := m.visibilityTimeout(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), timeout)
+	timeout, err = m.visibilityTimeout(map[string]string{messageVisibilityTimeoutKey: "120"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), timeout)
+	_, err = m.visibilityTimeout(map[string]string{messageVisibilityTimeoutKey: "43201"})
+	assert.NotNil(t, err)
+
+	_, err = parseMetadata(map[string]string{regionKey: "us-east-1", messageMaxNumberKey: "11"})
+	assert.NotNil(t, err)
+	_, err = parseMetadata(map[string]string{regionKey: "us-east-1", fifoKey: "yes"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,335 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snssqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/dapr/components-contrib/pubsub"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	receiveCountAttribute   = sqs.MessageSystemAttributeNameApproximateReceiveCount
+	messageGroupIDAttribute = sqs.MessageSystemAttributeNameMessageGroupId
+	retryInterval           = 3 * time.Second
+)
+
+// the policy allowing the sns topic to send messages to the sqs queue
+const queuePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "sns.amazonaws.com"},
+    "Action": "sqs:SendMessage",
+    "Resource": "%s",
+    "Condition": {"ArnEquals": {"aws:SourceArn": "%s"}}
+  }]
+}`
+
+// SnsSqs is a pubsub component in which every topic is a sns topic, and every subscription is a sqs queue
+// named "<consumerID>-<topic>" subscribed to it with raw message delivery.
+// If fifo is enabled, the topics and queues are FIFO ones, and the messages of a group are handled one by one in order.
+type SnsSqs struct {
+	metadata *metadata
+	sns      *sns.SNS
+	sqs      *sqs.SQS
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu         sync.Mutex
+	topicArns  map[string]string
+	subscribed map[string]*subscription
+}
+
+type subscription struct {
+	queue             string
+	queueURL          string
+	visibilityTimeout int64
+}
+
+// NewSnsSqs returns a new snssqs pubsub component
+func NewSnsSqs() pubsub.PubSub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SnsSqs{
+		ctx:        ctx,
+		cancel:     cancel,
+		topicArns:  make(map[string]string),
+		subscribed: make(map[string]*subscription),
+	}
+}
+
+func (s *SnsSqs) Init(md pubsub.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	s.metadata = m
+	cfg := aws.NewConfig().WithRegion(m.region)
+	if m.endpoint != "" {
+		cfg = cfg.WithEndpoint(m.endpoint)
+	}
+	if m.accessKey != "" {
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(m.accessKey, m.secretKey, m.sessionToken))
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return err
+	}
+	s.sns = sns.New(sess)
+	s.sqs = sqs.New(sess)
+	return nil
+}
+
+func (s *SnsSqs) Features() []pubsub.Feature {
+	return nil
+}
+
+// SupportPartitionOrdering reports whether the messages of a group are delivered in order, which requires FIFO topics
+func (s *SnsSqs) SupportPartitionOrdering() bool {
+	return s.metadata.fifo
+}
+
+// topicArn returns the arn of the sns topic, creating it if it doesn't exist
+func (s *SnsSqs) topicArn(topic string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if arn, ok := s.topicArns[topic]; ok {
+		return arn, nil
+	}
+	input := &sns.CreateTopicInput{Name: aws.String(s.metadata.topicName(topic))}
+	if s.metadata.fifo {
+		input.Attributes = map[string]*string{
+			"FifoTopic":                 aws.String("true"),
+			"ContentBasedDeduplication": aws.String("true"),
+		}
+	}
+	// creating a topic is idempotent, the arn of the existing topic is returned
+	out, err := s.sns.CreateTopicWithContext(s.ctx, input)
+	if err != nil {
+		return "", err
+	}
+	s.topicArns[topic] = aws.StringValue(out.TopicArn)
+	return s.topicArns[topic], nil
+}
+
+// Publish sends the message to the sns topic.
+// For FIFO topics, the group of the message is the "messageGroupId" metadata, or the "partitionKey" metadata,
+// or fifoMessageGroupID, and the duplicates are detected by the "messageDeduplicationId" metadata or the content.
+func (s *SnsSqs) Publish(req *pubsub.PublishRequest) error {
+	arn, err := s.topicArn(req.Topic)
+	if err != nil {
+		return err
+	}
+	input := &sns.PublishInput{
+		TopicArn: aws.String(arn),
+		Message:  aws.String(string(req.Data)),
+	}
+	if s.metadata.fifo {
+		input.MessageGroupId = aws.String(s.metadata.messageGroupID(req.Metadata))
+		if id := req.Metadata[messageDeduplicationIDKey]; id != "" {
+			input.MessageDeduplicationId = aws.String(id)
+		}
+	}
+	_, err = s.sns.PublishWithContext(s.ctx, input)
+	return err
+}
+
+// Subscribe creates the sqs queue of the subscription, subscribes it to the topic and receives the messages.
+// The "messageVisibilityTimeout" metadata of the subscription overrides the one of the component.
+func (s *SnsSqs) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	if s.metadata.consumerID == "" {
+		return errors.New("snssqs consumerID is empty")
+	}
+	timeout, err := s.metadata.visibilityTimeout(req.Metadata)
+	if err != nil {
+		return err
+	}
+	arn, err := s.topicArn(req.Topic)
+	if err != nil {
+		return err
+	}
+	sub := &subscription{queue: s.metadata.queueName(req.Topic), visibilityTimeout: timeout}
+	if sub.queueURL, err = s.createQueue(sub.queue, arn); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.subscribed[req.Topic] = sub
+	s.mu.Unlock()
+	utils.GoWithRecover(func() {
+		s.receive(req.Topic, sub, handler)
+	}, nil)
+	return nil
+}
+
+// createQueue creates the sqs queue, allows the topic to send messages to it and subscribes it to the topic
+func (s *SnsSqs) createQueue(name string, topicArn string) (string, error) {
+	input := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+	if s.metadata.fifo {
+		input.Attributes = map[string]*string{
+			sqs.QueueAttributeNameFifoQueue:                 aws.String("true"),
+			sqs.QueueAttributeNameContentBasedDeduplication: aws.String("true"),
+		}
+	}
+	out, err := s.sqs.CreateQueueWithContext(s.ctx, input)
+	if err != nil {
+		return "", err
+	}
+	queueURL := aws.StringValue(out.QueueUrl)
+	attrs, err := s.sqs.GetQueueAttributesWithContext(s.ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       out.QueueUrl,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+	})
+	if err != nil {
+		return "", err
+	}
+	queueArn := aws.StringValue(attrs.Attributes[sqs.QueueAttributeNameQueueArn])
+	_, err = s.sqs.SetQueueAttributesWithContext(s.ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl: out.QueueUrl,
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNamePolicy: aws.String(fmt.Sprintf(queuePolicy, queueArn, topicArn)),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	// subscribing is idempotent for the same attributes
+	_, err = s.sns.SubscribeWithContext(s.ctx, &sns.SubscribeInput{
+		TopicArn:   aws.String(topicArn),
+		Protocol:   aws.String("sqs"),
+		Endpoint:   aws.String(queueArn),
+		Attributes: map[string]*string{"RawMessageDelivery": aws.String("true")},
+	})
+	if err != nil {
+		return "", err
+	}
+	return queueURL, nil
+}
+
+func (s *SnsSqs) receive(topic string, sub *subscription, handler pubsub.Handler) {
+	for {
+		out, err := s.sqs.ReceiveMessageWithContext(s.ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(sub.queueURL),
+			MaxNumberOfMessages: aws.Int64(s.metadata.messageMaxNumber),
+			VisibilityTimeout:   aws.Int64(sub.visibilityTimeout),
+			WaitTimeSeconds:     aws.Int64(s.metadata.messageWaitTimeSeconds),
+			AttributeNames:      aws.StringSlice([]string{receiveCountAttribute, messageGroupIDAttribute}),
+		})
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			log.DefaultLogger.Errorf("[runtime] [pubsub.snssqs] receive from queue %s error: %v", sub.queue, err)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		s.handleBatch(topic, sub, out.Messages, handler)
+	}
+}
+
+// handleBatch handles the messages concurrently, except that the messages of a FIFO group are handled in order.
+// A failed message of a group stops the later ones, which are received again after the visibility timeout.
+func (s *SnsSqs) handleBatch(topic string, sub *subscription, messages []*sqs.Message, handler pubsub.Handler) {
+	groups := make(map[string][]*sqs.Message)
+	var order []string
+	for i, msg := range messages {
+		group := strconv.Itoa(i)
+		if s.metadata.fifo {
+			group = aws.StringValue(msg.Attributes[messageGroupIDAttribute])
+		}
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], msg)
+	}
+	var wg sync.WaitGroup
+	for _, group := range order {
+		msgs := groups[group]
+		wg.Add(1)
+		utils.GoWithRecover(func() {
+			defer wg.Done()
+			for _, msg := range msgs {
+				if !s.handle(topic, sub, msg, handler) {
+					return
+				}
+			}
+		}, nil)
+	}
+	wg.Wait()
+}
+
+// handle reports whether the message is done, i.e. handled or dropped after the retry limit
+func (s *SnsSqs) handle(topic string, sub *subscription, msg *sqs.Message, handler pubsub.Handler) bool {
+	md := map[string]string{}
+	if g := aws.StringValue(msg.Attributes[messageGroupIDAttribute]); g != "" {
+		md[messageGroupIDKey] = g
+	}
+	receiveCount, _ := strconv.ParseInt(aws.StringValue(msg.Attributes[receiveCountAttribute]), 10, 64)
+	err := handler(s.ctx, &pubsub.NewMessage{Data: []byte(aws.StringValue(msg.Body)), Topic: topic, Metadata: md})
+	if err != nil {
+		if s.metadata.messageRetryLimit <= 0 || receiveCount < s.metadata.messageRetryLimit {
+			log.DefaultLogger.Warnf("[runtime] [pubsub.snssqs] handle message %s of queue %s error: %v", aws.StringValue(msg.MessageId), sub.queue, err)
+			return false
+		}
+		log.DefaultLogger.Errorf("[runtime] [pubsub.snssqs] drop message %s of queue %s after %d receives: %v", aws.StringValue(msg.MessageId), sub.queue, receiveCount, err)
+	}
+	_, err = s.sqs.DeleteMessageWithContext(s.ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(sub.queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [pubsub.snssqs] delete message %s of queue %s error: %v", aws.StringValue(msg.MessageId), sub.queue, err)
+		return false
+	}
+	return true
+}
+
+// DescribeSubscription returns the queue of the subscription, so that it's visible in the metadata of the runtime
+func (s *SnsSqs) DescribeSubscription(topic string) map[string]string {
+	s.mu.Lock()
+	sub, ok := s.subscribed[topic]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return map[string]string{
+		"queue":              sub.queue,
+		"queue_url":          sub.queueURL,
+		"fifo":               strconv.FormatBool(s.metadata.fifo),
+		"visibility_timeout": strconv.FormatInt(sub.visibilityTimeout, 10),
+	}
+}
+
+func (s *SnsSqs) Close() error {
+	s.cancel()
+	return nil
+}
@@ -18,6 +18,8 @@ package pubsub
 
 import (
 	"context"
+
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/emptypb"
 	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 	"mosn.io/pkg/log"
@@ -34,3 +36,33 @@ func ListTopicSubscriptions(client runtimev1pb.AppCallbackClient, log log.ErrorL
 	}
 	return make([]*runtimev1pb.TopicSubscription, 0)
 }
+
+// declaredSubscriptions lists the declarative subscriptions besides the ones listed by the app
+type declaredSubscriptions struct {
+	runtimev1pb.AppCallbackClient
+	subscriptions []Subscription
+}
+
+// WithSubscriptions returns the client listing the declarative subscriptions besides the ones listed by the app,
+// the subscriptions declared are kept even if the app fails to list its own ones.
+func WithSubscriptions(client runtimev1pb.AppCallbackClient, subscriptions []Subscription) runtimev1pb.AppCallbackClient {
+	return &declaredSubscriptions{AppCallbackClient: client, subscriptions: subscriptions}
+}
+
+func (c *declaredSubscriptions) ListTopicSubscriptions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*runtimev1pb.ListTopicSubscriptionsResponse, error) {
+	resp, err := c.AppCallbackClient.ListTopicSubscriptions(ctx, in, opts...)
+	if err != nil {
+		log.DefaultLogger.Warnf("[runtime][ListTopicSubscriptions]app failed to list the subscriptions, only the declared ones are subscribed: %s", err)
+		resp = &runtimev1pb.ListTopicSubscriptionsResponse{}
+	} else if resp == nil {
+		resp = &runtimev1pb.ListTopicSubscriptionsResponse{}
+	}
+	for _, s := range c.subscriptions {
+		resp.Subscriptions = append(resp.Subscriptions, &runtimev1pb.TopicSubscription{
+			PubsubName: s.PubsubName,
+			Topic:      s.Topic,
+			Metadata:   s.Metadata,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+	mock_appcallback "mosn.io/layotto/pkg/mock/runtime/appcallback"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestWithSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	app := mock_appcallback.NewMockAppCallbackClient(ctrl)
+	client := WithSubscriptions(app, []Subscription{{PubsubName: "mock", Topic: "audit"}})
+
+	app.EXPECT().ListTopicSubscriptions(gomock.Any(), gomock.Any()).Return(&runtimev1pb.ListTopicSubscriptionsResponse{
+		Subscriptions: []*runtimev1pb.TopicSubscription{
+			{PubsubName: "mock", Topic: "orders"},
+		},
+	}, nil)
+	resp, err := client.ListTopicSubscriptions(context.Background(), &emptypb.Empty{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Subscriptions, 2)
+	assert.Equal(t, "audit", resp.Subscriptions[1].Topic)
+
+	// the declared subscriptions are kept if the app fails
+	app.EXPECT().ListTopicSubscriptions(gomock.Any(), gomock.Any()).Return(nil, errors.New("unimplemented"))
+	resp, err = client.ListTopicSubscriptions(context.Background(), &emptypb.Empty{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Subscriptions, 1)
+	assert.Equal(t, "audit", resp.Subscriptions[0].Topic)
+}
@@ -0,0 +1,522 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/contenttype"
+	"github.com/dapr/components-contrib/pubsub"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/jsonpath"
+)
+
+// The types of transformation steps
+const (
+	TransformMap     = "map"
+	TransformRedact  = "redact"
+	TransformConvert = "convert"
+)
+
+// The modes of redact steps
+const (
+	RedactRemove = "remove"
+	RedactMask   = "mask"
+	RedactHash   = "hash"
+)
+
+const (
+	// TransformAllTopics matches the topics without their own steps
+	TransformAllTopics = "*"
+
+	formContentType    = "application/x-www-form-urlencoded"
+	defaultRedactMask  = "****"
+	hashedValuePrefix  = "hmac-sha256:"
+	jsonContentType    = "application/json"
+	transformLogPrefix = "[runtime] [pubsub.transform]"
+)
+
+// TransformConfig is the config of the transformation of event data, so that e.g. PII is scrubbed without changing the apps.
+// The steps are keyed by topics, and the ones of TransformAllTopics are used for the other topics.
+type TransformConfig struct {
+	// Publish are the steps applied to the events published by the app, before they are sent to the broker
+	Publish map[string][]*TransformStep `json:"publish,omitempty"`
+	// Subscribe are the steps applied to the events of subscriptions, before they are delivered to the app
+	Subscribe map[string][]*TransformStep `json:"subscribe,omitempty"`
+	// DeadLetterTopic is where the events of subscriptions which fail to be transformed are republished,
+	// in which "{topic}" is replaced by the topic of the event. They're dropped if it's empty.
+	DeadLetterTopic string `json:"dead_letter_topic,omitempty"`
+}
+
+// TransformStep is a step of transformation. The data is transformed by the steps in order.
+type TransformStep struct {
+	// Type is map, redact or convert
+	Type string `json:"type"`
+	// Fields maps the JSONPaths of the fields to the JSONPaths of the values in map steps
+	Fields map[string]string `json:"fields,omitempty"`
+	// KeepUnmapped keeps the other fields in map steps, otherwise the data only has the mapped fields
+	KeepUnmapped bool `json:"keep_unmapped,omitempty"`
+	// Paths are the JSONPaths of the fields redacted in redact steps
+	Paths []string `json:"paths,omitempty"`
+	// Mode is remove (default), mask or hash in redact steps.
+	// The hash mode replaces the values with their HMAC-SHA256 keyed by HashKey, so the events can still be correlated.
+	Mode string `json:"mode,omitempty"`
+	// HashKey is the key of the HMAC in the hash mode, which is required.
+	// It should be kept secret, otherwise the low-entropy values can be found by brute force.
+	HashKey string `json:"hash_key,omitempty"`
+	// Mask replaces the values in the mask mode, `****` by default
+	Mask string `json:"mask,omitempty"`
+	// To is the content type converted to in convert steps, application/json or application/x-www-form-urlencoded
+	To string `json:"to,omitempty"`
+}
+
+// transformer transforms the data of events
+type transformer interface {
+	// transform transforms the decoded data, and returns the new data and its content type
+	transform(doc interface{}, contentType string) (interface{}, string, error)
+}
+
+// pipeline is the transformers of a topic
+type pipeline []transformer
+
+// TransformPubSub wraps a pubsub component to transform the data of events
+type TransformPubSub struct {
+	pubsub.PubSub
+	publish         map[string]pipeline
+	subscribe       map[string]pipeline
+	deadLetterTopic string
+}
+
+// NewTransformPubSub wraps the component, it returns error if the config is invalid
+func NewTransformPubSub(comp pubsub.PubSub, config *TransformConfig) (*TransformPubSub, error) {
+	t := &TransformPubSub{PubSub: comp, deadLetterTopic: config.DeadLetterTopic}
+	if t.deadLetterTopic == DeadLetterTopicPlaceholder {
+		return nil, fmt.Errorf("the dead-letter topic %s is the same as the topic of the events", t.deadLetterTopic)
+	}
+	var err error
+	if t.publish, err = newPipelines(config.Publish); err != nil {
+		return nil, fmt.Errorf("invalid publish transformation: %v", err)
+	}
+	if t.subscribe, err = newPipelines(config.Subscribe); err != nil {
+		return nil, fmt.Errorf("invalid subscribe transformation: %v", err)
+	}
+	return t, nil
+}
+
+// Publish transforms the data of the event before it's sent to the broker
+func (t *TransformPubSub) Publish(req *pubsub.PublishRequest) error {
+	p := pipelineOf(t.publish, req.Topic)
+	if p == nil {
+		return t.PubSub.Publish(req)
+	}
+	data, err := p.transformEnvelope(req.Data)
+	if err != nil {
+		return fmt.Errorf("transform the event of topic %s failed: %v", req.Topic, err)
+	}
+	transformed := *req
+	transformed.Data = data
+	return t.PubSub.Publish(&transformed)
+}
+
+// Subscribe transforms the data of events before they are delivered to the app.
+// The events which fail to be transformed are not delivered, so that the data which should be scrubbed never reaches the app.
+// Such failures are permanent, so the events are dead-lettered or dropped instead of being redelivered by the broker.
+func (t *TransformPubSub) Subscribe(req pubsub.SubscribeRequest, handler pubsub.Handler) error {
+	p := pipelineOf(t.subscribe, req.Topic)
+	if p == nil {
+		return t.PubSub.Subscribe(req, handler)
+	}
+	deadLetterTopic := strings.ReplaceAll(t.deadLetterTopic, DeadLetterTopicPlaceholder, req.Topic)
+	if deadLetterTopic != "" && deadLetterTopic == req.Topic {
+		return fmt.Errorf("the dead-letter topic of topic %s is itself", req.Topic)
+	}
+	return t.PubSub.Subscribe(req, func(ctx context.Context, msg *pubsub.NewMessage) error {
+		data, err := p.transformEnvelope(msg.Data)
+		if err != nil {
+			return t.reject(deadLetterTopic, req.Topic, msg, err)
+		}
+		transformed := *msg
+		transformed.Data = data
+		return handler(ctx, &transformed)
+	})
+}
+
+// reject dead-letters the event which fails to be transformed, or drops it if there's no dead-letter topic.
+// The error is returned to the broker only if the dead-lettering fails, so the event is redelivered.
+func (t *TransformPubSub) reject(deadLetterTopic string, topic string, msg *pubsub.NewMessage, cause error) error {
+	if deadLetterTopic == "" {
+		log.DefaultLogger.Errorf("%s the event of topic %s is dropped since the transformation failed: %v", transformLogPrefix, topic, cause)
+		return nil
+	}
+	failure := map[string]string{
+		DeadLetterTopicKey: topic,
+		DeadLetterErrorKey: cause.Error(),
+		DeadLetterTimeKey:  time.Now().UTC().Format(time.RFC3339),
+	}
+	// published to the wrapped component, so the event isn't transformed again
+	err := t.PubSub.Publish(&pubsub.PublishRequest{
+		Data:     withExtensions(msg.Data, failure),
+		Topic:    deadLetterTopic,
+		Metadata: failure,
+	})
+	if err != nil {
+		log.DefaultLogger.Errorf("%s dead-letter the event of topic %s to %s failed: %v", transformLogPrefix, topic, deadLetterTopic, err)
+		return err
+	}
+	log.DefaultLogger.Warnf("%s the event of topic %s is dead-lettered to %s since the transformation failed: %v", transformLogPrefix, topic, deadLetterTopic, cause)
+	return nil
+}
+
+func pipelineOf(pipelines map[string]pipeline, topic string) pipeline {
+	if p, ok := pipelines[topic]; ok {
+		return p
+	}
+	return pipelines[TransformAllTopics]
+}
+
+func newPipelines(steps map[string][]*TransformStep) (map[string]pipeline, error) {
+	pipelines := make(map[string]pipeline, len(steps))
+	for topic, topicSteps := range steps {
+		p := make(pipeline, 0, len(topicSteps))
+		for i, s := range topicSteps {
+			tr, err := newTransformer(s)
+			if err != nil {
+				return nil, fmt.Errorf("topic %s step %d: %v", topic, i, err)
+			}
+			p = append(p, tr)
+		}
+		pipelines[topic] = p
+	}
+	return pipelines, nil
+}
+
+func newTransformer(s *TransformStep) (transformer, error) {
+	switch s.Type {
+	case TransformMap:
+		return newMapper(s)
+	case TransformRedact:
+		return newRedactor(s)
+	case TransformConvert:
+		if s.To != jsonContentType && s.To != formContentType {
+			return nil, fmt.Errorf("can't convert to content type %q", s.To)
+		}
+		return converter(s.To), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", s.Type)
+}
+
+// transformEnvelope transforms the data in the cloud event, which is in json or protobuf format
+func (p pipeline) transformEnvelope(b []byte) ([]byte, error) {
+	if IsProtoCloudEvent(b) {
+		ce, err := UnmarshalProtoCloudEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		if ce.Data, ce.DataContentType, err = p.transformData(ce.Data, ce.DataContentType); err != nil {
+			return nil, err
+		}
+		return MarshalProtoCloudEvent(ce, nil, nil), nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	var ct string
+	if raw, ok := fields[pubsub.DataContentTypeField]; ok {
+		if err := json.Unmarshal(raw, &ct); err != nil {
+			return nil, err
+		}
+	}
+	data, err := envelopeData(fields, ct)
+	if err != nil {
+		return nil, err
+	}
+	if data, ct, err = p.transformData(data, ct); err != nil {
+		return nil, err
+	}
+	delete(fields, pubsub.DataField)
+	delete(fields, pubsub.DataBase64Field)
+	fields[pubsub.DataContentTypeField], _ = marshalJSON(ct)
+	if contenttype.IsJSONContentType(ct) {
+		fields[pubsub.DataField] = data
+	} else {
+		fields[pubsub.DataField], _ = marshalJSON(string(data))
+	}
+	return marshalJSON(fields)
+}
+
+// marshalJSON is like json.Marshal but doesn't escape the html characters in the data
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// envelopeData returns the data of the cloud event in json format
+func envelopeData(fields map[string]json.RawMessage, contentType string) ([]byte, error) {
+	if raw, ok := fields[pubsub.DataBase64Field]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+	raw, ok := fields[pubsub.DataField]
+	if !ok {
+		return nil, nil
+	}
+	if contenttype.IsJSONContentType(contentType) {
+		return raw, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		// the data of the events published as cloud events by the app may be json without content type
+		return raw, nil
+	}
+	return []byte(s), nil
+}
+
+// transformData decodes the data, runs the transformers and encodes the result
+func (p pipeline) transformData(data []byte, contentType string) ([]byte, string, error) {
+	if contentType == "" {
+		contentType = jsonContentType
+	}
+	doc, err := decodeData(data, contentType)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, t := range p {
+		if doc, contentType, err = t.transform(doc, contentType); err != nil {
+			return nil, "", err
+		}
+	}
+	data, err = encodeData(doc, contentType)
+	return data, contentType, err
+}
+
+func decodeData(data []byte, contentType string) (interface{}, error) {
+	switch {
+	case contenttype.IsJSONContentType(contentType):
+		var doc interface{}
+		d := json.NewDecoder(bytes.NewReader(data))
+		// keep the numbers as they are
+		d.UseNumber()
+		if err := d.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid json data: %v", err)
+		}
+		return doc, nil
+	case isFormContentType(contentType):
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid form data: %v", err)
+		}
+		doc := make(map[string]interface{}, len(values))
+		for k, vs := range values {
+			if len(vs) == 1 {
+				doc[k] = vs[0]
+				continue
+			}
+			arr := make([]interface{}, len(vs))
+			for i, v := range vs {
+				arr[i] = v
+			}
+			doc[k] = arr
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("can't transform the data of content type %q", contentType)
+}
+
+func encodeData(doc interface{}, contentType string) ([]byte, error) {
+	if contenttype.IsJSONContentType(contentType) {
+		return marshalJSON(doc)
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("only objects can be converted to %s", formContentType)
+	}
+	values := make(url.Values, len(obj))
+	for k, v := range obj {
+		if arr, ok := v.([]interface{}); ok {
+			for _, e := range arr {
+				values.Add(k, formValue(e))
+			}
+			continue
+		}
+		values.Set(k, formValue(v))
+	}
+	return []byte(values.Encode()), nil
+}
+
+func formValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	}
+	b, _ := marshalJSON(v)
+	return string(b)
+}
+
+func isFormContentType(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), formContentType)
+}
+
+// mapper builds the data from the fields of the original one
+type mapper struct {
+	targets      []*jsonpath.Path
+	sources      []*jsonpath.Path
+	keepUnmapped bool
+}
+
+func newMapper(s *TransformStep) (*mapper, error) {
+	if len(s.Fields) == 0 {
+		return nil, fmt.Errorf("no fields to map")
+	}
+	m := &mapper{keepUnmapped: s.KeepUnmapped}
+	// sorted, so that the result is stable if the targets overlap
+	targets := make([]string, 0, len(s.Fields))
+	for target := range s.Fields {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		tp, err := jsonpath.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		if !tp.Definite() {
+			return nil, fmt.Errorf("the target jsonpath %s should be definite", target)
+		}
+		sp, err := jsonpath.Parse(s.Fields[target])
+		if err != nil {
+			return nil, err
+		}
+		m.targets = append(m.targets, tp)
+		m.sources = append(m.sources, sp)
+	}
+	return m, nil
+}
+
+func (m *mapper) transform(doc interface{}, contentType string) (interface{}, string, error) {
+	var result interface{}
+	if m.keepUnmapped {
+		result = doc
+	}
+	for i, target := range m.targets {
+		values := m.sources[i].Get(doc)
+		if len(values) == 0 {
+			continue
+		}
+		var v interface{} = values
+		if m.sources[i].Definite() {
+			v = values[0]
+		}
+		var err error
+		if result, err = target.Set(result, v); err != nil {
+			return nil, "", err
+		}
+	}
+	if result == nil {
+		result = make(map[string]interface{})
+	}
+	return result, contentType, nil
+}
+
+// redactor removes, masks or hashes the fields
+type redactor struct {
+	paths   []*jsonpath.Path
+	mode    string
+	mask    string
+	hashKey []byte
+}
+
+func newRedactor(s *TransformStep) (*redactor, error) {
+	if len(s.Paths) == 0 {
+		return nil, fmt.Errorf("no paths to redact")
+	}
+	r := &redactor{mode: s.Mode, mask: s.Mask, hashKey: []byte(s.HashKey)}
+	if r.mode == "" {
+		r.mode = RedactRemove
+	}
+	if r.mode != RedactRemove && r.mode != RedactMask && r.mode != RedactHash {
+		return nil, fmt.Errorf("unknown redact mode %q", r.mode)
+	}
+	if r.mode == RedactHash && len(r.hashKey) == 0 {
+		return nil, fmt.Errorf("the hash_key of the hash mode is required")
+	}
+	if r.mask == "" {
+		r.mask = defaultRedactMask
+	}
+	for _, expr := range s.Paths {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, p)
+	}
+	return r, nil
+}
+
+func (r *redactor) transform(doc interface{}, contentType string) (interface{}, string, error) {
+	for _, p := range r.paths {
+		doc, _ = p.Update(doc, r.redact)
+	}
+	return doc, contentType, nil
+}
+
+func (r *redactor) redact(v interface{}) (interface{}, bool) {
+	switch r.mode {
+	case RedactMask:
+		return r.mask, true
+	case RedactHash:
+		b, _ := marshalJSON(v)
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write(b)
+		return hashedValuePrefix + hex.EncodeToString(mac.Sum(nil)), true
+	}
+	return nil, false
+}
+
+// converter changes the content type of the data, which is encoded in the new content type after all the steps
+type converter string
+
+func (c converter) transform(doc interface{}, contentType string) (interface{}, string, error) {
+	if string(c) == formContentType {
+		if _, ok := doc.(map[string]interface{}); !ok {
+			return nil, "", fmt.Errorf("only objects can be converted to %s", formContentType)
+		}
+	}
+	return doc, string(c), nil
+}
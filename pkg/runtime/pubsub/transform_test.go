@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+)
+
+const orderEvent = `{"id": "1", "specversion": "1.0", "source": "app", "type": "order", "datacontenttype": "application/json",
+  "data": {"id": 7, "user": {"name": "alice", "email": "a@example.com", "phone": "123"}, "cards": [{"number": "4111"}]}}`
+
+func eventData(t *testing.T, b []byte) (string, string) {
+	var fields map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(b, &fields))
+	var ct string
+	assert.Nil(t, json.Unmarshal(fields[pubsub.DataContentTypeField], &ct))
+	return string(fields[pubsub.DataField]), ct
+}
+
+func TestNewTransformPubSub(t *testing.T) {
+	invalid := []*TransformStep{
+		{Type: "unknown"},
+		{Type: TransformMap},
+		{Type: TransformMap, Fields: map[string]string{"$.a[*]": "$.b"}},
+		{Type: TransformMap, Fields: map[string]string{"$.a": "b"}},
+		{Type: TransformRedact},
+		{Type: TransformRedact, Paths: []string{"$.a"}, Mode: "encrypt"},
+		{Type: TransformRedact, Paths: []string{"$.a"}, Mode: RedactHash},
+		{Type: TransformConvert, To: "application/xml"},
+	}
+	for _, s := range invalid {
+		_, err := NewTransformPubSub(nil, &TransformConfig{Subscribe: map[string][]*TransformStep{"topic": {s}}})
+		assert.NotNil(t, err, s.Type)
+	}
+	_, err := NewTransformPubSub(nil, &TransformConfig{DeadLetterTopic: DeadLetterTopicPlaceholder})
+	assert.NotNil(t, err)
+}
+
+func TestTransformPubSub(t *testing.T) {
+	t.Run("subscribe", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewTransformPubSub(comp, &TransformConfig{Subscribe: map[string][]*TransformStep{
+			"orders": {
+				{Type: TransformRedact, Paths: []string{"$.user.phone"}},
+				{Type: TransformRedact, Paths: []string{"$.cards[*].number"}, Mode: RedactMask},
+				{Type: TransformRedact, Paths: []string{"$.user.email"}, Mode: RedactHash, HashKey: "secret"},
+			},
+		}})
+		assert.Nil(t, err)
+		var handler pubsub.Handler
+		comp.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req pubsub.SubscribeRequest, h pubsub.Handler) error {
+			handler = h
+			return nil
+		})
+		var received *pubsub.NewMessage
+		assert.Nil(t, p.Subscribe(pubsub.SubscribeRequest{Topic: "orders"}, func(ctx context.Context, msg *pubsub.NewMessage) error {
+			received = msg
+			return nil
+		}))
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "orders", Data: []byte(orderEvent)}))
+		data, ct := eventData(t, received.Data)
+		assert.Equal(t, "application/json", ct)
+		// the hash is the hmac-sha256 of the json value
+		assert.JSONEq(t, `{"id": 7, "user": {"name": "alice", "email": "hmac-sha256:87ec7eeb9429a2e4444d414277de69709c889b7c10ec2b643d61a5ad508ae7d2"}, "cards": [{"number": "****"}]}`, data)
+
+		// the events failing to be transformed are dropped instead of being redelivered
+		received = nil
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "orders", Data: []byte(`{"datacontenttype": "text/plain", "data": "x"}`)}))
+		assert.Nil(t, received)
+	})
+
+	t.Run("subscribe dead-letter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewTransformPubSub(comp, &TransformConfig{
+			Subscribe:       map[string][]*TransformStep{"orders": {{Type: TransformRedact, Paths: []string{"$.user.phone"}}}},
+			DeadLetterTopic: "{topic}-invalid",
+		})
+		assert.Nil(t, err)
+		var handler pubsub.Handler
+		comp.EXPECT().Subscribe(gomock.Any(), gomock.Any()).DoAndReturn(func(req pubsub.SubscribeRequest, h pubsub.Handler) error {
+			handler = h
+			return nil
+		})
+		assert.Nil(t, p.Subscribe(pubsub.SubscribeRequest{Topic: "orders"}, func(ctx context.Context, msg *pubsub.NewMessage) error {
+			t.Fatal("the event failing to be transformed is delivered")
+			return nil
+		}))
+		invalid := `{"specversion": "1.0", "datacontenttype": "text/plain", "data": "x"}`
+		var published *pubsub.PublishRequest
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			published = req
+			return nil
+		})
+		assert.Nil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "orders", Data: []byte(invalid)}))
+		assert.Equal(t, "orders-invalid", published.Topic)
+		assert.Equal(t, "orders", published.Metadata[DeadLetterTopicKey])
+		var fields map[string]interface{}
+		assert.Nil(t, json.Unmarshal(published.Data, &fields))
+		assert.Equal(t, "x", fields[pubsub.DataField])
+		assert.Equal(t, "orders", fields[DeadLetterTopicKey])
+
+		// redelivered if the dead-lettering fails
+		comp.EXPECT().Publish(gomock.Any()).Return(errors.New("unavailable"))
+		assert.NotNil(t, handler(context.Background(), &pubsub.NewMessage{Topic: "orders", Data: []byte(invalid)}))
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewTransformPubSub(comp, &TransformConfig{Publish: map[string][]*TransformStep{
+			TransformAllTopics: {
+				{Type: TransformMap, Fields: map[string]string{"$.orderId": "$.id", "$.customer.name": "$.user.name", "$.cards": "$.cards[*].number"}},
+				{Type: TransformConvert, To: "application/x-www-form-urlencoded"},
+			},
+		}})
+		assert.Nil(t, err)
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			data, ct := eventData(t, req.Data)
+			assert.Equal(t, "application/x-www-form-urlencoded", ct)
+			assert.Equal(t, `"cards=4111&customer=%7B%22name%22%3A%22alice%22%7D&orderId=7"`, data)
+			return nil
+		})
+		assert.Nil(t, p.Publish(&pubsub.PublishRequest{Topic: "orders", Data: []byte(orderEvent)}))
+	})
+
+	t.Run("proto envelope", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		comp := mock_pubsub.NewMockPubSub(ctrl)
+		p, err := NewTransformPubSub(comp, &TransformConfig{Publish: map[string][]*TransformStep{
+			"orders": {{Type: TransformRedact, Paths: []string{"$.user"}}},
+		}})
+		assert.Nil(t, err)
+		comp.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+			ce, err := UnmarshalProtoCloudEvent(req.Data)
+			assert.Nil(t, err)
+			assert.Equal(t, "42", ce.ID)
+			assert.JSONEq(t, `{"id": 7}`, string(ce.Data))
+			return nil
+		})
+		ce := &CloudEvent{ID: "42", Source: "app", Type: "order", DataContentType: "application/json", Data: []byte(`{"id": 7, "user": {"name": "alice"}}`)}
+		assert.Nil(t, p.Publish(&pubsub.PublishRequest{Topic: "orders", Data: MarshalProtoCloudEvent(ce, nil, nil)}))
+
+		// the other topics are not transformed
+		req := &pubsub.PublishRequest{Topic: "others", Data: []byte("x")}
+		comp.EXPECT().Publish(req).Return(nil)
+		assert.Nil(t, p.Publish(req))
+	})
+}
@@ -0,0 +1,662 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/bindings"
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/dapr/components-contrib/state"
+
+	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/pkg/runtime/alias"
+	mbindings "mosn.io/layotto/pkg/runtime/bindings"
+	"mosn.io/layotto/pkg/runtime/budget"
+	"mosn.io/layotto/pkg/runtime/crd"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+	"mosn.io/pkg/log"
+)
+
+const (
+	crdLoadTimeout = time.Second * 30
+	// retiredCloseDelay is the time waited before closing the components replaced or removed,
+	// so that the requests served by them in flight can complete
+	retiredCloseDelay = time.Second * 10
+)
+
+// kindGroups maps the kinds of components declared by the custom resources to the API groups serving them
+var kindGroups = map[alias.Kind]string{
+	alias.State:       GroupState,
+	alias.PubSub:      GroupPubSub,
+	alias.Lock:        GroupLock,
+	alias.Sequencer:   GroupSequencer,
+	alias.Binding:     GroupBinding,
+	alias.SecretStore: GroupSecret,
+}
+
+// crdState is the state of the components declared by the custom resources
+type crdState struct {
+	source *crd.Source
+	watch  bool
+	cancel context.CancelFunc
+	// applied is the snapshot the components are reconciled with
+	applied *crd.Snapshot
+}
+
+func (c *crdState) snapshot() *crd.Snapshot {
+	if c == nil {
+		return nil
+	}
+	return c.applied
+}
+
+func (m *MosnRuntime) watchingCRDs() bool {
+	return m.crd != nil && m.crd.watch
+}
+
+// initCRDs loads the custom resources and merges the components declared by them into the config
+func (m *MosnRuntime) initCRDs() error {
+	cfg := m.runtimeConfig.CRD
+	if cfg == nil {
+		return nil
+	}
+	source, err := crd.NewSource(cfg, m.runtimeConfig.AppManagement.AppId)
+	if err != nil {
+		m.errInt(err, "init custom resources failed")
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), crdLoadTimeout)
+	defer cancel()
+	s, err := source.Load(ctx)
+	if err != nil {
+		m.errInt(err, "load custom resources failed")
+		return err
+	}
+	for _, kind := range crd.Kinds {
+		for name, md := range s.Components[kind] {
+			if componentConfigured(m.runtimeConfig, kind, name) {
+				err = fmt.Errorf("%s component %s is declared by both the config and the custom resources", kind, name)
+				m.errInt(err, "load custom resources failed")
+				return err
+			}
+			configureComponent(m.runtimeConfig, kind, name, md)
+		}
+	}
+	m.crd = &crdState{source: source, watch: cfg.Watch, applied: s}
+	log.DefaultLogger.Infof("[runtime] load the custom resources in the namespace %s", cfg.Namespace)
+	return nil
+}
+
+// initDeclaredSubscriptions adds the subscriptions declared by the custom resources to the ones listed by the app
+func (m *MosnRuntime) initDeclaredSubscriptions() {
+	s := m.crd.snapshot()
+	if s == nil || len(s.Subscriptions) == 0 {
+		return
+	}
+	if m.appCallback != nil {
+		m.appCallback = runtime_pubsub.WithSubscriptions(m.appCallback, s.Subscriptions)
+	} else if m.AppCallbackConn != nil {
+		m.appCallback = runtime_pubsub.WithSubscriptions(runtimev1pb.NewAppCallbackClient(m.AppCallbackConn), s.Subscriptions)
+	} else {
+		log.DefaultLogger.Warnf("[runtime] the subscriptions declared by the custom resources are ignored, since the app callback isn't configured")
+	}
+}
+
+// startReconcilingCRDs reconciles the components after the custom resources change,
+// and serves the reconcile requests of the actuator endpoint
+func (m *MosnRuntime) startReconcilingCRDs() {
+	if !m.watchingCRDs() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.crd.cancel = cancel
+	crd.SetReconciler(func(ctx context.Context) error {
+		s, err := m.crd.source.Load(ctx)
+		if err != nil {
+			m.reportReconcile(nil, err)
+			return err
+		}
+		return m.reconcileCRDs(s)
+	})
+	m.crd.source.Watch(ctx, func(s *crd.Snapshot, err error) {
+		if err != nil {
+			m.reportReconcile(nil, err)
+			return
+		}
+		_ = m.reconcileCRDs(s)
+	})
+}
+
+func (m *MosnRuntime) stopReconcilingCRDs() {
+	if m.crd == nil || m.crd.cancel == nil {
+		return
+	}
+	m.crd.cancel()
+	crd.SetReconciler(nil)
+}
+
+func (m *MosnRuntime) reportReconcile(pending []string, err error) {
+	status := &crd.Status{Time: time.Now(), Pending: pending}
+	if err != nil {
+		status.Error = err.Error()
+		log.DefaultLogger.Errorf("[runtime] reconcile the components with the custom resources error: %v", err)
+	} else if len(pending) > 0 {
+		log.DefaultLogger.Warnf("[runtime] the changes of %v apply after the runtime restarts", pending)
+	}
+	crd.SetStatus(status)
+}
+
+// reconcileCRDs reconciles the components with the snapshot of the custom resources.
+// The components changed are created and the GrpcAPIs are created with them as a new generation,
+// which replaces the current one at once. The components are kept unchanged if any of them fails.
+// The pubsubs changed are rejected and the subscriptions are pending until the runtime restarts, since the topics are subscribed at startup,
+// while the other changes are applied.
+func (m *MosnRuntime) reconcileCRDs(desired *crd.Snapshot) error {
+	m.reconfigureLock.Lock()
+	defer m.reconfigureLock.Unlock()
+	pending, err := m.applyCRDs(desired)
+	m.reportReconcile(pending, err)
+	return err
+}
+
+func (m *MosnRuntime) applyCRDs(desired *crd.Snapshot) ([]string, error) {
+	applied := m.crd.applied
+	// 1. pick the changes
+	var pending, rejected []string
+	var changes []crd.Change
+	for _, c := range desired.Changes(applied) {
+		if c.Kind == alias.PubSub {
+			rejected = append(rejected, c.Name)
+			continue
+		}
+		if !m.profile.GroupEnabled(kindGroups[c.Kind]) {
+			log.DefaultLogger.Warnf("[runtime] %s component %s is ignored, since it's disabled by the profile %s", c.Kind, c.Name, m.profile.Name())
+			continue
+		}
+		if _, ok := applied.Components[c.Kind][c.Name]; !ok && componentConfigured(m.runtimeConfig, c.Kind, c.Name) {
+			return pending, fmt.Errorf("%s component %s is declared by both the config and the custom resources", c.Kind, c.Name)
+		}
+		changes = append(changes, c)
+	}
+	if desired.SubscriptionsChanged(applied) {
+		pending = append(pending, "subscriptions")
+	}
+	next := &crd.Snapshot{
+		Components:        make(map[alias.Kind]map[string]map[string]string, len(desired.Components)),
+		Subscriptions:     applied.Subscriptions,
+		DefaultComponents: desired.DefaultComponents,
+		ComponentAliases:  desired.ComponentAliases,
+	}
+	for kind, comps := range desired.Components {
+		next.Components[kind] = comps
+	}
+	next.Components[alias.PubSub] = applied.Components[alias.PubSub]
+	if len(changes) == 0 && reflect.DeepEqual(next.DefaultComponents, applied.DefaultComponents) &&
+		reflect.DeepEqual(next.ComponentAliases, applied.ComponentAliases) {
+		m.crd.applied = next
+		return pending, rejectPubSubChanges(rejected)
+	}
+	// 2. replace the components changed
+	if err := m.reconfigure(changes, next); err != nil {
+		return pending, err
+	}
+	m.crd.applied = next
+	log.DefaultLogger.Infof("[runtime] reconcile %d components with the custom resources", len(changes))
+	return pending, rejectPubSubChanges(rejected)
+}
+
+// rejectPubSubChanges returns the error of the pubsubs changed, which aren't applied since the topics are subscribed at startup
+func rejectPubSubChanges(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return fmt.Errorf("the pubsub components %s can't be changed at runtime, since the topics are subscribed at startup, "+
+		"restart the runtime to apply the changes", strings.Join(names, ", "))
+}
+
+// reconfigure creates the components changed and the GrpcAPIs with them as a new generation, which replaces the current one at once.
+// The snapshot of the custom resources is used to save the aliases of components, which may be nil.
+// The components are kept unchanged if any of them fails. The caller holds the reconfigureLock.
+func (m *MosnRuntime) reconfigure(changes []crd.Change, s *crd.Snapshot) error {
+	// 1. create the components changed
+	g, retired, err := m.nextGeneration(changes)
+	if err != nil {
+		return err
+	}
+	// 2. create the GrpcAPIs with them
+	routes, err := g.newRoutes(m.apiFactorys, m.apis, false)
+	if err == nil {
+		err = g.saveComponentAliases(s)
+	}
+	if err != nil {
+		g.stopStateWorkers()
+		closeComponents(m.createdComponents(g), 0)
+		return err
+	}
+	// 3. replace the current generation
+	m.router.update(routes)
+	m.runtimeConfig = g.runtimeConfig
+	m.pubSubs = g.pubSubs
+	m.states = g.states
+	m.locks = g.locks
+	m.sequencers = g.sequencers
+	m.outputBindings = g.outputBindings
+	m.secretStores = g.secretStores
+	// the workers retired are stopped before the stores, so the pending writes are flushed into them
+	workers := m.mergeStateWorkers(g, changes)
+	closeComponents(append(workers, retired...), retiredCloseDelay)
+	return nil
+}
+
+// closerFunc adapts the functions stopping the workers to io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// mergeStateWorkers moves the background workers of the state stores created by the generation into the runtime,
+// and returns the ones of the state stores replaced or removed, in the order they should be stopped
+func (m *MosnRuntime) mergeStateWorkers(g *MosnRuntime, changes []crd.Change) []interface{} {
+	var retired []interface{}
+	for _, c := range changes {
+		if c.Kind != alias.State {
+			continue
+		}
+		name := c.Name
+		if relay, ok := m.outboxRelays[name]; ok {
+			retired = append(retired, closerFunc(func() error {
+				relay.Stop()
+				return nil
+			}))
+			delete(m.outboxRelays, name)
+		}
+		if store, ok := m.bloomFilters[name]; ok {
+			retired = append(retired, store)
+			delete(m.bloomFilters, name)
+		}
+		if store, ok := m.writeBehinds[name]; ok {
+			retired = append(retired, store)
+			delete(m.writeBehinds, name)
+			if _, ok := g.writeBehinds[name]; !ok {
+				budget.Unregister("state_write_behind/" + name)
+			}
+		}
+		if store, ok := m.changeEvents[name]; ok {
+			retired = append(retired, store)
+			delete(m.changeEvents, name)
+		}
+		if _, ok := g.states[name].(budget.Consumer); !ok {
+			budget.Unregister("state_cache/" + name)
+		}
+	}
+	for name, relay := range g.outboxRelays {
+		m.outboxRelays[name] = relay
+	}
+	for name, store := range g.bloomFilters {
+		m.bloomFilters[name] = store
+	}
+	for name, store := range g.writeBehinds {
+		m.writeBehinds[name] = store
+	}
+	for name, store := range g.changeEvents {
+		m.changeEvents[name] = store
+	}
+	return retired
+}
+
+// stopStateWorkers stops the background workers of the generation, which isn't used
+func (m *MosnRuntime) stopStateWorkers() {
+	for _, relay := range m.outboxRelays {
+		relay.Stop()
+	}
+	for _, store := range m.bloomFilters {
+		store.Close()
+	}
+	for name, store := range m.writeBehinds {
+		store.Close()
+		budget.Unregister("state_write_behind/" + name)
+	}
+	for _, store := range m.changeEvents {
+		store.Close()
+	}
+}
+
+// nextGeneration creates the components changed, and returns the runtime with them and the components retired
+func (m *MosnRuntime) nextGeneration(changes []crd.Change) (*MosnRuntime, []interface{}, error) {
+	// the runtime of the next generation shares the registries and the other components with the current one
+	g := &MosnRuntime{
+		info:                 m.info,
+		helloRegistry:        m.helloRegistry,
+		configStoreRegistry:  m.configStoreRegistry,
+		rpcRegistry:          m.rpcRegistry,
+		pubSubRegistry:       m.pubSubRegistry,
+		stateRegistry:        m.stateRegistry,
+		fileRegistry:         m.fileRegistry,
+		lockRegistry:         m.lockRegistry,
+		sequencerRegistry:    m.sequencerRegistry,
+		bindingsRegistry:     m.bindingsRegistry,
+		secretStoresRegistry: m.secretStoresRegistry,
+		hellos:               m.hellos,
+		configStores:         m.configStores,
+		rpcs:                 m.rpcs,
+		files:                m.files,
+		AppCallbackConn:      m.AppCallbackConn,
+		appCallback:          m.appCallback,
+		errInt:               m.errInt,
+		profile:              m.profile,
+		crd:                  m.crd,
+		outboxRelays:         make(map[string]*runtime_state.OutboxRelay),
+		writeBehinds:         make(map[string]runtime_state.WriteBehindStore),
+		changeEvents:         make(map[string]runtime_state.ChangeEventStore),
+		bloomFilters:         make(map[string]runtime_state.BloomFilterStore),
+	}
+	nextConfig := *m.runtimeConfig
+	nextConfig.PubSubManagement = make(map[string]runtime_pubsub.Config, len(m.runtimeConfig.PubSubManagement))
+	for name, cfg := range m.runtimeConfig.PubSubManagement {
+		nextConfig.PubSubManagement[name] = cfg
+	}
+	nextConfig.StateManagement = make(map[string]runtime_state.Config, len(m.runtimeConfig.StateManagement))
+	for name, cfg := range m.runtimeConfig.StateManagement {
+		nextConfig.StateManagement[name] = cfg
+	}
+	nextConfig.LockManagement = make(map[string]lock.Config, len(m.runtimeConfig.LockManagement))
+	for name, cfg := range m.runtimeConfig.LockManagement {
+		nextConfig.LockManagement[name] = cfg
+	}
+	nextConfig.SequencerManagement = make(map[string]sequencer.Config, len(m.runtimeConfig.SequencerManagement))
+	for name, cfg := range m.runtimeConfig.SequencerManagement {
+		nextConfig.SequencerManagement[name] = cfg
+	}
+	nextConfig.Bindings = make(map[string]mbindings.Metadata, len(m.runtimeConfig.Bindings))
+	for name, cfg := range m.runtimeConfig.Bindings {
+		nextConfig.Bindings[name] = cfg
+	}
+	nextConfig.SecretStoresManagement = make(map[string]mbindings.Metadata, len(m.runtimeConfig.SecretStoresManagement))
+	for name, cfg := range m.runtimeConfig.SecretStoresManagement {
+		nextConfig.SecretStoresManagement[name] = cfg
+	}
+	g.pubSubs = make(map[string]pubsub.PubSub, len(m.pubSubs))
+	for name, comp := range m.pubSubs {
+		g.pubSubs[name] = comp
+	}
+	g.states = make(map[string]state.Store, len(m.states))
+	for name, comp := range m.states {
+		g.states[name] = comp
+	}
+	g.locks = make(map[string]lock.LockStore, len(m.locks))
+	for name, comp := range m.locks {
+		g.locks[name] = comp
+	}
+	g.sequencers = make(map[string]sequencer.Store, len(m.sequencers))
+	for name, comp := range m.sequencers {
+		g.sequencers[name] = comp
+	}
+	g.outputBindings = make(map[string]bindings.OutputBinding, len(m.outputBindings))
+	for name, comp := range m.outputBindings {
+		g.outputBindings[name] = comp
+	}
+	g.secretStores = make(map[string]secretstores.SecretStore, len(m.secretStores))
+	for name, comp := range m.secretStores {
+		g.secretStores[name] = comp
+	}
+	// the init functions create the components in the config, so only the ones changed are in it
+	initConfig := nextConfig
+	initConfig.PubSubManagement = nil
+	initConfig.StateManagement = nil
+	initConfig.LockManagement = nil
+	initConfig.SequencerManagement = nil
+	initConfig.Bindings = nil
+	initConfig.SecretStoresManagement = nil
+	var retired []interface{}
+	for _, c := range changes {
+		configureComponent(&nextConfig, c.Kind, c.Name, c.Metadata)
+		if comp := g.removeComponent(c.Kind, c.Name); comp != nil {
+			retired = append(retired, comp)
+		}
+		if !c.Removed() {
+			configureComponent(&initConfig, c.Kind, c.Name, c.Metadata)
+		}
+	}
+	g.runtimeConfig = &initConfig
+	// the secret stores are initialized first, since the secrets are referred by the metadata of the other components
+	err := g.initSecretStores()
+	if err == nil {
+		err = g.resolveSecretRefs()
+	}
+	if err == nil {
+		err = g.initPubSubs()
+	}
+	if err == nil {
+		err = g.initStates()
+	}
+	if err == nil {
+		err = g.initLocks()
+	}
+	if err == nil {
+		err = g.initSequencers()
+	}
+	if err == nil {
+		err = g.initOutputBinding()
+	}
+	if err != nil {
+		g.stopStateWorkers()
+		closeComponents(m.createdComponents(g), 0)
+		return nil, nil, err
+	}
+	g.runtimeConfig = &nextConfig
+	return g, retired, nil
+}
+
+// removeComponent removes the component from the runtime, and returns it
+func (m *MosnRuntime) removeComponent(kind alias.Kind, name string) interface{} {
+	var comp interface{}
+	var ok bool
+	switch kind {
+	case alias.PubSub:
+		if comp, ok = m.pubSubs[name]; ok {
+			delete(m.pubSubs, name)
+		}
+	case alias.State:
+		if comp, ok = m.states[name]; ok {
+			delete(m.states, name)
+		}
+	case alias.Lock:
+		if comp, ok = m.locks[name]; ok {
+			delete(m.locks, name)
+		}
+	case alias.Sequencer:
+		if comp, ok = m.sequencers[name]; ok {
+			delete(m.sequencers, name)
+		}
+	case alias.Binding:
+		if comp, ok = m.outputBindings[name]; ok {
+			delete(m.outputBindings, name)
+		}
+	case alias.SecretStore:
+		if comp, ok = m.secretStores[name]; ok {
+			delete(m.secretStores, name)
+		}
+	}
+	return comp
+}
+
+// createdComponents returns the components of the generation which aren't in the runtime
+func (m *MosnRuntime) createdComponents(g *MosnRuntime) []interface{} {
+	var created []interface{}
+	for name, comp := range g.pubSubs {
+		if old, ok := m.pubSubs[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	for name, comp := range g.states {
+		if old, ok := m.states[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	for name, comp := range g.locks {
+		if old, ok := m.locks[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	for name, comp := range g.sequencers {
+		if old, ok := m.sequencers[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	for name, comp := range g.outputBindings {
+		if old, ok := m.outputBindings[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	for name, comp := range g.secretStores {
+		if old, ok := m.secretStores[name]; !ok || old != comp {
+			created = append(created, comp)
+		}
+	}
+	return created
+}
+
+// closeComponents closes the components implementing io.Closer after the delay
+func closeComponents(comps []interface{}, delay time.Duration) {
+	var closers []io.Closer
+	for _, comp := range comps {
+		if c, ok := comp.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+	if len(closers) == 0 {
+		return
+	}
+	time.AfterFunc(delay, func() {
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				log.DefaultLogger.Warnf("[runtime] close the component retired error: %v", err)
+			}
+		}
+	})
+}
+
+// componentConfigured reports whether the component is in the config
+func componentConfigured(c *MosnRuntimeConfig, kind alias.Kind, name string) bool {
+	var ok bool
+	switch kind {
+	case alias.State:
+		_, ok = c.StateManagement[name]
+	case alias.PubSub:
+		_, ok = c.PubSubManagement[name]
+	case alias.Lock:
+		_, ok = c.LockManagement[name]
+	case alias.Sequencer:
+		_, ok = c.SequencerManagement[name]
+	case alias.Binding:
+		_, ok = c.Bindings[name]
+	case alias.SecretStore:
+		_, ok = c.SecretStoresManagement[name]
+	}
+	return ok
+}
+
+// configureComponent puts the component declared by the custom resources into the config, or removes it if the metadata is nil
+func configureComponent(c *MosnRuntimeConfig, kind alias.Kind, name string, metadata map[string]string) {
+	switch kind {
+	case alias.State:
+		if c.StateManagement == nil {
+			c.StateManagement = make(map[string]runtime_state.Config)
+		}
+		c.StateManagement[name] = runtime_state.Config{Metadata: metadata}
+		if metadata == nil {
+			delete(c.StateManagement, name)
+		}
+	case alias.PubSub:
+		if c.PubSubManagement == nil {
+			c.PubSubManagement = make(map[string]runtime_pubsub.Config)
+		}
+		c.PubSubManagement[name] = runtime_pubsub.Config{Metadata: metadata}
+		if metadata == nil {
+			delete(c.PubSubManagement, name)
+		}
+	case alias.Lock:
+		if c.LockManagement == nil {
+			c.LockManagement = make(map[string]lock.Config)
+		}
+		c.LockManagement[name] = lock.Config{Metadata: metadata}
+		if metadata == nil {
+			delete(c.LockManagement, name)
+		}
+	case alias.Sequencer:
+		if c.SequencerManagement == nil {
+			c.SequencerManagement = make(map[string]sequencer.Config)
+		}
+		c.SequencerManagement[name] = sequencer.Config{Metadata: metadata}
+		if metadata == nil {
+			delete(c.SequencerManagement, name)
+		}
+	case alias.Binding:
+		if c.Bindings == nil {
+			c.Bindings = make(map[string]mbindings.Metadata)
+		}
+		c.Bindings[name] = mbindings.Metadata{Metadata: metadata}
+		if metadata == nil {
+			delete(c.Bindings, name)
+		}
+	case alias.SecretStore:
+		if c.SecretStoresManagement == nil {
+			c.SecretStoresManagement = make(map[string]mbindings.Metadata)
+		}
+		c.SecretStoresManagement[name] = mbindings.Metadata{Metadata: metadata}
+		if metadata == nil {
+			delete(c.SecretStoresManagement, name)
+		}
+	}
+}
+
+// mergeComponentAliases merges the default components and the aliases, the latter ones win
+func mergeComponentAliases(defaults map[string]string, aliases map[string]map[string]string,
+	moreDefaults map[string]string, moreAliases map[string]map[string]string) (map[string]string, map[string]map[string]string) {
+	mergedDefaults := make(map[string]string, len(defaults)+len(moreDefaults))
+	for kind, name := range defaults {
+		mergedDefaults[kind] = name
+	}
+	for kind, name := range moreDefaults {
+		mergedDefaults[kind] = name
+	}
+	mergedAliases := make(map[string]map[string]string, len(aliases)+len(moreAliases))
+	for _, as := range []map[string]map[string]string{aliases, moreAliases} {
+		for kind, kindAliases := range as {
+			if mergedAliases[kind] == nil {
+				mergedAliases[kind] = make(map[string]string, len(kindAliases))
+			}
+			for a, name := range kindAliases {
+				mergedAliases[kind][a] = name
+			}
+		}
+	}
+	return mergedDefaults, mergedAliases
+}
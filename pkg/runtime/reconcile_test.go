@@ -0,0 +1,185 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/pkg/grpc/default_api"
+	mock_lock "mosn.io/layotto/pkg/mock/components/lock"
+	mock_secret "mosn.io/layotto/pkg/mock/components/secret"
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/crd"
+	mlock "mosn.io/layotto/pkg/runtime/lock"
+)
+
+func TestReconcileCRDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	var initialized []lock.Metadata
+	newLock := func() lock.LockStore {
+		store := mock_lock.NewMockLockStore(ctrl)
+		store.EXPECT().Init(gomock.Any()).DoAndReturn(func(md lock.Metadata) error {
+			initialized = append(initialized, md)
+			return nil
+		}).AnyTimes()
+		return store
+	}
+	rt := NewMosnRuntime(&MosnRuntimeConfig{
+		AppManagement:  AppConfig{AppId: "main"},
+		LockManagement: map[string]lock.Config{"file": {}},
+	})
+	_, err := rt.Run(
+		WithGrpcAPI(default_api.NewGrpcAPI),
+		WithLockFactory(mlock.NewFactory("file", newLock), mlock.NewFactory("crd", newLock)),
+	)
+	assert.Nil(t, err)
+	defer rt.Stop()
+	rt.crd = &crdState{applied: &crd.Snapshot{}}
+	routes, err := rt.newRoutes(rt.apiFactorys, rt.apis, true)
+	assert.Nil(t, err)
+	rt.router = newAPIRouter("main", routes, nil)
+	fileLock := rt.locks["file"]
+
+	t.Run("add", func(t *testing.T) {
+		err := rt.reconcileCRDs(&crd.Snapshot{
+			Components: map[alias.Kind]map[string]map[string]string{
+				alias.Lock:   {"crd": {"k": "v"}},
+				alias.PubSub: {"crd": {}},
+			},
+			DefaultComponents: map[string]string{"lock": "crd"},
+		})
+		// the pubsubs are rejected, and the other changes are applied
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "crd")
+		assert.NotNil(t, rt.locks["crd"])
+		assert.Equal(t, fileLock, rt.locks["file"])
+		assert.Equal(t, "v", rt.runtimeConfig.LockManagement["crd"].Metadata["k"])
+		assert.Equal(t, "crd", alias.Resolve(alias.Lock, ""))
+		assert.Nil(t, rt.crd.applied.Components[alias.PubSub])
+		// the main app is served by the new generation
+		next := rt.router.current.Load().(routeTable)["main"]
+		assert.Len(t, next.apis, len(rt.apis))
+	})
+
+	t.Run("declared by the config", func(t *testing.T) {
+		applied := rt.crd.applied
+		err := rt.reconcileCRDs(&crd.Snapshot{
+			Components: map[alias.Kind]map[string]map[string]string{
+				alias.Lock: {"crd": {"k": "v"}, "file": {}},
+			},
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, applied, rt.crd.applied)
+		assert.Equal(t, fileLock, rt.locks["file"])
+	})
+
+	t.Run("illegal default component", func(t *testing.T) {
+		locks := rt.locks
+		err := rt.reconcileCRDs(&crd.Snapshot{
+			DefaultComponents: map[string]string{"lock": "crd"},
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, locks, rt.locks)
+	})
+
+	t.Run("secret refs", func(t *testing.T) {
+		rt.secretStores["local"] = mock_secret.FakeSecretStore{}
+		md := map[string]string{"password": "${secretKeyRef:local:good-key}"}
+		err := rt.reconcileCRDs(&crd.Snapshot{
+			Components: map[alias.Kind]map[string]map[string]string{
+				alias.Lock: {"crd": md},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "life is good", initialized[len(initialized)-1].Properties["password"])
+		// the references are kept in the custom resources
+		assert.Equal(t, "${secretKeyRef:local:good-key}", md["password"])
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		err := rt.reconcileCRDs(&crd.Snapshot{})
+		assert.Nil(t, err)
+		assert.Nil(t, rt.locks["crd"])
+		assert.NotNil(t, rt.locks["file"])
+		_, ok := rt.runtimeConfig.LockManagement["crd"]
+		assert.False(t, ok)
+	})
+}
+
+type fakeWorkerStore struct {
+	state.Store
+	closed int
+}
+
+func (s *fakeWorkerStore) Flush() error {
+	return nil
+}
+
+func (s *fakeWorkerStore) Close() error {
+	s.closed++
+	return nil
+}
+
+func (s *fakeWorkerStore) MemoryUsage() int64 {
+	return 0
+}
+
+func TestMergeStateWorkers(t *testing.T) {
+	m := NewMosnRuntime(&MosnRuntimeConfig{})
+	oldWriteBehind, oldEvents, kept := &fakeWorkerStore{}, &fakeWorkerStore{}, &fakeWorkerStore{}
+	m.writeBehinds["redis"] = oldWriteBehind
+	m.changeEvents["redis"] = oldEvents
+	m.writeBehinds["mongo"] = kept
+	g := NewMosnRuntime(&MosnRuntimeConfig{})
+	newWriteBehind := &fakeWorkerStore{}
+	g.writeBehinds["redis"] = newWriteBehind
+
+	retired := m.mergeStateWorkers(g, []crd.Change{{Kind: alias.State, Name: "redis"}, {Kind: alias.Lock, Name: "mongo"}})
+	// the write-behind is flushed before the events are published
+	assert.Equal(t, []interface{}{oldWriteBehind, oldEvents}, retired)
+	assert.Equal(t, newWriteBehind, m.writeBehinds["redis"])
+	assert.Equal(t, kept, m.writeBehinds["mongo"])
+	_, ok := m.changeEvents["redis"]
+	assert.False(t, ok)
+
+	// the workers of a generation failed are stopped
+	failed := NewMosnRuntime(&MosnRuntimeConfig{})
+	unused := &fakeWorkerStore{}
+	failed.bloomFilters["redis"] = unused
+	failed.stopStateWorkers()
+	assert.Equal(t, 1, unused.closed)
+	assert.Equal(t, 0, newWriteBehind.closed)
+}
+
+func TestMergeComponentAliases(t *testing.T) {
+	defaults, aliases := mergeComponentAliases(
+		map[string]string{"state": "redis", "lock": "redis"},
+		map[string]map[string]string{"state": {"db": "redis"}},
+		map[string]string{"state": "mongo"},
+		map[string]map[string]string{"state": {"cache": "mongo"}, "lock": {"l": "redis"}},
+	)
+	assert.Equal(t, map[string]string{"state": "mongo", "lock": "redis"}, defaults)
+	assert.Equal(t, map[string]map[string]string{
+		"state": {"db": "redis", "cache": "mongo"},
+		"lock":  {"l": "redis"},
+	}, aliases)
+}
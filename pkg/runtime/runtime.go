@@ -23,6 +23,8 @@ import (
 	"github.com/dapr/components-contrib/secretstores"
 	msecretstores "mosn.io/layotto/pkg/runtime/secretstores"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dapr/components-contrib/bindings"
 	mbindings "mosn.io/layotto/pkg/runtime/bindings"
@@ -36,16 +38,25 @@ import (
 	"mosn.io/layotto/components/hello"
 	"mosn.io/layotto/components/lock"
 	"mosn.io/layotto/components/pkg/actuators"
+	"mosn.io/layotto/components/pkg/egress"
 	"mosn.io/layotto/components/pkg/info"
+	"mosn.io/layotto/components/pkg/schema"
 	"mosn.io/layotto/components/rpc"
 	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/diagnostics/fault"
+	"mosn.io/layotto/diagnostics/watchdog"
 	"mosn.io/layotto/pkg/actuator/health"
 	"mosn.io/layotto/pkg/grpc"
 	"mosn.io/layotto/pkg/integrate/actuator"
+	"mosn.io/layotto/pkg/runtime/alias"
+	"mosn.io/layotto/pkg/runtime/budget"
+	"mosn.io/layotto/pkg/runtime/crd"
+	runtime_file "mosn.io/layotto/pkg/runtime/file"
 	runtime_lock "mosn.io/layotto/pkg/runtime/lock"
 	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
 	runtime_sequencer "mosn.io/layotto/pkg/runtime/sequencer"
 	runtime_state "mosn.io/layotto/pkg/runtime/state"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 	mgrpc "mosn.io/mosn/pkg/filter/network/grpc"
 	"mosn.io/pkg/log"
 )
@@ -80,8 +91,30 @@ type MosnRuntime struct {
 	secretStores   map[string]secretstores.SecretStore
 	// app callback
 	AppCallbackConn *rawGRPC.ClientConn
+	appCallback     runtimev1pb.AppCallbackClient
 	// extends
-	errInt ErrInterceptor
+	errInt       ErrInterceptor
+	profile      *Profile
+	watchdog     *watchdog.Watchdog
+	faults       *fault.Injector
+	egress       *egress.Policy
+	drainer      *grpc.Drainer
+	fileJanitors []*runtime_file.Janitor
+	// the background workers of the state stores, keyed by the names of the stores
+	outboxRelays map[string]*runtime_state.OutboxRelay
+	writeBehinds map[string]runtime_state.WriteBehindStore
+	changeEvents map[string]runtime_state.ChangeEventStore
+	bloomFilters map[string]runtime_state.BloomFilterStore
+	// stopConnectionWatch stops refreshing the connection states of the configuration stores
+	stopConnectionWatch func()
+	// grpc apis
+	apiFactorys []grpc.NewGrpcAPI
+	apis        []grpc.GrpcAPI
+	router      *apiRouter
+	// custom resources
+	crd *crdState
+	// reconfigureLock serializes the changes of components at runtime
+	reconfigureLock sync.Mutex
 }
 
 func NewMosnRuntime(runtimeConfig *MosnRuntimeConfig) *MosnRuntime {
@@ -109,6 +142,10 @@ func NewMosnRuntime(runtimeConfig *MosnRuntimeConfig) *MosnRuntime {
 		sequencers:           make(map[string]sequencer.Store),
 		outputBindings:       make(map[string]bindings.OutputBinding),
 		secretStores:         make(map[string]secretstores.SecretStore),
+		outboxRelays:         make(map[string]*runtime_state.OutboxRelay),
+		writeBehinds:         make(map[string]runtime_state.WriteBehindStore),
+		changeEvents:         make(map[string]runtime_state.ChangeEventStore),
+		bloomFilters:         make(map[string]runtime_state.BloomFilterStore),
 	}
 }
 
@@ -116,25 +153,69 @@ func (m *MosnRuntime) GetInfo() *info.RuntimeInfo {
 	return m.info
 }
 
-func (m *MosnRuntime) sendToOutputBinding(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
-	if req.Operation == "" {
-		return nil, errors.New("operation field is missing from request")
-	}
+// outputBindingSender invokes the output bindings in the map, which is replaced instead of modified after the components are reconciled.
+// The default metadata in the configs is merged into the requests, and the metadata required by the operations is validated.
+func outputBindingSender(outputBindings map[string]bindings.OutputBinding, configs map[string]mbindings.Metadata) func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+	return func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+		if req.Operation == "" {
+			return nil, errors.New("operation field is missing from request")
+		}
 
-	if binding, ok := m.outputBindings[name]; ok {
-		ops := binding.Operations()
-		for _, o := range ops {
-			if o == req.Operation {
-				return binding.Invoke(req)
+		if binding, ok := outputBindings[name]; ok {
+			ops := binding.Operations()
+			for _, o := range ops {
+				if o == req.Operation {
+					if config, ok := configs[name]; ok {
+						metadata, err := config.MergeMetadata(string(req.Operation), req.Metadata)
+						if err != nil {
+							return nil, err
+						}
+						// the request of the app isn't modified
+						merged := *req
+						merged.Metadata = metadata
+						req = &merged
+					}
+					return binding.Invoke(req)
+				}
 			}
+			supported := make([]string, 0, len(ops))
+			for _, o := range ops {
+				supported = append(supported, string(o))
+			}
+			return nil, fmt.Errorf("binding %s does not support operation %s. supported operations:%s", name, req.Operation, strings.Join(supported, " "))
 		}
-		supported := make([]string, 0, len(ops))
-		for _, o := range ops {
-			supported = append(supported, string(o))
+		return nil, fmt.Errorf("couldn't find output binding %s", name)
+	}
+}
+
+// outputBindingLister lists the output bindings in the map, which is replaced instead of modified after the components are reconciled
+func outputBindingLister(outputBindings map[string]bindings.OutputBinding) func() map[string][]bindings.OperationKind {
+	return func() map[string][]bindings.OperationKind {
+		res := make(map[string][]bindings.OperationKind, len(outputBindings))
+		for name, binding := range outputBindings {
+			res[name] = binding.Operations()
 		}
-		return nil, fmt.Errorf("binding %s does not support operation %s. supported operations:%s", name, req.Operation, strings.Join(supported, " "))
+		return res
+	}
+}
+
+// applicationContext is the context of the GrpcAPIs serving the main app with the current components
+func (m *MosnRuntime) applicationContext() *grpc.ApplicationContext {
+	return &grpc.ApplicationContext{
+		m.runtimeConfig.AppManagement.AppId,
+		m.hellos,
+		m.configStores,
+		m.rpcs,
+		m.pubSubs,
+		m.states,
+		m.files,
+		m.locks,
+		m.sequencers,
+		outputBindingSender(m.outputBindings, m.runtimeConfig.Bindings),
+		m.secretStores,
+		outputBindingLister(m.outputBindings),
+		m.appCallback,
 	}
-	return nil, fmt.Errorf("couldn't find output binding %s", name)
 }
 
 func (m *MosnRuntime) Run(opts ...Option) (mgrpc.RegisteredServer, error) {
@@ -162,19 +243,7 @@ func (m *MosnRuntime) Run(opts ...Option) (mgrpc.RegisteredServer, error) {
 	}
 	// create GrpcAPIs
 	var apis []grpc.GrpcAPI
-	ac := &grpc.ApplicationContext{
-		m.runtimeConfig.AppManagement.AppId,
-		m.hellos,
-		m.configStores,
-		m.rpcs,
-		m.pubSubs,
-		m.states,
-		m.files,
-		m.locks,
-		m.sequencers,
-		m.sendToOutputBinding,
-		m.secretStores,
-	}
+	ac := m.applicationContext()
 
 	for _, apiFactory := range o.apiFactorys {
 		api := apiFactory(ac)
@@ -184,21 +253,154 @@ func (m *MosnRuntime) Run(opts ...Option) (mgrpc.RegisteredServer, error) {
 		}
 		apis = append(apis, api)
 	}
+	m.apiFactorys = o.apiFactorys
+	m.apis = apis
+	// serve the other apps with their own GrpcAPIs, and the later generations of components changed at runtime
+	if len(m.runtimeConfig.Tenants) > 0 || m.watchingCRDs() || m.runtimeConfig.Admin != nil {
+		tokens, err := appTokens(m.runtimeConfig)
+		if err != nil {
+			m.errInt(err, "tenants config is illegal")
+			return nil, err
+		}
+		routes, err := m.newRoutes(o.apiFactorys, apis, true)
+		if err != nil {
+			return nil, err
+		}
+		m.router = newAPIRouter(m.runtimeConfig.AppManagement.AppId, routes, tokens)
+	}
+	if d := m.runtimeConfig.GrpcDebug; d != nil {
+		apis = append(apis, grpc.NewDebugAPI(*d))
+	}
+	if a := m.runtimeConfig.Admin; a != nil {
+		if err := a.Validate(); err != nil {
+			m.errInt(err, "admin config is illegal")
+			return nil, err
+		}
+		apis = append(apis, newAdminAPI(m, a))
+	}
 	// put them into grpc options
+	if b := m.runtimeConfig.ResourceBudget; b != nil && b.MaxPayloadBytes > 0 {
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(rawGRPC.MaxRecvMsgSize(b.MaxPayloadBytes)))
+	}
+	if c := m.runtimeConfig.GrpcServer; c != nil {
+		if err := c.Validate(); err != nil {
+			m.errInt(err, "grpc server config is illegal")
+			return nil, err
+		}
+		// the streams are tracked before the others, so the ones rejected by the other interceptors aren't counted
+		m.drainer = grpc.NewDrainer(c.DrainGrace(), c.DrainTokens)
+		grpc.SetDrainer(m.drainer)
+		health.AddReadinessIndicator("grpcServer", health.IndicatorAdapter(m.drainer.ReadinessIndicator))
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(c.ServerOptions()...))
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(rawGRPC.ChainStreamInterceptor(m.drainer.StreamInterceptor)))
+	}
+	if m.runtimeConfig.Watchdog != nil {
+		m.watchdog = watchdog.New(m.runtimeConfig.Watchdog)
+		m.watchdog.Start()
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(
+			rawGRPC.ChainUnaryInterceptor(m.watchdog.UnaryInterceptor),
+			rawGRPC.ChainStreamInterceptor(m.watchdog.StreamInterceptor),
+		))
+	}
+	// reject the methods of the API groups disabled by the profile
+	grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(
+		rawGRPC.ChainUnaryInterceptor(m.profile.UnaryInterceptor),
+		rawGRPC.ChainStreamInterceptor(m.profile.StreamInterceptor),
+	))
+	// the faults are injected into the methods served only
+	if c := m.runtimeConfig.FaultInjection; c != nil {
+		faults, err := fault.New(c)
+		if err != nil {
+			m.errInt(err, "fault injection config is illegal")
+			return nil, err
+		}
+		m.faults = faults
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(
+			rawGRPC.ChainUnaryInterceptor(m.faults.UnaryInterceptor),
+			rawGRPC.ChainStreamInterceptor(m.faults.StreamInterceptor),
+		))
+	}
+	// the wasm filters run before the calls are routed to the servers of the tenants
+	if len(m.runtimeConfig.WasmFilters) > 0 {
+		filter, err := newWasmFilter(m.runtimeConfig.WasmFilters)
+		if err != nil {
+			m.errInt(err, "wasm filters are illegal")
+			return nil, err
+		}
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(rawGRPC.ChainUnaryInterceptor(filter)))
+	}
+	if m.router != nil {
+		grpcOpts = append(grpcOpts, grpc.WithGrpcOptions(
+			rawGRPC.ChainUnaryInterceptor(m.router.UnaryInterceptor),
+			rawGRPC.ChainStreamInterceptor(m.router.StreamInterceptor),
+		))
+	}
 	grpcOpts = append(grpcOpts,
 		grpc.WithGrpcOptions(o.options...),
 		grpc.WithGrpcAPIs(apis),
 	)
 	// create grpc server
-	var err error = nil
-	m.srv, err = grpc.NewGrpcServer(grpcOpts...)
-	return m.srv, err
+	srv, err := grpc.NewGrpcServer(grpcOpts...)
+	if err != nil {
+		return nil, err
+	}
+	m.srv = srv
+	// reconcile the components after the custom resources change
+	m.startReconcilingCRDs()
+	return m.srv, nil
 }
 
 func (m *MosnRuntime) Stop() {
+	m.stopReconcilingCRDs()
+	// the streams are closed gracefully, so the clients reconnect to another sidecar before it stops
+	drained := false
+	if m.drainer != nil {
+		m.drainer.Drain()
+		drained = m.drainer.Wait(m.runtimeConfig.GrpcServer.DrainGrace() + time.Second)
+		if !drained {
+			log.DefaultLogger.Warnf("[runtime] %d grpc streams are still open after draining", m.drainer.Streams())
+		}
+	}
 	if m.srv != nil {
-		m.srv.Stop()
+		if drained {
+			// the unary calls in flight are finished, and the clients are told to reconnect by GOAWAY
+			m.srv.GracefulStop()
+		} else {
+			m.srv.Stop()
+		}
+	}
+	if m.watchdog != nil {
+		m.watchdog.Stop()
+	}
+	for _, relay := range m.outboxRelays {
+		relay.Stop()
 	}
+	for _, janitor := range m.fileJanitors {
+		janitor.Stop()
+	}
+	for _, store := range m.bloomFilters {
+		store.Close()
+	}
+	if m.stopConnectionWatch != nil {
+		m.stopConnectionWatch()
+	}
+	// the configuration refreshed is written to the local cache before exiting
+	for _, store := range m.configStores {
+		if cached, ok := store.(*configstores.CachedStore); ok {
+			cached.Close()
+		}
+	}
+	// the pending writes are flushed before exiting
+	for _, store := range m.writeBehinds {
+		if err := store.Close(); err != nil {
+			log.DefaultLogger.Errorf("[runtime] close write-behind state store error: %v", err)
+		}
+	}
+	// the changes flushed above are published before exiting
+	for _, store := range m.changeEvents {
+		store.Close()
+	}
+	budget.Stop()
 	actuator.GetRuntimeReadinessIndicator().SetUnhealthy("shutdown")
 	actuator.GetRuntimeLivenessIndicator().SetUnhealthy("shutdown")
 }
@@ -207,11 +409,39 @@ func (m *MosnRuntime) initRuntime(o *runtimeOptions) error {
 	if m.runtimeConfig == nil {
 		return errors.New("[runtime] init error:no runtimeConfig")
 	}
+	// the components declared by the custom resources are merged into the config first
+	if err := m.initCRDs(); err != nil {
+		return err
+	}
+	if err := m.initProfile(); err != nil {
+		return err
+	}
+	// enforce the resource budget
+	budget.Init(m.runtimeConfig.ResourceBudget)
 	// init callback connection
 	if err := m.initAppCallbackConnection(); err != nil {
 		return err
 	}
-	// init all kinds of components with config
+	if err := m.initHTTPAppCallback(); err != nil {
+		return err
+	}
+	if err := m.initCallbackTargets(); err != nil {
+		return err
+	}
+	m.initDeclaredSubscriptions()
+	// init all kinds of components with config.
+	// The secret stores are initialized first, since the secrets are referred by the metadata of the other components,
+	// and they're used by file encryption
+	if err := m.initSecretStores(o.services.secretStores...); err != nil {
+		return err
+	}
+	if err := m.resolveSecretRefs(); err != nil {
+		m.errInt(err, "resolve secretKeyRef in runtime config failed")
+		return err
+	}
+	if err := m.initEgress(); err != nil {
+		return err
+	}
 	if err := m.initHellos(o.services.hellos...); err != nil {
 		return err
 	}
@@ -242,12 +472,134 @@ func (m *MosnRuntime) initRuntime(o *runtimeOptions) error {
 	if err := m.initOutputBinding(o.services.outputBinding...); err != nil {
 		return err
 	}
-	if err := m.initSecretStores(o.services.secretStores...); err != nil {
+	// resolve component names after all the components are ready
+	if err := m.initComponentAliases(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// initProfile resolves the profile, and drops the config of the API groups and the subsystems disabled by it,
+// so that their components and background goroutines don't start at all.
+func (m *MosnRuntime) initProfile() error {
+	profile, err := NewProfile(m.runtimeConfig.Profile)
+	if err != nil {
+		m.errInt(err, "runtime profile is illegal")
+		return err
+	}
+	m.profile = profile
+	log.DefaultLogger.Infof("[runtime] start with the profile %s", profile.Name())
+	c := m.runtimeConfig
+	ignored := func(kind, name string, enabled, configured bool) bool {
+		if !enabled && configured {
+			log.DefaultLogger.Warnf("[runtime] the config of %s %s is ignored, since it's disabled by the profile %s", kind, name, profile.Name())
+		}
+		return !enabled
+	}
+	dropGroup := func(group string, configured bool) bool {
+		return ignored("API group", group, profile.GroupEnabled(group), configured)
+	}
+	dropSubsystem := func(subsystem string, configured bool) bool {
+		return ignored("subsystem", subsystem, profile.SubsystemEnabled(subsystem), configured)
+	}
+	// API groups
+	if dropGroup(GroupHello, len(c.HelloServiceManagement) > 0) {
+		c.HelloServiceManagement = nil
+	}
+	if dropGroup(GroupConfiguration, len(c.ConfigStoreManagement) > 0) {
+		c.ConfigStoreManagement = nil
+	}
+	if dropGroup(GroupRpc, len(c.RpcManagement) > 0) {
+		c.RpcManagement = nil
+	}
+	if dropGroup(GroupPubSub, len(c.PubSubManagement) > 0) {
+		c.PubSubManagement = nil
+	}
+	if dropGroup(GroupState, len(c.StateManagement) > 0) {
+		c.StateManagement = nil
+	}
+	if dropGroup(GroupFile, len(c.Files) > 0) {
+		c.Files = nil
+	}
+	if dropGroup(GroupLock, len(c.LockManagement) > 0) {
+		c.LockManagement = nil
+	}
+	if dropGroup(GroupSequencer, len(c.SequencerManagement) > 0) {
+		c.SequencerManagement = nil
+	}
+	if dropGroup(GroupBinding, len(c.Bindings) > 0) {
+		c.Bindings = nil
+	}
+	if dropGroup(GroupSecret, len(c.SecretStoresManagement) > 0) {
+		c.SecretStoresManagement = nil
+	}
+	// subsystems
+	app := &c.AppManagement
+	if dropSubsystem(SubsystemAppCallback, app.GrpcCallbackPort != 0 || app.HttpCallback != nil || len(app.Callbacks) > 0) {
+		app.GrpcCallbackPort = 0
+		app.HttpCallback = nil
+		app.Callbacks = nil
+	}
+	for appId, t := range c.Tenants {
+		if dropSubsystem(SubsystemAppCallback, t.GrpcCallbackPort != 0 || t.HttpCallback != nil) {
+			t.GrpcCallbackPort = 0
+			t.HttpCallback = nil
+			c.Tenants[appId] = t
+		}
+	}
+	if dropSubsystem(SubsystemWatchdog, c.Watchdog != nil) {
+		c.Watchdog = nil
+	}
+	if dropSubsystem(SubsystemResourceBudget, c.ResourceBudget != nil) {
+		c.ResourceBudget = nil
+	}
+	if dropSubsystem(SubsystemGrpcDebug, c.GrpcDebug != nil) {
+		c.GrpcDebug = nil
+	}
+	if dropSubsystem(SubsystemFaultInjection, c.FaultInjection != nil) {
+		c.FaultInjection = nil
+	}
+	return nil
+}
+
+func (m *MosnRuntime) initComponentAliases() error {
+	if err := m.saveComponentAliases(m.crd.snapshot()); err != nil {
+		m.errInt(err, "init component aliases failed")
+		return err
+	}
+	return nil
+}
+
+// saveComponentAliases saves the default components and the aliases in the config and the custom resources,
+// the ones in the custom resources win
+func (m *MosnRuntime) saveComponentAliases(s *crd.Snapshot) error {
+	exists := func(kind alias.Kind, name string) bool {
+		var ok bool
+		switch kind {
+		case alias.State:
+			_, ok = m.states[name]
+		case alias.PubSub:
+			_, ok = m.pubSubs[name]
+		case alias.ConfigStore:
+			_, ok = m.configStores[name]
+		case alias.Lock:
+			_, ok = m.locks[name]
+		case alias.Sequencer:
+			_, ok = m.sequencers[name]
+		case alias.Binding:
+			_, ok = m.outputBindings[name]
+		case alias.SecretStore:
+			_, ok = m.secretStores[name]
+		}
+		return ok
+	}
+	defaults, aliases := m.runtimeConfig.DefaultComponents, m.runtimeConfig.ComponentAliases
+	if s != nil {
+		defaults, aliases = mergeComponentAliases(defaults, aliases, s.DefaultComponents, s.ComponentAliases)
+	}
+	return alias.Save(defaults, aliases, exists)
+}
+
 func (m *MosnRuntime) initHellos(hellos ...*hello.HelloFactory) error {
 	log.DefaultLogger.Infof("[runtime] init hello service")
 	// register all hello services implementation
@@ -281,6 +633,13 @@ func (m *MosnRuntime) initConfigStores(configStores ...*configstores.StoreFactor
 			m.errInt(err, "init configstore's component %s failed", name)
 			return err
 		}
+		if config.CacheDir != "" {
+			c, err = configstores.NewCachedStore(name, c, config.CacheDir)
+			if err != nil {
+				m.errInt(err, "init local cache of configstore's component %s failed", name)
+				return err
+			}
+		}
 		m.configStores[name] = c
 		v := actuators.GetIndicatorWithName(name)
 		//Now don't force user implement actuator of components
@@ -289,6 +648,10 @@ func (m *MosnRuntime) initConfigStores(configStores ...*configstores.StoreFactor
 			health.AddReadinessIndicator(name, v.ReadinessIndicator)
 		}
 	}
+	// the connection states are reported by the metrics
+	if len(m.configStores) > 0 {
+		m.stopConnectionWatch = configstores.WatchConnections(m.configStores, connectionWatchInterval)
+	}
 	return nil
 }
 
@@ -302,6 +665,7 @@ func (m *MosnRuntime) initRpcs(rpcs ...*rpc.Factory) error {
 			m.errInt(err, "create rpc's component %s failed", name)
 			return err
 		}
+		config.Egress = m.egress
 		if err := c.Init(config); err != nil {
 			m.errInt(err, "init rpc's component %s failed", name)
 			return err
@@ -328,11 +692,41 @@ func (m *MosnRuntime) initPubSubs(factorys ...*runtime_pubsub.Factory) error {
 		if consumerID == "" {
 			config.Metadata["consumerID"] = m.runtimeConfig.AppManagement.AppId
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "pubsub component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
 		// init this component with the config
 		if err := comp.Init(pubsub.Metadata{Properties: config.Metadata}); err != nil {
 			m.errInt(err, "init pubsub component %s failed", name)
 			return err
 		}
+		if config.Priority != nil {
+			comp, err = runtime_pubsub.NewPriorityPubSub(comp, config.Priority)
+			if err != nil {
+				m.errInt(err, "init priority of pubsub component %s failed", name)
+				return err
+			}
+		}
+		if config.DeadLetter != nil {
+			comp, err = runtime_pubsub.NewDeadLetterPubSub(comp, config.DeadLetter)
+			if err != nil {
+				m.errInt(err, "init dead-letter of pubsub component %s failed", name)
+				return err
+			}
+		}
+		if config.Transform != nil {
+			comp, err = runtime_pubsub.NewTransformPubSub(comp, config.Transform)
+			if err != nil {
+				m.errInt(err, "init transformation of pubsub component %s failed", name)
+				return err
+			}
+		}
+		if config.Async != nil {
+			async := runtime_pubsub.NewAsyncPubSub(comp, config.Async)
+			budget.Register("pubsub_async/"+name, async)
+			comp = async
+		}
 		// register this component
 		m.pubSubs[name] = comp
 	}
@@ -351,10 +745,91 @@ func (m *MosnRuntime) initStates(factorys ...*runtime_state.Factory) error {
 			m.errInt(err, "create state component %s failed", name)
 			return err
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "state component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
 		if err := comp.Init(state.Metadata{Properties: config.Metadata}); err != nil {
 			m.errInt(err, "init state component %s failed", name)
 			return err
 		}
+		// the outbox is relayed to the pubsubs, which are initialized before
+		if config.Outbox != nil {
+			store, ok := comp.(runtime_state.OutboxStore)
+			if !ok {
+				err = runtime_state.ErrOutboxNotSupported
+				m.errInt(err, "outbox of state component %s is illegal", name)
+				return err
+			}
+			relay := runtime_state.NewOutboxRelay(name, store, m.pubSubs, config.Outbox)
+			relay.Start()
+			m.outboxRelays[name] = relay
+		}
+		// the etags are the innermost, so that all the layers above see a store supporting etags
+		if config.ETag != nil {
+			if comp, err = runtime_state.NewETagStore(comp, config.ETag); err != nil {
+				m.errInt(err, "etag of state component %s is illegal", name)
+				return err
+			}
+		}
+		// the expire times are right above the etags, so that the expired values are deleted with their etags
+		if config.TTL != nil {
+			comp = runtime_state.NewTTLStore(comp, config.TTL)
+		}
+		if config.Compression != nil {
+			if comp, err = runtime_state.NewCompressedStore(comp, config.Compression); err != nil {
+				m.errInt(err, "compression of state component %s is illegal", name)
+				return err
+			}
+		}
+		// the changes are published once they are written to the store, so they're below the write-behind
+		if config.ChangeEvents != nil {
+			store, err := runtime_state.NewChangeEventStore(name, comp, m.pubSubs, config.ChangeEvents)
+			if err != nil {
+				m.errInt(err, "change events of state component %s is illegal", name)
+				return err
+			}
+			m.changeEvents[name] = store
+			comp = store
+		}
+		if config.WriteBehind != nil {
+			store, err := runtime_state.NewWriteBehindStore(name, comp, config.WriteBehind)
+			if err != nil {
+				m.errInt(err, "write-behind of state component %s is illegal", name)
+				return err
+			}
+			budget.Register("state_write_behind/"+name, store)
+			m.writeBehinds[name] = store
+			comp = store
+		}
+		// the values are validated after they're redacted, and the cache above keeps their content types
+		if config.TypedValues != nil {
+			comp = runtime_state.NewTypedStore(comp, config.TypedValues)
+		}
+		// the writes blocked aren't published, and the other layers never see the raw classified fields
+		if config.Classification != nil {
+			if comp, err = runtime_state.NewClassifiedStore(name, comp, m.runtimeConfig.DataClasses, config.Classification); err != nil {
+				m.errInt(err, "classification of state component %s is illegal", name)
+				return err
+			}
+		}
+		// the filter sees all the writes, and the cache above saves the reads of the keys present
+		if config.BloomFilter != nil {
+			store, err := runtime_state.NewBloomFilterStore(name, comp, config.BloomFilter)
+			if err != nil {
+				m.errInt(err, "bloom filter of state component %s is illegal", name)
+				return err
+			}
+			m.bloomFilters[name] = store
+			comp = store
+		}
+		// the cache is the outermost, so that the values cached are decompressed already
+		if config.Cache != nil {
+			comp = runtime_state.NewCachedStore(name, comp, config.Cache)
+			if consumer, ok := comp.(budget.Consumer); ok {
+				budget.Register("state_cache/"+name, consumer)
+			}
+		}
 		m.states[name] = comp
 		// 2.2. save prefix strategy
 		err = runtime_state.SaveStateConfiguration(name, config.Metadata)
@@ -381,6 +856,47 @@ func (m *MosnRuntime) initFiles(files ...*file.FileFactory) error {
 			m.errInt(err, "init files component %s failed", name)
 			return err
 		}
+		if cfg, ok := m.runtimeConfig.FileEncryption[name]; ok {
+			if c, err = m.newFileEncryption(c, &cfg); err != nil {
+				m.errInt(err, "file encryption of component %s is illegal", name)
+				return err
+			}
+		}
+		// the files are compressed before encryption
+		if cfg, ok := m.runtimeConfig.FileCompression[name]; ok {
+			if c, err = runtime_file.NewCompressedFile(c, &cfg); err != nil {
+				m.errInt(err, "file compression of component %s is illegal", name)
+				return err
+			}
+		}
+		if cfg, ok := m.runtimeConfig.FileEvents[name]; ok {
+			if err := cfg.Validate(); err != nil {
+				m.errInt(err, "file events of component %s is illegal", name)
+				return err
+			}
+			ps, ok := m.pubSubs[cfg.PubsubName]
+			if !ok {
+				err := fmt.Errorf("pubsub %s not found", cfg.PubsubName)
+				m.errInt(err, "file events of component %s is illegal", name)
+				return err
+			}
+			c = runtime_file.NewEventBridge(name, c, ps, &cfg)
+		}
+		if cfg, ok := m.runtimeConfig.FileJanitor[name]; ok {
+			cleaner, ok := file.AsUploadCleaner(c)
+			if !ok {
+				err := runtime_file.ErrUploadCleanerNotSupported
+				m.errInt(err, "file janitor of component %s is illegal", name)
+				return err
+			}
+			if err := cfg.Validate(); err != nil {
+				m.errInt(err, "file janitor of component %s is illegal", name)
+				return err
+			}
+			janitor := runtime_file.NewJanitor(name, cleaner, &cfg)
+			janitor.Start()
+			m.fileJanitors = append(m.fileJanitors, janitor)
+		}
 		m.files[name] = c
 		v := actuators.GetIndicatorWithName(name)
 		//Now don't force user implement actuator of components
@@ -392,6 +908,33 @@ func (m *MosnRuntime) initFiles(files ...*file.FileFactory) error {
 	return nil
 }
 
+// newFileEncryption wraps the file component with the master key in the secret store
+func (m *MosnRuntime) newFileEncryption(c file.File, cfg *runtime_file.EncryptionConfig) (file.File, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	store, ok := m.secretStores[cfg.SecretStore]
+	if !ok {
+		return nil, fmt.Errorf("secret store %s not found", cfg.SecretStore)
+	}
+	resp, err := store.GetSecret(secretstores.GetSecretRequest{Name: cfg.KeyName})
+	if err != nil {
+		return nil, fmt.Errorf("fail to get master key %s: %v", cfg.KeyName, err)
+	}
+	// the secret is a single value in most secret stores, otherwise the value with the same name is used
+	value, ok := resp.Data[cfg.KeyName]
+	if !ok && len(resp.Data) == 1 {
+		for _, v := range resp.Data {
+			value = v
+		}
+	}
+	key, err := runtime_file.ParseMasterKey(value)
+	if err != nil {
+		return nil, err
+	}
+	return runtime_file.NewEncryption(c, cfg.KeyName, key)
+}
+
 func (m *MosnRuntime) initLocks(factorys ...*runtime_lock.Factory) error {
 	log.DefaultLogger.Infof("[runtime] start initializing lock components")
 	// 1. register all the implementation
@@ -404,6 +947,10 @@ func (m *MosnRuntime) initLocks(factorys ...*runtime_lock.Factory) error {
 			m.errInt(err, "create lock component %s failed", name)
 			return err
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "lock component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
 		// 2.2. init
 		if err := comp.Init(lock.Metadata{Properties: config.Metadata}); err != nil {
 			m.errInt(err, "init lock component %s failed", name)
@@ -415,6 +962,22 @@ func (m *MosnRuntime) initLocks(factorys ...*runtime_lock.Factory) error {
 			m.errInt(err, "save lock configuration %s failed", name)
 			return err
 		}
+		// 2.4. serve the locks from the lock table in the sidecar
+		if cfg, ok := m.runtimeConfig.LockLocal[name]; ok {
+			if err := cfg.Validate(); err != nil {
+				m.errInt(err, "local lock of component %s is illegal", name)
+				return err
+			}
+			comp = runtime_lock.NewLocalLockStore(comp, &cfg)
+		}
+		// 2.5. record the metrics of the locks
+		if cfg, ok := m.runtimeConfig.LockStats[name]; ok {
+			if err := cfg.Validate(); err != nil {
+				m.errInt(err, "lock stats of component %s is illegal", name)
+				return err
+			}
+			comp = runtime_lock.NewStatsStore(name, comp, &cfg)
+		}
 		m.locks[name] = comp
 	}
 	return nil
@@ -432,6 +995,10 @@ func (m *MosnRuntime) initSequencers(factorys ...*runtime_sequencer.Factory) err
 			m.errInt(err, "create sequencer component %s failed", name)
 			return err
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "sequencer component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
 		// 2.2. init
 		if err = comp.Init(sequencer.Configuration{
 			Properties: config.Metadata,
@@ -446,6 +1013,35 @@ func (m *MosnRuntime) initSequencers(factorys ...*runtime_sequencer.Factory) err
 			m.errInt(err, "save sequencer configuration %s failed", name)
 			return err
 		}
+		if err = runtime_sequencer.SaveShardConfiguration(name, config.Shards, config.BiggerThan); err != nil {
+			m.errInt(err, "sequencer component %s shards are illegal", name)
+			return err
+		}
+		if config.Benchmark {
+			runtime_sequencer.EnableLatency(name)
+		}
+		// the ids of the regions aren't increasing globally, which are rejected by the watermarks
+		if config.Region != nil && config.Fencing != nil {
+			err = fmt.Errorf("region and fencing can't be configured together")
+			m.errInt(err, "sequencer component %s region is illegal", name)
+			return err
+		}
+		if config.Region != nil {
+			if comp, err = runtime_sequencer.NewRegionStore(name, comp, config.Region, config.BiggerThan); err != nil {
+				m.errInt(err, "sequencer component %s region is illegal", name)
+				return err
+			}
+		}
+		// the watermarks are saved in a state store, which is initialized before
+		if config.Fencing != nil {
+			watermarks, ok := m.states[config.Fencing.StateStore]
+			if !ok {
+				err = fmt.Errorf("state store %s of fencing not found", config.Fencing.StateStore)
+				m.errInt(err, "sequencer component %s fencing is illegal", name)
+				return err
+			}
+			comp = runtime_sequencer.NewFencedStore(name, comp, watermarks, config.Fencing)
+		}
 		m.sequencers[name] = comp
 	}
 	return nil
@@ -456,7 +1052,15 @@ func (m *MosnRuntime) initAppCallbackConnection() error {
 	if m.runtimeConfig == nil || m.runtimeConfig.AppManagement.GrpcCallbackPort == 0 {
 		return nil
 	}
-	port := m.runtimeConfig.AppManagement.GrpcCallbackPort
+	conn, err := dialAppCallback(m.runtimeConfig.AppManagement.GrpcCallbackPort)
+	if err != nil {
+		return err
+	}
+	m.AppCallbackConn = conn
+	return nil
+}
+
+func dialAppCallback(port int) (*rawGRPC.ClientConn, error) {
 	opts := []rawGRPC.DialOption{
 		rawGRPC.WithInsecure(),
 	}
@@ -466,9 +1070,87 @@ func (m *MosnRuntime) initAppCallbackConnection() error {
 	conn, err := rawGRPC.DialContext(ctx, fmt.Sprintf("127.0.0.1:%v", port), opts...)
 	if err != nil {
 		log.DefaultLogger.Warnf("[runtime]failed to init callback client at port %v : %s", port, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// initEgress loads the egress policy, which is nil if it's not configured
+func (m *MosnRuntime) initEgress() error {
+	if m.runtimeConfig.Egress == nil {
+		return nil
+	}
+	policy, err := egress.NewPolicy(m.runtimeConfig.Egress)
+	if err != nil {
+		m.errInt(err, "init egress policy failed")
 		return err
 	}
-	m.AppCallbackConn = conn
+	m.egress = policy
+	return nil
+}
+
+func (m *MosnRuntime) initHTTPAppCallback() error {
+	cfg := m.runtimeConfig.AppManagement.HttpCallback
+	if cfg == nil {
+		return nil
+	}
+	cb, err := runtime_pubsub.NewHTTPAppCallback(*cfg)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] init http callback error: %v", err)
+		return err
+	}
+	m.appCallback = cb
+	return nil
+}
+
+// initCallbackTargets dispatches the events to the extra callback targets besides the app
+func (m *MosnRuntime) initCallbackTargets() error {
+	cfgs := m.runtimeConfig.AppManagement.Callbacks
+	if len(cfgs) == 0 {
+		return nil
+	}
+	targets := make(map[string]runtime_pubsub.CallbackTarget, len(cfgs)+1)
+	// 1. the app itself
+	if m.appCallback != nil {
+		targets[runtime_pubsub.MainCallbackTarget] = runtime_pubsub.CallbackTarget{Client: m.appCallback, AckRequired: true}
+	} else if m.AppCallbackConn != nil {
+		targets[runtime_pubsub.MainCallbackTarget] = runtime_pubsub.CallbackTarget{
+			Client:      runtimev1pb.NewAppCallbackClient(m.AppCallbackConn),
+			AckRequired: true,
+		}
+	}
+	// 2. the extra targets
+	for name, cfg := range cfgs {
+		if name == runtime_pubsub.MainCallbackTarget || cfg == nil {
+			return fmt.Errorf("[runtime] invalid callback target: %s", name)
+		}
+		target := runtime_pubsub.CallbackTarget{}
+		switch cfg.Ack {
+		case "", runtime_pubsub.AckRequired:
+			target.AckRequired = true
+		case runtime_pubsub.AckNone:
+		default:
+			return fmt.Errorf("[runtime] unknown ack of callback target %s: %s", name, cfg.Ack)
+		}
+		if cfg.HttpCallback != nil {
+			cb, err := runtime_pubsub.NewHTTPAppCallback(*cfg.HttpCallback)
+			if err != nil {
+				log.DefaultLogger.Errorf("[runtime] init callback target %s error: %v", name, err)
+				return err
+			}
+			target.Client = cb
+		} else if cfg.GrpcPort != 0 {
+			conn, err := dialAppCallback(cfg.GrpcPort)
+			if err != nil {
+				return err
+			}
+			target.Client = runtimev1pb.NewAppCallbackClient(conn)
+		} else {
+			return fmt.Errorf("[runtime] neither grpc_port nor http_callback is configured for callback target %s", name)
+		}
+		targets[name] = target
+	}
+	m.appCallback = runtime_pubsub.NewFanOutCallback(targets)
 	return nil
 }
 
@@ -484,12 +1166,27 @@ func (m *MosnRuntime) initOutputBinding(factorys ...*mbindings.OutputBindingFact
 			m.errInt(err, "create outbinding component %s failed", name)
 			return err
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "outbinding component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
+		if err := config.Validate(); err != nil {
+			m.errInt(err, "outbinding component %s operation metadata is illegal", name)
+			return err
+		}
 		// 2.2. init
 		if err := comp.Init(bindings.Metadata{Name: name, Properties: config.Metadata}); err != nil {
 			m.errInt(err, "init outbinding component %s failed", name)
 			return err
 		}
-		// 2.3. put it into the runtime component pool
+		// 2.3. the requests of the http binding are sent by the egress policy
+		if name == mbindings.HTTPBindingName && m.egress != nil {
+			if comp, err = mbindings.NewEgressHTTPBinding(comp, m.egress, config.Metadata); err != nil {
+				m.errInt(err, "init egress of outbinding component %s failed", name)
+				return err
+			}
+		}
+		// 2.4. put it into the runtime component pool
 		m.outputBindings[name] = comp
 	}
 	return nil
@@ -512,6 +1209,10 @@ func (m *MosnRuntime) initSecretStores(factorys ...*msecretstores.SecretStoresFa
 			m.errInt(err, "create secretStore component %s failed", name)
 			return err
 		}
+		if err := validateMetadata(comp, config.Metadata); err != nil {
+			m.errInt(err, "secretStore component %s metadata %v is illegal", name, maskMetadata(comp, config.Metadata))
+			return err
+		}
 		// 2.2. init
 		if err := comp.Init(secretstores.Metadata{Properties: config.Metadata}); err != nil {
 			m.errInt(err, "init secretStore component %s failed", name)
@@ -523,3 +1224,32 @@ func (m *MosnRuntime) initSecretStores(factorys ...*msecretstores.SecretStoresFa
 	}
 	return nil
 }
+
+// validateMetadata checks the metadata against the schema if the component declares one,
+// so that a misconfigured component fails fast with a clear message instead of failing at runtime.
+func validateMetadata(comp interface{}, properties map[string]string) error {
+	provider, ok := comp.(schema.Provider)
+	if !ok {
+		return nil
+	}
+	s := provider.MetadataSchema()
+	if s == nil {
+		return nil
+	}
+	return s.Validate(properties)
+}
+
+// maskMetadata returns a copy of the metadata in which the secret fields declared by the component are masked,
+// so that it can be printed in the logs.
+// It returns nil if the component doesn't declare a schema, as the secret fields are unknown.
+func maskMetadata(comp interface{}, properties map[string]string) map[string]string {
+	provider, ok := comp.(schema.Provider)
+	if !ok {
+		return nil
+	}
+	s := provider.MetadataSchema()
+	if s == nil {
+		return nil
+	}
+	return s.Mask(properties)
+}
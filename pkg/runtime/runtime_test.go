@@ -19,6 +19,7 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"google.golang.org/grpc/test/bufconn"
 	"mosn.io/layotto/pkg/grpc/default_api"
@@ -84,6 +85,89 @@ func TestMosnRuntime_Run(t *testing.T) {
 		rt.Stop()
 	})
 
+	t.Run("run with profile", func(t *testing.T) {
+		runtimeConfig := &MosnRuntimeConfig{
+			Profile: &ProfileConfig{Name: ProfileMinimal},
+			// the locks are ignored by the minimal profile
+			LockManagement: map[string]lock.Config{
+				"mock": {},
+			},
+		}
+		rt := NewMosnRuntime(runtimeConfig)
+		server, err := rt.Run(
+			WithGrpcAPI(
+				default_api.NewGrpcAPI,
+			),
+		)
+		assert.Nil(t, err)
+		assert.NotNil(t, server)
+		assert.Empty(t, rt.locks)
+		rt.Stop()
+	})
+
+	t.Run("illegal profile", func(t *testing.T) {
+		rt := NewMosnRuntime(&MosnRuntimeConfig{Profile: &ProfileConfig{Name: "tiny"}})
+		_, err := rt.Run(
+			WithGrpcAPI(
+				default_api.NewGrpcAPI,
+			),
+		)
+		assert.NotNil(t, err)
+		rt.Stop()
+	})
+
+	t.Run("run with tenants", func(t *testing.T) {
+		runtimeConfig := &MosnRuntimeConfig{
+			AppManagement: AppConfig{AppId: "main", Tokens: []string{"main-token"}},
+			Tenants: map[string]TenantConfig{
+				"app1": {Tokens: []string{"app1-token"}},
+			},
+		}
+		rt := NewMosnRuntime(runtimeConfig)
+		server, err := rt.Run(
+			WithGrpcAPI(
+				default_api.NewGrpcAPI,
+			),
+		)
+		assert.Nil(t, err)
+		assert.NotNil(t, server)
+		rt.Stop()
+	})
+
+	t.Run("tenant without tokens", func(t *testing.T) {
+		runtimeConfig := &MosnRuntimeConfig{
+			AppManagement: AppConfig{AppId: "main"},
+			Tenants: map[string]TenantConfig{
+				"app1": {Tokens: []string{"app1-token"}},
+			},
+		}
+		rt := NewMosnRuntime(runtimeConfig)
+		_, err := rt.Run(
+			WithGrpcAPI(
+				default_api.NewGrpcAPI,
+			),
+		)
+		assert.True(t, errors.Is(err, ErrAppTokensEmpty))
+		rt.Stop()
+	})
+
+	t.Run("tenant with unknown component", func(t *testing.T) {
+		runtimeConfig := &MosnRuntimeConfig{
+			AppManagement: AppConfig{AppId: "main", Tokens: []string{"main-token"}},
+			Tenants: map[string]TenantConfig{
+				"app1": {Tokens: []string{"app1-token"}, Components: map[string][]string{GroupState: {"redis"}}},
+			},
+		}
+		rt := NewMosnRuntime(runtimeConfig)
+		_, err := rt.Run(
+			WithGrpcAPI(
+				default_api.NewGrpcAPI,
+			),
+		)
+		assert.NotNil(t, err)
+		rt.Stop()
+	})
+
 	t.Run("no runtime config", func(t *testing.T) {
 		rt := NewMosnRuntime(nil)
 		_, err := rt.Run(
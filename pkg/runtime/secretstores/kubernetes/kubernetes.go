@@ -0,0 +1,248 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dapr/components-contrib/secretstores"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	msecretstores "mosn.io/layotto/pkg/runtime/secretstores"
+)
+
+var ErrCacheNotSynced = errors.New("kubernetes secret store failed to sync the cache")
+
+// SecretStore is a secret store of the Secrets in a namespace of Kubernetes.
+// With cacheEnabled, the Secrets are cached by an informer, which is shared by the watchers of the namespace.
+type SecretStore struct {
+	metadata *metadata
+	selector labels.Selector
+	client   kubernetes.Interface
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// lister reads the cache of the namespace, it's nil if the cache is disabled
+	lister corelisters.SecretLister
+
+	mu       sync.RWMutex
+	watchers map[*watcher]struct{}
+}
+
+// NewSecretStore returns a new kubernetes secret store
+func NewSecretStore() secretstores.SecretStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SecretStore{
+		ctx:      ctx,
+		cancel:   cancel,
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (s *SecretStore) Init(md secretstores.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	config, err := restConfig(m.kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return s.init(m, client)
+}
+
+func restConfig(kubeconfigPath string) (*rest.Config, error) {
+	if kubeconfigPath == "" {
+		return rest.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+}
+
+func (s *SecretStore) init(m *metadata, client kubernetes.Interface) error {
+	selector, err := labels.Parse(m.labelSelector)
+	if err != nil {
+		return err
+	}
+	s.metadata = m
+	s.selector = selector
+	s.client = client
+	if !m.cacheEnabled {
+		return nil
+	}
+	factory := s.informerFactory(m.namespace, "")
+	informer := factory.Core().V1().Secrets().Informer()
+	s.lister = factory.Core().V1().Secrets().Lister()
+	// the watchers of the namespace share the informer
+	informer.AddEventHandler(s)
+	factory.Start(s.ctx.Done())
+	if !cache.WaitForCacheSync(s.ctx.Done(), informer.HasSynced) {
+		return ErrCacheNotSynced
+	}
+	return nil
+}
+
+// informerFactory returns the factory of the informers of the Secrets matching the label selector.
+// The Secret of the name is watched only if the name isn't empty.
+func (s *SecretStore) informerFactory(namespace string, name string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(s.client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = s.metadata.labelSelector
+			if name != "" {
+				o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			}
+		}))
+}
+
+func (s *SecretStore) GetSecret(req secretstores.GetSecretRequest) (secretstores.GetSecretResponse, error) {
+	namespace := s.metadata.namespaceOf(req.Metadata)
+	var secret *corev1.Secret
+	var err error
+	if s.lister != nil && namespace == s.metadata.namespace {
+		secret, err = s.lister.Secrets(namespace).Get(req.Name)
+	} else {
+		secret, err = s.client.CoreV1().Secrets(namespace).Get(s.ctx, req.Name, metav1.GetOptions{})
+		// the secrets out of the label selector are invisible, the same as the cached ones
+		if err == nil && !s.selector.Matches(labels.Set(secret.Labels)) {
+			err = apierrors.NewNotFound(corev1.Resource("secrets"), req.Name)
+		}
+	}
+	if err != nil {
+		return secretstores.GetSecretResponse{}, err
+	}
+	return secretstores.GetSecretResponse{Data: secretData(secret)}, nil
+}
+
+func (s *SecretStore) BulkGetSecret(req secretstores.BulkGetSecretRequest) (secretstores.BulkGetSecretResponse, error) {
+	namespace := s.metadata.namespaceOf(req.Metadata)
+	var secrets []*corev1.Secret
+	if s.lister != nil && namespace == s.metadata.namespace {
+		list, err := s.lister.Secrets(namespace).List(s.selector)
+		if err != nil {
+			return secretstores.BulkGetSecretResponse{}, err
+		}
+		secrets = list
+	} else {
+		list, err := s.client.CoreV1().Secrets(namespace).List(s.ctx, metav1.ListOptions{LabelSelector: s.metadata.labelSelector})
+		if err != nil {
+			return secretstores.BulkGetSecretResponse{}, err
+		}
+		for i := range list.Items {
+			secrets = append(secrets, &list.Items[i])
+		}
+	}
+	resp := secretstores.BulkGetSecretResponse{Data: make(map[string]map[string]string, len(secrets))}
+	for _, secret := range secrets {
+		resp.Data[secret.Name] = secretData(secret)
+	}
+	return resp, nil
+}
+
+// Watch watches the Secrets by the shared informer if the cache is enabled and the namespace is the same,
+// otherwise by an informer of the request, which is stopped when ctx is done.
+func (s *SecretStore) Watch(ctx context.Context, req *msecretstores.WatchRequest, handler func(*msecretstores.SecretEvent)) error {
+	w := newWatcher(req.Keys, handler)
+	go w.run(ctx)
+	namespace := s.metadata.namespaceOf(req.Metadata)
+	if s.lister != nil && namespace == s.metadata.namespace {
+		s.mu.Lock()
+		// the current values are pushed before the events dispatched after the lock
+		secrets, err := s.lister.Secrets(namespace).List(s.selector)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		for _, secret := range secrets {
+			w.OnAdd(secret)
+		}
+		s.watchers[w] = struct{}{}
+		s.mu.Unlock()
+		go func() {
+			<-ctx.Done()
+			s.mu.Lock()
+			delete(s.watchers, w)
+			s.mu.Unlock()
+		}()
+		return nil
+	}
+	name := ""
+	if len(req.Keys) == 1 {
+		name = req.Keys[0]
+	}
+	factory := s.informerFactory(namespace, name)
+	// the Secrets are pushed as added events when the informer lists them
+	factory.Core().V1().Secrets().Informer().AddEventHandler(w)
+	factory.Start(ctx.Done())
+	return nil
+}
+
+// OnAdd dispatches the event of the shared informer to the watchers
+func (s *SecretStore) OnAdd(obj interface{}) {
+	s.mu.RLock()
+	for w := range s.watchers {
+		w.OnAdd(obj)
+	}
+	s.mu.RUnlock()
+}
+
+// OnUpdate dispatches the event of the shared informer to the watchers
+func (s *SecretStore) OnUpdate(oldObj, newObj interface{}) {
+	s.mu.RLock()
+	for w := range s.watchers {
+		w.OnUpdate(oldObj, newObj)
+	}
+	s.mu.RUnlock()
+}
+
+// OnDelete dispatches the event of the shared informer to the watchers
+func (s *SecretStore) OnDelete(obj interface{}) {
+	s.mu.RLock()
+	for w := range s.watchers {
+		w.OnDelete(obj)
+	}
+	s.mu.RUnlock()
+}
+
+// Close stops the informers
+func (s *SecretStore) Close() error {
+	s.cancel()
+	return nil
+}
+
+func secretData(secret *corev1.Secret) map[string]string {
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data
+}
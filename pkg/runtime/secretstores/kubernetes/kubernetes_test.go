@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	msecretstores "mosn.io/layotto/pkg/runtime/secretstores"
+)
+
+func newSecret(namespace, name, value string, labels map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Data:       map[string][]byte{"password": []byte(value)},
+	}
+}
+
+func newTestStore(t *testing.T, m *metadata, objs ...runtime.Object) (*SecretStore, *fake.Clientset, chan struct{}) {
+	client := fake.NewSimpleClientset(objs...)
+	// the fake client misses the changes before the watch of informers is started
+	watchStarted := make(chan struct{}, 1)
+	client.PrependWatchReactor("secrets", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watchStarted <- struct{}{}:
+		default:
+		}
+		return false, nil, nil
+	})
+	s := NewSecretStore().(*SecretStore)
+	assert.Nil(t, s.init(m, client))
+	return s, client, watchStarted
+}
+
+func TestGetSecret(t *testing.T) {
+	for _, cacheEnabled := range []bool{false, true} {
+		s, _, _ := newTestStore(t, &metadata{namespace: "default", cacheEnabled: cacheEnabled, labelSelector: "app=layotto"},
+			newSecret("default", "db", "123", map[string]string{"app": "layotto"}),
+			newSecret("default", "other", "456", nil),
+			newSecret("prod", "db", "789", map[string]string{"app": "layotto"}),
+		)
+
+		resp, err := s.GetSecret(secretstores.GetSecretRequest{Name: "db"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"password": "123"}, resp.Data)
+
+		// the namespace of the request is read from the API server
+		resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db", Metadata: map[string]string{namespaceKey: "prod"}})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"password": "789"}, resp.Data)
+
+		// the secrets out of the label selector are not found
+		_, err = s.GetSecret(secretstores.GetSecretRequest{Name: "other"})
+		assert.True(t, apierrors.IsNotFound(err))
+
+		bulk, err := s.BulkGetSecret(secretstores.BulkGetSecretRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]string{"db": {"password": "123"}}, bulk.Data)
+		s.Close()
+	}
+}
+
+func receive(t *testing.T, events chan *msecretstores.SecretEvent) *msecretstores.SecretEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no secret event")
+		return nil
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, cacheEnabled := range []bool{false, true} {
+		s, client, watchStarted := newTestStore(t, &metadata{namespace: "default", cacheEnabled: cacheEnabled},
+			newSecret("default", "db", "123", nil),
+			newSecret("default", "other", "456", nil),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		events := make(chan *msecretstores.SecretEvent, 10)
+		err := s.Watch(ctx, &msecretstores.WatchRequest{Keys: []string{"db"}}, func(e *msecretstores.SecretEvent) {
+			events <- e
+		})
+		assert.Nil(t, err)
+
+		// the current value first
+		e := receive(t, events)
+		assert.Equal(t, "db", e.Key)
+		assert.Equal(t, map[string]string{"password": "123"}, e.Data)
+
+		<-watchStarted
+		// the rotation
+		updated := newSecret("default", "db", "abc", nil)
+		updated.ResourceVersion = "2"
+		_, err = client.CoreV1().Secrets("default").Update(ctx, updated, metav1.UpdateOptions{})
+		assert.Nil(t, err)
+		e = receive(t, events)
+		assert.Equal(t, map[string]string{"password": "abc"}, e.Data)
+		assert.False(t, e.Deleted)
+
+		// the secrets not watched are ignored
+		assert.Nil(t, client.CoreV1().Secrets("default").Delete(ctx, "other", metav1.DeleteOptions{}))
+		assert.Nil(t, client.CoreV1().Secrets("default").Delete(ctx, "db", metav1.DeleteOptions{}))
+		e = receive(t, events)
+		assert.Equal(t, "db", e.Key)
+		assert.True(t, e.Deleted)
+
+		cancel()
+		s.Close()
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	namespaceKey      = "namespace"
+	kubeconfigPathKey = "kubeconfigPath"
+	cacheEnabledKey   = "cacheEnabled"
+	labelSelectorKey  = "labelSelector"
+
+	namespaceEnv     = "NAMESPACE"
+	defaultNamespace = "default"
+)
+
+type metadata struct {
+	namespace string
+	// kubeconfigPath is used out of the cluster, the in-cluster config is used if it's empty
+	kubeconfigPath string
+	// cacheEnabled caches the secrets of the namespace by an informer, which watches the API server
+	cacheEnabled  bool
+	labelSelector string
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		namespace:      props[namespaceKey],
+		kubeconfigPath: props[kubeconfigPathKey],
+		labelSelector:  props[labelSelectorKey],
+	}
+	if m.namespace == "" {
+		m.namespace = os.Getenv(namespaceEnv)
+	}
+	if m.namespace == "" {
+		m.namespace = defaultNamespace
+	}
+	if s := props[cacheEnabledKey]; s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes secret store %s is invalid: %s", cacheEnabledKey, s)
+		}
+		m.cacheEnabled = b
+	}
+	return m, nil
+}
+
+// namespaceOf returns the namespace of the request, which overrides the one of the component
+func (m *metadata) namespaceOf(props map[string]string) string {
+	if ns := props[namespaceKey]; ns != "" {
+		return ns
+	}
+	return m.namespace
+}
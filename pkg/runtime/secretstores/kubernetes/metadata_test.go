@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	os.Unsetenv(namespaceEnv)
+	m, err := parseMetadata(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultNamespace, m.namespace)
+	assert.False(t, m.cacheEnabled)
+
+	os.Setenv(namespaceEnv, "env")
+	defer os.Unsetenv(namespaceEnv)
+	m, err = parseMetadata(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "env", m.namespace)
+
+	m, err = parseMetadata(map[string]string{
+		namespaceKey:      "prod",
+		kubeconfigPathKey: "/root/.kube/config",
+		cacheEnabledKey:   "true",
+		labelSelectorKey:  "app=layotto",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", m.namespace)
+	assert.Equal(t, "/root/.kube/config", m.kubeconfigPath)
+	assert.True(t, m.cacheEnabled)
+	assert.Equal(t, "app=layotto", m.labelSelector)
+
+	// the namespace of requests overrides the one of the component
+	assert.Equal(t, "prod", m.namespaceOf(nil))
+	assert.Equal(t, "test", m.namespaceOf(map[string]string{namespaceKey: "test"}))
+
+	_, err = parseMetadata(map[string]string{cacheEnabledKey: "yes"})
+	assert.NotNil(t, err)
+}
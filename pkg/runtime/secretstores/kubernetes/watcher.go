@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	msecretstores "mosn.io/layotto/pkg/runtime/secretstores"
+)
+
+// watcher filters the events of an informer by the keys, and calls the handler in its own goroutine,
+// so that a slow handler doesn't block the informer.
+type watcher struct {
+	keys    map[string]bool
+	handler func(*msecretstores.SecretEvent)
+
+	mu      sync.Mutex
+	pending []*msecretstores.SecretEvent
+	notify  chan struct{}
+}
+
+func newWatcher(keys []string, handler func(*msecretstores.SecretEvent)) *watcher {
+	w := &watcher{
+		handler: handler,
+		notify:  make(chan struct{}, 1),
+	}
+	if len(keys) > 0 {
+		w.keys = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			w.keys[k] = true
+		}
+	}
+	return w
+}
+
+func (w *watcher) OnAdd(obj interface{}) {
+	if secret, ok := obj.(*corev1.Secret); ok {
+		w.push(secret, false)
+	}
+}
+
+func (w *watcher) OnUpdate(oldObj, newObj interface{}) {
+	oldSecret, ok1 := oldObj.(*corev1.Secret)
+	newSecret, ok2 := newObj.(*corev1.Secret)
+	// the resyncs aren't changes
+	if !ok1 || !ok2 || oldSecret.ResourceVersion == newSecret.ResourceVersion {
+		return
+	}
+	w.push(newSecret, false)
+}
+
+func (w *watcher) OnDelete(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	if secret, ok := obj.(*corev1.Secret); ok {
+		w.push(secret, true)
+	}
+}
+
+func (w *watcher) push(secret *corev1.Secret, deleted bool) {
+	if w.keys != nil && !w.keys[secret.Name] {
+		return
+	}
+	e := &msecretstores.SecretEvent{Key: secret.Name, Deleted: deleted}
+	if !deleted {
+		e.Data = secretData(secret)
+	}
+	w.mu.Lock()
+	w.pending = append(w.pending, e)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run calls the handler with the pending events in order until ctx is done
+func (w *watcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.notify:
+		}
+		w.mu.Lock()
+		events := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+		for _, e := range events {
+			if ctx.Err() != nil {
+				return
+			}
+			w.handler(e)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretmanager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// the keys are compatible with the aws secret manager component of dapr
+const (
+	accessKeyKey    = "accessKey"
+	secretKeyKey    = "secretKey"
+	sessionTokenKey = "sessionToken"
+	regionKey       = "region"
+	endpointKey     = "endpoint"
+	// the default version stage of the component
+	versionStageComponentKey = "versionStage"
+	extractJSONKey           = "extractJSON"
+
+	// the metadata of requests, the keys of dapr and their snake case are both accepted
+	versionIDKey         = "VersionID"
+	versionStageKey      = "VersionStage"
+	versionIDSnakeKey    = "version_id"
+	versionStageSnakeKey = "version_stage"
+
+	// VersionStageCurrent is the current version of secrets
+	VersionStageCurrent = "AWSCURRENT"
+	// VersionStagePrevious is the previous version of secrets during the rotation
+	VersionStagePrevious = "AWSPREVIOUS"
+)
+
+var ErrRegionEmpty = errors.New("aws secret manager region is empty")
+
+type metadata struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	endpoint     string
+	// versionStage is used if the request specifies neither the version id nor the version stage
+	versionStage string
+	// extractJSON extracts the fields of the secret string if it's a json object, it's false by default like dapr
+	extractJSON bool
+}
+
+func parseMetadata(props map[string]string) (*metadata, error) {
+	m := &metadata{
+		accessKey:    props[accessKeyKey],
+		secretKey:    props[secretKeyKey],
+		sessionToken: props[sessionTokenKey],
+		region:       props[regionKey],
+		endpoint:     props[endpointKey],
+		versionStage: props[versionStageComponentKey],
+	}
+	if m.region == "" {
+		return nil, ErrRegionEmpty
+	}
+	if m.versionStage == "" {
+		m.versionStage = VersionStageCurrent
+	}
+	if s := props[extractJSONKey]; s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("aws secret manager %s is invalid: %s", extractJSONKey, s)
+		}
+		m.extractJSON = b
+	}
+	return m, nil
+}
+
+// requestMetadata returns the value of the key in the metadata of a request, or the value of the snake case key
+func requestMetadata(md map[string]string, key string, snakeKey string) string {
+	if v := md[key]; v != "" {
+		return v
+	}
+	return md[snakeKey]
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	_, err := parseMetadata(map[string]string{})
+	assert.Equal(t, ErrRegionEmpty, err)
+
+	m, err := parseMetadata(map[string]string{regionKey: "us-east-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, VersionStageCurrent, m.versionStage)
+	assert.False(t, m.extractJSON)
+
+	m, err = parseMetadata(map[string]string{
+		regionKey:                "us-east-1",
+		accessKeyKey:             "ak",
+		secretKeyKey:             "sk",
+		versionStageComponentKey: VersionStagePrevious,
+		extractJSONKey:           "true",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "ak", m.accessKey)
+	assert.Equal(t, VersionStagePrevious, m.versionStage)
+	assert.True(t, m.extractJSON)
+
+	_, err = parseMetadata(map[string]string{regionKey: "us-east-1", extractJSONKey: "yes"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretmanager
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/dapr/components-contrib/secretstores"
+)
+
+// SecretManager is a secret store of AWS Secrets Manager.
+// The version of a secret is selected by the "VersionID" or "VersionStage" metadata of requests like dapr,
+// e.g. AWSPREVIOUS during the rotation, and the secret string of a json object can be extracted to its fields.
+type SecretManager struct {
+	metadata *metadata
+	client   secretsmanageriface.SecretsManagerAPI
+}
+
+// NewSecretManager returns a new aws secret manager secret store
+func NewSecretManager() secretstores.SecretStore {
+	return &SecretManager{}
+}
+
+func (s *SecretManager) Init(md secretstores.Metadata) error {
+	m, err := parseMetadata(md.Properties)
+	if err != nil {
+		return err
+	}
+	s.metadata = m
+	cfg := aws.NewConfig().WithRegion(m.region)
+	if m.endpoint != "" {
+		cfg = cfg.WithEndpoint(m.endpoint)
+	}
+	if m.accessKey != "" {
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(m.accessKey, m.secretKey, m.sessionToken))
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return err
+	}
+	s.client = secretsmanager.New(sess)
+	return nil
+}
+
+func (s *SecretManager) GetSecret(req secretstores.GetSecretRequest) (secretstores.GetSecretResponse, error) {
+	data, err := s.getSecret(req.Name, requestMetadata(req.Metadata, versionIDKey, versionIDSnakeKey),
+		requestMetadata(req.Metadata, versionStageKey, versionStageSnakeKey))
+	if err != nil {
+		return secretstores.GetSecretResponse{}, err
+	}
+	return secretstores.GetSecretResponse{Data: data}, nil
+}
+
+// BulkGetSecret gets the secrets in the version stage of the request, or the default one of the component
+func (s *SecretManager) BulkGetSecret(req secretstores.BulkGetSecretRequest) (secretstores.BulkGetSecretResponse, error) {
+	var names []string
+	err := s.client.ListSecretsPages(&secretsmanager.ListSecretsInput{}, func(out *secretsmanager.ListSecretsOutput, lastPage bool) bool {
+		for _, e := range out.SecretList {
+			names = append(names, aws.StringValue(e.Name))
+		}
+		return true
+	})
+	if err != nil {
+		return secretstores.BulkGetSecretResponse{}, err
+	}
+	resp := secretstores.BulkGetSecretResponse{Data: make(map[string]map[string]string, len(names))}
+	for _, name := range names {
+		data, err := s.getSecret(name, "", requestMetadata(req.Metadata, versionStageKey, versionStageSnakeKey))
+		if err != nil {
+			// the secrets without the version stage are skipped, e.g. the ones never rotated have no AWSPREVIOUS
+			if isNotFound(err) {
+				continue
+			}
+			return secretstores.BulkGetSecretResponse{}, err
+		}
+		resp.Data[name] = data
+	}
+	return resp, nil
+}
+
+func (s *SecretManager) getSecret(name string, versionID string, versionStage string) (map[string]string, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	if versionID == "" && versionStage == "" {
+		versionStage = s.metadata.versionStage
+	}
+	if versionStage != "" {
+		input.VersionStage = aws.String(versionStage)
+	}
+	out, err := s.client.GetSecretValue(input)
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return map[string]string{name: string(out.SecretBinary)}, nil
+	}
+	value := aws.StringValue(out.SecretString)
+	if s.metadata.extractJSON {
+		if fields, ok := jsonFields(value); ok {
+			return fields, nil
+		}
+	}
+	return map[string]string{name: value}, nil
+}
+
+// jsonFields returns the fields of the json object, e.g. the username and the password of a database secret.
+// The values which aren't strings are kept in json.
+func jsonFields(value string) (map[string]string, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return nil, false
+	}
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	var obj map[string]interface{}
+	if err := d.Decode(&obj); err != nil || d.More() {
+		return nil, false
+	}
+	fields := make(map[string]string, len(obj))
+	for k, v := range obj {
+		if str, ok := v.(string); ok {
+			fields[k] = str
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		fields[k] = string(b)
+	}
+	return fields, true
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(awserr.Error)
+	return ok && e.Code() == secretsmanager.ErrCodeResourceNotFoundException
+}
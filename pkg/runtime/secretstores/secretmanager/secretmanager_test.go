@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretmanager
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockClient keeps the secret strings by the names and the version stages
+type mockClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]map[string]string
+}
+
+func (m *mockClient) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	stage := aws.StringValue(input.VersionStage)
+	if input.VersionId != nil {
+		stage = aws.StringValue(input.VersionId)
+	}
+	value, ok := m.secrets[aws.StringValue(input.SecretId)][stage]
+	if !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	return &secretsmanager.GetSecretValueOutput{Name: input.SecretId, SecretString: aws.String(value)}, nil
+}
+
+func (m *mockClient) ListSecretsPages(input *secretsmanager.ListSecretsInput, fn func(*secretsmanager.ListSecretsOutput, bool) bool) error {
+	// a page for every secret
+	names := []string{"db", "token"}
+	for i, name := range names {
+		out := &secretsmanager.ListSecretsOutput{SecretList: []*secretsmanager.SecretListEntry{{Name: aws.String(name)}}}
+		if !fn(out, i == len(names)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func newTestSecretManager(extractJSON bool) *SecretManager {
+	return &SecretManager{
+		metadata: &metadata{versionStage: VersionStageCurrent, extractJSON: extractJSON},
+		client: &mockClient{secrets: map[string]map[string]string{
+			"db": {
+				VersionStageCurrent:  `{"username": "admin", "password": "new", "port": 3306, "ssl": true}`,
+				VersionStagePrevious: `{"username": "admin", "password": "old", "port": 3306, "ssl": true}`,
+				"v1":                 `{"username": "admin", "password": "first", "port": 3306, "ssl": true}`,
+			},
+			"token": {
+				VersionStageCurrent: "abc",
+			},
+		}},
+	}
+}
+
+func TestGetSecret(t *testing.T) {
+	s := newTestSecretManager(true)
+
+	// the fields of json objects are extracted
+	resp, err := s.GetSecret(secretstores.GetSecretRequest{Name: "db"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "new", "port": "3306", "ssl": "true"}, resp.Data)
+
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db", Metadata: map[string]string{versionStageKey: VersionStagePrevious}})
+	assert.Nil(t, err)
+	assert.Equal(t, "old", resp.Data["password"])
+
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db", Metadata: map[string]string{versionIDKey: "v1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", resp.Data["password"])
+	// the snake case keys are accepted too
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db", Metadata: map[string]string{versionStageSnakeKey: VersionStagePrevious}})
+	assert.Nil(t, err)
+	assert.Equal(t, "old", resp.Data["password"])
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db", Metadata: map[string]string{versionIDSnakeKey: "v1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", resp.Data["password"])
+
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"token": "abc"}, resp.Data)
+
+	_, err = s.GetSecret(secretstores.GetSecretRequest{Name: "token", Metadata: map[string]string{versionStageKey: VersionStagePrevious}})
+	assert.True(t, isNotFound(err))
+
+	// the secret string is kept if the extraction is disabled
+	s = newTestSecretManager(false)
+	resp, err = s.GetSecret(secretstores.GetSecretRequest{Name: "db"})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Data, 1)
+	assert.Contains(t, resp.Data["db"], `"password": "new"`)
+}
+
+func TestBulkGetSecret(t *testing.T) {
+	s := newTestSecretManager(true)
+	resp, err := s.BulkGetSecret(secretstores.BulkGetSecretRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Data, 2)
+	assert.Equal(t, "new", resp.Data["db"]["password"])
+	assert.Equal(t, "abc", resp.Data["token"]["token"])
+
+	// the secrets without the version stage are skipped
+	resp, err = s.BulkGetSecret(secretstores.BulkGetSecretRequest{Metadata: map[string]string{versionStageKey: VersionStagePrevious}})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Data, 1)
+	assert.Equal(t, "old", resp.Data["db"]["password"])
+}
+
+func TestJSONFields(t *testing.T) {
+	fields, ok := jsonFields(`{"a": "1", "b": {"c": [1, 2]}, "d": null}`)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"a": "1", "b": `{"c":[1,2]}`, "d": "null"}, fields)
+
+	for _, s := range []string{"plain", `["a"]`, `{"a": 1} {"b": 2}`, `{"a": `} {
+		_, ok = jsonFields(s)
+		assert.False(t, ok, s)
+	}
+}
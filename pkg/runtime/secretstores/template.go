@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretstores
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// SecretGetter gets the secret of the key in the secret store
+type SecretGetter func(store string, key string) (map[string]string, error)
+
+// secretKey is the cache key of the secrets got in a rendering
+type secretKey struct {
+	store string
+	key   string
+}
+
+// RenderTemplate renders the template in the syntax of text/template with the secrets,
+// e.g. `jdbc:mysql://{{secret "vault" "db" "username"}}:{{secret "vault" "db" "password"}}@localhost/app`.
+// The secret function takes the name of the secret store, the key and an optional field of the secret,
+// and every secret is got once in a rendering.
+// The error of the getter is returned as it is, so that the caller can tell it from the errors of the template.
+func RenderTemplate(text string, get SecretGetter) (string, error) {
+	var getErr error
+	secrets := make(map[secretKey]map[string]string)
+	secret := func(store string, key string, field ...string) (string, error) {
+		if len(field) > 1 {
+			return "", fmt.Errorf("secret takes at most one field, got %d", len(field))
+		}
+		k := secretKey{store: store, key: key}
+		data, ok := secrets[k]
+		if !ok {
+			var err error
+			if data, err = get(store, key); err != nil {
+				getErr = err
+				return "", err
+			}
+			secrets[k] = data
+		}
+		return secretValue(store, key, data, field)
+	}
+	t, err := template.New("secret").Funcs(template.FuncMap{"secret": secret}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, nil); err != nil {
+		if getErr != nil {
+			return "", getErr
+		}
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// secretValue returns the field of the secret. Without the field, the secret should be a single value,
+// otherwise the value with the same name as the key is used.
+func secretValue(store string, key string, data map[string]string, field []string) (string, error) {
+	if len(field) == 1 {
+		v, ok := data[field[0]]
+		if !ok {
+			return "", fmt.Errorf("secret %s in store %s has no field %s", key, store, field[0])
+		}
+		return v, nil
+	}
+	if v, ok := data[key]; ok {
+		return v, nil
+	}
+	if len(data) == 1 {
+		for _, v := range data {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("secret %s in store %s has %d fields, one of them should be specified", key, store, len(data))
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretstores
+
+import "context"
+
+// SecretEvent is a change of a secret
+type SecretEvent struct {
+	Key  string
+	Data map[string]string
+	// Deleted is true if the secret is deleted
+	Deleted bool
+}
+
+// WatchRequest is the secrets to watch
+type WatchRequest struct {
+	// Keys are the names of the secrets, all the secrets are watched if it's empty
+	Keys     []string
+	Metadata map[string]string
+}
+
+// Watcher is implemented by the secret stores which can watch the changes of secrets, e.g. the rotation of secrets.
+type Watcher interface {
+	// Watch calls the handler with the current values of the secrets first, and then their changes, until ctx is done.
+	// It returns once the watch is started, and the handler is called in another goroutine.
+	Watch(ctx context.Context, req *WatchRequest, handler func(*SecretEvent)) error
+}
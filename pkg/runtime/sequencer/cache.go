@@ -17,6 +17,7 @@ import (
 	"context"
 	"errors"
 	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/pkg/runtime/budget"
 	"mosn.io/pkg/log"
 	"mosn.io/pkg/utils"
 	"sync"
@@ -28,6 +29,13 @@ const defaultLimit = 1000
 const defaultRetry = 5
 const waitTime = time.Second * 2
 
+// bufferEntrySize is the estimated memory of a DoubleBuffer besides its key
+const bufferEntrySize = 256
+
+func init() {
+	budget.Register("sequencer_segments", segmentCache{})
+}
+
 // DoubleBuffer is double segment id buffer.
 // There are two buffers in DoubleBuffer: inUseBuffer is in use, BackUpBuffer is a backup buffer.
 // Their default capacity is 1000. When the inUseBuffer usage exceeds 30%, the BackUpBuffer will be initialized.
@@ -225,3 +233,31 @@ func getDoubleBufferInRL(key string) *DoubleBuffer {
 	}
 	return nil
 }
+
+// segmentCache accounts BufferCatch in the resource budget.
+// The ids in the evicted segments are wasted, but ids are still increasing since new segments are got from the store.
+type segmentCache struct{}
+
+func (segmentCache) MemoryUsage() int64 {
+	rwLock.RLock()
+	defer rwLock.RUnlock()
+	var total int64
+	for key := range BufferCatch {
+		total += int64(len(key)) + bufferEntrySize
+	}
+	return total
+}
+
+// Shrink evicts the DoubleBuffers until the usage is not larger than target
+func (c segmentCache) Shrink(target int64) {
+	usage := c.MemoryUsage()
+	rwLock.Lock()
+	defer rwLock.Unlock()
+	for key := range BufferCatch {
+		if usage <= target {
+			return
+		}
+		delete(BufferCatch, key)
+		usage -= int64(len(key)) + bufferEntrySize
+	}
+}
@@ -0,0 +1,146 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/pkg/errors"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/components/sequencer"
+)
+
+const (
+	defaultFencingRetries = 3
+	// watermarkPrefix is the prefix of the keys of the high-watermarks in the state store
+	watermarkPrefix = "sequencer_watermark" + apiSeparator
+)
+
+// ErrSequenceBackwards is returned if the store keeps allocating the ids not above the watermark, e.g. after its failover
+var ErrSequenceBackwards = errors.New("sequencer store went backwards, the ids aren't above the high-watermark")
+
+// fencedStore verifies the ids of STRONG auto increment against the high-watermarks saved in a state store.
+// An id not above the watermark is allocated by a store which lost its latest writes in the failover,
+// or it's raced by a concurrent allocation of another sidecar whose id is larger. In both cases the id is dropped,
+// the store skips ahead past the watermark if it supports segments, and the id is allocated again.
+// The allocations of a key are serialized in the sidecar, so that they don't race with each other.
+type fencedStore struct {
+	sequencer.Store
+	name       string
+	watermarks state.Store
+	retries    int
+
+	lock sync.Mutex
+	keys map[string]*sync.Mutex
+}
+
+// NewFencedStore wraps the store with fencing, the watermarks are saved in the state store
+func NewFencedStore(name string, store sequencer.Store, watermarks state.Store, cfg *sequencer.FencingConfig) sequencer.Store {
+	f := &fencedStore{
+		Store:      store,
+		name:       name,
+		watermarks: watermarks,
+		retries:    defaultFencingRetries,
+		keys:       make(map[string]*sync.Mutex),
+	}
+	if cfg.MaxRetries > 0 {
+		f.retries = cfg.MaxRetries
+	}
+	return f
+}
+
+func (f *fencedStore) GetNextId(req *sequencer.GetNextIdRequest) (*sequencer.GetNextIdResponse, error) {
+	if req.Options.AutoIncrement != sequencer.STRONG {
+		return f.Store.GetNextId(req)
+	}
+	keyLock := f.keyLock(req.Key)
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	for i := 0; i <= f.retries; i++ {
+		resp, err := f.Store.GetNextId(req)
+		if err != nil {
+			return nil, err
+		}
+		ok, wm, err := f.advance(req.Key, resp.NextId)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return resp, nil
+		}
+		// skip ahead, so that the store recovers from a failover losing any number of ids
+		if err := seedCounter(f.Store, req.Key, req.Metadata, wm+1); err != nil {
+			log.DefaultLogger.Warnf("[runtime] [sequencer.fencing] key %s in store %s can't skip ahead the watermark %d: %v", req.Key, f.name, wm, err)
+		}
+	}
+	log.DefaultLogger.Errorf("[runtime] [sequencer.fencing] ids of key %s in store %s went backwards, the store may have failed over", req.Key, f.name)
+	return nil, ErrSequenceBackwards
+}
+
+// keyLock returns the lock serializing the allocations of the key
+func (f *fencedStore) keyLock(key string) *sync.Mutex {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	l, ok := f.keys[key]
+	if !ok {
+		l = &sync.Mutex{}
+		f.keys[key] = l
+	}
+	return l
+}
+
+// advance raises the watermark of the key to the id by compare-and-swap,
+// it returns false and the watermark if the id isn't above the watermark
+func (f *fencedStore) advance(key string, id int64) (bool, int64, error) {
+	wmKey := watermarkPrefix + key
+	for {
+		resp, err := f.watermarks.Get(&state.GetRequest{
+			Key:     wmKey,
+			Options: state.GetStateOption{Consistency: state.Strong},
+		})
+		if err != nil {
+			return false, 0, err
+		}
+		setReq := &state.SetRequest{
+			Key:     wmKey,
+			Value:   []byte(strconv.FormatInt(id, 10)),
+			Options: state.SetStateOption{Consistency: state.Strong},
+		}
+		if resp == nil || len(resp.Data) == 0 {
+			setReq.Options.Concurrency = state.FirstWrite
+		} else {
+			wm, err := strconv.ParseInt(string(resp.Data), 10, 64)
+			if err != nil {
+				return false, 0, errors.Errorf("watermark of key %s is illegal: %v", key, err)
+			}
+			if id <= wm {
+				log.DefaultLogger.Warnf("[runtime] [sequencer.fencing] id %d of key %s in store %s isn't above the watermark %d", id, key, f.name, wm)
+				return false, wm, nil
+			}
+			setReq.ETag = resp.ETag
+			setReq.Options.Concurrency = state.FirstWrite
+		}
+		err = f.watermarks.Set(setReq)
+		if err == nil {
+			return true, 0, nil
+		}
+		// the watermark is raised by another allocation, it's checked again
+		if _, ok := err.(*state.ETagError); !ok {
+			return false, 0, err
+		}
+	}
+}
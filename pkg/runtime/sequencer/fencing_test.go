@@ -0,0 +1,76 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/sequencer"
+	mock_sequencer "mosn.io/layotto/pkg/mock/components/sequencer"
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+func TestFencedStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_sequencer.NewMockStore(ctrl)
+	watermarks := mock_state.NewMockStore(ctrl)
+	f := NewFencedStore("mock", store, watermarks, &sequencer.FencingConfig{StateStore: "redis", MaxRetries: 1})
+	strong := &sequencer.GetNextIdRequest{Key: "k", Options: sequencer.SequencerOptions{AutoIncrement: sequencer.STRONG}}
+
+	// the weak ids aren't fenced
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 1}, nil)
+	resp, err := f.GetNextId(&sequencer.GetNextIdRequest{Key: "k", Options: sequencer.SequencerOptions{AutoIncrement: sequencer.WEAK}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), resp.NextId)
+
+	// the watermark is raised
+	etag := "1"
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 10}, nil)
+	watermarks.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("5"), ETag: &etag}, nil)
+	watermarks.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+		assert.Equal(t, "sequencer_watermark|||k", req.Key)
+		assert.Equal(t, []byte("10"), req.Value)
+		assert.Equal(t, &etag, req.ETag)
+		return nil
+	})
+	resp, err = f.GetNextId(strong)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), resp.NextId)
+
+	// the store skips ahead past the watermark if the id is below it
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 3}, nil)
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 4}, nil)
+	store.EXPECT().GetSegment(gomock.Any()).DoAndReturn(func(req *sequencer.GetSegmentRequest) (bool, *sequencer.GetSegmentResponse, error) {
+		assert.Equal(t, "k", req.Key)
+		assert.Equal(t, 6, req.Size)
+		return true, &sequencer.GetSegmentResponse{From: 5, To: 10}, nil
+	})
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 11}, nil)
+	watermarks.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("10"), ETag: &etag}, nil).Times(2)
+	watermarks.EXPECT().Set(gomock.Any()).Return(nil)
+	resp, err = f.GetNextId(strong)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), resp.NextId)
+
+	// the store went backwards, and it can't skip ahead without segments
+	store.EXPECT().GetNextId(gomock.Any()).Return(&sequencer.GetNextIdResponse{NextId: 1}, nil).Times(4)
+	store.EXPECT().GetSegment(gomock.Any()).Return(false, nil, nil).Times(2)
+	watermarks.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("11"), ETag: &etag}, nil).Times(2)
+	_, err = f.GetNextId(strong)
+	assert.Equal(t, ErrSequenceBackwards, err)
+}
@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"mosn.io/layotto/pkg/actuator/info"
+)
+
+// latencyBuckets is the number of the buckets, the upper bound of bucket i is 2^i microseconds
+const latencyBuckets = 32
+
+var (
+	latencyLock sync.RWMutex
+	latencies   = map[string]*LatencyRecorder{}
+)
+
+func init() {
+	info.AddInfoContributorFunc("sequencer_latency", func() (interface{}, error) {
+		latencyLock.RLock()
+		defer latencyLock.RUnlock()
+		res := make(map[string]LatencySummary, len(latencies))
+		for name, r := range latencies {
+			res[name] = r.Summary()
+		}
+		return res, nil
+	})
+}
+
+// LatencyRecorder records the latency distribution of the allocations in exponential buckets
+type LatencyRecorder struct {
+	mu      sync.Mutex
+	buckets [latencyBuckets]int64
+	count   int64
+	sum     time.Duration
+	max     time.Duration
+}
+
+// LatencySummary is the latency distribution, the percentiles are the upper bounds of the buckets
+type LatencySummary struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	P999  time.Duration `json:"p999"`
+	Max   time.Duration `json:"max"`
+}
+
+// EnableLatency starts recording the latency of the store
+func EnableLatency(storeName string) {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	if latencies[storeName] == nil {
+		latencies[storeName] = &LatencyRecorder{}
+	}
+}
+
+// ObserveLatency records the latency of an allocation if the store is benchmarked
+func ObserveLatency(storeName string, d time.Duration) {
+	latencyLock.RLock()
+	r := latencies[storeName]
+	latencyLock.RUnlock()
+	if r != nil {
+		r.Observe(d)
+	}
+}
+
+func (r *LatencyRecorder) Observe(d time.Duration) {
+	i := bits.Len64(uint64(d / time.Microsecond))
+	if i >= latencyBuckets {
+		i = latencyBuckets - 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buckets[i]++
+	r.count++
+	r.sum += d
+	if d > r.max {
+		r.max = d
+	}
+}
+
+func (r *LatencyRecorder) Summary() LatencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := LatencySummary{Count: r.count, Max: r.max}
+	if r.count == 0 {
+		return s
+	}
+	s.Mean = r.sum / time.Duration(r.count)
+	s.P50 = r.percentile(0.5)
+	s.P90 = r.percentile(0.9)
+	s.P99 = r.percentile(0.99)
+	s.P999 = r.percentile(0.999)
+	return s
+}
+
+// percentile should be called with the lock
+func (r *LatencyRecorder) percentile(p float64) time.Duration {
+	rank := int64(float64(r.count)*p + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var n int64
+	for i, c := range r.buckets {
+		n += c
+		if n >= rank {
+			bound := time.Duration(1<<uint(i)) * time.Microsecond
+			if bound > r.max {
+				return r.max
+			}
+			return bound
+		}
+	}
+	return r.max
+}
@@ -0,0 +1,211 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/components/sequencer"
+)
+
+const (
+	defaultBlockSize      = 10000
+	defaultReservedBlocks = 2
+	// blockSuffix is appended to the key of the counter of the blocks in the store
+	blockSuffix = "#block"
+)
+
+// regionStore serves the ids from the blocks reserved by the sidecar.
+// The blocks are numbered by a STRONG counter in the store shared by all the regions, so the blocks are disjoint globally.
+// The blocks are reserved ahead in background, so that the ids are still allocated locally
+// when the store can't be reached, e.g. during the partition between the regions, until the reserved blocks run out.
+type regionStore struct {
+	sequencer.Store
+	name      string
+	region    string
+	blockSize int64
+	reserved  int
+	// biggerThan is the BiggerThan of the store, which is honored by the blocks as well
+	biggerThan map[string]int64
+
+	lock   sync.Mutex
+	blocks map[string]*regionBlocks
+}
+
+// regionBlocks is the blocks of a key, the ids in [next, end) are not allocated in the block in use
+type regionBlocks struct {
+	lock sync.Mutex
+	next int64
+	end  int64
+	// reserved is the first ids of the reserved blocks, in ascending order
+	reserved []int64
+	filling  bool
+	// retryAt is when the blocks are reserved again after the store failed
+	retryAt time.Time
+	// seed seeds the counter of the blocks before the first block is allocated
+	seed counterSeed
+}
+
+// NewRegionStore wraps the store with the region mode, the biggerThan is the BiggerThan of the store
+func NewRegionStore(name string, store sequencer.Store, cfg *sequencer.RegionConfig, biggerThan map[string]int64) (sequencer.Store, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("region name is empty")
+	}
+	if cfg.BlockSize < 0 || cfg.ReservedBlocks < 0 {
+		return nil, errors.Errorf("block_size and reserved_blocks of region %s can't be negative", cfg.Name)
+	}
+	r := &regionStore{
+		Store:      store,
+		name:       name,
+		region:     cfg.Name,
+		blockSize:  defaultBlockSize,
+		reserved:   defaultReservedBlocks,
+		biggerThan: biggerThan,
+		blocks:     make(map[string]*regionBlocks),
+	}
+	if cfg.BlockSize > 0 {
+		r.blockSize = cfg.BlockSize
+	}
+	if cfg.ReservedBlocks > 0 {
+		r.reserved = cfg.ReservedBlocks
+	}
+	return r, nil
+}
+
+func (r *regionStore) GetNextId(req *sequencer.GetNextIdRequest) (*sequencer.GetNextIdResponse, error) {
+	b := r.getBlocks(req.Key)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.next >= b.end {
+		// the store is called synchronously only if no block is reserved
+		if len(b.reserved) == 0 {
+			from, err := r.allocate(req.Key, req.Metadata)
+			if err != nil {
+				log.DefaultLogger.Errorf("[runtime] [sequencer.region] region %s ran out of the blocks of key %s in store %s: %v", r.region, req.Key, r.name, err)
+				return nil, err
+			}
+			b.reserved = append(b.reserved, from)
+		}
+		b.next, b.end = b.reserved[0], b.reserved[0]+r.blockSize
+		b.reserved = b.reserved[1:]
+	}
+	id := b.next
+	b.next++
+	r.reserve(req.Key, req.Metadata, b)
+	return &sequencer.GetNextIdResponse{NextId: id}, nil
+}
+
+// GetSegment isn't supported, so that the runtime doesn't cache the segments bypassing the blocks
+func (r *regionStore) GetSegment(*sequencer.GetSegmentRequest) (bool, *sequencer.GetSegmentResponse, error) {
+	return false, nil, nil
+}
+
+func (r *regionStore) getBlocks(key string) *regionBlocks {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.blocks[key]
+	if !ok {
+		b = &regionBlocks{}
+		r.blocks[key] = b
+	}
+	return b
+}
+
+// reserve allocates the blocks in background until enough blocks are reserved, it must be called with the lock of the blocks
+func (r *regionStore) reserve(key string, metadata map[string]string, b *regionBlocks) {
+	if b.filling || len(b.reserved) >= r.reserved || time.Now().Before(b.retryAt) {
+		return
+	}
+	b.filling = true
+	utils.GoWithRecover(func() {
+		defer func() {
+			b.lock.Lock()
+			b.filling = false
+			b.lock.Unlock()
+		}()
+		for {
+			b.lock.Lock()
+			enough := len(b.reserved) >= r.reserved
+			b.lock.Unlock()
+			if enough {
+				return
+			}
+			from, err := r.allocate(key, metadata)
+			b.lock.Lock()
+			if err != nil {
+				b.retryAt = time.Now().Add(waitTime)
+				b.lock.Unlock()
+				log.DefaultLogger.Warnf("[runtime] [sequencer.region] region %s failed reserving the blocks of key %s in store %s, %d blocks are reserved: %v", r.region, key, r.name, len(b.reserved), err)
+				return
+			}
+			// the block allocated before the block in use is dropped, so that the ids keep increasing in the sidecar
+			if from >= b.end {
+				b.reserved = append(b.reserved, from)
+				sort.Slice(b.reserved, func(i, j int) bool { return b.reserved[i] < b.reserved[j] })
+			}
+			b.lock.Unlock()
+		}
+	}, nil)
+}
+
+// seed makes the blocks start above the ids issued before the region mode is turned on, i.e. the current id of the key and its BiggerThan.
+// It's done once for each key before the first block is allocated in the sidecar, see Shard.Seed.
+func (r *regionStore) seed(key string, metadata map[string]string) error {
+	seed := &r.getBlocks(key).seed
+	seed.lock.Lock()
+	defer seed.lock.Unlock()
+	if seed.seeded {
+		return nil
+	}
+	issued, err := issuedId(r.Store, key, metadata, r.biggerThan)
+	if err != nil {
+		return err
+	}
+	// the block b holds the ids in [b*blockSize, (b+1)*blockSize)
+	minBlock := int64(0)
+	if issued >= 0 {
+		minBlock = issued/r.blockSize + 1
+	}
+	if err = seedCounter(r.Store, key+blockSuffix, metadata, minBlock); err != nil {
+		return err
+	}
+	seed.seeded = true
+	return nil
+}
+
+// allocate returns the first id of a new block
+func (r *regionStore) allocate(key string, metadata map[string]string) (int64, error) {
+	if err := r.seed(key, metadata); err != nil {
+		return 0, err
+	}
+	resp, err := r.Store.GetNextId(&sequencer.GetNextIdRequest{
+		Key:      key + blockSuffix,
+		Options:  sequencer.SequencerOptions{AutoIncrement: sequencer.STRONG},
+		Metadata: metadata,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if resp.NextId < 0 || resp.NextId > math.MaxInt64/r.blockSize-1 {
+		return 0, errors.Errorf("block %d of key %s overflows", resp.NextId, key)
+	}
+	return resp.NextId * r.blockSize, nil
+}
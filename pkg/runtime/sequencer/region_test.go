@@ -0,0 +1,117 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/sequencer"
+)
+
+// counterStore is a store allocating the ids from the counters in memory, which fails if it's down
+type counterStore struct {
+	sequencer.Store
+	lock     sync.Mutex
+	counters map[string]int64
+	down     bool
+}
+
+func (s *counterStore) GetNextId(req *sequencer.GetNextIdRequest) (*sequencer.GetNextIdResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.down {
+		return nil, errors.New("partitioned")
+	}
+	s.counters[req.Key]++
+	return &sequencer.GetNextIdResponse{NextId: s.counters[req.Key]}, nil
+}
+
+func (s *counterStore) setDown(down bool) {
+	s.lock.Lock()
+	s.down = down
+	s.lock.Unlock()
+}
+
+func reservedBlocks(store sequencer.Store, key string) int {
+	b := store.(*regionStore).getBlocks(key)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.reserved)
+}
+
+func TestRegionStore(t *testing.T) {
+	_, err := NewRegionStore("mock", nil, &sequencer.RegionConfig{}, nil)
+	assert.NotNil(t, err)
+
+	global := &counterStore{counters: map[string]int64{}}
+	hz, err := NewRegionStore("mock", global, &sequencer.RegionConfig{Name: "hz", BlockSize: 10, ReservedBlocks: 2}, nil)
+	assert.Nil(t, err)
+	support, _, _ := hz.GetSegment(&sequencer.GetSegmentRequest{Key: "k"})
+	assert.False(t, support)
+
+	req := &sequencer.GetNextIdRequest{Key: "k"}
+	// the block 1 is allocated by seeding the counter of the blocks
+	resp, err := hz.GetNextId(req)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), resp.NextId)
+	assert.Eventually(t, func() bool { return reservedBlocks(hz, "k") == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(4), global.counters["k#block"])
+
+	// the reserved blocks are served during the partition
+	global.setDown(true)
+	for want := int64(21); want < 50; want++ {
+		resp, err = hz.GetNextId(req)
+		assert.Nil(t, err)
+		assert.Equal(t, want, resp.NextId)
+	}
+	_, err = hz.GetNextId(req)
+	assert.NotNil(t, err)
+
+	// the blocks of another region are disjoint
+	global.setDown(false)
+	sh, err := NewRegionStore("mock", global, &sequencer.RegionConfig{Name: "sh", BlockSize: 10}, nil)
+	assert.Nil(t, err)
+	resp, err = sh.GetNextId(req)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(60), resp.NextId)
+}
+
+func TestRegionStore_Seed(t *testing.T) {
+	global := &segmentStore{counterStore: &counterStore{counters: map[string]int64{"live": 25}}, support: true}
+	hz, err := NewRegionStore("mock", global, &sequencer.RegionConfig{Name: "hz", BlockSize: 10}, map[string]int64{"big": 123})
+	assert.Nil(t, err)
+
+	// the blocks start above the current id of the key
+	resp, err := hz.GetNextId(&sequencer.GetNextIdRequest{Key: "live"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), resp.NextId)
+
+	// and above BiggerThan
+	resp, err = hz.GetNextId(&sequencer.GetNextIdRequest{Key: "big"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(130), resp.NextId)
+
+	// the counter of the blocks behind can't be seeded without segments
+	global.lock.Lock()
+	global.support = false
+	global.counters["other"] = 25
+	global.lock.Unlock()
+	_, err = hz.GetNextId(&sequencer.GetNextIdRequest{Key: "other"})
+	assert.NotNil(t, err)
+}
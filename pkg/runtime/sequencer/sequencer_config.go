@@ -16,7 +16,9 @@ package sequencer
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	"mosn.io/layotto/pkg/runtime/keypolicy"
 	"strings"
+	"sync"
 )
 
 const (
@@ -30,10 +32,15 @@ const (
 	separator         = "||"
 )
 
-var seqConfiguration = map[string]*StoreConfiguration{}
+var (
+	seqConfiguration = map[string]*StoreConfiguration{}
+	// the configurations are saved again when the components are reconciled
+	seqConfigurationLock sync.RWMutex
+)
 
 type StoreConfiguration struct {
 	keyPrefixStrategy string
+	keyPolicy         *keypolicy.Policy
 }
 
 func SaveSeqConfiguration(storeName string, metadata map[string]string) error {
@@ -47,7 +54,14 @@ func SaveSeqConfiguration(storeName string, metadata map[string]string) error {
 		}
 	}
 
-	seqConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy}
+	policy, err := keypolicy.Parse(metadata)
+	if err != nil {
+		return err
+	}
+
+	seqConfigurationLock.Lock()
+	seqConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy, keyPolicy: policy}
+	seqConfigurationLock.Unlock()
 	return nil
 }
 
@@ -56,28 +70,43 @@ func GetModifiedSeqKey(key, storeName, appID string) (string, error) {
 		return "", err
 	}
 	config := getConfiguration(storeName)
+	key, err := config.keyPolicy.Sanitize(key)
+	if err != nil {
+		return "", err
+	}
+	return config.keyPolicy.Limit(addPrefix(config, key, storeName, appID))
+}
+
+func addPrefix(config *StoreConfiguration, key, storeName, appID string) string {
 	switch config.keyPrefixStrategy {
 	case strategyNone:
-		return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key), nil
+		return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key)
 	case strategyStoreName:
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, storeName, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, storeName, separator, key)
 	case strategyAppid:
 		if appID == "" {
-			return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key), nil
+			return fmt.Sprintf("%s%s%s", apiPrefix, apiSeparator, key)
 		}
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, appID, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, appID, separator, key)
 	default:
-		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, config.keyPrefixStrategy, separator, key), nil
+		return fmt.Sprintf("%s%s%s%s%s", apiPrefix, apiSeparator, config.keyPrefixStrategy, separator, key)
 	}
 }
 
 func getConfiguration(storeName string) *StoreConfiguration {
+	seqConfigurationLock.RLock()
 	c := seqConfiguration[storeName]
+	seqConfigurationLock.RUnlock()
+	if c != nil {
+		return c
+	}
+	seqConfigurationLock.Lock()
+	defer seqConfigurationLock.Unlock()
+	c = seqConfiguration[storeName]
 	if c == nil {
 		c = &StoreConfiguration{keyPrefixStrategy: strategyDefault}
 		seqConfiguration[storeName] = c
 	}
-
 	return c
 }
 
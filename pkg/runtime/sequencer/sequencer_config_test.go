@@ -73,3 +73,13 @@ func TestPrefix_StoreNotInitial(t *testing.T) {
 	modifiedLockKey, _ := GetModifiedSeqKey(key, "store999", "appid99")
 	require.Equal(t, "sequencer|||appid99||lock-key-1234567", modifiedLockKey)
 }
+
+func TestKeyPolicy(t *testing.T) {
+	err := SaveSeqConfiguration("store7", map[string]string{"keyAllowedChars": "a-z0-9-"})
+	require.Nil(t, err)
+	_, err = GetModifiedSeqKey("order 1", "store7", "")
+	require.NotNil(t, err)
+	modifiedSeqKey, err := GetModifiedSeqKey("order-1", "store7", "")
+	require.Nil(t, err)
+	require.Equal(t, "sequencer|||order-1", modifiedSeqKey)
+}
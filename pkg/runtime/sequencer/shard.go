@@ -0,0 +1,221 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"mosn.io/layotto/components/sequencer"
+)
+
+const (
+	MergeInterleave = "interleave"
+	MergePartition  = "partition"
+	// shardSeparator separates the key and the index of the shard in the store
+	shardSeparator = "#shard-"
+	maxShardCount  = 1024
+)
+
+// shardConfiguration is the shard rules of the stores, in the order of the config
+var shardConfiguration = map[string][]*Shard{}
+
+// Shard allocates the ids of a key from several keys in the store, the ids are unique but not monotonic across the shards.
+type Shard struct {
+	pattern string
+	count   int
+	merge   string
+	// partitionBits is the number of the highest bits holding the shard in the partition merge
+	partitionBits uint
+	next          uint64
+	// biggerThan is the BiggerThan of the store, which is honored by the shards as well
+	biggerThan map[string]int64
+
+	lock sync.Mutex
+	// seeds are the keys whose shards are seeded by the sidecar
+	seeds map[string]*counterSeed
+}
+
+// counterSeed seeds the counters of a key once
+type counterSeed struct {
+	lock   sync.Mutex
+	seeded bool
+}
+
+// SaveShardConfiguration validates and saves the shard rules of the store, the biggerThan is the BiggerThan of the store
+func SaveShardConfiguration(storeName string, configs []sequencer.ShardConfig, biggerThan map[string]int64) error {
+	shards := make([]*Shard, 0, len(configs))
+	for _, cfg := range configs {
+		if _, err := path.Match(cfg.Pattern, ""); err != nil {
+			return errors.Errorf("shard pattern '%s' is illegal: %v", cfg.Pattern, err)
+		}
+		if cfg.Count < 2 || cfg.Count > maxShardCount {
+			return errors.Errorf("shard count of pattern '%s' should be between 2 and %d", cfg.Pattern, maxShardCount)
+		}
+		s := &Shard{pattern: cfg.Pattern, count: cfg.Count, merge: cfg.Merge, biggerThan: biggerThan, seeds: make(map[string]*counterSeed)}
+		switch cfg.Merge {
+		case "":
+			s.merge = MergeInterleave
+		case MergeInterleave:
+		case MergePartition:
+			s.partitionBits = uint(bits.Len(uint(cfg.Count - 1)))
+		default:
+			return errors.Errorf("shard merge '%s' of pattern '%s' is unknown", cfg.Merge, cfg.Pattern)
+		}
+		shards = append(shards, s)
+	}
+	shardConfiguration[storeName] = shards
+	return nil
+}
+
+// GetShard returns the first shard rule matching the key, or nil if the key isn't sharded
+func GetShard(storeName, key string) *Shard {
+	for _, s := range shardConfiguration[storeName] {
+		if ok, _ := path.Match(s.pattern, key); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Next picks the shard of an allocation in round robin
+func (s *Shard) Next() int {
+	return int(atomic.AddUint64(&s.next, 1) % uint64(s.count))
+}
+
+// Key returns the key of the shard in the store
+func (s *Shard) Key(key string, shard int) string {
+	return fmt.Sprintf("%s%s%d", key, shardSeparator, shard)
+}
+
+// Merge converts the id allocated by the shard to the id returned to the client
+func (s *Shard) Merge(id int64, shard int) (int64, error) {
+	if s.merge == MergePartition {
+		if id < 0 || id >= int64(1)<<(63-s.partitionBits) {
+			return 0, errors.Errorf("id %d of shard %d exceeds the partition", id, shard)
+		}
+		return int64(shard)<<(63-s.partitionBits) | id, nil
+	}
+	if id < 0 || id > (math.MaxInt64-int64(shard))/int64(s.count) {
+		return 0, errors.Errorf("id %d of shard %d overflows after interleaving", id, shard)
+	}
+	return id*int64(s.count) + int64(shard), nil
+}
+
+// Seed makes the shards of the key allocate the ids above the ones issued before the key is sharded,
+// i.e. the current id of the key and its BiggerThan, so that sharding a live key doesn't issue the ids again.
+// It's done once for each key before the first allocation in the sidecar. The current id is got by allocating one,
+// and the shards behind are moved forward by allocating a segment, which fails if the store doesn't support segments.
+// The key is the one in the store, i.e. the one passed to Key.
+func (s *Shard) Seed(store sequencer.Store, key string, metadata map[string]string) error {
+	s.lock.Lock()
+	seed, ok := s.seeds[key]
+	if !ok {
+		seed = &counterSeed{}
+		s.seeds[key] = seed
+	}
+	s.lock.Unlock()
+
+	seed.lock.Lock()
+	defer seed.lock.Unlock()
+	if seed.seeded {
+		return nil
+	}
+	issued, err := issuedId(store, key, metadata, s.biggerThan)
+	if err != nil {
+		return err
+	}
+	for shard := 0; shard < s.count; shard++ {
+		if err := seedCounter(store, s.Key(key, shard), metadata, s.minId(issued, shard)); err != nil {
+			return err
+		}
+	}
+	seed.seeded = true
+	return nil
+}
+
+// minId returns the min id of the shard which is merged into an id bigger than the issued one
+func (s *Shard) minId(issued int64, shard int) int64 {
+	if issued < 0 {
+		return 0
+	}
+	if s.merge == MergePartition {
+		offset := int64(shard) << (63 - s.partitionBits)
+		if issued < offset {
+			return 0
+		}
+		return issued - offset + 1
+	}
+	if issued < int64(shard) {
+		return 0
+	}
+	return (issued-int64(shard))/int64(s.count) + 1
+}
+
+// issuedId returns the id issued by the key, which is the bigger one of an id allocated now and the BiggerThan of the key
+func issuedId(store sequencer.Store, key string, metadata map[string]string, biggerThan map[string]int64) (int64, error) {
+	resp, err := store.GetNextId(&sequencer.GetNextIdRequest{
+		Key:      key,
+		Options:  sequencer.SequencerOptions{AutoIncrement: sequencer.STRONG},
+		Metadata: metadata,
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "get the current id of key %s", key)
+	}
+	if bt := biggerThan[key]; bt > resp.NextId {
+		return bt, nil
+	}
+	return resp.NextId, nil
+}
+
+// seedCounter moves the counter forward until the next id isn't less than min
+func seedCounter(store sequencer.Store, counter string, metadata map[string]string, min int64) error {
+	if min <= 0 {
+		return nil
+	}
+	resp, err := store.GetNextId(&sequencer.GetNextIdRequest{
+		Key:      counter,
+		Options:  sequencer.SequencerOptions{AutoIncrement: sequencer.STRONG},
+		Metadata: metadata,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "get the current id of counter %s", counter)
+	}
+	if resp.NextId >= min-1 {
+		return nil
+	}
+	gap := min - 1 - resp.NextId
+	if gap > math.MaxInt32 {
+		return errors.Errorf("counter %s is %d ids behind the key, which is too far to seed", counter, gap)
+	}
+	support, _, err := store.GetSegment(&sequencer.GetSegmentRequest{
+		Size:     int(gap),
+		Key:      counter,
+		Options:  sequencer.SequencerOptions{AutoIncrement: sequencer.STRONG},
+		Metadata: metadata,
+	})
+	if !support {
+		return errors.Errorf("counter %s is %d ids behind the key, but the store doesn't support segments to seed it", counter, gap)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "seed counter %s", counter)
+	}
+	return nil
+}
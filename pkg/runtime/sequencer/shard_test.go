@@ -0,0 +1,129 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sequencer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/sequencer"
+)
+
+func TestShard(t *testing.T) {
+	err := SaveShardConfiguration("shard", []sequencer.ShardConfig{
+		{Pattern: "order_*", Count: 4},
+		{Pattern: "user_*", Count: 3, Merge: MergePartition},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, GetShard("shard", "other"))
+	assert.Nil(t, GetShard("other", "order_1"))
+
+	s := GetShard("shard", "order_1")
+	assert.NotNil(t, s)
+	assert.Equal(t, "k#shard-2", s.Key("k", 2))
+	assert.Equal(t, 1, s.Next())
+	id, err := s.Merge(10, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(43), id)
+	_, err = s.Merge(math.MaxInt64/2, 3)
+	assert.NotNil(t, err)
+
+	// the shard is in the highest 2 bits
+	s = GetShard("shard", "user_1")
+	id, err = s.Merge(10, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2)<<61|10, id)
+	_, err = s.Merge(int64(1)<<61, 2)
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, SaveShardConfiguration("shard", []sequencer.ShardConfig{{Pattern: "[", Count: 2}}, nil))
+	assert.NotNil(t, SaveShardConfiguration("shard", []sequencer.ShardConfig{{Pattern: "a", Count: 1}}, nil))
+	assert.NotNil(t, SaveShardConfiguration("shard", []sequencer.ShardConfig{{Pattern: "a", Count: 2, Merge: "x"}}, nil))
+}
+
+// segmentStore is a counterStore supporting segments
+type segmentStore struct {
+	*counterStore
+	support bool
+}
+
+func (s *segmentStore) GetSegment(req *sequencer.GetSegmentRequest) (bool, *sequencer.GetSegmentResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.support {
+		return false, nil, nil
+	}
+	from := s.counters[req.Key] + 1
+	s.counters[req.Key] += int64(req.Size)
+	return true, &sequencer.GetSegmentResponse{From: from, To: s.counters[req.Key]}, nil
+}
+
+func TestShard_Seed(t *testing.T) {
+	err := SaveShardConfiguration("seed", []sequencer.ShardConfig{
+		{Pattern: "order_*", Count: 4},
+		{Pattern: "user_*", Count: 2, Merge: MergePartition},
+	}, map[string]int64{"order_2": 100})
+	assert.Nil(t, err)
+	store := &segmentStore{counterStore: &counterStore{counters: map[string]int64{"order_1": 20, "user_1": 20}}, support: true}
+
+	// the ids of the shards are above the current id of the key
+	s := GetShard("seed", "order_1")
+	assert.Nil(t, s.Seed(store, "order_1", nil))
+	for shard := 0; shard < 4; shard++ {
+		resp, err := store.GetNextId(&sequencer.GetNextIdRequest{Key: s.Key("order_1", shard)})
+		assert.Nil(t, err)
+		id, err := s.Merge(resp.NextId, shard)
+		assert.Nil(t, err)
+		assert.True(t, id > 21)
+	}
+	// it's seeded once
+	assert.Nil(t, s.Seed(store, "order_1", nil))
+	assert.Equal(t, int64(21), store.counters["order_1"])
+
+	// and above BiggerThan
+	assert.Nil(t, s.Seed(store, "order_2", nil))
+	resp, _ := store.GetNextId(&sequencer.GetNextIdRequest{Key: s.Key("order_2", 0)})
+	id, _ := s.Merge(resp.NextId, 0)
+	assert.Equal(t, int64(104), id)
+
+	// only the shard 0 of the partitions overlaps the ids of the key
+	s = GetShard("seed", "user_1")
+	assert.Nil(t, s.Seed(store, "user_1", nil))
+	assert.Equal(t, int64(21), store.counters[s.Key("user_1", 0)])
+	assert.Equal(t, int64(0), store.counters[s.Key("user_1", 1)])
+
+	// the shards behind can't be seeded without segments
+	store.support = false
+	store.counters["order_3"] = 20
+	s = GetShard("seed", "order_3")
+	assert.NotNil(t, s.Seed(store, "order_3", nil))
+}
+
+func TestLatency(t *testing.T) {
+	ObserveLatency("latency", time.Millisecond)
+	EnableLatency("latency")
+	for i := 0; i < 99; i++ {
+		ObserveLatency("latency", 100*time.Microsecond)
+	}
+	ObserveLatency("latency", 10*time.Millisecond)
+	s := latencies["latency"].Summary()
+	assert.Equal(t, int64(100), s.Count)
+	assert.Equal(t, 128*time.Microsecond, s.P50)
+	assert.Equal(t, 128*time.Microsecond, s.P99)
+	assert.Equal(t, 10*time.Millisecond, s.P999)
+	assert.Equal(t, 10*time.Millisecond, s.Max)
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	defaultBloomExpectedKeys      = 100000
+	defaultBloomFalsePositiveRate = 0.01
+	bloomScanPageSize             = 1000
+
+	// BypassBloomFilterKey in the metadata of the get request reads the store even if the key is absent in the filter,
+	// e.g. "bypassBloomFilter": "true"
+	BypassBloomFilterKey = "bypassBloomFilter"
+)
+
+var (
+	ErrBloomFalsePositiveRate      = errors.New("false_positive_rate of bloom filter should be between 0 and 1")
+	ErrBloomFilterNotAuthoritative = errors.New("bloom filter needs scan and single_writer, since it only knows the keys listed or written through the sidecar")
+)
+
+// BloomFilterConfig is the config of the bloom filter of the keys of a state store
+type BloomFilterConfig struct {
+	// ExpectedKeys is the number of keys the filter is sized for, the default value is 100000.
+	// The false positive rate rises if there are more keys.
+	ExpectedKeys int `json:"expected_keys"`
+	// FalsePositiveRate is the rate of the absent keys read from the store at the expected keys, the default value is 0.01
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	// Scan builds the filter from the keys listed at startup, which needs the store to implement KeyLister. It's required.
+	Scan bool `json:"scan"`
+	// SingleWriter declares that the store is only written through this sidecar, so that the filter knows all the keys
+	// and the absent keys can be answered without reading the store. It's required.
+	SingleWriter bool `json:"single_writer"`
+	// RebuildIntervalMs rebuilds the filter by scanning the keys periodically if it's positive,
+	// so that the keys deleted are dropped.
+	RebuildIntervalMs int `json:"rebuild_interval_ms"`
+}
+
+// Validate checks the config
+func (c *BloomFilterConfig) Validate() error {
+	if c.FalsePositiveRate < 0 || c.FalsePositiveRate >= 1 {
+		return ErrBloomFalsePositiveRate
+	}
+	if !c.Scan || !c.SingleWriter {
+		return ErrBloomFilterNotAuthoritative
+	}
+	return nil
+}
+
+// bloomFilter is a bloom filter safe for concurrent use
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+	// keys is the number of keys added, including the duplicates
+	keys int64
+}
+
+func newBloomFilter(expectedKeys int, falsePositiveRate float64) *bloomFilter {
+	n := float64(expectedKeys)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	hashes := uint64(math.Round(float64(m) / n * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, hashes: hashes}
+}
+
+// locations returns the double hashes of the key
+func (f *bloomFilter) locations(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	// the second hash is odd so that it never repeats the first location
+	return sum & math.MaxUint32, sum>>32 | 1
+}
+
+func (f *bloomFilter) add(key string) {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		loc := (h1 + i*h2) % f.m
+		word, bit := &f.bits[loc/64], uint64(1)<<(loc%64)
+		for {
+			old := atomic.LoadUint64(word)
+			if old&bit != 0 || atomic.CompareAndSwapUint64(word, old, old|bit) {
+				break
+			}
+		}
+	}
+	atomic.AddInt64(&f.keys, 1)
+}
+
+func (f *bloomFilter) mayContain(key string) bool {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		loc := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.bits[loc/64])&(uint64(1)<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BloomFilterStore is the store returned by NewBloomFilterStore
+type BloomFilterStore interface {
+	state.Store
+	// Close stops rebuilding the filter
+	Close() error
+}
+
+// bloomStore answers the reads of the keys absent in the bloom filter of the keys without reading the store,
+// which saves the round trips of the misses. The keys are added to the filter before they're written,
+// and the keys deleted are kept in the filter until it's rebuilt, which only costs a read.
+// The filter doesn't answer until the scan at startup is done, and it's only authoritative if the store
+// is written through this sidecar only, so the config must declare it.
+type bloomStore struct {
+	state.Store
+	name              string
+	expectedKeys      int
+	falsePositiveRate float64
+	lister            KeyLister
+	metrics           types.Metrics
+	// filter is the *bloomFilter answering the reads, which is nil until the first scan is done
+	filter atomic.Value
+	mu     sync.Mutex
+	// building is the filter being built by a scan, which gets the keys written during the scan too
+	building *bloomFilter
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+type bloomTransactionalStore struct {
+	*bloomStore
+	transactional state.TransactionalStore
+}
+
+type bloomQuerierStore struct {
+	*bloomStore
+	state.Querier
+}
+
+type bloomTransactionalQuerierStore struct {
+	*bloomTransactionalStore
+	state.Querier
+}
+
+// NewBloomFilterStore wraps the store with a bloom filter of its keys, which is built by scanning the keys
+// in background if Scan is true
+func NewBloomFilterStore(name string, store state.Store, cfg *BloomFilterConfig) (BloomFilterStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	b := &bloomStore{
+		Store:             store,
+		name:              name,
+		expectedKeys:      defaultBloomExpectedKeys,
+		falsePositiveRate: defaultBloomFalsePositiveRate,
+		stopCh:            make(chan struct{}),
+	}
+	if cfg.ExpectedKeys > 0 {
+		b.expectedKeys = cfg.ExpectedKeys
+	}
+	if cfg.FalsePositiveRate > 0 {
+		b.falsePositiveRate = cfg.FalsePositiveRate
+	}
+	m, err := metrics.NewMetrics("state_bloom_filter", map[string]string{"store": name})
+	if err != nil {
+		log.DefaultLogger.Warnf("[runtime] [state.bloomFilter] create metrics of store %s error: %v", name, err)
+	}
+	b.metrics = m
+	lister, ok := AsKeyLister(store)
+	if !ok {
+		return nil, ErrListKeysNotSupported
+	}
+	b.lister = lister
+	utils.GoWithRecover(func() {
+		b.run(time.Duration(cfg.RebuildIntervalMs) * time.Millisecond)
+	}, nil)
+
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &bloomTransactionalQuerierStore{bloomTransactionalStore: &bloomTransactionalStore{bloomStore: b, transactional: t}, Querier: q}, nil
+	case transactional:
+		return &bloomTransactionalStore{bloomStore: b, transactional: t}, nil
+	case querier:
+		return &bloomQuerierStore{bloomStore: b, Querier: q}, nil
+	}
+	return b, nil
+}
+
+func (b *bloomStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	if req.Metadata[BypassBloomFilterKey] != "true" && b.absent(req.Key) {
+		b.inc("short_circuits", 1)
+		return &state.GetResponse{}, nil
+	}
+	resp, err := b.Store.Get(req)
+	if err == nil && resp != nil && resp.Data != nil {
+		b.add(req.Key)
+	}
+	return resp, err
+}
+
+func (b *bloomStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	present := make([]state.GetRequest, 0, len(req))
+	var absent []state.BulkGetResponse
+	for _, r := range req {
+		if r.Metadata[BypassBloomFilterKey] != "true" && b.absent(r.Key) {
+			absent = append(absent, state.BulkGetResponse{Key: r.Key})
+			continue
+		}
+		present = append(present, r)
+	}
+	if len(absent) > 0 {
+		b.inc("short_circuits", int64(len(absent)))
+	}
+	if len(present) == 0 {
+		return true, absent, nil
+	}
+	supported, resp, err := b.Store.BulkGet(present)
+	// the keys are got one by one through Get if it isn't supported
+	if err != nil || !supported {
+		return supported, resp, err
+	}
+	return true, append(resp, absent...), nil
+}
+
+func (b *bloomStore) Set(req *state.SetRequest) error {
+	b.add(req.Key)
+	return b.Store.Set(req)
+}
+
+func (b *bloomStore) BulkSet(req []state.SetRequest) error {
+	for _, r := range req {
+		b.add(r.Key)
+	}
+	return b.Store.BulkSet(req)
+}
+
+func (b *bloomTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	for _, o := range req.Operations {
+		if o.Operation != state.Upsert {
+			continue
+		}
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			b.add(r.Key)
+		case *state.SetRequest:
+			b.add(r.Key)
+		}
+	}
+	return b.transactional.Multi(req)
+}
+
+// trackNativeWrite implements nativeWriteTracker
+func (b *bloomStore) trackNativeWrite(key string, write func() (bool, error)) (bool, error) {
+	b.add(key)
+	return write()
+}
+
+func (b *bloomStore) Close() error {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+	return nil
+}
+
+// absent returns whether the key is absent in the store for sure
+func (b *bloomStore) absent(key string) bool {
+	f, _ := b.filter.Load().(*bloomFilter)
+	return f != nil && !f.mayContain(key)
+}
+
+func (b *bloomStore) add(key string) {
+	if f, _ := b.filter.Load().(*bloomFilter); f != nil {
+		f.add(key)
+	}
+	b.mu.Lock()
+	if b.building != nil {
+		b.building.add(key)
+	}
+	b.mu.Unlock()
+}
+
+// run builds the filter and rebuilds it periodically, a failed scan is retried at the next interval,
+// or one minute later if it's not rebuilt periodically
+func (b *bloomStore) run(interval time.Duration) {
+	for {
+		err := b.scan()
+		if err != nil {
+			log.DefaultLogger.Errorf("[runtime] [state.bloomFilter] scan the keys of store %s error: %v", b.name, err)
+		}
+		wait := interval
+		if wait <= 0 {
+			if err == nil {
+				return
+			}
+			wait = time.Minute
+		}
+		select {
+		case <-b.stopCh:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// scan builds a new filter from all the keys, and replaces the current one if it succeeds
+func (b *bloomStore) scan() error {
+	f := newBloomFilter(b.expectedKeys, b.falsePositiveRate)
+	b.mu.Lock()
+	b.building = f
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.building = nil
+		b.mu.Unlock()
+	}()
+	after := ""
+	for {
+		select {
+		case <-b.stopCh:
+			return nil
+		default:
+		}
+		keys, err := b.lister.ListKeys(&ListKeysRequest{After: after, Limit: bloomScanPageSize})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			f.add(k)
+		}
+		if len(keys) < bloomScanPageSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+	b.filter.Store(f)
+	if b.metrics != nil {
+		b.metrics.Gauge("keys").Update(atomic.LoadInt64(&f.keys))
+	}
+	log.DefaultLogger.Infof("[runtime] [state.bloomFilter] the filter of store %s is built with %d keys", b.name, atomic.LoadInt64(&f.keys))
+	return nil
+}
+
+func (b *bloomStore) inc(name string, n int64) {
+	if b.metrics != nil {
+		b.metrics.Counter(name).Inc(n)
+	}
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (b *bloomStore) Unwrap() state.Store {
+	return b.Store
+}
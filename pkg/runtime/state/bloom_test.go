@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the reads of the keys
+type countingStore struct {
+	*listingStore
+	gets int32
+}
+
+func (s *countingStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.listingStore.Get(req)
+}
+
+func (s *countingStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	atomic.AddInt32(&s.gets, int32(len(req)))
+	return s.listingStore.BulkGet(req)
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{listingStore: &listingStore{memStore: newMemStore()}}
+}
+
+func TestBloomFilter(t *testing.T) {
+	f := newBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.mayContain(fmt.Sprintf("key-%d", i)))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.mayContain(fmt.Sprintf("absent-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestBloomFilterConfig_Validate(t *testing.T) {
+	assert.Nil(t, (&BloomFilterConfig{Scan: true, SingleWriter: true}).Validate())
+	assert.Equal(t, ErrBloomFalsePositiveRate, (&BloomFilterConfig{Scan: true, SingleWriter: true, FalsePositiveRate: 1}).Validate())
+	// the filter isn't authoritative for the stores shared or not scanned
+	assert.Equal(t, ErrBloomFilterNotAuthoritative, (&BloomFilterConfig{Scan: true}).Validate())
+	assert.Equal(t, ErrBloomFilterNotAuthoritative, (&BloomFilterConfig{SingleWriter: true}).Validate())
+	_, err := NewBloomFilterStore("s", newMemStore(), &BloomFilterConfig{Scan: true, SingleWriter: true})
+	assert.Equal(t, ErrListKeysNotSupported, err)
+}
+
+// newScannedBloomFilterStore returns the store whose first scan is done
+func newScannedBloomFilterStore(t *testing.T, store state.Store, rebuildIntervalMs int) BloomFilterStore {
+	s, err := NewBloomFilterStore("s", store, &BloomFilterConfig{Scan: true, SingleWriter: true, RebuildIntervalMs: rebuildIntervalMs})
+	assert.Nil(t, err)
+	b := s.(*bloomTransactionalStore).bloomStore
+	assert.Eventually(t, func() bool {
+		return b.filter.Load() != nil
+	}, time.Second, 10*time.Millisecond)
+	return s
+}
+
+func TestBloomFilterStore_Writes(t *testing.T) {
+	mem := newCountingStore()
+	s := newScannedBloomFilterStore(t, mem, 0)
+	defer s.Close()
+
+	// the absent keys aren't read from the store
+	resp, err := s.Get(&state.GetRequest{Key: "a"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&mem.gets))
+
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "a", Value: []byte("1")}))
+	assert.Nil(t, s.BulkSet([]state.SetRequest{{Key: "b", Value: []byte("2")}}))
+	assert.Nil(t, s.(state.TransactionalStore).Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "c", Value: []byte("3")}},
+	}}))
+	for _, k := range []string{"a", "b", "c"} {
+		resp, err = s.Get(&state.GetRequest{Key: k})
+		assert.Nil(t, err)
+		assert.NotNil(t, resp.Data)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&mem.gets))
+
+	// written through another channel
+	mem.Set(&state.SetRequest{Key: "d", Value: []byte("4")})
+	resp, _ = s.Get(&state.GetRequest{Key: "d"})
+	assert.Nil(t, resp.Data)
+	resp, _ = s.Get(&state.GetRequest{Key: "d", Metadata: map[string]string{BypassBloomFilterKey: "true"}})
+	assert.Equal(t, []byte("4"), resp.Data)
+	// learnt from the read
+	resp, _ = s.Get(&state.GetRequest{Key: "d"})
+	assert.Equal(t, []byte("4"), resp.Data)
+
+	supported, bulk, err := s.BulkGet([]state.GetRequest{{Key: "a"}, {Key: "x"}, {Key: "y"}})
+	assert.Nil(t, err)
+	assert.True(t, supported)
+	assert.Len(t, bulk, 3)
+	assert.Equal(t, "a", bulk[0].Key)
+	assert.Equal(t, []byte("1"), bulk[0].Data)
+	assert.Nil(t, bulk[1].Data)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&mem.gets))
+}
+
+func TestBloomFilterStore_Scan(t *testing.T) {
+	mem := newCountingStore()
+	for i := 0; i < bloomScanPageSize+10; i++ {
+		mem.Set(&state.SetRequest{Key: fmt.Sprintf("k%d", i), Value: []byte("v")})
+	}
+	s := newScannedBloomFilterStore(t, mem, 50)
+	defer s.Close()
+
+	for _, k := range []string{"k0", fmt.Sprintf("k%d", bloomScanPageSize+9)} {
+		resp, err := s.Get(&state.GetRequest{Key: k})
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v"), resp.Data)
+	}
+	resp, _ := s.Get(&state.GetRequest{Key: "absent"})
+	assert.Nil(t, resp.Data)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mem.gets))
+
+	// found after rebuilt
+	mem.Set(&state.SetRequest{Key: "other", Value: []byte("v")})
+	assert.Eventually(t, func() bool {
+		resp, _ := s.Get(&state.GetRequest{Key: "other"})
+		return resp.Data != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"mosn.io/mosn/pkg/metrics"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/pkg/log"
+
+	"mosn.io/layotto/pkg/runtime/budget"
+)
+
+const (
+	defaultCacheMaxEntries = 10000
+	defaultCacheTTL        = time.Second
+	// cacheEntrySize is the estimated memory of an entry besides its key and value
+	cacheEntrySize = 128
+
+	// BypassCacheKey in the metadata of the get request reads the store directly, e.g. "bypassCache": "true"
+	BypassCacheKey = "bypassCache"
+)
+
+// CacheConfig is the config of the read-through cache of a state store.
+type CacheConfig struct {
+	// MaxEntries is the max number of keys cached, the least recently used one is evicted. The default value is 10000.
+	MaxEntries int `json:"max_entries"`
+	// TTLMs is how long a value is cached, the default value is 1000.
+	// The writes through the other sidecars aren't seen until the value expires.
+	TTLMs int `json:"ttl_ms"`
+}
+
+type cacheEntry struct {
+	key      string
+	resp     state.GetResponse
+	expireAt time.Time
+	size     int64
+}
+
+// cachedStore caches the responses of Get in a LRU, the keys are invalidated on the writes through the store.
+// The requests with strong consistency, the bypass metadata or any other metadata are sent to the store directly,
+// since the metadata like the partition key may select another value of the key.
+type cachedStore struct {
+	state.Store
+	ttl        time.Duration
+	maxEntries int
+	metrics    types.Metrics
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+	// generation increases on every write, so that the value got before a write isn't cached after it
+	generation uint64
+}
+
+// cachedTransactionalStore keeps the transaction capability of the store
+type cachedTransactionalStore struct {
+	*cachedStore
+	transactional state.TransactionalStore
+}
+
+// cachedQuerierStore keeps the query capability of the store, the results of queries aren't cached
+type cachedQuerierStore struct {
+	*cachedStore
+	state.Querier
+}
+
+type cachedTransactionalQuerierStore struct {
+	*cachedTransactionalStore
+	state.Querier
+}
+
+// NewCachedStore wraps the store with a read-through cache. The returned store implements budget.Shrinker.
+func NewCachedStore(name string, store state.Store, cfg *CacheConfig) state.Store {
+	c := &cachedStore{
+		Store:      store,
+		ttl:        defaultCacheTTL,
+		maxEntries: defaultCacheMaxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+	if cfg.TTLMs > 0 {
+		c.ttl = time.Duration(cfg.TTLMs) * time.Millisecond
+	}
+	if cfg.MaxEntries > 0 {
+		c.maxEntries = cfg.MaxEntries
+	}
+	m, err := metrics.NewMetrics("state_cache", map[string]string{"store": name})
+	if err != nil {
+		log.DefaultLogger.Warnf("[runtime] [state.cache] create metrics of store %s error: %v", name, err)
+	}
+	c.metrics = m
+
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &cachedTransactionalQuerierStore{cachedTransactionalStore: &cachedTransactionalStore{cachedStore: c, transactional: t}, Querier: q}
+	case transactional:
+		return &cachedTransactionalStore{cachedStore: c, transactional: t}
+	case querier:
+		return &cachedQuerierStore{cachedStore: c, Querier: q}
+	}
+	return c
+}
+
+func (c *cachedStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	if req.Options.Consistency == state.Strong || !cacheable(req.Metadata) {
+		c.inc("bypasses")
+		return c.Store.Get(req)
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.items[req.Key]; ok {
+		entry := e.Value.(*cacheEntry)
+		if now.Before(entry.expireAt) {
+			c.ll.MoveToFront(e)
+			resp := cloneGetResponse(&entry.resp)
+			c.mu.Unlock()
+			c.inc("hits")
+			return resp, nil
+		}
+		c.removeElement(e)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	c.inc("misses")
+	resp, err := c.Store.Get(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	c.add(req.Key, resp, generation, now.Add(c.ttl))
+	return resp, nil
+}
+
+// cacheable returns whether the get request with the metadata can be served by the cache
+func cacheable(metadata map[string]string) bool {
+	for k, v := range metadata {
+		if k != BypassCacheKey || v == "true" {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneGetResponse copies the response, so that the callers can't change the one cached
+func cloneGetResponse(resp *state.GetResponse) *state.GetResponse {
+	res := *resp
+	if resp.Data != nil {
+		res.Data = append([]byte(nil), resp.Data...)
+	}
+	if resp.ETag != nil {
+		etag := *resp.ETag
+		res.ETag = &etag
+	}
+	if resp.Metadata != nil {
+		res.Metadata = make(map[string]string, len(resp.Metadata))
+		for k, v := range resp.Metadata {
+			res.Metadata[k] = v
+		}
+	}
+	return &res
+}
+
+func (c *cachedStore) add(key string, resp *state.GetResponse, generation uint64, expireAt time.Time) {
+	size := int64(len(key)+len(resp.Data)) + cacheEntrySize
+	if resp.ETag != nil {
+		size += int64(len(*resp.ETag))
+	}
+	// the value isn't cached if the memory budget is exceeded, which is checked before locking since it reads the usage of the cache
+	if !budget.Allow(size) {
+		c.inc("rejections")
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the key may be written after it's got
+	if generation != c.generation {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, resp: *cloneGetResponse(resp), expireAt: expireAt, size: size})
+	c.bytes += size
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		c.inc("evictions")
+	}
+	c.updateEntries()
+}
+
+func (c *cachedStore) Set(req *state.SetRequest) error {
+	defer c.invalidate(req.Key)
+	return c.Store.Set(req)
+}
+
+func (c *cachedStore) BulkSet(req []state.SetRequest) error {
+	keys := make([]string, len(req))
+	for i := range req {
+		keys[i] = req[i].Key
+	}
+	defer c.invalidate(keys...)
+	return c.Store.BulkSet(req)
+}
+
+func (c *cachedStore) Delete(req *state.DeleteRequest) error {
+	defer c.invalidate(req.Key)
+	return c.Store.Delete(req)
+}
+
+func (c *cachedStore) BulkDelete(req []state.DeleteRequest) error {
+	keys := make([]string, len(req))
+	for i := range req {
+		keys[i] = req[i].Key
+	}
+	defer c.invalidate(keys...)
+	return c.Store.BulkDelete(req)
+}
+
+func (c *cachedTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	keys := make([]string, 0, len(req.Operations))
+	for _, o := range req.Operations {
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			keys = append(keys, r.Key)
+		case state.DeleteRequest:
+			keys = append(keys, r.Key)
+		}
+	}
+	defer c.invalidate(keys...)
+	return c.transactional.Multi(req)
+}
+
+// trackNativeWrite implements nativeWriteTracker
+func (c *cachedStore) trackNativeWrite(key string, write func() (bool, error)) (bool, error) {
+	defer c.invalidate(key)
+	return write()
+}
+
+// invalidate removes the keys whether the write succeeds or not, since the result of a failed write is uncertain
+func (c *cachedStore) invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, key := range keys {
+		if e, ok := c.items[key]; ok {
+			c.removeElement(e)
+		}
+	}
+	c.updateEntries()
+}
+
+func (c *cachedStore) removeElement(e *list.Element) {
+	entry := c.ll.Remove(e).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+}
+
+// MemoryUsage implements budget.Consumer
+func (c *cachedStore) MemoryUsage() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// Shrink implements budget.Shrinker, the least recently used entries are evicted first
+func (c *cachedStore) Shrink(target int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.bytes > target && c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+		c.inc("evictions")
+	}
+	c.updateEntries()
+}
+
+func (c *cachedStore) inc(name string) {
+	if c.metrics != nil {
+		c.metrics.Counter(name).Inc(1)
+	}
+}
+
+func (c *cachedStore) updateEntries() {
+	if c.metrics != nil {
+		c.metrics.Gauge("entries").Update(int64(c.ll.Len()))
+	}
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (c *cachedStore) Unwrap() state.Store {
+	return c.Store
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+	"mosn.io/layotto/pkg/runtime/budget"
+)
+
+func TestCachedStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s := NewCachedStore("mock", store, &CacheConfig{MaxEntries: 2, TTLMs: 50})
+	_, ok := s.(state.TransactionalStore)
+	assert.False(t, ok)
+
+	// the value is got from the store once
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v1")}, nil).Times(1)
+	for i := 0; i < 3; i++ {
+		resp, err := s.Get(&state.GetRequest{Key: "k"})
+		assert.Nil(t, err)
+		assert.Equal(t, "v1", string(resp.Data))
+	}
+
+	// strong consistency and the bypass flag read the store directly
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v2")}, nil).Times(2)
+	resp, _ := s.Get(&state.GetRequest{Key: "k", Options: state.GetStateOption{Consistency: state.Strong}})
+	assert.Equal(t, "v2", string(resp.Data))
+	resp, _ = s.Get(&state.GetRequest{Key: "k", Metadata: map[string]string{BypassCacheKey: "true"}})
+	assert.Equal(t, "v2", string(resp.Data))
+
+	// the key is invalidated by the writes
+	store.EXPECT().Set(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v3")}))
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v3")}, nil).Times(1)
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.Equal(t, "v3", string(resp.Data))
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.Equal(t, "v3", string(resp.Data))
+
+	// the value expires
+	time.Sleep(60 * time.Millisecond)
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil).Times(1)
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, resp.Data)
+
+	// the least recently used key is evicted
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v")}, nil).Times(2)
+	s.Get(&state.GetRequest{Key: "k1"})
+	s.Get(&state.GetRequest{Key: "k2"})
+	c := s.(*cachedStore)
+	assert.Len(t, c.items, 2)
+	_, ok = c.items["k"]
+	assert.False(t, ok)
+	assert.True(t, c.MemoryUsage() > 0)
+	c.Shrink(0)
+	assert.Equal(t, int64(0), c.MemoryUsage())
+	assert.Len(t, c.items, 0)
+}
+
+func TestCachedStoreIsolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s := NewCachedStore("mock", store, &CacheConfig{})
+	c := s.(*cachedStore)
+
+	// the requests with metadata read the store directly, e.g. the partition key may select another value
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("p1")}, nil)
+	resp, _ := s.Get(&state.GetRequest{Key: "k", Metadata: map[string]string{"partitionKey": "p1"}})
+	assert.Equal(t, "p1", string(resp.Data))
+	assert.Len(t, c.items, 0)
+
+	// the value cached isn't changed by the callers
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v")}, nil)
+	resp, _ = s.Get(&state.GetRequest{Key: "k", Metadata: map[string]string{BypassCacheKey: "false"}})
+	resp.Data[0] = 'x'
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.Equal(t, "v", string(resp.Data))
+	resp.Data[0] = 'x'
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.Equal(t, "v", string(resp.Data))
+}
+
+func TestCachedStoreBudget(t *testing.T) {
+	budget.Init(&budget.Config{MaxMemoryBytes: 1, CheckIntervalMs: 3600000})
+	defer budget.Init(nil)
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s := NewCachedStore("mock", store, &CacheConfig{})
+
+	// the value isn't cached if the budget is exceeded
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v")}, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		resp, err := s.Get(&state.GetRequest{Key: "k"})
+		assert.Nil(t, err)
+		assert.Equal(t, "v", string(resp.Data))
+	}
+	assert.Equal(t, int64(0), s.(*cachedStore).MemoryUsage())
+}
+
+func TestCachedStoreGeneration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s := NewCachedStore("mock", store, &CacheConfig{})
+	c := s.(*cachedStore)
+	// the key is written while it's got from the store, so the old value isn't cached
+	store.EXPECT().Get(gomock.Any()).DoAndReturn(func(req *state.GetRequest) (*state.GetResponse, error) {
+		c.invalidate(req.Key)
+		return &state.GetResponse{Data: []byte("old")}, nil
+	})
+	resp, _ := s.Get(&state.GetRequest{Key: "k"})
+	assert.Equal(t, "old", string(resp.Data))
+	assert.Len(t, c.items, 0)
+}
+
+func TestCachedTransactionalStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockTransactionalStore(ctrl)
+	s := NewCachedStore("mock", store, &CacheConfig{})
+	tx, ok := s.(state.TransactionalStore)
+	assert.True(t, ok)
+
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v")}, nil).Times(2)
+	s.Get(&state.GetRequest{Key: "k"})
+	store.EXPECT().Multi(gomock.Any()).Return(nil)
+	err := tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "k"}},
+	}})
+	assert.Nil(t, err)
+	s.Get(&state.GetRequest{Key: "k"})
+}
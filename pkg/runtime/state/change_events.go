@@ -0,0 +1,302 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/state"
+	"github.com/google/uuid"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	l8_comp_pubsub "mosn.io/layotto/components/pubsub"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+)
+
+const (
+	// ChangeEventType is the type of the cloud events of state changes
+	ChangeEventType = "com.runtime.state.changed"
+	// CompensationRecordKeyPrefix is the prefix of the keys of the compensation records of multi-store transactions,
+	// which are internal to the runtime, so their changes aren't published.
+	CompensationRecordKeyPrefix = "layotto-tx-compensation-"
+
+	ChangeOperationUpsert = "upsert"
+	ChangeOperationDelete = "delete"
+
+	defaultChangeEventsQueueSize = 1024
+)
+
+var ErrChangeEventsTopicEmpty = errors.New("pubsub_name and topic of change events are required")
+
+// ChangeEventsConfig is the config of publishing the changes of a state store as events.
+type ChangeEventsConfig struct {
+	// PubsubName is the pubsub component which the events are published to
+	PubsubName string `json:"pubsub_name"`
+	Topic      string `json:"topic"`
+	// QueueSize is the max number of the events waiting to be published, defaultChangeEventsQueueSize if it's not positive.
+	// The events are dropped when the queue is full.
+	QueueSize int `json:"queue_size,omitempty"`
+}
+
+// ChangeEvent is the data of the cloud event published after a key is saved or deleted successfully
+type ChangeEvent struct {
+	Store string `json:"store"`
+	Key   string `json:"key"`
+	// Hashed is true if the key is hashed by the key policy of the store, whose original key can't be restored,
+	// so Key is the key in the store instead of the key of the app
+	Hashed bool `json:"hashed,omitempty"`
+	// Etag is the etag of the value read after it's saved, which may be the one of a later write of the key.
+	// It's empty for the deletes and the stores without etags.
+	Etag      string `json:"etag,omitempty"`
+	Operation string `json:"operation"`
+}
+
+// ChangeEventStore is the store returned by NewChangeEventStore
+type ChangeEventStore interface {
+	state.Store
+	// Close publishes the events queued and stops publishing
+	Close() error
+}
+
+// changeEventStore publishes the changes through it as events, so that the subscribers can invalidate caches
+// or sync the data without CDC. The events are queued after the writes succeed, and published in background in order,
+// so the writes don't wait for the pubsub. The failures are only logged, since the writes can't be reverted;
+// the writes through other channels aren't published.
+type changeEventStore struct {
+	state.Store
+	name   string
+	pubsub pubsub.PubSub
+	config *ChangeEventsConfig
+	// etag is whether the store supports etags, which are read after the values are saved
+	etag bool
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *pendingChange
+	doneCh chan struct{}
+}
+
+// pendingChange is a change waiting to be published
+type pendingChange struct {
+	key       string
+	operation string
+	metadata  map[string]string
+}
+
+type changeEventTransactionalStore struct {
+	*changeEventStore
+	transactional state.TransactionalStore
+}
+
+type changeEventQuerierStore struct {
+	*changeEventStore
+	state.Querier
+}
+
+type changeEventTransactionalQuerierStore struct {
+	*changeEventTransactionalStore
+	state.Querier
+}
+
+// NewChangeEventStore wraps the store to publish its changes to the pubsub of the config
+func NewChangeEventStore(name string, store state.Store, pubsubs map[string]pubsub.PubSub, cfg *ChangeEventsConfig) (ChangeEventStore, error) {
+	if cfg.PubsubName == "" || cfg.Topic == "" {
+		return nil, ErrChangeEventsTopicEmpty
+	}
+	ps, ok := pubsubs[cfg.PubsubName]
+	if !ok {
+		return nil, fmt.Errorf("pubsub %s of change events not found", cfg.PubsubName)
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultChangeEventsQueueSize
+	}
+	c := &changeEventStore{
+		Store:  store,
+		name:   name,
+		pubsub: ps,
+		config: cfg,
+		etag:   state.FeatureETag.IsPresent(store.Features()),
+		queue:  make(chan *pendingChange, queueSize),
+		doneCh: make(chan struct{}),
+	}
+	utils.GoWithRecover(c.run, nil)
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &changeEventTransactionalQuerierStore{changeEventTransactionalStore: &changeEventTransactionalStore{changeEventStore: c, transactional: t}, Querier: q}, nil
+	case transactional:
+		return &changeEventTransactionalStore{changeEventStore: c, transactional: t}, nil
+	case querier:
+		return &changeEventQuerierStore{changeEventStore: c, Querier: q}, nil
+	}
+	return c, nil
+}
+
+func (c *changeEventStore) Set(req *state.SetRequest) error {
+	if err := c.Store.Set(req); err != nil {
+		return err
+	}
+	c.enqueue(req.Key, ChangeOperationUpsert, req.Metadata)
+	return nil
+}
+
+func (c *changeEventStore) BulkSet(req []state.SetRequest) error {
+	if err := c.Store.BulkSet(req); err != nil {
+		return err
+	}
+	for i := range req {
+		c.enqueue(req[i].Key, ChangeOperationUpsert, req[i].Metadata)
+	}
+	return nil
+}
+
+func (c *changeEventStore) Delete(req *state.DeleteRequest) error {
+	if err := c.Store.Delete(req); err != nil {
+		return err
+	}
+	c.enqueue(req.Key, ChangeOperationDelete, req.Metadata)
+	return nil
+}
+
+func (c *changeEventStore) BulkDelete(req []state.DeleteRequest) error {
+	if err := c.Store.BulkDelete(req); err != nil {
+		return err
+	}
+	for i := range req {
+		c.enqueue(req[i].Key, ChangeOperationDelete, req[i].Metadata)
+	}
+	return nil
+}
+
+func (c *changeEventTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	if err := c.transactional.Multi(req); err != nil {
+		return err
+	}
+	for _, o := range req.Operations {
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			c.enqueue(r.Key, ChangeOperationUpsert, r.Metadata)
+		case state.DeleteRequest:
+			c.enqueue(r.Key, ChangeOperationDelete, r.Metadata)
+		}
+	}
+	return nil
+}
+
+// trackNativeWrite implements nativeWriteTracker
+func (c *changeEventStore) trackNativeWrite(key string, write func() (bool, error)) (bool, error) {
+	written, err := write()
+	if err == nil && written {
+		c.enqueue(key, ChangeOperationUpsert, nil)
+	}
+	return written, err
+}
+
+// enqueue queues the change of the key, which is dropped if the queue is full or the store is closed
+func (c *changeEventStore) enqueue(key string, operation string, metadata map[string]string) {
+	// the companion keys are written with their keys
+	if isCompanionKey(key) {
+		return
+	}
+	if original, _ := GetOriginalStateKeyOf(c.name, key); strings.HasPrefix(original, CompensationRecordKeyPrefix) {
+		return
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		log.DefaultLogger.Errorf("[runtime] [state.changeEvents] store %s is closed, the change event of key %s is dropped", c.name, key)
+		return
+	}
+	select {
+	case c.queue <- &pendingChange{key: key, operation: operation, metadata: metadata}:
+	default:
+		log.DefaultLogger.Errorf("[runtime] [state.changeEvents] queue of store %s is full, the change event of key %s is dropped", c.name, key)
+	}
+}
+
+// Close publishes the events queued and stops publishing
+func (c *changeEventStore) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.queue)
+	c.mu.Unlock()
+	<-c.doneCh
+	return nil
+}
+
+func (c *changeEventStore) run() {
+	defer close(c.doneCh)
+	for change := range c.queue {
+		c.publish(change)
+	}
+}
+
+func (c *changeEventStore) publish(change *pendingChange) {
+	key, restored := GetOriginalStateKeyOf(c.name, change.key)
+	ev := &ChangeEvent{Store: c.name, Key: key, Hashed: !restored, Operation: change.operation}
+	if change.operation == ChangeOperationUpsert && c.etag {
+		resp, err := c.Store.Get(&state.GetRequest{Key: change.key, Metadata: change.metadata})
+		if err != nil {
+			log.DefaultLogger.Warnf("[runtime] [state.changeEvents] get etag of key %s in store %s error: %v", key, c.name, err)
+		} else if resp != nil && resp.ETag != nil {
+			ev.Etag = *resp.ETag
+		}
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [state.changeEvents] marshal change event of key %s error: %v", key, err)
+		return
+	}
+	ce := &runtime_pubsub.CloudEvent{
+		ID:              uuid.New().String(),
+		Source:          l8_comp_pubsub.DefaultCloudEventSource,
+		Type:            ChangeEventType,
+		Subject:         key,
+		Topic:           c.config.Topic,
+		PubsubName:      c.config.PubsubName,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	features := c.pubsub.Features()
+	err = c.pubsub.Publish(&pubsub.PublishRequest{
+		PubsubName: c.config.PubsubName,
+		Topic:      c.config.Topic,
+		Data:       runtime_pubsub.MarshalCloudEvent(ce, features, nil),
+		// the events of a key are ordered in the pubsubs partitioned by key
+		Metadata: map[string]string{"partitionKey": key},
+	})
+	if err != nil {
+		log.DefaultLogger.Errorf("[runtime] [state.changeEvents] publish change event of key %s in store %s error: %v", key, c.name, err)
+	}
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (c *changeEventStore) Unwrap() state.Store {
+	return c.Store
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+func TestChangeEventStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	ps := mock_pubsub.NewMockPubSub(ctrl)
+	pubsubs := map[string]pubsub.PubSub{"mq": ps}
+
+	_, err := NewChangeEventStore("mock", store, pubsubs, &ChangeEventsConfig{PubsubName: "mq"})
+	assert.Equal(t, ErrChangeEventsTopicEmpty, err)
+	_, err = NewChangeEventStore("mock", store, pubsubs, &ChangeEventsConfig{PubsubName: "unknown", Topic: "changes"})
+	assert.NotNil(t, err)
+
+	store.EXPECT().Features().Return(nil).AnyTimes()
+	s, err := NewChangeEventStore("mock", store, pubsubs, &ChangeEventsConfig{PubsubName: "mq", Topic: "changes"})
+	assert.Nil(t, err)
+	_, ok := s.(state.TransactionalStore)
+	assert.False(t, ok)
+
+	var events []*ChangeEvent
+	ps.EXPECT().Features().Return(nil).AnyTimes()
+	ps.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+		assert.Equal(t, "changes", req.Topic)
+		var ce map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(req.Data, &ce))
+		var ev ChangeEvent
+		assert.Nil(t, json.Unmarshal(ce["data"], &ev))
+		assert.Equal(t, ev.Key, req.Metadata["partitionKey"])
+		events = append(events, &ev)
+		return nil
+	}).AnyTimes()
+
+	// the app id prefix is removed from the key, and the etag of the request isn't published
+	etag := "1"
+	store.EXPECT().Set(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app||k1", Value: []byte("v"), ETag: &etag}))
+	store.EXPECT().Delete(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k2"}))
+	store.EXPECT().BulkSet(gomock.Any()).Return(nil)
+	assert.Nil(t, s.BulkSet([]state.SetRequest{{Key: "k3"}, {Key: "k4"}}))
+
+	// failed writes, the compensation records and the companion keys aren't published
+	store.EXPECT().Set(gomock.Any()).Return(errors.New("fail"))
+	assert.NotNil(t, s.Set(&state.SetRequest{Key: "k1"}))
+	store.EXPECT().Set(gomock.Any()).Return(nil).Times(2)
+	assert.Nil(t, s.Set(&state.SetRequest{Key: CompensationRecordKeyPrefix + "tx"}))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k1" + typeCompanionSuffix}))
+
+	// the events queued are published before it's closed
+	assert.Nil(t, s.Close())
+	assert.Equal(t, []*ChangeEvent{
+		{Store: "mock", Key: "k1", Operation: ChangeOperationUpsert},
+		{Store: "mock", Key: "k2", Operation: ChangeOperationDelete},
+		{Store: "mock", Key: "k3", Operation: ChangeOperationUpsert},
+		{Store: "mock", Key: "k4", Operation: ChangeOperationUpsert},
+	}, events)
+	// the changes after it's closed are dropped
+	store.EXPECT().Delete(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k1"}))
+	assert.Nil(t, s.Close())
+	assert.Len(t, events, 4)
+
+	// the failure of publishing doesn't fail the write
+	ps2 := mock_pubsub.NewMockPubSub(ctrl)
+	ps2.EXPECT().Features().Return(nil)
+	ps2.EXPECT().Publish(gomock.Any()).Return(errors.New("fail"))
+	s, _ = NewChangeEventStore("mock", store, map[string]pubsub.PubSub{"mq": ps2}, &ChangeEventsConfig{PubsubName: "mq", Topic: "changes"})
+	store.EXPECT().Delete(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k1"}))
+	assert.Nil(t, s.Close())
+}
+
+func TestChangeEventStore_ETag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	ps := mock_pubsub.NewMockPubSub(ctrl)
+	store.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+	s, err := NewChangeEventStore("mock", store, map[string]pubsub.PubSub{"mq": ps}, &ChangeEventsConfig{PubsubName: "mq", Topic: "changes"})
+	assert.Nil(t, err)
+
+	var events []*ChangeEvent
+	ps.EXPECT().Features().Return(nil).AnyTimes()
+	ps.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+		var ce map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(req.Data, &ce))
+		var ev ChangeEvent
+		assert.Nil(t, json.Unmarshal(ce["data"], &ev))
+		events = append(events, &ev)
+		return nil
+	}).Times(2)
+
+	// the etag of the value saved is published
+	etag := "2"
+	store.EXPECT().Set(gomock.Any()).Return(nil)
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v"), ETag: &etag}, nil)
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k1", Value: []byte("v")}))
+	store.EXPECT().Delete(gomock.Any()).Return(nil)
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k1"}))
+	assert.Nil(t, s.Close())
+	assert.Equal(t, []*ChangeEvent{
+		{Store: "mock", Key: "k1", Etag: "2", Operation: ChangeOperationUpsert},
+		{Store: "mock", Key: "k1", Operation: ChangeOperationDelete},
+	}, events)
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+
+	"mosn.io/layotto/pkg/jsonpath"
+)
+
+const (
+	// ClassificationBlock rejects the writes whose values contain the fields of the class
+	ClassificationBlock = "block"
+	// ClassificationMask replaces the fields of the class with the mask
+	ClassificationMask = "mask"
+	// ClassificationHash replaces the fields of the class with their sha256, so they can still be looked up by equality
+	ClassificationHash = "hash"
+	// ClassificationRemove removes the fields of the class
+	ClassificationRemove = "remove"
+
+	defaultClassificationMask = "****"
+	classifiedHashPrefix      = "sha256:"
+
+	// classifiedMetadataKey marks the writes whose values are classified by the same policy already, e.g. the ones
+	// imported from a snapshot of a store with the policy. Its value is the token of the store, which is random,
+	// so the apps can't skip the policy by the metadata.
+	classifiedMetadataKey = "layotto.classified"
+)
+
+// ClassificationConfig is the policy of a state store on the classified data in the values written to it
+type ClassificationConfig struct {
+	// Policy maps the data classes declared in the runtime config to the actions, i.e. block, mask, hash or remove
+	Policy map[string]string `json:"policy"`
+	// Mask replaces the fields of the classes masked, `****` by default
+	Mask string `json:"mask,omitempty"`
+}
+
+// ClassifiedDataError is returned when a write is blocked since its value contains the fields of a data class
+type ClassifiedDataError struct {
+	Store string
+	Key   string
+	Class string
+	Path  string
+}
+
+func (e *ClassifiedDataError) Error() string {
+	return fmt.Sprintf("value of key %s contains %s (data class %s), which is not allowed in state store %s",
+		e.Key, e.Path, e.Class, e.Store)
+}
+
+type classRule struct {
+	class  string
+	action string
+	paths  []*jsonpath.Path
+}
+
+// classifiedStore inspects the json values of the writes and blocks or redacts the fields of the data classes
+// according to the policy of the store, so that the raw PII doesn't land in the backends not allowed to keep it.
+// The values which aren't json objects or arrays are written as they are.
+type classifiedStore struct {
+	state.Store
+	name string
+	mask string
+	// the block rules go first, so that a write is rejected before any field of it is redacted
+	rules []*classRule
+	// fingerprint identifies the policy, and token marks the writes classified by it already
+	fingerprint string
+	token       string
+}
+
+type classifiedTransactionalStore struct {
+	*classifiedStore
+	transactional state.TransactionalStore
+}
+
+type classifiedQuerierStore struct {
+	*classifiedStore
+	state.Querier
+}
+
+type classifiedTransactionalQuerierStore struct {
+	*classifiedTransactionalStore
+	state.Querier
+}
+
+// NewClassifiedStore wraps the store to enforce its classification policy, classes maps the data classes to their json paths
+func NewClassifiedStore(name string, store state.Store, classes map[string][]string, cfg *ClassificationConfig) (state.Store, error) {
+	c := &classifiedStore{Store: store, name: name, mask: cfg.Mask}
+	if c.mask == "" {
+		c.mask = defaultClassificationMask
+	}
+	for class, action := range cfg.Policy {
+		switch action {
+		case ClassificationBlock, ClassificationMask, ClassificationHash, ClassificationRemove:
+		default:
+			return nil, fmt.Errorf("unknown action %q of data class %s", action, class)
+		}
+		exprs, ok := classes[class]
+		if !ok {
+			return nil, fmt.Errorf("data class %s not found", class)
+		}
+		r := &classRule{class: class, action: action}
+		for _, expr := range exprs {
+			p, err := jsonpath.Parse(expr)
+			if err != nil {
+				return nil, fmt.Errorf("path of data class %s is invalid: %w", class, err)
+			}
+			r.paths = append(r.paths, p)
+		}
+		c.rules = append(c.rules, r)
+	}
+	sort.Slice(c.rules, func(i, j int) bool {
+		bi, bj := c.rules[i].action == ClassificationBlock, c.rules[j].action == ClassificationBlock
+		if bi != bj {
+			return bi
+		}
+		return c.rules[i].class < c.rules[j].class
+	})
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", c.mask)
+	for _, r := range c.rules {
+		fmt.Fprintf(h, "%q %q %q\n", r.class, r.action, classes[r.class])
+	}
+	c.fingerprint = hex.EncodeToString(h.Sum(nil))
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	c.token = hex.EncodeToString(token)
+
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &classifiedTransactionalQuerierStore{classifiedTransactionalStore: &classifiedTransactionalStore{classifiedStore: c, transactional: t}, Querier: q}, nil
+	case transactional:
+		return &classifiedTransactionalStore{classifiedStore: c, transactional: t}, nil
+	case querier:
+		return &classifiedQuerierStore{classifiedStore: c, Querier: q}, nil
+	}
+	return c, nil
+}
+
+func (c *classifiedStore) Set(req *state.SetRequest) error {
+	r, err := c.classify(*req)
+	if err != nil {
+		return err
+	}
+	return c.Store.Set(&r)
+}
+
+func (c *classifiedStore) BulkSet(req []state.SetRequest) error {
+	reqs := make([]state.SetRequest, len(req))
+	for i := range req {
+		r, err := c.classify(req[i])
+		if err != nil {
+			return err
+		}
+		reqs[i] = r
+	}
+	return c.Store.BulkSet(reqs)
+}
+
+func (c *classifiedTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	operations := make([]state.TransactionalStateOperation, len(req.Operations))
+	copy(operations, req.Operations)
+	for i, o := range req.Operations {
+		r, ok := o.Request.(state.SetRequest)
+		if !ok {
+			continue
+		}
+		classified, err := c.classify(r)
+		if err != nil {
+			return err
+		}
+		operations[i].Request = classified
+	}
+	return c.transactional.Multi(&state.TransactionalStateRequest{Operations: operations, Metadata: req.Metadata})
+}
+
+// classify returns a copy of the request whose value is redacted by the policy,
+// or a ClassifiedDataError if the value contains the fields of a class blocked
+func (c *classifiedStore) classify(req state.SetRequest) (state.SetRequest, error) {
+	if token, ok := req.Metadata[classifiedMetadataKey]; ok {
+		metadata := make(map[string]string, len(req.Metadata))
+		for k, v := range req.Metadata {
+			if k != classifiedMetadataKey {
+				metadata[k] = v
+			}
+		}
+		req.Metadata = metadata
+		if token == c.token {
+			return req, nil
+		}
+	}
+	value, ok := req.Value.([]byte)
+	if !ok {
+		return req, nil
+	}
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return req, nil
+	}
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(trimmed))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return req, nil
+	}
+	changed := 0
+	for _, r := range c.rules {
+		for _, p := range r.paths {
+			var n int
+			switch r.action {
+			case ClassificationBlock:
+				if len(p.Get(doc)) > 0 {
+					key, _ := GetOriginalStateKeyOf(c.name, req.Key)
+					return req, &ClassifiedDataError{Store: c.name, Key: key, Class: r.class, Path: p.String()}
+				}
+			case ClassificationRemove:
+				doc, n = p.Delete(doc)
+			case ClassificationMask:
+				doc, n = p.Update(doc, func(interface{}) (interface{}, bool) { return c.mask, true })
+			case ClassificationHash:
+				doc, n = p.Update(doc, hashClassified)
+			}
+			changed += n
+		}
+	}
+	if changed == 0 {
+		return req, nil
+	}
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return req, err
+	}
+	req.Value = bytes.TrimRight(buf.Bytes(), "\n")
+	return req, nil
+}
+
+func hashClassified(v interface{}) (interface{}, bool) {
+	if s, ok := v.(string); ok && strings.HasPrefix(s, classifiedHashPrefix) {
+		// hashed already, e.g. the value read from the store is written back, so it's kept as it is
+		return v, true
+	}
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return classifiedHashPrefix + hex.EncodeToString(sum[:]), true
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (c *classifiedStore) Unwrap() state.Store {
+	return c.Store
+}
+
+// policy implements classificationPolicy
+func (c *classifiedStore) policy() (string, string) {
+	return c.fingerprint, c.token
+}
+
+// classificationPolicy is implemented by the classified stores
+type classificationPolicy interface {
+	// policy returns the fingerprint of the policy, and the token marking the writes classified by it already
+	policy() (string, string)
+}
+
+// classificationOf returns the fingerprint and the token of the classification policy in the chain of the wrappers,
+// which are empty if there's no policy
+func classificationOf(store state.Store) (string, string) {
+	for store != nil {
+		if p, ok := store.(classificationPolicy); ok {
+			return p.policy()
+		}
+		w, ok := store.(Wrapper)
+		if !ok {
+			break
+		}
+		store = w.Unwrap()
+	}
+	return "", ""
+}
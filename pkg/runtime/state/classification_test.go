@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+var testDataClasses = map[string][]string{
+	"pii":     {"$.ssn", "$.contacts[*].phone"},
+	"email":   {"$.email"},
+	"payment": {"$.card"},
+	"secret":  {"$.password"},
+}
+
+func TestNewClassifiedStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+
+	_, err := NewClassifiedStore("mock", store, testDataClasses, &ClassificationConfig{Policy: map[string]string{"pii": "encrypt"}})
+	assert.NotNil(t, err)
+	_, err = NewClassifiedStore("mock", store, testDataClasses, &ClassificationConfig{Policy: map[string]string{"unknown": ClassificationBlock}})
+	assert.NotNil(t, err)
+	_, err = NewClassifiedStore("mock", store, map[string][]string{"pii": {"ssn"}}, &ClassificationConfig{Policy: map[string]string{"pii": ClassificationBlock}})
+	assert.NotNil(t, err)
+
+	s, err := NewClassifiedStore("mock", store, testDataClasses, &ClassificationConfig{Policy: map[string]string{"pii": ClassificationBlock}})
+	assert.Nil(t, err)
+	_, ok := s.(state.TransactionalStore)
+	assert.False(t, ok)
+}
+
+func TestClassifiedStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s, err := NewClassifiedStore("mock", store, testDataClasses, &ClassificationConfig{Policy: map[string]string{
+		"pii":     ClassificationBlock,
+		"email":   ClassificationMask,
+		"payment": ClassificationHash,
+		"secret":  ClassificationRemove,
+	}})
+	assert.Nil(t, err)
+
+	var saved []state.SetRequest
+	store.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+		saved = append(saved, *req)
+		return nil
+	}).AnyTimes()
+	store.EXPECT().BulkSet(gomock.Any()).DoAndReturn(func(req []state.SetRequest) error {
+		saved = append(saved, req...)
+		return nil
+	}).AnyTimes()
+
+	// the fields are redacted by the policy
+	err = s.Set(&state.SetRequest{Key: "k1", Value: []byte(`{"name":"<a>","email":"a@b.c","card":"4111","password":"x","age":18}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"age":18,"card":"sha256:d53bd9707474231349de574bc854795383ffc2888271abd5554bc35555ef6577","email":"****","name":"<a>"}`,
+		string(saved[0].Value.([]byte)))
+
+	// the hashed values read from the store are written back as they are
+	saved = nil
+	err = s.Set(&state.SetRequest{Key: "k1", Value: []byte(`{"card":"sha256:d53bd9707474231349de574bc854795383ffc2888271abd5554bc35555ef6577"}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"card":"sha256:d53bd9707474231349de574bc854795383ffc2888271abd5554bc35555ef6577"}`, string(saved[0].Value.([]byte)))
+
+	// the values without classified fields and the values not in json are written as they are
+	saved = nil
+	err = s.BulkSet([]state.SetRequest{
+		{Key: "k2", Value: []byte(`{ "name": "layotto" }`)},
+		{Key: "k3", Value: []byte("email=a@b.c")},
+		{Key: "k4", Value: "not bytes"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `{ "name": "layotto" }`, string(saved[0].Value.([]byte)))
+	assert.Equal(t, "email=a@b.c", string(saved[1].Value.([]byte)))
+	assert.Equal(t, "not bytes", saved[2].Value)
+
+	// the writes containing the blocked classes are rejected, even in a bulk
+	saved = nil
+	err = s.Set(&state.SetRequest{Key: "app||k5", Value: []byte(`{"email":"a@b.c","contacts":[{"name":"x"},{"phone":"123"}]}`)})
+	var ce *ClassifiedDataError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, &ClassifiedDataError{Store: "mock", Key: "k5", Class: "pii", Path: "$.contacts[*].phone"}, ce)
+	err = s.BulkSet([]state.SetRequest{
+		{Key: "k6", Value: []byte(`{"name":"layotto"}`)},
+		{Key: "k7", Value: []byte(`{"ssn":"123"}`)},
+	})
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, "k7", ce.Key)
+	assert.Empty(t, saved)
+}
+
+func TestClassifiedTransactionalStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockTransactionalStore(ctrl)
+	s, err := NewClassifiedStore("mock", store, testDataClasses, &ClassificationConfig{
+		Policy: map[string]string{"pii": ClassificationBlock, "email": ClassificationMask},
+		Mask:   "[redacted]",
+	})
+	assert.Nil(t, err)
+	tx, ok := s.(state.TransactionalStore)
+	assert.True(t, ok)
+
+	value := []byte(`{"email":"a@b.c"}`)
+	store.EXPECT().Multi(gomock.Any()).DoAndReturn(func(req *state.TransactionalStateRequest) error {
+		assert.Equal(t, `{"email":"[redacted]"}`, string(req.Operations[0].Request.(state.SetRequest).Value.([]byte)))
+		assert.Equal(t, "k2", req.Operations[1].Request.(state.DeleteRequest).Key)
+		return nil
+	})
+	err = tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: value}},
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "k2"}},
+	}})
+	assert.Nil(t, err)
+	// the request of the caller isn't modified
+	assert.Equal(t, `{"email":"a@b.c"}`, string(value))
+
+	err = tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: []byte(`{"ssn":"123"}`)}},
+	}})
+	var ce *ClassifiedDataError
+	assert.True(t, errors.As(err, &ce))
+}
@@ -18,8 +18,11 @@ package state
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
+
+	"mosn.io/layotto/pkg/runtime/keypolicy"
 )
 
 const (
@@ -33,10 +36,15 @@ const (
 	daprSeparator = "||"
 )
 
-var statesConfiguration = map[string]*StoreConfiguration{}
+var (
+	statesConfiguration = map[string]*StoreConfiguration{}
+	// the configurations are saved again when the components are reconciled
+	statesConfigurationLock sync.RWMutex
+)
 
 type StoreConfiguration struct {
 	keyPrefixStrategy string
+	keyPolicy         *keypolicy.Policy
 }
 
 func SaveStateConfiguration(storeName string, metadata map[string]string) error {
@@ -51,7 +59,14 @@ func SaveStateConfiguration(storeName string, metadata map[string]string) error
 		}
 	}
 
-	statesConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy}
+	policy, err := keypolicy.Parse(metadata)
+	if err != nil {
+		return err
+	}
+
+	statesConfigurationLock.Lock()
+	statesConfiguration[storeName] = &StoreConfiguration{keyPrefixStrategy: strategy, keyPolicy: policy}
+	statesConfigurationLock.Unlock()
 	return nil
 }
 
@@ -60,21 +75,34 @@ func GetModifiedStateKey(key, storeName, appID string) (string, error) {
 		return "", err
 	}
 	stateConfiguration := getStateConfiguration(storeName)
+	key, err := stateConfiguration.keyPolicy.Sanitize(key)
+	if err != nil {
+		return "", err
+	}
+	return stateConfiguration.keyPolicy.Limit(addPrefix(stateConfiguration, key, storeName, appID))
+}
+
+func addPrefix(stateConfiguration *StoreConfiguration, key, storeName, appID string) string {
 	switch stateConfiguration.keyPrefixStrategy {
 	case strategyNone:
-		return key, nil
+		return key
 	case strategyStoreName:
-		return fmt.Sprintf("%s%s%s", storeName, daprSeparator, key), nil
+		return fmt.Sprintf("%s%s%s", storeName, daprSeparator, key)
 	case strategyAppid:
 		if appID == "" {
-			return key, nil
+			return key
 		}
-		return fmt.Sprintf("%s%s%s", appID, daprSeparator, key), nil
+		return fmt.Sprintf("%s%s%s", appID, daprSeparator, key)
 	default:
-		return fmt.Sprintf("%s%s%s", stateConfiguration.keyPrefixStrategy, daprSeparator, key), nil
+		return fmt.Sprintf("%s%s%s", stateConfiguration.keyPrefixStrategy, daprSeparator, key)
 	}
 }
 
+// KeyPrefix returns the prefix of the keys saved by the app in the store, which is empty if the keys aren't prefixed
+func KeyPrefix(storeName, appID string) string {
+	return addPrefix(getStateConfiguration(storeName), "", storeName, appID)
+}
+
 func GetOriginalStateKey(modifiedStateKey string) string {
 	splits := strings.Split(modifiedStateKey, daprSeparator)
 	if len(splits) <= 1 {
@@ -83,13 +111,33 @@ func GetOriginalStateKey(modifiedStateKey string) string {
 	return splits[1]
 }
 
+// GetOriginalStateKeyOf returns the key of the app from the key in the store, i.e. the prefix is removed
+// and the characters escaped by the key policy of the store are restored.
+// It returns false if the key is hashed by the key policy, whose original key can't be restored,
+// and the key in the store without the prefix is returned instead.
+func GetOriginalStateKeyOf(storeName, modifiedStateKey string) (string, bool) {
+	policy := getStateConfiguration(storeName).keyPolicy
+	key := GetOriginalStateKey(modifiedStateKey)
+	if policy.Hashed(modifiedStateKey) {
+		return key, false
+	}
+	return policy.Restore(key), true
+}
+
 func getStateConfiguration(storeName string) *StoreConfiguration {
+	statesConfigurationLock.RLock()
 	c := statesConfiguration[storeName]
+	statesConfigurationLock.RUnlock()
+	if c != nil {
+		return c
+	}
+	statesConfigurationLock.Lock()
+	defer statesConfigurationLock.Unlock()
+	c = statesConfiguration[storeName]
 	if c == nil {
 		c = &StoreConfiguration{keyPrefixStrategy: strategyDefault}
 		statesConfiguration[storeName] = c
 	}
-
 	return c
 }
 
@@ -18,6 +18,7 @@ package state
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -155,3 +156,37 @@ func TestPrefix_StoreNotInitial(t *testing.T) {
 	originalStateKey := GetOriginalStateKey(modifiedStateKey)
 	require.Equal(t, key, originalStateKey)
 }
+
+func TestKeyPolicy(t *testing.T) {
+	err := SaveStateConfiguration("store7", map[string]string{strategyKey: strategyNone, "keyMaxLength": "8"})
+	require.Nil(t, err)
+	key, err := GetModifiedStateKey("12345678", "store7", "appid1")
+	require.Nil(t, err)
+	require.Equal(t, "12345678", key)
+	_, err = GetModifiedStateKey("123456789", "store7", "appid1")
+	require.NotNil(t, err)
+}
+
+func TestGetOriginalStateKeyOf(t *testing.T) {
+	err := SaveStateConfiguration("store8", map[string]string{
+		strategyKey:              strategyNone,
+		"keyAllowedChars":        "a-z0-9",
+		"keyInvalidCharStrategy": "escape",
+		"keyMaxLength":           "40",
+		"keyOverlongStrategy":    "hash",
+	})
+	require.Nil(t, err)
+
+	key, err := GetModifiedStateKey("order/1", "store8", "appid1")
+	require.Nil(t, err)
+	require.Equal(t, "order%2F1", key)
+	original, restored := GetOriginalStateKeyOf("store8", key)
+	require.True(t, restored)
+	require.Equal(t, "order/1", original)
+
+	key, err = GetModifiedStateKey(strings.Repeat("a", 40), "store8", "appid1")
+	require.Nil(t, err)
+	require.Len(t, key, 40)
+	_, restored = GetOriginalStateKeyOf("store8", key)
+	require.False(t, restored)
+}
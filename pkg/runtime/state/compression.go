@@ -0,0 +1,191 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"github.com/dapr/components-contrib/state"
+
+	"mosn.io/layotto/pkg/runtime/compression"
+)
+
+// compressedStore compresses the values larger than the min size when they're saved,
+// and decompresses them when they're got. The values which aren't compressed are returned as they are,
+// so compression can be enabled for a store with data already.
+// The values are opaque to the store after compression, so the queries can't filter on the compressed values,
+// but the results are decompressed.
+type compressedStore struct {
+	state.Store
+	algorithm string
+	minSize   int
+}
+
+// compressedTransactionalStore keeps the transaction capability of the store
+type compressedTransactionalStore struct {
+	*compressedStore
+	transactional state.TransactionalStore
+}
+
+// compressedQuerierStore keeps the query capability of the store, the results are decompressed
+type compressedQuerierStore struct {
+	*compressedStore
+	querier state.Querier
+}
+
+type compressedTransactionalQuerierStore struct {
+	*compressedTransactionalStore
+	querier state.Querier
+}
+
+// NewCompressedStore wraps the store so that the large values are compressed
+func NewCompressedStore(store state.Store, cfg *compression.Config) (state.Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.GetAlgorithm() == compression.None {
+		return store, nil
+	}
+	s := &compressedStore{Store: store, algorithm: cfg.GetAlgorithm(), minSize: cfg.MinSize()}
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &compressedTransactionalQuerierStore{compressedTransactionalStore: &compressedTransactionalStore{compressedStore: s, transactional: t}, querier: q}, nil
+	case transactional:
+		return &compressedTransactionalStore{compressedStore: s, transactional: t}, nil
+	case querier:
+		return &compressedQuerierStore{compressedStore: s, querier: q}, nil
+	}
+	return s, nil
+}
+
+func (s *compressedStore) Set(req *state.SetRequest) error {
+	compressed, err := s.compress(*req)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(&compressed)
+}
+
+func (s *compressedStore) BulkSet(req []state.SetRequest) error {
+	compressed := make([]state.SetRequest, len(req))
+	for i, r := range req {
+		var err error
+		if compressed[i], err = s.compress(r); err != nil {
+			return err
+		}
+	}
+	return s.Store.BulkSet(compressed)
+}
+
+func (s *compressedStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	resp, err := s.Store.Get(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if resp.Data, err = compression.Decompress(resp.Data); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *compressedStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	supported, resp, err := s.Store.BulkGet(req)
+	if err != nil || !supported {
+		return supported, resp, err
+	}
+	for i := range resp {
+		if resp[i].Error != "" {
+			continue
+		}
+		data, err := compression.Decompress(resp[i].Data)
+		if err != nil {
+			resp[i].Error = err.Error()
+			continue
+		}
+		resp[i].Data = data
+	}
+	return supported, resp, nil
+}
+
+func (s *compressedQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+func (s *compressedTransactionalQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+func (s *compressedStore) query(querier state.Querier, req *state.QueryRequest) (*state.QueryResponse, error) {
+	resp, err := querier.Query(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	for i := range resp.Results {
+		if resp.Results[i].Error != "" {
+			continue
+		}
+		data, err := compression.Decompress(resp.Results[i].Data)
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+			continue
+		}
+		resp.Results[i].Data = data
+	}
+	return resp, nil
+}
+
+func (s *compressedTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	operations := make([]state.TransactionalStateOperation, len(req.Operations))
+	for i, o := range req.Operations {
+		operations[i] = o
+		if o.Operation != state.Upsert {
+			continue
+		}
+		setReq, ok := o.Request.(state.SetRequest)
+		if !ok {
+			continue
+		}
+		compressed, err := s.compress(setReq)
+		if err != nil {
+			return err
+		}
+		operations[i].Request = compressed
+	}
+	return s.transactional.Multi(&state.TransactionalStateRequest{Operations: operations, Metadata: req.Metadata})
+}
+
+// compress returns a copy of the request whose value is compressed if it's large enough
+func (s *compressedStore) compress(req state.SetRequest) (state.SetRequest, error) {
+	value, ok := req.Value.([]byte)
+	if !ok || len(value) < s.minSize {
+		return req, nil
+	}
+	compressed, err := compression.Compress(s.algorithm, value)
+	if err != nil {
+		return req, err
+	}
+	// keep the value as it is if it can't be compressed, e.g. an image
+	if len(compressed) < len(value) {
+		req.Value = compressed
+	}
+	return req, nil
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (s *compressedStore) Unwrap() state.Store {
+	return s.Store
+}
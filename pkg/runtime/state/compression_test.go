@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+	"mosn.io/layotto/pkg/runtime/compression"
+)
+
+func TestCompressedStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	s, err := NewCompressedStore(store, &compression.Config{MinSizeBytes: 100})
+	assert.Nil(t, err)
+	_, ok := s.(state.TransactionalStore)
+	assert.False(t, ok)
+
+	large := []byte(strings.Repeat("layotto", 100))
+	var saved []state.SetRequest
+	store.EXPECT().BulkSet(gomock.Any()).DoAndReturn(func(req []state.SetRequest) error {
+		saved = req
+		return nil
+	})
+	err = s.BulkSet([]state.SetRequest{{Key: "large", Value: large}, {Key: "small", Value: []byte("small")}})
+	assert.Nil(t, err)
+	assert.True(t, compression.IsCompressed(saved[0].Value.([]byte)))
+	assert.Equal(t, "small", string(saved[1].Value.([]byte)))
+
+	store.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: saved[0].Value.([]byte)}, nil)
+	resp, err := s.Get(&state.GetRequest{Key: "large"})
+	assert.Nil(t, err)
+	assert.Equal(t, large, resp.Data)
+
+	store.EXPECT().BulkGet(gomock.Any()).Return(true, []state.BulkGetResponse{
+		{Key: "large", Data: saved[0].Value.([]byte)},
+		{Key: "small", Data: []byte("small")},
+	}, nil)
+	_, bulk, err := s.BulkGet([]state.GetRequest{{Key: "large"}, {Key: "small"}})
+	assert.Nil(t, err)
+	assert.Equal(t, large, bulk[0].Data)
+	assert.Equal(t, "small", string(bulk[1].Data))
+
+	// nothing is wrapped for "none"
+	s, err = NewCompressedStore(store, &compression.Config{Algorithm: compression.None})
+	assert.Nil(t, err)
+	assert.Equal(t, store, s)
+	_, err = NewCompressedStore(store, &compression.Config{Algorithm: "lz4"})
+	assert.NotNil(t, err)
+}
+
+func TestCompressedTransactionalStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockTransactionalStore(ctrl)
+	s, err := NewCompressedStore(store, &compression.Config{Algorithm: compression.Zstd, MinSizeBytes: 100})
+	assert.Nil(t, err)
+	tx, ok := s.(state.TransactionalStore)
+	assert.True(t, ok)
+
+	large := []byte(strings.Repeat("layotto", 100))
+	store.EXPECT().Multi(gomock.Any()).DoAndReturn(func(req *state.TransactionalStateRequest) error {
+		assert.True(t, compression.IsCompressed(req.Operations[0].Request.(state.SetRequest).Value.([]byte)))
+		assert.Equal(t, "k", req.Operations[1].Request.(state.DeleteRequest).Key)
+		return nil
+	})
+	err = tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "k", Value: large}},
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "k"}},
+	}})
+	assert.Nil(t, err)
+}
+
+func TestCompressedStoreQuery(t *testing.T) {
+	s, err := NewCompressedStore(&memQuerierStore{memStore: newMemStore()}, &compression.Config{MinSizeBytes: 100})
+	assert.Nil(t, err)
+	large := []byte(strings.Repeat("layotto", 100))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: large}))
+
+	resp, err := s.(state.Querier).Query(&state.QueryRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 1)
+	assert.Equal(t, large, resp.Results[0].Data)
+}
@@ -16,7 +16,29 @@
 
 package state
 
+import "mosn.io/layotto/pkg/runtime/compression"
+
 // Config wraps configuration for a state implementation
 type Config struct {
 	Metadata map[string]string `json:"metadata"`
+	// ETag generates and checks the etags in the runtime for the store without native etags if it's not nil
+	ETag *ETagConfig `json:"etag,omitempty"`
+	// TTL records the expire times of the values saved with ttls, and hides the expired values if it's not nil
+	TTL *TTLConfig `json:"ttl,omitempty"`
+	// Compression compresses the large values if it's not nil
+	Compression *compression.Config `json:"compression,omitempty"`
+	// Outbox relays the messages in the outbox of the store to the pubsubs if it's not nil
+	Outbox *OutboxConfig `json:"outbox,omitempty"`
+	// BloomFilter answers the reads of the keys absent in the filter of the keys without reading the store if it's not nil
+	BloomFilter *BloomFilterConfig `json:"bloom_filter,omitempty"`
+	// Cache caches the results of Get in the sidecar if it's not nil
+	Cache *CacheConfig `json:"cache,omitempty"`
+	// WriteBehind acknowledges SaveState once it's logged locally and writes to the store in batches if it's not nil
+	WriteBehind *WriteBehindConfig `json:"write_behind,omitempty"`
+	// ChangeEvents publishes the keys saved or deleted successfully to a topic if it's not nil
+	ChangeEvents *ChangeEventsConfig `json:"change_events,omitempty"`
+	// TypedValues records the content types declared by the writes with the values if it's not nil
+	TypedValues *TypedValuesConfig `json:"typed_values,omitempty"`
+	// Classification blocks or redacts the fields of the data classes in the values written if it's not nil
+	Classification *ClassificationConfig `json:"classification,omitempty"`
 }
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+// DefaultIncrementMaxRetries is the max times of retrying when emulating increment with etag.
+const DefaultIncrementMaxRetries = 10
+
+var (
+	ErrIncrementNotSupported = errors.New("state store supports neither atomic increment nor etag with atomic set-if-absent")
+	ErrValueNotInteger       = errors.New("the value is not an integer")
+	ErrIncrementConflict     = errors.New("too many conflicts when incrementing")
+)
+
+// IncrementRequest is the request to increase the numeric value of a key.
+type IncrementRequest struct {
+	Key      string
+	Delta    int64
+	Metadata map[string]string
+}
+
+// Incrementer can be implemented by state stores which support atomic increment natively,
+// e.g. HINCRBY in redis or $inc in mongo.
+type Incrementer interface {
+	// Increment increases the value by delta and returns the new value.
+	// An absent key is treated as 0.
+	Increment(req *IncrementRequest) (int64, error)
+}
+
+// Increment increases the numeric value of a key atomically.
+// If the store implements Incrementer, which is found through the wrappers of the runtime, the native operation is used.
+// Otherwise it's emulated by a compare-and-swap loop based on etag, and an absent key is created by
+// the IdempotencyRecorder of the store, since saving without etag isn't conditional in all the stores.
+// The value is stored as a decimal string.
+func Increment(store state.Store, req *IncrementRequest, maxRetries int) (int64, error) {
+	if native, write, ok := findNative(store, func(s state.Store) bool {
+		_, ok := s.(Incrementer)
+		return ok
+	}); ok {
+		var v int64
+		_, err := write(req.Key, func() (_ bool, err error) {
+			v, err = native.(Incrementer).Increment(req)
+			return err == nil, err
+		})
+		return v, err
+	}
+	if !state.FeatureETag.IsPresent(store.Features()) {
+		return 0, ErrIncrementNotSupported
+	}
+	for i := 0; i <= maxRetries; i++ {
+		resp, err := store.Get(&state.GetRequest{
+			Key:      req.Key,
+			Metadata: req.Metadata,
+			Options:  state.GetStateOption{Consistency: state.Strong},
+		})
+		if err != nil {
+			return 0, err
+		}
+		if resp == nil || resp.ETag == nil {
+			// the key is absent
+			value := []byte(strconv.FormatInt(req.Delta, 10))
+			recorded, _, err := CheckAndRecord(store, &IdempotencyRequest{Key: req.Key, Value: value, Metadata: req.Metadata})
+			if err == ErrIdempotencyNotSupported {
+				return 0, ErrIncrementNotSupported
+			}
+			if err != nil {
+				return 0, err
+			}
+			if recorded {
+				return req.Delta, nil
+			}
+			// created concurrently, increase it with its etag
+			continue
+		}
+		current, err := parseInteger(resp.Data)
+		if err != nil {
+			return 0, err
+		}
+		next := current + req.Delta
+		err = store.Set(&state.SetRequest{
+			Key:      req.Key,
+			Value:    []byte(strconv.FormatInt(next, 10)),
+			ETag:     resp.ETag,
+			Metadata: req.Metadata,
+			Options: state.SetStateOption{
+				Concurrency: state.FirstWrite,
+				Consistency: state.Strong,
+			},
+		})
+		if err == nil {
+			return next, nil
+		}
+		if e, ok := err.(*state.ETagError); !ok || e.Kind() != state.ETagMismatch {
+			return 0, err
+		}
+	}
+	return 0, ErrIncrementConflict
+}
+
+func parseInteger(data []byte) (int64, error) {
+	// some stores return json string
+	s := strings.Trim(strings.TrimSpace(string(data)), "\"")
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrValueNotInteger
+	}
+	return v, nil
+}
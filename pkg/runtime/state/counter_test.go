@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+type nativeIncrementStore struct {
+	state.Store
+	value int64
+}
+
+func (s *nativeIncrementStore) Increment(req *IncrementRequest) (int64, error) {
+	s.value += req.Delta
+	return s.value, nil
+}
+
+func TestIncrement(t *testing.T) {
+	t.Run("native", func(t *testing.T) {
+		store := &nativeIncrementStore{value: 1}
+		v, err := Increment(store, &IncrementRequest{Key: "a", Delta: 2}, DefaultIncrementMaxRetries)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), v)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return(nil)
+		_, err := Increment(mockStore, &IncrementRequest{Key: "a", Delta: 1}, DefaultIncrementMaxRetries)
+		assert.Equal(t, ErrIncrementNotSupported, err)
+	})
+
+	t.Run("absent key", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil)
+		store := &nativeIdempotencyStore{Store: mockStore, markers: map[string][]byte{}}
+		v, err := Increment(store, &IncrementRequest{Key: "a", Delta: -1}, DefaultIncrementMaxRetries)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(-1), v)
+		assert.Equal(t, []byte("-1"), store.markers["a"])
+	})
+
+	t.Run("absent key without atomic creation", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil)
+		_, err := Increment(mockStore, &IncrementRequest{Key: "a", Delta: 1}, DefaultIncrementMaxRetries)
+		assert.Equal(t, ErrIncrementNotSupported, err)
+	})
+
+	t.Run("created concurrently", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		etag := "1"
+		gomock.InOrder(
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil),
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("2"), ETag: &etag}, nil),
+			mockStore.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+				assert.Equal(t, "1", *req.ETag)
+				assert.Equal(t, []byte("3"), req.Value)
+				return nil
+			}),
+		)
+		store := &nativeIdempotencyStore{Store: mockStore, markers: map[string][]byte{"a": []byte("2")}}
+		v, err := Increment(store, &IncrementRequest{Key: "a", Delta: 1}, DefaultIncrementMaxRetries)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), v)
+	})
+
+	t.Run("native through the wrappers", func(t *testing.T) {
+		store := NewCachedStore("mock", &nativeIncrementStore{value: 1}, &CacheConfig{})
+		v, err := Increment(store, &IncrementRequest{Key: "a", Delta: 2}, DefaultIncrementMaxRetries)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), v)
+	})
+
+	t.Run("retry when etag mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		etag1, etag2 := "1", "2"
+		gomock.InOrder(
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("5"), ETag: &etag1}, nil),
+			mockStore.EXPECT().Set(gomock.Any()).Return(state.NewETagError(state.ETagMismatch, nil)),
+			mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("\"6\""), ETag: &etag2}, nil),
+			mockStore.EXPECT().Set(gomock.Any()).DoAndReturn(func(req *state.SetRequest) error {
+				assert.Equal(t, "2", *req.ETag)
+				assert.Equal(t, []byte("16"), req.Value)
+				return nil
+			}),
+		)
+		v, err := Increment(mockStore, &IncrementRequest{Key: "a", Delta: 10}, DefaultIncrementMaxRetries)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(16), v)
+	})
+
+	t.Run("too many conflicts", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("1"), ETag: &etag}, nil).Times(2)
+		mockStore.EXPECT().Set(gomock.Any()).Return(state.NewETagError(state.ETagMismatch, nil)).Times(2)
+		_, err := Increment(mockStore, &IncrementRequest{Key: "a", Delta: 1}, 1)
+		assert.Equal(t, ErrIncrementConflict, err)
+	})
+
+	t.Run("not integer", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Features().Return([]state.Feature{state.FeatureETag})
+		etag := "1"
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("abc"), ETag: &etag}, nil)
+		_, err := Increment(mockStore, &IncrementRequest{Key: "a", Delta: 1}, DefaultIncrementMaxRetries)
+		assert.Equal(t, ErrValueNotInteger, err)
+	})
+}
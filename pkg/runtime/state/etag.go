@@ -0,0 +1,401 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/google/uuid"
+	"mosn.io/pkg/log"
+)
+
+const (
+	// ETagStorageEnvelope keeps the etag in the value, which is wrapped in an envelope
+	ETagStorageEnvelope = "envelope"
+	// ETagStorageCompanion keeps the etag in a companion key, so the values are stored as they are
+	ETagStorageCompanion = "companion"
+
+	// etagCompanionSuffix is appended to the key to get its companion key.
+	// The keys of the apps can't contain the separator, so they never conflict with the companion keys.
+	etagCompanionSuffix = daprSeparator + "etag"
+
+	etagLockStripes = 64
+)
+
+// etagEnvelopeMagic starts the values in envelopes, followed by the etag, a line feed and the value
+var etagEnvelopeMagic = []byte("\x00layotto-etag\x00")
+
+// ETagConfig is the config of the etags managed by the runtime for the stores without native etags.
+type ETagConfig struct {
+	// Storage is where the etags are kept, envelope by default.
+	// The stores querying the values keep the etags in the companion keys, since the envelopes are opaque to them.
+	Storage string `json:"storage,omitempty"`
+}
+
+func (c *ETagConfig) storage() string {
+	if c.Storage == "" {
+		return ETagStorageEnvelope
+	}
+	return c.Storage
+}
+
+// etagStore generates an etag for each value written and checks the etags and the first-write concurrency
+// of the requests before writing, so that the concurrency options work uniformly for the stores without native etags.
+// The check and the write are serialized per key in the sidecar, but the store has no conditional write to serialize them
+// across the sidecars, so the etags are only reliable if a single sidecar writes the store.
+// The values written before the etags are enabled have no etag until they're written again.
+type etagStore struct {
+	state.Store
+	storage string
+	locks   [etagLockStripes]sync.Mutex
+}
+
+// etagTransactionalStore keeps the transaction capability of the store
+type etagTransactionalStore struct {
+	*etagStore
+	transactional state.TransactionalStore
+}
+
+// etagQuerierStore reads the companion keys of the query results
+type etagQuerierStore struct {
+	*etagStore
+	querier state.Querier
+}
+
+type etagTransactionalQuerierStore struct {
+	*etagTransactionalStore
+	querier state.Querier
+}
+
+// NewETagStore wraps the store so that the etags are managed by the runtime,
+// the store is returned as it is if it supports etags natively.
+func NewETagStore(store state.Store, cfg *ETagConfig) (state.Store, error) {
+	storage := cfg.storage()
+	if storage != ETagStorageEnvelope && storage != ETagStorageCompanion {
+		return nil, fmt.Errorf("unknown etag storage %s", cfg.Storage)
+	}
+	if state.FeatureETag.IsPresent(store.Features()) {
+		return store, nil
+	}
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	if querier {
+		// the queries can't match the values in the envelopes
+		if cfg.Storage == ETagStorageEnvelope {
+			return nil, fmt.Errorf("etag storage %s doesn't support the stores querying the values, use %s instead", ETagStorageEnvelope, ETagStorageCompanion)
+		}
+		storage = ETagStorageCompanion
+	}
+	log.DefaultLogger.Warnf("[runtime] [state.etag] the etags are managed by the sidecar, they're only reliable if a single sidecar writes the store")
+	s := &etagStore{Store: store, storage: storage}
+	switch {
+	case transactional && querier:
+		return &etagTransactionalQuerierStore{etagTransactionalStore: &etagTransactionalStore{etagStore: s, transactional: t}, querier: q}, nil
+	case transactional:
+		return &etagTransactionalStore{etagStore: s, transactional: t}, nil
+	case querier:
+		return &etagQuerierStore{etagStore: s, querier: q}, nil
+	}
+	return s, nil
+}
+
+func (s *etagStore) Features() []state.Feature {
+	return append([]state.Feature{state.FeatureETag}, s.Store.Features()...)
+}
+
+func (s *etagStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	resp, err := s.Store.Get(req)
+	if err != nil || resp == nil || len(resp.Data) == 0 {
+		return resp, err
+	}
+	if s.storage == ETagStorageEnvelope {
+		resp.Data, resp.ETag = openEnvelope(resp.Data)
+		return resp, nil
+	}
+	if resp.ETag, err = s.getCompanion(req.Key, req.Metadata); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *etagStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	// the companion keys are got one by one by the callers
+	if s.storage == ETagStorageCompanion {
+		return false, nil, nil
+	}
+	supported, resp, err := s.Store.BulkGet(req)
+	if err != nil || !supported {
+		return supported, resp, err
+	}
+	for i := range resp {
+		if resp[i].Error == "" && len(resp[i].Data) > 0 {
+			resp[i].Data, resp[i].ETag = openEnvelope(resp[i].Data)
+		}
+	}
+	return supported, resp, nil
+}
+
+func (s *etagStore) Set(req *state.SetRequest) error {
+	mu := s.lock(req.Key)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := s.check(req.Key, req.ETag, req.Options.Concurrency, req.Metadata); err != nil {
+		return err
+	}
+	value, err := toBytes(req.Value)
+	if err != nil {
+		return err
+	}
+	etag := uuid.New().String()
+	r := *req
+	r.ETag = nil
+	r.Options.Concurrency = ""
+	if s.storage == ETagStorageEnvelope {
+		r.Value = sealEnvelope(etag, value)
+		return s.Store.Set(&r)
+	}
+	r.Value = value
+	if err := s.Store.Set(&r); err != nil {
+		return err
+	}
+	return s.Store.Set(&state.SetRequest{Key: req.Key + etagCompanionSuffix, Value: []byte(etag), Metadata: req.Metadata})
+}
+
+func (s *etagStore) BulkSet(req []state.SetRequest) error {
+	for i := range req {
+		if err := s.Set(&req[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *etagStore) Delete(req *state.DeleteRequest) error {
+	mu := s.lock(req.Key)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := s.check(req.Key, req.ETag, req.Options.Concurrency, req.Metadata); err != nil {
+		return err
+	}
+	r := *req
+	r.ETag = nil
+	r.Options.Concurrency = ""
+	if err := s.Store.Delete(&r); err != nil {
+		return err
+	}
+	if s.storage == ETagStorageCompanion {
+		return s.Store.Delete(&state.DeleteRequest{Key: req.Key + etagCompanionSuffix, Metadata: req.Metadata})
+	}
+	return nil
+}
+
+func (s *etagStore) BulkDelete(req []state.DeleteRequest) error {
+	for i := range req {
+		if err := s.Delete(&req[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *etagTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	keys := make([]string, 0, len(req.Operations))
+	for _, o := range req.Operations {
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			keys = append(keys, r.Key)
+		case state.DeleteRequest:
+			keys = append(keys, r.Key)
+		}
+	}
+	defer s.lockAll(keys)()
+	operations := make([]state.TransactionalStateOperation, 0, len(req.Operations))
+	for _, o := range req.Operations {
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			if err := s.check(r.Key, r.ETag, r.Options.Concurrency, r.Metadata); err != nil {
+				return err
+			}
+			value, err := toBytes(r.Value)
+			if err != nil {
+				return err
+			}
+			etag := uuid.New().String()
+			r.ETag = nil
+			r.Options.Concurrency = ""
+			if s.storage == ETagStorageEnvelope {
+				r.Value = sealEnvelope(etag, value)
+				operations = append(operations, state.TransactionalStateOperation{Operation: o.Operation, Request: r})
+				continue
+			}
+			r.Value = value
+			operations = append(operations, state.TransactionalStateOperation{Operation: o.Operation, Request: r},
+				state.TransactionalStateOperation{Operation: state.Upsert, Request: state.SetRequest{Key: r.Key + etagCompanionSuffix, Value: []byte(etag), Metadata: r.Metadata}})
+		case state.DeleteRequest:
+			if err := s.check(r.Key, r.ETag, r.Options.Concurrency, r.Metadata); err != nil {
+				return err
+			}
+			r.ETag = nil
+			r.Options.Concurrency = ""
+			operations = append(operations, state.TransactionalStateOperation{Operation: o.Operation, Request: r})
+			if s.storage == ETagStorageCompanion {
+				operations = append(operations, state.TransactionalStateOperation{Operation: state.Delete, Request: state.DeleteRequest{Key: r.Key + etagCompanionSuffix, Metadata: r.Metadata}})
+			}
+		default:
+			operations = append(operations, o)
+		}
+	}
+	return s.transactional.Multi(&state.TransactionalStateRequest{Operations: operations, Metadata: req.Metadata})
+}
+
+func (s *etagQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+func (s *etagTransactionalQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+// query drops the companion keys from the results, and fills the etags of the values
+func (s *etagStore) query(querier state.Querier, req *state.QueryRequest) (*state.QueryResponse, error) {
+	resp, err := querier.Query(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	results := resp.Results[:0]
+	for _, item := range resp.Results {
+		if item.Error != "" || len(item.Data) == 0 {
+			results = append(results, item)
+			continue
+		}
+		if strings.HasSuffix(item.Key, etagCompanionSuffix) {
+			continue
+		}
+		if item.ETag, err = s.getCompanion(item.Key, req.Metadata); err != nil {
+			item.Error = err.Error()
+		}
+		results = append(results, item)
+	}
+	resp.Results = results
+	return resp, nil
+}
+
+// check returns an etag mismatch error if the etag of the request isn't the current one,
+// or the key exists already for a first-write request without etag. It must be called with the key locked.
+func (s *etagStore) check(key string, etag *string, concurrency string, metadata map[string]string) error {
+	if etag == nil && concurrency != state.FirstWrite {
+		return nil
+	}
+	resp, err := s.Get(&state.GetRequest{Key: key, Metadata: metadata, Options: state.GetStateOption{Consistency: state.Strong}})
+	if err != nil {
+		return err
+	}
+	exists := resp != nil && len(resp.Data) > 0
+	if etag == nil {
+		if exists {
+			return state.NewETagError(state.ETagMismatch, fmt.Errorf("key %s exists already", key))
+		}
+		return nil
+	}
+	if !exists || resp.ETag == nil || *resp.ETag != *etag {
+		return state.NewETagError(state.ETagMismatch, nil)
+	}
+	return nil
+}
+
+func (s *etagStore) getCompanion(key string, metadata map[string]string) (*string, error) {
+	resp, err := s.Store.Get(&state.GetRequest{Key: key + etagCompanionSuffix, Metadata: metadata})
+	if err != nil || resp == nil || len(resp.Data) == 0 {
+		return nil, err
+	}
+	etag := string(resp.Data)
+	return &etag, nil
+}
+
+func (s *etagStore) lock(key string) *sync.Mutex {
+	return &s.locks[stripe(key)]
+}
+
+// lockAll locks the stripes of the keys in order to avoid deadlocks, and returns the function unlocking them
+func (s *etagStore) lockAll(keys []string) func() {
+	seen := make(map[int]bool, len(keys))
+	stripes := make([]int, 0, len(keys))
+	for _, k := range keys {
+		i := stripe(k)
+		if !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
+		}
+	}
+	sort.Ints(stripes)
+	for _, i := range stripes {
+		s.locks[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			s.locks[i].Unlock()
+		}
+	}
+}
+
+func stripe(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % etagLockStripes)
+}
+
+// toBytes returns the value as it is if it's bytes, otherwise it's serialized as json like the stores do
+func toBytes(value interface{}) ([]byte, error) {
+	if b, ok := value.([]byte); ok {
+		return b, nil
+	}
+	return json.Marshal(value)
+}
+
+func sealEnvelope(etag string, value []byte) []byte {
+	b := make([]byte, 0, len(etagEnvelopeMagic)+len(etag)+1+len(value))
+	b = append(b, etagEnvelopeMagic...)
+	b = append(b, etag...)
+	b = append(b, '\n')
+	return append(b, value...)
+}
+
+// openEnvelope returns the value and its etag, the data is returned as it is without etag if it's not in an envelope
+func openEnvelope(data []byte) ([]byte, *string) {
+	if !bytes.HasPrefix(data, etagEnvelopeMagic) {
+		return data, nil
+	}
+	rest := data[len(etagEnvelopeMagic):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	etag := string(rest[:i])
+	return rest[i+1:], &etag
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (s *etagStore) Unwrap() state.Store {
+	return s.Store
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is a transactional store without native etags
+type memStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: make(map[string][]byte)}
+}
+
+func (s *memStore) Init(metadata state.Metadata) error { return nil }
+func (s *memStore) Ping() error                        { return nil }
+func (s *memStore) Features() []state.Feature          { return []state.Feature{state.FeatureTransactional} }
+
+func (s *memStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &state.GetResponse{Data: s.items[req.Key]}, nil
+}
+
+func (s *memStore) Set(req *state.SetRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[req.Key] = req.Value.([]byte)
+	return nil
+}
+
+func (s *memStore) Delete(req *state.DeleteRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, req.Key)
+	return nil
+}
+
+func (s *memStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	resp := make([]state.BulkGetResponse, len(req))
+	for i, r := range req {
+		v, _ := s.Get(&r)
+		resp[i] = state.BulkGetResponse{Key: r.Key, Data: v.Data}
+	}
+	return true, resp, nil
+}
+
+func (s *memStore) BulkSet(req []state.SetRequest) error {
+	for i := range req {
+		s.Set(&req[i])
+	}
+	return nil
+}
+
+func (s *memStore) BulkDelete(req []state.DeleteRequest) error {
+	for i := range req {
+		s.Delete(&req[i])
+	}
+	return nil
+}
+
+func (s *memStore) Multi(req *state.TransactionalStateRequest) error {
+	for _, o := range req.Operations {
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			s.Set(&r)
+		case state.DeleteRequest:
+			s.Delete(&r)
+		}
+	}
+	return nil
+}
+
+func TestNewETagStore(t *testing.T) {
+	_, err := NewETagStore(newMemStore(), &ETagConfig{Storage: "unknown"})
+	assert.NotNil(t, err)
+
+	s, err := NewETagStore(newMemStore(), &ETagConfig{})
+	assert.Nil(t, err)
+	assert.True(t, state.FeatureETag.IsPresent(s.Features()))
+	_, ok := s.(state.TransactionalStore)
+	assert.True(t, ok)
+
+	// the store supporting etags natively isn't wrapped
+	native, err := NewETagStore(s, &ETagConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, s, native)
+}
+
+func TestETagStore(t *testing.T) {
+	for _, storage := range []string{ETagStorageEnvelope, ETagStorageCompanion} {
+		t.Run(storage, func(t *testing.T) {
+			mem := newMemStore()
+			s, _ := NewETagStore(mem, &ETagConfig{Storage: storage})
+
+			// first write
+			assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v1"), Options: state.SetStateOption{Concurrency: state.FirstWrite}}))
+			resp, err := s.Get(&state.GetRequest{Key: "k"})
+			assert.Nil(t, err)
+			assert.Equal(t, "v1", string(resp.Data))
+			assert.NotNil(t, resp.ETag)
+			etag := *resp.ETag
+			err = s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Options: state.SetStateOption{Concurrency: state.FirstWrite}})
+			assert.True(t, isETagMismatch(err))
+
+			// a new etag is generated for each write
+			assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v2"), ETag: &etag}))
+			err = s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), ETag: &etag})
+			assert.True(t, isETagMismatch(err))
+			resp, _ = s.Get(&state.GetRequest{Key: "k"})
+			assert.Equal(t, "v2", string(resp.Data))
+			assert.NotEqual(t, etag, *resp.ETag)
+
+			// delete with etag
+			err = s.Delete(&state.DeleteRequest{Key: "k", ETag: &etag})
+			assert.True(t, isETagMismatch(err))
+			assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k", ETag: resp.ETag}))
+			assert.Empty(t, mem.items)
+
+			// transaction
+			tx := s.(state.TransactionalStore)
+			assert.Nil(t, tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+				{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: []byte("v1")}},
+				{Operation: state.Upsert, Request: state.SetRequest{Key: "k2", Value: []byte("v2")}},
+			}}))
+			resp, _ = s.Get(&state.GetRequest{Key: "k1"})
+			assert.Equal(t, "v1", string(resp.Data))
+			err = tx.Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+				{Operation: state.Delete, Request: state.DeleteRequest{Key: "k1", ETag: resp.ETag}},
+				{Operation: state.Delete, Request: state.DeleteRequest{Key: "k2", ETag: &etag}},
+			}})
+			assert.True(t, isETagMismatch(err))
+			resp, _ = s.Get(&state.GetRequest{Key: "k1"})
+			assert.Equal(t, "v1", string(resp.Data))
+
+			// bulk get
+			supported, bulk, err := s.BulkGet([]state.GetRequest{{Key: "k1"}, {Key: "k2"}})
+			assert.Nil(t, err)
+			if storage == ETagStorageEnvelope {
+				assert.True(t, supported)
+				assert.Equal(t, "v2", string(bulk[1].Data))
+				assert.NotNil(t, bulk[1].ETag)
+			} else {
+				assert.False(t, supported)
+			}
+		})
+	}
+}
+
+func TestETagStoreLegacyValue(t *testing.T) {
+	mem := newMemStore()
+	mem.items["k"] = []byte("v")
+	s, _ := NewETagStore(mem, &ETagConfig{})
+
+	resp, err := s.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(resp.Data))
+	assert.Nil(t, resp.ETag)
+	etag := "1"
+	assert.True(t, isETagMismatch(s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), ETag: &etag})))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v")}))
+	resp, _ = s.Get(&state.GetRequest{Key: "k"})
+	assert.NotNil(t, resp.ETag)
+}
+
+// memQuerierStore returns all the items for any query
+type memQuerierStore struct {
+	*memStore
+}
+
+func (s *memQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &state.QueryResponse{}
+	for k, v := range s.items {
+		resp.Results = append(resp.Results, state.QueryItem{Key: k, Data: v})
+	}
+	return resp, nil
+}
+
+func TestETagStoreQuery(t *testing.T) {
+	// the envelopes can't be queried
+	_, err := NewETagStore(&memQuerierStore{memStore: newMemStore()}, &ETagConfig{Storage: ETagStorageEnvelope})
+	assert.NotNil(t, err)
+
+	// the etags of the stores querying the values are kept in the companion keys by default
+	for name, storage := range map[string]string{"default": "", "companion": ETagStorageCompanion} {
+		t.Run(name, func(t *testing.T) {
+			inner := &memQuerierStore{memStore: newMemStore()}
+			s, err := NewETagStore(inner, &ETagConfig{Storage: storage})
+			assert.Nil(t, err)
+			q, ok := s.(state.Querier)
+			assert.True(t, ok)
+			assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte(`{"a":1}`)}))
+			got, _ := s.Get(&state.GetRequest{Key: "k"})
+
+			resp, err := q.Query(&state.QueryRequest{})
+			assert.Nil(t, err)
+			assert.Len(t, resp.Results, 1)
+			assert.Equal(t, "k", resp.Results[0].Key)
+			assert.Equal(t, `{"a":1}`, string(resp.Results[0].Data))
+			assert.Equal(t, *got.ETag, *resp.Results[0].ETag)
+			// the value is stored as it is
+			raw, _ := inner.Get(&state.GetRequest{Key: "k"})
+			assert.Equal(t, `{"a":1}`, string(raw.Data))
+		})
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+const (
+	// snapshotVersion is the version of the format of the snapshots
+	snapshotVersion = 1
+	// snapshotPageSize is the number of keys listed or saved at a time
+	snapshotPageSize = 100
+)
+
+var ErrSnapshotInvalid = errors.New("invalid state snapshot")
+
+// SnapshotRequest is the request to export or import the keys starting with the prefix.
+type SnapshotRequest struct {
+	Prefix   string
+	Metadata map[string]string
+}
+
+// snapshotHeader is the first line of a snapshot
+type snapshotHeader struct {
+	Version int    `json:"version"`
+	Prefix  string `json:"prefix"`
+	// Classification is the fingerprint of the classification policy of the store exported,
+	// the values aren't classified again if they're imported to a store with the same policy
+	Classification string `json:"classification,omitempty"`
+}
+
+// snapshotRecord is a key of a snapshot, whose key is relative to the prefix, so that it can be imported for another app
+type snapshotRecord struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	// ContentType is the content type recorded with the value by the typed values
+	ContentType string `json:"content_type,omitempty"`
+	// ExpireTime is the expire time in RFC3339 recorded with the value by the ttl config of the store
+	ExpireTime string `json:"expire_time,omitempty"`
+}
+
+// Export writes the keys starting with the prefix to w as gzipped json lines, and returns the number of keys exported.
+// The keys are listed from the store wrapped but read through the wrappers, like DeleteByPrefix.
+// The snapshot isn't consistent if the keys are changed during the export.
+func Export(store state.Store, req *SnapshotRequest, w io.Writer) (int, error) {
+	lister, ok := AsKeyLister(store)
+	if !ok {
+		return 0, ErrListKeysNotSupported
+	}
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	classification, _ := classificationOf(store)
+	if err := enc.Encode(&snapshotHeader{Version: snapshotVersion, Prefix: req.Prefix, Classification: classification}); err != nil {
+		return 0, err
+	}
+	count := 0
+	after := ""
+	for {
+		keys, err := lister.ListKeys(&ListKeysRequest{Prefix: req.Prefix, After: after, Limit: snapshotPageSize, Metadata: req.Metadata})
+		if err != nil {
+			return count, err
+		}
+		for _, k := range keys {
+			// the etags aren't exported, the keys get new ones when they are imported,
+			// and the content types are exported with the values
+			if isCompanionKey(k) || !strings.HasPrefix(k, req.Prefix) {
+				continue
+			}
+			resp, err := store.Get(&state.GetRequest{Key: k, Metadata: req.Metadata})
+			if err != nil {
+				return count, err
+			}
+			// deleted after listed
+			if resp == nil || resp.Data == nil {
+				continue
+			}
+			record := &snapshotRecord{
+				Key:         k[len(req.Prefix):],
+				Value:       resp.Data,
+				ContentType: resp.Metadata[ContentTypeMetadataKey],
+				ExpireTime:  resp.Metadata[TTLExpireTimeMetadataKey],
+			}
+			if err = enc.Encode(record); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(keys) < snapshotPageSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+	return count, zw.Close()
+}
+
+// Import saves the keys of a snapshot written by Export with the prefix of the request, which may be different from
+// the prefix exported, and returns the number of keys imported. The keys are saved through the wrappers in batches,
+// so the keys of the batches saved before an error are kept. The keys with expire times are saved with the ttls left,
+// and the ones expired are skipped.
+func Import(store state.Store, req *SnapshotRequest, r io.Reader) (int, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotInvalid, err)
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(zr)
+	header := &snapshotHeader{}
+	if err = dec.Decode(header); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotInvalid, err)
+	}
+	if header.Version != snapshotVersion {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrSnapshotInvalid, header.Version)
+	}
+	// the values classified by the same policy are written as they are
+	classification, token := classificationOf(store)
+	classified := header.Classification != "" && header.Classification == classification
+	count := 0
+	batch := make([]state.SetRequest, 0, snapshotPageSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.BulkSet(batch); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		record := &snapshotRecord{}
+		if err = dec.Decode(record); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("%w: %v", ErrSnapshotInvalid, err)
+		}
+		if record.Key == "" {
+			return count, fmt.Errorf("%w: empty key", ErrSnapshotInvalid)
+		}
+		metadata := make(map[string]string, len(req.Metadata)+3)
+		for k, v := range req.Metadata {
+			metadata[k] = v
+		}
+		if record.ContentType != "" {
+			metadata[ContentTypeMetadataKey] = record.ContentType
+		}
+		if record.ExpireTime != "" {
+			expireTime, err := time.Parse(time.RFC3339, record.ExpireTime)
+			if err != nil {
+				return count, fmt.Errorf("%w: %v", ErrSnapshotInvalid, err)
+			}
+			ttl := int64(math.Ceil(time.Until(expireTime).Seconds()))
+			if ttl <= 0 {
+				continue
+			}
+			metadata[TTLMetadataKey] = strconv.FormatInt(ttl, 10)
+		}
+		if classified {
+			metadata[classifiedMetadataKey] = token
+		}
+		batch = append(batch, state.SetRequest{Key: req.Prefix + record.Key, Value: record.Value, Metadata: metadata})
+		if len(batch) == snapshotPageSize {
+			if err = flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
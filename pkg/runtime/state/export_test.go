@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	_, err := Export(newMemStore(), &SnapshotRequest{Prefix: "app1||"}, &bytes.Buffer{})
+	assert.Equal(t, ErrListKeysNotSupported, err)
+
+	mem := &listingStore{memStore: newMemStore()}
+	s, _ := NewETagStore(mem, &ETagConfig{Storage: ETagStorageCompanion})
+	// more than a page
+	for i := 0; i < snapshotPageSize+10; i++ {
+		assert.Nil(t, s.Set(&state.SetRequest{Key: fmt.Sprintf("app1||k%d", i), Value: []byte(fmt.Sprintf("v%d", i))}))
+	}
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app2||k0", Value: []byte("other")}))
+
+	buf := &bytes.Buffer{}
+	n, err := Export(s, &SnapshotRequest{Prefix: "app1||"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, snapshotPageSize+10, n)
+
+	// cloned for another app
+	n, err = Import(s, &SnapshotRequest{Prefix: "app3||"}, bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, snapshotPageSize+10, n)
+	for i := 0; i < snapshotPageSize+10; i++ {
+		resp, err := s.Get(&state.GetRequest{Key: fmt.Sprintf("app3||k%d", i)})
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("v%d", i), string(resp.Data))
+		// the imported keys get new etags
+		assert.NotNil(t, resp.ETag)
+	}
+	resp, _ := s.Get(&state.GetRequest{Key: "app3||k0||etag"})
+	assert.NotEmpty(t, resp.Data)
+	resp, _ = s.Get(&state.GetRequest{Key: "app3||app2||k0"})
+	assert.Nil(t, resp.Data)
+}
+
+func TestExportImportTyped(t *testing.T) {
+	s := NewTypedStore(&listingStore{memStore: newMemStore()}, &TypedValuesConfig{})
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app1||json", Value: []byte(`{"a":1}`), Metadata: map[string]string{ContentTypeMetadataKey: ContentTypeJSON}}))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app1||raw", Value: []byte("v")}))
+
+	buf := &bytes.Buffer{}
+	n, err := Export(s, &SnapshotRequest{Prefix: "app1||"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = Import(s, &SnapshotRequest{Prefix: "app2||"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	// the content types are kept
+	resp, _ := s.Get(&state.GetRequest{Key: "app2||json"})
+	assert.Equal(t, `{"a":1}`, string(resp.Data))
+	assert.Equal(t, ContentTypeJSON, resp.Metadata[ContentTypeMetadataKey])
+	resp, _ = s.Get(&state.GetRequest{Key: "app2||raw"})
+	assert.Equal(t, "v", string(resp.Data))
+	assert.Empty(t, resp.Metadata[ContentTypeMetadataKey])
+}
+
+func TestExportImportTTL(t *testing.T) {
+	mem := &listingStore{memStore: newMemStore()}
+	s := NewTTLStore(mem, &TTLConfig{Emulate: true})
+	now := time.Now()
+	s.(*ttlTransactionalStore).now = func() time.Time { return now }
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app1||live", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "3600"}}))
+	// expired by the clock of the import
+	now = now.Add(-time.Hour)
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "app1||expired", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "60"}}))
+
+	buf := &bytes.Buffer{}
+	n, err := Export(s, &SnapshotRequest{Prefix: "app1||"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	now = time.Now()
+	n, err = Import(s, &SnapshotRequest{Prefix: "app2||"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// the ttl left is kept
+	resp, _ := s.Get(&state.GetRequest{Key: "app2||live"})
+	assert.Equal(t, "v", string(resp.Data))
+	expireTime, err := time.Parse(time.RFC3339, resp.Metadata[TTLExpireTimeMetadataKey])
+	assert.Nil(t, err)
+	assert.InDelta(t, now.Add(time.Hour).Unix(), expireTime.Unix(), 2)
+	_, ok := mem.items["app2||expired"]
+	assert.False(t, ok)
+}
+
+func TestExportImportClassified(t *testing.T) {
+	mem := &listingStore{memStore: newMemStore()}
+	policy := &ClassificationConfig{Policy: map[string]string{"pii": ClassificationBlock}}
+	s, err := NewClassifiedStore("mock", mem, testDataClasses, policy)
+	assert.Nil(t, err)
+	// saved before the policy is enabled
+	assert.Nil(t, mem.Set(&state.SetRequest{Key: "app1||k", Value: []byte(`{"ssn":"1"}`)}))
+
+	buf := &bytes.Buffer{}
+	_, err = Export(s, &SnapshotRequest{Prefix: "app1||"}, buf)
+	assert.Nil(t, err)
+	snapshot := buf.Bytes()
+
+	// the values of the same policy aren't classified again
+	n, err := Import(s, &SnapshotRequest{Prefix: "app2||"}, bytes.NewReader(snapshot))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, `{"ssn":"1"}`, string(mem.items["app2||k"]))
+
+	// the other policies are applied
+	other, _ := NewClassifiedStore("mock", mem, testDataClasses, &ClassificationConfig{Policy: map[string]string{"pii": ClassificationBlock, "email": ClassificationMask}})
+	_, err = Import(other, &SnapshotRequest{Prefix: "app3||"}, bytes.NewReader(snapshot))
+	var classified *ClassifiedDataError
+	assert.True(t, errors.As(err, &classified))
+
+	// the marker of the apps is ignored
+	err = s.Set(&state.SetRequest{Key: "app4||k", Value: []byte(`{"ssn":"1"}`), Metadata: map[string]string{classifiedMetadataKey: "guess"}})
+	assert.True(t, errors.As(err, &classified))
+}
+
+func TestImportInvalid(t *testing.T) {
+	s := newMemStore()
+	_, err := Import(s, &SnapshotRequest{Prefix: "app||"}, bytes.NewReader([]byte("not gzipped")))
+	assert.True(t, errors.Is(err, ErrSnapshotInvalid))
+
+	gzipped := func(content string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		w.Write([]byte(content))
+		w.Close()
+		return buf
+	}
+	_, err = Import(s, &SnapshotRequest{Prefix: "app||"}, gzipped(`{"version":2}`))
+	assert.True(t, errors.Is(err, ErrSnapshotInvalid))
+
+	n, err := Import(s, &SnapshotRequest{Prefix: "app||"}, gzipped(`{"version":1}`+"\n"+`{"key":"a","value":"dg=="}`+"\n"+`{"key":""}`))
+	assert.True(t, errors.Is(err, ErrSnapshotInvalid))
+	assert.Equal(t, 0, n)
+	assert.Empty(t, s.items)
+}
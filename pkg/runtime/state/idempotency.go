@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+var ErrIdempotencyNotSupported = errors.New("state store doesn't support atomic set-if-absent")
+
+// IdempotencyRequest is the request to record the processed-marker of a key if it's absent.
+type IdempotencyRequest struct {
+	Key string
+	// Value is the marker, it's the time recorded in RFC3339 if empty
+	Value []byte
+	// TTLInSeconds is the time to live of the marker, it never expires if it's 0
+	TTLInSeconds int64
+	Metadata     map[string]string
+}
+
+// IdempotencyRecorder can be implemented by state stores which support atomic set-if-absent natively,
+// e.g. SET NX in redis or INSERT in sql databases.
+type IdempotencyRecorder interface {
+	// CheckAndRecord sets the marker if the key is absent, and reports whether it's set.
+	// The existing marker is returned if it's not set.
+	CheckAndRecord(req *IdempotencyRequest) (recorded bool, value []byte, err error)
+}
+
+// CheckAndRecord tests and sets the processed-marker of a key atomically by the IdempotencyRecorder of the store,
+// which is found through the wrappers of the runtime. ErrIdempotencyNotSupported is returned if there isn't one,
+// since a read followed by a write can't tell the concurrent callers apart in the stores without conditional creation.
+func CheckAndRecord(store state.Store, req *IdempotencyRequest) (bool, []byte, error) {
+	if len(req.Value) == 0 {
+		req.Value = []byte(time.Now().Format(time.RFC3339))
+	}
+	native, write, ok := findNative(store, func(s state.Store) bool {
+		_, ok := s.(IdempotencyRecorder)
+		return ok
+	})
+	if !ok {
+		return false, nil, ErrIdempotencyNotSupported
+	}
+	var value []byte
+	recorded, err := write(req.Key, func() (recorded bool, err error) {
+		recorded, value, err = native.(IdempotencyRecorder).CheckAndRecord(req)
+		return recorded, err
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return recorded, value, nil
+}
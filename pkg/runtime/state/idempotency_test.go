@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+type nativeIdempotencyStore struct {
+	state.Store
+	markers map[string][]byte
+}
+
+func (s *nativeIdempotencyStore) CheckAndRecord(req *IdempotencyRequest) (bool, []byte, error) {
+	if v, ok := s.markers[req.Key]; ok {
+		return false, v, nil
+	}
+	s.markers[req.Key] = req.Value
+	return true, req.Value, nil
+}
+
+func TestCheckAndRecord(t *testing.T) {
+	t.Run("native", func(t *testing.T) {
+		store := &nativeIdempotencyStore{markers: map[string][]byte{}}
+		recorded, v, err := CheckAndRecord(store, &IdempotencyRequest{Key: "a", Value: []byte("done")})
+		assert.Nil(t, err)
+		assert.True(t, recorded)
+		assert.Equal(t, []byte("done"), v)
+		recorded, v, err = CheckAndRecord(store, &IdempotencyRequest{Key: "a", Value: []byte("again")})
+		assert.Nil(t, err)
+		assert.False(t, recorded)
+		assert.Equal(t, []byte("done"), v)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		// etag isn't enough, since a read followed by a write isn't atomic
+		mockStore := mock_state.NewMockStore(ctrl)
+		_, _, err := CheckAndRecord(mockStore, &IdempotencyRequest{Key: "a"})
+		assert.Equal(t, ErrIdempotencyNotSupported, err)
+	})
+
+	t.Run("through the wrappers", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockStore := mock_state.NewMockStore(ctrl)
+		mockStore.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{}, nil).Times(2)
+		cache := NewCachedStore("mock", &nativeIdempotencyStore{Store: mockStore, markers: map[string][]byte{}}, &CacheConfig{})
+		_, err := cache.Get(&state.GetRequest{Key: "a"})
+		assert.Nil(t, err)
+		recorded, _, err := CheckAndRecord(cache, &IdempotencyRequest{Key: "a"})
+		assert.Nil(t, err)
+		assert.True(t, recorded)
+		// the absence cached is invalidated
+		_, err = cache.Get(&state.GetRequest{Key: "a"})
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,553 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/kit/logger"
+	"github.com/go-sql-driver/mysql"
+	"mosn.io/pkg/utils"
+
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+const (
+	connectionStringKey = "connectionString"
+	tableNameKey        = "tableName"
+	outboxTableNameKey  = "outboxTableName"
+	cleanupIntervalKey  = "cleanupIntervalInSeconds"
+	ttlInSecondsKey     = "ttlInSeconds"
+
+	defaultTableName       = "state"
+	defaultOutboxTableName = "state_outbox"
+	defaultCleanupInterval = time.Hour
+
+	// the error number of duplicate entry
+	errDupEntry = 1062
+	// notExpired is the condition of the rows which are visible
+	notExpired = "(expiration_time IS NULL OR expiration_time > CURRENT_TIMESTAMP)"
+)
+
+var (
+	ErrMissingConnectionString = errors.New("missing connectionString in metadata")
+	ErrInvalidTableName        = errors.New("table name should only contain letters, digits and underscores")
+
+	tableNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+)
+
+// execer is implemented by both sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// MySQL is a state store whose source of truth is MySQL.
+// The etag is the version column which increases on every update, the expired rows are deleted by a cleanup job,
+// and the outbox table is written in the same transaction as the state changes.
+type MySQL struct {
+	db              *sql.DB
+	tableName       string
+	outboxTableName string
+	cleanupInterval time.Duration
+	logger          logger.Logger
+	stopCh          chan struct{}
+	closeOnce       sync.Once
+}
+
+// NewMySQLStateStore returns a new MySQL state store.
+func NewMySQLStateStore(logger logger.Logger) state.Store {
+	return newMySQLStateStore(logger, nil)
+}
+
+// newMySQLStateStore uses the db if it's not nil, which is used in tests
+func newMySQLStateStore(logger logger.Logger, db *sql.DB) *MySQL {
+	return &MySQL{
+		db:     db,
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Init opens the database and creates the tables if they don't exist.
+func (m *MySQL) Init(metadata state.Metadata) error {
+	m.tableName = defaultTableName
+	if v := metadata.Properties[tableNameKey]; v != "" {
+		m.tableName = v
+	}
+	m.outboxTableName = defaultOutboxTableName
+	if v := metadata.Properties[outboxTableNameKey]; v != "" {
+		m.outboxTableName = v
+	}
+	if !tableNameRegexp.MatchString(m.tableName) || !tableNameRegexp.MatchString(m.outboxTableName) {
+		return ErrInvalidTableName
+	}
+	m.cleanupInterval = defaultCleanupInterval
+	if v := metadata.Properties[cleanupIntervalKey]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", cleanupIntervalKey, err)
+		}
+		// the cleanup job is disabled if it's not positive
+		m.cleanupInterval = time.Duration(seconds) * time.Second
+	}
+	if m.db == nil {
+		conn := metadata.Properties[connectionStringKey]
+		if conn == "" {
+			return ErrMissingConnectionString
+		}
+		db, err := sql.Open("mysql", conn)
+		if err != nil {
+			return err
+		}
+		m.db = db
+	}
+	if err := m.db.Ping(); err != nil {
+		return err
+	}
+	if err := m.ensureTables(); err != nil {
+		return err
+	}
+	if m.cleanupInterval > 0 {
+		utils.GoWithRecover(m.cleanupExpired, nil)
+	}
+	return nil
+}
+
+func (m *MySQL) ensureTables() error {
+	_, err := m.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		value MEDIUMBLOB NOT NULL,
+		version BIGINT NOT NULL,
+		expiration_time TIMESTAMP NULL,
+		update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_expiration_time (expiration_time)
+	)`, m.tableName))
+	if err != nil {
+		return err
+	}
+	_, err = m.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		pubsub_name VARCHAR(255) NOT NULL,
+		topic VARCHAR(255) NOT NULL,
+		data MEDIUMBLOB NOT NULL,
+		metadata TEXT,
+		attempts INT NOT NULL DEFAULT 0,
+		lease_owner VARCHAR(64) NULL,
+		lease_until TIMESTAMP NULL,
+		dead_letter BOOLEAN NOT NULL DEFAULT FALSE,
+		create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_dead_letter_id (dead_letter, id)
+	)`, m.outboxTableName))
+	return err
+}
+
+// cleanupExpired deletes the expired rows periodically, they're invisible even if they aren't deleted yet
+func (m *MySQL) cleanupExpired() {
+	ticker := time.NewTicker(m.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+		res, err := m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expiration_time IS NOT NULL AND expiration_time <= CURRENT_TIMESTAMP", m.tableName))
+		if err != nil {
+			m.logger.Errorf("[mysql] cleanup expired state error: %v", err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			m.logger.Debugf("[mysql] %d expired state deleted", n)
+		}
+	}
+}
+
+// Features returns the features supported by the store.
+func (m *MySQL) Features() []state.Feature {
+	return []state.Feature{state.FeatureETag, state.FeatureTransactional}
+}
+
+// Get returns an empty response if the key doesn't exist or it's expired.
+func (m *MySQL) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	if req.Key == "" {
+		return nil, errors.New("missing key in get operation")
+	}
+	var (
+		value   []byte
+		version int64
+	)
+	err := m.db.QueryRow(fmt.Sprintf("SELECT value, version FROM %s WHERE id = ? AND %s", m.tableName, notExpired), req.Key).Scan(&value, &version)
+	if err == sql.ErrNoRows {
+		return &state.GetResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	etag := strconv.FormatInt(version, 10)
+	return &state.GetResponse{Data: value, ETag: &etag}, nil
+}
+
+// BulkGet isn't supported natively, so the keys are got one by one by the runtime.
+func (m *MySQL) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	return false, nil, nil
+}
+
+func (m *MySQL) Set(req *state.SetRequest) error {
+	return m.set(m.db, req)
+}
+
+func (m *MySQL) set(db execer, req *state.SetRequest) error {
+	if req.Key == "" {
+		return errors.New("missing key in set operation")
+	}
+	value, err := marshal(req.Value)
+	if err != nil {
+		return err
+	}
+	ttl, err := parseTTL(req.Metadata)
+	if err != nil {
+		return err
+	}
+	expiration := "DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND)"
+	if req.ETag != nil && *req.ETag != "" {
+		version, err := strconv.ParseInt(*req.ETag, 10, 64)
+		if err != nil {
+			return state.NewETagError(state.ETagInvalid, err)
+		}
+		res, err := db.Exec(fmt.Sprintf("UPDATE %s SET value = ?, version = version + 1, expiration_time = %s WHERE id = ? AND version = ? AND %s",
+			m.tableName, expiration, notExpired), value, ttl, req.Key, version)
+		if err != nil {
+			return err
+		}
+		return checkAffected(res)
+	}
+	if req.Options.Concurrency == state.FirstWrite {
+		// the key shouldn't exist without etag, but the expired one can be replaced
+		if _, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ? AND expiration_time <= CURRENT_TIMESTAMP", m.tableName), req.Key); err != nil {
+			return err
+		}
+		_, err = db.Exec(fmt.Sprintf("INSERT INTO %s (id, value, version, expiration_time) VALUES (?, ?, 1, %s)", m.tableName, expiration),
+			req.Key, value, ttl)
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == errDupEntry {
+			return state.NewETagError(state.ETagMismatch, err)
+		}
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s (id, value, version, expiration_time) VALUES (?, ?, 1, %s)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), version = version + 1, expiration_time = VALUES(expiration_time)`, m.tableName, expiration),
+		req.Key, value, ttl)
+	return err
+}
+
+// BulkSet saves the states in a transaction.
+func (m *MySQL) BulkSet(req []state.SetRequest) error {
+	return m.transaction(func(tx *sql.Tx) error {
+		for i := range req {
+			if err := m.set(tx, &req[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *MySQL) Delete(req *state.DeleteRequest) error {
+	return m.delete(m.db, req)
+}
+
+func (m *MySQL) delete(db execer, req *state.DeleteRequest) error {
+	if req.Key == "" {
+		return errors.New("missing key in delete operation")
+	}
+	if req.ETag != nil && *req.ETag != "" {
+		version, err := strconv.ParseInt(*req.ETag, 10, 64)
+		if err != nil {
+			return state.NewETagError(state.ETagInvalid, err)
+		}
+		res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ? AND version = ?", m.tableName), req.Key, version)
+		if err != nil {
+			return err
+		}
+		return checkAffected(res)
+	}
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", m.tableName), req.Key)
+	return err
+}
+
+// BulkDelete deletes the states in a transaction.
+func (m *MySQL) BulkDelete(req []state.DeleteRequest) error {
+	return m.transaction(func(tx *sql.Tx) error {
+		for i := range req {
+			if err := m.delete(tx, &req[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Multi executes the operations in a transaction, and saves the messages carried by its metadata in the outbox.
+func (m *MySQL) Multi(req *state.TransactionalStateRequest) error {
+	messages, err := runtime_state.OutboxFromMetadata(req.Metadata)
+	if err != nil {
+		return err
+	}
+	return m.MultiWithOutbox(req, messages)
+}
+
+// MultiWithOutbox implements runtime_state.OutboxStore, the messages are saved in the outbox table
+// in the same transaction as the operations.
+func (m *MySQL) MultiWithOutbox(req *state.TransactionalStateRequest, messages []*runtime_state.OutboxMessage) error {
+	return m.transaction(func(tx *sql.Tx) error {
+		for _, o := range req.Operations {
+			switch o.Operation {
+			case state.Upsert:
+				r, ok := o.Request.(state.SetRequest)
+				if !ok {
+					return fmt.Errorf("expecting set request")
+				}
+				if err := m.set(tx, &r); err != nil {
+					return err
+				}
+			case state.Delete:
+				r, ok := o.Request.(state.DeleteRequest)
+				if !ok {
+					return fmt.Errorf("expecting delete request")
+				}
+				if err := m.delete(tx, &r); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported operation: %s", o.Operation)
+			}
+		}
+		for _, msg := range messages {
+			metadata, err := json.Marshal(msg.Metadata)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (pubsub_name, topic, data, metadata) VALUES (?, ?, ?, ?)", m.outboxTableName),
+				msg.PubsubName, msg.Topic, msg.Data, string(metadata))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CheckAndRecord implements runtime_state.IdempotencyRecorder, the marker is inserted only if the key is absent.
+func (m *MySQL) CheckAndRecord(req *runtime_state.IdempotencyRequest) (bool, []byte, error) {
+	metadata := map[string]string{}
+	if req.TTLInSeconds > 0 {
+		metadata[ttlInSecondsKey] = strconv.FormatInt(req.TTLInSeconds, 10)
+	}
+	err := m.set(m.db, &state.SetRequest{
+		Key:      req.Key,
+		Value:    req.Value,
+		Metadata: metadata,
+		Options:  state.SetStateOption{Concurrency: state.FirstWrite},
+	})
+	if err == nil {
+		return true, req.Value, nil
+	}
+	if e, ok := err.(*state.ETagError); !ok || e.Kind() != state.ETagMismatch {
+		return false, nil, err
+	}
+	// the key exists, return the marker recorded before
+	resp, err := m.Get(&state.GetRequest{Key: req.Key})
+	if err != nil {
+		return false, nil, err
+	}
+	return false, resp.Data, nil
+}
+
+// ListKeys implements runtime_state.KeyLister.
+func (m *MySQL) ListKeys(req *runtime_state.ListKeysRequest) ([]string, error) {
+	rows, err := m.db.Query(fmt.Sprintf("SELECT id FROM %s WHERE id LIKE ? AND id > ? AND %s ORDER BY id LIMIT ?", m.tableName, notExpired),
+		runtime_state.LikePrefixPattern(req.Prefix), req.After, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ClaimOutbox implements runtime_state.OutboxStore, the rows are locked while they're claimed,
+// so that the relays sharing the table claim them one by one.
+func (m *MySQL) ClaimOutbox(owner string, limit int, lease time.Duration) ([]*runtime_state.OutboxMessage, error) {
+	var messages []*runtime_state.OutboxMessage
+	err := m.transaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, pubsub_name, topic, data, metadata, attempts, lease_owner, lease_until > CURRENT_TIMESTAMP
+			FROM %s WHERE dead_letter = FALSE ORDER BY id LIMIT ? FOR UPDATE`, m.outboxTableName), limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			msg := &runtime_state.OutboxMessage{}
+			var (
+				metadata   sql.NullString
+				leaseOwner sql.NullString
+				leased     sql.NullBool
+			)
+			if err = rows.Scan(&msg.ID, &msg.PubsubName, &msg.Topic, &msg.Data, &metadata, &msg.Attempts, &leaseOwner, &leased); err != nil {
+				return err
+			}
+			// the messages after the one leased to another relay are left to it
+			if leased.Valid && leased.Bool && leaseOwner.String != owner {
+				break
+			}
+			if metadata.Valid && metadata.String != "" {
+				if err = json.Unmarshal([]byte(metadata.String), &msg.Metadata); err != nil {
+					return err
+				}
+			}
+			messages = append(messages, msg)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(messages) == 0 {
+			return nil
+		}
+		ids := make([]int64, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		placeholders, args := inClause(ids)
+		args = append([]interface{}{owner, int64(math.Ceil(lease.Seconds()))}, args...)
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET lease_owner = ?, lease_until = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE id IN (%s)",
+			m.outboxTableName, placeholders), args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteOutbox implements runtime_state.OutboxStore.
+func (m *MySQL) DeleteOutbox(owner string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders, args := inClause(ids)
+	_, err := m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (%s) AND lease_owner = ?", m.outboxTableName, placeholders), append(args, owner)...)
+	return err
+}
+
+// FailOutbox implements runtime_state.OutboxStore.
+func (m *MySQL) FailOutbox(owner string, id int64, deadLetter bool) error {
+	_, err := m.db.Exec(fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, lease_owner = NULL, lease_until = NULL, dead_letter = ?
+		WHERE id = ? AND lease_owner = ?`, m.outboxTableName), deadLetter, id, owner)
+	return err
+}
+
+// Close stops the cleanup job and closes the database.
+func (m *MySQL) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.stopCh)
+		if m.db != nil {
+			err = m.db.Close()
+		}
+	})
+	return err
+}
+
+// transaction commits the transaction if fn succeeds, otherwise it's rolled back
+func (m *MySQL) transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		if e := tx.Rollback(); e != nil {
+			m.logger.Errorf("[mysql] rollback error: %v", e)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// inClause returns the placeholders and the arguments of the ids in an IN clause
+func inClause(ids []int64) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// checkAffected returns an etag mismatch error if no row is affected
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return state.NewETagError(state.ETagMismatch, nil)
+	}
+	return nil
+}
+
+// parseTTL returns null if the state never expires
+func parseTTL(metadata map[string]string) (sql.NullInt64, error) {
+	v, ok := metadata[ttlInSecondsKey]
+	if !ok || v == "" {
+		return sql.NullInt64{}, nil
+	}
+	ttl, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("invalid %s: %v", ttlInSecondsKey, err)
+	}
+	// -1 means never expire
+	if ttl <= 0 {
+		return sql.NullInt64{}, nil
+	}
+	return sql.NullInt64{Int64: ttl, Valid: true}, nil
+}
+
+func marshal(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return json.Marshal(value)
+}
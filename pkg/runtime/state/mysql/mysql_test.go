@@ -0,0 +1,223 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mysql
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/kit/logger"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+func newTestStore(t *testing.T) (*MySQL, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	m := newMySQLStateStore(logger.NewLogger("test"), db)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS state ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS state_outbox ").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = m.Init(state.Metadata{Properties: map[string]string{cleanupIntervalKey: "0"}})
+	assert.Nil(t, err)
+	return m, mock
+}
+
+func TestInit(t *testing.T) {
+	m := NewMySQLStateStore(logger.NewLogger("test"))
+	err := m.Init(state.Metadata{Properties: map[string]string{}})
+	assert.Equal(t, ErrMissingConnectionString, err)
+	err = m.Init(state.Metadata{Properties: map[string]string{tableNameKey: "state;drop"}})
+	assert.Equal(t, ErrInvalidTableName, err)
+	err = m.Init(state.Metadata{Properties: map[string]string{cleanupIntervalKey: "1h"}})
+	assert.NotNil(t, err)
+
+	store, mock := newTestStore(t)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.True(t, state.FeatureETag.IsPresent(store.Features()))
+	assert.True(t, state.FeatureTransactional.IsPresent(store.Features()))
+	mock.ExpectClose()
+	assert.Nil(t, store.Close())
+}
+
+func TestGet(t *testing.T) {
+	m, mock := newTestStore(t)
+	mock.ExpectQuery("SELECT value, version FROM state WHERE id = ").WithArgs("k").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "version"}).AddRow([]byte("v"), 3))
+	resp, err := m.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(resp.Data))
+	assert.Equal(t, "3", *resp.ETag)
+
+	mock.ExpectQuery("SELECT value, version FROM state WHERE id = ").WithArgs("absent").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "version"}))
+	resp, err = m.Get(&state.GetRequest{Key: "absent"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+	assert.Nil(t, resp.ETag)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSet(t *testing.T) {
+	m, mock := newTestStore(t)
+	mock.ExpectExec("INSERT INTO state .* ON DUPLICATE KEY UPDATE").WithArgs("k", []byte("v"), int64(60)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err := m.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{ttlInSecondsKey: "60"}})
+	assert.Nil(t, err)
+
+	etag := "3"
+	mock.ExpectExec("UPDATE state SET value = ").WithArgs([]byte("v"), nil, "k", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = m.Set(&state.SetRequest{Key: "k", Value: []byte("v"), ETag: &etag})
+	var etagErr *state.ETagError
+	assert.True(t, errors.As(err, &etagErr))
+	assert.Equal(t, state.ETagMismatch, etagErr.Kind())
+
+	invalid := "v1"
+	err = m.Set(&state.SetRequest{Key: "k", Value: []byte("v"), ETag: &invalid})
+	assert.True(t, errors.As(err, &etagErr))
+	assert.Equal(t, state.ETagInvalid, etagErr.Kind())
+
+	mock.ExpectExec("DELETE FROM state WHERE id = ").WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO state ").WithArgs("k", []byte("v"), nil).WillReturnError(&mysql.MySQLError{Number: errDupEntry})
+	err = m.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Options: state.SetStateOption{Concurrency: state.FirstWrite}})
+	assert.True(t, errors.As(err, &etagErr))
+	assert.Equal(t, state.ETagMismatch, etagErr.Kind())
+
+	err = m.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{ttlInSecondsKey: "1m"}})
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDelete(t *testing.T) {
+	m, mock := newTestStore(t)
+	mock.ExpectExec("DELETE FROM state WHERE id = ").WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, m.Delete(&state.DeleteRequest{Key: "k"}))
+
+	etag := "2"
+	mock.ExpectExec("DELETE FROM state WHERE id = .* AND version = ").WithArgs("k", int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, m.Delete(&state.DeleteRequest{Key: "k", ETag: &etag}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckAndRecord(t *testing.T) {
+	m, mock := newTestStore(t)
+	mock.ExpectExec("DELETE FROM state WHERE id = ").WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO state ").WithArgs("k", []byte("done"), int64(60)).WillReturnResult(sqlmock.NewResult(0, 1))
+	recorded, v, err := m.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("done"), TTLInSeconds: 60})
+	assert.Nil(t, err)
+	assert.True(t, recorded)
+	assert.Equal(t, "done", string(v))
+
+	mock.ExpectExec("DELETE FROM state WHERE id = ").WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO state ").WithArgs("k", []byte("again"), nil).WillReturnError(&mysql.MySQLError{Number: errDupEntry})
+	mock.ExpectQuery("SELECT value, version FROM state WHERE id = ").WithArgs("k").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "version"}).AddRow([]byte("done"), 1))
+	recorded, v, err = m.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("again")})
+	assert.Nil(t, err)
+	assert.False(t, recorded)
+	assert.Equal(t, "done", string(v))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListKeys(t *testing.T) {
+	m, mock := newTestStore(t)
+	mock.ExpectQuery("SELECT id FROM state WHERE id LIKE .* AND id > .* ORDER BY id LIMIT ").WithArgs(`app||tenant\_1%`, "", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("app||tenant_1:a").AddRow("app||tenant_1:b"))
+	keys, err := m.ListKeys(&runtime_state.ListKeysRequest{Prefix: "app||tenant_1", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app||tenant_1:a", "app||tenant_1:b"}, keys)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMultiWithOutbox(t *testing.T) {
+	m, mock := newTestStore(t)
+	req := &state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: []byte("v")}},
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "k2"}},
+	}}
+	messages := []*runtime_state.OutboxMessage{{PubsubName: "mq", Topic: "orders", Data: []byte("created"), Metadata: map[string]string{"k": "v"}}}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO state ").WithArgs("k1", []byte("v"), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM state WHERE id = ").WithArgs("k2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO state_outbox ").WithArgs("mq", "orders", []byte("created"), `{"k":"v"}`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, m.MultiWithOutbox(req, messages))
+
+	// the transaction is rolled back if any operation fails
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO state ").WillReturnError(errors.New("timeout"))
+	mock.ExpectRollback()
+	assert.NotNil(t, m.Multi(req))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMultiWithOutboxMetadata(t *testing.T) {
+	m, mock := newTestStore(t)
+	metadata, err := runtime_state.WithOutbox(nil, []*runtime_state.OutboxMessage{{PubsubName: "mq", Topic: "orders", Data: []byte("created")}})
+	assert.Nil(t, err)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO state ").WithArgs("k1", []byte("v"), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO state_outbox ").WithArgs("mq", "orders", []byte("created"), "null").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, m.Multi(&state.TransactionalStateRequest{
+		Operations: []state.TransactionalStateOperation{{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: []byte("v")}}},
+		Metadata:   metadata,
+	}))
+	assert.NotNil(t, m.Multi(&state.TransactionalStateRequest{Metadata: map[string]string{runtime_state.OutboxMetadataKey: "{"}}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestOutbox(t *testing.T) {
+	m, mock := newTestStore(t)
+	columns := []string{"id", "pubsub_name", "topic", "data", "metadata", "attempts", "lease_owner", "leased"}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, pubsub_name, topic, data, metadata, attempts, lease_owner, lease_until > CURRENT_TIMESTAMP").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "mq", "orders", []byte("created"), `{"k":"v"}`, 0, nil, nil).
+			AddRow(2, "mq", "orders", []byte("paid"), nil, 2, "me", true).
+			AddRow(3, "mq", "orders", []byte("shipped"), nil, 0, "other", true))
+	mock.ExpectExec("UPDATE state_outbox SET lease_owner = ").WithArgs("me", int64(30), int64(1), int64(2)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	// the message leased to another relay and the ones after it aren't claimed
+	messages, err := m.ClaimOutbox("me", 10, 30*time.Second)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, int64(1), messages[0].ID)
+	assert.Equal(t, map[string]string{"k": "v"}, messages[0].Metadata)
+	assert.Equal(t, "paid", string(messages[1].Data))
+	assert.Equal(t, 2, messages[1].Attempts)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, pubsub_name").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "mq", "orders", []byte("created"), nil, 0, "other", true))
+	mock.ExpectCommit()
+	messages, err = m.ClaimOutbox("me", 10, 30*time.Second)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 0)
+
+	mock.ExpectExec("DELETE FROM state_outbox WHERE id IN").WithArgs(int64(1), int64(2), "me").WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.Nil(t, m.DeleteOutbox("me", []int64{1, 2}))
+	assert.Nil(t, m.DeleteOutbox("me", nil))
+	mock.ExpectExec("UPDATE state_outbox SET attempts = attempts \\+ 1").WithArgs(true, int64(3), "me").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, m.FailOutbox("me", 3, true))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/state"
+	"github.com/google/uuid"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+)
+
+const (
+	// OutboxMetadataKey is the metadata of a transaction carrying the messages saved in the outbox with it,
+	// so that they pass through the wrappers of the store to the OutboxStore.
+	OutboxMetadataKey = "layotto.outbox"
+
+	defaultOutboxInterval    = time.Second
+	defaultOutboxBatchSize   = 100
+	defaultOutboxLease       = 30 * time.Second
+	defaultOutboxMaxAttempts = 10
+)
+
+var ErrOutboxNotSupported = errors.New("state store doesn't support outbox")
+
+// OutboxMessage is saved in the outbox of the state store with the state changes,
+// and it's published by the OutboxRelay after the transaction is committed.
+type OutboxMessage struct {
+	// ID is assigned by the store, which increases in the order of saving
+	ID         int64             `json:"-"`
+	PubsubName string            `json:"pubsubName"`
+	Topic      string            `json:"topic"`
+	Data       []byte            `json:"data,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// Attempts is the number of the failed attempts of publishing the message
+	Attempts int `json:"-"`
+}
+
+// OutboxStore is implemented by the transactional stores with an outbox table,
+// so that the state changes and the messages are saved atomically, which is the base of transactional publishing.
+// Its Multi saves the messages carried by the metadata OutboxMetadataKey, see WithOutbox.
+type OutboxStore interface {
+	// MultiWithOutbox executes the operations and saves the messages in one transaction.
+	MultiWithOutbox(req *state.TransactionalStateRequest, messages []*OutboxMessage) error
+	// ClaimOutbox leases at most limit messages to the owner in the order of saving until the lease expires,
+	// the dead letters are skipped. The messages from the first one leased to another owner aren't claimed,
+	// so that the relays sharing the outbox don't publish the messages concurrently or out of order.
+	ClaimOutbox(owner string, limit int, lease time.Duration) ([]*OutboxMessage, error)
+	// DeleteOutbox removes the messages leased to the owner which are published.
+	DeleteOutbox(owner string, ids []int64) error
+	// FailOutbox increases the attempts of the message leased to the owner and releases it.
+	// The message is kept as a dead letter if deadLetter is true, which is never claimed again.
+	FailOutbox(owner string, id int64, deadLetter bool) error
+}
+
+// AsOutboxStore returns the OutboxStore in the chain of the wrappers
+func AsOutboxStore(store state.Store) (OutboxStore, bool) {
+	for store != nil {
+		if o, ok := store.(OutboxStore); ok {
+			return o, true
+		}
+		w, ok := store.(Wrapper)
+		if !ok {
+			break
+		}
+		store = w.Unwrap()
+	}
+	return nil, false
+}
+
+// WithOutbox returns a copy of the metadata of a transaction carrying the messages,
+// which are saved in the outbox by the OutboxStore executing the transaction.
+func WithOutbox(metadata map[string]string, messages []*OutboxMessage) (map[string]string, error) {
+	res := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		res[k] = v
+	}
+	delete(res, OutboxMetadataKey)
+	if len(messages) == 0 {
+		return res, nil
+	}
+	b, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	res[OutboxMetadataKey] = string(b)
+	return res, nil
+}
+
+// OutboxFromMetadata returns the messages carried by the metadata of a transaction
+func OutboxFromMetadata(metadata map[string]string) ([]*OutboxMessage, error) {
+	v := metadata[OutboxMetadataKey]
+	if v == "" {
+		return nil, nil
+	}
+	var messages []*OutboxMessage
+	if err := json.Unmarshal([]byte(v), &messages); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", OutboxMetadataKey, err)
+	}
+	return messages, nil
+}
+
+// OutboxConfig is the config of relaying the messages in the outbox.
+type OutboxConfig struct {
+	// IntervalMs is the interval of polling the outbox, the default value is 1000.
+	IntervalMs int `json:"interval_ms"`
+	// BatchSize is the max number of messages relayed in a round, the default value is 100.
+	BatchSize int `json:"batch_size"`
+	// LeaseMs is how long the messages claimed by a relay are hidden from the others, the default value is 30000.
+	// It should be longer than publishing a batch.
+	LeaseMs int `json:"lease_ms"`
+	// MaxAttempts is the number of the failures after which a message is kept as a dead letter, the default value is 10.
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// OutboxRelay publishes the messages in the outbox periodically.
+// The messages are published at least once and in order: the relay claims a batch of messages with a lease,
+// so that the relays of the sidecars sharing the store take turns, and it stops at the first failure of a round
+// and retries it in the next round. A message failing MaxAttempts times is kept as a dead letter and skipped.
+type OutboxRelay struct {
+	storeName   string
+	store       OutboxStore
+	pubsubs     map[string]pubsub.PubSub
+	owner       string
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewOutboxRelay creates the relay of the store, which publishes the messages to the pubsubs by their names.
+func NewOutboxRelay(storeName string, store OutboxStore, pubsubs map[string]pubsub.PubSub, config *OutboxConfig) *OutboxRelay {
+	r := &OutboxRelay{
+		storeName:   storeName,
+		store:       store,
+		pubsubs:     pubsubs,
+		owner:       uuid.New().String(),
+		interval:    defaultOutboxInterval,
+		batchSize:   defaultOutboxBatchSize,
+		lease:       defaultOutboxLease,
+		maxAttempts: defaultOutboxMaxAttempts,
+		stopCh:      make(chan struct{}),
+	}
+	if config == nil {
+		return r
+	}
+	if config.IntervalMs > 0 {
+		r.interval = time.Duration(config.IntervalMs) * time.Millisecond
+	}
+	if config.BatchSize > 0 {
+		r.batchSize = config.BatchSize
+	}
+	if config.LeaseMs > 0 {
+		r.lease = time.Duration(config.LeaseMs) * time.Millisecond
+	}
+	if config.MaxAttempts > 0 {
+		r.maxAttempts = config.MaxAttempts
+	}
+	return r
+}
+
+// Start relays the messages in background until Stop is called.
+func (r *OutboxRelay) Start() {
+	utils.GoWithRecover(r.run, nil)
+}
+
+// Stop stops relaying, the messages left are relayed after restart.
+func (r *OutboxRelay) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+func (r *OutboxRelay) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+		}
+		// keep relaying until the outbox is drained
+		for {
+			n, err := r.Relay()
+			if err != nil {
+				log.DefaultLogger.Errorf("[runtime] [state.outbox] relay messages of store %s error: %v", r.storeName, err)
+				break
+			}
+			if n < r.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// Relay claims a batch of messages, publishes them and removes them from the outbox,
+// it returns the number of messages handled, including the ones kept as dead letters.
+func (r *OutboxRelay) Relay() (int, error) {
+	messages, err := r.store.ClaimOutbox(r.owner, r.batchSize, r.lease)
+	if err != nil {
+		return 0, err
+	}
+	published := make([]int64, 0, len(messages))
+	handled := 0
+	for _, msg := range messages {
+		if err = r.publish(msg); err == nil {
+			published = append(published, msg.ID)
+			handled++
+			continue
+		}
+		deadLetter := msg.Attempts+1 >= r.maxAttempts
+		if e := r.store.FailOutbox(r.owner, msg.ID, deadLetter); e != nil {
+			log.DefaultLogger.Errorf("[runtime] [state.outbox] record failure of message %d of store %s error: %v", msg.ID, r.storeName, e)
+			break
+		}
+		if !deadLetter {
+			break
+		}
+		log.DefaultLogger.Errorf("[runtime] [state.outbox] message %d of store %s is kept as a dead letter after %d attempts: %v",
+			msg.ID, r.storeName, msg.Attempts+1, err)
+		err = nil
+		handled++
+	}
+	if len(published) > 0 {
+		if e := r.store.DeleteOutbox(r.owner, published); e != nil {
+			return 0, e
+		}
+	}
+	return handled, err
+}
+
+func (r *OutboxRelay) publish(msg *OutboxMessage) error {
+	ps, ok := r.pubsubs[msg.PubsubName]
+	if !ok {
+		return fmt.Errorf("pubsub %s of message %d not found", msg.PubsubName, msg.ID)
+	}
+	return ps.Publish(&pubsub.PublishRequest{
+		Data:       msg.Data,
+		PubsubName: msg.PubsubName,
+		Topic:      msg.Topic,
+		Metadata:   msg.Metadata,
+	})
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_pubsub "mosn.io/layotto/pkg/mock/components/pubsub"
+)
+
+type memOutboxStore struct {
+	messages []*OutboxMessage
+	dead     []*OutboxMessage
+	owners   map[int64]string
+}
+
+func (s *memOutboxStore) MultiWithOutbox(req *state.TransactionalStateRequest, messages []*OutboxMessage) error {
+	for _, msg := range messages {
+		msg.ID = int64(len(s.messages) + len(s.dead) + 1)
+		s.messages = append(s.messages, msg)
+	}
+	return nil
+}
+
+func (s *memOutboxStore) ClaimOutbox(owner string, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	if s.owners == nil {
+		s.owners = make(map[int64]string)
+	}
+	var claimed []*OutboxMessage
+	for _, msg := range s.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if o, ok := s.owners[msg.ID]; ok && o != owner {
+			break
+		}
+		s.owners[msg.ID] = owner
+		claimed = append(claimed, msg)
+	}
+	return claimed, nil
+}
+
+func (s *memOutboxStore) DeleteOutbox(owner string, ids []int64) error {
+	s.remove(ids...)
+	return nil
+}
+
+func (s *memOutboxStore) FailOutbox(owner string, id int64, deadLetter bool) error {
+	delete(s.owners, id)
+	for _, msg := range s.messages {
+		if msg.ID == id {
+			msg.Attempts++
+			if deadLetter {
+				s.dead = append(s.dead, msg)
+				s.remove(id)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memOutboxStore) remove(ids ...int64) {
+	removed := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+		delete(s.owners, id)
+	}
+	messages := s.messages[:0]
+	for _, msg := range s.messages {
+		if !removed[msg.ID] {
+			messages = append(messages, msg)
+		}
+	}
+	s.messages = messages
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ps := mock_pubsub.NewMockPubSub(ctrl)
+	store := &memOutboxStore{}
+	store.MultiWithOutbox(nil, []*OutboxMessage{
+		{PubsubName: "mq", Topic: "orders", Data: []byte("1")},
+		{PubsubName: "mq", Topic: "orders", Data: []byte("2")},
+		{PubsubName: "mq", Topic: "orders", Data: []byte("3")},
+	})
+	relay := NewOutboxRelay("mysql", store, map[string]pubsub.PubSub{"mq": ps}, &OutboxConfig{BatchSize: 2, MaxAttempts: 2})
+
+	var published []string
+	ps.EXPECT().Publish(gomock.Any()).DoAndReturn(func(req *pubsub.PublishRequest) error {
+		published = append(published, string(req.Data))
+		return nil
+	}).Times(2)
+	n, err := relay.Relay()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"1", "2"}, published)
+	assert.Len(t, store.messages, 1)
+
+	// the failed message is kept in the outbox
+	ps.EXPECT().Publish(gomock.Any()).Return(errors.New("timeout"))
+	n, err = relay.Relay()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, store.messages, 1)
+	assert.Equal(t, 1, store.messages[0].Attempts)
+
+	// the messages claimed by another relay are skipped
+	other := NewOutboxRelay("mysql", store, map[string]pubsub.PubSub{"mq": ps}, nil)
+	store.ClaimOutbox(other.owner, 1, time.Minute)
+	n, err = relay.Relay()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	delete(store.owners, store.messages[0].ID)
+
+	// the message is kept as a dead letter after max attempts, and the next one is published
+	store.MultiWithOutbox(nil, []*OutboxMessage{{PubsubName: "absent", Topic: "orders"}})
+	ps.EXPECT().Publish(gomock.Any()).Return(errors.New("timeout"))
+	n, err = relay.Relay()
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, store.dead, 1)
+	assert.Len(t, store.messages, 1)
+	relay.Stop()
+	relay.Stop()
+}
+
+func TestWithOutbox(t *testing.T) {
+	metadata, err := WithOutbox(map[string]string{"a": "b", OutboxMetadataKey: "forged"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, metadata)
+
+	messages := []*OutboxMessage{{PubsubName: "mq", Topic: "orders", Data: []byte("1"), Metadata: map[string]string{"k": "v"}}}
+	metadata, err = WithOutbox(nil, messages)
+	assert.Nil(t, err)
+	got, err := OutboxFromMetadata(metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, messages, got)
+	_, err = OutboxFromMetadata(map[string]string{OutboxMetadataKey: "{"})
+	assert.NotNil(t, err)
+
+	_, ok := AsOutboxStore(NewTTLStore(newMemStore(), &TTLConfig{}))
+	assert.False(t, ok)
+}
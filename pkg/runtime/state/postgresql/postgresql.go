@@ -0,0 +1,462 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/kit/logger"
+	// the pgx driver is registered as "pgx"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"mosn.io/pkg/utils"
+
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+const (
+	connectionStringKey = "connectionString"
+	tableNameKey        = "tableName"
+	cleanupIntervalKey  = "cleanupIntervalInSeconds"
+	ttlInSecondsKey     = "ttlInSeconds"
+
+	defaultTableName       = "state"
+	defaultCleanupInterval = time.Hour
+
+	// notExpired is the condition of the rows which are visible
+	notExpired = "(expiration_time IS NULL OR expiration_time > CURRENT_TIMESTAMP)"
+	// expiration is the expiration time of the ttl in seconds, which is null if the ttl is null
+	expiration = "CURRENT_TIMESTAMP + make_interval(secs => %s)"
+)
+
+var (
+	ErrMissingConnectionString = errors.New("missing connectionString in metadata")
+	ErrInvalidTableName        = errors.New("table name should only contain letters, digits and underscores")
+
+	tableNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+)
+
+// execer is implemented by both sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// PostgreSQL is a state store saving the values as JSONB, so that it can be queried by the State Query API.
+// The equality filters are translated to the containment operator, which is accelerated by the GIN index of the values.
+// The values which aren't JSON are saved as base64 strings, and they can't be queried.
+type PostgreSQL struct {
+	db              *sql.DB
+	tableName       string
+	cleanupInterval time.Duration
+	logger          logger.Logger
+	stopCh          chan struct{}
+	closeOnce       sync.Once
+}
+
+// NewPostgreSQLStateStore returns a new PostgreSQL state store.
+func NewPostgreSQLStateStore(logger logger.Logger) state.Store {
+	return newPostgreSQLStateStore(logger, nil)
+}
+
+// newPostgreSQLStateStore uses the db if it's not nil, which is used in tests
+func newPostgreSQLStateStore(logger logger.Logger, db *sql.DB) *PostgreSQL {
+	return &PostgreSQL{
+		db:     db,
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Init opens the database and creates the table and the index if they don't exist.
+func (p *PostgreSQL) Init(metadata state.Metadata) error {
+	p.tableName = defaultTableName
+	if v := metadata.Properties[tableNameKey]; v != "" {
+		p.tableName = v
+	}
+	if !tableNameRegexp.MatchString(p.tableName) {
+		return ErrInvalidTableName
+	}
+	p.cleanupInterval = defaultCleanupInterval
+	if v := metadata.Properties[cleanupIntervalKey]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", cleanupIntervalKey, err)
+		}
+		// the cleanup job is disabled if it's not positive
+		p.cleanupInterval = time.Duration(seconds) * time.Second
+	}
+	if p.db == nil {
+		conn := metadata.Properties[connectionStringKey]
+		if conn == "" {
+			return ErrMissingConnectionString
+		}
+		db, err := sql.Open("pgx", conn)
+		if err != nil {
+			return err
+		}
+		p.db = db
+	}
+	if err := p.db.Ping(); err != nil {
+		return err
+	}
+	if err := p.ensureTable(); err != nil {
+		return err
+	}
+	if p.cleanupInterval > 0 {
+		utils.GoWithRecover(p.cleanupExpired, nil)
+	}
+	return nil
+}
+
+func (p *PostgreSQL) ensureTable() error {
+	_, err := p.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		key TEXT NOT NULL PRIMARY KEY,
+		value JSONB NOT NULL,
+		isbinary BOOLEAN NOT NULL,
+		version BIGINT NOT NULL,
+		expiration_time TIMESTAMP WITH TIME ZONE NULL,
+		update_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`, p.tableName))
+	if err != nil {
+		return err
+	}
+	// jsonb_path_ops supports the containment operator only, which is smaller and faster than the default one
+	_, err = p.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_value_idx ON %s USING GIN (value jsonb_path_ops)", p.tableName, p.tableName))
+	return err
+}
+
+// cleanupExpired deletes the expired rows periodically, they're invisible even if they aren't deleted yet
+func (p *PostgreSQL) cleanupExpired() {
+	ticker := time.NewTicker(p.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+		}
+		res, err := p.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expiration_time IS NOT NULL AND expiration_time <= CURRENT_TIMESTAMP", p.tableName))
+		if err != nil {
+			p.logger.Errorf("[postgresql] cleanup expired state error: %v", err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			p.logger.Debugf("[postgresql] %d expired state deleted", n)
+		}
+	}
+}
+
+// Features returns the features supported by the store.
+func (p *PostgreSQL) Features() []state.Feature {
+	return []state.Feature{state.FeatureETag, state.FeatureTransactional}
+}
+
+// Get returns an empty response if the key doesn't exist or it's expired.
+func (p *PostgreSQL) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	if req.Key == "" {
+		return nil, errors.New("missing key in get operation")
+	}
+	var (
+		value    []byte
+		isBinary bool
+		version  int64
+	)
+	err := p.db.QueryRow(fmt.Sprintf("SELECT value, isbinary, version FROM %s WHERE key = $1 AND %s", p.tableName, notExpired), req.Key).
+		Scan(&value, &isBinary, &version)
+	if err == sql.ErrNoRows {
+		return &state.GetResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeValue(value, isBinary)
+	if err != nil {
+		return nil, err
+	}
+	etag := strconv.FormatInt(version, 10)
+	return &state.GetResponse{Data: data, ETag: &etag}, nil
+}
+
+// BulkGet isn't supported natively, so the keys are got one by one by the runtime.
+func (p *PostgreSQL) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	return false, nil, nil
+}
+
+func (p *PostgreSQL) Set(req *state.SetRequest) error {
+	return p.set(p.db, req)
+}
+
+func (p *PostgreSQL) set(db execer, req *state.SetRequest) error {
+	if req.Key == "" {
+		return errors.New("missing key in set operation")
+	}
+	value, isBinary, err := encodeValue(req.Value)
+	if err != nil {
+		return err
+	}
+	ttl, err := parseTTL(req.Metadata)
+	if err != nil {
+		return err
+	}
+	if req.ETag != nil && *req.ETag != "" {
+		version, err := strconv.ParseInt(*req.ETag, 10, 64)
+		if err != nil {
+			return state.NewETagError(state.ETagInvalid, err)
+		}
+		res, err := db.Exec(fmt.Sprintf("UPDATE %s SET value = $1::jsonb, isbinary = $2, version = version + 1, expiration_time = %s, update_time = CURRENT_TIMESTAMP WHERE key = $4 AND version = $5 AND %s",
+			p.tableName, fmt.Sprintf(expiration, "$3"), notExpired), value, isBinary, ttl, req.Key, version)
+		if err != nil {
+			return err
+		}
+		return checkAffected(res)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (key, value, isbinary, version, expiration_time) VALUES ($1, $2::jsonb, $3, 1, %s)",
+		p.tableName, fmt.Sprintf(expiration, "$4"))
+	if req.Options.Concurrency == state.FirstWrite {
+		// the key shouldn't exist without etag, but the expired one can be replaced
+		if _, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE key = $1 AND expiration_time <= CURRENT_TIMESTAMP", p.tableName), req.Key); err != nil {
+			return err
+		}
+		res, err := db.Exec(insert+" ON CONFLICT (key) DO NOTHING", req.Key, value, isBinary, ttl)
+		if err != nil {
+			return err
+		}
+		return checkAffected(res)
+	}
+	_, err = db.Exec(insert+fmt.Sprintf(` ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, isbinary = EXCLUDED.isbinary,
+		version = %s.version + 1, expiration_time = EXCLUDED.expiration_time, update_time = CURRENT_TIMESTAMP`, p.tableName),
+		req.Key, value, isBinary, ttl)
+	return err
+}
+
+// BulkSet saves the states in a transaction.
+func (p *PostgreSQL) BulkSet(req []state.SetRequest) error {
+	return p.transaction(func(tx *sql.Tx) error {
+		for i := range req {
+			if err := p.set(tx, &req[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PostgreSQL) Delete(req *state.DeleteRequest) error {
+	return p.delete(p.db, req)
+}
+
+func (p *PostgreSQL) delete(db execer, req *state.DeleteRequest) error {
+	if req.Key == "" {
+		return errors.New("missing key in delete operation")
+	}
+	if req.ETag != nil && *req.ETag != "" {
+		version, err := strconv.ParseInt(*req.ETag, 10, 64)
+		if err != nil {
+			return state.NewETagError(state.ETagInvalid, err)
+		}
+		res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE key = $1 AND version = $2", p.tableName), req.Key, version)
+		if err != nil {
+			return err
+		}
+		return checkAffected(res)
+	}
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE key = $1", p.tableName), req.Key)
+	return err
+}
+
+// BulkDelete deletes the states in a transaction.
+func (p *PostgreSQL) BulkDelete(req []state.DeleteRequest) error {
+	return p.transaction(func(tx *sql.Tx) error {
+		for i := range req {
+			if err := p.delete(tx, &req[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CheckAndRecord implements runtime_state.IdempotencyRecorder, the marker is inserted only if the key is absent.
+func (p *PostgreSQL) CheckAndRecord(req *runtime_state.IdempotencyRequest) (bool, []byte, error) {
+	metadata := map[string]string{}
+	if req.TTLInSeconds > 0 {
+		metadata[ttlInSecondsKey] = strconv.FormatInt(req.TTLInSeconds, 10)
+	}
+	err := p.set(p.db, &state.SetRequest{
+		Key:      req.Key,
+		Value:    req.Value,
+		Metadata: metadata,
+		Options:  state.SetStateOption{Concurrency: state.FirstWrite},
+	})
+	if err == nil {
+		return true, req.Value, nil
+	}
+	if e, ok := err.(*state.ETagError); !ok || e.Kind() != state.ETagMismatch {
+		return false, nil, err
+	}
+	// the key exists, return the marker recorded before
+	resp, err := p.Get(&state.GetRequest{Key: req.Key})
+	if err != nil {
+		return false, nil, err
+	}
+	return false, resp.Data, nil
+}
+
+// ListKeys implements runtime_state.KeyLister.
+func (p *PostgreSQL) ListKeys(req *runtime_state.ListKeysRequest) ([]string, error) {
+	rows, err := p.db.Query(fmt.Sprintf("SELECT key FROM %s WHERE key LIKE $1 AND key > $2 AND %s ORDER BY key LIMIT $3", p.tableName, notExpired),
+		runtime_state.LikePrefixPattern(req.Prefix), req.After, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Multi executes the operations in a transaction.
+func (p *PostgreSQL) Multi(req *state.TransactionalStateRequest) error {
+	return p.transaction(func(tx *sql.Tx) error {
+		for _, o := range req.Operations {
+			switch o.Operation {
+			case state.Upsert:
+				r, ok := o.Request.(state.SetRequest)
+				if !ok {
+					return fmt.Errorf("expecting set request")
+				}
+				if err := p.set(tx, &r); err != nil {
+					return err
+				}
+			case state.Delete:
+				r, ok := o.Request.(state.DeleteRequest)
+				if !ok {
+					return fmt.Errorf("expecting delete request")
+				}
+				if err := p.delete(tx, &r); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported operation: %s", o.Operation)
+			}
+		}
+		return nil
+	})
+}
+
+// Close stops the cleanup job and closes the database.
+func (p *PostgreSQL) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.stopCh)
+		if p.db != nil {
+			err = p.db.Close()
+		}
+	})
+	return err
+}
+
+// transaction commits the transaction if fn succeeds, otherwise it's rolled back
+func (p *PostgreSQL) transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		if e := tx.Rollback(); e != nil {
+			p.logger.Errorf("[postgresql] rollback error: %v", e)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkAffected returns an etag mismatch error if no row is affected
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return state.NewETagError(state.ETagMismatch, nil)
+	}
+	return nil
+}
+
+// parseTTL returns null if the state never expires
+func parseTTL(metadata map[string]string) (sql.NullInt64, error) {
+	v, ok := metadata[ttlInSecondsKey]
+	if !ok || v == "" {
+		return sql.NullInt64{}, nil
+	}
+	ttl, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("invalid %s: %v", ttlInSecondsKey, err)
+	}
+	// -1 means never expire
+	if ttl <= 0 {
+		return sql.NullInt64{}, nil
+	}
+	return sql.NullInt64{Int64: ttl, Valid: true}, nil
+}
+
+// encodeValue returns the JSON saved in the value column, the values which aren't JSON are saved as base64 strings
+func encodeValue(value interface{}) (string, bool, error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", false, err
+		}
+		return string(b), false, nil
+	}
+	if json.Valid(data) {
+		return string(data), false, nil
+	}
+	b, err := json.Marshal(base64.StdEncoding.EncodeToString(data))
+	return string(b), true, err
+}
+
+func decodeValue(value []byte, isBinary bool) ([]byte, error) {
+	if !isBinary {
+		return value, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/kit/logger"
+	"github.com/stretchr/testify/assert"
+
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+func newTestStore(t *testing.T) (*PostgreSQL, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	p := newPostgreSQLStateStore(logger.NewLogger("test"), db)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS state ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE INDEX IF NOT EXISTS state_value_idx ON state USING GIN").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = p.Init(state.Metadata{Properties: map[string]string{cleanupIntervalKey: "0"}})
+	assert.Nil(t, err)
+	return p, mock
+}
+
+func TestInit(t *testing.T) {
+	p := NewPostgreSQLStateStore(logger.NewLogger("test"))
+	err := p.Init(state.Metadata{Properties: map[string]string{}})
+	assert.Equal(t, ErrMissingConnectionString, err)
+	err = p.Init(state.Metadata{Properties: map[string]string{tableNameKey: "state;drop"}})
+	assert.Equal(t, ErrInvalidTableName, err)
+
+	store, mock := newTestStore(t)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.True(t, state.FeatureETag.IsPresent(store.Features()))
+	mock.ExpectClose()
+	assert.Nil(t, store.Close())
+}
+
+func TestGetAndSet(t *testing.T) {
+	p, mock := newTestStore(t)
+	// the values which aren't JSON are saved as base64 strings
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO state (key, value, isbinary, version, expiration_time)")).
+		WithArgs("k", `"aGVsbG8="`, true, int64(60)).WillReturnResult(sqlmock.NewResult(0, 1))
+	err := p.Set(&state.SetRequest{Key: "k", Value: []byte("hello"), Metadata: map[string]string{ttlInSecondsKey: "60"}})
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT value, isbinary, version FROM state WHERE key = $1")).WithArgs("k").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "isbinary", "version"}).AddRow([]byte(`"aGVsbG8="`), true, 2))
+	resp, err := p.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(resp.Data))
+	assert.Equal(t, "2", *resp.ETag)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT value, isbinary, version FROM state WHERE key = $1")).WithArgs("absent").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "isbinary", "version"}))
+	resp, err = p.Get(&state.GetRequest{Key: "absent"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+
+	etag := "2"
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE state SET value = $1::jsonb")).
+		WithArgs(`{"name":"layotto"}`, false, nil, "k", int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = p.Set(&state.SetRequest{Key: "k", Value: []byte(`{"name":"layotto"}`), ETag: &etag})
+	var etagErr *state.ETagError
+	assert.True(t, errors.As(err, &etagErr))
+	assert.Equal(t, state.ETagMismatch, etagErr.Kind())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM state WHERE key = $1 AND expiration_time")).WithArgs("k").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ON CONFLICT \\(key\\) DO NOTHING").WithArgs("k", `{}`, false, nil).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = p.Set(&state.SetRequest{Key: "k", Value: []byte(`{}`), Options: state.SetStateOption{Concurrency: state.FirstWrite}})
+	assert.True(t, errors.As(err, &etagErr))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckAndRecord(t *testing.T) {
+	p, mock := newTestStore(t)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM state WHERE key = $1")).WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO state (key, value, isbinary, version, expiration_time)")).
+		WithArgs("k", `"ZG9uZQ=="`, true, int64(60)).WillReturnResult(sqlmock.NewResult(0, 1))
+	recorded, v, err := p.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("done"), TTLInSeconds: 60})
+	assert.Nil(t, err)
+	assert.True(t, recorded)
+	assert.Equal(t, "done", string(v))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM state WHERE key = $1")).WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO state (key, value, isbinary, version, expiration_time)")).
+		WithArgs("k", `"YWdhaW4="`, true, nil).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT value, isbinary, version FROM state WHERE key = $1")).WithArgs("k").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "isbinary", "version"}).AddRow([]byte(`"ZG9uZQ=="`), true, 1))
+	recorded, v, err = p.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("again")})
+	assert.Nil(t, err)
+	assert.False(t, recorded)
+	assert.Equal(t, "done", string(v))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMulti(t *testing.T) {
+	p, mock := newTestStore(t)
+	req := &state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "k1", Value: []byte(`1`)}},
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "k2"}},
+	}}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO state ")).WithArgs("k1", "1", false, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM state WHERE key = $1")).WithArgs("k2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, p.Multi(req))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO state ")).WillReturnError(errors.New("timeout"))
+	mock.ExpectRollback()
+	assert.NotNil(t, p.Multi(req))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListKeys(t *testing.T) {
+	p, mock := newTestStore(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT key FROM state WHERE key LIKE $1 AND key > $2")).WithArgs(`app||50\%%`, "app||50%:a", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("app||50%:b"))
+	keys, err := p.ListKeys(&runtime_state.ListKeysRequest{Prefix: "app||50%", After: "app||50%:a", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app||50%:b"}, keys)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT key FROM state")).WillReturnError(errors.New("timeout"))
+	_, err = p.ListKeys(&runtime_state.ListKeysRequest{Prefix: "app||", Limit: 10})
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/components-contrib/state/query"
+)
+
+const defaultQueryLimit = 100
+
+var pathElementRegexp = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// Query implements state.Querier.
+// The filters are translated to the containment operator, and the token of the next page is the offset.
+func (p *PostgreSQL) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	q := &queryBuilder{tableName: p.tableName}
+	if err := query.NewQueryBuilder(q).BuildQuery(&req.Query); err != nil {
+		return nil, err
+	}
+	rows, err := p.db.Query(q.query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resp := &state.QueryResponse{}
+	for rows.Next() {
+		var (
+			key      string
+			value    []byte
+			isBinary bool
+			version  int64
+		)
+		if err = rows.Scan(&key, &value, &isBinary, &version); err != nil {
+			return nil, err
+		}
+		item := state.QueryItem{Key: key}
+		etag := strconv.FormatInt(version, 10)
+		item.ETag = &etag
+		if item.Data, err = decodeValue(value, isBinary); err != nil {
+			item.Error = err.Error()
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// there may be more results if the page is full
+	if len(resp.Results) == q.limit {
+		resp.Token = strconv.Itoa(q.offset + q.limit)
+	}
+	return resp, nil
+}
+
+// queryBuilder implements query.Visitor, the values in the filters are passed as arguments
+type queryBuilder struct {
+	tableName string
+	query     string
+	args      []interface{}
+	limit     int
+	offset    int
+}
+
+// VisitEQ uses the containment operator, e.g. {"person.org": "A"} is translated to value @> '{"person":{"org":"A"}}'
+func (q *queryBuilder) VisitEQ(f *query.EQ) (string, error) {
+	path, err := parsePath(f.Key)
+	if err != nil {
+		return "", err
+	}
+	var doc interface{} = f.Val
+	for i := len(path) - 1; i >= 0; i-- {
+		doc = map[string]interface{}{path[i]: doc}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	q.args = append(q.args, string(b))
+	return fmt.Sprintf("value @> $%d::jsonb", len(q.args)), nil
+}
+
+func (q *queryBuilder) VisitIN(f *query.IN) (string, error) {
+	if len(f.Vals) == 0 {
+		return "", fmt.Errorf("empty IN operator for key %q", f.Key)
+	}
+	conditions := make([]string, 0, len(f.Vals))
+	for _, v := range f.Vals {
+		c, err := q.VisitEQ(&query.EQ{Key: f.Key, Val: v})
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, c)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", nil
+}
+
+func (q *queryBuilder) VisitAND(f *query.AND) (string, error) {
+	return q.visitFilters(f.Filters, " AND ")
+}
+
+func (q *queryBuilder) VisitOR(f *query.OR) (string, error) {
+	return q.visitFilters(f.Filters, " OR ")
+}
+
+func (q *queryBuilder) visitFilters(filters []query.Filter, sep string) (string, error) {
+	conditions := make([]string, 0, len(filters))
+	for _, f := range filters {
+		var (
+			c   string
+			err error
+		)
+		switch f := f.(type) {
+		case *query.EQ:
+			c, err = q.VisitEQ(f)
+		case *query.IN:
+			c, err = q.VisitIN(f)
+		case *query.AND:
+			c, err = q.VisitAND(f)
+		case *query.OR:
+			c, err = q.VisitOR(f)
+		default:
+			err = fmt.Errorf("unsupported filter type %#v", f)
+		}
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, c)
+	}
+	return "(" + strings.Join(conditions, sep) + ")", nil
+}
+
+// Finalize builds the statement with the condition of the filters
+func (q *queryBuilder) Finalize(filters string, qq *query.Query) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT key, value, isbinary, version FROM %s WHERE %s", q.tableName, notExpired)
+	if filters != "" {
+		sb.WriteString(" AND ")
+		sb.WriteString(filters)
+	}
+	orders := make([]string, 0, len(qq.Sort)+1)
+	for _, s := range qq.Sort {
+		path, err := parsePath(s.Key)
+		if err != nil {
+			return err
+		}
+		order := "ASC"
+		if strings.EqualFold(s.Order, query.DESC) {
+			order = "DESC"
+		}
+		// the path elements are validated, so it's safe to be a literal
+		orders = append(orders, fmt.Sprintf("value #> '{%s}' %s", strings.Join(path, ","), order))
+	}
+	// the key makes the order stable for paging
+	orders = append(orders, "key ASC")
+	sb.WriteString(" ORDER BY ")
+	sb.WriteString(strings.Join(orders, ", "))
+
+	q.limit = qq.Page.Limit
+	if q.limit <= 0 {
+		q.limit = defaultQueryLimit
+	}
+	if qq.Page.Token != "" {
+		offset, err := strconv.Atoi(qq.Page.Token)
+		if err != nil || offset < 0 {
+			return fmt.Errorf("invalid page token %q", qq.Page.Token)
+		}
+		q.offset = offset
+	}
+	fmt.Fprintf(&sb, " LIMIT %d OFFSET %d", q.limit, q.offset)
+	q.query = sb.String()
+	return nil
+}
+
+// parsePath splits the key by dots, e.g. "person.org" is ["person", "org"]
+func parsePath(key string) ([]string, error) {
+	path := strings.Split(key, ".")
+	for _, e := range path {
+		if !pathElementRegexp.MatchString(e) {
+			return nil, fmt.Errorf("invalid key %q, which should be dot separated letters, digits, underscores and hyphens", key)
+		}
+	}
+	return path, nil
+}
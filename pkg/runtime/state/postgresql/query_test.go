@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/components-contrib/state/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildQuery(t *testing.T, dsl string) (*queryBuilder, error) {
+	var q query.Query
+	assert.Nil(t, json.Unmarshal([]byte(dsl), &q))
+	b := &queryBuilder{tableName: "state"}
+	return b, query.NewQueryBuilder(b).BuildQuery(&q)
+}
+
+func TestQueryBuilder(t *testing.T) {
+	b, err := buildQuery(t, `{
+		"filter": {"AND": [{"EQ": {"person.org": "A"}}, {"IN": {"state": ["CA", "WA"]}}]},
+		"sort": [{"key": "person.id", "order": "DESC"}],
+		"page": {"limit": 2, "token": "4"}
+	}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT key, value, isbinary, version FROM state WHERE "+notExpired+
+		" AND (value @> $1::jsonb AND (value @> $2::jsonb OR value @> $3::jsonb))"+
+		" ORDER BY value #> '{person,id}' DESC, key ASC LIMIT 2 OFFSET 4", b.query)
+	assert.Equal(t, []interface{}{`{"person":{"org":"A"}}`, `{"state":"CA"}`, `{"state":"WA"}`}, b.args)
+
+	b, err = buildQuery(t, `{}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT key, value, isbinary, version FROM state WHERE "+notExpired+
+		" ORDER BY key ASC LIMIT 100 OFFSET 0", b.query)
+
+	_, err = buildQuery(t, `{"sort": [{"key": "id'; drop table state; --"}]}`)
+	assert.NotNil(t, err)
+	_, err = buildQuery(t, `{"page": {"limit": 2, "token": "next"}}`)
+	assert.NotNil(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	p, mock := newTestStore(t)
+	var req state.QueryRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"filter": {"EQ": {"org": "A"}}, "page": {"limit": 2}}`), &req.Query))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT key, value, isbinary, version FROM state WHERE")).WithArgs(`{"org":"A"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "value", "isbinary", "version"}).
+			AddRow("app||1", []byte(`{"org":"A"}`), false, 1).
+			AddRow("app||2", []byte(`"aGVsbG8="`), true, 3))
+	resp, err := p.Query(&req)
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 2)
+	assert.Equal(t, `{"org":"A"}`, string(resp.Results[0].Data))
+	assert.Equal(t, "hello", string(resp.Results[1].Data))
+	assert.Equal(t, "3", *resp.Results[1].ETag)
+	assert.Equal(t, "2", resp.Token)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
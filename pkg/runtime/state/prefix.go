@@ -0,0 +1,171 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+// DefaultDeleteByPrefixMaxKeys is the max number of keys deleted by prefix if it's not specified
+const DefaultDeleteByPrefixMaxKeys = 1000
+
+var (
+	ErrListKeysNotSupported = errors.New("state store doesn't support listing keys")
+	ErrPrefixEmpty          = errors.New("the prefix is empty")
+	ErrPrefixTooManyKeys    = errors.New("too many keys match the prefix")
+
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+// Wrapper is implemented by the wrappers of the state stores in the runtime, e.g. the cache,
+// so that the optional capabilities of the wrapped store can be found
+type Wrapper interface {
+	Unwrap() state.Store
+}
+
+// ListKeysRequest is the request to list the keys starting with the prefix.
+type ListKeysRequest struct {
+	Prefix string
+	// After is the last key of the previous page, the keys are listed from the first one if it's empty
+	After    string
+	Limit    int
+	Metadata map[string]string
+}
+
+// KeyLister can be implemented by state stores which can enumerate their keys.
+type KeyLister interface {
+	// ListKeys returns at most limit keys starting with the prefix and greater than After, in ascending order.
+	ListKeys(req *ListKeysRequest) ([]string, error)
+}
+
+// AsKeyLister returns the KeyLister in the chain of the wrappers
+func AsKeyLister(store state.Store) (KeyLister, bool) {
+	for store != nil {
+		if l, ok := store.(KeyLister); ok {
+			return l, true
+		}
+		w, ok := store.(Wrapper)
+		if !ok {
+			break
+		}
+		store = w.Unwrap()
+	}
+	return nil, false
+}
+
+// nativeWriteTracker is implemented by the wrappers keeping track of the keys written, e.g. the cache and the bloom filter,
+// so that they see the writes of the native operations of the store wrapped, e.g. atomic increment, which bypass the wrappers.
+type nativeWriteTracker interface {
+	// trackNativeWrite runs the write of the key, which reports whether the key is written
+	trackNativeWrite(key string, write func() (bool, error)) (bool, error)
+}
+
+// findNative returns the first store in the chain of the wrappers which matches, and the function running its writes
+// through the wrappers tracking the keys above it.
+// The write-behind wrapper isn't passed through, since the native writes would overtake the writes buffered.
+func findNative(store state.Store, match func(state.Store) bool) (state.Store, func(key string, write func() (bool, error)) (bool, error), bool) {
+	var trackers []nativeWriteTracker
+	for store != nil {
+		if match(store) {
+			return store, func(key string, write func() (bool, error)) (bool, error) {
+				for i := len(trackers) - 1; i >= 0; i-- {
+					t, next := trackers[i], write
+					write = func() (bool, error) {
+						return t.trackNativeWrite(key, next)
+					}
+				}
+				return write()
+			}, true
+		}
+		if _, ok := store.(WriteBehindStore); ok {
+			break
+		}
+		if t, ok := store.(nativeWriteTracker); ok {
+			trackers = append(trackers, t)
+		}
+		w, ok := store.(Wrapper)
+		if !ok {
+			break
+		}
+		store = w.Unwrap()
+	}
+	return nil, nil, false
+}
+
+// DeleteByPrefixRequest is the request to delete the keys starting with the prefix.
+type DeleteByPrefixRequest struct {
+	Prefix string
+	// MaxKeys guards against deleting more keys than expected, DefaultDeleteByPrefixMaxKeys if it's not positive.
+	// The companion keys of the etags and the content types managed by the runtime are counted too.
+	MaxKeys  int
+	Metadata map[string]string
+}
+
+// DeleteByPrefix deletes the keys starting with the prefix, and returns the number of keys deleted.
+// The keys are listed from the store wrapped, but deleted through the wrappers, so that the caches are invalidated
+// and the change events are published. Nothing is deleted if more than MaxKeys keys match the prefix.
+func DeleteByPrefix(store state.Store, req *DeleteByPrefixRequest) (int, error) {
+	if req.Prefix == "" {
+		return 0, ErrPrefixEmpty
+	}
+	lister, ok := AsKeyLister(store)
+	if !ok {
+		return 0, ErrListKeysNotSupported
+	}
+	maxKeys := req.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultDeleteByPrefixMaxKeys
+	}
+	keys, err := lister.ListKeys(&ListKeysRequest{Prefix: req.Prefix, Limit: maxKeys + 1, Metadata: req.Metadata})
+	if err != nil {
+		return 0, err
+	}
+	// the companion keys are counted too, so that the listing isn't truncated
+	if len(keys) > maxKeys {
+		return 0, fmt.Errorf("%w: more than %d", ErrPrefixTooManyKeys, maxKeys)
+	}
+	deletes := make([]state.DeleteRequest, 0, len(keys))
+	for _, k := range keys {
+		// the companion keys of the etags and the content types are deleted with their keys
+		if isCompanionKey(k) {
+			continue
+		}
+		deletes = append(deletes, state.DeleteRequest{Key: k, Metadata: req.Metadata})
+	}
+	if len(deletes) == 0 {
+		return 0, nil
+	}
+	if err = store.BulkDelete(deletes); err != nil {
+		return 0, err
+	}
+	return len(deletes), nil
+}
+
+// isCompanionKey returns whether the key is a companion key managed by the runtime, e.g. the etag of a key
+func isCompanionKey(key string) bool {
+	return strings.HasSuffix(key, etagCompanionSuffix) || strings.HasSuffix(key, typeCompanionSuffix)
+}
+
+// LikePrefixPattern returns the pattern of sql LIKE matching the strings starting with the prefix,
+// whose wildcards are escaped by backslash.
+func LikePrefixPattern(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// listingStore is a memStore which can list its keys
+type listingStore struct {
+	*memStore
+}
+
+func (s *listingStore) ListKeys(req *ListKeysRequest) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.items {
+		if strings.HasPrefix(k, req.Prefix) && k > req.After {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > req.Limit {
+		keys = keys[:req.Limit]
+	}
+	return keys, nil
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	_, err := DeleteByPrefix(newMemStore(), &DeleteByPrefixRequest{Prefix: "a"})
+	assert.Equal(t, ErrListKeysNotSupported, err)
+
+	mem := &listingStore{memStore: newMemStore()}
+	// the store is found through the wrappers
+	s, _ := NewETagStore(mem, &ETagConfig{Storage: ETagStorageCompanion})
+	l, ok := AsKeyLister(s)
+	assert.True(t, ok)
+	assert.Equal(t, mem, l)
+	for _, k := range []string{"app||t1:a", "app||t1:b", "app||t1:c", "app||t2:a"} {
+		assert.Nil(t, s.Set(&state.SetRequest{Key: k, Value: []byte("v")}))
+	}
+
+	_, err = DeleteByPrefix(s, &DeleteByPrefixRequest{})
+	assert.Equal(t, ErrPrefixEmpty, err)
+
+	// nothing is deleted if there are too many keys, including the companion keys of the etags
+	_, err = DeleteByPrefix(s, &DeleteByPrefixRequest{Prefix: "app||t1:", MaxKeys: 5})
+	assert.True(t, errors.Is(err, ErrPrefixTooManyKeys))
+	assert.Len(t, mem.items, 8)
+
+	n, err := DeleteByPrefix(s, &DeleteByPrefixRequest{Prefix: "app||t1:", MaxKeys: 6})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	var keys []string
+	for k := range mem.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// the companion keys of the etags are deleted too
+	assert.Equal(t, []string{"app||t2:a", "app||t2:a||etag"}, keys)
+
+	n, err = DeleteByPrefix(s, &DeleteByPrefixRequest{Prefix: "app||t3:"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestLikePrefixPattern(t *testing.T) {
+	assert.Equal(t, "app||t1%", LikePrefixPattern("app||t1"))
+	assert.Equal(t, `50\%\_off\\%`, LikePrefixPattern(`50%_off\`))
+}
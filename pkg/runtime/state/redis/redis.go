@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+	state_redis "github.com/dapr/components-contrib/state/redis"
+	"github.com/dapr/kit/logger"
+	"github.com/go-redis/redis/v8"
+
+	"mosn.io/layotto/components/pkg/utils"
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+// daprDBKey is the name of the db index in the metadata of the redis state store of Dapr
+const daprDBKey = "redisDB"
+
+// checkAndRecordScript creates the hash of the key in the layout of the redis state store of Dapr,
+// i.e. the fields data and version, if the key is absent.
+// It returns the flag whether it's created and the data.
+const checkAndRecordScript = `
+local data = redis.call("HGET", KEYS[1], "data")
+if data then
+	return {0, data}
+end
+redis.call("HSET", KEYS[1], "data", ARGV[1], "version", 1)
+if tonumber(ARGV[2]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return {1, ARGV[1]}
+`
+
+// incrementScript increases the data of the hash of the key, and the version as the other writes of Dapr do
+const incrementScript = `
+local value = redis.call("HINCRBY", KEYS[1], "data", ARGV[1])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+return value
+`
+
+// Redis is the redis state store of Dapr with the atomic operations run by lua scripts,
+// which read and write the hashes in the same layout as Dapr, so the values are visible to both.
+type Redis struct {
+	*state_redis.StateStore
+	client redis.UniversalClient
+}
+
+// NewRedisStateStore returns a new redis state store.
+func NewRedisStateStore(logger logger.Logger) state.Store {
+	return &Redis{StateStore: state_redis.NewRedisStateStore(logger)}
+}
+
+// Init initializes the store of Dapr, and connects to the same redis for the atomic operations.
+func (r *Redis) Init(metadata state.Metadata) error {
+	if err := r.StateStore.Init(metadata); err != nil {
+		return err
+	}
+	properties := make(map[string]string, len(metadata.Properties)+1)
+	for k, v := range metadata.Properties {
+		properties[k] = v
+	}
+	if v, ok := properties[daprDBKey]; ok {
+		properties["db"] = v
+	}
+	m, err := utils.ParseRedisMetadata(properties)
+	if err != nil {
+		return err
+	}
+	r.client = utils.AcquireRedisClient(m)
+	return nil
+}
+
+// CheckAndRecord implements runtime_state.IdempotencyRecorder.
+func (r *Redis) CheckAndRecord(req *runtime_state.IdempotencyRequest) (bool, []byte, error) {
+	res, err := r.client.Eval(context.Background(), checkAndRecordScript, []string{req.Key}, req.Value, req.TTLInSeconds).Result()
+	if err != nil {
+		return false, nil, err
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, nil, fmt.Errorf("unexpected result of redis: %v", res)
+	}
+	recorded, _ := values[0].(int64)
+	data, _ := values[1].(string)
+	return recorded == 1, []byte(data), nil
+}
+
+// Increment implements runtime_state.Incrementer.
+func (r *Redis) Increment(req *runtime_state.IncrementRequest) (int64, error) {
+	v, err := r.client.Eval(context.Background(), incrementScript, []string{req.Key}, req.Delta).Int64()
+	if err != nil && strings.Contains(err.Error(), "not an integer") {
+		return 0, runtime_state.ErrValueNotInteger
+	}
+	return v, err
+}
+
+// Close releases the client of the atomic operations and closes the store of Dapr.
+func (r *Redis) Close() error {
+	if r.client != nil {
+		r.client.Close()
+	}
+	return r.StateStore.Close()
+}
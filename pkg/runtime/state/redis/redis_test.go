@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dapr/components-contrib/state"
+	"github.com/dapr/kit/logger"
+	"github.com/stretchr/testify/assert"
+
+	runtime_state "mosn.io/layotto/pkg/runtime/state"
+)
+
+func newTestStore(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	assert.Nil(t, err)
+	store := NewRedisStateStore(logger.NewLogger("test")).(*Redis)
+	err = store.Init(state.Metadata{Properties: map[string]string{"redisHost": s.Addr()}})
+	assert.Nil(t, err)
+	return store, s
+}
+
+func TestCheckAndRecord(t *testing.T) {
+	store, s := newTestStore(t)
+	defer s.Close()
+	defer store.Close()
+
+	recorded, v, err := store.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("done"), TTLInSeconds: 60})
+	assert.Nil(t, err)
+	assert.True(t, recorded)
+	assert.Equal(t, "done", string(v))
+	assert.Equal(t, 60*time.Second, s.TTL("k"))
+
+	recorded, v, err = store.CheckAndRecord(&runtime_state.IdempotencyRequest{Key: "k", Value: []byte("again")})
+	assert.Nil(t, err)
+	assert.False(t, recorded)
+	assert.Equal(t, "done", string(v))
+
+	// the marker is visible to the store of Dapr
+	resp, err := store.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, "done", string(resp.Data))
+	assert.Equal(t, "1", *resp.ETag)
+}
+
+func TestIncrement(t *testing.T) {
+	store, s := newTestStore(t)
+	defer s.Close()
+	defer store.Close()
+
+	v, err := store.Increment(&runtime_state.IncrementRequest{Key: "k", Delta: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), v)
+	v, err = store.Increment(&runtime_state.IncrementRequest{Key: "k", Delta: -3})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), v)
+	resp, err := store.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, "-1", string(resp.Data))
+	assert.Equal(t, "2", *resp.ETag)
+
+	s.HSet("text", "data", "abc")
+	_, err = store.Increment(&runtime_state.IncrementRequest{Key: "text", Delta: 1})
+	assert.Equal(t, runtime_state.ErrValueNotInteger, err)
+}
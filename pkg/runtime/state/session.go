@@ -0,0 +1,235 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+const (
+	// sessionKeyPrefix is the prefix of the keys of the sessions, which is added before the key prefix of the app
+	sessionKeyPrefix = "layotto-session-"
+	// maxRevokeAttempts is the max number of attempts to revoke a session renewed concurrently
+	maxRevokeAttempts = 10
+)
+
+var (
+	ErrSessionNotFound            = errors.New("the session is not found or expired")
+	ErrSessionTTLInvalid          = errors.New("the ttl of the session must be positive")
+	ErrSessionETagNotSupported    = errors.New("the sessions require a state store supporting etag")
+	errSessionRevokeRetryExceeded = errors.New("the session is renewed concurrently too many times to revoke")
+)
+
+// Session is a session stored in a state store
+type Session struct {
+	Data         []byte
+	TTLInSeconds int64
+	// ExpireTime is in unix seconds
+	ExpireTime int64
+}
+
+// sessionRecord is the value of a session in the state store
+type sessionRecord struct {
+	Data       []byte `json:"data"`
+	TTL        int64  `json:"ttl"`
+	ExpireTime int64  `json:"expire_time"`
+	// Revoked marks the tombstone of a revoked session
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// NewSessionId returns a random id of a session, which is url safe
+func NewSessionId() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SessionKey returns the key of the session in the state store, before adding the key prefix of the app
+func SessionKey(id string) string {
+	return sessionKeyPrefix + id
+}
+
+// Sessions stores the sessions in a state store, whose expiration slides when they're accessed.
+// The sessions are saved with the metadata ttlInSeconds, so the stores supporting it remove the expired ones,
+// and the expire time is checked when reading as well, for the stores expiring the keys lazily or not at all.
+// The sessions are written with etag, so the store must support it.
+type Sessions struct {
+	store state.Store
+	now   func() time.Time
+}
+
+func NewSessions(store state.Store) (*Sessions, error) {
+	if !state.FeatureETag.IsPresent(store.Features()) {
+		return nil, ErrSessionETagNotSupported
+	}
+	return &Sessions{store: store, now: time.Now}, nil
+}
+
+// Create saves a new session under the key, which expires after ttlInSeconds unless it's accessed
+func (s *Sessions) Create(key string, data []byte, ttlInSeconds int64, metadata map[string]string) (*Session, error) {
+	if ttlInSeconds <= 0 {
+		return nil, ErrSessionTTLInvalid
+	}
+	r := &sessionRecord{Data: data, TTL: ttlInSeconds, ExpireTime: s.now().Unix() + ttlInSeconds}
+	if err := s.save(key, r, nil, metadata); err != nil {
+		return nil, err
+	}
+	return r.session(), nil
+}
+
+// Get returns the session, and renews it if more than half of its ttl has elapsed since it's renewed,
+// so that the sessions read frequently aren't written on each read
+func (s *Sessions) Get(key string, metadata map[string]string) (*Session, error) {
+	r, etag, err := s.load(key, metadata)
+	if err != nil {
+		return nil, err
+	}
+	if r.ExpireTime-s.now().Unix() > r.TTL/2 {
+		return r.session(), nil
+	}
+	renewed := *r
+	renewed.ExpireTime = s.now().Unix() + r.TTL
+	if err := s.save(key, &renewed, etag, metadata); err != nil {
+		if isETagMismatch(err) {
+			// renewed or revoked concurrently, the session read was still valid
+			return r.session(), nil
+		}
+		return nil, err
+	}
+	return renewed.session(), nil
+}
+
+// Touch renews the session, whose expire time becomes ttl seconds later
+func (s *Sessions) Touch(key string, metadata map[string]string) (*Session, error) {
+	r, etag, err := s.load(key, metadata)
+	if err != nil {
+		return nil, err
+	}
+	r.ExpireTime = s.now().Unix() + r.TTL
+	if err := s.save(key, r, etag, metadata); err != nil {
+		if !isETagMismatch(err) {
+			return nil, err
+		}
+		// renewed or revoked concurrently, return the current one
+		if r, _, err = s.load(key, metadata); err != nil {
+			return nil, err
+		}
+	}
+	return r.session(), nil
+}
+
+// Revoke replaces the session with a tombstone, it succeeds if the session doesn't exist.
+// The session isn't deleted, since the stores of Dapr may accept a write with an etag if the key is absent,
+// so a renewal racing the revocation would restore the session. The tombstone changes the etag instead,
+// and expires after the ttl of the session.
+func (s *Sessions) Revoke(key string, metadata map[string]string) error {
+	for i := 0; i < maxRevokeAttempts; i++ {
+		r, etag, err := s.loadRecord(key, metadata)
+		if err == ErrSessionNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if r.Revoked {
+			return nil
+		}
+		tombstone := &sessionRecord{TTL: r.TTL, ExpireTime: s.now().Unix() + r.TTL, Revoked: true}
+		if err = s.save(key, tombstone, etag, metadata); !isETagMismatch(err) {
+			return err
+		}
+		// renewed concurrently, revoke the current one
+	}
+	return errSessionRevokeRetryExceeded
+}
+
+// load returns the session which isn't revoked
+func (s *Sessions) load(key string, metadata map[string]string) (*sessionRecord, *string, error) {
+	r, etag, err := s.loadRecord(key, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Revoked {
+		return nil, nil, ErrSessionNotFound
+	}
+	return r, etag, nil
+}
+
+// loadRecord returns the session or its tombstone
+func (s *Sessions) loadRecord(key string, metadata map[string]string) (*sessionRecord, *string, error) {
+	resp, err := s.store.Get(&state.GetRequest{
+		Key:      key,
+		Metadata: metadata,
+		Options:  state.GetStateOption{Consistency: state.Strong},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp == nil || len(resp.Data) == 0 {
+		return nil, nil, ErrSessionNotFound
+	}
+	r := &sessionRecord{}
+	if err := json.Unmarshal(resp.Data, r); err != nil {
+		return nil, nil, fmt.Errorf("the session is malformed: %v", err)
+	}
+	if r.ExpireTime <= s.now().Unix() {
+		// the store doesn't expire it in time, so remove it on behalf of the store
+		_ = s.store.Delete(&state.DeleteRequest{Key: key, ETag: resp.ETag, Metadata: metadata})
+		return nil, nil, ErrSessionNotFound
+	}
+	return r, resp.ETag, nil
+}
+
+// save writes the session, only if it's absent or unchanged since it's read
+func (s *Sessions) save(key string, r *sessionRecord, etag *string, metadata map[string]string) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	md := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	md[TTLMetadataKey] = strconv.FormatInt(r.ExpireTime-s.now().Unix(), 10)
+	req := &state.SetRequest{
+		Key:      key,
+		Value:    value,
+		Metadata: md,
+		ETag:     etag,
+		Options:  state.SetStateOption{Consistency: state.Strong, Concurrency: state.FirstWrite},
+	}
+	return s.store.Set(req)
+}
+
+func (r *sessionRecord) session() *Session {
+	return &Session{Data: r.Data, TTLInSeconds: r.TTL, ExpireTime: r.ExpireTime}
+}
+
+func isETagMismatch(err error) bool {
+	e, ok := err.(*state.ETagError)
+	return ok && e.Kind() == state.ETagMismatch
+}
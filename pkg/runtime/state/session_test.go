@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSessionId(t *testing.T) {
+	a, err := NewSessionId()
+	assert.Nil(t, err)
+	b, err := NewSessionId()
+	assert.Nil(t, err)
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, "layotto-session-"+a, SessionKey(a))
+}
+
+func TestSessions(t *testing.T) {
+	mem := newMemStore()
+	store, err := NewETagStore(mem, &ETagConfig{})
+	assert.Nil(t, err)
+	now := time.Unix(1000, 0)
+	s, err := NewSessions(store)
+	assert.Nil(t, err)
+	s.now = func() time.Time { return now }
+
+	_, err = s.Create("k", []byte("user=1"), 0, nil)
+	assert.Equal(t, ErrSessionTTLInvalid, err)
+	created, err := s.Create("k", []byte("user=1"), 100, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1100), created.ExpireTime)
+	// the key is taken
+	_, err = s.Create("k", []byte("user=2"), 100, nil)
+	assert.True(t, isETagMismatch(err))
+
+	// not renewed before half of the ttl elapses
+	now = time.Unix(1040, 0)
+	got, err := s.Get("k", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user=1"), got.Data)
+	assert.Equal(t, int64(100), got.TTLInSeconds)
+	assert.Equal(t, int64(1100), got.ExpireTime)
+
+	// renewed after that
+	now = time.Unix(1060, 0)
+	got, err = s.Get("k", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1160), got.ExpireTime)
+	now = time.Unix(1070, 0)
+	got, err = s.Get("k", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1160), got.ExpireTime)
+
+	// touched at any time
+	touched, err := s.Touch("k", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1170), touched.ExpireTime)
+	assert.Equal(t, []byte("user=1"), touched.Data)
+
+	// expired, and removed even if the store doesn't expire it
+	now = time.Unix(1170, 0)
+	_, err = s.Get("k", nil)
+	assert.Equal(t, ErrSessionNotFound, err)
+	_, err = s.Touch("k", nil)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Empty(t, mem.items)
+
+	_, err = s.Create("k2", []byte("user=2"), 100, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Revoke("k2", nil))
+	_, err = s.Get("k2", nil)
+	assert.Equal(t, ErrSessionNotFound, err)
+	// revoking twice succeeds
+	assert.Nil(t, s.Revoke("k2", nil))
+
+	// a renewal racing the revocation doesn't bring the session back
+	_, err = s.Create("k3", []byte("user=3"), 100, nil)
+	assert.Nil(t, err)
+	r, etag, err := s.load("k3", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Revoke("k3", nil))
+	assert.True(t, isETagMismatch(s.save("k3", r, etag, nil)))
+	_, err = s.Touch("k3", nil)
+	assert.Equal(t, ErrSessionNotFound, err)
+	// the tombstone expires after the ttl
+	now = time.Unix(1270, 0)
+	_, err = s.Get("k3", nil)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.NotContains(t, mem.items, "k3")
+}
+
+func TestSessions_ETagNotSupported(t *testing.T) {
+	_, err := NewSessions(newMemStore())
+	assert.Equal(t, ErrSessionETagNotSupported, err)
+}
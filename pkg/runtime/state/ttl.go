@@ -0,0 +1,303 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+const (
+	// TTLMetadataKey is the metadata of the time to live in seconds of a key, which is supported by some state stores
+	TTLMetadataKey = "ttlInSeconds"
+	// TTLExpireTimeMetadataKey is the key of the metadata of the values got carrying their expire time in RFC3339
+	TTLExpireTimeMetadataKey = "ttlExpireTime"
+
+	// ttlNever is the ttl of the values never expiring, which overrides the default ttl of the store
+	ttlNever = -1
+)
+
+var (
+	ErrTTLInvalid = fmt.Errorf("the %s must be %d or between 1 and %d", TTLMetadataKey, ttlNever, math.MaxInt32)
+
+	// ttlEnvelopeMagic starts the values with expire times, followed by the expire time in unix seconds, a line feed and the value
+	ttlEnvelopeMagic = []byte("\x00layotto-ttl\x00")
+)
+
+// TTLConfig records the expire times of the values saved with ttls
+type TTLConfig struct {
+	// Emulate removes the ttls from the metadata for the stores not supporting them, and the expired values are deleted
+	// by the runtime when they're read. The values never read again are never deleted.
+	// Otherwise the ttls are passed to the store, which removes the expired values itself.
+	Emulate bool `json:"emulate,omitempty"`
+}
+
+// ParseTTL returns the ttl in the metadata and whether it's set, the ttl is -1 if the value never expires
+func ParseTTL(metadata map[string]string) (int64, bool, error) {
+	v := metadata[TTLMetadataKey]
+	if v == "" {
+		return 0, false, nil
+	}
+	ttl, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ttl > math.MaxInt32 || (ttl <= 0 && ttl != ttlNever) {
+		return 0, false, fmt.Errorf("%w: %s", ErrTTLInvalid, v)
+	}
+	return ttl, true, nil
+}
+
+// ttlStore records the expire time of a write with a ttl with its value, and returns it in the metadata of the reads.
+// The expired values are never returned even if the store keeps them for a while, so the ttls work the same way
+// for the stores removing the expired values lazily, or not supporting ttls at all if they're emulated.
+type ttlStore struct {
+	state.Store
+	emulate bool
+	now     func() time.Time
+}
+
+// ttlTransactionalStore keeps the transaction capability of the store
+type ttlTransactionalStore struct {
+	*ttlStore
+	transactional state.TransactionalStore
+}
+
+// ttlQuerierStore keeps the query capability of the store, the expired values are dropped from the results
+type ttlQuerierStore struct {
+	*ttlStore
+	querier state.Querier
+}
+
+type ttlTransactionalQuerierStore struct {
+	*ttlTransactionalStore
+	querier state.Querier
+}
+
+// NewTTLStore wraps the store so that the expire times of the values are recorded
+func NewTTLStore(store state.Store, cfg *TTLConfig) state.Store {
+	s := &ttlStore{Store: store, emulate: cfg.Emulate, now: time.Now}
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &ttlTransactionalQuerierStore{ttlTransactionalStore: &ttlTransactionalStore{ttlStore: s, transactional: t}, querier: q}
+	case transactional:
+		return &ttlTransactionalStore{ttlStore: s, transactional: t}
+	case querier:
+		return &ttlQuerierStore{ttlStore: s, querier: q}
+	}
+	return s
+}
+
+func (s *ttlStore) Set(req *state.SetRequest) error {
+	sealed, err := s.seal(*req)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(&sealed)
+}
+
+func (s *ttlStore) BulkSet(req []state.SetRequest) error {
+	sealed := make([]state.SetRequest, len(req))
+	for i, r := range req {
+		var err error
+		if sealed[i], err = s.seal(r); err != nil {
+			return err
+		}
+	}
+	return s.Store.BulkSet(sealed)
+}
+
+func (s *ttlStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	resp, err := s.Store.Get(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	data, expireTime := openTTLEnvelope(resp.Data)
+	if expireTime == 0 {
+		return resp, nil
+	}
+	if s.expired(expireTime) {
+		s.deleteExpired(req.Key, resp.ETag)
+		return &state.GetResponse{}, nil
+	}
+	resp.Data = data
+	resp.Metadata = withExpireTime(resp.Metadata, expireTime)
+	return resp, nil
+}
+
+func (s *ttlStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	supported, resp, err := s.Store.BulkGet(req)
+	if err != nil || !supported {
+		return supported, resp, err
+	}
+	for i := range resp {
+		if resp[i].Error != "" {
+			continue
+		}
+		data, expireTime := openTTLEnvelope(resp[i].Data)
+		if expireTime == 0 {
+			continue
+		}
+		if s.expired(expireTime) {
+			resp[i] = state.BulkGetResponse{Key: resp[i].Key}
+			continue
+		}
+		resp[i].Data = data
+		resp[i].Metadata = withExpireTime(resp[i].Metadata, expireTime)
+	}
+	return supported, resp, nil
+}
+
+func (s *ttlQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+func (s *ttlTransactionalQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+// query opens the envelopes of the results, and drops the expired ones
+func (s *ttlStore) query(querier state.Querier, req *state.QueryRequest) (*state.QueryResponse, error) {
+	resp, err := querier.Query(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	results := resp.Results[:0]
+	for _, item := range resp.Results {
+		data, expireTime := openTTLEnvelope(item.Data)
+		if expireTime != 0 {
+			if s.expired(expireTime) {
+				continue
+			}
+			item.Data = data
+		}
+		results = append(results, item)
+	}
+	resp.Results = results
+	return resp, nil
+}
+
+func (s *ttlTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	operations := make([]state.TransactionalStateOperation, len(req.Operations))
+	for i, o := range req.Operations {
+		operations[i] = o
+		if o.Operation != state.Upsert {
+			continue
+		}
+		setReq, ok := o.Request.(state.SetRequest)
+		if !ok {
+			continue
+		}
+		sealed, err := s.seal(setReq)
+		if err != nil {
+			return err
+		}
+		operations[i].Request = sealed
+	}
+	return s.transactional.Multi(&state.TransactionalStateRequest{Operations: operations, Metadata: req.Metadata})
+}
+
+// seal returns a copy of the request whose value is in the envelope with the expire time,
+// and the ttl is removed from the metadata if it's emulated.
+func (s *ttlStore) seal(req state.SetRequest) (state.SetRequest, error) {
+	ttl, ok, err := ParseTTL(req.Metadata)
+	if err != nil {
+		return req, fmt.Errorf("key %s: %w", req.Key, err)
+	}
+	if !ok {
+		return req, nil
+	}
+	if s.emulate {
+		metadata := make(map[string]string, len(req.Metadata))
+		for k, v := range req.Metadata {
+			if k != TTLMetadataKey {
+				metadata[k] = v
+			}
+		}
+		req.Metadata = metadata
+	}
+	if ttl == ttlNever {
+		return req, nil
+	}
+	value, err := toBytes(req.Value)
+	if err != nil {
+		return req, err
+	}
+	req.Value = sealTTLEnvelope(s.now().Unix()+ttl, value)
+	return req, nil
+}
+
+func (s *ttlStore) expired(expireTime int64) bool {
+	return expireTime <= s.now().Unix()
+}
+
+// deleteExpired deletes the expired value for the store not removing it, if the value can't be overwritten concurrently
+func (s *ttlStore) deleteExpired(key string, etag *string) {
+	if !s.emulate || etag == nil || !state.FeatureETag.IsPresent(s.Store.Features()) {
+		return
+	}
+	// the value saved again after it's read is kept by the etag, so the error is ignored
+	_ = s.Store.Delete(&state.DeleteRequest{
+		Key:     key,
+		ETag:    etag,
+		Options: state.DeleteStateOption{Concurrency: state.FirstWrite},
+	})
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (s *ttlStore) Unwrap() state.Store {
+	return s.Store
+}
+
+func withExpireTime(metadata map[string]string, expireTime int64) map[string]string {
+	res := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		res[k] = v
+	}
+	res[TTLExpireTimeMetadataKey] = time.Unix(expireTime, 0).UTC().Format(time.RFC3339)
+	return res
+}
+
+func sealTTLEnvelope(expireTime int64, value []byte) []byte {
+	t := strconv.FormatInt(expireTime, 10)
+	b := make([]byte, 0, len(ttlEnvelopeMagic)+len(t)+1+len(value))
+	b = append(b, ttlEnvelopeMagic...)
+	b = append(b, t...)
+	b = append(b, '\n')
+	return append(b, value...)
+}
+
+// openTTLEnvelope returns the value and its expire time, the data is returned as it is with 0 if it's not in an envelope
+func openTTLEnvelope(data []byte) ([]byte, int64) {
+	if !bytes.HasPrefix(data, ttlEnvelopeMagic) {
+		return data, 0
+	}
+	rest := data[len(ttlEnvelopeMagic):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return data, 0
+	}
+	expireTime, err := strconv.ParseInt(string(rest[:i]), 10, 64)
+	if err != nil || expireTime <= 0 {
+		return data, 0
+	}
+	return rest[i+1:], expireTime
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// metadataStore records the metadata of the last write
+type metadataStore struct {
+	state.Store
+	metadata map[string]string
+}
+
+func (s *metadataStore) Set(req *state.SetRequest) error {
+	s.metadata = req.Metadata
+	return s.Store.Set(req)
+}
+
+func TestParseTTL(t *testing.T) {
+	ttl, ok, err := ParseTTL(map[string]string{TTLMetadataKey: "60"})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(60), ttl)
+	ttl, ok, err = ParseTTL(map[string]string{TTLMetadataKey: "-1"})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(-1), ttl)
+	_, ok, err = ParseTTL(nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	for _, v := range []string{"0", "-2", "1.5", "a", "2147483648"} {
+		_, _, err = ParseTTL(map[string]string{TTLMetadataKey: v})
+		assert.True(t, errors.Is(err, ErrTTLInvalid), v)
+	}
+}
+
+func TestTTLStore(t *testing.T) {
+	etags, _ := NewETagStore(newMemStore(), &ETagConfig{})
+	mem := &metadataStore{Store: etags}
+	s := NewTTLStore(mem, &TTLConfig{Emulate: true})
+	now := time.Unix(1000, 0)
+	s.(*ttlStore).now = func() time.Time { return now }
+
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "60", "a": "b"}}))
+	// the ttl isn't passed to the store
+	assert.Equal(t, map[string]string{"a": "b"}, mem.metadata)
+	resp, err := s.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), resp.Data)
+	assert.Equal(t, "1970-01-01T00:17:40Z", resp.Metadata[TTLExpireTimeMetadataKey])
+	assert.NotNil(t, resp.ETag)
+
+	// the values never expiring and the ones without ttls are kept as they are
+	assert.Nil(t, s.BulkSet([]state.SetRequest{
+		{Key: "never", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "-1"}},
+		{Key: "plain", Value: []byte("v")},
+	}))
+	_, bulk, err := s.BulkGet([]state.GetRequest{{Key: "k"}, {Key: "never"}, {Key: "plain"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), bulk[0].Data)
+	assert.Equal(t, "1970-01-01T00:17:40Z", bulk[0].Metadata[TTLExpireTimeMetadataKey])
+	assert.Equal(t, []byte("v"), bulk[1].Data)
+	assert.Empty(t, bulk[1].Metadata[TTLExpireTimeMetadataKey])
+	assert.Equal(t, []byte("v"), bulk[2].Data)
+
+	// the expired value is hidden and deleted
+	now = now.Add(time.Minute)
+	_, bulk, err = s.BulkGet([]state.GetRequest{{Key: "k"}})
+	assert.Nil(t, err)
+	assert.Nil(t, bulk[0].Data)
+	resp, err = s.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+	resp, err = etags.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+
+	err = s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "0"}})
+	assert.True(t, errors.Is(err, ErrTTLInvalid))
+}
+
+func TestTTLStore_Native(t *testing.T) {
+	mem := &metadataStore{Store: newMemStore()}
+	s := NewTTLStore(mem, &TTLConfig{})
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "60"}}))
+	assert.Equal(t, "60", mem.metadata[TTLMetadataKey])
+	resp, err := s.Get(&state.GetRequest{Key: "k"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), resp.Data)
+	assert.NotEmpty(t, resp.Metadata[TTLExpireTimeMetadataKey])
+}
+
+func TestTTLStoreQuery(t *testing.T) {
+	s := NewTTLStore(&memQuerierStore{memStore: newMemStore()}, &TTLConfig{Emulate: true})
+	now := time.Unix(1000, 0)
+	s.(*ttlTransactionalQuerierStore).now = func() time.Time { return now }
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v"), Metadata: map[string]string{TTLMetadataKey: "60"}}))
+
+	resp, err := s.(state.Querier).Query(&state.QueryRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 1)
+	assert.Equal(t, "v", string(resp.Results[0].Data))
+
+	// the expired values are dropped
+	now = now.Add(time.Minute)
+	resp, err = s.(state.Querier).Query(&state.QueryRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 0)
+}
@@ -0,0 +1,350 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/dapr/components-contrib/state"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// ContentTypeMetadataKey is the key of the metadata declaring the content type of the values saved,
+	// and the one expected of the values got. It's also the key of the metadata of the values got carrying their content type.
+	ContentTypeMetadataKey = "contentType"
+
+	// ContentTypeJSON is the content type of json values, which are validated when they're saved
+	ContentTypeJSON = "application/json"
+	// ContentTypeProtobuf is the content type of the serialized google.protobuf.Any, whose type url is recorded
+	// as the parameter `type`, e.g. `application/x-protobuf; type=type.googleapis.com/foo.Bar`
+	ContentTypeProtobuf = "application/x-protobuf"
+
+	contentTypeProtobufAlias = "application/protobuf"
+	contentTypeParamType     = "type"
+)
+
+var (
+	ErrContentTypeRequired = errors.New("the content type of the value is required")
+	ErrContentTypeInvalid  = errors.New("the value doesn't match its content type")
+	ErrContentTypeMismatch = errors.New("the content type of the value isn't the one expected")
+)
+
+// typeCompanionSuffix is appended to the key to get the companion key keeping its content type.
+// The keys of the apps can't contain the separator, so they never conflict with the companion keys.
+const typeCompanionSuffix = daprSeparator + "type"
+
+// TypedValuesConfig records the content types declared by the writes with the values
+type TypedValuesConfig struct {
+	// Strict rejects the writes without content types
+	Strict bool `json:"strict,omitempty"`
+}
+
+// typedStore records the content type in the metadata of a write in a companion key, after validating the value against it,
+// and returns it in the metadata of the reads, so that the apps using different sdks don't misread the values silently.
+// The values and their metadata are written as they are, so the queries and the other readers of the store see the same values.
+// The values written without content types are kept as they are, so it can be enabled for a store with data already.
+type typedStore struct {
+	state.Store
+	strict bool
+}
+
+// typedTransactionalStore keeps the transaction capability of the store, the companion keys are written in the same transaction
+type typedTransactionalStore struct {
+	*typedStore
+	transactional state.TransactionalStore
+}
+
+// typedQuerierStore keeps the query capability of the store, the companion keys are dropped from the results
+type typedQuerierStore struct {
+	*typedStore
+	querier state.Querier
+}
+
+type typedTransactionalQuerierStore struct {
+	*typedTransactionalStore
+	querier state.Querier
+}
+
+// NewTypedStore wraps the store so that the content types of the values are recorded
+func NewTypedStore(store state.Store, cfg *TypedValuesConfig) state.Store {
+	s := &typedStore{Store: store, strict: cfg.Strict}
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &typedTransactionalQuerierStore{typedTransactionalStore: &typedTransactionalStore{typedStore: s, transactional: t}, querier: q}
+	case transactional:
+		return &typedTransactionalStore{typedStore: s, transactional: t}
+	case querier:
+		return &typedQuerierStore{typedStore: s, querier: q}
+	}
+	return s
+}
+
+// Set writes the value, and then its content type, or deletes the content type written before if it has none
+func (s *typedStore) Set(req *state.SetRequest) error {
+	contentType, err := s.contentType(req)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Set(req); err != nil {
+		return err
+	}
+	if contentType == "" {
+		return s.Store.Delete(companionDelete(req.Key, req.Metadata))
+	}
+	return s.Store.Set(companionSet(req.Key, contentType, req.Metadata))
+}
+
+func (s *typedStore) BulkSet(req []state.SetRequest) error {
+	sets := make([]state.SetRequest, 0, len(req))
+	var deletes []state.DeleteRequest
+	for i := range req {
+		contentType, err := s.contentType(&req[i])
+		if err != nil {
+			return err
+		}
+		if contentType == "" {
+			deletes = append(deletes, *companionDelete(req[i].Key, req[i].Metadata))
+			continue
+		}
+		sets = append(sets, *companionSet(req[i].Key, contentType, req[i].Metadata))
+	}
+	if err := s.Store.BulkSet(req); err != nil {
+		return err
+	}
+	if len(sets) > 0 {
+		if err := s.Store.BulkSet(sets); err != nil {
+			return err
+		}
+	}
+	if len(deletes) > 0 {
+		return s.Store.BulkDelete(deletes)
+	}
+	return nil
+}
+
+func (s *typedStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	resp, err := s.Store.Get(req)
+	if err != nil || resp == nil || len(resp.Data) == 0 {
+		return resp, err
+	}
+	contentType, err := s.Store.Get(&state.GetRequest{Key: req.Key + typeCompanionSuffix, Metadata: req.Metadata})
+	if err != nil {
+		return nil, err
+	}
+	if contentType != nil && len(contentType.Data) > 0 {
+		resp.Metadata = withContentType(resp.Metadata, string(contentType.Data))
+	}
+	return resp, nil
+}
+
+// BulkGet isn't supported, the companion keys are got one by one by the callers
+func (s *typedStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	return false, nil, nil
+}
+
+func (s *typedStore) Delete(req *state.DeleteRequest) error {
+	if err := s.Store.Delete(req); err != nil {
+		return err
+	}
+	return s.Store.Delete(companionDelete(req.Key, req.Metadata))
+}
+
+func (s *typedStore) BulkDelete(req []state.DeleteRequest) error {
+	if err := s.Store.BulkDelete(req); err != nil {
+		return err
+	}
+	deletes := make([]state.DeleteRequest, len(req))
+	for i := range req {
+		deletes[i] = *companionDelete(req[i].Key, req[i].Metadata)
+	}
+	return s.Store.BulkDelete(deletes)
+}
+
+func (s *typedQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+func (s *typedTransactionalQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	return s.query(s.querier, req)
+}
+
+// query drops the companion keys from the results
+func (s *typedStore) query(querier state.Querier, req *state.QueryRequest) (*state.QueryResponse, error) {
+	resp, err := querier.Query(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	results := resp.Results[:0]
+	for _, item := range resp.Results {
+		if !strings.HasSuffix(item.Key, typeCompanionSuffix) {
+			results = append(results, item)
+		}
+	}
+	resp.Results = results
+	return resp, nil
+}
+
+func (s *typedTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	operations := make([]state.TransactionalStateOperation, 0, len(req.Operations))
+	for _, o := range req.Operations {
+		operations = append(operations, o)
+		switch r := o.Request.(type) {
+		case state.SetRequest:
+			contentType, err := s.contentType(&r)
+			if err != nil {
+				return err
+			}
+			if contentType == "" {
+				operations = append(operations, state.TransactionalStateOperation{Operation: state.Delete, Request: *companionDelete(r.Key, r.Metadata)})
+				continue
+			}
+			operations = append(operations, state.TransactionalStateOperation{Operation: state.Upsert, Request: *companionSet(r.Key, contentType, r.Metadata)})
+		case state.DeleteRequest:
+			operations = append(operations, state.TransactionalStateOperation{Operation: state.Delete, Request: *companionDelete(r.Key, r.Metadata)})
+		}
+	}
+	return s.transactional.Multi(&state.TransactionalStateRequest{Operations: operations, Metadata: req.Metadata})
+}
+
+// contentType validates the value against the content type declared in the metadata, and returns the content type normalized
+func (s *typedStore) contentType(req *state.SetRequest) (string, error) {
+	declared := req.Metadata[ContentTypeMetadataKey]
+	if declared == "" {
+		if s.strict {
+			return "", fmt.Errorf("%w: key %s", ErrContentTypeRequired, req.Key)
+		}
+		return "", nil
+	}
+	value, err := toBytes(req.Value)
+	if err != nil {
+		return "", err
+	}
+	contentType, err := ValidateContentType(declared, value)
+	if err != nil {
+		return "", fmt.Errorf("key %s: %w", req.Key, err)
+	}
+	return contentType, nil
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (s *typedStore) Unwrap() state.Store {
+	return s.Store
+}
+
+// companionSet returns the write of the content type of the key, which has the same metadata as the value,
+// e.g. the ttl, except the content type
+func companionSet(key string, contentType string, metadata map[string]string) *state.SetRequest {
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if k != ContentTypeMetadataKey {
+			md[k] = v
+		}
+	}
+	return &state.SetRequest{Key: key + typeCompanionSuffix, Value: []byte(contentType), Metadata: md}
+}
+
+func companionDelete(key string, metadata map[string]string) *state.DeleteRequest {
+	return &state.DeleteRequest{Key: key + typeCompanionSuffix, Metadata: metadata}
+}
+
+// ValidateContentType checks the value against the content type, and returns the content type normalized.
+// The json values must be valid, and the protobuf values must be google.protobuf.Any, whose type url is added
+// to the content type. The values of the other content types aren't validated.
+func ValidateContentType(contentType string, value []byte) (string, error) {
+	mediaType, params, err := parseContentType(contentType)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json"):
+		if !json.Valid(value) {
+			return "", fmt.Errorf("%w: invalid json", ErrContentTypeInvalid)
+		}
+	case mediaType == ContentTypeProtobuf:
+		a := &anypb.Any{}
+		if err := proto.Unmarshal(value, a); err != nil || a.TypeUrl == "" {
+			return "", fmt.Errorf("%w: not a google.protobuf.Any", ErrContentTypeInvalid)
+		}
+		if t, ok := params[contentTypeParamType]; ok && t != a.TypeUrl {
+			return "", fmt.Errorf("%w: the type is %s, not %s", ErrContentTypeInvalid, a.TypeUrl, t)
+		}
+		params[contentTypeParamType] = a.TypeUrl
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
+
+// CheckContentType checks the value got against the content type expected. The value matches if its content type
+// recorded in the metadata has the same media type and the parameters expected, e.g. the type of protobuf,
+// or the value without content type is valid for the one expected. Nothing is checked if the key isn't found.
+func CheckContentType(expected string, data []byte, metadata map[string]string) error {
+	if expected == "" || data == nil {
+		return nil
+	}
+	actual := metadata[ContentTypeMetadataKey]
+	if actual == "" {
+		_, err := ValidateContentType(expected, data)
+		return err
+	}
+	expectedType, expectedParams, err := parseContentType(expected)
+	if err != nil {
+		return err
+	}
+	actualType, actualParams, err := parseContentType(actual)
+	if err != nil {
+		return err
+	}
+	if expectedType != actualType {
+		return fmt.Errorf("%w: %s is not %s", ErrContentTypeMismatch, actual, expected)
+	}
+	for k, v := range expectedParams {
+		if actualParams[k] != v {
+			return fmt.Errorf("%w: %s is not %s", ErrContentTypeMismatch, actual, expected)
+		}
+	}
+	return nil
+}
+
+func parseContentType(contentType string) (string, map[string]string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && !strings.Contains(mediaType, "/") {
+		err = errors.New("no subtype")
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s isn't a content type: %v", ErrContentTypeInvalid, contentType, err)
+	}
+	if mediaType == contentTypeProtobufAlias {
+		mediaType = ContentTypeProtobuf
+	}
+	return mediaType, params, nil
+}
+
+func withContentType(metadata map[string]string, contentType string) map[string]string {
+	res := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		res[k] = v
+	}
+	res[ContentTypeMetadataKey] = contentType
+	return res
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestValidateContentType(t *testing.T) {
+	contentType, err := ValidateContentType("application/json; charset=utf-8", []byte(`{"a":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json; charset=utf-8", contentType)
+	_, err = ValidateContentType("application/cloudevents+json", []byte(`{"a":`))
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+
+	a, _ := anypb.New(wrapperspb.String("v"))
+	value, _ := proto.Marshal(a)
+	contentType, err = ValidateContentType("application/protobuf", value)
+	assert.Nil(t, err)
+	assert.Equal(t, `application/x-protobuf; type="type.googleapis.com/google.protobuf.StringValue"`, contentType)
+	_, err = ValidateContentType(`application/x-protobuf; type="type.googleapis.com/google.protobuf.Int64Value"`, value)
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+	_, err = ValidateContentType("application/x-protobuf", []byte(`{"a":1}`))
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+
+	// not validated
+	contentType, err = ValidateContentType("Text/Plain", []byte{0xff})
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	_, err = ValidateContentType("json", nil)
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+}
+
+func TestCheckContentType(t *testing.T) {
+	typed := map[string]string{ContentTypeMetadataKey: `application/x-protobuf; type="type.googleapis.com/google.protobuf.StringValue"`}
+	assert.Nil(t, CheckContentType("", []byte("v"), nil))
+	assert.Nil(t, CheckContentType("application/json", nil, nil))
+	assert.Nil(t, CheckContentType("application/x-protobuf", []byte("v"), typed))
+	assert.Nil(t, CheckContentType(`application/protobuf; type="type.googleapis.com/google.protobuf.StringValue"`, []byte("v"), typed))
+	err := CheckContentType(`application/x-protobuf; type="type.googleapis.com/google.protobuf.Int64Value"`, []byte("v"), typed)
+	assert.True(t, errors.Is(err, ErrContentTypeMismatch))
+	err = CheckContentType("application/json", []byte("v"), typed)
+	assert.True(t, errors.Is(err, ErrContentTypeMismatch))
+
+	// the values without content types are validated
+	assert.Nil(t, CheckContentType("application/json", []byte(`[1]`), nil))
+	err = CheckContentType("application/json", []byte("v"), map[string]string{})
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+}
+
+func TestTypedStore(t *testing.T) {
+	mem := newMemStore()
+	s := NewTypedStore(mem, &TypedValuesConfig{})
+	_, ok := s.(state.TransactionalStore)
+	assert.True(t, ok)
+
+	assert.Nil(t, s.Set(&state.SetRequest{
+		Key:      "json",
+		Value:    []byte(`{"a":1}`),
+		Metadata: map[string]string{ContentTypeMetadataKey: "application/json", "ttlInSeconds": "10"},
+	}))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "raw", Value: []byte("v")}))
+	err := s.Set(&state.SetRequest{Key: "bad", Value: []byte("v"), Metadata: map[string]string{ContentTypeMetadataKey: "application/json"}})
+	assert.True(t, errors.Is(err, ErrContentTypeInvalid))
+	_, ok = mem.items["bad"]
+	assert.False(t, ok)
+	// the value is written as it is, and the content type is in the companion key
+	assert.Equal(t, `{"a":1}`, string(mem.items["json"]))
+	assert.Equal(t, "application/json", string(mem.items["json"+typeCompanionSuffix]))
+
+	resp, err := s.Get(&state.GetRequest{Key: "json"})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":1}`, string(resp.Data))
+	assert.Equal(t, "application/json", resp.Metadata[ContentTypeMetadataKey])
+	resp, err = s.Get(&state.GetRequest{Key: "raw"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(resp.Data))
+	assert.Empty(t, resp.Metadata[ContentTypeMetadataKey])
+
+	err = s.(state.TransactionalStore).Multi(&state.TransactionalStateRequest{Operations: []state.TransactionalStateOperation{
+		{Operation: state.Upsert, Request: state.SetRequest{Key: "text", Value: []byte("t"), Metadata: map[string]string{ContentTypeMetadataKey: "text/plain"}}},
+		{Operation: state.Delete, Request: state.DeleteRequest{Key: "raw"}},
+	}})
+	assert.Nil(t, err)
+	resp, _ = s.Get(&state.GetRequest{Key: "text"})
+	assert.Equal(t, "t", string(resp.Data))
+	assert.Equal(t, "text/plain", resp.Metadata[ContentTypeMetadataKey])
+
+	_, ok = mem.items["raw"+typeCompanionSuffix]
+	assert.False(t, ok)
+
+	// the content type written before is removed with the value without content type
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "json", Value: []byte("v")}))
+	resp, _ = s.Get(&state.GetRequest{Key: "json"})
+	assert.Empty(t, resp.Metadata[ContentTypeMetadataKey])
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "text"}))
+	assert.Len(t, mem.items, 1)
+
+	strict := NewTypedStore(mem, &TypedValuesConfig{Strict: true})
+	err = strict.BulkSet([]state.SetRequest{{Key: "raw", Value: []byte("v")}})
+	assert.True(t, errors.Is(err, ErrContentTypeRequired))
+}
+
+func TestTypedStoreQuery(t *testing.T) {
+	s := NewTypedStore(&memQuerierStore{memStore: newMemStore()}, &TypedValuesConfig{})
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte(`{"a":1}`), Metadata: map[string]string{ContentTypeMetadataKey: ContentTypeJSON}}))
+
+	// the companion keys are dropped
+	resp, err := s.(state.Querier).Query(&state.QueryRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 1)
+	assert.Equal(t, "k", resp.Results[0].Key)
+	assert.Equal(t, `{"a":1}`, string(resp.Results[0].Data))
+}
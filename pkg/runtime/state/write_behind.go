@@ -0,0 +1,602 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dapr/components-contrib/state"
+	"mosn.io/pkg/log"
+	"mosn.io/pkg/utils"
+
+	"mosn.io/layotto/pkg/runtime/budget"
+)
+
+const (
+	defaultWriteBehindBatchSize     = 100
+	defaultWriteBehindFlushInterval = 100 * time.Millisecond
+	defaultWriteBehindMaxPending    = 10000
+	walSuffix                       = ".wal"
+	// walHeaderSize is the length of a record, which is followed by the record in JSON
+	walHeaderSize = 4
+	// writeBehindOpSize is the estimated memory of an operation besides its key and value
+	writeBehindOpSize = 64
+)
+
+var (
+	ErrWriteBehindDirEmpty = errors.New("dir of write-behind is empty")
+	// ErrWriteBehindFull is returned when there are too many keys pending, the client should retry later.
+	ErrWriteBehindFull   = errors.New("write-behind queue is full")
+	ErrWriteBehindClosed = errors.New("write-behind store is closed")
+)
+
+// WriteBehindConfig is the config of the write-behind mode of a state store.
+type WriteBehindConfig struct {
+	// Dir is where the write-ahead logs are saved, the logs of a store are in the sub directory named by the store.
+	Dir string `json:"dir"`
+	// BatchSize is the max number of keys written in a bulk request, the default value is 100.
+	BatchSize int `json:"batch_size"`
+	// FlushIntervalMs is the max delay of writing to the store, the default value is 100.
+	FlushIntervalMs int `json:"flush_interval_ms"`
+	// MaxPending is the max number of keys which aren't written to the store, the default value is 10000.
+	MaxPending int `json:"max_pending"`
+	// Fsync syncs the log to the disk before acknowledging, otherwise the writes may be lost if the machine crashes.
+	Fsync bool `json:"fsync"`
+}
+
+// writeBehindOp is the record of the write-ahead log, only the last one of a key is kept in memory.
+type writeBehindOp struct {
+	Key      string            `json:"k"`
+	Value    []byte            `json:"v,omitempty"`
+	Delete   bool              `json:"d,omitempty"`
+	Metadata map[string]string `json:"m,omitempty"`
+}
+
+func (op *writeBehindOp) size() int64 {
+	return int64(len(op.Key)+len(op.Value)) + writeBehindOpSize
+}
+
+// writeBehindStore acknowledges the writes once they're saved in the write-ahead log,
+// and the writes are batched to the store in background. The pending values are visible to Get.
+// The writes with etag or first-write concurrency and the transactions are written synchronously after the pending ones.
+type writeBehindStore struct {
+	state.Store
+	name      string
+	dir       string
+	batchSize int
+	interval  time.Duration
+	max       int
+	fsync     bool
+
+	mu       sync.Mutex
+	pending  map[string]*writeBehindOp
+	flushing map[string]*writeBehindOp
+	// bytes is the memory of the pending and flushing operations
+	bytes   int64
+	segment *os.File
+	seq     uint64
+	closed  bool
+
+	// flushMu serializes the flushes
+	flushMu sync.Mutex
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// writeBehindTransactionalStore keeps the transaction capability of the store
+type writeBehindTransactionalStore struct {
+	*writeBehindStore
+	transactional state.TransactionalStore
+}
+
+// writeBehindQuerierStore keeps the query capability of the store, the pending operations are flushed before a query,
+// so that the results include them.
+type writeBehindQuerierStore struct {
+	*writeBehindStore
+	querier state.Querier
+}
+
+type writeBehindTransactionalQuerierStore struct {
+	*writeBehindTransactionalStore
+	querier state.Querier
+}
+
+// WriteBehindStore is the store returned by NewWriteBehindStore
+type WriteBehindStore interface {
+	state.Store
+	budget.Consumer
+	// Flush writes the pending operations to the store
+	Flush() error
+	// Close flushes and stops writing in background
+	Close() error
+}
+
+// NewWriteBehindStore wraps the store with the write-behind mode, the operations in the logs are replayed first.
+func NewWriteBehindStore(name string, store state.Store, cfg *WriteBehindConfig) (WriteBehindStore, error) {
+	if cfg.Dir == "" {
+		return nil, ErrWriteBehindDirEmpty
+	}
+	w := &writeBehindStore{
+		Store:     store,
+		name:      name,
+		dir:       filepath.Join(cfg.Dir, name),
+		batchSize: defaultWriteBehindBatchSize,
+		interval:  defaultWriteBehindFlushInterval,
+		max:       defaultWriteBehindMaxPending,
+		fsync:     cfg.Fsync,
+		pending:   make(map[string]*writeBehindOp),
+		flushCh:   make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	if cfg.BatchSize > 0 {
+		w.batchSize = cfg.BatchSize
+	}
+	if cfg.FlushIntervalMs > 0 {
+		w.interval = time.Duration(cfg.FlushIntervalMs) * time.Millisecond
+	}
+	if cfg.MaxPending > 0 {
+		w.max = cfg.MaxPending
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := w.replay(); err != nil {
+		return nil, err
+	}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	utils.GoWithRecover(w.run, nil)
+	if len(w.pending) > 0 {
+		log.DefaultLogger.Infof("[runtime] [state.write_behind] %d operations of store %s are replayed", len(w.pending), name)
+		w.trigger()
+	}
+	t, transactional := store.(state.TransactionalStore)
+	q, querier := store.(state.Querier)
+	switch {
+	case transactional && querier:
+		return &writeBehindTransactionalQuerierStore{writeBehindTransactionalStore: &writeBehindTransactionalStore{writeBehindStore: w, transactional: t}, querier: q}, nil
+	case transactional:
+		return &writeBehindTransactionalStore{writeBehindStore: w, transactional: t}, nil
+	case querier:
+		return &writeBehindQuerierStore{writeBehindStore: w, querier: q}, nil
+	}
+	return w, nil
+}
+
+func (w *writeBehindQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return w.querier.Query(req)
+}
+
+func (w *writeBehindTransactionalQuerierStore) Query(req *state.QueryRequest) (*state.QueryResponse, error) {
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return w.querier.Query(req)
+}
+
+func (w *writeBehindStore) Get(req *state.GetRequest) (*state.GetResponse, error) {
+	w.mu.Lock()
+	op := w.lookup(req.Key)
+	w.mu.Unlock()
+	if op == nil {
+		return w.Store.Get(req)
+	}
+	if op.Delete {
+		return &state.GetResponse{}, nil
+	}
+	return &state.GetResponse{Data: op.Value}, nil
+}
+
+// BulkGet returns unsupported if any key is pending, so that the keys are got one by one
+func (w *writeBehindStore) BulkGet(req []state.GetRequest) (bool, []state.BulkGetResponse, error) {
+	w.mu.Lock()
+	for i := range req {
+		if w.lookup(req[i].Key) != nil {
+			w.mu.Unlock()
+			return false, nil, nil
+		}
+	}
+	w.mu.Unlock()
+	return w.Store.BulkGet(req)
+}
+
+func (w *writeBehindStore) Set(req *state.SetRequest) error {
+	if needSync(req.ETag, req.Options.Concurrency) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return w.Store.Set(req)
+	}
+	op, err := newSetOp(req)
+	if err != nil {
+		return err
+	}
+	return w.append(op)
+}
+
+func (w *writeBehindStore) BulkSet(req []state.SetRequest) error {
+	for i := range req {
+		if needSync(req[i].ETag, req[i].Options.Concurrency) {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return w.Store.BulkSet(req)
+		}
+	}
+	for i := range req {
+		op, err := newSetOp(&req[i])
+		if err != nil {
+			return err
+		}
+		if err = w.append(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *writeBehindStore) Delete(req *state.DeleteRequest) error {
+	if needSync(req.ETag, req.Options.Concurrency) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return w.Store.Delete(req)
+	}
+	return w.append(&writeBehindOp{Key: req.Key, Delete: true, Metadata: req.Metadata})
+}
+
+func (w *writeBehindStore) BulkDelete(req []state.DeleteRequest) error {
+	for i := range req {
+		if needSync(req[i].ETag, req[i].Options.Concurrency) {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return w.Store.BulkDelete(req)
+		}
+	}
+	for i := range req {
+		if err := w.append(&writeBehindOp{Key: req[i].Key, Delete: true, Metadata: req[i].Metadata}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multi is executed synchronously after the pending operations are written
+func (w *writeBehindTransactionalStore) Multi(req *state.TransactionalStateRequest) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return w.transactional.Multi(req)
+}
+
+// Flush writes the pending operations to the store. The logs are removed after they're written successfully,
+// otherwise the operations are kept pending and retried later.
+func (w *writeBehindStore) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	if len(w.pending) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	// the operations after the rotation are logged in the new segment, which is kept after the flush
+	if err := w.rotate(); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	seq := w.seq
+	snapshot := w.pending
+	w.pending = make(map[string]*writeBehindOp)
+	w.flushing = snapshot
+	w.mu.Unlock()
+
+	err := w.write(snapshot)
+
+	w.mu.Lock()
+	w.flushing = nil
+	for key, op := range snapshot {
+		// the operations which failed are pending again unless they're overwritten
+		if _, ok := w.pending[key]; err != nil && !ok {
+			w.pending[key] = op
+			continue
+		}
+		w.bytes -= op.size()
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.removeSegmentsBefore(seq)
+}
+
+// Close flushes the pending operations and stops writing in background
+func (w *writeBehindStore) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stopCh)
+	<-w.doneCh
+	err := w.Flush()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e := w.segment.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// MemoryUsage implements budget.Consumer
+func (w *writeBehindStore) MemoryUsage() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bytes
+}
+
+func (w *writeBehindStore) run() {
+	defer close(w.doneCh)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		case <-w.flushCh:
+		}
+		if err := w.Flush(); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [state.write_behind] flush store %s error: %v", w.name, err)
+		}
+	}
+}
+
+func (w *writeBehindStore) trigger() {
+	select {
+	case w.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// append logs the operation and makes it pending
+func (w *writeBehindStore) append(op *writeBehindOp) error {
+	size := op.size()
+	if !budget.Allow(size) {
+		return budget.ErrMemoryBudgetExceeded
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriteBehindClosed
+	}
+	old, exists := w.pending[op.Key]
+	if !exists && len(w.pending) >= w.max {
+		w.mu.Unlock()
+		w.trigger()
+		return ErrWriteBehindFull
+	}
+	if err := w.log(op); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	if exists {
+		w.bytes -= old.size()
+	}
+	w.pending[op.Key] = op
+	w.bytes += size
+	n := len(w.pending)
+	w.mu.Unlock()
+	if n >= w.batchSize {
+		w.trigger()
+	}
+	return nil
+}
+
+// write sends the operations to the store in batches
+func (w *writeBehindStore) write(ops map[string]*writeBehindOp) error {
+	var (
+		sets    []state.SetRequest
+		deletes []state.DeleteRequest
+	)
+	for _, op := range ops {
+		if op.Delete {
+			deletes = append(deletes, state.DeleteRequest{Key: op.Key, Metadata: op.Metadata})
+		} else {
+			sets = append(sets, state.SetRequest{Key: op.Key, Value: op.Value, Metadata: op.Metadata})
+		}
+	}
+	for i := 0; i < len(sets); i += w.batchSize {
+		end := i + w.batchSize
+		if end > len(sets) {
+			end = len(sets)
+		}
+		if err := w.Store.BulkSet(sets[i:end]); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(deletes); i += w.batchSize {
+		end := i + w.batchSize
+		if end > len(deletes) {
+			end = len(deletes)
+		}
+		if err := w.Store.BulkDelete(deletes[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the latest operation of the key which isn't written to the store, it should be called with the lock
+func (w *writeBehindStore) lookup(key string) *writeBehindOp {
+	if op, ok := w.pending[key]; ok {
+		return op
+	}
+	return w.flushing[key]
+}
+
+// log appends the operation to the current segment, it should be called with the lock
+func (w *writeBehindStore) log(op *writeBehindOp) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, walHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[walHeaderSize:], data)
+	if _, err = w.segment.Write(record); err != nil {
+		return err
+	}
+	if w.fsync {
+		return w.segment.Sync()
+	}
+	return nil
+}
+
+// rotate closes the current segment and creates a new one, it should be called with the lock
+func (w *writeBehindStore) rotate() error {
+	f, err := os.OpenFile(w.segmentPath(w.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if w.segment != nil {
+		if err = w.segment.Close(); err != nil {
+			log.DefaultLogger.Errorf("[runtime] [state.write_behind] close segment of store %s error: %v", w.name, err)
+		}
+	}
+	w.segment = f
+	w.seq++
+	return nil
+}
+
+// replay loads the operations in the segments, the incomplete record at the end of a segment is ignored
+func (w *writeBehindStore) replay() error {
+	seqs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		data, err := ioutil.ReadFile(w.segmentPath(seq))
+		if err != nil {
+			return err
+		}
+		for len(data) >= walHeaderSize {
+			n := int(binary.BigEndian.Uint32(data))
+			if len(data) < walHeaderSize+n {
+				break
+			}
+			op := &writeBehindOp{}
+			if err = json.Unmarshal(data[walHeaderSize:walHeaderSize+n], op); err != nil {
+				return fmt.Errorf("corrupted write-ahead log %s: %v", w.segmentPath(seq), err)
+			}
+			if old, ok := w.pending[op.Key]; ok {
+				w.bytes -= old.size()
+			}
+			w.pending[op.Key] = op
+			w.bytes += op.size()
+			data = data[walHeaderSize+n:]
+		}
+		w.seq = seq
+	}
+	return nil
+}
+
+func (w *writeBehindStore) removeSegmentsBefore(seq uint64) error {
+	seqs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s >= seq {
+			break
+		}
+		if err = os.Remove(w.segmentPath(s)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// segments returns the sequences of the segments in order
+func (w *writeBehindStore) segments() ([]uint64, error) {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), walSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), walSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (w *writeBehindStore) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", seq, walSuffix))
+}
+
+func needSync(etag *string, concurrency string) bool {
+	return (etag != nil && *etag != "") || concurrency == state.FirstWrite
+}
+
+func newSetOp(req *state.SetRequest) (*writeBehindOp, error) {
+	op := &writeBehindOp{Key: req.Key, Metadata: req.Metadata}
+	switch v := req.Value.(type) {
+	case []byte:
+		op.Value = v
+	case string:
+		op.Value = []byte(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		op.Value = b
+	}
+	return op, nil
+}
+
+// Unwrap implements Wrapper, so that the capabilities like listing keys are kept
+func (w *writeBehindStore) Unwrap() state.Store {
+	return w.Store
+}
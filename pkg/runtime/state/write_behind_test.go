@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_state "mosn.io/layotto/pkg/mock/components/state"
+)
+
+func TestWriteBehindStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write_behind")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctrl := gomock.NewController(t)
+	store := mock_state.NewMockStore(ctrl)
+	cfg := &WriteBehindConfig{Dir: dir, BatchSize: 100, FlushIntervalMs: 3600000, MaxPending: 2}
+	s, err := NewWriteBehindStore("mock", store, cfg)
+	assert.Nil(t, err)
+	_, ok := s.(state.TransactionalStore)
+	assert.False(t, ok)
+
+	// the pending writes are visible without reading the store
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k1", Value: []byte("v1")}))
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k1", Value: []byte("v2")}))
+	assert.Nil(t, s.Delete(&state.DeleteRequest{Key: "k2"}))
+	resp, err := s.Get(&state.GetRequest{Key: "k1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(resp.Data))
+	resp, err = s.Get(&state.GetRequest{Key: "k2"})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Data)
+	ok, _, err = s.BulkGet([]state.GetRequest{{Key: "k1"}})
+	assert.False(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrWriteBehindFull, s.Set(&state.SetRequest{Key: "k3", Value: []byte("v3")}))
+	assert.True(t, s.MemoryUsage() > 0)
+
+	// the logs are replayed by another store, and the failed writes are retried
+	other := mock_state.NewMockStore(ctrl)
+	replayed, err := NewWriteBehindStore("mock", other, cfg)
+	assert.Nil(t, err)
+	w := s.(*writeBehindStore)
+	close(w.stopCh)
+	<-w.doneCh
+	other.EXPECT().BulkSet(gomock.Any()).Return(errors.New("unavailable"))
+	assert.NotNil(t, replayed.Flush())
+	other.EXPECT().BulkSet([]state.SetRequest{{Key: "k1", Value: []byte("v2")}}).Return(nil)
+	other.EXPECT().BulkDelete([]state.DeleteRequest{{Key: "k2"}}).Return(nil)
+	assert.Nil(t, replayed.Flush())
+	assert.Equal(t, int64(0), replayed.MemoryUsage())
+	other.EXPECT().Get(gomock.Any()).Return(&state.GetResponse{Data: []byte("v2")}, nil)
+	resp, err = replayed.Get(&state.GetRequest{Key: "k1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(resp.Data))
+
+	// the writes with etag are synchronous
+	etag := "1"
+	other.EXPECT().Set(gomock.Any()).Return(nil)
+	assert.Nil(t, replayed.Set(&state.SetRequest{Key: "k1", Value: []byte("v3"), ETag: &etag}))
+	assert.Nil(t, replayed.Close())
+	assert.Equal(t, ErrWriteBehindClosed, replayed.Set(&state.SetRequest{Key: "k1", Value: []byte("v4")}))
+}
+
+func TestWriteBehindStoreQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write_behind")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := NewWriteBehindStore("mem", &memQuerierStore{memStore: newMemStore()}, &WriteBehindConfig{Dir: dir, FlushIntervalMs: 3600000})
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Nil(t, s.Set(&state.SetRequest{Key: "k", Value: []byte("v")}))
+
+	// the pending writes are flushed before the query
+	resp, err := s.(state.Querier).Query(&state.QueryRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Results, 1)
+	assert.Equal(t, "v", string(resp.Results[0].Data))
+}
@@ -0,0 +1,427 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dapr/components-contrib/bindings"
+	"github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/components-contrib/secretstores"
+	"github.com/dapr/components-contrib/state"
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mosn.io/layotto/components/configstores"
+	"mosn.io/layotto/components/file"
+	"mosn.io/layotto/components/hello"
+	"mosn.io/layotto/components/lock"
+	"mosn.io/layotto/components/rpc"
+	"mosn.io/layotto/components/sequencer"
+	"mosn.io/layotto/pkg/grpc"
+	runtime_pubsub "mosn.io/layotto/pkg/runtime/pubsub"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+	"mosn.io/pkg/log"
+)
+
+// AppIdMetadataKey is the key of the grpc metadata carrying the id of the app sending the request,
+// the requests without it are served as the main app
+const AppIdMetadataKey = "layotto-app-id"
+
+// AppTokenMetadataKey is the key of the grpc metadata carrying the token authenticating the app sending the request,
+// which is required if there are tenants
+const AppTokenMetadataKey = "layotto-app-token"
+
+// ErrAppTokensEmpty is returned if there are tenants but an app doesn't have the tokens authenticating it
+var ErrAppTokensEmpty = errors.New("the tokens of the apps are required if there are tenants and shouldn't be empty")
+
+// TenantConfig is the config of an app served by the runtime besides the main app
+type TenantConfig struct {
+	// GrpcCallbackPort is the port of the AppCallback service of the app
+	GrpcCallbackPort int `json:"grpc_callback_port"`
+	// HttpCallback delivers topic events to the app over HTTP instead of the gRPC AppCallback service
+	HttpCallback *runtime_pubsub.HTTPCallbackConfig `json:"http_callback,omitempty"`
+	// Tokens authenticate the requests of the app, a request is served as the app if it carries any of them
+	Tokens []string `json:"tokens"`
+	// Components maps the API groups to the names of the components the app can use,
+	// the app can't call the API groups not listed
+	Components map[string][]string `json:"components"`
+}
+
+// tenant is an app served by the runtime, including the main app
+type tenant struct {
+	// groups are the API groups the app can call, all of them if it's nil
+	groups map[string]bool
+	// apis maps the GrpcAPIs registered on the grpc server to the ones of the app,
+	// the registered ones serve the app if they're not in it
+	apis map[interface{}]interface{}
+}
+
+// routeTable maps the app ids to the apps served with a generation of components
+type routeTable map[string]*tenant
+
+// subscriptionMethods are served by the first generation of GrpcAPIs, which hold the subscriptions of the apps
+var subscriptionMethods = map[string]bool{
+	"GetMetadata":  true,
+	"GetReadiness": true,
+}
+
+// appToken is a token authenticating an app
+type appToken struct {
+	appId string
+	token []byte
+}
+
+// appTokens collects the tokens of the apps, which are nil if there are no tenants
+func appTokens(cfg *MosnRuntimeConfig) ([]appToken, error) {
+	if len(cfg.Tenants) == 0 {
+		return nil, nil
+	}
+	apps := make(map[string][]string, len(cfg.Tenants)+1)
+	apps[cfg.AppManagement.AppId] = cfg.AppManagement.Tokens
+	for appId, t := range cfg.Tenants {
+		apps[appId] = t.Tokens
+	}
+	var res []appToken
+	owners := make(map[string]string)
+	for appId, tokens := range apps {
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("%w: app %s", ErrAppTokensEmpty, appId)
+		}
+		for _, token := range tokens {
+			if token == "" {
+				return nil, fmt.Errorf("%w: app %s", ErrAppTokensEmpty, appId)
+			}
+			if owner, ok := owners[token]; ok && owner != appId {
+				return nil, fmt.Errorf("the apps %s and %s share a token, which should authenticate one app only", owner, appId)
+			}
+			owners[token] = appId
+			res = append(res, appToken{appId: appId, token: []byte(token)})
+		}
+	}
+	return res, nil
+}
+
+// apiRouter routes the requests to the GrpcAPIs of the app authenticated by the metadata,
+// which are created with the latest generation of components
+type apiRouter struct {
+	mainAppId string
+	// tokens authenticate the apps, the app id in the metadata is trusted if it's empty, i.e. there are no tenants
+	tokens []appToken
+	// subscribers is the first generation
+	subscribers routeTable
+	// current is the routeTable of the latest generation
+	current atomic.Value
+}
+
+func newAPIRouter(mainAppId string, routes routeTable, tokens []appToken) *apiRouter {
+	r := &apiRouter{mainAppId: mainAppId, tokens: tokens, subscribers: routes}
+	r.current.Store(routes)
+	return r
+}
+
+// update routes the requests to a new generation
+func (r *apiRouter) update(routes routeTable) {
+	r.current.Store(routes)
+}
+
+// authenticate returns the id of the app sending the request
+func (r *apiRouter) authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var appId string
+	if ids := md.Get(AppIdMetadataKey); len(ids) > 0 {
+		appId = ids[0]
+	}
+	if r.tokens == nil {
+		if appId == "" {
+			return r.mainAppId, nil
+		}
+		return appId, nil
+	}
+	tokens := md.Get(AppTokenMetadataKey)
+	if len(tokens) == 0 {
+		return "", status.Errorf(codes.Unauthenticated, "the metadata %s is required", AppTokenMetadataKey)
+	}
+	for _, token := range tokens {
+		for _, expected := range r.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), expected.token) != 1 {
+				continue
+			}
+			if appId != "" && appId != expected.appId {
+				return "", status.Errorf(codes.PermissionDenied, "the app token doesn't authenticate app %s", appId)
+			}
+			return expected.appId, nil
+		}
+	}
+	return "", status.Error(codes.PermissionDenied, "the app token is invalid")
+}
+
+// route returns the server handling the request, which is nil if the registered server handles it.
+// The request is nil for the streaming methods.
+func (r *apiRouter) route(ctx context.Context, fullMethod string, srv interface{}, req interface{}) (interface{}, error) {
+	appId, err := r.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var method string
+	if strings.HasPrefix(fullMethod, runtimeServicePrefix) {
+		method = strings.TrimPrefix(fullMethod, runtimeServicePrefix)
+	}
+	routes := r.current.Load().(routeTable)
+	if subscriptionMethods[method] {
+		routes = r.subscribers
+	}
+	t, ok := routes[appId]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "app %s isn't served by the runtime", appId)
+	}
+	if group, ok := methodGroups[method]; ok && group != groupShared && t.groups != nil && !t.groups[group] {
+		return nil, status.Errorf(codes.PermissionDenied, "app %s isn't allowed to call %s", appId, fullMethod)
+	}
+	for _, group := range batchGroups(req) {
+		if t.groups != nil && !t.groups[group] {
+			return nil, status.Errorf(codes.PermissionDenied, "app %s isn't allowed to call the API group %s in %s", appId, group, fullMethod)
+		}
+	}
+	// the services without the instances of the app, e.g. the health service, are shared by all the apps
+	return t.apis[srv], nil
+}
+
+// UnaryInterceptor calls the method on the server of the app in the metadata
+func (r *apiRouter) UnaryInterceptor(ctx context.Context, req interface{}, info *rawGRPC.UnaryServerInfo, handler rawGRPC.UnaryHandler) (interface{}, error) {
+	srv, err := r.route(ctx, info.FullMethod, info.Server, req)
+	if err != nil {
+		return nil, err
+	}
+	if srv == nil {
+		return handler(ctx, req)
+	}
+	method := reflect.ValueOf(srv).MethodByName(info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:])
+	if !method.IsValid() {
+		return nil, status.Errorf(codes.Unimplemented, "method %s not implemented", info.FullMethod)
+	}
+	out := method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
+	err, _ = out[1].Interface().(error)
+	return out[0].Interface(), err
+}
+
+// StreamInterceptor calls the streaming method on the server of the app in the metadata
+func (r *apiRouter) StreamInterceptor(srv interface{}, ss rawGRPC.ServerStream, info *rawGRPC.StreamServerInfo, handler rawGRPC.StreamHandler) error {
+	appSrv, err := r.route(ss.Context(), info.FullMethod, srv, nil)
+	if err != nil {
+		return err
+	}
+	if appSrv == nil {
+		return handler(srv, ss)
+	}
+	return handler(appSrv, ss)
+}
+
+// tenantComponents collects the components the app can use
+type tenantComponents struct {
+	hellos         map[string]hello.HelloService
+	configStores   map[string]configstores.Store
+	rpcs           map[string]rpc.Invoker
+	pubSubs        map[string]pubsub.PubSub
+	states         map[string]state.Store
+	files          map[string]file.File
+	locks          map[string]lock.LockStore
+	sequencers     map[string]sequencer.Store
+	outputBindings map[string]bool
+	secretStores   map[string]secretstores.SecretStore
+}
+
+// newTenantComponents picks the components listed in the config of the app
+func (m *MosnRuntime) newTenantComponents(appId string, cfg *TenantConfig) (*tenantComponents, error) {
+	c := &tenantComponents{
+		hellos:         make(map[string]hello.HelloService),
+		configStores:   make(map[string]configstores.Store),
+		rpcs:           make(map[string]rpc.Invoker),
+		pubSubs:        make(map[string]pubsub.PubSub),
+		states:         make(map[string]state.Store),
+		files:          make(map[string]file.File),
+		locks:          make(map[string]lock.LockStore),
+		sequencers:     make(map[string]sequencer.Store),
+		outputBindings: make(map[string]bool),
+		secretStores:   make(map[string]secretstores.SecretStore),
+	}
+	for group, names := range cfg.Components {
+		for _, name := range names {
+			var ok bool
+			switch group {
+			case GroupHello:
+				c.hellos[name], ok = m.hellos[name]
+			case GroupConfiguration:
+				c.configStores[name], ok = m.configStores[name]
+			case GroupRpc:
+				c.rpcs[name], ok = m.rpcs[name]
+			case GroupPubSub:
+				c.pubSubs[name], ok = m.pubSubs[name]
+			case GroupState:
+				c.states[name], ok = m.states[name]
+				if ok {
+					ok = appIdPrefixed(m.runtimeConfig.StateManagement[name].Metadata)
+				}
+			case GroupFile:
+				c.files[name], ok = m.files[name]
+			case GroupLock:
+				c.locks[name], ok = m.locks[name]
+				if ok {
+					ok = appIdPrefixed(m.runtimeConfig.LockManagement[name].Metadata)
+				}
+			case GroupSequencer:
+				c.sequencers[name], ok = m.sequencers[name]
+				if ok {
+					ok = appIdPrefixed(m.runtimeConfig.SequencerManagement[name].Metadata)
+				}
+			case GroupBinding:
+				_, ok = m.outputBindings[name]
+				c.outputBindings[name] = true
+			case GroupSecret:
+				c.secretStores[name], ok = m.secretStores[name]
+			default:
+				return nil, fmt.Errorf("unknown API group %q of app %s, expected one of %s", group, appId, strings.Join(allGroups, ", "))
+			}
+			if !ok {
+				return nil, fmt.Errorf("component %s of API group %s can't be used by app %s, "+
+					"it doesn't exist or it doesn't prefix the keys with the app id", name, group, appId)
+			}
+		}
+	}
+	return c, nil
+}
+
+// appIdPrefixed reports whether the keys of the store are prefixed with the app id, so the apps sharing it are isolated
+func appIdPrefixed(metadata map[string]string) bool {
+	strategy := strings.ToLower(metadata["keyPrefix"])
+	return strategy == "" || strategy == "appid"
+}
+
+// sendToOutputBinding invokes the output bindings the app can use only
+func (c *tenantComponents) sendToOutputBinding(send func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error)) func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+	return func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error) {
+		if !c.outputBindings[name] {
+			return nil, fmt.Errorf("couldn't find output binding %s", name)
+		}
+		return send(name, req)
+	}
+}
+
+// listOutputBindings lists the output bindings the app can use only
+func (c *tenantComponents) listOutputBindings(list func() map[string][]bindings.OperationKind) func() map[string][]bindings.OperationKind {
+	return func() map[string][]bindings.OperationKind {
+		res := make(map[string][]bindings.OperationKind, len(c.outputBindings))
+		for name, ops := range list() {
+			if c.outputBindings[name] {
+				res[name] = ops
+			}
+		}
+		return res
+	}
+}
+
+// newRoutes creates the GrpcAPIs of the apps with the components of the runtime.
+// The first generation connects to the apps to subscribe the topics, and the GrpcAPIs registered serve the main app in it,
+// while the later generations are created after the components are reconciled, which serve the requests only.
+func (m *MosnRuntime) newRoutes(factories []grpc.NewGrpcAPI, registered []grpc.GrpcAPI, first bool) (routeTable, error) {
+	mainAppId := m.runtimeConfig.AppManagement.AppId
+	routes := make(routeTable, len(m.runtimeConfig.Tenants)+1)
+	main := &tenant{apis: make(map[interface{}]interface{}, len(registered))}
+	if !first {
+		ac := m.applicationContext()
+		ac.AppCallback = nil
+		if err := main.newAPIs(factories, registered, ac, nil); err != nil {
+			return nil, err
+		}
+	}
+	routes[mainAppId] = main
+	for appId, cfg := range m.runtimeConfig.Tenants {
+		if appId == "" || appId == mainAppId {
+			return nil, fmt.Errorf("[runtime] illegal app id %q of tenant, it should be non-empty and differ from the main app", appId)
+		}
+		// 1. pick the components
+		comps, err := m.newTenantComponents(appId, &cfg)
+		if err != nil {
+			m.errInt(err, "init tenant %s failed", appId)
+			return nil, err
+		}
+		// 2. connect to the app
+		var conn *rawGRPC.ClientConn
+		var callback runtimev1pb.AppCallbackClient
+		if first && cfg.HttpCallback != nil {
+			if callback, err = runtime_pubsub.NewHTTPAppCallback(*cfg.HttpCallback); err != nil {
+				m.errInt(err, "init http callback of tenant %s failed", appId)
+				return nil, err
+			}
+		} else if first && cfg.GrpcCallbackPort != 0 {
+			if conn, err = dialAppCallback(cfg.GrpcCallbackPort); err != nil {
+				return nil, err
+			}
+		}
+		// 3. create the GrpcAPIs, which subscribe the topics of the app
+		ac := &grpc.ApplicationContext{
+			AppId:                 appId,
+			Hellos:                comps.hellos,
+			ConfigStores:          comps.configStores,
+			Rpcs:                  comps.rpcs,
+			PubSubs:               comps.pubSubs,
+			StateStores:           comps.states,
+			Files:                 comps.files,
+			LockStores:            comps.locks,
+			Sequencers:            comps.sequencers,
+			SendToOutputBindingFn: comps.sendToOutputBinding(outputBindingSender(m.outputBindings, m.runtimeConfig.Bindings)),
+			SecretStores:          comps.secretStores,
+			ListOutputBindingsFn:  comps.listOutputBindings(outputBindingLister(m.outputBindings)),
+			AppCallback:           callback,
+		}
+		t := &tenant{
+			groups: make(map[string]bool, len(cfg.Components)),
+			apis:   make(map[interface{}]interface{}, len(registered)),
+		}
+		for group := range cfg.Components {
+			t.groups[group] = true
+		}
+		if err := t.newAPIs(factories, registered, ac, conn); err != nil {
+			return nil, err
+		}
+		routes[appId] = t
+		if first {
+			log.DefaultLogger.Infof("[runtime] serve the app %s besides the main app", appId)
+		}
+	}
+	return routes, nil
+}
+
+// newAPIs creates and inits the GrpcAPIs of the app
+func (t *tenant) newAPIs(factories []grpc.NewGrpcAPI, registered []grpc.GrpcAPI, ac *grpc.ApplicationContext, conn *rawGRPC.ClientConn) error {
+	for i, apiFactory := range factories {
+		api := apiFactory(ac)
+		if err := api.Init(conn); err != nil {
+			return err
+		}
+		t.apis[registered[i]] = api
+	}
+	return nil
+}
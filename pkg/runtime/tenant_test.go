@@ -0,0 +1,221 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rawGRPC "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeAppServer struct {
+	appId string
+}
+
+func (s *fakeAppServer) GetState(ctx context.Context, req *string) (*string, error) {
+	resp := s.appId + ":" + *req
+	return &resp, nil
+}
+
+func (s *fakeAppServer) TryLock(ctx context.Context, req *string) (*string, error) {
+	return nil, status.Error(codes.Internal, "unreachable")
+}
+
+type fakeServerStream struct {
+	rawGRPC.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func withAppId(appId string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AppIdMetadataKey, appId))
+}
+
+func withAppToken(token string, kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(append(kv, AppTokenMetadataKey, token)...))
+}
+
+func TestTenantRouter(t *testing.T) {
+	mainSrv := &fakeAppServer{appId: "main"}
+	appSrv := &fakeAppServer{appId: "app1"}
+	routes := routeTable{
+		"main": {apis: map[interface{}]interface{}{}},
+		"app1": {
+			groups: map[string]bool{GroupState: true},
+			apis:   map[interface{}]interface{}{mainSrv: appSrv},
+		},
+	}
+	r := newAPIRouter("main", routes, nil)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return mainSrv.GetState(ctx, req.(*string))
+	}
+	info := &rawGRPC.UnaryServerInfo{Server: mainSrv, FullMethod: runtimeServicePrefix + "GetState"}
+	key := "k"
+
+	t.Run("main app", func(t *testing.T) {
+		resp, err := r.UnaryInterceptor(context.Background(), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "main:k", *resp.(*string))
+		resp, err = r.UnaryInterceptor(withAppId("main"), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "main:k", *resp.(*string))
+	})
+
+	t.Run("tenant", func(t *testing.T) {
+		resp, err := r.UnaryInterceptor(withAppId("app1"), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "app1:k", *resp.(*string))
+	})
+
+	t.Run("unknown app", func(t *testing.T) {
+		_, err := r.UnaryInterceptor(withAppId("app2"), &key, info, handler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("API group not allowed", func(t *testing.T) {
+		lockInfo := &rawGRPC.UnaryServerInfo{Server: mainSrv, FullMethod: runtimeServicePrefix + "TryLock"}
+		_, err := r.UnaryInterceptor(withAppId("app1"), &key, lockInfo, handler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("shared service", func(t *testing.T) {
+		healthInfo := &rawGRPC.UnaryServerInfo{Server: "health", FullMethod: "/grpc.health.v1.Health/Check"}
+		resp, err := r.UnaryInterceptor(withAppId("app1"), &key, healthInfo, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "main:k", *resp.(*string))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var served interface{}
+		streamHandler := func(srv interface{}, stream rawGRPC.ServerStream) error {
+			served = srv
+			return nil
+		}
+		streamInfo := &rawGRPC.StreamServerInfo{FullMethod: runtimeServicePrefix + "SubscribeConfiguration"}
+		err := r.StreamInterceptor(mainSrv, &fakeServerStream{ctx: context.Background()}, streamInfo, streamHandler)
+		assert.Nil(t, err)
+		assert.Equal(t, mainSrv, served)
+		// the API group isn't allowed
+		err = r.StreamInterceptor(mainSrv, &fakeServerStream{ctx: withAppId("app1")}, streamInfo, streamHandler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		routes["app1"].groups[GroupConfiguration] = true
+		err = r.StreamInterceptor(mainSrv, &fakeServerStream{ctx: withAppId("app1")}, streamInfo, streamHandler)
+		assert.Nil(t, err)
+		assert.Equal(t, appSrv, served)
+	})
+
+	t.Run("new generation", func(t *testing.T) {
+		nextSrv := &fakeAppServer{appId: "next"}
+		r.update(routeTable{
+			"main": {apis: map[interface{}]interface{}{mainSrv: nextSrv}},
+			"app1": routes["app1"],
+		})
+		resp, err := r.UnaryInterceptor(context.Background(), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "next:k", *resp.(*string))
+		// the subscriptions are held by the first generation
+		subInfo := &rawGRPC.UnaryServerInfo{Server: mainSrv, FullMethod: runtimeServicePrefix + "GetReadiness"}
+		subHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "first", nil
+		}
+		resp, err = r.UnaryInterceptor(context.Background(), &key, subInfo, subHandler)
+		assert.Nil(t, err)
+		assert.Equal(t, "first", resp)
+	})
+}
+
+func TestTenantRouter_Tokens(t *testing.T) {
+	mainSrv := &fakeAppServer{appId: "main"}
+	appSrv := &fakeAppServer{appId: "app1"}
+	routes := routeTable{
+		"main": {apis: map[interface{}]interface{}{}},
+		"app1": {apis: map[interface{}]interface{}{mainSrv: appSrv}},
+	}
+	tokens, err := appTokens(&MosnRuntimeConfig{
+		AppManagement: AppConfig{AppId: "main", Tokens: []string{"main-token"}},
+		Tenants:       map[string]TenantConfig{"app1": {Tokens: []string{"app1-token", "app1-token2"}}},
+	})
+	assert.Nil(t, err)
+	r := newAPIRouter("main", routes, tokens)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return mainSrv.GetState(ctx, req.(*string))
+	}
+	info := &rawGRPC.UnaryServerInfo{Server: mainSrv, FullMethod: runtimeServicePrefix + "GetState"}
+	key := "k"
+
+	t.Run("authenticated", func(t *testing.T) {
+		resp, err := r.UnaryInterceptor(withAppToken("main-token"), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "main:k", *resp.(*string))
+		resp, err = r.UnaryInterceptor(withAppToken("app1-token2"), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "app1:k", *resp.(*string))
+		resp, err = r.UnaryInterceptor(withAppToken("app1-token", AppIdMetadataKey, "app1"), &key, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "app1:k", *resp.(*string))
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		_, err := r.UnaryInterceptor(context.Background(), &key, info, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = r.UnaryInterceptor(withAppId("main"), &key, info, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := r.UnaryInterceptor(withAppToken("other"), &key, info, handler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("token of another app", func(t *testing.T) {
+		_, err := r.UnaryInterceptor(withAppToken("app1-token", AppIdMetadataKey, "main"), &key, info, handler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestAppTokens(t *testing.T) {
+	tokens, err := appTokens(&MosnRuntimeConfig{AppManagement: AppConfig{AppId: "main"}})
+	assert.Nil(t, err)
+	assert.Nil(t, tokens)
+	_, err = appTokens(&MosnRuntimeConfig{
+		AppManagement: AppConfig{AppId: "main", Tokens: []string{"main-token"}},
+		Tenants:       map[string]TenantConfig{"app1": {Tokens: []string{""}}},
+	})
+	assert.True(t, errors.Is(err, ErrAppTokensEmpty))
+	_, err = appTokens(&MosnRuntimeConfig{
+		AppManagement: AppConfig{AppId: "main", Tokens: []string{"token"}},
+		Tenants:       map[string]TenantConfig{"app1": {Tokens: []string{"token"}}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestAppIdPrefixed(t *testing.T) {
+	assert.True(t, appIdPrefixed(nil))
+	assert.True(t, appIdPrefixed(map[string]string{"keyPrefix": "AppId"}))
+	assert.False(t, appIdPrefixed(map[string]string{"keyPrefix": "none"}))
+	assert.False(t, appIdPrefixed(map[string]string{"keyPrefix": "name"}))
+}
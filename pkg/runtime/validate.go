@@ -0,0 +1,397 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a problem found in the runtime config
+type Diagnostic struct {
+	// Path is the path of the field, e.g. state.redis.metadata
+	Path string
+	// Line is the line of the field in the config, starting from 1. It's 0 if the line is unknown.
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	path := d.Path
+	if path == "" {
+		path = "<root>"
+	}
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", path, d.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", d.Line, path, d.Message)
+}
+
+// ValidateRuntimeConfig checks the runtime config without starting the runtime, and returns the problems found in it:
+//
+//   - the fields unknown to the runtime, which are ignored silently when the config is parsed
+//   - the values of wrong types
+//   - the duplicate names of components or other keys, of which only the last one takes effect
+//   - the metadata of components against the schema declared by them, if the factories are registered by the options
+func ValidateRuntimeConfig(data []byte, opts ...Option) []Diagnostic {
+	// the references are replaced in place, so the lines are kept
+	data, err := interpolateConfig(data)
+	if err != nil {
+		return []Diagnostic{{Message: err.Error()}}
+	}
+	v := &configValidator{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	v.dec.UseNumber()
+	if err := v.value("", reflect.TypeOf(MosnRuntimeConfig{})); err != nil {
+		v.report("", v.offset(), "illegal json: %v", err)
+		return v.diagnostics
+	}
+	if len(v.diagnostics) > 0 {
+		// the metadata may be parsed wrongly
+		return v.diagnostics
+	}
+	cfg := &MosnRuntimeConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		v.report("", 0, "%v", err)
+		return v.diagnostics
+	}
+	v.validateMetadata(cfg, opts...)
+	return v.diagnostics
+}
+
+type configValidator struct {
+	data        []byte
+	dec         *json.Decoder
+	lines       map[string]int
+	diagnostics []Diagnostic
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+)
+
+func (v *configValidator) offset() int64 {
+	return v.dec.InputOffset()
+}
+
+// line returns the line of the offset, starting from 1
+func (v *configValidator) line(offset int64) int {
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	return bytes.Count(v.data[:offset], []byte("\n")) + 1
+}
+
+func (v *configValidator) report(path string, offset int64, format string, args ...interface{}) {
+	line := 0
+	if offset > 0 {
+		line = v.line(offset)
+	}
+	v.diagnostics = append(v.diagnostics, Diagnostic{Path: path, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *configValidator) reportAt(path string, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{Path: path, Line: v.lines[path], Message: fmt.Sprintf(format, args...)})
+}
+
+// value checks the next value in the decoder against the type, t is nil if any value is accepted
+func (v *configValidator) value(path string, t reflect.Type) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// the types decoding themselves are not checked
+	if t != nil && (t == rawMessageType || t.Kind() == reflect.Interface ||
+		reflect.PtrTo(t).Implements(jsonUnmarshalerType)) {
+		t = nil
+	}
+	offset := v.offset()
+	tok, err := v.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '{' {
+			if t != nil && t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+				v.report(path, offset, "expected %s but got an object", typeName(t))
+				t = nil
+			}
+			return v.object(path, t)
+		}
+		if t != nil && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			v.report(path, offset, "expected %s but got an array", typeName(t))
+			t = nil
+		}
+		var elem reflect.Type
+		if t != nil {
+			elem = t.Elem()
+		}
+		for i := 0; v.dec.More(); i++ {
+			if err := v.value(fmt.Sprintf("%s[%d]", path, i), elem); err != nil {
+				return err
+			}
+		}
+		_, err = v.dec.Token()
+		return err
+	case nil:
+		return nil
+	case string:
+		if t != nil && t.Kind() != reflect.String && !reflect.PtrTo(t).Implements(textUnmarshalerType) &&
+			!(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8) {
+			v.report(path, offset, "expected %s but got a string", typeName(t))
+		}
+	case bool:
+		if t != nil && t.Kind() != reflect.Bool {
+			v.report(path, offset, "expected %s but got a bool", typeName(t))
+		}
+	case json.Number:
+		if t == nil {
+			return nil
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if strings.ContainsAny(tok.String(), ".eE") {
+				v.report(path, offset, "expected an integer but got %s", tok)
+			}
+		case reflect.Float32, reflect.Float64:
+		default:
+			v.report(path, offset, "expected %s but got a number", typeName(t))
+		}
+	}
+	return nil
+}
+
+// object checks the fields of the object, whose '{' is read already
+func (v *configValidator) object(path string, t reflect.Type) error {
+	var fields map[string]reflect.Type
+	if t != nil && t.Kind() == reflect.Struct {
+		fields = jsonFields(t)
+	}
+	seen := make(map[string]bool)
+	for v.dec.More() {
+		tok, err := v.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		offset := v.offset()
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		if v.lines == nil {
+			v.lines = make(map[string]int)
+		}
+		v.lines[child] = v.line(offset)
+		if seen[key] {
+			v.report(child, offset, "duplicate key %q, only the last one takes effect", key)
+		}
+		seen[key] = true
+		var ft reflect.Type
+		switch {
+		case fields != nil:
+			var ok bool
+			if ft, ok = lookupField(fields, key); !ok {
+				msg := fmt.Sprintf("unknown field %q", key)
+				if s := suggestField(fields, key); s != "" {
+					msg += fmt.Sprintf(", did you mean %q?", s)
+				}
+				v.report(child, offset, "%s", msg)
+			}
+		case t != nil:
+			ft = t.Elem()
+		}
+		if err := v.value(child, ft); err != nil {
+			return err
+		}
+	}
+	_, err := v.dec.Token()
+	return err
+}
+
+// jsonFields returns the fields of the struct decoded by encoding/json, keyed by the names in json
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			et := f.Type
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				for k, ft := range jsonFields(et) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = ft
+					}
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// lookupField matches the key like encoding/json, which prefers the exact match and falls back to the case-insensitive one
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if ft, ok := fields[key]; ok {
+		return ft, true
+	}
+	for name, ft := range fields {
+		if strings.EqualFold(name, key) {
+			return ft, true
+		}
+	}
+	return nil, false
+}
+
+// suggestField returns the known field closest to the key, or empty if none of them is close
+func suggestField(fields map[string]reflect.Type, key string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if normalize(name) == normalize(key) {
+			return name
+		}
+		if d := editDistance(normalize(name), normalize(key)); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a bool"
+	default:
+		return "a number"
+	}
+}
+
+// validateMetadata checks the metadata of the components against the schema declared by them
+func (v *configValidator) validateMetadata(cfg *MosnRuntimeConfig, opts ...Option) {
+	var o runtimeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := NewMosnRuntime(cfg)
+	m.pubSubRegistry.Register(o.services.pubSubs...)
+	m.stateRegistry.Register(o.services.states...)
+	m.lockRegistry.Register(o.services.locks...)
+	m.sequencerRegistry.Register(o.services.sequencers...)
+	m.bindingsRegistry.RegisterOutputBinding(o.services.outputBinding...)
+	m.secretStoresRegistry.Register(o.services.secretStores...)
+	check := func(key string, name string, registered bool, create func() (interface{}, error), metadata map[string]string) {
+		path := key + "." + name
+		if !registered {
+			return
+		}
+		comp, err := create()
+		if err != nil {
+			v.reportAt(path, "no implementation is registered for the component: %v", err)
+			return
+		}
+		if err := validateMetadata(comp, metadata); err != nil {
+			v.reportAt(path+".metadata", "%v", err)
+		}
+	}
+	// the implementations are checked only if the factories of the kind are registered
+	for name, c := range cfg.PubSubManagement {
+		check("pub_subs", name, len(o.services.pubSubs) > 0, func() (interface{}, error) { return m.pubSubRegistry.Create(name) }, c.Metadata)
+	}
+	for name, c := range cfg.StateManagement {
+		check("state", name, len(o.services.states) > 0, func() (interface{}, error) { return m.stateRegistry.Create(name) }, c.Metadata)
+	}
+	for name, c := range cfg.LockManagement {
+		check("lock", name, len(o.services.locks) > 0, func() (interface{}, error) { return m.lockRegistry.Create(name) }, c.Metadata)
+	}
+	for name, c := range cfg.SequencerManagement {
+		check("sequencer", name, len(o.services.sequencers) > 0, func() (interface{}, error) { return m.sequencerRegistry.Create(name) }, c.Metadata)
+	}
+	for name, c := range cfg.Bindings {
+		check("bindings", name, len(o.services.outputBinding) > 0, func() (interface{}, error) { return m.bindingsRegistry.CreateOutputBinding(name) }, c.Metadata)
+		if err := c.Validate(); err != nil {
+			v.reportAt("bindings."+name+".operation_metadata", "%v", err)
+		}
+	}
+	for name, c := range cfg.SecretStoresManagement {
+		check("secretStores", name, len(o.services.secretStores) > 0, func() (interface{}, error) { return m.secretStoresRegistry.Create(name) }, c.Metadata)
+	}
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		return v.diagnostics[i].Line < v.diagnostics[j].Line
+	})
+}
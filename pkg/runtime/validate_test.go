@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+
+	"mosn.io/layotto/components/pkg/schema"
+	mstate "mosn.io/layotto/pkg/runtime/state"
+)
+
+type schemaStateStore struct {
+	state.Store
+}
+
+func (s *schemaStateStore) MetadataSchema() *schema.Schema {
+	return &schema.Schema{Fields: []schema.Field{
+		{Name: "redisHost", Type: schema.TypeString, Required: true},
+		{Name: "redisPassword", Type: schema.TypeString, Secret: true},
+	}}
+}
+
+func TestValidateRuntimeConfig(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		data := `{
+  "app": {"app_id": "app1", "grpc_callback_port": 9999},
+  "hellos": {"helloworld": {"hello": "greeting"}},
+  "state": {"redis": {"metadata": {"redisHost": "localhost:6379"}}},
+  "files": {"aliOSS": {"metadata": [{"endpoint": "e"}]}}
+}`
+		assert.Empty(t, ValidateRuntimeConfig([]byte(data)))
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		data := `{
+  "app": {"app_id": "app1"},
+  "stat": {}
+}`
+		d := ValidateRuntimeConfig([]byte(data))
+		assert.Len(t, d, 1)
+		assert.Equal(t, "stat", d[0].Path)
+		assert.Equal(t, 3, d[0].Line)
+		assert.Equal(t, `unknown field "stat", did you mean "state"?`, d[0].Message)
+		assert.Equal(t, `line 3: stat: unknown field "stat", did you mean "state"?`, d[0].String())
+	})
+
+	t.Run("unknown field of component", func(t *testing.T) {
+		data := `{"state": {"redis": {"metdata": {}}}}`
+		d := ValidateRuntimeConfig([]byte(data))
+		assert.Len(t, d, 1)
+		assert.Equal(t, "state.redis.metdata", d[0].Path)
+		assert.Equal(t, `unknown field "metdata", did you mean "metadata"?`, d[0].Message)
+	})
+
+	t.Run("duplicate names", func(t *testing.T) {
+		data := `{
+  "lock": {
+    "redis": {},
+    "redis": {}
+  }
+}`
+		d := ValidateRuntimeConfig([]byte(data))
+		assert.Len(t, d, 1)
+		assert.Equal(t, "lock.redis", d[0].Path)
+		assert.Equal(t, 4, d[0].Line)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		data := `{"app": {"grpc_callback_port": "9999"}, "pub_subs": []}`
+		d := ValidateRuntimeConfig([]byte(data))
+		assert.Len(t, d, 2)
+		assert.Equal(t, "app.grpc_callback_port", d[0].Path)
+		assert.Equal(t, "expected a number but got a string", d[0].Message)
+		assert.Equal(t, "pub_subs", d[1].Path)
+		assert.Equal(t, "expected an object but got an array", d[1].Message)
+	})
+
+	t.Run("illegal json", func(t *testing.T) {
+		d := ValidateRuntimeConfig([]byte(`{"app": `))
+		assert.Len(t, d, 1)
+		assert.Contains(t, d[0].Message, "illegal json")
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		data := `{
+  "state": {
+    "redis": {"metadata": {}},
+    "mongo": {"metadata": {}}
+  }
+}`
+		f := mstate.NewFactory("redis", func() state.Store {
+			return &schemaStateStore{}
+		})
+		d := ValidateRuntimeConfig([]byte(data), WithStateFactory(f))
+		assert.Len(t, d, 2)
+		assert.Equal(t, "state.redis.metadata", d[0].Path)
+		assert.Equal(t, 3, d[0].Line)
+		assert.Equal(t, "illegal metadata: missing required field redisHost", d[0].Message)
+		assert.Equal(t, "state.mongo", d[1].Path)
+		assert.Equal(t, 4, d[1].Line)
+		// the metadata isn't checked without the factories
+		assert.Empty(t, ValidateRuntimeConfig([]byte(data)))
+	})
+}
+
+func TestMaskMetadata(t *testing.T) {
+	props := map[string]string{"redisHost": "localhost:6379", "redisPassword": "123"}
+	assert.Equal(t, map[string]string{"redisHost": "localhost:6379", "redisPassword": "******"}, maskMetadata(&schemaStateStore{}, props))
+	// nothing is printed if the secret fields are unknown
+	assert.Nil(t, maskMetadata(struct{}{}, props))
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+
+	rawGRPC "google.golang.org/grpc"
+)
+
+// ErrWasmNotSupported is returned when the wasm filters are configured, but the sidecar is built with the tag no_wasm
+var ErrWasmNotSupported = errors.New("wasm filters are configured but the runtime is built without wasm")
+
+// WasmFilterFactory creates the interceptor running the wasm filters on the unary calls of the runtime APIs in order
+type WasmFilterFactory func(configs []json.RawMessage) (rawGRPC.UnaryServerInterceptor, error)
+
+var wasmFilterFactory WasmFilterFactory
+
+// RegisterWasmFilterFactory registers the factory of the wasm filters,
+// it's called by pkg/wasm, which is compiled out with the build tag no_wasm.
+func RegisterWasmFilterFactory(f WasmFilterFactory) {
+	wasmFilterFactory = f
+}
+
+// newWasmFilter creates the interceptor of the wasm filters in the config
+func newWasmFilter(configs []json.RawMessage) (rawGRPC.UnaryServerInterceptor, error) {
+	if wasmFilterFactory == nil {
+		return nil, ErrWasmNotSupported
+	}
+	return wasmFilterFactory(configs)
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rawGRPC "google.golang.org/grpc"
+)
+
+func TestNewWasmFilter(t *testing.T) {
+	defer RegisterWasmFilterFactory(wasmFilterFactory)
+
+	RegisterWasmFilterFactory(nil)
+	_, err := newWasmFilter([]json.RawMessage{json.RawMessage(`{"name":"validate"}`)})
+	assert.Equal(t, ErrWasmNotSupported, err)
+
+	var configs []json.RawMessage
+	RegisterWasmFilterFactory(func(c []json.RawMessage) (rawGRPC.UnaryServerInterceptor, error) {
+		configs = c
+		return func(ctx context.Context, req interface{}, info *rawGRPC.UnaryServerInfo, handler rawGRPC.UnaryHandler) (interface{}, error) {
+			return handler(ctx, req)
+		}, nil
+	})
+	filter, err := newWasmFilter([]json.RawMessage{json.RawMessage(`{"name":"validate"}`)})
+	assert.Nil(t, err)
+	assert.NotNil(t, filter)
+	assert.Len(t, configs, 1)
+}
@@ -0,0 +1,534 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	v2 "mosn.io/mosn/pkg/config/v2"
+	"mosn.io/mosn/pkg/log"
+	"mosn.io/mosn/pkg/protocol"
+	"mosn.io/mosn/pkg/types"
+	"mosn.io/mosn/pkg/wasm"
+	"mosn.io/mosn/pkg/wasm/abi"
+	"mosn.io/mosn/pkg/wasm/abi/proxywasm010"
+	"mosn.io/pkg/buffer"
+	"mosn.io/proxy-wasm-go-host/proxywasm/common"
+	proxywasm "mosn.io/proxy-wasm-go-host/proxywasm/v1"
+
+	layotto_runtime "mosn.io/layotto/pkg/runtime"
+)
+
+// The runtime APIs are exposed to the filters like http requests with the proxy-wasm ABI:
+// the request headers carry the method in `:path` and the grpc metadata of the call,
+// the request body is the request message in json, and the response body is the response message in json.
+// The filters can modify the headers and the bodies, and reject the calls by sending a local response.
+const (
+	apiFilterPathHeader   = ":path"
+	apiFilterMethodHeader = ":method"
+	apiFilterStatusHeader = ":status"
+
+	apiFilterPluginPrefix = "layotto_api_filter_"
+)
+
+var errAPIFilterNameEmpty = errors.New("name of wasm filter is required")
+
+func init() {
+	layotto_runtime.RegisterWasmFilterFactory(NewAPIFilter)
+}
+
+// APIFilterConfig is the config of a wasm filter of the runtime APIs
+type APIFilterConfig struct {
+	Name string `json:"name"`
+	// FromWasmPlugin is the name of the wasm plugin loaded already, VmConfig is ignored if it's set
+	FromWasmPlugin string           `json:"from_wasm_plugin,omitempty"`
+	VmConfig       *v2.WasmVmConfig `json:"vm_config,omitempty"`
+	InstanceNum    int              `json:"instance_num,omitempty"`
+	// Methods are the names of the methods filtered, e.g. SaveState, all the unary methods are filtered if it's empty
+	Methods []string `json:"methods,omitempty"`
+	// FailOpen lets the calls through if the filter fails, otherwise they fail with INTERNAL
+	FailOpen bool `json:"fail_open,omitempty"`
+	// Config is passed to the filter as the plugin configuration
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// apiFilter runs a wasm module on the unary calls of the runtime APIs
+type apiFilter struct {
+	config  *APIFilterConfig
+	methods map[string]bool
+	plugin  *WasmPlugin
+	// the root context of each instance is created by OnPluginStart
+	rootContextID int32
+}
+
+var _ types.WasmPluginHandler = &apiFilter{}
+
+// NewAPIFilter creates the interceptor running the wasm filters in the configs in order
+func NewAPIFilter(configs []json.RawMessage) (grpc.UnaryServerInterceptor, error) {
+	filters := make([]*apiFilter, 0, len(configs))
+	for _, raw := range configs {
+		cfg := &APIFilterConfig{}
+		if err := json.Unmarshal(raw, cfg); err != nil {
+			return nil, err
+		}
+		f, err := newAPIFilter(cfg)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		h := handler
+		for i := len(filters) - 1; i >= 0; i-- {
+			f, next := filters[i], h
+			h = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return f.intercept(ctx, req, info.FullMethod, next)
+			}
+		}
+		return h(ctx, req)
+	}, nil
+}
+
+func newAPIFilter(cfg *APIFilterConfig) (*apiFilter, error) {
+	if cfg.Name == "" {
+		return nil, errAPIFilterNameEmpty
+	}
+	pluginName := cfg.FromWasmPlugin
+	if pluginName == "" {
+		if cfg.VmConfig == nil {
+			return nil, fmt.Errorf("vm config of wasm filter %s is required", cfg.Name)
+		}
+		if cfg.InstanceNum <= 0 {
+			cfg.InstanceNum = runtime.NumCPU()
+		}
+		pluginName = apiFilterPluginPrefix + cfg.Name
+		err := wasm.GetWasmManager().AddOrUpdateWasm(v2.WasmPluginConfig{
+			PluginName:  pluginName,
+			VmConfig:    cfg.VmConfig,
+			InstanceNum: cfg.InstanceNum,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("load wasm filter %s error: %w", cfg.Name, err)
+		}
+	}
+	pw := wasm.GetWasmManager().GetWasmPluginWrapperByName(pluginName)
+	if pw == nil {
+		return nil, fmt.Errorf("wasm plugin %s of filter %s not found", pluginName, cfg.Name)
+	}
+	f := &apiFilter{
+		config:        cfg,
+		rootContextID: 1,
+		plugin: &WasmPlugin{
+			pluginName:    pluginName,
+			plugin:        pw.GetPlugin(),
+			rootContextID: 1,
+			config:        &filterConfigItem{UserData: cfg.Config, PluginName: pluginName},
+		},
+	}
+	if len(cfg.Methods) > 0 {
+		f.methods = make(map[string]bool, len(cfg.Methods))
+		for _, m := range cfg.Methods {
+			f.methods[m] = true
+		}
+	}
+	// pw.RegisterPluginHandler calls f.OnPluginStart
+	pw.RegisterPluginHandler(f)
+	return f, nil
+}
+
+// OnConfigUpdate is called when the plugin is updated
+func (f *apiFilter) OnConfigUpdate(config v2.WasmPluginConfig) {
+	f.plugin.vmConfigBytes = nil
+}
+
+// OnPluginStart creates the root context of each instance of the plugin
+func (f *apiFilter) OnPluginStart(plugin types.WasmPlugin) {
+	f.plugin.plugin = plugin
+	plugin.Exec(func(instance types.WasmInstance) bool {
+		a := abi.GetABI(instance, AbiV2)
+		if a == nil {
+			log.DefaultLogger.Errorf("[proxywasm][apiFilter] OnPluginStart fail to get abi of filter %s", f.config.Name)
+			return true
+		}
+		a.SetABIImports(&apiFilterCall{filter: f})
+		exports := a.GetABIExports().(Exports)
+
+		instance.Lock(a)
+		defer instance.Unlock()
+
+		if err := exports.ProxyOnContextCreate(f.rootContextID, 0); err != nil {
+			log.DefaultLogger.Errorf("[proxywasm][apiFilter] OnPluginStart fail to create root context of filter %s, err: %v", f.config.Name, err)
+			return true
+		}
+		vmConfigSize := 0
+		if b := f.plugin.GetVmConfig(); b != nil {
+			vmConfigSize = b.Len()
+		}
+		if _, err := exports.ProxyOnVmStart(f.rootContextID, int32(vmConfigSize)); err != nil {
+			log.DefaultLogger.Errorf("[proxywasm][apiFilter] OnPluginStart fail to start vm of filter %s, err: %v", f.config.Name, err)
+			return true
+		}
+		pluginConfigSize := 0
+		if b := f.plugin.GetPluginConfig(); b != nil {
+			pluginConfigSize = b.Len()
+		}
+		if _, err := exports.ProxyOnConfigure(f.rootContextID, int32(pluginConfigSize)); err != nil {
+			log.DefaultLogger.Errorf("[proxywasm][apiFilter] OnPluginStart fail to configure filter %s, err: %v", f.config.Name, err)
+		}
+		return true
+	})
+}
+
+// OnPluginDestroy is called when the plugin is destroyed
+func (f *apiFilter) OnPluginDestroy(plugin types.WasmPlugin) {}
+
+// matches returns whether the method is filtered
+func (f *apiFilter) matches(fullMethod string) bool {
+	if f.methods == nil {
+		return true
+	}
+	return f.methods[fullMethod] || f.methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]
+}
+
+func (f *apiFilter) intercept(ctx context.Context, req interface{}, fullMethod string, handler grpc.UnaryHandler) (interface{}, error) {
+	if !f.matches(fullMethod) {
+		return handler(ctx, req)
+	}
+	plugin := f.plugin.plugin
+	instance := plugin.GetInstance()
+	defer plugin.ReleaseInstance(instance)
+
+	call := newAPIFilterCall(ctx, f, fullMethod, instance)
+	ctx, req, err := call.onRequest(ctx, req)
+	if err != nil {
+		call.done()
+		if f.rejects(err) {
+			return nil, err
+		}
+		log.DefaultLogger.Errorf("[proxywasm][apiFilter] filter %s fails on the request of %s, let it through: %v", f.config.Name, fullMethod, err)
+		return handler(ctx, req)
+	}
+	resp, err := handler(ctx, req)
+	if err != nil {
+		call.done()
+		return resp, err
+	}
+	filtered, ferr := call.onResponse(resp)
+	call.done()
+	if ferr != nil {
+		if f.rejects(ferr) {
+			return nil, ferr
+		}
+		log.DefaultLogger.Errorf("[proxywasm][apiFilter] filter %s fails on the response of %s, let it through: %v", f.config.Name, fullMethod, ferr)
+		return resp, nil
+	}
+	return filtered, nil
+}
+
+// rejects returns whether the call fails with the error of the filter, the failures of the filter itself are ignored if it fails open
+func (f *apiFilter) rejects(err error) bool {
+	return !f.config.FailOpen || status.Code(err) != codes.Internal
+}
+
+// apiFilterCall is the http context of a call in the filter, which implements the imports of the ABI
+type apiFilterCall struct {
+	LayottoHandler
+
+	filter     *apiFilter
+	fullMethod string
+	contextID  int32
+	instance   types.WasmInstance
+	md         metadata.MD
+
+	requestHeader  protocol.CommonHeader
+	requestBody    buffer.IoBuffer
+	responseHeader protocol.CommonHeader
+	responseBody   buffer.IoBuffer
+	// localResponse is the error of the call rejected by the filter
+	localResponse error
+}
+
+var _ proxywasm.ImportsHandler = &apiFilterCall{}
+
+func newAPIFilterCall(ctx context.Context, f *apiFilter, fullMethod string, instance types.WasmInstance) *apiFilterCall {
+	c := &apiFilterCall{
+		filter:        f,
+		fullMethod:    fullMethod,
+		contextID:     newContextID(f.rootContextID),
+		instance:      instance,
+		requestHeader: protocol.CommonHeader{apiFilterPathHeader: fullMethod, apiFilterMethodHeader: http.MethodPost},
+	}
+	c.Instance = instance
+	c.md, _ = metadata.FromIncomingContext(ctx)
+	for k, v := range c.md {
+		if len(v) > 0 && !strings.HasPrefix(k, ":") {
+			c.requestHeader[k] = strings.Join(v, ",")
+		}
+	}
+	return c
+}
+
+// lock locks the instance and returns the exports of it
+func (c *apiFilterCall) lock() (Exports, error) {
+	a := abi.GetABI(c.instance, AbiV2)
+	if a == nil {
+		return nil, status.Errorf(codes.Internal, "fail to get abi of wasm filter %s", c.filter.config.Name)
+	}
+	a.SetABIImports(c)
+	c.instance.Lock(a)
+	return a.GetABIExports().(Exports), nil
+}
+
+// onRequest calls the filter on the request, and returns the request modified by the filter
+func (c *apiFilterCall) onRequest(ctx context.Context, req interface{}) (context.Context, interface{}, error) {
+	exports, err := c.lock()
+	if err != nil {
+		return ctx, req, err
+	}
+	defer c.instance.Unlock()
+
+	if err = exports.ProxyOnContextCreate(c.contextID, c.filter.rootContextID); err != nil {
+		return ctx, req, c.failed("create context", err)
+	}
+	msg, isProto := req.(proto.Message)
+	var body []byte
+	if isProto {
+		if body, err = protojson.Marshal(msg); err != nil {
+			return ctx, req, c.failed("marshal request", err)
+		}
+	}
+	endOfStream := int32(1)
+	if len(body) > 0 {
+		endOfStream = 0
+	}
+	action, err := exports.ProxyOnRequestHeaders(c.contextID, int32(len(c.requestHeader)), endOfStream)
+	if err = c.result(action, err, "request headers"); err != nil {
+		return ctx, req, err
+	}
+	if len(body) > 0 {
+		c.requestBody = buffer.NewIoBufferBytes(body)
+		action, err = exports.ProxyOnRequestBody(c.contextID, int32(len(body)), 1)
+		if err = c.result(action, err, "request body"); err != nil {
+			return ctx, req, err
+		}
+		if req, err = c.unmarshal(msg, body, c.requestBody); err != nil {
+			return ctx, req, c.failed("unmarshal request", err)
+		}
+	}
+	// the headers added, modified or removed by the filter are applied to the metadata
+	md := metadata.MD{}
+	for k, v := range c.md {
+		if strings.HasPrefix(k, ":") {
+			md[k] = v
+		}
+	}
+	for k, v := range c.requestHeader {
+		if strings.HasPrefix(k, ":") {
+			continue
+		}
+		if original, ok := c.md[k]; ok && strings.Join(original, ",") == v {
+			md[k] = original
+		} else {
+			md[k] = []string{v}
+		}
+	}
+	return metadata.NewIncomingContext(ctx, md), req, nil
+}
+
+// onResponse calls the filter on the response, and returns the response modified by the filter
+func (c *apiFilterCall) onResponse(resp interface{}) (interface{}, error) {
+	exports, err := c.lock()
+	if err != nil {
+		return resp, err
+	}
+	defer c.instance.Unlock()
+
+	msg, isProto := resp.(proto.Message)
+	var body []byte
+	if isProto {
+		if body, err = protojson.Marshal(msg); err != nil {
+			return resp, c.failed("marshal response", err)
+		}
+	}
+	endOfStream := int32(1)
+	if len(body) > 0 {
+		endOfStream = 0
+	}
+	c.responseHeader = protocol.CommonHeader{apiFilterStatusHeader: strconv.Itoa(http.StatusOK)}
+	action, err := exports.ProxyOnResponseHeaders(c.contextID, int32(len(c.responseHeader)), endOfStream)
+	if err = c.result(action, err, "response headers"); err != nil {
+		return resp, err
+	}
+	if len(body) == 0 {
+		return resp, nil
+	}
+	c.responseBody = buffer.NewIoBufferBytes(body)
+	action, err = exports.ProxyOnResponseBody(c.contextID, int32(len(body)), 1)
+	if err = c.result(action, err, "response body"); err != nil {
+		return resp, err
+	}
+	if resp, err = c.unmarshal(msg, body, c.responseBody); err != nil {
+		return resp, c.failed("unmarshal response", err)
+	}
+	return resp, nil
+}
+
+// done deletes the context of the call
+func (c *apiFilterCall) done() {
+	exports, err := c.lock()
+	if err != nil {
+		return
+	}
+	defer c.instance.Unlock()
+	if _, err = exports.ProxyOnDone(c.contextID); err != nil {
+		log.DefaultLogger.Errorf("[proxywasm][apiFilter] filter %s fail to call ProxyOnDone, err: %v", c.filter.config.Name, err)
+	}
+	if err = exports.ProxyOnDelete(c.contextID); err != nil {
+		log.DefaultLogger.Errorf("[proxywasm][apiFilter] filter %s fail to call ProxyOnDelete, err: %v", c.filter.config.Name, err)
+	}
+}
+
+// unmarshal returns a new message of the body modified by the filter, or the message itself if it's not modified
+func (c *apiFilterCall) unmarshal(msg proto.Message, original []byte, body buffer.IoBuffer) (proto.Message, error) {
+	modified := body.Bytes()
+	if string(modified) == string(original) {
+		return msg, nil
+	}
+	m := msg.ProtoReflect().New().Interface()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(modified, m); err != nil {
+		return msg, err
+	}
+	return m, nil
+}
+
+// result returns the error of the call rejected or failed in the filter
+func (c *apiFilterCall) result(action proxywasm.Action, err error, phase string) error {
+	if c.localResponse != nil {
+		return c.localResponse
+	}
+	if err != nil {
+		return c.failed(phase, err)
+	}
+	if action != proxywasm.ActionContinue {
+		return status.Errorf(codes.PermissionDenied, "%s is rejected by wasm filter %s", c.fullMethod, c.filter.config.Name)
+	}
+	return nil
+}
+
+func (c *apiFilterCall) failed(phase string, err error) error {
+	log.DefaultLogger.Errorf("[proxywasm][apiFilter] filter %s fail on %s of %s, err: %v", c.filter.config.Name, phase, c.fullMethod, err)
+	return status.Errorf(codes.Internal, "wasm filter %s fails on %s: %v", c.filter.config.Name, phase, err)
+}
+
+// GetRootContextID returns the root context of the filter
+func (c *apiFilterCall) GetRootContextID() int32 {
+	return c.filter.rootContextID
+}
+
+// GetVmConfig returns the vm config of the filter
+func (c *apiFilterCall) GetVmConfig() common.IoBuffer {
+	return c.filter.plugin.GetVmConfig()
+}
+
+// GetPluginConfig returns the config of the filter
+func (c *apiFilterCall) GetPluginConfig() common.IoBuffer {
+	return c.filter.plugin.GetPluginConfig()
+}
+
+// GetHttpRequestHeader returns the method and the metadata of the call
+func (c *apiFilterCall) GetHttpRequestHeader() common.HeaderMap {
+	return &proxywasm010.HeaderMapWrapper{HeaderMap: c.requestHeader}
+}
+
+// GetHttpRequestBody returns the request in json
+func (c *apiFilterCall) GetHttpRequestBody() common.IoBuffer {
+	if c.requestBody == nil {
+		return nil
+	}
+	return &proxywasm010.IoBufferWrapper{IoBuffer: c.requestBody}
+}
+
+// GetHttpResponseHeader returns the status of the call
+func (c *apiFilterCall) GetHttpResponseHeader() common.HeaderMap {
+	if c.responseHeader == nil {
+		return nil
+	}
+	return &proxywasm010.HeaderMapWrapper{HeaderMap: c.responseHeader}
+}
+
+// GetHttpResponseBody returns the response in json
+func (c *apiFilterCall) GetHttpResponseBody() common.IoBuffer {
+	if c.responseBody == nil {
+		return nil
+	}
+	return &proxywasm010.IoBufferWrapper{IoBuffer: c.responseBody}
+}
+
+// SendHttpResp rejects the call with the grpc code, or the code converted from the http status if it's not set
+func (c *apiFilterCall) SendHttpResp(respCode int32, respCodeDetail common.IoBuffer, respBody common.IoBuffer,
+	additionalHeaderMap common.HeaderMap, grpcCode int32) proxywasm.WasmResult {
+	code := httpStatusToCode(respCode)
+	if grpcCode > 0 {
+		code = codes.Code(grpcCode)
+	}
+	msg := fmt.Sprintf("%s is rejected by wasm filter %s", c.fullMethod, c.filter.config.Name)
+	if respBody != nil && respBody.Len() > 0 {
+		msg = string(respBody.Bytes())
+	} else if respCodeDetail != nil && respCodeDetail.Len() > 0 {
+		msg = string(respCodeDetail.Bytes())
+	}
+	c.localResponse = status.Error(code, msg)
+	return proxywasm.WasmResultOk
+}
+
+// httpStatusToCode converts the http status of the local response to the grpc code
+func httpStatusToCode(s int32) codes.Code {
+	switch s {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.PermissionDenied
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2021 Layotto Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasm
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mosn.io/mosn/pkg/wasm/abi/proxywasm010"
+	"mosn.io/pkg/buffer"
+	proxywasm "mosn.io/proxy-wasm-go-host/proxywasm/v1"
+)
+
+func TestNewAPIFilterIllegal(t *testing.T) {
+	_, err := NewAPIFilter([]json.RawMessage{json.RawMessage(`{"from_wasm_plugin":"p"}`)})
+	assert.Equal(t, errAPIFilterNameEmpty, err)
+	_, err = NewAPIFilter([]json.RawMessage{json.RawMessage(`{"name":"validate"}`)})
+	assert.NotNil(t, err)
+	_, err = NewAPIFilter([]json.RawMessage{json.RawMessage(`{"name":"validate","from_wasm_plugin":"unknown"}`)})
+	assert.NotNil(t, err)
+	_, err = NewAPIFilter([]json.RawMessage{json.RawMessage(`[]`)})
+	assert.NotNil(t, err)
+}
+
+func TestAPIFilterMatches(t *testing.T) {
+	f := &apiFilter{config: &APIFilterConfig{}}
+	assert.True(t, f.matches("/spec.proto.runtime.v1.Runtime/SaveState"))
+
+	f.methods = map[string]bool{"SaveState": true, "/spec.proto.runtime.v1.Runtime/GetState": true}
+	assert.True(t, f.matches("/spec.proto.runtime.v1.Runtime/SaveState"))
+	assert.True(t, f.matches("/spec.proto.runtime.v1.Runtime/GetState"))
+	assert.False(t, f.matches("/spec.proto.runtime.v1.Runtime/DeleteState"))
+}
+
+func TestAPIFilterRejects(t *testing.T) {
+	f := &apiFilter{config: &APIFilterConfig{Name: "validate"}}
+	assert.True(t, f.rejects(status.Error(codes.Internal, "fail")))
+	assert.True(t, f.rejects(status.Error(codes.InvalidArgument, "invalid")))
+
+	f.config.FailOpen = true
+	assert.False(t, f.rejects(status.Error(codes.Internal, "fail")))
+	assert.True(t, f.rejects(status.Error(codes.InvalidArgument, "invalid")))
+}
+
+func TestAPIFilterLocalResponse(t *testing.T) {
+	c := &apiFilterCall{filter: &apiFilter{config: &APIFilterConfig{Name: "validate"}}, fullMethod: "/spec.proto.runtime.v1.Runtime/SaveState"}
+	assert.Nil(t, c.result(proxywasm.ActionContinue, nil, "request headers"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(c.result(proxywasm.ActionPause, nil, "request headers")))
+
+	body := &proxywasm010.IoBufferWrapper{IoBuffer: buffer.NewIoBufferString("key is required")}
+	assert.Equal(t, proxywasm.WasmResultOk, c.SendHttpResp(http.StatusBadRequest, nil, body, nil, -1))
+	err := c.result(proxywasm.ActionPause, nil, "request body")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "key is required", status.Convert(err).Message())
+
+	// the grpc code takes precedence over the http status
+	c.SendHttpResp(http.StatusBadRequest, nil, nil, nil, int32(codes.FailedPrecondition))
+	err = c.result(proxywasm.ActionContinue, nil, "request body")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "rejected by wasm filter validate")
+}
+
+func TestHttpStatusToCode(t *testing.T) {
+	assert.Equal(t, codes.Unauthenticated, httpStatusToCode(http.StatusUnauthorized))
+	assert.Equal(t, codes.ResourceExhausted, httpStatusToCode(http.StatusTooManyRequests))
+	assert.Equal(t, codes.PermissionDenied, httpStatusToCode(http.StatusTeapot))
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
 )
 
@@ -62,6 +63,15 @@ type Client interface {
 	// PublishEventfromCustomContent serializes an struct and publishes its contents as data (JSON) onto topic in specific pubsub component.
 	PublishEventfromCustomContent(ctx context.Context, pubsubName, topicName string, data interface{}) error
 
+	// PublishEventAsync publishes data onto topic in background, and returns once the event is enqueued by the sidecar.
+	PublishEventAsync(ctx context.Context, pubsubName, topicName string, data []byte) error
+
+	// PublishEventWithPartitionKey publishes data onto topic with the partition key, which keeps the events with the same key in order.
+	PublishEventWithPartitionKey(ctx context.Context, pubsubName, topicName, partitionKey string, data []byte) error
+
+	// Flush waits until the events published asynchronously are sent, and returns the number of events of this client dropped since its last flush.
+	Flush(ctx context.Context, pubsubName string) (failed int64, err error)
+
 	// SaveConfiguration saves configuration into configuration store.
 	SaveConfiguration(ctx context.Context, in *SaveConfigurationRequest) error
 
@@ -83,9 +93,24 @@ type Client interface {
 	// GetStateWithConsistency retrieves state from specific store using provided state consistency.
 	GetStateWithConsistency(ctx context.Context, storeName, key string, meta map[string]string, sc StateConsistency) (item *StateItem, err error)
 
+	// SaveStateJSON saves the value serialized as json, declaring its content type.
+	SaveStateJSON(ctx context.Context, storeName, key string, v interface{}, so ...StateOption) error
+
+	// SaveStateProto saves the message in a google.protobuf.Any, declaring its content type with the type of the message.
+	SaveStateProto(ctx context.Context, storeName, key string, m proto.Message, so ...StateOption) error
+
+	// GetStateJSON retrieves the json value into v, which fails if the value isn't json.
+	GetStateJSON(ctx context.Context, storeName, key string, v interface{}) (item *StateItem, err error)
+
+	// GetStateProto retrieves the message saved by SaveStateProto into m, which fails if the value is another type of message.
+	GetStateProto(ctx context.Context, storeName, key string, m proto.Message) (item *StateItem, err error)
+
 	// GetBulkState retrieves state for multiple keys from specific store.
 	GetBulkState(ctx context.Context, storeName string, keys []string, meta map[string]string, parallelism int32) ([]*BulkStateItem, error)
 
+	// QueryState queries the state items by their values, with the filter, sort and page in JSON.
+	QueryState(ctx context.Context, req *runtimev1pb.QueryStateRequest) (*runtimev1pb.QueryStateResponse, error)
+
 	// DeleteState deletes content from store using default state options.
 	DeleteState(ctx context.Context, storeName, key string) error
 
@@ -95,6 +120,36 @@ type Client interface {
 	// ExecuteStateTransaction provides way to execute multiple operations on a specified store.
 	ExecuteStateTransaction(ctx context.Context, storeName string, meta map[string]string, ops []*StateOperation) error
 
+	// ExecuteMultiStoreStateTransaction executes a best-effort transaction across multiple state stores.
+	ExecuteMultiStoreStateTransaction(ctx context.Context, req *runtimev1pb.ExecuteMultiStoreStateTransactionRequest) (*runtimev1pb.ExecuteMultiStoreStateTransactionResponse, error)
+
+	// CompareAndSwap sets the value of a key only if its current value equals the expected one.
+	CompareAndSwap(ctx context.Context, req *runtimev1pb.CompareAndSwapRequest) (*runtimev1pb.CompareAndSwapResponse, error)
+
+	// Increment increases the integer value of a key atomically.
+	Increment(ctx context.Context, req *runtimev1pb.IncrementRequest) (*runtimev1pb.IncrementResponse, error)
+
+	// Decrement decreases the integer value of a key atomically.
+	Decrement(ctx context.Context, req *runtimev1pb.DecrementRequest) (*runtimev1pb.DecrementResponse, error)
+
+	// DeleteStateByPrefix deletes all the keys starting with the prefix, for the stores which can enumerate keys.
+	DeleteStateByPrefix(ctx context.Context, req *runtimev1pb.DeleteStateByPrefixRequest) (*runtimev1pb.DeleteStateByPrefixResponse, error)
+
+	// CheckAndRecordIdempotency records the processed-marker of a key if it's absent, and reports whether it's recorded by this call.
+	CheckAndRecordIdempotency(ctx context.Context, req *runtimev1pb.CheckAndRecordIdempotencyRequest) (*runtimev1pb.CheckAndRecordIdempotencyResponse, error)
+
+	// CreateSession creates a session in a state store, which expires after its ttl unless it's accessed.
+	CreateSession(ctx context.Context, req *runtimev1pb.CreateSessionRequest) (*runtimev1pb.CreateSessionResponse, error)
+
+	// GetSession gets a session, and renews it if more than half of its ttl has elapsed since it's renewed.
+	GetSession(ctx context.Context, req *runtimev1pb.GetSessionRequest) (*runtimev1pb.GetSessionResponse, error)
+
+	// TouchSession renews a session.
+	TouchSession(ctx context.Context, req *runtimev1pb.TouchSessionRequest) (*runtimev1pb.TouchSessionResponse, error)
+
+	// RevokeSession deletes a session.
+	RevokeSession(ctx context.Context, req *runtimev1pb.RevokeSessionRequest) error
+
 	// DeleteBulkState deletes content for multiple keys from store.
 	DeleteBulkState(ctx context.Context, storeName string, keys []string) error
 
@@ -104,11 +159,36 @@ type Client interface {
 	// Distributed Lock API
 	TryLock(context.Context, *runtimev1pb.TryLockRequest) (*runtimev1pb.TryLockResponse, error)
 	Unlock(context.Context, *runtimev1pb.UnlockRequest) (*runtimev1pb.UnlockResponse, error)
+	// TryLockBulk acquires the locks of all the resources, or none of them
+	TryLockBulk(context.Context, *runtimev1pb.TryLockBulkRequest) (*runtimev1pb.TryLockBulkResponse, error)
 
 	// Sequencer API
 	// Get next unique id with some auto-increment guarantee
 	GetNextId(ctx context.Context, in *runtimev1pb.GetNextIdRequest) (*runtimev1pb.GetNextIdResponse, error)
 
+	// Batch executes multiple operations concurrently in one round trip
+	Batch(ctx context.Context, in *runtimev1pb.BatchRequest) (*runtimev1pb.BatchResponse, error)
+
+	// GetReadiness reports whether the sidecar is ready to serve
+	GetReadiness(ctx context.Context, in *runtimev1pb.GetReadinessRequest) (*runtimev1pb.GetReadinessResponse, error)
+
+	// SubscribeTopicEvents subscribes to the topic and calls the handler with the events until the context is done,
+	// so the app doesn't need to serve the AppCallback. The events are acked by the statuses returned by the handler.
+	SubscribeTopicEvents(ctx context.Context, pubsubName, topic string, handler TopicEventHandler) error
+
+	// GetMetadata gets the metadata of the sidecar, including the state of subscriptions
+	GetMetadata(ctx context.Context) (*runtimev1pb.GetMetadataResponse, error)
+
+
+	// GetPayloadSchemas gets the payload schemas of the rpc target, or all the targets if it's empty
+	GetPayloadSchemas(ctx context.Context, id string) ([]*runtimev1pb.PayloadSchema, error)
+
+	// EvaluateFeatureFlag evaluates a feature flag in the sidecar for the targeting key and attributes
+	EvaluateFeatureFlag(ctx context.Context, in *runtimev1pb.EvaluateFeatureFlagRequest) (*runtimev1pb.EvaluateFeatureFlagResponse, error)
+
+	// SubscribeFeatureFlag receives the evaluations of feature flags, and the new ones whenever they change
+	SubscribeFeatureFlag(ctx context.Context, in *runtimev1pb.SubscribeFeatureFlagRequest) (runtimev1pb.Runtime_SubscribeFeatureFlagClient, error)
+
 	// Close cleans up all resources created by the client.
 	Close()
 }
@@ -206,11 +206,11 @@ func (t *testRuntimeServer) GetConfiguration(ctx context.Context, req *runtimev1
 	}
 	return resp, nil
 }
-func (t *testRuntimeServer) SaveConfiguration(ctx context.Context, req *runtimev1pb.SaveConfigurationRequest) (*empty.Empty, error) {
+func (t *testRuntimeServer) SaveConfiguration(ctx context.Context, req *runtimev1pb.SaveConfigurationRequest) (*runtimev1pb.SaveConfigurationResponse, error) {
 	for _, v := range req.Items {
 		t.kv[v.Key] = v.Content
 	}
-	return &empty.Empty{}, nil
+	return &runtimev1pb.SaveConfigurationResponse{}, nil
 }
 func (t *testRuntimeServer) DeleteConfiguration(ctx context.Context, req *runtimev1pb.DeleteConfigurationRequest) (*empty.Empty, error) {
 	for _, v := range req.Keys {
@@ -236,6 +236,6 @@ func (t *testRuntimeServer) SubscribeConfiguration(srv runtimev1pb.Runtime_Subsc
 }
 
 func (*testRuntimeServer) SayHello(ctx context.Context, req *runtimev1pb.SayHelloRequest) (*runtimev1pb.SayHelloResponse, error) {
-	resp := &runtimev1pb.SayHelloResponse{Hello: "world"}
+	resp := &runtimev1pb.SayHelloResponse{Hello: "world", Metadata: req.Metadata}
 	return resp, nil
 }
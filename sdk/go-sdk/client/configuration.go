@@ -38,6 +38,9 @@ type ConfigurationRequestItem struct {
 	Keys []string
 	// The metadata which will be sent to configuration store components.
 	Metadata map[string]string
+	// The resume token of the last response received, only used for SUB request.
+	// If the store keeps the revisions, only the changes since then are sent instead of a snapshot.
+	ResumeToken string
 }
 
 type ConfigurationItem struct {
@@ -67,6 +70,8 @@ type SaveConfigurationRequest struct {
 	Items []*ConfigurationItem
 	// The metadata which will be sent to configuration store components.
 	Metadata map[string]string
+	// If true, either all the items are saved or none of them.
+	Atomic bool
 }
 
 type SubConfigurationResp struct {
@@ -78,6 +83,8 @@ type SubConfigurationResp struct {
 	// The list of configuration items to save.
 	// To delete a exist item, set the key (also label) and let content to be empty
 	Items []*ConfigurationItem
+	// The token to resume the subscription from this response, empty if the store doesn't keep the revisions.
+	ResumeToken string
 }
 
 type WatchResponse struct {
@@ -101,7 +108,7 @@ func (c *GRPCClient) GetConfiguration(ctx context.Context, in *ConfigurationRequ
 
 // SaveConfiguration saves configuration into configuration store.
 func (c *GRPCClient) SaveConfiguration(ctx context.Context, in *SaveConfigurationRequest) error {
-	req := &runtimev1pb.SaveConfigurationRequest{StoreName: in.StoreName, AppId: in.AppId, Metadata: in.Metadata}
+	req := &runtimev1pb.SaveConfigurationRequest{StoreName: in.StoreName, AppId: in.AppId, Metadata: in.Metadata, Atomic: in.Atomic}
 	for _, v := range in.Items {
 		c := &runtimev1pb.ConfigurationItem{Group: v.Group, Label: v.Label, Key: v.Key, Content: v.Content, Tags: v.Tags, Metadata: v.Metadata}
 		req.Items = append(req.Items, c)
@@ -128,7 +135,7 @@ func (c *GRPCClient) SubscribeConfiguration(ctx context.Context, in *Configurati
 		close(resCh)
 		return resCh
 	}
-	request := &runtimev1pb.SubscribeConfigurationRequest{StoreName: in.StoreName, AppId: in.AppId, Group: in.Group, Label: in.Label, Keys: in.Keys, Metadata: in.Metadata}
+	request := &runtimev1pb.SubscribeConfigurationRequest{StoreName: in.StoreName, AppId: in.AppId, Group: in.Group, Label: in.Label, Keys: in.Keys, Metadata: in.Metadata, ResumeToken: in.ResumeToken}
 	err = cli.Send(request)
 	if err != nil {
 		res.Err = err
@@ -148,6 +155,7 @@ func (c *GRPCClient) SubscribeConfiguration(ctx context.Context, in *Configurati
 			item := &SubConfigurationResp{}
 			item.StoreName = resp.StoreName
 			item.AppId = resp.AppId
+			item.ResumeToken = resp.ResumeToken
 			for _, v := range resp.Items {
 				c := &ConfigurationItem{}
 				c.Metadata = v.Metadata
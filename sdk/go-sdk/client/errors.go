@@ -0,0 +1,35 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// ErrorCode returns the error code that the runtime attached to the error.
+// It returns ErrorCode_ERROR_CODE_UNSPECIFIED if the error doesn't carry one.
+func ErrorCode(err error) runtimev1pb.ErrorCode {
+	s, ok := status.FromError(err)
+	if !ok {
+		return runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*runtimev1pb.ErrorInfo); ok {
+			return info.Code
+		}
+	}
+	return runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+}
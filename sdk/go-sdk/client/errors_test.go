@@ -0,0 +1,36 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+func TestErrorCode(t *testing.T) {
+	s, err := status.New(codes.NotFound, "state store redis is not found").
+		WithDetails(&runtimev1pb.ErrorInfo{Code: runtimev1pb.ErrorCode_STATE_STORE_NOT_FOUND})
+	assert.Nil(t, err)
+	assert.Equal(t, runtimev1pb.ErrorCode_STATE_STORE_NOT_FOUND, ErrorCode(s.Err()))
+
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCode(status.Error(codes.Internal, "boom")))
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCode(errors.New("boom")))
+	assert.Equal(t, runtimev1pb.ErrorCode_ERROR_CODE_UNSPECIFIED, ErrorCode(nil))
+}
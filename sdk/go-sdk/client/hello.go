@@ -23,17 +23,21 @@ import (
 
 type SayHelloRequest struct {
 	ServiceName string
+	Name        string
+	// Metadata is echoed back, and some keys control the response for testing, e.g. "delay_ms" and "error_code"
+	Metadata map[string]string
 }
 
 type SayHelloResp struct {
-	Hello string
+	Hello    string
+	Metadata map[string]string
 }
 
 func (c *GRPCClient) SayHello(ctx context.Context, in *SayHelloRequest) (*SayHelloResp, error) {
-	req := &runtimev1pb.SayHelloRequest{ServiceName: in.ServiceName}
+	req := &runtimev1pb.SayHelloRequest{ServiceName: in.ServiceName, Name: in.Name, Metadata: in.Metadata}
 	resp, err := c.protoClient.SayHello(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return &SayHelloResp{Hello: resp.Hello}, nil
+	return &SayHelloResp{Hello: resp.Hello, Metadata: resp.Metadata}, nil
 }
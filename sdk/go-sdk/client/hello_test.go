@@ -23,8 +23,9 @@ import (
 )
 
 func TestSayHello(t *testing.T) {
-	item := &SayHelloRequest{"helloworld"}
+	item := &SayHelloRequest{ServiceName: "helloworld", Metadata: map[string]string{"locale": "en"}}
 	resp, err := testClient.SayHello(context.Background(), item)
 	assert.Nil(t, err)
 	assert.Equal(t, resp.Hello, "world")
+	assert.Equal(t, item.Metadata, resp.Metadata)
 }
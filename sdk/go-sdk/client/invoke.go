@@ -152,3 +152,12 @@ func extractMethodAndQuery(name string) (method, query string) {
 	}
 	return
 }
+
+// GetPayloadSchemas gets the payload schemas of the rpc target, or all the targets if id is empty.
+func (c *GRPCClient) GetPayloadSchemas(ctx context.Context, id string) ([]*pb.PayloadSchema, error) {
+	resp, err := c.protoClient.GetPayloadSchemas(ctx, &pb.GetPayloadSchemasRequest{Id: id})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting payload schemas of %s", id)
+	}
+	return resp.Schemas, nil
+}
@@ -25,3 +25,7 @@ func (c *GRPCClient) TryLock(ctx context.Context, req *runtimev1pb.TryLockReques
 func (c *GRPCClient) Unlock(ctx context.Context, req *runtimev1pb.UnlockRequest) (*runtimev1pb.UnlockResponse, error) {
 	return c.protoClient.Unlock(ctx, req)
 }
+
+func (c *GRPCClient) TryLockBulk(ctx context.Context, req *runtimev1pb.TryLockBulkRequest) (*runtimev1pb.TryLockBulkResponse, error) {
+	return c.protoClient.TryLockBulk(ctx, req)
+}
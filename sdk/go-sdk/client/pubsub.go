@@ -47,6 +47,71 @@ func (c *GRPCClient) PublishEvent(ctx context.Context, pubsubName, topicName str
 	return nil
 }
 
+// PublishEventAsync publishes data onto specific pubsub topic in background.
+// It returns once the event is enqueued by the sidecar.
+func (c *GRPCClient) PublishEventAsync(ctx context.Context, pubsubName, topicName string, data []byte) error {
+	if pubsubName == "" {
+		return errors.New("pubsubName name required")
+	}
+	if topicName == "" {
+		return errors.New("topic name required")
+	}
+
+	envelop := &pb.PublishEventRequest{
+		PubsubName: pubsubName,
+		Topic:      topicName,
+		Data:       data,
+		Async:      true,
+	}
+
+	_, err := c.protoClient.PublishEvent(ctx, envelop)
+	if err != nil {
+		return errors.Wrapf(err, "error publishing event unto %s topic", topicName)
+	}
+
+	return nil
+}
+
+// PublishEventWithPartitionKey publishes data onto specific pubsub topic with the partition key.
+// The events with the same partition key are kept in order if the pubsub component guarantees it.
+func (c *GRPCClient) PublishEventWithPartitionKey(ctx context.Context, pubsubName, topicName, partitionKey string, data []byte) error {
+	if pubsubName == "" {
+		return errors.New("pubsubName name required")
+	}
+	if topicName == "" {
+		return errors.New("topic name required")
+	}
+	if partitionKey == "" {
+		return errors.New("partition key required")
+	}
+
+	envelop := &pb.PublishEventRequest{
+		PubsubName:   pubsubName,
+		Topic:        topicName,
+		Data:         data,
+		PartitionKey: partitionKey,
+	}
+
+	_, err := c.protoClient.PublishEvent(ctx, envelop)
+	if err != nil {
+		return errors.Wrapf(err, "error publishing event unto %s topic", topicName)
+	}
+
+	return nil
+}
+
+// Flush waits until the events published asynchronously onto specific pubsub are sent.
+func (c *GRPCClient) Flush(ctx context.Context, pubsubName string) (int64, error) {
+	if pubsubName == "" {
+		return 0, errors.New("pubsubName name required")
+	}
+	resp, err := c.protoClient.Flush(ctx, &pb.FlushRequest{PubsubName: pubsubName})
+	if err != nil {
+		return 0, errors.Wrapf(err, "error flushing pubsub %s", pubsubName)
+	}
+	return resp.Failed, nil
+}
+
 // PublishEventfromCustomContent serializes an struct and publishes its contents as data (JSON) onto topic in specific pubsub component.
 func (c *GRPCClient) PublishEventfromCustomContent(ctx context.Context, pubsubName, topicName string, data interface{}) error {
 	if pubsubName == "" {
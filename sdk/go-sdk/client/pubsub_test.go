@@ -56,6 +56,13 @@ func TestPublishEvent(t *testing.T) {
 		assert.NotNil(t, err)
 	})
 
+	t.Run("with partition key", func(t *testing.T) {
+		err := testClient.PublishEventWithPartitionKey(ctx, "messages", "test", "order-1", []byte("ping"))
+		assert.Nil(t, err)
+		err = testClient.PublishEventWithPartitionKey(ctx, "messages", "test", "", []byte("ping"))
+		assert.NotNil(t, err)
+	})
+
 	t.Run("from struct with text", func(t *testing.T) {
 		testdata := _testStructwithText{
 			Key1: "value1",
@@ -264,6 +264,67 @@ func (c *GRPCClient) ExecuteStateTransaction(ctx context.Context, storeName stri
 	return nil
 }
 
+// ExecuteMultiStoreStateTransaction executes a best-effort transaction across multiple state stores.
+// The returned status tells whether the transaction is committed, rolled back or left inconsistent.
+func (c *GRPCClient) ExecuteMultiStoreStateTransaction(ctx context.Context, req *runtimev1pb.ExecuteMultiStoreStateTransactionRequest) (*runtimev1pb.ExecuteMultiStoreStateTransactionResponse, error) {
+	return c.protoClient.ExecuteMultiStoreStateTransaction(ctx, req)
+}
+
+// CompareAndSwap sets the value of a key only if its current value equals the expected one.
+// An empty expected value means the key should be absent.
+func (c *GRPCClient) CompareAndSwap(ctx context.Context, req *runtimev1pb.CompareAndSwapRequest) (*runtimev1pb.CompareAndSwapResponse, error) {
+	return c.protoClient.CompareAndSwap(ctx, req)
+}
+
+// Increment increases the integer value of a key atomically. The delta is 1 if not set.
+func (c *GRPCClient) Increment(ctx context.Context, req *runtimev1pb.IncrementRequest) (*runtimev1pb.IncrementResponse, error) {
+	return c.protoClient.Increment(ctx, req)
+}
+
+// Decrement decreases the integer value of a key atomically. The delta is 1 if not set.
+func (c *GRPCClient) Decrement(ctx context.Context, req *runtimev1pb.DecrementRequest) (*runtimev1pb.DecrementResponse, error) {
+	return c.protoClient.Decrement(ctx, req)
+}
+
+// DeleteStateByPrefix deletes all the keys starting with the prefix. Confirm must be set to true,
+// and nothing is deleted if more keys than MaxKeys (1000 if not set) match the prefix.
+func (c *GRPCClient) DeleteStateByPrefix(ctx context.Context, req *runtimev1pb.DeleteStateByPrefixRequest) (*runtimev1pb.DeleteStateByPrefixResponse, error) {
+	return c.protoClient.DeleteStateByPrefix(ctx, req)
+}
+
+// QueryState queries the state items by their values. The query is the JSON of the filter, sort and page,
+// and the Token of the response is set to the page.token of the query to get the next page.
+func (c *GRPCClient) QueryState(ctx context.Context, req *runtimev1pb.QueryStateRequest) (*runtimev1pb.QueryStateResponse, error) {
+	return c.protoClient.QueryState(ctx, req)
+}
+
+// CheckAndRecordIdempotency records the processed-marker of a key if it's absent, so the side effects of a message
+// are applied only by the caller getting Recorded true. The marker expires after TtlInSeconds if it's not 0.
+func (c *GRPCClient) CheckAndRecordIdempotency(ctx context.Context, req *runtimev1pb.CheckAndRecordIdempotencyRequest) (*runtimev1pb.CheckAndRecordIdempotencyResponse, error) {
+	return c.protoClient.CheckAndRecordIdempotency(ctx, req)
+}
+
+// CreateSession creates a session with a random id, which expires after TtlInSeconds unless it's accessed.
+func (c *GRPCClient) CreateSession(ctx context.Context, req *runtimev1pb.CreateSessionRequest) (*runtimev1pb.CreateSessionResponse, error) {
+	return c.protoClient.CreateSession(ctx, req)
+}
+
+// GetSession gets a session, the error has the code NotFound if the session is not found or expired.
+func (c *GRPCClient) GetSession(ctx context.Context, req *runtimev1pb.GetSessionRequest) (*runtimev1pb.GetSessionResponse, error) {
+	return c.protoClient.GetSession(ctx, req)
+}
+
+// TouchSession renews a session, whose expire time becomes its ttl later.
+func (c *GRPCClient) TouchSession(ctx context.Context, req *runtimev1pb.TouchSessionRequest) (*runtimev1pb.TouchSessionResponse, error) {
+	return c.protoClient.TouchSession(ctx, req)
+}
+
+// RevokeSession deletes a session, e.g. when the user logs out.
+func (c *GRPCClient) RevokeSession(ctx context.Context, req *runtimev1pb.RevokeSessionRequest) error {
+	_, err := c.protoClient.RevokeSession(ctx, req)
+	return err
+}
+
 // SaveState saves the raw data into store, default options: strong, last-write
 func (c *GRPCClient) SaveState(ctx context.Context, storeName, key string, data []byte, so ...StateOption) error {
 	var stateOptions = new(StateOptions)
@@ -0,0 +1,106 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// ContentTypeMetadataKey is the key of the metadata declaring the content type of the values saved,
+	// and the one expected of the values got. The stores with typed_values record the content types with the values.
+	ContentTypeMetadataKey = "contentType"
+	// ContentTypeJSON is the content type of json values
+	ContentTypeJSON = "application/json"
+	// ContentTypeProtobuf is the content type of the serialized google.protobuf.Any
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// SaveStateJSON saves the value serialized as json, declaring its content type.
+func (c *GRPCClient) SaveStateJSON(ctx context.Context, storeName, key string, v interface{}, so ...StateOption) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling value")
+	}
+	return c.saveTypedState(ctx, storeName, key, data, ContentTypeJSON, so...)
+}
+
+// SaveStateProto saves the message in a google.protobuf.Any, declaring its content type with the type of the message.
+func (c *GRPCClient) SaveStateProto(ctx context.Context, storeName, key string, m proto.Message, so ...StateOption) error {
+	a, err := anypb.New(m)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling message")
+	}
+	data, err := proto.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling message")
+	}
+	return c.saveTypedState(ctx, storeName, key, data, protoContentType(a.TypeUrl), so...)
+}
+
+// GetStateJSON retrieves the json value into v, which is left unchanged if the key isn't found.
+// It fails if the value isn't json.
+func (c *GRPCClient) GetStateJSON(ctx context.Context, storeName, key string, v interface{}) (item *StateItem, err error) {
+	item, err = c.GetStateWithConsistency(ctx, storeName, key, map[string]string{ContentTypeMetadataKey: ContentTypeJSON}, StateConsistencyStrong)
+	if err != nil || len(item.Value) == 0 {
+		return item, err
+	}
+	if err = json.Unmarshal(item.Value, v); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling value")
+	}
+	return item, nil
+}
+
+// GetStateProto retrieves the message saved by SaveStateProto into m, which is left unchanged if the key isn't found.
+// It fails if the value is another type of message.
+func (c *GRPCClient) GetStateProto(ctx context.Context, storeName, key string, m proto.Message) (item *StateItem, err error) {
+	a, err := anypb.New(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling message")
+	}
+	item, err = c.GetStateWithConsistency(ctx, storeName, key, map[string]string{ContentTypeMetadataKey: protoContentType(a.TypeUrl)}, StateConsistencyStrong)
+	if err != nil || len(item.Value) == 0 {
+		return item, err
+	}
+	if err = proto.Unmarshal(item.Value, a); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling value")
+	}
+	if err = a.UnmarshalTo(m); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling value")
+	}
+	return item, nil
+}
+
+func (c *GRPCClient) saveTypedState(ctx context.Context, storeName, key string, data []byte, contentType string, so ...StateOption) error {
+	stateOptions := copyStateOptionDefault()
+	if len(so) > 0 {
+		stateOptions = new(StateOptions)
+		for _, o := range so {
+			o(stateOptions)
+		}
+	}
+	item := &SetStateItem{Key: key, Value: data, Metadata: map[string]string{ContentTypeMetadataKey: contentType}, Options: stateOptions}
+	return c.SaveBulkState(ctx, storeName, item)
+}
+
+func protoContentType(typeURL string) string {
+	return mime.FormatMediaType(ContentTypeProtobuf, map[string]string{"type": typeURL})
+}
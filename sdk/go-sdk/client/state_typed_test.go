@@ -0,0 +1,67 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTypedState(t *testing.T) {
+	ctx := context.Background()
+	store := "test"
+
+	t.Run("json", func(t *testing.T) {
+		type order struct {
+			ID    string `json:"id"`
+			Count int    `json:"count"`
+		}
+		err := testClient.SaveStateJSON(ctx, store, "json", &order{ID: "o1", Count: 2})
+		assert.Nil(t, err)
+		got := &order{}
+		item, err := testClient.GetStateJSON(ctx, store, "json", got)
+		assert.Nil(t, err)
+		assert.Equal(t, "json", item.Key)
+		assert.Equal(t, &order{ID: "o1", Count: 2}, got)
+
+		// left unchanged if the key isn't found
+		item, err = testClient.GetStateJSON(ctx, store, "missing", got)
+		assert.Nil(t, err)
+		assert.Empty(t, item.Value)
+		assert.Equal(t, "o1", got.ID)
+	})
+
+	t.Run("proto", func(t *testing.T) {
+		err := testClient.SaveStateProto(ctx, store, "proto", wrapperspb.String("v"))
+		assert.Nil(t, err)
+		got := &wrapperspb.StringValue{}
+		_, err = testClient.GetStateProto(ctx, store, "proto", got)
+		assert.Nil(t, err)
+		assert.Equal(t, "v", got.Value)
+
+		_, err = testClient.GetStateProto(ctx, store, "proto", &wrapperspb.Int64Value{})
+		assert.NotNil(t, err)
+		_, err = testClient.GetStateJSON(ctx, store, "proto", &map[string]interface{}{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		assert.Equal(t, `application/x-protobuf; type="type.googleapis.com/google.protobuf.StringValue"`,
+			protoContentType("type.googleapis.com/google.protobuf.StringValue"))
+	})
+}
@@ -0,0 +1,72 @@
+//
+// Copyright 2021 Layotto Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	runtimev1pb "mosn.io/layotto/spec/proto/runtime/v1"
+)
+
+// TopicEventHandler processes an event received by SubscribeTopicEvents and returns whether it succeeds.
+type TopicEventHandler func(ctx context.Context, event *runtimev1pb.TopicEventRequest) runtimev1pb.TopicEventResponse_TopicEventResponseStatus
+
+// SubscribeTopicEvents subscribes to the topic and calls the handler with the events until the context is done.
+// It returns nil if the stream is closed by the sidecar.
+func (c *GRPCClient) SubscribeTopicEvents(ctx context.Context, pubsubName, topic string, handler TopicEventHandler) error {
+	if pubsubName == "" {
+		return errors.New("pubsubName name required")
+	}
+	if topic == "" {
+		return errors.New("topic name required")
+	}
+	stream, err := c.protoClient.SubscribeTopicEvents(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error subscribing to %s topic", topic)
+	}
+	err = stream.Send(&runtimev1pb.SubscribeTopicEventsRequest{PubsubName: pubsubName, Topic: topic})
+	if err != nil {
+		return errors.Wrapf(err, "error subscribing to %s topic", topic)
+	}
+	// the first response confirms the subscription
+	if _, err = stream.Recv(); err != nil {
+		return errors.Wrapf(err, "error subscribing to %s topic", topic)
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrapf(err, "error receiving events of %s topic", topic)
+		}
+		if resp.Event == nil {
+			continue
+		}
+		status := handler(ctx, resp.Event)
+		err = stream.Send(&runtimev1pb.SubscribeTopicEventsRequest{Id: resp.Event.Id, Status: status})
+		if err != nil {
+			return errors.Wrapf(err, "error acking event %s of %s topic", resp.Event.Id, topic)
+		}
+	}
+}
+
+func (c *GRPCClient) GetMetadata(ctx context.Context) (*runtimev1pb.GetMetadataResponse, error) {
+	return c.protoClient.GetMetadata(ctx, &runtimev1pb.GetMetadataRequest{})
+}